@@ -56,7 +56,42 @@ import (
 // 34: sim/server refactor, signon flow
 // 35: VFRRunways in sim.State, METAR Wind struct changes
 // 36: STARS center representation changes
-const CurrentConfigVersion = 36
+// 37: tower view, adaptation editor, and EDST panes
+const CurrentConfigVersion = 37
+
+// configMigrations upgrades configs saved with earlier versions. When the
+// representation of something in the config changes, CurrentConfigVersion
+// should be incremented and a step added here (or to the migrations of
+// the pane that changed; see panes.PaneUpgrader).
+var configMigrations = util.NewMigrations(
+	util.Migration[*ConfigNoSim]{
+		Version:     1,
+		Description: "reset display panes",
+		Apply: func(c *ConfigNoSim) {
+			// Force upgrade via upcoming Activate() call...
+			c.DisplayRoot = nil
+		},
+	},
+	util.Migration[*ConfigNoSim]{
+		Version:     5,
+		Description: "clear primary TCP",
+		Apply:       func(c *ConfigNoSim) { c.PrimaryTCP = "" },
+	},
+	util.Migration[*ConfigNoSim]{
+		Version:     29,
+		Description: "TFR cache",
+		Apply:       func(c *ConfigNoSim) { c.TFRCache = av.MakeTFRCache() },
+	},
+	util.Migration[*ConfigNoSim]{
+		Version:     37,
+		Description: "add hidden panes",
+		Apply: func(c *ConfigNoSim) {
+			if c.DisplayRoot != nil {
+				panes.AddHiddenPanes(c.DisplayRoot)
+			}
+		},
+	},
+)
 
 // Slightly convoluted, but the full Config definition is split into
 // the part with the Sim and the rest of it.  In this way, we can first
@@ -83,6 +118,11 @@ type ConfigNoSim struct {
 
 	TFRCache av.TFRCache
 
+	// Redraw less often when there's no user input; see pacing.go.
+	ReduceIdleRendering bool
+
+	Capture panes.CaptureConfig
+
 	AskedDiscordOptIn      bool
 	InhibitDiscordActivity util.AtomicBool
 	NotifiedTargetGenMode  bool
@@ -199,18 +239,10 @@ func LoadOrMakeDefaultConfig(lg *log.Logger) (config *Config, configErr error) {
 			config = getDefaultConfig()
 		}
 
-		if config.Version < 1 {
-			// Force upgrade via upcoming Activate() call...
-			config.DisplayRoot = nil
-		}
-		if config.Version < 5 {
-			config.PrimaryTCP = ""
-		}
-		if config.Version < 29 {
-			config.TFRCache = av.MakeTFRCache()
-		}
-
 		if config.Version < CurrentConfigVersion {
+			for _, step := range configMigrations.Apply(&config.ConfigNoSim, config.Version, CurrentConfigVersion) {
+				lg.Infof("Config upgrade from version %d: %s", config.Version, step)
+			}
 			if config.DisplayRoot != nil {
 				config.DisplayRoot.VisitPanes(func(p panes.Pane) {
 					if up, ok := p.(panes.PaneUpgrader); ok {
@@ -245,6 +277,7 @@ func (gc *Config) Activate(r renderer.Renderer, p platform.Platform, eventStream
 	if gc.DisplayRoot == nil {
 		gc.DisplayRoot = panes.NewDisplayPanes(stars.NewSTARSPane(), panes.NewMessagesPane(),
 			panes.NewFlightStripPane())
+		panes.AddHiddenPanes(gc.DisplayRoot)
 	}
 
 	panes.Activate(gc.DisplayRoot, r, p, eventStream, lg)
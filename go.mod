@@ -20,6 +20,7 @@ require (
 	github.com/shirou/gopsutil v3.21.11+incompatible
 	github.com/tosone/minimp3 v1.0.2
 	github.com/veandco/go-sdl2 v0.5.0-alpha.3.0.20220913133553-3c4862273074
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
 	golang.org/x/exp v0.0.0-20231127185646-65229373498e
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 )
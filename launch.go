@@ -5,6 +5,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"maps"
@@ -25,6 +26,7 @@ import (
 	"github.com/mmp/vice/pkg/renderer"
 	"github.com/mmp/vice/pkg/server"
 	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/swim"
 	"github.com/mmp/vice/pkg/util"
 
 	"github.com/mmp/imgui-go/v4"
@@ -42,6 +44,9 @@ type NewSimConfiguration struct {
 
 	displayError error
 
+	// Comma-separated, as entered; parsed into Federation.RemoteFacilities.
+	federationFacilities string
+
 	mgr            *server.ConnectionManager
 	selectedServer *server.Server
 	defaultTRACON  *string
@@ -288,7 +293,7 @@ func (c *NewSimConfiguration) DrawUI(p platform.Platform) bool {
 			imgui.Text(fmtPosition(c.Scenario.SelectedController))
 			imgui.TableNextRow()
 			imgui.TableNextColumn()
-			imgui.Checkbox("Allow Instructor Sign-ins", &c.InstructorAllowed)
+			imgui.Checkbox("Allow Instructor and Pseudo-Pilot Sign-ins", &c.InstructorAllowed)
 
 			if len(c.Scenario.ArrivalRunways) > 0 {
 				imgui.TableNextRow()
@@ -362,6 +367,61 @@ func (c *NewSimConfiguration) DrawUI(p platform.Platform) bool {
 			uiEndDisable(!c.LiveWeather)
 			imgui.EndTable()
 		}
+
+		if c.NewSimType == server.NewSimCreateLocal {
+			imgui.Checkbox("Connect to FSD network", &c.ConnectNetwork)
+			if c.ConnectNetwork {
+				imgui.InputTextV("Server", &c.Network.Server, 0, nil)
+				imgui.InputTextV("CID", &c.Network.CID, 0, nil)
+				imgui.InputTextV("Network password", &c.Network.Password, 0, nil)
+				imgui.InputTextV("Name", &c.Network.RealName, 0, nil)
+			}
+
+			imgui.Checkbox("Live ADS-B traffic", &c.ConnectADSB)
+			if c.ConnectADSB {
+				imgui.InputTextV("aircraft.json URL or Beast host:port", &c.ADSB.Source, 0, nil)
+			}
+
+			imgui.Checkbox("Export flight data", &c.ExportFlightData)
+			if c.ExportFlightData {
+				if c.Export.Address == "" {
+					c.Export.Address = "localhost:9000"
+				}
+				imgui.InputTextV("Export address", &c.Export.Address, 0, nil)
+				imgui.SameLine()
+				if imgui.RadioButton("JSON", c.Export.Format != swim.FormatXML) {
+					c.Export.Format = swim.FormatJSON
+				}
+				imgui.SameLine()
+				if imgui.RadioButton("XML", c.Export.Format == swim.FormatXML) {
+					c.Export.Format = swim.FormatXML
+				}
+			}
+
+			imgui.Checkbox("Serve live data for overlays", &c.StreamData)
+			if c.StreamData {
+				if c.Stream.Address == "" {
+					c.Stream.Address = "localhost:9001"
+				}
+				imgui.InputTextV("Overlay data address", &c.Stream.Address, 0, nil)
+				if imgui.IsItemHovered() {
+					imgui.SetTooltip("Tracks, statistics, and events are served at /tracks, /stats, and /stream")
+				}
+			}
+
+			imgui.Checkbox("Federate with another sim", &c.Federate)
+			if c.Federate {
+				imgui.InputTextV("Listen address (if the other sim connects)", &c.Federation.Listen, 0, nil)
+				imgui.InputTextV("Other sim's host:port (to connect to it)", &c.Federation.Peer, 0, nil)
+				if imgui.InputTextV("Facilities handled by the other sim", &c.federationFacilities, 0, nil) {
+					c.Federation.RemoteFacilities = strings.Fields(strings.ToUpper(
+						strings.ReplaceAll(c.federationFacilities, ",", " ")))
+				}
+				if imgui.IsItemHovered() {
+					imgui.SetTooltip("E.g., \"ZNY\" or \"N90, PHL\"")
+				}
+			}
+		}
 	} else {
 		// Join remote
 		runningSims := c.mgr.RemoteServer.GetRunningSims()
@@ -466,6 +526,7 @@ func (c *NewSimConfiguration) DrawUI(p platform.Platform) bool {
 		}
 		uiStartDisable(!rs.InstructorAllowed)
 		imgui.Checkbox("Sign-in as Instructor", &c.Instructor)
+		imgui.Checkbox("Sign-in as Pseudo-Pilot", &c.PseudoPilot)
 		uiEndDisable(!rs.InstructorAllowed)
 	}
 
@@ -554,11 +615,18 @@ func refreshWeather() {
 }
 
 func (c *NewSimConfiguration) OkDisabled() bool {
-	return c.NewSimType == server.NewSimCreateRemote && (c.NewSimName == "" || (c.RequirePassword && c.Password == ""))
+	return (c.NewSimType == server.NewSimCreateRemote && (c.NewSimName == "" || (c.RequirePassword && c.Password == ""))) ||
+		(c.NewSimType == server.NewSimCreateLocal &&
+			((c.ConnectNetwork && c.Network.Server == "") || (c.ConnectADSB && c.ADSB.Source == "") ||
+				(c.Federate && ((c.Federation.Listen == "") == (c.Federation.Peer == "") ||
+					len(c.Federation.RemoteFacilities) == 0))))
 }
 
 func (c *NewSimConfiguration) Start() error {
 	c.TFRs = c.tfrCache.TFRsForTRACON(c.TRACONName, c.lg)
+	if *simSeed != 0 && c.NewSimType == server.NewSimCreateLocal {
+		c.Deterministic, c.Seed = true, uint64(*simSeed)
+	}
 
 	if err := c.mgr.CreateNewSim(c.NewSimConfiguration, c.selectedServer); err != nil {
 		c.lg.Errorf("CreateNewSim failed: %v", err)
@@ -676,6 +744,13 @@ func drawDepartureUI(lc *sim.LaunchConfig, p platform.Platform) (changed bool) {
 		changed = imgui.SliderFloatV("VFR reparture rate scale", &lc.VFRDepartureRateScale, 0, 2, "%.1f", imgui.SliderFlagsNoInput) || changed
 	}
 
+	imgui.Separator()
+	changed = imgui.SliderFloatV("Ambient VFR traffic (peak aircraft / hour)", &lc.AmbientVFRRate, 0, 60, "%.0f",
+		imgui.SliderFlagsNoInput) || changed
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Untracked 1200-code aircraft flying around the area; fewer fly early and late in the day")
+	}
+
 	imgui.Separator()
 
 	return
@@ -710,6 +785,41 @@ func drawArrivalUI(lc *sim.LaunchConfig, p platform.Platform) (changed bool) {
 	changed = imgui.SliderFloatV("Arrival/overflight rate scale", &lc.InboundFlowRateScale, 0, 5, "%.1f", imgui.SliderFlagsNoInput) || changed
 
 	changed = imgui.SliderFloatV("Go around probability", &lc.GoAroundRate, 0, 1, "%.02f", 0) || changed
+	changed = imgui.SliderFloatV("Rejected takeoff probability", &lc.RejectedTakeoffRate, 0, 0.2, "%.02f", 0) || changed
+	changed = imgui.SliderFloatV("Flight ID mismatch probability", &lc.FlightIDMismatchRate, 0, 0.2, "%.02f", 0) || changed
+	changed = imgui.SliderFloatV("Airport vehicle runway requests / hour", &lc.VehicleRate, 0, 12, "%.0f",
+		imgui.SliderFlagsNoInput) || changed
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Ops trucks, follow-mes, and snow plows that cross or need time on the runways")
+	}
+	changed = imgui.SliderFloatV("Practice approach requests / hour", &lc.PracticeApproachRate, 0, 12, "%.0f",
+		imgui.SliderFlagsNoInput) || changed
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("GA aircraft calling for practice approaches to the active runways")
+	}
+	changed = imgui.SliderFloatV("Special VFR requests / hour", &lc.SVFRRate, 0, 12, "%.0f",
+		imgui.SliderFlagsNoInput) || changed
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Tower requests for special VFR operations at airports below VFR minimums")
+	}
+
+	year := int32(lc.FleetYear)
+	changed = imgui.SliderInt("Fleet year (0 for current fleets)", &year, 0, int32(time.Now().Year())) || changed
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Airlines only fly the aircraft types that were in service in the given year, favoring the newer ones")
+	}
+	lc.FleetYear = int(year)
+	if lc.FleetYear != 0 && lc.FleetYear < 1960 {
+		lc.FleetYear = 1960
+	}
+
+	changed = imgui.SliderFloatV("Pilot error probability", &lc.PilotErrors.Rate, 0, 0.5, "%.02f", 0) || changed
+	uiStartDisable(lc.PilotErrors.Rate == 0)
+	changed = imgui.SliderFloatV("Pilot error severity", &lc.PilotErrors.Severity, 0, 1, "%.02f", 0) || changed
+	window := int32(util.Select(lc.PilotErrors.CorrectionSeconds == 0, 60, lc.PilotErrors.CorrectionSeconds))
+	changed = imgui.SliderInt("Time to catch pilot errors (seconds)", &window, 10, 180) || changed
+	lc.PilotErrors.CorrectionSeconds = int(window)
+	uiEndDisable(lc.PilotErrors.Rate == 0)
 
 	changed = imgui.Checkbox("Include random arrival pushes", &lc.ArrivalPushes) || changed
 	uiStartDisable(!lc.ArrivalPushes)
@@ -827,6 +937,11 @@ type LaunchControlWindow struct {
 	vfrDepartures       []*LaunchDeparture
 	arrivalsOverflights []*LaunchArrivalOverflight
 	lg                  *log.Logger
+
+	// Scheduled rate change being edited in the UI, with its start
+	// given in minutes from now.
+	newRateChange      sim.RateChange
+	newRateChangeDelay int32
 }
 
 type LaunchDeparture struct {
@@ -943,6 +1058,75 @@ func (lc *LaunchControlWindow) getLastDeparture(airport, runway string) (callsig
 	return
 }
 
+// drawRateScheduleUI draws the UI for scheduling changes to the
+// departure and arrival rate scales, e.g. to have traffic build up to a
+// push and then subside.
+func (lc *LaunchControlWindow) drawRateScheduleUI(p platform.Platform) (changed bool) {
+	config := &lc.controlClient.LaunchConfig
+	now := lc.controlClient.CurrentTime()
+
+	flags := imgui.TableFlagsBordersV | imgui.TableFlagsBordersOuterH | imgui.TableFlagsRowBg | imgui.TableFlagsSizingStretchProp
+	tableScale := util.Select(runtime.GOOS == "windows", p.DPIScale(), float32(1))
+	if len(config.RateSchedule) > 0 && imgui.BeginTableV("schedule", 5, flags, imgui.Vec2{tableScale * 500, 0}, 0) {
+		imgui.TableSetupColumn("Starts")
+		imgui.TableSetupColumn("Ramp")
+		imgui.TableSetupColumn("Departures")
+		imgui.TableSetupColumn("Arrivals")
+		imgui.TableSetupColumn("")
+		imgui.TableHeadersRow()
+
+		del := -1
+		for i, rc := range config.RateSchedule {
+			imgui.PushID(strconv.Itoa(i))
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			if d := rc.Time.Sub(now); d > 0 {
+				imgui.Text(fmt.Sprintf("in %d min", int(d.Minutes()+0.5)))
+			} else {
+				imgui.Text("in progress")
+			}
+			imgui.TableNextColumn()
+			imgui.Text(fmt.Sprintf("%d min", rc.RampMinutes))
+			imgui.TableNextColumn()
+			imgui.Text(fmt.Sprintf("%.1fx", rc.DepartureRateScale))
+			imgui.TableNextColumn()
+			imgui.Text(fmt.Sprintf("%.1fx", rc.InboundFlowRateScale))
+			imgui.TableNextColumn()
+			if imgui.Button(renderer.FontAwesomeIconTrash) {
+				del = i
+			}
+			imgui.PopID()
+		}
+		imgui.EndTable()
+
+		if del != -1 {
+			config.RateSchedule = slices.Delete(config.RateSchedule, del, del+1)
+			changed = true
+		}
+	}
+
+	nrc := &lc.newRateChange
+	if nrc.DepartureRateScale == 0 && nrc.InboundFlowRateScale == 0 {
+		nrc.DepartureRateScale, nrc.InboundFlowRateScale = config.DepartureRateScale, config.InboundFlowRateScale
+	}
+	imgui.InputIntV("Start in (minutes)", &lc.newRateChangeDelay, 5, 15, 0)
+	lc.newRateChangeDelay = math.Max(lc.newRateChangeDelay, 0)
+	ramp := int32(nrc.RampMinutes)
+	imgui.SliderInt("Ramp (minutes)", &ramp, 0, 60)
+	nrc.RampMinutes = int(ramp)
+	imgui.SliderFloatV("Departure rate scale", &nrc.DepartureRateScale, 0, 5, "%.1f", imgui.SliderFlagsNoInput)
+	imgui.SliderFloatV("Arrival/overflight rate scale", &nrc.InboundFlowRateScale, 0, 5, "%.1f", imgui.SliderFlagsNoInput)
+	if imgui.Button("Schedule") {
+		rc := *nrc
+		rc.Time = now.Add(time.Duration(lc.newRateChangeDelay) * time.Minute)
+		config.RateSchedule = append(config.RateSchedule, rc)
+		slices.SortStableFunc(config.RateSchedule, func(a, b sim.RateChange) int { return a.Time.Compare(b.Time) })
+		changed = true
+	}
+
+	return
+}
+
 func (lc *LaunchControlWindow) Draw(eventStream *sim.EventStream, p platform.Platform) {
 	showLaunchControls := true
 	imgui.SetNextWindowSizeConstraints(imgui.Vec2{300, 100}, imgui.Vec2{-1, float32(p.WindowSize()[1]) * 19 / 20})
@@ -1340,6 +1524,9 @@ func (lc *LaunchControlWindow) Draw(eventStream *sim.EventStream, p platform.Pla
 				changed = drawArrivalUI(&lc.controlClient.LaunchConfig, p) || changed
 				changed = drawOverflightUI(&lc.controlClient.LaunchConfig, p) || changed
 			}
+			if imgui.CollapsingHeader("Traffic Schedule") {
+				changed = lc.drawRateScheduleUI(p) || changed
+			}
 
 			if changed {
 				lc.controlClient.SetLaunchConfig(lc.controlClient.LaunchConfig)
@@ -1469,3 +1656,221 @@ func drawScenarioInfoWindow(config *Config, c *server.ControlClient, p platform.
 
 	return show
 }
+
+///////////////////////////////////////////////////////////////////////////
+// ScoreWindow
+
+// ScoreWindow shows how the controllers are doing according to the
+// scenario's scoring rubrics.
+type ScoreWindow struct {
+	report      sim.ScoreReport
+	lastRequest time.Time
+}
+
+func (sw *ScoreWindow) Draw(c *server.ControlClient, p platform.Platform) bool {
+	// The report is cheap to compute but needn't be current to the frame.
+	if time.Since(sw.lastRequest) > 2*time.Second {
+		sw.lastRequest = time.Now()
+		c.GetScoreReport(func(r sim.ScoreReport) { sw.report = r })
+	}
+
+	show := true
+	imgui.BeginV("Controller Performance", &show, imgui.WindowFlagsAlwaysAutoResize)
+
+	r := sw.report
+	imgui.Text(fmt.Sprintf("Score: %.0f / 100", r.Score))
+	if !r.Start.IsZero() {
+		imgui.Text("Session: " + r.Start.Format("15:04:05") + " - " + r.End.Format("15:04:05") +
+			fmt.Sprintf(" (%s)", r.End.Sub(r.Start).Round(time.Second)))
+	}
+	imgui.SameLine()
+	if imgui.Button("Copy report") {
+		if b, err := json.MarshalIndent(r, "", "  "); err == nil {
+			p.GetClipboard().SetText(string(b))
+		}
+	}
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Copy the report to the clipboard as JSON")
+	}
+	imgui.Separator()
+
+	tableFlags := imgui.TableFlagsBordersV | imgui.TableFlagsBordersOuterH |
+		imgui.TableFlagsRowBg | imgui.TableFlagsSizingStretchProp
+	if imgui.BeginTableV("rubrics", 3, tableFlags, imgui.Vec2{}, 0) {
+		imgui.TableSetupColumn("Rubric")
+		imgui.TableSetupColumn("Violations")
+		imgui.TableSetupColumn("Penalty")
+		imgui.TableHeadersRow()
+		for _, res := range r.Rubrics {
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			imgui.Text(res.Name)
+			imgui.TableNextColumn()
+			imgui.Text(strconv.Itoa(len(res.Violations)))
+			imgui.TableNextColumn()
+			imgui.Text(fmt.Sprintf("%.0f", res.Penalty))
+		}
+		imgui.EndTable()
+	}
+
+	for _, res := range r.Rubrics {
+		if len(res.Violations) == 0 {
+			continue
+		}
+		if imgui.CollapsingHeader(res.Name) {
+			if imgui.BeginTableV("violations-"+res.Name, 4, tableFlags, imgui.Vec2{}, 0) {
+				imgui.TableSetupColumn("Time")
+				imgui.TableSetupColumn("Callsign")
+				imgui.TableSetupColumn("Controller")
+				imgui.TableSetupColumn("Details")
+				imgui.TableHeadersRow()
+				for _, v := range res.Violations {
+					imgui.TableNextRow()
+					imgui.TableNextColumn()
+					imgui.Text(v.Time.Format("15:04:05"))
+					imgui.TableNextColumn()
+					imgui.Text(v.Callsign)
+					imgui.TableNextColumn()
+					imgui.Text(v.Controller)
+					imgui.TableNextColumn()
+					imgui.Text(v.Message)
+				}
+				imgui.EndTable()
+			}
+		}
+	}
+
+	if len(r.Compliance) > 0 && imgui.CollapsingHeader("Crossing Restrictions") {
+		if imgui.BeginTableV("compliance", 6, tableFlags, imgui.Vec2{}, 0) {
+			imgui.TableSetupColumn("Time")
+			imgui.TableSetupColumn("Callsign")
+			imgui.TableSetupColumn("Fix")
+			imgui.TableSetupColumn("Restriction")
+			imgui.TableSetupColumn("Crossed")
+			imgui.TableSetupColumn("Result")
+			imgui.TableHeadersRow()
+			for _, rec := range r.Compliance {
+				imgui.TableNextRow()
+				imgui.TableNextColumn()
+				imgui.Text(rec.Time.Format("15:04:05"))
+				imgui.TableNextColumn()
+				imgui.Text(rec.Callsign)
+				imgui.TableNextColumn()
+				imgui.Text(rec.Fix)
+				imgui.TableNextColumn()
+				imgui.Text(rec.Restriction + " (" + rec.Kind + ")")
+				imgui.TableNextColumn()
+				imgui.Text(fmt.Sprintf("%d ft, %d kts", rec.Altitude, rec.IAS))
+				imgui.TableNextColumn()
+				result := util.Select(rec.Compliant, "Met", "Missed")
+				if rec.Warned {
+					result += " (warned)"
+				}
+				imgui.Text(result)
+			}
+			imgui.EndTable()
+		}
+	}
+
+	if hb := r.Hearback; hb.Clearances > 0 && imgui.CollapsingHeader("Readbacks") {
+		imgui.Text(fmt.Sprintf("%d clearances, %d readback errors: %d corrected, %d missed",
+			hb.Clearances, hb.ReadbackErrors, hb.Corrected, hb.Missed))
+		if hb.Corrected > 0 {
+			imgui.Text("Average time to correct: " + hb.MeanLatency.Round(time.Second).String())
+		}
+		if len(hb.Errors) > 0 && imgui.BeginTableV("hearback", 5, tableFlags, imgui.Vec2{}, 0) {
+			imgui.TableSetupColumn("Time")
+			imgui.TableSetupColumn("Callsign")
+			imgui.TableSetupColumn("Controller")
+			imgui.TableSetupColumn("Readback")
+			imgui.TableSetupColumn("Result")
+			imgui.TableHeadersRow()
+			for _, he := range hb.Errors {
+				imgui.TableNextRow()
+				imgui.TableNextColumn()
+				imgui.Text(he.Time.Format("15:04:05"))
+				imgui.TableNextColumn()
+				imgui.Text(he.Callsign)
+				imgui.TableNextColumn()
+				imgui.Text(he.Controller)
+				imgui.TableNextColumn()
+				imgui.Text(he.Description)
+				imgui.TableNextColumn()
+				if he.Corrected {
+					imgui.Text("Corrected in " + he.Latency.Round(time.Second).String())
+				} else if he.Resolved {
+					imgui.Text("Missed")
+				} else {
+					imgui.Text("Pending")
+				}
+			}
+			imgui.EndTable()
+		}
+	}
+
+	if l := r.Lesson; l != nil && imgui.CollapsingHeader("Lesson") {
+		imgui.Text(fmt.Sprintf("%s: %d of %d steps completed", l.Title, l.Completed, l.Steps))
+		if imgui.BeginTableV("lesson", 2, tableFlags, imgui.Vec2{}, 0) {
+			imgui.TableSetupColumn("Step")
+			imgui.TableSetupColumn("Time")
+			imgui.TableHeadersRow()
+			for i, d := range l.StepTimes {
+				imgui.TableNextRow()
+				imgui.TableNextColumn()
+				imgui.Text(strconv.Itoa(i + 1))
+				imgui.TableNextColumn()
+				imgui.Text(d.Round(time.Second).String())
+			}
+			imgui.EndTable()
+		}
+	}
+
+	if len(r.TCAS) > 0 && imgui.CollapsingHeader("TCAS RAs") {
+		if imgui.BeginTableV("tcas", 6, tableFlags, imgui.Vec2{}, 0) {
+			imgui.TableSetupColumn("Time")
+			imgui.TableSetupColumn("Callsign")
+			imgui.TableSetupColumn("Traffic")
+			imgui.TableSetupColumn("RA")
+			imgui.TableSetupColumn("Controller")
+			imgui.TableSetupColumn("Duration")
+			imgui.TableHeadersRow()
+			for _, ra := range r.TCAS {
+				imgui.TableNextRow()
+				imgui.TableNextColumn()
+				imgui.Text(ra.Start.Format("15:04:05"))
+				imgui.TableNextColumn()
+				imgui.Text(ra.Callsign)
+				imgui.TableNextColumn()
+				imgui.Text(ra.Intruder)
+				imgui.TableNextColumn()
+				imgui.Text(ra.Sense + util.Select(ra.Coordinated, " (coordinated)", "") + " at " +
+					av.FormatAltitude(ra.Altitude))
+				imgui.TableNextColumn()
+				imgui.Text(ra.Controller)
+				imgui.TableNextColumn()
+				if ra.End.IsZero() {
+					imgui.Text("in progress")
+				} else {
+					imgui.Text(ra.End.Sub(ra.Start).String())
+				}
+			}
+			imgui.EndTable()
+		}
+	}
+
+	imgui.End()
+	return show
+}
+
+// drawLessonWindow shows the current step of the scenario's lesson.
+func drawLessonWindow(l *sim.LessonStatus) {
+	imgui.BeginV("Lesson: "+l.Title, nil, imgui.WindowFlagsAlwaysAutoResize)
+	if l.Complete {
+		imgui.Text(fmt.Sprintf("All %d steps complete.", l.NumSteps))
+	} else {
+		imgui.Text(fmt.Sprintf("Step %d of %d", l.Step, l.NumSteps))
+		imgui.Separator()
+		imgui.Text(l.Prompt)
+	}
+	imgui.End()
+}
@@ -15,6 +15,7 @@ import (
 	"log/slog"
 	_ "net/http/pprof"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/debug"
 	"strings"
@@ -41,9 +42,10 @@ var (
 	// Command-line options are only used for developer features.
 	cpuprofile        = flag.String("cpuprofile", "", "write CPU profile to file")
 	memprofile        = flag.String("memprofile", "", "write memory profile to this file")
-	logLevel          = flag.String("loglevel", "info", "logging level: debug, info, warn, error")
+	logLevel          = flag.String("loglevel", "info", "logging level: debug, info, warn, error; per-subsystem levels may be given as e.g. \"info,eram=debug\"")
 	logDir            = flag.String("logdir", "", "log file directory")
 	lintScenarios     = flag.Bool("lint", false, "check the validity of the built-in scenarios")
+	validateScenario  = flag.String("validate", "", "run extended checks on the given scenario file, print a JSON report, and exit")
 	runServer         = flag.Bool("runserver", false, "run vice scenario server")
 	serverPort        = flag.Int("port", server.ViceServerPort, "port to listen on when running server")
 	serverAddress     = flag.String("server", server.ViceServerAddress+fmt.Sprintf(":%d", server.ViceServerPort), "IP address of vice multi-controller server")
@@ -53,7 +55,12 @@ var (
 	broadcastPassword = flag.String("password", "", "password to authenticate with server for broadcast message")
 	resetSim          = flag.Bool("resetsim", false, "discard the saved simulation and do not try to resume it")
 	showRoutes        = flag.String("routes", "", "display the STARS, SIDs, and approaches known for the given airport")
+	simSeed           = flag.Int64("seed", 0, "if non-zero, run new local sims deterministically using the given random seed")
 	listMaps          = flag.String("listmaps", "", "path to a video map file to list maps of (e.g., resources/videomaps/ZNY-videomaps.gob.zst)")
+	importSectorFile  = flag.String("importsct", "", "convert the given VRC/Euroscope .sct2 file (and its .ese file) to a video map file and scenario skeleton")
+	importScenario    = flag.String("importscenario", "", "convert the traffic in the given openScope airport .json or Euroscope scenario .txt file to a scenario skeleton")
+	batchScenario     = flag.String("batch", "", "run the given scenario without the UI at full speed, print a JSON report of its traffic, and exit")
+	batchHours        = flag.Float64("batchhours", 4, "number of simulated hours to run the scenario given with -batch")
 )
 
 func init() {
@@ -89,7 +96,30 @@ func main() {
 		*serverAddress += fmt.Sprintf(":%d", server.ViceServerPort)
 	}
 
-	if *lintScenarios {
+	if *validateScenario != "" {
+		report := server.ValidateScenario(*validateScenario, *videoMapFilename, lg)
+		if err := report.Write(os.Stdout); err != nil {
+			lg.Errorf("%v", err)
+		}
+		server.PrintValidationReport(os.Stderr, report)
+		if !report.OK() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	} else if *batchScenario != "" {
+		var e util.ErrorLogger
+		d := time.Duration(*batchHours * float64(time.Hour))
+		report, ok := server.RunBatch(*batchScenario, *scenarioFilename, *videoMapFilename, d, uint64(*simSeed), &e, lg)
+		if !ok {
+			e.PrintErrors(lg)
+			os.Exit(1)
+		}
+		if err := report.Write(os.Stdout); err != nil {
+			lg.Errorf("%v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	} else if *lintScenarios {
 		var e util.ErrorLogger
 		scenarioGroups, _, _ :=
 			server.LoadScenarioGroups(true, *scenarioFilename, *videoMapFilename, &e, lg)
@@ -142,6 +172,20 @@ func main() {
 		if e.HaveErrors() {
 			e.PrintErrors(lg)
 		}
+	} else if *importSectorFile != "" {
+		var e util.ErrorLogger
+		server.ImportSectorFile(*importSectorFile, &e)
+		if e.HaveErrors() {
+			e.PrintErrors(lg)
+			os.Exit(1)
+		}
+	} else if *importScenario != "" {
+		var e util.ErrorLogger
+		server.ImportScenario(*importScenario, &e)
+		if e.HaveErrors() {
+			e.PrintErrors(lg)
+			os.Exit(1)
+		}
 	} else {
 		var stats Stats
 		var render renderer.Renderer
@@ -164,6 +208,7 @@ func main() {
 
 		_ = imguiInit()
 
+		panes.LoadPlugins(filepath.Join(filepath.Dir(configFilePath(lg)), "plugins"), lg)
 		config, configErr := LoadOrMakeDefaultConfig(lg)
 
 		var controlClient *server.ControlClient
@@ -248,6 +293,7 @@ func main() {
 		lg.Info("Starting main loop")
 
 		stats.startTime = time.Now()
+		var pacer framePacer
 		for {
 			plat.SetWindowTitle("vice: " + controlClient.Status())
 
@@ -270,16 +316,19 @@ func main() {
 			mgr.Update(eventStream, lg)
 
 			// Inform imgui about input events from the user.
-			plat.ProcessEvents()
+			pacer.ProcessEvents(plat, config.ReduceIdleRendering)
 
 			stats.redraws++
+			if pacer.Idle() {
+				stats.idleRedraws++
+			}
 
 			plat.NewFrame()
 			imgui.NewFrame()
 
 			// Generate and render vice draw lists
 			stats.drawPanes = panes.DrawPanes(config.DisplayRoot, plat, render, controlClient,
-				ui.menuBarHeight, lg)
+				ui.menuBarHeight, &ui.capture, lg)
 
 			// Draw the user interface
 			stats.drawUI = uiDraw(mgr, config, plat, render, controlClient, eventStream, lg)
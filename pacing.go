@@ -0,0 +1,57 @@
+// pacing.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package main
+
+import (
+	"time"
+
+	"github.com/mmp/vice/pkg/platform"
+)
+
+// vice normally redraws at the display's refresh rate, which is wasteful
+// (and hard on laptop batteries) when nothing is happening: radar tracks
+// only move once a second and most everything else on the screen is
+// static. If reduced idle rendering is enabled, framePacer drops to a low
+// redraw rate once there hasn't been any user input for a few seconds
+// and returns to the full rate as soon as there is.
+
+const (
+	idleAfter = 3 * time.Second
+	// Flashing text in datablocks and lists is on a half-second cycle;
+	// redraw twice as often as that so that it stays regular.
+	idleFrameInterval = 250 * time.Millisecond
+)
+
+type framePacer struct {
+	lastInput time.Time
+	lastFrame time.Time
+	idle      bool
+}
+
+// ProcessEvents handles pending window events, first waiting until it's
+// time for the next frame if the display is idle. It returns true if
+// there was user input.
+func (fp *framePacer) ProcessEvents(plat platform.Platform, reduceIdle bool) bool {
+	fp.idle = reduceIdle && time.Since(fp.lastInput) > idleAfter
+
+	var input bool
+	if fp.idle {
+		input = plat.WaitEvents(idleFrameInterval - time.Since(fp.lastFrame))
+	} else {
+		input = plat.ProcessEvents()
+	}
+
+	fp.lastFrame = time.Now()
+	if input {
+		fp.lastInput = fp.lastFrame
+		fp.idle = false
+	}
+	return input
+}
+
+// Idle reports whether the current frame is being drawn at the idle rate.
+func (fp *framePacer) Idle() bool {
+	return fp.idle
+}
@@ -0,0 +1,272 @@
+// pkg/adsb/adsb.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+// Package adsb provides live traffic from an ADS-B receiver, either from
+// the aircraft.json file that readsb and dump1090 serve over HTTP or from
+// a Beast-format feed of raw Mode S messages.
+package adsb
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/math"
+)
+
+const (
+	// Aircraft are dropped if we haven't received their position for this
+	// long.
+	maxPositionAge = 30 * time.Second
+	pollInterval   = time.Second
+	dialTimeout    = 15 * time.Second
+)
+
+var ErrClosed = errors.New("ADS-B feed closed")
+
+// Config specifies where traffic comes from: either the URL of a
+// readsb/dump1090 aircraft.json (e.g.,
+// "http://raspberrypi/tar1090/data/aircraft.json") or the host:port of a
+// Beast-format feed (e.g., "raspberrypi:30005").
+type Config struct {
+	Source string
+}
+
+func (c Config) isJSON() bool {
+	return strings.HasPrefix(c.Source, "http://") || strings.HasPrefix(c.Source, "https://")
+}
+
+// Aircraft is the latest state of an aircraft received from the feed.
+type Aircraft struct {
+	ICAO       string // 24-bit address, in hex
+	Callsign   string // may be empty if it hasn't been received
+	Squawk     string // may be empty if it hasn't been received
+	Position   math.Point2LL
+	Altitude   float32 // feet, barometric
+	OnGround   bool
+	GS         float32 // knots
+	Track      float32 // true
+	LastUpdate time.Time
+}
+
+// Feed receives traffic in the background; Aircraft returns what has been
+// received so far.
+type Feed struct {
+	config Config
+	lg     *log.Logger
+
+	mu       sync.Mutex
+	aircraft map[string]Aircraft
+	err      error
+	conn     net.Conn
+	done     chan struct{}
+}
+
+func Connect(config Config, lg *log.Logger) *Feed {
+	f := &Feed{
+		config:   config,
+		lg:       lg,
+		aircraft: make(map[string]Aircraft),
+		done:     make(chan struct{}),
+	}
+	if config.isJSON() {
+		go f.pollJSON()
+	} else {
+		go f.readBeast()
+	}
+	return f
+}
+
+// Aircraft returns the aircraft with recent positions, sorted by ICAO
+// address.
+func (f *Feed) Aircraft() []Aircraft {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var ac []Aircraft
+	for icao, a := range f.aircraft {
+		if time.Since(a.LastUpdate) > maxPositionAge {
+			delete(f.aircraft, icao)
+		} else {
+			ac = append(ac, a)
+		}
+	}
+	slices.SortFunc(ac, func(a, b Aircraft) int { return strings.Compare(a.ICAO, b.ICAO) })
+	return ac
+}
+
+// Err returns the error that ended the feed, if it has ended.
+func (f *Feed) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *Feed) Close() {
+	f.fail(ErrClosed)
+}
+
+func (f *Feed) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err == nil {
+		f.lg.Warnf("adsb: %v", err)
+		f.err = err
+		if f.conn != nil {
+			f.conn.Close()
+		}
+		close(f.done)
+	}
+}
+
+func (f *Feed) update(ac Aircraft) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aircraft[ac.ICAO] = ac
+}
+
+///////////////////////////////////////////////////////////////////////////
+// aircraft.json
+
+type jsonAircraft struct {
+	Hex      string          `json:"hex"`
+	Flight   string          `json:"flight"`
+	Squawk   string          `json:"squawk"`
+	AltBaro  json.RawMessage `json:"alt_baro"`
+	Altitude json.RawMessage `json:"altitude"` // older versions of dump1090
+	GS       *float32        `json:"gs"`
+	Speed    *float32        `json:"speed"` // older versions of dump1090
+	Track    float32         `json:"track"`
+	Lat      *float32        `json:"lat"`
+	Lon      *float32        `json:"lon"`
+	SeenPos  float32         `json:"seen_pos"`
+}
+
+type jsonAircraftFile struct {
+	Aircraft []jsonAircraft `json:"aircraft"`
+}
+
+func (f *Feed) pollJSON() {
+	defer f.lg.CatchAndReportCrash()
+
+	client := http.Client{Timeout: 5 * time.Second}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.fetchJSON(&client); err != nil {
+			// Keep trying; the receiver may be restarting.
+			f.lg.Warnf("adsb: %s: %v", f.config.Source, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-f.done:
+			return
+		}
+	}
+}
+
+func (f *Feed) fetchJSON(client *http.Client) error {
+	resp, err := client.Get(f.config.Source)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+
+	var file jsonAircraftFile
+	if err := json.NewDecoder(resp.Body).Decode(&file); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, ja := range file.Aircraft {
+		if ac, ok := ja.aircraft(now); ok {
+			f.update(ac)
+		}
+	}
+	return nil
+}
+
+func (ja jsonAircraft) aircraft(now time.Time) (Aircraft, bool) {
+	if ja.Lat == nil || ja.Lon == nil || ja.SeenPos > float32(maxPositionAge.Seconds()) {
+		return Aircraft{}, false
+	}
+
+	ac := Aircraft{
+		ICAO:       strings.ToUpper(strings.TrimPrefix(ja.Hex, "~")),
+		Callsign:   strings.TrimSpace(ja.Flight),
+		Squawk:     ja.Squawk,
+		Position:   math.Point2LL{*ja.Lon, *ja.Lat},
+		Track:      ja.Track,
+		LastUpdate: now.Add(-time.Duration(ja.SeenPos * float32(time.Second))),
+	}
+	if ja.GS != nil {
+		ac.GS = *ja.GS
+	} else if ja.Speed != nil {
+		ac.GS = *ja.Speed
+	}
+
+	// Altitudes are either a number of feet or "ground".
+	alt := ja.AltBaro
+	if len(alt) == 0 {
+		alt = ja.Altitude
+	}
+	if s := strings.Trim(string(alt), `"`); s == "ground" {
+		ac.OnGround = true
+	} else if v, err := strconv.ParseFloat(s, 32); err == nil {
+		ac.Altitude = float32(v)
+	}
+
+	return ac, true
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Beast
+
+func (f *Feed) readBeast() {
+	defer f.lg.CatchAndReportCrash()
+
+	conn, err := net.DialTimeout("tcp", f.config.Source, dialTimeout)
+	if err != nil {
+		f.fail(err)
+		return
+	}
+	f.mu.Lock()
+	if f.err != nil {
+		// Close was called while we were dialing.
+		f.mu.Unlock()
+		conn.Close()
+		return
+	}
+	f.conn = conn
+	f.mu.Unlock()
+	f.lg.Infof("adsb: connected to %s", f.config.Source)
+
+	r := bufio.NewReader(conn)
+	d := makeDecoder()
+	for {
+		msg, err := readBeastFrame(r)
+		if err != nil {
+			f.fail(err)
+			return
+		}
+		if ac, ok := d.decode(msg, time.Now()); ok {
+			f.update(ac)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// pkg/adsb/adsb_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package adsb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/math"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	d := makeDecoder()
+	now := time.Now()
+
+	// Identification
+	if _, ok := d.decode(mustDecodeHex(t, "8D4840D6202CC371C32CE0576098"), now); ok {
+		t.Errorf("expected no aircraft before a position is received")
+	}
+	if cs := d.aircraft[0x4840d6].Callsign; cs != "KLM1023" {
+		t.Errorf("got callsign %q, expected KLM1023", cs)
+	}
+
+	// Corrupted messages are ignored
+	bad := mustDecodeHex(t, "8D4840D6202CC371C32CE0576098")
+	bad[5] ^= 1
+	d.decode(bad, now)
+	if cs := d.aircraft[0x4840d6].Callsign; cs != "KLM1023" {
+		t.Errorf("got callsign %q after corrupted message", cs)
+	}
+
+	// Airborne position: odd then even
+	if _, ok := d.decode(mustDecodeHex(t, "8D40621D58C386435CC412692AD6"), now); ok {
+		t.Errorf("expected no position from a single report")
+	}
+	ac, ok := d.decode(mustDecodeHex(t, "8D40621D58C382D690C8AC2863A7"), now.Add(time.Second))
+	if !ok {
+		t.Fatalf("expected position")
+	}
+	if ac.ICAO != "40621D" || ac.Altitude != 38000 || ac.OnGround {
+		t.Errorf("got %+v", ac)
+	}
+	if math.NMDistance2LL(ac.Position, math.Point2LL{3.91937, 52.25720}) > 0.05 {
+		t.Errorf("got position %v, expected [3.91937 52.25720]", ac.Position)
+	}
+
+	// Velocity
+	d.decode(mustDecodeHex(t, "8D485020994409940838175B284F"), now)
+	tr := d.aircraft[0x485020]
+	if tr.GS < 159 || tr.GS > 159.5 || tr.Track < 182.5 || tr.Track > 183.2 {
+		t.Errorf("got GS %f track %f, expected 159.2, 182.88", tr.GS, tr.Track)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	// Squawks are encoded by interleaving their bits.
+	encode := func(a, b, c, d uint32) uint32 {
+		var id uint32
+		set := func(v uint32, bit uint32, pos uint) {
+			if v&bit != 0 {
+				id |= 1 << pos
+			}
+		}
+		set(c, 1, 12)
+		set(a, 1, 11)
+		set(c, 2, 10)
+		set(a, 2, 9)
+		set(c, 4, 8)
+		set(a, 4, 7)
+		set(b, 1, 5)
+		set(d, 1, 4)
+		set(b, 2, 3)
+		set(d, 2, 2)
+		set(b, 4, 1)
+		set(d, 4, 0)
+		return id
+	}
+
+	for _, sq := range [][4]uint32{{1, 2, 0, 0}, {7, 7, 0, 0}, {4, 5, 2, 1}, {0, 0, 0, 0}} {
+		expected := string([]byte{byte('0' + sq[0]), byte('0' + sq[1]), byte('0' + sq[2]), byte('0' + sq[3])})
+		if got := decodeIdentity(encode(sq[0], sq[1], sq[2], sq[3])); got != expected {
+			t.Errorf("got squawk %s, expected %s", got, expected)
+		}
+	}
+}
+
+func TestBeastFrame(t *testing.T) {
+	msg := mustDecodeHex(t, "8D4840D6202CC371C32CE0576098")
+	var buf bytes.Buffer
+	buf.Write([]byte{0x55, 0x1a, '4', 0, 1}) // junk and an unused frame type
+	buf.Write([]byte{0x1a, '3', 0, 0, 0x1a, 0x1a, 0, 0, 0, 0x40})
+	buf.Write(msg)
+
+	f, err := readBeastFrame(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !bytes.Equal(f, msg) {
+		t.Errorf("got %x, expected %x", f, msg)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var file jsonAircraftFile
+	err := json.Unmarshal([]byte(`{"now":1700000000,"aircraft":[
+{"hex":"a1b2c3","flight":"AAL123  ","alt_baro":5000,"gs":250.5,"track":270.1,"lat":40.6,"lon":-73.7,"squawk":"4521","seen_pos":1.5},
+{"hex":"~abcdef","alt_baro":"ground","lat":40.64,"lon":-73.78,"seen_pos":0},
+{"hex":"123456","flight":"NOPOS"}]}`), &file)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	now := time.Now()
+	var ac []Aircraft
+	for _, ja := range file.Aircraft {
+		if a, ok := ja.aircraft(now); ok {
+			ac = append(ac, a)
+		}
+	}
+	if len(ac) != 2 {
+		t.Fatalf("got %d aircraft, expected 2", len(ac))
+	}
+	if a := ac[0]; a.ICAO != "A1B2C3" || a.Callsign != "AAL123" || a.Altitude != 5000 || a.Squawk != "4521" ||
+		a.GS != 250.5 || a.OnGround || a.Position != (math.Point2LL{-73.7, 40.6}) {
+		t.Errorf("got %+v", a)
+	}
+	if a := ac[1]; a.ICAO != "ABCDEF" || !a.OnGround || a.Callsign != "" {
+		t.Errorf("got %+v", a)
+	}
+}
+
+func TestCloseWhileConnecting(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Skipf("unable to listen: %v", err)
+	}
+	defer l.Close()
+
+	lg := &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	f := Connect(Config{Source: l.Addr().String()}, lg)
+	f.Close()
+
+	// However the dial and Close were ordered, the feed's end of the
+	// connection should be closed.
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
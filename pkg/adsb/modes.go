@@ -0,0 +1,327 @@
+// pkg/adsb/modes.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package adsb
+
+import (
+	"bufio"
+	"fmt"
+	gomath "math"
+	"strings"
+	"time"
+
+	"github.com/mmp/vice/pkg/math"
+)
+
+///////////////////////////////////////////////////////////////////////////
+// Beast framing
+
+// Beast frames start with 0x1a and a type byte, followed by a 6-byte
+// timestamp, a signal level byte, and the message. 0x1a bytes in the rest
+// of the frame are doubled.
+const beastEscape = 0x1a
+
+var beastMessageLength = map[byte]int{
+	'1': 2,  // Mode A/C
+	'2': 7,  // Mode S short
+	'3': 14, // Mode S long
+}
+
+// readBeastFrame returns the message from the next Beast frame, skipping
+// over frames of types we don't use and anything that's garbled.
+func readBeastFrame(r *bufio.Reader) ([]byte, error) {
+	synced := false // whether we've just read a frame-starting 0x1a
+	for {
+		if !synced {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if b != beastEscape {
+				continue
+			}
+		}
+		synced = false
+
+		t, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n, ok := beastMessageLength[t]
+		if !ok {
+			continue
+		}
+
+		frame := make([]byte, 0, 7+n)
+		for len(frame) < cap(frame) {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if b == beastEscape {
+				if b, err = r.ReadByte(); err != nil {
+					return nil, err
+				}
+				if b != beastEscape {
+					// An unescaped 0x1a starts a new frame.
+					r.UnreadByte()
+					synced = true
+					break
+				}
+			}
+			frame = append(frame, b)
+		}
+		if len(frame) == cap(frame) {
+			return frame[7:], nil
+		}
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Mode S decoding
+
+// decoder keeps the state across messages that's needed to decode
+// positions and to identify the senders of messages that don't include
+// their address.
+type decoder struct {
+	aircraft map[uint32]*track
+}
+
+type track struct {
+	Aircraft
+	cpr [2]cprPosition // even, odd
+}
+
+type cprPosition struct {
+	lat, lon float64 // [0,1)
+	t        time.Time
+}
+
+// Even and odd position reports must be this close in time to be combined.
+const maxCPRInterval = 10 * time.Second
+
+func makeDecoder() decoder {
+	return decoder{aircraft: make(map[uint32]*track)}
+}
+
+// decode updates the decoder's state from the message and returns the
+// updated aircraft if it has a position.
+func (d *decoder) decode(msg []byte, now time.Time) (Aircraft, bool) {
+	if len(msg) != 7 && len(msg) != 14 {
+		return Aircraft{}, false
+	}
+
+	var tr *track
+	switch df := msg[0] >> 3; df {
+	case 17, 18:
+		if len(msg) != 14 || crc(msg) != parity(msg) {
+			return Aircraft{}, false
+		}
+		icao := uint32(msg[1])<<16 | uint32(msg[2])<<8 | uint32(msg[3])
+		if tr = d.aircraft[icao]; tr == nil {
+			tr = &track{Aircraft: Aircraft{ICAO: fmt.Sprintf("%06X", icao)}}
+			d.aircraft[icao] = tr
+		}
+		tr.decodeExtendedSquitter(msg[4:11], now)
+
+	case 4, 5, 20, 21:
+		// The address is XORed into the parity, so we can only use these
+		// for aircraft we've already heard from.
+		if tr = d.aircraft[crc(msg)^parity(msg)]; tr == nil {
+			return Aircraft{}, false
+		}
+		id := uint32(msg[2]&0x1f)<<8 | uint32(msg[3])
+		if df == 5 || df == 21 {
+			tr.Squawk = decodeIdentity(id)
+		} else if alt, ok := decodeAltitude13(id); ok {
+			tr.Altitude = float32(alt)
+		}
+
+	default:
+		return Aircraft{}, false
+	}
+
+	if tr.LastUpdate.IsZero() {
+		// No position yet.
+		return Aircraft{}, false
+	}
+	return tr.Aircraft, true
+}
+
+func (tr *track) decodeExtendedSquitter(me []byte, now time.Time) {
+	var v uint64
+	for _, b := range me {
+		v = v<<8 | uint64(b)
+	}
+
+	switch tc := me[0] >> 3; {
+	case tc >= 1 && tc <= 4:
+		tr.Callsign = decodeCallsign(v)
+
+	case tc >= 5 && tc <= 8:
+		// Surface position; decoding it requires a reference location,
+		// so we only note that the aircraft is on the ground.
+		tr.OnGround = true
+
+	case tc >= 9 && tc <= 18:
+		tr.OnGround = false
+		if alt, ok := decodeAltitude12(uint32(v>>36) & 0xfff); ok {
+			tr.Altitude = float32(alt)
+		}
+		odd := (v >> 34) & 1
+		tr.cpr[odd] = cprPosition{
+			lat: float64((v>>17)&0x1ffff) / 131072,
+			lon: float64(v&0x1ffff) / 131072,
+			t:   now,
+		}
+		if p, ok := decodeCPR(tr.cpr[0], tr.cpr[1], odd == 1); ok {
+			tr.Position = p
+			tr.LastUpdate = now
+		}
+
+	case tc == 19:
+		if st := (v >> 48) & 7; st == 1 || st == 2 {
+			vew, vns := float32((v>>32)&0x3ff), float32((v>>21)&0x3ff)
+			if vew == 0 || vns == 0 {
+				// Not available
+				return
+			}
+			vx, vy := vew-1, vns-1
+			if (v>>42)&1 == 1 {
+				vx = -vx
+			}
+			if (v>>31)&1 == 1 {
+				vy = -vy
+			}
+			if st == 2 {
+				// Supersonic
+				vx, vy = 4*vx, 4*vy
+			}
+			tr.GS = math.Sqrt(vx*vx + vy*vy)
+			tr.Track = math.NormalizeHeading(math.Degrees(math.Atan2(vx, vy)))
+		}
+	}
+}
+
+// The CRC-24 of the message, not including the 24-bit parity field at its
+// end.
+func crc(msg []byte) uint32 {
+	var c uint32
+	for _, b := range msg[:len(msg)-3] {
+		c ^= uint32(b) << 16
+		for range 8 {
+			c <<= 1
+			if c&0x1000000 != 0 {
+				c ^= 0x1fff409
+			}
+		}
+	}
+	return c & 0xffffff
+}
+
+func parity(msg []byte) uint32 {
+	n := len(msg)
+	return uint32(msg[n-3])<<16 | uint32(msg[n-2])<<8 | uint32(msg[n-1])
+}
+
+const callsignChars = "#ABCDEFGHIJKLMNOPQRSTUVWXYZ##### ###############0123456789######"
+
+func decodeCallsign(me uint64) string {
+	var b strings.Builder
+	for i := range 8 {
+		b.WriteByte(callsignChars[(me>>(42-6*i))&0x3f])
+	}
+	return strings.TrimSpace(strings.ReplaceAll(b.String(), "#", ""))
+}
+
+// The 12-bit altitude field in airborne position messages; only 25-foot
+// increments (Q bit set) are handled.
+func decodeAltitude12(alt uint32) (int, bool) {
+	if alt&0x10 == 0 {
+		return 0, false
+	}
+	n := (alt>>5)<<4 | alt&0xf
+	return int(n)*25 - 1000, true
+}
+
+// The 13-bit altitude field in surveillance replies, which also has an M
+// bit for metric altitudes.
+func decodeAltitude13(ac uint32) (int, bool) {
+	if ac&0x40 != 0 || ac&0x10 == 0 {
+		return 0, false
+	}
+	n := (ac&0x1f80)>>2 | (ac&0x20)>>1 | ac&0xf
+	return int(n)*25 - 1000, true
+}
+
+// The 13-bit identity field's bits are interleaved: C1 A1 C2 A2 C4 A4 X
+// B1 D1 B2 D2 B4 D4.
+func decodeIdentity(id uint32) string {
+	bit := func(i uint) uint32 { return (id >> i) & 1 }
+	a := bit(7)<<2 | bit(9)<<1 | bit(11)
+	b := bit(1)<<2 | bit(3)<<1 | bit(5)
+	c := bit(8)<<2 | bit(10)<<1 | bit(12)
+	d := bit(0)<<2 | bit(2)<<1 | bit(4)
+	return fmt.Sprintf("%d%d%d%d", a, b, c, d)
+}
+
+// decodeCPR returns the position given by a pair of even and odd airborne
+// position reports using the globally unambiguous decoding; oddLatest
+// indicates which of them was received most recently.
+func decodeCPR(even, odd cprPosition, oddLatest bool) (math.Point2LL, bool) {
+	if even.t.IsZero() || odd.t.IsZero() || even.t.Sub(odd.t).Abs() > maxCPRInterval {
+		return math.Point2LL{}, false
+	}
+
+	const dLatEven, dLatOdd = 360. / 60, 360. / 59
+	j := gomath.Floor(59*even.lat - 60*odd.lat + 0.5)
+	latEven := dLatEven * (mod(j, 60) + even.lat)
+	latOdd := dLatOdd * (mod(j, 59) + odd.lat)
+	if latEven >= 270 {
+		latEven -= 360
+	}
+	if latOdd >= 270 {
+		latOdd -= 360
+	}
+	if cprNL(latEven) != cprNL(latOdd) {
+		// The aircraft crossed a longitude zone boundary between the
+		// reports; wait for the next pair.
+		return math.Point2LL{}, false
+	}
+
+	lat, lon := latEven, even.lon
+	nl := cprNL(latEven)
+	ni := max(nl, 1)
+	if oddLatest {
+		lat, lon = latOdd, odd.lon
+		ni = max(nl-1, 1)
+	}
+	m := gomath.Floor(even.lon*float64(nl-1) - odd.lon*float64(nl) + 0.5)
+	lon = 360 / float64(ni) * (mod(m, float64(ni)) + lon)
+	if lon >= 180 {
+		lon -= 360
+	}
+
+	return math.Point2LL{float32(lon), float32(lat)}, true
+}
+
+func mod(a, b float64) float64 {
+	return a - b*gomath.Floor(a/b)
+}
+
+// cprNL returns the number of longitude zones at the given latitude.
+func cprNL(lat float64) int {
+	const nz = 15
+	lat = gomath.Abs(lat)
+	switch {
+	case lat == 0:
+		return 59
+	case lat == 87:
+		return 2
+	case lat > 87:
+		return 1
+	}
+	c := gomath.Cos(gomath.Pi / 180 * lat)
+	return int(gomath.Floor(2 * gomath.Pi / gomath.Acos(1-(1-gomath.Cos(gomath.Pi/(2*nz)))/(c*c))))
+}
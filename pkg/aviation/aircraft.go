@@ -24,6 +24,10 @@ type Aircraft struct {
 	// callsigns; however, the ADS-B callsign is transmitted from the
 	// aircraft and would be the same to all facilities.
 	Callsign string
+	// FlightID is what the aircraft's Mode S transponder or ADS-B out
+	// actually downlinks; it's entered by the pilot and so may not match
+	// Callsign. It is empty for aircraft without Mode S.
+	FlightID string
 
 	Scratchpad          string
 	SecondaryScratchpad string
@@ -42,6 +46,7 @@ type Aircraft struct {
 	SPCOverride                 string
 	PilotReportedAltitude       int
 	InhibitModeCAltitudeDisplay bool
+	DeclaredPriority            PriorityFlags // minimum fuel or emergency
 
 	HoldForRelease   bool
 	Released         bool // only used for hold for release
@@ -92,6 +97,20 @@ func (ac *Aircraft) NewFlightPlan(r FlightRules, acType, dep, arr string) *Fligh
 	}
 }
 
+// FlightIDMismatch returns whether the aircraft is downlinking a flight
+// ID that differs from its callsign.
+func (ac *Aircraft) FlightIDMismatch() bool {
+	return ac.FlightID != "" && ac.FlightID != ac.Callsign
+}
+
+// Priority returns the flight's priority status, both filed and declared.
+func (ac *Aircraft) Priority() PriorityFlags {
+	if ac.FlightPlan == nil {
+		return ac.DeclaredPriority
+	}
+	return ac.FlightPlan.FiledPriority() | ac.DeclaredPriority
+}
+
 func (ac *Aircraft) TAS() float32 {
 	return ac.Nav.TAS()
 }
@@ -170,12 +189,12 @@ func (ac *Aircraft) transmitResponse(r PilotResponse) []RadioTransmission {
 	}}
 }
 
-func (ac *Aircraft) Update(wind WindModel, lg *log.Logger) *Waypoint {
+func (ac *Aircraft) Update(wind WindModel, simTime time.Time, lg *log.Logger) *Waypoint {
 	if lg != nil {
 		lg = lg.With(slog.String("callsign", ac.Callsign))
 	}
 
-	passedWaypoint := ac.Nav.Update(wind, ac.FlightPlan, lg)
+	passedWaypoint := ac.Nav.Update(wind, ac.FlightPlan, simTime, lg)
 	if passedWaypoint != nil {
 		lg.Info("passed", slog.Any("waypoint", passedWaypoint))
 
@@ -235,29 +254,33 @@ func (ac *Aircraft) ExpediteClimb() []RadioTransmission {
 	return ac.transmitResponse(ac.Nav.ExpediteClimb())
 }
 
-func (ac *Aircraft) AssignHeading(heading int, turn TurnMethod) []RadioTransmission {
-	resp := ac.Nav.AssignHeading(float32(heading), turn)
+func (ac *Aircraft) AssignHeading(heading int, turn TurnMethod, simTime time.Time) []RadioTransmission {
+	resp := ac.Nav.AssignHeading(float32(heading), turn, simTime)
 	return ac.transmitResponse(resp)
 }
 
-func (ac *Aircraft) TurnLeft(deg int) []RadioTransmission {
+func (ac *Aircraft) TurnLeft(deg int, simTime time.Time) []RadioTransmission {
 	hdg := math.NormalizeHeading(ac.Nav.FlightState.Heading - float32(deg))
-	ac.Nav.AssignHeading(hdg, TurnLeft)
-	return ac.readback(rand.Sample("turn %d degrees left", "%d to the left"), deg)
+	ac.Nav.AssignHeading(hdg, TurnLeft, simTime)
+	return ac.readback(rand.SampleWith(&ac.Nav.Rand, "turn %d degrees left", "%d to the left"), deg)
 }
 
-func (ac *Aircraft) TurnRight(deg int) []RadioTransmission {
+func (ac *Aircraft) TurnRight(deg int, simTime time.Time) []RadioTransmission {
 	hdg := math.NormalizeHeading(ac.Nav.FlightState.Heading + float32(deg))
-	ac.Nav.AssignHeading(hdg, TurnRight)
-	return ac.readback(rand.Sample("turn %d degrees right", "%d to the right"), deg)
+	ac.Nav.AssignHeading(hdg, TurnRight, simTime)
+	return ac.readback(rand.SampleWith(&ac.Nav.Rand, "turn %d degrees right", "%d to the right"), deg)
+}
+
+func (ac *Aircraft) FlyPresentHeading(simTime time.Time) []RadioTransmission {
+	return ac.transmitResponse(ac.Nav.FlyPresentHeading(simTime))
 }
 
-func (ac *Aircraft) FlyPresentHeading() []RadioTransmission {
-	return ac.transmitResponse(ac.Nav.FlyPresentHeading())
+func (ac *Aircraft) DirectFix(fix string, simTime time.Time) []RadioTransmission {
+	return ac.transmitResponse(ac.Nav.DirectFix(strings.ToUpper(fix), simTime))
 }
 
-func (ac *Aircraft) DirectFix(fix string) []RadioTransmission {
-	return ac.transmitResponse(ac.Nav.DirectFix(strings.ToUpper(fix)))
+func (ac *Aircraft) Hold(fix string, loc math.Point2LL, rightTurns bool, efc, simTime time.Time) []RadioTransmission {
+	return ac.transmitResponse(ac.Nav.Hold(strings.ToUpper(fix), loc, rightTurns, efc, simTime))
 }
 
 func (ac *Aircraft) DepartFixHeading(fix string, hdg int) []RadioTransmission {
@@ -276,6 +299,9 @@ func (ac *Aircraft) CrossFixAt(fix string, ar *AltitudeRestriction, speed int) [
 }
 
 func (ac *Aircraft) ExpectApproach(id string, ap *Airport, lg *log.Logger) []RadioTransmission {
+	if appr, ok := ap.Approaches[id]; ok && appr.Type == RNAVApproach && !ac.FlightPlan.RNAVCapable() {
+		return ac.readbackUnexpected("unable. We're not RNAV equipped.")
+	}
 	resp := ac.Nav.ExpectApproach(ap, id, ac.STARRunwayWaypoints, lg)
 	return ac.transmitResponse(resp)
 }
@@ -308,12 +334,12 @@ func (ac *Aircraft) CancelApproachClearance() []RadioTransmission {
 	return ac.transmitResponse(ac.Nav.CancelApproachClearance())
 }
 
-func (ac *Aircraft) ClimbViaSID() []RadioTransmission {
-	return ac.transmitResponse(ac.Nav.ClimbViaSID())
+func (ac *Aircraft) ClimbViaSID(simTime time.Time) []RadioTransmission {
+	return ac.transmitResponse(ac.Nav.ClimbViaSID(simTime))
 }
 
-func (ac *Aircraft) DescendViaSTAR() []RadioTransmission {
-	return ac.transmitResponse(ac.Nav.DescendViaSTAR())
+func (ac *Aircraft) DescendViaSTAR(simTime time.Time) []RadioTransmission {
+	return ac.transmitResponse(ac.Nav.DescendViaSTAR(simTime))
 }
 
 func (ac *Aircraft) ContactTower(lg *log.Logger) []RadioTransmission {
@@ -343,7 +369,7 @@ func (ac *Aircraft) InterceptApproach() []RadioTransmission {
 }
 
 func (ac *Aircraft) InitializeArrival(ap *Airport, arr *Arrival, arrivalHandoffController string, goAround bool,
-	nmPerLongitude float32, magneticVariation float32, wind WindModel, lg *log.Logger) error {
+	nmPerLongitude float32, magneticVariation float32, wind WindModel, r *rand.Rand, lg *log.Logger) error {
 	ac.STAR = arr.STAR
 	ac.STARRunwayWaypoints = arr.RunwayWaypoints[ac.FlightPlan.ArrivalAirport]
 	ac.Scratchpad = arr.Scratchpad
@@ -370,7 +396,7 @@ func (ac *Aircraft) InitializeArrival(ap *Airport, arr *Arrival, arrivalHandoffC
 	}
 
 	if goAround && ac.FlightPlan.Rules == IFR { // VFRs don't go around since they aren't talking to us.
-		d := 0.1 + .6*rand.Float32()
+		d := 0.1 + .6*r.Float32()
 		ac.GoAroundDistance = &d
 	}
 
@@ -398,7 +424,7 @@ func (ac *Aircraft) InitializeDeparture(ap *Airport, departureAirport string, de
 	runway string, exitRoute ExitRoute, nmPerLongitude float32,
 	magneticVariation float32, scratchpads map[string]string,
 	primaryController string, multiControllers SplitConfiguration,
-	wind WindModel, lg *log.Logger) error {
+	wind WindModel, r *rand.Rand, lg *log.Logger) error {
 	wp := util.DuplicateSlice(exitRoute.Waypoints)
 	wp = append(wp, dep.RouteWaypoints...)
 	wp = util.FilterSliceInPlace(wp, func(wp Waypoint) bool { return !wp.Location.IsZero() })
@@ -422,7 +448,7 @@ func (ac *Aircraft) InitializeDeparture(ap *Airport, departureAirport string, de
 	ac.SecondaryScratchpad = dep.SecondaryScratchpad
 	ac.FlightPlan.Exit = dep.Exit
 
-	idx := rand.SampleFiltered(dep.Altitudes, func(alt int) bool { return alt <= int(perf.Ceiling) })
+	idx := rand.SampleFilteredWith(r, dep.Altitudes, func(alt int) bool { return alt <= int(perf.Ceiling) })
 	if idx == -1 {
 		ac.FlightPlan.Altitude =
 			PlausibleFinalAltitude(ac.FlightPlan, perf, nmPerLongitude, magneticVariation)
@@ -462,7 +488,7 @@ func (ac *Aircraft) InitializeDeparture(ap *Airport, departureAirport string, de
 		}
 
 		ac.DepartureContactAltitude =
-			ac.Nav.FlightState.DepartureAirportElevation + 500 + float32(rand.Intn(500))
+			ac.Nav.FlightState.DepartureAirportElevation + 500 + float32(r.Intn(500))
 		ac.DepartureContactAltitude = math.Min(ac.DepartureContactAltitude, float32(ac.FlightPlan.Altitude))
 		ac.DepartureContactController = ctrl
 	}
@@ -536,11 +562,11 @@ func (ac *Aircraft) ContactMessage(reportingPoints []ReportingPoint) string {
 	return ac.Nav.ContactMessage(reportingPoints, ac.STAR)
 }
 
-func (ac *Aircraft) DepartOnCourse(lg *log.Logger) {
+func (ac *Aircraft) DepartOnCourse(simTime time.Time, lg *log.Logger) {
 	if ac.FlightPlan.Exit == "" {
 		lg.Warn("unset \"exit\" for departure", slog.String("callsign", ac.Callsign))
 	}
-	ac.Nav.DepartOnCourse(float32(ac.FlightPlan.Altitude), ac.FlightPlan.Exit)
+	ac.Nav.DepartOnCourse(float32(ac.FlightPlan.Altitude), ac.FlightPlan.Exit, simTime)
 }
 
 func (ac *Aircraft) Check(lg *log.Logger) {
@@ -658,8 +684,8 @@ func (ac *Aircraft) CWT() string {
 func PlausibleFinalAltitude(fp *FlightPlan, perf AircraftPerformance, nmPerLongitude float32,
 	magneticVariation float32) (altitude int) {
 	// try to figure out direction of flight
-	dep, dok := DB.Airports[fp.DepartureAirport]
-	arr, aok := DB.Airports[fp.ArrivalAirport]
+	dep, dok := DB.Airports()[fp.DepartureAirport]
+	arr, aok := DB.Airports()[fp.ArrivalAirport]
 	if !dok || !aok {
 		return 34000
 	}
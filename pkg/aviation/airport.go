@@ -47,6 +47,18 @@ type Airport struct {
 	ATPAVolumes           map[string]*ATPAVolume `json:"atpa_volumes"`
 	OmitArrivalScratchpad bool                   `json:"omit_arrival_scratchpad"`
 	DepartureRunwaysAsOne []string               `json:"departure_runways_as_one"`
+
+	// Optional: OpenStreetMap XML file in the resources directory that
+	// describes the airport's taxiways, runways, and gates.
+	SurfaceFile string `json:"surface_file,omitempty"`
+	surface     *Surface
+
+	// Optional: tower cab location and height above the field for the
+	// tower view; the airport location and a typical height are used
+	// otherwise.
+	TowerCabString string        `json:"tower_cab,omitempty"`
+	TowerCab       math.Point2LL // not specified in user JSON
+	TowerCabHeight int           `json:"tower_cab_height,omitempty"`
 }
 
 type VFRRandomsSpec struct {
@@ -190,7 +202,7 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 	facilityAirports map[string]*Airport, e *util.ErrorLogger) {
 	defer e.CheckDepth(e.CurrentDepth())
 
-	if info, ok := DB.Airports[icao]; !ok {
+	if info, ok := DB.Airports()[icao]; !ok {
 		e.ErrorString("airport %q not found in airport database", icao)
 	} else {
 		ap.Location = info.Location
@@ -212,9 +224,9 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 		}
 
 		if appr.Id != "" {
-			if dbAppr, ok := DB.Airports[icao].Approaches[appr.Id]; !ok {
+			if dbAppr, ok := DB.Airports()[icao].Approaches()[appr.Id]; !ok {
 				e.ErrorString("Approach %q not in database. Options: %s", appr.Id,
-					strings.Join(util.SortedMapKeys(DB.Airports[icao].Approaches), ", "))
+					strings.Join(util.SortedMapKeys(DB.Airports()[icao].Approaches()), ", "))
 				e.Pop()
 				continue
 			} else {
@@ -234,16 +246,31 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 				for _, wps := range dbAppr.Waypoints {
 					appr.Waypoints = append(appr.Waypoints, util.DuplicateSlice(wps))
 				}
+				if len(appr.MissedApproach) == 0 {
+					appr.MissedApproach = util.DuplicateSlice(dbAppr.MissedApproach)
+				}
+				if appr.MissedApproachAltitude == 0 {
+					appr.MissedApproachAltitude = dbAppr.MissedApproachAltitude
+				}
 			}
 		}
 
+		if len(appr.MissedApproach) > 0 {
+			e.Push("\"missed_approach\"")
+			appr.MissedApproach.InitializeLocations(loc, nmPerLongitude, magneticVariation, e)
+			e.Pop()
+		}
+		if appr.MissedApproachAltitude < 0 {
+			e.ErrorString("\"missed_approach_altitude\" must be positive")
+		}
+
 		if appr.Runway == "" {
 			e.ErrorString("Must specify \"runway\"")
 		}
 		rwy, ok := LookupRunway(icao, appr.Runway)
 		if !ok {
 			e.ErrorString("\"runway\" %q is unknown. Options: %s", appr.Runway,
-				DB.Airports[icao].ValidRunways())
+				DB.Airports()[icao].ValidRunways())
 		}
 
 		for i := range appr.Waypoints {
@@ -302,6 +329,33 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 			e.ErrorString("Only a single set of waypoints are allowed for a charted visual approach route")
 		}
 
+		if appr.Type == ChartedVisualApproach {
+			for _, fix := range util.SortedMapKeys(appr.Landmarks) {
+				found := false
+				for i := range appr.Waypoints {
+					for j := range appr.Waypoints[i] {
+						if appr.Waypoints[i][j].Fix == fix {
+							appr.Waypoints[i][j].Landmark = appr.Landmarks[fix]
+							found = true
+						}
+					}
+				}
+				if !found {
+					e.ErrorString("%s: landmark fix not found in approach's \"waypoints\"", fix)
+				}
+			}
+			if appr.DayOnly && appr.NightOnly {
+				e.ErrorString("Only one of \"day_only\" and \"night_only\" may be given")
+			}
+			if appr.MinimumCeiling < 0 || appr.MinimumVisibility < 0 {
+				e.ErrorString("\"minimum_ceiling\" and \"minimum_visibility\" must not be negative")
+			}
+		} else if len(appr.Landmarks) > 0 || appr.DayOnly || appr.NightOnly || appr.MinimumCeiling != 0 ||
+			appr.MinimumVisibility != 0 {
+			e.ErrorString("\"landmarks\", \"day_only\", \"night_only\", \"minimum_ceiling\", and " +
+				"\"minimum_visibility\" may only be given for charted visual approaches")
+		}
+
 		e.Pop()
 	}
 
@@ -398,7 +452,7 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 			}
 		}
 
-		if _, ok := DB.Airports[dep.Destination]; !ok {
+		if _, ok := DB.Airports()[dep.Destination]; !ok {
 			e.ErrorString("destination airport %q unknown", dep.Destination)
 		}
 
@@ -409,7 +463,7 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 		// Make sure that all runways have a route to the exit
 		for rwy := range ap.DepartureRoutes {
 			if _, ok := LookupRunway(icao, rwy); !ok {
-				e.ErrorString("runway %q is unknown. Options: %s", rwy, DB.Airports[icao].ValidRunways())
+				e.ErrorString("runway %q is unknown. Options: %s", rwy, DB.Airports()[icao].ValidRunways())
 			}
 		}
 
@@ -500,7 +554,7 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 		} else {
 			spec.Waypoints[len(spec.Waypoints)-1].Land = true
 		}
-		if _, ok := DB.Airports[spec.Destination]; !ok {
+		if _, ok := DB.Airports()[spec.Destination]; !ok {
 			e.ErrorString("Destination airport %q unknown", spec.Destination)
 		}
 		e.Pop()
@@ -509,7 +563,7 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 
 	// Check if airport has VFR departures but is in class B or C airspace
 	if ap.VFR.Randoms.Rate > 0 || len(ap.VFR.Routes) > 0 {
-		elevation := DB.Airports[icao].Elevation
+		elevation := DB.Airports()[icao].Elevation
 		checkAllVolumes := func(volsIter iter.Seq[[]AirspaceVolume]) bool {
 			return util.SeqContainsFunc(volsIter, func(vols []AirspaceVolume) bool {
 				return slices.ContainsFunc(vols, func(vol AirspaceVolume) bool {
@@ -537,7 +591,7 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 		for _, rwy := range runways {
 			rwy = strings.TrimSpace(rwy)
 			if _, ok := LookupRunway(icao, rwy); !ok {
-				e.ErrorString("runway %q is unknown. Options: %s", rwy, DB.Airports[icao].ValidRunways())
+				e.ErrorString("runway %q is unknown. Options: %s", rwy, DB.Airports()[icao].ValidRunways())
 			}
 			if seenRunways[rwy] {
 				e.ErrorString("runway %q appears in multiple groups", rwy)
@@ -553,7 +607,7 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 
 		if _, ok := LookupRunway(icao, rwy); !ok {
 			e.ErrorString("runway %q is unknown. Options: %s", rwy,
-				DB.Airports[icao].ValidRunways())
+				DB.Airports()[icao].ValidRunways())
 		}
 
 		if !slices.ContainsFunc(ap.ConvergingRunways,
@@ -569,7 +623,7 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 
 		for _, rwy := range pair.Runways {
 			if _, ok := LookupRunway(icao, rwy); !ok {
-				e.ErrorString("runway %q is unknown. Options: %s", rwy, DB.Airports[icao].ValidRunways())
+				e.ErrorString("runway %q is unknown. Options: %s", rwy, DB.Airports()[icao].ValidRunways())
 			}
 		}
 
@@ -616,7 +670,7 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 	if ap.ATPAVolumes == nil {
 		ap.ATPAVolumes = make(map[string]*ATPAVolume)
 	}
-	for _, rwy := range DB.Airports[icao].Runways {
+	for _, rwy := range DB.Airports()[icao].Runways {
 		if _, ok := ap.ATPAVolumes[rwy.Id]; !ok {
 			// Make a default volume
 			ap.ATPAVolumes[rwy.Id] = &ATPAVolume{
@@ -635,7 +689,7 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 		}
 
 		if _, ok := LookupRunway(icao, rwy); !ok {
-			e.ErrorString("runway %q is unknown. Options: %s", rwy, DB.Airports[icao].ValidRunways())
+			e.ErrorString("runway %q is unknown. Options: %s", rwy, DB.Airports()[icao].ValidRunways())
 		}
 
 		if vol.Threshold.IsZero() { // the location is set directly for default volumes
@@ -654,10 +708,10 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 			vol.MaxHeadingDeviation = 90
 		}
 		if vol.Floor == 0 {
-			vol.Floor = float32(DB.Airports[icao].Elevation + 100)
+			vol.Floor = float32(DB.Airports()[icao].Elevation + 100)
 		}
 		if vol.Ceiling == 0 {
-			vol.Ceiling = float32(DB.Airports[icao].Elevation + 5000)
+			vol.Ceiling = float32(DB.Airports()[icao].Elevation + 5000)
 		}
 		if vol.Length == 0 {
 			vol.Length = 15
@@ -671,6 +725,44 @@ func (ap *Airport) PostDeserialize(icao string, loc Locator, nmPerLongitude floa
 
 		e.Pop()
 	}
+
+	if ap.TowerCabString != "" {
+		var ok bool
+		if ap.TowerCab, ok = loc.Locate(ap.TowerCabString); !ok {
+			e.ErrorString("%q unknown for \"tower_cab\"", ap.TowerCabString)
+		}
+	}
+	if ap.TowerCabHeight < 0 {
+		e.ErrorString("\"tower_cab_height\" must be positive")
+	}
+
+	if ap.SurfaceFile != "" {
+		e.Push("\"surface_file\"")
+		if _, err := util.GetResourcesFS().Stat(ap.SurfaceFile); err != nil {
+			e.Error(err)
+		} else {
+			r := util.LoadResource(ap.SurfaceFile)
+			if ap.surface, err = LoadOSMSurface(r, nmPerLongitude); err != nil {
+				e.Error(err)
+			} else {
+				for _, rwy := range ap.surface.Runways {
+					for _, id := range rwy.Ids {
+						if _, ok := LookupRunway(icao, id); !ok {
+							e.ErrorString("runway %q is unknown. Options: %s", id, DB.Airports()[icao].ValidRunways())
+						}
+					}
+				}
+			}
+			r.Close()
+		}
+		e.Pop()
+	}
+}
+
+// Surface returns the airport's surface model, if one was given via
+// "surface_file".
+func (ap *Airport) Surface() *Surface {
+	return ap.surface
 }
 
 func (ap Airport) VFRRateSum() int {
@@ -776,6 +868,48 @@ type Approach struct {
 	// Note: this isn't currently documented; currently it's only set when
 	// we have a canonical value from the CIFP.
 	ApproachHeading float32 `json:"approach_heading"`
+
+	// The missed approach procedure: the fixes to fly after going around
+	// and the altitude to climb to. If they aren't given, aircraft fly
+	// runway heading and climb to 2,500' above the airport.
+	MissedApproach         WaypointArray `json:"missed_approach,omitempty"`
+	MissedApproachAltitude int           `json:"missed_approach_altitude,omitempty"`
+
+	// The following are only for charted visual approaches. Landmarks
+	// describes what's at the route's fixes (e.g., "Citi Field") for the
+	// fixes that pilots fly to by eye. The approach may only be available
+	// during the day or at night and in weather at or above the given
+	// ceiling (feet AGL) and visibility (statute miles).
+	Landmarks         map[string]string `json:"landmarks,omitempty"`
+	DayOnly           bool              `json:"day_only,omitempty"`
+	NightOnly         bool              `json:"night_only,omitempty"`
+	MinimumCeiling    int               `json:"minimum_ceiling,omitempty"`
+	MinimumVisibility float32           `json:"minimum_visibility,omitempty"`
+}
+
+// VisualUnavailable returns why a charted visual approach can't be flown
+// given whether it's daytime and the airport's weather, if it can't be; it
+// returns an empty string otherwise. Weather that isn't reported isn't
+// considered.
+func (ap *Approach) VisualUnavailable(daytime bool, metar *METAR) string {
+	if ap.Type != ChartedVisualApproach {
+		return ""
+	}
+	if ap.DayOnly && !daytime {
+		return "it's only flown during the day"
+	}
+	if ap.NightOnly && daytime {
+		return "it's only flown at night"
+	}
+	if metar != nil {
+		if ap.MinimumCeiling > 0 && metar.Ceiling > 0 && metar.Ceiling < ap.MinimumCeiling {
+			return fmt.Sprintf("the ceiling is below %s", FormatAltitude(float32(ap.MinimumCeiling)))
+		}
+		if ap.MinimumVisibility > 0 && metar.Visibility > 0 && metar.Visibility < ap.MinimumVisibility {
+			return fmt.Sprintf("the visibility is below %g miles", ap.MinimumVisibility)
+		}
+	}
+	return ""
 }
 
 // Find the FAF: return the corresponding waypoint array and the index of the FAF within it.
@@ -43,6 +43,14 @@ func parseAltitude(s []byte) int {
 	return parseInt(s)
 }
 
+// tryParseAltitude returns 0 for blank or unknown ("UNKNN") altitudes.
+func tryParseAltitude(s []byte) int {
+	if v, err := strconv.Atoi(strings.TrimSpace(string(s))); err == nil {
+		return v
+	}
+	return 0
+}
+
 func printColumnHeader() {
 	for i := 0; i < ARINC424LineLength/10; i++ {
 		fmt.Printf("         |")
@@ -51,6 +59,15 @@ func printColumnHeader() {
 }
 
 func ParseARINC424(r io.Reader) (map[string]FAAAirport, map[string]Navaid, map[string]Fix, map[string][]Airway) {
+	return parseARINC424(r, nil)
+}
+
+// parseARINC424 parses the ARINC 424 records from the given reader. If
+// deferProcedure is non-nil, it is called with each STAR and approach
+// record; if it returns true, the record is not parsed, leaving it to
+// the caller to parse it later (see procedures.go).
+func parseARINC424(r io.Reader, deferProcedure func(icao string, line []byte) bool) (map[string]FAAAirport,
+	map[string]Navaid, map[string]Fix, map[string][]Airway) {
 	start := time.Now()
 
 	airports := make(map[string]FAAAirport)
@@ -113,6 +130,13 @@ func ParseARINC424(r io.Reader) (map[string]FAAAirport, map[string]Navaid, map[s
 		lines = append(lines, line)
 	}
 
+	// "RW04L" -> "4L"
+	tidyRunway := func(s []byte) string {
+		rwy := strings.TrimPrefix(string(s), "RW")
+		rwy = strings.TrimPrefix(rwy, "0")
+		return strings.TrimSpace(rwy)
+	}
+
 	// returns array of ssaRecords for all lines starting at the given one
 	// that are airport records with the same subsection.
 	matchingSSARecs := func(line []byte, recs []ssaRecord) []ssaRecord {
@@ -229,9 +253,11 @@ func ParseARINC424(r io.Reader) (map[string]FAAAirport, map[string]Navaid, map[s
 				}()
 
 				fix := AirwayFix{
-					Fix:       strings.TrimSpace(string(line[29:34])),
-					Level:     level,
-					Direction: direction,
+					Fix:             strings.TrimSpace(string(line[29:34])),
+					Level:           level,
+					Direction:       direction,
+					MinimumAltitude: tryParseAltitude(line[83:88]),
+					MaximumAltitude: tryParseAltitude(line[93:98]),
 				}
 				airwayWIP[seq] = fix
 
@@ -285,39 +311,45 @@ func ParseARINC424(r io.Reader) (map[string]FAAAirport, map[string]Navaid, map[s
 			case 'D': // SID 4.1.9
 
 			case 'E': // STAR 4.1.9
+				if deferProcedure != nil && deferProcedure(icao, line) {
+					break
+				}
 				recs = matchingSSARecs(line, recs)
 				id := recs[0].id
 				if star := parseSTAR(recs); star != nil {
-					if airports[icao].STARs == nil {
+					if airports[icao].stars == nil {
 						ap := airports[icao]
-						ap.STARs = make(map[string]STAR)
+						ap.stars = make(map[string]STAR)
 						airports[icao] = ap
 					}
-					if _, ok := airports[icao].STARs[id]; ok {
+					if _, ok := airports[icao].stars[id]; ok {
 						panic("already seen STAR id " + id)
 					}
 
-					airports[icao].STARs[id] = *star
+					airports[icao].stars[id] = *star
 				}
 
 			case 'F': // Approach 4.1.9
+				if deferProcedure != nil && deferProcedure(icao, line) {
+					break
+				}
 				recs = matchingSSARecs(line, recs)
 
 				if appr := parseApproach(recs); appr != nil {
 					// Note: database.Airports isn't initialized yet but
 					// the CIFP file is sorted so we get the airports
 					// before the approaches..
-					if airports[icao].Approaches == nil {
+					if airports[icao].approaches == nil {
 						ap := airports[icao]
-						ap.Approaches = make(map[string]Approach)
+						ap.approaches = make(map[string]Approach)
 						airports[icao] = ap
 					}
 
-					if _, ok := airports[icao].Approaches[appr.Id]; ok {
+					if _, ok := airports[icao].approaches[appr.Id]; ok {
 						panic("already seen approach id " + appr.Id)
 					}
 
-					airports[icao].Approaches[appr.Id] = *appr
+					airports[icao].approaches[appr.Id] = *appr
 				}
 
 			case 'G': // runway records 4.1.10
@@ -330,19 +362,80 @@ func ParseARINC424(r io.Reader) (map[string]FAAAirport, map[string]Navaid, map[s
 					continue
 				}
 
-				rwy := string(line[13:18])
-				rwy = strings.TrimPrefix(rwy, "RW")
-				rwy = strings.TrimPrefix(rwy, "0")
-				rwy = strings.TrimSpace(rwy)
-
 				ap := airports[icao]
 				ap.Runways = append(ap.Runways, Runway{
-					Id:        rwy,
+					Id:        tidyRunway(line[13:18]),
 					Heading:   float32(parseInt(line[27:31])) / 10,
 					Threshold: parseLatLong(line[32:41], line[41:51]),
 					Elevation: parseInt(line[66:71]),
 				})
 				airports[icao] = ap
+
+			case 'S': // MSA 4.1.24
+				if line[38] != '0' && line[38] != '1' {
+					continue
+				}
+
+				msa := MSA{
+					Center:           strings.TrimSpace(string(line[13:18])),
+					MagneticBearings: line[119] != 'T',
+				}
+
+				// The center may be a runway threshold, a terminal or
+				// enroute waypoint, or a navaid.
+				ap := airports[icao]
+				ok := false
+				if line[20] == 'P' && line[21] == 'G' {
+					rwy := tidyRunway(line[13:18])
+					if idx := slices.IndexFunc(ap.Runways, func(r Runway) bool { return r.Id == rwy }); idx != -1 {
+						msa.Location, ok = ap.Runways[idx].Threshold, true
+					}
+				} else if n, nok := navaids[msa.Center]; nok {
+					msa.Location, ok = n.Location, true
+				} else if f, fok := fixes[string(line[13:18])]; fok {
+					msa.Location, ok = f.Location, true
+				} else if f, fok := fixes[msa.Center]; fok {
+					msa.Location, ok = f.Location, true
+				}
+				if !ok {
+					// Most likely a terminal NDB, which we don't parse.
+					continue
+				}
+
+				// Up to 7 sectors, each a pair of bearings, an altitude
+				// in hundreds of feet, and a radius.
+				for i := 42; i+11 <= 119 && !empty(line[i:i+11]); i += 11 {
+					sec := line[i : i+11]
+					msa.Sectors = append(msa.Sectors, MSASector{
+						FromBearing: float32(parseInt(sec[0:3])),
+						ToBearing:   float32(parseInt(sec[3:6])),
+						Altitude:    100 * parseInt(sec[6:9]),
+						Radius:      float32(parseInt(sec[9:11])),
+					})
+				}
+				ap.MSAs = append(ap.MSAs, msa)
+				airports[icao] = ap
+
+			case 'V': // communications 4.1.20
+				if line[25] != '0' && line[25] != '1' {
+					continue
+				}
+				if units := line[24]; units != 'V' && units != 'U' && units != 'C' {
+					// Skip HF frequencies
+					continue
+				}
+				freq, err := strconv.Atoi(string(line[16:23])) // units of 100Hz
+				if err != nil {
+					continue
+				}
+
+				ap := airports[icao]
+				ap.Frequencies = append(ap.Frequencies, AirportFrequency{
+					Type:      strings.TrimSpace(string(line[13:16])),
+					Frequency: Frequency(freq / 10),
+					Callsign:  strings.TrimSpace(string(line[98:123])),
+				})
+				airports[icao] = ap
 			}
 		}
 
@@ -708,6 +801,8 @@ func parseApproach(recs []ssaRecord) *Approach {
 		}
 	}
 
+	appr.MissedApproach, appr.MissedApproachAltitude = parseMissedApproach(recs)
+
 	if len(transitions) == 1 {
 		appr.Waypoints = []WaypointArray{transitions[""]}
 	} else {
@@ -728,3 +823,34 @@ func parseApproach(recs []ssaRecord) *Approach {
 
 	return &appr
 }
+
+// parseMissedApproach returns the fixes of an approach's missed approach
+// procedure, which follows the missed approach point in the final
+// approach records, along with the highest altitude given along it.
+// Legs that don't end at a fix (climbs on a heading, etc.) only
+// contribute their altitude.
+func parseMissedApproach(recs []ssaRecord) (WaypointArray, int) {
+	var wps WaypointArray
+	alt := 0
+	missed := false
+	for _, r := range recs {
+		if r.transition != "" || (r.continuation != '0' && r.continuation != '1') {
+			continue
+		}
+		if !missed {
+			missed = r.waypointDescription[0] == 'G' || r.waypointDescription[3] == 'M'
+			continue
+		}
+
+		if !empty(r.alt0) {
+			alt = max(alt, parseAltitude(r.alt0))
+		}
+		switch string(r.pathAndTermination) {
+		case "IF", "TF", "CF", "DF", "HA", "HF", "HM":
+			if r.fix != "" && (len(wps) == 0 || wps[len(wps)-1].Fix != r.fix) {
+				wps = append(wps, Waypoint{Fix: r.fix})
+			}
+		}
+	}
+	return wps, alt
+}
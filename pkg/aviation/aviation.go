@@ -11,10 +11,12 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mmp/vice/pkg/math"
 	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/units"
 	"github.com/mmp/vice/pkg/util"
 )
 
@@ -26,6 +28,9 @@ type ReportingPoint struct {
 type InboundFlow struct {
 	Arrivals    []Arrival    `json:"arrivals"`
 	Overflights []Overflight `json:"overflights"`
+	// Overflights are generated from these and added to Overflights; see
+	// route.go.
+	BoundaryFixFlows []BoundaryFixFlow `json:"boundary_fix_flows"`
 }
 
 type Arrival struct {
@@ -56,6 +61,9 @@ type AirlineSpecifier struct {
 	ICAO          string   `json:"icao"`
 	Fleet         string   `json:"fleet,omitempty"`
 	AircraftTypes []string `json:"types,omitempty"`
+	// Profile gives a traffic profile to use instead of an airline; see
+	// profiles.go.
+	Profile string `json:"profile,omitempty"`
 }
 
 type ArrivalAirline struct {
@@ -64,7 +72,9 @@ type ArrivalAirline struct {
 }
 
 func (a AirlineSpecifier) Aircraft() []FleetAircraft {
-	if a.Fleet == "" && len(a.AircraftTypes) == 0 {
+	if p, ok := TrafficProfiles[a.Profile]; ok && len(a.AircraftTypes) == 0 {
+		return p.Fleet
+	} else if a.Fleet == "" && len(a.AircraftTypes) == 0 {
 		return DB.Airlines[strings.ToUpper(a.ICAO)].Fleets["default"]
 	} else if a.Fleet != "" {
 		return DB.Airlines[strings.ToUpper(a.ICAO)].Fleets[a.Fleet]
@@ -80,27 +90,43 @@ func (a AirlineSpecifier) Aircraft() []FleetAircraft {
 func (a *AirlineSpecifier) Check(e *util.ErrorLogger) {
 	defer e.CheckDepth(e.CurrentDepth())
 
-	e.Push("Airline " + a.ICAO)
-	defer e.Pop()
-
-	al, ok := DB.Airlines[strings.ToUpper(a.ICAO)]
-	if !ok {
-		e.ErrorString("airline not known")
-		return
-	}
-
-	if a.Fleet == "" && len(a.AircraftTypes) == 0 {
-		a.Fleet = "default"
-	}
-	if a.Fleet != "" {
-		if len(a.AircraftTypes) != 0 {
-			e.ErrorString("cannot specify both \"fleet\" and \"types\"")
+	if a.Profile != "" {
+		e.Push("Profile " + a.Profile)
+		defer e.Pop()
+		if !a.checkProfile(e) {
 			return
 		}
-		if _, ok := al.Fleets[a.Fleet]; !ok {
-			e.ErrorString("\"fleet\" %s unknown", a.Fleet)
+	} else {
+		e.Push("Airline " + a.ICAO)
+		defer e.Pop()
+
+		al, ok := DB.Airlines[strings.ToUpper(a.ICAO)]
+		if !ok {
+			e.ErrorString("airline not known")
 			return
 		}
+
+		if a.Fleet == "" && len(a.AircraftTypes) == 0 {
+			a.Fleet = "default"
+		}
+		if a.Fleet != "" {
+			if len(a.AircraftTypes) != 0 {
+				e.ErrorString("cannot specify both \"fleet\" and \"types\"")
+				return
+			}
+			if _, ok := al.Fleets[a.Fleet]; !ok {
+				e.ErrorString("\"fleet\" %s unknown", a.Fleet)
+				return
+			}
+		}
+	}
+
+	// Substitute for types given in the scenario that aren't in the
+	// performance database; the fleets have already been taken care of.
+	for i, ty := range a.AircraftTypes {
+		if sub, ok := SubstituteAircraftType(ty); ok {
+			a.AircraftTypes[i] = sub
+		}
 	}
 
 	for _, ac := range a.Aircraft() {
@@ -221,6 +247,21 @@ type FlightPlan struct {
 	Exit                   string
 	Route                  string
 	Remarks                string
+
+	// Items from ICAO flight plans; see fpl.go.
+	FlightType             string // S, N, G, M, or X
+	WakeCategory           string // L, M, H, or J
+	Equipment              string // item 10a
+	Surveillance           string // item 10b
+	SecondAlternateAirport string
+	OtherInfo              string // item 18, without remarks
+
+	// Indicators from item 18 and the remarks; set by ParseRemarks.
+	// (They're not slices so that flight plans can be compared.)
+	DateOfFlight time.Time // DOF/
+	PBN          string    // PBN/ navigation specification codes, e.g. "A1B1D2"
+	MinimumRVR   int       // RVR/, in meters
+	STS          string    // STS/ special handling, e.g. "MEDEVAC ALTRV"
 }
 
 type FlightStrip struct {
@@ -290,22 +331,7 @@ type RadarTrack struct {
 }
 
 func FormatAltitude(falt float32) string {
-	alt := int(falt)
-	if alt >= 18000 {
-		return "FL" + strconv.Itoa(alt/100)
-	} else if alt < 1000 {
-		return strconv.Itoa(alt)
-	} else {
-		th := alt / 1000
-		hu := (alt % 1000) / 100 * 100
-		if th == 0 {
-			return strconv.Itoa(hu)
-		} else if hu == 0 {
-			return strconv.Itoa(th) + ",000"
-		} else {
-			return fmt.Sprintf("%d,%03d", th, hu)
-		}
-	}
+	return units.Feet(falt).String()
 }
 
 type TransponderMode int
@@ -360,6 +386,72 @@ type RadarSite struct {
 	SecondaryRange int32   `json:"secondary_range"`
 	SlopeAngle     float32 `json:"slope_angle"`
 	SilenceAngle   float32 `json:"silence_angle"`
+
+	// RotationRate only matters when the site is used for a single-sensor
+	// display, which updates at the site's scan rate. BeaconOnly and
+	// TerrainShadows limit the site's coverage in CheckVisibility and so
+	// apply in all display modes.
+	RotationRate   float32       `json:"rotation_rate"` // seconds per antenna revolution
+	BeaconOnly     bool          `json:"beacon_only"`   // no primary radar
+	TerrainShadows []RadarShadow `json:"terrain_shadows"`
+}
+
+// RadarShadow describes a sector where terrain blocks a radar site's
+// coverage below an altitude.
+type RadarShadow struct {
+	Bearings [2]float32 `json:"bearings"` // true bearings from the site; the sector runs clockwise from the first to the second
+	Altitude int32      `json:"altitude"`
+	Range    float32    `json:"range"` // nm from the site where the shadow starts
+}
+
+// DefaultRadarRotationRate is the rotation period in seconds used for
+// radar sites that don't specify one; it's that of an ASR-9.
+const DefaultRadarRotationRate = 4.8
+
+// ScanInterval returns the time between successive updates of a target by
+// the site.
+func (rs *RadarSite) ScanInterval() time.Duration {
+	rate := util.Select(rs.RotationRate > 0, rs.RotationRate, DefaultRadarRotationRate)
+	return time.Duration(rate * float32(time.Second))
+}
+
+// bearing returns the true bearing from the site to the point.
+func (rs *RadarSite) bearing(p math.Point2LL) float32 {
+	nmPerLongitude := math.NMPerLatitude * math.Cos(math.Radians(rs.Position[1]))
+	return math.Heading2LL(rs.Position, p, nmPerLongitude, 0)
+}
+
+// InTerrainShadow returns whether terrain blocks the site's view of the
+// given position and altitude.
+func (rs *RadarSite) InTerrainShadow(p math.Point2LL, altitude int) bool {
+	if len(rs.TerrainShadows) == 0 {
+		return false
+	}
+
+	hdg := rs.bearing(p)
+	dist := math.NMDistance2LL(rs.Position, p)
+	return slices.ContainsFunc(rs.TerrainShadows, func(sh RadarShadow) bool {
+		if altitude >= int(sh.Altitude) || dist < sh.Range {
+			return false
+		}
+		// Measure clockwise from the start of the sector.
+		return math.NormalizeHeading(hdg-sh.Bearings[0]) <= math.NormalizeHeading(sh.Bearings[1]-sh.Bearings[0])
+	})
+}
+
+// SlantRangePosition returns where a single-sensor display shows a target
+// at the given position and altitude: the radar measures the slant range
+// to the target but the display treats it as the ground range, so targets
+// are shown farther from the site than they actually are, especially when
+// they are high and close.
+func (rs *RadarSite) SlantRangePosition(p math.Point2LL, altitude int) math.Point2LL {
+	ground := math.NMDistance2LL(rs.Position, p)
+	if ground < 0.01 {
+		return p
+	}
+	height := float32(altitude-int(rs.Elevation)) * math.FeetToNauticalMiles
+	slant := math.Sqrt(ground*ground + height*height)
+	return math.Add2LL(rs.Position, math.Scale2f(math.Sub2LL(p, rs.Position), slant/ground))
 }
 
 func (rs *RadarSite) CheckVisibility(p math.Point2LL, altitude int) (primary, secondary bool, distance float32) {
@@ -393,14 +485,17 @@ func (rs *RadarSite) CheckVisibility(p math.Point2LL, altitude int) (primary, se
 		// below the slope angle
 		return
 	}
+	if rs.InTerrainShadow(p, altitude) {
+		return
+	}
 
-	primary = distance <= float32(rs.PrimaryRange)
+	primary = !rs.BeaconOnly && distance <= float32(rs.PrimaryRange)
 	secondary = !primary && distance <= float32(rs.SecondaryRange)
 	return
 }
 
 func FixReadback(fix string) string {
-	if aid, ok := DB.Navaids[fix]; ok {
+	if aid, ok := DB.Navaids()[fix]; ok {
 		return util.StopShouting(aid.Name)
 	} else {
 		return fix
@@ -424,7 +519,7 @@ func cleanRunway(rwy string) string {
 }
 
 func LookupRunway(icao, rwy string) (Runway, bool) {
-	if ap, ok := DB.Airports[icao]; !ok {
+	if ap, ok := DB.Airports()[icao]; !ok {
 		return Runway{}, false
 	} else {
 		rwy = cleanRunway(rwy)
@@ -437,7 +532,7 @@ func LookupRunway(icao, rwy string) (Runway, bool) {
 }
 
 func LookupOppositeRunway(icao, rwy string) (Runway, bool) {
-	if ap, ok := DB.Airports[icao]; !ok {
+	if ap, ok := DB.Airports()[icao]; !ok {
 		return Runway{}, false
 	} else {
 		rwy = cleanRunway(rwy)
@@ -482,6 +577,59 @@ func LookupOppositeRunway(icao, rwy string) (Runway, bool) {
 	}
 }
 
+// RunwayDependency describes how arrivals to one of an airport's runways
+// and departures from another interact.
+type RunwayDependency int
+
+const (
+	RunwaysIndependent RunwayDependency = iota
+	// The runways themselves cross.
+	RunwaysIntersect
+	// The runways don't cross, but the arrival runway's missed approach
+	// path and the departure runway's climbout do, close to the ends of
+	// the runways.
+	RunwaysConverge
+)
+
+func (d RunwayDependency) String() string {
+	return []string{"independent", "intersecting", "converging"}[d]
+}
+
+// convergingRunwayDistance is how far past the departure ends of the
+// runways flight paths that cross make the runways dependent.
+const convergingRunwayDistance = 1 // nm
+
+// ArrivalDepartureDependency returns how arrivals to the arrival runway
+// and departures from the departure runway at the airport interact. Two
+// directions of the same runway are treated as independent; that case is
+// one of runway occupancy rather than crossing traffic.
+func ArrivalDepartureDependency(airport, arrival, departure string, nmPerLongitude float32) RunwayDependency {
+	arr, ok := LookupRunway(airport, arrival)
+	arrEnd, eok := LookupOppositeRunway(airport, arrival)
+	dep, dok := LookupRunway(airport, departure)
+	depEnd, deok := LookupOppositeRunway(airport, departure)
+	if !ok || !eok || !dok || !deok || arr.Id == dep.Id || arrEnd.Id == dep.Id {
+		return RunwaysIndependent
+	}
+
+	a0, a1 := math.LL2NM(arr.Threshold, nmPerLongitude), math.LL2NM(arrEnd.Threshold, nmPerLongitude)
+	d0, d1 := math.LL2NM(dep.Threshold, nmPerLongitude), math.LL2NM(depEnd.Threshold, nmPerLongitude)
+	if segmentsIntersect(a0, a1, d0, d1) {
+		return RunwaysIntersect
+	}
+
+	extend := func(p0, p1 [2]float32) [2]float32 {
+		if math.Length2f(math.Sub2f(p1, p0)) == 0 {
+			return p1
+		}
+		return math.Add2f(p1, math.Scale2f(math.Normalize2f(math.Sub2f(p1, p0)), convergingRunwayDistance))
+	}
+	if segmentsIntersect(a0, extend(a0, a1), d0, extend(d0, d1)) {
+		return RunwaysConverge
+	}
+	return RunwaysIndependent
+}
+
 // returns the ratio of air density at the given altitude (in feet) to the
 // air density at sea level, subject to assuming the standard atmosphere.
 func DensityRatioAtAltitude(alt float32) float32 {
@@ -547,17 +695,17 @@ func (ar *Arrival) PostDeserialize(loc Locator, nmPerLongitude float32, magnetic
 		}
 
 		for icao := range ar.Airlines {
-			airport, ok := DB.Airports[icao]
+			airport, ok := DB.Airports()[icao]
 			if !ok {
 				e.ErrorString("airport %q not found in database", icao)
 				continue
 			}
 
-			star, ok := airport.STARs[ar.STAR]
+			star, ok := airport.STARs()[ar.STAR]
 			if !ok {
 				e.ErrorString(
 					"STAR %q not available for %s. Options: %s",
-					ar.STAR, icao, strings.Join(util.SortedMapKeys(airport.STARs), ", "),
+					ar.STAR, icao, strings.Join(util.SortedMapKeys(airport.STARs()), ", "),
 				)
 				continue
 			}
@@ -650,7 +798,7 @@ func (ar *Arrival) PostDeserialize(loc Locator, nmPerLongitude float32, magnetic
 		for ap, rwywp := range ar.RunwayWaypoints {
 			e.Push("Airport " + ap)
 
-			if _, ok := DB.Airports[ap]; !ok {
+			if _, ok := DB.Airports()[ap]; !ok {
 				e.ErrorString("airport is unknown")
 				continue
 			}
@@ -659,7 +807,7 @@ func (ar *Arrival) PostDeserialize(loc Locator, nmPerLongitude float32, magnetic
 				e.Push("Runway " + rwy)
 
 				if _, ok := LookupRunway(ap, rwy); !ok {
-					e.ErrorString("runway %q is unknown. Options: %s", rwy, DB.Airports[ap].ValidRunways())
+					e.ErrorString("runway %q is unknown. Options: %s", rwy, DB.Airports()[ap].ValidRunways())
 				}
 
 				wp.InitializeLocations(loc, nmPerLongitude, magneticVariation, e)
@@ -703,7 +851,7 @@ func (ar *Arrival) PostDeserialize(loc Locator, nmPerLongitude float32, magnetic
 		}
 		for _, al := range airlines {
 			al.Check(e)
-			if _, ok := DB.Airports[al.Airport]; !ok {
+			if _, ok := DB.Airports()[al.Airport]; !ok {
 				e.ErrorString("departure airport \"airport\" %q unknown", al.Airport)
 			}
 		}
@@ -882,6 +1030,20 @@ func (p *SquawkCodePool) removeInvalidCodes() {
 	}
 }
 
+// reservedSquawks has the codes that pools never assign marked as
+// assigned.
+var reservedSquawks = sync.OnceValue(func() *SquawkCodePool {
+	p := &SquawkCodePool{First: 0, Last: 0o7777, AssignedBits: make([]uint64, 64)}
+	p.removeInvalidCodes()
+	return p
+})
+
+// IsReservedSquawk returns true if the code is one that is never assigned
+// from a SquawkCodePool (e.g., non-discrete codes and 1200).
+func IsReservedSquawk(code Squawk) bool {
+	return reservedSquawks().IsAssigned(code)
+}
+
 func MakeCompleteSquawkCodePool() *SquawkCodePool {
 	return makePool(0o1001, 0o7777)
 }
@@ -890,9 +1052,9 @@ func MakeSquawkBankCodePool(bank int) *SquawkCodePool {
 	return makePool(bank*0o100+1, bank*0o100+0o77)
 }
 
-func (p *SquawkCodePool) Get() (Squawk, error) {
-	start := rand.Intn(len(p.AssignedBits)) // random starting point in p.AssignedBits
-	rot := rand.Intn(64)                    // random rotation to randomize search start within each uint64
+func (p *SquawkCodePool) Get(r *rand.Rand) (Squawk, error) {
+	start := r.Intn(len(p.AssignedBits)) // random starting point in p.AssignedBits
+	rot := r.Intn(64)                    // random rotation to randomize search start within each uint64
 
 	for i := range len(p.AssignedBits) {
 		// Start the search at start, then wrap around.
@@ -5,9 +5,16 @@
 package aviation
 
 import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/mmp/vice/pkg/math"
 	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/util"
 )
 
 func TestFrequencyFormat(t *testing.T) {
@@ -67,8 +74,9 @@ func TestParseAltitudeRestriction(t *testing.T) {
 }
 
 func TestSquawkCodePoolBasics(t *testing.T) {
+	r := rand.New()
 	for _, p := range []*SquawkCodePool{MakeCompleteSquawkCodePool(), MakeSquawkBankCodePool(1), MakeSquawkBankCodePool(6)} {
-		sq, err := p.Get()
+		sq, err := p.Get(&r)
 		if err != nil {
 			t.Errorf("unexpected error: %v", err)
 		}
@@ -96,11 +104,12 @@ func TestSquawkCodePoolBasics(t *testing.T) {
 }
 
 func TestSquawkCodePoolRandoms(t *testing.T) {
+	r := rand.New()
 	for _, p := range []*SquawkCodePool{MakeCompleteSquawkCodePool(), MakeSquawkBankCodePool(1), MakeSquawkBankCodePool(6)} {
 		assigned := make(map[Squawk]interface{})
 
 		for i := range 100000 {
-			sq, err := p.Get()
+			sq, err := p.Get(&r)
 			if err != nil && p.NumAvailable() > 0 {
 				t.Errorf("unexpected error: %v", err)
 			} else if _, ok := assigned[sq]; ok {
@@ -178,3 +187,760 @@ func TestDirectlyBehindCWTSeparation(t *testing.T) {
 		}
 	}
 }
+
+func TestParseMissedApproach(t *testing.T) {
+	rec := func(fix, desc, pt, alt string) ssaRecord {
+		return ssaRecord{
+			fix:                 fix,
+			waypointDescription: []byte(desc),
+			pathAndTermination:  pt,
+			continuation:        '1',
+			alt0:                []byte(alt),
+		}
+	}
+	recs := []ssaRecord{
+		rec("ZALPO", "E  F", "IF", "02000"),
+		rec("RW22L", "GY M", "TF", "00052"),
+		rec("", "    ", "CA", "00500"),
+		rec("DPK", "V   ", "DF", "     "),
+		rec("DPK", "V  H", "HM", "03000"),
+	}
+	// Approach transitions aren't part of the missed approach.
+	recs = append(recs, ssaRecord{fix: "CAMRN", transition: "CAMRN", waypointDescription: []byte("E  A"),
+		pathAndTermination: "IF", continuation: '1', alt0: []byte("04000")})
+
+	wps, alt := parseMissedApproach(recs)
+	if len(wps) != 1 || wps[0].Fix != "DPK" || alt != 3000 {
+		t.Errorf("got %s / %d, expected DPK / 3000", wps.RouteString(), alt)
+	}
+}
+
+func TestSurface(t *testing.T) {
+	// Runway 9/27 with a parallel taxiway, a right-angle connector that
+	// continues across the runway, a high-speed exit, and a gate.
+	const osm = `<osm>
+<node id="1" lat="40" lon="-74"/>
+<node id="2" lat="40" lon="-73.97"/>
+<node id="10" lat="40.003" lon="-74"/>
+<node id="11" lat="40.003" lon="-73.985"/>
+<node id="12" lat="40.003" lon="-73.97"/>
+<node id="20" lat="40" lon="-73.99"/>
+<node id="21" lat="40.003" lon="-73.99"/>
+<node id="22" lat="39.997" lon="-73.99"/>
+<node id="30" lat="40" lon="-73.982"/>
+<node id="31" lat="40.003" lon="-73.978"/>
+<node id="40" lat="40.006" lon="-73.99"><tag k="aeroway" v="gate"/></node>
+<way><nd ref="1"/><nd ref="2"/><tag k="aeroway" v="runway"/><tag k="ref" v="09/27"/></way>
+<way><nd ref="10"/><nd ref="21"/><nd ref="11"/><nd ref="31"/><nd ref="12"/><tag k="aeroway" v="taxiway"/><tag k="ref" v="A"/></way>
+<way><nd ref="21"/><nd ref="20"/><nd ref="22"/><tag k="aeroway" v="taxiway"/><tag k="ref" v="B"/></way>
+<way><nd ref="30"/><nd ref="31"/><tag k="aeroway" v="taxiway"/><tag k="ref" v="C"/></way>
+<way><nd ref="40"/><nd ref="21"/><tag k="aeroway" v="taxiway"/><tag k="ref" v="D"/></way>
+</osm>`
+
+	sf, err := LoadOSMSurface(strings.NewReader(osm), 45.96)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sf.Runways) != 1 || sf.Runways[0].Ids != [2]string{"9", "27"} {
+		t.Fatalf("unexpected runways %+v", sf.Runways)
+	}
+
+	exits := sf.RunwayExits("9")
+	if len(exits) != 2 || exits[0].Taxiway != "B" || exits[0].HighSpeed ||
+		exits[1].Taxiway != "C" || !exits[1].HighSpeed {
+		t.Errorf("runway 9: unexpected exits %+v", exits)
+	}
+	if exits := sf.RunwayExits("27"); len(exits) != 2 || exits[0].Taxiway != "C" || exits[0].HighSpeed {
+		t.Errorf("runway 27: unexpected exits %+v", exits)
+	}
+
+	length, _ := sf.RunwayLength("9")
+	if exit, _ := ArrivalRunwayOccupancy("F", 130, exits, length); exit.Taxiway != "C" {
+		t.Errorf("CWT F: expected exit C, got %+v", exit)
+	}
+	if exit, _ := ArrivalRunwayOccupancy("I", 70, exits, length); exit.Taxiway != "B" {
+		t.Errorf("CWT I: expected exit B, got %+v", exit)
+	}
+
+	route, _, ok := sf.TaxiRoute(sf.Nodes[40], sf.Nodes[12])
+	if !ok || len(route) != 5 {
+		t.Errorf("unexpected taxi route %v", route)
+	} else if c := sf.RunwayCrossings(route); len(c) != 0 {
+		t.Errorf("unexpected runway crossings %v", c)
+	}
+	route, _, ok = sf.TaxiRoute(sf.Nodes[40], sf.Nodes[22])
+	if !ok || len(route) != 4 {
+		t.Errorf("unexpected taxi route %v", route)
+	} else if c := sf.RunwayCrossings(route); len(c) != 1 || c[0].String() != "9/27" {
+		t.Errorf("expected to cross 9/27, got %v", c)
+	}
+}
+
+func TestICAOFlightPlan(t *testing.T) {
+	fp, err := ParseICAOFlightPlan(`(FPL-BAW117/A2145-IS
+-B744/H-SDE3FGHIJ1RWY/LB1
+-EGLL1200
+-N0490F330 DVR L9 KONAN UL607 SPI DCT
+-KJFK0715 KBOS KEWR
+-PBN/A1B1 DOF/240101 RMK/TCAS EQUIPPED)`)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := FlightPlan{
+		Callsign:               "BAW117",
+		Rules:                  IFR,
+		AircraftType:           "H/B744/L",
+		CruiseSpeed:            490,
+		AssignedSquawk:         Squawk(0o2145),
+		DepartureAirport:       "EGLL",
+		DepartTimeEst:          1200,
+		Altitude:               33000,
+		ArrivalAirport:         "KJFK",
+		Hours:                  7,
+		Minutes:                15,
+		AlternateAirport:       "KBOS",
+		Route:                  "DVR L9 KONAN UL607 SPI DCT",
+		Remarks:                "TCAS EQUIPPED",
+		FlightType:             "S",
+		WakeCategory:           "H",
+		Equipment:              "SDE3FGHIJ1RWY",
+		Surveillance:           "LB1",
+		SecondAlternateAirport: "KEWR",
+		OtherInfo:              "PBN/A1B1 DOF/240101",
+		DateOfFlight:           time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		PBN:                    "A1B1",
+	}
+	if *fp != expected {
+		t.Errorf("got %+v, expected %+v", *fp, expected)
+	}
+
+	// Formatting and parsing again should give the same plan.
+	if rt, err := ParseICAOFlightPlan(fp.ICAOString()); err != nil {
+		t.Errorf("%s: unexpected error %v", fp.ICAOString(), err)
+	} else if *rt != *fp {
+		t.Errorf("round trip: got %+v, expected %+v", *rt, *fp)
+	}
+
+	for _, bad := range []string{"", "(FPL-BAW117-IS)", "(FPL-BAW117-IS-B744/Q-S/C-EGLL1200-N0490F330 DCT-KJFK0715-0)"} {
+		if _, err := ParseICAOFlightPlan(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestFlightPlanRemarks(t *testing.T) {
+	// Domestic plans give indicators in the remarks.
+	fp := FlightPlan{AircraftType: "C56X/A", Remarks: "STS/MEDEVAC RVR/300 PATIENT ON BOARD"}
+	fp.ParseRemarks()
+	if fp.STS != "MEDEVAC" || fp.MinimumRVR != 300 || fp.FiledPriority() != PriorityMEDEVAC {
+		t.Errorf("got STS %q RVR %d priority %q", fp.STS, fp.MinimumRVR, fp.FiledPriority())
+	}
+	if fp.RNAVCapable() {
+		t.Errorf("/A aircraft without PBN is RNAV capable")
+	}
+	fp.OtherInfo = "PBN/D2O2 STS/ALTRV"
+	fp.ParseRemarks()
+	if !fp.RNAVCapable() || !slices.Equal(fp.PBNCodes(), []string{"D2", "O2"}) ||
+		!slices.Equal(fp.SpecialHandling(), []string{"MEDEVAC", "ALTRV"}) {
+		t.Errorf("got PBN %v STS %v", fp.PBNCodes(), fp.SpecialHandling())
+	}
+
+	// PBN capabilities count toward the equipment suffix.
+	for _, c := range []struct{ pbn, suffix string }{{"", "A"}, {"A1", "I"}, {"D1", "G"}} {
+		item18 := "0"
+		if c.pbn != "" {
+			item18 = "PBN/" + c.pbn
+		}
+		fp, err := ParseICAOFlightPlan("(FPL-N123-IG-C56X/M-SD/C-KTEB1200-N0400A170 DCT-KBOS0100-" + item18 + ")")
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.pbn, err)
+		}
+		if fp.EquipmentSuffix() != c.suffix {
+			t.Errorf("PBN %q: got suffix %q, expected %q", c.pbn, fp.EquipmentSuffix(), c.suffix)
+		}
+	}
+}
+
+func TestFAAEquipmentSuffix(t *testing.T) {
+	for _, test := range []struct{ eq, surv, suffix string }{
+		{"SDE3FGHIJ1RWY", "LB1", "L"},
+		{"SDRW", "C", "Z"},
+		{"SDW", "S", "W"},
+		{"SG", "C", "G"},
+		{"SDR", "S", "I"},
+		{"SD", "C", "A"},
+		{"SD", "A", "B"},
+		{"SD", "N", "D"},
+		{"S", "C", "U"},
+		{"S", "A", "T"},
+		{"S", "", "X"},
+	} {
+		if s := FAAEquipmentSuffix(test.eq, test.surv); s != test.suffix {
+			t.Errorf("%s/%s: got %s, expected %s", test.eq, test.surv, s, test.suffix)
+		}
+
+		// The representative ICAO codes for each suffix map back to it.
+		fp := FlightPlan{AircraftType: "B738/" + test.suffix}
+		if eq, surv := fp.ICAOEquipment(); FAAEquipmentSuffix(eq, surv) != test.suffix {
+			t.Errorf("%s: got ICAO equipment %s/%s", test.suffix, eq, surv)
+		}
+	}
+}
+
+func TestParseSectorFile(t *testing.T) {
+	sct := `#define Taxiway 32768
+[INFO]
+New York TRACON
+BOS_CTR
+KJFK
+N040.38.24.000
+W073.46.43.000
+
+[VOR]
+JFK 115.900 N040.37.58.400 W073.46.17.000 ; Kennedy
+
+[FIXES]
+CAMRN N040.01.02.000 W073.51.41.000
+
+[AIRPORT]
+KJFK 000.000 N040.38.23.000 W073.46.44.000 B
+
+[STAR]
+CAMRN4   CAMRN CAMRN JFK JFK
+         JFK JFK N040.40.00.000 W073.45.00.000
+
+[GEO]
+KJFK Taxiways N040.38.00.000 W073.47.00.000 N040.38.30.000 W073.47.30.000 Taxiway
+              N040.39.00.000 W073.48.00.000 N040.39.30.000 W073.48.30.000 Taxiway
+bogus line
+`
+	ese := `[POSITIONS]
+JFK_TWR:Kennedy Tower:119.100:JT:T:JFK:TWR:-:-:0401:0477
+[SECTORLINE]
+COORD:N040.00.00.000:W073.00.00.000
+`
+
+	var e util.ErrorLogger
+	sf, err := ParseSectorFile(strings.NewReader(sct), &e)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if sf.Name != "New York TRACON" || sf.DefaultAirport != "KJFK" || sf.Center.IsZero() {
+		t.Errorf("info: got %q %q %v", sf.Name, sf.DefaultAirport, sf.Center)
+	}
+	for _, fix := range []string{"JFK", "CAMRN", "KJFK"} {
+		if _, ok := sf.Fixes[fix]; !ok {
+			t.Errorf("%s: fix not found", fix)
+		}
+	}
+	if errs := e.Errors(); len(errs) != 1 || !strings.Contains(errs[0], "bogus") {
+		t.Errorf("expected one error, got %v", errs)
+	}
+
+	// Consecutive segments are joined into a single line strip.
+	if l := sf.Lines["STAR CAMRN4"]; len(l) != 1 || len(l[0]) != 3 || l[0][0] != sf.Fixes["CAMRN"] {
+		t.Errorf("STAR CAMRN4: got %v", l)
+	}
+	if l := sf.Lines["GEO KJFK Taxiways"]; len(l) != 2 {
+		t.Errorf("GEO KJFK Taxiways: got %v", l)
+	}
+
+	vm := sf.VideoMaps()
+	if len(vm) != 2 || vm[0].Name != "GEO KJFK Taxiways" || vm[0].Label != "KJFK TA" || vm[1].Id != 2 {
+		t.Errorf("video maps: got %+v", vm)
+	}
+
+	if err := sf.ParseESE(strings.NewReader(ese), &e); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if c, ok := sf.Positions["JFK_TWR"]; !ok || c.Frequency != Frequency(119100) || c.TCP != "JT" || c.RadioName != "Kennedy Tower" {
+		t.Errorf("positions: got %+v", sf.Positions)
+	}
+}
+
+func TestParseDatablockTemplate(t *testing.T) {
+	tmpl := DatablockTemplate{Lines: [4]string{"{alerts}", "{callsign}{inhibit}", "{altitude|scratchpad:3}{handoff_id} {groundspeed}{vri}"}}
+	if err := tmpl.Parse(); err != nil {
+		t.Fatalf("%v: unexpected error", err)
+	}
+	if len(tmpl.Fields[0]) != 1 || len(tmpl.Fields[1]) != 2 || len(tmpl.Fields[3]) != 0 {
+		t.Errorf("unexpected fields: %+v", tmpl.Fields)
+	}
+	expect := []DatablockTemplateField{
+		DatablockTemplateField{Items: []string{"altitude", "scratchpad"}, Width: 3},
+		DatablockTemplateField{Items: []string{"handoff_id"}},
+		DatablockTemplateField{Literal: " "},
+		DatablockTemplateField{Items: []string{"groundspeed"}},
+		DatablockTemplateField{Items: []string{"vri"}},
+	}
+	if !reflect.DeepEqual(tmpl.Fields[2], expect) {
+		t.Errorf("got %+v; expected %+v", tmpl.Fields[2], expect)
+	}
+
+	for _, line := range []string{"{callsign", "callsign}", "{bogus}", "{altitude:0}", "{altitude:x}"} {
+		tmpl := DatablockTemplate{Lines: [4]string{line}}
+		if err := tmpl.Parse(); err == nil {
+			t.Errorf("%q: expected error", line)
+		}
+	}
+}
+
+func TestLazyProcedures(t *testing.T) {
+	r := util.LoadResource("FAACIFP18.zst")
+	defer r.Close()
+	airports, _, _, _ := ParseARINC424(r)
+
+	for _, icao := range []string{"KJFK", "KLGA", "KPHL", "KBOS", "KDEN", "KSFO", "PHNL", "KAAO"} {
+		ap, ok := DB.Airports()[icao]
+		if !ok {
+			t.Errorf("%s: not found", icao)
+			continue
+		}
+		if !reflect.DeepEqual(approachSummary(ap.Approaches()), approachSummary(airports[icao].Approaches())) {
+			t.Errorf("%s: lazily-parsed approaches don't match", icao)
+		}
+		if !reflect.DeepEqual(ap.STARs(), airports[icao].STARs()) {
+			t.Errorf("%s: lazily-parsed STARs don't match", icao)
+		}
+	}
+	if len(DB.Airports()["KJFK"].Approaches()) == 0 || len(DB.Airports()["KDEN"].STARs()) == 0 {
+		t.Errorf("procedures missing")
+	}
+
+	if adj := DB.AdjacentARTCCs("ZNY"); !slices.Contains(adj, "ZBW") || !slices.Contains(adj, "ZDC") ||
+		slices.Contains(adj, "ZLA") {
+		t.Errorf("unexpected ARTCCs adjacent to ZNY: %v", adj)
+	}
+}
+
+// approachSummary returns a description of each approach; the order of
+// an approach's transitions isn't deterministic, so they are sorted.
+func approachSummary(approaches map[string]Approach) map[string][]string {
+	m := make(map[string][]string)
+	for id, appr := range approaches {
+		s := []string{appr.Id, appr.FullName, appr.Type.String(), appr.Runway}
+		var wps []string
+		for _, wp := range appr.Waypoints {
+			wps = append(wps, wp.Encode())
+		}
+		slices.Sort(wps)
+		m[id] = append(s, wps...)
+	}
+	return m
+}
+
+func TestDBCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "avdb.gob.zst")
+	hash := dbCacheSourceHash()
+	// DB's procedure records may have been parsed and discarded already,
+	// so cache a freshly loaded database.
+	var src StaticDatabase
+	loadNavigationData(&src)
+	if err := writeDBCache(path, makeDBCache(&src, hash)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := readDBCache(path, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var db StaticDatabase
+	c.restore(&db)
+	if !reflect.DeepEqual(db.fixes, DB.Fixes()) || !reflect.DeepEqual(db.navaids, DB.Navaids()) ||
+		!reflect.DeepEqual(db.airways, DB.Airways()) {
+		t.Errorf("cached fixes, navaids, or airways don't match")
+	}
+	if len(db.airports) != len(DB.Airports()) {
+		t.Errorf("%d cached airports; expected %d", len(db.airports), len(DB.Airports()))
+	}
+	for _, icao := range []string{"KJFK", "KDEN", "KAAC"} {
+		ap, cap := DB.Airports()[icao], db.airports[icao]
+		if !reflect.DeepEqual(ap.Runways, cap.Runways) || ap.Location != cap.Location || ap.ARTCC != cap.ARTCC {
+			t.Errorf("%s: cached airport doesn't match", icao)
+		}
+		if !reflect.DeepEqual(approachSummary(ap.Approaches()), approachSummary(cap.Approaches())) ||
+			!reflect.DeepEqual(ap.STARs(), cap.STARs()) {
+			t.Errorf("%s: cached procedures don't match", icao)
+		}
+	}
+
+	hash[0]++
+	if _, err := readDBCache(path, hash); err == nil {
+		t.Errorf("expected error for stale cache")
+	}
+}
+
+type testLocator map[string]math.Point2LL
+
+func (l testLocator) Locate(fix string) (math.Point2LL, bool) {
+	p, ok := l[fix]
+	return p, ok
+}
+
+func TestDirectionOfFlightAltitudes(t *testing.T) {
+	if a := DirectionOfFlightAltitudes(90, 10000, 17000); !slices.Equal(a, []int{11000, 13000, 15000, 17000}) {
+		t.Errorf("eastbound 100-170: got %v", a)
+	}
+	if a := DirectionOfFlightAltitudes(270, 10000, 17000); !slices.Equal(a, []int{10000, 12000, 14000, 16000}) {
+		t.Errorf("westbound 100-170: got %v", a)
+	}
+	if a := DirectionOfFlightAltitudes(45, 37000, 49000); !slices.Equal(a, []int{37000, 39000, 41000, 45000, 49000}) {
+		t.Errorf("eastbound 370-490: got %v", a)
+	}
+	if a := DirectionOfFlightAltitudes(225, 37000, 49000); !slices.Equal(a, []int{38000, 40000, 43000, 47000}) {
+		t.Errorf("westbound 370-490: got %v", a)
+	}
+}
+
+func TestBoundaryFixFlowOverflights(t *testing.T) {
+	loc := testLocator{"WEST": {-1, 0}, "MIDDL": {0, 0}, "EAST": {1, 0}}
+	ctrl := map[string]*Controller{"N56": {TCP: "N56"}}
+	bf := BoundaryFixFlow{
+		Entry:             "WEST",
+		Route:             "MIDDL",
+		Exit:              "EAST",
+		InitialController: "N56",
+		Airlines:          []OverflightAirline{{AirlineSpecifier: AirlineSpecifier{ICAO: "AAL"}}},
+	}
+	adapted := map[string]AdaptationFixes{
+		"WEST": {{Name: "WEST", Altitude: [2]int{20000, 24000}}, {Name: "WEST", Altitude: [2]int{12000, 19000}}},
+	}
+
+	var e util.ErrorLogger
+	ofs := bf.Overflights(loc, 60, 0, adapted, nil, ctrl, &e)
+	if e.HaveErrors() {
+		t.Fatalf("errors: %s", e.String())
+	}
+	var alts []int
+	for _, of := range ofs {
+		alts = append(alts, of.InitialAltitudes[0])
+		if int(of.CruiseAltitude) != of.InitialAltitudes[0] {
+			t.Errorf("cruise altitude %.0f doesn't match initial altitude %d", of.CruiseAltitude, of.InitialAltitudes[0])
+		}
+	}
+	if !slices.Equal(alts, []int{13000, 15000, 17000, 19000, 21000, 23000}) {
+		t.Errorf("got altitudes %v", alts)
+	}
+
+	of := ofs[0]
+	if fixes := util.MapSlice(of.Waypoints, func(wp Waypoint) string { return wp.Fix }); !slices.Equal(fixes,
+		[]string{"_WEST_spawn", "WEST", "MIDDL", "EAST"}) {
+		t.Errorf("got waypoints %v", fixes)
+	}
+	if !of.Waypoints[1].HumanHandoff || !of.Waypoints[3].Delete {
+		t.Errorf("expected handoff at WEST and delete at EAST")
+	}
+	if d := math.NMDistance2LL(of.Waypoints[0].Location, of.Waypoints[1].Location); d < 14 || d > 16 ||
+		of.Waypoints[0].Location[0] > -1 {
+		t.Errorf("spawn point %v is %.1fnm from the entry fix", of.Waypoints[0].Location, d)
+	}
+
+	// Without an adapted entry fix, the altitudes must be given.
+	bf.Entry = "MIDDL"
+	bf.Route = ""
+	e = util.ErrorLogger{}
+	if ofs := bf.Overflights(loc, 60, 0, adapted, nil, ctrl, &e); len(ofs) != 0 || !e.HaveErrors() {
+		t.Errorf("expected an error without altitudes")
+	}
+}
+
+func TestRegistrationDatabase(t *testing.T) {
+	rdb := RegistrationDatabase{
+		Aircraft: map[string]RegisteredAircraft{
+			"n172sp": {Type: "c172", Equipment: "g"},
+			"N738XY": {Type: "C172"},
+			"C-GABC": {Type: "C172"},
+			"N1XX":   {Type: "ZZZZ"},
+		},
+		Flights: map[string]string{"aal1": "a21n", "DAL2": "ZZZZ"},
+	}
+	rdb.initialize(func(t string) (string, bool) {
+		if t == "A21N" {
+			return "A321", true
+		}
+		return t, t != "ZZZZ"
+	})
+
+	if len(rdb.Aircraft) != 3 || rdb.Aircraft["N172SP"] != (RegisteredAircraft{Type: "C172", Equipment: "G"}) {
+		t.Errorf("unexpected aircraft %v", rdb.Aircraft)
+	}
+	if ft, ok := rdb.FlightType("AAL1"); !ok || ft != "A321" {
+		t.Errorf("AAL1: got %q, expected A321", ft)
+	}
+	if _, ok := rdb.FlightType("DAL2"); ok {
+		t.Errorf("DAL2: type without performance data not ignored")
+	}
+
+	r := rand.New()
+	inUse := map[string]bool{"N172SP": true}
+	used := func(reg string) bool { return inUse[reg] }
+	for range 10 {
+		if reg, _, ok := rdb.SampleRegistration("N", "C172", &r, used); !ok || reg != "N738XY" {
+			t.Errorf("sampled %q, expected N738XY", reg)
+		}
+	}
+	if reg, _, ok := rdb.SampleRegistration("C", "C172", &r, func(string) bool { return false }); !ok || reg != "CGABC" {
+		t.Errorf("sampled %q, expected CGABC", reg)
+	}
+	inUse["N738XY"] = true
+	if reg, _, ok := rdb.SampleRegistration("N", "C172", &r, used); ok {
+		t.Errorf("sampled %q with all in use", reg)
+	}
+}
+
+func TestInTerrainShadow(t *testing.T) {
+	rs := RadarSite{
+		Position:       math.Point2LL{-73, 41},
+		Elevation:      100,
+		PrimaryRange:   60,
+		SecondaryRange: 60,
+		SlopeAngle:     0.175,
+		SilenceAngle:   5,
+		// North of the site, wrapping through 360, beyond 5nm.
+		TerrainShadows: []RadarShadow{{Bearings: [2]float32{340, 20}, Altitude: 3000, Range: 5}},
+	}
+
+	// Returns the point dist nm from the site at the given true bearing.
+	at := func(hdg, dist float32) math.Point2LL {
+		nmPerLongitude := math.NMPerLatitude * math.Cos(math.Radians(rs.Position[1]))
+		return math.Offset2LL(rs.Position, hdg, dist, nmPerLongitude, 0)
+	}
+
+	for _, test := range []struct {
+		hdg, dist float32
+		alt       int
+		shadowed  bool
+	}{
+		{0, 10, 2000, true},
+		{350, 10, 2000, true},
+		{15, 20, 2999, true},
+		{0, 10, 3000, false}, // above the shadow
+		{0, 3, 2000, false},  // closer than the terrain
+		{30, 10, 2000, false},
+		{330, 10, 2000, false},
+		{180, 10, 2000, false},
+	} {
+		p := at(test.hdg, test.dist)
+		if s := rs.InTerrainShadow(p, test.alt); s != test.shadowed {
+			t.Errorf("%.0f/%.0fnm at %d: got shadowed %v, expected %v", test.hdg, test.dist, test.alt,
+				s, test.shadowed)
+		}
+		if primary, secondary, _ := rs.CheckVisibility(p, test.alt); test.shadowed && (primary || secondary) {
+			t.Errorf("%.0f/%.0fnm at %d: visible in terrain shadow", test.hdg, test.dist, test.alt)
+		}
+	}
+
+	rs.TerrainShadows = nil
+	if rs.InTerrainShadow(at(0, 10), 2000) {
+		t.Errorf("shadowed with no terrain shadows")
+	}
+	if primary, _, _ := rs.CheckVisibility(at(0, 10), 2000); !primary {
+		t.Errorf("not visible with no terrain shadows")
+	}
+}
+
+func TestParseOpenScopeCoordinate(t *testing.T) {
+	for _, test := range []struct {
+		s  string
+		v  float32
+		ok bool
+	}{
+		{s: "N40.6398", v: 40.6398, ok: true},
+		{s: "W073.7789", v: -73.7789, ok: true},
+		{s: "N40d38m23.28", v: 40.6398, ok: true},
+		{s: "s33d30m", v: -33.5, ok: true},
+		{s: "e151d10m48", v: 151.18, ok: true},
+		{s: "40.6398"},
+		{s: "X40.6398"},
+		{s: "N"},
+		{s: ""},
+		{s: "N40.6.3"},
+		{s: "Nabc"},
+	} {
+		v, ok := parseOpenScopeCoordinate(test.s)
+		if ok != test.ok || (ok && math.Abs(v-test.v) > 1e-4) {
+			t.Errorf("%q: got %f/%v, expected %f/%v", test.s, v, ok, test.v, test.ok)
+		}
+	}
+}
+
+func TestParseOpenScopeAirport(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		json     string
+		expected *ImportedTraffic
+		errors   []string
+		err      bool
+	}{
+		{
+			name: "traffic",
+			json: `{"icao": "kabc", "name": "Test",
+"fixes": {"FIXA": ["N40.5", "W073.5"], "_HELPER": ["x", "y"], "BAD": ["N40.5"], "WORSE": ["Q1", "W073.5"]},
+"spawnPatterns": [
+  {"category": "departure", "route": "KABC04L.DEEZZ5.CANDR", "destination": "kxyz", "altitude": [5000, 19000],
+   "rate": 9.6, "airlines": [["aal/long", 10], ["aal/long", 2], ["dal", 1]]},
+  {"category": "arrival", "route": "CAMRN.CAMRN4.KABC", "altitude": 12000, "speed": 280, "rate": 5,
+   "airlines": [["jbu", 1]]},
+  {"category": "overflight", "route": "ENTRY..MIDDL..EXITT", "origin": "kzzz", "destination": "kyyy"},
+  {"category": "departure", "route": "KABC.DEEZZ5"},
+  {"category": "arrival", "route": "KABC"},
+  {"category": "balloon", "route": "UP"}]}`,
+			expected: &ImportedTraffic{
+				Name:     "Test",
+				Fixes:    map[string]math.Point2LL{"FIXA": {-73.5, 40.5}},
+				Airports: []string{"KABC"},
+				Departures: map[string][]ImportedDeparture{"KABC": {{
+					Runway: "04L", SID: "DEEZZ5", Exit: "CANDR", Destination: "KXYZ", Altitude: 19000,
+					Route: "DEEZZ5 CANDR", Rate: 10,
+					Airlines: []AirlineSpecifier{{ICAO: "AAL", Fleet: "long"}, {ICAO: "DAL"}},
+				}}},
+				Arrivals: []ImportedArrival{
+					{Airport: "KABC", Waypoints: "CAMRN", STAR: "CAMRN4", Route: "CAMRN CAMRN4",
+						InitialAltitude: 12000, InitialSpeed: 280, Rate: 5, Airlines: []AirlineSpecifier{{ICAO: "JBU"}}},
+					{Origin: "KZZZ", Waypoints: "ENTRY MIDDL EXITT", Route: "ENTRY MIDDL EXITT"},
+				},
+				VFRRoutes: map[string][]ImportedVFRRoute{},
+			},
+			errors: []string{
+				`fixes: BAD: invalid position ["N40.5"]`,
+				`fixes: WORSE: invalid position ["Q1" "W073.5"]`,
+				`spawnPatterns[3]: "KABC.DEEZZ5": unexpected departure route`,
+				`spawnPatterns[4]: "KABC": no fixes in arrival route`,
+				`spawnPatterns[5]: "balloon": unknown spawn pattern category`,
+			},
+		},
+		{
+			name: "no fixes or spawn patterns",
+			json: `{"icao": "kabc", "name": "Empty"}`,
+			expected: &ImportedTraffic{
+				Name:       "Empty",
+				Fixes:      map[string]math.Point2LL{},
+				Airports:   []string{"KABC"},
+				Departures: map[string][]ImportedDeparture{},
+				VFRRoutes:  map[string][]ImportedVFRRoute{},
+			},
+		},
+		{name: "bad JSON", json: `{"icao": "kabc", "fixes": [`, err: true},
+	} {
+		var e util.ErrorLogger
+		it, err := ParseOpenScopeAirport(strings.NewReader(test.json), &e)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v, expected error %v", test.name, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(it, test.expected) {
+			t.Errorf("%s: got %+v, expected %+v", test.name, it, test.expected)
+		}
+		errs := e.Errors()
+		slices.Sort(errs)
+		if !slices.Equal(errs, test.errors) {
+			t.Errorf("%s: got errors %q, expected %q", test.name, errs, test.errors)
+		}
+	}
+}
+
+func TestParseEuroscopeScenario(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		scenario string
+		expected *ImportedTraffic
+		errors   []string
+	}{
+		{
+			name: "traffic",
+			scenario: `; a comment
+AIRPORT_ALT:13
+@N:AAL123:1234:1:40.64:-73.78:13:0:0:0
+$FPAAL123:*A:I:H/B738/L:450:KJFK:0:0:FL350:KLAX:0:0:0:0:KSFO:/v/:DEEZZ5 CANDR J60 PSB
+@N:JBU45:2345:1:40.9:-73.1:8000:0:0:0
+$FPJBU45:*A:I:A320/L:300:KBOS:0:0:F230:KJFK:0:0:0:0:::PARCH3 CCC ROBER
+$ROUTE:QWERT/8000 CCC ROBER
+@N:N123AB:3456:1:40.8:-73.1:2500:0:0:0
+$FPN123AB:*A:V:C172/G:110:KISP:0:0:3500:KHPN:0:0:0:0:::
+$ROUTE:ISP CCC HPN
+`,
+			expected: &ImportedTraffic{
+				Fixes:    map[string]math.Point2LL{"QWERT": {-73.1, 40.9}},
+				Airports: []string{"KJFK", "KISP"},
+				Departures: map[string][]ImportedDeparture{"KJFK": {{
+					SID: "DEEZZ5", Exit: "CANDR", Destination: "KLAX", Altitude: 35000, Route: "DEEZZ5 CANDR J60 PSB",
+					Airlines: []AirlineSpecifier{{ICAO: "AAL", AircraftTypes: []string{"B738"}}},
+				}}},
+				Arrivals: []ImportedArrival{{
+					Airport: "KJFK", Origin: "KBOS", Waypoints: "QWERT CCC ROBER", Route: "PARCH3 CCC ROBER",
+					InitialAltitude: 8000, InitialSpeed: 250,
+					Airlines: []AirlineSpecifier{{ICAO: "JBU", AircraftTypes: []string{"A320"}}},
+				}},
+				VFRRoutes: map[string][]ImportedVFRRoute{"KISP": {{
+					Name: "KISP-KHPN (N123AB)", Destination: "KHPN", Waypoints: "ISP CCC HPN",
+				}}},
+			},
+		},
+		{
+			name: "bad aircraft",
+			scenario: `@N:AAL1:1234:1
+@N:AAL2:1234:1:north:-73.78:13:0:0:0
+@N:AAL3:1234:1:40.64:-73.78:13:0:0:0
+$FPAAL4:*A:I:B738:450:KJFK:0:0:FL350:KLAX:0:0:0:0:KSFO:/v/:DEEZZ5 CANDR
+@N:AAL5:1234:1:40.64:-73.78:13:0:0:0
+$FPAAL5:*A:I:B738:450:KJFK:0:0:FL350:KLAX:0:0:0:0:KSFO:/v/:
+@N:AAL6:1234:1:40.9:-73.1:8000:0:0:0
+$FPAAL6:*A:I:B738:450:KLAX:0:0:FL350:KJFK:0:0:0:0:KSFO:/v/:ROBER
+`,
+			expected: makeImportedTraffic(),
+			errors: []string{
+				`: "$FPAAL4:*A:I:B738:450:KJFK:0:0:FL350:KLAX:0:0:0:0:KSFO:/v/:DEEZZ5 CANDR": flight plan without aircraft`,
+				`: "@N:AAL1:1234:1": unexpected format`,
+				`: "@N:AAL2:1234:1:north:-73.78:13:0:0:0": invalid position or altitude`,
+				`AAL3: no flight plan`,
+				`AAL5: no route`,
+				`AAL6: no $ROUTE for arrival`,
+			},
+		},
+		{name: "empty", expected: makeImportedTraffic()},
+	} {
+		var e util.ErrorLogger
+		it, err := ParseEuroscopeScenario(strings.NewReader(test.scenario), &e)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(it, test.expected) {
+			t.Errorf("%s: got %+v, expected %+v", test.name, it, test.expected)
+		}
+		errs := e.Errors()
+		slices.Sort(errs)
+		if !slices.Equal(errs, test.errors) {
+			t.Errorf("%s: got errors %q, expected %q", test.name, errs, test.errors)
+		}
+	}
+}
+
+func TestHoldOutboundLeg(t *testing.T) {
+	// Holding west of the fix with a one-minute outbound leg at 230
+	// knots; after the turn outbound, the aircraft is 2.4nm abeam.
+	const nmPerLongitude = 45.5
+	fix := math.Point2LL{-73, 40}
+	h := &FlyHold{Fix: "FIX", FixLocation: fix, InboundCourse: 90, State: HoldStateFlyingOutbound, LegLength: 230. / 60}
+
+	for _, test := range []struct {
+		along    float32
+		outbound bool
+	}{
+		{0, true},
+		{3, true},
+		{3.9, false},
+	} {
+		h.State = HoldStateFlyingOutbound
+		nav := &Nav{FlightState: FlightState{
+			Position:       math.Point2LL{fix[0] - test.along/nmPerLongitude, fix[1] + 2.4/math.NMPerLatitude},
+			Heading:        270,
+			NmPerLongitude: nmPerLongitude,
+		}}
+		h.GetHeading(nav, nil, nil)
+		if outbound := h.State == HoldStateFlyingOutbound; outbound != test.outbound {
+			t.Errorf("%.1fnm past abeam the fix: got outbound %v, expected %v", test.along, outbound, test.outbound)
+		}
+	}
+}
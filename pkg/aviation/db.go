@@ -22,6 +22,7 @@ import (
 
 	"github.com/mmp/vice/pkg/log"
 	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/units"
 	"github.com/mmp/vice/pkg/util"
 
 	"github.com/gocolly/colly/v2"
@@ -34,10 +35,6 @@ var DB *StaticDatabase
 // StaticDatabase
 
 type StaticDatabase struct {
-	Navaids             map[string]Navaid
-	Airports            map[string]FAAAirport
-	Fixes               map[string]Fix
-	Airways             map[string][]Airway
 	Callsigns           map[string]string // 3 letter -> callsign
 	AircraftTypeAliases map[string]string
 	AircraftPerformance map[string]AircraftPerformance
@@ -49,18 +46,93 @@ type StaticDatabase struct {
 	MVAs                map[string][]MVA // TRACON -> MVAs
 	BravoAirspace       map[string][]AirspaceVolume
 	CharlieAirspace     map[string][]AirspaceVolume
+	// Optional; see registry.go.
+	Registrations RegistrationDatabase
+
+	// The airports, navaids, fixes, and airways are only loaded the first
+	// time one of them is needed; use the Airports(), Navaids(), Fixes(),
+	// and Airways() methods to access them.
+	airports map[string]FAAAirport
+	navaids  map[string]Navaid
+	fixes    map[string]Fix
+	airways  map[string][]Airway
+	navOnce  sync.Once
+	loadNav  func(*StaticDatabase) // nil for databases that are built by hand
+
+	// ARTCC -> the unparsed STARs and approaches of its airports; see
+	// procedures.go.
+	procedureGroups map[string]*procedureGroup
+}
+
+func (d *StaticDatabase) Airports() map[string]FAAAirport {
+	d.loadNavigation()
+	return d.airports
+}
+
+func (d *StaticDatabase) Navaids() map[string]Navaid {
+	d.loadNavigation()
+	return d.navaids
+}
+
+func (d *StaticDatabase) Fixes() map[string]Fix {
+	d.loadNavigation()
+	return d.fixes
+}
+
+func (d *StaticDatabase) Airways() map[string][]Airway {
+	d.loadNavigation()
+	return d.airways
+}
+
+func (d *StaticDatabase) loadNavigation() {
+	d.navOnce.Do(func() {
+		if d.loadNav != nil {
+			d.loadNav(d)
+		}
+	})
 }
 
 type FAAAirport struct {
-	Id         string
-	Name       string
-	Country    string
-	Elevation  int
-	Location   math.Point2LL
-	Runways    []Runway
-	Approaches map[string]Approach
-	STARs      map[string]STAR
-	ARTCC      string
+	Id        string
+	Name      string
+	Country   string
+	Elevation int
+	Location  math.Point2LL
+	Runways   []Runway
+	ARTCC     string
+	MSAs      []MSA
+	// Not included in the FAA's CIFP but present in other ARINC 424 data.
+	Frequencies []AirportFrequency
+
+	// Use the Approaches and STARs methods to access these; if the
+	// airport came from the CIFP, they are parsed on demand. See
+	// procedures.go.
+	approaches map[string]Approach
+	stars      map[string]STAR
+	procedures *airportProcedures
+}
+
+// MSA is a minimum sector altitude, valid within each sector's radius of
+// the center fix.
+type MSA struct {
+	Center           string
+	Location         math.Point2LL
+	MagneticBearings bool
+	Sectors          []MSASector
+}
+
+// MSASector's bearings are to the MSA's center; the sector runs clockwise
+// from FromBearing to ToBearing.
+type MSASector struct {
+	FromBearing, ToBearing float32
+	Altitude               int
+	Radius                 float32 // nm
+}
+
+type AirportFrequency struct {
+	Type      string // e.g., "ATI", "CLD", "GND", "TWR", "APP", "DEP"
+	Frequency Frequency
+	Callsign  string
 }
 
 type TRACON struct {
@@ -136,12 +208,53 @@ func (ap FAAAirport) SelectBestRunway(wind WindModel, magneticVariation float32)
 	return &rwy, &opp
 }
 
+// MinimumSafeAltitude returns the minimum sector altitude at the given
+// point from the airport's MSAs, if it is within one of them.
+func (ap FAAAirport) MinimumSafeAltitude(p math.Point2LL, nmPerLongitude, magneticVariation float32) (int, bool) {
+	alt, found := 0, false
+	for _, msa := range ap.MSAs {
+		d := math.NMDistance2LLFast(p, msa.Location, nmPerLongitude)
+		hdg := math.Heading2LL(p, msa.Location, nmPerLongitude, util.Select(msa.MagneticBearings, magneticVariation, 0))
+		for _, sec := range msa.Sectors {
+			if d > sec.Radius {
+				continue
+			}
+			if sec.FromBearing == sec.ToBearing || // whole circle
+				(sec.FromBearing < sec.ToBearing && hdg >= sec.FromBearing && hdg < sec.ToBearing) ||
+				(sec.FromBearing > sec.ToBearing && (hdg >= sec.FromBearing || hdg < sec.ToBearing)) {
+				alt, found = max(alt, sec.Altitude), true
+			}
+		}
+	}
+	return alt, found
+}
+
+// LookupFrequency returns the airport's frequency of the given type
+// (e.g., "ATI" for ATIS), if it is known.
+func (ap FAAAirport) LookupFrequency(t string) (Frequency, bool) {
+	if idx := slices.IndexFunc(ap.Frequencies, func(f AirportFrequency) bool { return f.Type == t }); idx != -1 {
+		return ap.Frequencies[idx].Frequency, true
+	}
+	return 0, false
+}
+
 ///////////////////////////////////////////////////////////////////////////
 
-func (d StaticDatabase) LookupWaypoint(f string) (math.Point2LL, bool) {
-	if n, ok := d.Navaids[f]; ok {
+// LookupAirway returns the airway with the given name that includes the
+// given fix; there may be multiple disjoint airways with the same name.
+func (d *StaticDatabase) LookupAirway(name, fix string) (Airway, bool) {
+	for _, a := range d.Airways()[name] {
+		if slices.ContainsFunc(a.Fixes, func(f AirwayFix) bool { return f.Fix == fix }) {
+			return a, true
+		}
+	}
+	return Airway{}, false
+}
+
+func (d *StaticDatabase) LookupWaypoint(f string) (math.Point2LL, bool) {
+	if n, ok := d.Navaids()[f]; ok {
 		return n.Location, true
-	} else if f, ok := d.Fixes[f]; ok {
+	} else if f, ok := d.Fixes()[f]; ok {
 		return f.Location, true
 	} else {
 		return math.Point2LL{}, false
@@ -200,18 +313,13 @@ type FleetAircraft struct {
 }
 
 func init() {
-	db := &StaticDatabase{}
+	db := &StaticDatabase{loadNav: loadNavigationData}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go func() { db.Airports = parseAirports(); wg.Done() }()
-	wg.Add(1)
 	go func() { db.AircraftPerformance = parseAircraftPerformance(); wg.Done() }()
 	wg.Add(1)
 	go func() { db.Airlines, db.Callsigns = parseAirlines(); wg.Done() }()
-	var airports map[string]FAAAirport
-	wg.Add(1)
-	go func() { airports, db.Navaids, db.Fixes, db.Airways = parseCIFP(); wg.Done() }()
 	wg.Add(1)
 	go func() { db.MagneticGrid = parseMagneticGrid(); wg.Done() }()
 	wg.Add(1)
@@ -228,25 +336,64 @@ func init() {
 	}()
 	wg.Wait()
 
+	db.substituteFleetTypes()
+	db.Registrations = parseRegistrations(db)
+
+	DB = db
+
+	math.SetLocationResolver(&dbResolver{})
+}
+
+// loadNavigationData loads the airports, navaids, fixes, airways, and
+// procedure groups into the database, either from the cache or by parsing
+// them from the resources.
+func loadNavigationData(db *StaticDatabase) {
+	// Use the cached airports and CIFP data if they're available; see
+	// dbcache.go.
+	cachePath, err := dbCachePath()
+	sourceHash := dbCacheSourceHash()
+	if err == nil {
+		if cache, err := readDBCache(cachePath, sourceHash); err == nil {
+			cache.restore(db)
+			return
+		}
+	}
+
+	var wg sync.WaitGroup
+	var airports map[string]FAAAirport
+	wg.Add(1)
+	go func() { db.airports = parseAirports(); wg.Done() }()
+	wg.Add(1)
+	go func() {
+		airports, db.navaids, db.fixes, db.airways, db.procedureGroups = parseCIFP()
+		wg.Done()
+	}()
+	wg.Wait()
+
 	for icao, ap := range airports {
 		if icao != "4V4" { // Ignore the rw one for AAC.
-			db.Airports[icao] = ap
+			db.airports[icao] = ap
 		}
 	}
 
-	DB = db
-
-	math.SetLocationResolver(&dbResolver{})
+	if cachePath != "" {
+		c := makeDBCache(db, sourceHash)
+		go func() {
+			if err := writeDBCache(cachePath, c); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: unable to write database cache: %v\n", cachePath, err)
+			}
+		}()
+	}
 }
 
 type dbResolver struct{}
 
 func (d *dbResolver) Resolve(s string) (math.Point2LL, error) {
-	if n, ok := DB.Navaids[s]; ok {
+	if n, ok := DB.Navaids()[s]; ok {
 		return n.Location, nil
-	} else if n, ok := DB.Airports[s]; ok {
+	} else if n, ok := DB.Airports()[s]; ok {
 		return n.Location, nil
-	} else if f, ok := DB.Fixes[s]; ok {
+	} else if f, ok := DB.Fixes()[s]; ok {
 		return f.Location, nil
 	} else {
 		return math.Point2LL{}, fmt.Errorf("%s: unknown fix", s)
@@ -439,15 +586,7 @@ func parseAirports() map[string]FAAAirport {
 		Runway{Id: "36R", Threshold: parse("N42.46.31.65,E141.40.18.87"), Heading: 2, Elevation: 87},
 	})
 
-	ar := util.LoadResource("airport_artccs.json")
-	defer ar.Close()
-	data := make(map[string]string) // Airport -> ARTCC
-	if err := util.UnmarshalJSON(ar, &data); err != nil {
-		fmt.Fprintf(os.Stderr, "airport_artccs.json: %v\n", err)
-		os.Exit(1)
-	}
-
-	for name, artcc := range data {
+	for name, artcc := range loadAirportARTCCs() {
 		if entry, ok := airports[name]; ok {
 			entry.ARTCC = artcc
 			airports[name] = entry
@@ -552,10 +691,15 @@ func parseAirlines() (map[string]Airline, map[string]string) {
 
 // FAA Coded Instrument Flight Procedures (CIFP)
 // https://www.faa.gov/air_traffic/flight_info/aeronav/digital_products/cifp/download/
-func parseCIFP() (map[string]FAAAirport, map[string]Navaid, map[string]Fix, map[string][]Airway) {
+func parseCIFP() (map[string]FAAAirport, map[string]Navaid, map[string]Fix, map[string][]Airway,
+	map[string]*procedureGroup) {
 	r := util.LoadResource("FAACIFP18.zst")
 	defer r.Close()
-	return ParseARINC424(r)
+
+	// Set the STARs and approaches aside to be parsed when needed.
+	pg := makeProcedureGrouper()
+	airports, navaids, fixes, airways := parseARINC424(r, pg.add)
+	return airports, navaids, fixes, airways, pg.finish(airports)
 }
 
 type MagneticGrid struct {
@@ -919,19 +1063,21 @@ func (ap FAAAirport) ValidRunways() string {
 }
 
 func PrintCIFPRoutes(airport string) error {
-	ap, ok := DB.Airports[airport]
+	ap, ok := DB.Airports()[airport]
 	if !ok {
 		return fmt.Errorf("%s: airport not present in database\n", airport)
 	}
 
 	fmt.Printf("STARs:\n")
-	for _, s := range util.SortedMapKeys(ap.STARs) {
-		ap.STARs[s].Print(s)
+	stars := ap.STARs()
+	for _, s := range util.SortedMapKeys(stars) {
+		stars[s].Print(s)
 	}
 	fmt.Printf("\nApproaches:\n")
-	for _, appr := range util.SortedMapKeys(ap.Approaches) {
+	approaches := ap.Approaches()
+	for _, appr := range util.SortedMapKeys(approaches) {
 		fmt.Printf("%-5s: ", appr)
-		for i, wp := range ap.Approaches[appr].Waypoints {
+		for i, wp := range approaches[appr].Waypoints {
 			if i > 0 {
 				fmt.Printf("       ")
 			}
@@ -1243,7 +1389,7 @@ func decodeTFRXML(url string, r io.Reader, lg *log.Logger) (TFR, error) {
 
 ///////////////////////////////////////////////////////////////////////////
 
-func (ea ERAMAdaptation) FixForRouteAndAltitude(route string, altitude string) *AdaptationFix {
+func (ea ERAMAdaptation) FixForRouteAndAltitude(route string, altitude units.FlightDataAltitude) *AdaptationFix {
 	waypoints := strings.Fields(route)
 	for fix, adaptationFixes := range ea.CoordinationFixes {
 		if slices.Contains(waypoints, fix) {
@@ -1256,7 +1402,7 @@ func (ea ERAMAdaptation) FixForRouteAndAltitude(route string, altitude string) *
 	return nil
 }
 
-func (ea ERAMAdaptation) AdaptationFixForAltitude(fix string, altitude string) *AdaptationFix {
+func (ea ERAMAdaptation) AdaptationFixForAltitude(fix string, altitude units.FlightDataAltitude) *AdaptationFix {
 	if adaptationFixes, ok := ea.CoordinationFixes[fix]; !ok {
 		return nil
 	} else if af, err := adaptationFixes.Fix(altitude); err != nil {
@@ -1266,7 +1412,7 @@ func (ea ERAMAdaptation) AdaptationFixForAltitude(fix string, altitude string) *
 	}
 }
 
-func (fixes AdaptationFixes) Fix(altitude string) (AdaptationFix, error) {
+func (fixes AdaptationFixes) Fix(altitude units.FlightDataAltitude) (AdaptationFix, error) {
 	switch len(fixes) {
 	case 0:
 		return AdaptationFix{}, ErrNoMatchingFix
@@ -1275,13 +1421,12 @@ func (fixes AdaptationFixes) Fix(altitude string) (AdaptationFix, error) {
 		return fixes[0], nil
 
 	default:
-		// TODO: eventually make a function to parse a string that has a block altitude (for example)
-		// and return an int (figure out how STARS handles that). For now strconv.Atoi can be used
-		if alt, err := strconv.Atoi(altitude); err != nil {
+		// Block altitudes are matched using the bottom of the block.
+		if alt, err := altitude.Feet(); err != nil {
 			return AdaptationFix{}, err
 		} else {
 			for _, fix := range fixes {
-				if alt >= fix.Altitude[0] && alt <= fix.Altitude[1] {
+				if int(alt) >= fix.Altitude[0] && int(alt) <= fix.Altitude[1] {
 					return fix, nil
 				}
 			}
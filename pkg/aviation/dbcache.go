@@ -0,0 +1,190 @@
+// pkg/aviation/dbcache.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package aviation
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mmp/vice/pkg/util"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Parsing the airports and the CIFP accounts for most of the time it
+// takes to load the database. After they have been parsed, the results
+// are saved in a binary cache in the user's cache directory; subsequent
+// launches use the cache as long as it's the current version and the
+// source files haven't changed.
+
+// dbCacheVersion should be incremented whenever the representation of
+// anything stored in the cache changes.
+const dbCacheVersion = 1
+
+// dbCacheSources are the resource files that the cached data is derived
+// from.
+var dbCacheSources = []string{"airports.csv.zst", "airport_artccs.json", "FAACIFP18.zst"}
+
+type dbCache struct {
+	Version    int
+	SourceHash [sha256.Size]byte
+
+	Airports        map[string]FAAAirport
+	Navaids         map[string]Navaid
+	Fixes           map[string]Fix
+	Airways         map[string][]Airway
+	ProcedureGroups map[string]cachedProcedureGroup
+}
+
+// cachedProcedureGroup stores a procedureGroup; its records are still
+// compressed.
+type cachedProcedureGroup struct {
+	Records  []byte
+	Airports []string
+}
+
+func dbCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "Vice", "avdb.gob.zst"), nil
+}
+
+// dbCacheSourceHash returns a hash of the contents of the cache's source
+// files.
+func dbCacheSourceHash() [sha256.Size]byte {
+	h := sha256.New()
+	for _, name := range dbCacheSources {
+		b, err := fs.ReadFile(util.GetResourcesFS(), name)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(h, "%s %d\n", name, len(b))
+		h.Write(b)
+	}
+	var hash [sha256.Size]byte
+	h.Sum(hash[:0])
+	return hash
+}
+
+// readDBCache returns the cached airports, navaids, fixes, airways, and
+// procedure groups from the given file, if it is valid for the source
+// files with the given hash.
+func readDBCache(path string, hash [sha256.Size]byte) (*dbCache, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	// Check the header before decoding everything else.
+	dec := gob.NewDecoder(zr)
+	var version int
+	var sourceHash [sha256.Size]byte
+	if err := dec.Decode(&version); err != nil {
+		return nil, err
+	} else if version != dbCacheVersion {
+		return nil, fmt.Errorf("cache version %d; expected %d", version, dbCacheVersion)
+	}
+	if err := dec.Decode(&sourceHash); err != nil {
+		return nil, err
+	} else if sourceHash != hash {
+		return nil, errors.New("source files have changed")
+	}
+
+	c := &dbCache{Version: version, SourceHash: sourceHash}
+	if err := dec.Decode(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// writeDBCache writes the cache to the given file. It is written to a
+// temporary file first so that a partially-written cache is never seen.
+func writeDBCache(path string, c *dbCache) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "avdb-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = func() error {
+		defer f.Close()
+		zw, err := zstd.NewWriter(f, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if err != nil {
+			return err
+		}
+		enc := gob.NewEncoder(zw)
+		if err := enc.Encode(c.Version); err != nil {
+			return err
+		}
+		if err := enc.Encode(c.SourceHash); err != nil {
+			return err
+		}
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+		return zw.Close()
+	}()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// makeDBCache returns a dbCache holding the parsed data from the given
+// database.
+func makeDBCache(db *StaticDatabase, hash [sha256.Size]byte) *dbCache {
+	c := &dbCache{
+		Version:         dbCacheVersion,
+		SourceHash:      hash,
+		Airports:        db.airports,
+		Navaids:         db.navaids,
+		Fixes:           db.fixes,
+		Airways:         db.airways,
+		ProcedureGroups: make(map[string]cachedProcedureGroup),
+	}
+	for artcc, g := range db.procedureGroups {
+		c.ProcedureGroups[artcc] = cachedProcedureGroup{
+			Records:  g.records,
+			Airports: util.SortedMapKeys(g.airports),
+		}
+	}
+	return c
+}
+
+// restore initializes the database's airports, navaids, fixes, airways,
+// and procedure groups from the cache.
+func (c *dbCache) restore(db *StaticDatabase) {
+	db.airports, db.navaids, db.fixes, db.airways = c.Airports, c.Navaids, c.Fixes, c.Airways
+	db.procedureGroups = make(map[string]*procedureGroup)
+	for artcc, cg := range c.ProcedureGroups {
+		g := &procedureGroup{records: cg.Records, airports: make(map[string]*airportProcedures)}
+		for _, icao := range cg.Airports {
+			procs := &airportProcedures{group: g}
+			g.airports[icao] = procs
+			if ap, ok := db.airports[icao]; ok {
+				ap.procedures = procs
+				db.airports[icao] = ap
+			}
+		}
+		db.procedureGroups[artcc] = g
+	}
+}
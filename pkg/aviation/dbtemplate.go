@@ -0,0 +1,138 @@
+// pkg/aviation/dbtemplate.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package aviation
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DatablockTemplate specifies the layout of full datablocks for
+// facilities that don't use the default one. Each line is a mix of
+// literal text and fields in braces; a field gives one or more items
+// separated by "|", which the datablock cycles through, and optionally a
+// width after a colon. For example,
+//
+//	"{altitude|scratchpad|destination:3}{handoff_id} {groundspeed}{vri}"
+//
+// Items that are empty are skipped when cycling; fields are padded (or
+// truncated) to their width, which is the width of the widest item if it
+// isn't given.
+type DatablockTemplate struct {
+	Lines [4]string `json:"lines"`
+	// How long the first item of each field is shown, and how long the
+	// others are shown; 2 and 1.5 seconds by default.
+	FirstCycleSeconds float32 `json:"first_cycle_seconds"`
+	CycleSeconds      float32 `json:"cycle_seconds"`
+
+	Fields [4][]DatablockTemplateField // not in JSON, set by Parse
+}
+
+// DatablockTemplateField is either literal text or a field of items.
+type DatablockTemplateField struct {
+	Literal string
+	Items   []string
+	Width   int // 0 if not specified
+}
+
+// DatablockTemplateItems are the items that may be used in templates.
+var DatablockTemplateItems = []string{
+	"alerts",             // safety alerts and special conditions
+	"altitude",           // mode C or pilot-reported altitude
+	"ambiguous",          // AMB if the track couldn't be re-associated
+	"assigned_beacon",    // assigned beacon code, if it doesn't match
+	"atpa",               // ATPA in-trail distance
+	"beacon",             // reported beacon code
+	"callsign",           // ACID
+	"cwt",                // CWT category
+	"destination",        // arrival airport
+	"groundspeed",        // groundspeed in tens of knots
+	"handoff_id",         // single-character id of the handoff position
+	"handoff_tcp",        // full id of a handoff position in another facility
+	"ident",              // ID when the aircraft is identing
+	"inhibit",            // MSAW/CA inhibited indicators
+	"pointout",           // point out and redirected handoff indicators
+	"requested_altitude", // requested altitude, if enabled
+	"rules",              // V for VFR, E for overflights
+	"scratchpad",         // scratchpad 1, or the adapted alternate
+	"scratchpad2",        // scratchpad 2
+	"temp_altitude",      // temporary altitude
+	"type",               // aircraft type
+	"vri",                // vertical rate indicator
+}
+
+// Parse parses the template's lines into its Fields.
+func (t *DatablockTemplate) Parse() error {
+	if t.FirstCycleSeconds < 0 || t.CycleSeconds < 0 {
+		return fmt.Errorf("cycle times must not be negative")
+	}
+
+	for i, line := range t.Lines {
+		t.Fields[i] = nil
+		for line != "" {
+			start := strings.IndexByte(line, '{')
+			if start == -1 {
+				start = len(line)
+			}
+			if lit := line[:start]; lit != "" {
+				if strings.IndexByte(lit, '}') != -1 {
+					return fmt.Errorf("line %d: unmatched '}'", i+1)
+				}
+				t.Fields[i] = append(t.Fields[i], DatablockTemplateField{Literal: lit})
+			}
+			if start == len(line) {
+				break
+			}
+
+			end := strings.IndexByte(line[start:], '}')
+			if end == -1 {
+				return fmt.Errorf("line %d: unmatched '{'", i+1)
+			}
+			f, err := parseDatablockTemplateField(line[start+1 : start+end])
+			if err != nil {
+				return fmt.Errorf("line %d: %w", i+1, err)
+			}
+			t.Fields[i] = append(t.Fields[i], f)
+
+			line = line[start+end+1:]
+		}
+	}
+	return nil
+}
+
+func parseDatablockTemplateField(s string) (DatablockTemplateField, error) {
+	var f DatablockTemplateField
+	items, width, ok := strings.Cut(s, ":")
+	if ok {
+		var err error
+		if f.Width, err = strconv.Atoi(width); err != nil || f.Width <= 0 {
+			return f, fmt.Errorf("%q: invalid field width", width)
+		}
+	}
+
+	for _, item := range strings.Split(items, "|") {
+		item = strings.TrimSpace(item)
+		if !slices.Contains(DatablockTemplateItems, item) {
+			return f, fmt.Errorf("%q: unknown datablock item", item)
+		}
+		f.Items = append(f.Items, item)
+	}
+	return f, nil
+}
+
+// CycleHalfSeconds returns the lengths of the first and subsequent cycles
+// in half seconds.
+func (t *DatablockTemplate) CycleHalfSeconds() (first, rest int) {
+	first, rest = 4, 3
+	if t.FirstCycleSeconds > 0 {
+		first = max(1, int(2*t.FirstCycleSeconds+0.5))
+	}
+	if t.CycleSeconds > 0 {
+		rest = max(1, int(2*t.CycleSeconds+0.5))
+	}
+	return
+}
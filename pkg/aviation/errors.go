@@ -13,6 +13,7 @@ var (
 	ErrInvalidApproach              = errors.New("Invalid approach")
 	ErrInvalidController            = errors.New("Invalid controller")
 	ErrInvalidFacility              = errors.New("Invalid facility")
+	ErrInvalidFlightPlan            = errors.New("Invalid flight plan")
 	ErrInvalidHeading               = errors.New("Invalid heading")
 	ErrInvalidSquawkCode            = errors.New("Invalid squawk code")
 	ErrNoAircraftForCallsign        = errors.New("No aircraft exists with specified callsign")
@@ -0,0 +1,168 @@
+// pkg/aviation/fleet.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package aviation
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Airline fleets and scenarios sometimes give aircraft types that aren't
+// in the performance database, usually newer variants of types that are.
+// Rather than failing validation, such types are replaced with a similar
+// type that is in the database: one from a table of known substitutes or
+// otherwise one from the same family, as given by the first three
+// characters of its ICAO designator.
+//
+// Fleets may also be aged to a given year: types that weren't yet in
+// service or had already been retired from scheduled service then aren't
+// used, types that were new then are favored, and old ones are used less.
+// Types without service years are unaffected.
+
+// aircraftTypeSubstitutes gives substitutes for types that are commonly
+// missing from the performance database, most-preferred first.
+var aircraftTypeSubstitutes = map[string][]string{
+	"A19N": {"A319"},
+	"A20N": {"A320"},
+	"A21N": {"A321"},
+	"A338": {"A332"},
+	"A339": {"A333"},
+	"A35K": {"A359", "B77W"},
+	"B37M": {"B737"},
+	"B38M": {"B738"},
+	"B39M": {"B739"},
+	"B3XM": {"B739"},
+	"B78X": {"B789", "B788"},
+	"B779": {"B77W"},
+	"BCS1": {"E190", "A319"},
+	"BCS3": {"E195", "A319"},
+	"E75L": {"E170", "E175"},
+	"E75S": {"E170", "E175"},
+	"E290": {"E190"},
+	"E295": {"E195"},
+	"CRJ1": {"CRJ2"},
+	"MD82": {"MD80"},
+	"MD83": {"MD80"},
+	"MD88": {"MD80"},
+}
+
+// ServiceYears gives the years an aircraft type entered and, if it has,
+// left scheduled service.
+type ServiceYears struct {
+	Introduced int
+	Retired    int // zero if still in service
+}
+
+var aircraftServiceYears = map[string]ServiceYears{
+	"A306": {1983, 0}, "A310": {1983, 0}, "A318": {2003, 0}, "A319": {1996, 0},
+	"A320": {1988, 0}, "A321": {1994, 0}, "A19N": {2017, 0}, "A20N": {2016, 0},
+	"A21N": {2017, 0}, "A332": {1998, 0}, "A333": {1994, 0}, "A339": {2018, 0},
+	"A343": {1994, 0}, "A346": {2002, 0}, "A359": {2015, 0}, "A35K": {2018, 0},
+	"A388": {2007, 0}, "B712": {1999, 0}, "B722": {1967, 2003}, "B732": {1968, 2008},
+	"B733": {1984, 0}, "B734": {1988, 0}, "B735": {1990, 0}, "B736": {1998, 0},
+	"B737": {1997, 0}, "B738": {1998, 0}, "B739": {2001, 0}, "B37M": {2022, 0},
+	"B38M": {2017, 0}, "B39M": {2018, 0}, "B742": {1971, 2010}, "B744": {1989, 0},
+	"B748": {2012, 0}, "B752": {1983, 0}, "B753": {1999, 0}, "B762": {1982, 0},
+	"B763": {1986, 0}, "B764": {2000, 0}, "B772": {1995, 0}, "B77L": {2006, 0},
+	"B77W": {2004, 0}, "B788": {2011, 0}, "B789": {2014, 0}, "B78X": {2018, 0},
+	"BCS1": {2016, 0}, "BCS3": {2016, 0}, "CRJ1": {1992, 2015}, "CRJ2": {1996, 0},
+	"CRJ7": {2001, 0}, "CRJ9": {2003, 0}, "DC10": {1971, 2014}, "DC93": {1967, 2014},
+	"E135": {1999, 0}, "E145": {1997, 0}, "E170": {2004, 0}, "E75L": {2005, 0},
+	"E75S": {2005, 0}, "E190": {2005, 0}, "E195": {2006, 0}, "E290": {2018, 0},
+	"E295": {2019, 0}, "F100": {1988, 2017}, "L101": {1972, 2004}, "MD11": {1990, 2014},
+	"MD80": {1980, 2020}, "MD82": {1981, 2020}, "MD83": {1985, 2020}, "MD88": {1988, 2020},
+	"MD90": {1995, 2020},
+}
+
+// SubstituteAircraftType returns a type that's in the performance database
+// to use for the given one, which is the type itself if it's present.
+func SubstituteAircraftType(icao string) (string, bool) {
+	return DB.substituteAircraftType(strings.ToUpper(icao))
+}
+
+func (db *StaticDatabase) substituteAircraftType(icao string) (string, bool) {
+	if _, ok := db.AircraftPerformance[icao]; ok {
+		return icao, true
+	}
+	for _, sub := range aircraftTypeSubstitutes[icao] {
+		if _, ok := db.AircraftPerformance[sub]; ok {
+			return sub, true
+		}
+	}
+	if len(icao) >= 3 {
+		for _, t := range util.SortedMapKeys(db.AircraftPerformance) {
+			if strings.HasPrefix(t, icao[:3]) {
+				return t, true
+			}
+		}
+	}
+	return "", false
+}
+
+// FleetWeight returns how much to scale the aircraft type's count in a
+// fleet for a sim set in the given year; zero means that the type wasn't
+// flying then. A year of zero leaves fleets as they are.
+func FleetWeight(icao string, year int) float32 {
+	sy, ok := aircraftServiceYears[icao]
+	if year == 0 || !ok {
+		return 1
+	}
+	if year < sy.Introduced || (sy.Retired != 0 && year >= sy.Retired) {
+		return 0
+	}
+	switch age := year - sy.Introduced; {
+	case age < 2:
+		// Just entering service; there aren't many yet.
+		return 0.5
+	case age < 10:
+		return 1.5
+	case age >= 25:
+		return 0.5
+	default:
+		return 1
+	}
+}
+
+// SampleFleet returns an aircraft type from the fleet, chosen according
+// to the fleet counts as aged to the given year. If none of the types
+// were flying that year, the fleet is sampled as is.
+func SampleFleet(fleet []FleetAircraft, year int, r *rand.Rand) (string, bool) {
+	weight := func(ac FleetAircraft) float32 { return float32(ac.Count) * FleetWeight(ac.ICAO, year) }
+	if !slices.ContainsFunc(fleet, func(ac FleetAircraft) bool { return weight(ac) > 0 }) {
+		year = 0
+	}
+
+	// Reservoir sampling...
+	var aircraft string
+	var sum float32
+	for _, ac := range fleet {
+		w := weight(ac)
+		if w == 0 {
+			continue
+		}
+		sum += w
+		if r.Float32() < w/sum {
+			aircraft = ac.ICAO
+		}
+	}
+	return aircraft, aircraft != ""
+}
+
+// substituteFleetTypes replaces the types in the airlines' fleets that
+// aren't in the performance database.
+func (db *StaticDatabase) substituteFleetTypes() {
+	for _, al := range db.Airlines {
+		for _, fleet := range al.Fleets {
+			for i, ac := range fleet {
+				if sub, ok := db.substituteAircraftType(ac.ICAO); ok {
+					fleet[i].ICAO = sub
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,463 @@
+// pkg/aviation/fpl.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package aviation
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mmp/vice/pkg/util"
+)
+
+// ICAO flight plans (FPL) describe the aircraft's equipment with the codes
+// of items 10a and 10b rather than the single-letter FAA equipment suffix
+// and give the wake turbulence category with the aircraft type. Since the
+// rest of vice works with FAA-style aircraft types (e.g., "H/B744/L"),
+// AircraftType is always kept in that form; the ICAO items are kept
+// alongside it so that plans can be shown and sent as they were filed.
+//
+// Some item 18 indicators--which domestic plans often give in the
+// remarks--are also parsed into their own fields: the date of flight,
+// PBN capabilities, minimum RVR, and special handling. PBN capabilities
+// count toward the aircraft's equipment and STS/MEDEVAC gives the flight
+// priority.
+
+// FAAEquipmentSuffix returns the FAA equipment suffix that corresponds to
+// the given ICAO item 10a (communication/navigation) and 10b
+// (surveillance) equipment codes.
+func FAAEquipmentSuffix(equipment, surveillance string) string {
+	has := func(s, codes string) bool { return strings.ContainsAny(s, codes) }
+	rvsm, gnss, rnav, dme := has(equipment, "W"), has(equipment, "G"), has(equipment, "GR"), has(equipment, "D")
+	modeC := has(surveillance, "CEHLPS")
+	transponder := modeC || has(surveillance, "AIX")
+
+	switch {
+	case rvsm && gnss:
+		return "L"
+	case rvsm && rnav:
+		return "Z"
+	case rvsm:
+		return "W"
+	case gnss:
+		return "G"
+	case rnav:
+		return "I"
+	case dme:
+		return util.Select(modeC, "A", util.Select(transponder, "B", "D"))
+	default:
+		return util.Select(modeC, "U", util.Select(transponder, "T", "X"))
+	}
+}
+
+// icaoEquipment gives representative ICAO item 10a and 10b codes for
+// each FAA equipment suffix.
+var icaoEquipment = map[string][2]string{
+	"L": {"SDGRW", "C"},
+	"Z": {"SDRW", "C"},
+	"W": {"SDW", "C"},
+	"G": {"SDGR", "C"},
+	"I": {"SDR", "C"},
+	"A": {"SD", "C"},
+	"B": {"SD", "A"},
+	"D": {"SD", "N"},
+	"U": {"S", "C"},
+	"T": {"S", "A"},
+	"X": {"S", "N"},
+}
+
+// ICAOEquipment returns the flight plan's item 10a and 10b equipment
+// codes, derived from the FAA equipment suffix if the plan wasn't filed
+// in ICAO format.
+func (fp FlightPlan) ICAOEquipment() (equipment, surveillance string) {
+	if fp.Equipment != "" {
+		return fp.Equipment, util.Select(fp.Surveillance != "", fp.Surveillance, "N")
+	}
+	if eq, ok := icaoEquipment[fp.EquipmentSuffix()]; ok {
+		return eq[0], eq[1]
+	}
+	return "S", "C"
+}
+
+// HasModeS returns whether the flight plan indicates that the aircraft
+// has a Mode S transponder or ADS-B out and so downlinks its flight ID.
+// FAA equipment suffixes don't say; aircraft with RVSM or GNSS are
+// assumed to have it.
+func (fp FlightPlan) HasModeS() bool {
+	if fp.Equipment != "" {
+		_, surveillance := fp.ICAOEquipment()
+		return strings.ContainsAny(surveillance, "EHILPSXBUV")
+	}
+	switch fp.EquipmentSuffix() {
+	case "L", "Z", "W", "G":
+		return true
+	default:
+		return false
+	}
+}
+
+// EquipmentSuffix returns the FAA equipment suffix from the aircraft
+// type, if there is one.
+func (fp FlightPlan) EquipmentSuffix() string {
+	if t := fp.TypeWithoutSuffix(); t != fp.AircraftType {
+		return strings.TrimPrefix(fp.AircraftType, t+"/")
+	}
+	return ""
+}
+
+// ICAOWakeCategory returns the flight plan's ICAO wake turbulence
+// category: L, M, H, or J.
+func (fp FlightPlan) ICAOWakeCategory() string {
+	if fp.WakeCategory != "" {
+		return fp.WakeCategory
+	}
+	if strings.HasPrefix(fp.AircraftType, "J/") {
+		return "J"
+	} else if strings.HasPrefix(fp.AircraftType, "H/") {
+		return "H"
+	}
+	if perf, ok := DB.AircraftPerformance[fp.BaseType()]; ok {
+		return ICAOWakeCategoryForWeightClass(perf.WeightClass)
+	}
+	return "M"
+}
+
+// ICAOWakeCategoryForWeightClass maps FAA weight classes to ICAO wake
+// categories.
+func ICAOWakeCategoryForWeightClass(wc string) string {
+	switch wc {
+	case "S":
+		return "L"
+	case "H", "J":
+		return wc
+	default:
+		return "M"
+	}
+}
+
+// ICAOTypeAndWake returns the aircraft type and wake category as they are
+// written in item 9, e.g. "B744/H".
+func (fp FlightPlan) ICAOTypeAndWake() string {
+	return fp.BaseType() + "/" + fp.ICAOWakeCategory()
+}
+
+// SetICAOAircraft sets the aircraft type, wake category, and equipment
+// from ICAO items 9 (e.g., "B744/H") and 10 (e.g., "SDE3FGHIJ1RWY/LB1").
+// AircraftType is set to the corresponding FAA form.
+func (fp *FlightPlan) SetICAOAircraft(item9, item10 string) error {
+	// Item 9 may start with the number of aircraft.
+	item9 = strings.TrimLeftFunc(item9, unicode.IsDigit)
+	actype, wake, ok := strings.Cut(item9, "/")
+	if !ok || actype == "" || !strings.Contains("LMHJ", wake) || len(wake) != 1 {
+		return ErrInvalidFlightPlan
+	}
+	eq, surv, _ := strings.Cut(item10, "/")
+	if eq == "" {
+		return ErrInvalidFlightPlan
+	}
+
+	fp.WakeCategory, fp.Equipment, fp.Surveillance = wake, eq, surv
+	switch wake {
+	case "H":
+		actype = "H/" + actype
+	case "J":
+		actype = "J/" + actype
+	}
+	fp.AircraftType = actype + "/" + FAAEquipmentSuffix(eq+fp.pbnEquipment(), surv)
+	return nil
+}
+
+// pbnEquipment returns the item 10a codes implied by the flight plan's
+// PBN capabilities: R for PBN approval and G if any of them use GNSS.
+func (fp FlightPlan) pbnEquipment() string {
+	if fp.PBN == "" {
+		return ""
+	}
+	gnss := slices.ContainsFunc(fp.PBNCodes(), func(spec string) bool {
+		// RNAV 5, 2, and 1 and RNP 1 with all sensors or GNSS; RNP APCH
+		// and RNP AR APCH.
+		return spec[0] == 'S' || spec[0] == 'T' ||
+			(strings.ContainsRune("BCDO", rune(spec[0])) && (spec[1] == '1' || spec[1] == '2'))
+	})
+	return "R" + util.Select(gnss, "G", "")
+}
+
+// RNAVCapable returns whether the flight plan indicates that the aircraft
+// can fly RNAV procedures; it's assumed to if the plan doesn't say.
+func (fp FlightPlan) RNAVCapable() bool {
+	if fp.PBN != "" {
+		return true
+	} else if fp.Equipment != "" {
+		return strings.ContainsAny(fp.Equipment, "GR")
+	}
+	switch fp.EquipmentSuffix() {
+	case "W", "A", "B", "D", "U", "T", "X":
+		return false
+	default:
+		return true
+	}
+}
+
+// PBNCodes returns the flight plan's PBN navigation specifications, e.g.
+// "A1", "D2".
+func (fp FlightPlan) PBNCodes() []string {
+	var codes []string
+	for i := 0; i+1 < len(fp.PBN); i += 2 {
+		codes = append(codes, fp.PBN[i:i+2])
+	}
+	return codes
+}
+
+// ParseRemarks sets the flight plan's indicator fields from OtherInfo and
+// Remarks; where both give one, OtherInfo takes precedence.
+func (fp *FlightPlan) ParseRemarks() {
+	fp.DateOfFlight, fp.PBN, fp.MinimumRVR, fp.STS = time.Time{}, "", 0, ""
+	var sts []string
+
+	for _, ind := range append(parseItem18(fp.Remarks), parseItem18(fp.OtherInfo)...) {
+		f := strings.Fields(ind.value)
+		if len(f) == 0 {
+			continue
+		}
+		switch ind.key {
+		case "DOF":
+			if t, err := time.Parse("060102", f[0]); err == nil {
+				fp.DateOfFlight = t
+			}
+		case "PBN":
+			fp.PBN = f[0]
+		case "RVR":
+			if rvr, err := strconv.Atoi(f[0]); err == nil {
+				fp.MinimumRVR = rvr
+			}
+		case "STS":
+			for _, s := range f {
+				if !slices.Contains(sts, s) {
+					sts = append(sts, s)
+				}
+			}
+		}
+	}
+	fp.STS = strings.Join(sts, " ")
+}
+
+///////////////////////////////////////////////////////////////////////////
+// FPL messages
+
+var (
+	fplSpeedLevelRE = regexp.MustCompile(`^([NK]\d{4}|M\d{3})(F\d{3}|A\d{3}|S\d{4}|M\d{4}|VFR)$`)
+	fplItem18RE     = regexp.MustCompile(`^[A-Z]{3,4}/`)
+)
+
+// ParseICAOFlightPlan parses an ICAO FPL message, e.g.:
+//
+//	(FPL-BAW117-IS
+//	-B744/H-SDE3FGHIJ1RWY/LB1
+//	-EGLL1200
+//	-N0490F330 DVR L9 KONAN ... DCT
+//	-KJFK0715 KBOS KEWR
+//	-PBN/A1B1 DOF/240101 RMK/TCAS)
+func ParseICAOFlightPlan(s string) (*FlightPlan, error) {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "("), ")")
+	items := strings.Split(s, "-")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	if len(items) < 8 || items[0] != "FPL" {
+		return nil, ErrInvalidFlightPlan
+	}
+
+	fp := &FlightPlan{}
+
+	// Item 7: aircraft identification and, optionally, SSR mode and code.
+	callsign, ssr, _ := strings.Cut(items[1], "/")
+	fp.Callsign = callsign
+	if len(ssr) == 5 {
+		sq, err := ParseSquawk(ssr[1:])
+		if err != nil {
+			return nil, err
+		}
+		fp.AssignedSquawk = sq
+	}
+
+	// Item 8: flight rules and type of flight.
+	if items[2] == "" {
+		return nil, ErrInvalidFlightPlan
+	}
+	switch items[2][0] {
+	case 'I', 'Y': // Y: IFR first
+		fp.Rules = IFR
+	case 'V', 'Z': // Z: VFR first
+		fp.Rules = VFR
+	default:
+		return nil, ErrInvalidFlightPlan
+	}
+	fp.FlightType = items[2][1:]
+
+	// Item 18 is needed first in case the type is given there and for
+	// PBN capabilities. Remarks are kept separately.
+	var item18 []fplIndicator
+	if len(items) > 8 {
+		item18 = parseItem18(strings.Join(items[8:], "-"))
+	}
+	var other []string
+	for _, ind := range item18 {
+		if ind.key == "RMK" {
+			fp.Remarks = ind.value
+		} else {
+			other = append(other, ind.key+"/"+ind.value)
+		}
+	}
+	fp.OtherInfo = strings.Join(other, " ")
+	fp.ParseRemarks()
+
+	// Items 9 and 10: aircraft type, wake category, and equipment.
+	item9 := items[3]
+	if strings.HasPrefix(strings.TrimLeftFunc(item9, unicode.IsDigit), "ZZZZ") {
+		for _, ind := range item18 {
+			if f := strings.Fields(ind.value); ind.key == "TYP" && len(f) > 0 {
+				_, wake, _ := strings.Cut(item9, "/")
+				item9 = f[0] + "/" + wake
+			}
+		}
+	}
+	if err := fp.SetICAOAircraft(item9, items[4]); err != nil {
+		return nil, err
+	}
+
+	// Item 13: departure aerodrome and time.
+	if len(items[5]) != 8 {
+		return nil, ErrInvalidFlightPlan
+	}
+	fp.DepartureAirport = items[5][:4]
+	fp.DepartTimeEst, _ = strconv.Atoi(items[5][4:])
+
+	// Item 15: cruising speed, level, and route.
+	speedLevel, route, _ := strings.Cut(items[6], " ")
+	m := fplSpeedLevelRE.FindStringSubmatch(speedLevel)
+	if m == nil {
+		return nil, ErrInvalidFlightPlan
+	}
+	fp.CruiseSpeed = parseFPLSpeed(m[1])
+	fp.Altitude = parseFPLLevel(m[2])
+	fp.Route = strings.TrimSpace(route)
+
+	// Item 16: destination, total EET, and alternates.
+	f := strings.Fields(items[7])
+	if len(f) == 0 || len(f[0]) != 8 {
+		return nil, ErrInvalidFlightPlan
+	}
+	fp.ArrivalAirport = f[0][:4]
+	fp.Hours, _ = strconv.Atoi(f[0][4:6])
+	fp.Minutes, _ = strconv.Atoi(f[0][6:])
+	if len(f) > 1 {
+		fp.AlternateAirport = f[1]
+	}
+	if len(f) > 2 {
+		fp.SecondAlternateAirport = f[2]
+	}
+
+	return fp, nil
+}
+
+type fplIndicator struct {
+	key, value string
+}
+
+func parseItem18(s string) []fplIndicator {
+	var inds []fplIndicator
+	for _, f := range strings.Fields(s) {
+		if fplItem18RE.MatchString(f) {
+			k, v, _ := strings.Cut(f, "/")
+			inds = append(inds, fplIndicator{key: k, value: v})
+		} else if len(inds) > 0 {
+			inds[len(inds)-1].value += " " + f
+		}
+	}
+	return inds
+}
+
+func parseFPLSpeed(s string) int {
+	v, _ := strconv.Atoi(s[1:])
+	switch s[0] {
+	case 'K': // km/h
+		return int(float32(v)*0.539957 + 0.5)
+	case 'M': // hundredths of Mach; use the speed of sound at typical cruise altitudes
+		return int(float32(v)/100*573 + 0.5)
+	default: // knots
+		return v
+	}
+}
+
+func parseFPLLevel(s string) int {
+	if s == "VFR" {
+		return 0
+	}
+	v, _ := strconv.Atoi(s[1:])
+	switch s[0] {
+	case 'F', 'A': // hundreds of feet
+		return 100 * v
+	default: // 'S', 'M': tens of meters
+		return int(float32(10*v)*3.28084 + 0.5)
+	}
+}
+
+// ICAOString returns the flight plan as an ICAO FPL message.
+func (fp FlightPlan) ICAOString() string {
+	var b strings.Builder
+
+	b.WriteString("(FPL-" + fp.Callsign)
+	if fp.AssignedSquawk != 0 {
+		b.WriteString("/A" + fp.AssignedSquawk.String())
+	}
+	b.WriteString("-" + util.Select(fp.Rules == VFR, "V", "I"))
+	if fp.FlightType != "" {
+		b.WriteString(fp.FlightType)
+	} else {
+		b.WriteString(util.Select(fp.Rules == VFR, "G", "S"))
+	}
+
+	eq, surv := fp.ICAOEquipment()
+	b.WriteString("\n-" + fp.ICAOTypeAndWake() + "-" + eq + "/" + surv)
+	fmt.Fprintf(&b, "\n-%s%04d", fp.DepartureAirport, fp.DepartTimeEst)
+
+	level := "VFR"
+	if fp.Altitude >= 18000 {
+		level = fmt.Sprintf("F%03d", fp.Altitude/100)
+	} else if fp.Altitude > 0 {
+		level = fmt.Sprintf("A%03d", fp.Altitude/100)
+	}
+	route := fp.Route
+	if route == "" {
+		route = "DCT"
+	}
+	fmt.Fprintf(&b, "\n-N%04d%s %s", fp.CruiseSpeed, level, route)
+
+	fmt.Fprintf(&b, "\n-%s%02d%02d", fp.ArrivalAirport, fp.Hours, fp.Minutes)
+	for _, alt := range []string{fp.AlternateAirport, fp.SecondAlternateAirport} {
+		if alt != "" {
+			b.WriteString(" " + alt)
+		}
+	}
+
+	var other []string
+	if fp.OtherInfo != "" {
+		other = append(other, fp.OtherInfo)
+	}
+	if fp.Remarks != "" {
+		other = append(other, "RMK/"+fp.Remarks)
+	}
+	if len(other) == 0 {
+		other = []string{"0"}
+	}
+	b.WriteString("\n-" + strings.Join(other, " ") + ")")
+
+	return b.String()
+}
@@ -0,0 +1,115 @@
+// pkg/aviation/intent.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package aviation
+
+import (
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Intent summarizes what an aircraft is going to do given its current
+// clearance: where it's going, what altitude it's climbing or descending
+// to, and the restrictions it's expected to meet along the way. It's
+// derived from the Nav state so that the automation (conflict probe,
+// compliance monitoring, EDST, ...) doesn't need to know how the various
+// controller instructions are represented there.
+type Intent struct {
+	Route   []IntentFix // the rest of the route; nil if being vectored
+	Heading *float32    // assigned heading, if being vectored
+
+	// TargetAltitude is where the aircraft will level off; Interim is set
+	// if that's short of its requested altitude due to a controller's
+	// assignment or the initial clearance.
+	TargetAltitude float32
+	Interim        bool
+	AssignedSpeed  *float32
+
+	// Restrictions that the aircraft is expected to meet, in route order.
+	Constraints []IntentConstraint
+}
+
+type IntentFix struct {
+	Fix      string
+	Location math.Point2LL
+}
+
+// IntentConstraint is a crossing restriction: either one assigned by a
+// controller ("cross MERIT at 10000") or one charted on a STAR that the
+// aircraft is descending via.
+type IntentConstraint struct {
+	Fix      string
+	Location math.Point2LL
+	Kind     string // "crossing" or "descend via"
+	Altitude *AltitudeRestriction
+	Speed    float32 // 0 if none
+}
+
+// Intent returns the intent for an aircraft flying the given flight
+// plan; fp may be nil.
+func (nav *Nav) Intent(fp *FlightPlan) Intent {
+	var in Intent
+
+	if nav.Heading.Assigned != nil {
+		hdg := *nav.Heading.Assigned
+		in.Heading = &hdg
+	} else {
+		in.Route = util.MapSlice(nav.Waypoints, func(wp Waypoint) IntentFix {
+			return IntentFix{Fix: wp.Fix, Location: wp.Location}
+		})
+
+		for _, wp := range nav.Waypoints {
+			if nfa, ok := nav.FixAssignments[wp.Fix]; ok && (nfa.Arrive.Altitude != nil || nfa.Arrive.Speed != nil) {
+				c := IntentConstraint{Fix: wp.Fix, Location: wp.Location, Kind: "crossing", Altitude: nfa.Arrive.Altitude}
+				if nfa.Arrive.Speed != nil {
+					c.Speed = *nfa.Arrive.Speed
+				}
+				in.Constraints = append(in.Constraints, c)
+			} else if wp.OnSTAR && nav.Altitude.Assigned == nil && (wp.AltitudeRestriction != nil || wp.Speed != 0) {
+				// Charted restrictions are followed on STARs unless the
+				// controller has assigned an altitude.
+				in.Constraints = append(in.Constraints, IntentConstraint{Fix: wp.Fix, Location: wp.Location,
+					Kind: "descend via", Altitude: wp.AltitudeRestriction, Speed: float32(wp.Speed)})
+			}
+		}
+	}
+
+	if a := nav.Altitude.Assigned; a != nil {
+		in.TargetAltitude = *a
+	} else if a := nav.Altitude.Cleared; a != nil {
+		in.TargetAltitude = *a
+	} else if fp != nil && fp.Altitude != 0 {
+		in.TargetAltitude = float32(fp.Altitude)
+	} else {
+		in.TargetAltitude = nav.FlightState.Altitude
+	}
+	in.Interim = fp != nil && fp.Altitude != 0 && int(in.TargetAltitude) != fp.Altitude
+
+	if s := nav.Speed.Assigned; s != nil {
+		spd := *s
+		in.AssignedSpeed = &spd
+	}
+
+	return in
+}
+
+func (ac *Aircraft) Intent() Intent {
+	return ac.Nav.Intent(ac.FlightPlan)
+}
+
+// RoutePoints returns the locations of the fixes in the rest of the
+// route.
+func (in Intent) RoutePoints() []math.Point2LL {
+	return util.MapSlice(in.Route, func(f IntentFix) math.Point2LL { return f.Location })
+}
+
+// IncludesFix returns whether the rest of the route includes the fix.
+func (in Intent) IncludesFix(fix string) bool {
+	for _, f := range in.Route {
+		if f.Fix == fix {
+			return true
+		}
+	}
+	return false
+}
@@ -48,12 +48,8 @@ type Nav struct {
 // seconds after the controller issues it in order to model the delay
 // before pilots start to follow assignments.
 type DeferredHeading struct {
-	// Time is just plain old wallclock time; it should be sim time, but a
-	// lot of replumbing would be required to have that available where
-	// needed. The downsides are minor: 1. On quit and resume, any pending
-	// assignments will generally be followed immediately, and 2. if the
-	// sim rate is increased, the delay will end up being longer than
-	// intended.
+	// Time is w.r.t. sim time, so that the delay is independent of the
+	// sim rate and of pauses and so that seeded sims are reproducible.
 	Time    time.Time
 	Heading NavHeading
 }
@@ -124,6 +120,7 @@ type NavHeading struct {
 	JoiningArc   bool
 	RacetrackPT  *FlyRacetrackPT
 	Standard45PT *FlyStandard45PT
+	Hold         *FlyHold
 }
 
 type NavApproach struct {
@@ -239,7 +236,7 @@ func MakeOverflightNav(callsign string, of *Overflight, fp FlightPlan, perf Airc
 			nav.Speed.Assigned = &spd
 		}
 
-		nav.FlightState.Altitude = float32(rand.SampleSlice(of.InitialAltitudes))
+		nav.FlightState.Altitude = float32(rand.SampleSliceWith(&nav.Rand, of.InitialAltitudes))
 		nav.FlightState.IAS = of.InitialSpeed
 		// This won't be quite right but it's better than leaving GS to be
 		// 0 for the first nav update tick which leads to various Inf and
@@ -262,7 +259,7 @@ func makeNav(callsign string, fp FlightPlan, perf AircraftPerformance, wp []Wayp
 	}
 	nav.Rand.Seed(util.HashString64(callsign))
 
-	nav.Waypoints = RandomizeRoute(nav.Waypoints, randomizeAltitudeRange, nav.Perf, nmPerLongitude,
+	nav.Waypoints = RandomizeRoute(nav.Waypoints, &nav.Rand, randomizeAltitudeRange, nav.Perf, nmPerLongitude,
 		magneticVariation, fp.ArrivalAirport, wind, lg)
 
 	if fp.Rules == IFR && slices.ContainsFunc(nav.Waypoints, func(wp Waypoint) bool { return wp.Land }) {
@@ -292,14 +289,14 @@ func makeNav(callsign string, fp FlightPlan, perf AircraftPerformance, wp []Wayp
 	nav.Waypoints = util.FilterSliceInPlace(nav.Waypoints,
 		func(wp Waypoint) bool { return !wp.Location.IsZero() })
 
-	if ap, ok := DB.Airports[fp.DepartureAirport]; !ok {
+	if ap, ok := DB.Airports()[fp.DepartureAirport]; !ok {
 		lg.Errorf("%s: departure airport unknown", fp.DepartureAirport)
 		return nil
 	} else {
 		nav.FlightState.DepartureAirportLocation = ap.Location
 		nav.FlightState.DepartureAirportElevation = float32(ap.Elevation)
 	}
-	if ap, ok := DB.Airports[fp.ArrivalAirport]; !ok {
+	if ap, ok := DB.Airports()[fp.ArrivalAirport]; !ok {
 		lg.Errorf("%s: arrival airport unknown", fp.ArrivalAirport)
 		return nil
 	} else {
@@ -357,11 +354,10 @@ func (nav *Nav) AssignedHeading() (float32, bool) {
 // few seconds in the future. It should only be called for heading changes
 // due to controller instructions to the pilot and never in cases where the
 // autopilot is changing the heading assignment.
-func (nav *Nav) EnqueueHeading(h NavHeading) {
+func (nav *Nav) EnqueueHeading(h NavHeading, simTime time.Time) {
 	delay := 3 + 3*nav.Rand.Float32()
-	now := time.Now()
 	nav.DeferredHeading = &DeferredHeading{
-		Time:    now.Add(time.Duration(delay * float32(time.Second))),
+		Time:    simTime.Add(time.Duration(delay * float32(time.Second))),
 		Heading: h,
 	}
 }
@@ -550,6 +546,14 @@ func (nav *Nav) Summary(fp FlightPlan, lg *log.Logger) string {
 			lines = append(lines, fmt.Sprintf("Fly the standard 45/180 procedure turn at %s", pt.Fix))
 		}
 	}
+	if h := nav.Heading.Hold; h != nil {
+		line := fmt.Sprintf("Hold %s of %s, inbound course %03d, %s turns", math.Compass(h.OutboundCourse()),
+			h.Fix, int(h.InboundCourse), util.Select(h.RightTurns, "right", "left"))
+		if !h.EFC.IsZero() {
+			line += ", EFC " + h.EFC.UTC().Format("1504")
+		}
+		lines = append(lines, line)
+	}
 
 	lines = append(lines, "Route: "+WaypointArray(nav.Waypoints).Encode())
 
@@ -808,8 +812,8 @@ func (nav *Nav) updateAltitude(targetAltitude, targetRate float32, lg *log.Logge
 	}
 }
 
-func (nav *Nav) updateHeading(wind WindModel, lg *log.Logger) {
-	targetHeading, turnDirection, turnRate := nav.TargetHeading(wind, lg)
+func (nav *Nav) updateHeading(wind WindModel, simTime time.Time, lg *log.Logger) {
+	targetHeading, turnDirection, turnRate := nav.TargetHeading(wind, simTime, lg)
 
 	if nav.FlightState.Heading == targetHeading {
 		return
@@ -859,7 +863,7 @@ func (nav *Nav) updatePositionAndGS(wind WindModel, lg *log.Logger) {
 	nav.FlightState.GS = math.Length2f(math.Add2f(flightVector, windVector)) * 3600
 }
 
-func (nav *Nav) DepartOnCourse(alt float32, exit string) {
+func (nav *Nav) DepartOnCourse(alt float32, exit string, simTime time.Time) {
 	if _, ok := nav.AssignedHeading(); !ok {
 		// Don't do anything if they are not on a heading; let them fly the
 		// regular route and don't (potentially) skip waypoints and go
@@ -875,7 +879,7 @@ func (nav *Nav) DepartOnCourse(alt float32, exit string) {
 	}
 	nav.Altitude = NavAltitude{Assigned: &alt}
 	nav.Speed = NavSpeed{}
-	nav.EnqueueHeading(NavHeading{})
+	nav.EnqueueHeading(NavHeading{}, simTime)
 }
 
 func (nav *Nav) Check(lg *log.Logger) {
@@ -896,11 +900,11 @@ func (nav *Nav) Check(lg *log.Logger) {
 }
 
 // returns passed waypoint if any
-func (nav *Nav) Update(wind WindModel, fp *FlightPlan, lg *log.Logger) *Waypoint {
+func (nav *Nav) Update(wind WindModel, fp *FlightPlan, simTime time.Time, lg *log.Logger) *Waypoint {
 	targetAltitude, altitudeRate := nav.TargetAltitude(lg)
 	deltaKts, slowingTo250 := nav.updateAirspeed(targetAltitude, lg)
 	nav.updateAltitude(targetAltitude, altitudeRate, lg, deltaKts, slowingTo250)
-	nav.updateHeading(wind, lg)
+	nav.updateHeading(wind, simTime, lg)
 	nav.updatePositionAndGS(wind, lg)
 	if nav.Airwork != nil && !nav.Airwork.Update(nav) {
 		nav.Airwork = nil // Done.
@@ -911,21 +915,21 @@ func (nav *Nav) Update(wind WindModel, fp *FlightPlan, lg *log.Logger) *Waypoint
 	// Don't refer to DeferredHeading here; assume that if the pilot hasn't
 	// punched in a new heading assignment, we should update waypoints or
 	// not as per the old assignment.
-	if nav.Airwork == nil && nav.Heading.Assigned == nil {
+	if nav.Airwork == nil && nav.Heading.Assigned == nil && nav.Heading.Hold == nil {
 		return nav.updateWaypoints(wind, fp, lg)
 	}
 
 	return nil
 }
 
-func (nav *Nav) TargetHeading(wind WindModel, lg *log.Logger) (heading float32, turn TurnMethod, rate float32) {
+func (nav *Nav) TargetHeading(wind WindModel, simTime time.Time, lg *log.Logger) (heading float32, turn TurnMethod, rate float32) {
 	if nav.Airwork != nil {
 		return nav.Airwork.TargetHeading()
 	}
 
 	// Is it time to start following a heading given by the controller a
 	// few seconds ago?
-	if dh := nav.DeferredHeading; dh != nil && time.Now().After(dh.Time) {
+	if dh := nav.DeferredHeading; dh != nil && simTime.After(dh.Time) {
 		lg.Debug("initiating deferred heading assignment", slog.Any("heading", dh.Heading))
 		nav.Heading = dh.Heading
 		nav.DeferredHeading = nil
@@ -945,6 +949,9 @@ func (nav *Nav) TargetHeading(wind WindModel, lg *log.Logger) (heading float32,
 	if nav.Heading.Standard45PT != nil {
 		return nav.Heading.Standard45PT.GetHeading(nav, wind, lg)
 	}
+	if nav.Heading.Hold != nil {
+		return nav.Heading.Hold.GetHeading(nav, wind, lg)
+	}
 
 	if nav.Heading.Assigned != nil {
 		heading = *nav.Heading.Assigned
@@ -1428,6 +1435,11 @@ func (nav *Nav) TargetSpeed(targetAltitude float32, lg *log.Logger) (float32, fl
 		//lg.Debugf("speed: %.0f assigned", *nav.Speed.Assigned)
 		return *nav.Speed.Assigned, MaximumRate
 	}
+	if nav.Heading.Hold != nil {
+		// Slow to holding speed, if needed.
+		ias, rate := nav.targetAltitudeIAS()
+		return math.Min(ias, HoldingSpeed(nav.FlightState.Altitude)), rate
+	}
 
 	// Manage the speed profile in the initial climb
 	if nav.FlightState.InitialDepartureClimb {
@@ -1811,7 +1823,7 @@ func (nav *Nav) shouldTurnForOutbound(p math.Point2LL, hdg float32, turn TurnMet
 	// Don't simulate the turn longer than it will take to do it.
 	n := int(1 + turnAngle/3)
 	for i := 0; i < n; i++ {
-		nav2.Update(wind, nil, nil)
+		nav2.Update(wind, nil, time.Time{}, nil)
 		curDist := math.SignedPointLineDistance(math.LL2NM(nav2.FlightState.Position,
 			nav2.FlightState.NmPerLongitude),
 			p0, p1)
@@ -1852,7 +1864,7 @@ func (nav *Nav) shouldTurnToIntercept(p0 math.Point2LL, hdg float32, turn TurnMe
 
 	n := int(1 + turnAngle/3)
 	for i := 0; i < n; i++ {
-		nav2.Update(wind, nil, nil)
+		nav2.Update(wind, nil, time.Time{}, nil)
 		curDist := math.SignedPointLineDistance(math.LL2NM(nav2.FlightState.Position, nav2.FlightState.NmPerLongitude), p0, p1)
 		if math.Sign(initialDist) != math.Sign(curDist) && math.Abs(curDist) < .25 && math.HeadingDifference(hdg, nav2.FlightState.Heading) < 3.5 {
 			lg.Debugf("turning now to intercept radial in %d seconds", i)
@@ -1902,13 +1914,22 @@ func (nav *Nav) GoAround() PilotResponse {
 	nav.Speed = NavSpeed{}
 
 	alt := float32(1000 * int((nav.FlightState.ArrivalAirportElevation+2500)/1000))
+	// Keep the destination airport at the end of the route.
+	nav.Waypoints = []Waypoint{nav.FlightState.ArrivalAirport}
+
+	// Fly the published missed approach, if there is one.
+	if appr := nav.Approach.Assigned; appr != nil && len(appr.MissedApproach) > 0 {
+		nav.Heading = NavHeading{}
+		nav.Waypoints = append(util.DuplicateSlice(appr.MissedApproach), nav.FlightState.ArrivalAirport)
+		if appr.MissedApproachAltitude > 0 {
+			alt = float32(appr.MissedApproachAltitude)
+		}
+	}
 	nav.Altitude = NavAltitude{Assigned: &alt}
 
 	nav.Approach = NavApproach{}
-	// Keep the destination airport at the end of the route.
-	nav.Waypoints = []Waypoint{nav.FlightState.ArrivalAirport}
 
-	s := rand.Sample("going around", "on the go")
+	s := rand.SampleWith(&nav.Rand, "going around", "on the go")
 	return PilotResponse{Message: s}
 }
 
@@ -1919,11 +1940,11 @@ func (nav *Nav) AssignAltitude(alt float32, afterSpeed bool) PilotResponse {
 
 	var response string
 	if alt > nav.FlightState.Altitude {
-		response = rand.Sample("climb and maintain ", "up to ") + FormatAltitude(alt)
+		response = rand.SampleWith(&nav.Rand, "climb and maintain ", "up to ") + FormatAltitude(alt)
 	} else if alt == nav.FlightState.Altitude {
-		response = rand.Sample("maintain ", "we'll keep it at ") + FormatAltitude(alt)
+		response = rand.SampleWith(&nav.Rand, "maintain ", "we'll keep it at ") + FormatAltitude(alt)
 	} else {
-		response = rand.Sample("descend and maintain ", "down to ") + FormatAltitude(alt)
+		response = rand.SampleWith(&nav.Rand, "descend and maintain ", "down to ") + FormatAltitude(alt)
 	}
 
 	if afterSpeed && nav.Speed.Assigned != nil && *nav.Speed.Assigned != nav.FlightState.IAS {
@@ -1964,13 +1985,13 @@ func (nav *Nav) AssignSpeed(speed float32, afterAltitude bool) PilotResponse {
 	} else {
 		nav.Speed = NavSpeed{Assigned: &speed}
 		if speed < nav.FlightState.IAS {
-			msg := rand.Sample("reduce speed to %.0f knots", "speed %.0f", "pulling it back to %.0f", "%.0f for the speed", "slow to %.0f")
+			msg := rand.SampleWith(&nav.Rand, "reduce speed to %.0f knots", "speed %.0f", "pulling it back to %.0f", "%.0f for the speed", "slow to %.0f")
 			response = fmt.Sprintf(msg, speed)
 		} else if speed > nav.FlightState.IAS {
-			msg := rand.Sample("increase speed to %.0f knots", "speed %.0f", "%.0f for the speed", "maintain %.0f knots")
+			msg := rand.SampleWith(&nav.Rand, "increase speed to %.0f knots", "speed %.0f", "%.0f for the speed", "maintain %.0f knots")
 			response = fmt.Sprintf(msg, speed)
 		} else {
-			msg := rand.Sample("maintain %.0f knots", "keep it at %.0f", "well stay at %.0f")
+			msg := rand.SampleWith(&nav.Rand, "maintain %.0f knots", "keep it at %.0f", "well stay at %.0f")
 			response = fmt.Sprintf(msg, speed)
 		}
 	}
@@ -1979,13 +2000,13 @@ func (nav *Nav) AssignSpeed(speed float32, afterAltitude bool) PilotResponse {
 
 func (nav *Nav) MaintainSlowestPractical() PilotResponse {
 	nav.Speed = NavSpeed{MaintainSlowestPractical: true}
-	r := rand.Sample("we'll maintain slowest practical speed", "slowing as much as we can")
+	r := rand.SampleWith(&nav.Rand, "we'll maintain slowest practical speed", "slowing as much as we can")
 	return PilotResponse{Message: r}
 }
 
 func (nav *Nav) MaintainMaximumForward() PilotResponse {
 	nav.Speed = NavSpeed{MaintainMaximumForward: true}
-	r := rand.Sample("we'll keep it at maximum forward speed", "maintaining maximum forward speed")
+	r := rand.SampleWith(&nav.Rand, "we'll keep it at maximum forward speed", "maintaining maximum forward speed")
 	return PilotResponse{Message: r}
 }
 
@@ -1996,16 +2017,16 @@ func (nav *Nav) SaySpeed() PilotResponse {
 	if nav.Speed.Assigned != nil {
 		assignedSpeed := *nav.Speed.Assigned
 		if assignedSpeed < currentSpeed {
-			output = rand.Sample(fmt.Sprintf("at %.0f slowing to %.0f", currentSpeed, assignedSpeed),
+			output = rand.SampleWith(&nav.Rand, fmt.Sprintf("at %.0f slowing to %.0f", currentSpeed, assignedSpeed),
 				fmt.Sprintf("at %.0f and slowing", currentSpeed))
 
 		} else if assignedSpeed > currentSpeed {
 			output = fmt.Sprintf("at %0.f speeding up to %.0f", currentSpeed, assignedSpeed)
 		} else {
-			output = rand.Sample(fmt.Sprintf("maintaining %.0f knots", currentSpeed), fmt.Sprintf("at %.0f knots", currentSpeed))
+			output = rand.SampleWith(&nav.Rand, fmt.Sprintf("maintaining %.0f knots", currentSpeed), fmt.Sprintf("at %.0f knots", currentSpeed))
 		}
 	} else {
-		output = rand.Sample(fmt.Sprintf("maintaining %.0f knots", currentSpeed), fmt.Sprintf("at %.0f knots", currentSpeed))
+		output = rand.SampleWith(&nav.Rand, fmt.Sprintf("maintaining %.0f knots", currentSpeed), fmt.Sprintf("at %.0f knots", currentSpeed))
 	}
 	return PilotResponse{Message: output}
 }
@@ -2035,16 +2056,16 @@ func (nav *Nav) SayAltitude() PilotResponse {
 	if nav.Altitude.Assigned != nil {
 		assignedAltitude := *nav.Altitude.Assigned
 		if assignedAltitude < currentAltitude {
-			output = rand.Sample(fmt.Sprintf("at %s descending to %s", FormatAltitude(currentAltitude), FormatAltitude(assignedAltitude)),
+			output = rand.SampleWith(&nav.Rand, fmt.Sprintf("at %s descending to %s", FormatAltitude(currentAltitude), FormatAltitude(assignedAltitude)),
 				fmt.Sprintf("at %s and descending", FormatAltitude(currentAltitude)))
 
 		} else if assignedAltitude > currentAltitude {
 			output = fmt.Sprintf("at %s climbing to %s", FormatAltitude(currentAltitude), FormatAltitude(assignedAltitude))
 		} else {
-			output = rand.Sample(fmt.Sprintf("maintaining %s", FormatAltitude(currentAltitude)), fmt.Sprintf("at %s", FormatAltitude(currentAltitude)))
+			output = rand.SampleWith(&nav.Rand, fmt.Sprintf("maintaining %s", FormatAltitude(currentAltitude)), fmt.Sprintf("at %s", FormatAltitude(currentAltitude)))
 		}
 	} else {
-		output = rand.Sample(fmt.Sprintf("maintaining %s", FormatAltitude(currentAltitude)), fmt.Sprintf("at %s", FormatAltitude(currentAltitude)))
+		output = rand.SampleWith(&nav.Rand, fmt.Sprintf("maintaining %s", FormatAltitude(currentAltitude)), fmt.Sprintf("at %s", FormatAltitude(currentAltitude)))
 	}
 
 	return PilotResponse{Message: output}
@@ -2055,7 +2076,7 @@ func (nav *Nav) ExpediteDescent() PilotResponse {
 	if alt >= nav.FlightState.Altitude {
 		if nav.Altitude.AfterSpeed != nil {
 			nav.Altitude.ExpediteAfterSpeed = true
-			resp := rand.Sample("expediting down to", "expedite to")
+			resp := rand.SampleWith(&nav.Rand, "expediting down to", "expedite to")
 			return PilotResponse{Message: resp + " " + FormatAltitude(*nav.Altitude.AfterSpeed) + " once we're at " +
 				fmt.Sprintf("%d", int(*nav.Altitude.AfterSpeedSpeed))}
 		} else {
@@ -2063,11 +2084,11 @@ func (nav *Nav) ExpediteDescent() PilotResponse {
 		}
 	}
 	if nav.Altitude.Expedite {
-		return PilotResponse{Message: rand.Sample("we're already expediting", "that's our best rate")}
+		return PilotResponse{Message: rand.SampleWith(&nav.Rand, "we're already expediting", "that's our best rate")}
 	}
 
 	nav.Altitude.Expedite = true
-	resp := rand.Sample("expediting down to", "expedite to")
+	resp := rand.SampleWith(&nav.Rand, "expediting down to", "expedite to")
 	return PilotResponse{Message: resp + " " + FormatAltitude(alt)}
 }
 
@@ -2076,7 +2097,7 @@ func (nav *Nav) ExpediteClimb() PilotResponse {
 	if alt <= nav.FlightState.Altitude {
 		if nav.Altitude.AfterSpeed != nil {
 			nav.Altitude.ExpediteAfterSpeed = true
-			resp := rand.Sample("expediting up to", "expedite to")
+			resp := rand.SampleWith(&nav.Rand, "expediting up to", "expedite to")
 			return PilotResponse{Message: resp + " " + FormatAltitude(*nav.Altitude.AfterSpeed) + " once we're at " +
 				fmt.Sprintf("%d", int(*nav.Altitude.AfterSpeedSpeed))}
 		} else {
@@ -2084,21 +2105,21 @@ func (nav *Nav) ExpediteClimb() PilotResponse {
 		}
 	}
 	if nav.Altitude.Expedite {
-		r := rand.Sample("we're already expediting", "that's our best rate")
+		r := rand.SampleWith(&nav.Rand, "we're already expediting", "that's our best rate")
 		return PilotResponse{Message: r}
 	}
 
 	nav.Altitude.Expedite = true
-	resp := rand.Sample("expediting up to", "expedite to")
+	resp := rand.SampleWith(&nav.Rand, "expediting up to", "expedite to")
 	return PilotResponse{Message: resp + " " + FormatAltitude(alt)}
 }
 
-func (nav *Nav) AssignHeading(hdg float32, turn TurnMethod) PilotResponse {
+func (nav *Nav) AssignHeading(hdg float32, turn TurnMethod, simTime time.Time) PilotResponse {
 	if hdg <= 0 || hdg > 360 {
 		return PilotResponse{Message: fmt.Sprintf("unable. %.0f isn't a valid heading", hdg), Unexpected: true}
 	}
 
-	nav.assignHeading(hdg, turn)
+	nav.assignHeading(hdg, turn, simTime)
 
 	switch turn {
 	case TurnClosest:
@@ -2112,7 +2133,7 @@ func (nav *Nav) AssignHeading(hdg float32, turn TurnMethod) PilotResponse {
 	}
 }
 
-func (nav *Nav) assignHeading(hdg float32, turn TurnMethod) {
+func (nav *Nav) assignHeading(hdg float32, turn TurnMethod, simTime time.Time) {
 	if _, ok := nav.AssignedHeading(); !ok {
 		// Only cancel approach clearance if the aircraft wasn't on a
 		// heading and now we're giving them one.
@@ -2135,11 +2156,11 @@ func (nav *Nav) assignHeading(hdg float32, turn TurnMethod) {
 
 	// Don't carry this from a waypoint we may have previously passed.
 	nav.Approach.NoPT = false
-	nav.EnqueueHeading(NavHeading{Assigned: &hdg, Turn: &turn})
+	nav.EnqueueHeading(NavHeading{Assigned: &hdg, Turn: &turn}, simTime)
 }
 
-func (nav *Nav) FlyPresentHeading() PilotResponse {
-	nav.assignHeading(nav.FlightState.Heading, TurnClosest)
+func (nav *Nav) FlyPresentHeading(simTime time.Time) PilotResponse {
+	nav.assignHeading(nav.FlightState.Heading, TurnClosest, simTime)
 	return PilotResponse{Message: "fly present heading"}
 }
 
@@ -2240,9 +2261,9 @@ func (nav *Nav) directFix(fix string) bool {
 	return false
 }
 
-func (nav *Nav) DirectFix(fix string) PilotResponse {
+func (nav *Nav) DirectFix(fix string, simTime time.Time) PilotResponse {
 	if nav.directFix(fix) {
-		nav.EnqueueHeading(NavHeading{})
+		nav.EnqueueHeading(NavHeading{}, simTime)
 		nav.Approach.NoPT = false
 		nav.Approach.InterceptState = NotIntercepting
 
@@ -2396,7 +2417,7 @@ func (nav *Nav) ExpectApproach(airport *Airport, id string, runwayWaypoints map[
 		}
 	}
 
-	opener := rand.Sample("we'll expect the", "expecting the", "we'll plan for the")
+	opener := rand.SampleWith(&nav.Rand, "we'll expect the", "expecting the", "we'll plan for the")
 	return PilotResponse{Message: opener + " " + ap.FullName + " approach"}
 }
 
@@ -2418,9 +2439,9 @@ func (nav *Nav) InterceptApproach(airport string) PilotResponse {
 		ap := nav.Approach.Assigned
 		var r string
 		if ap.Type == ILSApproach || ap.Type == LocalizerApproach {
-			r = rand.Sample("intercepting the "+ap.FullName+" approach", "intercepting "+ap.FullName)
+			r = rand.SampleWith(&nav.Rand, "intercepting the "+ap.FullName+" approach", "intercepting "+ap.FullName)
 		} else {
-			r = rand.Sample("joining the "+ap.FullName+" approach course", "joining "+ap.FullName)
+			r = rand.SampleWith(&nav.Rand, "joining the "+ap.FullName+" approach course", "joining "+ap.FullName)
 		}
 		return PilotResponse{Message: r}
 	}
@@ -2451,7 +2472,7 @@ func (nav *Nav) AtFixCleared(fix, id string) PilotResponse {
 		}
 	}
 
-	return PilotResponse{Message: rand.Sample("at "+fix+", cleared "+ap.FullName,
+	return PilotResponse{Message: rand.SampleWith(&nav.Rand, "at "+fix+", cleared "+ap.FullName,
 		"cleared "+ap.FullName+" at "+fix)}
 }
 
@@ -2587,7 +2608,7 @@ func (nav *Nav) prepareForChartedVisual() (PilotResponse, error) {
 
 	if wi != nil {
 		// Update the route and go direct to the intercept point.
-		nav.Waypoints = append(wi, nav.FlightState.ArrivalAirport)
+		nav.Waypoints = append(nav.varyChartedVisualRoute(wi), nav.FlightState.ArrivalAirport)
 		nav.Heading = NavHeading{}
 		nav.DeferredHeading = nil
 		return PilotResponse{}, nil
@@ -2597,6 +2618,40 @@ func (nav *Nav) prepareForChartedVisual() (PilotResponse, error) {
 		ErrUnableCommand
 }
 
+// varyChartedVisualRoute returns a copy of the charted visual route with
+// the waypoints offset a little to one side or the other of the charted
+// track: pilots fly the route by eye, so no two aircraft fly exactly the
+// same track, though each pilot tends to be off to the same side.
+// Waypoints at landmarks, which are easy to fly to, and the last waypoint,
+// which lines the aircraft up with the runway, are left alone.
+func (nav *Nav) varyChartedVisualRoute(wps []Waypoint) []Waypoint {
+	const maxOffset = 0.4 // nm
+
+	wps = util.DuplicateSlice(wps)
+	nmPerLongitude := nav.FlightState.NmPerLongitude
+	bias := nav.Rand.Float32()*2 - 1
+	for i := 0; i < len(wps)-1; i++ {
+		if wps[i].Landmark != "" || wps[i].Fix == "intercept" {
+			continue
+		}
+
+		prev := nav.FlightState.Position
+		if i > 0 {
+			prev = wps[i-1].Location
+		}
+		d := math.Sub2f(math.LL2NM(wps[i+1].Location, nmPerLongitude), math.LL2NM(prev, nmPerLongitude))
+		if math.Length2f(d) == 0 {
+			continue
+		}
+		perp := math.Normalize2f([2]float32{-d[1], d[0]})
+
+		offset := maxOffset * (0.7*bias + 0.3*(nav.Rand.Float32()*2-1))
+		p := math.Add2f(math.LL2NM(wps[i].Location, nmPerLongitude), math.Scale2f(perp, offset))
+		wps[i].Location = math.NM2LL(p, nmPerLongitude)
+	}
+	return wps
+}
+
 func (nav *Nav) clearedApproach(airport string, id string, straightIn bool) (PilotResponse, error) {
 	ap := nav.Approach.Assigned
 	if ap == nil {
@@ -2629,6 +2684,9 @@ func (nav *Nav) clearedApproach(airport string, id string, straightIn bool) (Pil
 
 		if straightIn {
 			return PilotResponse{Message: "cleared straight in " + ap.FullName + " approach"}, nil
+		} else if idx := slices.IndexFunc(nav.Waypoints, func(wp Waypoint) bool { return wp.Landmark != "" }); idx != -1 {
+			return PilotResponse{Message: "cleared " + ap.FullName + " approach, we have " +
+				nav.Waypoints[idx].Landmark + " in sight"}, nil
 		} else {
 			return PilotResponse{Message: "cleared " + ap.FullName + " approach"}, nil
 		}
@@ -2647,25 +2705,25 @@ func (nav *Nav) CancelApproachClearance() PilotResponse {
 	return PilotResponse{Message: "cancel approach clearance."}
 }
 
-func (nav *Nav) ClimbViaSID() PilotResponse {
+func (nav *Nav) ClimbViaSID(simTime time.Time) PilotResponse {
 	if len(nav.Waypoints) == 0 || !nav.Waypoints[0].OnSID {
 		return PilotResponse{Message: "unable. We're not flying a departure procedure", Unexpected: true}
 	}
 
 	nav.Altitude = NavAltitude{}
 	nav.Speed = NavSpeed{}
-	nav.EnqueueHeading(NavHeading{})
+	nav.EnqueueHeading(NavHeading{}, simTime)
 	return PilotResponse{Message: "climb via the SID"}
 }
 
-func (nav *Nav) DescendViaSTAR() PilotResponse {
+func (nav *Nav) DescendViaSTAR(simTime time.Time) PilotResponse {
 	if len(nav.Waypoints) == 0 || !nav.Waypoints[0].OnSTAR {
 		return PilotResponse{Message: "unable. We're not on a STAR", Unexpected: true}
 	}
 
 	nav.Altitude = NavAltitude{}
 	nav.Speed = NavSpeed{}
-	nav.EnqueueHeading(NavHeading{})
+	nav.EnqueueHeading(NavHeading{}, simTime)
 	return PilotResponse{Message: "descend via the STAR"}
 }
 
@@ -2693,6 +2751,162 @@ func (nav *Nav) InterceptedButNotCleared() bool {
 	return nav.Approach.InterceptState == OnApproachCourse && !nav.Approach.Cleared
 }
 
+///////////////////////////////////////////////////////////////////////////
+// Holding
+
+// FlyHold is a holding pattern at a fix that the controller has assigned.
+// Aircraft always make a direct entry: they fly to the fix and then turn
+// outbound in the direction of the hold. The pattern is flown until the
+// aircraft is given another routing or heading.
+type FlyHold struct {
+	Fix           string
+	FixLocation   math.Point2LL
+	InboundCourse float32 // magnetic
+	RightTurns    bool
+	// Expect further clearance time; this is only used by the sim and
+	// may be zero.
+	EFC time.Time
+
+	State     int
+	LegLength float32 // nm; set when the outbound leg starts
+}
+
+const (
+	HoldStateToFix = iota
+	HoldStateTurningOutbound
+	HoldStateFlyingOutbound
+	HoldStateTurningInbound
+)
+
+// HoldingSpeed returns the maximum holding airspeed at the given
+// altitude.
+func HoldingSpeed(alt float32) float32 {
+	if alt <= 6000 {
+		return 200
+	} else if alt <= 14000 {
+		return 230
+	}
+	return 265
+}
+
+func (h *FlyHold) OutboundCourse() float32 {
+	return math.OppositeHeading(h.InboundCourse)
+}
+
+func (h *FlyHold) turn() TurnMethod {
+	return TurnMethod(util.Select(h.RightTurns, TurnRight, TurnLeft))
+}
+
+// Entered returns whether the aircraft has reached the fix and started
+// flying the pattern.
+func (h *FlyHold) Entered() bool {
+	return h.State != HoldStateToFix || h.LegLength != 0
+}
+
+// Readback returns the pilot's readback of the holding instructions, e.g.
+// "hold east of CAMRN, left turns".
+func (h *FlyHold) Readback() string {
+	s := "hold " + strings.ToLower(math.Compass(h.OutboundCourse())) + " of " + FixReadback(h.Fix)
+	if !h.RightTurns {
+		s += ", left turns"
+	}
+	return s
+}
+
+// distancePastFix returns how far the aircraft has flown along the
+// outbound course past abeam the fix.
+func (h *FlyHold) distancePastFix(nav *Nav) float32 {
+	nmPerLongitude := nav.FlightState.NmPerLongitude
+	d := math.Sub2f(math.LL2NM(nav.FlightState.Position, nmPerLongitude), math.LL2NM(h.FixLocation, nmPerLongitude))
+	// Headings are magnetic; the offset is in true coordinates.
+	hdg := math.Radians(h.OutboundCourse() - nav.FlightState.MagneticVariation)
+	return math.Dot(d, [2]float32{math.Sin(hdg), math.Cos(hdg)})
+}
+
+func (h *FlyHold) GetHeading(nav *Nav, wind WindModel, lg *log.Logger) (float32, TurnMethod, float32) {
+	switch h.State {
+	case HoldStateToFix:
+		dist := math.NMDistance2LL(nav.FlightState.Position, h.FixLocation)
+		if eta := dist / math.Max(nav.FlightState.GS, 60) * 3600; eta < 2 {
+			lg.Debugf("hold: at %s, turning outbound to %.0f", h.Fix, h.OutboundCourse())
+			h.State = HoldStateTurningOutbound
+		}
+		fixHeading := math.Heading2LL(nav.FlightState.Position, h.FixLocation, nav.FlightState.NmPerLongitude,
+			nav.FlightState.MagneticVariation)
+		return fixHeading, TurnClosest, StandardTurnRate
+
+	case HoldStateTurningOutbound:
+		if math.HeadingDifference(nav.FlightState.Heading, h.OutboundCourse()) < 1 {
+			// One minute legs at and below 14,000', 1.5 minutes above.
+			minutes := util.Select(nav.FlightState.Altitude <= 14000, float32(1), float32(1.5))
+			h.LegLength = minutes * nav.FlightState.GS / 60
+			h.State = HoldStateFlyingOutbound
+		}
+		return h.OutboundCourse(), h.turn(), StandardTurnRate
+
+	case HoldStateFlyingOutbound:
+		// The outbound leg is timed from abeam the fix.
+		if h.distancePastFix(nav) > h.LegLength {
+			h.State = HoldStateTurningInbound
+		}
+		return h.OutboundCourse(), TurnClosest, StandardTurnRate
+
+	case HoldStateTurningInbound:
+		if math.HeadingDifference(nav.FlightState.Heading, h.InboundCourse) < 1 {
+			h.State = HoldStateToFix
+		}
+		return h.InboundCourse, h.turn(), StandardTurnRate
+
+	default:
+		panic("unhandled hold state")
+	}
+}
+
+// Hold instructs the aircraft to hold at the given fix. The inbound
+// course is the one from the aircraft's current position.
+func (nav *Nav) Hold(fix string, loc math.Point2LL, rightTurns bool, efc, simTime time.Time) PilotResponse {
+	h := &FlyHold{
+		Fix:         fix,
+		FixLocation: loc,
+		InboundCourse: math.Heading2LL(nav.FlightState.Position, loc, nav.FlightState.NmPerLongitude,
+			nav.FlightState.MagneticVariation),
+		RightTurns: rightTurns,
+		EFC:        efc,
+	}
+	if cur := nav.Heading.Hold; cur != nil && nav.DeferredHeading == nil && cur.Fix == fix &&
+		cur.RightTurns == rightTurns {
+		// Just a new EFC; keep flying the pattern as is.
+		cur.EFC = efc
+		return PilotResponse{Message: holdEFCReadback(efc)}
+	}
+
+	nav.Approach.Cleared = false
+	nav.Approach.InterceptState = NotIntercepting
+	nav.EnqueueHeading(NavHeading{Hold: h}, simTime)
+
+	msg := h.Readback()
+	if !efc.IsZero() {
+		msg += ", " + holdEFCReadback(efc)
+	}
+	return PilotResponse{Message: msg}
+}
+
+func holdEFCReadback(efc time.Time) string {
+	if efc.IsZero() {
+		return "no delay expected"
+	}
+	return "expect further clearance " + efc.UTC().Format("1504")
+}
+
+// Holding returns the holding pattern the aircraft is flying or has been
+// told to fly, if any.
+func (nav *Nav) Holding() *FlyHold {
+	if dh := nav.DeferredHeading; dh != nil {
+		return dh.Heading.Hold
+	}
+	return nav.Heading.Hold
+}
+
 ///////////////////////////////////////////////////////////////////////////
 // Procedure turns
 
@@ -0,0 +1,195 @@
+// pkg/aviation/procedures.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package aviation
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Most of the time spent parsing the CIFP goes to airports' STARs and
+// approaches, and most users only ever fly scenarios at a handful of
+// airports. Therefore, when the database is loaded, those records are
+// set aside, grouped by the ARTCC that the airport is in (as given by
+// the airport_artccs.json index), and compressed. An ARTCC's procedures
+// are parsed the first time that any of its airports' STARs or
+// approaches are needed, or ahead of time via LoadProcedures.
+
+// procedureGroup holds the unparsed STAR and approach records for the
+// airports in an ARTCC.
+type procedureGroup struct {
+	once     sync.Once
+	records  []byte // zstd-compressed; nil once parsed
+	airports map[string]*airportProcedures
+}
+
+type airportProcedures struct {
+	group      *procedureGroup
+	approaches map[string]Approach
+	stars      map[string]STAR
+}
+
+// Approaches returns the airport's approaches, parsing them if they
+// haven't been already.
+func (ap FAAAirport) Approaches() map[string]Approach {
+	if ap.procedures == nil {
+		return ap.approaches
+	}
+	ap.procedures.group.load()
+	return ap.procedures.approaches
+}
+
+// STARs returns the airport's STARs, parsing them if they haven't been
+// already.
+func (ap FAAAirport) STARs() map[string]STAR {
+	if ap.procedures == nil {
+		return ap.stars
+	}
+	ap.procedures.group.load()
+	return ap.procedures.stars
+}
+
+func (g *procedureGroup) load() {
+	g.once.Do(func() {
+		zr, err := zstd.NewReader(bytes.NewReader(g.records))
+		if err != nil {
+			panic(err)
+		}
+		defer zr.Close()
+
+		airports, _, _, _ := parseARINC424(zr, nil)
+		for icao, procs := range g.airports {
+			procs.approaches, procs.stars = airports[icao].approaches, airports[icao].stars
+		}
+		g.records = nil
+	})
+}
+
+// procedureGrouper accumulates the STAR and approach records from the
+// CIFP for each ARTCC.
+type procedureGrouper struct {
+	artccs  map[string]string // airport -> ARTCC
+	records map[string]*bytes.Buffer
+	groups  map[string]*procedureGroup
+}
+
+func makeProcedureGrouper() *procedureGrouper {
+	return &procedureGrouper{
+		artccs:  loadAirportARTCCs(),
+		records: make(map[string]*bytes.Buffer),
+		groups:  make(map[string]*procedureGroup),
+	}
+}
+
+// add is passed to parseARINC424 to defer parsing all of the STAR and
+// approach records.
+func (pg *procedureGrouper) add(icao string, line []byte) bool {
+	artcc := pg.artccs[icao] // airports that aren't in the index all go in the "" group
+	g, ok := pg.groups[artcc]
+	if !ok {
+		g = &procedureGroup{airports: make(map[string]*airportProcedures)}
+		pg.groups[artcc] = g
+		pg.records[artcc] = &bytes.Buffer{}
+	}
+	if _, ok := g.airports[icao]; !ok {
+		g.airports[icao] = &airportProcedures{group: g}
+	}
+	pg.records[artcc].Write(line)
+	return true
+}
+
+// finish compresses each ARTCC's records and records the procedure groups
+// in the airports.
+func (pg *procedureGrouper) finish(airports map[string]FAAAirport) map[string]*procedureGroup {
+	zw, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	if err != nil {
+		panic(err)
+	}
+	defer zw.Close()
+
+	for artcc, g := range pg.groups {
+		g.records = zw.EncodeAll(pg.records[artcc].Bytes(), nil)
+		for icao, procs := range g.airports {
+			ap := airports[icao]
+			ap.procedures = procs
+			airports[icao] = ap
+		}
+	}
+	return pg.groups
+}
+
+func loadAirportARTCCs() map[string]string {
+	ar := util.LoadResource("airport_artccs.json")
+	defer ar.Close()
+	artccs := make(map[string]string) // Airport -> ARTCC
+	if err := util.UnmarshalJSON(ar, &artccs); err != nil {
+		fmt.Fprintf(os.Stderr, "airport_artccs.json: %v\n", err)
+		os.Exit(1)
+	}
+	return artccs
+}
+
+// LoadProcedures parses the STARs and approaches for the airports in the
+// given ARTCCs, if they haven't been parsed already. The ARTCCs are
+// loaded in parallel.
+func (db *StaticDatabase) LoadProcedures(artccs ...string) {
+	db.loadNavigation()
+
+	var wg sync.WaitGroup
+	for _, artcc := range artccs {
+		if g, ok := db.procedureGroups[artcc]; ok {
+			wg.Add(1)
+			go func() { g.load(); wg.Done() }()
+		}
+	}
+	wg.Wait()
+}
+
+// AdjacentARTCCs returns the ARTCCs that have an airport with
+// procedures within 100nm of one of the given ARTCC's airports with
+// procedures; flights in scenarios there may well use them.
+func (db *StaticDatabase) AdjacentARTCCs(artcc string) []string {
+	const dist = 100
+
+	db.loadNavigation()
+
+	locations := func(g *procedureGroup) []math.Point2LL {
+		var p []math.Point2LL
+		for icao := range g.airports {
+			if ap, ok := db.Airports()[icao]; ok {
+				p = append(p, ap.Location)
+			}
+		}
+		return p
+	}
+
+	g, ok := db.procedureGroups[artcc]
+	if !ok || artcc == "" {
+		return nil
+	}
+	ours := locations(g)
+
+	var adjacent []string
+	for other, og := range db.procedureGroups {
+		if other == "" || other == artcc {
+			continue
+		}
+		if slices.ContainsFunc(locations(og), func(p math.Point2LL) bool {
+			return slices.ContainsFunc(ours, func(q math.Point2LL) bool { return math.NMDistance2LL(p, q) < dist })
+		}) {
+			adjacent = append(adjacent, other)
+		}
+	}
+	slices.Sort(adjacent)
+	return adjacent
+}
@@ -0,0 +1,138 @@
+// pkg/aviation/profiles.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package aviation
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Traffic profiles generate traffic other than airline flights: military
+// flights with tactical callsigns, IFR general aviation, and lifeguard
+// (medevac) flights. Scenarios use them in place of an airline by giving
+// a "profile" for an airline entry; its types and callsigns then come
+// from the profile, though "types" may still be given.
+//
+// Some flights from a profile are given a special handling indicator
+// (STS/ in item 18 of the flight plan) that controllers are expected to
+// honor: lifeguard flights are MEDEVAC and shouldn't be delayed, and
+// military flights operating under an altitude reservation are ALTRV and
+// should be left at their reserved altitude.
+
+// TrafficProfile describes a kind of non-airline traffic.
+type TrafficProfile struct {
+	// Callsign prefixes for tactical callsigns, followed by a number
+	// given by CallsignFormat. If there are none, the callsigns are
+	// generated for the airline ICAO.
+	Callsigns      []string
+	CallsignFormat string
+	ICAO           string
+	Fleet          []FleetAircraft
+	FlightType     string // ICAO item 8
+	// The STS/ indicator given to SpecialHandlingRate of the flights.
+	SpecialHandling     string
+	SpecialHandlingRate float32
+}
+
+var TrafficProfiles = map[string]TrafficProfile{
+	"military": {
+		Callsigns:      []string{"BOLT", "COBRA", "HAWK", "RAIDR", "SLAM", "TITAN", "VADER", "VIPER"},
+		CallsignFormat: "##",
+		Fleet: []FleetAircraft{{"F16", 6}, {"F15", 4}, {"F18S", 4}, {"A10", 2}, {"T38", 3},
+			{"C130", 3}, {"C30J", 2}, {"C17", 2}, {"R135", 1}, {"C5", 1}},
+		FlightType:          "M",
+		SpecialHandling:     "ALTRV",
+		SpecialHandlingRate: 0.25,
+	},
+	"ga_ifr": {
+		ICAO: "N",
+		Fleet: []FleetAircraft{{"C172", 3}, {"P28A", 3}, {"SR22", 5}, {"BE36", 2}, {"PA46", 2},
+			{"C208", 2}, {"PC12", 3}, {"TBM9", 2}, {"BE20", 2}, {"B350", 1}, {"C25B", 2},
+			{"C56X", 2}, {"E55P", 2}, {"LJ45", 1}, {"CL30", 1}},
+		FlightType: "G",
+	},
+	"lifeguard": {
+		ICAO:                "N",
+		Fleet:               []FleetAircraft{{"PC12", 4}, {"BE20", 3}, {"B350", 2}, {"C56X", 1}, {"LJ45", 2}},
+		FlightType:          "N",
+		SpecialHandling:     "MEDEVAC",
+		SpecialHandlingRate: 1,
+	},
+}
+
+// SampleCallsign returns a tactical callsign from the profile.
+func (p TrafficProfile) SampleCallsign(r *rand.Rand) (prefix, format string) {
+	return rand.SampleSliceWith(r, p.Callsigns), p.CallsignFormat
+}
+
+// ApplyProfile sets the parts of the flight plan that come from the
+// airline's traffic profile, if it has one.
+func (a AirlineSpecifier) ApplyProfile(fp *FlightPlan, r *rand.Rand) {
+	p, ok := TrafficProfiles[a.Profile]
+	if !ok {
+		return
+	}
+	fp.FlightType = p.FlightType
+	if p.SpecialHandling != "" && r.Float32() < p.SpecialHandlingRate {
+		fp.OtherInfo = strings.TrimSpace(fp.OtherInfo + " STS/" + p.SpecialHandling)
+		fp.ParseRemarks()
+	}
+}
+
+// SpecialHandling returns the flight's special handling indicators from
+// STS/ in item 18 or the remarks, e.g., "MEDEVAC".
+func (fp FlightPlan) SpecialHandling() []string {
+	return strings.Fields(fp.STS)
+}
+
+func (fp FlightPlan) HasSpecialHandling(sts string) bool {
+	return slices.Contains(fp.SpecialHandling(), sts)
+}
+
+// FiledPriority returns the priority flags given by the flight plan:
+// STS/MEDEVAC or LIFEGUARD in the remarks.
+func (fp FlightPlan) FiledPriority() PriorityFlags {
+	var p PriorityFlags
+	if fp.HasSpecialHandling("MEDEVAC") {
+		p |= PriorityMEDEVAC
+	}
+	if strings.Contains(strings.ToUpper(fp.Remarks), "LIFEGUARD") {
+		p |= PriorityLifeguard
+	}
+	return p
+}
+
+// checkProfile validates an airline given by a traffic profile, returning
+// false if its aircraft can't be checked.
+func (a *AirlineSpecifier) checkProfile(e *util.ErrorLogger) bool {
+	p, ok := TrafficProfiles[a.Profile]
+	if !ok {
+		e.ErrorString("traffic profile not known")
+		return false
+	}
+	if a.Fleet != "" {
+		e.ErrorString("cannot specify both \"profile\" and \"fleet\"")
+		return false
+	}
+
+	if len(p.Callsigns) > 0 {
+		if a.ICAO != "" {
+			e.ErrorString("\"icao\" cannot be given for a profile with tactical callsigns")
+			return false
+		}
+	} else {
+		if a.ICAO == "" {
+			a.ICAO = p.ICAO
+		}
+		if _, ok := DB.Airlines[strings.ToUpper(a.ICAO)]; !ok {
+			e.ErrorString("%s: airline not known", a.ICAO)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+// pkg/aviation/registry.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package aviation
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Aircraft types are sampled from airline fleets, so a generated GA
+// callsign or airline flight number otherwise has no relation to the
+// aircraft flying it. If the resources include a registration database,
+// it's used to make traffic more plausible: GA aircraft are given the
+// registration and equipment of an actual aircraft of the sampled type,
+// and airline flights that it lists are flown by the type that usually
+// operates them. Its format is:
+//
+//	{
+//	  "aircraft": { "N172SP": { "type": "C172", "equipment": "G" }, ... },
+//	  "flights": { "AAL1": "A321", ... }
+//	}
+//
+// Types that aren't in the performance database are substituted as they
+// are for fleets (see fleet.go); entries with types that can't be are
+// ignored.
+
+const registrationsResource = "registrations.json.zst"
+
+// RegistrationDatabase maps registrations and airline flights to aircraft.
+type RegistrationDatabase struct {
+	Aircraft map[string]RegisteredAircraft `json:"aircraft"` // registration ->
+	Flights  map[string]string             `json:"flights"`  // callsign -> ICAO type
+
+	byType map[string][]string // ICAO type -> sorted registrations
+}
+
+// RegisteredAircraft is an aircraft in the registration database.
+type RegisteredAircraft struct {
+	Type      string `json:"type"`                // ICAO type
+	Equipment string `json:"equipment,omitempty"` // FAA equipment suffix
+}
+
+func parseRegistrations(db *StaticDatabase) RegistrationDatabase {
+	var rdb RegistrationDatabase
+	if _, err := fs.Stat(util.GetResourcesFS(), registrationsResource); err != nil {
+		// It's optional.
+		return rdb
+	}
+
+	r := util.LoadResource(registrationsResource)
+	defer r.Close()
+	if err := util.UnmarshalJSON(r, &rdb); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", registrationsResource, err)
+		return RegistrationDatabase{}
+	}
+	rdb.initialize(db.substituteAircraftType)
+	return rdb
+}
+
+// initialize normalizes the database's entries, using substitute to map
+// their types to ones in the performance database, and indexes them.
+func (rdb *RegistrationDatabase) initialize(substitute func(string) (string, bool)) {
+	aircraft, flights := rdb.Aircraft, rdb.Flights
+	rdb.Aircraft = make(map[string]RegisteredAircraft)
+	rdb.Flights = make(map[string]string)
+	rdb.byType = make(map[string][]string)
+
+	for reg, ra := range aircraft {
+		reg = strings.ToUpper(strings.ReplaceAll(reg, "-", ""))
+		var ok bool
+		if ra.Type, ok = substitute(strings.ToUpper(ra.Type)); ok {
+			ra.Equipment = strings.ToUpper(ra.Equipment)
+			rdb.Aircraft[reg] = ra
+			rdb.byType[ra.Type] = append(rdb.byType[ra.Type], reg)
+		}
+	}
+	for _, regs := range rdb.byType {
+		slices.Sort(regs)
+	}
+
+	for callsign, t := range flights {
+		if t, ok := substitute(strings.ToUpper(t)); ok {
+			rdb.Flights[strings.ToUpper(callsign)] = t
+		}
+	}
+}
+
+// SampleRegistration returns the registration of a randomly chosen
+// aircraft of the given type whose registration starts with prefix and
+// isn't in use.
+func (rdb RegistrationDatabase) SampleRegistration(prefix, acType string, r *rand.Rand,
+	inUse func(string) bool) (string, RegisteredAircraft, bool) {
+	regs := rdb.byType[acType]
+	if len(regs) == 0 {
+		return "", RegisteredAircraft{}, false
+	}
+
+	// Take the first available one starting from a random one.
+	start := r.Intn(len(regs))
+	for i := range regs {
+		reg := regs[(start+i)%len(regs)]
+		if strings.HasPrefix(reg, prefix) && !inUse(reg) {
+			return reg, rdb.Aircraft[reg], true
+		}
+	}
+	return "", RegisteredAircraft{}, false
+}
+
+// FlightType returns the type of aircraft that usually flies the airline
+// flight with the given callsign.
+func (rdb RegistrationDatabase) FlightType(callsign string) (string, bool) {
+	t, ok := rdb.Flights[callsign]
+	return t, ok
+}
@@ -43,6 +43,7 @@ type Waypoint struct {
 	Airway                   string               // when parsing waypoints, this is set if we're on an airway after the fix
 	OnSID, OnSTAR            bool                 // set during deserialization
 	OnApproach               bool                 // set during deserialization
+	Landmark                 string               // charted visuals; set during deserialization
 	AirworkRadius            int                  // set during deserialization
 	AirworkMinutes           int                  // set during deserialization
 	Radius                   float32
@@ -449,11 +450,11 @@ func (w WaypointArray) checkDescending(e *util.ErrorLogger) {
 
 }
 
-func RandomizeRoute(w []Waypoint, randomizeAltitudeRange bool, perf AircraftPerformance, nmPerLongitude float32,
-	magneticVariation float32, airport string, wind WindModel, lg *log.Logger) WaypointArray {
+func RandomizeRoute(w []Waypoint, r *rand.Rand, randomizeAltitudeRange bool, perf AircraftPerformance,
+	nmPerLongitude float32, magneticVariation float32, airport string, wind WindModel, lg *log.Logger) WaypointArray {
 	// Random values used for altitude and position randomization
-	rtheta, rrad := rand.Float32(), rand.Float32()
-	ralt := rand.Float32()
+	rtheta, rrad := r.Float32(), r.Float32()
+	ralt := r.Float32()
 
 	// We use this to some random variation to the random sample after each
 	// use. In this way, there's some correlation between adjacent
@@ -461,7 +462,7 @@ func RandomizeRoute(w []Waypoint, randomizeAltitudeRange bool, perf AircraftPerf
 	// relatively high at the next one, though the random choices still
 	// vary a bit.
 	jitter := func(v float32) float32 {
-		v += -0.1 + 0.2*rand.Float32()
+		v += -0.1 + 0.2*r.Float32()
 		if v < 0 {
 			v = -v
 		} else if v > 1 {
@@ -521,7 +522,7 @@ func RandomizeRoute(w []Waypoint, randomizeAltitudeRange bool, perf AircraftPerf
 
 func constructVFRLanding(wp Waypoint, perf AircraftPerformance, airport string, wind WindModel, nmPerLongitude float32,
 	magneticVariation float32, lg *log.Logger) []Waypoint {
-	ap, ok := DB.Airports[airport]
+	ap, ok := DB.Airports()[airport]
 	if !ok {
 		lg.Errorf("%s: couldn't find arrival airport", airport)
 		wp.Delete = true
@@ -624,7 +625,7 @@ func parseWaypoints(str string) (WaypointArray, error) {
 		components := strings.Split(field, "/")
 
 		// Is it an airway?
-		if _, ok := DB.Airways[components[0]]; ok {
+		if _, ok := DB.Airways()[components[0]]; ok {
 			if ei == 0 {
 				return nil, fmt.Errorf("%s: can't begin a route with an airway", components[0])
 			} else if ei == len(entries)-1 {
@@ -831,7 +832,7 @@ func parseWaypoints(str string) (WaypointArray, error) {
 		if wp.Airway != "" {
 			found := false
 			wp0, wp1 := wp.Fix, waypoints[i+1].Fix
-			for _, airway := range DB.Airways[wp.Airway] {
+			for _, airway := range DB.Airways()[wp.Airway] {
 				if awp, ok := airway.WaypointsBetween(wp0, wp1); ok {
 					wpExpanded = append(wpExpanded, awp...)
 					found = true
@@ -1071,8 +1072,8 @@ func (s STAR) Check(e *util.ErrorLogger) {
 
 	check := func(wps WaypointArray) {
 		for _, wp := range wps {
-			_, okn := DB.Navaids[wp.Fix]
-			_, okf := DB.Fixes[wp.Fix]
+			_, okn := DB.Navaids()[wp.Fix]
+			_, okf := DB.Fixes()[wp.Fix]
 			if !okn && !okf {
 				e.ErrorString("fix %s not found in navaid database", wp.Fix)
 			}
@@ -1336,6 +1337,10 @@ type AirwayFix struct {
 	Fix       string
 	Level     AirwayLevel
 	Direction AirwayDirection
+	// Minimum enroute and maximum authorized altitudes for the segment
+	// from this fix to the next one; zero if unknown.
+	MinimumAltitude int
+	MaximumAltitude int
 }
 
 type Airway struct {
@@ -1362,6 +1367,25 @@ func (a Airway) WaypointsBetween(wp0, wp1 string) ([]Waypoint, bool) {
 	return wps, true
 }
 
+// MinimumAltitude returns the highest MEA of the airway's segments between
+// the two fixes.
+func (a Airway) MinimumAltitude(wp0, wp1 string) (int, bool) {
+	start := slices.IndexFunc(a.Fixes, func(f AirwayFix) bool { return f.Fix == wp0 })
+	end := slices.IndexFunc(a.Fixes, func(f AirwayFix) bool { return f.Fix == wp1 })
+	if start == -1 || end == -1 {
+		return 0, false
+	}
+	if start > end {
+		start, end = end, start
+	}
+
+	alt := 0
+	for _, f := range a.Fixes[start:end] {
+		alt = max(alt, f.MinimumAltitude)
+	}
+	return alt, true
+}
+
 ///////////////////////////////////////////////////////////////////////////
 // Overflight
 
@@ -1422,6 +1446,130 @@ func (of *Overflight) PostDeserialize(loc Locator, nmPerLongitude float32, magne
 	}
 }
 
+///////////////////////////////////////////////////////////////////////////
+// BoundaryFixFlow
+
+// BoundaryFixFlow describes enroute traffic that crosses the facility's
+// airspace, entering at one boundary fix and leaving at another. Rather
+// than each overflight being written out, overflights along the flow are
+// generated at all of the altitudes in its range that are appropriate
+// for the direction of flight.
+type BoundaryFixFlow struct {
+	Entry string `json:"entry"`
+	Exit  string `json:"exit"`
+	// Optional fixes between the entry and exit fixes.
+	Route string `json:"route"`
+	// Range of altitudes the traffic crosses at; if it isn't given, the
+	// adapted altitudes for the entry coordination fix are used.
+	Altitudes         [2]int              `json:"altitudes"`
+	InitialSpeed      float32             `json:"initial_speed"`
+	InitialController string              `json:"initial_controller"`
+	Airlines          []OverflightAirline `json:"airlines"`
+}
+
+// Aircraft are spawned this far before the entry fix so that the
+// handoff has been offered by the time they reach the boundary.
+const boundaryFixSpawnDistance = 15 // nm
+
+// DirectionOfFlightAltitudes returns the IFR altitudes between lo and hi
+// (inclusive) for the given magnetic course: odd thousands eastbound and
+// even thousands westbound through FL410 and every 4,000' above that.
+func DirectionOfFlightAltitudes(course float32, lo, hi int) []int {
+	east := math.NormalizeHeading(course) < 180
+	var alts []int
+	for alt := util.Select(east, 1000, 2000); alt <= hi; alt += 2000 {
+		if alt > 41000 {
+			break
+		}
+		if alt >= lo {
+			alts = append(alts, alt)
+		}
+	}
+	for alt := util.Select(east, 45000, 43000); alt <= hi; alt += 4000 {
+		if alt >= lo {
+			alts = append(alts, alt)
+		}
+	}
+	return alts
+}
+
+// Overflights returns the overflights along the flow. adapted gives the
+// coordination fixes, which supply the altitudes if the flow doesn't.
+func (bf BoundaryFixFlow) Overflights(loc Locator, nmPerLongitude float32, magneticVariation float32,
+	adapted map[string]AdaptationFixes, airports map[string]*Airport, controlPositions map[string]*Controller,
+	e *util.ErrorLogger) []Overflight {
+	defer e.CheckDepth(e.CurrentDepth())
+
+	if bf.Entry == "" || bf.Exit == "" {
+		e.ErrorString("must specify both \"entry\" and \"exit\"")
+		return nil
+	}
+
+	lo, hi := bf.Altitudes[0], bf.Altitudes[1]
+	if lo == 0 && hi == 0 {
+		fixes, ok := adapted[bf.Entry]
+		if !ok || len(fixes) == 0 {
+			e.ErrorString("no \"altitudes\" given and %q isn't an adapted coordination fix", bf.Entry)
+			return nil
+		}
+		lo, hi = fixes[0].Altitude[0], fixes[0].Altitude[1]
+		for _, f := range fixes[1:] {
+			lo, hi = min(lo, f.Altitude[0]), max(hi, f.Altitude[1])
+		}
+	}
+	if lo > hi {
+		e.ErrorString("\"altitudes\" %d-%d: the lower altitude is above the upper one", lo, hi)
+		return nil
+	}
+
+	wps, err := parseWaypoints(strings.Join([]string{bf.Entry + "/ho", bf.Route, bf.Exit}, " "))
+	if err != nil {
+		e.Error(err)
+		return nil
+	}
+	of := Overflight{
+		Waypoints:         wps,
+		InitialAltitudes:  util.SingleOrArray[int]{lo},
+		InitialSpeed:      util.Select(bf.InitialSpeed != 0, bf.InitialSpeed, 250),
+		InitialController: bf.InitialController,
+		Description:       bf.Entry + " to " + bf.Exit,
+		Airlines:          bf.Airlines,
+	}
+	nerr := len(e.Errors())
+	of.PostDeserialize(loc, nmPerLongitude, magneticVariation, airports, controlPositions, e)
+	if len(e.Errors()) > nerr {
+		return nil
+	}
+
+	entry, exit := of.Waypoints[0].Location, of.Waypoints[len(of.Waypoints)-1].Location
+	course := math.Heading2LL(entry, exit, nmPerLongitude, magneticVariation)
+	alts := DirectionOfFlightAltitudes(course, lo, hi)
+	if len(alts) == 0 {
+		e.ErrorString("no altitudes between %d and %d for a course of %03d", lo, hi, int(course+0.5))
+		return nil
+	}
+
+	// Start outside of the airspace, inbound to the entry fix.
+	inbound := math.Heading2LL(entry, of.Waypoints[1].Location, nmPerLongitude, magneticVariation)
+	spawn := Waypoint{
+		Fix:      "_" + bf.Entry + "_spawn",
+		Location: math.Offset2LL(entry, inbound+180, boundaryFixSpawnDistance, nmPerLongitude, magneticVariation),
+	}
+	of.Waypoints = append(WaypointArray{spawn}, of.Waypoints...)
+
+	var ofs []Overflight
+	for _, alt := range alts {
+		o := of
+		o.InitialAltitudes = util.SingleOrArray[int]{alt}
+		o.CruiseAltitude = float32(alt)
+		if bf.InitialSpeed == 0 {
+			o.InitialSpeed = util.Select(alt < 10000, float32(250), 280)
+		}
+		ofs = append(ofs, o)
+	}
+	return ofs
+}
+
 ///////////////////////////////////////////////////////////////////////////
 // RouteGenerator
 
@@ -0,0 +1,516 @@
+// pkg/aviation/scenarioimport.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package aviation
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Traffic can be imported from other sims' scenarios: openScope airport
+// JSON files and Euroscope scenario (.txt) files. Their traffic is mapped
+// onto vice's departures, arrivals, and VFR routes, which are then
+// written out as the start of a scenario group (see
+// server/scenarioimport.go). They will usually need some editing--adding
+// exit routes for the departure runways, for example--before they can be
+// used.
+//
+// openScope spawn patterns give routes like "KJFK04L.DEEZZ5.CANDR" for
+// departures (airport and runway, SID, exit) and "CAMRN.CAMRN4.KJFK" or
+// "ENTRY..FIX..KJFK" for arrivals; airlines are given as "aal" or
+// "aal/long", with the latter giving a fleet. Euroscope scenarios instead
+// list individual aircraft: a position line starting with '@', followed
+// by its flight plan ($FP) and route ($ROUTE). Aircraft on the ground
+// become departures, VFR aircraft become VFR routes, and the rest become
+// arrivals to their destination.
+
+// ImportedTraffic is the traffic read from another sim's file.
+type ImportedTraffic struct {
+	Name     string
+	Fixes    map[string]math.Point2LL
+	Airports []string
+
+	Departures map[string][]ImportedDeparture // airport ->
+	Arrivals   []ImportedArrival
+	VFRRoutes  map[string][]ImportedVFRRoute // departure airport ->
+}
+
+type ImportedDeparture struct {
+	Runway      string
+	SID         string
+	Exit        string
+	Destination string
+	Altitude    int
+	Route       string
+	Rate        int // per hour; zero if not given
+	Airlines    []AirlineSpecifier
+}
+
+// ImportedArrival may also be an overflight, in which case Airport is
+// empty.
+type ImportedArrival struct {
+	Airport         string
+	Origin          string
+	Waypoints       string // in vice's route syntax
+	STAR            string
+	Route           string
+	InitialAltitude int
+	InitialSpeed    int
+	Rate            int // per hour; zero if not given
+	Airlines        []AirlineSpecifier
+}
+
+type ImportedVFRRoute struct {
+	Name        string
+	Destination string
+	Waypoints   string // in vice's route syntax
+}
+
+func makeImportedTraffic() *ImportedTraffic {
+	return &ImportedTraffic{
+		Fixes:      make(map[string]math.Point2LL),
+		Departures: make(map[string][]ImportedDeparture),
+		VFRRoutes:  make(map[string][]ImportedVFRRoute),
+	}
+}
+
+func (it *ImportedTraffic) addAirport(ap string) {
+	if ap != "" && !slices.Contains(it.Airports, ap) {
+		it.Airports = append(it.Airports, ap)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// openScope
+
+type openScopeAirport struct {
+	ICAO          string                  `json:"icao"`
+	Name          string                  `json:"name"`
+	Fixes         map[string][]string     `json:"fixes"`
+	SpawnPatterns []openScopeSpawnPattern `json:"spawnPatterns"`
+}
+
+type openScopeSpawnPattern struct {
+	Origin      string          `json:"origin"`
+	Destination string          `json:"destination"`
+	Category    string          `json:"category"`
+	Route       string          `json:"route"`
+	Altitude    json.RawMessage `json:"altitude"` // number or [min, max]
+	Speed       float32         `json:"speed"`
+	Rate        float32         `json:"rate"`
+	Airlines    [][]any         `json:"airlines"`
+}
+
+// ParseOpenScopeAirport parses an openScope airport JSON file. Spawn
+// patterns that can't be converted are reported via e and skipped.
+func ParseOpenScopeAirport(r io.Reader, e *util.ErrorLogger) (*ImportedTraffic, error) {
+	var osa openScopeAirport
+	if err := json.NewDecoder(r).Decode(&osa); err != nil {
+		return nil, err
+	}
+
+	it := makeImportedTraffic()
+	it.Name = osa.Name
+	icao := strings.ToUpper(osa.ICAO)
+	it.addAirport(icao)
+
+	e.Push("fixes")
+	for name, ll := range osa.Fixes {
+		if p, ok := parseOpenScopePosition(ll); ok {
+			it.Fixes[strings.ToUpper(name)] = p
+		} else if !strings.HasPrefix(name, "_") { // openScope's own helper points
+			e.ErrorString("%s: invalid position %q", name, ll)
+		}
+	}
+	e.Pop()
+
+	for i, sp := range osa.SpawnPatterns {
+		e.Push(fmt.Sprintf("spawnPatterns[%d]", i))
+		airlines := openScopeAirlines(sp.Airlines)
+		alt := openScopeAltitude(sp.Altitude)
+		rate := int(sp.Rate + 0.5)
+
+		switch sp.Category {
+		case "departure":
+			// e.g. KJFK04L.DEEZZ5.CANDR
+			f := strings.Split(sp.Route, ".")
+			if len(f) != 3 || len(f[0]) <= 4 {
+				e.ErrorString("%q: unexpected departure route", sp.Route)
+				break
+			}
+			ap, rwy := strings.ToUpper(f[0][:4]), strings.ToUpper(f[0][4:])
+			it.addAirport(ap)
+			exit := strings.ToUpper(f[2])
+			it.Departures[ap] = append(it.Departures[ap], ImportedDeparture{
+				Runway:      rwy,
+				SID:         strings.ToUpper(f[1]),
+				Exit:        exit,
+				Destination: strings.ToUpper(sp.Destination),
+				Altitude:    alt,
+				Route:       strings.ToUpper(f[1]) + " " + exit,
+				Rate:        rate,
+				Airlines:    airlines,
+			})
+
+		case "arrival", "overflight":
+			// e.g., CAMRN.CAMRN4.KJFK or ENTRY..FIX..KJFK
+			arr := ImportedArrival{
+				Airport:         strings.ToUpper(util.Select(sp.Destination != "", sp.Destination, icao)),
+				Origin:          strings.ToUpper(sp.Origin),
+				InitialAltitude: alt,
+				InitialSpeed:    int(sp.Speed),
+				Rate:            rate,
+				Airlines:        airlines,
+			}
+			var fixes, route []string
+			for _, seg := range strings.Split(strings.ToUpper(sp.Route), "..") {
+				if f := strings.Split(seg, "."); len(f) == 3 {
+					// entry.STAR.airport
+					fixes = append(fixes, f[0])
+					route = append(route, f[0], f[1])
+					arr.STAR = f[1]
+				} else if len(seg) > 0 && seg != arr.Airport {
+					fixes = append(fixes, seg)
+					route = append(route, seg)
+				}
+			}
+			if len(fixes) == 0 {
+				e.ErrorString("%q: no fixes in arrival route", sp.Route)
+				break
+			}
+			if sp.Category == "overflight" {
+				arr.Airport = ""
+			}
+			arr.Waypoints = strings.Join(fixes, " ")
+			arr.Route = strings.Join(route, " ")
+			it.addAirport(arr.Airport)
+			it.Arrivals = append(it.Arrivals, arr)
+
+		default:
+			e.ErrorString("%q: unknown spawn pattern category", sp.Category)
+		}
+		e.Pop()
+	}
+
+	return it, nil
+}
+
+// parseOpenScopePosition parses positions given as, e.g., ["N40.6398",
+// "W073.7789"] or ["N40d38m23.28", "W073d46m44.04"].
+func parseOpenScopePosition(ll []string) (math.Point2LL, bool) {
+	if len(ll) < 2 {
+		return math.Point2LL{}, false
+	}
+	lat, ok0 := parseOpenScopeCoordinate(ll[0])
+	lon, ok1 := parseOpenScopeCoordinate(ll[1])
+	return math.Point2LL{lon, lat}, ok0 && ok1
+}
+
+func parseOpenScopeCoordinate(s string) (float32, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	sign := float32(1)
+	switch s[0] {
+	case 'S', 's', 'W', 'w':
+		sign = -1
+	case 'N', 'n', 'E', 'e':
+	default:
+		return 0, false
+	}
+	s = s[1:]
+
+	var v float32
+	scale := float32(1)
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == 'd' || r == 'm' || r == 's' }) {
+		f, err := strconv.ParseFloat(part, 32)
+		if err != nil {
+			return 0, false
+		}
+		v += float32(f) / scale
+		scale *= 60
+	}
+	return sign * v, true
+}
+
+func openScopeAltitude(raw json.RawMessage) int {
+	var alt float32
+	if json.Unmarshal(raw, &alt) == nil {
+		return int(alt)
+	}
+	var r []float32
+	if json.Unmarshal(raw, &r) == nil && len(r) > 0 {
+		return int(r[len(r)-1])
+	}
+	return 0
+}
+
+// openScopeAirlines converts openScope's [["aal/long", 10], ...] to
+// airline specifiers; the weights aren't used.
+func openScopeAirlines(airlines [][]any) []AirlineSpecifier {
+	var specs []AirlineSpecifier
+	for _, al := range airlines {
+		if len(al) == 0 {
+			continue
+		}
+		name, ok := al[0].(string)
+		if !ok {
+			continue
+		}
+		icao, fleet, _ := strings.Cut(name, "/")
+		icao = strings.ToUpper(icao)
+		if !slices.ContainsFunc(specs, func(s AirlineSpecifier) bool { return s.ICAO == icao && s.Fleet == fleet }) {
+			specs = append(specs, AirlineSpecifier{ICAO: icao, Fleet: fleet})
+		}
+	}
+	return specs
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Euroscope
+
+type euroscopeAircraft struct {
+	callsign    string
+	position    math.Point2LL
+	altitude    int
+	vfr         bool
+	acType      string
+	tas         int
+	departure   string
+	arrival     string
+	cruise      int
+	fplRoute    string
+	route       []string // from $ROUTE
+	initialized bool
+}
+
+// ParseEuroscopeScenario parses a Euroscope scenario file. Aircraft that
+// can't be converted are reported via e and skipped.
+func ParseEuroscopeScenario(r io.Reader, e *util.ErrorLogger) (*ImportedTraffic, error) {
+	var aircraft []*euroscopeAircraft
+	var cur *euroscopeAircraft
+	var airportAltitude int // of the scenario's primary airport
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == ';' {
+			continue
+		}
+		f := strings.Split(line, ":")
+
+		switch {
+		case line[0] == '@':
+			// @N:CALLSIGN:SQUAWK:1:LAT:LON:ALT:...
+			if len(f) < 7 {
+				e.ErrorString("%q: unexpected format", line)
+				cur = nil
+				continue
+			}
+			lat, err0 := strconv.ParseFloat(f[4], 32)
+			lon, err1 := strconv.ParseFloat(f[5], 32)
+			alt, err2 := strconv.Atoi(f[6])
+			if err0 != nil || err1 != nil || err2 != nil {
+				e.ErrorString("%q: invalid position or altitude", line)
+				cur = nil
+				continue
+			}
+			cur = &euroscopeAircraft{
+				callsign: strings.ToUpper(f[1]),
+				position: math.Point2LL{float32(lon), float32(lat)},
+				altitude: alt,
+			}
+			aircraft = append(aircraft, cur)
+
+		case strings.HasPrefix(line, "$FP"):
+			// $FPCALLSIGN:*A:I:TYPE:TAS:DEP:DEPTIME:ACTTIME:ALT:ARR:HRS:MIN:FHRS:FMIN:ALTN:RMK:ROUTE
+			if cur == nil || len(f) < 17 || strings.ToUpper(strings.TrimPrefix(f[0], "$FP")) != cur.callsign {
+				e.ErrorString("%q: flight plan without aircraft", line)
+				continue
+			}
+			cur.vfr = strings.EqualFold(f[2], "V")
+			cur.acType = aircraftTypeFromFlightPlan(f[3])
+			cur.tas, _ = strconv.Atoi(f[4])
+			cur.departure = strings.ToUpper(f[5])
+			cur.cruise = parseEuroscopeAltitude(f[8])
+			cur.arrival = strings.ToUpper(f[9])
+			cur.fplRoute = strings.ToUpper(strings.Join(f[16:], ":"))
+			cur.initialized = true
+
+		case strings.HasPrefix(line, "$ROUTE"):
+			if cur != nil && len(f) > 1 {
+				for _, fix := range strings.Fields(strings.ToUpper(f[1])) {
+					// Drop Euroscope's altitude annotations, e.g. FIX/5000.
+					fix, _, _ = strings.Cut(fix, "/")
+					cur.route = append(cur.route, fix)
+				}
+			}
+
+		case strings.HasPrefix(line, "AIRPORT_ALT"):
+			if len(f) > 1 {
+				airportAltitude, _ = strconv.Atoi(f[1])
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	it := makeImportedTraffic()
+	for _, ac := range aircraft {
+		e.Push(ac.callsign)
+		if !ac.initialized {
+			e.ErrorString("no flight plan")
+			e.Pop()
+			continue
+		}
+
+		elevation := airportAltitude
+		if ap, ok := DB.Airports()[ac.departure]; ok {
+			elevation = ap.Elevation
+		}
+		onGround := ac.altitude < elevation+200
+
+		airlines := []AirlineSpecifier{euroscopeAirline(ac.callsign, ac.acType)}
+		switch {
+		case ac.vfr:
+			route := util.Select(len(ac.route) > 0, strings.Join(ac.route, " "), ac.fplRoute)
+			if route == "" {
+				e.ErrorString("no route for VFR aircraft")
+				break
+			}
+			it.addAirport(ac.departure)
+			it.VFRRoutes[ac.departure] = append(it.VFRRoutes[ac.departure], ImportedVFRRoute{
+				Name:        ac.departure + "-" + ac.arrival + " (" + ac.callsign + ")",
+				Destination: ac.arrival,
+				Waypoints:   route,
+			})
+
+		case onGround:
+			route := strings.Fields(ac.fplRoute)
+			if len(route) == 0 {
+				e.ErrorString("no route")
+				break
+			}
+			dep := ImportedDeparture{
+				Exit:        route[0],
+				Destination: ac.arrival,
+				Altitude:    ac.cruise,
+				Route:       ac.fplRoute,
+				Airlines:    airlines,
+			}
+			if len(route) > 1 && strings.IndexFunc(route[0], unicode.IsDigit) != -1 {
+				// The route starts with a SID.
+				dep.SID, dep.Exit = route[0], route[1]
+			}
+			it.addAirport(ac.departure)
+			it.Departures[ac.departure] = appendImportedDeparture(it.Departures[ac.departure], dep)
+
+		default:
+			if len(ac.route) == 0 {
+				e.ErrorString("no $ROUTE for arrival")
+				break
+			}
+			speed := ac.tas
+			if ac.altitude < 10000 {
+				speed = min(speed, 250)
+			}
+			it.addAirport(ac.arrival)
+			it.Arrivals = append(it.Arrivals, ImportedArrival{
+				Airport:         ac.arrival,
+				Origin:          ac.departure,
+				Waypoints:       strings.Join(ac.route, " "),
+				Route:           ac.fplRoute,
+				InitialAltitude: ac.altitude,
+				InitialSpeed:    speed,
+				Airlines:        airlines,
+			})
+			// The first fix's location isn't given, but this is
+			// where the aircraft starts.
+			if _, ok := DB.LookupWaypoint(ac.route[0]); !ok {
+				if _, ok := it.Fixes[ac.route[0]]; !ok {
+					it.Fixes[ac.route[0]] = ac.position
+				}
+			}
+		}
+		e.Pop()
+	}
+
+	return it, nil
+}
+
+// parseEuroscopeAltitude parses flight plan altitudes like "35000",
+// "FL350", or "F350".
+func parseEuroscopeAltitude(s string) int {
+	s = strings.ToUpper(s)
+	if fl, ok := strings.CutPrefix(s, "FL"); ok {
+		v, _ := strconv.Atoi(fl)
+		return 100 * v
+	} else if fl, ok := strings.CutPrefix(s, "F"); ok {
+		v, _ := strconv.Atoi(fl)
+		return 100 * v
+	}
+	v, _ := strconv.Atoi(s)
+	return v
+}
+
+// aircraftTypeFromFlightPlan returns the ICAO type from flight plan
+// aircraft fields like "B738/L", "H/B744/L", or "B738/M-SDE2E3FGHIRWY/LB1".
+func aircraftTypeFromFlightPlan(s string) string {
+	f := strings.Split(strings.ToUpper(s), "/")
+	if len(f) > 1 && len(f[0]) == 1 {
+		// Weight class prefix
+		return f[1]
+	}
+	return f[0]
+}
+
+// euroscopeAirline returns an airline specifier for the aircraft: its
+// airline if the callsign starts with a known airline's ICAO code and
+// otherwise general aviation.
+func euroscopeAirline(callsign, acType string) AirlineSpecifier {
+	icao := "N"
+	if idx := strings.IndexFunc(callsign, unicode.IsDigit); idx == 3 {
+		if _, ok := DB.Airlines[callsign[:3]]; ok {
+			icao = callsign[:3]
+		}
+	}
+	spec := AirlineSpecifier{ICAO: icao}
+	if acType != "" {
+		spec.AircraftTypes = []string{acType}
+	}
+	return spec
+}
+
+// appendImportedDeparture adds the departure, merging it with an existing
+// one with the same route.
+func appendImportedDeparture(deps []ImportedDeparture, dep ImportedDeparture) []ImportedDeparture {
+	for i, d := range deps {
+		if d.Exit == dep.Exit && d.Destination == dep.Destination && d.Route == dep.Route {
+			for _, al := range dep.Airlines {
+				if idx := slices.IndexFunc(d.Airlines, func(a AirlineSpecifier) bool { return a.ICAO == al.ICAO }); idx == -1 {
+					deps[i].Airlines = append(deps[i].Airlines, al)
+				} else {
+					for _, t := range al.AircraftTypes {
+						if !slices.Contains(d.Airlines[idx].AircraftTypes, t) {
+							deps[i].Airlines[idx].AircraftTypes = append(deps[i].Airlines[idx].AircraftTypes, t)
+						}
+					}
+				}
+			}
+			return deps
+		}
+	}
+	return append(deps, dep)
+}
@@ -0,0 +1,299 @@
+// pkg/aviation/sectorfile.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package aviation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// SectorFile holds the contents of a VRC/Euroscope sector file (.sct or
+// .sct2) and, optionally, the controller positions from the accompanying
+// Euroscope .ese file.
+type SectorFile struct {
+	Name           string
+	DefaultAirport string
+	Center         math.Point2LL
+
+	// Fixes, VORs, NDBs, and airports, all together.
+	Fixes    map[string]math.Point2LL
+	Airports []string
+
+	// Map name -> line strips. Names are prefixed with the section they
+	// came from, e.g. "GEO KJFK Taxiways" or "STAR CAMRN4".
+	Lines map[string][][]math.Point2LL
+
+	// Controller positions from the .ese file, keyed by network callsign,
+	// which is how vice's scenarios key them as well.
+	Positions map[string]*Controller
+}
+
+// The sections with line segments; their names are used as prefixes for
+// the names of the maps made from them.
+var sectorFileLineSections = []string{"ARTCC", "ARTCC HIGH", "ARTCC LOW", "SID", "STAR",
+	"LOW AIRWAY", "HIGH AIRWAY", "GEO"}
+
+// ParseSectorFile parses a .sct/.sct2 file. Errors in individual lines are
+// reported via e and the lines are skipped.
+func ParseSectorFile(r io.Reader, e *util.ErrorLogger) (*SectorFile, error) {
+	sf := &SectorFile{
+		Fixes:     make(map[string]math.Point2LL),
+		Lines:     make(map[string][][]math.Point2LL),
+		Positions: make(map[string]*Controller),
+	}
+
+	// Gather the lines of each section first: line segments may refer to
+	// navaids by name and sections may come in any order.
+	sections := make(map[string][]string)
+	section := ""
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, ';'); i != -1 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			// Blank, or a #define of a color; we don't use the colors.
+			continue
+		}
+		if s, ok := strings.CutPrefix(strings.TrimSpace(line), "["); ok && strings.HasSuffix(s, "]") {
+			section = strings.ToUpper(strings.TrimSuffix(s, "]"))
+			continue
+		}
+		sections[section] = append(sections[section], line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if info := sections["INFO"]; len(info) >= 5 {
+		sf.Name = strings.TrimSpace(info[0])
+		sf.DefaultAirport = strings.TrimSpace(info[2])
+		if p, err := math.ParseLatLong([]byte(strings.TrimSpace(info[3]) + "," + strings.TrimSpace(info[4]))); err == nil {
+			sf.Center = p
+		}
+	}
+
+	// Navaids: "name [freq] lat lon [...]"
+	for _, s := range []string{"VOR", "NDB", "AIRPORT", "FIXES"} {
+		e.Push(s)
+		for _, line := range sections[s] {
+			f := strings.Fields(line)
+			idx := slices.IndexFunc(f, func(s string) bool { return len(s) > 0 && (s[0] == 'N' || s[0] == 'S') })
+			if len(f) < 3 || idx < 1 || idx+1 >= len(f) {
+				e.ErrorString("%q: unexpected format", line)
+				continue
+			}
+			p, err := math.ParseLatLong([]byte(f[idx] + "," + f[idx+1]))
+			if err != nil {
+				e.Error(err)
+				continue
+			}
+			name := strings.Join(f[:util.Select(s == "FIXES", idx, 1)], " ")
+			sf.Fixes[name] = p
+			if s == "AIRPORT" {
+				sf.Airports = append(sf.Airports, name)
+			}
+		}
+		e.Pop()
+	}
+
+	// Runways: "id id hdg hdg lat lon lat lon [airport ...]"
+	e.Push("RUNWAY")
+	for _, line := range sections["RUNWAY"] {
+		f := strings.Fields(line)
+		if len(f) < 8 {
+			e.ErrorString("%q: unexpected format", line)
+			continue
+		}
+		p0, ok0 := sf.point(f[4], f[5])
+		p1, ok1 := sf.point(f[6], f[7])
+		if !ok0 || !ok1 {
+			e.ErrorString("%q: invalid location", line)
+			continue
+		}
+		name := "RUNWAY"
+		if len(f) > 8 {
+			name += " " + f[8]
+		}
+		sf.addSegment(name, p0, p1)
+	}
+	e.Pop()
+
+	for _, s := range sectorFileLineSections {
+		e.Push(s)
+		name := ""
+		for _, line := range sections[s] {
+			n, p0, p1, ok := sf.parseSegment(line)
+			if !ok {
+				e.ErrorString("%q: unable to parse line segment", line)
+				continue
+			}
+			if n != "" {
+				name = n
+			}
+			sf.addSegment(strings.TrimSpace(s+" "+name), p0, p1)
+		}
+		e.Pop()
+	}
+
+	// Regions are filled polygons; we just draw their outlines.
+	e.Push("REGIONS")
+	var region []math.Point2LL
+	regionName := ""
+	flush := func() {
+		if len(region) > 2 {
+			region = append(region, region[0])
+			n := strings.TrimSpace("REGION " + regionName)
+			sf.Lines[n] = append(sf.Lines[n], region)
+		}
+		region = nil
+	}
+	for _, line := range sections["REGIONS"] {
+		f := strings.Fields(line)
+		if len(f) >= 2 && f[0] == "REGIONNAME" {
+			flush()
+			regionName = strings.Join(f[1:], " ")
+			continue
+		}
+		if len(f) == 3 {
+			// A color starts a new polygon.
+			flush()
+			f = f[1:]
+		}
+		if len(f) != 2 {
+			e.ErrorString("%q: unexpected format", line)
+			continue
+		}
+		if p, ok := sf.point(f[0], f[1]); ok {
+			region = append(region, p)
+		} else {
+			e.ErrorString("%q: invalid location", line)
+		}
+	}
+	flush()
+	e.Pop()
+
+	return sf, nil
+}
+
+// point returns the location given by a latitude and longitude pair or
+// by a navaid's name, which is then given for both.
+func (sf *SectorFile) point(lat, lon string) (math.Point2LL, bool) {
+	if p, err := math.ParseLatLong([]byte(lat + "," + lon)); err == nil {
+		return p, true
+	}
+	if lat == lon {
+		p, ok := sf.Fixes[lat]
+		return p, ok
+	}
+	return math.Point2LL{}, false
+}
+
+// parseSegment parses a line segment, "[name] lat lon lat lon [color]",
+// where the locations may also be given by navaid names.
+func (sf *SectorFile) parseSegment(line string) (string, math.Point2LL, math.Point2LL, bool) {
+	f := strings.Fields(line)
+	for _, n := range []int{len(f), len(f) - 1} {
+		// Either there's a color at the end or there isn't.
+		if n < 4 {
+			break
+		}
+		p0, ok0 := sf.point(f[n-4], f[n-3])
+		p1, ok1 := sf.point(f[n-2], f[n-1])
+		if ok0 && ok1 {
+			return strings.Join(f[:n-4], " "), p0, p1, true
+		}
+	}
+	return "", math.Point2LL{}, math.Point2LL{}, false
+}
+
+// addSegment adds a line segment to the named map, extending the last line
+// strip if it ends where the segment starts.
+func (sf *SectorFile) addSegment(name string, p0, p1 math.Point2LL) {
+	strips := sf.Lines[name]
+	if n := len(strips); n > 0 && strips[n-1][len(strips[n-1])-1] == p0 {
+		strips[n-1] = append(strips[n-1], p1)
+	} else {
+		strips = append(strips, []math.Point2LL{p0, p1})
+	}
+	sf.Lines[name] = strips
+}
+
+// ParseESE reads the controller positions from a Euroscope .ese file:
+// name:radio name:frequency:id:middle letter:prefix:suffix:...
+func (sf *SectorFile) ParseESE(r io.Reader, e *util.ErrorLogger) error {
+	e.Push("POSITIONS")
+	defer e.Pop()
+
+	section := ""
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == ';' {
+			continue
+		}
+		if s, ok := strings.CutPrefix(line, "["); ok && strings.HasSuffix(s, "]") {
+			section = strings.ToUpper(strings.TrimSuffix(s, "]"))
+			continue
+		}
+		if section != "POSITIONS" {
+			continue
+		}
+
+		f := strings.Split(line, ":")
+		if len(f) < 7 {
+			e.ErrorString("%q: unexpected format", line)
+			continue
+		}
+		var freq float32
+		if _, err := fmt.Sscanf(f[2], "%f", &freq); err != nil {
+			e.ErrorString("%q: invalid frequency", line)
+			continue
+		}
+		sf.Positions[f[0]] = &Controller{
+			Position:  f[0],
+			RadioName: f[1],
+			Frequency: NewFrequency(freq),
+			TCP:       f[3],
+			Facility:  f[5],
+		}
+	}
+	return sc.Err()
+}
+
+// VideoMaps returns the sector file's line segments as video maps, one
+// for each named group of lines, sorted by name.
+func (sf *SectorFile) VideoMaps() []VideoMap {
+	var maps []VideoMap
+	for i, name := range util.SortedMapKeys(sf.Lines) {
+		// Drop the section name from the label unless that's all there is.
+		label := strings.ToUpper(name)
+		prefix := ""
+		for _, s := range append(sectorFileLineSections, "REGION", "RUNWAY") {
+			if strings.HasPrefix(label, s+" ") && len(s) > len(prefix) {
+				prefix = s
+			}
+		}
+		label = strings.TrimPrefix(label, prefix+" ")
+		if len(label) > 7 {
+			label = label[:7]
+		}
+
+		maps = append(maps, VideoMap{
+			Id:    i + 1,
+			Name:  name,
+			Label: label,
+			Lines: sf.Lines[name],
+		})
+	}
+	return maps
+}
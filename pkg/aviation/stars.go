@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"slices"
 	"sort"
@@ -20,6 +21,7 @@ import (
 	"github.com/klauspost/compress/zstd"
 	"github.com/mmp/vice/pkg/math"
 	"github.com/mmp/vice/pkg/renderer"
+	"github.com/mmp/vice/pkg/units"
 	"github.com/mmp/vice/pkg/util"
 )
 
@@ -280,6 +282,40 @@ func PrintVideoMaps(path string, e *util.ErrorLogger) {
 	}
 }
 
+// WriteVideoMapLibrary writes the video maps to prefix-videomaps.gob.zst
+// and their names to prefix-manifest.gob, the files expected by
+// LoadVideoMapManifest.
+func WriteVideoMapLibrary(vmf VideoMapLibrary, prefix string) error {
+	f, err := os.Create(prefix + "-videomaps.gob.zst")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(zw).Encode(vmf); err != nil {
+		zw.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	names := make(map[string]interface{})
+	for _, m := range vmf.Maps {
+		names[m.Name] = nil
+	}
+	mf, err := os.Create(prefix + "-manifest.gob")
+	if err != nil {
+		return err
+	}
+	defer mf.Close()
+	return gob.NewEncoder(mf).Encode(names)
+}
+
 type STARSFacilityAdaptation struct {
 	AirspaceAwareness   []AirspaceAwareness               `json:"airspace_awareness"`
 	ForceQLToSelf       bool                              `json:"force_ql_self"`
@@ -305,6 +341,10 @@ type STARSFacilityAdaptation struct {
 	BeaconBank        int                        `json:"beacon_bank"`
 	KeepLDB           bool                       `json:"keep_ldb"`
 	FullLDBSeconds    int                        `json:"full_ldb_seconds"`
+	// Point out aircraft that will briefly enter another position's
+	// airspace automatically rather than suggesting that the controller
+	// do so.
+	AutoPointOuts bool `json:"auto_point_outs"`
 
 	HandoffAcceptFlashDuration int  `json:"handoff_acceptance_flash_duration"`
 	DisplayHOFacilityOnly      bool `json:"display_handoff_facility_only"`
@@ -328,6 +368,9 @@ type STARSFacilityAdaptation struct {
 	CoordinationLists []CoordinationList `json:"coordination_lists"`
 	RestrictionAreas  []RestrictionArea  `json:"restriction_areas"`
 	UseLegacyFont     bool               `json:"use_legacy_font"`
+
+	LeaderDirections LeaderDirectionAdaptation `json:"leader_directions"`
+	FDBTemplate      *DatablockTemplate        `json:"fdb_template"`
 }
 
 type STARSControllerConfig struct {
@@ -347,6 +390,63 @@ type CoordinationList struct {
 	YellowEntries bool     `json:"yellow_entries"`
 }
 
+// LeaderDirectionAdaptation specifies the facility's default leader line
+// directions for tracks that the controller hasn't given a direction for.
+// Areas are checked in order; if a track isn't in any of them, the
+// direction for the quadrant of the scope it's in is used.
+type LeaderDirectionAdaptation struct {
+	Areas           []LeaderDirectionArea `json:"areas"`
+	QuadrantStrings map[string]string     `json:"quadrants"` // e.g., "NE": "SW"
+	// Not in JSON, set during deserialize
+	Quadrants map[math.CardinalOrdinalDirection]math.CardinalOrdinalDirection
+}
+
+type LeaderDirectionArea struct {
+	Name            string          `json:"name"`
+	Vertices        []math.Point2LL `json:"vertices"`
+	Floor           int             `json:"floor"`
+	Ceiling         int             `json:"ceiling"` // no limit if zero
+	DirectionString string          `json:"direction"`
+	// Not in JSON, set during deserialize
+	Direction math.CardinalOrdinalDirection
+}
+
+func (a *LeaderDirectionArea) Inside(p math.Point2LL, alt int) bool {
+	if alt < a.Floor || (a.Ceiling != 0 && alt > a.Ceiling) {
+		return false
+	}
+	return math.PointInPolygon2LL(p, a.Vertices)
+}
+
+// Quadrant returns the ordinal direction of the quadrant around center
+// that p is in.
+func Quadrant(p, center math.Point2LL) math.CardinalOrdinalDirection {
+	north, east := p[1] >= center[1], p[0] >= center[0]
+	switch {
+	case north && east:
+		return math.NorthEast
+	case north:
+		return math.NorthWest
+	case east:
+		return math.SouthEast
+	default:
+		return math.SouthWest
+	}
+}
+
+// DefaultDirection returns the adapted leader line direction for a track
+// at the given position and altitude, where center is the center of the
+// scope; false is returned if there isn't one.
+func (la *LeaderDirectionAdaptation) DefaultDirection(p math.Point2LL, alt int, center math.Point2LL) (math.CardinalOrdinalDirection, bool) {
+	for i := range la.Areas {
+		if la.Areas[i].Inside(p, alt) {
+			return la.Areas[i].Direction, true
+		}
+	}
+	dir, ok := la.Quadrants[Quadrant(p, center)]
+	return dir, ok
+}
+
 type SignificantPoint struct {
 	Name         string        // JSON comes in as a map from name to SignificantPoint; we set this.
 	ShortName    string        `json:"short_name"`
@@ -368,10 +468,55 @@ type STARSFlightPlan struct {
 	CoordinationTime    CoordinationTime
 	CoordinationFix     string
 	ContainedFacilities []string
-	Altitude            string
+	Altitude            units.FlightDataAltitude
 	SP1                 string
 	SP2                 string
 	InitialController   string // For abbreviated FPs
+	Priority            PriorityFlags
+}
+
+// PriorityFlags record a flight's priority status. Lifeguard and MEDEVAC
+// come from the filed flight plan; minimum fuel and emergencies are
+// declared by the pilot. They're carried with the flight plan between
+// facilities.
+type PriorityFlags uint8
+
+const (
+	PriorityLifeguard PriorityFlags = 1 << iota
+	PriorityMEDEVAC
+	PriorityMinimumFuel
+	PriorityEmergency
+)
+
+func (p PriorityFlags) String() string {
+	var s []string
+	for i, name := range []string{"LIFEGUARD", "MEDEVAC", "MIN FUEL", "EMERGENCY"} {
+		if p&(1<<i) != 0 {
+			s = append(s, name)
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+// Indicator returns the most urgent of the flags as shown in datablocks
+// and lists; it's empty if there are none.
+func (p PriorityFlags) Indicator() string {
+	switch {
+	case p&PriorityEmergency != 0:
+		return "EM"
+	case p&PriorityMinimumFuel != 0:
+		return "MF"
+	case p&(PriorityLifeguard|PriorityMEDEVAC) != 0:
+		return "LG"
+	default:
+		return ""
+	}
+}
+
+// Expedite returns whether the flight should be handled ahead of others,
+// e.g., exempted from metering.
+func (p PriorityFlags) Expedite() bool {
+	return p&(PriorityLifeguard|PriorityMEDEVAC|PriorityEmergency) != 0
 }
 
 type CoordinationTime struct {
@@ -443,9 +588,12 @@ func (fa *STARSFacilityAdaptation) GetCoordinationFix(fp *STARSFlightPlan, acpos
 }
 
 func MakeSTARSFlightPlan(fp *FlightPlan) *STARSFlightPlan {
+	alt := units.MakeFlightDataAltitude(units.Feet(fp.Altitude))
+	alt.VFR = fp.Rules == VFR
 	return &STARSFlightPlan{
 		FlightPlan: fp,
-		Altitude:   fmt.Sprint(fp.Altitude),
+		Altitude:   alt,
+		Priority:   fp.FiledPriority(),
 	}
 }
 
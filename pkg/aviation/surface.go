@@ -0,0 +1,451 @@
+// pkg/aviation/surface.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package aviation
+
+import (
+	"container/heap"
+	"encoding/xml"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmp/vice/pkg/math"
+)
+
+// Surface is a model of an airport's surface--its taxiways, runways, and
+// gates--built from OpenStreetMap data. It's used to find where arriving
+// aircraft can exit the runway and how departing aircraft taxi to it.
+type Surface struct {
+	Nodes    map[int64]math.Point2LL
+	Taxiways []Taxiway
+	Runways  []SurfaceRunway
+	// Gates are nodes at gates and parking positions.
+	Gates []int64
+
+	NmPerLongitude float32
+
+	// node -> edges to adjacent nodes along taxiways
+	edges map[int64][]surfaceEdge
+}
+
+type Taxiway struct {
+	Name  string
+	Nodes []int64
+}
+
+// SurfaceRunway is a runway on the airport surface; Ids[i] is the runway
+// whose threshold is at Ends[i].
+type SurfaceRunway struct {
+	Ids  [2]string
+	Ends [2]math.Point2LL
+}
+
+func (r SurfaceRunway) String() string {
+	return r.Ids[0] + "/" + r.Ids[1]
+}
+
+// RunwayExit is a taxiway that leaves a runway.
+type RunwayExit struct {
+	Taxiway   string
+	Distance  float32 // from the threshold, in feet
+	HighSpeed bool
+}
+
+type surfaceEdge struct {
+	to      int64
+	taxiway string
+	length  float32 // nm
+}
+
+var (
+	ErrNoSurfaceRunways  = errors.New("No runways found in surface data")
+	ErrNoSurfaceTaxiways = errors.New("No taxiways found in surface data")
+)
+
+// Nodes within this distance of a runway's centerline are taken to be on
+// the runway.
+const onRunwayDistance = 0.03 // nm; ~180'
+
+type osmTag struct {
+	K string `xml:"k,attr"`
+	V string `xml:"v,attr"`
+}
+
+type osmData struct {
+	Nodes []struct {
+		Id   int64    `xml:"id,attr"`
+		Lat  float32  `xml:"lat,attr"`
+		Lon  float32  `xml:"lon,attr"`
+		Tags []osmTag `xml:"tag"`
+	} `xml:"node"`
+	Ways []struct {
+		Refs []struct {
+			Ref int64 `xml:"ref,attr"`
+		} `xml:"nd"`
+		Tags []osmTag `xml:"tag"`
+	} `xml:"way"`
+}
+
+func osmTagValue(tags []osmTag, k string) string {
+	if idx := slices.IndexFunc(tags, func(t osmTag) bool { return t.K == k }); idx != -1 {
+		return strings.TrimSpace(tags[idx].V)
+	}
+	return ""
+}
+
+// LoadOSMSurface reads an airport surface from OpenStreetMap XML; ways
+// tagged aeroway=taxiway and aeroway=runway give the taxiways and runways
+// and nodes or ways tagged aeroway=gate or aeroway=parking_position give
+// gates.
+func LoadOSMSurface(r io.Reader, nmPerLongitude float32) (*Surface, error) {
+	var osm osmData
+	if err := xml.NewDecoder(r).Decode(&osm); err != nil {
+		return nil, err
+	}
+
+	s := &Surface{
+		Nodes:          make(map[int64]math.Point2LL),
+		NmPerLongitude: nmPerLongitude,
+	}
+	for _, n := range osm.Nodes {
+		s.Nodes[n.Id] = math.Point2LL{n.Lon, n.Lat}
+		if av := osmTagValue(n.Tags, "aeroway"); av == "gate" || av == "parking_position" {
+			s.Gates = append(s.Gates, n.Id)
+		}
+	}
+
+	for _, w := range osm.Ways {
+		var nodes []int64
+		for _, nd := range w.Refs {
+			if _, ok := s.Nodes[nd.Ref]; ok {
+				nodes = append(nodes, nd.Ref)
+			}
+		}
+		if len(nodes) == 0 {
+			continue
+		}
+
+		switch osmTagValue(w.Tags, "aeroway") {
+		case "taxiway":
+			if len(nodes) > 1 {
+				s.Taxiways = append(s.Taxiways, Taxiway{Name: osmTagValue(w.Tags, "ref"), Nodes: nodes})
+			}
+
+		case "runway":
+			a, b, ok := strings.Cut(osmTagValue(w.Tags, "ref"), "/")
+			if !ok || len(nodes) < 2 {
+				continue
+			}
+			rwy := SurfaceRunway{
+				Ids:  [2]string{cleanRunway(strings.TrimLeft(a, "0")), cleanRunway(strings.TrimLeft(b, "0"))},
+				Ends: [2]math.Point2LL{s.Nodes[nodes[0]], s.Nodes[nodes[len(nodes)-1]]},
+			}
+			// Make sure that each runway's threshold is at the end that
+			// it is numbered for.
+			hdg := math.Heading2LL(rwy.Ends[0], rwy.Ends[1], nmPerLongitude, 0)
+			if n, err := strconv.Atoi(strings.TrimRight(rwy.Ids[0], "LRC")); err == nil &&
+				math.HeadingDifference(hdg, float32(10*n)) > 90 {
+				rwy.Ends[0], rwy.Ends[1] = rwy.Ends[1], rwy.Ends[0]
+			}
+			s.Runways = append(s.Runways, rwy)
+
+		case "gate", "parking_position":
+			s.Gates = append(s.Gates, nodes[0])
+		}
+	}
+
+	if len(s.Runways) == 0 {
+		return nil, ErrNoSurfaceRunways
+	}
+	if len(s.Taxiways) == 0 {
+		return nil, ErrNoSurfaceTaxiways
+	}
+
+	s.edges = make(map[int64][]surfaceEdge)
+	for _, tw := range s.Taxiways {
+		for i := 1; i < len(tw.Nodes); i++ {
+			a, b := tw.Nodes[i-1], tw.Nodes[i]
+			l := math.NMDistance2LLFast(s.Nodes[a], s.Nodes[b], nmPerLongitude)
+			s.edges[a] = append(s.edges[a], surfaceEdge{to: b, taxiway: tw.Name, length: l})
+			s.edges[b] = append(s.edges[b], surfaceEdge{to: a, taxiway: tw.Name, length: l})
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Surface) nm(p math.Point2LL) [2]float32 {
+	return math.LL2NM(p, s.NmPerLongitude)
+}
+
+// LookupRunway returns the surface runway that includes the given runway
+// along with the index of the given runway in its Ids.
+func (s *Surface) LookupRunway(rwy string) (SurfaceRunway, int, bool) {
+	rwy = cleanRunway(TidyRunway(rwy))
+	for _, r := range s.Runways {
+		if i := slices.Index(r.Ids[:], rwy); i != -1 {
+			return r, i, true
+		}
+	}
+	return SurfaceRunway{}, 0, false
+}
+
+// RunwayLength returns the length of the runway in feet.
+func (s *Surface) RunwayLength(rwy string) (float32, bool) {
+	r, _, ok := s.LookupRunway(rwy)
+	if !ok {
+		return 0, false
+	}
+	return 6076 * math.NMDistance2LLFast(r.Ends[0], r.Ends[1], s.NmPerLongitude), true
+}
+
+// RunwayExits returns the taxiways that leave the given runway, sorted by
+// distance from its threshold. High-speed exits are those that leave at
+// an acute angle in the direction of landing.
+func (s *Surface) RunwayExits(rwy string) []RunwayExit {
+	r, i, ok := s.LookupRunway(rwy)
+	if !ok {
+		return nil
+	}
+	p0, p1 := s.nm(r.Ends[i]), s.nm(r.Ends[1-i])
+	length := math.Distance2f(p0, p1)
+	if length == 0 {
+		return nil
+	}
+	dir := math.Normalize2f(math.Sub2f(p1, p0))
+
+	var exits []RunwayExit
+	for _, tw := range s.Taxiways {
+		for j, n := range tw.Nodes {
+			p := s.nm(s.Nodes[n])
+			if math.PointSegmentDistance(p, p0, p1) > onRunwayDistance {
+				continue
+			}
+			along := math.Dot(math.Sub2f(p, p0), dir)
+			if along < 0 || along > length {
+				continue
+			}
+
+			// Look at where the taxiway goes from the runway.
+			exit := RunwayExit{Taxiway: tw.Name, Distance: 6076 * along}
+			for _, k := range []int{j - 1, j + 1} {
+				if k < 0 || k >= len(tw.Nodes) {
+					continue
+				}
+				q := s.nm(s.Nodes[tw.Nodes[k]])
+				if math.PointSegmentDistance(q, p0, p1) <= onRunwayDistance {
+					continue
+				}
+				// cos(50 degrees)
+				if math.Dot(math.Normalize2f(math.Sub2f(q, p)), dir) > 0.64 {
+					exit.HighSpeed = true
+				}
+			}
+
+			// Taxiways along the runway touch it at many nodes; only
+			// take the first of any that are close together.
+			if !slices.ContainsFunc(exits, func(e RunwayExit) bool {
+				return e.Taxiway == exit.Taxiway && math.Abs(e.Distance-exit.Distance) < 500
+			}) {
+				exits = append(exits, exit)
+			}
+		}
+	}
+
+	slices.SortFunc(exits, func(a, b RunwayExit) int {
+		if a.Distance < b.Distance {
+			return -1
+		} else if a.Distance > b.Distance {
+			return 1
+		}
+		return strings.Compare(a.Taxiway, b.Taxiway)
+	})
+	return exits
+}
+
+// closestNode returns the taxiway node closest to the given point.
+func (s *Surface) closestNode(p math.Point2LL) (int64, bool) {
+	best, found := int64(0), false
+	bestDist := float32(0)
+	for n := range s.edges {
+		if d := math.NMDistance2LLFast(p, s.Nodes[n], s.NmPerLongitude); !found || d < bestDist ||
+			(d == bestDist && n < best) {
+			best, bestDist, found = n, d, true
+		}
+	}
+	return best, found
+}
+
+type taxiQueueItem struct {
+	node int64
+	dist float32
+}
+
+type taxiQueue []taxiQueueItem
+
+func (q taxiQueue) Len() int           { return len(q) }
+func (q taxiQueue) Less(i, j int) bool { return q[i].dist < q[j].dist }
+func (q taxiQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *taxiQueue) Push(x any)        { *q = append(*q, x.(taxiQueueItem)) }
+func (q *taxiQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// TaxiRoute returns the shortest route along the taxiways between the
+// taxiway nodes closest to the two points, as a list of nodes, along
+// with its length in nm.
+func (s *Surface) TaxiRoute(from, to math.Point2LL) ([]int64, float32, bool) {
+	return s.TaxiRouteAvoiding(from, to, nil)
+}
+
+// TaxiRouteAvoiding is like TaxiRoute but doesn't use the given taxiways,
+// e.g. because they're closed.
+func (s *Surface) TaxiRouteAvoiding(from, to math.Point2LL, avoid []string) ([]int64, float32, bool) {
+	start, ok := s.closestNode(from)
+	if !ok {
+		return nil, 0, false
+	}
+	end, ok := s.closestNode(to)
+	if !ok {
+		return nil, 0, false
+	}
+
+	dist := map[int64]float32{start: 0}
+	prev := make(map[int64]int64)
+	q := &taxiQueue{{node: start}}
+	for q.Len() > 0 {
+		item := heap.Pop(q).(taxiQueueItem)
+		if item.node == end {
+			break
+		}
+		if item.dist > dist[item.node] {
+			continue // stale entry
+		}
+		for _, e := range s.edges[item.node] {
+			if slices.Contains(avoid, e.taxiway) {
+				continue
+			}
+			d := item.dist + e.length
+			if od, ok := dist[e.to]; !ok || d < od {
+				dist[e.to] = d
+				prev[e.to] = item.node
+				heap.Push(q, taxiQueueItem{node: e.to, dist: d})
+			}
+		}
+	}
+
+	if _, ok := dist[end]; !ok {
+		return nil, 0, false
+	}
+	route := []int64{end}
+	for n := end; n != start; {
+		n = prev[n]
+		route = append(route, n)
+	}
+	slices.Reverse(route)
+	return route, dist[end], true
+}
+
+// RunwayCrossings returns the runways that the given taxi route crosses,
+// in order.
+func (s *Surface) RunwayCrossings(route []int64) []SurfaceRunway {
+	var crossings []SurfaceRunway
+	for i := 1; i < len(route); i++ {
+		a, b := s.nm(s.Nodes[route[i-1]]), s.nm(s.Nodes[route[i]])
+		for _, r := range s.Runways {
+			if slices.Contains(crossings, r) {
+				continue
+			}
+			r0, r1 := s.nm(r.Ends[0]), s.nm(r.Ends[1])
+			// Either the segment crosses the centerline or the route
+			// passes over a node on the runway.
+			onRunway := math.PointSegmentDistance(b, r0, r1) <= onRunwayDistance
+			if segmentsIntersect(a, b, r0, r1) || (onRunway && i < len(route)-1) {
+				crossings = append(crossings, r)
+			}
+		}
+	}
+	return crossings
+}
+
+func segmentsIntersect(a, b, c, d [2]float32) bool {
+	orient := func(p, q, r [2]float32) float32 {
+		return (q[0]-p[0])*(r[1]-p[1]) - (q[1]-p[1])*(r[0]-p[0])
+	}
+	o1, o2 := orient(a, b, c), orient(a, b, d)
+	o3, o4 := orient(c, d, a), orient(c, d, b)
+	return ((o1 > 0) != (o2 > 0)) && ((o3 > 0) != (o4 > 0)) && o1 != 0 && o2 != 0 && o3 != 0 && o4 != 0
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Runway occupancy
+
+// landingRoll returns the distance in feet that an aircraft in the given
+// CWT category typically needs to slow to exit speed after touchdown.
+func landingRoll(cwt string) float32 {
+	switch cwt {
+	case "A", "B", "C":
+		return 6000
+	case "D", "E":
+		return 5000
+	case "F", "G":
+		return 4500
+	case "H":
+		return 3000
+	default:
+		return 1500
+	}
+}
+
+// ArrivalRunwayOccupancy returns the exit that an arrival in the given CWT
+// category that touches down at the given speed (in knots) takes and how
+// long it occupies the runway. It takes the first exit it can slow down
+// for; high-speed exits may be taken at a higher speed and so a bit
+// earlier. If no exits are given, a plausible one is made up; if none is
+// usable, it rolls to the end of the runway, whose length is given in
+// feet.
+func ArrivalRunwayOccupancy(cwt string, speed float32, exits []RunwayExit, length float32) (RunwayExit, time.Duration) {
+	roll := landingRoll(cwt)
+
+	exit := RunwayExit{Distance: 1.1 * roll}
+	if len(exits) > 0 {
+		exit = RunwayExit{Distance: max(length, roll)}
+		if idx := slices.IndexFunc(exits, func(e RunwayExit) bool {
+			return e.Distance >= roll || (e.HighSpeed && e.Distance >= 0.85*roll)
+		}); idx != -1 {
+			exit = exits[idx]
+		}
+	}
+
+	// Decelerate uniformly to the exit speed and then take some time to
+	// clear the runway.
+	const ktToFtPerSec = 1.688
+	exitSpeed, clear := float32(15), float32(15)
+	if exit.HighSpeed {
+		exitSpeed, clear = 50, 8
+	}
+	seconds := 2*exit.Distance/(ktToFtPerSec*(speed+exitSpeed)) + clear
+	return exit, time.Duration(seconds * float32(time.Second))
+}
+
+// DepartureRunwayOccupancy returns how long a departure in the given CWT
+// category occupies the runway: the time to line up and for the takeoff
+// roll.
+func DepartureRunwayOccupancy(cwt string) time.Duration {
+	switch cwt {
+	case "A", "B", "C":
+		return 55 * time.Second
+	case "D", "E", "F", "G":
+		return 45 * time.Second
+	default:
+		return 35 * time.Second
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/mmp/vice/pkg/math"
@@ -46,17 +47,17 @@ func (w Wind) String() string {
 	}
 }
 
-func (w Wind) Randomize() Wind {
-	w.Speed += -3 + rand.Intn(6)
+func (w Wind) Randomize(r *rand.Rand) Wind {
+	w.Speed += -3 + r.Intn(6)
 	if w.Speed < 0 {
 		w.Speed = 0
 	} else if w.Speed < 4 {
 		w.Variable = true
 	} else {
 		dir := 10 * ((w.Direction + 5) / 10)
-		dir += [3]int{-10, 0, 10}[rand.Intn(3)]
+		dir += [3]int{-10, 0, 10}[r.Intn(3)]
 		w.Direction = dir
-		gst := w.Gust - 3 + rand.Intn(6)
+		gst := w.Gust - 3 + r.Intn(6)
 		if gst-w.Speed > 5 {
 			w.Gust = gst
 		}
@@ -80,6 +81,11 @@ type METAR struct {
 	Altimeter   string
 	Weather     string
 	Rmk         string
+	// Ceiling is the height of the lowest broken or overcast layer (feet
+	// AGL) and Visibility is in statute miles; they're zero if they
+	// weren't reported or, for the ceiling, if there isn't one.
+	Ceiling    int
+	Visibility float32
 }
 
 func (m METAR) String() string {
@@ -95,11 +101,11 @@ type avWeatherMETAR struct {
 	//ReportTime  string      `json:"reportTime"`
 	//Temp        float64     `json:"temp"`
 	//Dewp        float64     `json:"dewp"`
-	WindDir   any `json:"wdir"` // Wind direction in degrees or VRB for variable winds
-	WindSpeed int `json:"wspd"` // Wind speed in knots
-	WindGust  int `json:"wgst"` // Wind gusts in knots
-	//Visib string  `json:"visib"`
-	Altim float64 `json:"altim"` // Altimeter setting in hectoPascals
+	WindDir   any     `json:"wdir"`  // Wind direction in degrees or VRB for variable winds
+	WindSpeed int     `json:"wspd"`  // Wind speed in knots
+	WindGust  int     `json:"wgst"`  // Wind gusts in knots
+	Visib     any     `json:"visib"` // Statute miles; a number or a string like "10+"
+	Altim     float64 `json:"altim"` // Altimeter setting in hectoPascals
 	//Slp        float64      `json:"slp"`
 	//QcField    int          `json:"qcField"`
 	//WxString   *string  `json:"wxString"` // Encoded present weather string
@@ -122,15 +128,13 @@ type avWeatherMETAR struct {
 	//Elev       int          `json:"elev"`
 	//Prior      int          `json:"prior"`
 	//Name       string       `json:"name"`
-	//Clouds     []cloudLayer `json:"clouds"`
+	Clouds []cloudLayer `json:"clouds"`
 }
 
-/*
 type cloudLayer struct {
-	Base  int64  `json:"base"`
+	Base  int    `json:"base"`
 	Cover string `json:"cover"`
 }
-*/
 
 // GetWindDirection returns the wind direction in degrees or VRB for variable winds.
 func (m avWeatherMETAR) WindDirection() (vrb bool, direction int) {
@@ -142,6 +146,32 @@ func (m avWeatherMETAR) WindDirection() (vrb bool, direction int) {
 	return
 }
 
+// Visibility returns the visibility in statute miles or zero if it wasn't
+// reported.
+func (m avWeatherMETAR) Visibility() float32 {
+	switch v := m.Visib.(type) {
+	case float64:
+		return float32(v)
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSuffix(v, "+"), 32); err == nil {
+			return float32(f)
+		}
+	}
+	return 0
+}
+
+// Ceiling returns the base of the lowest broken or overcast layer in feet
+// or zero if there isn't one.
+func (m avWeatherMETAR) Ceiling() int {
+	ceiling := 0
+	for _, c := range m.Clouds {
+		if (c.Cover == "BKN" || c.Cover == "OVC" || c.Cover == "OVX") && (ceiling == 0 || c.Base < ceiling) {
+			ceiling = c.Base
+		}
+	}
+	return ceiling
+}
+
 // getAltimeter returns the altimeter setting in inches Hg
 func (m avWeatherMETAR) Altimeter() float64 {
 	// Conversion formula (hectoPascal to Inch of Mercury): 29.92 * (hpa / 1013.2)
@@ -174,6 +204,8 @@ func GetWeather(icao ...string) ([]METAR, error) {
 		metar.Wind.Variable, metar.Wind.Direction = m.WindDirection()
 		metar.Wind.Speed = m.WindSpeed
 		metar.Wind.Gust = m.WindGust
+		metar.Ceiling = m.Ceiling()
+		metar.Visibility = m.Visibility()
 
 		return metar
 	})
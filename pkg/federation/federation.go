@@ -0,0 +1,276 @@
+// pkg/federation/federation.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+// Package federation links two independently-running sims so that each
+// acts as the other's adjacent facilities--for example, one running N90
+// and the other ZNY. The sims exchange NAS messages (flight plans,
+// amendments, and track transfers), the tracks of the aircraft that each
+// one is flying, handoffs, and PIREPs. One of the sims listens for the other to
+// connect; messages are sent as JSON, one per line.
+package federation
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/math"
+)
+
+const (
+	dialTimeout = 15 * time.Second
+	// Sends fail if the other sim falls this many messages behind.
+	sendQueueLength = 4096
+)
+
+var (
+	ErrBacklogged   = errors.New("Federated sim is not keeping up")
+	ErrClosed       = errors.New("Federation link closed")
+	ErrNoAddress    = errors.New("No address given for the federated sim")
+	ErrNotConnected = errors.New("Not connected to the federated sim")
+)
+
+// Config specifies how to connect to the other sim: exactly one of
+// Listen and Peer should be given.
+type Config struct {
+	Listen string // address to listen at, e.g. ":6502"
+	Peer   string // host:port of the sim that is listening
+	// RemoteFacilities are the facilities (e.g., "ZNY") that the other
+	// sim is responsible for.
+	RemoteFacilities []string
+}
+
+// Message is sent between the sims; only one of its fields is set.
+type Message struct {
+	NAS     *NASMessage  `json:",omitempty"`
+	Tracks  *TrackUpdate `json:",omitempty"`
+	Handoff *Handoff     `json:",omitempty"`
+	// PIREP is opaque here, like NAS message payloads.
+	PIREP json.RawMessage `json:",omitempty"`
+}
+
+// NASMessage is a message sent to the computer of one of the receiving
+// sim's facilities. The message itself is opaque here; it is encoded and
+// decoded by the sims.
+type NASMessage struct {
+	Facility string
+	Payload  json.RawMessage
+}
+
+// TrackUpdate gives the current state of all of the aircraft that the
+// sending sim is flying.
+type TrackUpdate struct {
+	Tracks []Track
+}
+
+type Track struct {
+	Callsign   string
+	Squawk     av.Squawk
+	Mode       av.TransponderMode
+	Position   math.Point2LL
+	Altitude   float32
+	GS         float32
+	Heading    float32 // true
+	FlightPlan *av.FlightPlan
+	// Set if the aircraft is tracked by a controller at one of the
+	// sending sim's facilities.
+	TrackingController string
+}
+
+// Handoff is a handoff offer from a controller in the sending sim to one
+// in the receiving sim or, if Accepted is set, its acceptance.
+type Handoff struct {
+	Callsign string
+	From, To string
+	Accepted bool
+}
+
+// Link is a connection to the other sim. The network I/O happens in the
+// background; Received returns what has arrived so far.
+type Link struct {
+	config Config
+	lg     *log.Logger
+
+	mu       sync.Mutex
+	listener net.Listener
+	conn     net.Conn
+	err      error
+	received []Message
+	queue    chan []byte
+	done     chan struct{}
+}
+
+// Connect starts listening for or connecting to the other sim in the
+// background; Err reports if it fails.
+func Connect(config Config, lg *log.Logger) *Link {
+	l := &Link{
+		config: config,
+		lg:     lg,
+		queue:  make(chan []byte, sendQueueLength),
+		done:   make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+func (l *Link) run() {
+	defer l.lg.CatchAndReportCrash()
+
+	conn, err := l.connect()
+	if err != nil {
+		l.fail(err)
+		return
+	}
+
+	l.mu.Lock()
+	if l.err != nil {
+		// Closed while we were connecting.
+		l.mu.Unlock()
+		conn.Close()
+		return
+	}
+	l.conn = conn
+	l.mu.Unlock()
+	l.lg.Infof("federation: connected to %s", conn.RemoteAddr())
+
+	go l.write(conn)
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	for {
+		var m Message
+		if err := dec.Decode(&m); err != nil {
+			l.fail(err)
+			return
+		}
+		l.mu.Lock()
+		l.received = append(l.received, m)
+		l.mu.Unlock()
+	}
+}
+
+func (l *Link) connect() (net.Conn, error) {
+	switch {
+	case l.config.Listen != "":
+		ln, err := net.Listen("tcp", l.config.Listen)
+		if err != nil {
+			return nil, err
+		}
+		l.mu.Lock()
+		l.listener = ln
+		l.mu.Unlock()
+		l.lg.Infof("federation: listening at %s", ln.Addr())
+
+		// There's only one other sim, so stop listening once it has
+		// connected.
+		conn, err := ln.Accept()
+		ln.Close()
+		return conn, err
+
+	case l.config.Peer != "":
+		return net.DialTimeout("tcp", l.config.Peer, dialTimeout)
+
+	default:
+		return nil, ErrNoAddress
+	}
+}
+
+func (l *Link) write(conn net.Conn) {
+	defer l.lg.CatchAndReportCrash()
+
+	for {
+		select {
+		case b := <-l.queue:
+			if _, err := conn.Write(b); err != nil {
+				l.fail(err)
+				return
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *Link) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err == nil {
+		l.lg.Warnf("federation: %v", err)
+		l.err = err
+		if l.listener != nil {
+			l.listener.Close()
+		}
+		if l.conn != nil {
+			l.conn.Close()
+		}
+		close(l.done)
+	}
+}
+
+// Addr returns the address that the link is listening at, or nil if it
+// isn't listening.
+func (l *Link) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.listener == nil {
+		return nil
+	}
+	return l.listener.Addr()
+}
+
+// Send queues the message to be sent to the other sim.
+func (l *Link) Send(m Message) error {
+	if !l.Connected() {
+		return ErrNotConnected
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	select {
+	case l.queue <- b:
+		return nil
+	default:
+		return ErrBacklogged
+	}
+}
+
+// Received returns the messages received since the last time it was
+// called.
+func (l *Link) Received() []Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m := l.received
+	l.received = nil
+	return m
+}
+
+// Connected returns true once the other sim has connected.
+func (l *Link) Connected() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conn != nil && l.err == nil
+}
+
+// Err returns the error that ended the link, if it has ended.
+func (l *Link) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Close disconnects from the other sim.
+func (l *Link) Close() {
+	l.fail(ErrClosed)
+}
@@ -0,0 +1,68 @@
+// pkg/federation/federation_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package federation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	for start := time.Now(); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestLink(t *testing.T) {
+	a := Connect(Config{Listen: "localhost:0"}, nil)
+	defer a.Close()
+
+	waitFor(t, "listener", func() bool { return a.Addr() != nil || a.Err() != nil })
+	if err := a.Err(); err != nil {
+		t.Skipf("unable to listen: %v", err)
+	}
+
+	b := Connect(Config{Peer: a.Addr().String()}, nil)
+	defer b.Close()
+
+	waitFor(t, "connection", func() bool { return a.Connected() && b.Connected() })
+
+	if err := b.Send(Message{Handoff: &Handoff{Callsign: "AAL123", From: "N56", To: "2J"}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := a.Send(Message{NAS: &NASMessage{Facility: "N90", Payload: json.RawMessage(`{"BCN":1234}`)}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var ma, mb []Message
+	waitFor(t, "messages", func() bool {
+		ma = append(ma, a.Received()...)
+		mb = append(mb, b.Received()...)
+		return len(ma) > 0 && len(mb) > 0
+	})
+	if len(ma) != 1 || ma[0].Handoff == nil || *ma[0].Handoff != (Handoff{Callsign: "AAL123", From: "N56", To: "2J"}) {
+		t.Errorf("unexpected messages %+v", ma)
+	}
+	if len(mb) != 1 || mb[0].NAS == nil || mb[0].NAS.Facility != "N90" || string(mb[0].NAS.Payload) != `{"BCN":1234}` {
+		t.Errorf("unexpected messages %+v", mb)
+	}
+
+	b.Close()
+	waitFor(t, "disconnect", func() bool { return a.Err() != nil })
+	if err := a.Send(Message{}); err != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestNoAddress(t *testing.T) {
+	l := Connect(Config{}, nil)
+	waitFor(t, "failure", func() bool { return l.Err() != nil })
+	if err := l.Err(); err != ErrNoAddress {
+		t.Errorf("expected ErrNoAddress, got %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+// pkg/fsd/client.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package fsd
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/util"
+)
+
+const (
+	protocolVersion = 9
+	// How often our position is sent; the network drops clients it
+	// doesn't hear from.
+	positionInterval = 15 * time.Second
+	dialTimeout      = 15 * time.Second
+)
+
+var (
+	ErrNotConnected = errors.New("Not connected to network")
+	ErrClosed       = errors.New("Network connection closed")
+)
+
+// Config gives the parameters for connecting to a network as a
+// controller.
+type Config struct {
+	Server string // host:port
+	ATC
+}
+
+// Authenticator responds to the server's challenges to establish that the
+// client is one that the network has approved. The VATSIM network
+// requires this; vice does not have a key of its own, so one must be
+// provided to connect there. Private FSD servers generally don't issue
+// challenges.
+type Authenticator interface {
+	ClientID() string
+	Respond(challenge string) string
+}
+
+// Client is a connection to an FSD server. All of the network I/O happens
+// in the background; the methods that return state from the network
+// return what has been received so far.
+type Client struct {
+	config Config
+	auth   Authenticator
+	lg     *log.Logger
+
+	mu        sync.Mutex
+	writeMu   sync.Mutex
+	conn      net.Conn
+	connected bool
+	err       error
+	pilots    map[string]*Pilot
+	handoffs  []Handoff
+	messages  []Message
+	done      chan struct{}
+}
+
+// Message is a text message sent to us or to everyone on a frequency.
+type Message struct {
+	From, To string
+	Text     string
+}
+
+// Connect starts connecting to the server in the background; Err reports
+// if it fails.
+func Connect(config Config, auth Authenticator, lg *log.Logger) *Client {
+	c := &Client{
+		config: config,
+		auth:   auth,
+		lg:     lg,
+		pilots: make(map[string]*Pilot),
+		done:   make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+func (c *Client) run() {
+	defer c.lg.CatchAndReportCrash()
+
+	conn, err := net.DialTimeout("tcp", c.config.Server, dialTimeout)
+	if err != nil {
+		c.fail(err)
+		return
+	}
+	c.mu.Lock()
+	if c.err != nil {
+		// Close was called while we were dialing.
+		c.mu.Unlock()
+		conn.Close()
+		return
+	}
+	c.conn = conn
+	c.mu.Unlock()
+	c.lg.Infof("fsd: connected to %s as %s", c.config.Server, c.config.Callsign)
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		if p, err := ParsePacket(line); err == nil {
+			c.handle(p)
+		}
+	}
+}
+
+func (c *Client) handle(p Packet) {
+	switch p.Type {
+	case ServerIdentify:
+		// The server has identified itself; identify ourselves and log in.
+		clientID, response := "0", ""
+		if c.auth != nil {
+			clientID, response = c.auth.ClientID(), c.auth.Respond(p.field(3))
+		}
+		c.send(Packet{Type: ClientIdentify, Fields: []string{c.config.Callsign, "SERVER", clientID, "vice",
+			"1", "0", c.config.CID, "", response}})
+		c.send(MakeAddATC(c.config.ATC, protocolVersion))
+		c.sendPosition()
+
+		c.mu.Lock()
+		c.connected = true
+		c.mu.Unlock()
+		go c.updatePosition()
+
+	case serverChallenge:
+		if c.auth != nil {
+			c.send(Packet{Type: challengeResponse, Fields: []string{c.config.Callsign, p.field(0),
+				c.auth.Respond(p.field(2))}})
+		}
+
+	case PilotPosition:
+		pilot, err := ParsePilotPosition(p)
+		if err != nil {
+			c.lg.Warnf("fsd: %v: %s", err, strings.TrimSpace(p.String()))
+			return
+		}
+		c.mu.Lock()
+		prev, ok := c.pilots[pilot.Callsign]
+		if ok {
+			pilot.FlightPlan = prev.FlightPlan
+		}
+		c.pilots[pilot.Callsign] = &pilot
+		c.mu.Unlock()
+
+		if !ok {
+			// Ask for the flight plan of aircraft we haven't seen before.
+			c.send(Packet{Type: ClientQuery, Fields: []string{c.config.Callsign, "SERVER", "FP", pilot.Callsign}})
+		}
+
+	case DeletePilot:
+		c.mu.Lock()
+		delete(c.pilots, p.field(0))
+		c.mu.Unlock()
+
+	case FlightPlan:
+		fp, err := ParseFlightPlan(p)
+		if err != nil {
+			c.lg.Warnf("fsd: %v: %s", err, strings.TrimSpace(p.String()))
+			return
+		}
+		c.mu.Lock()
+		if pilot, ok := c.pilots[fp.Callsign]; ok {
+			pilot.FlightPlan = fp
+		} else {
+			c.pilots[fp.Callsign] = &Pilot{Callsign: fp.Callsign, FlightPlan: fp}
+		}
+		c.mu.Unlock()
+
+	case HandoffOffer, HandoffAccept:
+		if h, err := ParseHandoff(p); err == nil && h.To == c.config.Callsign {
+			c.mu.Lock()
+			c.handoffs = append(c.handoffs, h)
+			c.mu.Unlock()
+		}
+
+	case TextMessage:
+		if to := p.field(1); to == c.config.Callsign || strings.HasPrefix(to, "@") {
+			c.mu.Lock()
+			c.messages = append(c.messages, Message{From: p.field(0), To: to,
+				Text: strings.Join(p.Fields[min(2, len(p.Fields)):], ":")})
+			c.mu.Unlock()
+		}
+
+	case Error:
+		se := ParseServerError(p)
+		if slices.Contains(fatalErrorCodes, se.Code) {
+			c.fail(se)
+		} else {
+			c.lg.Warnf("fsd: %v", se)
+		}
+	}
+}
+
+func (c *Client) updatePosition() {
+	defer c.lg.CatchAndReportCrash()
+
+	ticker := time.NewTicker(positionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.sendPosition()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Client) sendPosition() {
+	if p, err := MakeATCPosition(c.config.ATC); err != nil {
+		c.lg.Warnf("fsd: %v", err)
+	} else {
+		c.send(p)
+	}
+}
+
+func (c *Client) send(p Packet) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := conn.Write([]byte(p.String()))
+	if err != nil {
+		c.fail(err)
+	}
+	return err
+}
+
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err == nil {
+		c.lg.Warnf("fsd: %v", err)
+		c.err = err
+		c.connected = false
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		close(c.done)
+	}
+}
+
+// Close logs off from the network.
+func (c *Client) Close() {
+	if c.Connected() {
+		c.send(MakeDeleteATC(c.config.ATC))
+	}
+	c.fail(ErrClosed)
+}
+
+// Err returns the error that ended the connection, if it has ended.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Connected returns true once we have logged in to the network.
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// Callsign returns our callsign on the network.
+func (c *Client) Callsign() string {
+	return c.config.Callsign
+}
+
+// Pilots returns the pilots that we have received updates for, sorted by
+// callsign.
+func (c *Client) Pilots() []Pilot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var pilots []Pilot
+	for _, callsign := range util.SortedMapKeys(c.pilots) {
+		pilots = append(pilots, *c.pilots[callsign])
+	}
+	return pilots
+}
+
+// Handoffs returns the handoff offers and acceptances that other
+// controllers have sent us since the last time it was called.
+func (c *Client) Handoffs() []Handoff {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h := c.handoffs
+	c.handoffs = nil
+	return h
+}
+
+// Messages returns the text messages received since the last time it was
+// called.
+func (c *Client) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.messages
+	c.messages = nil
+	return m
+}
+
+// OfferHandoff offers the track of the given aircraft to the controller
+// with the given network callsign.
+func (c *Client) OfferHandoff(callsign, to string) error {
+	if !c.Connected() {
+		return ErrNotConnected
+	}
+	return c.send(MakeHandoff(Handoff{From: c.config.Callsign, To: to, Callsign: callsign}))
+}
+
+// AcceptHandoff accepts a handoff of the given aircraft from the
+// controller with the given network callsign.
+func (c *Client) AcceptHandoff(callsign, from string) error {
+	if !c.Connected() {
+		return ErrNotConnected
+	}
+	return c.send(MakeHandoff(Handoff{From: c.config.Callsign, To: from, Callsign: callsign, Accepted: true}))
+}
@@ -0,0 +1,195 @@
+// pkg/fsd/fsd_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package fsd
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/math"
+)
+
+func TestParsePacket(t *testing.T) {
+	for _, test := range []struct {
+		line   string
+		typ    string
+		fields []string
+	}{
+		{"#TMJFK_APP:@24550:hello\r\n", TextMessage, []string{"JFK_APP", "@24550", "hello"}},
+		{"$HOJFK_APP:NY_CTR:AAL123\n", HandoffOffer, []string{"JFK_APP", "NY_CTR", "AAL123"}},
+		{"@N:AAL123:1200:1:40.1:-73.2:5000:250:0:0", PilotPosition, []string{"N", "AAL123", "1200", "1", "40.1", "-73.2", "5000", "250", "0", "0"}},
+		{"%JFK_APP:24550:5:150:5:40.6:-73.7:0", ATCPosition, []string{"JFK_APP", "24550", "5", "150", "5", "40.6", "-73.7", "0"}},
+	} {
+		p, err := ParsePacket(test.line)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.line, err)
+			continue
+		}
+		if p.Type != test.typ {
+			t.Errorf("%q: got type %q, expected %q", test.line, p.Type, test.typ)
+		}
+		if len(p.Fields) != len(test.fields) {
+			t.Errorf("%q: got fields %v, expected %v", test.line, p.Fields, test.fields)
+			continue
+		}
+		for i := range p.Fields {
+			if p.Fields[i] != test.fields[i] {
+				t.Errorf("%q: got fields %v, expected %v", test.line, p.Fields, test.fields)
+				break
+			}
+		}
+	}
+
+	if _, err := ParsePacket("!bogus"); err != ErrUnknownPacket {
+		t.Errorf("expected ErrUnknownPacket, got %v", err)
+	}
+}
+
+func TestPilotPosition(t *testing.T) {
+	pilot := Pilot{
+		Callsign: "AAL123",
+		Squawk:   av.Squawk(0o4521),
+		Mode:     av.Altitude,
+		Ident:    true,
+		Position: math.Point2LL{-73.77861, 40.63993},
+		Altitude: 5000,
+		GS:       250,
+		Heading:  270,
+	}
+
+	p, err := ParsePacket(MakePilotPosition(pilot).String())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	got, err := ParsePilotPosition(p)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if got.Callsign != pilot.Callsign || got.Squawk != pilot.Squawk || got.Mode != pilot.Mode ||
+		got.Ident != pilot.Ident || got.Altitude != pilot.Altitude || got.GS != pilot.GS || got.OnGround {
+		t.Errorf("got %+v, expected %+v", got, pilot)
+	}
+	if math.NMDistance2LL(got.Position, pilot.Position) > 0.01 {
+		t.Errorf("got position %v, expected %v", got.Position, pilot.Position)
+	}
+	if math.HeadingDifference(got.Heading, pilot.Heading) > 0.5 {
+		t.Errorf("got heading %f, expected %f", got.Heading, pilot.Heading)
+	}
+
+	if _, err := ParsePilotPosition(Packet{Type: PilotPosition, Fields: []string{"N", "AAL123"}}); err != ErrMalformedPacket {
+		t.Errorf("expected ErrMalformedPacket, got %v", err)
+	}
+}
+
+func TestPBH(t *testing.T) {
+	for _, hdg := range []float32{0, 45, 90, 181, 359} {
+		for _, ground := range []bool{false, true} {
+			h, g := decodePBH(encodePBH(hdg, ground))
+			if math.HeadingDifference(h, hdg) > 0.5 || g != ground {
+				t.Errorf("%f/%v: got %f/%v", hdg, ground, h, g)
+			}
+		}
+	}
+}
+
+func TestParseFlightPlan(t *testing.T) {
+	p, err := ParsePacket("$FPDAL456:*A:I:B738/L:450:KJFK:1400:1405:FL350:KATL:2:10:4:0:KCLT:/v/:DEEZZ5 CANDR J60 PSB\r\n")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	fp, err := ParseFlightPlan(p)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := av.FlightPlan{
+		Callsign:         "DAL456",
+		Rules:            av.IFR,
+		AircraftType:     "B738/L",
+		CruiseSpeed:      450,
+		DepartureAirport: "KJFK",
+		DepartTimeEst:    1400,
+		DepartTimeActual: 1405,
+		Altitude:         35000,
+		ArrivalAirport:   "KATL",
+		Hours:            2,
+		Minutes:          10,
+		FuelHours:        4,
+		AlternateAirport: "KCLT",
+		Remarks:          "/v/",
+		Route:            "DEEZZ5 CANDR J60 PSB",
+	}
+	if *fp != expected {
+		t.Errorf("got %+v, expected %+v", *fp, expected)
+	}
+}
+
+func TestHandoff(t *testing.T) {
+	for _, h := range []Handoff{
+		{From: "JFK_APP", To: "NY_CTR", Callsign: "AAL123"},
+		{From: "NY_CTR", To: "JFK_APP", Callsign: "AAL123", Accepted: true},
+	} {
+		p, err := ParsePacket(MakeHandoff(h).String())
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if got, err := ParseHandoff(p); err != nil {
+			t.Errorf("unexpected error %v", err)
+		} else if got != h {
+			t.Errorf("got %+v, expected %+v", got, h)
+		}
+	}
+}
+
+func TestATCPosition(t *testing.T) {
+	atc := ATC{Callsign: "JFK_APP", Frequency: av.NewFrequency(127.4), Facility: FacilityApproach,
+		VisibilityRange: 150, Rating: 5}
+	p, err := MakeATCPosition(atc)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if p.field(1) != "27400" {
+		t.Errorf("got frequency %q, expected 27400", p.field(1))
+	}
+
+	atc.Frequency = av.NewFrequency(99.5)
+	if _, err := MakeATCPosition(atc); err != ErrInvalidFrequency {
+		t.Errorf("expected ErrInvalidFrequency, got %v", err)
+	}
+}
+
+func TestCloseWhileConnecting(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Skipf("unable to listen: %v", err)
+	}
+	defer l.Close()
+
+	lg := &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	c := Connect(Config{Server: l.Addr().String()}, nil, lg)
+	c.Close()
+
+	// However the dial and Close were ordered, the server's end of the
+	// connection should see it closed.
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	if c.Err() != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", c.Err())
+	}
+}
@@ -0,0 +1,326 @@
+// pkg/fsd/packet.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+// Package fsd implements the client side of the FSD protocol that is used
+// by VATSIM and other flight simulation networks, as a controller client.
+package fsd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Packets are lines of text: a prefix that gives the packet type followed
+// by colon-separated fields, the first two of which are generally the
+// sender and recipient.
+const (
+	AddATC           = "#AA"
+	DeleteATC        = "#DA"
+	AddPilot         = "#AP"
+	DeletePilot      = "#DP"
+	TextMessage      = "#TM"
+	ProControllerMsg = "#PC"
+	PilotPosition    = "@"
+	ATCPosition      = "%"
+	FlightPlan       = "$FP"
+	HandoffOffer     = "$HO"
+	HandoffAccept    = "$HA"
+	ServerIdentify   = "$DI"
+	ClientIdentify   = "$ID"
+	ClientQuery      = "$CQ"
+	ClientResponse   = "$CR"
+	Error            = "$ER"
+
+	// Used for authentication
+	serverChallenge   = "$ZC"
+	challengeResponse = "$ZR"
+)
+
+// The single-character position prefixes go last so that they're only
+// matched if nothing else does.
+var packetTypes = []string{AddATC, DeleteATC, AddPilot, DeletePilot, TextMessage, ProControllerMsg,
+	FlightPlan, HandoffOffer, HandoffAccept, ServerIdentify, ClientIdentify, ClientQuery, ClientResponse,
+	Error, serverChallenge, challengeResponse, PilotPosition, ATCPosition}
+
+var (
+	ErrUnknownPacket    = errors.New("Unknown packet type")
+	ErrMalformedPacket  = errors.New("Malformed packet")
+	ErrInvalidFrequency = errors.New("Invalid frequency")
+)
+
+type Packet struct {
+	Type   string
+	Fields []string
+}
+
+func ParsePacket(line string) (Packet, error) {
+	line = strings.TrimRight(line, "\r\n")
+	for _, t := range packetTypes {
+		if rest, ok := strings.CutPrefix(line, t); ok {
+			return Packet{Type: t, Fields: strings.Split(rest, ":")}, nil
+		}
+	}
+	return Packet{}, ErrUnknownPacket
+}
+
+// String returns the packet as it is sent, including the trailing
+// carriage return and line feed.
+func (p Packet) String() string {
+	return p.Type + strings.Join(p.Fields, ":") + "\r\n"
+}
+
+func (p Packet) field(i int) string {
+	if i < len(p.Fields) {
+		return p.Fields[i]
+	}
+	return ""
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Pilots
+
+// Pilot is the latest state of a pilot connected to the network.
+type Pilot struct {
+	Callsign   string
+	Squawk     av.Squawk
+	Mode       av.TransponderMode
+	Ident      bool
+	Position   math.Point2LL
+	Altitude   float32 // feet
+	GS         float32 // knots
+	Heading    float32 // true
+	OnGround   bool
+	FlightPlan *av.FlightPlan
+}
+
+// ParsePilotPosition parses a pilot position update:
+// @mode:callsign:squawk:rating:lat:lon:alt:gs:pbh:pressure-delta
+func ParsePilotPosition(p Packet) (Pilot, error) {
+	if p.Type != PilotPosition || len(p.Fields) < 9 {
+		return Pilot{}, ErrMalformedPacket
+	}
+
+	pilot := Pilot{Callsign: p.Fields[1]}
+	switch p.Fields[0] {
+	case "S":
+		pilot.Mode = av.Standby
+	case "Y":
+		pilot.Mode = av.Altitude
+		pilot.Ident = true
+	default:
+		pilot.Mode = av.Altitude
+	}
+
+	sq, err := av.ParseSquawk(p.Fields[2])
+	if err != nil {
+		return Pilot{}, err
+	}
+	pilot.Squawk = sq
+
+	var f [4]float64
+	for i, s := range []string{p.Fields[4], p.Fields[5], p.Fields[6], p.Fields[7]} {
+		if f[i], err = strconv.ParseFloat(s, 32); err != nil {
+			return Pilot{}, ErrMalformedPacket
+		}
+	}
+	pilot.Position = math.Point2LL{float32(f[1]), float32(f[0])}
+	pilot.Altitude, pilot.GS = float32(f[2]), float32(f[3])
+
+	pbh, err := strconv.ParseInt(p.Fields[8], 10, 64)
+	if err != nil {
+		return Pilot{}, ErrMalformedPacket
+	}
+	pilot.Heading, pilot.OnGround = decodePBH(uint32(pbh))
+
+	return pilot, nil
+}
+
+// Pitch, bank, and heading are packed into 32 bits: 10 each, with the
+// heading in units of 360/1024 degrees in bits 2-11 and the on-ground
+// flag in bit 1.
+func decodePBH(pbh uint32) (heading float32, onGround bool) {
+	heading = float32((pbh>>2)&0x3ff) * 360 / 1024
+	return math.NormalizeHeading(heading), pbh&2 != 0
+}
+
+func encodePBH(heading float32, onGround bool) uint32 {
+	v := (uint32(math.NormalizeHeading(heading)*1024/360) & 0x3ff) << 2
+	if onGround {
+		v |= 2
+	}
+	return v
+}
+
+// MakePilotPosition returns the position packet for the given pilot; it
+// is mostly useful for testing.
+func MakePilotPosition(p Pilot) Packet {
+	mode := util.Select(p.Mode == av.Standby, "S", util.Select(p.Ident, "Y", "N"))
+	return Packet{Type: PilotPosition, Fields: []string{mode, p.Callsign, p.Squawk.String(), "1",
+		strconv.FormatFloat(float64(p.Position[1]), 'f', 5, 32),
+		strconv.FormatFloat(float64(p.Position[0]), 'f', 5, 32),
+		strconv.Itoa(int(p.Altitude)), strconv.Itoa(int(p.GS)),
+		strconv.FormatUint(uint64(encodePBH(p.Heading, p.OnGround)), 10), "0"}}
+}
+
+// ParseFlightPlan parses a filed flight plan:
+// $FPcallsign:recipient:rules:type:tas:dep:deptime:actdeptime:alt:dest:
+// hrs:min:fuelhrs:fuelmin:alternate:remarks:route
+func ParseFlightPlan(p Packet) (*av.FlightPlan, error) {
+	if p.Type != FlightPlan || len(p.Fields) < 17 {
+		return nil, ErrMalformedPacket
+	}
+
+	atoi := func(i int) int {
+		v, _ := strconv.Atoi(strings.TrimSpace(p.Fields[i]))
+		return v
+	}
+	fp := &av.FlightPlan{
+		Callsign:         p.Fields[0],
+		Rules:            parseRules(p.Fields[2]),
+		AircraftType:     p.Fields[3],
+		CruiseSpeed:      atoi(4),
+		DepartureAirport: p.Fields[5],
+		DepartTimeEst:    atoi(6),
+		DepartTimeActual: atoi(7),
+		Altitude:         parseFlightPlanAltitude(p.Fields[8]),
+		ArrivalAirport:   p.Fields[9],
+		Hours:            atoi(10),
+		Minutes:          atoi(11),
+		FuelHours:        atoi(12),
+		FuelMinutes:      atoi(13),
+		AlternateAirport: p.Fields[14],
+		Remarks:          p.Fields[15],
+		Route:            strings.Join(p.Fields[16:], ":"),
+	}
+
+	// Newer clients file the aircraft in ICAO form, e.g.
+	// "B738/M-SDE2E3FGIJ1RWY/LB1".
+	if item9, item10, ok := strings.Cut(fp.AircraftType, "-"); ok {
+		if err := fp.SetICAOAircraft(item9, item10); err != nil {
+			return nil, err
+		}
+	}
+	return fp, nil
+}
+
+func parseRules(s string) av.FlightRules {
+	if s == "V" {
+		return av.VFR
+	}
+	return av.IFR
+}
+
+// Altitudes may be given as feet or as a flight level.
+func parseFlightPlanAltitude(s string) int {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if fl, ok := strings.CutPrefix(s, "FL"); ok {
+		v, _ := strconv.Atoi(fl)
+		return 100 * v
+	}
+	v, _ := strconv.Atoi(s)
+	return v
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Controllers
+
+// Facility types used in ATC position updates.
+const (
+	FacilityObserver = iota
+	FacilityFSS
+	FacilityDelivery
+	FacilityGround
+	FacilityTower
+	FacilityApproach
+	FacilityCenter
+)
+
+// ATC is the information used to log in as a controller and that is sent
+// in position updates.
+type ATC struct {
+	Callsign        string
+	RealName        string
+	CID             string
+	Password        string
+	Rating          int
+	Facility        int
+	Frequency       av.Frequency
+	VisibilityRange int // nm
+	Location        math.Point2LL
+}
+
+// Frequencies are sent without the leading 1 and decimal point, e.g.
+// "27850" for 127.850.
+func encodeFrequency(f av.Frequency) (string, error) {
+	if f < 118000 || f >= 137000 {
+		return "", ErrInvalidFrequency
+	}
+	return strconv.Itoa(int(f) - 100000), nil
+}
+
+func MakeAddATC(atc ATC, protocol int) Packet {
+	return Packet{Type: AddATC, Fields: []string{atc.Callsign, "SERVER", atc.RealName, atc.CID, atc.Password,
+		strconv.Itoa(atc.Rating), strconv.Itoa(protocol)}}
+}
+
+func MakeDeleteATC(atc ATC) Packet {
+	return Packet{Type: DeleteATC, Fields: []string{atc.Callsign, atc.CID}}
+}
+
+func MakeATCPosition(atc ATC) (Packet, error) {
+	freq, err := encodeFrequency(atc.Frequency)
+	if err != nil {
+		return Packet{}, err
+	}
+	return Packet{Type: ATCPosition, Fields: []string{atc.Callsign, freq, strconv.Itoa(atc.Facility),
+		strconv.Itoa(atc.VisibilityRange), strconv.Itoa(atc.Rating),
+		strconv.FormatFloat(float64(atc.Location[1]), 'f', 5, 32),
+		strconv.FormatFloat(float64(atc.Location[0]), 'f', 5, 32), "0"}}, nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Handoffs
+
+// Handoff is a handoff offer or acceptance between two controllers.
+type Handoff struct {
+	From, To string
+	Callsign string
+	Accepted bool // false for offers
+}
+
+func ParseHandoff(p Packet) (Handoff, error) {
+	if (p.Type != HandoffOffer && p.Type != HandoffAccept) || len(p.Fields) < 3 {
+		return Handoff{}, ErrMalformedPacket
+	}
+	return Handoff{From: p.Fields[0], To: p.Fields[1], Callsign: p.Fields[2], Accepted: p.Type == HandoffAccept}, nil
+}
+
+func MakeHandoff(h Handoff) Packet {
+	return Packet{Type: util.Select(h.Accepted, HandoffAccept, HandoffOffer), Fields: []string{h.From, h.To, h.Callsign}}
+}
+
+// ServerError is an error reported by the server.
+type ServerError struct {
+	Code    int
+	Message string
+}
+
+func (e ServerError) Error() string {
+	return fmt.Sprintf("server error %d: %s", e.Code, e.Message)
+}
+
+// Codes of server errors that are fatal for the connection.
+var fatalErrorCodes = []int{1 /* callsign in use */, 2 /* invalid callsign */, 4, /* invalid CID/password */
+	5 /* protocol version */, 6 /* rating too low */, 9 /* suspended */}
+
+func ParseServerError(p Packet) ServerError {
+	code, _ := strconv.Atoi(p.field(2))
+	return ServerError{Code: code, Message: p.field(4)}
+}
@@ -0,0 +1,197 @@
+// pkg/log/crash.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package log
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// When vice crashes, CatchAndReportCrash saves a bug report bundle--a
+// zip file with the panic and its stack trace, the most recent log
+// messages, and dumps of whatever state has been registered with
+// RegisterCrashState--that the user can attach to an issue. This gives
+// far more to go on than the stack trace alone.
+
+const (
+	// The server writes at most ServerCrashBundleBurst crash bundles in
+	// each ServerCrashBundleInterval; the crash report is still logged
+	// and sent to the crash report server for the rest.
+	ServerCrashBundleBurst    = 5
+	ServerCrashBundleInterval = time.Hour
+)
+
+var errCrashBundleLimit = errors.New("crash bundle limit reached")
+
+// crashLogRecords is the number of recent log records that are kept for
+// crash reports.
+const crashLogRecords = 1000
+
+// recentLog is an io.Writer that keeps the most recent log records that
+// were written to it.
+type recentLog struct {
+	mu      sync.Mutex
+	records [][]byte
+	next    int
+}
+
+func (r *recentLog) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The slog handler writes a single record with each call to Write.
+	rec := slices.Clone(p)
+	if len(r.records) < crashLogRecords {
+		r.records = append(r.records, rec)
+	} else {
+		r.records[r.next] = rec
+		r.next = (r.next + 1) % crashLogRecords
+	}
+	return len(p), nil
+}
+
+// Bytes returns the saved records, oldest first.
+func (r *recentLog) Bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b []byte
+	for i := range r.records {
+		b = append(b, r.records[(r.next+i)%len(r.records)]...)
+	}
+	return b
+}
+
+// CrashStateFunc returns a dump of some part of the system's state for a
+// crash report. It is called after a panic has been recovered, so it
+// shouldn't wait on locks, as the code that crashed may have held them.
+type CrashStateFunc func() ([]byte, error)
+
+// RegisterCrashState registers a function that provides state to be
+// included in crash reports under the given name. The registration is
+// shared with all of the Loggers derived from this one. The returned
+// function removes it.
+func (l *Logger) RegisterCrashState(name string, f CrashStateFunc) func() {
+	if l == nil || l.state == nil {
+		return func() {}
+	}
+
+	s := l.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.crashState == nil {
+		s.crashState = make(map[string]CrashStateFunc)
+	}
+	s.crashState[name] = f
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.crashState, name)
+	}
+}
+
+// RecentLogs returns the most recent log records.
+func (l *Logger) RecentLogs() []byte {
+	if l == nil || l.state == nil || l.state.recent == nil {
+		return nil
+	}
+	return l.state.recent.Bytes()
+}
+
+// writeCrashBundle writes a bug report bundle with the given crash report
+// to the log directory and returns its path.
+func (l *Logger) writeCrashBundle(report string) (string, error) {
+	if l.state != nil && l.state.bundleLimiter != nil {
+		if ok, _ := l.state.bundleLimiter.Allow("crash"); !ok {
+			return "", errCrashBundleLimit
+		}
+	}
+
+	f, err := createCrashBundle(l.LogDir, time.Now())
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fn := f.Name()
+
+	zw := zip.NewWriter(f)
+	add := func(name string, b []byte) error {
+		w, err := zw.Create(name)
+		if err == nil {
+			_, err = w.Write(b)
+		}
+		return err
+	}
+
+	if err := add("report.txt", []byte(report)); err != nil {
+		return "", err
+	}
+	if err := add("log.json", l.RecentLogs()); err != nil {
+		return "", err
+	}
+
+	var crashState map[string]CrashStateFunc
+	if l.state != nil {
+		l.state.mu.Lock()
+		crashState = maps.Clone(l.state.crashState)
+		l.state.mu.Unlock()
+	}
+
+	var errs string
+	for _, name := range slices.Sorted(maps.Keys(crashState)) {
+		if b, err := dumpCrashState(crashState[name]); err != nil {
+			errs += fmt.Sprintf("%s: %v\n", name, err)
+		} else if err := add(name+".json", b); err != nil {
+			return "", err
+		}
+	}
+	if errs != "" {
+		if err := add("state-errors.txt", []byte(errs)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return fn, nil
+}
+
+// createCrashBundle creates a new crash bundle file in dir, named using
+// the given time. An existing bundle is never overwritten; crashes in the
+// same second get a numeric suffix.
+func createCrashBundle(dir string, t time.Time) (*os.File, error) {
+	base := filepath.Join(dir, "crash-"+t.Format("2006-01-02T150405"))
+	for i := 0; ; i++ {
+		fn := base + ".zip"
+		if i > 0 {
+			fn = fmt.Sprintf("%s-%d.zip", base, i)
+		}
+		f, err := os.OpenFile(fn, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+// dumpCrashState calls f, turning a panic into an error; state that was
+// involved in a crash may well be inconsistent.
+func dumpCrashState(f CrashStateFunc) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return f()
+}
@@ -5,6 +5,7 @@
 package log
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -29,8 +30,18 @@ type Logger struct {
 	LogFile string
 	LogDir  string
 	Start   time.Time
+
+	subsystem string
+	// fields records the attributes given to With() so that they can be
+	// included in the rate limiting key.
+	fields string
+	state  *logState
 }
 
+// New returns a new Logger. level may either be a single log level
+// ("debug", "info", "warn", or "error") or a comma-separated list that
+// also specifies levels for individual subsystems, e.g.
+// "info,eram=debug,stars=warn".
 func New(server bool, level string, dir string) *Logger {
 	if dir == "" {
 		if server {
@@ -65,26 +76,26 @@ func New(server bool, level string, dir string) *Logger {
 		}
 	}
 
-	lvl := slog.LevelInfo
-	switch level {
-	case "debug":
-		lvl = slog.LevelDebug
-	case "info":
-		lvl = slog.LevelInfo
-	case "warn":
-		lvl = slog.LevelWarn
-	case "error":
-		lvl = slog.LevelError
-	default:
-		fmt.Fprintf(os.Stderr, "%s: invalid log level", level)
+	lvl, subsystemLevels, err := parseLevels(level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	state := makeLogState(lvl)
+	for sub, l := range subsystemLevels {
+		state.setLevel(sub, l)
+	}
+	if server {
+		bl := makeRateLimiter(ServerCrashBundleBurst, ServerCrashBundleInterval)
+		state.bundleLimiter = &bl
 	}
 
-	h := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})
+	h := slog.NewJSONHandler(io.MultiWriter(w, state.recent), &slog.HandlerOptions{Level: &state.handlerLevel})
 	l := &Logger{
 		Logger:  slog.New(h),
 		LogFile: w.Filename,
 		LogDir:  dir,
 		Start:   time.Now(),
+		state:   state,
 	}
 
 	// Start out the logs with some basic information about the system
@@ -129,36 +140,56 @@ func New(server bool, level string, dir string) *Logger {
 // We also wrap the logging methods to allow a nil *Logger, in which case
 // debug and info messages are discarded (though warnings and errors still
 // go through to slog.)
+//
+// Messages are filtered according to the Logger's subsystem's log level
+// and repeated non-error messages are rate limited; see RateLimitBurst.
 func (l *Logger) Debug(msg string, args ...any) {
-	if l != nil && l.Logger.Enabled(nil, slog.LevelDebug) {
-		args = append([]any{slog.Any("callstack", Callstack(nil))}, args...)
-		l.Logger.Debug(msg, args...)
+	if l.enabled(slog.LevelDebug) {
+		if ok, extra := l.limit(msg, args); ok {
+			args = append([]any{slog.Any("callstack", Callstack(nil))}, append(args, extra...)...)
+			l.Logger.Debug(msg, args...)
+		}
 	}
 }
 
 // Debugf is a convenience wrapper that logs just a message and allows
 // printf-style formatting of the provided args.
 func (l *Logger) Debugf(msg string, args ...any) {
-	if l != nil && l.Logger.Enabled(nil, slog.LevelDebug) {
-		l.Logger.Debug(fmt.Sprintf(msg, args...), slog.Any("callstack", Callstack(nil)))
+	if l.enabled(slog.LevelDebug) {
+		msg = fmt.Sprintf(msg, args...)
+		if ok, extra := l.limit(msg, nil); ok {
+			l.Logger.Debug(msg, append([]any{slog.Any("callstack", Callstack(nil))}, extra...)...)
+		}
 	}
 }
 
 func (l *Logger) Info(msg string, args ...any) {
-	if l != nil && l.Logger.Enabled(nil, slog.LevelInfo) {
-		args = append([]any{slog.Any("callstack", Callstack(nil))}, args...)
-		l.Logger.Info(msg, args...)
+	if l.enabled(slog.LevelInfo) {
+		if ok, extra := l.limit(msg, args); ok {
+			args = append([]any{slog.Any("callstack", Callstack(nil))}, append(args, extra...)...)
+			l.Logger.Info(msg, args...)
+		}
 	}
 }
 
 func (l *Logger) Infof(msg string, args ...any) {
-	if l != nil && l.Logger.Enabled(nil, slog.LevelInfo) {
-		l.Logger.Info(fmt.Sprintf(msg, args...), slog.Any("callstack", Callstack(nil)))
+	if l.enabled(slog.LevelInfo) {
+		msg = fmt.Sprintf(msg, args...)
+		if ok, extra := l.limit(msg, nil); ok {
+			l.Logger.Info(msg, append([]any{slog.Any("callstack", Callstack(nil))}, extra...)...)
+		}
 	}
 }
 
 func (l *Logger) Warn(msg string, args ...any) {
-	args = append([]any{slog.Any("callstack", Callstack(nil))}, args...)
+	if !l.enabled(slog.LevelWarn) {
+		return
+	}
+	ok, extra := l.limit(msg, args)
+	if !ok {
+		return
+	}
+	args = append([]any{slog.Any("callstack", Callstack(nil))}, append(args, extra...)...)
 	if l == nil {
 		slog.Warn(msg, args...)
 	} else {
@@ -167,10 +198,19 @@ func (l *Logger) Warn(msg string, args ...any) {
 }
 
 func (l *Logger) Warnf(msg string, args ...any) {
+	if !l.enabled(slog.LevelWarn) {
+		return
+	}
+	msg = fmt.Sprintf(msg, args...)
+	ok, extra := l.limit(msg, nil)
+	if !ok {
+		return
+	}
+	args = append([]any{slog.Any("callstack", Callstack(nil))}, extra...)
 	if l == nil {
-		slog.Warn(fmt.Sprintf(msg, args...), slog.Any("callstack", Callstack(nil)))
+		slog.Warn(msg, args...)
 	} else {
-		l.Logger.Warn(fmt.Sprintf(msg, args...), slog.Any("callstack", Callstack(nil)))
+		l.Logger.Warn(msg, args...)
 	}
 }
 
@@ -183,17 +223,26 @@ func (l *Logger) Error(msg string, args ...any) {
 }
 
 func (l *Logger) Errorf(msg string, args ...any) {
-	slog.Error(fmt.Sprintf(msg, args...), slog.Any("callstack", Callstack(nil)))
+	msg = fmt.Sprintf(msg, args...)
+	args = []any{slog.Any("callstack", Callstack(nil))}
+	slog.Error(msg, args...)
 	if l != nil {
-		l.Logger.Error(fmt.Sprintf(msg, args...), slog.Any("callstack", Callstack(nil)))
+		l.Logger.Error(msg, args...)
 	}
 }
 
 func (l *Logger) With(args ...any) *Logger {
+	if l == nil {
+		return nil
+	}
 	return &Logger{
-		Logger:  l.Logger.With(args...),
-		LogFile: l.LogFile,
-		Start:   l.Start,
+		Logger:    l.Logger.With(args...),
+		LogFile:   l.LogFile,
+		LogDir:    l.LogDir,
+		Start:     l.Start,
+		subsystem: l.subsystem,
+		fields:    l.fields + fmt.Sprint(args...) + "\x00",
+		state:     l.state,
 	}
 }
 
@@ -221,9 +270,16 @@ func (l *Logger) CatchAndReportCrash() any {
 		// Print it to stdout
 		fmt.Println(report)
 
-		// Try to save it to disk locally
-		fn := filepath.Join(l.LogDir, "crash-"+time.Now().Format(time.RFC3339)+".txt")
-		_ = os.WriteFile(fn, []byte(report), 0o600)
+		// Try to save it to disk locally, along with the recent logs
+		// and the state of things.
+		if fn, err := l.writeCrashBundle(report); err == nil {
+			fmt.Printf("A bug report has been saved to %s; please attach it when reporting this crash at "+
+				"https://github.com/mmp/vice/issues.\n", fn)
+		} else if !errors.Is(err, errCrashBundleLimit) {
+			l.Errorf("%v: unable to write crash report bundle", err)
+			fn := filepath.Join(l.LogDir, "crash-"+time.Now().Format(time.RFC3339)+".txt")
+			_ = os.WriteFile(fn, []byte(report), 0o600)
+		}
 
 		// And pass it along to the crash report server.
 		l.postCrashReport(report)
@@ -0,0 +1,228 @@
+// pkg/log/log_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package log
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLevels(t *testing.T) {
+	def, levels, err := parseLevels("warn, ERAM=debug,stars=error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def != slog.LevelWarn || levels["eram"] != slog.LevelDebug || levels["stars"] != slog.LevelError {
+		t.Errorf("got default %v, subsystem levels %v", def, levels)
+	}
+
+	if _, _, err := parseLevels("info,eram=loud"); err == nil {
+		t.Errorf("expected error for invalid subsystem level")
+	}
+
+	s := makeLogState(def)
+	for sub, l := range levels {
+		s.setLevel(sub, l)
+	}
+	if s.handlerLevel.Level() != slog.LevelDebug {
+		t.Errorf("handler level %v; expected debug", s.handlerLevel.Level())
+	}
+	if s.level("stars") != slog.LevelError || s.level("sim") != slog.LevelWarn {
+		t.Errorf("incorrect subsystem levels")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	r := makeRateLimiter(3, time.Minute)
+	r.now = func() time.Time { return now }
+
+	for i := range 10 {
+		ok, suppressed := r.Allow("storm")
+		if ok != (i < 3) || suppressed != 0 {
+			t.Errorf("%d: got %v/%d", i, ok, suppressed)
+		}
+	}
+	if ok, _ := r.Allow("other"); !ok {
+		t.Errorf("unrelated message was limited")
+	}
+
+	now = now.Add(time.Minute)
+	if ok, suppressed := r.Allow("storm"); !ok || suppressed != 7 {
+		t.Errorf("after interval got %v/%d; expected true/7", ok, suppressed)
+	}
+}
+
+func TestRecentLog(t *testing.T) {
+	var r recentLog
+	for i := range crashLogRecords + 10 {
+		fmt.Fprintf(&r, "%d\n", i)
+	}
+	lines := strings.Split(strings.TrimSpace(string(r.Bytes())), "\n")
+	if len(lines) != crashLogRecords || lines[0] != "10" || lines[len(lines)-1] != fmt.Sprint(crashLogRecords+9) {
+		t.Errorf("got %d records from %s to %s", len(lines), lines[0], lines[len(lines)-1])
+	}
+}
+
+func TestCrashBundle(t *testing.T) {
+	l := New(false, "info", t.TempDir())
+	l.Info("about to crash")
+	l.RegisterCrashState("good", func() ([]byte, error) { return []byte(`{"squawk": 0}`), nil })
+	l.RegisterCrashState("bad", func() ([]byte, error) { panic("zero squawk") })
+	unregister := l.RegisterCrashState("gone", func() ([]byte, error) { return nil, nil })
+	unregister()
+
+	fn, err := l.writeCrashBundle("Crashed: zero squawk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(r)
+		r.Close()
+		contents[f.Name] = string(b)
+	}
+
+	if contents["report.txt"] != "Crashed: zero squawk" {
+		t.Errorf("report.txt: got %q", contents["report.txt"])
+	}
+	if !strings.Contains(contents["log.json"], "about to crash") {
+		t.Errorf("log.json doesn't have the recent log message")
+	}
+	if contents["good.json"] != `{"squawk": 0}` {
+		t.Errorf("good.json: got %q", contents["good.json"])
+	}
+	if !strings.Contains(contents["state-errors.txt"], "bad: panic: zero squawk") {
+		t.Errorf("state-errors.txt: got %q", contents["state-errors.txt"])
+	}
+	if _, ok := contents["gone.json"]; ok {
+		t.Errorf("unregistered state was included")
+	}
+}
+
+type countingHandler struct {
+	n *int
+}
+
+func (h countingHandler) Enabled(context.Context, slog.Level) bool  { return true }
+func (h countingHandler) Handle(context.Context, slog.Record) error { *h.n++; return nil }
+func (h countingHandler) WithAttrs([]slog.Attr) slog.Handler        { return h }
+func (h countingHandler) WithGroup(string) slog.Handler             { return h }
+
+func TestRateLimitKeys(t *testing.T) {
+	n := 0
+	l := &Logger{Logger: slog.New(countingHandler{n: &n}), state: makeLogState(slog.LevelDebug)}
+
+	// Messages that differ in their attributes or in the fields given to
+	// With() aren't repeats.
+	for i := range 3 * RateLimitBurst {
+		l.Info("dispatch_command", fmt.Sprintf("key%d", i), 1)
+		l.WithFlight("", fmt.Sprintf("AAL%d", i)).Warn("handoff")
+	}
+	if n != 6*RateLimitBurst {
+		t.Errorf("got %d messages, expected %d", n, 6*RateLimitBurst)
+	}
+
+	// The same message for two different flights isn't limited against
+	// the other flight's.
+	n = 0
+	for range 3 * RateLimitBurst {
+		l.Info("deleted aircraft", slog.String("callsign", "AAL1"))
+		l.Info("deleted aircraft", slog.String("callsign", "UAL2"))
+	}
+	if n != 2*RateLimitBurst {
+		t.Errorf("got %d messages for two flights, expected %d", n, 2*RateLimitBurst)
+	}
+
+	// Identical messages are.
+	n = 0
+	for range 3 * RateLimitBurst {
+		l.Info("storm", slog.Int("i", 1))
+	}
+	if n != RateLimitBurst {
+		t.Errorf("got %d repeated messages, expected %d", n, RateLimitBurst)
+	}
+
+	// Errors are never suppressed.
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	n = 0
+	for range 3 * RateLimitBurst {
+		l.Error("disaster")
+	}
+	if n != 3*RateLimitBurst {
+		t.Errorf("got %d errors, expected %d", n, 3*RateLimitBurst)
+	}
+}
+
+func TestCrashBundleNames(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var names []string
+	for range 3 {
+		f, err := createCrashBundle(dir, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, filepath.Base(f.Name()))
+		f.Close()
+	}
+
+	expected := []string{"crash-2024-06-01T120000.zip", "crash-2024-06-01T120000-1.zip", "crash-2024-06-01T120000-2.zip"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("got %v, expected %v", names, expected)
+	}
+}
+
+func TestServerCrashBundleLimit(t *testing.T) {
+	// Set up the limiter the way New does for the server without
+	// launching the crash report server.
+	l := New(false, "info", t.TempDir())
+	bl := makeRateLimiter(ServerCrashBundleBurst, ServerCrashBundleInterval)
+	l.state.bundleLimiter = &bl
+
+	for i := range ServerCrashBundleBurst + 2 {
+		_, err := l.writeCrashBundle("Crashed")
+		if i < ServerCrashBundleBurst && err != nil {
+			t.Errorf("bundle %d: unexpected error %v", i, err)
+		} else if i >= ServerCrashBundleBurst && !errors.Is(err, errCrashBundleLimit) {
+			t.Errorf("bundle %d: got %v, expected %v", i, err, errCrashBundleLimit)
+		}
+	}
+
+	bundles, _ := filepath.Glob(filepath.Join(l.LogDir, "crash-*.zip"))
+	if len(bundles) != ServerCrashBundleBurst {
+		t.Errorf("got %d bundles, expected %d", len(bundles), ServerCrashBundleBurst)
+	}
+}
+
+func TestLoggerWithoutState(t *testing.T) {
+	// Loggers that weren't created with New() shouldn't crash.
+	l := &Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil)), LogDir: t.TempDir()}
+	l.RegisterCrashState("sim", func() ([]byte, error) { return nil, nil })()
+	if _, err := l.writeCrashBundle("Crashed"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+// pkg/log/subsystem.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package log
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logging state that is shared by a Logger and all of the Loggers derived
+// from it via With() and Subsystem().
+type logState struct {
+	mu sync.Mutex
+
+	// Per-subsystem log levels; subsystems that aren't present use the
+	// default level.
+	defaultLevel slog.Level
+	levels       map[string]slog.Level
+	// handlerLevel is the minimum of all of the levels; it's what's given
+	// to the slog.Handler so that it doesn't discard messages from
+	// subsystems with more verbose logging than the default.
+	handlerLevel slog.LevelVar
+
+	limiter rateLimiter
+
+	// For crash reports; see crash.go.
+	recent     *recentLog
+	crashState map[string]CrashStateFunc
+	// bundleLimiter limits how many crash bundles are written; it is only
+	// set for the server, where panics in many sims could otherwise fill
+	// the disk.
+	bundleLimiter *rateLimiter
+}
+
+func makeLogState(level slog.Level) *logState {
+	s := &logState{
+		defaultLevel: level,
+		levels:       make(map[string]slog.Level),
+		limiter:      makeRateLimiter(RateLimitBurst, RateLimitInterval),
+		recent:       &recentLog{},
+	}
+	s.handlerLevel.Set(level)
+	return s
+}
+
+func (s *logState) level(subsystem string) slog.Level {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lvl, ok := s.levels[subsystem]; ok && subsystem != "" {
+		return lvl
+	}
+	return s.defaultLevel
+}
+
+func (s *logState) setLevel(subsystem string, lvl slog.Level) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if subsystem == "" {
+		s.defaultLevel = lvl
+	} else {
+		s.levels[subsystem] = lvl
+	}
+
+	hl := s.defaultLevel
+	for _, l := range s.levels {
+		hl = min(hl, l)
+	}
+	s.handlerLevel.Set(hl)
+}
+
+// parseLevel converts a level name as given on the command line to a
+// slog.Level.
+func parseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("%s: invalid log level", level)
+	}
+}
+
+// parseLevels parses a log level specification of the form
+// "info,eram=debug,stars=warn": an optional default level followed by
+// per-subsystem levels.
+func parseLevels(spec string) (slog.Level, map[string]slog.Level, error) {
+	def, levels := slog.LevelInfo, make(map[string]slog.Level)
+	for _, f := range strings.Split(spec, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		if sub, lvl, ok := strings.Cut(f, "="); ok {
+			l, err := parseLevel(lvl)
+			if err != nil {
+				return def, levels, err
+			}
+			levels[strings.ToLower(strings.TrimSpace(sub))] = l
+		} else {
+			l, err := parseLevel(f)
+			if err != nil {
+				return def, levels, err
+			}
+			def = l
+		}
+	}
+	return def, levels, nil
+}
+
+// Subsystem returns a Logger for the named subsystem (e.g., "eram",
+// "stars"); its messages include a "subsystem" attribute and it uses the
+// subsystem's log level, if one has been set.
+func (l *Logger) Subsystem(name string) *Logger {
+	if l == nil {
+		return nil
+	}
+	name = strings.ToLower(name)
+	nl := l.With(slog.String("subsystem", name))
+	nl.subsystem = name
+	return nl
+}
+
+// SetLevel sets the log level for the given subsystem, or the default
+// level if subsystem is empty.
+func (l *Logger) SetLevel(subsystem string, level string) error {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	} else if l.state == nil {
+		return errors.New("Logger was not created with New()")
+	}
+	l.state.setLevel(strings.ToLower(subsystem), lvl)
+	return nil
+}
+
+func (l *Logger) enabled(level slog.Level) bool {
+	if l == nil {
+		return level >= slog.LevelWarn
+	} else if l.state == nil {
+		return l.Logger.Enabled(nil, level)
+	}
+	return level >= l.state.level(l.subsystem)
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Rate limiting
+
+var (
+	// At most RateLimitBurst identical messages are logged in each
+	// RateLimitInterval; beyond that they are counted and the count is
+	// reported with the next one that is logged. Errors are never rate
+	// limited.
+	RateLimitBurst    = 10
+	RateLimitInterval = 10 * time.Second
+)
+
+type rateLimiter struct {
+	mu       sync.Mutex
+	burst    int
+	interval time.Duration
+	entries  map[string]*rateLimitEntry
+	now      func() time.Time // for testing
+}
+
+type rateLimitEntry struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+func makeRateLimiter(burst int, interval time.Duration) rateLimiter {
+	return rateLimiter{
+		burst:    burst,
+		interval: interval,
+		entries:  make(map[string]*rateLimitEntry),
+		now:      time.Now,
+	}
+}
+
+// Allow reports whether a message with the given key should be logged.
+// If so, it also returns the number of times the message has been
+// suppressed since the last time it was logged.
+func (r *rateLimiter) Allow(key string) (bool, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	e, ok := r.entries[key]
+	if !ok || now.Sub(e.start) >= r.interval {
+		suppressed := 0
+		if ok {
+			suppressed = e.suppressed
+		}
+		if len(r.entries) > 4096 {
+			r.prune(now)
+		}
+		r.entries[key] = &rateLimitEntry{start: now, count: 1}
+		return true, suppressed
+	}
+
+	if e.count < r.burst {
+		e.count++
+		return true, 0
+	}
+	e.suppressed++
+	return false, 0
+}
+
+func (r *rateLimiter) prune(now time.Time) {
+	for k, e := range r.entries {
+		if now.Sub(e.start) >= r.interval {
+			delete(r.entries, k)
+		}
+	}
+}
+
+// limit applies rate limiting to the given message. Messages are only
+// considered to be repeats if their subsystem, the attributes given to
+// With(), and the call's own attributes all match. limit returns false
+// if the message should be discarded; otherwise additional attributes to
+// include with the message are returned.
+func (l *Logger) limit(msg string, args []any) (bool, []any) {
+	if l == nil || l.state == nil {
+		return true, nil
+	}
+
+	key := l.subsystem + "\x00" + l.fields + msg + "\x00" + fmt.Sprint(args...)
+	ok, suppressed := l.state.limiter.Allow(key)
+	if ok && suppressed > 0 {
+		return true, []any{slog.Int("suppressed_repeats", suppressed)}
+	}
+	return ok, nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Structured fields
+
+// These provide consistent attribute keys for the things that are
+// commonly needed to track down the history of a single flight, e.g.
+// lg.With(log.Callsign(ac.Callsign), log.Beacon(ac.Squawk)).
+
+func Facility(f string) slog.Attr {
+	return slog.String("facility", f)
+}
+
+func Callsign(cs string) slog.Attr {
+	return slog.String("callsign", cs)
+}
+
+func Beacon(code fmt.Stringer) slog.Attr {
+	return slog.String("beacon", code.String())
+}
+
+// WithFlight returns a Logger that includes the given facility and
+// callsign with all of its messages. Either may be empty.
+func (l *Logger) WithFlight(facility, callsign string) *Logger {
+	if l == nil {
+		return nil
+	}
+	var args []any
+	if facility != "" {
+		args = append(args, Facility(facility))
+	}
+	if callsign != "" {
+		args = append(args, Callsign(callsign))
+	}
+	if len(args) == 0 {
+		return l
+	}
+	return l.With(args...)
+}
@@ -0,0 +1,763 @@
+// pkg/panes/adaptationeditor.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package panes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/platform"
+	"github.com/mmp/vice/pkg/renderer"
+	"github.com/mmp/vice/pkg/server"
+	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/util"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// AdaptationEditorPane edits the facility adaptation in a scenario group's
+// JSON file: STARS coordination fixes and beacon code blocks, CA inhibit
+// volumes, and airports' ATPA volumes and approach regions. Locations are
+// edited by dragging them on the map in the pane and everything else in
+// the settings window. Edits are applied to the file's contents with
+// util.PatchJSON so that everything else in it is left as it was.
+type AdaptationEditorPane struct {
+	ShowEditor bool
+	Filename   string
+
+	doc    []byte // file contents, with edits applied
+	adapt  *editorAdaptation
+	dirty  bool
+	status string
+
+	tracon, primaryAirport string
+	locate                 func(string) (math.Point2LL, bool)
+	nmPerLongitude         float32
+	magneticVariation      float32
+	center                 math.Point2LL
+	rangeNm                float32
+
+	selection adaptationSelection
+	dragging  bool
+	newFix    string
+
+	font *renderer.Font
+	lg   *log.Logger
+}
+
+// editorAdaptation holds the parts of the scenario group JSON that the
+// editor handles.
+type editorAdaptation struct {
+	Airports map[string]*struct {
+		ApproachRegions map[string]*av.ApproachRegion `json:"approach_regions"`
+		ATPAVolumes     map[string]*av.ATPAVolume     `json:"atpa_volumes"`
+	} `json:"airports"`
+	STARS struct {
+		CoordinationFixes map[string]av.AdaptationFixes `json:"coordination_fixes"`
+		BeaconBank        int                           `json:"beacon_bank"`
+		BeaconCodeBlocks  string                        `json:"beacon_code_blocks"`
+		InhibitCAVolumes  []av.AirspaceVolume           `json:"inhibit_ca_volumes"`
+		Center            string                        `json:"center"`
+		Range             float32                       `json:"range"`
+	} `json:"stars_config"`
+}
+
+// av.AdaptationFix has a Name member that isn't in the JSON, so we use
+// this when writing entire coordination fix lists.
+type editorAdaptationFix struct {
+	Type         string `json:"type"`
+	ToFacility   string `json:"to"`
+	FromFacility string `json:"from"`
+	Altitude     [2]int `json:"altitude"`
+}
+
+const (
+	selectNone = iota
+	selectATPAVolume
+	selectApproachRegion
+	selectCAVolume
+	selectCoordinationFix
+)
+
+type adaptationSelection struct {
+	kind    int
+	airport string
+	id      string // runway or fix
+	index   int    // CA volume
+	vertex  int    // CA volume polygon vertex; -1 for its center
+}
+
+var (
+	editorGeometryColor = renderer.RGB{.5, .7, .9}
+	editorSelectedColor = renderer.RGB{1, .85, .3}
+	editorFixColor      = renderer.RGB{.6, .9, .6}
+	editorRunwayColor   = renderer.RGB{.5, .5, .5}
+)
+
+func init() {
+	RegisterUnmarshalPane("AdaptationEditorPane", func(d []byte) (Pane, error) {
+		var p AdaptationEditorPane
+		err := json.Unmarshal(d, &p)
+		return &p, err
+	})
+}
+
+func NewAdaptationEditorPane() *AdaptationEditorPane {
+	return &AdaptationEditorPane{}
+}
+
+func (ae *AdaptationEditorPane) DisplayName() string { return "Adaptation Editor" }
+
+func (ae *AdaptationEditorPane) Hide() bool { return !ae.ShowEditor }
+
+func (ae *AdaptationEditorPane) Activate(r renderer.Renderer, p platform.Platform, eventStream *sim.EventStream, lg *log.Logger) {
+	ae.font = renderer.GetDefaultFont()
+	ae.lg = lg
+}
+
+func (ae *AdaptationEditorPane) LoadedSim(client *server.ControlClient, ss sim.State, pl platform.Platform, lg *log.Logger) {
+	ae.initializeSim(ss)
+}
+
+func (ae *AdaptationEditorPane) ResetSim(client *server.ControlClient, ss sim.State, pl platform.Platform, lg *log.Logger) {
+	ae.initializeSim(ss)
+}
+
+func (ae *AdaptationEditorPane) initializeSim(ss sim.State) {
+	ae.tracon, ae.primaryAirport = ss.TRACON, ss.PrimaryAirport
+	ae.locate = ss.Locate
+	ae.nmPerLongitude, ae.magneticVariation = ss.NmPerLongitude, ss.MagneticVariation
+	ae.center, ae.rangeNm = ss.GetInitialCenter(), ss.GetInitialRange()
+
+	ae.adapt, ae.doc, ae.dirty = nil, nil, false
+	ae.selection = adaptationSelection{}
+	if fn := findScenarioFile(ae.tracon, ae.primaryAirport); fn != "" {
+		ae.Filename = fn
+	}
+	if ae.ShowEditor && ae.Filename != "" {
+		ae.load()
+	}
+}
+
+// findScenarioFile returns the path to the scenario group file in the
+// resources directory for the given TRACON that includes the given
+// airport.
+func findScenarioFile(tracon, airport string) string {
+	dir := filepath.Join(util.GetResourcesDirectory(), "scenarios")
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, fn := range files {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			continue
+		}
+		var sg struct {
+			TRACON   string                     `json:"tracon"`
+			Airports map[string]json.RawMessage `json:"airports"`
+		}
+		if json.Unmarshal(b, &sg) == nil && sg.TRACON == tracon {
+			if _, ok := sg.Airports[airport]; ok {
+				return fn
+			}
+		}
+	}
+	return ""
+}
+
+func (ae *AdaptationEditorPane) load() {
+	b, err := os.ReadFile(ae.Filename)
+	if err != nil {
+		ae.status = err.Error()
+		return
+	}
+
+	var adapt editorAdaptation
+	if err := util.UnmarshalJSONBytes(b, &adapt); err != nil {
+		ae.status = err.Error()
+		return
+	}
+	for _, ap := range adapt.Airports {
+		for _, vol := range ap.ATPAVolumes {
+			if ae.locate != nil {
+				vol.Threshold, _ = ae.locate(vol.ThresholdString)
+			}
+		}
+	}
+	if p, ok := ae.locateFix(adapt.STARS.Center); ok {
+		ae.center = p
+	}
+	if adapt.STARS.Range != 0 {
+		ae.rangeNm = adapt.STARS.Range
+	}
+
+	ae.adapt, ae.doc, ae.dirty = &adapt, b, false
+	ae.selection = adaptationSelection{}
+	ae.status = "Loaded " + ae.Filename
+}
+
+func (ae *AdaptationEditorPane) save() {
+	if err := os.WriteFile(ae.Filename, ae.doc, 0o644); err != nil {
+		ae.status = err.Error()
+	} else {
+		ae.dirty = false
+		ae.status = "Saved " + ae.Filename
+	}
+}
+
+// patch sets the value at the given path in the JSON document.
+func (ae *AdaptationEditorPane) patch(value interface{}, path ...interface{}) {
+	if b, err := util.PatchJSON(ae.doc, path, value); err != nil {
+		ae.status = err.Error()
+		ae.lg.Warnf("adaptation editor: %v", err)
+	} else {
+		ae.doc, ae.dirty = b, true
+	}
+}
+
+func (ae *AdaptationEditorPane) CanTakeKeyboardFocus() bool { return false }
+
+///////////////////////////////////////////////////////////////////////////
+// Settings UI
+
+func (ae *AdaptationEditorPane) DrawUI(p platform.Platform, config *platform.Config) {
+	imgui.Checkbox("Show adaptation editor", &ae.ShowEditor)
+	if !ae.ShowEditor {
+		return
+	}
+
+	imgui.InputTextV("Scenario file", &ae.Filename, 0, nil)
+	if imgui.Button("Load") {
+		ae.load()
+	}
+	if ae.adapt != nil {
+		imgui.SameLine()
+		uiStartDisable(!ae.dirty)
+		if imgui.Button("Save") {
+			ae.save()
+		}
+		imgui.SameLine()
+		if imgui.Button("Revert") {
+			ae.load()
+		}
+		uiEndDisable(!ae.dirty)
+	}
+	if ae.status != "" {
+		imgui.Text(ae.status)
+	}
+	if ae.adapt == nil {
+		return
+	}
+
+	if imgui.CollapsingHeader("Beacon codes") {
+		bank := int32(ae.adapt.STARS.BeaconBank)
+		if imgui.InputIntV("Beacon bank", &bank, 1, 1, 0) {
+			ae.adapt.STARS.BeaconBank = int(bank)
+			ae.patch(ae.adapt.STARS.BeaconBank, "stars_config", "beacon_bank")
+		}
+		if imgui.InputTextV("Monitored code blocks", &ae.adapt.STARS.BeaconCodeBlocks, 0, nil) {
+			ae.patch(ae.adapt.STARS.BeaconCodeBlocks, "stars_config", "beacon_code_blocks")
+		}
+	}
+
+	if imgui.CollapsingHeader("Coordination fixes") {
+		ae.drawCoordinationFixesUI()
+	}
+
+	if imgui.CollapsingHeader("ATPA volumes") {
+		ae.drawATPAVolumesUI()
+	}
+
+	if imgui.CollapsingHeader("Approach regions") {
+		for _, icao := range util.SortedMapKeys(ae.adapt.Airports) {
+			for _, rwy := range util.SortedMapKeys(ae.adapt.Airports[icao].ApproachRegions) {
+				sel := adaptationSelection{kind: selectApproachRegion, airport: icao, id: rwy}
+				if imgui.SelectableV(icao+" "+rwy, ae.selection == sel, 0, imgui.Vec2{}) {
+					ae.selection = sel
+				}
+			}
+		}
+	}
+
+	if imgui.CollapsingHeader("CA inhibit volumes") {
+		for i, vol := range ae.adapt.STARS.InhibitCAVolumes {
+			sel := adaptationSelection{kind: selectCAVolume, index: i, vertex: -1}
+			if imgui.SelectableV(fmt.Sprintf("%d: %s", i+1, vol.Name), ae.selection.kind == selectCAVolume &&
+				ae.selection.index == i, 0, imgui.Vec2{}) {
+				ae.selection = sel
+			}
+		}
+	}
+
+	imgui.Separator()
+	ae.drawSelectionUI()
+}
+
+func (ae *AdaptationEditorPane) drawCoordinationFixesUI() {
+	fixes := ae.adapt.STARS.CoordinationFixes
+	for _, fix := range util.SortedMapKeys(fixes) {
+		sel := adaptationSelection{kind: selectCoordinationFix, id: fix}
+		if imgui.SelectableV(fix, ae.selection == sel, 0, imgui.Vec2{}) {
+			ae.selection = sel
+		}
+	}
+
+	if imgui.InputTextV("##newfix", &ae.newFix, 0, nil) {
+		ae.newFix = strings.ToUpper(ae.newFix)
+	}
+	imgui.SameLine()
+	_, exists := fixes[ae.newFix]
+	_, known := ae.locateFix(ae.newFix)
+	uiStartDisable(exists || !known)
+	if imgui.Button("Add fix") {
+		if ae.adapt.STARS.CoordinationFixes == nil {
+			ae.adapt.STARS.CoordinationFixes = make(map[string]av.AdaptationFixes)
+		}
+		ae.adapt.STARS.CoordinationFixes[ae.newFix] = av.AdaptationFixes{{Name: ae.newFix, Type: av.RouteBasedFix}}
+		ae.patchCoordinationFix(ae.newFix)
+		ae.selection = adaptationSelection{kind: selectCoordinationFix, id: ae.newFix}
+		ae.newFix = ""
+	}
+	uiEndDisable(exists || !known)
+}
+
+func (ae *AdaptationEditorPane) patchCoordinationFix(fix string) {
+	ae.patch(util.MapSlice(ae.adapt.STARS.CoordinationFixes[fix], func(f av.AdaptationFix) editorAdaptationFix {
+		return editorAdaptationFix{Type: f.Type, ToFacility: f.ToFacility, FromFacility: f.FromFacility, Altitude: f.Altitude}
+	}), "stars_config", "coordination_fixes", fix)
+}
+
+func (ae *AdaptationEditorPane) drawATPAVolumesUI() {
+	for _, icao := range util.SortedMapKeys(ae.adapt.Airports) {
+		ap := ae.adapt.Airports[icao]
+		for _, rwy := range util.SortedMapKeys(ap.ATPAVolumes) {
+			sel := adaptationSelection{kind: selectATPAVolume, airport: icao, id: rwy}
+			if imgui.SelectableV(icao+" "+rwy, ae.selection == sel, 0, imgui.Vec2{}) {
+				ae.selection = sel
+			}
+		}
+
+		// Offer to add volumes for runways that don't have one.
+		dbap, ok := av.DB.Airports()[icao]
+		if !ok {
+			continue
+		}
+		var missing []av.Runway
+		for _, rwy := range dbap.Runways {
+			if _, ok := ap.ATPAVolumes[rwy.Id]; !ok {
+				missing = append(missing, rwy)
+			}
+		}
+		if len(missing) > 0 && imgui.BeginComboV("Add "+icao+" volume", "", 0) {
+			for _, rwy := range missing {
+				if imgui.SelectableV(rwy.Id, false, 0, imgui.Vec2{}) {
+					if ap.ATPAVolumes == nil {
+						ap.ATPAVolumes = make(map[string]*av.ATPAVolume)
+					}
+					vol := &av.ATPAVolume{
+						Id:                  rwy.Id,
+						ThresholdString:     rwy.Threshold.DMSString(),
+						Threshold:           rwy.Threshold,
+						Heading:             rwy.Heading,
+						MaxHeadingDeviation: 90,
+						Ceiling:             5000,
+						Length:              15,
+						LeftWidth:           2000,
+						RightWidth:          2000,
+					}
+					ap.ATPAVolumes[rwy.Id] = vol
+					ae.patch(map[string]interface{}{
+						"runway_threshold":      vol.ThresholdString,
+						"heading":               vol.Heading,
+						"max_heading_deviation": vol.MaxHeadingDeviation,
+						"floor":                 vol.Floor,
+						"ceiling":               vol.Ceiling,
+						"length":                vol.Length,
+						"left_width":            vol.LeftWidth,
+						"right_width":           vol.RightWidth,
+					}, "airports", icao, "atpa_volumes", rwy.Id)
+					ae.selection = adaptationSelection{kind: selectATPAVolume, airport: icao, id: rwy.Id}
+				}
+			}
+			imgui.EndCombo()
+		}
+	}
+}
+
+// drawSelectionUI draws the fields of the selected item.
+func (ae *AdaptationEditorPane) drawSelectionUI() {
+	sel := ae.selection
+	float := func(label string, v *float32, min, max float32, path ...interface{}) {
+		if imgui.SliderFloatV(label, v, min, max, "%.1f", 0) {
+			ae.patch(*v, path...)
+		}
+	}
+
+	switch sel.kind {
+	case selectNone:
+		imgui.Text("Click on an item on the map or in the lists above to edit it.")
+
+	case selectATPAVolume:
+		vol := ae.adapt.Airports[sel.airport].ATPAVolumes[sel.id]
+		path := []interface{}{"airports", sel.airport, "atpa_volumes", sel.id}
+		imgui.Text("ATPA volume " + sel.airport + " " + sel.id + " (drag the threshold on the map)")
+		float("Heading", &vol.Heading, 0, 360, append(path, "heading")...)
+		float("Max heading deviation", &vol.MaxHeadingDeviation, 0, 180, append(path, "max_heading_deviation")...)
+		float("Floor", &vol.Floor, 0, 10000, append(path, "floor")...)
+		float("Ceiling", &vol.Ceiling, 0, 20000, append(path, "ceiling")...)
+		float("Length (nm)", &vol.Length, 0, 30, append(path, "length")...)
+		float("Left width (ft)", &vol.LeftWidth, 0, 10000, append(path, "left_width")...)
+		float("Right width (ft)", &vol.RightWidth, 0, 10000, append(path, "right_width")...)
+
+	case selectApproachRegion:
+		ar := ae.adapt.Airports[sel.airport].ApproachRegions[sel.id]
+		path := []interface{}{"airports", sel.airport, "approach_regions", sel.id}
+		imgui.Text("Approach region " + sel.airport + " " + sel.id + " (drag the reference point on the map)")
+		float("Reference heading", &ar.ReferenceLineHeading, 0, 360, append(path, "reference_heading")...)
+		float("Reference length", &ar.ReferenceLineLength, 0, 30, append(path, "reference_length")...)
+		float("Reference altitude", &ar.ReferencePointAltitude, 0, 10000, append(path, "reference_altitude")...)
+		float("Near distance", &ar.NearDistance, 0, 30, append(path, "near_distance")...)
+		float("Near half width", &ar.NearHalfWidth, 0, 5, append(path, "near_half_width")...)
+		float("Far half width", &ar.FarHalfWidth, 0, 5, append(path, "far_half_width")...)
+		float("Region length", &ar.RegionLength, 0, 50, append(path, "region_length")...)
+		float("Heading tolerance", &ar.HeadingTolerance, 0, 180, append(path, "heading_tolerance")...)
+		float("Descent distance", &ar.DescentPointDistance, 0, 30, append(path, "descent_distance")...)
+		float("Descent altitude", &ar.DescentPointAltitude, 0, 20000, append(path, "descent_altitude")...)
+
+	case selectCAVolume:
+		vol := &ae.adapt.STARS.InhibitCAVolumes[sel.index]
+		path := []interface{}{"stars_config", "inhibit_ca_volumes", sel.index}
+		imgui.Text("CA inhibit volume " + vol.Name)
+		if vol.Type == av.AirspaceVolumePolygon {
+			imgui.Text("Drag vertices to move them, double-click to add one, and right-click to delete one.")
+		}
+		floor, ceiling := int32(vol.Floor), int32(vol.Ceiling)
+		if imgui.InputIntV("Floor", &floor, 100, 1000, 0) {
+			vol.Floor = int(floor)
+			ae.patch(vol.Floor, append(path, "floor")...)
+		}
+		if imgui.InputIntV("Ceiling", &ceiling, 100, 1000, 0) {
+			vol.Ceiling = int(ceiling)
+			ae.patch(vol.Ceiling, append(path, "ceiling")...)
+		}
+		if vol.Type == av.AirspaceVolumeCircle {
+			float("Radius", &vol.Radius, 0, 30, append(path, "radius")...)
+		}
+
+	case selectCoordinationFix:
+		fixes := ae.adapt.STARS.CoordinationFixes[sel.id]
+		imgui.Text("Coordination fix " + sel.id)
+		changed, del := false, -1
+		for i := range fixes {
+			f := &fixes[i]
+			imgui.PushID(fmt.Sprintf("%d", i))
+			imgui.Separator()
+			if imgui.BeginComboV("Type", f.Type, 0) {
+				for _, t := range []string{av.RouteBasedFix, av.ZoneBasedFix} {
+					if imgui.SelectableV(t, f.Type == t, 0, imgui.Vec2{}) {
+						f.Type, changed = t, true
+					}
+				}
+				imgui.EndCombo()
+			}
+			changed = imgui.InputTextV("To", &f.ToFacility, 0, nil) || changed
+			changed = imgui.InputTextV("From", &f.FromFacility, 0, nil) || changed
+			lo, hi := int32(f.Altitude[0]), int32(f.Altitude[1])
+			if imgui.InputIntV("Min altitude", &lo, 100, 1000, 0) {
+				f.Altitude[0], changed = int(lo), true
+			}
+			if imgui.InputIntV("Max altitude", &hi, 100, 1000, 0) {
+				f.Altitude[1], changed = int(hi), true
+			}
+			if imgui.Button("Delete") {
+				del = i
+			}
+			imgui.PopID()
+		}
+		if del != -1 {
+			fixes = slices.Delete(fixes, del, del+1)
+			changed = true
+		}
+		if imgui.Button("Add entry") {
+			fixes = append(fixes, av.AdaptationFix{Name: sel.id, Type: av.RouteBasedFix})
+			changed = true
+		}
+		if changed {
+			ae.adapt.STARS.CoordinationFixes[sel.id] = fixes
+			ae.patchCoordinationFix(sel.id)
+		}
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Map view
+
+// adaptationHandle is a location on the map that can be selected and,
+// for everything but coordination fixes, dragged.
+type adaptationHandle struct {
+	sel adaptationSelection
+	p   math.Point2LL
+}
+
+func (ae *AdaptationEditorPane) locateFix(fix string) (math.Point2LL, bool) {
+	if ae.locate == nil || fix == "" {
+		return math.Point2LL{}, false
+	}
+	return ae.locate(fix)
+}
+
+// The map is drawn north-up, centered at ae.center and showing
+// ae.rangeNm in the smaller dimension of the pane.
+func (ae *AdaptationEditorPane) scale(ctx *Context) float32 {
+	return math.Min(ctx.PaneExtent.Width(), ctx.PaneExtent.Height()) / (2 * ae.rangeNm)
+}
+
+func (ae *AdaptationEditorPane) toWindow(ctx *Context, p math.Point2LL) [2]float32 {
+	d := math.Sub2f(math.LL2NM(p, ae.nmPerLongitude), math.LL2NM(ae.center, ae.nmPerLongitude))
+	c := [2]float32{ctx.PaneExtent.Width() / 2, ctx.PaneExtent.Height() / 2}
+	return math.Add2f(c, math.Scale2f(d, ae.scale(ctx)))
+}
+
+func (ae *AdaptationEditorPane) fromWindow(ctx *Context, p [2]float32) math.Point2LL {
+	c := [2]float32{ctx.PaneExtent.Width() / 2, ctx.PaneExtent.Height() / 2}
+	d := math.Scale2f(math.Sub2f(p, c), 1/ae.scale(ctx))
+	return math.NM2LL(math.Add2f(math.LL2NM(ae.center, ae.nmPerLongitude), d), ae.nmPerLongitude)
+}
+
+func (ae *AdaptationEditorPane) handles() []adaptationHandle {
+	var h []adaptationHandle
+	for _, icao := range util.SortedMapKeys(ae.adapt.Airports) {
+		ap := ae.adapt.Airports[icao]
+		for _, rwy := range util.SortedMapKeys(ap.ATPAVolumes) {
+			h = append(h, adaptationHandle{
+				sel: adaptationSelection{kind: selectATPAVolume, airport: icao, id: rwy},
+				p:   ap.ATPAVolumes[rwy].Threshold,
+			})
+		}
+		for _, rwy := range util.SortedMapKeys(ap.ApproachRegions) {
+			h = append(h, adaptationHandle{
+				sel: adaptationSelection{kind: selectApproachRegion, airport: icao, id: rwy},
+				p:   ap.ApproachRegions[rwy].ReferencePoint,
+			})
+		}
+	}
+	for i, vol := range ae.adapt.STARS.InhibitCAVolumes {
+		if vol.Type == av.AirspaceVolumeCircle {
+			h = append(h, adaptationHandle{sel: adaptationSelection{kind: selectCAVolume, index: i, vertex: -1}, p: vol.Center})
+		} else {
+			for j, v := range vol.Vertices {
+				h = append(h, adaptationHandle{sel: adaptationSelection{kind: selectCAVolume, index: i, vertex: j}, p: v})
+			}
+		}
+	}
+	for _, fix := range util.SortedMapKeys(ae.adapt.STARS.CoordinationFixes) {
+		if p, ok := ae.locateFix(fix); ok {
+			h = append(h, adaptationHandle{sel: adaptationSelection{kind: selectCoordinationFix, id: fix}, p: p})
+		}
+	}
+	return h
+}
+
+// moveHandle updates the location of the selected handle; it's only
+// written to the JSON when the drag is finished, in commitHandle.
+func (ae *AdaptationEditorPane) moveHandle(sel adaptationSelection, p math.Point2LL) {
+	switch sel.kind {
+	case selectATPAVolume:
+		vol := ae.adapt.Airports[sel.airport].ATPAVolumes[sel.id]
+		vol.Threshold, vol.ThresholdString = p, p.DMSString()
+	case selectApproachRegion:
+		ae.adapt.Airports[sel.airport].ApproachRegions[sel.id].ReferencePoint = p
+	case selectCAVolume:
+		vol := &ae.adapt.STARS.InhibitCAVolumes[sel.index]
+		if sel.vertex == -1 {
+			vol.Center = p
+		} else {
+			vol.Vertices[sel.vertex] = p
+		}
+	}
+}
+
+func (ae *AdaptationEditorPane) commitHandle(sel adaptationSelection) {
+	switch sel.kind {
+	case selectATPAVolume:
+		vol := ae.adapt.Airports[sel.airport].ATPAVolumes[sel.id]
+		ae.patch(vol.ThresholdString, "airports", sel.airport, "atpa_volumes", sel.id, "runway_threshold")
+	case selectApproachRegion:
+		ar := ae.adapt.Airports[sel.airport].ApproachRegions[sel.id]
+		ae.patch(ar.ReferencePoint, "airports", sel.airport, "approach_regions", sel.id, "reference_point")
+	case selectCAVolume:
+		vol := ae.adapt.STARS.InhibitCAVolumes[sel.index]
+		if sel.vertex == -1 {
+			ae.patch(vol.Center, "stars_config", "inhibit_ca_volumes", sel.index, "center")
+		} else {
+			ae.patch(vol.Vertices, "stars_config", "inhibit_ca_volumes", sel.index, "vertices")
+		}
+	}
+}
+
+func (ae *AdaptationEditorPane) Draw(ctx *Context, cb *renderer.CommandBuffer) {
+	cb.ClearRGB(renderer.RGB{})
+	if ae.adapt == nil || ae.rangeNm == 0 {
+		return
+	}
+
+	ae.processMouse(ctx)
+
+	ld := renderer.GetColoredLinesDrawBuilder()
+	defer renderer.ReturnColoredLinesDrawBuilder(ld)
+	td := renderer.GetTextDrawBuilder()
+	defer renderer.ReturnTextDrawBuilder(td)
+
+	pw := func(p math.Point2LL) [2]float32 { return ae.toWindow(ctx, p) }
+	color := func(sel adaptationSelection) renderer.RGB {
+		if sel.kind == ae.selection.kind && sel.airport == ae.selection.airport && sel.id == ae.selection.id &&
+			sel.index == ae.selection.index {
+			return editorSelectedColor
+		}
+		return editorGeometryColor
+	}
+	loop := func(pts []math.Point2LL, c renderer.RGB) {
+		ld.AddLineLoop(c, util.MapSlice(pts, pw))
+	}
+
+	// Runways, for context.
+	for icao := range ae.adapt.Airports {
+		if dbap, ok := av.DB.Airports()[icao]; ok {
+			for _, rwy := range dbap.Runways {
+				p := math.Offset2LL(rwy.Threshold, rwy.Heading, 1, ae.nmPerLongitude, ae.magneticVariation)
+				ld.AddLine(pw(rwy.Threshold), pw(p), editorRunwayColor)
+			}
+		}
+	}
+
+	for icao, ap := range ae.adapt.Airports {
+		for rwy, vol := range ap.ATPAVolumes {
+			rect := vol.GetRect(ae.nmPerLongitude, ae.magneticVariation)
+			loop(rect[:], color(adaptationSelection{kind: selectATPAVolume, airport: icao, id: rwy}))
+		}
+		for rwy, ar := range ap.ApproachRegions {
+			c := color(adaptationSelection{kind: selectApproachRegion, airport: icao, id: rwy})
+			line, quad := ar.GetLateralGeometry(ae.nmPerLongitude, ae.magneticVariation)
+			ld.AddLine(pw(line[0]), pw(line[1]), c)
+			loop(quad[:], c)
+		}
+	}
+
+	for i, vol := range ae.adapt.STARS.InhibitCAVolumes {
+		c := color(adaptationSelection{kind: selectCAVolume, index: i, vertex: -1})
+		if vol.Type == av.AirspaceVolumeCircle {
+			ld.AddCircle(pw(vol.Center), vol.Radius*ae.scale(ctx), 64, c)
+		} else {
+			loop(vol.Vertices, c)
+		}
+	}
+
+	style := renderer.TextStyle{Font: ae.font, Color: editorFixColor}
+	for _, fix := range util.SortedMapKeys(ae.adapt.STARS.CoordinationFixes) {
+		if p, ok := ae.locateFix(fix); ok {
+			td.AddText(fix, math.Add2f(pw(p), [2]float32{6, 6}), style)
+		}
+	}
+
+	// Handles
+	r := 3 * ctx.DrawPixelScale
+	for _, h := range ae.handles() {
+		c := util.Select(h.sel.kind == selectCoordinationFix, editorFixColor, color(h.sel))
+		if h.sel == ae.selection {
+			c = editorSelectedColor
+		}
+		ld.AddCircle(pw(h.p), r, 8, c)
+	}
+
+	ctx.SetWindowCoordinateMatrices(cb)
+	ld.GenerateCommands(cb)
+	td.GenerateCommands(cb)
+}
+
+func (ae *AdaptationEditorPane) processMouse(ctx *Context) {
+	mouse := ctx.Mouse
+	if mouse == nil {
+		if ae.dragging {
+			// The mouse left the pane mid-drag; keep what we have.
+			ae.commitHandle(ae.selection)
+			ae.dragging = false
+		}
+		return
+	}
+
+	if mouse.Wheel[1] != 0 {
+		ae.rangeNm = math.Clamp(ae.rangeNm*math.Pow(0.9, mouse.Wheel[1]), 1, 250)
+	}
+
+	// Returns the handle closest to the mouse, if one is near enough.
+	pick := func() (adaptationHandle, bool) {
+		var best adaptationHandle
+		bestDist := 8 * ctx.DrawPixelScale
+		found := false
+		for _, h := range ae.handles() {
+			if d := math.Distance2f(ae.toWindow(ctx, h.p), mouse.Pos); d < bestDist {
+				best, bestDist, found = h, d, true
+			}
+		}
+		return best, found
+	}
+
+	if mouse.Clicked[platform.MouseButtonPrimary] {
+		if h, ok := pick(); ok {
+			ae.selection = h.sel
+			ae.dragging = h.sel.kind != selectCoordinationFix
+		}
+	}
+	if mouse.Dragging[platform.MouseButtonPrimary] {
+		if ae.dragging {
+			ae.moveHandle(ae.selection, ae.fromWindow(ctx, mouse.Pos))
+		} else {
+			// Pan
+			d := math.Scale2f(mouse.DragDelta, -1/ae.scale(ctx))
+			ae.center = math.NM2LL(math.Add2f(math.LL2NM(ae.center, ae.nmPerLongitude), d), ae.nmPerLongitude)
+		}
+	}
+	if mouse.Released[platform.MouseButtonPrimary] && ae.dragging {
+		ae.commitHandle(ae.selection)
+		ae.dragging = false
+	}
+
+	if ae.selection.kind != selectCAVolume {
+		return
+	}
+	vol := &ae.adapt.STARS.InhibitCAVolumes[ae.selection.index]
+	if vol.Type != av.AirspaceVolumePolygon {
+		return
+	}
+	if mouse.Clicked[platform.MouseButtonSecondary] && len(vol.Vertices) > 3 {
+		// Delete the vertex under the mouse.
+		if h, ok := pick(); ok && h.sel.kind == selectCAVolume && h.sel.index == ae.selection.index && h.sel.vertex >= 0 {
+			vol.Vertices = slices.Delete(vol.Vertices, h.sel.vertex, h.sel.vertex+1)
+			ae.selection.vertex = -1
+			ae.commitHandle(adaptationSelection{kind: selectCAVolume, index: ae.selection.index})
+		}
+	}
+	if mouse.DoubleClicked[platform.MouseButtonPrimary] {
+		// Insert a vertex on the closest edge.
+		best, bestDist := -1, float32(10*ctx.DrawPixelScale)
+		for i := range vol.Vertices {
+			v0 := ae.toWindow(ctx, vol.Vertices[i])
+			v1 := ae.toWindow(ctx, vol.Vertices[(i+1)%len(vol.Vertices)])
+			if d := math.PointSegmentDistance(mouse.Pos, v0, v1); d < bestDist {
+				best, bestDist = i, d
+			}
+		}
+		if best != -1 {
+			vol.Vertices = slices.Insert(vol.Vertices, best+1, ae.fromWindow(ctx, mouse.Pos))
+			ae.selection.vertex = best + 1
+			ae.commitHandle(ae.selection)
+		}
+	}
+}
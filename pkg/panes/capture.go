@@ -0,0 +1,171 @@
+// pkg/panes/capture.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package panes
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/renderer"
+	"github.com/mmp/vice/pkg/server"
+)
+
+// Screenshots can be saved as PNG files in the user's home directory,
+// either of the pane with the keyboard focus (usually the scope) or of
+// the entire window. A single capture is taken at the next frame after
+// it's requested; timed captures are taken at a fixed interval until
+// they're stopped, giving a sequence of images for debriefs.
+//
+// Captures may have the time and facility drawn in their corner. If
+// callsigns are to be anonymized, panes draw them using
+// Context.DisplayCallsign, which returns stand-ins when the pane is part
+// of a frame that's being captured; they're consistent over a sequence of
+// timed captures. (Both are drawn to the screen as well, but only for the
+// captured frame.)
+
+// CaptureConfig specifies what is captured and how.
+type CaptureConfig struct {
+	WholeWindow        bool
+	AnonymizeCallsigns bool
+	Watermark          bool
+	IntervalSeconds    int // for timed captures
+}
+
+// Capture holds the state of pending and timed captures; it is passed to
+// DrawPanes, which takes the captures.
+type Capture struct {
+	config  CaptureConfig
+	pending bool
+	timed   bool
+	next    time.Time
+	count   int
+	// Anonymized callsigns, indexed by actual callsign.
+	anonymous map[string]string
+}
+
+// CaptureNextFrame requests a capture of the next frame.
+func (c *Capture) CaptureNextFrame(config CaptureConfig) {
+	c.config = config
+	c.pending = true
+	c.anonymous = nil
+}
+
+// StartTimed starts taking captures every config.IntervalSeconds.
+func (c *Capture) StartTimed(config CaptureConfig) {
+	c.config = config
+	c.config.IntervalSeconds = max(1, config.IntervalSeconds)
+	c.timed = true
+	c.next = time.Time{}
+	c.anonymous = nil
+}
+
+func (c *Capture) StopTimed() {
+	c.timed = false
+}
+
+func (c *Capture) TimedActive() bool {
+	return c.timed
+}
+
+// DisplayCallsign returns the callsign that should be drawn for an
+// aircraft; it's only different from its actual callsign when the pane is
+// being captured with anonymized callsigns.
+func (ctx *Context) DisplayCallsign(callsign string) string {
+	c := ctx.capture
+	if c == nil || !c.config.AnonymizeCallsigns {
+		return callsign
+	}
+	if c.anonymous == nil {
+		c.anonymous = make(map[string]string)
+	}
+	anon, ok := c.anonymous[callsign]
+	if !ok {
+		anon = fmt.Sprintf("ACFT%03d", len(c.anonymous)+1)
+		c.anonymous[callsign] = anon
+	}
+	return anon
+}
+
+// beginFrame is called at the start of each frame and returns true if the
+// frame is to be captured.
+func (c *Capture) beginFrame(now time.Time) bool {
+	active := c.pending || (c.timed && !now.Before(c.next))
+	if active && c.timed {
+		c.next = now.Add(time.Duration(c.config.IntervalSeconds) * time.Second)
+	}
+	c.pending = false
+	return active
+}
+
+// drawWatermark adds the watermark to the command buffer, which must be
+// set up for drawing over the full window, in the corner of the captured
+// extent.
+func (c *Capture) drawWatermark(extent math.Extent2D, client *server.ControlClient, cb *renderer.CommandBuffer) {
+	if !c.config.Watermark {
+		return
+	}
+
+	td := renderer.GetTextDrawBuilder()
+	defer renderer.ReturnTextDrawBuilder(td)
+
+	font := renderer.GetDefaultFont()
+	text := client.State.TRACON + " " + client.State.SimTime.UTC().Format("2006-01-02 15:04:05Z")
+	pad := float32(4)
+	p := [2]float32{extent.P0[0] + pad, extent.P0[1] + pad + float32(font.Size)}
+	td.AddText(text, p, renderer.TextStyle{
+		Font:            font,
+		Color:           renderer.RGB{R: 1, G: 1, B: 1},
+		DrawBackground:  true,
+		BackgroundColor: renderer.RGB{R: 0.2, G: 0.2, B: 0.2},
+	})
+	td.GenerateCommands(cb)
+}
+
+// save reads back the pixels in the given window extent, which must have
+// already been rendered, and writes them to a PNG file.
+func (c *Capture) save(r renderer.Renderer, extent math.Extent2D, fbScale float32, facility string, lg *log.Logger) {
+	x, y := int(fbScale*extent.P0[0]), int(fbScale*extent.P0[1])
+	w, h := int(fbScale*extent.Width()), int(fbScale*extent.Height())
+	if w <= 0 || h <= 0 {
+		return
+	}
+	px := r.ReadPixelRGBAs(x, y, w, h)
+
+	c.count++
+	fn := fmt.Sprintf("vice-%s-%s-%03d.png", facility, time.Now().Format("20060102-150405"), c.count)
+	if d, err := os.UserHomeDir(); err == nil {
+		fn = filepath.Join(d, fn)
+	}
+
+	// Encoding takes long enough that it's worth not holding up drawing.
+	go func() {
+		// Flip in y and set alpha to 1.
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for i := range h {
+			copy(img.Pix[i*img.Stride:(i+1)*img.Stride], px[(h-1-i)*4*w:(h-i)*4*w])
+			for j := range w {
+				img.Pix[i*img.Stride+4*j+3] = 255
+			}
+		}
+
+		f, err := os.Create(fn)
+		if err != nil {
+			lg.Errorf("%s: %v", fn, err)
+			return
+		}
+		defer f.Close()
+		if err := png.Encode(f, img); err != nil {
+			lg.Errorf("%s: %v", fn, err)
+		} else {
+			lg.Infof("Saved capture to %s", fn)
+		}
+	}()
+}
@@ -128,6 +128,9 @@ type DisplayNode struct {
 	SplitLine SplitLine
 	// non-nil only for interior notes: iff splitAxis != SplitAxisNone
 	Children [2]*DisplayNode
+	// Hidden is set for leaf nodes whose Pane the user has hidden; it's
+	// only used for plugins' panes (see DrawPluginUI).
+	Hidden bool
 }
 
 // NodeForPane searches a display node hierarchy for a given Pane,
@@ -213,6 +216,11 @@ func (d *DisplayNode) UnmarshalJSON(s []byte) error {
 	if err := json.Unmarshal(*m["Children"], &d.Children); err != nil {
 		return err
 	}
+	if h, ok := m["Hidden"]; ok {
+		if err := json.Unmarshal(*h, &d.Hidden); err != nil {
+			return err
+		}
+	}
 
 	// Now create the appropriate Pane type based on the type string.
 	if paneType == "" {
@@ -244,6 +252,11 @@ func (d *DisplayNode) VisitPanes(visit func(Pane)) {
 // the bounding box of its parent node in the DisplayNodeTree.
 func (d *DisplayNode) VisitPanesWithBounds(displayExtent math.Extent2D, parentDisplayExtent math.Extent2D, p platform.Platform,
 	visit func(math.Extent2D, math.Extent2D, Pane)) {
+	if i := d.hiddenChild(); i != -1 {
+		d.Children[1-i].VisitPanesWithBounds(displayExtent, parentDisplayExtent, p, visit)
+		return
+	}
+
 	switch d.SplitLine.Axis {
 	case SplitAxisNone:
 		visit(displayExtent, parentDisplayExtent, d.Pane)
@@ -260,6 +273,26 @@ func (d *DisplayNode) VisitPanesWithBounds(displayExtent math.Extent2D, parentDi
 	}
 }
 
+// hiddenChild returns the index of the child of a split node that is a
+// hidden Pane, or -1 if there isn't one; the other child then takes the
+// node's entire extent.
+func (d *DisplayNode) hiddenChild() int {
+	if d.SplitLine.Axis == SplitAxisNone {
+		return -1
+	}
+	for i, c := range d.Children {
+		if c.hidden() {
+			return i
+		}
+	}
+	return -1
+}
+
+// hidden returns whether the node is a leaf with a Pane that is hidden.
+func (d *DisplayNode) hidden() bool {
+	return d != nil && d.SplitLine.Axis == SplitAxisNone && d.Pane != nil && (d.Hidden || d.Pane.Hide())
+}
+
 // SplitX returns a new DisplayNode that is the result of splitting the
 // provided node horizontally direction at the specified offset (which should
 // be between 0 and 1), storing the node as the new node's first child, and
@@ -322,6 +355,9 @@ func (d *DisplayNode) FindPaneForMouse(displayExtent math.Extent2D, p [2]float32
 		// We've reached a leaf node and found the pane.
 		return d.Pane
 	}
+	if i := d.hiddenChild(); i != -1 {
+		return d.Children[1-i].FindPaneForMouse(displayExtent, p, plat)
+	}
 
 	// Compute the extents of the two nodes and the split line.
 	var d0, ds, d1 math.Extent2D
@@ -394,7 +430,7 @@ func wmPaneIsPresent(pane Pane, root *DisplayNode) bool {
 // and providing mouse and keyboard events only to the Pane that should
 // respectively be receiving them.
 func DrawPanes(root *DisplayNode, p platform.Platform, r renderer.Renderer, controlClient *server.ControlClient,
-	menuBarHeight float32, lg *log.Logger) renderer.RendererStats {
+	menuBarHeight float32, capture *Capture, lg *log.Logger) renderer.RendererStats {
 	if controlClient == nil {
 		commandBuffer := renderer.GetCommandBuffer()
 		defer renderer.ReturnCommandBuffer(commandBuffer)
@@ -402,17 +438,9 @@ func DrawPanes(root *DisplayNode, p platform.Platform, r renderer.Renderer, cont
 		return r.RenderCommandBuffer(commandBuffer)
 	}
 
-	var filter func(d *DisplayNode) *DisplayNode
-	filter = func(d *DisplayNode) *DisplayNode {
-		if d.Children[0] != nil && d.Children[0].Pane != nil && d.Children[0].Pane.Hide() {
-			return filter(d.Children[1])
-		} else if d.Children[1] != nil && d.Children[1].Pane != nil && d.Children[1].Pane.Hide() {
-			return filter(d.Children[0])
-		} else {
-			return d
-		}
+	for i := root.hiddenChild(); i != -1; i = root.hiddenChild() {
+		root = root.Children[1-i]
 	}
-	root = filter(root)
 
 	if wm.focus.Current() == nil || !wmPaneIsPresent(wm.focus.Current(), root) {
 		wm.focus.Release()
@@ -468,6 +496,11 @@ func DrawPanes(root *DisplayNode, p platform.Platform, r renderer.Renderer, cont
 	// First clear the entire window to the background color.
 	commandBuffer.ClearRGB(renderer.RGB{})
 
+	// If the frame is being captured, this is the window extent that
+	// will be saved; see capture.go.
+	captureFrame := capture.beginFrame(time.Now())
+	captureExtent := paneDisplayExtent
+
 	// Handle tabbing between panes that can take the keyboard focus.
 	var keyboard *platform.KeyboardState
 	if !imgui.CurrentIO().WantCaptureKeyboard() {
@@ -478,6 +511,10 @@ func DrawPanes(root *DisplayNode, p platform.Platform, r renderer.Renderer, cont
 	root.VisitPanesWithBounds(paneDisplayExtent, paneDisplayExtent, p,
 		func(paneExtent math.Extent2D, parentExtent math.Extent2D, pane Pane) {
 			haveFocus := pane == wm.focus.Current() && !imgui.CurrentIO().WantCaptureKeyboard()
+			captured := captureFrame && (capture.config.WholeWindow || pane == wm.focus.Current())
+			if captured && !capture.config.WholeWindow {
+				captureExtent = paneExtent
+			}
 			ctx := Context{
 				PaneExtent:       paneExtent,
 				ParentPaneExtent: parentExtent,
@@ -495,6 +532,9 @@ func DrawPanes(root *DisplayNode, p platform.Platform, r renderer.Renderer, cont
 				ControlClient:    controlClient,
 				displaySize:      p.DisplaySize(),
 			}
+			if captured {
+				ctx.capture = capture
+			}
 
 			// Similarly make the mouse events available only to the
 			// one Pane that should see them.
@@ -529,12 +569,25 @@ func DrawPanes(root *DisplayNode, p platform.Platform, r renderer.Renderer, cont
 		wm.mouseConsumerOverride = nil
 	}
 
+	if captureFrame {
+		commandBuffer.SetDrawBounds(paneDisplayExtent, fbSize[1]/displaySize[1])
+		commandBuffer.LoadProjectionMatrix(math.Identity3x3().Ortho(0, paneDisplayExtent.Width(), 0,
+			paneDisplayExtent.Height()))
+		commandBuffer.LoadModelViewMatrix(math.Identity3x3())
+		capture.drawWatermark(captureExtent, controlClient, commandBuffer)
+		commandBuffer.ResetState()
+	}
+
 	// fbSize will be (0,0) if the window is minimized, in which case we
 	// can skip rendering. It's still important to do all of the pane
 	// traversal, etc., though, so that events are still consumed and
 	// memory use doesn't grow.
 	if fbSize[0] > 0 && fbSize[1] > 0 {
-		return r.RenderCommandBuffer(commandBuffer)
+		stats := r.RenderCommandBuffer(commandBuffer)
+		if captureFrame {
+			capture.save(r, captureExtent, fbSize[1]/displaySize[1], controlClient.State.TRACON, lg)
+		}
+		return stats
 	}
 	return renderer.RendererStats{}
 }
@@ -588,11 +641,55 @@ func Activate(root *DisplayNode, r renderer.Renderer, p platform.Platform, event
 		}
 	}
 
+	// Add one for each plugin; unlike the built-in panes (see
+	// AddHiddenPanes), which plugins are present may change from run to
+	// run.
+	if root != nil {
+		addPluginPanes(root)
+	}
+
 	root.VisitPanes(func(pane Pane) {
 		pane.Activate(r, p, eventStream, lg)
 	})
 }
 
+// AddHiddenPanes adds the built-in panes that are hidden until they're
+// enabled in the settings window to the display hierarchy if it doesn't
+// have them. It's called for new hierarchies and when upgrading configs
+// saved before they were added.
+func AddHiddenPanes(root *DisplayNode) {
+	for _, pane := range []Pane{NewTowerViewPane(), NewAdaptationEditorPane(), NewEDSTPane()} {
+		addHiddenPane(root, pane)
+	}
+}
+
+// addHiddenPane adds the pane to the display hierarchy above everything
+// else unless there's already one of the same type, returning its node
+// if it was added. The pane should be hidden until the user enables it.
+func addHiddenPane(root *DisplayNode, pane Pane) *DisplayNode {
+	have := false
+	root.VisitPanes(func(p Pane) {
+		have = have || paneTypeName(p) == paneTypeName(pane)
+	})
+	if have {
+		return nil
+	}
+
+	prev := *root
+	node := &DisplayNode{Pane: pane}
+	*root = DisplayNode{
+		SplitLine: SplitLine{
+			Pos:  0.6,
+			Axis: SplitAxisY,
+		},
+		Children: [2]*DisplayNode{
+			&prev,
+			node,
+		},
+	}
+	return node
+}
+
 func LoadedSim(root *DisplayNode, client *server.ControlClient, state sim.State, pl platform.Platform, lg *log.Logger) {
 	root.VisitPanes(func(p Pane) {
 		p.LoadedSim(client, state, pl, lg)
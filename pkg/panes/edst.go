@@ -0,0 +1,313 @@
+// pkg/panes/edst.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package panes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/platform"
+	"github.com/mmp/vice/pkg/renderer"
+	"github.com/mmp/vice/pkg/server"
+	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/util"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// EDSTPane is a simplified ERAM en route decision support tool: it lists
+// the flight plans of the aircraft the user is tracking (or is being
+// offered), highlighting those that the ERAM conflict probe has found
+// conflicts for. Clicking on an entry opens an amendment window where a
+// new route or altitude can be trial planned against the probe and then
+// entered, which sends an amendment to the facilities that have the
+// flight plan.
+type EDSTPane struct {
+	ShowEDST       bool
+	FontIdentifier renderer.FontIdentifier
+
+	font *renderer.Font
+
+	selected string // callsign
+	route    string
+	altitude int32
+	trial    *edstTrialPlan
+	status   string
+}
+
+// edstTrialPlan is the result of a trial plan.
+type edstTrialPlan struct {
+	route     string
+	altitude  int32
+	conflicts []sim.ProbeConflict
+}
+
+var (
+	edstHeaderColor   = renderer.RGB{.6, .6, .6}
+	edstTextColor     = renderer.RGB{.9, .9, .9}
+	edstHandoffColor  = renderer.RGB{.5, .8, 1}
+	edstConflictColor = renderer.RGB{.5, .08, .08} // < 5 minutes
+	edstAlertColor    = renderer.RGB{.45, .4, .05}
+	edstSelectedColor = renderer.RGB{.15, .2, .35}
+)
+
+func init() {
+	RegisterUnmarshalPane("EDSTPane", func(d []byte) (Pane, error) {
+		var p EDSTPane
+		err := json.Unmarshal(d, &p)
+		return &p, err
+	})
+}
+
+func NewEDSTPane() *EDSTPane {
+	return &EDSTPane{
+		FontIdentifier: renderer.FontIdentifier{Name: "Inconsolata Condensed Regular", Size: 16},
+	}
+}
+
+func (ep *EDSTPane) DisplayName() string { return "EDST" }
+
+func (ep *EDSTPane) Hide() bool { return !ep.ShowEDST }
+
+func (ep *EDSTPane) Activate(r renderer.Renderer, p platform.Platform, eventStream *sim.EventStream, lg *log.Logger) {
+	if ep.font = renderer.GetFont(ep.FontIdentifier); ep.font == nil {
+		ep.font = renderer.GetDefaultFont()
+		ep.FontIdentifier = ep.font.Id
+	}
+}
+
+func (ep *EDSTPane) LoadedSim(client *server.ControlClient, ss sim.State, pl platform.Platform, lg *log.Logger) {
+}
+
+func (ep *EDSTPane) ResetSim(client *server.ControlClient, ss sim.State, pl platform.Platform, lg *log.Logger) {
+	ep.selected = ""
+	ep.trial = nil
+}
+
+func (ep *EDSTPane) CanTakeKeyboardFocus() bool { return false }
+
+func (ep *EDSTPane) DrawUI(p platform.Platform, config *platform.Config) {
+	imgui.Checkbox("Show EDST", &ep.ShowEDST)
+	if newFont, changed := renderer.DrawFontPicker(&ep.FontIdentifier, "Font"); changed {
+		ep.font = newFont
+	}
+}
+
+// aircraft returns the aircraft in the flight plan list, sorted by
+// callsign.
+func (ep *EDSTPane) aircraft(ctx *Context) []*av.Aircraft {
+	tcp := ctx.ControlClient.PrimaryTCP
+	var list []*av.Aircraft
+	for _, callsign := range util.SortedMapKeys(ctx.ControlClient.Aircraft) {
+		ac := ctx.ControlClient.Aircraft[callsign]
+		if ac.FlightPlan != nil && (ac.TrackingController == tcp || ac.HandoffTrackController == tcp) {
+			list = append(list, ac)
+		}
+	}
+	return list
+}
+
+// conflict returns the earliest probe conflict for the aircraft, if any.
+func (ep *EDSTPane) conflict(ctx *Context, callsign string) (sim.ProbeConflict, bool) {
+	// ProbeConflicts is sorted by time.
+	for _, c := range ctx.ControlClient.State.ProbeConflicts {
+		if c.Callsign == callsign {
+			return c, true
+		} else if c.Other == callsign {
+			c.Callsign, c.Other = c.Other, c.Callsign
+			return c, true
+		}
+	}
+	return sim.ProbeConflict{}, false
+}
+
+func (ep *EDSTPane) Draw(ctx *Context, cb *renderer.CommandBuffer) {
+	cb.ClearRGB(renderer.RGB{})
+
+	list := ep.aircraft(ctx)
+	lineHeight := float32(ep.font.Size + 2)
+	w, h := ctx.PaneExtent.Width(), ctx.PaneExtent.Height()
+
+	if mouse := ctx.Mouse; mouse != nil && mouse.Clicked[platform.MouseButtonPrimary] {
+		// Row 0 is the header.
+		if row := int((h-mouse.Pos[1])/lineHeight) - 1; row >= 0 && row < len(list) {
+			ep.selectAircraft(list[row])
+		}
+	}
+
+	td := renderer.GetTextDrawBuilder()
+	defer renderer.ReturnTextDrawBuilder(td)
+	trid := renderer.GetColoredTrianglesDrawBuilder()
+	defer renderer.ReturnColoredTrianglesDrawBuilder(trid)
+
+	// Column offsets, in characters.
+	cols := []int{0, 9, 16, 24, 65}
+	charWidth, _ := ep.font.BoundText("W", 0)
+	drawRow := func(y float32, fields []string, style renderer.TextStyle) {
+		for i, f := range fields {
+			td.AddText(f, [2]float32{float32(2 + cols[i]*charWidth), y}, style)
+		}
+	}
+
+	y := h
+	drawRow(y, []string{"ACID", "TYPE", "ALT", "ROUTE", "CONFLICT"},
+		renderer.TextStyle{Font: ep.font, Color: edstHeaderColor})
+	y -= lineHeight
+
+	now := ctx.ControlClient.CurrentTime()
+	for _, ac := range list {
+		fp := ac.FlightPlan
+		conflict := ""
+		bg := renderer.RGB{}
+		if c, ok := ep.conflict(ctx, ac.Callsign); ok {
+			minutes := int(math.Max(0, float32(c.Time.Sub(now).Minutes())))
+			conflict = fmt.Sprintf("%s %dM", c.Other, minutes)
+			bg = util.Select(minutes < 5, edstConflictColor, edstAlertColor)
+		}
+		if ac.Callsign == ep.selected {
+			bg = util.Select(bg == renderer.RGB{}, edstSelectedColor, bg)
+		}
+		if bg != (renderer.RGB{}) {
+			trid.AddQuad([2]float32{0, y}, [2]float32{w, y}, [2]float32{w, y - lineHeight},
+				[2]float32{0, y - lineHeight}, bg)
+		}
+
+		color := util.Select(ac.TrackingController == ctx.ControlClient.PrimaryTCP, edstTextColor, edstHandoffColor)
+		// Show interim altitudes and assigned headings the way ERAM
+		// does: "080T350" and a leading "H270/" on the route.
+		alt := fmt.Sprintf("%03d", fp.Altitude/100)
+		route := fp.Route
+		if in, ok := ctx.ControlClient.State.Intent(ac.Callsign); ok {
+			if in.Interim {
+				alt = fmt.Sprintf("%03dT%03d", int(in.TargetAltitude+50)/100, fp.Altitude/100)
+			}
+			if in.Heading != nil {
+				route = fmt.Sprintf("H%03d/", int(*in.Heading)) + route
+			}
+		}
+		if n := cols[4] - cols[3] - 1; len(route) > n {
+			route = route[:n-1] + "*"
+		}
+		drawRow(y, []string{ac.Callsign, fp.TypeWithoutSuffix(), alt, route, conflict},
+			renderer.TextStyle{Font: ep.font, Color: color})
+		y -= lineHeight
+	}
+
+	ctx.SetWindowCoordinateMatrices(cb)
+	trid.GenerateCommands(cb)
+	td.GenerateCommands(cb)
+
+	ep.drawAmendmentWindow(ctx)
+}
+
+func (ep *EDSTPane) selectAircraft(ac *av.Aircraft) {
+	ep.selected = ac.Callsign
+	ep.route = ac.FlightPlan.Route
+	ep.altitude = int32(ac.FlightPlan.Altitude)
+	ep.trial = nil
+	ep.status = ""
+}
+
+// drawAmendmentWindow draws the window for trial planning and amending
+// the selected aircraft's flight plan, if there is one.
+func (ep *EDSTPane) drawAmendmentWindow(ctx *Context) {
+	ac, ok := ctx.ControlClient.Aircraft[ep.selected]
+	if !ok || ac.FlightPlan == nil {
+		ep.selected = ""
+		return
+	}
+
+	show := true
+	imgui.BeginV("EDST Amendment - "+ac.Callsign, &show, imgui.WindowFlagsAlwaysAutoResize)
+
+	fp := ac.FlightPlan
+	imgui.Text(fmt.Sprintf("%s %s %s-%s", ac.Callsign, fp.AircraftType, fp.DepartureAirport, fp.ArrivalAirport))
+	imgui.Separator()
+
+	imgui.InputTextV("Route", &ep.route, 0, nil)
+	imgui.InputIntV("Altitude", &ep.altitude, 1000, 1000, 0)
+	ep.route = strings.ToUpper(ep.route)
+
+	// Only send what's been changed to the probe.
+	route := util.Select(ep.route != fp.Route, ep.route, "")
+	altitude := util.Select(int(ep.altitude) != fp.Altitude, int(ep.altitude), 0)
+
+	if imgui.Button("Trial Plan") {
+		ep.status = ""
+		trial := &edstTrialPlan{route: ep.route, altitude: ep.altitude}
+		callsign := ac.Callsign
+		ctx.ControlClient.TrialPlan(callsign, route, altitude,
+			func(c []sim.ProbeConflict) {
+				if callsign == ep.selected {
+					trial.conflicts = c
+					ep.trial = trial
+				}
+			},
+			func(err error) { ep.status = err.Error() })
+	}
+	imgui.SameLine()
+	changed := route != "" || altitude != 0
+	uiStartDisable(!changed)
+	if imgui.Button("Amend") {
+		afp := *fp
+		afp.Route, afp.Altitude = ep.route, int(ep.altitude)
+		if err := ctx.ControlClient.AmendFlightPlan(ac.Callsign, afp); err != nil {
+			ep.status = err.Error()
+		} else {
+			ep.status = "Amendment sent"
+			ep.trial = nil
+		}
+	}
+	uiEndDisable(!changed)
+	imgui.SameLine()
+	if imgui.Button("Close") {
+		show = false
+	}
+
+	if ep.status != "" {
+		imgui.Text(ep.status)
+	}
+
+	if t := ep.trial; t != nil && t.route == ep.route && t.altitude == ep.altitude {
+		imgui.Separator()
+		if len(t.conflicts) == 0 {
+			imgui.Text("No conflicts")
+		} else {
+			now := ctx.ControlClient.CurrentTime()
+			tableFlags := imgui.TableFlagsBordersV | imgui.TableFlagsBordersOuterH |
+				imgui.TableFlagsRowBg | imgui.TableFlagsSizingStretchProp
+			if imgui.BeginTableV("conflicts", 4, tableFlags, imgui.Vec2{}, 0) {
+				imgui.TableSetupColumn("Aircraft")
+				imgui.TableSetupColumn("In")
+				imgui.TableSetupColumn("Lateral")
+				imgui.TableSetupColumn("Vertical")
+				imgui.TableHeadersRow()
+				for _, c := range t.conflicts {
+					imgui.TableNextRow()
+					imgui.TableNextColumn()
+					imgui.Text(c.Other)
+					imgui.TableNextColumn()
+					imgui.Text(fmt.Sprintf("%.0f min", math.Max(0, float32(c.Time.Sub(now).Minutes()))))
+					imgui.TableNextColumn()
+					imgui.Text(fmt.Sprintf("%.1f nm", c.LateralNM))
+					imgui.TableNextColumn()
+					imgui.Text(fmt.Sprintf("%.0f ft", c.VerticalFt))
+				}
+				imgui.EndTable()
+			}
+		}
+	}
+
+	imgui.End()
+
+	if !show {
+		ep.selected = ""
+		ep.trial = nil
+	}
+}
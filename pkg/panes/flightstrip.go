@@ -39,9 +39,13 @@ type FlightStripPane struct {
 	AddPushed                 bool
 	CollectDeparturesArrivals bool
 	DarkMode                  bool
+	ICAOFormat                bool // show aircraft types as in ICAO flight plans
 
 	strips        []string // callsigns
 	addedAircraft map[string]interface{}
+	// ControlClient.AircraftGeneration when new aircraft were last
+	// looked for.
+	aircraftGeneration uint64
 
 	mouseDragging       bool
 	lastMousePos        [2]float32
@@ -181,6 +185,7 @@ func (fsp *FlightStripPane) ResetSim(client *server.ControlClient, ss sim.State,
 	fsp.CIDs = make(map[string]int)
 	fsp.AllocatedCIDs = make(map[int]interface{})
 	fsp.AircraftTimes = make(map[string]time.Time)
+	fsp.aircraftGeneration = 0
 }
 
 func (fsp *FlightStripPane) CanTakeKeyboardFocus() bool { return false /*true*/ }
@@ -188,8 +193,11 @@ func (fsp *FlightStripPane) CanTakeKeyboardFocus() bool { return false /*true*/
 func (fsp *FlightStripPane) processEvents(ctx *Context) {
 	// First account for changes in world.Aircraft
 	// Added aircraft
-	for _, ac := range ctx.ControlClient.Aircraft {
-		fsp.possiblyAddAircraft(&ctx.ControlClient.State, ac)
+	if gen := ctx.ControlClient.AircraftGeneration(); gen != fsp.aircraftGeneration {
+		fsp.aircraftGeneration = gen
+		for _, ac := range ctx.ControlClient.Aircraft {
+			fsp.possiblyAddAircraft(&ctx.ControlClient.State, ac)
+		}
 	}
 
 	remove := func(c string) {
@@ -280,6 +288,7 @@ func (fsp *FlightStripPane) DrawUI(p platform.Platform, config *platform.Config)
 
 	imgui.Checkbox("Collect departures and arrivals together", &fsp.CollectDeparturesArrivals)
 	imgui.Checkbox("Night mode", &fsp.DarkMode)
+	imgui.Checkbox("ICAO aircraft types", &fsp.ICAOFormat)
 
 	id := renderer.FontIdentifier{Name: fsp.font.Id.Name, Size: fsp.FontSize}
 	if newFont, changed := renderer.DrawFontSizeSelector(&id); changed {
@@ -447,7 +456,11 @@ func (fsp *FlightStripPane) Draw(ctx *Context, cb *renderer.CommandBuffer) {
 
 		// First column; 3 entries: callsign, aircraft type, 3-digit id number
 		cid := fmt.Sprintf("%03d", fsp.getCID(callsign))
-		drawColumn(callsign, ac.CWT()+"/"+fp.BaseType(), cid, width0, false)
+		if fsp.ICAOFormat {
+			drawColumn(ctx.DisplayCallsign(callsign), fp.ICAOTypeAndWake(), cid, width0, false)
+		} else {
+			drawColumn(ctx.DisplayCallsign(callsign), ac.CWT()+"/"+fp.BaseType(), cid, width0, false)
+		}
 
 		x += width0
 		if ctx.ControlClient.State.IsDeparture(ac) {
@@ -0,0 +1,130 @@
+// pkg/panes/labels.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package panes
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mmp/vice/pkg/math"
+)
+
+// Datablocks for closely-spaced aircraft (e.g., on final) tend to overlap
+// one another and each other's tracks, at which point controllers
+// usually start fiddling with leader line directions to keep them
+// readable. LabelLayout automates that for panes: given each track's
+// window position and the extent its label would cover for each leader
+// line direction, it picks directions that minimize overlap.
+//
+// Layout is greedy: labels with manually-specified directions are placed
+// first, and then each of the others, in order of their ids, takes the
+// direction with the lowest cost, where cost is the area of overlap with
+// the labels placed so far and with all of the tracks, plus penalties for
+// deviating from the label's preferred direction and for moving it from
+// where it was in the previous layout. The latter keeps labels from
+// jumping around from frame to frame as aircraft move.
+
+// Label describes a track's label for LabelLayout.
+type Label struct {
+	Id    string
+	Track [2]float32 // window coordinates
+	// The direction the label would otherwise be drawn in.
+	Direction math.CardinalOrdinalDirection
+	// Fixed labels have a manually-specified direction that the layout
+	// keeps.
+	Fixed bool
+	// Bounds returns the window-space extent of the label when its
+	// leader line is in the given direction.
+	Bounds func(math.CardinalOrdinalDirection) math.Extent2D
+}
+
+// LabelLayout chooses leader line directions for labels; it should be
+// reused across frames.
+type LabelLayout struct {
+	previous map[string]math.CardinalOrdinalDirection
+}
+
+const (
+	// Costs, as fractions of the label's area.
+	labelDeviationCost = 0.05 // per 45 degrees away from the preferred direction
+	labelMoveCost      = 0.1
+)
+
+// Layout returns the direction chosen for each label. trackRadius gives
+// the size of the region around each track that labels should avoid.
+func (l *LabelLayout) Layout(labels []Label, trackRadius float32) map[string]math.CardinalOrdinalDirection {
+	labels = slices.Clone(labels)
+	slices.SortFunc(labels, func(a, b Label) int {
+		if a.Fixed != b.Fixed {
+			if a.Fixed {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	tracks := make([]math.Extent2D, len(labels))
+	for i, lb := range labels {
+		tracks[i] = math.Extent2D{P0: lb.Track, P1: lb.Track}.Expand(trackRadius)
+	}
+
+	dirs := make(map[string]math.CardinalOrdinalDirection)
+	var placed []math.Extent2D
+	for i, lb := range labels {
+		if lb.Fixed {
+			dirs[lb.Id] = lb.Direction
+			placed = append(placed, lb.Bounds(lb.Direction))
+			continue
+		}
+
+		bestDir, bestCost := lb.Direction, float32(0)
+		var bestBounds math.Extent2D
+		for d := range math.CardinalOrdinalDirection(8) {
+			b := lb.Bounds(d)
+			area := b.Width() * b.Height()
+
+			var cost float32
+			for _, p := range placed {
+				cost += overlapArea(b, p)
+			}
+			for j, t := range tracks {
+				if j != i {
+					cost += overlapArea(b, t)
+				}
+			}
+			cost += labelDeviationCost * area * float32(directionSteps(d, lb.Direction))
+			if prev, ok := l.previous[lb.Id]; ok && prev != d {
+				cost += labelMoveCost * area
+			}
+
+			if d == 0 || cost < bestCost {
+				bestDir, bestCost, bestBounds = d, cost, b
+			}
+		}
+		dirs[lb.Id] = bestDir
+		placed = append(placed, bestBounds)
+	}
+
+	l.previous = dirs
+	return dirs
+}
+
+// overlapArea returns the area of the intersection of the two extents.
+func overlapArea(a, b math.Extent2D) float32 {
+	w := min(a.P1[0], b.P1[0]) - max(a.P0[0], b.P0[0])
+	h := min(a.P1[1], b.P1[1]) - max(a.P0[1], b.P0[1])
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	return w * h
+}
+
+// directionSteps returns the number of 45 degree steps between the two
+// directions.
+func directionSteps(a, b math.CardinalOrdinalDirection) int {
+	d := math.Abs(int(a) - int(b))
+	return min(d, 8-d)
+}
@@ -0,0 +1,173 @@
+// pkg/panes/measure.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package panes
+
+import (
+	gomath "math"
+
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Measurement tools for radar-style panes: range/bearing lines between
+// tracks and fixed points, the closest point of approach of two tracks,
+// and range rings. A pane keeps the tools' state using the types here and
+// provides a TrackFunc that gives the positions of the tracks it's
+// displaying; the geometry is all computed here so that the pane's
+// drawing code only has to render the results.
+
+// MeasureTrack is what a pane knows about an aircraft's radar track.
+type MeasureTrack struct {
+	Position math.Point2LL
+	// Where the track is expected to be one minute from now, relative to
+	// Position; zero if its course isn't known yet.
+	Velocity    math.Point2LL
+	Groundspeed float32
+}
+
+// TrackFunc returns the track for the aircraft with the given callsign if
+// the pane is displaying it.
+type TrackFunc func(callsign string) (MeasureTrack, bool)
+
+// MeasurePoint is an endpoint or center for a measurement: either an
+// aircraft's track or a fixed position.
+type MeasurePoint struct {
+	// If callsign is given, use that aircraft's position;
+	// otherwise we have a fixed position.
+	Loc      math.Point2LL
+	Callsign string
+}
+
+// Resolve returns the point's current position; false is returned if it
+// is a track that isn't being displayed.
+func (p MeasurePoint) Resolve(tracks TrackFunc) (math.Point2LL, bool) {
+	if p.Callsign != "" {
+		if trk, ok := tracks(p.Callsign); ok {
+			return trk.Position, true
+		}
+	}
+	return p.Loc, !p.Loc.IsZero()
+}
+
+///////////////////////////////////////////////////////////////////////////
+// RangeBearingLine
+
+type RangeBearingLine struct {
+	P [2]MeasurePoint
+}
+
+// RangeBearing is the measurement given by a RangeBearingLine.
+type RangeBearing struct {
+	P0, P1   math.Point2LL
+	Heading  float32 // magnetic, from P0 to P1
+	Distance float32 // nm
+	// Minutes for the track to reach the fixed point if exactly one of
+	// the endpoints is a track; zero otherwise.
+	ETA float32
+}
+
+// Measure returns the range and bearing between the line's endpoints;
+// false is returned if either of them can't be resolved.
+func (rbl RangeBearingLine) Measure(tracks TrackFunc, nmPerLongitude, magneticVariation float32) (RangeBearing, bool) {
+	p0, ok0 := rbl.P[0].Resolve(tracks)
+	p1, ok1 := rbl.P[1].Resolve(tracks)
+	if !ok0 || !ok1 {
+		return RangeBearing{}, false
+	}
+
+	rb := RangeBearing{
+		P0:       p0,
+		P1:       p1,
+		Heading:  math.Heading2LL(p0, p1, nmPerLongitude, magneticVariation),
+		Distance: math.NMDistance2LL(p0, p1),
+	}
+
+	// If one but not both are tracks, use its groundspeed for the ETA.
+	if (rbl.P[0].Callsign == "") != (rbl.P[1].Callsign == "") {
+		cs := util.Select(rbl.P[0].Callsign != "", rbl.P[0].Callsign, rbl.P[1].Callsign)
+		if trk, ok := tracks(cs); ok && trk.Groundspeed > 0 {
+			rb.ETA = 60 * rb.Distance / trk.Groundspeed
+		}
+	}
+
+	return rb, true
+}
+
+// PruneRangeBearingLines returns the lines whose endpoints can all still
+// be resolved, e.g. removing ones to aircraft that have landed.
+func PruneRangeBearingLines(rbls []RangeBearingLine, tracks TrackFunc) []RangeBearingLine {
+	return util.FilterSlice(rbls, func(rbl RangeBearingLine) bool {
+		_, ok0 := rbl.P[0].Resolve(tracks)
+		_, ok1 := rbl.P[1].Resolve(tracks)
+		return ok0 && ok1
+	})
+}
+
+///////////////////////////////////////////////////////////////////////////
+// ClosestApproach
+
+// ClosestApproach describes where two tracks will be closest if they
+// continue on their current courses.
+type ClosestApproach struct {
+	// Where each of them will be at the closest approach. If they are
+	// diverging, these are their current positions.
+	P0, P1   math.Point2LL
+	Distance float32 // nm
+	// Time until the closest approach; negative if it has passed.
+	Minutes float32
+}
+
+// Diverging returns whether the closest approach has already happened.
+func (ca ClosestApproach) Diverging() bool {
+	return ca.Minutes < 0
+}
+
+// MeasureClosestApproach linearly extrapolates the two tracks to find
+// their closest approach; false is returned if it can't be computed,
+// e.g. if they are on parallel courses at the same speed.
+func MeasureClosestApproach(t0, t1 MeasureTrack, nmPerLongitude float32) (ClosestApproach, bool) {
+	p0, d0 := math.LL2NM(t0.Position, nmPerLongitude), math.LL2NM(t0.Velocity, nmPerLongitude)
+	p1, d1 := math.LL2NM(t1.Position, nmPerLongitude), math.LL2NM(t1.Velocity, nmPerLongitude)
+
+	// Find the parametric distance along the respective rays of the
+	// aircrafts' courses where they at at a minimum distance.
+	tmin := math.RayRayMinimumDistance(p0, d0, p1, d1)
+	if gomath.IsInf(float64(tmin), 0) || gomath.IsNaN(float64(tmin)) {
+		return ClosestApproach{}, false
+	}
+
+	ca := ClosestApproach{Minutes: tmin}
+	if tmin < 0 {
+		ca.P0, ca.P1 = t0.Position, t1.Position
+	} else {
+		ca.P0 = math.NM2LL(math.Add2f(p0, math.Scale2f(d0, tmin)), nmPerLongitude)
+		ca.P1 = math.NM2LL(math.Add2f(p1, math.Scale2f(d1, tmin)), nmPerLongitude)
+	}
+	ca.Distance = math.NMDistance2LL(ca.P0, ca.P1)
+
+	return ca, true
+}
+
+///////////////////////////////////////////////////////////////////////////
+// RangeRings
+
+// RangeRings are concentric rings at a fixed spacing around a point.
+type RangeRings struct {
+	Center MeasurePoint
+	Radius float32 // nm between rings
+	Count  int
+}
+
+// Radii returns the radius in nm of each of the rings, innermost first.
+func (rr RangeRings) Radii() []float32 {
+	if rr.Radius <= 0 {
+		return nil
+	}
+	r := make([]float32, rr.Count)
+	for i := range r {
+		r[i] = float32(i+1) * rr.Radius
+	}
+	return r
+}
@@ -8,7 +8,9 @@ import (
 	"encoding/json"
 	"log/slog"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mmp/imgui-go/v4"
 	av "github.com/mmp/vice/pkg/aviation"
@@ -18,6 +20,7 @@ import (
 	"github.com/mmp/vice/pkg/renderer"
 	"github.com/mmp/vice/pkg/server"
 	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/speech"
 	"github.com/mmp/vice/pkg/util"
 )
 
@@ -26,6 +29,11 @@ type Message struct {
 	system   bool
 	error    bool
 	global   bool
+
+	// The aircraft the message is about and how it was referred to on
+	// the radio, so that the callsign can be anonymized when drawn.
+	callsign      string
+	radioCallsign string
 }
 
 var audioAlerts map[string]string = map[string]string{
@@ -38,12 +46,22 @@ type MessagesPane struct {
 	AudioAlertSelection        string
 	ContactTransmissionsAlert  bool
 	ReadbackTransmissionsAlert bool
+	SpeakTransmissions         bool
+	StepOnTransmissions        bool
+	SpeechInput                bool
+	PushToTalkFKey             int // 1-16
+	SendSpeechUnconfirmed      bool
+	LOAViolationAlerts         bool // instructors only
 
 	font            *renderer.Font
 	scrollbar       *ScrollBar
 	events          *sim.EventsSubscription
 	messages        []Message
 	alertAudioIndex map[string]int
+	speaker         *speech.Speaker
+	speechChannel   *speech.RadioChannel
+	speechErr       error
+	voice           voiceInput
 }
 
 func init() {
@@ -57,6 +75,7 @@ func init() {
 func NewMessagesPane() *MessagesPane {
 	return &MessagesPane{
 		FontIdentifier: renderer.FontIdentifier{Name: "Inconsolata Condensed Regular", Size: 16},
+		PushToTalkFKey: defaultPushToTalkFKey,
 	}
 }
 
@@ -73,6 +92,9 @@ func (mp *MessagesPane) Activate(r renderer.Renderer, p platform.Platform, event
 		mp.scrollbar = NewVerticalScrollBar(4, true)
 	}
 	mp.events = eventStream.Subscribe()
+	if mp.PushToTalkFKey < 1 || mp.PushToTalkFKey > 16 {
+		mp.PushToTalkFKey = defaultPushToTalkFKey
+	}
 
 	mp.alertAudioIndex = make(map[string]int)
 	for _, alert := range util.SortedMapKeys(audioAlerts) {
@@ -121,10 +143,68 @@ func (mp *MessagesPane) DrawUI(p platform.Platform, config *platform.Config) {
 	}
 	imgui.Checkbox("Play audio alert after pilot initial contact transmissions", &mp.ContactTransmissionsAlert)
 	imgui.Checkbox("Play audio alert after pilot readback transmissions", &mp.ReadbackTransmissionsAlert)
+	imgui.Checkbox("Show LOA violations when signed in as an instructor", &mp.LOAViolationAlerts)
+
+	imgui.Separator()
+	imgui.Checkbox("Speak pilot transmissions", &mp.SpeakTransmissions)
+	if mp.SpeakTransmissions {
+		if mp.speechErr != nil {
+			imgui.Text("Text-to-speech unavailable: " + mp.speechErr.Error())
+		}
+		if imgui.Checkbox("Allow pilots to step on each other's transmissions", &mp.StepOnTransmissions) &&
+			mp.speechChannel != nil {
+			mp.speechChannel.SetStepOnProbability(util.Select(mp.StepOnTransmissions, stepOnProbability, float32(0)))
+		}
+	}
+
+	imgui.Separator()
+	imgui.Checkbox("Issue clearances by voice", &mp.SpeechInput)
+	if mp.SpeechInput {
+		if mp.voice.err != nil {
+			imgui.Text("Speech recognition unavailable: " + mp.voice.err.Error())
+		}
+		if imgui.BeginComboV("Push-to-talk key", "F"+strconv.Itoa(mp.PushToTalkFKey), 0 /* flags */) {
+			for i := 1; i <= 16; i++ {
+				if imgui.SelectableV("F"+strconv.Itoa(i), i == mp.PushToTalkFKey, 0, imgui.Vec2{}) {
+					mp.PushToTalkFKey = i
+				}
+			}
+			imgui.EndCombo()
+		}
+		imgui.Checkbox("Send recognized clearances without confirmation", &mp.SendSpeechUnconfirmed)
+	}
+}
+
+// stepOnProbability is the probability that a pilot transmission made
+// while the frequency is in use steps on the one in progress when
+// MessagesPane.StepOnTransmissions is enabled.
+const stepOnProbability = 0.2
+
+// speak speaks a pilot transmission if text-to-speech is enabled,
+// creating the speaker the first time it is needed.
+func (mp *MessagesPane) speak(ctx *Context, callsign, text string) {
+	if !mp.SpeakTransmissions {
+		return
+	}
+	if mp.speaker == nil && mp.speechErr == nil {
+		b, err := speech.NewBackend("")
+		if err != nil {
+			ctx.Lg.Warnf("text-to-speech: %v", err)
+			mp.speechErr = err
+			return
+		}
+		mp.speechChannel = speech.NewRadioChannel(util.Select(mp.StepOnTransmissions, stepOnProbability, float32(0)),
+			uint64(time.Now().UnixNano()))
+		mp.speaker = speech.NewSpeaker(b, mp.speechChannel, 175, ctx.Platform.PlayPCM, ctx.Lg.Subsystem("speech"))
+	}
+	if mp.speaker != nil {
+		mp.speaker.Say(callsign, text)
+	}
 }
 
 func (mp *MessagesPane) Draw(ctx *Context, cb *renderer.CommandBuffer) {
 	mp.processEvents(ctx)
+	mp.processVoiceInput(ctx)
 
 	nLines := len(mp.messages) + 1 /* prompt */
 	lineHeight := float32(mp.font.Size + 1)
@@ -144,12 +224,19 @@ func (mp *MessagesPane) Draw(ctx *Context, cb *renderer.CommandBuffer) {
 	scrollOffset := mp.scrollbar.Offset()
 	y := lineHeight
 
+	if pending := mp.voice.pending; pending != nil {
+		// Recognized clearance awaiting confirmation
+		s := renderer.TextStyle{Font: mp.font, Color: renderer.RGB{0.1, 0.9, 0.9}}
+		td.AddText("VOICE: "+pending.String()+" [click: send, right-click: cancel]", [2]float32{indent, y}, s)
+		y += lineHeight
+	}
+
 	for i := scrollOffset; i < math.Min(len(mp.messages), visibleLines+scrollOffset+1); i++ {
 		// TODO? wrap text
 		msg := mp.messages[len(mp.messages)-1-i]
 
 		s := renderer.TextStyle{Font: mp.font, Color: msg.Color()}
-		td.AddText(msg.contents, [2]float32{indent, y}, s)
+		td.AddText(msg.displayContents(ctx), [2]float32{indent, y}, s)
 		y += lineHeight
 	}
 
@@ -200,6 +287,8 @@ func (mp *MessagesPane) processEvents(ctx *Context) {
 	}
 
 	for _, event := range consolidateRadioTransmissions(mp.events.Get()) {
+		first := len(mp.messages)
+
 		switch event.Type {
 		case sim.RadioTransmissionEvent:
 			// Collect multiple successive transmissions from the same
@@ -248,7 +337,11 @@ func (mp *MessagesPane) processEvents(ctx *Context) {
 					// Always refer to the controller as "departure" for departing aircraft.
 					name = strings.ReplaceAll(name, "approach", "departure")
 				}
-				msg = Message{contents: prefix + name + ", " + radioCallsign + ", " + event.Message}
+				msg = Message{contents: prefix + name + ", " + radioCallsign + ", " + event.Message,
+					callsign: event.Callsign, radioCallsign: radioCallsign}
+				if toUs {
+					mp.speak(ctx, event.Callsign, name+", "+radioCallsign+", "+event.Message)
+				}
 				if mp.ContactTransmissionsAlert {
 					ctx.Platform.PlayAudioOnce(mp.alertAudioIndex[mp.AudioAlertSelection])
 				}
@@ -257,7 +350,11 @@ func (mp *MessagesPane) processEvents(ctx *Context) {
 					event.Message = strings.ToUpper(event.Message[:1]) + event.Message[1:]
 				}
 				msg = Message{contents: prefix + event.Message + ". " + radioCallsign,
-					error: event.Type == av.RadioTransmissionUnexpected,
+					error:    event.Type == av.RadioTransmissionUnexpected,
+					callsign: event.Callsign, radioCallsign: radioCallsign,
+				}
+				if toUs {
+					mp.speak(ctx, event.Callsign, event.Message+". "+radioCallsign)
 				}
 				if mp.ReadbackTransmissionsAlert {
 					ctx.Platform.PlayAudioOnce(mp.alertAudioIndex[mp.AudioAlertSelection])
@@ -266,6 +363,16 @@ func (mp *MessagesPane) processEvents(ctx *Context) {
 			ctx.Lg.Debug("radio_transmission", slog.String("callsign", event.Callsign), slog.Any("message", msg))
 			mp.messages = append(mp.messages, msg)
 
+		case sim.PseudoPilotInstructionEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: "[" + event.FromController + "] " + event.Callsign + " " + event.Message,
+				})
+				if mp.ReadbackTransmissionsAlert {
+					ctx.Platform.PlayAudioOnce(mp.alertAudioIndex[mp.AudioAlertSelection])
+				}
+			}
+
 		case sim.GlobalMessageEvent:
 			if event.FromController != ctx.ControlClient.PrimaryTCP {
 				for _, line := range strings.Split(event.Message, "\n") {
@@ -273,6 +380,115 @@ func (mp *MessagesPane) processEvents(ctx *Context) {
 				}
 			}
 
+		case sim.RestrictionWarningEvent, sim.RestrictionMissedEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: event.Callsign + " " + event.Message,
+					error:    true,
+				})
+			}
+
+		case sim.AmbiguousTrackEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: "AMB: " + event.Callsign + " " + event.Message,
+					error:    true,
+				})
+			}
+
+		case sim.CallsignMismatchEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: "CALLSIGN MISMATCH: " + event.Callsign + " " + event.Message,
+					error:    true,
+				})
+			}
+
+		case sim.TCASRAEvent:
+			if ctx.ControlClient.State.AmInstructor() {
+				mp.messages = append(mp.messages, Message{
+					contents: "TCAS: " + event.Callsign + " " + event.Message,
+					error:    true,
+				})
+			}
+
+		case sim.TMIViolationEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: "TMI: " + event.Callsign + " " + event.Message,
+					error:    true,
+				})
+			}
+
+		case sim.WeatherDeviationEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: "WX: " + event.Callsign + " " + event.Message,
+					error:    true,
+				})
+			}
+
+		case sim.PriorityHandlingEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: "PRIORITY: " + event.Callsign + " " + event.Message,
+					error:    true,
+				})
+			}
+
+		case sim.RejectedHandoffEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: "HO REJECTED: " + event.FromController + " " + event.Callsign + " " + event.Message,
+					error:    true,
+				})
+			}
+
+		case sim.PointOutSuggestionEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: "PO: " + event.Callsign + " " + event.Message,
+					system:   true,
+				})
+			}
+
+		case sim.MissedPointOutEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: "PO: " + event.Callsign + " " + event.Message,
+					error:    true,
+				})
+			}
+
+		case sim.AirspaceViolationEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: "AV: " + event.Callsign + " " + event.Message,
+					error:    true,
+				})
+			}
+
+		case sim.CoordinationEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{
+					contents: "[" + event.FromController + "] " + event.Callsign + " " + event.Message,
+				})
+				mp.speak(ctx, event.FromController, event.Callsign+", "+event.Message)
+			}
+
+		case sim.PIREPEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				mp.messages = append(mp.messages, Message{contents: "PIREP: " + event.Message})
+			}
+
+		case sim.LOAViolationEvent:
+			if mp.LOAViolationAlerts && ctx.ControlClient.State.AmInstructor() {
+				mp.messages = append(mp.messages, Message{
+					contents: "LOA: " + event.ToController + " " + event.Callsign + " " + event.Message,
+					error:    true,
+				})
+			}
+
 		case sim.StatusMessageEvent:
 			// Don't spam the same message repeatedly; look in the most recent 5.
 			n := len(mp.messages)
@@ -286,5 +502,30 @@ func (mp *MessagesPane) processEvents(ctx *Context) {
 					})
 			}
 		}
+
+		if event.Callsign != "" {
+			for i := first; i < len(mp.messages); i++ {
+				if mp.messages[i].callsign == "" && strings.Contains(mp.messages[i].contents, event.Callsign) {
+					mp.messages[i].callsign = event.Callsign
+				}
+			}
+		}
+	}
+}
+
+// displayContents returns the message's text as it should be drawn, with
+// the aircraft's callsign replaced if it's being anonymized.
+func (msg Message) displayContents(ctx *Context) string {
+	if msg.callsign == "" {
+		return msg.contents
+	}
+	dc := ctx.DisplayCallsign(msg.callsign)
+	if dc == msg.callsign {
+		return msg.contents
+	}
+	s := msg.contents
+	if msg.radioCallsign != "" {
+		s = strings.ReplaceAll(s, msg.radioCallsign, dc)
 	}
+	return strings.ReplaceAll(s, msg.callsign, dc)
 }
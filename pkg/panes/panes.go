@@ -87,6 +87,9 @@ type Context struct {
 
 	// Full display size, including the menu and status bar.
 	displaySize [2]float32
+
+	// Set if the pane is being captured in this frame; see capture.go.
+	capture *Capture
 }
 
 func (ctx *Context) InitializeMouse(p platform.Platform) {
@@ -0,0 +1,155 @@
+// pkg/panes/plugin.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package panes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mmp/imgui-go/v4"
+	"github.com/mmp/vice/pkg/log"
+)
+
+// Third parties can provide their own panes--say, a facility-specific
+// coordination tool--as Go plugins, without changes to vice itself. A
+// plugin is a main package built with "go build -buildmode=plugin"
+// against the same version of vice (Go requires that a plugin and the
+// program loading it were built with the same versions of the packages
+// they share) that exports:
+//
+//	var VicePlugin = panes.PluginInfo{
+//	    Name:       "Coordination",
+//	    APIVersion: panes.PluginAPIVersion,
+//	    NewPane:    func() panes.Pane { return &CoordinationPane{} },
+//	}
+//
+// Plugins are loaded at startup from the "plugins" directory in vice's
+// configuration directory. Their panes implement Pane like the built-in
+// ones do: they see the latest world update through
+// Context.ControlClient, receive events via the EventStream that they're
+// given in Activate, and draw by adding commands to the CommandBuffer
+// passed to Draw. They may implement UIDrawer to have a section in the
+// settings window. A pane for each plugin is added to the layout
+// automatically; it's hidden until it's shown in the settings window.
+//
+// The exported fields of plugin panes are saved in the configuration
+// like those of other panes; if the plugin isn't present when vice next
+// starts, its pane is replaced with an EmptyPane.
+
+// PluginAPIVersion is incremented whenever a change to the interfaces
+// that plugins use would break existing ones; plugins built for another
+// version aren't loaded.
+const PluginAPIVersion = 1
+
+// PluginInfo describes a plugin; plugins export one named VicePlugin.
+type PluginInfo struct {
+	Name       string
+	APIVersion int
+	// NewPane returns a new instance of the plugin's pane with its
+	// default settings.
+	NewPane func() Pane
+}
+
+var (
+	ErrPluginsUnsupported = errors.New("Plugins are not supported on this platform")
+	ErrPluginVersion      = errors.New("Plugin was built for a different version of vice")
+)
+
+var plugins []*PluginInfo
+
+// LoadPlugins loads the plugins in the given directory; errors are
+// logged and those plugins are skipped. It must be called before the
+// configuration is loaded so that the plugins' panes can be unmarshaled.
+func LoadPlugins(dir string, lg *log.Logger) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		// Most users won't have any.
+		return
+	}
+
+	for _, entry := range entries {
+		if ext := filepath.Ext(entry.Name()); entry.IsDir() || (ext != ".so" && ext != ".dylib") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if info, err := openPlugin(path); err != nil {
+			lg.Errorf("%s: %v", path, err)
+		} else if err := registerPlugin(info); err != nil {
+			lg.Errorf("%s: %v", path, err)
+		} else {
+			lg.Infof("%s: loaded plugin %q", path, info.Name)
+		}
+	}
+}
+
+func registerPlugin(info *PluginInfo) error {
+	if info.APIVersion != PluginAPIVersion {
+		return fmt.Errorf("%w (API version %d; expected %d)", ErrPluginVersion, info.APIVersion, PluginAPIVersion)
+	}
+	if info.NewPane == nil {
+		return fmt.Errorf("%s: NewPane not provided", info.Name)
+	}
+
+	// Panes are saved with the name of their type (see
+	// DisplayNode.MarshalJSON), so it must be distinct from the others'.
+	name := paneTypeName(info.NewPane())
+	if _, ok := paneUnmarshalRegistry[name]; ok {
+		return fmt.Errorf("%s: pane type %s is already registered", info.Name, name)
+	}
+	RegisterUnmarshalPane(name, func(d []byte) (Pane, error) {
+		p := info.NewPane()
+		err := json.Unmarshal(d, p)
+		return p, err
+	})
+
+	plugins = append(plugins, info)
+	return nil
+}
+
+// paneTypeName returns the name that the pane is registered under, e.g.,
+// "MessagesPane" for a *panes.MessagesPane.
+func paneTypeName(p Pane) string {
+	_, name, _ := strings.Cut(fmt.Sprintf("%T", p), ".")
+	return name
+}
+
+// addPluginPanes adds a pane for each plugin that doesn't have one in the
+// display hierarchy; it's hidden until the user shows it.
+func addPluginPanes(root *DisplayNode) {
+	for _, info := range plugins {
+		if node := addHiddenPane(root, info.NewPane()); node != nil {
+			node.Hidden = true
+		}
+	}
+}
+
+// DrawPluginUI draws the section of the settings window that controls
+// which of the plugins' panes are shown.
+func DrawPluginUI(root *DisplayNode) {
+	if len(plugins) == 0 || !imgui.CollapsingHeader("Plugins") {
+		return
+	}
+
+	for _, info := range plugins {
+		name := paneTypeName(info.NewPane())
+		var node *DisplayNode
+		root.VisitPanes(func(p Pane) {
+			if paneTypeName(p) == name {
+				node = root.NodeForPane(p)
+			}
+		})
+		if node != nil {
+			show := !node.Hidden
+			if imgui.Checkbox("Show "+info.Name, &show) {
+				node.Hidden = !show
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// pkg/panes/plugin_other.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+//go:build !windows
+
+package panes
+
+import (
+	"fmt"
+	"plugin"
+)
+
+func openPlugin(path string) (*PluginInfo, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("VicePlugin")
+	if err != nil {
+		return nil, err
+	}
+	info, ok := sym.(*PluginInfo)
+	if !ok {
+		return nil, fmt.Errorf("VicePlugin is a %T, not a panes.PluginInfo", sym)
+	}
+	return info, nil
+}
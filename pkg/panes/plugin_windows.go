@@ -0,0 +1,10 @@
+// pkg/panes/plugin_windows.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package panes
+
+// Go doesn't support plugins on Windows.
+func openPlugin(path string) (*PluginInfo, error) {
+	return nil, ErrPluginsUnsupported
+}
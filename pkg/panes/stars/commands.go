@@ -17,9 +17,12 @@ import (
 	"github.com/mmp/vice/pkg/math"
 	"github.com/mmp/vice/pkg/panes"
 	"github.com/mmp/vice/pkg/platform"
+	"github.com/mmp/vice/pkg/rand"
 	"github.com/mmp/vice/pkg/renderer"
 	"github.com/mmp/vice/pkg/server"
 	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/speech"
+	starscmd "github.com/mmp/vice/pkg/stars"
 	"github.com/mmp/vice/pkg/util"
 
 	"github.com/davecgh/go-spew/spew"
@@ -158,6 +161,8 @@ func (sp *STARSPane) processKeyboardInput(ctx *panes.Context) {
 		return
 	}
 
+	sp.processKeyBindings(ctx)
+
 	input := strings.ToUpper(ctx.Keyboard.Input)
 	if sp.commandMode == CommandModeMultiFunc && sp.multiFuncPrefix == "" && len(input) > 0 {
 		sp.multiFuncPrefix = string(input[0])
@@ -462,6 +467,16 @@ func (sp *STARSPane) executeSTARSCommand(cmd string, ctx *panes.Context) (status
 			status.clear = true
 			return
 
+		case "?BCN":
+			// Debugging: report beacon code leaks and other accounting problems.
+			problems := ctx.ControlClient.State.ERAMComputers.SquawkProblems(ctx.ControlClient.Aircraft)
+			for _, p := range problems {
+				ctx.Lg.Warn("beacon code problem", slog.String("problem", p))
+			}
+			status.clear = true
+			status.output = fmt.Sprintf("%d BCN PROBLEMS", len(problems))
+			return
+
 		case "CR":
 			if sp.capture.enabled && (sp.capture.specifyingRegion || sp.capture.haveRegion) {
 				sp.capture.specifyingRegion = false
@@ -556,7 +571,7 @@ func (sp *STARSPane) executeSTARSCommand(cmd string, ctx *panes.Context) (status
 					sp.wipRBL = nil
 					status.clear = true
 				} else {
-					sp.wipRBL = &STARSRangeBearingLine{}
+					sp.wipRBL = &panes.RangeBearingLine{}
 					sp.wipRBL.P[0].Loc = p
 					sp.scopeClickHandler = rblSecondClickHandler(ctx, sp)
 					sp.previewAreaInput = "*T" // set up for the second point
@@ -617,14 +632,16 @@ func (sp *STARSPane) executeSTARSCommand(cmd string, ctx *panes.Context) (status
 				return
 			} else {
 				// Is it an abbreviated flight plan?
-				fp, err := sim.MakeSTARSFlightPlanFromAbbreviated(cmd, ctx.ControlClient.STARSComputer(),
-					ctx.ControlClient.STARSFacilityAdaptation)
+				r := rand.New()
+				r.Seed(uint64(time.Now().UnixNano()))
+				fp, err := starscmd.MakeFlightPlanFromAbbreviated(cmd, ctx.ControlClient.STARSComputer(),
+					ctx.ControlClient.STARSFacilityAdaptation, &r)
 				if fp != nil {
 					ctx.ControlClient.UploadFlightPlan(fp, av.LocalNonEnroute, nil,
 						func(err error) { sp.displayError(err, ctx) })
 					status.output = fmt.Sprintf("%v%v%v %04o\nNO ROUTE %v", fp.Callsign,
 						util.Select(fp.AircraftType != "", " ", ""), fp.AircraftType, fp.AssignedSquawk,
-						util.Select(fp.Altitude != "VFR", fp.Altitude, ""))
+						util.Select(fp.Altitude.HasAltitude(), fp.Altitude.String(), ""))
 				}
 				status.clear = err == nil
 				status.err = err
@@ -727,8 +744,13 @@ func (sp *STARSPane) executeSTARSCommand(cmd string, ctx *panes.Context) (status
 		}
 
 	case CommandModeVFRPlan:
-		// TODO
-		status.err = ErrSTARSCommandFormat
+		// Local flight plan for an aircraft calling in VFR.
+		if ac := ctx.ControlClient.State.Aircraft[cmd]; ac == nil {
+			status.err = ErrSTARSNoFlight
+		} else {
+			sp.createLocalFlightPlan(ctx, ac.Callsign)
+			status.clear = true
+		}
 		return
 
 	case CommandModeMultiFunc:
@@ -797,6 +819,41 @@ func (sp *STARSPane) executeSTARSCommand(cmd string, ctx *panes.Context) (status
 				return
 			}
 
+		case "C":
+			// Position consolidation: C lists the positions we have
+			// consolidated, C(tcp) consolidates a position, and X (tcp)
+			// splits it off again. CS lists the sectorizations and CS
+			// (name) resectorizes the airspace.
+			if cmd == "" {
+				status.output = ctx.ControlClient.State.ConsolidatedPositionsString(ctx.ControlClient.PrimaryTCP)
+				if status.output == "" {
+					status.output = "NONE"
+				}
+				status.clear = true
+			} else if cmd == "S" {
+				var names []string
+				for _, name := range util.SortedMapKeys(ctx.ControlClient.State.Sectorizations) {
+					if name == ctx.ControlClient.State.Sectorization {
+						name = "*" + name
+					}
+					names = append(names, strings.ToUpper(name))
+				}
+				status.output = util.Select(len(names) == 0, "NONE", strings.Join(names, " "))
+				status.clear = true
+			} else if name, ok := strings.CutPrefix(cmd, "S "); ok {
+				ctx.ControlClient.Resectorize(name, nil, func(err error) { sp.displayError(err, ctx) })
+				status.clear = true
+			} else if pos, ok := strings.CutPrefix(cmd, "X "); ok {
+				ctx.ControlClient.SplitPosition(pos, nil, func(err error) { sp.displayError(err, ctx) })
+				status.clear = true
+			} else if strings.Contains(cmd, " ") {
+				status.err = ErrSTARSCommandFormat
+			} else {
+				ctx.ControlClient.ConsolidatePosition(cmd, nil, func(err error) { sp.displayError(err, ctx) })
+				status.clear = true
+			}
+			return
+
 		case "D":
 			if cmd == "E" {
 				ps.DwellMode = DwellModeOn
@@ -850,44 +907,26 @@ func (sp *STARSPane) executeSTARSCommand(cmd string, ctx *panes.Context) (status
 				return
 			} else if cmd[0] == 'C' {
 				// FC(low associated)(high associated)
-				if len(cmd[1:]) != 6 {
-					status.err = ErrSTARSCommandFormat
-				} else if digits, err := strconv.Atoi(cmd[1:]); err == nil {
-					// TODO: validation?
-					// The first three digits give the low altitude in 100s of feet
-					af.Associated[0] = (digits / 1000) * 100
-					// And the last three give the high altitude in 100s of feet
-					af.Associated[1] = (digits % 1000) * 100
+				if assoc, err := parseAltitudeFilter(cmd[1:]); err != nil {
+					status.err = err
 				} else {
-					status.err = ErrSTARSIllegalParam
+					af.Associated = assoc
+					status.clear = true
 				}
-				status.clear = true
 				return
 			} else {
 				// F(low unassociated)(high unassociated) (low associated)(high associated)
-				if len(cmd) != 13 {
+				if len(cmd) != 13 || cmd[6] != ' ' {
 					status.err = ErrSTARSCommandFormat
+				} else if unassoc, err := parseAltitudeFilter(cmd[0:6]); err != nil {
+					status.err = err
+				} else if assoc, err := parseAltitudeFilter(cmd[7:13]); err != nil {
+					status.err = err
 				} else {
-					unassoc, assoc := cmd[0:6], cmd[7:13]
-					if digits, err := strconv.Atoi(unassoc); err == nil {
-						// TODO: more validation?
-						af.Unassociated[0] = (digits / 1000) * 100
-						// And the last three give the high altitude in 100s of feet
-						af.Unassociated[1] = (digits % 1000) * 100
-
-						if digits, err := strconv.Atoi(assoc); err == nil {
-							// TODO: more validation?
-							af.Associated[0] = (digits / 1000) * 100
-							// And the last three give the high altitude in 100s of feet
-							af.Associated[1] = (digits % 1000) * 100
-						} else {
-							status.err = ErrSTARSIllegalParam
-						}
-					} else {
-						status.err = ErrSTARSIllegalParam
-					}
+					// Only update them if both are valid.
+					af.Unassociated, af.Associated = unassoc, assoc
+					status.clear = true
 				}
-				status.clear = true
 				return
 			}
 
@@ -1666,6 +1705,7 @@ func (sp *STARSPane) executeSTARSCommand(cmd string, ctx *panes.Context) (status
 				p.Name = cmd
 				sp.prefSet.Selected = &idx
 				sp.prefSet.Saved[idx] = p
+				sp.preferenceSetsChanged = true
 				status.clear = true
 			}
 		}
@@ -1687,7 +1727,12 @@ func (sp *STARSPane) executeSTARSCommand(cmd string, ctx *panes.Context) (status
 				cmd = cmd[:n-1]
 			}
 
-			if idx, err := strconv.Atoi(cmd); err != nil {
+			if cat := slices.Index(videoMapCategoryNames[:], cmd); cmd != "" && cat != -1 {
+				// Inhibit or enable display of all of the maps in a category.
+				hidden := &ps.HiddenVideoMapCategories[cat]
+				*hidden = util.Select(op == "T", !*hidden, op == "I")
+				status.clear = true
+			} else if idx, err := strconv.Atoi(cmd); err != nil {
 				status.err = ErrSTARSCommandFormat
 			} else if idx <= 0 {
 				status.err = ErrSTARSIllegalMap
@@ -2176,7 +2221,21 @@ func (sp *STARSPane) maybeAutoHomeCursor(ctx *panes.Context) {
 }
 
 func (sp *STARSPane) runAircraftCommands(ctx *panes.Context, ac *av.Aircraft, cmds string) {
-	ctx.ControlClient.RunAircraftCommands(ac.Callsign, cmds,
+	// Instructions may also be written out in words, in which case
+	// they're checked against standard phraseology.
+	var nonstandard []string
+	if speech.IsPhraseology(cmds) {
+		cl, err := speech.ParseClearance(ac.Callsign+" "+cmds, []speech.AircraftGrammar{ctx.ClearanceGrammar(ac)})
+		if err != nil {
+			sp.commandMode = CommandModeTargetGen
+			sp.previewAreaInput = cmds
+			sp.displayError(ErrSTARSCommandFormat, ctx)
+			return
+		}
+		cmds, nonstandard = strings.Join(cl.Commands, " "), cl.Nonstandard
+	}
+
+	ctx.ControlClient.IssueClearance(ac.Callsign, cmds, nonstandard,
 		func(errStr string, remaining string) {
 			if errStr != "" {
 				sp.commandMode = CommandModeTargetGen
@@ -2201,6 +2260,25 @@ func (sp *STARSPane) setWIPRestrictionArea(ctx *panes.Context, ra *av.Restrictio
 	sp.wipRestrictionAreaMouseMoved = false
 }
 
+// parseAltitudeFilter parses an altitude filter entry: three digits for
+// the low altitude in 100s of feet followed by three for the high one.
+func parseAltitudeFilter(s string) ([2]int, error) {
+	if len(s) != 6 {
+		return [2]int{}, ErrSTARSCommandFormat
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return [2]int{}, ErrSTARSIllegalParam
+		}
+	}
+	low, _ := strconv.Atoi(s[:3])
+	high, _ := strconv.Atoi(s[3:])
+	if low > high {
+		return [2]int{}, ErrSTARSIllegalParam
+	}
+	return [2]int{low * 100, high * 100}, nil
+}
+
 func tryConsumeInt(cmd string) (string, int, bool) {
 	idx := strings.IndexFunc(cmd, func(r rune) bool { return r < '0' || r > '9' })
 	if idx == 0 {
@@ -2633,6 +2711,16 @@ func (sp *STARSPane) initiateTrack(ctx *panes.Context, callsign string) error {
 	return nil
 }
 
+func (sp *STARSPane) createLocalFlightPlan(ctx *panes.Context, callsign string) {
+	ctx.ControlClient.CreateLocalFlightPlan(callsign,
+		func(any) {
+			if ac, ok := ctx.ControlClient.Aircraft[callsign]; ok {
+				sp.previewAreaOutput, _ = sp.flightPlanSTARS(ctx, ac)
+			}
+		},
+		func(err error) { sp.displayError(err, ctx) })
+}
+
 func (sp *STARSPane) dropTrack(ctx *panes.Context, callsign string) {
 	ctx.ControlClient.DropTrack(callsign, nil, func(err error) { sp.displayError(err, ctx) })
 }
@@ -2911,290 +2999,17 @@ func (sp *STARSPane) executeSTARSClickedCommand(ctx *panes.Context, cmd string,
 					status.output = slewAircaft(ac)
 				}
 
-			} else if cmd == "." {
-				if err := sp.setScratchpad(ctx, ac.Callsign, "", false, true); err != nil {
-					status.err = err
-				} else {
-					status.clear = true
-				}
-				return
-			} else if cmd == "+" {
-				if err := sp.setScratchpad(ctx, ac.Callsign, "", true, true); err != nil {
-					status.err = err
-				} else {
-					status.clear = true
-				}
-				return
-			} else if cmd == "*" {
-				from := sp.Aircraft[ac.Callsign].TrackPosition()
-				sp.scopeClickHandler = func(pw [2]float32, transforms ScopeTransformations) (status CommandStatus) {
-					p := transforms.LatLongFromWindowP(pw)
-					hdg := math.Heading2LL(from, p, ac.NmPerLongitude(), ac.MagneticVariation())
-					dist := math.NMDistance2LL(from, p)
-
-					status.output = fmt.Sprintf("%03d/%.2f", int(hdg+.5), dist)
-					status.clear = true
-					return
-				}
-				return
 			} else if trySetLeaderLine(cmd) {
 				status.clear = true
 				return
-			} else if cmd == "?" {
-				ctx.Lg.Info("print aircraft", slog.String("callsign", ac.Callsign),
-					slog.Any("aircraft", ac))
-				fmt.Println(spew.Sdump(ac) + "\n" + ac.Nav.FlightState.Summary())
-				status.clear = true
-				return
-			} else if cmd == "*F" {
-				// 6-148 range/bearing to significant point
-				p := state.TrackPosition()
-				sp.wipSignificantPoint = &p
-				sp.scopeClickHandler = toSignificantPointClickHandler(ctx, sp)
-				sp.previewAreaInput += " " // sort of a hack: if the fix is entered via keyboard, it appears on the next line
-				return
-			} else if cmd == "*J" {
-				// remove j-ring for aircraft
-				state.JRingRadius = 0
-				status.clear = true
-				return
-			} else if cmd == "*P" {
-				// remove cone for aircraft
-				state.ConeLength = 0
-				status.clear = true
-				return
-			} else if cmd == "*T" {
-				// range bearing line
-				sp.wipRBL = &STARSRangeBearingLine{}
-				sp.wipRBL.P[0].Callsign = ac.Callsign
-				sp.scopeClickHandler = rblSecondClickHandler(ctx, sp)
-				// Do not clear the input area to allow entering a fix for the second location
-				return
 			} else if ctx.ControlClient.StringIsSPC(cmd) {
 				state.SPCAcknowledged = false
 				ctx.ControlClient.ToggleSPCOverride(ac.Callsign, cmd, nil,
 					func(err error) { sp.displayError(err, ctx) })
 				status.clear = true
 				return
-			} else if cmd == "UN" {
-				ctx.ControlClient.RejectPointOut(ac.Callsign, nil,
-					func(err error) { sp.displayError(err, ctx) })
-				status.clear = true
-				return
-			} else if lc := len(cmd); lc >= 2 && cmd[0:2] == "**" { // Force QL. You need to specify a TCP unless otherwise specified in STARS config
-				// STARS Manual 6-70 (On slew). Cannot go interfacility
-				// TODO: Or can be used to accept a pointout as a handoff.
-
-				if cmd == "**" { // Non specified TCP
-					if ctx.ControlClient.STARSFacilityAdaptation.ForceQLToSelf && trk.TrackOwner == ctx.ControlClient.PrimaryTCP {
-						state.ForceQL = true
-						status.clear = true
-						return
-					} else {
-						status.err = ErrSTARSIllegalPosition
-						return
-					}
-				} else {
-					tcps := strings.Split(cmd[2:], " ")
-					if len(tcps) > 0 && tcps[0] == "ALL" {
-						// Force QL for all TCP
-						// Find user fac
-						if ctrl, ok := ctx.ControlClient.Controllers[ctx.ControlClient.PrimaryTCP]; ok && !ctrl.ERAMFacility {
-							sp.forceQL(ctx, ac.Callsign, ctx.ControlClient.PrimaryTCP)
-						}
-					}
-					for _, tcp := range tcps {
-						control := sp.lookupControllerForId(ctx, tcp, ac.Callsign)
-						if control == nil {
-							status.err = ErrSTARSIllegalPosition
-							return
-						}
-						sp.forceQL(ctx, ac.Callsign, control.Id())
-					}
-					status.clear = true
-					return
-				}
-
-			} else if cmd == "*D+" {
-				// TODO: this and the following two should give ILL FNCT if
-				// there's no j-ring/[A]TPA cone being displayed for the
-				// track (6-173).
-
-				// toggle TPA size display
-				if state.DisplayTPASize == nil {
-					b := ps.DisplayTPASize // new variable; don't alias ps.DisplayTPASize!
-					state.DisplayTPASize = &b
-				}
-				*state.DisplayTPASize = !*state.DisplayTPASize
-				status.clear = true
-				return
-			} else if cmd == "*D+E" {
-				// enable TPA size display
-				b := true
-				state.DisplayTPASize = &b
-				status.clear = true
-				return
-			} else if cmd == "*D+I" {
-				// inhibit TPA size display
-				b := false
-				state.DisplayTPASize = &b
-				status.clear = true
-				return
-			} else if cmd == "*AE" {
-				// Enable ATPA warning/alert cones for the track
-				// TODO: for this and *AI and the two *B commands below, we
-				// should issue an error if not IFR, not displaying FDB, or
-				// not in ATPA approach volume (6-176).
-				b := true
-				state.DisplayATPAWarnAlert = &b
-				status.clear = true
-				return
-			} else if cmd == "*AI" {
-				// Inhibit ATPA warning/alert cones for the track
-				b := false
-				state.DisplayATPAWarnAlert = &b
-				status.clear = true
-				return
-			} else if cmd == "*BE" {
-				// Enable ATPA monitor cones for the track
-				b := true
-				state.DisplayATPAMonitor = &b
-				status.clear = true
-				return
-			} else if cmd == "*BI" {
-				// Inhibit ATPA monitor cones for the track
-				b := false
-				state.DisplayATPAMonitor = &b
-				status.clear = true
-				return
-			} else if alt, err := strconv.Atoi(cmd); err == nil && len(cmd) == 3 {
-				sp.setPilotReportedAltitude(ctx, ac.Callsign, alt)
-				status.clear = true
-				return
-			} else if len(cmd) == 5 && cmd[:2] == "++" {
-				if alt, err := strconv.Atoi(cmd[2:]); err == nil {
-					status.err = amendFlightPlan(ctx, ac.Callsign, func(fp *av.FlightPlan) {
-						fp.Altitude = alt * 100
-					})
-					status.clear = true
-				} else {
-					status.err = ErrSTARSCommandFormat
-				}
-				return
-			} else if len(cmd) >= 2 && cmd[0] == '+' {
-				if alt, err := strconv.Atoi(cmd[1:]); err == nil {
-					sp.setTemporaryAltitude(ctx, ac.Callsign, alt*100)
-					status.clear = true
-				} else {
-					if err := sp.setScratchpad(ctx, ac.Callsign, cmd[1:], true, true); err != nil {
-						status.err = err
-					} else {
-						status.clear = true
-					}
-				}
-				return
-			} else if cmd == ".ROUTE" {
-				sp.drawRouteAircraft = ac.Callsign
-				status.clear = true
-				return
-			} else if len(cmd) > 2 && cmd[:2] == "*J" {
-				if r, err := strconv.Atoi(cmd[2:]); err == nil {
-					if r < 1 || r > 30 {
-						status.err = ErrSTARSIllegalValue
-					} else {
-						state.JRingRadius = float32(r)
-						state.ConeLength = 0 // can't have both
-					}
-					status.clear = true
-				} else if r, err := strconv.ParseFloat(cmd[2:], 32); err == nil {
-					if r < 1 || r > 30 {
-						status.err = ErrSTARSIllegalValue
-					} else {
-						state.JRingRadius = float32(r)
-						state.ConeLength = 0 // can't have both
-					}
-					status.clear = true
-				} else {
-					status.err = ErrSTARSIllegalParam
-				}
-				return
-			} else if len(cmd) > 2 && cmd[:2] == "*P" {
-				if r, err := strconv.Atoi(cmd[2:]); err == nil {
-					if r < 1 || r > 30 {
-						status.err = ErrSTARSIllegalValue
-					} else {
-						state.ConeLength = float32(r)
-						state.JRingRadius = 0 // can't have both
-					}
-					status.clear = true
-				} else if r, err := strconv.ParseFloat(cmd[2:], 32); err == nil {
-					if r < 1 || r > 30 {
-						status.err = ErrSTARSIllegalValue
-					} else {
-						state.ConeLength = float32(r)
-						state.JRingRadius = 0 // can't have both
-					}
-					status.clear = true
-				} else {
-					status.err = ErrSTARSIllegalParam
-				}
-				return
-			} else if lc := len(cmd); lc >= 2 && cmd[lc-1] == '*' { // Some sort of pointout
-				// First check for errors. (Manual 6-64, 6-73)
-
-				// TODO: if it's to a different facility and it's an arrival, ILL TRK
-
-				// Check if being handed off, pointed out or suspended (TODO suspended)
-				if _, ok := sp.PointOuts[ac.Callsign]; ok {
-					status.err = ErrSTARSIllegalTrack
-					return
-				}
-				if ac.HandoffTrackController != "" && ac.HandoffTrackController != ctx.ControlClient.PrimaryTCP {
-					status.err = ErrSTARSIllegalTrack
-					return
-				}
-
-				control := sp.lookupControllerForId(ctx, strings.TrimSuffix(cmd, "*"), ac.Callsign)
-				if control == nil {
-					status.err = ErrSTARSIllegalPosition
-				} else {
-					status.clear = true
-					sp.pointOut(ctx, ac.Callsign, control.Id())
-				}
-				return
-
-			} else if len(cmd) > 0 {
-				// If it matches the callsign, attempt to initiate track.
-				if cmd == ac.Callsign {
-					if err := sp.initiateTrack(ctx, ac.Callsign); err != nil {
-						status.err = err
-					} else {
-						status.clear = true
-					}
-					return
-				}
-
-				// See if cmd works as a sector id; if so, make it a handoff.
-				control := sp.lookupControllerForId(ctx, cmd, ac.Callsign)
-				if control != nil {
-					if ac.HandoffTrackController == ctx.ControlClient.PrimaryTCP ||
-						ac.RedirectedHandoff.RedirectedTo == ctx.ControlClient.PrimaryTCP { // Redirect
-						sp.redirectHandoff(ctx, ac.Callsign, control.Id())
-						status.clear = true
-					} else if err := sp.handoffTrack(ctx, ac.Callsign, cmd); err == nil {
-						status.clear = true
-					} else {
-						status.err = err
-					}
-				} else {
-					// Try setting the scratchpad
-					if err := sp.setScratchpad(ctx, ac.Callsign, cmd, false, true); err != nil {
-						status.err = err
-					} else {
-						status.clear = true
-					}
-				}
-				return
+			} else {
+				return sp.executeSlewCommand(ctx, ac, cmd)
 			}
 
 		case CommandModeInitiateControl:
@@ -3232,8 +3047,12 @@ func (sp *STARSPane) executeSTARSClickedCommand(ctx *panes.Context, cmd string,
 			return
 
 		case CommandModeVFRPlan:
-			// TODO: implement
-			status.err = ErrSTARSCommandFormat
+			if cmd != "" {
+				status.err = ErrSTARSCommandFormat
+			} else {
+				sp.createLocalFlightPlan(ctx, ac.Callsign)
+				status.clear = true
+			}
 			return
 
 		case CommandModeMultiFunc:
@@ -3248,6 +3067,12 @@ func (sp *STARSPane) executeSTARSClickedCommand(ctx *panes.Context, cmd string,
 						state.DisplayLDBBeaconCode = !state.DisplayLDBBeaconCode
 					}
 					status.clear = true
+				} else if cmd == "R" {
+					// Reassign the flight plan to the code the aircraft is
+					// squawking.
+					ctx.ControlClient.ReassignBeaconCode(ac.Callsign, nil,
+						func(err error) { sp.displayError(err, ctx) })
+					status.clear = true
 				} else {
 					status.err = ErrSTARSCommandFormat
 				}
@@ -3519,7 +3344,7 @@ func (sp *STARSPane) executeSTARSClickedCommand(ctx *panes.Context, cmd string,
 			sp.previewAreaInput += " " // sort of a hack: if the fix is entered via keyboard, it appears on the next line
 			return
 		} else if cmd == "*T" {
-			sp.wipRBL = &STARSRangeBearingLine{}
+			sp.wipRBL = &panes.RangeBearingLine{}
 			sp.wipRBL.P[0].Loc = transforms.LatLongFromWindowP(mousePosition)
 			sp.scopeClickHandler = rblSecondClickHandler(ctx, sp)
 			return
@@ -3751,6 +3576,224 @@ func (sp *STARSPane) executeSTARSClickedCommand(ctx *panes.Context, cmd string,
 	return
 }
 
+// executeSlewCommand handles the commands that are entered and then
+// followed by clicking on a track; the input is parsed by the stars
+// package and carried out here.
+func (sp *STARSPane) executeSlewCommand(ctx *panes.Context, ac *av.Aircraft, cmd string) (status CommandStatus) {
+	slew, err := starscmd.ParseSlew(cmd)
+	if err != nil {
+		status.err = err
+		return
+	}
+
+	ps := sp.currentPrefs()
+	state := sp.Aircraft[ac.Callsign]
+	trk := sp.getTrack(ctx, ac)
+
+	setScratchpad := func(contents string, isSecondary bool) {
+		if err := sp.setScratchpad(ctx, ac.Callsign, contents, isSecondary, true); err != nil {
+			status.err = err
+		} else {
+			status.clear = true
+		}
+	}
+
+	switch slew.Command {
+	case starscmd.SlewClearScratchpad:
+		setScratchpad("", false)
+
+	case starscmd.SlewClearSecondaryScratchpad:
+		setScratchpad("", true)
+
+	case starscmd.SlewSecondaryScratchpad:
+		setScratchpad(slew.Text, true)
+
+	case starscmd.SlewRangeBearing:
+		from := state.TrackPosition()
+		sp.scopeClickHandler = func(pw [2]float32, transforms ScopeTransformations) (status CommandStatus) {
+			p := transforms.LatLongFromWindowP(pw)
+			hdg := math.Heading2LL(from, p, ac.NmPerLongitude(), ac.MagneticVariation())
+			dist := math.NMDistance2LL(from, p)
+
+			status.output = fmt.Sprintf("%03d/%.2f", int(hdg+.5), dist)
+			status.clear = true
+			return
+		}
+
+	case starscmd.SlewDump:
+		ctx.Lg.Info("print aircraft", slog.String("callsign", ac.Callsign),
+			slog.Any("aircraft", ac))
+		fmt.Println(spew.Sdump(ac) + "\n" + ac.Nav.FlightState.Summary())
+		status.clear = true
+
+	case starscmd.SlewRangeBearingToFix:
+		// 6-148 range/bearing to significant point
+		p := state.TrackPosition()
+		sp.wipSignificantPoint = &p
+		sp.scopeClickHandler = toSignificantPointClickHandler(ctx, sp)
+		sp.previewAreaInput += " " // sort of a hack: if the fix is entered via keyboard, it appears on the next line
+
+	case starscmd.SlewRemoveJRing:
+		state.JRingRadius = 0
+		status.clear = true
+
+	case starscmd.SlewRemoveCone:
+		state.ConeLength = 0
+		status.clear = true
+
+	case starscmd.SlewJRing:
+		state.JRingRadius = slew.Range
+		state.ConeLength = 0 // can't have both
+		status.clear = true
+
+	case starscmd.SlewCone:
+		state.ConeLength = slew.Range
+		state.JRingRadius = 0 // can't have both
+		status.clear = true
+
+	case starscmd.SlewRangeBearingLine:
+		sp.wipRBL = &panes.RangeBearingLine{}
+		sp.wipRBL.P[0].Callsign = ac.Callsign
+		sp.scopeClickHandler = rblSecondClickHandler(ctx, sp)
+		// Do not clear the input area to allow entering a fix for the second location
+
+	case starscmd.SlewRejectPointOut:
+		ctx.ControlClient.RejectPointOut(ac.Callsign, nil,
+			func(err error) { sp.displayError(err, ctx) })
+		status.clear = true
+
+	case starscmd.SlewForceQL:
+		// STARS Manual 6-70 (On slew). Cannot go interfacility
+		// TODO: Or can be used to accept a pointout as a handoff.
+		if len(slew.Positions) == 0 {
+			if ctx.ControlClient.STARSFacilityAdaptation.ForceQLToSelf && trk.TrackOwner == ctx.ControlClient.PrimaryTCP {
+				state.ForceQL = true
+				status.clear = true
+			} else {
+				status.err = ErrSTARSIllegalPosition
+			}
+			return
+		}
+
+		tcps := slew.Positions
+		if tcps[0] == "ALL" {
+			// Force QL for all TCP
+			// Find user fac
+			if ctrl, ok := ctx.ControlClient.Controllers[ctx.ControlClient.PrimaryTCP]; ok && !ctrl.ERAMFacility {
+				sp.forceQL(ctx, ac.Callsign, ctx.ControlClient.PrimaryTCP)
+			}
+		}
+		for _, tcp := range tcps {
+			control := sp.lookupControllerForId(ctx, tcp, ac.Callsign)
+			if control == nil {
+				status.err = ErrSTARSIllegalPosition
+				return
+			}
+			sp.forceQL(ctx, ac.Callsign, control.Id())
+		}
+		status.clear = true
+
+	case starscmd.SlewToggleTPASize:
+		// TODO: this and the following two should give ILL FNCT if
+		// there's no j-ring/[A]TPA cone being displayed for the
+		// track (6-173).
+		if state.DisplayTPASize == nil {
+			b := ps.DisplayTPASize // new variable; don't alias ps.DisplayTPASize!
+			state.DisplayTPASize = &b
+		}
+		*state.DisplayTPASize = !*state.DisplayTPASize
+		status.clear = true
+
+	case starscmd.SlewEnableTPASize, starscmd.SlewInhibitTPASize:
+		b := slew.Command == starscmd.SlewEnableTPASize
+		state.DisplayTPASize = &b
+		status.clear = true
+
+	case starscmd.SlewEnableATPAWarnAlert, starscmd.SlewInhibitATPAWarnAlert:
+		// TODO: for these and the ATPA monitor cone commands, we should
+		// issue an error if not IFR, not displaying FDB, or not in ATPA
+		// approach volume (6-176).
+		b := slew.Command == starscmd.SlewEnableATPAWarnAlert
+		state.DisplayATPAWarnAlert = &b
+		status.clear = true
+
+	case starscmd.SlewEnableATPAMonitor, starscmd.SlewInhibitATPAMonitor:
+		b := slew.Command == starscmd.SlewEnableATPAMonitor
+		state.DisplayATPAMonitor = &b
+		status.clear = true
+
+	case starscmd.SlewPilotReportedAltitude:
+		sp.setPilotReportedAltitude(ctx, ac.Callsign, slew.Altitude/100)
+		status.clear = true
+
+	case starscmd.SlewAssignedAltitude:
+		status.err = amendFlightPlan(ctx, ac.Callsign, func(fp *av.FlightPlan) {
+			fp.Altitude = slew.Altitude
+		})
+		status.clear = true
+
+	case starscmd.SlewTemporaryAltitude:
+		sp.setTemporaryAltitude(ctx, ac.Callsign, slew.Altitude)
+		status.clear = true
+
+	case starscmd.SlewDisplayRoute:
+		sp.drawRouteAircraft = ac.Callsign
+		status.clear = true
+
+	case starscmd.SlewPointOut:
+		// First check for errors. (Manual 6-64, 6-73)
+
+		// TODO: if it's to a different facility and it's an arrival, ILL TRK
+
+		// Check if being handed off, pointed out or suspended (TODO suspended)
+		if _, ok := sp.PointOuts[ac.Callsign]; ok {
+			status.err = ErrSTARSIllegalTrack
+			return
+		}
+		if ac.HandoffTrackController != "" && ac.HandoffTrackController != ctx.ControlClient.PrimaryTCP {
+			status.err = ErrSTARSIllegalTrack
+			return
+		}
+
+		control := sp.lookupControllerForId(ctx, slew.Text, ac.Callsign)
+		if control == nil {
+			status.err = ErrSTARSIllegalPosition
+		} else {
+			status.clear = true
+			sp.pointOut(ctx, ac.Callsign, control.Id())
+		}
+
+	case starscmd.SlewText:
+		// If it matches the callsign, attempt to initiate track.
+		if cmd == ac.Callsign {
+			if err := sp.initiateTrack(ctx, ac.Callsign); err != nil {
+				status.err = err
+			} else {
+				status.clear = true
+			}
+			return
+		}
+
+		// See if cmd works as a sector id; if so, make it a handoff.
+		control := sp.lookupControllerForId(ctx, cmd, ac.Callsign)
+		if control != nil {
+			if ac.HandoffTrackController == ctx.ControlClient.PrimaryTCP ||
+				ac.RedirectedHandoff.RedirectedTo == ctx.ControlClient.PrimaryTCP { // Redirect
+				sp.redirectHandoff(ctx, ac.Callsign, control.Id())
+				status.clear = true
+			} else if err := sp.handoffTrack(ctx, ac.Callsign, cmd); err == nil {
+				status.clear = true
+			} else {
+				status.err = err
+			}
+		} else {
+			// Try setting the scratchpad
+			setScratchpad(cmd, false)
+		}
+	}
+	return
+}
+
 func (sp *STARSPane) createRestrictionArea(ctx *panes.Context, ra av.RestrictionArea) {
 	// Go ahead and make it visible, assuming which index will be assigned
 	// to reduce update latency.
@@ -4020,14 +4063,7 @@ func (sp *STARSPane) displayError(err error, ctx *panes.Context) {
 	}
 }
 
-type QuickLookPosition struct {
-	Id   string
-	Plus bool
-}
-
-func (q QuickLookPosition) String() string {
-	return q.Id + util.Select(q.Plus, "+", "")
-}
+type QuickLookPosition = sim.QuickLookPosition
 
 func (sp *STARSPane) parseQuickLookPositions(ctx *panes.Context, s string) ([]QuickLookPosition, string, error) {
 	var positions []QuickLookPosition
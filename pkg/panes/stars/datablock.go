@@ -26,11 +26,39 @@ const (
 )
 
 // datablock is a simple interface that abstracts the various types of
-// datablock. The only operation that exposes is drawing the datablock.
+// datablock. The only operation that exposes is getting the lines of text
+// to draw; see dbDraw and dbExtent.
 type datablock interface {
-	// pt is end of leader line--attachment point
-	draw(td *renderer.TextDrawBuilder, pt [2]float32, font *renderer.Font, brightness STARSBrightness,
-		leaderLineDirection math.CardinalOrdinalDirection, halfSeconds int64)
+	// lines returns the datablock's lines at the given time along with
+	// the index of the one that the leader line is aligned with.
+	lines(halfSeconds int64) (lines []dbLine, leaderLine int)
+}
+
+// dbDraw draws the datablock; pt is end of leader line--attachment point.
+func dbDraw(db datablock, td *renderer.TextDrawBuilder, pt [2]float32, font *renderer.Font,
+	brightness STARSBrightness, leaderLineDirection math.CardinalOrdinalDirection, halfSeconds int64) {
+	lines, ll := db.lines(halfSeconds)
+	pt[1] += float32(ll * font.Size)
+	dbDrawLines(lines, td, pt, font, brightness, leaderLineDirection, halfSeconds)
+}
+
+// dbExtent returns the window-space extent that dbDraw would cover.
+func dbExtent(db datablock, pt [2]float32, font *renderer.Font, leaderLineDirection math.CardinalOrdinalDirection,
+	halfSeconds int64) math.Extent2D {
+	lines, ll := db.lines(halfSeconds)
+	pt[1] += float32(ll * font.Size)
+	rightJustify := leaderLineDirection >= math.South
+	fontWidth := font.LookupGlyph(' ').AdvanceX
+
+	e := math.EmptyExtent2D()
+	for _, line := range lines {
+		w := float32(line.Len()) * fontWidth
+		x := util.Select(rightJustify, pt[0]-4-w, pt[0]+4)
+		e = math.Union(e, [2]float32{x, pt[1]})
+		e = math.Union(e, [2]float32{x + w, pt[1] - float32(font.Size)})
+		pt[1] -= float32(font.Size)
+	}
+	return e
 }
 
 // dbChar represents a single character in a datablock.
@@ -58,8 +86,7 @@ type fullDatablock struct {
 	field7 [2][4]dbChar
 }
 
-func (db fullDatablock) draw(td *renderer.TextDrawBuilder, pt [2]float32, font *renderer.Font,
-	brightness STARSBrightness, leaderLineDirection math.CardinalOrdinalDirection, halfSeconds int64) {
+func (db fullDatablock) lines(halfSeconds int64) ([]dbLine, int) {
 	// Figure out the maximum number of values any field is cycling through.
 	numVariants := func(fields [][]dbChar) int {
 		n := 0
@@ -102,8 +129,7 @@ func (db fullDatablock) draw(td *renderer.TextDrawBuilder, pt [2]float32, font *
 		dbMakeLine(selectMultiplexed([][]dbChar{db.field6[0][:], db.field6[1][:]}),
 			selectMultiplexed([][]dbChar{db.field7[0][:], db.field7[1][:]})),
 	}
-	pt[1] += float32(font.Size) // align leader with line 1
-	dbDrawLines(lines, td, pt, font, brightness, leaderLineDirection, halfSeconds)
+	return lines, 1 // align leader with line 1
 }
 
 ///////////////////////////////////////////////////////////////////////////
@@ -118,8 +144,7 @@ type partialDatablock struct {
 	field4  [2]dbChar
 }
 
-func (db partialDatablock) draw(td *renderer.TextDrawBuilder, pt [2]float32, font *renderer.Font,
-	brightness STARSBrightness, leaderLineDirection math.CardinalOrdinalDirection, halfSeconds int64) {
+func (db partialDatablock) lines(halfSeconds int64) ([]dbLine, int) {
 	// How many cycles?
 	nc := util.Select(fieldEmpty(db.field3[1][:]), 1, 2)
 	// If all three of field12 are set, it's 4 cycles: 0, 1, 0, 2 for field12
@@ -158,8 +183,7 @@ func (db partialDatablock) draw(td *renderer.TextDrawBuilder, pt [2]float32, fon
 		dbMakeLine(db.field0[:]),
 		dbMakeLine(dbChopTrailing(f12), f3, db.field4[:]),
 	}
-	pt[1] += float32(font.Size) // align leader with line 1
-	dbDrawLines(lines, td, pt, font, brightness, leaderLineDirection, halfSeconds)
+	return lines, 1 // align leader with line 1
 }
 
 ///////////////////////////////////////////////////////////////////////////
@@ -179,16 +203,14 @@ type limitedDatablock struct {
 	field6 [8]dbChar
 }
 
-func (db limitedDatablock) draw(td *renderer.TextDrawBuilder, pt [2]float32, font *renderer.Font,
-	brightness STARSBrightness, leaderLineDirection math.CardinalOrdinalDirection, halfSeconds int64) {
+func (db limitedDatablock) lines(halfSeconds int64) ([]dbLine, int) {
 	lines := []dbLine{
 		dbMakeLine(db.field0[:]),
 		dbMakeLine(db.field1[:], db.field2[:]),
 		dbMakeLine(db.field3[:], db.field4[:], db.field5[:]),
 		dbMakeLine(db.field6[:]),
 	}
-	pt[1] += 2 * float32(font.Size) // align leader with line 2
-	dbDrawLines(lines, td, pt, font, brightness, leaderLineDirection, halfSeconds)
+	return lines, 2 // align leader with line 2
 }
 
 ///////////////////////////////////////////////////////////////////////////
@@ -202,14 +224,12 @@ type ghostDatablock struct {
 	field1 [3]dbChar
 }
 
-func (db ghostDatablock) draw(td *renderer.TextDrawBuilder, pt [2]float32, font *renderer.Font,
-	brightness STARSBrightness, leaderLineDirection math.CardinalOrdinalDirection, halfSeconds int64) {
+func (db ghostDatablock) lines(halfSeconds int64) ([]dbLine, int) {
 	lines := []dbLine{
 		dbMakeLine(db.field0[:]),
 		dbMakeLine(db.field1[:]),
 	}
-	// Leader aligns with line 0, so no offset is needed
-	dbDrawLines(lines, td, pt, font, brightness, leaderLineDirection, halfSeconds)
+	return lines, 0 // align leader with line 0
 }
 
 ///////////////////////////////////////////////////////////////////////////
@@ -223,11 +243,15 @@ type dbLine struct {
 }
 
 // dbMakeLine flattens the given datablock fields into a single contiguous
-// line of characters.
+// line of characters; characters past the maximum line length are
+// dropped.
 func dbMakeLine(fields ...[]dbChar) dbLine {
 	var l dbLine
 	for _, f := range fields {
 		for _, ch := range f {
+			if l.length == len(l.ch) {
+				return l
+			}
 			l.ch[l.length] = ch
 			l.length++
 		}
@@ -619,7 +643,7 @@ func (sp *STARSPane) getDatablock(ctx *panes.Context, ac *av.Aircraft) datablock
 
 		if (extended || beaconator) && ac.Mode != av.Standby {
 			// Field 6: callsign
-			formatDBText(db.field6[:], ac.Callsign, color, false)
+			formatDBText(db.field6[:], ctx.DisplayCallsign(ac.Callsign), color, false)
 		}
 
 		return db
@@ -710,7 +734,7 @@ func (sp *STARSPane) getDatablock(ctx *panes.Context, ac *av.Aircraft) datablock
 		if beaconator && ac.Mode != av.Standby {
 			formatDBText(db.field1[:], ac.Squawk.String(), color, false)
 		} else {
-			formatDBText(db.field1[:], ac.Callsign, color, false)
+			formatDBText(db.field1[:], ctx.DisplayCallsign(ac.Callsign), color, false)
 		}
 
 		// Field 2: various symbols for inhibited stuff
@@ -760,11 +784,21 @@ func (sp *STARSPane) getDatablock(ctx *panes.Context, ac *av.Aircraft) datablock
 			formatDBText(db.field34[0][:], fmt3(altitude)+handoffId, color, false)
 		}
 		idx34 := 1
+		ambiguous := false
+		if ct, ok := ctx.ControlClient.CoastTracks[ac.Callsign]; ok && ct.Ambiguous {
+			// The track couldn't be automatically re-associated after
+			// coasting; time-shared with the altitude.
+			ambiguous = true
+			formatDBText(db.field34[idx34][:], fmt3("AMB")+handoffId, color, false)
+			idx34++
+		}
 		if sp1 != "" {
 			formatDBText(db.field34[idx34][:], fmt3(sp1)+handoffId, color, false)
 			idx34++
 		}
-		if handoffTCP != "" && !ctx.ControlClient.STARSFacilityAdaptation.DisplayHOFacilityOnly {
+		if idx34 == len(db.field34) {
+			// No room for anything else
+		} else if handoffTCP != "" && !ctx.ControlClient.STARSFacilityAdaptation.DisplayHOFacilityOnly {
 			formatDBText(db.field34[idx34][:], fmt3(handoffTCP)+handoffId, color, false)
 		} else if ac.SecondaryScratchpad != "" { // don't show secondary if we're showing a center
 			// TODO: confirm no handoffId here
@@ -820,6 +854,10 @@ func (sp *STARSPane) getDatablock(ctx *panes.Context, ac *av.Aircraft) datablock
 			formatDBText(db.field6[idx6][:], fmt.Sprintf("%.2f", state.IntrailDistance), distColor, false)
 			idx6++
 		}
+		var atpa []dbChar
+		if idx6 > 0 {
+			atpa = dbChopTrailing(db.field6[0][:])
+		}
 		if displayBeaconCode {
 			formatDBText(db.field6[idx6][:], ac.Squawk.String(), brightness.ScaleRGB(STARSTextWarningColor), true)
 			idx6++
@@ -842,13 +880,72 @@ func (sp *STARSPane) getDatablock(ctx *panes.Context, ac *av.Aircraft) datablock
 			formatDBText(db.field7[idx][:], ac.FlightPlan.AssignedSquawk.String(), color, true)
 		}
 
+		if tmpl := ctx.ControlClient.STARSFacilityAdaptation.FDBTemplate; tmpl != nil {
+			text := func(s string, flashing bool) []dbChar {
+				f := make([]dbChar, len([]rune(s)))
+				formatDBText(f, s, color, flashing)
+				return f
+			}
+
+			values := map[string][]dbChar{
+				"alerts":      dbChopTrailing(db.field0[:]),
+				"atpa":        atpa,
+				"beacon":      text(ac.Squawk.String(), false),
+				"callsign":    dbChopTrailing(db.field1[:]),
+				"cwt":         text(state.CWTCategory, false),
+				"groundspeed": text(groundspeed, false),
+				"handoff_id":  text(handoffId, false),
+				"inhibit":     dbChopTrailing(db.field2[:]),
+				"pointout":    dbChopTrailing(db.field8[:]),
+				"rules":       text(strings.TrimSpace(rulesCategory[:1]), false),
+				"scratchpad":  text(sp1, false),
+				"scratchpad2": text(trk.SP2, false),
+				"type":        text(actype, false),
+			}
+			if dest := ac.FlightPlan.ArrivalAirport; len(dest) == 4 && dest[0] == 'K' {
+				values["destination"] = text(dest[1:], false)
+			} else {
+				values["destination"] = text(dest, false)
+			}
+			if ac.PilotReportedAltitude != 0 {
+				values["altitude"] = text(altitude+"*", false)
+			} else {
+				values["altitude"] = text(altitude, false)
+			}
+			if beaconMismatch {
+				values["assigned_beacon"] = text(ac.FlightPlan.AssignedSquawk.String(), true)
+			}
+			if handoffTCP != "" && !ctx.ControlClient.STARSFacilityAdaptation.DisplayHOFacilityOnly {
+				values["handoff_tcp"] = text(handoffTCP, false)
+			}
+			if ambiguous {
+				values["ambiguous"] = text("AMB", false)
+			}
+			if ident {
+				values["ident"] = text("ID", true)
+			}
+			if !fieldEmpty(db.field5[2][:]) {
+				values["requested_altitude"] = dbChopTrailing(db.field5[2][:])
+			}
+			if ac.TempAltitude != 0 {
+				values["temp_altitude"] = text(fmt.Sprintf("A%03d", (ac.TempAltitude+50)/100), false)
+			}
+			if d := state.TrackDeltaAltitude(); d > 50 {
+				values["vri"] = text(STARSClimbingCharacter, false)
+			} else if d < -50 {
+				values["vri"] = text(STARSDescendingCharacter, false)
+			}
+
+			return makeTemplateDatablock(tmpl, values, color)
+		}
+
 		return db
 	}
 
 	return nil
 }
 
-func (sp *STARSPane) getGhostDatablock(ghost *av.GhostAircraft, color renderer.RGB) ghostDatablock {
+func (sp *STARSPane) getGhostDatablock(ctx *panes.Context, ghost *av.GhostAircraft, color renderer.RGB) ghostDatablock {
 	var db ghostDatablock
 
 	state := sp.Aircraft[ghost.Callsign]
@@ -858,7 +955,7 @@ func (sp *STARSPane) getGhostDatablock(ghost *av.GhostAircraft, color renderer.R
 		formatDBText(db.field0[:], groundspeed+state.CWTCategory, color, false)
 	} else {
 		// The full datablock ain't much more...
-		formatDBText(db.field0[:], ghost.Callsign, color, false)
+		formatDBText(db.field0[:], ctx.DisplayCallsign(ghost.Callsign), color, false)
 		formatDBText(db.field1[:], groundspeed, color, false) // TODO: no CWT?
 	}
 
@@ -1074,27 +1171,12 @@ func (sp *STARSPane) drawDatablocks(aircraft []*av.Aircraft, ctx *panes.Context,
 			}
 
 			state := sp.Aircraft[ac.Callsign]
-
-			// Calculate the endpoint of the leader line
 			pac := transforms.WindowFromLatLongP(state.TrackPosition())
 			leaderLineDirection := sp.getLeaderLineDirection(ac, ctx)
-			vll := sp.getLeaderLineVector(ctx, leaderLineDirection)
-			pll := math.Add2f(pac, math.Scale2f(vll, ctx.DrawPixelScale))
-			if math.Length2f(vll) == 0 {
-				// no leader line is being drawn; make sure that the datablock
-				// doesn't overlap the target track.
-				sz := sp.getTrackSize(ctx, transforms) / 2
-				rightJustify := leaderLineDirection >= math.South
-				pll[0] += util.Select(rightJustify, -sz, sz)
-				pll[1] += float32(font.Size)
-			} else {
-				// Start drawing down a half line-height to align the leader
-				// line in the middle of the db line.
-				pll[1] += float32(font.Size / 2)
-			}
+			pll := sp.datablockAttachment(ctx, transforms, pac, leaderLineDirection, font)
 
 			halfSeconds := realNow.UnixMilli() / 500
-			db.draw(td, pll, font, brightness, sp.getLeaderLineDirection(ac, ctx), halfSeconds)
+			dbDraw(db, td, pll, font, brightness, leaderLineDirection, halfSeconds)
 		}
 	}
 
@@ -1102,6 +1184,78 @@ func (sp *STARSPane) drawDatablocks(aircraft []*av.Aircraft, ctx *panes.Context,
 	td.GenerateCommands(cb)
 }
 
+// datablockAttachment returns the point where a datablock for a track at
+// the window position pac attaches to its leader line.
+func (sp *STARSPane) datablockAttachment(ctx *panes.Context, transforms ScopeTransformations, pac [2]float32,
+	leaderLineDirection math.CardinalOrdinalDirection, font *renderer.Font) [2]float32 {
+	// Calculate the endpoint of the leader line
+	vll := sp.getLeaderLineVector(ctx, leaderLineDirection)
+	pll := math.Add2f(pac, math.Scale2f(vll, ctx.DrawPixelScale))
+	if math.Length2f(vll) == 0 {
+		// no leader line is being drawn; make sure that the datablock
+		// doesn't overlap the target track.
+		sz := sp.getTrackSize(ctx, transforms) / 2
+		rightJustify := leaderLineDirection >= math.South
+		pll[0] += util.Select(rightJustify, -sz, sz)
+		pll[1] += float32(font.Size)
+	} else {
+		// Start drawing down a half line-height to align the leader
+		// line in the middle of the db line.
+		pll[1] += float32(font.Size / 2)
+	}
+	return pll
+}
+
+// layoutDatablocks chooses leader line directions for datablocks that
+// don't have one specified manually so that they don't overlap each
+// other or other tracks, if the user has enabled that; it's called once
+// per frame before anything that depends on leader line directions is
+// drawn.
+func (sp *STARSPane) layoutDatablocks(aircraft []*av.Aircraft, ctx *panes.Context, transforms ScopeTransformations) {
+	ps := sp.currentPrefs()
+	if !ps.AutomaticLeaderLines {
+		sp.autoLeaderLineDirections = nil
+		return
+	}
+
+	now := ctx.ControlClient.SimTime
+	font := sp.systemFont(ctx, ps.CharSize.Datablocks)
+	halfSeconds := ctx.Now.UnixMilli() / 500
+
+	var labels []panes.Label
+	for _, ac := range aircraft {
+		state := sp.Aircraft[ac.Callsign]
+		if state.LostTrack(now) || !sp.datablockVisible(ac, ctx) {
+			continue
+		}
+		db := sp.getDatablock(ctx, ac)
+		if db == nil {
+			continue
+		}
+		if _, brightness, _ := sp.trackDatablockColorBrightness(ctx, ac); brightness == 0 {
+			continue
+		}
+
+		pac := transforms.WindowFromLatLongP(state.TrackPosition())
+		dir, manual := sp.manualLeaderLineDirection(ac)
+		if !manual {
+			dir = sp.defaultLeaderLineDirection(ac, ctx)
+		}
+		labels = append(labels, panes.Label{
+			Id:        ac.Callsign,
+			Track:     pac,
+			Direction: dir,
+			Fixed:     manual,
+			Bounds: func(dir math.CardinalOrdinalDirection) math.Extent2D {
+				pll := sp.datablockAttachment(ctx, transforms, pac, dir, font)
+				return dbExtent(db, pll, font, dir, halfSeconds)
+			},
+		})
+	}
+
+	sp.autoLeaderLineDirections = sp.leaderLineLayout.Layout(labels, sp.getTrackSize(ctx, transforms)/2)
+}
+
 func (sp *STARSPane) haveActiveWarnings(ctx *panes.Context, ac *av.Aircraft) bool {
 	ps := sp.currentPrefs()
 	state := sp.Aircraft[ac.Callsign]
@@ -1189,6 +1343,13 @@ func (sp *STARSPane) getDatablockAlerts(ctx *panes.Context, ac *av.Aircraft, dbt
 				addAlert("CA", !sp.CAAircraft[idx].Acknowledged, true)
 			}
 		}
+		if ind := sp.priority(ctx, ac).Indicator(); ind != "" {
+			addAlert(ind, false, ind == "EM")
+		}
+		if ac.FlightIDMismatch() && ac.TrackingController != "" {
+			// The downlinked flight ID doesn't match the callsign.
+			addAlert("CM", false, false)
+		}
 		if alts, warn := sp.WarnOutsideAirspace(ctx, ac); warn {
 			altStrs := ""
 			for _, a := range alts {
@@ -0,0 +1,101 @@
+// pkg/panes/stars/dbtemplate.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package stars
+
+import (
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/renderer"
+)
+
+const (
+	STARSClimbingCharacter   = string(rune(0x1e))
+	STARSDescendingCharacter = string(rune(0x1f))
+)
+
+///////////////////////////////////////////////////////////////////////////
+// templateDatablock
+
+// templateDatablock is a full datablock laid out using the facility's
+// adapted av.DatablockTemplate.
+type templateDatablock struct {
+	fields            [4][]templateDBField
+	firstCycle, cycle int // half seconds
+}
+
+type templateDBField struct {
+	// Non-empty values that the field cycles through; for literal text,
+	// there's just the one.
+	variants [][]dbChar
+	width    int
+}
+
+// makeTemplateDatablock assembles a datablock following the template,
+// taking the items' values from the given map; literal text is drawn
+// with the given color.
+func makeTemplateDatablock(tmpl *av.DatablockTemplate, values map[string][]dbChar, color renderer.RGB) *templateDatablock {
+	db := &templateDatablock{}
+	db.firstCycle, db.cycle = tmpl.CycleHalfSeconds()
+
+	for i, fields := range tmpl.Fields {
+		for _, f := range fields {
+			var tf templateDBField
+			if f.Literal != "" {
+				lit := make([]dbChar, len([]rune(f.Literal)))
+				formatDBText(lit, f.Literal, color, false)
+				tf.variants = [][]dbChar{lit}
+			} else {
+				for _, item := range f.Items {
+					if v := values[item]; !fieldEmpty(v) {
+						tf.variants = append(tf.variants, v)
+					}
+				}
+			}
+
+			if f.Width > 0 {
+				tf.width = f.Width
+			} else {
+				for _, v := range tf.variants {
+					tf.width = max(tf.width, len(v))
+				}
+			}
+			db.fields[i] = append(db.fields[i], tf)
+		}
+	}
+
+	return db
+}
+
+func (db templateDatablock) lines(halfSeconds int64) ([]dbLine, int) {
+	nc := 1
+	for _, line := range db.fields {
+		for _, f := range line {
+			nc = max(nc, len(f.variants))
+		}
+	}
+
+	fullCycleHalfSeconds := db.firstCycle + db.cycle*(nc-1)
+	// Figure out which cycle we are in
+	cycle := 0
+	for idx := int(halfSeconds % int64(fullCycleHalfSeconds)); idx >= db.firstCycle; idx -= db.cycle {
+		cycle++
+	}
+
+	var lines []dbLine
+	for _, line := range db.fields {
+		var fields [][]dbChar
+		for _, f := range line {
+			v := make([]dbChar, f.width)
+			if cycle < len(f.variants) {
+				copy(v, f.variants[cycle])
+			} else if len(f.variants) > 0 {
+				copy(v, f.variants[0])
+			}
+			fields = append(fields, v)
+		}
+		lines = append(lines, dbMakeLine(fields...))
+	}
+
+	return lines, 1 // align leader with line 1
+}
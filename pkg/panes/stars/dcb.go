@@ -529,6 +529,7 @@ func (sp *STARSPane) drawDCB(ctx *panes.Context, transforms ScopeTransformations
 		if sp.prefSet.Selected != nil {
 			if selectButton(ctx, "SAVE", buttonHalfVertical, buttonScale) {
 				sp.prefSet.Saved[*sp.prefSet.Selected] = sp.prefSet.Current.Duplicate()
+				sp.preferenceSetsChanged = true
 			}
 		} else {
 			disabledButton(ctx, "SAVE", buttonHalfVertical, buttonScale)
@@ -547,6 +548,7 @@ func (sp *STARSPane) drawDCB(ctx *panes.Context, transforms ScopeTransformations
 			if selectButton(ctx, "DELETE", buttonHalfVertical, buttonScale) {
 				sp.prefSet.Saved[*sp.prefSet.Selected] = nil
 				sp.prefSet.Selected = nil
+				sp.preferenceSetsChanged = true
 			}
 		} else {
 			disabledButton(ctx, "DELETE", buttonHalfVertical, buttonScale)
@@ -707,6 +709,10 @@ func (sp *STARSPane) drawDCB(ctx *panes.Context, transforms ScopeTransformations
 			ps.DisplayATPAMonitorCones = !ps.DisplayATPAMonitorCones
 			sp.previewAreaOutput = ""
 		}
+		if selectButton(ctx, "SLOT\nMARKERS\n"+onoff(ps.DisplaySlotMarkers), buttonFull, buttonScale) {
+			ps.DisplaySlotMarkers = !ps.DisplaySlotMarkers
+			sp.previewAreaOutput = ""
+		}
 		if selectButton(ctx, "DONE", buttonFull, buttonScale) {
 			sp.setCommandMode(ctx, CommandModeNone)
 		} else {
@@ -6,12 +6,14 @@ package stars
 
 import (
 	"errors"
+	"log/slog"
 	"net/rpc"
 
 	av "github.com/mmp/vice/pkg/aviation"
 	"github.com/mmp/vice/pkg/log"
 	"github.com/mmp/vice/pkg/server"
 	"github.com/mmp/vice/pkg/sim"
+	starscmd "github.com/mmp/vice/pkg/stars"
 )
 
 ///////////////////////////////////////////////////////////////////////////
@@ -38,6 +40,7 @@ var (
 	ErrSTARSIllegalAirport    = NewSTARSError("ILL AIRPORT")
 	ErrSTARSIllegalCode       = NewSTARSError("ILL CODE")
 	ErrSTARSIllegalColor      = NewSTARSError("ILL COLOR")
+	ErrSTARSIllegalFacility   = NewSTARSError("ILL FAC")
 	ErrSTARSIllegalFix        = NewSTARSError("ILL FIX")
 	ErrSTARSIllegalFlight     = NewSTARSError("ILL FLIGHT")
 	ErrSTARSIllegalFunction   = NewSTARSError("ILL FUNC")
@@ -66,9 +69,16 @@ var starsErrorRemap = map[error]*STARSError{
 	sim.ErrAircraftAlreadyReleased:     ErrSTARSDuplicateCommand,
 	sim.ErrBeaconMismatch:              ErrSTARSBeaconMismatch,
 	av.ErrClearedForUnexpectedApproach: ErrSTARSIllegalValue,
+	starscmd.ErrCommandFormat:          ErrSTARSCommandFormat,
+	sim.ErrControllerAlreadySignedIn:   ErrSTARSIllegalPosition,
 	av.ErrFixNotInRoute:                ErrSTARSIllegalFix,
 	sim.ErrIllegalACID:                 ErrSTARSIllegalACID,
+	sim.ErrIllegalACType:               ErrSTARSIllegalACType,
 	sim.ErrIllegalFunction:             ErrSTARSIllegalFunction,
+	starscmd.ErrIllegalParam:           ErrSTARSIllegalParam,
+	sim.ErrIllegalScratchpad:           ErrSTARSIllegalScratchpad,
+	starscmd.ErrIllegalValue:           ErrSTARSIllegalValue,
+	sim.ErrInvalidAbbreviatedFP:        ErrSTARSCommandFormat,
 	av.ErrInvalidAltitude:              ErrSTARSIllegalValue,
 	av.ErrInvalidApproach:              ErrSTARSIllegalValue,
 	server.ErrInvalidCommandSyntax:     ErrSTARSCommandFormat,
@@ -76,8 +86,15 @@ var starsErrorRemap = map[error]*STARSError{
 	sim.ErrInvalidDepartureController:  ErrSTARSIllegalFunction,
 	av.ErrInvalidFacility:              ErrSTARSIllegalTrack,
 	av.ErrInvalidHeading:               ErrSTARSIllegalValue,
+	av.ErrInvalidSquawkCode:            ErrSTARSIllegalCode,
 	sim.ErrInvalidRestrictionAreaIndex: ErrSTARSIllegalGeoId,
+	sim.ErrNoMatchingFlight:            ErrSTARSNoFlight,
+	sim.ErrNotConsolidated:             ErrSTARSIllegalPosition,
+	sim.ErrPositionAlreadyConsolidated: ErrSTARSDuplicateCommand,
+	sim.ErrReleaseAlreadyRequested:     ErrSTARSDuplicateCommand,
+	av.ErrSquawkCodeAlreadyAssigned:    ErrSTARSDuplicateBeacon,
 	av.ErrNoAircraftForCallsign:        ErrSTARSNoFlight,
+	sim.ErrNoBeaconMismatch:            ErrSTARSIllegalFunction,
 	av.ErrNoController:                 ErrSTARSIllegalSector,
 	av.ErrNoFlightPlan:                 ErrSTARSIllegalFlight,
 	av.ErrNotBeingHandedOffToMe:        ErrSTARSIllegalTrack,
@@ -92,6 +109,7 @@ var starsErrorRemap = map[error]*STARSError{
 	av.ErrUnknownAirport:               ErrSTARSIllegalAirport,
 	av.ErrUnknownApproach:              ErrSTARSIllegalValue,
 	sim.ErrUnknownController:           ErrSTARSIllegalPosition,
+	sim.ErrUnknownFacility:             ErrSTARSIllegalFacility,
 	av.ErrUnknownRunway:                ErrSTARSIllegalValue,
 }
 
@@ -104,8 +122,16 @@ func GetSTARSError(e error, lg *log.Logger) *STARSError {
 		e = server.TryDecodeError(e)
 	}
 
-	if se, ok := starsErrorRemap[e]; ok {
-		return se
+	// Errors from the sim may be wrapped with additional context (e.g.,
+	// a sim.NASError); check the whole chain for one we know how to
+	// report.
+	for err := e; err != nil; err = errors.Unwrap(err) {
+		if se, ok := starsErrorRemap[err]; ok {
+			if err != e {
+				lg.Info("STARS error", slog.String("error", e.Error()), slog.String("readout", se.Error()))
+			}
+			return se
+		}
 	}
 
 	lg.Errorf("%v: unexpected error passed to GetSTARSError", e)
@@ -0,0 +1,252 @@
+// pkg/panes/stars/keybindings.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package stars
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mmp/vice/pkg/panes"
+	"github.com/mmp/vice/pkg/platform"
+	"github.com/mmp/vice/pkg/util"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// Key bindings allow the common track operations--accepting a handoff,
+// handing off or pointing out to a particular position, and forcing a
+// quick look--to be done with a single keystroke on the track under the
+// cursor. Facilities' keyboards and controllers' habits vary, so the
+// bindings are set separately for each position and are saved in the
+// config.
+
+type KeyBindingAction string
+
+const (
+	KeyBindingAcceptHandoff KeyBindingAction = "accept"
+	KeyBindingHandoff       KeyBindingAction = "handoff"
+	KeyBindingPointOut      KeyBindingAction = "point out"
+	KeyBindingQuickLook     KeyBindingAction = "quick look"
+)
+
+var keyBindingActions = []KeyBindingAction{KeyBindingAcceptHandoff, KeyBindingHandoff, KeyBindingPointOut,
+	KeyBindingQuickLook}
+
+type KeyBinding struct {
+	// Key is an F-key with optional modifiers, e.g. "F14", "Alt-F5", or
+	// "Ctrl-Shift-F2".
+	Key    string
+	Action KeyBindingAction
+	// Position is the sector that the track is handed off or pointed out
+	// to or force quick looked at, as it would be entered in a command.
+	Position string
+}
+
+type keyChord struct {
+	key                 platform.Key
+	control, shift, alt bool
+}
+
+func parseKeyChord(s string) (keyChord, bool) {
+	var kc keyChord
+	f := strings.Split(strings.ToUpper(strings.TrimSpace(s)), "-")
+	for _, mod := range f[:len(f)-1] {
+		switch mod {
+		case "CTRL", "CONTROL":
+			kc.control = true
+		case "SHIFT":
+			kc.shift = true
+		case "ALT":
+			kc.alt = true
+		default:
+			return keyChord{}, false
+		}
+	}
+
+	key := f[len(f)-1]
+	if !strings.HasPrefix(key, "F") {
+		return keyChord{}, false
+	}
+	n, err := strconv.Atoi(key[1:])
+	if err != nil || n < 1 || n > 16 {
+		return keyChord{}, false
+	}
+	kc.key = platform.Key(int(platform.KeyF1) + n - 1)
+	return kc, true
+}
+
+func (kc keyChord) pressed(kb *platform.KeyboardState) bool {
+	return kb.WasPressed(kc.key) && kb.WasPressed(platform.KeyControl) == kc.control &&
+		kb.WasPressed(platform.KeyShift) == kc.shift && kb.WasPressed(platform.KeyAlt) == kc.alt
+}
+
+func (kb KeyBinding) Validate() error {
+	if _, ok := parseKeyChord(kb.Key); !ok {
+		return fmt.Errorf("%q: invalid key; must be an F-key, optionally with Ctrl-, Shift-, and/or Alt-", kb.Key)
+	}
+	if !slices.Contains(keyBindingActions, kb.Action) {
+		return fmt.Errorf("%q: unknown action", kb.Action)
+	}
+	if kb.Action != KeyBindingAcceptHandoff && kb.Position == "" {
+		return fmt.Errorf("%s: must specify a position for %q", kb.Key, kb.Action)
+	}
+	return nil
+}
+
+// keyBindings returns the bindings for the current position.
+func (sp *STARSPane) keyBindings() []KeyBinding {
+	return sp.KeyBindings[sp.keyBindingPosition]
+}
+
+// processKeyBindings runs the actions for any bound keys that were
+// pressed; those keys are then removed from the keyboard state so that
+// they don't also do whatever they normally would.
+func (sp *STARSPane) processKeyBindings(ctx *panes.Context) {
+	bindings := sp.keyBindings()
+	if len(bindings) == 0 || ctx.Keyboard == nil || ctx.Mouse == nil {
+		return
+	}
+
+	var consumed []platform.Key
+	for _, kb := range bindings {
+		kc, ok := parseKeyChord(kb.Key)
+		if !ok || !kc.pressed(ctx.Keyboard) {
+			continue
+		}
+		consumed = append(consumed, kc.key)
+
+		ps := sp.currentPrefs()
+		ctr := util.Select(ps.UseUserCenter, ps.UserCenter, ps.DefaultCenter)
+		transforms := GetScopeTransformations(ctx.PaneExtent, ctx.ControlClient.MagneticVariation,
+			ctx.ControlClient.NmPerLongitude, ctr, float32(ps.Range), 0)
+		if err := sp.runKeyBinding(ctx, kb, transforms); err != nil {
+			sp.displayError(err, ctx)
+		}
+	}
+
+	for _, k := range consumed {
+		delete(ctx.Keyboard.Pressed, k)
+	}
+}
+
+func (sp *STARSPane) runKeyBinding(ctx *panes.Context, kb KeyBinding, transforms ScopeTransformations) error {
+	ac, _ := sp.tryGetClosestAircraft(ctx, ctx.Mouse.Pos, transforms)
+	if ac == nil {
+		return ErrSTARSNoTrack
+	}
+	tcp := ctx.ControlClient.PrimaryTCP
+
+	switch kb.Action {
+	case KeyBindingAcceptHandoff:
+		if ac.RedirectedHandoff.RedirectedTo == tcp {
+			sp.acceptRedirectedHandoff(ctx, ac.Callsign)
+		} else if ac.HandoffTrackController == tcp {
+			sp.acceptHandoff(ctx, ac.Callsign)
+		} else {
+			return ErrSTARSIllegalTrack
+		}
+
+	case KeyBindingHandoff:
+		if ac.TrackingController != tcp {
+			return ErrSTARSIllegalTrack
+		}
+		return sp.handoffTrack(ctx, ac.Callsign, kb.Position)
+
+	case KeyBindingPointOut, KeyBindingQuickLook:
+		control := sp.lookupControllerForId(ctx, kb.Position, ac.Callsign)
+		if control == nil {
+			return ErrSTARSIllegalPosition
+		}
+		if kb.Action == KeyBindingPointOut {
+			if _, ok := sp.PointOuts[ac.Callsign]; ok {
+				return ErrSTARSIllegalTrack
+			}
+			sp.pointOut(ctx, ac.Callsign, control.Id())
+		} else {
+			sp.forceQL(ctx, ac.Callsign, control.Id())
+		}
+
+	default:
+		return ErrSTARSIllegalFunction
+	}
+	return nil
+}
+
+func (sp *STARSPane) drawKeyBindingsUI() {
+	if sp.keyBindingPosition == "" {
+		return
+	}
+	if !imgui.CollapsingHeader("Key Bindings (" + sp.keyBindingPosition + ")") {
+		return
+	}
+
+	if sp.KeyBindings == nil {
+		sp.KeyBindings = make(map[string][]KeyBinding)
+	}
+	bindings := sp.KeyBindings[sp.keyBindingPosition]
+
+	tableFlags := imgui.TableFlagsBordersV | imgui.TableFlagsBordersOuterH | imgui.TableFlagsRowBg |
+		imgui.TableFlagsSizingStretchProp
+	if len(bindings) > 0 && imgui.BeginTableV("keybindings", 4, tableFlags, imgui.Vec2{}, 0) {
+		imgui.TableSetupColumn("Key")
+		imgui.TableSetupColumn("Action")
+		imgui.TableSetupColumn("Position")
+		imgui.TableSetupColumn("")
+		imgui.TableHeadersRow()
+
+		del := -1
+		for i := range bindings {
+			kb := &bindings[i]
+			imgui.PushID(fmt.Sprintf("%d", i))
+
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			imgui.InputTextV("##key", &kb.Key, 0, nil)
+			if _, ok := parseKeyChord(kb.Key); !ok && imgui.IsItemHovered() {
+				imgui.SetTooltip("F1-F16, optionally with Ctrl-, Shift-, and/or Alt-")
+			}
+
+			imgui.TableNextColumn()
+			if imgui.BeginComboV("##action", string(kb.Action), 0) {
+				for _, action := range keyBindingActions {
+					if imgui.SelectableV(string(action), action == kb.Action, 0, imgui.Vec2{}) {
+						kb.Action = action
+					}
+				}
+				imgui.EndCombo()
+			}
+
+			imgui.TableNextColumn()
+			if kb.Action != KeyBindingAcceptHandoff {
+				imgui.InputTextV("##position", &kb.Position, imgui.InputTextFlagsCharsUppercase, nil)
+			}
+
+			imgui.TableNextColumn()
+			if imgui.Button("Delete") {
+				del = i
+			}
+
+			imgui.PopID()
+		}
+		imgui.EndTable()
+
+		if del != -1 {
+			bindings = slices.Delete(bindings, del, del+1)
+		}
+	}
+
+	if imgui.Button("Add Key Binding") {
+		bindings = append(bindings, KeyBinding{Key: "Alt-F1", Action: KeyBindingAcceptHandoff})
+	}
+	for _, kb := range bindings {
+		if err := kb.Validate(); err != nil {
+			imgui.Text(err.Error())
+		}
+	}
+
+	sp.KeyBindings[sp.keyBindingPosition] = bindings
+}
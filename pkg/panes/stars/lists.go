@@ -15,6 +15,7 @@ import (
 	"github.com/mmp/vice/pkg/math"
 	"github.com/mmp/vice/pkg/panes"
 	"github.com/mmp/vice/pkg/renderer"
+	"github.com/mmp/vice/pkg/sim"
 	"github.com/mmp/vice/pkg/util"
 )
 
@@ -483,7 +484,7 @@ func (sp *STARSPane) drawVFRList(ctx *panes.Context, pw [2]float32, aircraft []*
 	}
 	for i := range math.Min(len(vfr), ps.VFRList.Lines) {
 		ac := vfr[i]
-		text.WriteString(fmt.Sprintf("%s %-7s VFR\n", sp.getTabListIndex(ac), ac.Callsign))
+		text.WriteString(fmt.Sprintf("%s %-7s VFR\n", sp.getTabListIndex(ac), ctx.DisplayCallsign(ac.Callsign)))
 	}
 
 	if text.Len() > 0 {
@@ -520,7 +521,7 @@ func (sp *STARSPane) drawTABList(ctx *panes.Context, pw [2]float32, aircraft []*
 	}
 	for i := range math.Min(len(dep), ps.TABList.Lines) {
 		ac := dep[i]
-		text.WriteString(fmt.Sprintf("%s %-7s %s\n", sp.getTabListIndex(ac), ac.Callsign, ac.Squawk.String()))
+		text.WriteString(fmt.Sprintf("%s %-7s %s\n", sp.getTabListIndex(ac), ctx.DisplayCallsign(ac.Callsign), ac.Squawk.String()))
 	}
 
 	if text.Len() > 0 {
@@ -605,17 +606,17 @@ func (sp *STARSPane) drawAlertList(ctx *panes.Context, pw [2]float32, aircraft [
 			}
 
 			if msawac != nil {
-				text.WriteString(fmt.Sprintf("%-13s%4s LA\n", msawac.Callsign, alt(msawac)))
+				text.WriteString(fmt.Sprintf("%-13s%4s LA\n", ctx.DisplayCallsign(msawac.Callsign), alt(msawac)))
 			} else if capair != nil {
-				text.WriteString(fmt.Sprintf("%-17s CA\n", capair.Callsigns[0]+"*"+capair.Callsigns[1]))
+				text.WriteString(fmt.Sprintf("%-17s CA\n", ctx.DisplayCallsign(capair.Callsigns[0])+"*"+ctx.DisplayCallsign(capair.Callsigns[1])))
 			} else if mcipair != nil {
 				// For MCIs, the unassociated track is always the second callsign.
 				// Beacon code is reported for MCI or blank if we don't have it.
 				ac1 := ctx.ControlClient.Aircraft[mcipair.Callsigns[1]]
 				if ac1.Mode != av.Standby {
-					text.WriteString(fmt.Sprintf("%-17s MCI\n", mcipair.Callsigns[0]+"*"+ac1.Squawk.String()))
+					text.WriteString(fmt.Sprintf("%-17s MCI\n", ctx.DisplayCallsign(mcipair.Callsigns[0])+"*"+ac1.Squawk.String()))
 				} else {
-					text.WriteString(fmt.Sprintf("%-17s MCI\n", mcipair.Callsigns[0]+"*"))
+					text.WriteString(fmt.Sprintf("%-17s MCI\n", ctx.DisplayCallsign(mcipair.Callsigns[0])+"*"))
 				}
 			} else {
 				break
@@ -629,8 +630,30 @@ func (sp *STARSPane) drawAlertList(ctx *panes.Context, pw [2]float32, aircraft [
 }
 
 func (sp *STARSPane) drawCoastList(ctx *panes.Context, pw [2]float32, style renderer.TextStyle, td *renderer.TextDrawBuilder) {
-	// TODO
-	td.AddText("COAST/SUSPEND", pw, style)
+	ps := sp.currentPrefs()
+	now := ctx.ControlClient.SimTime
+
+	// Our coasting tracks and ones that couldn't be re-associated,
+	// oldest first.
+	var tracks []*sim.CoastTrack
+	for callsign, ct := range ctx.ControlClient.CoastTracks {
+		if ac, ok := ctx.ControlClient.Aircraft[callsign]; ok && ac.TrackingController == ctx.ControlClient.PrimaryTCP &&
+			(ct.Ambiguous || ct.Coasting(now)) {
+			tracks = append(tracks, ct)
+		}
+	}
+	slices.SortFunc(tracks, func(a, b *sim.CoastTrack) int { return a.LastSeen.Compare(b.LastSeen) })
+
+	var text strings.Builder
+	text.WriteString("COAST/SUSPEND\n")
+	if len(tracks) > ps.CoastList.Lines {
+		text.WriteString(fmt.Sprintf("MORE: %d/%d\n", ps.CoastList.Lines, len(tracks)))
+		tracks = tracks[:ps.CoastList.Lines]
+	}
+	for _, ct := range tracks {
+		text.WriteString(fmt.Sprintf("%-8s %s %s\n", ctx.DisplayCallsign(ct.Callsign), ct.Squawk, util.Select(ct.Ambiguous, "AMB", "CST")))
+	}
+	td.AddText(text.String(), pw, style)
 }
 
 func (sp *STARSPane) drawMapsList(ctx *panes.Context, pw [2]float32, style renderer.TextStyle, td *renderer.TextDrawBuilder) {
@@ -666,6 +689,9 @@ func (sp *STARSPane) drawMapsList(ctx *panes.Context, pw [2]float32, style rende
 	}
 
 	text.WriteString(mapTitles[ps.VideoMapsList.Selection])
+	if ps.videoMapCategoryHidden(int(ps.VideoMapsList.Selection)) {
+		text.WriteString(" INHIBITED")
+	}
 	text.WriteByte('\n')
 	var m []av.VideoMap
 	if ps.VideoMapsList.Selection == VideoMapCurrent {
@@ -790,7 +816,7 @@ func (sp *STARSPane) drawMCISuppressionList(ctx *panes.Context, pw [2]float32, a
 	for _, ac := range aircraft {
 		state := sp.Aircraft[ac.Callsign]
 		if state.MCISuppressedCode != av.Squawk(0) {
-			text.WriteString(fmt.Sprintf("%7s %s  %s\n", ac.Callsign, ac.Squawk.String(),
+			text.WriteString(fmt.Sprintf("%7s %s  %s\n", ctx.DisplayCallsign(ac.Callsign), ac.Squawk.String(),
 				state.MCISuppressedCode.String()))
 		}
 	}
@@ -820,7 +846,8 @@ func (sp *STARSPane) drawTowerList(ctx *panes.Context, pw [2]float32, airport st
 			actype = strings.TrimPrefix(actype, "S/")
 			// We'll punt on the chance that two aircraft have the
 			// exact same distance to the airport...
-			m[dist] = fmt.Sprintf("%-7s %s", ac.Callsign, actype)
+			m[dist] = strings.TrimSpace(fmt.Sprintf("%-7s %-4s %s", ctx.DisplayCallsign(ac.Callsign), actype,
+				sp.priority(ctx, ac).Indicator()))
 		}
 	}
 
@@ -928,7 +955,7 @@ func (sp *STARSPane) drawCoordinationLists(ctx *panes.Context, paneExtent math.E
 			// TODO: NO FP if no flight plan
 			text.WriteString("     " + sp.getTabListIndex(ac))
 			text.WriteString(util.Select(ac.Released, "+", " "))
-			text.WriteString(fmt.Sprintf(" %-10s %5s %s %5s %03d\n", ac.Callsign, ac.FlightPlan.BaseType(),
+			text.WriteString(fmt.Sprintf(" %-10s %5s %s %5s %03d\n", ctx.DisplayCallsign(ac.Callsign), ac.FlightPlan.BaseType(),
 				ac.Squawk, trk.SP1, ac.FlightPlan.Altitude/100))
 			if !ac.Released && blinkDim {
 				pw = td.AddText(rewriteDelta(text.String()), pw, dimStyle)
@@ -5,10 +5,12 @@
 package stars
 
 import (
+	"encoding/json"
 	"slices"
 
 	av "github.com/mmp/vice/pkg/aviation"
 	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/panes"
 	"github.com/mmp/vice/pkg/platform"
 	"github.com/mmp/vice/pkg/sim"
 	"github.com/mmp/vice/pkg/util"
@@ -20,7 +22,7 @@ const numSavedPreferenceSets = 32
 
 // PreferenceSet stores the currently active preferences and up to
 // numSavedPreferenceSets saved preferences; STARSPane keeps a separate
-// PreferenceSet for each TRACON that the user signs in to.
+// PreferenceSet for each position that the user signs in to.
 type PreferenceSet struct {
 	Current  Preferences
 	Selected *int // if non-nil, an index into Saved
@@ -134,6 +136,9 @@ type Preferences struct {
 	DisableMSAW        bool
 
 	VideoMapVisible map[int]interface{}
+	// Categories of video maps that aren't drawn, even if maps in them
+	// are visible.
+	HiddenVideoMapCategories [VideoMapNumCategories]bool
 
 	DisplayRequestedAltitude bool
 
@@ -155,6 +160,13 @@ type CommonPreferences struct {
 	// 4-94: 0.5s increments via trackball but 0.1s increments allowed if
 	// keyboard input.
 	RadarTrackHistoryRate float32
+	// Draw history trails as lines rather than as dots.
+	HistoryLines bool
+	// Draw all of the history tracks in the brightest history color.
+	DisableHistoryFade bool
+	// Choose leader line directions for datablocks without manually
+	// specified ones so that they don't overlap.
+	AutomaticLeaderLines bool
 
 	AudioEffectEnabled []bool
 
@@ -175,6 +187,7 @@ type CommonPreferences struct {
 	DisplayATPAInTrailDist       bool `json:"DisplayATPAIntrailDist"`
 	DisplayATPAWarningAlertCones bool
 	DisplayATPAMonitorCones      bool
+	DisplaySlotMarkers           bool
 
 	PTLLength      float32
 	PTLOwn, PTLAll bool
@@ -311,6 +324,7 @@ func (p *Preferences) Reset(ss sim.State, sp *STARSPane) {
 
 	// Make the scenario's default video maps visible
 	p.VideoMapVisible = make(map[int]interface{})
+	clear(p.HiddenVideoMapCategories[:])
 
 	for _, dm := range ss.ControllerDefaultVideoMaps {
 		if idx := slices.IndexFunc(sp.allVideoMaps, func(v av.VideoMap) bool { return v.Name == dm }); idx != -1 {
@@ -436,6 +450,10 @@ func makeDefaultPreferences() *Preferences {
 	return &prefs
 }
 
+func (p *Preferences) videoMapCategoryHidden(cat int) bool {
+	return cat >= 0 && cat < len(p.HiddenVideoMapCategories) && p.HiddenVideoMapCategories[cat]
+}
+
 func (p *Preferences) Duplicate() *Preferences {
 	c := deep.MustCopy(*p)
 	return &c
@@ -453,131 +471,205 @@ func (p *Preferences) Activate(pl platform.Platform, sp *STARSPane) {
 }
 
 func (ps *Preferences) Upgrade(from, to int) {
-	if from < 8 {
-		ps.Brightness.DCB = 60
-		ps.CharSize.DCB = 1
-	}
-	if from < 9 {
-		remap := func(b *STARSBrightness) {
-			*b = STARSBrightness(math.Min(*b*2, 100))
-		}
-		remap(&ps.Brightness.VideoGroupA)
-		remap(&ps.Brightness.VideoGroupB)
-		remap(&ps.Brightness.RangeRings)
-		remap(&ps.Brightness.Compass)
-	}
-	if from < 12 {
-		if ps.Brightness.DCB == 0 {
+	preferencesMigrations.Apply(ps, from, to)
+}
+
+// preferencesMigrations upgrades Preferences saved with earlier config
+// versions; new steps should be added at the end with the new
+// CurrentConfigVersion.
+var preferencesMigrations = util.NewMigrations(
+	util.Migration[*Preferences]{
+		Version:     8,
+		Description: "DCB brightness and font size",
+		Apply: func(ps *Preferences) {
 			ps.Brightness.DCB = 60
-		}
-	}
-	if from < 17 {
-		// Added DisplayWeatherLevel
-		for i := range ps.DisplayWeatherLevel {
-			ps.DisplayWeatherLevel[i] = true
-		}
-	}
-	if from < 18 {
-		// ATPA; set defaults
-		ps.DisplayATPAInTrailDist = true
-		ps.DisplayATPAWarningAlertCones = true
-	}
-	if from < 21 {
-		// System list offsets changed from updated handling of
-		// transformation matrices with and without the DCB visible.
-		ps.CharSize.DCB = math.Max(0, ps.CharSize.DCB-1)
-		ps.CharSize.Datablocks = math.Max(0, ps.CharSize.Datablocks-1)
-		ps.CharSize.Lists = math.Max(0, ps.CharSize.Lists-1)
-		ps.CharSize.Tools = math.Max(0, ps.CharSize.Tools-1)
-		ps.CharSize.PositionSymbols = math.Max(0, ps.CharSize.PositionSymbols-1)
-
-		if ps.DisplayDCB && ps.DCBPosition == dcbPositionTop {
-			shift := func(y *float32) {
-				*y = math.Max(0, *y-.05)
+			ps.CharSize.DCB = 1
+		},
+	},
+	util.Migration[*Preferences]{
+		Version:     9,
+		Description: "compensate brightness for corrected STARS colors",
+		Apply: func(ps *Preferences) {
+			remap := func(b *STARSBrightness) {
+				*b = STARSBrightness(math.Min(*b*2, 100))
 			}
-			shift(&ps.SSAList.Position[1])
-			shift(&ps.VFRList.Position[1])
-			shift(&ps.TABList.Position[1])
-			shift(&ps.AlertList.Position[1])
-			shift(&ps.CoastList.Position[1])
-			shift(&ps.SignOnList.Position[1])
-			shift(&ps.VideoMapsList.Position[1])
-			shift(&ps.CRDAStatusList.Position[1])
-			for i := range ps.TowerLists {
-				shift(&ps.TowerLists[i].Position[1])
+			remap(&ps.Brightness.VideoGroupA)
+			remap(&ps.Brightness.VideoGroupB)
+			remap(&ps.Brightness.RangeRings)
+			remap(&ps.Brightness.Compass)
+		},
+	},
+	util.Migration[*Preferences]{
+		Version:     12,
+		Description: "default for zero DCB brightness",
+		Apply: func(ps *Preferences) {
+			if ps.Brightness.DCB == 0 {
+				ps.Brightness.DCB = 60
+			}
+		},
+	},
+	util.Migration[*Preferences]{
+		Version:     17,
+		Description: "weather levels",
+		Apply: func(ps *Preferences) {
+			for i := range ps.DisplayWeatherLevel {
+				ps.DisplayWeatherLevel[i] = true
+			}
+		},
+	},
+	util.Migration[*Preferences]{
+		Version:     18,
+		Description: "ATPA defaults",
+		Apply: func(ps *Preferences) {
+			ps.DisplayATPAInTrailDist = true
+			ps.DisplayATPAWarningAlertCones = true
+		},
+	},
+	util.Migration[*Preferences]{
+		Version:     21,
+		Description: "character sizes and list positions for DCB transformation changes",
+		Apply: func(ps *Preferences) {
+			// System list offsets changed from updated handling of
+			// transformation matrices with and without the DCB visible.
+			ps.CharSize.DCB = math.Max(0, ps.CharSize.DCB-1)
+			ps.CharSize.Datablocks = math.Max(0, ps.CharSize.Datablocks-1)
+			ps.CharSize.Lists = math.Max(0, ps.CharSize.Lists-1)
+			ps.CharSize.Tools = math.Max(0, ps.CharSize.Tools-1)
+			ps.CharSize.PositionSymbols = math.Max(0, ps.CharSize.PositionSymbols-1)
+
+			if ps.DisplayDCB && ps.DCBPosition == dcbPositionTop {
+				shift := func(y *float32) {
+					*y = math.Max(0, *y-.05)
+				}
+				shift(&ps.SSAList.Position[1])
+				shift(&ps.VFRList.Position[1])
+				shift(&ps.TABList.Position[1])
+				shift(&ps.AlertList.Position[1])
+				shift(&ps.CoastList.Position[1])
+				shift(&ps.SignOnList.Position[1])
+				shift(&ps.VideoMapsList.Position[1])
+				shift(&ps.CRDAStatusList.Position[1])
+				for i := range ps.TowerLists {
+					shift(&ps.TowerLists[i].Position[1])
+				}
+			}
+		},
+	},
+	util.Migration[*Preferences]{
+		Version:     23,
+		Description: "preview area position",
+		Apply: func(ps *Preferences) {
+			// This should have been in the version 21 migration...
+			if ps.PreviewAreaPosition[0] == .05 && ps.PreviewAreaPosition[1] == .8 {
+				ps.PreviewAreaPosition = [2]float32{.05, .75}
+			}
+		},
+	},
+	util.Migration[*Preferences]{
+		Version:     24,
+		Description: "audio volume",
+		Apply: func(ps *Preferences) {
+			ps.AudioVolume = 10
+		},
+	},
+	util.Migration[*Preferences]{
+		Version:     26,
+		Description: "fixups previously done in PreferenceSet Activate",
+		Apply: func(ps *Preferences) {
+			// These are all from earlier releases but were previously
+			// done in PreferenceSet Activate (unfortunately), so some of
+			// these may still be lingering...
+
+			// It should only take integer values but it's a float32 and
+			// we previously didn't enforce this...
+			ps.Range = float32(int(ps.Range))
+
+			if ps.PTLAll { // both can't be set; we didn't enforce this previously...
+				ps.PTLOwn = false
 			}
-		}
-	}
-	if from < 23 {
-		// This should have been in the from < 21 case...
-		if ps.PreviewAreaPosition[0] == .05 && ps.PreviewAreaPosition[1] == .8 {
-			ps.PreviewAreaPosition = [2]float32{.05, .75}
-		}
-	}
-	if from < 24 {
-		ps.AudioVolume = 10
-	}
-	if from < 26 {
-		// These are all from earlier releases but were previously done in
-		// PreferenceSet Activate (unfortunately), so some of these may
-		// still be lingering...
-
-		// It should only take integer values but it's a float32 and we
-		// previously didn't enforce this...
-		ps.Range = float32(int(ps.Range))
 
-		if ps.PTLAll { // both can't be set; we didn't enforce this previously...
-			ps.PTLOwn = false
-		}
+			if ps.RadarTrackHistoryRate == 0 {
+				ps.RadarTrackHistoryRate = 4.5 // upgrade from old
+			}
 
-		if ps.RadarTrackHistoryRate == 0 {
-			ps.RadarTrackHistoryRate = 4.5 // upgrade from old
-		}
+			// Brightness goes in steps of 5 (similarly not enforced previously...)
+			remapBrightness := func(b *STARSBrightness) {
+				*b = (*b + 2) / 5 * 5
+				*b = math.Clamp(*b, 0, 100)
+			}
+			remapBrightness(&ps.Brightness.DCB)
+			remapBrightness(&ps.Brightness.BackgroundContrast)
+			remapBrightness(&ps.Brightness.VideoGroupA)
+			remapBrightness(&ps.Brightness.VideoGroupB)
+			remapBrightness(&ps.Brightness.FullDatablocks)
+			remapBrightness(&ps.Brightness.Lists)
+			remapBrightness(&ps.Brightness.Positions)
+			remapBrightness(&ps.Brightness.LimitedDatablocks)
+			remapBrightness(&ps.Brightness.OtherTracks)
+			remapBrightness(&ps.Brightness.Lines)
+			remapBrightness(&ps.Brightness.RangeRings)
+			remapBrightness(&ps.Brightness.Compass)
+			remapBrightness(&ps.Brightness.BeaconSymbols)
+			remapBrightness(&ps.Brightness.PrimarySymbols)
+			remapBrightness(&ps.Brightness.History)
+			remapBrightness(&ps.Brightness.Weather)
+			remapBrightness(&ps.Brightness.WxContrast)
+
+			for len(ps.AudioEffectEnabled) < AudioNumTypes {
+				ps.AudioEffectEnabled = append(ps.AudioEffectEnabled, false)
+			}
+		},
+	},
+	util.Migration[*Preferences]{
+		Version:     27,
+		Description: "SSA list filters and coordination lists",
+		Apply: func(ps *Preferences) {
+			ps.SSAList.Filter.Text.Main = true
+			for i := range ps.SSAList.Filter.Text.GI {
+				ps.SSAList.Filter.Text.GI[i] = true
+			}
+			ps.CoordinationLists = make(map[string]*CoordinationList)
+		},
+	},
+	util.Migration[*Preferences]{
+		Version:     29,
+		Description: "restriction areas",
+		Apply: func(ps *Preferences) {
+			ps.RestrictionAreaList.Position = [2]float32{.8, .575}
+			ps.RestrictionAreaSettings = make(map[int]*RestrictionAreaSettings)
+		},
+	},
+	util.Migration[*Preferences]{
+		Version:     32,
+		Description: "MCI suppression list",
+		Apply: func(ps *Preferences) {
+			ps.MCISuppressionList.Position = [2]float32{.8, .1}
+		},
+	},
+)
 
-		// Brightness goes in steps of 5 (similarly not enforced previously...)
-		remapBrightness := func(b *STARSBrightness) {
-			*b = (*b + 2) / 5 * 5
-			*b = math.Clamp(*b, 0, 100)
-		}
-		remapBrightness(&ps.Brightness.DCB)
-		remapBrightness(&ps.Brightness.BackgroundContrast)
-		remapBrightness(&ps.Brightness.VideoGroupA)
-		remapBrightness(&ps.Brightness.VideoGroupB)
-		remapBrightness(&ps.Brightness.FullDatablocks)
-		remapBrightness(&ps.Brightness.Lists)
-		remapBrightness(&ps.Brightness.Positions)
-		remapBrightness(&ps.Brightness.LimitedDatablocks)
-		remapBrightness(&ps.Brightness.OtherTracks)
-		remapBrightness(&ps.Brightness.Lines)
-		remapBrightness(&ps.Brightness.RangeRings)
-		remapBrightness(&ps.Brightness.Compass)
-		remapBrightness(&ps.Brightness.BeaconSymbols)
-		remapBrightness(&ps.Brightness.PrimarySymbols)
-		remapBrightness(&ps.Brightness.History)
-		remapBrightness(&ps.Brightness.Weather)
-		remapBrightness(&ps.Brightness.WxContrast)
-
-		for len(ps.AudioEffectEnabled) < AudioNumTypes {
-			ps.AudioEffectEnabled = append(ps.AudioEffectEnabled, false)
-		}
-	}
-	if from < 27 {
-		ps.SSAList.Filter.Text.Main = true
-		for i := range ps.SSAList.Filter.Text.GI {
-			ps.SSAList.Filter.Text.GI[i] = true
-		}
-		ps.CoordinationLists = make(map[string]*CoordinationList)
-	}
-	if from < 29 {
-		ps.RestrictionAreaList.Position = [2]float32{.8, .575}
-		ps.RestrictionAreaSettings = make(map[int]*RestrictionAreaSettings)
-	}
-	if from < 32 {
-		ps.MCISuppressionList.Position = [2]float32{.8, .1}
+func (sp *STARSPane) initPrefsForLoadedSim(ss sim.State, pl platform.Platform) {
+	pos := ss.TRACON + "/" + ss.PrimaryTCP
+	prefSet, ok := sp.PositionPreferenceSets[pos]
+	if !ok {
+		// First time at this position; start with a copy of the TRACON's
+		// preferences.
+		ps := deep.MustCopy(*sp.traconPreferenceSet(ss))
+		prefSet = &ps
+		sp.PositionPreferenceSets[pos] = prefSet
 	}
+
+	// Cache the PreferenceSet for use throughout the rest of the STARSPane
+	// methods.
+	sp.prefSet = prefSet
+	sp.initPreferenceSetsForLoadedSim(ss)
+	sp.prefSet.Current.Activate(pl, sp)
 }
 
-func (sp *STARSPane) initPrefsForLoadedSim(ss sim.State, pl platform.Platform) {
+// traconPreferenceSet returns the PreferenceSet for the TRACON, which new
+// positions' preferences are initialized with. (Before preferences were
+// kept for each position, this was the only one.)
+func (sp *STARSPane) traconPreferenceSet(ss sim.State) *PreferenceSet {
 	prefSet, ok := sp.TRACONPreferenceSets[ss.TRACON]
 	if !ok {
 		// First time we've seen this TRACON. Start out with system defaults.
@@ -612,11 +704,46 @@ func (sp *STARSPane) initPrefsForLoadedSim(ss sim.State, pl platform.Platform) {
 
 		sp.TRACONPreferenceSets[ss.TRACON] = prefSet
 	}
+	return prefSet
+}
 
-	// Cache the PreferenceSet for use throughout the rest of the STARSPane
-	// methods.
-	sp.prefSet = prefSet
-	sp.prefSet.Current.Activate(pl, sp)
+// initPreferenceSetsForLoadedSim takes the position's saved preference
+// sets from the sim if it has them, so that they follow the position
+// rather than the computer. Otherwise ours are sent to the sim.
+func (sp *STARSPane) initPreferenceSetsForLoadedSim(ss sim.State) {
+	sp.preferenceSetsChanged = true
+
+	data, ok := ss.PreferenceSets[ss.PrimaryTCP]
+	if !ok {
+		return
+	}
+	var saved [numSavedPreferenceSets]*Preferences
+	if err := json.Unmarshal(data, &saved); err != nil {
+		// Keep ours and send them to the sim instead.
+		return
+	}
+
+	sp.prefSet.Saved = saved
+	if sel := sp.prefSet.Selected; sel != nil && saved[*sel] == nil {
+		sp.prefSet.Selected = nil
+	}
+	sp.preferenceSetsChanged = false
+}
+
+// syncPreferenceSets sends the saved preference sets to the sim if they
+// have changed since they were last sent.
+func (sp *STARSPane) syncPreferenceSets(ctx *panes.Context) {
+	if !sp.preferenceSetsChanged {
+		return
+	}
+	sp.preferenceSetsChanged = false
+
+	data, err := json.Marshal(sp.prefSet.Saved)
+	if err != nil {
+		ctx.Lg.Errorf("%v: unable to marshal preference sets", err)
+		return
+	}
+	ctx.ControlClient.SetPreferenceSets(data, nil, func(err error) { sp.displayError(err, ctx) })
 }
 
 // This is called when a new Sim is started from scratch.
@@ -626,6 +753,38 @@ func (sp *STARSPane) resetPrefsForNewSim(ss sim.State, pl platform.Platform) {
 	// Clear out the preference-related state (e.g. quicklooks) that we
 	// don't expect to persist across Sim restarts.
 	sp.prefSet.Reset(ss, sp)
+	sp.syncedQuickLook = nil
+}
+
+// initQuickLookForLoadedSim restores the position's quick looks from the
+// sim, if it has them; this way they carry over if we've reconnected or
+// are relieving another controller.
+func (sp *STARSPane) initQuickLookForLoadedSim(ss sim.State) {
+	sp.syncedQuickLook = nil
+	if ql, ok := ss.QuickLooks[ss.PrimaryTCP]; ok {
+		ps := sp.currentPrefs()
+		ps.QuickLookAll, ps.QuickLookAllIsPlus = ql.All, ql.AllIsPlus
+		ps.QuickLookPositions = slices.Clone(ql.Positions)
+		sp.syncedQuickLook = &ql
+	}
+}
+
+// syncQuickLook sends the current quick look selection to the sim if it
+// has changed since it was last sent.
+func (sp *STARSPane) syncQuickLook(ctx *panes.Context) {
+	ps := sp.currentPrefs()
+	if sq := sp.syncedQuickLook; sq != nil && sq.All == ps.QuickLookAll && sq.AllIsPlus == ps.QuickLookAllIsPlus &&
+		slices.Equal(sq.Positions, ps.QuickLookPositions) {
+		return
+	}
+
+	ql := sim.QuickLook{
+		All:       ps.QuickLookAll,
+		AllIsPlus: ps.QuickLookAllIsPlus,
+		Positions: slices.Clone(ps.QuickLookPositions),
+	}
+	sp.syncedQuickLook = &ql
+	ctx.ControlClient.SetQuickLook(ql, nil, func(err error) { sp.displayError(err, ctx) })
 }
 
 func (sp *STARSPane) currentPrefs() *Preferences {
@@ -25,6 +25,7 @@ import (
 	"github.com/mmp/vice/pkg/renderer"
 	"github.com/mmp/vice/pkg/server"
 	"github.com/mmp/vice/pkg/sim"
+	starscmd "github.com/mmp/vice/pkg/stars"
 	"github.com/mmp/vice/pkg/util"
 
 	"github.com/mmp/imgui-go/v4"
@@ -35,7 +36,7 @@ const LateralMinimum = 3
 const VerticalMinimum = 1000
 
 // STARS ∆ is character 0x80 in the font
-const STARSTriangleCharacter = string(rune(0x80))
+const STARSTriangleCharacter = starscmd.TriangleCharacter
 
 // Filled upward-pointing triangle
 const STARSFilledUpTriangle = string(rune(0x1e))
@@ -71,7 +72,11 @@ var (
 
 type STARSPane struct {
 	TRACONPreferenceSets map[string]*PreferenceSet
-	prefSet              *PreferenceSet
+	// Indexed by "TRACON/TCP"
+	PositionPreferenceSets map[string]*PreferenceSet
+	prefSet                *PreferenceSet
+	// Set when the saved preference sets need to be sent to the sim.
+	preferenceSetsChanged bool
 
 	// These are the current prefs from the prior representation; we read
 	// them back in if they're there to use to bootstrap the new
@@ -138,7 +143,7 @@ type STARSPane struct {
 
 	queryUnassociated *util.TransientMap[string, interface{}]
 
-	RangeBearingLines []STARSRangeBearingLine
+	RangeBearingLines []panes.RangeBearingLine
 	MinSepAircraft    [2]string
 
 	CAAircraft  []CAAircraft
@@ -151,6 +156,30 @@ type STARSPane struct {
 	FlipNumericKeypad bool
 	TgtGenKey         byte
 
+	// Per-position key bindings, indexed by "TRACON/TCP"; see
+	// keybindings.go.
+	KeyBindings        map[string][]KeyBinding
+	keyBindingPosition string
+
+	// The quick look selection as the sim last knew it.
+	syncedQuickLook *sim.QuickLook
+
+	// NOTAMs being edited for each airport's ATIS, separated by semicolons.
+	atisNOTAMs map[string]string
+	// The NOTAM being entered in the info window.
+	newNOTAM sim.NOTAM
+	// The traffic restriction being entered in the info window: its fix,
+	// arrival airports (separated by spaces), and spacing.
+	newTMIFix      string
+	newTMIAirports string
+	newTMISpacing  int32
+	newTMIMinutes  bool
+	// The PIREP being entered in the info window and the fix, if any,
+	// that the PIREPs shown are limited to.
+	newPIREP         sim.PIREP
+	newPIREPAltitude int32
+	pirepFix         string
+
 	FontSelection int
 
 	DisplayBeaconCode        av.Squawk
@@ -165,6 +194,11 @@ type STARSPane struct {
 	dwellAircraft     string
 	drawRouteAircraft string
 
+	// Leader line directions chosen to keep datablocks from overlapping,
+	// when enabled; see layoutDatablocks.
+	leaderLineLayout         panes.LabelLayout
+	autoLeaderLineDirections map[string]math.CardinalOrdinalDirection
+
 	drawRouteMode   bool
 	drawRoutePoints []math.Point2LL
 
@@ -174,12 +208,17 @@ type STARSPane struct {
 	previewAreaInput  string
 	dcbShowAux        bool
 
-	lastTrackUpdate        time.Time
-	lastHistoryTrackUpdate time.Time
-	discardTracks          bool
+	lastTrackUpdate time.Time
+	discardTracks   bool
+	// History tracks from before this time aren't drawn; it's set when
+	// the tracks are discarded, e.g. when the radar mode changes.
+	historyStart time.Time
+	// ControlClient.AircraftGeneration when the aircraft were last
+	// processed in processEvents; zero forces them to be processed.
+	aircraftGeneration uint64
 
 	// The start of a RBL--one click received, waiting for the second.
-	wipRBL *STARSRangeBearingLine
+	wipRBL *panes.RangeBearingLine
 
 	// First point clicked for display bearing/range to significant point.
 	wipSignificantPoint *math.Point2LL
@@ -256,6 +295,7 @@ const (
 	AudioInboundHandoff
 	AudioCommandError
 	AudioHandoffAccepted
+	AudioAirspaceViolation
 	AudioNumTypes
 )
 
@@ -269,6 +309,7 @@ func (ae AudioType) String() string {
 		"Inbound Handoff",
 		"Command Error",
 		"Handoff Accepted",
+		"Airspace Violation",
 	}[ae]
 }
 
@@ -331,6 +372,21 @@ const (
 	VideoMapNumCategories
 )
 
+// videoMapCategoryNames gives the names used in MAP commands to inhibit
+// and enable the display of all of the maps in a category.
+var videoMapCategoryNames = [VideoMapNumCategories]string{
+	VideoMapGeographicMaps:     "GEO",
+	VideoMapControlledAirspace: "CTL",
+	VideoMapRunwayExtensions:   "RWY",
+	VideoMapDangerAreas:        "DGR",
+	VideoMapAerodromes:         "APT",
+	VideoMapGeneralAviation:    "GA",
+	VideoMapSIDsSTARs:          "SID",
+	VideoMapMilitary:           "MIL",
+	VideoMapGeographicPoints:   "PTS",
+	VideoMapProcessingAreas:    "PROC",
+}
+
 type DwellMode int
 
 const (
@@ -391,6 +447,9 @@ func (sp *STARSPane) Activate(r renderer.Renderer, p platform.Platform, eventStr
 	if sp.TRACONPreferenceSets == nil {
 		sp.TRACONPreferenceSets = make(map[string]*PreferenceSet)
 	}
+	if sp.PositionPreferenceSets == nil {
+		sp.PositionPreferenceSets = make(map[string]*PreferenceSet)
+	}
 
 	sp.initializeFonts(r, p)
 	sp.initializeAudio(p, lg)
@@ -407,7 +466,7 @@ func (sp *STARSPane) Activate(r renderer.Renderer, p platform.Platform, eventStr
 	sp.weatherRadar.Activate(r, lg)
 
 	sp.lastTrackUpdate = time.Time{} // force immediate update at start
-	sp.lastHistoryTrackUpdate = time.Time{}
+	sp.historyStart = time.Time{}
 
 	if sp.TgtGenKey == 0 {
 		sp.TgtGenKey = ';'
@@ -418,11 +477,14 @@ func (sp *STARSPane) Activate(r renderer.Renderer, p platform.Platform, eventStr
 
 func (sp *STARSPane) LoadedSim(client *server.ControlClient, ss sim.State, pl platform.Platform, lg *log.Logger) {
 	sp.initPrefsForLoadedSim(ss, pl)
+	sp.keyBindingPosition = ss.TRACON + "/" + ss.PrimaryTCP
+	sp.initQuickLookForLoadedSim(ss)
 
 	sp.weatherRadar.UpdateCenter(sp.currentPrefs().DefaultCenter)
 
 	sp.makeMaps(client, ss, lg)
 	sp.makeSignificantPoints(ss)
+	sp.aircraftGeneration = 0
 }
 
 func (sp *STARSPane) ResetSim(client *server.ControlClient, ss sim.State, pl platform.Platform, lg *log.Logger) {
@@ -456,7 +518,8 @@ func (sp *STARSPane) ResetSim(client *server.ControlClient, ss sim.State, pl pla
 	sp.weatherRadar.UpdateCenter(sp.currentPrefs().DefaultCenter)
 
 	sp.lastTrackUpdate = time.Time{} // force update
-	sp.lastHistoryTrackUpdate = time.Time{}
+	sp.historyStart = time.Time{}
+	sp.aircraftGeneration = 0
 
 	clear(sp.scopeDraw.arrivals)
 	clear(sp.scopeDraw.approaches)
@@ -634,6 +697,9 @@ func (sp *STARSPane) Upgrade(from, to int) {
 	for _, prefs := range sp.TRACONPreferenceSets {
 		prefs.Upgrade(from, to)
 	}
+	for _, prefs := range sp.PositionPreferenceSets {
+		prefs.Upgrade(from, to)
+	}
 	if sp.OldPrefsCurrentPreferenceSet != nil {
 		sp.OldPrefsCurrentPreferenceSet.Upgrade(from, to)
 	}
@@ -647,6 +713,8 @@ func (sp *STARSPane) Upgrade(from, to int) {
 
 func (sp *STARSPane) Draw(ctx *panes.Context, cb *renderer.CommandBuffer) {
 	sp.processEvents(ctx)
+	sp.syncQuickLook(ctx)
+	sp.syncPreferenceSets(ctx)
 	sp.updateRadarTracks(ctx)
 	sp.autoReleaseDepartures(ctx)
 
@@ -705,12 +773,14 @@ func (sp *STARSPane) Draw(ctx *panes.Context, cb *renderer.CommandBuffer) {
 
 	sp.drawPTLs(aircraft, ctx, transforms, cb)
 	sp.drawRingsAndCones(aircraft, ctx, transforms, cb)
+	sp.drawSlotMarkers(aircraft, ctx, transforms, cb)
 	sp.drawRBLs(aircraft, ctx, transforms, cb)
-	sp.drawMinSep(ctx, transforms, cb)
+	sp.drawMinSep(aircraft, ctx, transforms, cb)
 
 	sp.drawHighlighted(ctx, transforms, cb)
 	sp.drawVFRAirports(ctx, transforms, cb)
 
+	sp.layoutDatablocks(aircraft, ctx, transforms)
 	sp.drawLeaderLines(aircraft, ctx, transforms, cb)
 	sp.drawTracks(aircraft, ctx, transforms, cb)
 	sp.drawDatablocks(aircraft, ctx, transforms, cb)
@@ -736,11 +806,8 @@ func (sp *STARSPane) Draw(ctx *panes.Context, cb *renderer.CommandBuffer) {
 	// Do this at the end of drawing so that we hold on to the tracks we
 	// have for rendering the current frame.
 	if sp.discardTracks {
-		for _, state := range sp.Aircraft {
-			state.historyTracksIndex = 0
-		}
 		sp.lastTrackUpdate = time.Time{} // force update
-		sp.lastHistoryTrackUpdate = time.Time{}
+		sp.historyStart = ctx.ControlClient.SimTime
 		sp.discardTracks = false
 	}
 }
@@ -764,6 +831,33 @@ func (sp *STARSPane) drawWX(ctx *panes.Context, transforms ScopeTransformations,
 
 	sp.weatherRadar.Draw(ctx, sp.wxHistoryDraw, weatherBrightness, weatherContrast, ps.DisplayWeatherLevel,
 		transforms, cb)
+
+	// Scripted convective cells are drawn like the radar returns at
+	// their level.
+	transforms.LoadLatLongViewingMatrices(cb)
+	for _, c := range ctx.ControlClient.State.WeatherCells {
+		i := c.Level - 1
+		if !ps.DisplayWeatherLevel[i] {
+			continue
+		}
+
+		trid := renderer.GetTrianglesDrawBuilder()
+		for j := 1; j+1 < len(c.Vertices); j++ {
+			trid.AddTriangle(c.Vertices[0], c.Vertices[j], c.Vertices[j+1])
+		}
+
+		baseColor := util.Select(i < 3, renderer.RGBFromUInt8(37, 77, 77), renderer.RGBFromUInt8(100, 100, 51))
+		cb.SetRGB(baseColor.Scale(weatherBrightness))
+		trid.GenerateCommands(cb)
+		if i != 0 && i != 3 {
+			cb.EnablePolygonStipple()
+			cb.PolygonStipple(reverseStippleBytes(util.Select(i == 1 || i == 4, wxStippleLight, wxStippleDense)))
+			cb.SetRGB(renderer.RGB{weatherContrast, weatherContrast, weatherContrast})
+			trid.GenerateCommands(cb)
+			cb.DisablePolygonStipple()
+		}
+		renderer.ReturnTrianglesDrawBuilder(trid)
+	}
 }
 
 const numMapColors = 8
@@ -799,7 +893,7 @@ func (sp *STARSPane) drawVideoMaps(ctx *panes.Context, transforms ScopeTransform
 	cb.LineWidth(1, ctx.DPIScale)
 	var draw []av.VideoMap
 	for _, vm := range sp.allVideoMaps {
-		if _, ok := ps.VideoMapVisible[vm.Id]; ok {
+		if _, ok := ps.VideoMapVisible[vm.Id]; ok && !ps.videoMapCategoryHidden(vm.Category) {
 			draw = append(draw, vm)
 		}
 	}
@@ -1166,7 +1260,7 @@ func (sp *STARSPane) makeSignificantPoints(ss sim.State) {
 
 	// All airports within 250nm
 	center := ss.GetInitialCenter()
-	for name, ap := range av.DB.Airports {
+	for name, ap := range av.DB.Airports() {
 		if math.NMDistance2LL(ap.Location, center) < 250 {
 			if len(name) == 4 && name[0] == 'K' {
 				name = name[1:]
@@ -1180,13 +1274,13 @@ func (sp *STARSPane) makeSignificantPoints(ss sim.State) {
 		}
 	}
 
-	for name, nav := range av.DB.Navaids {
+	for name, nav := range av.DB.Navaids() {
 		if math.NMDistance2LL(nav.Location, center) < 250 {
 			tryAdd(name, name+" "+nav.Type, nav.Location)
 		}
 	}
 
-	for name, fix := range av.DB.Fixes {
+	for name, fix := range av.DB.Fixes() {
 		if math.NMDistance2LL(fix.Location, center) < 250 {
 			// FIXME: should be INTERSECTION not WAYPOINT potentially
 			tryAdd(name, name+" WAYPOINT", fix.Location)
@@ -1338,6 +1432,7 @@ func (sp *STARSPane) initializeAudio(p platform.Platform, lg *log.Logger) {
 		sp.audioEffects[AudioInboundHandoff] = loadMP3("263124__pan14__sine-octaves-up-beep.mp3")
 		sp.audioEffects[AudioCommandError] = loadMP3("ERROR.mp3")
 		sp.audioEffects[AudioHandoffAccepted] = loadMP3("321104__nsstudios__blip2.mp3")
+		sp.audioEffects[AudioAirspaceViolation] = loadMP3("MCI_1000ms.mp3")
 	}
 }
 
@@ -11,7 +11,6 @@ import (
 	"image/draw"
 	"image/png"
 	"log/slog"
-	gomath "math"
 	"math/bits"
 	"net/http"
 	"net/url"
@@ -677,17 +676,20 @@ func (sp *STARSPane) drawRangeRings(ctx *panes.Context, transforms ScopeTransfor
 		return
 	}
 
+	rings := panes.RangeRings{
+		Center: panes.MeasurePoint{Loc: util.Select(ps.UseUserRangeRingsCenter, ps.RangeRingsUserCenter, ps.DefaultCenter)},
+		Radius: float32(ps.RangeRingRadius),
+		Count:  39,
+	}
 	pixelDistanceNm := transforms.PixelDistanceNM(ctx.ControlClient.NmPerLongitude)
-	ctr := util.Select(ps.UseUserRangeRingsCenter, ps.RangeRingsUserCenter, ps.DefaultCenter)
-	centerWindow := transforms.WindowFromLatLongP(ctr)
+	centerWindow := transforms.WindowFromLatLongP(rings.Center.Loc)
 
 	ld := renderer.GetLinesDrawBuilder()
 	defer renderer.ReturnLinesDrawBuilder(ld)
 
-	for i := 1; i < 40; i++ {
+	for _, r := range rings.Radii() {
 		// Radius of this ring in pixels
-		r := float32(i) * float32(ps.RangeRingRadius) / pixelDistanceNm
-		ld.AddCircle(centerWindow, r, 360)
+		ld.AddCircle(centerWindow, r/pixelDistanceNm, 360)
 	}
 
 	cb.LineWidth(1, ctx.DPIScale)
@@ -846,7 +848,7 @@ func (sp *STARSPane) drawVFRAirports(ctx *panes.Context, transforms ScopeTransfo
 
 	for name, ap := range ctx.ControlClient.State.DepartureAirports {
 		if ap.VFRRateSum() > 0 {
-			pll := av.DB.Airports[name].Location
+			pll := av.DB.Airports()[name].Location
 			pw := transforms.WindowFromLatLongP(pll)
 			ld.AddCircle(pw, 10, 32)
 
@@ -873,73 +875,41 @@ func (sp *STARSPane) drawRBLs(aircraft []*av.Aircraft, ctx *panes.Context, trans
 		Font:  sp.systemFont(ctx, ps.CharSize.Tools),
 		Color: color,
 	}
+	tracks := sp.measureTracks(ctx, aircraft)
+
+	drawRBL := func(rbl panes.RangeBearingLine, idx int) {
+		rb, ok := rbl.Measure(tracks, ctx.ControlClient.NmPerLongitude, ctx.ControlClient.MagneticVariation)
+		if !ok {
+			return
+		}
 
-	drawRBL := func(p0 math.Point2LL, p1 math.Point2LL, idx int, gs float32) {
 		// Format the range-bearing line text for the two positions.
-		hdg := math.Heading2LL(p0, p1, ctx.ControlClient.NmPerLongitude, ctx.ControlClient.MagneticVariation)
-		dist := math.NMDistance2LL(p0, p1)
-		text := fmt.Sprintf(" %03d/%.2f", int(hdg+.5), dist) // leading space for alignment
-		if gs != 0 {
+		text := fmt.Sprintf(" %03d/%.2f", int(rb.Heading+.5), rb.Distance) // leading space for alignment
+		if rb.ETA != 0 {
 			// Add ETA in minutes
-			eta := 60 * dist / gs
-			text += fmt.Sprintf("/%d", int(eta+.5))
+			text += fmt.Sprintf("/%d", int(rb.ETA+.5))
 		}
 		text += fmt.Sprintf("-%d", idx)
 
 		// And draw the line and the text.
-		pText := transforms.WindowFromLatLongP(p1) // draw at right endpoint
-		//pText[1] += float32(style.Font.Size / 2)   // vertically align
+		pText := transforms.WindowFromLatLongP(rb.P1) // draw at right endpoint
 		td.AddText(text, pText, style)
-		ld.AddLine(p0, p1, color)
+		ld.AddLine(rb.P0, rb.P1, color)
 	}
 
 	// Maybe draw a wip RBL with p1 as the mouse's position
-	if sp.wipRBL != nil {
-		wp := sp.wipRBL.P[0]
-		if ctx.Mouse != nil {
-			p1 := transforms.LatLongFromWindowP(ctx.Mouse.Pos)
-			if wp.Callsign != "" {
-				if ac := ctx.ControlClient.Aircraft[wp.Callsign]; ac != nil && sp.datablockVisible(ac, ctx) &&
-					slices.Contains(aircraft, ac) {
-					if state, ok := sp.Aircraft[wp.Callsign]; ok {
-						drawRBL(state.TrackPosition(), p1, len(sp.RangeBearingLines)+1, ac.GS())
-					}
-				}
-			} else {
-				drawRBL(wp.Loc, p1, len(sp.RangeBearingLines)+1, 0)
-			}
-		}
+	if sp.wipRBL != nil && ctx.Mouse != nil {
+		rbl := *sp.wipRBL
+		rbl.P[1] = panes.MeasurePoint{Loc: transforms.LatLongFromWindowP(ctx.Mouse.Pos)}
+		drawRBL(rbl, len(sp.RangeBearingLines)+1)
 	}
 
 	for i, rbl := range sp.RangeBearingLines {
-		if p0, p1 := rbl.GetPoints(ctx, aircraft, sp); !p0.IsZero() && !p1.IsZero() {
-			gs := float32(0)
-
-			// If one but not both are tracks, get the groundspeed so we
-			// can display an ETA.
-			if rbl.P[0].Callsign != "" {
-				if rbl.P[1].Callsign == "" {
-					if ac := ctx.ControlClient.Aircraft[rbl.P[0].Callsign]; ac != nil {
-						gs = ac.GS()
-					}
-				}
-			} else if rbl.P[1].Callsign != "" {
-				if rbl.P[0].Callsign == "" {
-					if ac := ctx.ControlClient.Aircraft[rbl.P[1].Callsign]; ac != nil {
-						gs = ac.GS()
-					}
-				}
-			}
-
-			drawRBL(p0, p1, i+1, gs)
-		}
+		drawRBL(rbl, i+1)
 	}
 
 	// Remove stale ones that include aircraft that have landed, etc.
-	sp.RangeBearingLines = util.FilterSlice(sp.RangeBearingLines, func(rbl STARSRangeBearingLine) bool {
-		p0, p1 := rbl.GetPoints(ctx, aircraft, sp)
-		return !p0.IsZero() && !p1.IsZero()
-	})
+	sp.RangeBearingLines = panes.PruneRangeBearingLines(sp.RangeBearingLines, tracks)
 
 	transforms.LoadLatLongViewingMatrices(cb)
 	ld.GenerateCommands(cb)
@@ -947,46 +917,50 @@ func (sp *STARSPane) drawRBLs(aircraft []*av.Aircraft, ctx *panes.Context, trans
 	td.GenerateCommands(cb)
 }
 
+// measureTracks returns a panes.TrackFunc for the measurement tools that
+// gives the positions of the visible tracks.
+func (sp *STARSPane) measureTracks(ctx *panes.Context, visibleAircraft []*av.Aircraft) panes.TrackFunc {
+	return func(callsign string) (panes.MeasureTrack, bool) {
+		ac, ok := ctx.ControlClient.Aircraft[callsign]
+		if !ok || !slices.Contains(visibleAircraft, ac) {
+			return panes.MeasureTrack{}, false
+		}
+		state, ok := sp.Aircraft[callsign]
+		if !ok || state.LostTrack(ctx.ControlClient.SimTime) {
+			return panes.MeasureTrack{}, false
+		}
+		return panes.MeasureTrack{
+			Position:    state.TrackPosition(),
+			Velocity:    state.HeadingVector(ac.NmPerLongitude(), ac.MagneticVariation()),
+			Groundspeed: ac.GS(),
+		}, true
+	}
+}
+
 // Draw the minimum separation line between two aircraft, if selected.
-func (sp *STARSPane) drawMinSep(ctx *panes.Context, transforms ScopeTransformations, cb *renderer.CommandBuffer) {
+func (sp *STARSPane) drawMinSep(aircraft []*av.Aircraft, ctx *panes.Context, transforms ScopeTransformations,
+	cb *renderer.CommandBuffer) {
 	cs0, cs1 := sp.MinSepAircraft[0], sp.MinSepAircraft[1]
 	if cs0 == "" || cs1 == "" {
 		// Two aircraft haven't been specified.
 		return
 	}
-	ac0, ok0 := ctx.ControlClient.Aircraft[cs0]
-	ac1, ok1 := ctx.ControlClient.Aircraft[cs1]
+	tracks := sp.measureTracks(ctx, aircraft)
+	t0, ok0 := tracks(cs0)
+	t1, ok1 := tracks(cs1)
 	if !ok0 || !ok1 {
 		// Missing aircraft
 		return
 	}
 
-	ps := sp.currentPrefs()
-	color := ps.Brightness.Lines.RGB()
-
-	s0, ok0 := sp.Aircraft[ac0.Callsign]
-	s1, ok1 := sp.Aircraft[ac1.Callsign]
-	if !ok0 || !ok1 {
+	ca, ok := panes.MeasureClosestApproach(t0, t1, ctx.ControlClient.NmPerLongitude)
+	if !ok {
+		// If something blew up computing it then just bail out here.
 		return
 	}
 
-	// Go ahead and draw the minimum separation lines and text.
-	p0ll, p1ll := s0.TrackPosition(), s1.TrackPosition()
-	d0ll := s0.HeadingVector(ac0.NmPerLongitude(), ac0.MagneticVariation())
-	d1ll := s1.HeadingVector(ac1.NmPerLongitude(), ac1.MagneticVariation())
-
-	p0, d0 := math.LL2NM(p0ll, ac0.NmPerLongitude()), math.LL2NM(d0ll, ac0.NmPerLongitude())
-	p1, d1 := math.LL2NM(p1ll, ac1.NmPerLongitude()), math.LL2NM(d1ll, ac1.NmPerLongitude())
-
-	// Find the parametric distance along the respective rays of the
-	// aircrafts' courses where they at at a minimum distance; this is
-	// linearly extrapolating their positions.
-	tmin := math.RayRayMinimumDistance(p0, d0, p1, d1)
-
-	// If something blew up in RayRayMinimumDistance then just bail out here.
-	if gomath.IsInf(float64(tmin), 0) || gomath.IsNaN(float64(tmin)) {
-		return
-	}
+	ps := sp.currentPrefs()
+	color := ps.Brightness.Lines.RGB()
 
 	ld := renderer.GetColoredLinesDrawBuilder()
 	defer renderer.ReturnColoredLinesDrawBuilder(ld)
@@ -998,26 +972,20 @@ func (sp *STARSPane) drawMinSep(ctx *panes.Context, transforms ScopeTransformati
 	font := sp.systemFont(ctx, ps.CharSize.Tools)
 
 	// Draw the separator lines (and triangles, if appropriate.)
-	var pw0, pw1 [2]float32          // Window coordinates of the points of minimum approach
-	var p0tmin, p1tmin math.Point2LL // Lat-long coordinates of the points of minimum approach
-	if tmin < 0 {
+	pw0, pw1 := transforms.WindowFromLatLongP(ca.P0), transforms.WindowFromLatLongP(ca.P1)
+	if ca.Diverging() {
 		// The closest approach was in the past; just draw a line between
-		// the two tracks and initialize the above coordinates.
-		ld.AddLine(p0ll, p1ll, color)
-		p0tmin, p1tmin = p0ll, p1ll
-		pw0, pw1 = transforms.WindowFromLatLongP(p0ll), transforms.WindowFromLatLongP(p1ll)
+		// the two tracks.
+		ld.AddLine(ca.P0, ca.P1, color)
 	} else {
 		// Closest approach in the future: draw a line from each track to
 		// the minimum separation line as well as the minimum separation
 		// line itself.
-		p0tmin = math.NM2LL(math.Add2f(p0, math.Scale2f(d0, tmin)), ac0.NmPerLongitude())
-		p1tmin = math.NM2LL(math.Add2f(p1, math.Scale2f(d1, tmin)), ac1.NmPerLongitude())
-		ld.AddLine(p0ll, p0tmin, color)
-		ld.AddLine(p0tmin, p1tmin, color)
-		ld.AddLine(p1tmin, p1ll, color)
-
-		// Draw filled triangles centered at p0tmin and p1tmin.
-		pw0, pw1 = transforms.WindowFromLatLongP(p0tmin), transforms.WindowFromLatLongP(p1tmin)
+		ld.AddLine(t0.Position, ca.P0, color)
+		ld.AddLine(ca.P0, ca.P1, color)
+		ld.AddLine(ca.P1, t1.Position, color)
+
+		// Draw filled triangles centered at the points of minimum approach.
 		style := renderer.TextStyle{Font: font, Color: color}
 		td.AddTextCentered(STARSFilledUpTriangle, pw0, style)
 		td.AddTextCentered(STARSFilledUpTriangle, pw1, style)
@@ -1032,8 +1000,8 @@ func (sp *STARSPane) drawMinSep(ctx *panes.Context, transforms ScopeTransformati
 		DrawBackground:  true,
 		BackgroundColor: renderer.RGB{},
 	}
-	text := fmt.Sprintf("%.2fNM", math.NMDistance2LL(p0tmin, p1tmin))
-	if tmin < 0 {
+	text := fmt.Sprintf("%.2fNM", ca.Distance)
+	if ca.Diverging() {
 		text = "NO XING\n" + text
 	}
 	td.AddTextCentered(text, pText, style)
@@ -1744,6 +1712,40 @@ func (sp *STARSPane) drawRingsAndCones(aircraft []*av.Aircraft, ctx *panes.Conte
 	td.GenerateCommands(cb)
 }
 
+// drawSlotMarkers draws a chevron pointing toward the runway at the slot
+// on final of each aircraft that is following another to the runway.
+func (sp *STARSPane) drawSlotMarkers(aircraft []*av.Aircraft, ctx *panes.Context, transforms ScopeTransformations,
+	cb *renderer.CommandBuffer) {
+	ps := sp.currentPrefs()
+	if !ps.DisplaySlotMarkers {
+		return
+	}
+
+	ld := renderer.GetLinesDrawBuilder()
+	defer renderer.ReturnLinesDrawBuilder(ld)
+
+	now := ctx.ControlClient.SimTime
+	for _, ac := range aircraft {
+		state := sp.Aircraft[ac.Callsign]
+		vol := ac.ATPAVolume()
+		if state.SlotDistance == 0 || vol == nil || state.LostTrack(now) {
+			continue
+		}
+
+		rot := math.Rotator2f(vol.Heading - ac.MagneticVariation())
+		pw := transforms.WindowFromLatLongP(state.SlotMarker)
+		pts := [3][2]float32{{-6, -4}, {0, 4}, {6, -4}}
+		for i := range pts {
+			pts[i] = math.Add2f(pw, rot(pts[i]))
+		}
+		ld.AddLineStrip(pts[:])
+	}
+
+	transforms.LoadWindowViewingMatrices(cb)
+	cb.SetRGB(ps.Brightness.Lines.ScaleRGB(STARSJRingConeColor))
+	ld.GenerateCommands(cb)
+}
+
 func (sp *STARSPane) drawSelectedRoute(ctx *panes.Context, transforms ScopeTransformations, cb *renderer.CommandBuffer) {
 	if sp.drawRouteAircraft == "" {
 		return
@@ -1791,35 +1793,6 @@ func (sp *STARSPane) drawPlotPoints(ctx *panes.Context, transforms ScopeTransfor
 	ld.GenerateCommands(cb)
 }
 
-type STARSRangeBearingLine struct {
-	P [2]struct {
-		// If callsign is given, use that aircraft's position;
-		// otherwise we have a fixed position.
-		Loc      math.Point2LL
-		Callsign string
-	}
-}
-
-func (rbl STARSRangeBearingLine) GetPoints(ctx *panes.Context, visibleAircraft []*av.Aircraft, sp *STARSPane) (p0, p1 math.Point2LL) {
-	// Each line endpoint may be specified either by an aircraft's
-	// position or by a fixed position. We'll start with the fixed
-	// position and then override it if there's a valid *Aircraft.
-	p0, p1 = rbl.P[0].Loc, rbl.P[1].Loc
-	if ac := ctx.ControlClient.Aircraft[rbl.P[0].Callsign]; ac != nil {
-		state, ok := sp.Aircraft[ac.Callsign]
-		if ok && !state.LostTrack(ctx.ControlClient.SimTime) && slices.Contains(visibleAircraft, ac) {
-			p0 = state.TrackPosition()
-		}
-	}
-	if ac := ctx.ControlClient.Aircraft[rbl.P[1].Callsign]; ac != nil {
-		state, ok := sp.Aircraft[ac.Callsign]
-		if ok && !state.LostTrack(ctx.ControlClient.SimTime) && slices.Contains(visibleAircraft, ac) {
-			p1 = state.TrackPosition()
-		}
-	}
-	return
-}
-
 func rblSecondClickHandler(ctx *panes.Context, sp *STARSPane) func([2]float32, ScopeTransformations) (status CommandStatus) {
 	return func(pw [2]float32, transforms ScopeTransformations) (status CommandStatus) {
 		if sp.wipRBL == nil {
@@ -40,22 +40,23 @@ func (sp *STARSPane) getTrack(ctx *panes.Context, ac *av.Aircraft) sim.TrackInfo
 	return trk
 }
 
+// priority returns the flight's priority flags from the facility's flight
+// plan for it or, if there isn't one, from the aircraft.
+func (sp *STARSPane) priority(ctx *panes.Context, ac *av.Aircraft) av.PriorityFlags {
+	if trk := sp.getTrack(ctx, ac); trk.FlightPlan != nil {
+		return trk.FlightPlan.Priority
+	}
+	return ac.Priority()
+}
+
 type AircraftState struct {
-	// Independently of the track history, we store the most recent track
-	// from the sensor as well as the previous one. This gives us the
-	// freshest possible information for things like calculating headings,
-	// rates of altitude change, etc.
+	// Independently of the track history, which comes from the sim, we
+	// store the most recent track from the sensor as well as the previous
+	// one. This gives us the freshest possible information for things
+	// like calculating headings, rates of altitude change, etc.
 	track         av.RadarTrack
 	previousTrack av.RadarTrack
 
-	// Radar track history is maintained with a ring buffer where
-	// historyTracksIndex is the index of the next track to be written.
-	// (Thus, historyTracksIndex==0 implies that there are no tracks.)
-	// Changing to/from FUSED mode causes tracksIndex to be reset, thus
-	// discarding previous tracks.
-	historyTracks      [10]av.RadarTrack
-	historyTracksIndex int
-
 	FullLDBEndTime           time.Time // If the LDB displays the groundspeed. When to stop
 	DisplayRequestedAltitude *bool     // nil if unspecified
 
@@ -83,6 +84,11 @@ type AircraftState struct {
 	MinimumMIT               float32
 	ATPALeadAircraftCallsign string
 
+	// Where on final the aircraft should be to be spaced behind the
+	// aircraft ahead of it; only drawn if SlotDistance is non-zero.
+	SlotMarker   math.Point2LL
+	SlotDistance float32 // from the threshold, nm
+
 	POFlashingEndTime time.Time
 	UNFlashingEndTime time.Time
 	IFFlashing        bool // Will continue to flash unless slewed or a successful handoff
@@ -227,69 +233,73 @@ func (s *AircraftState) Ident(now time.Time) bool {
 }
 
 func (sp *STARSPane) processEvents(ctx *panes.Context) {
-	// First handle changes in world.Aircraft
-	for callsign, ac := range ctx.ControlClient.Aircraft {
-		if _, ok := sp.Aircraft[callsign]; !ok {
-			// First we've seen it; create the *AircraftState for it
-			sa := &AircraftState{}
-			sa.GlobalLeaderLineDirection = ac.GlobalLeaderLineDirection
-			sa.UseGlobalLeaderLine = sa.GlobalLeaderLineDirection != nil
-			sa.FirstSeen = ctx.ControlClient.SimTime
-			sa.CWTCategory = ac.CWT()
-			sa.TabListIndex = TabListUnassignedIndex
-
-			sp.Aircraft[callsign] = sa
-		}
+	// First handle changes in world.Aircraft; there's nothing to do if
+	// they're the same as the last time we looked.
+	if gen := ctx.ControlClient.AircraftGeneration(); gen != sp.aircraftGeneration {
+		sp.aircraftGeneration = gen
+		for callsign, ac := range ctx.ControlClient.Aircraft {
+			if _, ok := sp.Aircraft[callsign]; !ok {
+				// First we've seen it; create the *AircraftState for it
+				sa := &AircraftState{}
+				sa.GlobalLeaderLineDirection = ac.GlobalLeaderLineDirection
+				sa.UseGlobalLeaderLine = sa.GlobalLeaderLineDirection != nil
+				sa.FirstSeen = ctx.ControlClient.SimTime
+				sa.CWTCategory = ac.CWT()
+				sa.TabListIndex = TabListUnassignedIndex
+
+				sp.Aircraft[callsign] = sa
+			}
 
-		if ok, _ := ac.Squawk.IsSPC(); ok && !sp.Aircraft[callsign].SPCAlert {
-			// First we've seen it
-			state := sp.Aircraft[callsign]
-			state.SPCAlert = true
-			state.SPCAcknowledged = false
-			state.SPCSoundEnd = ctx.Now.Add(AlertAudioDuration)
+			if ok, _ := ac.Squawk.IsSPC(); ok && !sp.Aircraft[callsign].SPCAlert {
+				// First we've seen it
+				state := sp.Aircraft[callsign]
+				state.SPCAlert = true
+				state.SPCAcknowledged = false
+				state.SPCSoundEnd = ctx.Now.Add(AlertAudioDuration)
+			}
 		}
-	}
 
-	// See if any aircraft we have state for have been removed
-	for callsign, state := range sp.Aircraft {
-		if _, ok := ctx.ControlClient.Aircraft[callsign]; !ok {
-			// Free up the Tab list entry
-			if state.TabListIndex != TabListUnassignedIndex {
-				sp.TabListAircraft[state.TabListIndex] = ""
+		// See if any aircraft we have state for have been removed
+		for callsign, state := range sp.Aircraft {
+			if _, ok := ctx.ControlClient.Aircraft[callsign]; !ok {
+				// Free up the Tab list entry
+				if state.TabListIndex != TabListUnassignedIndex {
+					sp.TabListAircraft[state.TabListIndex] = ""
+				}
+				delete(sp.Aircraft, callsign)
 			}
-			delete(sp.Aircraft, callsign)
 		}
-	}
 
-	// Look for duplicate beacon codes
-	sp.DuplicateBeacons = make(map[av.Squawk]interface{})
-	beaconCount := make(map[av.Squawk]int)
-	for _, ac := range ctx.ControlClient.Aircraft {
-		// Don't count SPC or VFR as duplicates.
-		if ok, _ := av.SquawkIsSPC(ac.Squawk); ok {
-			continue
-		}
-		if ac.Squawk == 0o1200 {
-			continue
-		}
+		// Look for duplicate beacon codes
+		sp.DuplicateBeacons = make(map[av.Squawk]interface{})
+		beaconCount := make(map[av.Squawk]int)
+		for _, ac := range ctx.ControlClient.Aircraft {
+			// Don't count SPC or VFR as duplicates.
+			if ok, _ := av.SquawkIsSPC(ac.Squawk); ok {
+				continue
+			}
+			if ac.Squawk == 0o1200 {
+				continue
+			}
 
-		beaconCount[ac.Squawk] = beaconCount[ac.Squawk] + 1
-		if beaconCount[ac.Squawk] > 1 {
-			sp.DuplicateBeacons[ac.Squawk] = nil
+			beaconCount[ac.Squawk] = beaconCount[ac.Squawk] + 1
+			if beaconCount[ac.Squawk] > 1 {
+				sp.DuplicateBeacons[ac.Squawk] = nil
+			}
 		}
-	}
 
-	// Filter out any removed aircraft from the CA and MCI lists
-	sp.CAAircraft = util.FilterSliceInPlace(sp.CAAircraft, func(ca CAAircraft) bool {
-		_, a := ctx.ControlClient.Aircraft[ca.Callsigns[0]]
-		_, b := ctx.ControlClient.Aircraft[ca.Callsigns[1]]
-		return a && b
-	})
-	sp.MCIAircraft = util.FilterSliceInPlace(sp.MCIAircraft, func(ca CAAircraft) bool {
-		_, a := ctx.ControlClient.Aircraft[ca.Callsigns[0]]
-		_, b := ctx.ControlClient.Aircraft[ca.Callsigns[1]]
-		return a && b
-	})
+		// Filter out any removed aircraft from the CA and MCI lists
+		sp.CAAircraft = util.FilterSliceInPlace(sp.CAAircraft, func(ca CAAircraft) bool {
+			_, a := ctx.ControlClient.Aircraft[ca.Callsigns[0]]
+			_, b := ctx.ControlClient.Aircraft[ca.Callsigns[1]]
+			return a && b
+		})
+		sp.MCIAircraft = util.FilterSliceInPlace(sp.MCIAircraft, func(ca CAAircraft) bool {
+			_, a := ctx.ControlClient.Aircraft[ca.Callsigns[0]]
+			_, b := ctx.ControlClient.Aircraft[ca.Callsigns[1]]
+			return a && b
+		})
+	}
 
 	// In the following, note that we may see events that refer to aircraft
 	// that no longer exist (e.g., due to deletion). Thus, this is a case
@@ -382,6 +392,11 @@ func (sp *STARSPane) processEvents(ctx *panes.Context) {
 			}
 			sp.ForceQLCallsigns[event.Callsign] = nil
 
+		case sim.AirspaceViolationEvent:
+			if event.ToController == ctx.ControlClient.PrimaryTCP {
+				sp.playOnce(ctx.Platform, AudioAirspaceViolation)
+			}
+
 		case sim.TransferRejectedEvent:
 			if state, ok := sp.Aircraft[event.Callsign]; ok {
 				state.IFFlashing = true
@@ -392,6 +407,10 @@ func (sp *STARSPane) processEvents(ctx *panes.Context) {
 			if state, ok := sp.Aircraft[event.Callsign]; ok {
 				state.IFFlashing = false
 			}
+
+		case sim.SimRewoundEvent:
+			// The tracks we have are from the future.
+			sp.discardTracks = true
 		}
 	}
 }
@@ -462,11 +481,21 @@ func (sp *STARSPane) updateMSAWs(ctx *panes.Context) {
 func (sp *STARSPane) updateRadarTracks(ctx *panes.Context) {
 	// FIXME: all aircraft radar tracks are updated at the same time.
 	now := ctx.ControlClient.SimTime
-	if sp.radarMode(ctx.ControlClient.State.STARSFacilityAdaptation.RadarSites) == RadarModeFused {
+	radarSites := ctx.ControlClient.State.STARSFacilityAdaptation.RadarSites
+	var singleSite *av.RadarSite
+	switch sp.radarMode(radarSites) {
+	case RadarModeFused:
 		if now.Sub(sp.lastTrackUpdate) < 1*time.Second {
 			return
 		}
-	} else {
+	case RadarModeSingle:
+		// Tracks are updated once per revolution of the selected site's
+		// antenna.
+		singleSite = radarSites[sp.currentPrefs().RadarSiteSelected]
+		if now.Sub(sp.lastTrackUpdate) < singleSite.ScanInterval() {
+			return
+		}
+	default:
 		if now.Sub(sp.lastTrackUpdate) < 5*time.Second {
 			return
 		}
@@ -487,6 +516,10 @@ func (sp *STARSPane) updateRadarTracks(ctx *panes.Context) {
 			Groundspeed: int(ac.Nav.FlightState.GS),
 			Time:        now,
 		}
+		if singleSite != nil {
+			// A single sensor can't correct for slant range.
+			state.track.Position = singleSite.SlantRangePosition(state.track.Position, state.track.Altitude)
+		}
 	}
 
 	// Update low altitude alerts now that we have updated tracks
@@ -497,19 +530,6 @@ func (sp *STARSPane) updateRadarTracks(ctx *panes.Context) {
 		return aircraft[i].Callsign < aircraft[j].Callsign
 	})
 
-	// History tracks are updated after a radar track update, only if
-	// H_RATE seconds have elapsed (4-94).
-	ps := sp.currentPrefs()
-	if now.Sub(sp.lastHistoryTrackUpdate).Seconds() >= float64(ps.RadarTrackHistoryRate) {
-		sp.lastHistoryTrackUpdate = now
-		for _, ac := range aircraft { // We only get radar tracks for visible aircraft
-			state := sp.Aircraft[ac.Callsign]
-			idx := state.historyTracksIndex % len(state.historyTracks)
-			state.historyTracks[idx] = state.track
-			state.historyTracksIndex++
-		}
-	}
-
 	sp.updateCAAircraft(ctx, aircraft)
 	sp.updateInTrailDistance(ctx, aircraft)
 
@@ -705,12 +725,12 @@ func (sp *STARSPane) drawGhosts(ghosts []*av.GhostAircraft, ctx *panes.Context,
 		td.AddTextCentered(ghost.TrackId, pw, trackStyle)
 
 		// Draw datablock
-		db := sp.getGhostDatablock(ghost, color)
+		db := sp.getGhostDatablock(ctx, ghost, color)
 		pac := transforms.WindowFromLatLongP(ghost.Position)
 		vll := sp.getLeaderLineVector(ctx, ghost.LeaderLineDirection)
 		pll := math.Add2f(pac, vll)
 
-		db.draw(td, pll, datablockFont, brightness, ghost.LeaderLineDirection, ctx.Now.Unix())
+		dbDraw(db, td, pll, datablockFont, brightness, ghost.LeaderLineDirection, ctx.Now.Unix())
 
 		// Leader line
 		ld.AddLine(pac, math.Add2f(pac, vll), color)
@@ -879,6 +899,8 @@ func (sp *STARSPane) drawHistoryTrails(aircraft []*av.Aircraft, ctx *panes.Conte
 
 	historyBuilder := renderer.GetColoredTrianglesDrawBuilder()
 	defer renderer.ReturnColoredTrianglesDrawBuilder(historyBuilder)
+	ld := renderer.GetColoredLinesDrawBuilder()
+	defer renderer.ReturnColoredLinesDrawBuilder(ld)
 
 	const historyTrackDiameter = 8
 	historyTrackVertices := getTrackVertices(ctx, historyTrackDiameter)
@@ -892,23 +914,66 @@ func (sp *STARSPane) drawHistoryTrails(aircraft []*av.Aircraft, ctx *panes.Conte
 		}
 
 		// Draw history from new to old
-		for i := range ps.RadarTrackHistory {
-			trackColorNum := math.Min(i, len(STARSTrackHistoryColors)-1)
+		prev := state.TrackPosition()
+		for i, p := range sp.historyPositions(ctx, ac, state) {
+			trackColorNum := util.Select(ps.DisableHistoryFade, 0, math.Min(i, len(STARSTrackHistoryColors)-1))
 			trackColor := ps.Brightness.History.ScaleRGB(STARSTrackHistoryColors[trackColorNum])
 
-			if idx := (state.historyTracksIndex - 1 - i) % len(state.historyTracks); idx >= 0 {
-				if p := state.historyTracks[idx].Position; !p.IsZero() {
-					drawTrack(historyBuilder, transforms.WindowFromLatLongP(p), historyTrackVertices,
-						trackColor)
-				}
+			if ps.HistoryLines {
+				ld.AddLine(prev, p, trackColor)
+				prev = p
+			} else {
+				drawTrack(historyBuilder, transforms.WindowFromLatLongP(p), historyTrackVertices,
+					trackColor)
 			}
 		}
 	}
 
+	transforms.LoadLatLongViewingMatrices(cb)
+	ld.GenerateCommands(cb)
 	transforms.LoadWindowViewingMatrices(cb)
 	historyBuilder.GenerateCommands(cb)
 }
 
+// historyPositions returns the positions of the aircraft's history
+// tracks, newest first. They're taken from the sim's track history at the
+// H_RATE interval (4-94).
+func (sp *STARSPane) historyPositions(ctx *panes.Context, ac *av.Aircraft, state *AircraftState) []math.Point2LL {
+	ps := sp.currentPrefs()
+	hist, ok := ctx.ControlClient.State.TrackHistories[ac.Callsign]
+	if !ok || ps.RadarTrackHistory == 0 {
+		return nil
+	}
+
+	var singleSite *av.RadarSite
+	radarSites := ctx.ControlClient.State.STARSFacilityAdaptation.RadarSites
+	if sp.radarMode(radarSites) == RadarModeSingle {
+		singleSite = radarSites[ps.RadarSiteSelected]
+	}
+
+	rate := time.Duration(ps.RadarTrackHistoryRate * float32(time.Second))
+	next := state.track.Time.Add(-rate)
+	var pos []math.Point2LL
+	for _, trk := range hist.Recent(len(hist.Tracks)) {
+		if len(pos) == ps.RadarTrackHistory || !trk.Time.After(sp.historyStart) {
+			break
+		}
+		if trk.Time.After(next) {
+			continue
+		}
+
+		p := trk.Position
+		if singleSite != nil {
+			// As with the radar tracks, a single sensor can't correct
+			// for slant range.
+			p = singleSite.SlantRangePosition(p, trk.Altitude)
+		}
+		pos = append(pos, p)
+		next = trk.Time.Add(-rate)
+	}
+	return pos
+}
+
 func (sp *STARSPane) WarnOutsideAirspace(ctx *panes.Context, ac *av.Aircraft) ([][2]int, bool) {
 	// Only report on ones that are tracked by us
 	if trk := sp.getTrack(ctx, ac); trk.TrackOwner != ctx.ControlClient.PrimaryTCP {
@@ -1048,12 +1113,17 @@ func (sp *STARSPane) updateCAAircraft(ctx *panes.Context, aircraft []*av.Aircraf
 	})
 
 	// Add new conflicts; by appending we keep them sorted by when they
-	// were first detected...
-	for cs0 := range tracked {
-		for cs1 := range tracked {
-			if cs0 >= cs1 { // alphabetically-ordered callsign pair
-				continue
-			}
+	// were first detected... Only aircraft within 10nm of each other can
+	// be in conflict, so use a spatial index to find candidate pairs.
+	airborne := util.FilterSlice(aircraft, func(ac *av.Aircraft) bool { return ac.IsAirborne() })
+	idx := sim.NewAircraftIndex(airborne, func(ac *av.Aircraft) math.Point2LL {
+		return sp.Aircraft[ac.Callsign].TrackPosition()
+	}, ctx.ControlClient.NmPerLongitude)
+	for _, pair := range idx.PairsWithin(10) {
+		cs0, cs1 := pair[0].Callsign, pair[1].Callsign // alphabetically-ordered callsign pair
+		_, tracked0 := tracked[cs0]
+		_, tracked1 := tracked[cs1]
+		if tracked0 && tracked1 {
 			if slices.ContainsFunc(sp.CAAircraft, func(ca CAAircraft) bool {
 				return cs0 == ca.Callsigns[0] && cs1 == ca.Callsigns[1]
 			}) {
@@ -1066,21 +1136,26 @@ func (sp *STARSPane) updateCAAircraft(ctx *panes.Context, aircraft []*av.Aircraf
 					Start:     time.Now(), // this rather than ctx.Now so they are unique and sort consistently for the list.
 				})
 			}
+			continue
 		}
 
-		for cs1 := range untracked {
-			if slices.ContainsFunc(sp.MCIAircraft, func(ca CAAircraft) bool {
-				return cs0 == ca.Callsigns[0] && cs1 == ca.Callsigns[1]
-			}) {
-				continue
-			}
-			if mciConflict(cs0, cs1) {
-				sp.MCIAircraft = append(sp.MCIAircraft, CAAircraft{
-					Callsigns: [2]string{cs0, cs1},
-					SoundEnd:  ctx.Now.Add(AlertAudioDuration),
-					Start:     time.Now(), // this rather than ctx.Now so they are unique and sort consistently for the list.
-				})
-			}
+		// MCI pairs are ordered tracked, untracked.
+		if tracked1 {
+			cs0, cs1 = cs1, cs0
+		} else if !tracked0 {
+			continue
+		}
+		if slices.ContainsFunc(sp.MCIAircraft, func(ca CAAircraft) bool {
+			return cs0 == ca.Callsigns[0] && cs1 == ca.Callsigns[1]
+		}) {
+			continue
+		}
+		if mciConflict(cs0, cs1) {
+			sp.MCIAircraft = append(sp.MCIAircraft, CAAircraft{
+				Callsigns: [2]string{cs0, cs1},
+				SoundEnd:  ctx.Now.Add(AlertAudioDuration),
+				Start:     time.Now(), // this rather than ctx.Now so they are unique and sort consistently for the list.
+			})
 		}
 	}
 }
@@ -1092,6 +1167,7 @@ func (sp *STARSPane) updateInTrailDistance(ctx *panes.Context, aircraft []*av.Ai
 		sp.Aircraft[ac.Callsign].MinimumMIT = 0
 		sp.Aircraft[ac.Callsign].ATPAStatus = ATPAStatusUnset
 		sp.Aircraft[ac.Callsign].ATPALeadAircraftCallsign = ""
+		sp.Aircraft[ac.Callsign].SlotDistance = 0
 	}
 
 	// For simplicity, we always compute all of the necessary distances
@@ -1154,6 +1230,7 @@ func (sp *STARSPane) updateInTrailDistance(ctx *panes.Context, aircraft []*av.Ai
 			trailingState.IntrailDistance =
 				math.NMDistance2LL(leadingState.TrackPosition(), trailingState.TrackPosition())
 			sp.checkInTrailCwtSeparation(ctx, trailing, leading)
+			sp.updateSlotMarker(trailing, leading)
 		}
 		handledVolumes[vol.Id] = nil
 	}
@@ -1198,8 +1275,15 @@ func (ma *ModeledAircraft) EstimatedAltitude(s float32) float32 {
 
 // Return estimated position 1s in the future
 func (ma *ModeledAircraft) NextPosition(p [2]float32) [2]float32 {
+	gs := ma.groundspeedAt(math.Distance2f(p, ma.threshold)) / 3600 // nm / second
+	return math.Add2f(p, math.Scale2f(ma.v, gs))
+}
+
+// groundspeedAt returns the aircraft's estimated groundspeed when it is
+// td nm from the threshold: it slows to its landing speed starting 5 nm
+// out.
+func (ma *ModeledAircraft) groundspeedAt(td float32) float32 {
 	gs := ma.gs // current speed
-	td := math.Distance2f(p, ma.threshold)
 	if td < 2 {
 		gs = math.Min(gs, ma.landingSpeed)
 	} else if td < 5 {
@@ -1207,9 +1291,37 @@ func (ma *ModeledAircraft) NextPosition(p [2]float32) [2]float32 {
 		// lerp from current speed down to landing speed
 		gs = math.Lerp(t, ma.landingSpeed, gs)
 	}
+	return gs
+}
 
-	gs /= 3600 // nm / second
-	return math.Add2f(p, math.Scale2f(ma.v, gs))
+// Slot markers aren't computed for aircraft that are farther out than
+// this (nm).
+const maxSlotDistance = 30
+
+// TimeToThreshold returns the estimated number of seconds until the
+// aircraft reaches the threshold.
+func (ma *ModeledAircraft) TimeToThreshold() float32 {
+	var t float32
+	for td := math.Distance2f(ma.p, ma.threshold); td > 0 && t < 3600; td -= ma.groundspeedAt(td) / 3600 {
+		t++
+	}
+	return t
+}
+
+// SlotDistance returns the distance from the threshold at which the
+// aircraft would reach the threshold in t seconds, or 0 if that is more
+// than maxSlotDistance out.
+func (ma *ModeledAircraft) SlotDistance(t float32) float32 {
+	const step = 0.05 // nm
+	var td, tt float32
+	for tt < t {
+		tt += step / math.Max(ma.groundspeedAt(td), 1) * 3600
+		td += step
+		if td > maxSlotDistance {
+			return 0
+		}
+	}
+	return td
 }
 
 func (sp *STARSPane) checkInTrailCwtSeparation(ctx *panes.Context, back, front *av.Aircraft) {
@@ -1271,6 +1383,32 @@ func (sp *STARSPane) checkInTrailCwtSeparation(ctx *panes.Context, back, front *
 	}
 }
 
+// updateSlotMarker computes the trailing aircraft's slot on final: where
+// it should be so that, with both aircraft slowing to their landing
+// speeds, it is the required separation behind the leading aircraft when
+// that one reaches the threshold. The slot moves back as the leading
+// aircraft decelerates.
+func (sp *STARSPane) updateSlotMarker(back, front *av.Aircraft) {
+	state := sp.Aircraft[back.Callsign]
+	vol := back.ATPAVolume()
+
+	frontModel := MakeModeledAircraft(front, sp.Aircraft[front.Callsign], vol.Threshold)
+	backModel := MakeModeledAircraft(back, state, vol.Threshold)
+
+	// At the threshold, the trailing aircraft is at its landing speed.
+	spacing := state.MinimumMIT / backModel.landingSpeed * 3600
+	state.SlotDistance = backModel.SlotDistance(frontModel.TimeToThreshold() + spacing)
+	if state.SlotDistance == 0 {
+		return
+	}
+
+	// The slot is on the extended centerline.
+	hdg := math.Radians(vol.Heading - back.MagneticVariation() + 180)
+	v := [2]float32{math.Sin(hdg), math.Cos(hdg)}
+	p := math.Add2f(math.LL2NM(vol.Threshold, back.NmPerLongitude()), math.Scale2f(v, state.SlotDistance))
+	state.SlotMarker = math.NM2LL(p, back.NmPerLongitude())
+}
+
 func (sp *STARSPane) diverging(a, b *av.Aircraft) bool {
 	sa, sb := sp.Aircraft[a.Callsign], sp.Aircraft[b.Callsign]
 
@@ -1322,16 +1460,35 @@ func (sp *STARSPane) drawLeaderLines(aircraft []*av.Aircraft, ctx *panes.Context
 }
 
 func (sp *STARSPane) getLeaderLineDirection(ac *av.Aircraft, ctx *panes.Context) math.CardinalOrdinalDirection {
-	ps := sp.currentPrefs()
-	state := sp.Aircraft[ac.Callsign]
-	trk := sp.getTrack(ctx, ac)
+	if dir, ok := sp.manualLeaderLineDirection(ac); ok {
+		return dir
+	} else if dir, ok := sp.autoLeaderLineDirections[ac.Callsign]; ok {
+		// Chosen to avoid overlapping other datablocks; see layoutDatablocks
+		return dir
+	} else {
+		return sp.defaultLeaderLineDirection(ac, ctx)
+	}
+}
 
+// manualLeaderLineDirection returns the leader line direction for the
+// aircraft if one has been specified for it in particular.
+func (sp *STARSPane) manualLeaderLineDirection(ac *av.Aircraft) (math.CardinalOrdinalDirection, bool) {
+	state := sp.Aircraft[ac.Callsign]
 	if state.UseGlobalLeaderLine {
-		return *state.GlobalLeaderLineDirection
+		return *state.GlobalLeaderLineDirection, true
 	} else if state.LeaderLineDirection != nil {
 		// The direction was specified for the aircraft specifically
-		return *state.LeaderLineDirection
-	} else if trk.TrackOwner == ctx.ControlClient.PrimaryTCP {
+		return *state.LeaderLineDirection, true
+	}
+	return 0, false
+}
+
+func (sp *STARSPane) defaultLeaderLineDirection(ac *av.Aircraft, ctx *panes.Context) math.CardinalOrdinalDirection {
+	ps := sp.currentPrefs()
+	state := sp.Aircraft[ac.Callsign]
+	trk := sp.getTrack(ctx, ac)
+
+	if trk.TrackOwner == ctx.ControlClient.PrimaryTCP {
 		// Tracked by us
 		return ps.LeaderLineDirection
 	} else if trk.HandoffController == ctx.ControlClient.PrimaryTCP {
@@ -1343,6 +1500,10 @@ func (sp *STARSPane) getLeaderLineDirection(ac *av.Aircraft, ctx *panes.Context)
 	} else if ps.OtherControllerLeaderLineDirection != nil {
 		// Tracked by another controller without a per-controller direction specified
 		return *ps.OtherControllerLeaderLineDirection
+	} else if dir, ok := ctx.ControlClient.STARSFacilityAdaptation.LeaderDirections.DefaultDirection(state.track.Position,
+		state.track.Altitude, util.Select(ps.UseUserCenter, ps.UserCenter, ps.DefaultCenter)); ok {
+		// Facility default for where the track is
+		return dir
 	} else {
 		// TODO: should this case have a user-specifiable default?
 		return math.CardinalOrdinalDirection(math.North)
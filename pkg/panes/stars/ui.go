@@ -14,6 +14,7 @@ import (
 	"github.com/mmp/vice/pkg/log"
 	"github.com/mmp/vice/pkg/platform"
 	"github.com/mmp/vice/pkg/server"
+	"github.com/mmp/vice/pkg/sim"
 	"github.com/mmp/vice/pkg/util"
 
 	"github.com/mmp/imgui-go/v4"
@@ -36,6 +37,14 @@ func (sp *STARSPane) DrawUI(p platform.Platform, config *platform.Config) {
 
 	imgui.Checkbox("Invert numeric keypad", &sp.FlipNumericKeypad)
 
+	imgui.Checkbox("Draw history trails as lines", &ps.HistoryLines)
+	fade := !ps.DisableHistoryFade
+	if imgui.Checkbox("Fade history trails", &fade) {
+		ps.DisableHistoryFade = !fade
+	}
+
+	imgui.Checkbox("Automatically position datablocks to avoid overlap", &ps.AutomaticLeaderLines)
+
 	if imgui.BeginComboV("TGT GEN Key", string(sp.TgtGenKey), imgui.ComboFlagsHeightLarge) {
 		for _, key := range []byte{';', ','} {
 			if imgui.SelectableV(string(key), key == sp.TgtGenKey, 0, imgui.Vec2{}) {
@@ -45,11 +54,13 @@ func (sp *STARSPane) DrawUI(p platform.Platform, config *platform.Config) {
 		imgui.EndCombo()
 	}
 
+	sp.drawKeyBindingsUI()
+
 	imgui.Separator()
 	imgui.Text("Non-standard Audio Effects")
 
 	// Only offer the non-standard ones to globally disable.
-	for _, i := range []AudioType{AudioInboundHandoff, AudioHandoffAccepted} {
+	for _, i := range []AudioType{AudioInboundHandoff, AudioHandoffAccepted, AudioAirspaceViolation} {
 		imgui.Text("  ")
 		imgui.SameLine()
 		if imgui.Checkbox(AudioType(i).String(), &ps.AudioEffectEnabled[i]) && ps.AudioEffectEnabled[i] {
@@ -331,6 +342,397 @@ func (sp *STARSPane) DrawInfo(c *server.ControlClient, p platform.Platform, lg *
 		}
 	}
 
+	if len(c.State.RunwayAdvice) > 0 && imgui.CollapsingHeader("Runway Advisor") {
+		for _, a := range c.State.RunwayAdvice {
+			if a.Recommended != "" {
+				imgui.Text("Recommend " + a.Recommended + util.Select(a.Current != "", " (now "+a.Current+")", ""))
+			}
+			for _, ap := range util.SortedMapKeys(a.Runways) {
+				imgui.Text("  " + ap + ": " + strings.Join(a.Runways[ap], ", "))
+			}
+			for _, r := range a.Reasons {
+				imgui.Text("  " + r)
+			}
+		}
+	}
+
+	if len(c.State.RunwayTimers) > 0 && imgui.CollapsingHeader("Dependent Runways") {
+		now := c.State.SimTime
+		for _, t := range c.State.RunwayTimers {
+			str := t.Airport + " " + t.Arrival + " arrivals / " + t.Departure + " departures (" +
+				t.Dependency.String() + "): " + t.Status(now)
+			if t.Protected(now) {
+				imgui.PushStyleColor(imgui.StyleColorText, imgui.Vec4{1, .5, .5, 1})
+				imgui.Text(str)
+				imgui.PopStyleColor()
+			} else {
+				imgui.Text(str)
+			}
+		}
+	}
+
+	if len(c.State.ATIS) > 0 && imgui.CollapsingHeader("ATIS") {
+		if sp.atisNOTAMs == nil {
+			sp.atisNOTAMs = make(map[string]string)
+		}
+		for _, ap := range util.SortedMapKeys(c.State.ATIS) {
+			atis := c.State.ATIS[ap]
+			imgui.PushID(ap)
+			imgui.Text(atis.Text())
+
+			notams, ok := sp.atisNOTAMs[ap]
+			if !ok {
+				notams = strings.Join(atis.NOTAMs, "; ")
+			}
+			imgui.InputTextV("NOTAMs (separated by ;)", &notams, 0, nil)
+			sp.atisNOTAMs[ap] = notams
+
+			if imgui.Button("Issue New ATIS") {
+				c.SetATISNOTAMs(ap, strings.Split(notams, ";"), nil,
+					func(err error) { lg.Errorf("%s: %v", ap, err) })
+				delete(sp.atisNOTAMs, ap)
+			}
+			imgui.PopID()
+			imgui.Separator()
+		}
+	}
+
+	if len(c.State.SurfaceVehicles) > 0 && imgui.CollapsingHeader("Airport Vehicles") {
+		if imgui.BeginTableV("vehicles", 5, tableFlags, imgui.Vec2{}, 0) {
+			imgui.TableSetupColumn("Vehicle")
+			imgui.TableSetupColumn("Airport")
+			imgui.TableSetupColumn("Runway")
+			imgui.TableSetupColumn("Request")
+			imgui.TableSetupColumn("Status")
+			imgui.TableHeadersRow()
+
+			for _, v := range c.State.SurfaceVehicles {
+				imgui.PushID(strconv.Itoa(v.Id))
+				imgui.TableNextRow()
+				imgui.TableNextColumn()
+				imgui.Text(v.Callsign)
+				imgui.TableNextColumn()
+				imgui.Text(v.Airport)
+				imgui.TableNextColumn()
+				imgui.Text(v.Runway)
+				imgui.TableNextColumn()
+				if v.NeedsApproval() {
+					imgui.Text(fmt.Sprintf("%s (%d min)", v.Request, int(v.Duration.Minutes()+0.5)))
+				} else {
+					imgui.Text(string(v.Request))
+				}
+				imgui.TableNextColumn()
+				if !v.ClearTime.IsZero() {
+					imgui.Text("On runway")
+				} else if v.Pending() {
+					if imgui.Button("Approve") {
+						c.RespondToVehicleRequest(v.Id, true, nil, func(err error) { lg.Errorf("%s: %v", v.Callsign, err) })
+					}
+					imgui.SameLine()
+					if imgui.Button("Deny") {
+						c.RespondToVehicleRequest(v.Id, false, nil, func(err error) { lg.Errorf("%s: %v", v.Callsign, err) })
+					}
+				} else {
+					imgui.Text("Holding short")
+				}
+				imgui.PopID()
+			}
+			imgui.EndTable()
+		}
+	}
+
+	if len(c.State.SVFRRequests) > 0 && imgui.CollapsingHeader("Special VFR") {
+		if imgui.BeginTableV("svfr", 5, tableFlags, imgui.Vec2{}, 0) {
+			imgui.TableSetupColumn("Callsign")
+			imgui.TableSetupColumn("Airport")
+			imgui.TableSetupColumn("Request")
+			imgui.TableSetupColumn("Direction")
+			imgui.TableSetupColumn("Status")
+			imgui.TableHeadersRow()
+
+			for _, r := range c.State.SVFRRequests {
+				imgui.PushID(strconv.Itoa(r.Id))
+				imgui.TableNextRow()
+				imgui.TableNextColumn()
+				imgui.Text(r.Callsign)
+				imgui.TableNextColumn()
+				imgui.Text(r.Airport)
+				imgui.TableNextColumn()
+				imgui.Text(string(r.Type))
+				imgui.TableNextColumn()
+				imgui.Text(r.Direction)
+				imgui.TableNextColumn()
+				if r.Active() {
+					imgui.Text("In surface area")
+				} else if r.Pending() {
+					if imgui.Button("Approve") {
+						c.RespondToSVFRRequest(r.Id, true, nil, func(err error) { lg.Errorf("%s: %v", r.Callsign, err) })
+					}
+					imgui.SameLine()
+					if imgui.Button("Deny") {
+						c.RespondToSVFRRequest(r.Id, false, nil, func(err error) { lg.Errorf("%s: %v", r.Callsign, err) })
+					}
+				} else {
+					imgui.Text("Waiting")
+				}
+				imgui.PopID()
+			}
+			imgui.EndTable()
+		}
+	}
+
+	if len(c.State.Releases) > 0 && imgui.CollapsingHeader("Releases (APREQ)") {
+		if imgui.BeginTableV("releases", 4, tableFlags, imgui.Vec2{}, 0) {
+			imgui.TableSetupColumn("Callsign")
+			imgui.TableSetupColumn("Facility")
+			imgui.TableSetupColumn("Ready")
+			imgui.TableSetupColumn("Status")
+			imgui.TableHeadersRow()
+
+			for _, r := range c.State.Releases {
+				imgui.PushID(r.Callsign)
+				imgui.TableNextRow()
+				imgui.TableNextColumn()
+				imgui.Text(r.Callsign)
+				imgui.TableNextColumn()
+				imgui.Text(r.Facility)
+				imgui.TableNextColumn()
+				imgui.Text(r.ReadyTime.UTC().Format("1504:05"))
+				imgui.TableNextColumn()
+				switch r.Status {
+				case sim.ReleaseNeeded:
+					if r.Controller == c.PrimaryTCP && imgui.Button("Request") {
+						c.RequestRelease(r.Callsign, nil, func(err error) { lg.Errorf("%s: %v", r.Callsign, err) })
+					} else if r.Controller != c.PrimaryTCP {
+						imgui.Text("Needed (" + r.Controller + ")")
+					}
+				case sim.ReleaseRequested:
+					imgui.Text("Requested " + r.RequestTime.UTC().Format("1504:05"))
+				case sim.ReleaseGranted:
+					imgui.Text("Window " + r.WindowStart.UTC().Format("1504:05") + "-" + r.WindowEnd.UTC().Format("1504:05"))
+				}
+				imgui.PopID()
+			}
+			imgui.EndTable()
+		}
+	}
+
+	if len(c.State.HoldingStacks) > 0 && imgui.CollapsingHeader("Holding") {
+		for _, fix := range util.SortedMapKeys(c.State.HoldingStacks) {
+			imgui.Text(fix)
+			if imgui.BeginTableV("hold-"+fix, 4, tableFlags, imgui.Vec2{}, 0) {
+				imgui.TableSetupColumn("Altitude")
+				imgui.TableSetupColumn("Callsign")
+				imgui.TableSetupColumn("EFC")
+				imgui.TableSetupColumn("Controller")
+				imgui.TableHeadersRow()
+
+				// Show the stack top-down.
+				stack := c.State.HoldingStacks[fix]
+				for i := len(stack) - 1; i >= 0; i-- {
+					h := stack[i]
+					imgui.TableNextRow()
+					imgui.TableNextColumn()
+					imgui.Text(av.FormatAltitude(float32(h.Altitude)))
+					imgui.TableNextColumn()
+					imgui.Text(h.Callsign + util.Select(h.Entered, "", " (inbound)"))
+					imgui.TableNextColumn()
+					if h.EFC.IsZero() {
+						imgui.Text("--")
+					} else if efc := h.EFC.UTC().Format("1504"); !c.State.SimTime.Before(h.EFC) {
+						// Expired
+						imgui.PushStyleColor(imgui.StyleColorText, imgui.Vec4{1, .5, .5, 1})
+						imgui.Text(efc)
+						imgui.PopStyleColor()
+					} else {
+						imgui.Text(efc)
+					}
+					imgui.TableNextColumn()
+					imgui.Text(h.Controller)
+				}
+				imgui.EndTable()
+			}
+		}
+	}
+
+	if imgui.CollapsingHeader("PIREPs") {
+		// Summarize the conditions reported around each airport.
+		for _, ap := range util.SortedMapKeys(c.State.Airports) {
+			if sum := sim.SummarizePIREPs(c.State.RecentPIREPs(ap, 30)); sum != "" {
+				imgui.Text(ap + ": " + sum)
+			}
+		}
+
+		imgui.InputTextV("Near fix (all if blank)##pirep", &sp.pirepFix, imgui.InputTextFlagsCharsUppercase, nil)
+		pireps := c.State.RecentPIREPs(sp.pirepFix, 25)
+		if sp.pirepFix == "" {
+			pireps = slices.Clone(c.State.PIREPs)
+			slices.Reverse(pireps)
+		}
+
+		if len(pireps) > 0 && imgui.BeginTableV("pireps", 6, tableFlags, imgui.Vec2{}, 0) {
+			imgui.TableSetupColumn("Time")
+			imgui.TableSetupColumn("Callsign")
+			imgui.TableSetupColumn("Type")
+			imgui.TableSetupColumn("Location")
+			imgui.TableSetupColumn("Altitude")
+			imgui.TableSetupColumn("Conditions")
+			imgui.TableHeadersRow()
+
+			// Most recent first
+			for _, p := range pireps {
+				imgui.TableNextRow()
+				imgui.TableNextColumn()
+				imgui.Text(p.Time.UTC().Format("1504"))
+				imgui.TableNextColumn()
+				imgui.Text(p.Callsign)
+				imgui.TableNextColumn()
+				imgui.Text(p.AircraftType)
+				imgui.TableNextColumn()
+				imgui.Text(p.Location)
+				imgui.TableNextColumn()
+				imgui.Text(av.FormatAltitude(float32(p.Altitude)))
+				imgui.TableNextColumn()
+				cond := strings.TrimSpace(p.Intensity + " " + p.Type + " " + p.Remarks)
+				if p.Intensity == "severe" {
+					imgui.PushStyleColor(imgui.StyleColorText, imgui.Vec4{1, .5, .5, 1})
+					imgui.Text(cond)
+					imgui.PopStyleColor()
+				} else {
+					imgui.Text(cond)
+				}
+			}
+			imgui.EndTable()
+		}
+
+		p := &sp.newPIREP
+		imgui.InputTextV("Callsign##pirep", &p.Callsign, imgui.InputTextFlagsCharsUppercase, nil)
+		imgui.InputTextV("Location (e.g. CAMRN or CAMRN270012)##pirep", &p.Location, imgui.InputTextFlagsCharsUppercase, nil)
+		imgui.InputIntV("Altitude##pirep", &sp.newPIREPAltitude, 1000, 5000, 0)
+		if imgui.BeginComboV("Conditions##pirep", util.Select(p.Type == "", "(remarks only)", p.Type), 0) {
+			for _, t := range []string{"", "icing", "turbulence"} {
+				if imgui.SelectableV(util.Select(t == "", "(remarks only)", t), t == p.Type, 0, imgui.Vec2{}) {
+					p.Type = t
+				}
+			}
+			imgui.EndCombo()
+		}
+		if p.Type != "" {
+			if p.Intensity == "" {
+				p.Intensity = "light"
+			}
+			if imgui.BeginComboV("Intensity##pirep", p.Intensity, 0) {
+				for _, in := range []string{"light", "moderate", "severe"} {
+					if imgui.SelectableV(in, in == p.Intensity, 0, imgui.Vec2{}) {
+						p.Intensity = in
+					}
+				}
+				imgui.EndCombo()
+			}
+		}
+		imgui.InputTextV("Remarks##pirep", &p.Remarks, imgui.InputTextFlagsCharsUppercase, nil)
+
+		p.Altitude = int(sp.newPIREPAltitude)
+		if err := p.Validate(); err != nil {
+			imgui.Text(err.Error())
+		} else if imgui.Button("Enter PIREP") {
+			c.EnterPIREP(*p, nil, func(err error) { lg.Errorf("PIREP: %v", err) })
+			sp.newPIREP = sim.PIREP{}
+		}
+	}
+
+	if imgui.CollapsingHeader("NOTAMs") {
+		if len(c.State.NOTAMs) > 0 && imgui.BeginTableV("notams", 4, tableFlags, imgui.Vec2{}, 0) {
+			imgui.TableSetupColumn("#")
+			imgui.TableSetupColumn("Airport")
+			imgui.TableSetupColumn("NOTAM")
+			imgui.TableSetupColumn("")
+			imgui.TableHeadersRow()
+
+			for _, n := range c.State.NOTAMs {
+				imgui.PushID(strconv.Itoa(n.Id))
+				imgui.TableNextRow()
+				imgui.TableNextColumn()
+				imgui.Text(strconv.Itoa(n.Id))
+				imgui.TableNextColumn()
+				imgui.Text(n.Airport)
+				imgui.TableNextColumn()
+				imgui.Text(n.String())
+				imgui.TableNextColumn()
+				if imgui.Button("Cancel") {
+					c.CancelNOTAM(n.Id, nil, func(err error) { lg.Errorf("NOTAM %d: %v", n.Id, err) })
+				}
+				imgui.PopID()
+			}
+			imgui.EndTable()
+		}
+
+		n := &sp.newNOTAM
+		if n.Type == "" {
+			n.Type = sim.NOTAMRunwayClosed
+		}
+		if imgui.BeginComboV("Type", string(n.Type), 0) {
+			for _, t := range sim.NOTAMTypes {
+				if imgui.SelectableV(string(t), t == n.Type, 0, imgui.Vec2{}) {
+					n.Type = t
+				}
+			}
+			imgui.EndCombo()
+		}
+		imgui.InputTextV("Airport", &n.Airport, imgui.InputTextFlagsCharsUppercase, nil)
+		imgui.InputTextV("Runway/taxiway/navaid/approach", &n.Subject, imgui.InputTextFlagsCharsUppercase, nil)
+		imgui.InputTextV("Remarks", &n.Remarks, 0, nil)
+		if err := n.Validate(); err != nil {
+			imgui.Text(err.Error())
+		} else if imgui.Button("Issue NOTAM") {
+			c.AddNOTAM(*n, nil, func(err error) { lg.Errorf("NOTAM: %v", err) })
+			sp.newNOTAM = sim.NOTAM{Type: n.Type}
+		}
+	}
+
+	if imgui.CollapsingHeader("Traffic Management Restrictions") {
+		if len(c.State.TrafficRestrictions) > 0 && imgui.BeginTableV("tmis", 3, tableFlags, imgui.Vec2{}, 0) {
+			imgui.TableSetupColumn("#")
+			imgui.TableSetupColumn("Restriction")
+			imgui.TableSetupColumn("")
+			imgui.TableHeadersRow()
+
+			for _, r := range c.State.TrafficRestrictions {
+				imgui.PushID(strconv.Itoa(r.Id))
+				imgui.TableNextRow()
+				imgui.TableNextColumn()
+				imgui.Text(strconv.Itoa(r.Id))
+				imgui.TableNextColumn()
+				imgui.Text(r.String())
+				imgui.TableNextColumn()
+				if imgui.Button("Cancel") {
+					c.CancelTrafficRestriction(r.Id, nil, func(err error) { lg.Errorf("TMI %d: %v", r.Id, err) })
+				}
+				imgui.PopID()
+			}
+			imgui.EndTable()
+		}
+
+		imgui.InputTextV("Fix##tmi", &sp.newTMIFix, imgui.InputTextFlagsCharsUppercase, nil)
+		imgui.InputTextV("Arrival airports (all if blank)##tmi", &sp.newTMIAirports, imgui.InputTextFlagsCharsUppercase, nil)
+		imgui.InputIntV("Spacing##tmi", &sp.newTMISpacing, 1, 5, 0)
+		imgui.SameLine()
+		imgui.Checkbox("Minutes in trail", &sp.newTMIMinutes)
+
+		r := sim.TrafficRestriction{Fix: sp.newTMIFix, Airports: strings.Fields(sp.newTMIAirports)}
+		if sp.newTMIMinutes {
+			r.MinutesInTrail = int(sp.newTMISpacing)
+		} else {
+			r.MilesInTrail = int(sp.newTMISpacing)
+		}
+		if err := r.Validate(c.State.Locate); err != nil {
+			imgui.Text(err.Error())
+		} else if imgui.Button("Impose restriction") {
+			c.ImposeTrafficRestriction(r, nil, func(err error) { lg.Errorf("TMI: %v", err) })
+			sp.newTMIFix, sp.newTMIAirports = "", ""
+		}
+	}
+
 	if imgui.CollapsingHeader("Tower/Coordination Lists") {
 		if imgui.BeginTableV("tclists", 3, tableFlags, imgui.Vec2{}, 0) {
 			imgui.TableSetupColumn("Id")
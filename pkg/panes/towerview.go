@@ -0,0 +1,480 @@
+// pkg/panes/towerview.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package panes
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/platform"
+	"github.com/mmp/vice/pkg/renderer"
+	"github.com/mmp/vice/pkg/server"
+	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/util"
+
+	"github.com/mmp/imgui-go/v4"
+)
+
+// TowerViewPane draws an out-the-window view of an airport from its
+// tower cab: runways and taxiways on the ground and aircraft as simple
+// extruded shapes. The renderer only handles 2D geometry, so points are
+// projected to the screen here and everything is drawn back to front.
+// Dragging in the pane looks around and the mouse wheel zooms.
+type TowerViewPane struct {
+	ShowTowerView  bool
+	Airport        string
+	Heading        float32 // true
+	Pitch          float32 // degrees; negative is down
+	FOV            float32 // horizontal, in degrees
+	ShowDataTags   bool
+	FontIdentifier renderer.FontIdentifier
+
+	font     *renderer.Font
+	airports []string
+	// airport -> surface loaded from its "surface_file"; nil if it has
+	// none or it couldn't be loaded.
+	surfaces map[string]*av.Surface
+	lg       *log.Logger
+}
+
+const (
+	towerDefaultCabHeight = 150  // feet above the field
+	towerViewRange        = 15   // nm
+	towerNearZ            = .002 // nm
+)
+
+var (
+	towerSkyColor      = renderer.RGB{.45, .6, .8}
+	towerGroundColor   = renderer.RGB{.3, .4, .25}
+	towerRunwayColor   = renderer.RGB{.25, .25, .25}
+	towerMarkingColor  = renderer.RGB{.9, .9, .9}
+	towerTaxiwayColor  = renderer.RGB{.8, .7, .2}
+	towerAircraftColor = renderer.RGB{.9, .9, .92}
+)
+
+func init() {
+	RegisterUnmarshalPane("TowerViewPane", func(d []byte) (Pane, error) {
+		var p TowerViewPane
+		err := json.Unmarshal(d, &p)
+		return &p, err
+	})
+}
+
+func NewTowerViewPane() *TowerViewPane {
+	return &TowerViewPane{
+		Pitch:          -2,
+		FOV:            90,
+		ShowDataTags:   true,
+		FontIdentifier: renderer.FontIdentifier{Name: "Inconsolata Condensed Regular", Size: 14},
+	}
+}
+
+func (tv *TowerViewPane) DisplayName() string { return "Tower View" }
+
+func (tv *TowerViewPane) Hide() bool { return !tv.ShowTowerView }
+
+func (tv *TowerViewPane) Activate(r renderer.Renderer, p platform.Platform, eventStream *sim.EventStream, lg *log.Logger) {
+	if tv.font = renderer.GetFont(tv.FontIdentifier); tv.font == nil {
+		tv.font = renderer.GetDefaultFont()
+		tv.FontIdentifier = tv.font.Id
+	}
+	if tv.FOV == 0 {
+		tv.FOV = 90
+	}
+	tv.surfaces = make(map[string]*av.Surface)
+	tv.lg = lg
+}
+
+func (tv *TowerViewPane) LoadedSim(client *server.ControlClient, ss sim.State, pl platform.Platform, lg *log.Logger) {
+	tv.initializeAirports(ss)
+}
+
+func (tv *TowerViewPane) ResetSim(client *server.ControlClient, ss sim.State, pl platform.Platform, lg *log.Logger) {
+	tv.initializeAirports(ss)
+}
+
+func (tv *TowerViewPane) initializeAirports(ss sim.State) {
+	tv.airports = util.SortedMapKeys(ss.Airports)
+	clear(tv.surfaces)
+	if !slices.Contains(tv.airports, tv.Airport) {
+		tv.Airport = util.Select(ss.PrimaryAirport != "", ss.PrimaryAirport, "")
+		if tv.Airport == "" && len(tv.airports) > 0 {
+			tv.Airport = tv.airports[0]
+		}
+	}
+}
+
+func (tv *TowerViewPane) CanTakeKeyboardFocus() bool { return false }
+
+func (tv *TowerViewPane) DrawUI(p platform.Platform, config *platform.Config) {
+	imgui.Checkbox("Show tower view", &tv.ShowTowerView)
+
+	uiStartDisable(!tv.ShowTowerView)
+	if imgui.BeginComboV("Airport", tv.Airport, 0 /* flags */) {
+		for _, ap := range tv.airports {
+			if imgui.SelectableV(ap, ap == tv.Airport, 0, imgui.Vec2{}) {
+				tv.Airport = ap
+			}
+		}
+		imgui.EndCombo()
+	}
+	imgui.SliderFloatV("Field of view", &tv.FOV, 20, 150, "%.0f", 0)
+	imgui.Checkbox("Show data tags", &tv.ShowDataTags)
+	if newFont, changed := renderer.DrawFontPicker(&tv.FontIdentifier, "Font"); changed {
+		tv.font = newFont
+	}
+	uiEndDisable(!tv.ShowTowerView)
+}
+
+func (tv *TowerViewPane) surface(ap *av.Airport, nmPerLongitude float32) *av.Surface {
+	if sf, ok := tv.surfaces[tv.Airport]; ok {
+		return sf
+	}
+
+	var sf *av.Surface
+	if ap.SurfaceFile != "" {
+		if _, err := util.GetResourcesFS().Stat(ap.SurfaceFile); err != nil {
+			tv.lg.Warnf("%s: %v", ap.SurfaceFile, err)
+		} else {
+			r := util.LoadResource(ap.SurfaceFile)
+			if sf, err = av.LoadOSMSurface(r, nmPerLongitude); err != nil {
+				tv.lg.Warnf("%s: %v", ap.SurfaceFile, err)
+			}
+			r.Close()
+		}
+	}
+	tv.surfaces[tv.Airport] = sf
+	return sf
+}
+
+///////////////////////////////////////////////////////////////////////////
+// towerCamera
+
+// towerCamera handles the perspective projection for the tower view.
+// World coordinates are nm with x east, y north, and z up.
+type towerCamera struct {
+	pos                   [3]float32
+	right, up, forward    [3]float32
+	focal                 float32
+	center                [2]float32
+	nmPerLongitude, field float32
+}
+
+func makeTowerCamera(cab math.Point2LL, height, fieldElevation, heading, pitch, fov float32,
+	nmPerLongitude float32, extent math.Extent2D) towerCamera {
+	h, p := math.Radians(heading), math.Radians(pitch)
+	sh, ch, sp, cp := math.Sin(h), math.Cos(h), math.Sin(p), math.Cos(p)
+
+	cam := towerCamera{
+		right:          [3]float32{ch, -sh, 0},
+		up:             [3]float32{-sh * sp, -ch * sp, cp},
+		forward:        [3]float32{sh * cp, ch * cp, sp},
+		focal:          extent.Width() / 2 / math.Tan(math.Radians(fov/2)),
+		center:         [2]float32{extent.Width() / 2, extent.Height() / 2},
+		nmPerLongitude: nmPerLongitude,
+		field:          fieldElevation,
+	}
+	cam.pos = cam.world(cab, fieldElevation+height)
+	return cam
+}
+
+// world returns the world-space position of the given point at the given
+// altitude in feet.
+func (c *towerCamera) world(p math.Point2LL, alt float32) [3]float32 {
+	v := math.LL2NM(p, c.nmPerLongitude)
+	return [3]float32{v[0], v[1], alt * math.FeetToNauticalMiles}
+}
+
+func (c *towerCamera) ground(p math.Point2LL) [3]float32 {
+	return c.world(p, c.field)
+}
+
+// toCamera returns the point in camera space, where z is the distance in
+// front of the camera.
+func (c *towerCamera) toCamera(p [3]float32) [3]float32 {
+	v := sub3(p, c.pos)
+	return [3]float32{dot3(v, c.right), dot3(v, c.up), dot3(v, c.forward)}
+}
+
+func (c *towerCamera) project(pc [3]float32) [2]float32 {
+	return [2]float32{c.center[0] + c.focal*pc[0]/pc[2], c.center[1] + c.focal*pc[1]/pc[2]}
+}
+
+// horizon returns the y coordinate of the horizon.
+func (c *towerCamera) horizon() float32 {
+	return c.center[1] - c.focal*c.forward[2]/c.up[2]
+}
+
+// addPolygon adds the given convex polygon, clipping it to the near plane.
+func (c *towerCamera) addPolygon(tb *renderer.ColoredTrianglesDrawBuilder, poly [][3]float32, color renderer.RGB) {
+	var clipped [][2]float32
+	for i := range poly {
+		a, b := c.toCamera(poly[i]), c.toCamera(poly[(i+1)%len(poly)])
+		ain, bin := a[2] >= towerNearZ, b[2] >= towerNearZ
+		if ain {
+			clipped = append(clipped, c.project(a))
+		}
+		if ain != bin {
+			t := (towerNearZ - a[2]) / (b[2] - a[2])
+			clipped = append(clipped, c.project(lerp3(t, a, b)))
+		}
+	}
+	for i := 2; i < len(clipped); i++ {
+		tb.AddTriangle(clipped[0], clipped[i-1], clipped[i], color)
+	}
+}
+
+// addLine adds the given line, clipping it to the near plane.
+func (c *towerCamera) addLine(ld *renderer.ColoredLinesDrawBuilder, p0, p1 [3]float32, color renderer.RGB) {
+	a, b := c.toCamera(p0), c.toCamera(p1)
+	if a[2] < towerNearZ && b[2] < towerNearZ {
+		return
+	}
+	if a[2] < towerNearZ {
+		a = lerp3((towerNearZ-a[2])/(b[2]-a[2]), a, b)
+	} else if b[2] < towerNearZ {
+		b = lerp3((towerNearZ-b[2])/(a[2]-b[2]), b, a)
+	}
+	ld.AddLine(c.project(a), c.project(b), color)
+}
+
+func sub3(a, b [3]float32) [3]float32 { return [3]float32{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+func add3(a, b [3]float32) [3]float32 { return [3]float32{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func scale3(a [3]float32, s float32) [3]float32 {
+	return [3]float32{a[0] * s, a[1] * s, a[2] * s}
+}
+func dot3(a, b [3]float32) float32 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+func lerp3(t float32, a, b [3]float32) [3]float32 {
+	return add3(scale3(a, 1-t), scale3(b, t))
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Drawing
+
+func (tv *TowerViewPane) Draw(ctx *Context, cb *renderer.CommandBuffer) {
+	if ctx.ControlClient == nil {
+		return
+	}
+	ap, ok := ctx.ControlClient.State.Airports[tv.Airport]
+	dbap, dbok := av.DB.Airports()[tv.Airport]
+	if !ok || !dbok {
+		return
+	}
+
+	if ctx.Mouse != nil {
+		if ctx.Mouse.Dragging[platform.MouseButtonPrimary] {
+			// Move the view with the mouse, scaled by the field of view.
+			scale := tv.FOV / ctx.PaneExtent.Width()
+			tv.Heading = math.NormalizeHeading(tv.Heading - ctx.Mouse.DragDelta[0]*scale)
+			tv.Pitch = math.Clamp(tv.Pitch-ctx.Mouse.DragDelta[1]*scale, -60, 30)
+		}
+		tv.FOV = math.Clamp(tv.FOV*math.Pow(1.05, ctx.Mouse.Wheel[1]), 20, 150)
+	}
+
+	cab, height := ap.TowerCab, float32(ap.TowerCabHeight)
+	if cab.IsZero() {
+		cab = dbap.Location
+	}
+	if height == 0 {
+		height = towerDefaultCabHeight
+	}
+	cam := makeTowerCamera(cab, height, float32(dbap.Elevation), tv.Heading, tv.Pitch, tv.FOV,
+		ctx.ControlClient.NmPerLongitude, ctx.PaneExtent)
+
+	tb := renderer.GetColoredTrianglesDrawBuilder()
+	defer renderer.ReturnColoredTrianglesDrawBuilder(tb)
+	ld := renderer.GetColoredLinesDrawBuilder()
+	defer renderer.ReturnColoredLinesDrawBuilder(ld)
+	td := renderer.GetTextDrawBuilder()
+	defer renderer.ReturnTextDrawBuilder(td)
+
+	// Sky and ground
+	w, h := ctx.PaneExtent.Width(), ctx.PaneExtent.Height()
+	hy := math.Clamp(cam.horizon(), 0, h)
+	tb.AddQuad([2]float32{0, hy}, [2]float32{w, hy}, [2]float32{w, h}, [2]float32{0, h}, towerSkyColor)
+	tb.AddQuad([2]float32{0, 0}, [2]float32{w, 0}, [2]float32{w, hy}, [2]float32{0, hy}, towerGroundColor)
+
+	tv.drawSurface(&cam, ap, dbap, tb, ld)
+	tv.drawAircraft(ctx, &cam, tb, td)
+
+	ctx.SetWindowCoordinateMatrices(cb)
+	tb.GenerateCommands(cb)
+	ld.GenerateCommands(cb)
+	td.GenerateCommands(cb)
+}
+
+func (tv *TowerViewPane) drawSurface(cam *towerCamera, ap *av.Airport, dbap av.FAAAirport,
+	tb *renderer.ColoredTrianglesDrawBuilder, ld *renderer.ColoredLinesDrawBuilder) {
+	var runways [][2]math.Point2LL
+	if sf := tv.surface(ap, cam.nmPerLongitude); sf != nil {
+		for _, rwy := range sf.Runways {
+			runways = append(runways, rwy.Ends)
+		}
+		for _, tw := range sf.Taxiways {
+			for i := 1; i < len(tw.Nodes); i++ {
+				cam.addLine(ld, cam.ground(sf.Nodes[tw.Nodes[i-1]]), cam.ground(sf.Nodes[tw.Nodes[i]]), towerTaxiwayColor)
+			}
+		}
+	} else {
+		// Pair up the runway thresholds from the database.
+		for i, rwy := range dbap.Runways {
+			for _, opp := range dbap.Runways[i+1:] {
+				if oppositeRunway(rwy.Id) == opp.Id {
+					runways = append(runways, [2]math.Point2LL{rwy.Threshold, opp.Threshold})
+				}
+			}
+		}
+	}
+
+	const halfWidth = 75 * math.FeetToNauticalMiles
+	for _, ends := range runways {
+		p0, p1 := cam.ground(ends[0]), cam.ground(ends[1])
+		dir := sub3(p1, p0)
+		length := math.Sqrt(dot3(dir, dir))
+		if length == 0 {
+			continue
+		}
+		dir = scale3(dir, 1/length)
+		perp := [3]float32{-dir[1] * halfWidth, dir[0] * halfWidth, 0}
+
+		cam.addPolygon(tb, [][3]float32{sub3(p0, perp), sub3(p1, perp), add3(p1, perp), add3(p0, perp)},
+			towerRunwayColor)
+
+		// Edges and a dashed centerline
+		cam.addLine(ld, sub3(p0, perp), sub3(p1, perp), towerMarkingColor)
+		cam.addLine(ld, add3(p0, perp), add3(p1, perp), towerMarkingColor)
+		const dash = 150 * math.FeetToNauticalMiles
+		for d := float32(500 * math.FeetToNauticalMiles); d+dash < length; d += 2 * dash {
+			cam.addLine(ld, add3(p0, scale3(dir, d)), add3(p0, scale3(dir, d+dash)), towerMarkingColor)
+		}
+
+		// Threshold bars
+		for j, end := range [2][3]float32{p0, p1} {
+			in := scale3(dir, util.Select(j == 0, float32(1), float32(-1))*50*math.FeetToNauticalMiles)
+			cam.addLine(ld, sub3(end, perp), add3(end, perp), towerMarkingColor)
+			cam.addLine(ld, add3(sub3(end, perp), in), add3(add3(end, perp), in), towerMarkingColor)
+		}
+	}
+}
+
+// oppositeRunway returns the runway at the other end of the given one,
+// e.g., "4L" -> "22R".
+func oppositeRunway(id string) string {
+	n := strings.TrimRight(id, "LRC")
+	num, err := strconv.Atoi(n)
+	if err != nil {
+		return ""
+	}
+	opp := strconv.Itoa((num+17)%36 + 1)
+	switch id[len(n):] {
+	case "L":
+		return opp + "R"
+	case "R":
+		return opp + "L"
+	default:
+		return opp + id[len(n):]
+	}
+}
+
+// towerAircraftLength returns the approximate length in feet of aircraft
+// in the given CWT category.
+func towerAircraftLength(cwt string) float32 {
+	switch cwt {
+	case "A", "B":
+		return 230
+	case "C", "D", "E":
+		return 180
+	case "F", "G":
+		return 120
+	case "H":
+		return 80
+	default:
+		return 30
+	}
+}
+
+func (tv *TowerViewPane) drawAircraft(ctx *Context, cam *towerCamera, tb *renderer.ColoredTrianglesDrawBuilder,
+	td *renderer.TextDrawBuilder) {
+	type visible struct {
+		ac   *av.Aircraft
+		dist float32
+	}
+	var aircraft []visible
+	for _, ac := range ctx.ControlClient.Aircraft {
+		p := cam.world(ac.Position(), ac.Altitude())
+		if d := sub3(p, cam.pos); dot3(d, d) < towerViewRange*towerViewRange {
+			aircraft = append(aircraft, visible{ac: ac, dist: dot3(d, d)})
+		}
+	}
+	// Back to front
+	slices.SortFunc(aircraft, func(a, b visible) int {
+		if a.dist > b.dist {
+			return -1
+		} else if a.dist < b.dist {
+			return 1
+		}
+		return strings.Compare(a.ac.Callsign, b.ac.Callsign)
+	})
+
+	for _, v := range aircraft {
+		ac := v.ac
+		length := towerAircraftLength(ac.CWT()) * math.FeetToNauticalMiles
+		// Aircraft at the field are drawn sitting on the ground.
+		alt := math.Max(ac.Altitude(), cam.field+length/8/math.FeetToNauticalMiles)
+		center := cam.world(ac.Position(), alt)
+
+		hdg := math.Radians(ac.Heading() - ac.MagneticVariation())
+		fwd := [3]float32{math.Sin(hdg), math.Cos(hdg), 0}
+		side := [3]float32{math.Cos(hdg), -math.Sin(hdg), 0}
+		up := [3]float32{0, 0, 1}
+
+		// Wings and horizontal stabilizer
+		wing := func(at, span, chord float32) {
+			c := add3(center, scale3(fwd, at*length))
+			s, f := scale3(side, span*length/2), scale3(fwd, chord*length/2)
+			cam.addPolygon(tb, [][3]float32{add3(sub3(c, s), f), add3(add3(c, s), f), sub3(add3(c, s), f),
+				sub3(sub3(c, s), f)}, towerAircraftColor.Scale(.7))
+		}
+		wing(0, 1, .15)
+		wing(-.42, .35, .08)
+
+		// Fuselage: a box, drawing only the faces that point toward the
+		// camera and shading them according to their orientation.
+		half := [3][3]float32{scale3(fwd, length/2), scale3(side, length/20), scale3(up, length/20)}
+		for axis := range 3 {
+			for _, sign := range []float32{-1, 1} {
+				n := scale3(half[axis], sign)
+				fc := add3(center, n)
+				if dot3(n, sub3(cam.pos, fc)) <= 0 {
+					continue
+				}
+				a, b := half[(axis+1)%3], half[(axis+2)%3]
+				shade := util.Select(axis == 2, float32(1), util.Select(axis == 0, float32(.8), float32(.6)))
+				cam.addPolygon(tb, [][3]float32{sub3(sub3(fc, a), b), sub3(add3(fc, a), b), add3(add3(fc, a), b),
+					add3(sub3(fc, a), b)}, towerAircraftColor.Scale(shade))
+			}
+		}
+
+		// Vertical stabilizer
+		tail := sub3(center, half[0])
+		cam.addPolygon(tb, [][3]float32{tail, add3(tail, scale3(fwd, length/5)),
+			add3(tail, scale3(up, length/5))}, towerAircraftColor.Scale(.85))
+
+		if tv.ShowDataTags && ac.FlightPlan != nil {
+			if pc := cam.toCamera(add3(center, scale3(up, length/4))); pc[2] >= towerNearZ {
+				p := cam.project(pc)
+				tag := ctx.DisplayCallsign(ac.Callsign) + "\n" + ac.FlightPlan.TypeWithoutSuffix() + " " +
+					strconv.Itoa(int(ac.GS()))
+				td.AddTextCentered(tag, [2]float32{p[0], p[1] + float32(2*tv.font.Size)},
+					renderer.TextStyle{Font: tv.font, Color: renderer.RGB{1, 1, 1}})
+			}
+		}
+	}
+}
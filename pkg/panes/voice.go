@@ -0,0 +1,177 @@
+// pkg/panes/voice.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package panes
+
+import (
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/platform"
+	"github.com/mmp/vice/pkg/speech"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Clearances may be issued by voice: audio is recorded while the
+// push-to-talk key is held, and when it is released, the audio is
+// transcribed and parsed into aircraft commands. Unless the user has
+// chosen to skip confirmation, the result is shown in the messages pane
+// until the user clicks to send it or right-clicks to discard it.
+
+// F1-F13 are used by STARS, so default to the first key after those.
+const defaultPushToTalkFKey = 14
+
+type voiceInput struct {
+	recognizer speech.Recognizer
+	err        error
+	recording  bool
+	results    chan voiceResult
+	pending    *speech.Clearance
+}
+
+type voiceResult struct {
+	clearance speech.Clearance
+	err       error
+}
+
+func (mp *MessagesPane) processVoiceInput(ctx *Context) {
+	v := &mp.voice
+	if !mp.SpeechInput || ctx.ControlClient == nil {
+		if v.recording {
+			ctx.Platform.StopAudioCapture()
+			v.recording = false
+		}
+		return
+	}
+
+	if v.recognizer == nil && v.err == nil {
+		if v.recognizer, v.err = speech.NewRecognizer(""); v.err != nil {
+			ctx.Lg.Warnf("speech recognition: %v", v.err)
+		}
+		v.results = make(chan voiceResult, 4)
+	}
+	if v.recognizer == nil {
+		return
+	}
+
+	pttKey := platform.Key(int(platform.KeyF1) + mp.PushToTalkFKey - 1)
+	held := ctx.Keyboard != nil && ctx.Keyboard.IsFKeyHeld(pttKey)
+	if held && !v.recording {
+		if err := ctx.Platform.StartAudioCapture(); err != nil {
+			mp.messages = append(mp.messages, Message{contents: "Unable to record audio: " + err.Error(), error: true})
+		} else {
+			v.recording = true
+			v.pending = nil
+		}
+	} else if !held && v.recording {
+		v.recording = false
+		if pcm := ctx.Platform.StopAudioCapture(); len(pcm) > 0 {
+			grammar, hints := mp.voiceGrammar(ctx)
+			go func(r speech.Recognizer) {
+				transcript, err := r.Transcribe(pcm, hints)
+				if err != nil {
+					v.results <- voiceResult{err: err}
+					return
+				}
+				cl, err := speech.ParseClearance(transcript, grammar)
+				v.results <- voiceResult{clearance: cl, err: err}
+			}(v.recognizer)
+		}
+	}
+
+	select {
+	case r := <-v.results:
+		if r.err != nil {
+			msg := "Voice: " + r.err.Error()
+			if r.clearance.Transcript != "" {
+				msg += " (\"" + r.clearance.Transcript + "\")"
+			}
+			mp.messages = append(mp.messages, Message{contents: msg, error: true})
+		} else if mp.SendSpeechUnconfirmed {
+			mp.sendClearance(ctx, r.clearance)
+		} else {
+			v.pending = &r.clearance
+		}
+	default:
+	}
+
+	if v.pending != nil && ctx.Mouse != nil {
+		if ctx.Mouse.Clicked[platform.MouseButtonPrimary] {
+			mp.sendClearance(ctx, *v.pending)
+			v.pending = nil
+		} else if ctx.Mouse.Clicked[platform.MouseButtonSecondary] {
+			v.pending = nil
+		}
+	}
+}
+
+func (mp *MessagesPane) sendClearance(ctx *Context, cl speech.Clearance) {
+	if len(cl.Nonstandard) > 0 {
+		mp.messages = append(mp.messages, Message{
+			contents: "Phraseology: " + strings.Join(cl.Nonstandard, "; "),
+			system:   true,
+		})
+	}
+	ctx.ControlClient.IssueClearance(cl.Callsign, strings.Join(cl.Commands, " "), cl.Nonstandard,
+		func(message string, remainingInput string) {
+			if message != "" {
+				mp.messages = append(mp.messages, Message{
+					contents: cl.Callsign + ": " + message + ": " + remainingInput,
+					error:    true,
+				})
+			}
+		})
+}
+
+// voiceGrammar returns the aircraft that the user may address--those that
+// they control--along with what is plausible for each, and hints for the
+// recognizer.
+func (mp *MessagesPane) voiceGrammar(ctx *Context) ([]speech.AircraftGrammar, []string) {
+	var grammar []speech.AircraftGrammar
+	hints := make(map[string]interface{})
+
+	for _, callsign := range util.SortedMapKeys(ctx.ControlClient.Aircraft) {
+		ac := ctx.ControlClient.Aircraft[callsign]
+		if ac.ControllingController != ctx.ControlClient.PrimaryTCP {
+			continue
+		}
+
+		ag := ctx.ClearanceGrammar(ac)
+		if ag.Telephony != "" {
+			hints[ag.Telephony] = nil
+		}
+		for _, fix := range ag.Fixes {
+			hints[fix] = nil
+		}
+		grammar = append(grammar, ag)
+	}
+
+	return grammar, util.SortedMapKeys(hints)
+}
+
+// ClearanceGrammar returns what is plausible in clearances for the given
+// aircraft.
+func (ctx *Context) ClearanceGrammar(ac *av.Aircraft) speech.AircraftGrammar {
+	ag := speech.AircraftGrammar{
+		Callsign:   ac.Callsign,
+		Altitude:   ac.Altitude(),
+		Approaches: make(map[string]string),
+	}
+	if idx := strings.IndexAny(ac.Callsign, "0123456789"); idx > 0 {
+		if tel, ok := av.DB.Callsigns[ac.Callsign[:idx]]; ok {
+			ag.Telephony = tel
+		}
+	}
+	if fp := ac.FlightPlan; fp != nil {
+		if ap, ok := ctx.ControlClient.State.ArrivalAirports[fp.ArrivalAirport]; ok {
+			for id, appr := range ap.Approaches {
+				ag.Approaches[id] = appr.FullName
+			}
+		}
+	}
+	for _, wp := range ac.Waypoints() {
+		ag.Fixes = append(ag.Fixes, wp.Fix)
+	}
+	return ag
+}
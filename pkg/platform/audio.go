@@ -11,6 +11,7 @@ import "C"
 import (
 	"fmt"
 	"runtime"
+	"slices"
 	"sync"
 	"unsafe"
 
@@ -26,7 +27,9 @@ const AudioSampleRate = 44100
 type audioEngine struct {
 	pinner  runtime.Pinner
 	effects []audioEffect
+	oneShot []audioEffect // audio that is played once and then discarded
 	mu      sync.Mutex
+	capture sdl.AudioDeviceID
 	volume  int
 }
 
@@ -101,6 +104,63 @@ func (a *audioEngine) PlayAudioOnce(index int) {
 	a.effects[index-1].playOnceCount++
 }
 
+func (a *audioEngine) PlayPCM(pcm []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(pcm) >= 2 {
+		a.oneShot = append(a.oneShot, audioEffect{pcm: pcm[:len(pcm)&^1], playOnceCount: 1})
+	}
+}
+
+func (a *audioEngine) StartAudioCapture() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.capture != 0 {
+		return nil
+	}
+
+	// The capture device doesn't have a callback; SDL queues the
+	// recorded audio until StopAudioCapture retrieves it.
+	spec := sdl.AudioSpec{
+		Freq:     AudioSampleRate,
+		Format:   sdl.AUDIO_S16SYS,
+		Channels: 1,
+		Samples:  2048,
+	}
+	dev, err := sdl.OpenAudioDevice("", true, &spec, nil, 0)
+	if err != nil {
+		return err
+	}
+	a.capture = dev
+	sdl.PauseAudioDevice(dev, false)
+	return nil
+}
+
+func (a *audioEngine) StopAudioCapture() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.capture == 0 {
+		return nil
+	}
+
+	dev := a.capture
+	a.capture = 0
+	defer sdl.CloseAudioDevice(dev)
+
+	sdl.PauseAudioDevice(dev, true)
+	pcm := make([]byte, sdl.GetQueuedAudioSize(dev))
+	if len(pcm) == 0 {
+		return nil
+	}
+	if err := sdl.DequeueAudio(dev, pcm); err != nil {
+		return nil
+	}
+	return pcm[:len(pcm)&^1]
+}
+
 func (a *audioEngine) StartPlayAudioContinuous(index int) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -136,8 +196,7 @@ func audioCallback(user unsafe.Pointer, ptr *C.uint8, size C.int) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	for i := range a.effects {
-		e := &a.effects[i]
+	mix := func(e *audioEffect) {
 		buf := make([]byte, n)
 		bread := buf
 		for len(bread) > 0 && (e.playContinuous || e.playOnceCount > 0) {
@@ -157,6 +216,13 @@ func audioCallback(user unsafe.Pointer, ptr *C.uint8, size C.int) {
 			accum[i] += int(int16(buf[2*i])|int16(buf[2*i+1])<<8) / 2
 		}
 	}
+	for i := range a.effects {
+		mix(&a.effects[i])
+	}
+	for i := range a.oneShot {
+		mix(&a.oneShot[i])
+	}
+	a.oneShot = slices.DeleteFunc(a.oneShot, func(e audioEffect) bool { return e.playOnceCount == 0 })
 
 	for i := 0; i < n/2; i++ {
 		v := int16(math.Clamp(accum[i]*a.volume/10, -32768, 32767))
@@ -14,6 +14,7 @@ import (
 	gomath "math"
 	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/mmp/vice/pkg/log"
 	"github.com/mmp/vice/pkg/math"
@@ -212,10 +213,21 @@ func (g *glfwPlatform) CancelShouldStop() {
 }
 
 func (g *glfwPlatform) ProcessEvents() bool {
+	return g.processEvents(glfw.PollEvents)
+}
+
+func (g *glfwPlatform) WaitEvents(timeout time.Duration) bool {
+	if timeout <= 0 {
+		return g.processEvents(glfw.PollEvents)
+	}
+	return g.processEvents(func() { glfw.WaitEventsTimeout(timeout.Seconds()) })
+}
+
+func (g *glfwPlatform) processEvents(poll func()) bool {
 	g.inputCharacters = ""
 	g.anyEvents = false
 
-	glfw.PollEvents()
+	poll()
 
 	if g.anyEvents {
 		return true
@@ -5,6 +5,8 @@
 package platform
 
 import (
+	"time"
+
 	"github.com/mmp/vice/pkg/math"
 
 	"github.com/mmp/imgui-go/v4"
@@ -20,6 +22,10 @@ type Platform interface {
 	// there were any events and false otherwise.
 	ProcessEvents() bool
 
+	// WaitEvents is like ProcessEvents but if there are no pending events,
+	// it waits for up to the given amount of time for one to arrive.
+	WaitEvents(timeout time.Duration) bool
+
 	// PostRender performs the buffer swap.
 	PostRender()
 
@@ -116,6 +122,20 @@ type Platform interface {
 	// once. Multiple audio effects may be played simultaneously.
 	PlayAudioOnce(id int)
 
+	// PlayPCM plays the given audio once; as with AddPCM, it is assumed
+	// to be one channel audio sampled at AudioSampleRate. It is intended
+	// for audio that is generated on the fly and is only played once.
+	PlayPCM(pcm []byte)
+
+	// StartAudioCapture starts recording audio from the default input
+	// device.
+	StartAudioCapture() error
+
+	// StopAudioCapture stops recording and returns the audio recorded
+	// since StartAudioCapture was called as one channel, 16-bit PCM
+	// sampled at AudioSampleRate.
+	StopAudioCapture() []byte
+
 	// StartPlayAudioContinuous	starts playing the specified audio effect
 	// continuously, until StopPlayAudioContinuous is called.
 	StartPlayAudioContinuous(id int)
@@ -0,0 +1,155 @@
+// pkg/rand/distributions.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package rand
+
+import (
+	"math"
+)
+
+// Non-uniform distributions, mostly for traffic generation. All of these
+// are available both as methods on Rand, so that a Rand seeded from a
+// scenario gives reproducible results, and as package-level functions
+// that use the shared generator.
+
+// Float64 returns a uniformly-distributed value in [0,1).
+func (r *Rand) Float64() float64 {
+	// Use 53 bits of randomness so that every representable value can be
+	// returned and 1 is excluded.
+	hi, lo := uint64(r.Random()), uint64(r.Random())
+	return float64(((hi<<32)|lo)>>11) / (1 << 53)
+}
+
+// Exponential returns an exponentially-distributed value with the given
+// mean. Successive samples give the interarrival times of a Poisson
+// process with rate 1/mean.
+func (r *Rand) Exponential(mean float32) float32 {
+	// 1-u is in (0,1], so the log is finite.
+	return float32(-math.Log(1-r.Float64())) * mean
+}
+
+// Poisson returns the number of events in an interval for a Poisson
+// process where lambda events are expected in the interval.
+func (r *Rand) Poisson(lambda float32) int {
+	if lambda <= 0 {
+		return 0
+	}
+	if lambda > 30 {
+		// Knuth's method is linear in lambda and underflows for large
+		// lambda; the normal approximation is fine there.
+		n := math.Round(float64(lambda) + math.Sqrt(float64(lambda))*r.NormFloat64())
+		return max(0, int(n))
+	}
+
+	// Knuth
+	l, p := math.Exp(-float64(lambda)), 1.0
+	n := -1
+	for p > l {
+		p *= r.Float64()
+		n++
+	}
+	return n
+}
+
+// NormFloat64 returns a normally-distributed value with mean 0 and
+// standard deviation 1.
+func (r *Rand) NormFloat64() float64 {
+	// Box-Muller; we just throw away the second value.
+	u := 1 - r.Float64()
+	v := r.Float64()
+	return math.Sqrt(-2*math.Log(u)) * math.Cos(2*math.Pi*v)
+}
+
+// Normal returns a normally-distributed value with the given mean and
+// standard deviation.
+func (r *Rand) Normal(mean, stddev float32) float32 {
+	return mean + stddev*float32(r.NormFloat64())
+}
+
+// TruncatedNormal returns a normally-distributed value with the given
+// mean and standard deviation that is in the range [low,high].
+func (r *Rand) TruncatedNormal(mean, stddev, low, high float32) float32 {
+	if low > high {
+		low, high = high, low
+	}
+	if stddev <= 0 {
+		return max(low, min(high, mean))
+	}
+
+	// Rejection sampling is efficient as long as a reasonable fraction of
+	// the distribution is inside the range; if we haven't found a value
+	// after a while, the range is far out in a tail so just clamp.
+	for range 64 {
+		if v := r.Normal(mean, stddev); v >= low && v <= high {
+			return v
+		}
+	}
+	return max(low, min(high, mean))
+}
+
+// SampleWeightedFloat returns the index of an element of weights sampled
+// with probability proportional to its weight; negative weights are
+// treated as zero. -1 is returned if all of the weights are zero.
+func (r *Rand) SampleWeightedFloat(weights []float32) int {
+	// Weighted reservoir sampling, as in SampleWeightedSeq.
+	idx := -1
+	var sum float32
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		sum += w
+		if r.Float32() < w/sum {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// WeightedChoice returns an element of choices sampled with probability
+// proportional to the value returned by weight for it.
+func WeightedChoice[T any](r *Rand, choices []T, weight func(T) float32) (T, bool) {
+	var sample T
+	ok := false
+	var sum float32
+	for _, c := range choices {
+		w := weight(c)
+		if w <= 0 {
+			continue
+		}
+		sum += w
+		if r.Float32() < w/sum {
+			sample, ok = c, true
+		}
+	}
+	return sample, ok
+}
+
+func Float64() float64 {
+	return r.Float64()
+}
+
+func Exponential(mean float32) float32 {
+	return r.Exponential(mean)
+}
+
+func Poisson(lambda float32) int {
+	return r.Poisson(lambda)
+}
+
+func NormFloat64() float64 {
+	return r.NormFloat64()
+}
+
+func Normal(mean, stddev float32) float32 {
+	return r.Normal(mean, stddev)
+}
+
+func TruncatedNormal(mean, stddev, low, high float32) float32 {
+	return r.TruncatedNormal(mean, stddev, low, high)
+}
+
+func SampleWeightedFloat(weights []float32) int {
+	return r.SampleWeightedFloat(weights)
+}
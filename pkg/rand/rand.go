@@ -169,11 +169,21 @@ func PermuteSlice[Slice ~[]E, E any](s Slice, seed uint32) iter.Seq2[int, E] {
 
 // SampleSlice uniformly randomly samples an element of a non-empty slice.
 func SampleSlice[T any](slice []T) T {
-	return slice[Intn(len(slice))]
+	return SampleSliceWith(&r, slice)
+}
+
+// SampleSliceWith is the same as SampleSlice but uses the provided random
+// number generator; the other ...With functions that follow are similar.
+func SampleSliceWith[T any](r *Rand, slice []T) T {
+	return slice[r.Intn(len(slice))]
 }
 
 func Sample[T any](t ...T) T {
-	return t[Intn(len(t))]
+	return SampleWith(&r, t...)
+}
+
+func SampleWith[T any](r *Rand, t ...T) T {
+	return t[r.Intn(len(t))]
 }
 
 // SampleFiltered uniformly randomly samples a slice, returning the index
@@ -181,13 +191,17 @@ func Sample[T any](t ...T) T {
 // items that may be sampled.  An index of -1 is returned if the slice is
 // empty or the predicate returns false for all items.
 func SampleFiltered[T any](slice []T, pred func(T) bool) int {
+	return SampleFilteredWith(&r, slice, pred)
+}
+
+func SampleFilteredWith[T any](r *Rand, slice []T, pred func(T) bool) int {
 	idx := -1
 	candidates := 0
 	for i, v := range slice {
 		if pred(v) {
 			candidates++
 			p := float32(1) / float32(candidates)
-			if Float32() < p {
+			if r.Float32() < p {
 				idx = i
 			}
 		}
@@ -199,10 +213,18 @@ func SampleFiltered[T any](slice []T, pred func(T) bool) int {
 // probability of choosing each element proportional to the value returned
 // by the provided callback.
 func SampleWeighted[T any](slice []T, weight func(T) int) (T, bool) {
-	return SampleWeightedSeq(slices.Values(slice), weight)
+	return SampleWeightedSeqWith(&r, slices.Values(slice), weight)
+}
+
+func SampleWeightedWith[T any](r *Rand, slice []T, weight func(T) int) (T, bool) {
+	return SampleWeightedSeqWith(r, slices.Values(slice), weight)
 }
 
 func SampleWeightedSeq[T any](it iter.Seq[T], weight func(T) int) (sample T, ok bool) {
+	return SampleWeightedSeqWith(&r, it, weight)
+}
+
+func SampleWeightedSeqWith[T any](r *Rand, it iter.Seq[T], weight func(T) int) (sample T, ok bool) {
 	// Weighted reservoir sampling...
 	sumWt := 0
 	for v := range it {
@@ -213,7 +235,7 @@ func SampleWeightedSeq[T any](it iter.Seq[T], weight func(T) int) (sample T, ok
 
 		sumWt += w
 		p := float32(w) / float32(sumWt)
-		if Float32() < p {
+		if r.Float32() < p {
 			sample = v
 			ok = true
 		}
@@ -108,3 +108,79 @@ func TestSampleWeighted(t *testing.T) {
 		}
 	}
 }
+
+func TestDistributionsReproducible(t *testing.T) {
+	a, b := New(), New()
+	a.Seed(1234)
+	b.Seed(1234)
+	for range 100 {
+		if a.Exponential(60) != b.Exponential(60) || a.TruncatedNormal(10, 2, 5, 15) != b.TruncatedNormal(10, 2, 5, 15) ||
+			a.Poisson(4) != b.Poisson(4) {
+			t.Fatalf("Same seed gave different samples")
+		}
+	}
+}
+
+func TestExponential(t *testing.T) {
+	r := New()
+	n, sum := 100000, float32(0)
+	for range n {
+		v := r.Exponential(60)
+		if v < 0 {
+			t.Fatalf("Got negative sample %f", v)
+		}
+		sum += v
+	}
+	if mean := sum / float32(n); mean < 59 || mean > 61 {
+		t.Errorf("Expected mean of roughly 60; got %f", mean)
+	}
+}
+
+func TestPoisson(t *testing.T) {
+	r := New()
+	for _, lambda := range []float32{0.5, 4, 50} {
+		n, sum := 50000, 0
+		for range n {
+			sum += r.Poisson(lambda)
+		}
+		if mean := float32(sum) / float32(n); mean < 0.97*lambda || mean > 1.03*lambda {
+			t.Errorf("lambda %f: got mean %f", lambda, mean)
+		}
+	}
+}
+
+func TestTruncatedNormal(t *testing.T) {
+	r := New()
+	n, sum := 50000, float32(0)
+	for range n {
+		v := r.TruncatedNormal(10, 3, 8, 20)
+		if v < 8 || v > 20 {
+			t.Fatalf("Got out of range sample %f", v)
+		}
+		sum += v
+	}
+	// Truncating the low side pushes the mean up.
+	if mean := sum / float32(n); mean < 10.5 || mean > 12.5 {
+		t.Errorf("Unexpected mean %f", mean)
+	}
+
+	if v := r.TruncatedNormal(0, 1, 50, 60); v != 50 {
+		t.Errorf("Expected clamping far into the tail; got %f", v)
+	}
+}
+
+func TestSampleWeightedFloat(t *testing.T) {
+	r := New()
+	if r.SampleWeightedFloat(nil) != -1 || r.SampleWeightedFloat([]float32{0, -1}) != -1 {
+		t.Errorf("Expected -1 with no positive weights")
+	}
+
+	weights := []float32{1, 0, 3}
+	var counts [3]int
+	for range 40000 {
+		counts[r.SampleWeightedFloat(weights)]++
+	}
+	if counts[1] != 0 || counts[0] < 9500 || counts[0] > 10500 {
+		t.Errorf("Unexpected sample counts %v", counts)
+	}
+}
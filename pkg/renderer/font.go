@@ -176,6 +176,7 @@ var (
 	FontAwesomeIconPlaneDeparture      = faUsedIcons["PlaneDeparture"]
 	FontAwesomeIconRedo                = faUsedIcons["Redo"]
 	FontAwesomeIconSquare              = faUsedIcons["Square"]
+	FontAwesomeIconStepForward         = faUsedIcons["StepForward"]
 	FontAwesomeIconTrash               = faUsedIcons["Trash"]
 )
 
@@ -216,6 +217,7 @@ var (
 		"PlaneDeparture":      FontAwesomeString("PlaneDeparture"),
 		"Redo":                FontAwesomeString("Redo"),
 		"Square":              FontAwesomeString("Square"),
+		"StepForward":         FontAwesomeString("StepForward"),
 		"Trash":               FontAwesomeString("Trash"),
 	}
 	faBrandsUsedIcons map[string]string = map[string]string{
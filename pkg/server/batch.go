@@ -0,0 +1,82 @@
+// pkg/server/batch.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// BatchReport is the result of running a scenario as a batch; see
+// sim/batch.go.
+type BatchReport struct {
+	TRACON   string `json:"tracon"`
+	Group    string `json:"group"`
+	Scenario string `json:"scenario"`
+	Seed     uint64 `json:"seed,omitempty"`
+	sim.BatchReport
+}
+
+// Write writes the report to the given writer as JSON.
+func (r BatchReport) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// RunBatch loads the scenarios and runs the named one without a UI or
+// any human controllers for the given amount of simulated time. If seed
+// is non-zero, the sim is deterministic.
+func RunBatch(scenarioName, extraScenario, extraVideoMap string, d time.Duration, seed uint64,
+	e *util.ErrorLogger, lg *log.Logger) (BatchReport, bool) {
+	scenarioGroups, _, mapManifests := LoadScenarioGroups(true, extraScenario, extraVideoMap, e, lg)
+	if e.HaveErrors() {
+		return BatchReport{}, false
+	}
+
+	var sg *ScenarioGroup
+	var sc *Scenario
+	for _, tracon := range util.SortedMapKeys(scenarioGroups) {
+		for _, name := range util.SortedMapKeys(scenarioGroups[tracon]) {
+			g := scenarioGroups[tracon][name]
+			if s, ok := g.Scenarios[scenarioName]; ok {
+				if sc != nil {
+					e.ErrorString("%s: scenario is in both %s/%s and %s/%s", scenarioName,
+						sg.TRACON, sg.Name, g.TRACON, g.Name)
+					return BatchReport{}, false
+				}
+				sg, sc = g, s
+			}
+		}
+	}
+	if sc == nil {
+		e.ErrorString("%s: scenario not found", scenarioName)
+		return BatchReport{}, false
+	}
+
+	nsc := scenarioSimConfiguration(sg, sc)
+	nsc.Description = " " + scenarioName
+	nsc.IsLocal = true
+	nsc.PrimaryController = sc.SoloController
+	nsc.Deterministic = seed != 0
+	nsc.Seed = seed
+
+	s := sim.NewSim(nsc, mapManifests[nsc.STARSFacilityAdaptation.VideoMapFile], lg)
+	s.Activate(lg)
+	s.Prespawn()
+
+	return BatchReport{
+		TRACON:      sg.TRACON,
+		Group:       sg.Name,
+		Scenario:    scenarioName,
+		Seed:        seed,
+		BatchReport: s.RunBatch(d),
+	}, true
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"slices"
 	"sort"
+	"strings"
 	"time"
 
 	av "github.com/mmp/vice/pkg/aviation"
@@ -25,7 +26,16 @@ type ControlClient struct {
 	lastUpdateRequest time.Time
 	lastReturnedTime  time.Time
 	updateCall        *util.PendingCall
-	remoteSim         bool
+	// Sequence number of the last world update applied; see
+	// sim.WorldUpdate.
+	lastUpdateSequence uint64
+	remoteSim          bool
+	// Incremented whenever an update changes the aircraft; see
+	// AircraftGeneration.
+	aircraftGeneration uint64
+	// Extrapolates the sim time between updates using the embedded
+	// State's time and rates.
+	clock *sim.TimeSource
 
 	pendingCalls []*util.PendingCall
 
@@ -43,6 +53,13 @@ type ControlClient struct {
 	sim.State
 }
 
+// AircraftGeneration returns a number that changes whenever aircraft are
+// added, changed, or removed, so that panes can skip work when the
+// aircraft are the same as the last time they looked.
+func (c *ControlClient) AircraftGeneration() uint64 {
+	return c.aircraftGeneration
+}
+
 func (c *ControlClient) RPCClient() *util.RPCClient {
 	return c.proxy.Client
 }
@@ -57,7 +74,10 @@ func NewControlClient(ss sim.State, local bool, controllerToken string, client *
 			Client:          client,
 		},
 		lastUpdateRequest: time.Now(),
+		// The aircraft in the initial State are the first generation.
+		aircraftGeneration: 1,
 	}
+	cc.clock = sim.NewTimeSource(&cc.State)
 	cc.SessionStats.SignOnTime = ss.SimTime
 	return cc
 }
@@ -69,6 +89,14 @@ func (c *ControlClient) Status() string {
 		stats := c.SessionStats
 		deparr := fmt.Sprintf(" [ %d departures %d arrivals %d intrafacility %d overflights ]",
 			stats.Departures, stats.Arrivals, stats.IntraFacility, stats.Overflights)
+		if p := c.State.ActivePush; p != nil {
+			deparr += fmt.Sprintf(" [ %s push %d/hr ]", p.Name, int(p.Rate+0.5))
+		}
+		if c.State.AmPseudoPilot() {
+			if cs := c.State.PseudoPilotCallsigns(c.State.PrimaryTCP); len(cs) > 0 {
+				deparr += " [ flying " + strings.Join(cs, " ") + " ]"
+			}
+		}
 		return c.State.PrimaryTCP + c.SimDescription + deparr
 	}
 }
@@ -191,7 +219,29 @@ func (c *ControlClient) ToggleDisplayModeCAltitude(callsign string, success func
 }
 
 func (c *ControlClient) AmendFlightPlan(callsign string, fp av.FlightPlan) error {
-	return nil // UNIMPLEMENTED
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.AmendFlightPlan(callsign, fp),
+			IssueTime: time.Now(),
+			OnErr: func(err error) {
+				c.lg.Errorf("%s: amend flight plan: %v", callsign, err)
+			},
+		})
+	return nil
+}
+
+// TrialPlan asks the server's conflict probe which conflicts the aircraft
+// would have with the given route and altitude; callback is called with
+// them when they arrive.
+func (c *ControlClient) TrialPlan(callsign, route string, altitude int, callback func([]sim.ProbeConflict), err func(error)) {
+	var conflicts []sim.ProbeConflict
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.TrialPlan(callsign, route, altitude, &conflicts),
+			IssueTime: time.Now(),
+			OnSuccess: func(any) { callback(conflicts) },
+			OnErr:     err,
+		})
 }
 
 func (c *ControlClient) SetGlobalLeaderLine(callsign string, dir *math.CardinalOrdinalDirection, success func(any), err func(error)) {
@@ -226,6 +276,16 @@ func (c *ControlClient) AutoAssociateFP(callsign string, fp *av.STARSFlightPlan,
 		})
 }
 
+func (c *ControlClient) CreateLocalFlightPlan(callsign string, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.CreateLocalFlightPlan(callsign),
+			IssueTime: time.Now(),
+			OnSuccess: c.updateControllerStats(callsign, success),
+			OnErr:     err,
+		})
+}
+
 func (c *ControlClient) UploadFlightPlan(fp *av.STARSFlightPlan, typ int, success func(any), err func(error)) {
 	c.pendingCalls = append(c.pendingCalls,
 		&util.PendingCall{
@@ -360,6 +420,156 @@ func (c *ControlClient) ForceQL(callsign, controller string, success func(any),
 		})
 }
 
+func (c *ControlClient) SetQuickLook(ql sim.QuickLook, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.SetQuickLook(ql),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) SetPreferenceSets(prefs []byte, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.SetPreferenceSets(prefs),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) ConsolidatePosition(position string, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.ConsolidatePosition(position),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) SplitPosition(position string, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.SplitPosition(position),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) Resectorize(sectorization string, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.Resectorize(sectorization),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) SetATISNOTAMs(airport string, notams []string, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.SetATISNOTAMs(airport, notams),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) AddNOTAM(n sim.NOTAM, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.AddNOTAM(n),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) CancelNOTAM(id int, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.CancelNOTAM(id),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) ImposeTrafficRestriction(r sim.TrafficRestriction, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.ImposeTrafficRestriction(r),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) CancelTrafficRestriction(id int, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.CancelTrafficRestriction(id),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) EnterPIREP(p sim.PIREP, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.EnterPIREP(p),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) RespondToVehicleRequest(id int, approve bool, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.RespondToVehicleRequest(id, approve),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) RespondToSVFRRequest(id int, approve bool, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.RespondToSVFRRequest(id, approve),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) RequestRelease(callsign string, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.RequestRelease(callsign),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
+func (c *ControlClient) ReassignBeaconCode(callsign string, success func(any), err func(error)) {
+	c.pendingCalls = append(c.pendingCalls,
+		&util.PendingCall{
+			Call:      c.proxy.ReassignBeaconCode(callsign),
+			IssueTime: time.Now(),
+			OnSuccess: success,
+			OnErr:     err,
+		})
+}
+
 func (c *ControlClient) PointOut(callsign string, controller string, success func(any), err func(error)) {
 	c.pendingCalls = append(c.pendingCalls,
 		&util.PendingCall{
@@ -558,7 +768,7 @@ func (c *ControlClient) GetUpdates(eventStream *sim.EventStream, onErr func(erro
 	c.checkPendingRPCs(eventStream, onErr)
 
 	// Wait in seconds between update fetches; no less than 50ms
-	rate := math.Clamp(1/c.State.SimRate, 0.05, 1)
+	rate := math.Clamp(1/c.clock.Rate(), 0.05, 1)
 	if d := time.Since(c.lastUpdateRequest); d > time.Duration(rate*float32(time.Second)) {
 		if c.updateCall != nil {
 			c.lg.Warnf("GetUpdates still waiting for %s on last update call", d)
@@ -568,7 +778,7 @@ func (c *ControlClient) GetUpdates(eventStream *sim.EventStream, onErr func(erro
 
 		wu := &sim.WorldUpdate{}
 		c.updateCall = &util.PendingCall{
-			Call:      c.proxy.GetWorldUpdate(wu),
+			Call:      c.proxy.GetWorldUpdate(c.lastUpdateSequence, wu),
 			IssueTime: time.Now(),
 			OnSuccess: func(any) {
 				d := time.Since(c.updateCall.IssueTime)
@@ -585,24 +795,60 @@ func (c *ControlClient) GetUpdates(eventStream *sim.EventStream, onErr func(erro
 }
 
 func (c *ControlClient) UpdateWorld(wu *sim.WorldUpdate, eventStream *sim.EventStream) {
-	c.State.Aircraft = wu.Aircraft
+	var ok bool
+	c.State.Aircraft, ok = wu.ApplyAircraft(c.State.Aircraft)
+	if wu.AircraftChanged() {
+		c.aircraftGeneration++
+	}
 	if wu.Controllers != nil {
 		c.State.Controllers = wu.Controllers
 	}
+	if wu.AirspaceChanged {
+		c.State.Airspace = wu.Airspace
+		c.State.Sectorization = wu.Sectorization
+	}
 	c.State.HumanControllers = wu.HumanControllers
 
-	c.State.ERAMComputers = wu.ERAMComputers
+	c.State.ERAMComputers = wu.ApplyERAMComputers(c.State.ERAMComputers)
+	if ok {
+		c.lastUpdateSequence = wu.Sequence
+	} else {
+		c.lg.Warn("world update patched unknown aircraft; requesting full update")
+		c.lastUpdateSequence = 0
+	}
 
 	c.State.LaunchConfig = wu.LaunchConfig
 
 	c.State.UserRestrictionAreas = wu.UserRestrictionAreas
 
+	if wu.Time.Before(c.State.SimTime) {
+		// The sim has been rewound; don't hold CurrentTime back until
+		// it catches up with where it was.
+		c.lastReturnedTime = time.Time{}
+	}
 	c.State.SimTime = wu.Time
 	c.State.Paused = wu.SimIsPaused
 	c.State.SimRate = wu.SimRate
+	c.State.FastForwardRate = wu.FastForwardRate
+	c.State.FastForwarding = wu.FastForwarding
+	c.State.Consolidations = wu.Consolidations
+	c.State.ATIS = wu.ATIS
+	c.State.NOTAMs = wu.NOTAMs
+	c.State.TrafficRestrictions = wu.TrafficRestrictions
+	c.State.ActivePush = wu.ActivePush
+	c.State.Lesson = wu.Lesson
+	c.State.SurfaceVehicles = wu.SurfaceVehicles
+	c.State.SVFRRequests = wu.SVFRRequests
+	c.State.Releases = wu.Releases
+	c.State.RunwayTimers = wu.RunwayTimers
+	wu.ApplyCollections(&c.State)
+	c.State.TrackHistories = wu.ApplyTrackHistories(c.State.TrackHistories, c.State.Aircraft)
+	c.State.CoastTracks = wu.CoastTracks
 	c.State.TotalIFR = wu.TotalIFR
 	c.State.TotalVFR = wu.TotalVFR
 	c.State.Instructors = wu.Instructors
+	c.State.PseudoPilots = wu.PseudoPilots
+	c.State.PseudoPilotAircraft = wu.PseudoPilotAircraft
 
 	// Important: do this after updating aircraft, controllers, etc.,
 	// so that they reflect any changes the events are flagging.
@@ -666,6 +912,43 @@ func (c *ControlClient) SetSimRate(r float32) {
 	c.SimRate = r // so the UI is well-behaved...
 }
 
+// SingleStepSim advances the sim by one second; the sim must be paused.
+func (c *ControlClient) SingleStepSim() {
+	c.pendingCalls = append(c.pendingCalls, &util.PendingCall{
+		Call:      c.proxy.SingleStep(),
+		IssueTime: time.Now(),
+	})
+}
+
+// SetFastForwardRate sets the rate at which the sim runs when no traffic
+// needs attention; 0 disables fast-forwarding.
+func (c *ControlClient) SetFastForwardRate(r float32) {
+	c.pendingCalls = append(c.pendingCalls, &util.PendingCall{
+		Call:      c.proxy.SetFastForwardRate(r),
+		IssueTime: time.Now(),
+	})
+	c.FastForwardRate = r
+}
+
+// Rewind returns the sim to a checkpoint at least d in the past.
+func (c *ControlClient) Rewind(d time.Duration) {
+	c.pendingCalls = append(c.pendingCalls, &util.PendingCall{
+		Call:      c.proxy.Rewind(d),
+		IssueTime: time.Now(),
+	})
+}
+
+// GetScoreReport requests the current score report from the server;
+// callback is called with it when it arrives.
+func (c *ControlClient) GetScoreReport(callback func(sim.ScoreReport)) {
+	var report sim.ScoreReport
+	c.pendingCalls = append(c.pendingCalls, &util.PendingCall{
+		Call:      c.proxy.GetScoreReport(&report),
+		IssueTime: time.Now(),
+		OnSuccess: func(any) { callback(report) },
+	})
+}
+
 func (c *ControlClient) SetLaunchConfig(lc sim.LaunchConfig) {
 	c.pendingCalls = append(c.pendingCalls, &util.PendingCall{
 		Call:      c.proxy.SetLaunchConfig(lc),
@@ -681,7 +964,7 @@ func (c *ControlClient) SetLaunchConfig(lc sim.LaunchConfig) {
 func (c *ControlClient) CurrentTime() time.Time {
 	t := c.SimTime
 
-	if !c.State.Paused && !c.lastUpdateRequest.IsZero() {
+	if !c.lastUpdateRequest.IsZero() {
 		d := time.Since(c.lastUpdateRequest)
 
 		// Roughly account for RPC overhead; more for a remote server (where
@@ -691,12 +974,9 @@ func (c *ControlClient) CurrentTime() time.Time {
 		} else {
 			d -= 50 * time.Millisecond
 		}
-		d = math.Max(0, d)
-
-		// Account for sim rate
-		d = time.Duration(float64(d) * float64(c.SimRate))
 
-		t = t.Add(d)
+		// The clock accounts for the sim rate and for the sim being paused.
+		t = c.clock.Extrapolate(d)
 	}
 
 	// Make sure we don't ever go backward; this can happen due to
@@ -711,6 +991,7 @@ func (c *ControlClient) CurrentTime() time.Time {
 func (c *ControlClient) DeleteAllAircraft(onErr func(err error)) {
 	if lctrl := c.LaunchConfig.Controller; lctrl == "" || lctrl == c.State.PrimaryTCP {
 		c.State.Aircraft = nil
+		c.aircraftGeneration++
 	}
 
 	c.pendingCalls = append(c.pendingCalls,
@@ -722,10 +1003,18 @@ func (c *ControlClient) DeleteAllAircraft(onErr func(err error)) {
 }
 
 func (c *ControlClient) RunAircraftCommands(callsign string, cmds string, handleResult func(message string, remainingInput string)) {
+	c.IssueClearance(callsign, cmds, nil, handleResult)
+}
+
+// IssueClearance runs commands that were given in words; nonstandard
+// describes the deviations from standard phraseology in them, which are
+// included in the session's score.
+func (c *ControlClient) IssueClearance(callsign string, cmds string, nonstandard []string,
+	handleResult func(message string, remainingInput string)) {
 	var result AircraftCommandsResult
 	c.pendingCalls = append(c.pendingCalls,
 		&util.PendingCall{
-			Call:      c.proxy.RunAircraftCommands(callsign, cmds, &result),
+			Call:      c.proxy.RunAircraftCommands(callsign, cmds, nonstandard, &result),
 			IssueTime: time.Now(),
 			OnSuccess: func(any) {
 				handleResult(result.ErrorMessage, result.RemainingInput)
@@ -0,0 +1,380 @@
+// pkg/server/control.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brunoga/deep"
+	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// The server's sims can be managed over HTTP with a REST API so that
+// training organizations can run sessions for multiple students from
+// their own scheduling tools or learning management systems. It's only
+// enabled if there's an "api-token" file in the server's directory;
+// requests must give its contents as a bearer token ("Authorization:
+// Bearer <token>"). Because the token would otherwise be sent in the
+// clear, the API is only served on the loopback interface; a reverse
+// proxy that terminates TLS should be used to make it available to
+// other hosts. Requests and responses are JSON:
+//
+//	GET    /api/scenarios              the scenarios that sims may be started with
+//	GET    /api/sims                   the running sims
+//	POST   /api/sims                   start a sim (controlStartRequest)
+//	GET    /api/sims/{name}            one sim
+//	DELETE /api/sims/{name}            stop a sim
+//	POST   /api/sims/{name}/pause
+//	POST   /api/sims/{name}/resume
+//	POST   /api/sims/{name}/rate       set the sim rate ({"rate": 2})
+//	POST   /api/sims/{name}/message    send a message to its controllers ({"message": "..."})
+//	POST   /api/sims/{name}/emergency  start an emergency ({"callsign": "AAL123", "type": "engine_failure"})
+//
+// Sims that are started this way don't have anyone signed in; students
+// join them from vice as usual. Operations on a running sim are made
+// with an instructor's privileges.
+
+// controlTokenFile holds the API's bearer token.
+const controlTokenFile = "api-token"
+
+const controlAddress = "localhost:6503"
+
+// controlSender is who pause notices and messages sent via the API are
+// from.
+const controlSender = "Instructor"
+
+// The same limits as the UI's.
+const maxControlSimRate = 20
+
+type controlScenario struct {
+	TRACON   string   `json:"tracon"`
+	Group    string   `json:"group"`
+	Scenario string   `json:"scenario"`
+	Splits   []string `json:"splits"`
+}
+
+type controlSim struct {
+	Name               string        `json:"name"`
+	Group              string        `json:"group"`
+	Scenario           string        `json:"scenario"`
+	Paused             bool          `json:"paused"`
+	Rate               float32       `json:"rate"`
+	IdleTime           time.Duration `json:"idle_time"`
+	Controllers        []string      `json:"controllers"`
+	AvailablePositions []string      `json:"available_positions"`
+	TotalIFR           int           `json:"total_ifr"`
+	TotalVFR           int           `json:"total_vfr"`
+}
+
+type controlStartRequest struct {
+	Name              string  `json:"name"`
+	TRACON            string  `json:"tracon"`
+	Group             string  `json:"group"`
+	Scenario          string  `json:"scenario"` // the group's default if empty
+	Split             string  `json:"split"`
+	Password          string  `json:"password"`
+	InstructorAllowed bool    `json:"instructor_allowed"`
+	Rate              float32 `json:"rate"`
+	Paused            bool    `json:"paused"`
+}
+
+type controlRequest struct {
+	Rate     float32 `json:"rate"`
+	Message  string  `json:"message"`
+	Callsign string  `json:"callsign"`
+	Type     string  `json:"type"`
+}
+
+var errControlRate = errors.New("Rate must be greater than 0 and at most 20")
+
+// launchControlAPI serves the API if the token file is present.
+func launchControlAPI(sm *SimManager) {
+	b, err := os.ReadFile(controlTokenFile)
+	if err != nil {
+		sm.lg.Infof("%s: %v; control API disabled", controlTokenFile, err)
+		return
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		sm.lg.Warnf("%s: empty token; control API disabled", controlTokenFile)
+		return
+	}
+
+	sm.lg.Infof("control API enabled at %s", controlAddress)
+	go func() {
+		if err := http.ListenAndServe(controlAddress, sm.controlHandler(token)); err != nil {
+			sm.lg.Errorf("Failed to start HTTP server for control API: %v", err)
+		}
+	}()
+}
+
+func (sm *SimManager) controlHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern string, f func(w http.ResponseWriter, r *http.Request) (any, error)) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+
+			auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+				sm.lg.Warnf("%s %s: unauthorized request from %s", r.Method, r.URL, r.RemoteAddr)
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+				return
+			}
+
+			result, err := f(w, r)
+			if err != nil {
+				sm.lg.Infof("%s %s: %v", r.Method, r.URL, err)
+				w.WriteHeader(controlErrorStatus(err))
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			sm.lg.Infof("%s %s: ok", r.Method, r.URL)
+			json.NewEncoder(w).Encode(result)
+		})
+	}
+
+	handle("GET /api/scenarios", func(w http.ResponseWriter, r *http.Request) (any, error) {
+		return sm.controlScenarios(), nil
+	})
+	handle("GET /api/sims", func(w http.ResponseWriter, r *http.Request) (any, error) {
+		return sm.controlSims(), nil
+	})
+	handle("POST /api/sims", func(w http.ResponseWriter, r *http.Request) (any, error) {
+		var req controlStartRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		cs, err := sm.controlStart(req)
+		if err == nil {
+			w.WriteHeader(http.StatusCreated)
+		}
+		return cs, err
+	})
+	handle("GET /api/sims/{name}", func(w http.ResponseWriter, r *http.Request) (any, error) {
+		return sm.controlSim(r.PathValue("name"))
+	})
+	handle("DELETE /api/sims/{name}", func(w http.ResponseWriter, r *http.Request) (any, error) {
+		return struct{}{}, sm.Stop(r.PathValue("name"))
+	})
+
+	// The rest operate on a running sim.
+	handleSim := func(op string, f func(s *sim.Sim, req controlRequest) error) {
+		handle("POST /api/sims/{name}/"+op, func(w http.ResponseWriter, r *http.Request) (any, error) {
+			var req controlRequest
+			if r.ContentLength != 0 {
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					return nil, err
+				}
+			}
+			name := r.PathValue("name")
+			s, ok := sm.lookupSim(name)
+			if !ok {
+				return nil, ErrNoNamedSim
+			}
+			if err := f(s, req); err != nil {
+				return nil, err
+			}
+			return sm.controlSim(name)
+		})
+	}
+	handleSim("pause", func(s *sim.Sim, req controlRequest) error {
+		return s.SetPaused(controlSender, true)
+	})
+	handleSim("resume", func(s *sim.Sim, req controlRequest) error {
+		return s.SetPaused(controlSender, false)
+	})
+	handleSim("rate", func(s *sim.Sim, req controlRequest) error {
+		if req.Rate <= 0 || req.Rate > maxControlSimRate {
+			return errControlRate
+		}
+		return s.SetSimRate(controlSender, req.Rate)
+	})
+	handleSim("message", func(s *sim.Sim, req controlRequest) error {
+		if req.Message == "" {
+			return errors.New("No message given")
+		}
+		return s.GlobalMessage(controlSender, req.Message)
+	})
+	handleSim("emergency", func(s *sim.Sim, req controlRequest) error {
+		t, ok := sim.ParseEmergencyType(req.Type)
+		if !ok {
+			return sim.ErrUnknownEmergency
+		}
+		return s.InstructorTriggerEmergency(strings.ToUpper(req.Callsign), t)
+	})
+
+	return mux
+}
+
+func controlErrorStatus(err error) int {
+	switch err {
+	case ErrNoNamedSim:
+		return http.StatusNotFound
+	case ErrDuplicateSimName:
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func (sm *SimManager) lookupSim(name string) (*sim.Sim, bool) {
+	sm.mu.Lock(sm.lg)
+	defer sm.mu.Unlock(sm.lg)
+
+	if as, ok := sm.activeSims[name]; ok && name != "" {
+		return as.sim, true
+	}
+	return nil, false
+}
+
+func (sm *SimManager) controlScenarios() []controlScenario {
+	// The configurations may be replaced if a scenario is reloaded.
+	sm.mu.Lock(sm.lg)
+	defer sm.mu.Unlock(sm.lg)
+
+	scenarios := []controlScenario{}
+	for _, tracon := range util.SortedMapKeys(sm.configs) {
+		for _, group := range util.SortedMapKeys(sm.configs[tracon]) {
+			config := sm.configs[tracon][group]
+			for _, name := range util.SortedMapKeys(config.ScenarioConfigs) {
+				scenarios = append(scenarios, controlScenario{
+					TRACON:   tracon,
+					Group:    group,
+					Scenario: name,
+					Splits:   util.SortedMapKeys(config.ScenarioConfigs[name].SplitConfigurations),
+				})
+			}
+		}
+	}
+	return scenarios
+}
+
+func (sm *SimManager) controlSims() []controlSim {
+	sm.mu.Lock(sm.lg)
+	names := util.SortedMapKeys(sm.activeSims)
+	sm.mu.Unlock(sm.lg)
+
+	sims := []controlSim{}
+	for _, name := range names {
+		if cs, err := sm.controlSim(name); err == nil {
+			sims = append(sims, cs)
+		}
+	}
+	return sims
+}
+
+func (sm *SimManager) controlSim(name string) (controlSim, error) {
+	sm.mu.Lock(sm.lg)
+	as, ok := sm.activeSims[name]
+	sm.mu.Unlock(sm.lg)
+	if !ok || name == "" {
+		return controlSim{}, ErrNoNamedSim
+	}
+
+	available, _ := as.sim.GetAvailableCoveredPositions()
+	status := as.sim.Status()
+	return controlSim{
+		Name:               name,
+		Group:              as.scenarioGroup,
+		Scenario:           as.scenario,
+		Paused:             status.Paused,
+		Rate:               status.Rate,
+		IdleTime:           as.sim.IdleTime().Round(time.Second),
+		Controllers:        as.sim.ActiveControllers(),
+		AvailablePositions: util.SortedMapKeys(available),
+		TotalIFR:           status.TotalIFR,
+		TotalVFR:           status.TotalVFR,
+	}, nil
+}
+
+// controlScenario returns a copy of the scenario configuration for the
+// request, filling in the request's default scenario and split if they
+// aren't given.
+func (sm *SimManager) controlScenario(req *controlStartRequest) (SimScenarioConfiguration, error) {
+	// The configurations may be replaced if a scenario is reloaded.
+	sm.mu.Lock(sm.lg)
+	defer sm.mu.Unlock(sm.lg)
+
+	group, ok := sm.configs[req.TRACON][req.Group]
+	if !ok {
+		return SimScenarioConfiguration{}, ErrNoNamedScenarioGroup
+	}
+	if req.Scenario == "" {
+		req.Scenario = group.DefaultScenario
+	}
+	sc, ok := group.ScenarioConfigs[req.Scenario]
+	if !ok {
+		return SimScenarioConfiguration{}, errors.New("No scenario with that name")
+	}
+	if req.Split == "" {
+		req.Split = sc.SelectedSplit
+	} else if _, ok := sc.SplitConfigurations[req.Split]; !ok {
+		return SimScenarioConfiguration{}, errors.New("No split with that name")
+	}
+	scenario := *sc
+	scenario.SelectedSplit = req.Split
+	// Sims update their launch configuration's rates in place (e.g., for
+	// NOTAMs and reloads), so each needs its own copy of the maps.
+	scenario.LaunchConfig = deep.MustCopy(sc.LaunchConfig)
+	return scenario, nil
+}
+
+// controlStart starts a multi-controller sim as if it had been created
+// from vice's launch dialog and then signs off its creator so that all of
+// its positions are open to students.
+func (sm *SimManager) controlStart(req controlStartRequest) (controlSim, error) {
+	if req.Name == "" {
+		return controlSim{}, errors.New("No sim name given")
+	}
+	if req.Rate < 0 || req.Rate > maxControlSimRate {
+		return controlSim{}, errControlRate
+	}
+
+	scenario, err := sm.controlScenario(&req)
+	if err != nil {
+		return controlSim{}, err
+	}
+
+	var result NewSimResult
+	if err := sm.New(&NewSimConfiguration{
+		NewSimType:        NewSimCreateRemote,
+		NewSimName:        req.Name,
+		GroupName:         req.Group,
+		ScenarioName:      req.Scenario,
+		Scenario:          &scenario,
+		TRACONName:        req.TRACON,
+		RequirePassword:   req.Password != "",
+		Password:          req.Password,
+		InstructorAllowed: req.InstructorAllowed,
+	}, &result); err != nil {
+		return controlSim{}, err
+	}
+	if err := sm.SignOff(result.ControllerToken); err != nil {
+		sm.lg.Errorf("%s: unable to sign off: %v", req.Name, err)
+	}
+
+	if s, ok := sm.lookupSim(req.Name); ok {
+		if req.Rate != 0 {
+			if err := s.SetSimRate(controlSender, req.Rate); err != nil {
+				return controlSim{}, err
+			}
+		}
+		if req.Paused {
+			if err := s.SetPaused(controlSender, true); err != nil {
+				return controlSim{}, err
+			}
+		}
+	}
+
+	return sm.controlSim(req.Name)
+}
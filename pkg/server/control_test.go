@@ -0,0 +1,201 @@
+// pkg/server/control_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/sim"
+)
+
+func makeControlTestServer(t *testing.T) (*SimManager, *httptest.Server) {
+	lg := &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	sm := &SimManager{
+		configs: map[string]map[string]*Configuration{
+			"N90": {"JFK": {
+				ScenarioConfigs: map[string]*SimScenarioConfiguration{"JFK 31s": {}},
+				DefaultScenario: "JFK 31s",
+			}},
+		},
+		activeSims: map[string]*ActiveSim{},
+		lg:         lg,
+	}
+	sm.activeSims["class"] = &ActiveSim{
+		name:          "class",
+		scenarioGroup: "JFK",
+		scenario:      "JFK 31s",
+		sim: sim.NewSim(sim.NewSimConfiguration{
+			PrimaryController: "2K",
+			SignOnPositions:   map[string]*av.Controller{"2K": {Position: "2K"}},
+			Deterministic:     true,
+		}, nil, lg),
+	}
+
+	ts := httptest.NewServer(sm.controlHandler("secret"))
+	t.Cleanup(ts.Close)
+	return sm, ts
+}
+
+func controlRequestJSON(t *testing.T, ts *httptest.Server, method, path, token, body string) (int, map[string]any) {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]any
+	b, _ := io.ReadAll(resp.Body)
+	if len(b) > 0 && b[0] == '{' {
+		if err := json.Unmarshal(b, &result); err != nil {
+			t.Fatalf("%s: unexpected error %v", string(b), err)
+		}
+	}
+	return resp.StatusCode, result
+}
+
+func TestControlAuthorization(t *testing.T) {
+	_, ts := makeControlTestServer(t)
+
+	for _, token := range []string{"", "wrong", "secre", "secrett"} {
+		for _, path := range []string{"/api/sims", "/api/sims/class/pause"} {
+			method := "GET"
+			if strings.HasSuffix(path, "pause") {
+				method = "POST"
+			}
+			if code, result := controlRequestJSON(t, ts, method, path, token, ""); code != http.StatusUnauthorized {
+				t.Errorf("%s %s with token %q: got status %d, expected %d", method, path, token, code,
+					http.StatusUnauthorized)
+			} else if result["error"] != "unauthorized" {
+				t.Errorf("%s %s with token %q: got %+v", method, path, token, result)
+			}
+		}
+	}
+
+	// A token that isn't a bearer token.
+	req, _ := http.NewRequest("GET", ts.URL+"/api/sims", nil)
+	req.Header.Set("Authorization", "Basic secret")
+	if resp, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("basic authorization: got status %d", resp.StatusCode)
+	}
+
+	if code, _ := controlRequestJSON(t, ts, "GET", "/api/sims", "secret", ""); code != http.StatusOK {
+		t.Errorf("authorized request: got status %d", code)
+	}
+}
+
+func TestControlHandlers(t *testing.T) {
+	sm, ts := makeControlTestServer(t)
+	s := sm.activeSims["class"].sim
+
+	for _, test := range []struct {
+		method, path, body string
+		status             int
+		check              func(result map[string]any) bool
+	}{
+		{"GET", "/api/sims/class", "", http.StatusOK,
+			func(r map[string]any) bool {
+				pos, _ := r["available_positions"].([]any)
+				return r["name"] == "class" && r["scenario"] == "JFK 31s" && len(pos) == 1 && pos[0] == "2K"
+			}},
+		{"GET", "/api/sims/nope", "", http.StatusNotFound, nil},
+		{"POST", "/api/sims/class/pause", "", http.StatusOK,
+			func(r map[string]any) bool { return r["paused"] == true && s.Status().Paused }},
+		{"POST", "/api/sims/class/resume", "", http.StatusOK,
+			func(r map[string]any) bool { return r["paused"] == false && !s.Status().Paused }},
+		{"POST", "/api/sims/class/rate", `{"rate": 4}`, http.StatusOK,
+			func(r map[string]any) bool { return r["rate"] == 4.0 && s.Status().Rate == 4 }},
+		{"POST", "/api/sims/class/rate", `{"rate": 40}`, http.StatusBadRequest, nil},
+		{"POST", "/api/sims/class/rate", `{"rate":`, http.StatusBadRequest, nil},
+		{"POST", "/api/sims/nope/rate", `{"rate": 2}`, http.StatusNotFound, nil},
+		{"POST", "/api/sims/class/message", `{"message": "break time"}`, http.StatusOK, nil},
+		{"POST", "/api/sims/class/message", `{}`, http.StatusBadRequest, nil},
+		{"POST", "/api/sims/class/emergency", `{"callsign": "aal1", "type": "bogus"}`, http.StatusBadRequest,
+			func(r map[string]any) bool { return r["error"] == sim.ErrUnknownEmergency.Error() }},
+		{"POST", "/api/sims/class/emergency", `{"callsign": "aal1", "type": "engine_failure"}`,
+			http.StatusBadRequest, nil}, // no such aircraft
+		{"POST", "/api/sims", `{"tracon": "N90", "group": "JFK"}`, http.StatusBadRequest, nil},
+		{"POST", "/api/sims", `{"name": "x", "tracon": "N90", "group": "EWR"}`, http.StatusBadRequest,
+			func(r map[string]any) bool { return r["error"] == ErrNoNamedScenarioGroup.Error() }},
+		{"POST", "/api/sims", `{"name": "x", "tracon": "N90", "group": "JFK", "rate": 30}`,
+			http.StatusBadRequest, nil},
+		{"DELETE", "/api/sims/nope", "", http.StatusNotFound, nil},
+	} {
+		code, result := controlRequestJSON(t, ts, test.method, test.path, "secret", test.body)
+		if code != test.status {
+			t.Errorf("%s %s %s: got status %d, expected %d (%+v)", test.method, test.path, test.body,
+				code, test.status, result)
+		} else if test.check != nil && !test.check(result) {
+			t.Errorf("%s %s %s: unexpected result %+v", test.method, test.path, test.body, result)
+		}
+	}
+
+	// The list endpoints return arrays.
+	req, _ := http.NewRequest("GET", ts.URL+"/api/scenarios", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer resp.Body.Close()
+	var scenarios []controlScenario
+	if err := json.NewDecoder(resp.Body).Decode(&scenarios); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(scenarios) != 1 || scenarios[0].TRACON != "N90" || scenarios[0].Scenario != "JFK 31s" {
+		t.Errorf("got scenarios %+v", scenarios)
+	}
+}
+
+func TestControlScenarioCopiesRates(t *testing.T) {
+	sm, _ := makeControlTestServer(t)
+	config := sm.configs["N90"]["JFK"].ScenarioConfigs["JFK 31s"]
+	config.LaunchConfig.DepartureRates = map[string]map[string]map[string]float32{
+		"KJFK": {"31L": {"": 30}},
+	}
+	config.LaunchConfig.InboundFlowRates = map[string]map[string]float32{
+		"CAMRN": {"KJFK": 20},
+	}
+
+	// Each sim started from the scenario gets its own rates, so that
+	// changes to them in one sim (e.g., when a NOTAM closes a runway)
+	// don't affect the others or the scenario.
+	a, err := sm.controlScenario(&controlStartRequest{TRACON: "N90", Group: "JFK"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b, err := sm.controlScenario(&controlStartRequest{TRACON: "N90", Group: "JFK"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	delete(a.LaunchConfig.DepartureRates["KJFK"], "31L")
+	a.LaunchConfig.InboundFlowRates["CAMRN"]["KJFK"] = 5
+
+	for _, lc := range []sim.LaunchConfig{b.LaunchConfig, config.LaunchConfig} {
+		if lc.DepartureRates["KJFK"]["31L"][""] != 30 {
+			t.Errorf("departure rates are shared: %v", lc.DepartureRates)
+		}
+		if lc.InboundFlowRates["CAMRN"]["KJFK"] != 20 {
+			t.Errorf("inbound flow rates are shared: %v", lc.InboundFlowRates)
+		}
+	}
+}
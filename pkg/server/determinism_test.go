@@ -0,0 +1,228 @@
+// pkg/server/determinism_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package server
+
+import (
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// loadTestScenarioGroup loads a single scenario group from the resources
+// directory along with its video map manifest and launch configurations.
+func loadTestScenarioGroup(t *testing.T, filename string) (*ScenarioGroup, *av.VideoMapManifest,
+	map[string]map[string]*Configuration) {
+	var e util.ErrorLogger
+	sg := loadScenarioGroup(util.GetResourcesFS(), "scenarios/"+filename, &e)
+	if e.HaveErrors() {
+		t.Fatalf("%s: %s", filename, e.String())
+	}
+
+	manifest, err := av.LoadVideoMapManifest(sg.STARSFacilityAdaptation.VideoMapFile)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	configs := make(map[string]map[string]*Configuration)
+	sg.PostDeserialize(false, &e, configs, manifest)
+	if e.HaveErrors() {
+		t.Fatalf("%s: %s", filename, e.String())
+	}
+	return sg, manifest, configs
+}
+
+// newTestSim creates a deterministic local sim for the group's default
+// scenario that updates aircraft with the given number of goroutines.
+func newTestSim(t *testing.T, sg *ScenarioGroup, manifest *av.VideoMapManifest, seed uint64, workers int) *sim.Sim {
+	lg := &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	sm := &SimManager{
+		scenarioGroups: map[string]map[string]*ScenarioGroup{sg.TRACON: {sg.Name: sg}},
+		lg:             lg,
+	}
+	sc := sg.Scenarios[sg.DefaultScenario]
+	nsc := sm.makeSimConfiguration(&NewSimConfiguration{
+		NewSimType:    NewSimCreateLocal,
+		TRACONName:    sg.TRACON,
+		GroupName:     sg.Name,
+		ScenarioName:  sg.DefaultScenario,
+		Scenario:      &SimScenarioConfiguration{LaunchConfig: sg.defaultLaunchConfig(sc)},
+		Deterministic: true,
+		Seed:          seed,
+	}, lg)
+	if nsc == nil {
+		t.Fatalf("%s: unable to make sim configuration", sg.DefaultScenario)
+	}
+	nsc.UpdateWorkers = workers
+
+	s := sim.NewSim(*nsc, manifest, lg)
+	s.Activate(lg)
+	return s
+}
+
+// runDeterministicSim creates a deterministic sim for the group's default
+// scenario and runs it for the given amount of time, updating aircraft
+// with the given number of goroutines.
+func runDeterministicSim(t *testing.T, sg *ScenarioGroup, manifest *av.VideoMapManifest, seed uint64,
+	workers int, d time.Duration) *sim.Sim {
+	s := newTestSim(t, sg, manifest, seed, workers)
+	s.Prespawn()
+	s.Step(d)
+	return s
+}
+
+// runCommandedSim is like runDeterministicSim, but halfway through it
+// issues heading, altitude, and speed instructions to some of the
+// airborne aircraft. It returns the number of instructions that were
+// accepted along with the sim.
+func runCommandedSim(t *testing.T, sg *ScenarioGroup, manifest *av.VideoMapManifest, seed uint64,
+	workers int, d time.Duration) (*sim.Sim, int) {
+	s := newTestSim(t, sg, manifest, seed, workers)
+	s.Prespawn()
+	s.Step(d / 2)
+
+	n := 0
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		tcp := ac.ControllingController
+		if !ac.IsAirborne() || ac.Altitude() < 3000 || tcp == "" {
+			continue
+		}
+
+		hdg := int(math.NormalizeHeading(ac.Heading()+40)+5) / 10 * 10
+		if hdg == 0 {
+			hdg = 360
+		}
+		alt := (int(ac.Altitude())/1000 + 2) * 1000
+		for _, err := range []error{
+			s.AssignHeading(&sim.HeadingArgs{TCP: tcp, Callsign: callsign, Heading: hdg, Turn: av.TurnClosest}),
+			s.AssignAltitude(tcp, callsign, alt, false),
+			s.AssignSpeed(tcp, callsign, 210, false),
+		} {
+			if err == nil {
+				n++
+			}
+		}
+		if n >= 9 {
+			break
+		}
+	}
+
+	s.Step(d / 2)
+	return s, n
+}
+
+// aircraftState summarizes the state of each aircraft in the sim.
+func aircraftState(s *sim.Sim) map[string]any {
+	type state struct {
+		Squawk      av.Squawk
+		FlightState av.FlightState
+		Controller  string
+		Waypoints   []string
+	}
+
+	m := make(map[string]any)
+	for callsign, ac := range s.State.Aircraft {
+		st := state{Squawk: ac.Squawk, FlightState: ac.Nav.FlightState, Controller: ac.ControllingController}
+		for _, wp := range ac.Nav.Waypoints {
+			st.Waypoints = append(st.Waypoints, wp.Fix)
+		}
+		m[callsign] = st
+	}
+	return m
+}
+
+func TestDeterministicSim(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads a full scenario")
+	}
+
+	sg, manifest, _ := loadTestScenarioGroup(t, "jfk.json")
+
+	// Errors are also logged via slog's default logger.
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	const seed, d = 1234, 10 * time.Minute
+	a := aircraftState(runDeterministicSim(t, sg, manifest, seed, 1, d))
+	if len(a) == 0 {
+		t.Fatalf("no aircraft were launched")
+	}
+
+	// The same seed should give the same traffic, regardless of how many
+	// goroutines update the aircraft.
+	for _, workers := range []int{1, 8} {
+		b := aircraftState(runDeterministicSim(t, sg, manifest, seed, workers, d))
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+		for _, callsign := range util.SortedMapKeys(a) {
+			if !reflect.DeepEqual(a[callsign], b[callsign]) {
+				t.Errorf("%d workers: %s: got %+v, expected %+v", workers, callsign, b[callsign], a[callsign])
+			}
+		}
+		for callsign := range b {
+			if _, ok := a[callsign]; !ok {
+				t.Errorf("%d workers: %s: unexpected aircraft", workers, callsign)
+			}
+		}
+	}
+
+	// Make sure that the comparison isn't vacuous.
+	if c := aircraftState(runDeterministicSim(t, sg, manifest, seed+1, 1, d)); reflect.DeepEqual(a, c) {
+		t.Errorf("different seeds gave the same traffic")
+	}
+}
+
+func TestDeterministicSimWithCommands(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads a full scenario")
+	}
+
+	sg, manifest, _ := loadTestScenarioGroup(t, "jfk.json")
+
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Controller instructions should take effect at the same sim time
+	// however quickly the sim is run, so the same seed and the same
+	// commands should give the same results.
+	const seed, d = 1234, 10 * time.Minute
+	sa, n := runCommandedSim(t, sg, manifest, seed, 1, d)
+	if n == 0 {
+		t.Fatalf("no instructions were accepted")
+	}
+	a := aircraftState(sa)
+
+	for _, workers := range []int{1, 8} {
+		sb, nb := runCommandedSim(t, sg, manifest, seed, workers, d)
+		if nb != n {
+			t.Errorf("%d workers: %d instructions were accepted, expected %d", workers, nb, n)
+		}
+		b := aircraftState(sb)
+		for _, callsign := range util.SortedMapKeys(a) {
+			if !reflect.DeepEqual(a[callsign], b[callsign]) {
+				t.Errorf("%d workers: %s: got %+v, expected %+v", workers, callsign, b[callsign], a[callsign])
+			}
+		}
+		for callsign := range b {
+			if _, ok := a[callsign]; !ok {
+				t.Errorf("%d workers: %s: unexpected aircraft", workers, callsign)
+			}
+		}
+	}
+
+	// And the commands should have made a difference.
+	if c := aircraftState(runDeterministicSim(t, sg, manifest, seed, 1, d)); reflect.DeepEqual(a, c) {
+		t.Errorf("instructions had no effect")
+	}
+}
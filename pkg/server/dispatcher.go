@@ -7,6 +7,7 @@ package server
 import (
 	"strconv"
 	"strings"
+	"time"
 
 	av "github.com/mmp/vice/pkg/aviation"
 	"github.com/mmp/vice/pkg/math"
@@ -18,14 +19,19 @@ type Dispatcher struct {
 	sm *SimManager
 }
 
-func (sd *Dispatcher) GetWorldUpdate(token string, update *sim.WorldUpdate) error {
+type GetWorldUpdateArgs struct {
+	ControllerToken string
+	Sequence        uint64 // of the last update received
+}
+
+func (sd *Dispatcher) GetWorldUpdate(a *GetWorldUpdateArgs, update *sim.WorldUpdate) error {
 	// Most of the methods in this file are called from the RPC dispatcher,
 	// which spawns up goroutines as needed to handle requests, so if we
 	// want to catch and report panics, all of the methods need to start
 	// like this...
 	defer sd.sm.lg.CatchAndReportCrash()
 
-	return sd.sm.GetWorldUpdate(token, update)
+	return sd.sm.GetWorldUpdate(a.ControllerToken, a.Sequence, update)
 }
 
 func (sd *Dispatcher) SignOff(token string, _ *struct{}) error {
@@ -75,6 +81,47 @@ func (sd *Dispatcher) SetSimRate(r *SetSimRateArgs, _ *struct{}) error {
 	}
 }
 
+type SetFastForwardRateArgs struct {
+	ControllerToken string
+	Rate            float32
+}
+
+func (sd *Dispatcher) SetFastForwardRate(r *SetFastForwardRateArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(r.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.SetFastForwardRate(ctrl.tcp, r.Rate)
+	}
+}
+
+type RewindArgs struct {
+	ControllerToken string
+	Duration        time.Duration
+}
+
+func (sd *Dispatcher) Rewind(r *RewindArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(r.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.Rewind(ctrl.tcp, r.Duration)
+	}
+}
+
+func (sd *Dispatcher) GetScoreReport(token string, report *sim.ScoreReport) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if _, s, ok := sd.sm.LookupController(token); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		*report = s.GetScoreReport()
+		return nil
+	}
+}
+
 type SetLaunchConfigArgs struct {
 	ControllerToken string
 	Config          sim.LaunchConfig
@@ -100,6 +147,16 @@ func (sd *Dispatcher) TogglePause(token string, _ *struct{}) error {
 	}
 }
 
+func (sd *Dispatcher) SingleStep(token string, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(token); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.SingleStep(ctrl.tcp)
+	}
+}
+
 type SetScratchpadArgs struct {
 	ControllerToken string
 	Callsign        string
@@ -183,6 +240,18 @@ func (sd *Dispatcher) CreateUnsupportedTrack(it *CreateUnsupportedTrackArgs, _ *
 	}
 }
 
+type CreateLocalFlightPlanArgs AircraftSpecifier
+
+func (sd *Dispatcher) CreateLocalFlightPlan(lf *CreateLocalFlightPlanArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(lf.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.CreateLocalFlightPlan(ctrl.tcp, lf.Callsign)
+	}
+}
+
 type UploadPlanArgs struct {
 	ControllerToken string
 	Type            int
@@ -199,6 +268,41 @@ func (sd *Dispatcher) UploadFlightPlan(it *UploadPlanArgs, _ *struct{}) error {
 	}
 }
 
+type AmendFlightPlanArgs struct {
+	ControllerToken string
+	Callsign        string
+	FlightPlan      av.FlightPlan
+}
+
+func (sd *Dispatcher) AmendFlightPlan(it *AmendFlightPlanArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(it.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.AmendFlightPlan(ctrl.tcp, it.Callsign, it.FlightPlan)
+	}
+}
+
+type TrialPlanArgs struct {
+	ControllerToken string
+	Callsign        string
+	Route           string
+	Altitude        int
+}
+
+func (sd *Dispatcher) TrialPlan(it *TrialPlanArgs, conflicts *[]sim.ProbeConflict) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(it.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		var err error
+		*conflicts, err = s.TrialPlan(ctrl.tcp, it.Callsign, it.Route, it.Altitude)
+		return err
+	}
+}
+
 type AircraftSpecifier struct {
 	ControllerToken string
 	Callsign        string
@@ -298,6 +402,189 @@ func (sd *Dispatcher) ForceQL(ql *ForceQLArgs, _ *struct{}) error {
 	}
 }
 
+type QuickLookArgs struct {
+	ControllerToken string
+	QuickLook       sim.QuickLook
+}
+
+func (sd *Dispatcher) SetQuickLook(ql *QuickLookArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(ql.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.SetQuickLook(ctrl.tcp, ql.QuickLook)
+	}
+}
+
+type PreferenceSetsArgs struct {
+	ControllerToken string
+	PreferenceSets  []byte
+}
+
+func (sd *Dispatcher) SetPreferenceSets(pa *PreferenceSetsArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(pa.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.SetPreferenceSets(ctrl.tcp, pa.PreferenceSets)
+	}
+}
+
+type ConsolidatePositionArgs struct {
+	ControllerToken string
+	Position        string
+}
+
+func (sd *Dispatcher) ConsolidatePosition(cp *ConsolidatePositionArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(cp.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.ConsolidatePosition(ctrl.tcp, cp.Position)
+	}
+}
+
+func (sd *Dispatcher) SplitPosition(cp *ConsolidatePositionArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(cp.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.SplitPosition(ctrl.tcp, cp.Position)
+	}
+}
+
+type ResectorizeArgs struct {
+	ControllerToken string
+	Sectorization   string
+}
+
+func (sd *Dispatcher) Resectorize(ra *ResectorizeArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(ra.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.Resectorize(ctrl.tcp, ra.Sectorization)
+	}
+}
+
+type ATISNOTAMsArgs struct {
+	ControllerToken string
+	Airport         string
+	NOTAMs          []string
+}
+
+func (sd *Dispatcher) SetATISNOTAMs(an *ATISNOTAMsArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(an.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.SetATISNOTAMs(ctrl.tcp, an.Airport, an.NOTAMs)
+	}
+}
+
+type NOTAMArgs struct {
+	ControllerToken string
+	NOTAM           sim.NOTAM
+}
+
+func (sd *Dispatcher) AddNOTAM(na *NOTAMArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(na.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.AddNOTAM(ctrl.tcp, na.NOTAM)
+	}
+}
+
+func (sd *Dispatcher) CancelNOTAM(na *NOTAMArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(na.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.CancelNOTAM(ctrl.tcp, na.NOTAM.Id)
+	}
+}
+
+type TrafficRestrictionArgs struct {
+	ControllerToken string
+	Restriction     sim.TrafficRestriction
+}
+
+func (sd *Dispatcher) ImposeTrafficRestriction(ta *TrafficRestrictionArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(ta.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.ImposeTrafficRestriction(ctrl.tcp, ta.Restriction)
+	}
+}
+
+func (sd *Dispatcher) CancelTrafficRestriction(ta *TrafficRestrictionArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(ta.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.CancelTrafficRestriction(ctrl.tcp, ta.Restriction.Id)
+	}
+}
+
+type PIREPArgs struct {
+	ControllerToken string
+	PIREP           sim.PIREP
+}
+
+func (sd *Dispatcher) EnterPIREP(pa *PIREPArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(pa.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.EnterPIREP(ctrl.tcp, pa.PIREP)
+	}
+}
+
+type VehicleRequestArgs struct {
+	ControllerToken string
+	Id              int
+	Approve         bool
+}
+
+func (sd *Dispatcher) RespondToVehicleRequest(va *VehicleRequestArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(va.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.RespondToVehicleRequest(ctrl.tcp, va.Id, va.Approve)
+	}
+}
+
+type SVFRRequestArgs struct {
+	ControllerToken string
+	Id              int
+	Approve         bool
+}
+
+func (sd *Dispatcher) RespondToSVFRRequest(ra *SVFRRequestArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(ra.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.RespondToSVFRRequest(ctrl.tcp, ra.Id, ra.Approve)
+	}
+}
+
 type GlobalMessageArgs struct {
 	ControllerToken string
 	Message         string
@@ -381,6 +668,26 @@ func (sd *Dispatcher) ReleaseDeparture(hd *HeldDepartureArgs, _ *struct{}) error
 	}
 }
 
+func (sd *Dispatcher) RequestRelease(hd *HeldDepartureArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(hd.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.RequestRelease(ctrl.tcp, hd.Callsign)
+	}
+}
+
+func (sd *Dispatcher) ReassignBeaconCode(hd *HeldDepartureArgs, _ *struct{}) error {
+	defer sd.sm.lg.CatchAndReportCrash()
+
+	if ctrl, s, ok := sd.sm.LookupController(hd.ControllerToken); !ok {
+		return ErrNoSimForControllerToken
+	} else {
+		return s.ReassignBeaconCode(ctrl.tcp, hd.Callsign)
+	}
+}
+
 type AssignAltitudeArgs struct {
 	ControllerToken string
 	Callsign        string
@@ -433,6 +740,9 @@ type AircraftCommandsArgs struct {
 	ControllerToken string
 	Callsign        string
 	Commands        string
+	// Deviations from standard phraseology if the commands were given in
+	// words; see sim/phraseology.go.
+	Nonstandard []string
 }
 
 // If an RPC call returns an error, then the result argument is not returned(!?).
@@ -451,8 +761,73 @@ func (sd *Dispatcher) RunAircraftCommands(cmds *AircraftCommandsArgs, result *Ai
 	}
 	callsign := cmds.Callsign
 
+	if len(cmds.Nonstandard) > 0 {
+		s.ReportPhraseology(ctrl.tcp, callsign, cmds.Nonstandard)
+	}
+
 	commands := strings.Fields(cmds.Commands)
 
+	// Pseudo-pilots claim and release aircraft with "PP" and "PPX".
+	if len(commands) == 1 && (commands[0] == "PP" || commands[0] == "PPX") {
+		var err error
+		if commands[0] == "PP" {
+			err = s.ClaimPseudoPilotAircraft(ctrl.tcp, callsign)
+		} else {
+			err = s.ReleasePseudoPilotAircraft(ctrl.tcp, callsign)
+		}
+		if err != nil {
+			result.RemainingInput = cmds.Commands
+			result.ErrorMessage = err.Error()
+		}
+		return nil
+	}
+
+	// Instructors start emergencies with "EMERG" followed by the type of
+	// emergency.
+	if len(commands) == 2 && commands[0] == "EMERG" {
+		err := ErrInvalidCommandSyntax
+		if t, ok := sim.ParseEmergencyType(commands[1]); ok {
+			err = s.TriggerEmergency(ctrl.tcp, callsign, t)
+		}
+		if err != nil {
+			result.RemainingInput = cmds.Commands
+			result.ErrorMessage = err.Error()
+		}
+		return nil
+	}
+
+	// Coordination calls to virtual controllers: "CALL APREQ", "CALL 2K
+	// PO", or "CALL 2K A120".
+	if len(commands) > 1 && commands[0] == "CALL" {
+		err := ErrInvalidCommandSyntax
+		if req, ok := sim.ParseCoordinationRequest(commands[1:]); ok {
+			err = s.RequestCoordination(ctrl.tcp, callsign, req)
+		}
+		if err != nil {
+			result.RemainingInput = cmds.Commands
+			result.ErrorMessage = err.Error()
+		}
+		return nil
+	}
+
+	if pp := s.PseudoPilotFor(callsign); pp != "" && pp != ctrl.tcp {
+		// The aircraft is flown by a pseudo-pilot, so pass the
+		// instructions along rather than executing them.
+		if err := s.RelayToPseudoPilot(ctrl.tcp, callsign, cmds.Commands); err != nil {
+			result.RemainingInput = cmds.Commands
+			result.ErrorMessage = err.Error()
+		}
+		return nil
+	} else if pp == ctrl.tcp {
+		for i, command := range commands {
+			if !sim.PseudoPilotCommandAllowed(command) {
+				result.RemainingInput = strings.Join(commands[i:], " ")
+				result.ErrorMessage = ErrInvalidPseudoPilotCommand.Error()
+				return nil
+			}
+		}
+	}
+
 	for i, command := range commands {
 		rewriteError := func(err error) {
 			result.RemainingInput = strings.Join(commands[i:], " ")
@@ -463,7 +838,17 @@ func (sd *Dispatcher) RunAircraftCommands(cmds *AircraftCommandsArgs, result *Ai
 
 		switch command[0] {
 		case 'A', 'C':
-			if command == "CAC" {
+			if command == "ATIS" {
+				if err := s.VerifyATIS(ctrl.tcp, callsign); err != nil {
+					rewriteError(err)
+					return nil
+				}
+			} else if command == "APREQ" {
+				if err := s.RequestRelease(ctrl.tcp, callsign); err != nil {
+					rewriteError(err)
+					return nil
+				}
+			} else if command == "CAC" {
 				// Cancel approach clearance
 				if err := s.CancelApproachClearance(ctrl.tcp, callsign); err != nil {
 					rewriteError(err)
@@ -555,6 +940,11 @@ func (sd *Dispatcher) RunAircraftCommands(cmds *AircraftCommandsArgs, result *Ai
 					rewriteError(err)
 					return nil
 				}
+			} else if command == "DEV" {
+				if err := s.ApproveDeviation(ctrl.tcp, callsign); err != nil {
+					rewriteError(err)
+					return nil
+				}
 			} else if components := strings.Split(command, "/"); len(components) > 1 && len(components[1]) > 1 {
 				fix := components[0][1:]
 
@@ -626,6 +1016,11 @@ func (sd *Dispatcher) RunAircraftCommands(cmds *AircraftCommandsArgs, result *Ai
 					rewriteError(err)
 					return nil
 				}
+			} else if command == "FID" {
+				if err := s.ResetFlightID(ctrl.tcp, callsign); err != nil {
+					rewriteError(err)
+					return nil
+				}
 			} else {
 				rewriteError(ErrInvalidCommandSyntax)
 				return nil
@@ -641,6 +1036,25 @@ func (sd *Dispatcher) RunAircraftCommands(cmds *AircraftCommandsArgs, result *Ai
 					rewriteError(err)
 					return nil
 				}
+			} else if command[1] < '0' || command[1] > '9' {
+				// Hold at <fix>, optionally with left turns and an EFC:
+				// HCAMRN/L/EFC1530
+				components := strings.Split(command, "/")
+				fix, right, efc := components[0][1:], true, ""
+				for _, c := range components[1:] {
+					if c == "L" {
+						right = false
+					} else if strings.HasPrefix(c, "EFC") {
+						efc = c[3:]
+					} else {
+						rewriteError(ErrInvalidCommandSyntax)
+						return nil
+					}
+				}
+				if err := s.Hold(ctrl.tcp, callsign, fix, right, efc); err != nil {
+					rewriteError(err)
+					return nil
+				}
 			} else if hdg, err := strconv.Atoi(command[1:]); err != nil {
 				rewriteError(err)
 				return nil
@@ -752,6 +1166,11 @@ func (sd *Dispatcher) RunAircraftCommands(cmds *AircraftCommandsArgs, result *Ai
 					rewriteError(err)
 					return nil
 				}
+			} else if command == "SQ" {
+				if err := s.ReissueBeaconCode(ctrl.tcp, callsign); err != nil {
+					rewriteError(err)
+					return nil
+				}
 			} else if command == "SQS" {
 				if err := s.ChangeTransponderMode(ctrl.tcp, callsign, av.Standby); err != nil {
 					rewriteError(err)
@@ -17,12 +17,15 @@ var (
 	ErrInvalidCommandSyntax      = errors.New("Invalid command syntax")
 	ErrInvalidControllerToken    = errors.New("Invalid controller token")
 	ErrInvalidPassword           = errors.New("Invalid password")
+	ErrInvalidPseudoPilotCommand = errors.New("Command not available to pseudo-pilots")
 	ErrInvalidSSimConfiguration  = errors.New("Invalid SimConfiguration")
+	ErrNoNamedScenarioGroup      = errors.New("No scenario group with that name")
 	ErrNoNamedSim                = errors.New("No Sim with that name")
 	ErrNoSimForControllerToken   = errors.New("No Sim running for controller token")
 	ErrRPCTimeout                = errors.New("RPC call timed out")
 	ErrRPCVersionMismatch        = errors.New("Client and server RPC versions don't match")
 	ErrServerDisconnected        = errors.New("Server disconnected")
+	ErrUnknownVideoMapFile       = errors.New("Unknown video map file")
 )
 
 var errorStringToError = map[string]error{
@@ -32,7 +35,9 @@ var errorStringToError = map[string]error{
 	av.ErrInvalidApproach.Error():              av.ErrInvalidApproach,
 	av.ErrInvalidController.Error():            av.ErrInvalidController,
 	av.ErrInvalidFacility.Error():              av.ErrInvalidFacility,
+	av.ErrInvalidFlightPlan.Error():            av.ErrInvalidFlightPlan,
 	av.ErrInvalidHeading.Error():               av.ErrInvalidHeading,
+	av.ErrInvalidSquawkCode.Error():            av.ErrInvalidSquawkCode,
 	av.ErrNoAircraftForCallsign.Error():        av.ErrNoAircraftForCallsign,
 	av.ErrNoController.Error():                 av.ErrNoController,
 	av.ErrNoCoordinationFix.Error():            av.ErrNoCoordinationFix,
@@ -45,6 +50,7 @@ var errorStringToError = map[string]error{
 	av.ErrNotFlyingRoute.Error():               av.ErrNotFlyingRoute,
 	av.ErrNotPointedOutToMe.Error():            av.ErrNotPointedOutToMe,
 	av.ErrOtherControllerHasTrack.Error():      av.ErrOtherControllerHasTrack,
+	av.ErrSquawkCodeAlreadyAssigned.Error():    av.ErrSquawkCodeAlreadyAssigned,
 	av.ErrUnableCommand.Error():                av.ErrUnableCommand,
 	av.ErrUnknownAircraftType.Error():          av.ErrUnknownAircraftType,
 	av.ErrUnknownAirport.Error():               av.ErrUnknownAirport,
@@ -52,6 +58,8 @@ var errorStringToError = map[string]error{
 	av.ErrUnknownRunway.Error():                av.ErrUnknownRunway,
 
 	sim.ErrAircraftAlreadyReleased.Error():     sim.ErrAircraftAlreadyReleased,
+	sim.ErrAircraftHasEmergency.Error():        sim.ErrAircraftHasEmergency,
+	sim.ErrAircraftHasPseudoPilot.Error():      sim.ErrAircraftHasPseudoPilot,
 	sim.ErrBeaconMismatch.Error():              sim.ErrBeaconMismatch,
 	sim.ErrControllerAlreadySignedIn.Error():   sim.ErrControllerAlreadySignedIn,
 	sim.ErrIllegalACID.Error():                 sim.ErrIllegalACID,
@@ -60,12 +68,40 @@ var errorStringToError = map[string]error{
 	sim.ErrIllegalScratchpad.Error():           sim.ErrIllegalScratchpad,
 	sim.ErrInvalidAbbreviatedFP.Error():        sim.ErrInvalidAbbreviatedFP,
 	sim.ErrInvalidDepartureController.Error():  sim.ErrInvalidDepartureController,
+	sim.ErrInvalidEFC.Error():                  sim.ErrInvalidEFC,
+	sim.ErrInvalidFastForwardRate.Error():      sim.ErrInvalidFastForwardRate,
+	sim.ErrInvalidNOTAM.Error():                sim.ErrInvalidNOTAM,
+	sim.ErrInvalidPIREP.Error():                sim.ErrInvalidPIREP,
 	sim.ErrInvalidRestrictionAreaIndex.Error(): sim.ErrInvalidRestrictionAreaIndex,
+	sim.ErrInvalidRoute.Error():                sim.ErrInvalidRoute,
+	sim.ErrInvalidTrafficRestriction.Error():   sim.ErrInvalidTrafficRestriction,
+	sim.ErrNoAPREQ.Error():                     sim.ErrNoAPREQ,
+	sim.ErrNoBeaconMismatch.Error():            sim.ErrNoBeaconMismatch,
+	sim.ErrNoCheckpoint.Error():                sim.ErrNoCheckpoint,
+	sim.ErrNoDeviationRequest.Error():          sim.ErrNoDeviationRequest,
+	sim.ErrNoFlightIDMismatch.Error():          sim.ErrNoFlightIDMismatch,
 	sim.ErrNoMatchingFlight.Error():            sim.ErrNoMatchingFlight,
+	sim.ErrNoSVFRRequest.Error():               sim.ErrNoSVFRRequest,
+	sim.ErrNoVehicleRequest.Error():            sim.ErrNoVehicleRequest,
+	sim.ErrNotConsolidated.Error():             sim.ErrNotConsolidated,
 	sim.ErrNotLaunchController.Error():         sim.ErrNotLaunchController,
+	sim.ErrNotPseudoPilot.Error():              sim.ErrNotPseudoPilot,
+	sim.ErrNotVFR.Error():                      sim.ErrNotVFR,
+	sim.ErrNotVirtualController.Error():        sim.ErrNotVirtualController,
+	sim.ErrPositionAlreadyConsolidated.Error(): sim.ErrPositionAlreadyConsolidated,
+	sim.ErrPreferenceSetsTooLarge.Error():      sim.ErrPreferenceSetsTooLarge,
+	sim.ErrReleaseAlreadyRequested.Error():     sim.ErrReleaseAlreadyRequested,
+	sim.ErrRunwayClosed.Error():                sim.ErrRunwayClosed,
+	sim.ErrSVFRBelowMinimums.Error():           sim.ErrSVFRBelowMinimums,
+	sim.ErrSimNotPaused.Error():                sim.ErrSimNotPaused,
 	sim.ErrTooManyRestrictionAreas.Error():     sim.ErrTooManyRestrictionAreas,
 	sim.ErrUnknownController.Error():           sim.ErrUnknownController,
 	sim.ErrUnknownControllerFacility.Error():   sim.ErrUnknownControllerFacility,
+	sim.ErrUnknownEmergency.Error():            sim.ErrUnknownEmergency,
+	sim.ErrUnknownFacility.Error():             sim.ErrUnknownFacility,
+	sim.ErrUnknownNOTAM.Error():                sim.ErrUnknownNOTAM,
+	sim.ErrUnknownSectorization.Error():        sim.ErrUnknownSectorization,
+	sim.ErrUnknownTrafficRestriction.Error():   sim.ErrUnknownTrafficRestriction,
 	sim.ErrViolatedAirspace.Error():            sim.ErrViolatedAirspace,
 	sim.ErrVFRSimTookTooLong.Error():           sim.ErrVFRSimTookTooLong,
 
@@ -82,7 +118,7 @@ var errorStringToError = map[string]error{
 }
 
 func TryDecodeError(e error) error {
-	if err, ok := errorStringToError[e.Error()]; ok {
+	if err := TryDecodeErrorString(e.Error()); err != nil {
 		return err
 	}
 	return e
@@ -92,5 +128,9 @@ func TryDecodeErrorString(s string) error {
 	if err, ok := errorStringToError[s]; ok {
 		return err
 	}
+	// Errors from the NAS computers carry additional context.
+	if ne, ok := sim.ParseNASError(s, func(s string) error { return errorStringToError[s] }); ok {
+		return ne
+	}
 	return nil
 }
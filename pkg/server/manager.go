@@ -7,10 +7,12 @@ package server
 import (
 	crand "crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"log/slog"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/brunoga/deep"
@@ -69,6 +71,7 @@ type ActiveSim struct {
 	allowInstructor bool
 	password        string
 	local           bool
+	stopped         atomic.Bool // see SimManager.Stop
 
 	controllersByTCP map[string]*HumanController
 }
@@ -87,7 +90,7 @@ func (as *ActiveSim) AddHumanController(tcp, token string) *HumanController {
 func NewSimManager(scenarioGroups map[string]map[string]*ScenarioGroup,
 	simConfigurations map[string]map[string]*Configuration, manifests map[string]*av.VideoMapManifest,
 	lg *log.Logger) *SimManager {
-	return &SimManager{
+	sm := &SimManager{
 		scenarioGroups:     scenarioGroups,
 		configs:            simConfigurations,
 		activeSims:         make(map[string]*ActiveSim),
@@ -96,6 +99,31 @@ func NewSimManager(scenarioGroups map[string]map[string]*ScenarioGroup,
 		startTime:          time.Now(),
 		lg:                 lg,
 	}
+	lg.RegisterCrashState("sims", sm.crashDump)
+	return sm
+}
+
+// crashDump returns the state of all of the active sims for a crash
+// report. Sims that can't be dumped (e.g., because they are locked) are
+// reported with the error.
+func (sm *SimManager) crashDump() ([]byte, error) {
+	if !sm.mu.TryLock() {
+		return nil, errors.New("sim manager is locked")
+	}
+	defer sm.mu.Mutex.Unlock()
+
+	sims := make(map[string]any)
+	for name, as := range sm.activeSims {
+		if name == "" {
+			name = "(local)"
+		}
+		if b, err := as.sim.CrashDump(); err != nil {
+			sims[name] = err.Error()
+		} else {
+			sims[name] = json.RawMessage(b)
+		}
+	}
+	return json.Marshal(sims)
 }
 
 type NewSimResult struct {
@@ -109,6 +137,13 @@ func (sm *SimManager) New(config *NewSimConfiguration, result *NewSimResult) err
 		if nsc := sm.makeSimConfiguration(config, lg); nsc != nil {
 			manifest := sm.mapManifests[nsc.STARSFacilityAdaptation.VideoMapFile]
 			sim := sim.NewSim(*nsc, manifest, lg)
+
+			// Get the procedures for the neighboring facilities ready in
+			// case they're needed.
+			if tracon, ok := av.DB.TRACONs[nsc.TRACON]; ok {
+				go av.DB.LoadProcedures(av.DB.AdjacentARTCCs(tracon.ARTCC)...)
+			}
+
 			as := &ActiveSim{
 				name:             config.NewSimName,
 				scenarioGroup:    config.GroupName,
@@ -136,7 +171,7 @@ func (sm *SimManager) New(config *NewSimConfiguration, result *NewSimResult) err
 			return ErrInvalidPassword
 		}
 
-		ss, token, err := sm.signOn(as, config.SelectedRemoteSimPosition, config.Instructor)
+		ss, token, err := sm.signOn(as, config.SelectedRemoteSimPosition, config.Instructor, config.PseudoPilot)
 		if err != nil {
 			return err
 		}
@@ -172,32 +207,29 @@ func (sm *SimManager) makeSimConfiguration(config *NewSimConfiguration, lg *log.
 	description := util.Select(config.NewSimType == NewSimCreateLocal, " "+config.ScenarioName,
 		"@"+config.NewSimName+": "+config.ScenarioName)
 
-	nsc := sim.NewSimConfiguration{
-		TFRs:                    config.TFRs,
-		LiveWeather:             config.LiveWeather,
-		TRACON:                  config.TRACONName,
-		LaunchConfig:            config.Scenario.LaunchConfig,
-		STARSFacilityAdaptation: deep.MustCopy(sg.STARSFacilityAdaptation),
-		IsLocal:                 config.NewSimType == NewSimCreateLocal,
-		DepartureRunways:        sc.DepartureRunways,
-		ArrivalRunways:          sc.ArrivalRunways,
-		ReportingPoints:         sg.ReportingPoints,
-		Description:             description,
-		MagneticVariation:       sg.MagneticVariation,
-		NmPerLongitude:          sg.NmPerLongitude,
-		Wind:                    sc.Wind,
-		Airports:                sg.Airports,
-		Fixes:                   sg.Fixes,
-		PrimaryAirport:          sg.PrimaryAirport,
-		Center:                  util.Select(sc.Center.IsZero(), sg.STARSFacilityAdaptation.Center, sc.Center),
-		Range:                   util.Select(sc.Range == 0, sg.STARSFacilityAdaptation.Range, sc.Range),
-		DefaultMaps:             sc.DefaultMaps,
-		InboundFlows:            sg.InboundFlows,
-		Airspace:                sg.Airspace,
-		ControllerAirspace:      sc.Airspace,
-		ControlPositions:        sg.ControlPositions,
-		VirtualControllers:      sc.VirtualControllers,
-		SignOnPositions:         make(map[string]*av.Controller),
+	nsc := scenarioSimConfiguration(sg, sc)
+	nsc.TFRs = config.TFRs
+	nsc.LiveWeather = config.LiveWeather
+	nsc.Deterministic = config.Deterministic
+	nsc.Seed = config.Seed
+	nsc.TRACON = config.TRACONName
+	nsc.LaunchConfig = config.Scenario.LaunchConfig
+	nsc.IsLocal = config.NewSimType == NewSimCreateLocal
+	nsc.Description = description
+	if nsc.IsLocal && config.ConnectNetwork {
+		nsc.Network = &config.Network
+	}
+	if nsc.IsLocal && config.ConnectADSB {
+		nsc.ADSB = &config.ADSB
+	}
+	if nsc.IsLocal && config.ExportFlightData {
+		nsc.Export = &config.Export
+	}
+	if nsc.IsLocal && config.StreamData {
+		nsc.Stream = &config.Stream
+	}
+	if nsc.IsLocal && config.Federate {
+		nsc.Federation = &config.Federation
 	}
 
 	if !nsc.IsLocal {
@@ -237,6 +269,50 @@ func (sm *SimManager) makeSimConfiguration(config *NewSimConfiguration, lg *log.
 	return &nsc
 }
 
+// scenarioSimConfiguration returns a sim.NewSimConfiguration with the
+// fields that come from the scenario group and scenario initialized.
+func scenarioSimConfiguration(sg *ScenarioGroup, sc *Scenario) sim.NewSimConfiguration {
+	return sim.NewSimConfiguration{
+		TRACON:                  sg.TRACON,
+		LaunchConfig:            sg.defaultLaunchConfig(sc),
+		STARSFacilityAdaptation: deep.MustCopy(sg.STARSFacilityAdaptation),
+		DepartureRunways:        sc.DepartureRunways,
+		ArrivalRunways:          sc.ArrivalRunways,
+		ReportingPoints:         sg.ReportingPoints,
+		MagneticVariation:       sg.MagneticVariation,
+		NmPerLongitude:          sg.NmPerLongitude,
+		Wind:                    sc.Wind,
+		Airports:                sg.Airports,
+		Fixes:                   sg.Fixes,
+		PrimaryAirport:          sg.PrimaryAirport,
+		Center:                  util.Select(sc.Center.IsZero(), sg.STARSFacilityAdaptation.Center, sc.Center),
+		Range:                   util.Select(sc.Range == 0, sg.STARSFacilityAdaptation.Range, sc.Range),
+		DefaultMaps:             sc.DefaultMaps,
+		InboundFlows:            sg.InboundFlows,
+		Airspace:                sg.Airspace,
+		ControllerAirspace:      sc.Airspace,
+		Sectorizations:          sc.Sectorizations,
+		SectorizationSchedule:   sc.SectorizationSchedule,
+		ControlPositions:        sg.ControlPositions,
+		VirtualControllers:      sc.VirtualControllers,
+		SignOnPositions:         make(map[string]*av.Controller),
+		Emergencies:             sc.Emergencies,
+		NOTAMs:                  sc.NOTAMs,
+		TrafficRestrictions:     sc.TrafficRestrictions,
+		ArrivalPushes:           sc.ArrivalPushes,
+		WeatherCells:            sc.WeatherCells,
+		WeatherHazards:          sc.WeatherHazards,
+		Script:                  sc.Script,
+		Lesson:                  sc.Lesson,
+		VirtualHandoffs:         sc.VirtualHandoffs,
+		ScoringRubrics:          sg.ScoringRubrics,
+		LOAs:                    sg.LOAs,
+		APREQs:                  sg.APREQs,
+		RunwayFlows:             sg.RunwayFlows,
+		TrackHistoryDepth:       sg.TrackHistoryDepth,
+	}
+}
+
 func (sm *SimManager) AddLocal(sim *sim.Sim, result *NewSimResult) error {
 	as := &ActiveSim{ // no password, etc.
 		sim:              sim,
@@ -268,7 +344,7 @@ func (sm *SimManager) Add(as *ActiveSim, result *NewSimResult, prespawn bool) er
 	sm.activeSims[as.name] = as
 
 	instuctor := as.sim.Instructors[as.sim.State.PrimaryController]
-	ss, token, err := sm.signOn(as, as.sim.State.PrimaryController, instuctor)
+	ss, token, err := sm.signOn(as, as.sim.State.PrimaryController, instuctor, false)
 	if err != nil {
 		return err
 	}
@@ -288,7 +364,7 @@ func (sm *SimManager) Add(as *ActiveSim, result *NewSimResult, prespawn bool) er
 
 		// Terminate idle Sims after 4 hours, but not unnamed Sims, since
 		// they're local and not running on the server.
-		for !sm.SimShouldExit(as.sim) {
+		for !as.stopped.Load() && !sm.SimShouldExit(as.sim) {
 			if !as.local {
 				// Sign off controllers we haven't heard from in 15 seconds so that
 				// someone else can take their place. We only make this check for
@@ -320,7 +396,12 @@ func (sm *SimManager) Add(as *ActiveSim, result *NewSimResult, prespawn bool) er
 			time.Sleep(100 * time.Millisecond)
 		}
 
-		sm.lg.Infof("%s: terminating sim after %s idle", as.name, as.sim.IdleTime())
+		if as.stopped.Load() {
+			sm.lg.Infof("%s: terminating stopped sim", as.name)
+		} else {
+			sm.lg.Infof("%s: terminating sim after %s idle", as.name, as.sim.IdleTime())
+		}
+		as.sim.Disconnect()
 		sm.mu.Lock(sm.lg)
 		defer sm.mu.Unlock(sm.lg)
 		delete(sm.activeSims, as.name)
@@ -338,6 +419,24 @@ func (sm *SimManager) Add(as *ActiveSim, result *NewSimResult, prespawn bool) er
 	return nil
 }
 
+// Stop terminates the named sim; its controllers are told and then
+// disconnected.
+func (sm *SimManager) Stop(name string) error {
+	sm.mu.Lock(sm.lg)
+	defer sm.mu.Unlock(sm.lg)
+
+	as, ok := sm.activeSims[name]
+	if !ok || name == "" {
+		return ErrNoNamedSim
+	}
+	as.sim.PostEvent(sim.Event{
+		Type:    sim.ServerBroadcastMessageEvent,
+		Message: "This sim has been stopped.",
+	})
+	as.stopped.Store(true)
+	return nil
+}
+
 type ConnectResult struct {
 	Configurations map[string]map[string]*Configuration
 	RunningSims    map[string]*RemoteSim
@@ -362,8 +461,8 @@ func (sm *SimManager) Connect(version int, result *ConnectResult) error {
 }
 
 // assume SimManager lock is held
-func (sm *SimManager) signOn(as *ActiveSim, tcp string, instructor bool) (*sim.State, string, error) {
-	ss, err := as.sim.SignOn(tcp, instructor)
+func (sm *SimManager) signOn(as *ActiveSim, tcp string, instructor, pseudoPilot bool) (*sim.State, string, error) {
+	ss, err := as.sim.SignOn(tcp, instructor, pseudoPilot)
 	if err != nil {
 		return nil, "", err
 	}
@@ -465,7 +564,7 @@ type simStatus struct {
 	TotalIFR, TotalVFR int
 }
 
-func (sm *SimManager) GetWorldUpdate(token string, update *sim.WorldUpdate) error {
+func (sm *SimManager) GetWorldUpdate(token string, sequence uint64, update *sim.WorldUpdate) error {
 	if ctrl, s, ok := sm.LookupController(token); !ok {
 		return ErrNoSimForControllerToken
 	} else {
@@ -481,7 +580,7 @@ func (sm *SimManager) GetWorldUpdate(token string, update *sim.WorldUpdate) erro
 		}
 		sm.mu.Unlock(sm.lg)
 
-		return s.GetWorldUpdate(ctrl.tcp, update)
+		return s.GetWorldUpdate(ctrl.tcp, sequence, update)
 	}
 }
 
@@ -6,6 +6,7 @@ package server
 
 import (
 	"net/rpc"
+	"time"
 
 	av "github.com/mmp/vice/pkg/aviation"
 	"github.com/mmp/vice/pkg/math"
@@ -22,6 +23,10 @@ func (p *proxy) TogglePause() *rpc.Call {
 	return p.Client.Go("Sim.TogglePause", p.ControllerToken, nil, nil)
 }
 
+func (p *proxy) SingleStep() *rpc.Call {
+	return p.Client.Go("Sim.SingleStep", p.ControllerToken, nil, nil)
+}
+
 func (p *proxy) SignOff(_, _ *struct{}) error {
 	if err := p.Client.CallWithTimeout("Sim.SignOff", p.ControllerToken, nil); err != nil {
 		return err
@@ -46,8 +51,12 @@ func (p *proxy) GetSerializeSim() (*sim.Sim, error) {
 	return &s, err
 }
 
-func (p *proxy) GetWorldUpdate(wu *sim.WorldUpdate) *rpc.Call {
-	return p.Client.Go("Sim.GetWorldUpdate", p.ControllerToken, wu, nil)
+func (p *proxy) GetWorldUpdate(sequence uint64, wu *sim.WorldUpdate) *rpc.Call {
+	return p.Client.Go("Sim.GetWorldUpdate",
+		&GetWorldUpdateArgs{
+			ControllerToken: p.ControllerToken,
+			Sequence:        sequence,
+		}, wu, nil)
 }
 
 func (p *proxy) SetSimRate(r float32) *rpc.Call {
@@ -58,6 +67,26 @@ func (p *proxy) SetSimRate(r float32) *rpc.Call {
 		}, nil, nil)
 }
 
+func (p *proxy) SetFastForwardRate(r float32) *rpc.Call {
+	return p.Client.Go("Sim.SetFastForwardRate",
+		&SetFastForwardRateArgs{
+			ControllerToken: p.ControllerToken,
+			Rate:            r,
+		}, nil, nil)
+}
+
+func (p *proxy) Rewind(d time.Duration) *rpc.Call {
+	return p.Client.Go("Sim.Rewind",
+		&RewindArgs{
+			ControllerToken: p.ControllerToken,
+			Duration:        d,
+		}, nil, nil)
+}
+
+func (p *proxy) GetScoreReport(report *sim.ScoreReport) *rpc.Call {
+	return p.Client.Go("Sim.GetScoreReport", p.ControllerToken, report, nil)
+}
+
 func (p *proxy) SetLaunchConfig(lc sim.LaunchConfig) *rpc.Call {
 	return p.Client.Go("Sim.SetLaunchConfig",
 		&SetLaunchConfigArgs{
@@ -112,6 +141,13 @@ func (p *proxy) CreateUnsupportedTrack(callsign string, ut *sim.UnsupportedTrack
 	}, nil, nil)
 }
 
+func (p *proxy) CreateLocalFlightPlan(callsign string) *rpc.Call {
+	return p.Client.Go("Sim.CreateLocalFlightPlan", &CreateLocalFlightPlanArgs{
+		ControllerToken: p.ControllerToken,
+		Callsign:        callsign,
+	}, nil, nil)
+}
+
 func (p *proxy) UploadFlightPlan(Type int, fp *av.STARSFlightPlan) *rpc.Call {
 	return p.Client.Go("Sim.UploadFlightPlan", &UploadPlanArgs{
 		ControllerToken: p.ControllerToken,
@@ -120,6 +156,23 @@ func (p *proxy) UploadFlightPlan(Type int, fp *av.STARSFlightPlan) *rpc.Call {
 	}, nil, nil)
 }
 
+func (p *proxy) AmendFlightPlan(callsign string, fp av.FlightPlan) *rpc.Call {
+	return p.Client.Go("Sim.AmendFlightPlan", &AmendFlightPlanArgs{
+		ControllerToken: p.ControllerToken,
+		Callsign:        callsign,
+		FlightPlan:      fp,
+	}, nil, nil)
+}
+
+func (p *proxy) TrialPlan(callsign, route string, altitude int, conflicts *[]sim.ProbeConflict) *rpc.Call {
+	return p.Client.Go("Sim.TrialPlan", &TrialPlanArgs{
+		ControllerToken: p.ControllerToken,
+		Callsign:        callsign,
+		Route:           route,
+		Altitude:        altitude,
+	}, conflicts, nil)
+}
+
 func (p *proxy) InitiateTrack(callsign string, fp *av.STARSFlightPlan) *rpc.Call {
 	return p.Client.Go("Sim.InitiateTrack", InitiateTrackArgs{
 		AircraftSpecifier: AircraftSpecifier{
@@ -174,6 +227,100 @@ func (p *proxy) ForceQL(callsign, controller string) *rpc.Call {
 	}, nil, nil)
 }
 
+func (p *proxy) SetQuickLook(ql sim.QuickLook) *rpc.Call {
+	return p.Client.Go("Sim.SetQuickLook", &QuickLookArgs{
+		ControllerToken: p.ControllerToken,
+		QuickLook:       ql,
+	}, nil, nil)
+}
+
+func (p *proxy) SetPreferenceSets(prefs []byte) *rpc.Call {
+	return p.Client.Go("Sim.SetPreferenceSets", &PreferenceSetsArgs{
+		ControllerToken: p.ControllerToken,
+		PreferenceSets:  prefs,
+	}, nil, nil)
+}
+
+func (p *proxy) ConsolidatePosition(position string) *rpc.Call {
+	return p.Client.Go("Sim.ConsolidatePosition", &ConsolidatePositionArgs{
+		ControllerToken: p.ControllerToken,
+		Position:        position,
+	}, nil, nil)
+}
+
+func (p *proxy) SplitPosition(position string) *rpc.Call {
+	return p.Client.Go("Sim.SplitPosition", &ConsolidatePositionArgs{
+		ControllerToken: p.ControllerToken,
+		Position:        position,
+	}, nil, nil)
+}
+
+func (p *proxy) Resectorize(sectorization string) *rpc.Call {
+	return p.Client.Go("Sim.Resectorize", &ResectorizeArgs{
+		ControllerToken: p.ControllerToken,
+		Sectorization:   sectorization,
+	}, nil, nil)
+}
+
+func (p *proxy) SetATISNOTAMs(airport string, notams []string) *rpc.Call {
+	return p.Client.Go("Sim.SetATISNOTAMs", &ATISNOTAMsArgs{
+		ControllerToken: p.ControllerToken,
+		Airport:         airport,
+		NOTAMs:          notams,
+	}, nil, nil)
+}
+
+func (p *proxy) AddNOTAM(n sim.NOTAM) *rpc.Call {
+	return p.Client.Go("Sim.AddNOTAM", &NOTAMArgs{
+		ControllerToken: p.ControllerToken,
+		NOTAM:           n,
+	}, nil, nil)
+}
+
+func (p *proxy) CancelNOTAM(id int) *rpc.Call {
+	return p.Client.Go("Sim.CancelNOTAM", &NOTAMArgs{
+		ControllerToken: p.ControllerToken,
+		NOTAM:           sim.NOTAM{Id: id},
+	}, nil, nil)
+}
+
+func (p *proxy) ImposeTrafficRestriction(r sim.TrafficRestriction) *rpc.Call {
+	return p.Client.Go("Sim.ImposeTrafficRestriction", &TrafficRestrictionArgs{
+		ControllerToken: p.ControllerToken,
+		Restriction:     r,
+	}, nil, nil)
+}
+
+func (p *proxy) CancelTrafficRestriction(id int) *rpc.Call {
+	return p.Client.Go("Sim.CancelTrafficRestriction", &TrafficRestrictionArgs{
+		ControllerToken: p.ControllerToken,
+		Restriction:     sim.TrafficRestriction{Id: id},
+	}, nil, nil)
+}
+
+func (p *proxy) EnterPIREP(pirep sim.PIREP) *rpc.Call {
+	return p.Client.Go("Sim.EnterPIREP", &PIREPArgs{
+		ControllerToken: p.ControllerToken,
+		PIREP:           pirep,
+	}, nil, nil)
+}
+
+func (p *proxy) RespondToVehicleRequest(id int, approve bool) *rpc.Call {
+	return p.Client.Go("Sim.RespondToVehicleRequest", &VehicleRequestArgs{
+		ControllerToken: p.ControllerToken,
+		Id:              id,
+		Approve:         approve,
+	}, nil, nil)
+}
+
+func (p *proxy) RespondToSVFRRequest(id int, approve bool) *rpc.Call {
+	return p.Client.Go("Sim.RespondToSVFRRequest", &SVFRRequestArgs{
+		ControllerToken: p.ControllerToken,
+		Id:              id,
+		Approve:         approve,
+	}, nil, nil)
+}
+
 func (p *proxy) RedirectHandoff(callsign, controller string) *rpc.Call {
 	return p.Client.Go("Sim.RedirectHandoff", &HandoffArgs{
 		ControllerToken: p.ControllerToken,
@@ -233,6 +380,20 @@ func (p *proxy) ReleaseDeparture(callsign string) *rpc.Call {
 	}, nil, nil)
 }
 
+func (p *proxy) RequestRelease(callsign string) *rpc.Call {
+	return p.Client.Go("Sim.RequestRelease", &HeldDepartureArgs{
+		ControllerToken: p.ControllerToken,
+		Callsign:        callsign,
+	}, nil, nil)
+}
+
+func (p *proxy) ReassignBeaconCode(callsign string) *rpc.Call {
+	return p.Client.Go("Sim.ReassignBeaconCode", &HeldDepartureArgs{
+		ControllerToken: p.ControllerToken,
+		Callsign:        callsign,
+	}, nil, nil)
+}
+
 func (p *proxy) SetTemporaryAltitude(callsign string, alt int) *rpc.Call {
 	return p.Client.Go("Sim.SetTemporaryAltitude", &AssignAltitudeArgs{
 		ControllerToken: p.ControllerToken,
@@ -262,11 +423,12 @@ func (p *proxy) DeleteAllAircraft() *rpc.Call {
 	}, nil, nil)
 }
 
-func (p *proxy) RunAircraftCommands(callsign string, cmds string, result *AircraftCommandsResult) *rpc.Call {
+func (p *proxy) RunAircraftCommands(callsign string, cmds string, nonstandard []string, result *AircraftCommandsResult) *rpc.Call {
 	return p.Client.Go("Sim.RunAircraftCommands", &AircraftCommandsArgs{
 		ControllerToken: p.ControllerToken,
 		Callsign:        callsign,
 		Commands:        cmds,
+		Nonstandard:     nonstandard,
 	}, result, nil)
 }
 
@@ -0,0 +1,131 @@
+// pkg/server/reload.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// ScenarioReloadInterval is how often a scenario file given on the command
+// line is checked for changes.
+var ScenarioReloadInterval = 2 * time.Second
+
+// WatchScenarioFile polls the given scenario file and reloads it into the
+// running sims that use it whenever it is modified. It doesn't return.
+func (sm *SimManager) WatchScenarioFile(filename string, isLocal bool) {
+	var lastMod time.Time
+	if fi, err := os.Stat(filename); err == nil {
+		lastMod = fi.ModTime()
+	}
+
+	for range time.Tick(ScenarioReloadInterval) {
+		fi, err := os.Stat(filename)
+		if err != nil || !fi.ModTime().After(lastMod) {
+			continue
+		}
+		lastMod = fi.ModTime()
+
+		sm.lg.Infof("%s: modified; reloading", filename)
+		reports, err := sm.ReloadScenarioFile(filename, isLocal)
+		if err != nil {
+			sm.lg.Errorf("%s: unable to reload: %v", filename, err)
+			sm.postReloadMessage("Unable to reload " + filepath.Base(filename) + ": " + err.Error())
+			continue
+		}
+		for name, r := range reports {
+			sm.lg.Infof("%s: %s", name, r)
+		}
+	}
+}
+
+// ReloadScenarioFile loads the given scenario file and, if it is valid,
+// replaces the previously-loaded definition of its scenario group and
+// applies the changes to any running sims that use it. The returned
+// reports, indexed by sim name, describe what was applied to each sim
+// and what requires a restart.
+func (sm *SimManager) ReloadScenarioFile(filename string, isLocal bool) (map[string]sim.ReloadReport, error) {
+	var e util.ErrorLogger
+
+	var fsys fs.FS = os.DirFS(".")
+	if filepath.IsAbs(filename) {
+		fsys = util.RootFS{}
+	}
+	sg := loadScenarioGroup(fsys, filename, &e)
+	if e.HaveErrors() {
+		return nil, errors.New(e.String())
+	}
+
+	sm.mu.Lock(sm.lg)
+	defer sm.mu.Unlock(sm.lg)
+
+	prev, ok := sm.scenarioGroups[sg.TRACON][sg.Name]
+	if !ok {
+		return nil, ErrNoNamedScenarioGroup
+	}
+	if sg.STARSFacilityAdaptation.VideoMapFile == "" {
+		// As in LoadScenarioGroups, allow the video map file to come
+		// from the command line.
+		sg.STARSFacilityAdaptation.VideoMapFile = prev.STARSFacilityAdaptation.VideoMapFile
+	}
+	manifest, ok := sm.mapManifests[sg.STARSFacilityAdaptation.VideoMapFile]
+	if !ok {
+		return nil, ErrUnknownVideoMapFile
+	}
+
+	configs := make(map[string]map[string]*Configuration)
+	sg.PostDeserialize(!isLocal, &e, configs, manifest)
+	if e.HaveErrors() {
+		return nil, errors.New(e.String())
+	}
+
+	sm.scenarioGroups[sg.TRACON][sg.Name] = sg
+	if c, ok := configs[sg.TRACON][sg.Name]; ok && sm.configs[sg.TRACON] != nil {
+		sm.configs[sg.TRACON][sg.Name] = c
+	}
+
+	reports := make(map[string]sim.ReloadReport)
+	for name, as := range sm.activeSims {
+		if as.scenarioGroup != sg.Name || as.sim.TRACON() != sg.TRACON {
+			continue
+		}
+
+		psc, pok := prev.Scenarios[as.scenario]
+		sc, ok := sg.Scenarios[as.scenario]
+		if !pok || !ok {
+			reports[name] = sim.ReloadReport{RequiresRestart: []string{"scenario " + as.scenario + " removed"}}
+			continue
+		}
+
+		r := as.sim.ReloadScenario(scenarioSimConfiguration(prev, psc), scenarioSimConfiguration(sg, sc))
+		reports[name] = r
+		if r.Changed() {
+			as.sim.PostEvent(sim.Event{
+				Type:    sim.StatusMessageEvent,
+				Message: "Scenario reloaded. " + r.String(),
+			})
+		}
+	}
+
+	return reports, nil
+}
+
+func (sm *SimManager) postReloadMessage(msg string) {
+	sm.mu.Lock(sm.lg)
+	defer sm.mu.Unlock(sm.lg)
+
+	for _, as := range sm.activeSims {
+		as.sim.PostEvent(sim.Event{
+			Type:    sim.StatusMessageEvent,
+			Message: msg,
+		})
+	}
+}
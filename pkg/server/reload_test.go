@@ -0,0 +1,125 @@
+// pkg/server/reload_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// writeModifiedScenario writes a copy of the given scenario file from the
+// resources directory to a temporary file after letting modify change its
+// JSON. The path to the new file is returned.
+func writeModifiedScenario(t *testing.T, filename string, modify func(sg map[string]any)) string {
+	var sg map[string]any
+	if err := json.Unmarshal(util.LoadResourceBytes("scenarios/"+filename), &sg); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	modify(sg)
+
+	b, err := json.Marshal(sg)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	fn := filepath.Join(t.TempDir(), filename)
+	if err := os.WriteFile(fn, b, 0o600); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return fn
+}
+
+func TestReloadScenarioFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads a full scenario")
+	}
+
+	sg, manifest, configs := loadTestScenarioGroup(t, "jfk.json")
+	sm := &SimManager{
+		scenarioGroups: map[string]map[string]*ScenarioGroup{sg.TRACON: {sg.Name: sg}},
+		configs:        configs,
+		mapManifests:   map[string]*av.VideoMapManifest{sg.STARSFacilityAdaptation.VideoMapFile: manifest},
+		activeSims:     make(map[string]*ActiveSim),
+		lg:             &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))},
+	}
+	prevConfig := configs[sg.TRACON][sg.Name]
+	s := newTestSim(t, sg, manifest, 1, 0)
+	sm.activeSims["test"] = &ActiveSim{name: "test", scenarioGroup: sg.Name, scenario: sg.DefaultScenario, sim: s}
+
+	// Change the default scenario's wind, which can be applied to the
+	// running sim, and drop one of its virtual controllers, which can't.
+	fn := writeModifiedScenario(t, "jfk.json", func(g map[string]any) {
+		sc := g["scenarios"].(map[string]any)[g["default_scenario"].(string)].(map[string]any)
+		sc["wind"] = map[string]any{"direction": 310, "speed": 25}
+		ctrl := sc["controllers"].([]any)
+		sc["controllers"] = ctrl[:len(ctrl)-1]
+	})
+
+	// Meanwhile, the control API may be looking at the scenarios.
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				sm.controlScenarios()
+				if _, err := sm.controlScenario(&controlStartRequest{TRACON: sg.TRACON, Group: sg.Name}); err != nil {
+					t.Errorf("unexpected error %v", err)
+					return
+				}
+			}
+		}
+	}()
+
+	reports, err := sm.ReloadScenarioFile(fn, true)
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	r, ok := reports["test"]
+	if !ok {
+		t.Fatalf("no report for the running sim: %+v", reports)
+	}
+	if !slices.Contains(r.Applied, "updated wind") {
+		t.Errorf("applied %v; expected the wind to be updated", r.Applied)
+	}
+	if !slices.Contains(r.RequiresRestart, "virtual controllers") {
+		t.Errorf("requires restart %v; expected virtual controllers", r.RequiresRestart)
+	}
+
+	if w := s.State.Wind; w.Direction != 310 || w.Speed != 25 {
+		t.Errorf("sim wind %+v; expected 310@25", w)
+	}
+	nsg := sm.scenarioGroups[sg.TRACON][sg.Name]
+	if nsg == sg {
+		t.Errorf("scenario group wasn't replaced")
+	} else if w := nsg.Scenarios[sg.DefaultScenario].Wind; w.Direction != 310 || w.Speed != 25 {
+		t.Errorf("reloaded scenario wind %+v; expected 310@25", w)
+	}
+	if sm.configs[sg.TRACON][sg.Name] == prevConfig {
+		t.Errorf("launch configuration wasn't replaced")
+	}
+
+	// A scenario group that isn't loaded can't be reloaded.
+	fn = writeModifiedScenario(t, "jfk.json", func(g map[string]any) { g["name"] = "Elsewhere" })
+	if _, err := sm.ReloadScenarioFile(fn, true); err != ErrNoNamedScenarioGroup {
+		t.Errorf("got error %v, expected %v", err, ErrNoNamedScenarioGroup)
+	}
+}
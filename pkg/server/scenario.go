@@ -7,6 +7,7 @@ package server
 import (
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -45,6 +46,19 @@ type ScenarioGroup struct {
 	MagneticVariation       float32
 	MagneticAdjustment      float32                    `json:"magnetic_adjustment"`
 	STARSFacilityAdaptation av.STARSFacilityAdaptation `json:"stars_config"`
+
+	// Rubrics that controllers are scored against; if none are given,
+	// sim.DefaultRubrics are used.
+	ScoringRubrics []sim.Rubric `json:"scoring,omitempty"`
+	// Crossing restrictions from letters of agreement and SOPs.
+	LOAs []sim.LOA `json:"loas,omitempty"`
+	// Departures that need a release from the overlying facility.
+	APREQs []sim.APREQ `json:"apreqs,omitempty"`
+	// Runway configurations used together at nearby airports, for the
+	// runway advisor.
+	RunwayFlows []sim.RunwayFlow `json:"runway_flows,omitempty"`
+	// Number of positions kept in each aircraft's track history.
+	TrackHistoryDepth int `json:"track_history_depth,omitempty"`
 }
 
 type Scenario struct {
@@ -61,6 +75,11 @@ type Scenario struct {
 	ArrivalGroupDefaultRates map[string]map[string]int `json:"arrivals"`
 
 	Airspace map[string][]string `json:"airspace"`
+	// Alternative assignments of airspace volumes to positions, e.g. for
+	// a night configuration, and when they take effect; see
+	// sim/sectorization.go.
+	Sectorizations        map[string]sim.Sectorization `json:"sectorizations,omitempty"`
+	SectorizationSchedule []sim.ScheduledSectorization `json:"sectorization_schedule,omitempty"`
 
 	DepartureRunways []sim.DepartureRunway `json:"departure_runways,omitempty"`
 	ArrivalRunways   []sim.ArrivalRunway   `json:"arrival_runways,omitempty"`
@@ -70,6 +89,28 @@ type Scenario struct {
 	Range        float32       `json:"range"`
 	DefaultMaps  []string      `json:"default_maps"`
 	VFRRateScale *float32      `json:"vfr_rate_scale"`
+	// Year to age the airlines' fleets to, if given.
+	FleetYear int `json:"fleet_year,omitempty"`
+
+	PilotErrors *sim.PilotErrorConfig    `json:"pilot_errors,omitempty"`
+	Emergencies []sim.ScheduledEmergency `json:"emergencies,omitempty"`
+	NOTAMs      []sim.NOTAM              `json:"notams,omitempty"`
+
+	TrafficRestrictions []sim.TrafficRestriction `json:"traffic_restrictions,omitempty"`
+	// Scheduled banks of arrivals; see sim/pushes.go.
+	ArrivalPushes []sim.ArrivalPush `json:"arrival_pushes,omitempty"`
+	// Scripted convective weather, icing, and turbulence.
+	WeatherCells   []sim.WeatherCell   `json:"weather_cells,omitempty"`
+	WeatherHazards []sim.WeatherHazard `json:"weather_hazards,omitempty"`
+
+	// Starlark script with hooks for scenario logic; see sim/script.go.
+	// If it ends in ".star", it's the path to a file in the resources
+	// directory that holds the script.
+	Script string `json:"script,omitempty"`
+	// Guided steps if the scenario is a lesson; see sim/lesson.go.
+	Lesson *sim.Lesson `json:"lesson,omitempty"`
+
+	VirtualHandoffs sim.VirtualHandoffConfig `json:"virtual_handoffs,omitempty"`
 }
 
 func (s *Scenario) PostDeserialize(sg *ScenarioGroup, e *util.ErrorLogger, manifest *av.VideoMapManifest) {
@@ -99,24 +140,48 @@ func (s *Scenario) PostDeserialize(sg *ScenarioGroup, e *util.ErrorLogger, manif
 		e.Pop()
 	}
 
-	for ctrl, vnames := range s.Airspace {
-		e.Push("airspace")
-
-		found := ctrl == s.SoloController
-		// Check multi-controller
-		for _, config := range s.SplitConfigurations {
-			if _, ok := config[ctrl]; ok {
-				found = true
+	checkAirspace := func(airspace map[string][]string) {
+		for ctrl, vnames := range airspace {
+			found := ctrl == s.SoloController
+			// Check multi-controller
+			for _, config := range s.SplitConfigurations {
+				if _, ok := config[ctrl]; ok {
+					found = true
+				}
+			}
+			if !found {
+				e.ErrorString("Controller %q not used in in scenario", ctrl)
+			}
+			for _, vname := range vnames {
+				if _, ok := sg.Airspace.Volumes[vname]; !ok {
+					e.ErrorString("Airspace volume %q for controller %q not defined in scenario group \"airspace\"",
+						vname, ctrl)
+				}
 			}
 		}
-		if !found {
-			e.ErrorString("Controller %q not used in in scenario", ctrl)
+	}
+	e.Push("airspace")
+	checkAirspace(s.Airspace)
+	e.Pop()
+
+	for name, sect := range s.Sectorizations {
+		e.Push("\"sectorizations\": " + name)
+		if strings.EqualFold(name, sim.DefaultSectorization) {
+			e.ErrorString("%q is reserved for the scenario's \"airspace\"", sim.DefaultSectorization)
 		}
-		for _, vname := range vnames {
-			if _, ok := sg.Airspace.Volumes[vname]; !ok {
-				e.ErrorString("Airspace volume %q for controller %q not defined in scenario group \"airspace\"",
-					vname, ctrl)
-			}
+		if len(sect) == 0 {
+			e.ErrorString("no airspace assigned")
+		}
+		checkAirspace(sect)
+		e.Pop()
+	}
+	for _, ss := range s.SectorizationSchedule {
+		e.Push("\"sectorization_schedule\": " + ss.Sectorization)
+		if _, ok := s.Sectorizations[ss.Sectorization]; !ok && ss.Sectorization != sim.DefaultSectorization {
+			e.ErrorString("sectorization not defined in \"sectorizations\"")
+		}
+		if ss.AfterMinutes < 0 {
+			e.ErrorString("\"after_minutes\" must be non-negative")
 		}
 		e.Pop()
 	}
@@ -600,6 +665,127 @@ func (s *Scenario) PostDeserialize(sg *ScenarioGroup, e *util.ErrorLogger, manif
 		one := float32(1)
 		s.VFRRateScale = &one
 	}
+
+	if s.PilotErrors != nil {
+		if err := s.PilotErrors.Validate(); err != nil {
+			e.Push("\"pilot_errors\"")
+			e.Error(err)
+			e.Pop()
+		}
+	}
+
+	if s.FleetYear != 0 && (s.FleetYear < 1960 || s.FleetYear > 2100) {
+		e.ErrorString("\"fleet_year\" %d: must be between 1960 and 2100", s.FleetYear)
+	}
+
+	for _, em := range s.Emergencies {
+		if err := em.Validate(); err != nil {
+			e.Push("\"emergencies\"")
+			e.Error(err)
+			e.Pop()
+		}
+	}
+
+	for _, n := range s.NOTAMs {
+		e.Push("\"notams\"")
+		if err := n.Validate(); err != nil {
+			e.Error(err)
+		} else if ap, ok := sg.Airports[n.Airport]; n.Airport != "" && !ok {
+			e.ErrorString("%s: airport not found in scenario group \"airports\"", n.Airport)
+		} else {
+			switch n.Type {
+			case sim.NOTAMRunwayClosed:
+				if _, ok := av.LookupRunway(n.Airport, n.Subject); !ok {
+					e.ErrorString("%s: runway not found at %s", n.Subject, n.Airport)
+				}
+			case sim.NOTAMNavaidOutOfService:
+				if _, ok := av.DB.Navaids()[n.Subject]; !ok {
+					e.ErrorString("%s: navaid not found", n.Subject)
+				}
+			case sim.NOTAMApproachUnavailable:
+				if _, ok := ap.Approaches[n.Subject]; !ok {
+					e.ErrorString("%s: approach not found at %s", n.Subject, n.Airport)
+				}
+			}
+		}
+		e.Pop()
+	}
+
+	for _, r := range s.TrafficRestrictions {
+		if err := r.Validate(sg.Locate); err != nil {
+			e.Push("\"traffic_restrictions\"")
+			e.Error(err)
+			e.Pop()
+		}
+	}
+
+	for i, p := range s.ArrivalPushes {
+		e.Push("\"arrival_pushes\"")
+		if err := p.Validate(sg.Locate); err != nil {
+			e.Error(err)
+		}
+		for _, flow := range util.SortedMapKeys(p.Flows) {
+			if _, ok := s.InboundFlowDefaultRates[flow]; !ok {
+				e.ErrorString("%s: inbound flow %q not in \"inbound_rates\"", p.Name, flow)
+			}
+		}
+		for _, prev := range s.ArrivalPushes[:i] {
+			if p.StartMinutes < prev.EndMinutes && prev.StartMinutes < p.EndMinutes {
+				e.ErrorString("%s: overlaps %s", p.Name, prev.Name)
+			}
+		}
+		e.Pop()
+	}
+
+	for _, c := range s.WeatherCells {
+		if err := c.Validate(); err != nil {
+			e.Push("\"weather_cells\"")
+			e.Error(err)
+			e.Pop()
+		}
+	}
+	for _, h := range s.WeatherHazards {
+		if err := h.Validate(); err != nil {
+			e.Push("\"weather_hazards\"")
+			e.Error(err)
+			e.Pop()
+		}
+	}
+
+	if err := s.VirtualHandoffs.Validate(); err != nil {
+		e.Push("\"virtual_handoffs\"")
+		e.Error(err)
+		e.Pop()
+	}
+
+	if strings.HasSuffix(s.Script, ".star") {
+		if b, err := fs.ReadFile(util.GetResourcesFS(), s.Script); err != nil {
+			e.ErrorString("\"script\": %v", err)
+		} else {
+			s.Script = string(b)
+		}
+	}
+	if s.Script != "" {
+		if err := sim.CompileScript(s.Script); err != nil {
+			e.Push("\"script\"")
+			e.Error(err)
+			e.Pop()
+		}
+	}
+
+	if s.Lesson != nil {
+		if err := s.Lesson.Validate(); err != nil {
+			e.Push("\"lesson\"")
+			e.Error(err)
+			e.Pop()
+		}
+	}
+}
+
+// runwayClosed returns whether one of the scenario's NOTAMs closes the
+// runway.
+func (s *Scenario) runwayClosed(airport, rwy string) bool {
+	return slices.ContainsFunc(s.NOTAMs, func(n sim.NOTAM) bool { return n.ClosesRunway(airport, rwy) })
 }
 
 ///////////////////////////////////////////////////////////////////////////
@@ -610,11 +796,11 @@ func (sg *ScenarioGroup) Locate(s string) (math.Point2LL, bool) {
 	// ScenarioGroup's definitions take precedence...
 	if p, ok := sg.Fixes[s]; ok {
 		return p, true
-	} else if n, ok := av.DB.Navaids[strings.ToUpper(s)]; ok {
+	} else if n, ok := av.DB.Navaids()[strings.ToUpper(s)]; ok {
 		return n.Location, ok
-	} else if ap, ok := av.DB.Airports[strings.ToUpper(s)]; ok {
+	} else if ap, ok := av.DB.Airports()[strings.ToUpper(s)]; ok {
 		return ap.Location, ok
-	} else if f, ok := av.DB.Fixes[strings.ToUpper(s)]; ok {
+	} else if f, ok := av.DB.Fixes()[strings.ToUpper(s)]; ok {
 		return f.Location, ok
 	} else if p, err := math.ParseLatLong([]byte(s)); err == nil {
 		return p, true
@@ -740,7 +926,7 @@ func (sg *ScenarioGroup) PostDeserialize(multiController bool, e *util.ErrorLogg
 
 	if sg.PrimaryAirport == "" {
 		e.ErrorString("\"primary_airport\" not specified")
-	} else if ap, ok := av.DB.Airports[sg.PrimaryAirport]; !ok {
+	} else if ap, ok := av.DB.Airports()[sg.PrimaryAirport]; !ok {
 		e.ErrorString("\"primary_airport\" %q unknown", sg.PrimaryAirport)
 	} else if mvar, err := av.DB.MagneticGrid.Lookup(ap.Location); err != nil {
 		e.ErrorString("%s: unable to find magnetic declination: %v", sg.PrimaryAirport, err)
@@ -811,9 +997,17 @@ func (sg *ScenarioGroup) PostDeserialize(multiController bool, e *util.ErrorLogg
 		e.Pop()
 	}
 
+	// Boundary fix flows get their altitudes from the coordination fixes;
+	// the scenario's take precedence over the ARTCC's.
+	adapted := maps.Clone(av.DB.ERAMAdaptations[av.DB.TRACONs[sg.TRACON].ARTCC].CoordinationFixes)
+	if adapted == nil {
+		adapted = make(map[string]av.AdaptationFixes)
+	}
+	maps.Copy(adapted, sg.STARSFacilityAdaptation.CoordinationFixes)
+
 	for name, flow := range sg.InboundFlows {
 		e.Push("Inbound flow " + name)
-		if len(flow.Arrivals) == 0 && len(flow.Overflights) == 0 {
+		if len(flow.Arrivals) == 0 && len(flow.Overflights) == 0 && len(flow.BoundaryFixFlows) == 0 {
 			e.ErrorString("no arrivals or overflights in inbound flow group")
 		}
 
@@ -826,6 +1020,13 @@ func (sg *ScenarioGroup) PostDeserialize(multiController bool, e *util.ErrorLogg
 				sg.Airports, sg.ControlPositions, e)
 		}
 
+		for i, bf := range flow.BoundaryFixFlows {
+			e.Push(fmt.Sprintf("\"boundary_fix_flows\" %d", i))
+			flow.Overflights = append(flow.Overflights, bf.Overflights(sg, sg.NmPerLongitude,
+				sg.MagneticVariation, adapted, sg.Airports, sg.ControlPositions, e)...)
+			e.Pop()
+		}
+
 		e.Pop()
 	}
 
@@ -837,6 +1038,42 @@ func (sg *ScenarioGroup) PostDeserialize(multiController bool, e *util.ErrorLogg
 		}
 	}
 
+	for _, r := range sg.ScoringRubrics {
+		if err := r.Validate(sg.Locate); err != nil {
+			e.Push("\"scoring\"")
+			e.Error(err)
+			e.Pop()
+		}
+	}
+
+	for _, l := range sg.LOAs {
+		if err := l.Validate(sg.Locate); err != nil {
+			e.Push("\"loas\"")
+			e.Error(err)
+			e.Pop()
+		}
+	}
+
+	for _, a := range sg.APREQs {
+		if err := a.Validate(); err != nil {
+			e.Push("\"apreqs\"")
+			e.Error(err)
+			e.Pop()
+		}
+	}
+
+	for _, f := range sg.RunwayFlows {
+		if err := f.Validate(); err != nil {
+			e.Push("\"runway_flows\"")
+			e.Error(err)
+			e.Pop()
+		}
+	}
+
+	if sg.TrackHistoryDepth < 0 || sg.TrackHistoryDepth > sim.MaxTrackHistoryDepth {
+		e.ErrorString("\"track_history_depth\" must be between 0 and %d", sim.MaxTrackHistoryDepth)
+	}
+
 	// Do after airports!
 	if len(sg.Scenarios) == 0 {
 		e.ErrorString("No \"scenarios\" specified")
@@ -892,6 +1129,14 @@ func (sg *ScenarioGroup) rewriteControllers(e *util.ErrorLogger) {
 			}
 			s.Airspace = a
 		}
+		for name, sect := range s.Sectorizations {
+			a := make(sim.Sectorization)
+			for ctrl, vols := range sect {
+				rewrite(&ctrl)
+				a[ctrl] = vols
+			}
+			s.Sectorizations[name] = a
+		}
 
 		for _, rwy := range s.DepartureRunways {
 			if ap, ok := sg.Airports[rwy.Airport]; ok {
@@ -962,6 +1207,9 @@ func (sg *ScenarioGroup) rewriteControllers(e *util.ErrorLogger) {
 			rewrite(&flow.Overflights[i].InitialController)
 			rewriteWaypoints(flow.Overflights[i].Waypoints)
 		}
+		for i := range flow.BoundaryFixFlows {
+			rewrite(&flow.BoundaryFixFlows[i].InitialController)
+		}
 	}
 
 	sg.ControlPositions = pos
@@ -1069,6 +1317,17 @@ func PostDeserializeSTARSFacilityAdaptation(s *av.STARSFacilityAdaptation, e *ut
 		if rs.Elevation == 0 {
 			e.ErrorString("radar site is missing \"elevation\"")
 		}
+		if rs.RotationRate < 0 {
+			e.ErrorString("\"rotation_rate\" must be positive")
+		}
+		for i, sh := range rs.TerrainShadows {
+			if sh.Altitude <= rs.Elevation {
+				e.ErrorString("terrain shadow %d: \"altitude\" must be above the site's elevation", i)
+			}
+			if sh.Bearings[0] < 0 || sh.Bearings[0] > 360 || sh.Bearings[1] < 0 || sh.Bearings[1] > 360 {
+				e.ErrorString("terrain shadow %d: \"bearings\" must be between 0 and 360", i)
+			}
+		}
 		e.Pop()
 	}
 
@@ -1372,6 +1631,46 @@ func PostDeserializeSTARSFacilityAdaptation(s *av.STARSFacilityAdaptation, e *ut
 	}
 	e.Pop()
 
+	e.Push("\"leader_directions\"")
+	for i := range s.LeaderDirections.Areas {
+		area := &s.LeaderDirections.Areas[i]
+		e.Push(area.Name)
+		if area.Name == "" {
+			e.ErrorString("\"name\" must be specified for leader direction area.")
+		}
+		if len(area.Vertices) < 3 {
+			e.ErrorString("At least 3 \"vertices\" must be given for leader direction area.")
+		}
+		if area.Ceiling != 0 && area.Floor > area.Ceiling {
+			e.ErrorString("\"floor\" %d is above \"ceiling\" %d", area.Floor, area.Ceiling)
+		}
+		var err error
+		if area.Direction, err = math.ParseCardinalOrdinalDirection(area.DirectionString); err != nil {
+			e.ErrorString("%q: invalid \"direction\"", area.DirectionString)
+		}
+		e.Pop()
+	}
+	if len(s.LeaderDirections.QuadrantStrings) > 0 {
+		s.LeaderDirections.Quadrants = make(map[math.CardinalOrdinalDirection]math.CardinalOrdinalDirection)
+	}
+	for quad, dir := range s.LeaderDirections.QuadrantStrings {
+		q, err := math.ParseCardinalOrdinalDirection(quad)
+		if err != nil || (q != math.NorthEast && q != math.SouthEast && q != math.SouthWest && q != math.NorthWest) {
+			e.ErrorString("%q: quadrant must be one of \"NE\", \"SE\", \"SW\", or \"NW\"", quad)
+			continue
+		}
+		if s.LeaderDirections.Quadrants[q], err = math.ParseCardinalOrdinalDirection(dir); err != nil {
+			e.ErrorString("%q: invalid direction for quadrant %q", dir, quad)
+		}
+	}
+	e.Pop()
+
+	if s.FDBTemplate != nil {
+		if err := s.FDBTemplate.Parse(); err != nil {
+			e.ErrorString("\"fdb_template\": %v", err)
+		}
+	}
+
 	e.Pop() // stars_config
 }
 
@@ -1383,24 +1682,30 @@ func initializeSimConfigurations(sg *ScenarioGroup,
 		DefaultScenario:  sg.DefaultScenario,
 	}
 
-	vfrAirports := make(map[string]*av.Airport)
-	for name, ap := range sg.Airports {
-		if ap.VFRRateSum() > 0 {
-			vfrAirports[name] = ap
-		}
-	}
 	for name, scenario := range sg.Scenarios {
-		lc := sim.MakeLaunchConfig(scenario.DepartureRunways, *scenario.VFRRateScale, vfrAirports,
-			scenario.InboundFlowDefaultRates)
 		sc := &SimScenarioConfiguration{
 			SplitConfigurations: scenario.SplitConfigurations,
-			LaunchConfig:        lc,
+			LaunchConfig:        sg.defaultLaunchConfig(scenario),
 			Wind:                scenario.Wind,
-			DepartureRunways:    scenario.DepartureRunways,
-			ArrivalRunways:      scenario.ArrivalRunways,
 			PrimaryAirport:      sg.PrimaryAirport,
 		}
 
+		// Runways that are closed by the scenario's NOTAMs aren't offered;
+		// the sim restores them if the NOTAM is cancelled.
+		sc.DepartureRunways = util.FilterSlice(scenario.DepartureRunways, func(r sim.DepartureRunway) bool {
+			return !scenario.runwayClosed(r.Airport, r.Runway)
+		})
+		sc.ArrivalRunways = util.FilterSlice(scenario.ArrivalRunways, func(r sim.ArrivalRunway) bool {
+			return !scenario.runwayClosed(r.Airport, r.Runway)
+		})
+		for ap, rates := range sc.LaunchConfig.DepartureRates {
+			for rwy := range rates {
+				if scenario.runwayClosed(ap, rwy) {
+					delete(rates, rwy)
+				}
+			}
+		}
+
 		if multiController {
 			if len(scenario.SplitConfigurations) == 0 {
 				// not a multi-controller scenario
@@ -1440,6 +1745,23 @@ func initializeSimConfigurations(sg *ScenarioGroup,
 	}
 }
 
+// defaultLaunchConfig returns the scenario's launch configuration with
+// the default rates specified in the scenario group.
+func (sg *ScenarioGroup) defaultLaunchConfig(s *Scenario) sim.LaunchConfig {
+	vfrAirports := make(map[string]*av.Airport)
+	for name, ap := range sg.Airports {
+		if ap.VFRRateSum() > 0 {
+			vfrAirports[name] = ap
+		}
+	}
+	lc := sim.MakeLaunchConfig(s.DepartureRunways, *s.VFRRateScale, vfrAirports, s.InboundFlowDefaultRates)
+	if s.PilotErrors != nil {
+		lc.PilotErrors = *s.PilotErrors
+	}
+	lc.FleetYear = s.FleetYear
+	return lc
+}
+
 ///////////////////////////////////////////////////////////////////////////
 // LoadScenarioGroups
 
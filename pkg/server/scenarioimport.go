@@ -0,0 +1,254 @@
+// pkg/server/scenarioimport.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// The types here mirror the parts of the scenario group JSON that traffic
+// imported from other sims is written to; as with sector files, the
+// result is a starting point for a scenario group rather than a complete
+// one.
+
+type importedTrafficGroup struct {
+	TRACON       string                           `json:"tracon"`
+	Name         string                           `json:"name"`
+	Fixes        map[string]string                `json:"fixes,omitempty"`
+	Airports     map[string]*importedAirport      `json:"airports"`
+	InboundFlows map[string]*importedInboundFlow  `json:"inbound_flows,omitempty"`
+	Scenarios    map[string]*importedScenarioDefs `json:"scenarios"`
+}
+
+type importedAirport struct {
+	Departures      []importedDeparture                      `json:"departures,omitempty"`
+	DepartureRoutes map[string]map[string]*importedExitRoute `json:"departure_routes,omitempty"`
+	VFR             *importedVFR                             `json:"vfr,omitempty"`
+}
+
+type importedDeparture struct {
+	Exit        string                `json:"exit"`
+	Destination string                `json:"destination"`
+	Altitude    int                   `json:"altitude,omitempty"`
+	Route       string                `json:"route"`
+	Airlines    []av.DepartureAirline `json:"airlines"`
+}
+
+type importedExitRoute struct {
+	SID       string `json:"sid"`
+	Waypoints string `json:"waypoints"`
+}
+
+type importedVFR struct {
+	Routes []importedVFRRoute `json:"routes"`
+}
+
+type importedVFRRoute struct {
+	Name        string `json:"name"`
+	Rate        int    `json:"rate"`
+	Fleet       string `json:"fleet"`
+	Waypoints   string `json:"waypoints"`
+	Destination string `json:"destination"`
+}
+
+type importedInboundFlow struct {
+	Arrivals    []importedArrival    `json:"arrivals,omitempty"`
+	Overflights []importedOverflight `json:"overflights,omitempty"`
+}
+
+type importedArrival struct {
+	Waypoints       string                         `json:"waypoints"`
+	STAR            string                         `json:"star,omitempty"`
+	Route           string                         `json:"route"`
+	InitialAltitude int                            `json:"initial_altitude"`
+	InitialSpeed    int                            `json:"initial_speed"`
+	Airlines        map[string][]av.ArrivalAirline `json:"airlines"`
+}
+
+type importedOverflight struct {
+	Waypoints       string                 `json:"waypoints"`
+	InitialAltitude int                    `json:"initial_altitude"`
+	InitialSpeed    int                    `json:"initial_speed"`
+	Airlines        []av.OverflightAirline `json:"airlines"`
+}
+
+type importedScenarioDefs struct {
+	DepartureRunways []importedDepartureRunway `json:"departure_runways,omitempty"`
+	InboundRates     map[string]map[string]int `json:"inbound_rates,omitempty"`
+}
+
+type importedDepartureRunway struct {
+	Airport string `json:"airport"`
+	Runway  string `json:"runway"`
+	Rate    int    `json:"rate"`
+}
+
+// ImportScenario converts an openScope airport JSON file or a Euroscope
+// scenario .txt file to a skeleton scenario group JSON file with its
+// traffic, which is written to the current directory using the file's
+// base name.
+func ImportScenario(filename string, e *util.ErrorLogger) {
+	defer e.CheckDepth(e.CurrentDepth())
+	e.Push(filename)
+	defer e.Pop()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		e.Error(err)
+		return
+	}
+	defer f.Close()
+
+	var parse func(io.Reader, *util.ErrorLogger) (*av.ImportedTraffic, error)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		parse = av.ParseOpenScopeAirport
+	case ".txt":
+		parse = av.ParseEuroscopeScenario
+	default:
+		e.ErrorString("expected an openScope .json or Euroscope .txt file")
+		return
+	}
+	it, err := parse(f, e)
+	if err != nil {
+		e.Error(err)
+		return
+	}
+
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	b, err := json.MarshalIndent(makeImportedTrafficGroup(base, it), "", "    ")
+	if err != nil {
+		e.Error(err)
+		return
+	}
+	if err := os.WriteFile(base+".json", b, 0o644); err != nil {
+		e.Error(err)
+	}
+}
+
+func makeImportedTrafficGroup(base string, it *av.ImportedTraffic) importedTrafficGroup {
+	sg := importedTrafficGroup{
+		TRACON:       base,
+		Name:         util.Select(it.Name != "", it.Name, base),
+		Fixes:        make(map[string]string),
+		Airports:     make(map[string]*importedAirport),
+		InboundFlows: make(map[string]*importedInboundFlow),
+	}
+	scenario := &importedScenarioDefs{InboundRates: make(map[string]map[string]int)}
+	sg.Scenarios = map[string]*importedScenarioDefs{base: scenario}
+
+	for name, p := range it.Fixes {
+		sg.Fixes[name] = p.DMSString()
+	}
+	airport := func(ap string) *importedAirport {
+		if sg.Airports[ap] == nil {
+			sg.Airports[ap] = &importedAirport{}
+		}
+		return sg.Airports[ap]
+	}
+
+	for _, ap := range util.SortedMapKeys(it.Departures) {
+		iap := airport(ap)
+		rates := make(map[string]int)
+		for _, dep := range it.Departures[ap] {
+			iap.Departures = append(iap.Departures, importedDeparture{
+				Exit:        dep.Exit,
+				Destination: dep.Destination,
+				Altitude:    dep.Altitude,
+				Route:       dep.Route,
+				Airlines: util.MapSlice(dep.Airlines, func(al av.AirlineSpecifier) av.DepartureAirline {
+					return av.DepartureAirline{AirlineSpecifier: al}
+				}),
+			})
+			if dep.Runway == "" {
+				continue
+			}
+			if iap.DepartureRoutes == nil {
+				iap.DepartureRoutes = make(map[string]map[string]*importedExitRoute)
+			}
+			if iap.DepartureRoutes[dep.Runway] == nil {
+				iap.DepartureRoutes[dep.Runway] = make(map[string]*importedExitRoute)
+			}
+			iap.DepartureRoutes[dep.Runway][dep.Exit] = &importedExitRoute{SID: dep.SID, Waypoints: dep.Exit}
+			rates[dep.Runway] += dep.Rate
+		}
+		for _, rwy := range util.SortedMapKeys(rates) {
+			scenario.DepartureRunways = append(scenario.DepartureRunways, importedDepartureRunway{
+				Airport: ap,
+				Runway:  rwy,
+				Rate:    rates[rwy],
+			})
+		}
+	}
+
+	for _, ap := range util.SortedMapKeys(it.VFRRoutes) {
+		iap := airport(ap)
+		iap.VFR = &importedVFR{}
+		for _, r := range it.VFRRoutes[ap] {
+			iap.VFR.Routes = append(iap.VFR.Routes, importedVFRRoute{
+				Name:        r.Name,
+				Rate:        1,
+				Fleet:       "default",
+				Waypoints:   r.Waypoints,
+				Destination: r.Destination,
+			})
+		}
+	}
+
+	// Inbound flows are named after the STAR if there is one and
+	// otherwise the first fix.
+	for _, arr := range it.Arrivals {
+		name := arr.STAR
+		if name == "" {
+			name, _, _ = strings.Cut(arr.Waypoints, " ")
+		}
+		flow := sg.InboundFlows[name]
+		if flow == nil {
+			flow = &importedInboundFlow{}
+			sg.InboundFlows[name] = flow
+			scenario.InboundRates[name] = make(map[string]int)
+		}
+
+		if arr.Airport == "" {
+			flow.Overflights = append(flow.Overflights, importedOverflight{
+				Waypoints:       arr.Waypoints,
+				InitialAltitude: arr.InitialAltitude,
+				InitialSpeed:    arr.InitialSpeed,
+				Airlines: util.MapSlice(arr.Airlines, func(al av.AirlineSpecifier) av.OverflightAirline {
+					return av.OverflightAirline{AirlineSpecifier: al, DepartureAirport: arr.Origin}
+				}),
+			})
+			scenario.InboundRates[name]["overflights"] += max(arr.Rate, 1)
+		} else {
+			airport(arr.Airport)
+			flow.Arrivals = append(flow.Arrivals, importedArrival{
+				Waypoints:       arr.Waypoints,
+				STAR:            arr.STAR,
+				Route:           arr.Route,
+				InitialAltitude: arr.InitialAltitude,
+				InitialSpeed:    arr.InitialSpeed,
+				Airlines: map[string][]av.ArrivalAirline{
+					arr.Airport: util.MapSlice(arr.Airlines, func(al av.AirlineSpecifier) av.ArrivalAirline {
+						return av.ArrivalAirline{AirlineSpecifier: al, Airport: arr.Origin}
+					}),
+				},
+			})
+			scenario.InboundRates[name][arr.Airport] += max(arr.Rate, 1)
+		}
+	}
+
+	for _, ap := range it.Airports {
+		airport(ap)
+	}
+
+	return sg
+}
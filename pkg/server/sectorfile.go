@@ -0,0 +1,102 @@
+// pkg/server/sectorfile.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// importedScenarioGroup is the subset of the scenario group JSON that can
+// be derived from a sector file; it's a starting point for a new
+// facility, not a complete scenario group.
+type importedScenarioGroup struct {
+	TRACON           string                    `json:"tracon"`
+	Name             string                    `json:"name"`
+	Fixes            map[string]string         `json:"fixes"`
+	ControlPositions map[string]*av.Controller `json:"control_positions"`
+	STARSConfig      struct {
+		VideoMapNames []string `json:"stars_maps"`
+		Center        string   `json:"center"`
+		Range         float32  `json:"range"`
+		VideoMapFile  string   `json:"video_map_file"`
+	} `json:"stars_config"`
+}
+
+// ImportSectorFile converts a VRC/Euroscope .sct2 file (and the .ese file
+// next to it, if there is one) into a video map file and a skeleton
+// scenario group JSON file, which are written to the current directory
+// using the sector file's base name.
+func ImportSectorFile(filename string, e *util.ErrorLogger) {
+	defer e.CheckDepth(e.CurrentDepth())
+	e.Push(filename)
+	defer e.Pop()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		e.Error(err)
+		return
+	}
+	defer f.Close()
+
+	sf, err := av.ParseSectorFile(f, e)
+	if err != nil {
+		e.Error(err)
+		return
+	}
+
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	ese := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".ese"
+	if ef, err := os.Open(ese); err == nil {
+		err = sf.ParseESE(ef, e)
+		ef.Close()
+		if err != nil {
+			e.Error(err)
+			return
+		}
+	}
+
+	maps := sf.VideoMaps()
+	if err := av.WriteVideoMapLibrary(av.VideoMapLibrary{Maps: maps}, base); err != nil {
+		e.Error(err)
+		return
+	}
+
+	sg := importedScenarioGroup{
+		TRACON:           base,
+		Name:             util.Select(sf.Name != "", sf.Name, base),
+		Fixes:            make(map[string]string),
+		ControlPositions: sf.Positions,
+	}
+	for name, p := range sf.Fixes {
+		sg.Fixes[name] = p.DMSString()
+	}
+	for _, m := range maps {
+		sg.STARSConfig.VideoMapNames = append(sg.STARSConfig.VideoMapNames, m.Name)
+	}
+	center := sf.Center
+	if center.IsZero() {
+		if p, ok := sf.Fixes[sf.DefaultAirport]; ok {
+			center = p
+		}
+	}
+	sg.STARSConfig.Center = center.DMSString()
+	sg.STARSConfig.Range = 50
+	sg.STARSConfig.VideoMapFile = base + "-videomaps.gob.zst"
+
+	b, err := json.MarshalIndent(sg, "", "    ")
+	if err != nil {
+		e.Error(err)
+		return
+	}
+	if err := os.WriteFile(base+".json", b, 0o644); err != nil {
+		e.Error(err)
+	}
+}
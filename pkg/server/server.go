@@ -18,9 +18,14 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/mmp/vice/pkg/adsb"
 	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/federation"
+	"github.com/mmp/vice/pkg/fsd"
 	"github.com/mmp/vice/pkg/log"
 	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/stream"
+	"github.com/mmp/vice/pkg/swim"
 	"github.com/mmp/vice/pkg/util"
 
 	"github.com/shirou/gopsutil/cpu"
@@ -28,7 +33,7 @@ import (
 
 const ViceServerAddress = "vice.pharr.org"
 const ViceServerPort = 8000 + ViceRPCVersion
-const ViceRPCVersion = 24
+const ViceRPCVersion = 29
 
 type Server struct {
 	*util.RPCClient
@@ -60,6 +65,33 @@ type NewSimConfiguration struct {
 
 	InstructorAllowed bool
 	Instructor        bool
+	PseudoPilot       bool
+
+	// Deterministic sims give the same traffic for the same scenario,
+	// seed, and controller commands.
+	Deterministic bool
+	Seed          uint64
+
+	// Local sims may connect to an FSD network as a controller.
+	ConnectNetwork bool
+	Network        fsd.Config
+
+	// Local sims may also add live traffic from an ADS-B receiver.
+	ConnectADSB bool
+	ADSB        adsb.Config
+
+	// Local sims may export their flight data for external tools.
+	ExportFlightData bool
+	Export           swim.Config
+
+	// Local sims may serve live data to browser overlays.
+	StreamData bool
+	Stream     stream.Config
+
+	// Local sims may be federated with another sim that handles adjacent
+	// facilities.
+	Federate   bool
+	Federation federation.Config
 }
 
 const (
@@ -221,6 +253,10 @@ func runServer(l net.Listener, isLocal bool, extraScenario string, extraVideoMap
 
 		go launchHTTPStats(sm)
 
+		if extraScenario != "" {
+			go sm.WatchScenarioFile(extraScenario, isLocal)
+		}
+
 		ch <- simConfigurations
 
 		lg.Infof("Listening on %+v", l)
@@ -270,6 +306,8 @@ func launchHTTPStats(sm *SimManager) {
 		}
 	})
 
+	launchControlAPI(sm)
+
 	if err := http.ListenAndServe(":6502", nil); err != nil {
 		sm.lg.Errorf("Failed to start HTTP server for stats: %v\n", err)
 	}
@@ -0,0 +1,244 @@
+// pkg/server/validate.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// ValidationReport summarizes the results of validating a scenario file.
+// Errors are problems that will prevent the scenario from loading or
+// from running correctly; warnings are things that are likely mistakes
+// but that don't prevent it from running.
+type ValidationReport struct {
+	Filename string   `json:"filename"`
+	TRACON   string   `json:"tracon,omitempty"`
+	Group    string   `json:"group,omitempty"`
+	ARTCC    string   `json:"artcc,omitempty"`
+	Airports []string `json:"airports,omitempty"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+func (r ValidationReport) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// Write writes the report to the given writer as JSON.
+func (r ValidationReport) Write(w io.Writer) error {
+	// Always emit arrays, even if empty, for the benefit of tools that
+	// consume the report.
+	r.Errors = util.Select(r.Errors == nil, []string{}, r.Errors)
+	r.Warnings = util.Select(r.Warnings == nil, []string{}, r.Warnings)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// ValidateScenario loads the given scenario file along with everything
+// that it references--airports, routes, the ERAM and STARS adaptations,
+// and video maps--and runs both the standard checks done when scenarios
+// are loaded and a number of additional, more expensive ones.
+func ValidateScenario(filename, videoMapFilename string, lg *log.Logger) ValidationReport {
+	report := ValidationReport{Filename: filename}
+	var e, w util.ErrorLogger
+
+	// Load it on its own first so that we know which scenario group it
+	// is once everything has been loaded.
+	var fsys fs.FS = os.DirFS(".")
+	if filepath.IsAbs(filename) {
+		fsys = util.RootFS{}
+	}
+	sg := loadScenarioGroup(fsys, filename, &e)
+	if sg == nil {
+		report.Errors = e.Errors()
+		return report
+	}
+	report.TRACON, report.Group = sg.TRACON, sg.Name
+
+	// Otherwise the STARs and approaches are parsed as they're needed;
+	// here we'll check everything, so parse them up front, in parallel.
+	if tracon, ok := av.DB.TRACONs[sg.TRACON]; ok {
+		av.DB.LoadProcedures(append(av.DB.AdjacentARTCCs(tracon.ARTCC), tracon.ARTCC)...)
+	}
+
+	scenarioGroups, _, _ := LoadScenarioGroups(true, filename, videoMapFilename, &e, lg)
+	if sg = scenarioGroups[report.TRACON][report.Group]; sg == nil {
+		if !e.HaveErrors() {
+			e.ErrorString("%s: scenario group %q not found after loading", filename, report.Group)
+		}
+		report.Errors = e.Errors()
+		return report
+	}
+
+	if vm := sg.STARSFacilityAdaptation.VideoMapFile; vm != "" {
+		av.CheckVideoMapManifest(vm, &e)
+	}
+
+	report.Airports = util.SortedMapKeys(sg.Airports)
+	if tracon, ok := av.DB.TRACONs[sg.TRACON]; !ok {
+		e.ErrorString("TRACON %q is unknown", sg.TRACON)
+	} else {
+		report.ARTCC = tracon.ARTCC
+		validateCoordinationFixes(sg, tracon.ARTCC, &e)
+		validateBeaconBank(sg, tracon.ARTCC, scenarioGroups, &e)
+	}
+	validateDepartureReachability(sg, &e, &w)
+
+	report.Errors, report.Warnings = e.Errors(), w.Errors()
+	return report
+}
+
+// validateCoordinationFixes makes sure that all of the coordination fixes
+// in the ERAM adaptation for the scenario's ARTCC can be located and refer
+// to known facilities.
+func validateCoordinationFixes(sg *ScenarioGroup, artcc string, e *util.ErrorLogger) {
+	e.Push("ERAM adaptation " + artcc)
+	defer e.Pop()
+
+	adapt, ok := av.DB.ERAMAdaptations[artcc]
+	if !ok {
+		e.ErrorString("no ERAM adaptation found")
+		return
+	}
+
+	knownFacility := func(f string) bool {
+		_, tok := av.DB.TRACONs[f]
+		_, aok := av.DB.ARTCCs[f]
+		return tok || aok
+	}
+
+	for _, fix := range util.SortedMapKeys(adapt.CoordinationFixes) {
+		e.Push("Coordination fix " + fix)
+
+		if _, ok := sg.Locate(fix); !ok {
+			e.ErrorString("unable to locate fix")
+		}
+		for _, af := range adapt.CoordinationFixes[fix] {
+			if af.Type != av.RouteBasedFix && af.Type != av.ZoneBasedFix {
+				e.ErrorString("%q: invalid type; must be %q or %q", af.Type, av.RouteBasedFix, av.ZoneBasedFix)
+			}
+			if !knownFacility(af.ToFacility) {
+				e.ErrorString("\"to\" facility %q is unknown", af.ToFacility)
+			}
+			if !knownFacility(af.FromFacility) {
+				e.ErrorString("\"from\" facility %q is unknown", af.FromFacility)
+			}
+			if af.Altitude[0] > af.Altitude[1] {
+				e.ErrorString("altitude range %d-%d is invalid", af.Altitude[0], af.Altitude[1])
+			}
+		}
+
+		e.Pop()
+	}
+}
+
+// validateBeaconBank checks that the scenario group's STARS beacon bank is
+// valid and that it doesn't overlap with the bank used by another TRACON
+// in the same ARTCC; all of the TRACONs under an ARTCC share its ERAM
+// computer, so overlapping banks lead to duplicate code assignments.
+func validateBeaconBank(sg *ScenarioGroup, artcc string, scenarioGroups map[string]map[string]*ScenarioGroup,
+	e *util.ErrorLogger) {
+	e.Push("STARS adaptation")
+	defer e.Pop()
+
+	bank := sg.STARSFacilityAdaptation.BeaconBank
+	if bank < 0 || bank*0o100+0o77 > 0o7777 {
+		e.ErrorString("beacon bank %d is invalid", bank)
+		return
+	}
+	if bank == 0 {
+		return
+	}
+
+	for _, tracon := range util.SortedMapKeys(scenarioGroups) {
+		if tracon == sg.TRACON || av.DB.TRACONs[tracon].ARTCC != artcc {
+			continue
+		}
+		for _, name := range util.SortedMapKeys(scenarioGroups[tracon]) {
+			if scenarioGroups[tracon][name].STARSFacilityAdaptation.BeaconBank == bank {
+				e.ErrorString("beacon bank %d is also used by %s scenario group %q", bank, tracon, name)
+			}
+		}
+	}
+}
+
+// validateDepartureReachability checks that each active departure runway
+// in each scenario can launch at least one departure and warns about
+// departures whose exits aren't reachable from any of the scenario's
+// active runways, since they will never be launched.
+func validateDepartureReachability(sg *ScenarioGroup, e, w *util.ErrorLogger) {
+	for _, name := range util.SortedMapKeys(sg.Scenarios) {
+		s := sg.Scenarios[name]
+		e.Push("Scenario " + name)
+		w.Push("Scenario " + name)
+
+		reachable := make(map[string]map[string]bool) // airport -> exit -> reachable
+		for _, rwy := range s.DepartureRunways {
+			ap, ok := sg.Airports[rwy.Airport]
+			if !ok {
+				// Already reported by PostDeserialize
+				continue
+			}
+
+			if reachable[rwy.Airport] == nil {
+				reachable[rwy.Airport] = make(map[string]bool)
+			}
+
+			n := 0
+			for _, dep := range ap.Departures {
+				_, ok := rwy.ExitRoutes[dep.Exit]
+				if ok && (rwy.Category == "" || rwy.Category == ap.ExitCategories[dep.Exit]) {
+					reachable[rwy.Airport][dep.Exit] = true
+					n++
+				}
+			}
+			if n == 0 {
+				e.ErrorString("%s runway %s: no departures can be launched", rwy.Airport, rwy.Runway)
+			}
+		}
+
+		for _, icao := range util.SortedMapKeys(reachable) {
+			var unreachable []string
+			for _, dep := range sg.Airports[icao].Departures {
+				if !reachable[icao][dep.Exit] && !slices.Contains(unreachable, dep.Exit) {
+					unreachable = append(unreachable, dep.Exit)
+				}
+			}
+			if len(unreachable) > 0 {
+				slices.Sort(unreachable)
+				w.ErrorString("%s: departures to exits %v are not reachable from any active runway",
+					icao, unreachable)
+			}
+		}
+
+		w.Pop()
+		e.Pop()
+	}
+}
+
+// PrintValidationReport writes a human-readable summary of the report to
+// the given writer.
+func PrintValidationReport(w io.Writer, r ValidationReport) {
+	fmt.Fprintf(w, "%s: %s / %s (%s)\n", r.Filename, r.TRACON, r.Group, r.ARTCC)
+	for _, err := range r.Errors {
+		fmt.Fprintf(w, "error: %s\n", err)
+	}
+	for _, warn := range r.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", warn)
+	}
+	fmt.Fprintf(w, "%d errors, %d warnings\n", len(r.Errors), len(r.Warnings))
+}
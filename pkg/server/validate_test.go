@@ -0,0 +1,172 @@
+// pkg/server/validate_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package server
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// checkValidationErrors reports a test failure if the errors logged to e
+// don't include the expected one, or, if expected is empty, if there were
+// any errors.
+func checkValidationErrors(t *testing.T, name string, e *util.ErrorLogger, expected string) {
+	t.Helper()
+	if expected == "" {
+		if e.HaveErrors() {
+			t.Errorf("%s: unexpected errors %s", name, e.String())
+		}
+	} else if !strings.Contains(e.String(), expected) {
+		t.Errorf("%s: got errors %q, expected one containing %q", name, e.String(), expected)
+	}
+}
+
+// withTestFacilities adds a test ARTCC with two TRACONs to the database
+// for the duration of the test.
+func withTestFacilities(t *testing.T, fixes map[string]av.AdaptationFixes) {
+	av.DB.ERAMAdaptations["ZZZ"] = av.ERAMAdaptation{ARTCC: "ZZZ", CoordinationFixes: fixes}
+	av.DB.TRACONs["T01"] = av.TRACON{ARTCC: "ZZZ"}
+	av.DB.TRACONs["T02"] = av.TRACON{ARTCC: "ZZZ"}
+	t.Cleanup(func() {
+		delete(av.DB.ERAMAdaptations, "ZZZ")
+		delete(av.DB.TRACONs, "T01")
+		delete(av.DB.TRACONs, "T02")
+	})
+}
+
+func TestValidateCoordinationFixes(t *testing.T) {
+	good := av.AdaptationFix{Type: av.RouteBasedFix, ToFacility: "T01", FromFacility: "ZNY", Altitude: [2]int{0, 17000}}
+	with := func(f func(af *av.AdaptationFix)) av.AdaptationFixes {
+		af := good
+		f(&af)
+		return av.AdaptationFixes{af}
+	}
+
+	for _, test := range []struct {
+		name     string
+		fix      string
+		fixes    av.AdaptationFixes
+		expected string
+	}{
+		{"valid", "GOODY", av.AdaptationFixes{good}, ""},
+		{"unknown fix", "NOWHERE", av.AdaptationFixes{good}, "unable to locate fix"},
+		{"invalid type", "GOODY", with(func(af *av.AdaptationFix) { af.Type = "orbit" }), `"orbit": invalid type`},
+		{"unknown to", "GOODY", with(func(af *av.AdaptationFix) { af.ToFacility = "XYZ" }),
+			`"to" facility "XYZ" is unknown`},
+		{"unknown from", "GOODY", with(func(af *av.AdaptationFix) { af.FromFacility = "ZQQ" }),
+			`"from" facility "ZQQ" is unknown`},
+		{"altitudes", "GOODY", with(func(af *av.AdaptationFix) { af.Altitude = [2]int{20000, 10000} }),
+			"altitude range 20000-10000 is invalid"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			withTestFacilities(t, map[string]av.AdaptationFixes{test.fix: test.fixes})
+			sg := &ScenarioGroup{TRACON: "T01", Fixes: map[string]math.Point2LL{"GOODY": {-73, 40}}}
+
+			var e util.ErrorLogger
+			validateCoordinationFixes(sg, "ZZZ", &e)
+			checkValidationErrors(t, test.name, &e, test.expected)
+		})
+	}
+
+	var e util.ErrorLogger
+	validateCoordinationFixes(&ScenarioGroup{}, "ZXX", &e)
+	checkValidationErrors(t, "no adaptation", &e, "no ERAM adaptation found")
+}
+
+func TestValidateBeaconBank(t *testing.T) {
+	withTestFacilities(t, nil)
+	groups := map[string]map[string]*ScenarioGroup{
+		"T02": {"Other": {TRACON: "T02", STARSFacilityAdaptation: av.STARSFacilityAdaptation{BeaconBank: 3}}},
+	}
+
+	for _, test := range []struct {
+		name     string
+		bank     int
+		expected string
+	}{
+		{"unset", 0, ""},
+		{"unique", 2, ""},
+		{"negative", -1, "beacon bank -1 is invalid"},
+		{"too large", 0o100, "beacon bank 64 is invalid"},
+		{"shared", 3, `beacon bank 3 is also used by T02 scenario group "Other"`},
+	} {
+		sg := &ScenarioGroup{TRACON: "T01", STARSFacilityAdaptation: av.STARSFacilityAdaptation{BeaconBank: test.bank}}
+		var e util.ErrorLogger
+		validateBeaconBank(sg, "ZZZ", groups, &e)
+		checkValidationErrors(t, test.name, &e, test.expected)
+	}
+}
+
+func TestValidateDepartureReachability(t *testing.T) {
+	makeGroup := func(rwy sim.DepartureRunway) *ScenarioGroup {
+		return &ScenarioGroup{
+			Airports: map[string]*av.Airport{
+				"KJFK": {
+					Departures: []av.Departure{{Exit: "MERIT"}, {Exit: "WAVEY"}, {Exit: "DIXIE"}},
+					ExitCategories: map[string]string{
+						"MERIT": "North", "WAVEY": "Water", "DIXIE": "Water",
+					},
+				},
+			},
+			Scenarios: map[string]*Scenario{"Test": {DepartureRunways: []sim.DepartureRunway{rwy}}},
+		}
+	}
+
+	for _, test := range []struct {
+		name           string
+		rwy            sim.DepartureRunway
+		error, warning string
+	}{
+		{
+			name: "all reachable",
+			rwy: sim.DepartureRunway{Airport: "KJFK", Runway: "31L",
+				ExitRoutes: map[string]*av.ExitRoute{"MERIT": {}, "WAVEY": {}, "DIXIE": {}}},
+		},
+		{
+			name: "no exits",
+			rwy: sim.DepartureRunway{Airport: "KJFK", Runway: "31L",
+				ExitRoutes: map[string]*av.ExitRoute{"BETTE": {}}},
+			error:   "KJFK runway 31L: no departures can be launched",
+			warning: "KJFK: departures to exits [DIXIE MERIT WAVEY] are not reachable from any active runway",
+		},
+		{
+			name: "category",
+			rwy: sim.DepartureRunway{Airport: "KJFK", Runway: "31L", Category: "Water",
+				ExitRoutes: map[string]*av.ExitRoute{"MERIT": {}, "WAVEY": {}, "DIXIE": {}}},
+			warning: "KJFK: departures to exits [MERIT] are not reachable from any active runway",
+		},
+		{
+			name: "wrong category",
+			rwy: sim.DepartureRunway{Airport: "KJFK", Runway: "31L", Category: "South",
+				ExitRoutes: map[string]*av.ExitRoute{"MERIT": {}, "WAVEY": {}, "DIXIE": {}}},
+			error:   "KJFK runway 31L: no departures can be launched",
+			warning: "KJFK: departures to exits [DIXIE MERIT WAVEY] are not reachable from any active runway",
+		},
+	} {
+		var e, w util.ErrorLogger
+		validateDepartureReachability(makeGroup(test.rwy), &e, &w)
+		checkValidationErrors(t, test.name+" errors", &e, test.error)
+		checkValidationErrors(t, test.name+" warnings", &w, test.warning)
+	}
+}
+
+func TestValidateScenarioMissingFile(t *testing.T) {
+	lg := &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	fn := filepath.Join(t.TempDir(), "missing.json")
+
+	r := ValidateScenario(fn, "", lg)
+	if r.OK() || len(r.Errors) != 1 || !strings.Contains(r.Errors[0], fn) {
+		t.Errorf("got report %+v, expected a single error for %s", r, fn)
+	}
+}
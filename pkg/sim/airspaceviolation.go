@@ -0,0 +1,145 @@
+// pkg/sim/airspaceviolation.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Aircraft are checked once a second for airspace violations:
+//
+//   - An aircraft tracked by a human controller that enters another
+//     position's delegated airspace (see sectorization.go) without having
+//     been handed off or pointed out to it. Entries that the point-out
+//     advisor predicted are left to it to report.
+//   - A VFR aircraft that enters class B airspace without being tracked
+//     and talking to a controller, or class C airspace without being in
+//     two-way communication with one.
+//
+// An AirspaceViolationEvent is posted to the controller responsible for
+// the aircraft--the tracking controller in the first case and the owners
+// of the airspace in the second--when it enters the airspace; it isn't
+// reported again until it has left and come back.
+
+// airspaceViolationKey returns the key for recording that the aircraft is
+// in the given airspace without authorization; airspace is either a TCP
+// or "B" or "C" for class B and C airspace.
+func airspaceViolationKey(callsign, airspace string) string {
+	return callsign + "/" + airspace
+}
+
+// unauthorizedEntries returns the controllers other than the tracking
+// controller whose airspace the aircraft is in but who don't know about
+// it.
+func (s *Sim) unauthorizedEntries(ac *av.Aircraft) []string {
+	var entries []string
+	for _, owner := range s.State.airspaceOwnersAt(ac.Position(), ac.Altitude()) {
+		if owner != ac.TrackingController && !s.pointedOut(ac, owner) {
+			entries = append(entries, owner)
+		}
+	}
+	return entries
+}
+
+// classBCViolation returns "B" or "C" if the aircraft is VFR and in class
+// B or C airspace without the required services.
+func (s *Sim) classBCViolation(ac *av.Aircraft) string {
+	if ac.FlightPlan != nil && ac.FlightPlan.Rules != av.VFR {
+		return ""
+	}
+	if s.bravoAirspace == nil || s.charlieAirspace == nil {
+		s.initializeAirspaceGrids()
+	}
+
+	p, alt := ac.Position(), int(ac.Altitude())
+	if s.bravoAirspace.Inside(p, alt) && (ac.ControllingController == "" || ac.TrackingController == "") {
+		// Class B requires a clearance, which we take to mean that the
+		// aircraft is radar identified and talking to a controller.
+		return "B"
+	} else if s.charlieAirspace.Inside(p, alt) && ac.ControllingController == "" {
+		return "C"
+	}
+	return ""
+}
+
+// classBCRecipients returns the human controllers who should be told
+// about an aircraft in class B or C airspace: those who own the airspace
+// it's in or, if none of them do, all of them.
+func (s *Sim) classBCRecipients(ac *av.Aircraft) []string {
+	owners := slices.DeleteFunc(s.State.airspaceOwnersAt(ac.Position(), ac.Altitude()),
+		func(tcp string) bool { return !s.isActiveHumanController(tcp) })
+	if len(owners) == 0 {
+		return util.SortedMapKeys(s.humanControllers)
+	}
+	return owners
+}
+
+// checkAirspaceViolations is called once a second.
+func (s *Sim) checkAirspaceViolations() {
+	if s.airspaceViolations == nil {
+		s.airspaceViolations = make(map[string]bool)
+	}
+	seen := make(map[string]bool)
+
+	post := func(ac *av.Aircraft, key, from string, to []string, msg string) {
+		seen[key] = true
+		if s.airspaceViolations[key] {
+			return
+		}
+		s.airspaceViolations[key] = true
+
+		for _, tcp := range to {
+			s.eventStream.Post(Event{
+				Type:           AirspaceViolationEvent,
+				Callsign:       ac.Callsign,
+				FromController: from,
+				ToController:   tcp,
+				Message:        msg,
+			})
+		}
+		s.lg.Info("airspace violation", slog.String("callsign", ac.Callsign),
+			slog.Any("controllers", to), slog.String("violation", msg))
+	}
+
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		if !ac.IsAirborne() {
+			continue
+		}
+		alt := fmt.Sprintf("%03d", int(ac.Altitude()+50)/100)
+
+		if tcp := ac.TrackingController; s.isActiveHumanController(tcp) {
+			for _, owner := range s.unauthorizedEntries(ac) {
+				key := airspaceViolationKey(callsign, owner)
+				if _, ok := s.pointOutAdvisories[key]; ok {
+					// The point-out advisor will report it.
+					seen[key] = true
+					continue
+				}
+				post(ac, key, owner, []string{tcp}, "entered "+owner+" airspace at "+alt+" without a handoff or point out")
+			}
+		}
+
+		if class := s.classBCViolation(ac); class != "" {
+			key := airspaceViolationKey(callsign, class)
+			service := util.Select(class == "B", "a clearance", "two-way communication")
+			msg := "VFR aircraft entered class " + class + " airspace at " + alt + " without " + service
+			post(ac, key, "", s.classBCRecipients(ac), msg)
+		}
+	}
+
+	// Forget about aircraft that are no longer in violation so that
+	// they're reported if they enter again.
+	for key := range s.airspaceViolations {
+		if !seen[key] {
+			delete(s.airspaceViolations, key)
+		}
+	}
+}
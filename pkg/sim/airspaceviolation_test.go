@@ -0,0 +1,95 @@
+// pkg/sim/airspaceviolation_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+func TestAirspaceViolations(t *testing.T) {
+	box := func(x0, x1 float32) []av.ControllerAirspaceVolume {
+		return []av.ControllerAirspaceVolume{{
+			LowerLimit: 0,
+			UpperLimit: 10000,
+			Boundaries: [][]math.Point2LL{{{x0, 0}, {x1, 0}, {x1, 1}, {x0, 1}}},
+		}}
+	}
+	bravo := func(x0, x1 float32) *av.AirspaceVolume {
+		pts := []math.Point2LL{{x0, 0}, {x1, 0}, {x1, 1}, {x0, 1}}
+		e := math.Extent2DFromP2LLs(pts)
+		return &av.AirspaceVolume{Type: av.AirspaceVolumePolygon, Floor: 3000, Ceiling: 10000,
+			Vertices: pts, PolygonBounds: &e}
+	}
+
+	ac := &av.Aircraft{Callsign: "AAL1", TrackingController: "2K", FlightPlan: &av.FlightPlan{Rules: av.IFR}}
+	ac.Nav.FlightState.IAS = 250
+	ac.Nav.FlightState.Altitude = 5000
+	ac.Nav.FlightState.Position = math.Point2LL{0.5, 0.5}
+
+	s := newTestSim(t, &State{
+		Aircraft: map[string]*av.Aircraft{"AAL1": ac},
+		Airspace: map[string]map[string][]av.ControllerAirspaceVolume{
+			"2K": {"A": box(0, 1)},
+			"2J": {"A": box(1, 2)},
+		},
+	})
+	s.bravoAirspace = av.MakeAirspaceGrid([]*av.AirspaceVolume{bravo(2, 3)})
+	s.charlieAirspace = av.MakeAirspaceGrid(nil)
+	s.humanControllers = map[string]*EventsSubscription{"2K": nil, "2J": nil}
+	s.PointOuts = make(map[string]PointOut)
+	sub := s.eventStream.Subscribe()
+
+	// violations moves the aircraft and returns the resulting violation
+	// messages for each controller.
+	violations := func(x float32) map[string][]string {
+		ac.Nav.FlightState.Position[0] = x
+		s.checkAirspaceViolations()
+		v := make(map[string][]string)
+		for _, e := range sub.Get() {
+			if e.Type == AirspaceViolationEvent {
+				v[e.ToController] = append(v[e.ToController], e.Message)
+			}
+		}
+		return v
+	}
+
+	if v := violations(0.5); len(v) != 0 {
+		t.Errorf("unexpected violations %v in own airspace", v)
+	}
+	if v := violations(1.5); len(v["2K"]) != 1 || v["2K"][0] != "entered 2J airspace at 050 without a handoff or point out" {
+		t.Errorf("unexpected violations %v entering 2J airspace", v)
+	}
+	// It's only reported when it enters.
+	if v := violations(1.6); len(v) != 0 {
+		t.Errorf("unexpected violations %v still in 2J airspace", v)
+	}
+	violations(0.5)
+	ac.PointOutHistory = []string{"2J"}
+	if v := violations(1.5); len(v) != 0 {
+		t.Errorf("unexpected violations %v after point out", v)
+	}
+
+	// An untracked VFR aircraft wandering into class B airspace; no one
+	// owns the airspace there so all of the controllers are told.
+	ac.TrackingController = ""
+	ac.FlightPlan.Rules = av.VFR
+	if v := violations(2.5); len(v["2K"]) != 1 || len(v["2J"]) != 1 ||
+		v["2K"][0] != "VFR aircraft entered class B airspace at 050 without a clearance" {
+		t.Errorf("unexpected violations %v entering class B", v)
+	}
+	violations(1.5)
+	ac.Nav.FlightState.Altitude = 2500 // below the shelf
+	if v := violations(2.5); len(v) != 0 {
+		t.Errorf("unexpected violations %v below class B", v)
+	}
+	ac.Nav.FlightState.Altitude = 5000
+	ac.TrackingController, ac.ControllingController = "2J", "2J"
+	if v := violations(2.5); len(v) != 0 {
+		t.Errorf("unexpected violations %v with services", v)
+	}
+}
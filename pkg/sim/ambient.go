@@ -0,0 +1,209 @@
+// pkg/sim/ambient.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+
+	"github.com/brunoga/deep"
+)
+
+// Ambient VFR traffic is untracked 1200-code aircraft that wander through
+// the area without talking to anyone: people out sightseeing, doing
+// airwork, or going somewhere nearby. They're spawned already airborne
+// around the general aviation airports in the area, so traffic is denser
+// where there are more airports, and at a rate that follows the time of
+// day.
+
+// ambientVFRActivity gives the fraction of the peak ambient VFR traffic
+// that is flying for each local hour: hardly anyone overnight, building
+// through the morning and peaking in the early afternoon.
+var ambientVFRActivity = [24]float32{
+	.02, .01, .01, .01, .02, .05, .15, .3, .5, .7, .85, .95,
+	1, 1, 1, .95, .9, .8, .65, .45, .25, .12, .06, .03,
+}
+
+// ambientVFRActivityAt returns the fraction of the peak ambient VFR
+// traffic that is flying at the given time and longitude.
+func ambientVFRActivityAt(t time.Time, longitude float32) float32 {
+	// Local mean solar time is close enough to the local clock for this.
+	t = t.UTC()
+	hour := float32(t.Hour()) + float32(t.Minute())/60 + longitude/15
+	for hour < 0 {
+		hour += 24
+	}
+	for hour >= 24 {
+		hour -= 24
+	}
+
+	h := int(hour)
+	return math.Lerp(hour-float32(h), ambientVFRActivity[h], ambientVFRActivity[(h+1)%24])
+}
+
+// isDaytime returns whether the sun is up at the given time and position.
+func isDaytime(t time.Time, p math.Point2LL) bool {
+	// The approximate solar declination and hour angle are good to within
+	// a few minutes of the actual sunrise and sunset, which is plenty.
+	t = t.UTC()
+	decl := math.Radians(-23.44 * math.Cos(math.Radians(360*float32(t.YearDay()+10)/365)))
+	hour := float32(t.Hour()) + float32(t.Minute())/60 + p.Longitude()/15
+	ha := math.Radians(15 * (hour - 12))
+	lat := math.Radians(p.Latitude())
+	sinElevation := math.Sin(lat)*math.Sin(decl) + math.Cos(lat)*math.Cos(decl)*math.Cos(ha)
+	// The sun is up when its upper limb is above the horizon, allowing for
+	// refraction.
+	return sinElevation > math.Sin(math.Radians(-0.833))
+}
+
+func (s *Sim) setInitialAmbientVFRSpawnTime(now time.Time) {
+	if rate := s.State.LaunchConfig.AmbientVFRRate; rate > 0 {
+		s.NextAmbientVFRSpawn = now.Add(time.Duration(s.Rand.Float32() * 3600 / rate * float32(time.Second)))
+	} else {
+		s.NextAmbientVFRSpawn = time.Time{}
+	}
+}
+
+func (s *Sim) spawnAmbientVFR() {
+	rate := s.State.LaunchConfig.AmbientVFRRate
+	now := s.clock.Now()
+	if rate == 0 || now.Before(s.NextAmbientVFRSpawn) {
+		return
+	}
+
+	// Candidates are generated at the peak rate and then thinned
+	// according to the time of day, which keeps the spawns a Poisson
+	// process even as the rate changes over the course of the session.
+	s.NextAmbientVFRSpawn = now.Add(poissonWait(&s.Rand, rate))
+	if s.Rand.Float32() > ambientVFRActivityAt(now, s.State.Center.Longitude()) {
+		return
+	}
+
+	if ac, err := s.createAmbientVFRNoLock(); err != nil {
+		s.lg.Info("unable to create ambient VFR", slog.Any("error", err))
+	} else if ac != nil {
+		s.addAircraftNoLock(*ac)
+	}
+}
+
+// initializeAmbientVFRAirports finds the airports within the scope's
+// range that ambient VFR traffic is based around; the sim's own airports
+// are skipped since they have their own VFR departures.
+func (s *Sim) initializeAmbientVFRAirports() {
+	s.ambientVFRAirports = []string{}
+	for _, icao := range util.SortedMapKeys(av.DB.Airports()) {
+		ap := av.DB.Airports()[icao]
+		if _, ok := s.State.Airports[icao]; ok || len(ap.Runways) == 0 {
+			continue
+		}
+		if math.NMDistance2LL(ap.Location, s.State.Center) < s.State.Range {
+			s.ambientVFRAirports = append(s.ambientVFRAirports, icao)
+		}
+	}
+}
+
+func (s *Sim) createAmbientVFRNoLock() (*av.Aircraft, error) {
+	if s.ambientVFRAirports == nil {
+		s.initializeAmbientVFRAirports()
+	}
+	if len(s.ambientVFRAirports) == 0 {
+		return nil, nil
+	}
+	if s.bravoAirspace == nil || s.charlieAirspace == nil {
+		s.initializeAirspaceGrids()
+	}
+
+	// Try a few times to find a route that stays clear of B and C
+	// airspace.
+	var err error
+	for range 10 {
+		var ac *av.Aircraft
+		icao := s.ambientVFRAirports[s.Rand.Intn(len(s.ambientVFRAirports))]
+		if ac, err = s.createAmbientVFR(icao); err == nil {
+			return ac, nil
+		}
+	}
+	return nil, err
+}
+
+func (s *Sim) createAmbientVFR(icao string) (*av.Aircraft, error) {
+	ap := av.DB.Airports()[icao]
+	nmPerLongitude, magneticVariation := s.State.NmPerLongitude, s.State.MagneticVariation
+
+	ac, acType := s.State.sampleAircraft(av.AirlineSpecifier{ICAO: "N"}, &s.Rand, s.lg)
+	if ac == nil {
+		return nil, fmt.Errorf("unable to sample a valid aircraft")
+	}
+	ac.Squawk = 0o1200
+	if r := s.Rand.Float32(); r < .02 {
+		ac.Mode = av.On // mode-A
+	} else if r < .03 {
+		ac.Mode = av.Standby
+	}
+	// The flight plan is only there to keep the nav code happy; nobody
+	// has filed one.
+	ac.FlightPlan = ac.NewFlightPlan(av.VFR, acType, icao, icao)
+
+	// Start somewhere near the airport and wander from there, turning
+	// back toward the center of the scope if we get too far out.
+	hdg := float32(1 + s.Rand.Intn(360))
+	p := math.Offset2LL(ap.Location, hdg, float32(2+s.Rand.Intn(8)), nmPerLongitude, magneticVariation)
+	wps := []av.Waypoint{{Fix: "_ambient0", Location: p}}
+	n := 4 + s.Rand.Intn(4)
+	for i := 1; i <= n; i++ {
+		hdg += float32(s.Rand.Intn(121) - 60)
+		if math.NMDistance2LL(p, s.State.Center) > .8*s.State.Range {
+			hdg = math.Heading2LL(p, s.State.Center, nmPerLongitude, magneticVariation)
+		}
+		p = math.Offset2LL(p, hdg, float32(5+s.Rand.Intn(11)), nmPerLongitude, magneticVariation)
+		wps = append(wps, av.Waypoint{Fix: "_ambient" + strconv.Itoa(i), Location: p, Radius: 2})
+	}
+	wps[len(wps)-1].Delete = true
+
+	// Below 3,000' AGL anything goes; above that, cruise at the VFR
+	// altitude for the initial direction of flight.
+	perf := av.DB.AircraftPerformance[ac.FlightPlan.BaseType()]
+	course := math.NormalizeHeading(math.Heading2LL(wps[0].Location, wps[1].Location, nmPerLongitude,
+		magneticVariation))
+	base := 1000 * ((ap.Elevation + 999) / 1000)
+	var alt int
+	if s.Rand.Intn(3) == 0 {
+		alt = base + 1500 + 500*s.Rand.Intn(3)
+	} else {
+		alt = util.Select(course < 180, 3500, 4500) + 2000*s.Rand.Intn(4)
+		alt = max(alt, base+3500)
+	}
+	alt = min(alt, 17500, int(perf.Ceiling))
+
+	of := av.Overflight{
+		Waypoints:        wps,
+		InitialAltitudes: util.SingleOrArray[int]{alt},
+		CruiseAltitude:   float32(alt),
+		InitialSpeed:     perf.Speed.CruiseTAS,
+	}
+	if err := ac.InitializeOverflight(&of, "", nmPerLongitude, magneticVariation, s.State /* wind */, s.lg); err != nil {
+		return nil, err
+	}
+
+	// Make sure they stay clear of B and C airspace.
+	simac := deep.MustCopy(*ac)
+	for i := range 2 * 60 * 60 {
+		t := s.State.SimTime.Add(time.Duration(i) * time.Second)
+		if wp := simac.Update(s.State /* wind */, t, nil); wp != nil && wp.Delete {
+			return ac, nil
+		}
+		if s.bravoAirspace.Inside(simac.Position(), int(simac.Altitude())) ||
+			s.charlieAirspace.Inside(simac.Position(), int(simac.Altitude())) {
+			return nil, ErrViolatedAirspace
+		}
+	}
+	return nil, ErrVFRSimTookTooLong
+}
@@ -0,0 +1,310 @@
+// pkg/sim/apreq.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Departures over some exits need an approval request (APREQ)--a "call
+// for release"--to the overlying facility before they can go. They're
+// held at the runway like hold for release departures; once the tower
+// says one is ready, its departure controller requests a release from
+// the facility, which grants a window in which the aircraft must be off
+// the ground. The aircraft departs once the window opens (and, at hold
+// for release airports, once the controller has released it as well).
+// If it doesn't make the window, the release is void and must be
+// requested again. An APREQEvent is posted for requests that are made
+// late and for releases that are missed; the "apreq" rubric scores them.
+
+// APREQ specifies the departures that need a release from another
+// facility.
+type APREQ struct {
+	Name     string   `json:"name"`
+	Exits    []string `json:"exits"`
+	Airports []string `json:"departure_airports,omitempty"` // all if empty
+	Facility string   `json:"facility"`                     // e.g., "ZNY" or "PHL"
+	// Length of the release window; defaults to 3 minutes.
+	WindowMinutes int `json:"window_minutes,omitempty"`
+}
+
+func (a APREQ) Validate() error {
+	if a.Name == "" {
+		return fmt.Errorf("\"name\" must be specified")
+	}
+	if len(a.Exits) == 0 {
+		return fmt.Errorf("%s: \"exits\" must be specified", a.Name)
+	}
+	if a.Facility == "" {
+		return fmt.Errorf("%s: \"facility\" must be specified", a.Name)
+	}
+	if a.WindowMinutes < 0 {
+		return fmt.Errorf("%s: \"window_minutes\" must not be negative", a.Name)
+	}
+	return nil
+}
+
+func (a APREQ) applies(ac *av.Aircraft) bool {
+	fp := ac.FlightPlan
+	return fp != nil && fp.Rules == av.IFR && slices.Contains(a.Exits, fp.Exit) &&
+		(len(a.Airports) == 0 || slices.Contains(a.Airports, fp.DepartureAirport))
+}
+
+func (a APREQ) window() time.Duration {
+	return time.Duration(util.Select(a.WindowMinutes > 0, a.WindowMinutes, 3)) * time.Minute
+}
+
+type ReleaseStatus string
+
+const (
+	// The aircraft is ready and a release needs to be requested.
+	ReleaseNeeded    ReleaseStatus = "needed"
+	ReleaseRequested ReleaseStatus = "requested"
+	ReleaseGranted   ReleaseStatus = "granted"
+)
+
+// Release tracks an APREQ departure's release.
+type Release struct {
+	Callsign   string
+	APREQ      string
+	Facility   string
+	Controller string // the departure controller
+	Status     ReleaseStatus
+
+	ReadyTime    time.Time
+	RequestTime  time.Time
+	ResponseTime time.Time // when the facility will answer the request
+	WindowStart  time.Time
+	WindowEnd    time.Time
+
+	Missed       int  // number of release windows that were missed
+	LateReported bool // has a late request been reported
+}
+
+const (
+	// Releases should be requested within this long of the tower's
+	// call; later requests are reported as late.
+	releaseRequestDeadline = 3 * time.Minute
+)
+
+func (s *Sim) apreqFor(ac *av.Aircraft) *APREQ {
+	for i := range s.APREQs {
+		if s.APREQs[i].applies(ac) {
+			return &s.APREQs[i]
+		}
+	}
+	return nil
+}
+
+func (s *Sim) releaseFor(callsign string) *Release {
+	for i := range s.State.Releases {
+		if s.State.Releases[i].Callsign == callsign {
+			return &s.State.Releases[i]
+		}
+	}
+	return nil
+}
+
+// needsAPREQ returns whether the departure must be held for an APREQ.
+func (s *Sim) needsAPREQ(ac *av.Aircraft) bool {
+	return s.apreqFor(ac) != nil
+}
+
+// departureReleased returns whether a held departure may move on to be
+// sequenced for takeoff.
+func (s *Sim) departureReleased(ac *av.Aircraft) bool {
+	if ac.HoldForRelease && !ac.Released {
+		return false
+	}
+	return s.releaseWindowOpen(ac.Callsign)
+}
+
+// departureReady is called when the tower reports that a held departure
+// is ready to go; if it needs an APREQ, its controller is told to request
+// the release.
+func (s *Sim) departureReady(ac *av.Aircraft) {
+	a := s.apreqFor(ac)
+	if a == nil || s.releaseFor(ac.Callsign) != nil {
+		return
+	}
+
+	r := Release{
+		Callsign:   ac.Callsign,
+		APREQ:      a.Name,
+		Facility:   a.Facility,
+		Controller: s.State.DepartureController(ac, s.lg),
+		Status:     ReleaseNeeded,
+		ReadyTime:  s.State.SimTime,
+	}
+	s.State.Releases = append(s.State.Releases, r)
+
+	s.eventStream.Post(Event{
+		Type:         StatusMessageEvent,
+		ToController: r.Controller,
+		Message: fmt.Sprintf("%s tower: %s ready, %s needs a release from %s", ac.FlightPlan.DepartureAirport,
+			ac.Callsign, ac.FlightPlan.Exit, a.Facility),
+	})
+}
+
+// RequestRelease sends an APREQ for the departure to the facility.
+func (s *Sim) RequestRelease(tcp, callsign string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	r, err := s.checkReleaseRequest(tcp, callsign)
+	if err != nil {
+		return err
+	}
+	s.requestRelease(tcp, r)
+	return nil
+}
+
+// checkReleaseRequest returns the departure's release if the given
+// controller may request it.
+func (s *Sim) checkReleaseRequest(tcp, callsign string) (*Release, error) {
+	ac, ok := s.State.Aircraft[callsign]
+	if !ok {
+		return nil, av.ErrNoAircraftForCallsign
+	}
+	if s.State.DepartureController(ac, s.lg) != tcp {
+		return nil, ErrInvalidDepartureController
+	}
+	r := s.releaseFor(callsign)
+	if r == nil {
+		return nil, ErrNoAPREQ
+	}
+	if r.Status != ReleaseNeeded {
+		return nil, ErrReleaseAlreadyRequested
+	}
+	return r, nil
+}
+
+func (s *Sim) requestRelease(tcp string, r *Release) {
+	now := s.State.SimTime
+	r.Status = ReleaseRequested
+	r.Controller = tcp
+	r.RequestTime = now
+	r.ResponseTime = now.Add(time.Duration(20+s.Rand.Intn(70)) * time.Second)
+
+	if late := now.Sub(r.ReadyTime); late > releaseRequestDeadline && !r.LateReported {
+		r.LateReported = true
+		s.postAPREQEvent(r, fmt.Sprintf("release requested %d minutes after the aircraft was ready",
+			int(late.Minutes())))
+	}
+
+	s.lg.Info("APREQ", slog.String("callsign", r.Callsign), slog.String("tcp", tcp),
+		slog.String("facility", r.Facility))
+}
+
+func (s *Sim) postAPREQEvent(r *Release, msg string) {
+	s.eventStream.Post(Event{
+		Type:         APREQEvent,
+		Callsign:     r.Callsign,
+		ToController: r.Controller,
+		Message:      r.APREQ + ": " + msg,
+	})
+}
+
+// updateReleases is called once a second; it answers outstanding
+// requests, releases the departures whose windows have opened, and voids
+// the releases of those that missed them.
+func (s *Sim) updateReleases() {
+	now := s.State.SimTime
+
+	s.State.Releases = slices.DeleteFunc(s.State.Releases, func(r Release) bool {
+		ac, ok := s.State.Aircraft[r.Callsign]
+		return !ok || !ac.WaitingForLaunch
+	})
+
+	for i := range s.State.Releases {
+		r := &s.State.Releases[i]
+		ac := s.State.Aircraft[r.Callsign]
+		a := s.apreqFor(ac)
+		if a == nil {
+			continue
+		}
+
+		switch r.Status {
+		case ReleaseNeeded:
+			if now.Sub(r.ReadyTime) > releaseRequestDeadline && !r.LateReported {
+				r.LateReported = true
+				s.postAPREQEvent(r, "release not requested")
+			}
+
+		case ReleaseRequested:
+			if now.Before(r.ResponseTime) {
+				continue
+			}
+			// The facility may need a few minutes to fit it in.
+			r.Status = ReleaseGranted
+			r.WindowStart = now.Add(time.Duration(s.Rand.Intn(240)) * time.Second)
+			r.WindowEnd = r.WindowStart.Add(a.window())
+
+			s.eventStream.Post(Event{
+				Type:         StatusMessageEvent,
+				ToController: r.Controller,
+				Message: fmt.Sprintf("%s: %s released, window %s-%s", r.Facility, r.Callsign,
+					r.WindowStart.UTC().Format("1504:05"), r.WindowEnd.UTC().Format("1504:05Z")),
+			})
+
+		case ReleaseGranted:
+			if now.Before(r.WindowStart) {
+				continue
+			}
+			if !ac.HoldForRelease && ac.ReleaseTime.Before(r.WindowStart) {
+				// Departures from airports that don't hold for release
+				// are released by the APREQ alone.
+				ac.ReleaseTime = now
+			}
+			if now.After(r.WindowEnd) {
+				r.Status = ReleaseNeeded
+				r.ReadyTime = now
+				r.LateReported = false
+				r.Missed++
+				s.returnToHeld(ac)
+				s.postAPREQEvent(r, "release window missed; release is void")
+			}
+		}
+	}
+}
+
+// releaseWindowOpen returns whether the departure can take off as far as
+// APREQs are concerned.
+func (s *Sim) releaseWindowOpen(callsign string) bool {
+	r := s.releaseFor(callsign)
+	if r == nil {
+		return true
+	}
+	now := s.State.SimTime
+	return r.Status == ReleaseGranted && !now.Before(r.WindowStart) && !now.After(r.WindowEnd)
+}
+
+// returnToHeld moves a departure whose release is void from the runway's
+// released or sequenced departures back to the held ones.
+func (s *Sim) returnToHeld(ac *av.Aircraft) {
+	for _, depState := range s.DepartureState[ac.FlightPlan.DepartureAirport] {
+		match := func(dep DepartureAircraft) bool { return dep.Callsign == ac.Callsign }
+		var dep *DepartureAircraft
+		if idx := slices.IndexFunc(depState.Released, match); idx != -1 {
+			dep = &depState.Released[idx]
+		} else if idx := slices.IndexFunc(depState.Sequenced, match); idx != -1 {
+			dep = &depState.Sequenced[idx]
+		} else {
+			continue
+		}
+
+		held := *dep
+		depState.Released = slices.DeleteFunc(depState.Released, match)
+		depState.Sequenced = slices.DeleteFunc(depState.Sequenced, match)
+		depState.Held = append(depState.Held, held)
+		return
+	}
+}
@@ -0,0 +1,52 @@
+// pkg/sim/apreq_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+func TestReleaseHeldDepartures(t *testing.T) {
+	s := newTestSim(t, &State{
+		Aircraft: map[string]*av.Aircraft{
+			"AAL1": {Callsign: "AAL1"},
+			"UAL2": {Callsign: "UAL2"},
+		},
+		SimTime: testSimTime,
+	})
+	now := s.State.SimTime
+
+	// AAL1 needs an APREQ and its window hasn't opened yet; UAL2, behind
+	// it, was released by the controller two minutes ago.
+	s.State.Releases = []Release{{Callsign: "AAL1", Status: ReleaseGranted,
+		WindowStart: now.Add(time.Minute), WindowEnd: now.Add(4 * time.Minute)}}
+	ual := s.State.Aircraft["UAL2"]
+	ual.HoldForRelease, ual.Released, ual.ReleaseTime = true, true, now.Add(-2*time.Minute)
+
+	depState := &RunwayLaunchState{Held: []DepartureAircraft{
+		{Callsign: "AAL1", ReleaseRequested: true},
+		{Callsign: "UAL2", ReleaseRequested: true, ReleaseDelay: time.Minute},
+	}}
+	if !s.releaseHeldDepartures(depState, now) {
+		t.Errorf("UAL2 not released")
+	}
+	if len(depState.Held) != 1 || depState.Held[0].Callsign != "AAL1" ||
+		len(depState.Released) != 1 || depState.Released[0].Callsign != "UAL2" {
+		t.Errorf("unexpected held %+v released %+v", depState.Held, depState.Released)
+	}
+
+	if s.releaseHeldDepartures(depState, now) {
+		t.Errorf("AAL1 released before its window")
+	}
+
+	s.State.SimTime = now.Add(90 * time.Second)
+	if !s.releaseHeldDepartures(depState, s.State.SimTime) || len(depState.Held) != 0 ||
+		len(depState.Released) != 2 || depState.Released[1].Callsign != "AAL1" {
+		t.Errorf("unexpected held %+v released %+v", depState.Held, depState.Released)
+	}
+}
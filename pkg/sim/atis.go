@@ -0,0 +1,287 @@
+// pkg/sim/atis.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Each of the sim's airports broadcasts an ATIS that is composed from its
+// METAR, the active runways, and any NOTAMs that the controllers have
+// added. A new letter is issued every hour and whenever something
+// significant changes. Arrivals report the letter they have when they
+// check in; some have an old one (or none at all), in which case the
+// controller should ask them to verify they have the current one.
+
+type ATIS struct {
+	Airport   string
+	Letter    string
+	Issued    time.Time
+	Wind      av.Wind
+	Altimeter string
+	Runways   string
+	// NOTAMs are the controllers' free-form ones; Closures are from the
+	// NOTAMs in State.NOTAMs for the airport (see notam.go).
+	NOTAMs   []string
+	Closures []string
+}
+
+var atisPhonetic = [26]string{"Alpha", "Bravo", "Charlie", "Delta", "Echo", "Foxtrot", "Golf", "Hotel",
+	"India", "Juliet", "Kilo", "Lima", "Mike", "November", "Oscar", "Papa", "Quebec", "Romeo", "Sierra",
+	"Tango", "Uniform", "Victor", "Whiskey", "X-ray", "Yankee", "Zulu"}
+
+func atisLetterPhonetic(letter string) string {
+	if len(letter) != 1 || letter[0] < 'A' || letter[0] > 'Z' {
+		return letter
+	}
+	return atisPhonetic[letter[0]-'A']
+}
+
+func nextATISLetter(letter string) string {
+	if letter == "" || letter == "Z" {
+		return "A"
+	}
+	return string(letter[0] + 1)
+}
+
+func previousATISLetter(letter string) string {
+	if letter == "" || letter == "A" {
+		return "Z"
+	}
+	return string(letter[0] - 1)
+}
+
+// Text returns the ATIS as it's broadcast.
+func (a ATIS) Text() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s information %s, %s. ", a.Airport, atisLetterPhonetic(a.Letter),
+		a.Issued.UTC().Format("1504Z"))
+	if a.Wind.Speed <= 0 {
+		sb.WriteString("Wind calm. ")
+	} else if a.Wind.Variable {
+		fmt.Fprintf(&sb, "Wind variable at %d. ", a.Wind.Speed)
+	} else if a.Wind.Gust > 0 {
+		fmt.Fprintf(&sb, "Wind %03d at %d gust %d. ", a.Wind.Direction, a.Wind.Speed, a.Wind.Gust)
+	} else {
+		fmt.Fprintf(&sb, "Wind %03d at %d. ", a.Wind.Direction, a.Wind.Speed)
+	}
+	if alt := strings.TrimPrefix(a.Altimeter, "A"); alt != "" {
+		fmt.Fprintf(&sb, "Altimeter %s. ", alt)
+	}
+	if a.Runways != "" {
+		sb.WriteString(a.Runways + ". ")
+	}
+	for _, n := range append(slices.Clone(a.Closures), a.NOTAMs...) {
+		sb.WriteString("NOTAM: " + n + ". ")
+	}
+	fmt.Fprintf(&sb, "Advise on initial contact you have information %s.", atisLetterPhonetic(a.Letter))
+	return sb.String()
+}
+
+// significantATISChange returns whether the differences between two
+// versions of the ATIS require a new letter.
+func significantATISChange(a, b ATIS) bool {
+	if a.Runways != b.Runways || !slices.Equal(a.NOTAMs, b.NOTAMs) || !slices.Equal(a.Closures, b.Closures) ||
+		a.Altimeter != b.Altimeter {
+		return true
+	}
+	if a.Wind.Variable != b.Wind.Variable || a.Wind.Speed-b.Wind.Speed >= 10 || b.Wind.Speed-a.Wind.Speed >= 10 {
+		return true
+	}
+	return a.Wind.Speed >= 5 && b.Wind.Speed >= 5 &&
+		math.HeadingDifference(float32(a.Wind.Direction), float32(b.Wind.Direction)) >= 30
+}
+
+// composeATIS returns the ATIS for the airport given the current weather
+// and runways; Letter and Issued are left for the caller to fill in.
+func (s *Sim) composeATIS(airport string, notams []string) ATIS {
+	atis := ATIS{Airport: airport, NOTAMs: notams}
+	if m, ok := s.State.METAR[airport]; ok && m != nil {
+		atis.Wind, atis.Altimeter = m.Wind, m.Altimeter
+	} else {
+		atis.Wind = s.State.Wind
+	}
+
+	var arr, dep []string
+	for _, r := range s.State.ArrivalRunways {
+		if rwy := av.TidyRunway(r.Runway); r.Airport == airport && !slices.Contains(arr, rwy) &&
+			!s.State.RunwayClosed(airport, rwy) {
+			arr = append(arr, rwy)
+		}
+	}
+	for _, r := range s.State.DepartureRunways {
+		if rwy := av.TidyRunway(r.Runway); r.Airport == airport && !slices.Contains(dep, rwy) &&
+			!s.State.RunwayClosed(airport, rwy) {
+			dep = append(dep, rwy)
+		}
+	}
+	var rwys []string
+	if len(arr) > 0 {
+		rwys = append(rwys, "Landing runway "+strings.Join(arr, " and "))
+	}
+	if len(dep) > 0 {
+		rwys = append(rwys, "departing runway "+strings.Join(dep, " and "))
+	}
+	atis.Runways = strings.Join(rwys, ", ")
+
+	for _, n := range s.State.AirportNOTAMs(airport) {
+		atis.Closures = append(atis.Closures, n.String())
+	}
+
+	return atis
+}
+
+// atisAirports returns the airports that have an ATIS: the ones that
+// have arrivals or departures.
+func (s *Sim) atisAirports() []string {
+	var aps []string
+	for _, r := range s.State.ArrivalRunways {
+		aps = append(aps, r.Airport)
+	}
+	for _, r := range s.State.DepartureRunways {
+		aps = append(aps, r.Airport)
+	}
+	slices.Sort(aps)
+	return slices.Compact(aps)
+}
+
+// updateATIS is called once a second.
+func (s *Sim) updateATIS() {
+	if s.State.ATIS == nil {
+		s.State.ATIS = make(map[string]ATIS)
+	}
+	now := s.State.SimTime
+
+	for _, ap := range s.atisAirports() {
+		cur, ok := s.State.ATIS[ap]
+		next := s.composeATIS(ap, cur.NOTAMs)
+		if !ok {
+			next.Letter = string(rune('A' + s.Rand.Intn(26)))
+		} else if now.Sub(cur.Issued) >= time.Hour || significantATISChange(cur, next) {
+			next.Letter = nextATISLetter(cur.Letter)
+			s.postATISEvent(next)
+		} else {
+			continue
+		}
+		next.Issued = now
+		s.State.ATIS[ap] = next
+	}
+
+	for callsign := range s.atisReported {
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(s.atisReported, callsign)
+		}
+	}
+}
+
+func (s *Sim) postATISEvent(atis ATIS) {
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: fmt.Sprintf("%s information %s is current.", atis.Airport, atisLetterPhonetic(atis.Letter)),
+	})
+}
+
+// SetATISNOTAMs sets the NOTAMs that are included in an airport's ATIS
+// and issues a new one.
+func (s *Sim) SetATISNOTAMs(tcp, airport string, notams []string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.isActiveHumanController(tcp) {
+		return av.ErrNoController
+	}
+	cur, ok := s.State.ATIS[airport]
+	if !ok {
+		return av.ErrUnknownAirport
+	}
+
+	notams = util.FilterSlice(util.MapSlice(notams, strings.TrimSpace), func(n string) bool { return n != "" })
+	next := s.composeATIS(airport, notams)
+	next.Letter = nextATISLetter(cur.Letter)
+	next.Issued = s.State.SimTime
+	s.State.ATIS[airport] = next
+	s.postATISEvent(next)
+
+	s.lg.Info("ATIS NOTAMs", slog.String("tcp", tcp), slog.String("airport", airport),
+		slog.Any("notams", notams))
+
+	return nil
+}
+
+// atisCheckIn returns the part of an arrival's initial contact where they
+// report the ATIS they have and records it so that it can be verified.
+func (s *Sim) atisCheckIn(ac *av.Aircraft) string {
+	if ac.FlightPlan == nil || !s.State.IsArrival(ac) {
+		return ""
+	}
+	atis, ok := s.State.ATIS[ac.FlightPlan.ArrivalAirport]
+	if !ok {
+		return ""
+	}
+
+	// Most pilots have the current one, but some haven't picked up the
+	// latest and a few don't say.
+	letter := atis.Letter
+	if r := s.Rand.Float32(); r < .08 {
+		letter = ""
+	} else if r < .2 {
+		letter = previousATISLetter(letter)
+	}
+
+	if s.atisReported == nil {
+		s.atisReported = make(map[string]string)
+	}
+	s.atisReported[ac.Callsign] = letter
+
+	if letter == "" {
+		return ""
+	}
+	return ", with information " + atisLetterPhonetic(letter)
+}
+
+// VerifyATIS is issued by the controller when an aircraft has checked in
+// without the current ATIS: "verify you have information X."
+func (s *Sim) VerifyATIS(tcp, callsign string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	return s.dispatchControllingCommand(tcp, callsign,
+		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			var atis ATIS
+			ok := false
+			if ac.FlightPlan != nil {
+				atis, ok = s.State.ATIS[ac.FlightPlan.ArrivalAirport]
+			}
+			if !ok {
+				return []av.RadioTransmission{av.RadioTransmission{
+					Controller: tcp,
+					Message:    "say again?",
+					Type:       av.RadioTransmissionReadback,
+				}}
+			}
+
+			msg := "we have " + atisLetterPhonetic(atis.Letter)
+			if s.atisReported[ac.Callsign] != atis.Letter {
+				msg = "we'll pick up " + atisLetterPhonetic(atis.Letter)
+				if s.atisReported == nil {
+					s.atisReported = make(map[string]string)
+				}
+				s.atisReported[ac.Callsign] = atis.Letter
+			}
+			return []av.RadioTransmission{av.RadioTransmission{
+				Controller: tcp,
+				Message:    msg,
+				Type:       av.RadioTransmissionReadback,
+			}}
+		})
+}
@@ -0,0 +1,27 @@
+// pkg/sim/atis_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+func TestVerifyATISNoFlightPlan(t *testing.T) {
+	// 2K is working UAL2, which doesn't have a flight plan.
+	s := newTestSim(t, &State{
+		Aircraft:    map[string]*av.Aircraft{"UAL2": {Callsign: "UAL2", ControllingController: "2K"}},
+		Controllers: map[string]*av.Controller{"2K": {Position: "2K"}},
+		ATIS:        map[string]ATIS{"KJFK": {Airport: "KJFK", Letter: "B"}},
+	})
+
+	if err := s.VerifyATIS("2K", "UAL2"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if len(s.atisReported) != 0 {
+		t.Errorf("ATIS recorded for an aircraft without a flight plan: %+v", s.atisReported)
+	}
+}
@@ -0,0 +1,214 @@
+// pkg/sim/batch.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// A sim can also be run as a batch: with no one signed in, as fast as
+// possible, for a given amount of simulated time. Along the way, it
+// keeps track of what traffic was generated and how it fared so that
+// scenario authors can tune rates without sitting through sessions. All
+// of the aircraft are worked by virtual controllers, so arrivals to
+// human-controlled approaches may not land; the spawn rates are still
+// meaningful, though.
+
+const (
+	// Losses of separation are counted with the standard terminal minima.
+	batchConflictLateralNM  = 3
+	batchConflictVerticalFt = 1000
+)
+
+// BatchReport summarizes a batch run.
+type BatchReport struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration float32   `json:"hours"`
+
+	Arrivals    map[string]*BatchArrivalStats   `json:"arrivals"`   // airport ->
+	Departures  map[string]*BatchDepartureStats `json:"departures"` // "airport/runway" ->
+	Overflights int                             `json:"overflights"`
+	Pushes      map[string]*BatchPushStats      `json:"arrival_pushes,omitempty"` // name ->
+
+	GoArounds    int `json:"go_arounds"`
+	Conflicts    int `json:"conflicts"`
+	PeakAircraft int `json:"peak_aircraft"`
+
+	// Beacon code usage of the facility's ERAM code pool.
+	BeaconCodes         int `json:"beacon_codes"`
+	MinBeaconsAvailable int `json:"min_beacon_codes_available"`
+	// Number of seconds during which no codes were available.
+	BeaconsExhausted int `json:"beacon_codes_exhausted_seconds"`
+}
+
+// BatchArrivalStats gives the arrivals to an airport; PerHour is the rate
+// at which they were spawned, for comparison to the scenario's rates.
+type BatchArrivalStats struct {
+	Spawned int     `json:"spawned"`
+	Landed  int     `json:"landed"`
+	PerHour float32 `json:"per_hour"`
+}
+
+// BatchPushStats gives the arrivals spawned during an arrival push and
+// their rate over the part of it that the batch covered.
+type BatchPushStats struct {
+	Spawned int     `json:"spawned"`
+	PerHour float32 `json:"per_hour"`
+
+	seconds int
+}
+
+// BatchDepartureStats gives the departures launched from a runway. The
+// wait for each is the time from when it was ready to go until its
+// takeoff roll.
+type BatchDepartureStats struct {
+	Launched    int     `json:"launched"`
+	PerHour     float32 `json:"per_hour"`
+	AverageWait float32 `json:"average_wait_seconds"`
+	MaxWait     float32 `json:"max_wait_seconds"`
+
+	totalWait time.Duration
+}
+
+type batchStats struct {
+	report     BatchReport
+	inConflict map[string]bool // "callsign/callsign"
+}
+
+// RunBatch runs the sim for the given amount of simulated time and
+// returns a report of what happened. The sim should have already been
+// activated and prespawned.
+func (s *Sim) RunBatch(d time.Duration) BatchReport {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	s.batch = &batchStats{
+		report: BatchReport{
+			Start:               s.State.SimTime,
+			Arrivals:            make(map[string]*BatchArrivalStats),
+			Departures:          make(map[string]*BatchDepartureStats),
+			Pushes:              make(map[string]*BatchPushStats),
+			MinBeaconsAvailable: -1,
+		},
+		inConflict: make(map[string]bool),
+	}
+	defer func() { s.batch = nil }()
+
+	for range int(d.Seconds()) {
+		s.clock.Tick(func() {
+			s.updateState()
+			s.batch.update(s)
+		})
+	}
+	s.clock.Resync()
+
+	r := s.batch.report
+	r.End = s.State.SimTime
+	r.Duration = float32(r.End.Sub(r.Start).Hours())
+	if r.Duration > 0 {
+		for _, a := range r.Arrivals {
+			a.PerHour = float32(a.Spawned) / r.Duration
+		}
+		for _, p := range r.Pushes {
+			if p.seconds > 0 {
+				p.PerHour = float32(p.Spawned) * 3600 / float32(p.seconds)
+			}
+		}
+		for _, dep := range r.Departures {
+			dep.PerHour = float32(dep.Launched) / r.Duration
+			if dep.Launched > 0 {
+				dep.AverageWait = float32(dep.totalWait.Seconds()) / float32(dep.Launched)
+			}
+		}
+	}
+	return r
+}
+
+// update is called once a second.
+func (b *batchStats) update(s *Sim) {
+	b.report.PeakAircraft = max(b.report.PeakAircraft, len(s.State.Aircraft))
+	if p := s.State.ActivePush; p != nil {
+		b.push(p.Name).seconds++
+	}
+
+	if eram := s.State.ERAMComputer(); eram != nil && eram.SquawkCodePool != nil {
+		pool := eram.SquawkCodePool
+		n := pool.NumAvailable()
+		b.report.BeaconCodes = int(pool.Last - pool.First + 1)
+		if b.report.MinBeaconsAvailable == -1 || n < b.report.MinBeaconsAvailable {
+			b.report.MinBeaconsAvailable = n
+		}
+		if n == 0 {
+			b.report.BeaconsExhausted++
+		}
+	}
+
+	conflicts := make(map[string]bool)
+	for _, pair := range s.aircraftIndex.PairsWithin(batchConflictLateralNM) {
+		ac0, ac1 := pair[0], pair[1]
+		if !ac0.IsAirborne() || !ac1.IsAirborne() ||
+			math.Abs(ac0.Altitude()-ac1.Altitude()) >= batchConflictVerticalFt ||
+			math.NMDistance2LL(ac0.Position(), ac1.Position()) >= batchConflictLateralNM {
+			continue
+		}
+		key := ac0.Callsign + "/" + ac1.Callsign
+		conflicts[key] = true
+		if !b.inConflict[key] {
+			b.report.Conflicts++
+		}
+	}
+	b.inConflict = conflicts
+}
+
+func (b *batchStats) arrival(airport string) *BatchArrivalStats {
+	if b.report.Arrivals[airport] == nil {
+		b.report.Arrivals[airport] = &BatchArrivalStats{}
+	}
+	return b.report.Arrivals[airport]
+}
+
+func (b *batchStats) push(name string) *BatchPushStats {
+	if b.report.Pushes[name] == nil {
+		b.report.Pushes[name] = &BatchPushStats{}
+	}
+	return b.report.Pushes[name]
+}
+
+// aircraftAdded is called when an arrival or overflight is spawned.
+func (b *batchStats) aircraftAdded(s *Sim, ac *av.Aircraft) {
+	if s.State.IsDeparture(ac) {
+		return
+	} else if s.State.IsArrival(ac) {
+		b.arrival(ac.FlightPlan.ArrivalAirport).Spawned++
+		if p := s.State.ActivePush; p != nil {
+			b.push(p.Name).Spawned++
+		}
+	} else {
+		b.report.Overflights++
+	}
+}
+
+func (b *batchStats) landed(ac *av.Aircraft) {
+	b.arrival(ac.FlightPlan.ArrivalAirport).Landed++
+}
+
+// departureLaunched is called when a departure starts its takeoff roll.
+func (b *batchStats) departureLaunched(airport, runway string, dep *DepartureAircraft, now time.Time) {
+	key := airport + "/" + runway
+	ds := b.report.Departures[key]
+	if ds == nil {
+		ds = &BatchDepartureStats{}
+		b.report.Departures[key] = ds
+	}
+	wait := now.Sub(util.Select(dep.TaxiReadyTime.After(dep.SpawnTime), dep.TaxiReadyTime, dep.SpawnTime))
+	ds.Launched++
+	ds.totalWait += wait
+	ds.MaxWait = max(ds.MaxWait, float32(wait.Seconds()))
+}
@@ -0,0 +1,135 @@
+// pkg/sim/beacon.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"log/slog"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+// Aircraft sometimes squawk a code other than the one assigned in their
+// flight plan--because the pilot dialed it in wrong or the aircraft
+// departed with the wrong code. The tracking controller is told when that
+// happens and can then either re-issue the assigned code to the pilot or
+// reassign the flight plan to the code the aircraft is squawking; in the
+// latter case, an amendment goes out so that all of the facilities that
+// have the flight plan correlate it with the new code.
+
+// checkBeaconMismatches is called once a second.
+func (s *Sim) checkBeaconMismatches() {
+	if s.beaconMismatches == nil {
+		s.beaconMismatches = make(map[string]av.Squawk)
+	}
+
+	for callsign, ac := range s.State.Aircraft {
+		observed, ok := s.beaconMismatch(ac)
+		if !ok {
+			delete(s.beaconMismatches, callsign)
+			continue
+		}
+		if prev, ok := s.beaconMismatches[callsign]; ok && prev == observed {
+			// Already reported.
+			continue
+		}
+
+		s.beaconMismatches[callsign] = observed
+		s.lg.Info("beacon code mismatch", slog.String("callsign", callsign),
+			slog.String("squawk", observed.String()),
+			slog.String("assigned", ac.FlightPlan.AssignedSquawk.String()))
+		s.eventStream.Post(Event{
+			Type:         StatusMessageEvent,
+			ToController: ac.TrackingController,
+			Message: callsign + " squawking " + observed.String() + ", assigned " +
+				ac.FlightPlan.AssignedSquawk.String(),
+		})
+	}
+}
+
+// beaconMismatch returns the code that a tracked aircraft is squawking if
+// it differs from the one assigned in its flight plan. Aircraft that are
+// in the middle of changing codes and ones squawking SPCs aren't
+// reported.
+func (s *Sim) beaconMismatch(ac *av.Aircraft) (av.Squawk, bool) {
+	if ac.TrackingController == "" || ac.FlightPlan == nil || ac.WaitingForLaunch ||
+		ac.Squawk == ac.FlightPlan.AssignedSquawk || ac.Mode == av.Standby {
+		return 0, false
+	}
+	if spc, _ := ac.Squawk.IsSPC(); spc {
+		return 0, false
+	}
+	for _, fcs := range s.FutureSquawkChanges {
+		if fcs.Callsign == ac.Callsign {
+			return 0, false
+		}
+	}
+	return ac.Squawk, true
+}
+
+// ReassignBeaconCode changes the aircraft's flight plan to use the code
+// that it is squawking and sends the amended plan to the other
+// facilities.
+func (s *Sim) ReassignBeaconCode(tcp, callsign string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	return s.dispatchCommand(tcp, callsign,
+		func(tcp string, ac *av.Aircraft) error {
+			if ac.TrackingController != tcp && !s.Instructors[tcp] {
+				return av.ErrOtherControllerHasTrack
+			} else if ac.FlightPlan == nil {
+				return av.ErrNoFlightPlan
+			} else if ac.Squawk == ac.FlightPlan.AssignedSquawk {
+				return ErrNoBeaconMismatch
+			} else if spc, _ := ac.Squawk.IsSPC(); spc || ac.Squawk == 0o1200 {
+				return av.ErrInvalidSquawkCode
+			}
+			for _, other := range s.State.Aircraft {
+				if other != ac && other.FlightPlan != nil && other.FlightPlan.AssignedSquawk == ac.Squawk {
+					return av.ErrSquawkCodeAlreadyAssigned
+				}
+			}
+			return nil
+		},
+		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			previous := ac.FlightPlan.AssignedSquawk
+			ac.FlightPlan.AssignedSquawk = ac.Squawk
+			delete(s.beaconMismatches, ac.Callsign)
+			s.pilotErrorCorrected(ac.Callsign, "squawk")
+
+			s.lg.Info("beacon code reassigned", slog.String("callsign", ac.Callsign),
+				slog.String("previous", previous.String()), slog.String("squawk", ac.Squawk.String()))
+
+			ctrl := s.State.Controllers[tcp]
+			if err := s.State.ERAMComputers.AmendBeaconCode(ac, ctrl.Facility, previous, s.State.SimTime); err != nil {
+				s.lg.Warnf("%s: AmendBeaconCode: %v", ac.Callsign, err)
+			}
+			return nil
+		})
+}
+
+// ReissueBeaconCode instructs the pilot to squawk the code assigned in
+// the aircraft's flight plan.
+func (s *Sim) ReissueBeaconCode(tcp, callsign string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	return s.dispatchCommand(tcp, callsign,
+		func(tcp string, ac *av.Aircraft) error {
+			if ac.ControllingController != tcp && !s.Instructors[tcp] && !s.isPseudoPilotFor(tcp, ac.Callsign) {
+				return av.ErrOtherControllerHasTrack
+			} else if ac.FlightPlan == nil {
+				return av.ErrNoFlightPlan
+			} else if ac.Squawk == ac.FlightPlan.AssignedSquawk {
+				return ErrNoBeaconMismatch
+			}
+			return nil
+		},
+		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			return s.radioForEmergency(tcp, ac, func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+				return s.changeSquawkWithErrors(tcp, ac, ac.FlightPlan.AssignedSquawk)
+			})
+		})
+}
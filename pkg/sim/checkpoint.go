@@ -0,0 +1,263 @@
+// pkg/sim/checkpoint.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+
+	"github.com/brunoga/deep"
+)
+
+// The sim periodically takes in-memory checkpoints of its state so that
+// controllers can rewind to shortly before a mistake and try again.
+
+// Snapshotter is implemented by each part of the sim that holds state
+// that changes as the sim runs. Snapshot returns a copy of that state
+// that isn't affected by subsequent changes and Restore returns to a
+// state previously returned by Snapshot. A snapshot may be restored more
+// than once.
+type Snapshotter interface {
+	Snapshot() any
+	Restore(snapshot any)
+}
+
+const (
+	checkpointInterval = 10 * time.Second // sim time
+	checkpointHistory  = 6 * time.Minute
+)
+
+// checkpoint holds snapshots of all of the sim's Snapshotters, in the
+// order they are returned by Sim.snapshotters.
+type checkpoint struct {
+	time      time.Time
+	snapshots []any
+}
+
+// snapshotters returns all of the parts of the sim whose state is saved
+// in a checkpoint: everything that changes as the sim runs other than
+// live traffic, the signed-in controllers, connections to other systems,
+// and the scenario script, which is restarted instead (see script.go).
+// (TestCheckpointCoverage checks that new Sim fields are either here or
+// deliberately left out.)
+func (s *Sim) snapshotters() []Snapshotter {
+	return []Snapshotter{
+		s.State,
+		snapshotValue(&s.Rand),
+		snapshotValue(&s.lastSimUpdate),
+		// Launches
+		snapshotValue(&s.DepartureState),
+		snapshotValue(&s.NextInboundSpawn),
+		snapshotValue(&s.NextPushStart),
+		snapshotValue(&s.PushEnd),
+		snapshotValue(&s.ArrivalPushes),
+		snapshotValue(&s.NextAmbientVFRSpawn),
+		snapshotValue(&s.ambientVFRAirports),
+		snapshotValue(&s.NextVehicleSpawn),
+		snapshotValue(&s.NextPracticeApproachSpawn),
+		snapshotValue(&s.PracticeApproaches),
+		snapshotValue(&s.NextSVFRSpawn),
+		snapshotValue(&s.svfrIntruders),
+		snapshotValue(&s.meterSlots),
+		// Runway closures change the departure rates.
+		snapshotValue(&s.closedRunwayRates),
+		snapshotValue(&s.State.LaunchConfig.DepartureRates),
+		// Coordination between controllers
+		snapshotValue(&s.Handoffs),
+		snapshotValue(&s.PointOuts),
+		snapshotValue(&s.Coordination),
+		snapshotValue(&s.CoordinatedAltitudes),
+		snapshotValue(&s.FutureSectorizations),
+		snapshotValue(&s.atisReported),
+		// Deferred pilot actions
+		snapshotValue(&s.FutureControllerContacts),
+		snapshotValue(&s.FutureOnCourse),
+		snapshotValue(&s.FutureSquawkChanges),
+		// Monitoring and alerts
+		snapshotValue(&s.beaconMismatches),
+		snapshotValue(&s.flightIDMismatches),
+		snapshotValue(&s.efcWarnings),
+		snapshotValue(&s.wxDeviations),
+		snapshotValue(&s.hazardEncounters),
+		snapshotValue(&s.runwayTimerHolds),
+		snapshotValue(&s.loaChecks),
+		snapshotValue(&s.pointOutAdvisories),
+		snapshotValue(&s.airspaceViolations),
+		snapshotValue(&s.lastTrackHistory),
+		snapshotValue(&s.lastProbe),
+		snapshotValue(&s.lastPointOutCheck),
+		snapshotValue(&s.lastRunwayAdvice),
+		// Training events
+		snapshotValue(&s.PilotErrors),
+		snapshotValue(&s.Hearback),
+		snapshotValue(&s.Emergencies),
+		snapshotValue(&s.FutureEmergencies),
+		snapshotValue(&s.TCASRAs),
+		snapshotValue(&s.tcasAltitudes),
+		snapshotValue(&s.RunwayOccupied),
+		snapshotValue(&s.StabilityChecked),
+		snapshotValue(&s.ComplianceLog),
+		snapshotValue(&s.monitoredRestrictions),
+		snapshotValue(&s.tmiApproaching),
+		snapshotValue(&s.tmiCrossings),
+		snapshotValue(&s.Scoring),
+		snapshotValue(&s.Lesson),
+	}
+}
+
+// valueSnapshotter is a Snapshotter for a value that holds its state
+// directly and can be deep-copied.
+type valueSnapshotter[T any] struct {
+	v *T
+}
+
+func snapshotValue[T any](v *T) Snapshotter {
+	return valueSnapshotter[T]{v: v}
+}
+
+func (vs valueSnapshotter[T]) Snapshot() any {
+	return deep.MustCopy(*vs.v)
+}
+
+func (vs valueSnapshotter[T]) Restore(snapshot any) {
+	*vs.v = deep.MustCopy(snapshot.(T))
+}
+
+// stateNotCheckpointed gives the State fields that aren't saved in
+// checkpoints; the rest are. They're the ones given by the scenario, the
+// signed-in controllers and their settings, and settings like the sim
+// rate and launch configuration that rewinding shouldn't change.
+var stateNotCheckpointed = map[string]bool{
+	// Scenario
+	"Airports": true, "DepartureAirports": true, "ArrivalAirports": true, "Fixes": true,
+	"VFRRunways": true, "Sectorizations": true, "DepartureRunways": true, "ArrivalRunways": true,
+	"InboundFlows": true, "Center": true, "Range": true, "ScenarioDefaultVideoMaps": true,
+	"STARSFacilityAdaptation": true, "TRACON": true, "MagneticVariation": true,
+	"NmPerLongitude": true, "PrimaryAirport": true, "SimDescription": true,
+	"VideoMapLibraryHash": true,
+	// Controllers
+	"Controllers": true, "HumanControllers": true, "PrimaryController": true,
+	"MultiControllers": true, "PrimaryTCP": true, "Consolidations": true, "QuickLooks": true,
+	"PreferenceSets": true, "Instructors": true, "PseudoPilots": true,
+	"PseudoPilotAircraft": true, "ControllerVideoMaps": true, "ControllerDefaultVideoMaps": true,
+	"ControllerMonitoredBeaconCodeBlocks": true,
+	// Settings
+	"LaunchConfig": true, "Paused": true, "SimRate": true, "FastForwardRate": true,
+	"FastForwarding": true,
+}
+
+// Snapshot returns a copy of the State's checkpointed fields with the
+// others zeroed.
+func (ss *State) Snapshot() any {
+	snap := *ss
+	v := reflect.ValueOf(&snap).Elem()
+	for i := range v.NumField() {
+		if stateNotCheckpointed[v.Type().Field(i).Name] {
+			v.Field(i).SetZero()
+		}
+	}
+	return deep.MustCopy(snap)
+}
+
+func (ss *State) Restore(snapshot any) {
+	snap := reflect.ValueOf(deep.MustCopy(snapshot.(State)))
+	v := reflect.ValueOf(ss).Elem()
+	for i := range v.NumField() {
+		if !stateNotCheckpointed[v.Type().Field(i).Name] {
+			v.Field(i).Set(snap.Field(i))
+		}
+	}
+}
+
+// takeCheckpoint takes a checkpoint and discards ones that are too old to
+// be useful; the sim's clock calls it every checkpointInterval.
+func (s *Sim) takeCheckpoint() {
+	if s.prespawn {
+		return
+	}
+
+	now := s.State.SimTime
+
+	for len(s.checkpoints) > 0 && now.Sub(s.checkpoints[0].time) > checkpointHistory {
+		s.checkpoints = s.checkpoints[1:]
+	}
+
+	cp := checkpoint{time: now}
+	for _, snap := range s.snapshotters() {
+		cp.snapshots = append(cp.snapshots, snap.Snapshot())
+	}
+	s.checkpoints = append(s.checkpoints, cp)
+}
+
+// Rewind returns the sim to the most recent checkpoint at least d before
+// the current sim time or to the oldest one, if there isn't one that far
+// back.
+func (s *Sim) Rewind(tcp string, d time.Duration) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if len(s.checkpoints) == 0 {
+		return ErrNoCheckpoint
+	}
+
+	target := s.State.SimTime.Add(-d)
+	idx := 0
+	for i, cp := range s.checkpoints {
+		if !cp.time.After(target) {
+			idx = i
+		}
+	}
+	cp := s.checkpoints[idx]
+	elapsed := s.State.SimTime.Sub(cp.time)
+
+	// Live traffic stays as it is now.
+	live := make(map[string]*av.Aircraft)
+	for callsign, ac := range s.State.Aircraft {
+		if s.isExternalAircraft(callsign) {
+			live[callsign] = ac
+		}
+	}
+
+	for i, snap := range s.snapshotters() {
+		snap.Restore(cp.snapshots[i])
+	}
+
+	for callsign := range s.State.Aircraft {
+		if s.isExternalAircraft(callsign) {
+			delete(s.State.Aircraft, callsign)
+		}
+	}
+	for callsign, ac := range live {
+		s.State.Aircraft[callsign] = ac
+	}
+	// Keep the checkpoint we went back to so that it's possible to rewind
+	// to it again.
+	s.checkpoints = s.checkpoints[:idx+1]
+
+	// Things that are based on the sim time but aren't worth
+	// checkpointing.
+	s.clock.Rewound()
+	s.stopScript() // restarted at the next update; see script.go
+	s.quietSince = time.Time{}
+	s.export.lastExport = time.Time{}
+	for callsign := range s.PseudoPilotAircraft {
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(s.PseudoPilotAircraft, callsign)
+		}
+	}
+
+	s.lg.Info("rewound", slog.String("tcp", tcp), slog.Duration("elapsed", elapsed))
+	s.eventStream.Post(Event{Type: SimRewoundEvent})
+	s.eventStream.Post(Event{
+		Type:    GlobalMessageEvent,
+		Message: fmt.Sprintf("%s has rewound the sim by %s", tcp, elapsed.Round(time.Second)),
+	})
+
+	return nil
+}
@@ -0,0 +1,253 @@
+// pkg/sim/checkpoint_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+
+	"github.com/brunoga/deep"
+)
+
+func makeCheckpointTestSim(t *testing.T) *Sim {
+	alt := float32(5000)
+	return newTestSim(t, &State{
+		Aircraft: map[string]*av.Aircraft{
+			"AAL1": {Callsign: "AAL1", Nav: av.Nav{Altitude: av.NavAltitude{Assigned: &alt}}},
+			"UAL2": {Callsign: "UAL2"},
+		},
+		SimTime: testSimTime,
+	})
+}
+
+func TestRewindTCAS(t *testing.T) {
+	s := makeCheckpointTestSim(t)
+	s.tcasAltitudes = map[string]float32{"AAL1": 5000, "UAL2": 5400}
+	s.takeCheckpoint()
+
+	// AAL1 gets an RA after the checkpoint.
+	s.State.SimTime = s.State.SimTime.Add(30 * time.Second)
+	ac := s.State.Aircraft["AAL1"]
+	prior := ac.Nav.Altitude
+	s.TCASRAs = append(s.TCASRAs, TCASRA{Callsign: "AAL1", Intruder: "UAL2", Sense: "descend",
+		Start: s.State.SimTime, PriorAltitude: prior})
+	ra := float32(4000)
+	ac.Nav.Altitude = av.NavAltitude{Assigned: &ra, Expedite: true}
+	s.tcasAltitudes = map[string]float32{"AAL1": 4900, "UAL2": 5400}
+
+	if err := s.Rewind("2K", time.Minute); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(s.TCASRAs) != 0 || s.activeRA("AAL1") != nil {
+		t.Errorf("RA still active after rewind: %+v", s.TCASRAs)
+	}
+	if alt := s.tcasAltitudes["AAL1"]; alt != 5000 {
+		t.Errorf("TCAS altitude %f, expected 5000", alt)
+	}
+	// Nothing should put the RA's prior altitude back.
+	s.updateActiveRAs()
+	ac = s.State.Aircraft["AAL1"]
+	if alt := ac.Nav.Altitude.Assigned; alt == nil || *alt != 5000 || ac.Nav.Altitude.Expedite {
+		t.Errorf("unexpected altitude after rewind: %+v", ac.Nav.Altitude)
+	}
+}
+
+// simNotCheckpointed gives the Sim fields that snapshotters deliberately
+// leaves out: configuration from the scenario, the controllers,
+// connections to other systems, caches, and the script, which is
+// restarted on rewind.
+var simNotCheckpointed = []string{
+	"mu", "SignOnPositions", "humanControllers", "worldUpdates", "worldVersions", "eventStream", "lg",
+	"VirtualHandoffs", "ReportingPoints", "clock", "lastLogTime", "prespawn",
+	"prespawnUncontrolledOnly", "TrackHistoryDepth", "quietSince", "checkpoints", "LOAs", "APREQs",
+	"AirspaceVolumes", "LocalAirspace", "WeatherScript", "HazardScript", "RunwayFlows", "Script",
+	"script", "lessonEvents", "scoringEvents", "batch", "Instructors", "PseudoPilots",
+	"PseudoPilotAircraft", "aircraftIndex", "NetworkConfig", "NetworkAircraft", "network",
+	"networkRetry", "ADSBConfig", "ADSBAircraft", "adsbFeed", "adsbRetry", "FederationConfig",
+	"FederatedAircraft", "federation", "federationRetry", "federationTracksSent", "ExportConfig",
+	"export", "StreamConfig", "streaming", "Deterministic", "workers", "bravoAirspace", "charlieAirspace",
+}
+
+func TestCheckpointCoverage(t *testing.T) {
+	s := makeCheckpointTestSim(t)
+
+	snapshotted := make(map[uintptr]bool)
+	for _, snap := range s.snapshotters() {
+		if st, ok := snap.(*State); ok {
+			snapshotted[reflect.ValueOf(s).Elem().FieldByName("State").UnsafeAddr()] = st == s.State
+		} else {
+			snapshotted[reflect.ValueOf(snap).Field(0).Pointer()] = true
+		}
+	}
+
+	v := reflect.ValueOf(s).Elem()
+	for i := range v.NumField() {
+		name := v.Type().Field(i).Name
+		have, excluded := snapshotted[v.Field(i).UnsafeAddr()], slices.Contains(simNotCheckpointed, name)
+		if !have && !excluded {
+			t.Errorf("%s: not checkpointed; add it to snapshotters or to simNotCheckpointed", name)
+		} else if have && excluded {
+			t.Errorf("%s: both checkpointed and excluded", name)
+		}
+	}
+}
+
+func TestRewindRestoresSimState(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		get    func(s *Sim) any
+		change func(s *Sim)
+	}{
+		{"coordination",
+			func(s *Sim) any { return []any{s.Coordination, s.CoordinatedAltitudes} },
+			func(s *Sim) {
+				s.Coordination = append(s.Coordination, Coordination{Callsign: "AAL1", FromController: "2K"})
+				s.CoordinatedAltitudes = map[string]int{"AAL1": 9000}
+			}},
+		{"releases",
+			func(s *Sim) any { return s.State.Releases },
+			func(s *Sim) {
+				s.State.Releases = append(s.State.Releases, Release{Callsign: "AAL1", Status: ReleaseRequested})
+			}},
+		{"practice approaches",
+			func(s *Sim) any { return []any{s.PracticeApproaches, s.NextPracticeApproachSpawn} },
+			func(s *Sim) {
+				s.PracticeApproaches = map[string]*PracticeApproach{"N123": {Airport: "KFRG", LowApproaches: 2}}
+				s.NextPracticeApproachSpawn = s.State.SimTime.Add(10 * time.Minute)
+			}},
+		{"alerts",
+			func(s *Sim) any { return []any{s.loaChecks, s.pointOutAdvisories, s.airspaceViolations} },
+			func(s *Sim) {
+				s.loaChecks = map[string]*loaCheck{"AAL1/CAMRN": {crossed: true}}
+				s.pointOutAdvisories = map[string]*pointOutAdvisory{"AAL1/2K": {TrackingController: "1V"}}
+				s.airspaceViolations = map[string]bool{"N123/B": true}
+			}},
+		{"atis and svfr",
+			func(s *Sim) any { return []any{s.atisReported, s.svfrIntruders} },
+			func(s *Sim) {
+				s.atisReported = map[string]string{"AAL1": "B"}
+				s.svfrIntruders = map[string]bool{"N123": true}
+			}},
+		{"spawns",
+			func(s *Sim) any {
+				return []any{s.NextInboundSpawn, s.NextAmbientVFRSpawn, s.NextVehicleSpawn, s.NextSVFRSpawn}
+			},
+			func(s *Sim) {
+				s.NextInboundSpawn = map[string]time.Time{"CAMRN": s.State.SimTime.Add(time.Minute)}
+				s.NextAmbientVFRSpawn = s.State.SimTime.Add(2 * time.Minute)
+				s.NextVehicleSpawn = s.State.SimTime.Add(3 * time.Minute)
+				s.NextSVFRSpawn = s.State.SimTime.Add(4 * time.Minute)
+			}},
+		{"sectorizations",
+			func(s *Sim) any { return []any{s.FutureSectorizations, s.State.Sectorization, s.State.Airspace} },
+			func(s *Sim) {
+				s.FutureSectorizations = s.FutureSectorizations[1:]
+				s.State.Sectorization = "combined"
+				s.State.Airspace = map[string]map[string][]av.ControllerAirspaceVolume{"2K": nil}
+			}},
+		{"runway closures",
+			func(s *Sim) any {
+				return []any{s.State.NOTAMs, s.closedRunwayRates, s.State.LaunchConfig.DepartureRates}
+			},
+			func(s *Sim) {
+				s.State.NOTAMs = append(s.State.NOTAMs, NOTAM{Id: 1, Airport: "KJFK", Subject: "4L"})
+				s.closedRunwayRates = map[int]map[string]map[string]float32{1: {"4L": {"default": 30}}}
+				delete(s.State.LaunchConfig.DepartureRates["KJFK"], "4L")
+			}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := makeCheckpointTestSim(t)
+			s.FutureSectorizations = []FutureSectorization{{Name: "combined", Time: s.State.SimTime.Add(time.Hour)}}
+			s.State.Sectorization = "split"
+			s.State.LaunchConfig.DepartureRates = map[string]map[string]map[string]float32{
+				"KJFK": {"4L": {"default": 30}},
+			}
+			s.takeCheckpoint()
+			expected := deep.MustCopy(test.get(s))
+
+			s.State.SimTime = s.State.SimTime.Add(30 * time.Second)
+			test.change(s)
+			if reflect.DeepEqual(test.get(s), expected) {
+				t.Fatalf("change didn't change anything")
+			}
+
+			if err := s.Rewind("2K", time.Minute); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got := test.get(s); !reflect.DeepEqual(got, expected) {
+				t.Errorf("got %+v after rewind, expected %+v", got, expected)
+			}
+		})
+	}
+}
+
+// TestStateSnapshot changes each of the State's fields and checks that
+// only the checkpointed ones are restored.
+func TestStateSnapshot(t *testing.T) {
+	ss := &State{SimTime: time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)}
+	snap := ss.Snapshot()
+
+	var change func(v reflect.Value) bool
+	change = func(v reflect.Value) bool {
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(v.Interface().(time.Time).Add(time.Hour)))
+			return true
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			v.Set(reflect.MakeMap(v.Type()))
+			v.SetMapIndex(reflect.Zero(v.Type().Key()), reflect.Zero(v.Type().Elem()))
+		case reflect.Slice:
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		case reflect.Pointer:
+			v.Set(reflect.New(v.Type().Elem()))
+		case reflect.String:
+			v.SetString(v.String() + "x")
+		case reflect.Bool:
+			v.SetBool(!v.Bool())
+		case reflect.Int, reflect.Int64:
+			v.SetInt(v.Int() + 1)
+		case reflect.Float32:
+			v.SetFloat(v.Float() + 1)
+		case reflect.Array:
+			return change(v.Index(0))
+		case reflect.Struct:
+			for i := range v.NumField() {
+				if v.Type().Field(i).IsExported() && change(v.Field(i)) {
+					return true
+				}
+			}
+			return false
+		default:
+			return false
+		}
+		return true
+	}
+
+	v := reflect.ValueOf(ss).Elem()
+	before := deep.MustCopy(*ss)
+	for i := range v.NumField() {
+		if !change(v.Field(i)) {
+			t.Fatalf("%s: unable to change %s", v.Type().Field(i).Name, v.Field(i).Type())
+		}
+	}
+	after := deep.MustCopy(*ss)
+
+	ss.Restore(snap)
+
+	for i := range v.NumField() {
+		name := v.Type().Field(i).Name
+		expected := util.Select(stateNotCheckpointed[name], reflect.ValueOf(after), reflect.ValueOf(before)).Field(i)
+		if !reflect.DeepEqual(v.Field(i).Interface(), expected.Interface()) {
+			t.Errorf("%s: got %+v, expected %+v", name, v.Field(i).Interface(), expected.Interface())
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// pkg/sim/coast.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+// When none of the facility's radars can see an associated track, it
+// coasts: its position is extrapolated from where it was last seen. Once
+// a target is seen again, the track is automatically re-associated with
+// it if exactly one target with the track's beacon code is within a gate
+// around the extrapolated position. Otherwise the re-association is
+// ambiguous; an AmbiguousTrackEvent is posted and the track stays marked
+// ambiguous (AMB in STARS) until a later scan finds a single match or the
+// track is dropped.
+
+const (
+	// Tracks that aren't seen for this long are coasting; ones seen again
+	// sooner are just missed hits.
+	coastDelay = 10 * time.Second
+	// The gate around the extrapolated position grows the longer the
+	// track coasts.
+	reassociationGate        = 2 // nm
+	reassociationGatePerMin  = 1 // nm
+	maxReassociationGateSize = 6 // nm
+)
+
+// CoastTrack is an associated track whose target hasn't been seen.
+type CoastTrack struct {
+	Callsign string
+	Squawk   av.Squawk
+	// Where the target was last seen and its course then.
+	Position    math.Point2LL
+	Heading     float32
+	Groundspeed float32
+	LastSeen    time.Time
+	// Set if a target was seen again but couldn't be re-associated.
+	Ambiguous bool
+}
+
+// Coasting returns whether the track has been lost long enough to be
+// displayed as coasting.
+func (ct *CoastTrack) Coasting(now time.Time) bool {
+	return now.Sub(ct.LastSeen) >= coastDelay
+}
+
+// Extrapolate returns where the track is expected to be at the given
+// time.
+func (ct *CoastTrack) Extrapolate(now time.Time, nmPerLongitude, magneticVariation float32) math.Point2LL {
+	dist := ct.Groundspeed * float32(now.Sub(ct.LastSeen).Hours())
+	return math.Offset2LL(ct.Position, ct.Heading, dist, nmPerLongitude, magneticVariation)
+}
+
+func (ct *CoastTrack) gate(now time.Time) float32 {
+	return min(reassociationGate+reassociationGatePerMin*float32(now.Sub(ct.LastSeen).Minutes()),
+		maxReassociationGateSize)
+}
+
+// radarVisibility returns whether any of the facility's radars has a
+// primary or beacon return from the aircraft. If the facility hasn't
+// specified radars, everything is visible.
+func (s *Sim) radarVisibility(ac *av.Aircraft) (primary, secondary bool) {
+	sites := s.State.STARSFacilityAdaptation.RadarSites
+	if len(sites) == 0 {
+		return true, true
+	}
+	for _, site := range sites {
+		p, sec, _ := site.CheckVisibility(ac.Position(), int(ac.Altitude()))
+		primary, secondary = primary || p, secondary || sec
+	}
+	return
+}
+
+// updateCoastTracks is called once a second.
+func (s *Sim) updateCoastTracks() {
+	now := s.State.SimTime
+	if s.State.CoastTracks == nil {
+		s.State.CoastTracks = make(map[string]*CoastTrack)
+	}
+
+	for callsign := range s.State.CoastTracks {
+		if ac, ok := s.State.Aircraft[callsign]; !ok || ac.TrackingController == "" {
+			// Landed or the track was dropped.
+			delete(s.State.CoastTracks, callsign)
+		}
+	}
+
+	for callsign, ac := range s.State.Aircraft {
+		if ac.TrackingController == "" || ac.WaitingForLaunch {
+			continue
+		}
+
+		p, sec := s.radarVisibility(ac)
+		ct, ok := s.State.CoastTracks[callsign]
+		if !p && !sec {
+			if !ok {
+				s.State.CoastTracks[callsign] = &CoastTrack{
+					Callsign:    callsign,
+					Squawk:      ac.Squawk,
+					Position:    ac.Position(),
+					Heading:     ac.Heading(),
+					Groundspeed: ac.GS(),
+					LastSeen:    now,
+				}
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if !ct.Coasting(now) {
+			// Seen again before it started coasting.
+			delete(s.State.CoastTracks, callsign)
+			continue
+		}
+
+		candidates := s.reassociationCandidates(ct)
+		if len(candidates) == 1 && candidates[0] == callsign {
+			s.lg.Info("track re-associated", slog.String("callsign", callsign),
+				slog.Duration("coasted", now.Sub(ct.LastSeen)))
+			delete(s.State.CoastTracks, callsign)
+		} else if !ct.Ambiguous {
+			ct.Ambiguous = true
+			s.lg.Info("ambiguous track re-association", slog.String("callsign", callsign),
+				slog.Any("candidates", candidates))
+
+			var msg string
+			switch len(candidates) {
+			case 0:
+				msg = fmt.Sprintf("no target with code %s near its coasted position", ct.Squawk)
+			case 1:
+				msg = fmt.Sprintf("another target with code %s near its coasted position", ct.Squawk)
+			default:
+				msg = fmt.Sprintf("%d targets with code %s near its coasted position", len(candidates), ct.Squawk)
+			}
+			s.eventStream.Post(Event{
+				Type:         AmbiguousTrackEvent,
+				Callsign:     callsign,
+				ToController: ac.TrackingController,
+				Message:      msg,
+			})
+		}
+	}
+}
+
+// reassociationCandidates returns the callsigns of the aircraft with
+// beacon returns whose code matches the coasting track's and that are
+// within its gate.
+func (s *Sim) reassociationCandidates(ct *CoastTrack) []string {
+	now := s.State.SimTime
+	p := ct.Extrapolate(now, s.State.NmPerLongitude, s.State.MagneticVariation)
+	gate := ct.gate(now)
+
+	var candidates []string
+	for _, ac := range s.aircraftIndex.NearbyAircraft(p, gate) {
+		if ac.WaitingForLaunch || ac.Squawk != ct.Squawk {
+			continue
+		}
+		if _, sec := s.radarVisibility(ac); !sec {
+			continue
+		}
+		candidates = append(candidates, ac.Callsign)
+	}
+	return candidates
+}
@@ -0,0 +1,278 @@
+// pkg/sim/compliance.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Aircraft that a human controller is working are monitored for
+// compliance with the next crossing restriction they've been given:
+// either one assigned by the controller ("cross MERIT at 10000") or one
+// charted on a STAR that they're descending via. If an aircraft's
+// current rate of climb or descent won't get it to the restriction and
+// it's close to being unable to, a RestrictionWarningEvent is posted so
+// that the controller can intervene. How the aircraft actually crossed
+// the fix is recorded in the ComplianceLog, and misses are posted as
+// RestrictionMissedEvents.
+
+// ComplianceRecord records how an aircraft met a crossing restriction.
+type ComplianceRecord struct {
+	Time        time.Time `json:"time"`
+	Callsign    string    `json:"callsign"`
+	Controller  string    `json:"controller"`
+	Fix         string    `json:"fix"`
+	Kind        string    `json:"kind"` // "crossing" or "descend via"
+	Restriction string    `json:"restriction"`
+	Altitude    int       `json:"altitude"`
+	IAS         int       `json:"ias"`
+	Warned      bool      `json:"warned"` // non-compliance was projected
+	Compliant   bool      `json:"compliant"`
+}
+
+const (
+	// Altitudes within this many feet are considered to meet a
+	// restriction; speeds are allowed slightly more slop.
+	restrictionAltitudeTolerance = 100
+	restrictionSpeedTolerance    = 10
+	// Aircraft are considered to have crossed a fix once they've come
+	// within this many nm of it and it's no longer ahead of them.
+	crossingRadius = 3
+	// A warning is given once making the restriction would need this
+	// fraction of the aircraft's maximum climb or descent rate.
+	restrictionWarningRateFraction = 0.8
+)
+
+// crossingWindow is an altitude range and speed limit that an aircraft
+// is to cross a fix within, whether it's from a restriction in the
+// aircraft's clearance, an LOA, or a scoring rule; all of them are
+// evaluated the same way.
+type crossingWindow struct {
+	Altitude *av.AltitudeRestriction // nil if none
+	MaxSpeed float32                 // 0 if none
+	// Coordinated is an altitude that was coordinated with the receiving
+	// controller (0 if none was); it's acceptable as well.
+	Coordinated float32
+}
+
+// makeCrossingWindow returns the window for an LOA-style [low, high]
+// altitude range and maximum speed, either of which may be zero.
+func makeCrossingWindow(altitude [2]int, maxSpeed int) crossingWindow {
+	w := crossingWindow{MaxSpeed: float32(maxSpeed)}
+	if altitude[1] != 0 {
+		w.Altitude = &av.AltitudeRestriction{Range: [2]float32{float32(altitude[0]), float32(altitude[1])}}
+	}
+	return w
+}
+
+func (w crossingWindow) altitudeOK(alt float32) bool {
+	return w.Altitude == nil || math.Abs(w.Altitude.TargetAltitude(alt)-alt) <= restrictionAltitudeTolerance ||
+		(w.Coordinated != 0 && math.Abs(w.Coordinated-alt) <= restrictionAltitudeTolerance)
+}
+
+func (w crossingWindow) speedOK(ias float32) bool {
+	return w.MaxSpeed == 0 || ias <= w.MaxSpeed+restrictionSpeedTolerance
+}
+
+// crossingProblem returns a description of how crossing the fix at the
+// given altitude and speed is outside of the window, or "" if it isn't.
+func (w crossingWindow) crossingProblem(alt, ias float32) string {
+	var problems []string
+	if !w.altitudeOK(alt) {
+		problems = append(problems, fmt.Sprintf("at %d, not %s", int(alt+0.5), w.Altitude.Encoded()))
+	}
+	if !w.speedOK(ias) {
+		problems = append(problems, fmt.Sprintf("at %d knots, not %d or less", int(ias), int(w.MaxSpeed)))
+	}
+	return strings.Join(problems, " and ")
+}
+
+// clearanceProblem returns a description of how an aircraft at the given
+// altitude that has been assigned the given altitude and speed (nil if
+// not) has been cleared outside of the window, or "" if it hasn't. An
+// altitude clearance is only a problem if it would take the aircraft
+// through or out of the window; clearing a departure to an interim
+// altitude below it is fine, for example.
+func (w crossingWindow) clearanceProblem(alt float32, assignedAlt, assignedSpeed *float32) string {
+	var problems []string
+	if w.Altitude != nil && assignedAlt != nil && *assignedAlt != w.Coordinated {
+		cleared, lo, hi := *assignedAlt, w.Altitude.Range[0], w.Altitude.Range[1]
+		if (cleared < lo && alt >= lo-restrictionAltitudeTolerance) ||
+			(hi != 0 && cleared > hi && alt <= hi+restrictionAltitudeTolerance) {
+			problems = append(problems, fmt.Sprintf("cleared to %d, not %s", int(cleared), w.Altitude.Encoded()))
+		}
+	}
+	if w.MaxSpeed != 0 && assignedSpeed != nil && *assignedSpeed > w.MaxSpeed {
+		problems = append(problems, fmt.Sprintf("assigned %d knots, not %d or less", int(*assignedSpeed), int(w.MaxSpeed)))
+	}
+	return strings.Join(problems, " and ")
+}
+
+// monitoredRestriction is the restriction that is currently being
+// monitored for an aircraft.
+type monitoredRestriction struct {
+	Fix         string
+	Location    math.Point2LL
+	Kind        string
+	Altitude    *av.AltitudeRestriction
+	Speed       float32 // 0 if none
+	Controller  string
+	Warned      bool
+	AltitudeNow float32 // for the vertical rate
+}
+
+func (mr *monitoredRestriction) summary() string {
+	var s string
+	if mr.Altitude != nil {
+		s = mr.Altitude.Summary()
+	}
+	if mr.Speed != 0 {
+		if s != "" {
+			s += " "
+		}
+		s += fmt.Sprintf("at %.0f knots", mr.Speed)
+	}
+	return s
+}
+
+// nextRestriction returns the first restriction in the aircraft's route
+// that it is expected to meet, if any.
+func nextRestriction(in av.Intent) *monitoredRestriction {
+	if len(in.Constraints) == 0 {
+		return nil
+	}
+	c := in.Constraints[0]
+	return &monitoredRestriction{Fix: c.Fix, Location: c.Location, Kind: c.Kind, Altitude: c.Altitude, Speed: c.Speed}
+}
+
+func sameRestriction(a, b *monitoredRestriction) bool {
+	return a.Fix == b.Fix && a.Kind == b.Kind && a.Speed == b.Speed &&
+		(a.Altitude == nil) == (b.Altitude == nil) && (a.Altitude == nil || *a.Altitude == *b.Altitude)
+}
+
+// checkRestrictionCompliance is called once a second.
+func (s *Sim) checkRestrictionCompliance() {
+	if s.monitoredRestrictions == nil {
+		s.monitoredRestrictions = make(map[string]*monitoredRestriction)
+	}
+
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		prev := s.monitoredRestrictions[callsign]
+
+		var next *monitoredRestriction
+		if in, ok := s.State.Intent(callsign); ok && ac.IsAirborne() && s.isActiveHumanController(ac.ControllingController) {
+			next = nextRestriction(in)
+		}
+
+		if prev != nil && (next == nil || !sameRestriction(prev, next)) {
+			// If the fix is no longer in the route and the aircraft is
+			// near it, it has crossed it; otherwise the restriction has
+			// been changed or canceled.
+			if !ac.RouteIncludesFix(prev.Fix) && math.NMDistance2LL(ac.Position(), prev.Location) < crossingRadius {
+				s.recordRestrictionCrossing(ac, prev)
+			}
+			prev = nil
+		}
+
+		if next == nil {
+			delete(s.monitoredRestrictions, callsign)
+			continue
+		}
+		if prev == nil {
+			next.Controller = ac.ControllingController
+			next.AltitudeNow = ac.Altitude()
+			s.monitoredRestrictions[callsign] = next
+			continue
+		}
+
+		prev.Controller = ac.ControllingController
+		s.projectRestrictionCompliance(ac, prev)
+	}
+
+	for callsign := range s.monitoredRestrictions {
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(s.monitoredRestrictions, callsign)
+		}
+	}
+}
+
+// projectRestrictionCompliance warns the controller if the aircraft isn't
+// going to make the restriction at its current vertical rate and would
+// soon be unable to make it at all.
+func (s *Sim) projectRestrictionCompliance(ac *av.Aircraft, mr *monitoredRestriction) {
+	alt := ac.Altitude()
+	rate := (alt - mr.AltitudeNow) * 60 // ft/minute, since we're called once a second
+	mr.AltitudeNow = alt
+
+	if mr.Altitude == nil || mr.Warned {
+		return
+	}
+	dist, err := ac.Nav.DistanceAlongRoute(mr.Fix)
+	if err != nil || ac.GS() < 1 {
+		return
+	}
+	minutes := dist / ac.GS() * 60
+
+	target := mr.Altitude.TargetAltitude(alt)
+	projected := alt + rate*minutes
+	if math.Abs(mr.Altitude.TargetAltitude(projected)-projected) <= restrictionAltitudeTolerance {
+		return // on track
+	}
+
+	perf := ac.AircraftPerformance()
+	maxRate := util.Select(target < alt, perf.Rate.Descent, perf.Rate.Climb)
+	if minutes > 0 && math.Abs(target-alt)/minutes < restrictionWarningRateFraction*maxRate {
+		// It can still make it easily enough.
+		return
+	}
+
+	mr.Warned = true
+	msg := fmt.Sprintf("projected to cross %s at %s, not %s", mr.Fix, av.FormatAltitude(projected), mr.summary())
+	s.lg.Info("restriction warning", slog.String("callsign", ac.Callsign), slog.String("message", msg))
+	s.eventStream.Post(Event{
+		Type:         RestrictionWarningEvent,
+		Callsign:     ac.Callsign,
+		ToController: mr.Controller,
+		Message:      msg,
+	})
+}
+
+func (s *Sim) recordRestrictionCrossing(ac *av.Aircraft, mr *monitoredRestriction) {
+	alt, ias := ac.Altitude(), ac.IAS()
+	compliant := crossingWindow{Altitude: mr.Altitude, MaxSpeed: mr.Speed}.crossingProblem(alt, ias) == ""
+
+	rec := ComplianceRecord{
+		Time:        s.State.SimTime,
+		Callsign:    ac.Callsign,
+		Controller:  mr.Controller,
+		Fix:         mr.Fix,
+		Kind:        mr.Kind,
+		Restriction: mr.summary(),
+		Altitude:    int(alt + 0.5),
+		IAS:         int(ias + 0.5),
+		Warned:      mr.Warned,
+		Compliant:   compliant,
+	}
+	s.ComplianceLog = append(s.ComplianceLog, rec)
+	s.lg.Info("restriction crossed", slog.Any("record", rec))
+
+	if !compliant {
+		s.eventStream.Post(Event{
+			Type:         RestrictionMissedEvent,
+			Callsign:     ac.Callsign,
+			ToController: mr.Controller,
+			Message: fmt.Sprintf("crossed %s at %s and %d knots, not %s (%s)", mr.Fix, av.FormatAltitude(alt),
+				rec.IAS, rec.Restriction, mr.Kind),
+		})
+	}
+}
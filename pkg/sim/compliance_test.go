@@ -0,0 +1,65 @@
+// pkg/sim/compliance_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+func TestCrossingWindow(t *testing.T) {
+	for _, test := range []struct {
+		w        crossingWindow
+		alt, ias float32
+		problem  string
+	}{
+		{makeCrossingWindow([2]int{10000, 10000}, 250), 10000, 250, ""},
+		{makeCrossingWindow([2]int{10000, 10000}, 250), 10090, 259, ""},
+		{makeCrossingWindow([2]int{10000, 10000}, 250), 10200, 250, "at 10200, not 10000"},
+		{makeCrossingWindow([2]int{10000, 10000}, 250), 9800, 270, "at 9800, not 10000 and at 270 knots, not 250 or less"},
+		{makeCrossingWindow([2]int{8000, 10000}, 0), 9000, 320, ""},
+		{makeCrossingWindow([2]int{8000, 10000}, 0), 7500, 320, "at 7500, not 8000-10000"},
+		{makeCrossingWindow([2]int{0, 0}, 250), 17000, 262, "at 262 knots, not 250 or less"},
+		{crossingWindow{Altitude: &av.AltitudeRestriction{Range: [2]float32{6000, 0}}}, 12000, 300, ""},
+		{crossingWindow{Altitude: &av.AltitudeRestriction{Range: [2]float32{6000, 0}}}, 5000, 300, "at 5000, not 6000+"},
+		{crossingWindow{Altitude: &av.AltitudeRestriction{Range: [2]float32{10000, 10000}}, Coordinated: 12000},
+			12050, 250, ""},
+		{crossingWindow{Altitude: &av.AltitudeRestriction{Range: [2]float32{10000, 10000}}, Coordinated: 12000},
+			11000, 250, "at 11000, not 10000"},
+	} {
+		if p := test.w.crossingProblem(test.alt, test.ias); p != test.problem {
+			t.Errorf("%+v at %.0f/%.0f: got %q, expected %q", test.w, test.alt, test.ias, p, test.problem)
+		}
+	}
+}
+
+func TestCrossingWindowClearance(t *testing.T) {
+	ptr := func(f float32) *float32 { return &f }
+	w := makeCrossingWindow([2]int{10000, 11000}, 250)
+	for _, test := range []struct {
+		alt                   float32
+		assignedAlt, assigned *float32
+		problem               string
+	}{
+		{5000, ptr(7000), nil, ""},   // interim altitude below the window
+		{12000, ptr(10000), nil, ""}, // descending into it
+		{12000, ptr(8000), nil, "cleared to 8000, not 10000-11000"},
+		{9000, ptr(14000), nil, "cleared to 14000, not 10000-11000"},
+		{15000, ptr(13000), nil, ""}, // not yet at the window
+		{12000, nil, ptr(280), "assigned 280 knots, not 250 or less"},
+		{12000, ptr(6000), ptr(250), "cleared to 6000, not 10000-11000"},
+	} {
+		if p := w.clearanceProblem(test.alt, test.assignedAlt, test.assigned); p != test.problem {
+			t.Errorf("at %.0f: got %q, expected %q", test.alt, p, test.problem)
+		}
+	}
+
+	// Clearances to a coordinated altitude are fine.
+	w.Coordinated = 8000
+	if p := w.clearanceProblem(12000, ptr(8000), nil); p != "" {
+		t.Errorf("coordinated altitude: got %q", p)
+	}
+}
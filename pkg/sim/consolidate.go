@@ -0,0 +1,162 @@
+// pkg/sim/consolidate.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"slices"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// A human controller may consolidate other adapted positions that no one
+// is signed in to, so that they work them as well as their own, and may
+// later split them off again. While a position is consolidated, it's in
+// State.Controllers like any other position so that handoffs and point
+// outs can be addressed to it, but they're all delivered to the
+// controller who has it: tracks, inbound handoffs, and aircraft on the
+// position's frequency are transferred to them when it's consolidated,
+// and ResolveController and the NAS computers route anything addressed
+// to the position there afterward.
+//
+// Positions are split when their controller asks to or when someone
+// signs in to one of them; in the latter case, the new controller takes
+// over the tracks that are in the position's airspace.
+
+// ConsolidatePosition consolidates the given position into tcp's.
+func (s *Sim) ConsolidatePosition(tcp, position string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.isActiveHumanController(tcp) {
+		return av.ErrNoController
+	}
+	if _, ok := s.SignOnPositions[position]; !ok || position == tcp {
+		return av.ErrInvalidController
+	}
+	if s.isActiveHumanController(position) {
+		return ErrControllerAlreadySignedIn
+	}
+	if _, ok := s.State.Consolidations[position]; ok {
+		return ErrPositionAlreadyConsolidated
+	}
+
+	if s.State.Consolidations == nil {
+		s.State.Consolidations = make(map[string]string)
+	}
+	s.State.Consolidations[position] = tcp
+	s.State.Controllers[position] = s.SignOnPositions[position]
+	s.transferPosition(position, tcp, nil)
+
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: position + " has been consolidated to " + tcp + ".",
+	})
+	s.lg.Infof("%s: consolidated %s", tcp, position)
+
+	return nil
+}
+
+// SplitPosition splits a position that tcp has consolidated; afterward,
+// it is resolved through the split configuration like any other
+// uncovered position.
+func (s *Sim) SplitPosition(tcp, position string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if s.State.Consolidations[position] != tcp {
+		return ErrNotConsolidated
+	}
+	s.splitPosition(position)
+
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: position + " has been split from " + tcp + ".",
+	})
+	s.lg.Infof("%s: split %s", tcp, position)
+
+	return nil
+}
+
+func (s *Sim) splitPosition(position string) {
+	delete(s.State.Consolidations, position)
+	delete(s.State.Controllers, position)
+}
+
+// splitAllPositions splits all of the positions that tcp has
+// consolidated; it's called when tcp signs off.
+func (s *Sim) splitAllPositions(tcp string) {
+	for _, pos := range util.SortedMapKeys(s.State.Consolidations) {
+		if s.State.Consolidations[pos] == tcp {
+			s.splitPosition(pos)
+		}
+	}
+}
+
+// takeOverSplitPosition is called when a controller has signed in to a
+// position that owner had consolidated; the tracks in its airspace are
+// handed over to them.
+func (s *Sim) takeOverSplitPosition(owner, tcp string) {
+	s.transferPosition(owner, tcp, func(ac *av.Aircraft) bool {
+		for _, vols := range s.State.Airspace[tcp] {
+			if inside, _ := av.InAirspace(ac.Position(), ac.Altitude(), vols); inside {
+				return true
+			}
+		}
+		return false
+	})
+
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: tcp + " has been split from " + owner + ".",
+	})
+}
+
+// transferPosition moves the tracks, handoffs, and point outs that are
+// for the from position to the to position, both for the aircraft
+// themselves and in the STARS computer. If filter is non-nil, only the
+// aircraft it returns true for are transferred.
+func (s *Sim) transferPosition(from, to string, filter func(*av.Aircraft) bool) {
+	fromCtrl, fok := s.State.Controllers[from]
+	toCtrl, tok := s.State.Controllers[to]
+	comp := s.State.STARSComputer()
+
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		if filter != nil && !filter(ac) {
+			continue
+		}
+		ac.TransferTracks(from, to)
+		if ac.RedirectedHandoff.RedirectedTo == from {
+			ac.RedirectedHandoff.RedirectedTo = to
+		}
+
+		if fok && tok {
+			comp.TransferTrack(callsign, fromCtrl.Id(), toCtrl.Id())
+		}
+	}
+}
+
+// resolveConsolidation returns the position that is working tcp.
+func (ss *State) resolveConsolidation(tcp string) string {
+	if c, ok := ss.Consolidations[tcp]; ok {
+		return c
+	}
+	return tcp
+}
+
+// ConsolidatedPositionsString returns a summary of the positions that
+// tcp has consolidated, e.g. "2B 2C".
+func (ss *State) ConsolidatedPositionsString(tcp string) string {
+	var pos []string
+	for p, c := range ss.Consolidations {
+		if c == tcp {
+			pos = append(pos, p)
+		}
+	}
+	slices.Sort(pos)
+	return strings.Join(pos, " ")
+}
@@ -40,17 +40,19 @@ func (s *Sim) dispatchCommand(tcp string, callsign string,
 }
 
 // Commands that are allowed by the controlling controller, who may not still have the track;
-// e.g., turns after handoffs.
+// e.g., turns after handoffs. They are also allowed by the pseudo-pilot flying the aircraft, if any.
 func (s *Sim) dispatchControllingCommand(tcp string, callsign string,
 	cmd func(tcp string, ac *av.Aircraft) []av.RadioTransmission) error {
 	return s.dispatchCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) error {
-			if ac.ControllingController != tcp && !s.Instructors[tcp] {
+			if ac.ControllingController != tcp && !s.Instructors[tcp] && !s.isPseudoPilotFor(tcp, ac.Callsign) {
 				return av.ErrOtherControllerHasTrack
 			}
 			return nil
 		},
-		cmd)
+		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			return s.radioForEmergency(tcp, ac, cmd)
+		})
 }
 
 // Commands that are allowed by tracking controller only.
@@ -149,13 +151,7 @@ func (s *Sim) ChangeSquawk(tcp, callsign string, sq av.Squawk) error {
 
 	return s.dispatchControllingCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
-			s.enqueueTransponderChange(ac.Callsign, sq, ac.Mode)
-
-			return []av.RadioTransmission{av.RadioTransmission{
-				Controller: tcp,
-				Message:    "squawk " + sq.String(),
-				Type:       av.RadioTransmissionReadback,
-			}}
+			return s.changeSquawkWithErrors(tcp, ac, sq)
 		})
 }
 
@@ -185,6 +181,7 @@ func (s *Sim) Ident(tcp, callsign string) error {
 				Type:     IdentEvent,
 				Callsign: ac.Callsign,
 			})
+			s.emergencyAction(tcp, ac.Callsign, EmergencyActionIdent)
 
 			return []av.RadioTransmission{av.RadioTransmission{
 				Controller: tcp,
@@ -276,6 +273,36 @@ func (s *Sim) UploadFlightPlan(tcp string, planType int, plan *av.STARSFlightPla
 	return nil
 }
 
+// AmendFlightPlan updates the parts of the aircraft's flight plan that a
+// controller may amend and sends the amendment to the facilities that
+// have the plan.
+func (s *Sim) AmendFlightPlan(tcp, callsign string, fp av.FlightPlan) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	return s.dispatchCommand(tcp, callsign,
+		func(tcp string, ac *av.Aircraft) error {
+			if ac.TrackingController != tcp && !s.Instructors[tcp] {
+				return av.ErrOtherControllerHasTrack
+			}
+			if ac.FlightPlan == nil {
+				return av.ErrNoFlightPlan
+			}
+			return nil
+		},
+		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			afp := ac.FlightPlan
+			afp.Rules, afp.AircraftType = fp.Rules, fp.AircraftType
+			afp.Altitude, afp.Route, afp.Exit = fp.Altitude, fp.Route, fp.Exit
+
+			ctrl := s.State.Controllers[tcp]
+			if err := s.State.ERAMComputers.AmendFlightPlan(ac, ctrl.Facility, s.State.SimTime); err != nil {
+				s.lg.Warnf("%s: amendment: %v", callsign, err)
+			}
+			return nil
+		})
+}
+
 func (s *Sim) InitiateTrack(tcp, callsign string, fp *av.STARSFlightPlan) error {
 	s.mu.Lock(s.lg)
 	defer s.mu.Unlock(s.lg)
@@ -319,6 +346,7 @@ func (s *Sim) InitiateTrack(tcp, callsign string, fp *av.STARSFlightPlan) error
 				Callsign:     ac.Callsign,
 				ToController: tcp,
 			})
+			s.emergencyAction(tcp, ac.Callsign, EmergencyActionTrack)
 
 			return nil
 		})
@@ -355,6 +383,7 @@ func (s *Sim) HandoffTrack(tcp, callsign, toTCP string) error {
 
 	return s.dispatchCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) error {
+			toTCP = s.State.resolveConsolidation(toTCP)
 			if ac.TrackingController != tcp {
 				return av.ErrOtherControllerHasTrack
 			} else if _, ok := s.State.Controllers[toTCP]; !ok {
@@ -389,6 +418,8 @@ func (s *Sim) HandoffTrack(tcp, callsign, toTCP string) error {
 }
 
 func (s *Sim) handoffTrack(fromTCP, toTCP string, callsign string) {
+	toTCP = s.State.resolveConsolidation(toTCP)
+
 	s.eventStream.Post(Event{
 		Type:           OfferedHandoffEvent,
 		FromController: fromTCP,
@@ -406,13 +437,22 @@ func (s *Sim) handoffTrack(fromTCP, toTCP string, callsign string) {
 		//s.lg.Errorf("HandoffTrack: %v", err)
 	}
 
+	if s.isNetworkAircraft(callsign) && !s.isActiveHumanController(toTCP) {
+		// The receiving controller is on the network and will accept it
+		// (or not) there.
+		s.offerNetworkHandoff(callsign, toTCP)
+		return
+	}
+	if s.isRemoteController(toTCP) {
+		// The receiving controller is in the federated sim.
+		s.offerFederatedHandoff(fromTCP, toTCP, callsign)
+		return
+	}
+
 	// Add them to the auto-accept map even if the target is
 	// covered; this way, if they sign off in the interim, we still
 	// end up accepting it automatically.
-	acceptDelay := 4 + rand.Intn(10)
-	s.Handoffs[callsign] = Handoff{
-		Time: s.State.SimTime.Add(time.Duration(acceptDelay) * time.Second),
-	}
+	s.Handoffs[callsign] = s.makeVirtualHandoff(fromTCP)
 }
 
 func (s *Sim) HandoffControl(tcp, callsign string) error {
@@ -430,7 +470,14 @@ func (s *Sim) HandoffControl(tcp, callsign string) error {
 			var radioTransmissions []av.RadioTransmission
 			// Immediately respond to the current controller that we're
 			// changing frequency.
+			if !s.emergencyCanHear(ac.Callsign) {
+				return nil
+			}
 			if octrl, ok := s.State.Controllers[ac.TrackingController]; ok {
+				if ac.TrackingController != tcp && s.missedFrequencyChange(tcp, ac) {
+					// The pilot didn't hear it.
+					return nil
+				}
 				if ac.TrackingController == tcp {
 					radioTransmissions = append(radioTransmissions, av.RadioTransmission{
 						Controller: ac.ControllingController,
@@ -439,8 +486,8 @@ func (s *Sim) HandoffControl(tcp, callsign string) error {
 					})
 					return radioTransmissions
 				}
-				bye := rand.Sample("good day", "seeya")
-				contact := rand.Sample("contact ", "over to ", "")
+				bye := rand.SampleWith(&s.Rand, "good day", "seeya")
+				contact := rand.SampleWith(&s.Rand, "contact ", "over to ", "")
 				goodbye := contact + octrl.RadioName + " on " + octrl.Frequency.String() + ", " + bye
 				radioTransmissions = append(radioTransmissions, av.RadioTransmission{
 					Controller: ac.ControllingController,
@@ -502,6 +549,13 @@ func (s *Sim) AcceptHandoff(tcp, callsign string) error {
 				Callsign:       ac.Callsign,
 			})
 
+			if s.isNetworkAircraft(ac.Callsign) {
+				s.acceptNetworkHandoff(ac)
+			}
+			if s.isRemoteController(ac.TrackingController) {
+				s.acceptFederatedHandoff(ac, tcp)
+			}
+
 			ac.HandoffTrackController = ""
 			ac.TrackingController = tcp
 
@@ -550,6 +604,7 @@ func (s *Sim) CancelHandoff(tcp, callsign string) error {
 func (s *Sim) RedirectHandoff(tcp, callsign, controller string) error {
 	return s.dispatchCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) error {
+			controller = s.State.resolveConsolidation(controller)
 			if octrl, ok := s.State.Controllers[controller]; !ok {
 				return av.ErrNoController
 			} else if octrl.Id() == tcp || octrl.Id() == ac.TrackingController {
@@ -649,6 +704,7 @@ func (s *Sim) ForceQL(tcp, callsign, controller string) error {
 func (s *Sim) PointOut(fromTCP, callsign, toTCP string) error {
 	return s.dispatchCommand(fromTCP, callsign,
 		func(tcp string, ac *av.Aircraft) error {
+			toTCP = s.State.resolveConsolidation(toTCP)
 			if ac.TrackingController != fromTCP {
 				return av.ErrOtherControllerHasTrack
 			} else if octrl, ok := s.State.Controllers[toTCP]; !ok {
@@ -684,7 +740,7 @@ func (s *Sim) pointOut(callsign string, from *av.Controller, to *av.Controller)
 		//s.lg.Errorf("PointOut: %v", err)
 	}
 
-	acceptDelay := 4 + rand.Intn(10)
+	acceptDelay := 4 + s.Rand.Intn(10)
 	s.PointOuts[callsign] = PointOut{
 		FromController: from.Id(),
 		ToController:   to.Id(),
@@ -822,7 +878,20 @@ func (s *Sim) AssignAltitude(tcp, callsign string, altitude int, afterSpeed bool
 
 	return s.dispatchControllingCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
-			return ac.AssignAltitude(altitude, afterSpeed)
+			return s.radioForRA(tcp, ac, func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+				if h, ok := s.severeHazardAt(ac, altitude); ok && math.Abs(float32(altitude)-ac.Altitude()) >= 100 {
+					return []av.RadioTransmission{av.RadioTransmission{
+						Controller: ac.ControllingController,
+						Message:    "unable " + av.FormatAltitude(float32(altitude)) + ", there's severe " + h.Type + " there",
+						Type:       av.RadioTransmissionUnexpected,
+					}}
+				}
+				if altitude <= 10000 {
+					s.emergencyAction(tcp, ac.Callsign, EmergencyActionDescend)
+				}
+				s.checkPriorityAltitude(tcp, ac, altitude)
+				return s.assignAltitudeWithErrors(tcp, ac, altitude, afterSpeed)
+			})
 		})
 }
 
@@ -893,13 +962,22 @@ func (s *Sim) AssignHeading(hdg *HeadingArgs) error {
 	return s.dispatchControllingCommand(hdg.TCP, hdg.Callsign,
 		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
 			if hdg.Present {
-				return ac.FlyPresentHeading()
+				s.pilotErrorCorrected(ac.Callsign, "heading")
+				return ac.FlyPresentHeading(s.State.SimTime)
 			} else if hdg.LeftDegrees != 0 {
-				return ac.TurnLeft(hdg.LeftDegrees)
+				s.pilotErrorCorrected(ac.Callsign, "heading")
+				return ac.TurnLeft(hdg.LeftDegrees, s.State.SimTime)
 			} else if hdg.RightDegrees != 0 {
-				return ac.TurnRight(hdg.RightDegrees)
+				s.pilotErrorCorrected(ac.Callsign, "heading")
+				return ac.TurnRight(hdg.RightDegrees, s.State.SimTime)
+			} else if _, blocked := s.weatherAhead(ac, float32(hdg.Heading)); blocked {
+				return []av.RadioTransmission{av.RadioTransmission{
+					Controller: ac.ControllingController,
+					Message:    fmt.Sprintf("unable heading %03d due to weather", hdg.Heading),
+					Type:       av.RadioTransmissionUnexpected,
+				}}
 			} else {
-				return ac.AssignHeading(hdg.Heading, hdg.Turn)
+				return s.assignHeadingWithErrors(tcp, ac, hdg.Heading, hdg.Turn)
 			}
 		})
 }
@@ -910,6 +988,7 @@ func (s *Sim) AssignSpeed(tcp, callsign string, speed int, afterAltitude bool) e
 
 	return s.dispatchControllingCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			s.checkPrioritySpeed(tcp, ac, speed)
 			return ac.AssignSpeed(speed, afterAltitude)
 		})
 }
@@ -990,7 +1069,7 @@ func (s *Sim) DirectFix(tcp, callsign, fix string) error {
 
 	return s.dispatchControllingCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
-			return ac.DirectFix(fix)
+			return ac.DirectFix(fix, s.State.SimTime)
 		})
 }
 
@@ -1030,6 +1109,9 @@ func (s *Sim) AtFixCleared(tcp, callsign, fix, approach string) error {
 
 	return s.dispatchControllingCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			if rt := s.unavailableApproach(tcp, ac, approach); rt != nil {
+				return rt
+			}
 			return ac.AtFixCleared(fix, approach)
 		})
 }
@@ -1048,6 +1130,9 @@ func (s *Sim) ExpectApproach(tcp, callsign, approach string) error {
 
 	return s.dispatchControllingCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			if rt := s.unavailableApproach(tcp, ac, approach); rt != nil {
+				return rt
+			}
 			return ac.ExpectApproach(approach, ap, s.lg)
 		})
 }
@@ -1058,11 +1143,20 @@ func (s *Sim) ClearedApproach(tcp, callsign, approach string, straightIn bool) e
 
 	return s.dispatchControllingCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			if rt := s.unavailableApproach(tcp, ac, approach); rt != nil {
+				return rt
+			}
+
+			var rt []av.RadioTransmission
 			if straightIn {
-				return ac.ClearedStraightInApproach(approach)
+				rt = ac.ClearedStraightInApproach(approach)
 			} else {
-				return ac.ClearedApproach(approach, s.lg)
+				rt = ac.ClearedApproach(approach, s.lg)
+			}
+			if !unexpectedResponse(rt) {
+				s.emergencyAction(tcp, ac.Callsign, EmergencyActionApproach)
 			}
+			return rt
 		})
 }
 
@@ -1092,7 +1186,7 @@ func (s *Sim) ClimbViaSID(tcp, callsign string) error {
 
 	return s.dispatchControllingCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
-			return ac.ClimbViaSID()
+			return ac.ClimbViaSID(s.State.SimTime)
 		})
 }
 
@@ -1102,7 +1196,7 @@ func (s *Sim) DescendViaSTAR(tcp, callsign string) error {
 
 	return s.dispatchControllingCommand(tcp, callsign,
 		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
-			return ac.DescendViaSTAR()
+			return ac.DescendViaSTAR(s.State.SimTime)
 		})
 }
 
@@ -1140,7 +1234,7 @@ type FutureControllerContact struct {
 }
 
 func (s *Sim) enqueueControllerContact(callsign, tcp string) {
-	wait := time.Duration(5+rand.Intn(10)) * time.Second
+	wait := time.Duration(5+s.Rand.Intn(10)) * time.Second
 	s.FutureControllerContacts = append(s.FutureControllerContacts,
 		FutureControllerContact{Callsign: callsign, TCP: tcp, Time: s.State.SimTime.Add(wait)})
 }
@@ -1151,7 +1245,7 @@ type FutureOnCourse struct {
 }
 
 func (s *Sim) enqueueDepartOnCourse(callsign string) {
-	wait := time.Duration(10+rand.Intn(15)) * time.Second
+	wait := time.Duration(10+s.Rand.Intn(15)) * time.Second
 	s.FutureOnCourse = append(s.FutureOnCourse,
 		FutureOnCourse{Callsign: callsign, Time: s.State.SimTime.Add(wait)})
 }
@@ -1164,7 +1258,7 @@ type FutureChangeSquawk struct {
 }
 
 func (s *Sim) enqueueTransponderChange(callsign string, code av.Squawk, mode av.TransponderMode) {
-	wait := time.Duration(5+rand.Intn(5)) * time.Second
+	wait := time.Duration(5+s.Rand.Intn(5)) * time.Second
 	s.FutureSquawkChanges = append(s.FutureSquawkChanges,
 		FutureChangeSquawk{Callsign: callsign, Code: code, Mode: mode, Time: s.State.SimTime.Add(wait)})
 }
@@ -1177,7 +1271,7 @@ func (s *Sim) processEnqueued() {
 					ac.ControllingController = c.TCP
 					r := []av.RadioTransmission{av.RadioTransmission{
 						Controller: c.TCP,
-						Message:    ac.ContactMessage(s.ReportingPoints),
+						Message:    ac.ContactMessage(s.ReportingPoints) + priorityCheckIn(ac) + s.atisCheckIn(ac),
 						Type:       av.RadioTransmissionContact,
 					}}
 					s.postRadioEvents(c.Callsign, r)
@@ -1201,7 +1295,7 @@ func (s *Sim) processEnqueued() {
 				if ac, ok := s.State.Aircraft[oc.Callsign]; ok {
 					s.lg.Info("departing on course", slog.String("callsign", ac.Callsign),
 						slog.Int("final_altitude", ac.FlightPlan.Altitude))
-					ac.DepartOnCourse(s.lg)
+					ac.DepartOnCourse(s.State.SimTime, s.lg)
 				}
 				return false
 			}
@@ -0,0 +1,359 @@
+// pkg/sim/convective.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Scenarios may script convective weather: cells given as polygons that
+// appear at a given time, drift with the steering winds, and dissipate.
+// Pilots won't fly through cells of level 3 or above that top out above
+// them. When an aircraft's heading would take it into one, the pilot
+// asks the controller for a deviation; if the controller doesn't approve
+// it (DEV) or give a heading that stays clear before the aircraft gets
+// close, the pilot deviates anyway and a WeatherDeviationEvent is posted,
+// which is scored by the "weather" rubric. Once the way ahead is clear,
+// the pilot reports clear of the weather and rejoins the route or
+// returns to the heading that was assigned before. Headings that would
+// take an aircraft into a cell are refused.
+//
+// Only scripted cells are used; the cells aren't derived from the live
+// weather radar imagery, which is only fetched by the STARS clients.
+
+// WeatherCell is a convective cell given in a scenario's weather script.
+type WeatherCell struct {
+	Name string `json:"name,omitempty"`
+	// Vertices gives the outline of the cell when it appears. It's drawn
+	// as a fan from the first vertex, so it should be convex.
+	Vertices []math.Point2LL `json:"vertices"`
+	Level    int             `json:"level"`         // 1-6, as with the NWS intensity levels
+	Top      int             `json:"top,omitempty"` // feet MSL; unlimited if zero
+	// The cell moves at the given speed (knots) in the given direction
+	// (degrees true).
+	Heading float32 `json:"heading,omitempty"`
+	Speed   float32 `json:"speed,omitempty"`
+	// When the cell appears, relative to the start of the sim, and how
+	// long it lasts; it lasts for the rest of the session if
+	// DurationMinutes is zero.
+	AfterMinutes    float32 `json:"after_minutes,omitempty"`
+	DurationMinutes float32 `json:"duration_minutes,omitempty"`
+}
+
+const (
+	// Pilots won't penetrate cells at this level or above.
+	wxAvoidLevel = 3
+
+	// How far ahead pilots look for weather: the lesser of the distance
+	// and how far they'll go in the time.
+	wxLookaheadNM      = 20
+	wxLookaheadMinutes = 4
+
+	// If the controller doesn't respond to a deviation request in time or
+	// the aircraft gets this close to the cell, the pilot deviates anyway.
+	wxRequestTimeout = 45 * time.Second
+	wxUrgentNM       = 8
+
+	// Pilots stay on their deviation heading at least this long before
+	// checking whether they're clear.
+	wxMinimumDeviation = time.Minute
+)
+
+func (c WeatherCell) Validate() error {
+	if len(c.Vertices) < 3 {
+		return fmt.Errorf("%s: at least three \"vertices\" must be given", c.Name)
+	}
+	if c.Level < 1 || c.Level > 6 {
+		return fmt.Errorf("%s: %d: \"level\" must be between 1 and 6", c.Name, c.Level)
+	}
+	if c.Top < 0 || c.Speed < 0 || c.AfterMinutes < 0 || c.DurationMinutes < 0 {
+		return fmt.Errorf("%s: \"top\", \"speed\", \"after_minutes\", and \"duration_minutes\" must not be negative", c.Name)
+	}
+	return nil
+}
+
+// blocks returns whether aircraft at the given altitude avoid the cell.
+func (c WeatherCell) blocks(alt float32) bool {
+	return c.Level >= wxAvoidLevel && (c.Top == 0 || alt < float32(c.Top))
+}
+
+// ScriptedWeatherCell is a cell from the weather script along with when
+// it is present.
+type ScriptedWeatherCell struct {
+	Cell       WeatherCell
+	Start, End time.Time // End is zero if it lasts indefinitely
+}
+
+func (s *Sim) scheduleWeatherCells(cells []WeatherCell) {
+	for _, c := range cells {
+		sc := ScriptedWeatherCell{
+			Cell:  c,
+			Start: s.State.SimTime.Add(time.Duration(c.AfterMinutes * float32(time.Minute))),
+		}
+		if c.DurationMinutes > 0 {
+			sc.End = sc.Start.Add(time.Duration(c.DurationMinutes * float32(time.Minute)))
+		}
+		s.WeatherScript = append(s.WeatherScript, sc)
+	}
+}
+
+// updateWeatherCells is called once a second; it updates the cells in the
+// State to those that are currently present, moved to where they are now.
+func (s *Sim) updateWeatherCells() {
+	var cells []WeatherCell
+	now := s.State.SimTime
+	for _, sc := range s.WeatherScript {
+		if now.Before(sc.Start) || (!sc.End.IsZero() && now.After(sc.End)) {
+			continue
+		}
+
+		c := sc.Cell
+		nm := c.Speed * float32(now.Sub(sc.Start).Hours())
+		c.Vertices = util.MapSlice(c.Vertices, func(p math.Point2LL) math.Point2LL {
+			return math.Offset2LL(p, c.Heading, nm, s.State.NmPerLongitude, 0)
+		})
+		cells = append(cells, c)
+	}
+	s.State.WeatherCells = cells
+}
+
+// weatherAhead returns the distance to the nearest cell that the aircraft
+// would fly into on the given (magnetic) heading, if there is one within
+// the lookahead distance.
+func (s *Sim) weatherAhead(ac *av.Aircraft, hdg float32) (float32, bool) {
+	if len(s.State.WeatherCells) == 0 {
+		return 0, false
+	}
+
+	lookahead := min(wxLookaheadNM, ac.GS()*wxLookaheadMinutes/60)
+	for d := float32(1); d <= lookahead; d++ {
+		p := math.Offset2LL(ac.Position(), hdg, d, s.State.NmPerLongitude, s.State.MagneticVariation)
+		if s.inWeather(p, ac.Altitude()) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+func (s *Sim) inWeather(p math.Point2LL, alt float32) bool {
+	for _, c := range s.State.WeatherCells {
+		if c.blocks(alt) && math.PointInPolygon2LL(p, c.Vertices) {
+			return true
+		}
+	}
+	return false
+}
+
+// wxDeviation is a deviation around weather that a pilot has asked for or
+// is flying.
+type wxDeviation struct {
+	Heading   float32
+	Turn      av.TurnMethod
+	Degrees   int
+	Requested time.Time
+	// Set once the pilot is flying the deviation heading.
+	Deviating bool
+	Started   time.Time
+	// The heading to return to afterward; the aircraft rejoins its route
+	// if it's nil.
+	Resume *float32
+}
+
+func (d *wxDeviation) String() string {
+	return strconv.Itoa(d.Degrees) + " degrees " + util.Select(d.Turn == av.TurnLeft, "left", "right")
+}
+
+// course returns the heading that the aircraft is flying or will soon be
+// flying if it has been assigned one.
+func course(ac *av.Aircraft) float32 {
+	if hdg, ok := ac.Nav.AssignedHeading(); ok {
+		return hdg
+	}
+	return ac.Heading()
+}
+
+// planDeviation returns the smallest turn off the aircraft's course that
+// avoids the weather ahead, if there is one.
+func (s *Sim) planDeviation(ac *av.Aircraft) *wxDeviation {
+	for deg := 10; deg <= 90; deg += 10 {
+		for _, turn := range []av.TurnMethod{av.TurnLeft, av.TurnRight} {
+			hdg := course(ac) + float32(util.Select(turn == av.TurnLeft, -deg, deg))
+			hdg = math.NormalizeHeading(hdg)
+			if _, blocked := s.weatherAhead(ac, hdg); !blocked {
+				return &wxDeviation{
+					Heading:   hdg,
+					Turn:      turn,
+					Degrees:   deg,
+					Requested: s.State.SimTime,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// deviationCandidate returns whether the pilot of the aircraft will
+// deviate around weather; aircraft that are cleared for an approach or
+// holding are left alone, as are ones that aren't flown by the sim.
+func (s *Sim) deviationCandidate(ac *av.Aircraft) bool {
+	return ac.IsAirborne() && !ac.Nav.Approach.Cleared && ac.Nav.Holding() == nil &&
+		!s.isExternalAircraft(ac.Callsign) && !s.inWeather(ac.Position(), ac.Altitude())
+}
+
+// checkWeatherDeviations is called once a second.
+func (s *Sim) checkWeatherDeviations() {
+	if s.wxDeviations == nil {
+		s.wxDeviations = make(map[string]*wxDeviation)
+	}
+
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		if !s.deviationCandidate(ac) {
+			delete(s.wxDeviations, callsign)
+			continue
+		}
+
+		dev := s.wxDeviations[callsign]
+		if dev != nil && dev.Deviating {
+			s.continueDeviation(ac, dev)
+			continue
+		}
+
+		dist, blocked := s.weatherAhead(ac, course(ac))
+		if !blocked {
+			// Either there's nothing ahead or the controller has
+			// already turned the aircraft clear of it.
+			delete(s.wxDeviations, callsign)
+			continue
+		}
+
+		human := s.isActiveHumanController(ac.ControllingController)
+		if dev == nil {
+			if dev = s.planDeviation(ac); dev == nil {
+				continue
+			}
+			s.wxDeviations[callsign] = dev
+
+			if human && dist > wxUrgentNM {
+				s.postRadioEvents(callsign, []av.RadioTransmission{av.RadioTransmission{
+					Controller: ac.ControllingController,
+					Message:    "request deviation " + dev.String() + " for weather",
+					Type:       av.RadioTransmissionUnexpected,
+				}})
+				continue
+			}
+		}
+
+		if !human {
+			s.startDeviation(ac, dev)
+		} else if expired := s.State.SimTime.Sub(dev.Requested) > wxRequestTimeout; expired || dist <= wxUrgentNM {
+			s.startDeviation(ac, dev)
+
+			msg := "deviated " + dev.String() + " for weather; " +
+				util.Select(expired, "deviation request not answered", "got within "+strconv.Itoa(wxUrgentNM)+" miles of the cell")
+			s.lg.Info("weather deviation", slog.String("callsign", callsign),
+				slog.String("controller", ac.ControllingController), slog.String("problem", msg))
+			s.eventStream.Post(Event{
+				Type:         WeatherDeviationEvent,
+				Callsign:     callsign,
+				ToController: ac.ControllingController,
+				Message:      msg,
+			})
+			s.postRadioEvents(callsign, []av.RadioTransmission{av.RadioTransmission{
+				Controller: ac.ControllingController,
+				Message:    "we're deviating " + dev.String() + " for weather",
+				Type:       av.RadioTransmissionUnexpected,
+			}})
+		}
+	}
+
+	for callsign := range s.wxDeviations {
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(s.wxDeviations, callsign)
+		}
+	}
+}
+
+// startDeviation has the pilot turn to the deviation heading.
+func (s *Sim) startDeviation(ac *av.Aircraft, dev *wxDeviation) {
+	if hdg, ok := ac.Nav.AssignedHeading(); ok {
+		dev.Resume = &hdg
+	}
+	ac.Nav.AssignHeading(dev.Heading, dev.Turn, s.State.SimTime)
+	dev.Deviating = true
+	dev.Started = s.State.SimTime
+}
+
+// continueDeviation checks whether an aircraft that is deviating is clear
+// of the weather and can resume its route or previous heading.
+func (s *Sim) continueDeviation(ac *av.Aircraft, dev *wxDeviation) {
+	if hdg, ok := ac.Nav.AssignedHeading(); !ok || hdg != dev.Heading {
+		// The controller has given the aircraft something else to do.
+		delete(s.wxDeviations, ac.Callsign)
+		return
+	}
+	if s.State.SimTime.Sub(dev.Started) < wxMinimumDeviation {
+		return
+	}
+
+	var msg string
+	if dev.Resume != nil {
+		if _, blocked := s.weatherAhead(ac, *dev.Resume); blocked {
+			return
+		}
+		ac.Nav.AssignHeading(*dev.Resume, av.TurnClosest, s.State.SimTime)
+		msg = fmt.Sprintf("clear of the weather, heading %03d", int(*dev.Resume))
+	} else if len(ac.Nav.Waypoints) > 0 {
+		wp := ac.Nav.Waypoints[0]
+		hdg := math.Heading2LL(ac.Position(), wp.Location, s.State.NmPerLongitude, s.State.MagneticVariation)
+		if _, blocked := s.weatherAhead(ac, hdg); blocked {
+			return
+		}
+		ac.Nav.DirectFix(wp.Fix, s.State.SimTime)
+		msg = "clear of the weather, proceeding direct " + av.FixReadback(wp.Fix)
+	} else {
+		// Nowhere to go back to; stay on the deviation heading until the
+		// controller says otherwise.
+		msg = "clear of the weather"
+	}
+
+	delete(s.wxDeviations, ac.Callsign)
+	if ac.ControllingController != "" {
+		s.postRadioEvents(ac.Callsign, []av.RadioTransmission{av.RadioTransmission{
+			Controller: ac.ControllingController,
+			Message:    msg,
+			Type:       av.RadioTransmissionUnexpected,
+		}})
+	}
+}
+
+// ApproveDeviation approves the aircraft's request to deviate for
+// weather.
+func (s *Sim) ApproveDeviation(tcp, callsign string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if dev, ok := s.wxDeviations[callsign]; !ok || dev.Deviating {
+		return ErrNoDeviationRequest
+	}
+
+	return s.dispatchControllingCommand(tcp, callsign,
+		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			dev := s.wxDeviations[callsign]
+			s.startDeviation(ac, dev)
+			return []av.RadioTransmission{av.RadioTransmission{
+				Controller: ac.ControllingController,
+				Message:    "deviating " + dev.String() + ", we'll advise clear of the weather",
+				Type:       av.RadioTransmissionReadback,
+			}}
+		})
+}
@@ -0,0 +1,219 @@
+// pkg/sim/coordination.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+// Controllers can call virtual controllers on the landline to coordinate
+// aircraft: verbal point-outs, APREQs, and requests to hand an aircraft
+// off at an altitude other than the one an LOA calls for. The virtual
+// controller answers after a short delay, applying the LOAs: point-outs
+// and releases of aircraft whose clearances don't meet an LOA are
+// refused, and altitude requests are approved if they're close enough to
+// the LOA's altitudes. Approved altitudes aren't reported as LOA
+// violations. Each reply is posted as a CoordinationEvent.
+
+type CoordinationType string
+
+const (
+	CoordinationPointOut CoordinationType = "pointout"
+	CoordinationAPREQ    CoordinationType = "apreq"
+	CoordinationAltitude CoordinationType = "altitude"
+)
+
+// CoordinationRequest is a structured request to a virtual controller.
+type CoordinationRequest struct {
+	Type         CoordinationType
+	ToController string // not used for APREQs, which go to the facility
+	Altitude     int    // for altitude requests
+}
+
+func (r CoordinationRequest) String() string {
+	switch r.Type {
+	case CoordinationAPREQ:
+		return "APREQ"
+	case CoordinationAltitude:
+		return fmt.Sprintf("%s A%d", r.ToController, r.Altitude/100)
+	default:
+		return r.ToController + " PO"
+	}
+}
+
+// ParseCoordinationRequest parses the fields of a "CALL" command: either
+// "APREQ" or a controller's TCP followed by "PO" for a point-out or "A"
+// and an altitude in hundreds of feet for an altitude request.
+func ParseCoordinationRequest(fields []string) (CoordinationRequest, bool) {
+	if len(fields) == 1 && fields[0] == "APREQ" {
+		return CoordinationRequest{Type: CoordinationAPREQ}, true
+	} else if len(fields) != 2 {
+		return CoordinationRequest{}, false
+	}
+
+	req := CoordinationRequest{ToController: fields[0]}
+	if fields[1] == "PO" {
+		req.Type = CoordinationPointOut
+		return req, true
+	} else if alt, ok := strings.CutPrefix(fields[1], "A"); ok {
+		if a, err := strconv.Atoi(alt); err == nil && a > 0 {
+			req.Type = CoordinationAltitude
+			req.Altitude = 100 * a
+			return req, true
+		}
+	}
+	return CoordinationRequest{}, false
+}
+
+// Coordination is a request that is awaiting the virtual controller's
+// reply.
+type Coordination struct {
+	CoordinationRequest
+	Callsign       string
+	FromController string
+	ReplyTime      time.Time
+	Refusal        string // if non-empty, the request will be refused
+}
+
+// Altitude requests that are within this many feet of an LOA's altitudes
+// are approved.
+const maxCoordinatedDeviation = 2000
+
+// RequestCoordination calls a virtual controller with a request about the
+// given aircraft.
+func (s *Sim) RequestCoordination(tcp, callsign string, req CoordinationRequest) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	ac, ok := s.State.Aircraft[callsign]
+	if !ok {
+		return av.ErrNoAircraftForCallsign
+	}
+
+	co := Coordination{
+		CoordinationRequest: req,
+		Callsign:            callsign,
+		FromController:      tcp,
+		ReplyTime:           s.State.SimTime.Add(time.Duration(5+s.Rand.Intn(11)) * time.Second),
+	}
+
+	if req.Type == CoordinationAPREQ {
+		r, err := s.checkReleaseRequest(tcp, callsign)
+		if err != nil {
+			return err
+		}
+		if co.Refusal = s.coordinationLOAProblems(ac); co.Refusal == "" {
+			// The facility answers the release request itself.
+			s.requestRelease(tcp, r)
+			return nil
+		}
+		co.ToController = r.Facility
+	} else {
+		co.ToController = s.State.resolveConsolidation(req.ToController)
+		if ac.TrackingController != tcp {
+			return av.ErrOtherControllerHasTrack
+		} else if _, ok := s.State.Controllers[co.ToController]; !ok {
+			return av.ErrNoController
+		} else if co.ToController == tcp {
+			return av.ErrInvalidController
+		} else if s.isActiveHumanController(co.ToController) {
+			return ErrNotVirtualController
+		}
+		if req.Type == CoordinationAltitude {
+			co.Refusal = s.altitudeRequestProblems(ac, req.Altitude)
+		} else {
+			co.Refusal = s.coordinationLOAProblems(ac)
+		}
+	}
+
+	s.lg.Info("coordination request", slog.String("callsign", callsign), slog.String("from", tcp),
+		slog.String("to", co.ToController), slog.String("request", req.String()))
+	s.Coordination = append(s.Coordination, co)
+
+	return nil
+}
+
+// coordinationLOAProblems returns the ways in which the aircraft's
+// clearance is inconsistent with the LOAs that apply to it.
+func (s *Sim) coordinationLOAProblems(ac *av.Aircraft) string {
+	var problems []string
+	for _, l := range s.LOAs {
+		if l.appliesTo(ac) {
+			if p := s.loaClearanceProblem(l, ac); p != "" {
+				problems = append(problems, p+" at "+l.Fix)
+			}
+		}
+	}
+	return strings.Join(problems, "; ")
+}
+
+// altitudeRequestProblems returns the reasons that a request for the
+// aircraft to be at the given altitude won't be approved.
+func (s *Sim) altitudeRequestProblems(ac *av.Aircraft, alt int) string {
+	var problems []string
+	for _, l := range s.LOAs {
+		if l.Altitude[1] == 0 || !l.appliesTo(ac) {
+			continue
+		}
+		if dev := math.Max(l.Altitude[0]-alt, alt-l.Altitude[1]); dev > maxCoordinatedDeviation {
+			problems = append(problems, "need "+l.altitudeString()+" at "+l.Fix)
+		}
+	}
+	return strings.Join(problems, "; ")
+}
+
+// updateCoordination delivers the virtual controllers' replies to
+// coordination requests whose time has come.
+func (s *Sim) updateCoordination() {
+	now := s.State.SimTime
+
+	s.Coordination = slices.DeleteFunc(s.Coordination, func(co Coordination) bool {
+		ac, ok := s.State.Aircraft[co.Callsign]
+		if !ok {
+			return true
+		} else if now.Before(co.ReplyTime) {
+			return false
+		}
+
+		var reply string
+		if co.Refusal != "" {
+			reply = "unable, " + co.Refusal
+		} else if co.Type == CoordinationAltitude {
+			reply = fmt.Sprintf("%d approved", co.Altitude)
+			if s.CoordinatedAltitudes == nil {
+				s.CoordinatedAltitudes = make(map[string]int)
+			}
+			s.CoordinatedAltitudes[co.Callsign] = co.Altitude
+		} else {
+			reply = "point out approved"
+		}
+
+		s.eventStream.Post(Event{
+			Type:           CoordinationEvent,
+			Callsign:       ac.Callsign,
+			FromController: co.ToController,
+			ToController:   co.FromController,
+			Message:        reply,
+		})
+		s.lg.Info("coordination reply", slog.String("callsign", ac.Callsign),
+			slog.String("by", co.ToController), slog.String("reply", reply))
+
+		return true
+	})
+
+	for callsign := range s.CoordinatedAltitudes {
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(s.CoordinatedAltitudes, callsign)
+		}
+	}
+}
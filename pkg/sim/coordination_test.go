@@ -0,0 +1,107 @@
+// pkg/sim/coordination_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/rand"
+)
+
+func TestParseCoordinationRequest(t *testing.T) {
+	for s, req := range map[string]CoordinationRequest{
+		"APREQ":   {Type: CoordinationAPREQ},
+		"N4P PO":  {Type: CoordinationPointOut, ToController: "N4P"},
+		"2K A120": {Type: CoordinationAltitude, ToController: "2K", Altitude: 12000},
+	} {
+		if got, ok := ParseCoordinationRequest(strings.Fields(s)); !ok || got != req {
+			t.Errorf("%s: got %+v (%v), expected %+v", s, got, ok, req)
+		}
+	}
+	for _, s := range []string{"", "PO", "2K", "2K A", "2K AX", "2K A0", "2K PO A120", "2K HO"} {
+		if req, ok := ParseCoordinationRequest(strings.Fields(s)); ok {
+			t.Errorf("%s: unexpectedly parsed as %+v", s, req)
+		}
+	}
+}
+
+func TestCoordination(t *testing.T) {
+	alt := float32(12000)
+	ac := &av.Aircraft{
+		Callsign:           "AAL1",
+		TrackingController: "2K",
+		FlightPlan:         &av.FlightPlan{},
+	}
+	ac.Nav.Waypoints = []av.Waypoint{{Fix: "MERIT"}}
+	ac.Nav.FlightState.Altitude = 8000
+	ac.Nav.Altitude.Assigned = &alt
+
+	s := newTestSim(t, &State{
+		Aircraft:    map[string]*av.Aircraft{"AAL1": ac},
+		Controllers: map[string]*av.Controller{"2K": {}, "N4P": {}, "N56": {}},
+		SimTime:     time.Date(2024, 6, 1, 15, 4, 0, 0, time.UTC),
+	})
+	s.LOAs = []LOA{{Name: "merit", Fix: "MERIT", Altitude: [2]int{10000, 10000}}}
+	s.humanControllers = map[string]*EventsSubscription{"2K": nil, "N56": nil}
+	s.Rand = rand.New()
+	sub := s.eventStream.Subscribe()
+
+	// replies advances past the reply delay and returns the replies.
+	replies := func() []string {
+		s.State.SimTime = s.State.SimTime.Add(20 * time.Second)
+		s.updateCoordination()
+		var r []string
+		for _, e := range sub.Get() {
+			if e.Type == CoordinationEvent && e.ToController == "2K" && e.FromController == "N4P" {
+				r = append(r, e.Message)
+			}
+		}
+		return r
+	}
+
+	if err := s.RequestCoordination("2K", "AAL1", CoordinationRequest{Type: CoordinationPointOut, ToController: "N56"}); err != ErrNotVirtualController {
+		t.Errorf("human controller: got error %v", err)
+	}
+	if err := s.RequestCoordination("N4P", "AAL1", CoordinationRequest{Type: CoordinationPointOut, ToController: "2K"}); err != av.ErrOtherControllerHasTrack {
+		t.Errorf("untracked aircraft: got error %v", err)
+	}
+
+	// Cleared to 12000 but the LOA calls for 10000.
+	if err := s.RequestCoordination("2K", "AAL1", CoordinationRequest{Type: CoordinationPointOut, ToController: "N4P"}); err != nil {
+		t.Fatalf("point out: %v", err)
+	}
+	if r := replies(); len(r) != 1 || r[0] != "unable, cleared to 12000, not 10000 at MERIT" {
+		t.Errorf("point out: unexpected replies %q", r)
+	}
+
+	// Too far from the LOA's altitude.
+	if err := s.RequestCoordination("2K", "AAL1", CoordinationRequest{Type: CoordinationAltitude, ToController: "N4P", Altitude: 14000}); err != nil {
+		t.Fatalf("altitude: %v", err)
+	}
+	if r := replies(); len(r) != 1 || r[0] != "unable, need 10000 at MERIT" || s.CoordinatedAltitudes["AAL1"] != 0 {
+		t.Errorf("altitude: unexpected replies %q", r)
+	}
+
+	if err := s.RequestCoordination("2K", "AAL1", CoordinationRequest{Type: CoordinationAltitude, ToController: "N4P", Altitude: 12000}); err != nil {
+		t.Fatalf("altitude: %v", err)
+	}
+	if r := replies(); len(r) != 1 || r[0] != "12000 approved" || s.CoordinatedAltitudes["AAL1"] != 12000 {
+		t.Errorf("altitude: unexpected replies %q", r)
+	}
+
+	// Now that 12000 has been coordinated, the clearance meets the LOA.
+	if p := s.coordinationLOAProblems(ac); p != "" {
+		t.Errorf("unexpected LOA problem %q after coordination", p)
+	}
+	if err := s.RequestCoordination("2K", "AAL1", CoordinationRequest{Type: CoordinationPointOut, ToController: "N4P"}); err != nil {
+		t.Fatalf("point out: %v", err)
+	}
+	if r := replies(); len(r) != 1 || r[0] != "point out approved" {
+		t.Errorf("point out: unexpected replies %q", r)
+	}
+}
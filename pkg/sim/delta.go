@@ -0,0 +1,512 @@
+// pkg/sim/delta.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"reflect"
+	"slices"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// World updates are sent to each human controller as patches against
+// the last update that it applied. The sim keeps a version number for
+// the world that advances whenever something changes, along with the
+// version in which each field of each aircraft, the controllers, each
+// facility's ERAM computer, and each of the worldCollections last changed,
+// the versions in which tracks were added to each aircraft's track
+// history, and the versions in which aircraft were deleted. An update
+// then includes:
+//
+//   - New aircraft in their entirety.
+//   - For aircraft that have changed, an AircraftPatch holding just the
+//     fields that are different.
+//   - The callsigns of the aircraft that have been deleted.
+//   - The controllers, ERAM computers, airspace, and worldCollections,
+//     only if they have changed.
+//   - The tracks that have been added to each track history.
+//
+// The client acknowledges the version of the last update it applied with
+// its next request. Because the versions are for the world rather than
+// for each client, a patch can be made against any earlier version; a
+// full update is only needed when a client first connects or if it's so
+// far behind that deletions it hasn't seen have been forgotten.
+//
+// Finding what has changed requires hashing everything, so it's only
+// done if the sim's state may have changed since the last time: after
+// the sim has been stepped or if its mutex has been locked by anything
+// other than GetWorldUpdate and Update, which don't change it otherwise.
+
+// stateMutex is the Sim's mutex; it notes that the state may have
+// changed whenever it's locked.
+type stateMutex struct {
+	util.LoggingMutex
+	changed bool
+}
+
+func (m *stateMutex) Lock(lg *log.Logger) {
+	m.LoggingMutex.Lock(lg)
+	m.changed = true
+}
+
+// lockUnchanged locks the mutex for a caller that either doesn't change
+// the state or sets changed itself when it does.
+func (m *stateMutex) lockUnchanged(lg *log.Logger) {
+	m.LoggingMutex.Lock(lg)
+}
+
+// worldUpdateState records the latest version sent to a controller and
+// the one that it has acknowledged receiving; deletions since the latter
+// must be remembered.
+type worldUpdateState struct {
+	sent  uint64
+	acked uint64
+}
+
+type worldVersions struct {
+	version  uint64
+	aircraft map[string]*aircraftVersions
+	removed  map[string]uint64 // callsign -> version in which it was deleted
+	// Deletions before this version have been forgotten.
+	oldest      uint64
+	controllers versionedHash
+	airspace    versionedHash            // changes only when resectorized
+	facilities  map[string]versionedHash // ERAM computer identifier ->
+	collections []versionedHash          // indexed like worldCollections
+	histories   map[string]*historyVersions
+}
+
+type versionedHash struct {
+	hash    uint64
+	version uint64
+}
+
+type aircraftVersions struct {
+	added  uint64
+	fields []versionedHash // indexed by av.Aircraft field
+}
+
+// historyVersions records the changes to an aircraft's track history.
+type historyVersions struct {
+	reset  uint64    // version in which the whole history must be resent
+	newest time.Time // time of its newest track
+	// Versions in which the most recent tracks were added, oldest first;
+	// there are at most as many as there are tracks in the history.
+	added []uint64
+}
+
+// aircraftFields gives the indices of the av.Aircraft fields that are
+// sent to clients; each has a bit in AircraftPatch.Fields.
+var aircraftFields = func() []int {
+	var fields []int
+	t := reflect.TypeFor[av.Aircraft]()
+	for i := range t.NumField() {
+		if t.Field(i).IsExported() {
+			fields = append(fields, i)
+		}
+	}
+	if len(fields) > 64 {
+		panic("too many av.Aircraft fields for AircraftPatch")
+	}
+	return fields
+}()
+
+// AircraftPatch gives the fields of an aircraft that have changed. Bit i
+// of Fields is set if the i'th exported field of av.Aircraft changed;
+// only those fields are set in Aircraft. The rest are zero-valued and so
+// aren't transmitted.
+type AircraftPatch struct {
+	Fields   uint64
+	Aircraft av.Aircraft
+}
+
+// worldCollections are the State fields that are only sent in a
+// WorldUpdate if they have changed; each has a bit in
+// WorldUpdate.Collections and is in both State and WorldUpdate.
+var worldCollections = func() []string {
+	names := []string{"ProbeConflicts", "Intents", "HoldingStacks", "WeatherCells", "PIREPs", "RunwayAdvice"}
+	for _, name := range names {
+		sf, ok := reflect.TypeFor[State]().FieldByName(name)
+		wf, wok := reflect.TypeFor[WorldUpdate]().FieldByName(name)
+		if !ok || !wok || sf.Type != wf.Type {
+			panic(name + ": not in both State and WorldUpdate")
+		}
+	}
+	return names
+}()
+
+// Apply returns a copy of the given aircraft with the patch applied.
+func (p *AircraftPatch) Apply(ac *av.Aircraft) *av.Aircraft {
+	nac := *ac
+	dst, src := reflect.ValueOf(&nac).Elem(), reflect.ValueOf(&p.Aircraft).Elem()
+	for bit, idx := range aircraftFields {
+		if p.Fields&(1<<bit) != 0 {
+			dst.Field(idx).Set(src.Field(idx))
+		}
+	}
+	return &nac
+}
+
+// hashValue returns a hash of the JSON encoding of v. JSON is used since
+// it gives a consistent ordering of map entries; zero is returned if v
+// can't be encoded, which causes it to always be treated as changed.
+func hashValue(v any) uint64 {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// update records that something has the given hash as of the given
+// version, returning true if it changed.
+func (vh *versionedHash) update(h, version uint64) bool {
+	if h == vh.hash && h != 0 {
+		return false
+	}
+	vh.hash, vh.version = h, version
+	return true
+}
+
+// refreshWorldVersions finds what has changed in the world since it was
+// last called and advances the world version if anything has. s.mu must
+// be held.
+func (s *Sim) refreshWorldVersions() {
+	wv := s.worldVersions
+	if wv == nil {
+		wv = &worldVersions{
+			aircraft:    make(map[string]*aircraftVersions),
+			removed:     make(map[string]uint64),
+			facilities:  make(map[string]versionedHash),
+			collections: make([]versionedHash, len(worldCollections)),
+			histories:   make(map[string]*historyVersions),
+		}
+		s.worldVersions = wv
+	} else if !s.mu.changed {
+		return
+	}
+	s.mu.changed = false
+
+	next := wv.version + 1
+	changed := false
+	for callsign, ac := range s.State.Aircraft {
+		acv, ok := wv.aircraft[callsign]
+		if !ok {
+			acv = &aircraftVersions{added: next, fields: make([]versionedHash, len(aircraftFields))}
+			wv.aircraft[callsign] = acv
+			delete(wv.removed, callsign)
+			changed = true
+		}
+		v := reflect.ValueOf(ac).Elem()
+		for i, idx := range aircraftFields {
+			if acv.fields[i].update(hashValue(v.Field(idx).Interface()), next) {
+				changed = true
+			}
+		}
+	}
+	for callsign := range wv.aircraft {
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(wv.aircraft, callsign)
+			wv.removed[callsign] = next
+			changed = true
+		}
+	}
+
+	if wv.controllers.update(hashValue(s.State.Controllers), next) {
+		changed = true
+	}
+	if wv.airspace.update(hashValue(s.State.Sectorization), next) {
+		changed = true
+	}
+	if ec := s.State.ERAMComputers; ec != nil {
+		for id, comp := range ec.Computers {
+			vh := wv.facilities[id]
+			if vh.update(hashValue(comp), next) {
+				wv.facilities[id] = vh
+				changed = true
+			}
+		}
+	}
+
+	st := reflect.ValueOf(s.State).Elem()
+	for i, name := range worldCollections {
+		if wv.collections[i].update(hashValue(st.FieldByName(name).Interface()), next) {
+			changed = true
+		}
+	}
+	if s.refreshHistoryVersions(next) {
+		changed = true
+	}
+
+	if changed {
+		wv.version = next
+	}
+}
+
+// refreshHistoryVersions records the tracks that have been added to the
+// track histories, returning true if there are any.
+func (s *Sim) refreshHistoryVersions(next uint64) bool {
+	wv := s.worldVersions
+	changed := false
+	for callsign, h := range s.State.TrackHistories {
+		newest := time.Time{}
+		if r := h.Recent(1); len(r) > 0 {
+			newest = r[0].Time
+		}
+
+		hv, ok := wv.histories[callsign]
+		if acv := wv.aircraft[callsign]; !ok || acv == nil || acv.added == next || newest.Before(hv.newest) {
+			// It's new, or it's for a new aircraft with the same
+			// callsign, or the sim has been rewound.
+			wv.histories[callsign] = &historyVersions{reset: next, newest: newest}
+			changed = true
+			continue
+		}
+
+		n := 0
+		for _, t := range h.Tracks {
+			if t.Time.After(hv.newest) {
+				n++
+			}
+		}
+		if n > 0 {
+			for range n {
+				hv.added = append(hv.added, next)
+			}
+			hv.added = hv.added[max(0, len(hv.added)-len(h.Tracks)):]
+			hv.newest = newest
+			changed = true
+		}
+	}
+	for callsign := range wv.histories {
+		if _, ok := s.State.TrackHistories[callsign]; !ok {
+			delete(wv.histories, callsign)
+		}
+	}
+	return changed
+}
+
+// forgetWorldDeletions discards the deletions that all of the
+// controllers have acknowledged.
+func (s *Sim) forgetWorldDeletions() {
+	wv := s.worldVersions
+	oldest := wv.version
+	for _, ws := range s.worldUpdates {
+		oldest = min(oldest, ws.acked)
+	}
+	for callsign, v := range wv.removed {
+		if v <= oldest {
+			delete(wv.removed, callsign)
+		}
+	}
+	wv.oldest = oldest
+}
+
+// worldUpdateDelta initializes the aircraft, controller, ERAM computer,
+// airspace, collection, and track history fields of the WorldUpdate for the given controller. ack is
+// the version of the last update that the controller applied. s.mu must
+// be held.
+func (s *Sim) worldUpdateDelta(tcp string, ack uint64, wu *WorldUpdate) {
+	if s.worldUpdates == nil {
+		s.worldUpdates = make(map[string]*worldUpdateState)
+	}
+	s.refreshWorldVersions()
+	wv := s.worldVersions
+
+	// A patch can be made if the controller has applied an update that
+	// we sent it and we still know what has been deleted since then.
+	ws, ok := s.worldUpdates[tcp]
+	if !ok {
+		ws = &worldUpdateState{}
+		s.worldUpdates[tcp] = ws
+	}
+	wu.Delta = ok && ack != 0 && ack <= ws.sent && ack >= wv.oldest
+	if !wu.Delta {
+		// After a full update, the controller is up to date as of the
+		// current version.
+		ack = 0
+		ws.acked = wv.version
+	} else {
+		ws.acked = ack
+	}
+	wu.Sequence = wv.version
+	ws.sent = wv.version
+	defer s.forgetWorldDeletions()
+
+	wu.Aircraft = make(map[string]*av.Aircraft)
+	for callsign, ac := range s.State.Aircraft {
+		acv := wv.aircraft[callsign]
+		if acv.added > ack {
+			wu.Aircraft[callsign] = ac
+			continue
+		}
+
+		var p AircraftPatch
+		src, dst := reflect.ValueOf(ac).Elem(), reflect.ValueOf(&p.Aircraft).Elem()
+		for bit, idx := range aircraftFields {
+			if acv.fields[bit].version > ack {
+				p.Fields |= 1 << bit
+				dst.Field(idx).Set(src.Field(idx))
+			}
+		}
+		if p.Fields != 0 {
+			if wu.AircraftPatches == nil {
+				wu.AircraftPatches = make(map[string]*AircraftPatch)
+			}
+			wu.AircraftPatches[callsign] = &p
+		}
+	}
+	if wu.Delta {
+		for _, callsign := range util.SortedMapKeys(wv.removed) {
+			if wv.removed[callsign] > ack {
+				wu.RemovedAircraft = append(wu.RemovedAircraft, callsign)
+			}
+		}
+	}
+
+	if wv.controllers.version > ack {
+		wu.Controllers = s.State.Controllers
+	}
+	if wv.airspace.version > ack {
+		wu.Airspace = s.State.Airspace
+		wu.Sectorization = s.State.Sectorization
+		wu.AirspaceChanged = true
+	}
+	if ec := s.State.ERAMComputers; ec != nil {
+		for id, comp := range ec.Computers {
+			if wv.facilities[id].version > ack {
+				if wu.ERAMComputers == nil {
+					wu.ERAMComputers = &ERAMComputers{Computers: make(map[string]*ERAMComputer)}
+				}
+				wu.ERAMComputers.Computers[id] = comp
+			}
+		}
+	}
+
+	st, dst := reflect.ValueOf(s.State).Elem(), reflect.ValueOf(wu).Elem()
+	for bit, name := range worldCollections {
+		if wv.collections[bit].version > ack {
+			wu.Collections |= 1 << bit
+			dst.FieldByName(name).Set(st.FieldByName(name))
+		}
+	}
+
+	wu.TrackHistoryDepth = util.Select(s.TrackHistoryDepth > 0, s.TrackHistoryDepth, DefaultTrackHistoryDepth)
+	for callsign, h := range s.State.TrackHistories {
+		hv := wv.histories[callsign]
+		if hv.reset > ack {
+			if wu.TrackHistories == nil {
+				wu.TrackHistories = make(map[string]*TrackHistory)
+			}
+			wu.TrackHistories[callsign] = h
+		} else if i := slices.IndexFunc(hv.added, func(v uint64) bool { return v > ack }); i != -1 {
+			if wu.TrackHistoryAppends == nil {
+				wu.TrackHistoryAppends = make(map[string][]av.RadarTrack)
+			}
+			tracks := h.Recent(len(hv.added) - i)
+			slices.Reverse(tracks)
+			wu.TrackHistoryAppends[callsign] = tracks
+		}
+	}
+}
+
+// ApplyAircraft updates the given aircraft map, which holds the
+// aircraft from previous updates, with the aircraft in the WorldUpdate and
+// returns the result. It returns false if the update is a patch to an
+// aircraft that isn't in the map, in which case the caller should
+// request a full update.
+func (wu *WorldUpdate) ApplyAircraft(aircraft map[string]*av.Aircraft) (map[string]*av.Aircraft, bool) {
+	if !wu.Delta || aircraft == nil {
+		aircraft = make(map[string]*av.Aircraft)
+	}
+	for callsign, ac := range wu.Aircraft {
+		aircraft[callsign] = ac
+	}
+	ok := true
+	for callsign, p := range wu.AircraftPatches {
+		if ac, found := aircraft[callsign]; found {
+			aircraft[callsign] = p.Apply(ac)
+		} else {
+			ok = false
+		}
+	}
+	for _, callsign := range wu.RemovedAircraft {
+		delete(aircraft, callsign)
+	}
+	return aircraft, ok
+}
+
+// ApplyERAMComputers returns the given ERAM computers, which are from
+// previous updates, updated with the facilities in the WorldUpdate.
+func (wu *WorldUpdate) ApplyERAMComputers(ec *ERAMComputers) *ERAMComputers {
+	if wu.ERAMComputers == nil {
+		return ec
+	} else if !wu.Delta || ec == nil {
+		return wu.ERAMComputers
+	}
+
+	merged := &ERAMComputers{Computers: make(map[string]*ERAMComputer)}
+	for id, comp := range ec.Computers {
+		merged.Computers[id] = comp
+	}
+	for id, comp := range wu.ERAMComputers.Computers {
+		merged.Computers[id] = comp
+	}
+	return merged
+}
+
+// ApplyCollections updates the worldCollections in the given state with
+// the ones in the WorldUpdate.
+func (wu *WorldUpdate) ApplyCollections(ss *State) {
+	dst, src := reflect.ValueOf(ss).Elem(), reflect.ValueOf(wu).Elem()
+	for bit, name := range worldCollections {
+		if wu.Collections&(1<<bit) != 0 {
+			dst.FieldByName(name).Set(src.FieldByName(name))
+		}
+	}
+}
+
+// ApplyTrackHistories returns the given track histories, which are from
+// previous updates, updated with the ones in the WorldUpdate. aircraft
+// should be the aircraft after the update has been applied; histories of
+// aircraft that are gone are discarded.
+func (wu *WorldUpdate) ApplyTrackHistories(histories map[string]*TrackHistory,
+	aircraft map[string]*av.Aircraft) map[string]*TrackHistory {
+	if !wu.Delta || histories == nil {
+		histories = make(map[string]*TrackHistory)
+	}
+	for callsign, h := range wu.TrackHistories {
+		histories[callsign] = h
+	}
+	for callsign, tracks := range wu.TrackHistoryAppends {
+		h, ok := histories[callsign]
+		if !ok {
+			h = &TrackHistory{}
+			histories[callsign] = h
+		}
+		for _, t := range tracks {
+			h.Add(t, wu.TrackHistoryDepth)
+		}
+	}
+	for callsign := range histories {
+		if _, ok := aircraft[callsign]; !ok {
+			delete(histories, callsign)
+		}
+	}
+	return histories
+}
+
+// AircraftChanged returns whether the update adds, changes, or removes
+// any aircraft.
+func (wu *WorldUpdate) AircraftChanged() bool {
+	return len(wu.Aircraft) > 0 || len(wu.AircraftPatches) > 0 || len(wu.RemovedAircraft) > 0
+}
@@ -0,0 +1,186 @@
+// pkg/sim/delta_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+func TestWorldUpdatePatches(t *testing.T) {
+	s := &Sim{State: &State{
+		Aircraft: map[string]*av.Aircraft{
+			"AAL1": {Callsign: "AAL1", Squawk: 0o1234, HandoffTrackController: "2K"},
+			"AAL2": {Callsign: "AAL2", Squawk: 0o2345, Scratchpad: "ABC"},
+		},
+		Controllers: map[string]*av.Controller{"1K": {Position: "1K"}},
+	}}
+
+	// update gets an update for the client as it would come over the
+	// wire and applies it.
+	var client map[string]*av.Aircraft
+	var clientSeq uint64
+	update := func(ack uint64) *WorldUpdate {
+		t.Helper()
+		var wu WorldUpdate
+		s.mu.changed = true // as if the changes had been made with s.mu held
+		s.worldUpdateDelta("1K", ack, &wu)
+
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(wu); err != nil {
+			t.Fatal(err)
+		}
+		var rwu WorldUpdate
+		if err := gob.NewDecoder(&buf).Decode(&rwu); err != nil {
+			t.Fatal(err)
+		}
+
+		var ok bool
+		if client, ok = rwu.ApplyAircraft(client); !ok {
+			t.Fatalf("patch for unknown aircraft")
+		}
+		clientSeq = rwu.Sequence
+		if !reflect.DeepEqual(client, s.State.Aircraft) {
+			t.Errorf("client aircraft %+v don't match sim's %+v", client, s.State.Aircraft)
+		}
+		return &rwu
+	}
+
+	if wu := update(0); wu.Delta || len(wu.Aircraft) != 2 || wu.Controllers == nil {
+		t.Fatalf("expected full initial update; got %+v", wu)
+	}
+
+	if wu := update(clientSeq); !wu.Delta || len(wu.Aircraft) != 0 || len(wu.AircraftPatches) != 0 ||
+		wu.Controllers != nil {
+		t.Errorf("expected empty patch; got %+v", wu)
+	}
+
+	// Clearing a field must be sent even though the zero value isn't
+	// transmitted.
+	s.State.Aircraft["AAL1"].HandoffTrackController = ""
+	s.State.Aircraft["AAL3"] = &av.Aircraft{Callsign: "AAL3", Squawk: 0o3456}
+	delete(s.State.Aircraft, "AAL2")
+	wu := update(clientSeq)
+	if !wu.Delta || len(wu.Aircraft) != 1 || len(wu.AircraftPatches) != 1 ||
+		!reflect.DeepEqual(wu.RemovedAircraft, []string{"AAL2"}) {
+		t.Errorf("unexpected patch %+v", wu)
+	}
+	if p := wu.AircraftPatches["AAL1"]; p == nil || p.Aircraft.Squawk != 0 {
+		t.Errorf("expected only changed fields in the patch; got %+v", p)
+	}
+
+	// If an update is lost, the next one is a patch against the one
+	// before it.
+	prevSeq, prevClient := clientSeq, make(map[string]*av.Aircraft)
+	for cs, ac := range client {
+		prevClient[cs] = ac
+	}
+	s.State.Aircraft["AAL1"].Scratchpad = "XYZ"
+	update(clientSeq)
+	s.State.Aircraft["AAL3"].Squawk = 0o4567
+	client = prevClient
+	if wu := update(prevSeq); !wu.Delta || len(wu.AircraftPatches) != 2 {
+		t.Errorf("expected patch of both aircraft; got %+v", wu)
+	}
+
+	// A sectorization without any airspace must still be sent.
+	s.State.Sectorization = "combined"
+	s.State.Airspace = map[string]map[string][]av.ControllerAirspaceVolume{}
+	if wu := update(clientSeq); !wu.AirspaceChanged || len(wu.Airspace) != 0 || wu.Sectorization != "combined" {
+		t.Errorf("expected empty airspace; got %+v", wu)
+	}
+	if wu := update(clientSeq); wu.AirspaceChanged {
+		t.Errorf("expected unchanged airspace; got %+v", wu)
+	}
+}
+
+func TestWorldUpdateCollections(t *testing.T) {
+	start := time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)
+	s := &Sim{
+		State: &State{
+			Aircraft: map[string]*av.Aircraft{"AAL1": {Callsign: "AAL1"}, "AAL2": {Callsign: "AAL2"}},
+			SimTime:  start,
+		},
+		TrackHistoryDepth: 3,
+	}
+
+	var client State
+	var seq uint64
+	update := func() *WorldUpdate {
+		t.Helper()
+		var wu WorldUpdate
+		s.worldUpdateDelta("1K", seq, &wu)
+
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(wu); err != nil {
+			t.Fatal(err)
+		}
+		var rwu WorldUpdate
+		if err := gob.NewDecoder(&buf).Decode(&rwu); err != nil {
+			t.Fatal(err)
+		}
+
+		client.Aircraft, _ = rwu.ApplyAircraft(client.Aircraft)
+		rwu.ApplyCollections(&client)
+		client.TrackHistories = rwu.ApplyTrackHistories(client.TrackHistories, client.Aircraft)
+		seq = rwu.Sequence
+		if !reflect.DeepEqual(client.TrackHistories, s.State.TrackHistories) {
+			t.Errorf("client track histories %+v don't match sim's %+v", client.TrackHistories,
+				s.State.TrackHistories)
+		}
+		return &rwu
+	}
+	step := func(n int) {
+		for range n {
+			s.State.SimTime = s.State.SimTime.Add(trackHistoryInterval)
+			s.updateTrackHistories()
+		}
+		s.mu.changed = true
+	}
+
+	s.State.PIREPs = []PIREP{{Callsign: "AAL1"}}
+	step(2)
+	if wu := update(); wu.Collections == 0 || len(wu.TrackHistories) != 2 || len(client.PIREPs) != 1 {
+		t.Fatalf("expected full initial update; got %+v", wu)
+	}
+
+	// Nothing changed, so nothing is sent, even though s.mu was locked.
+	s.mu.changed = true
+	if wu := update(); wu.Collections != 0 || wu.TrackHistories != nil || wu.TrackHistoryAppends != nil {
+		t.Errorf("expected empty update; got %+v", wu)
+	}
+
+	// Only the new tracks are sent, including once the history is full.
+	for _, n := range []int{1, 3} {
+		step(n)
+		wu := update()
+		if wu.TrackHistories != nil || len(wu.TrackHistoryAppends) != 2 || len(wu.TrackHistoryAppends["AAL1"]) != n {
+			t.Errorf("expected %d appended tracks; got %+v", n, wu)
+		}
+	}
+
+	// Cleared collections must be sent; unchanged ones aren't.
+	s.State.PIREPs = nil
+	s.State.Intents = map[string]av.Intent{"AAL1": {}}
+	s.mu.changed = true
+	if wu := update(); wu.Collections == 0 || len(client.PIREPs) != 0 || len(client.Intents) != 1 ||
+		wu.WeatherCells != nil {
+		t.Errorf("unexpected update %+v", wu)
+	}
+
+	// A deleted aircraft's history is discarded; a rewound one is resent.
+	delete(s.State.Aircraft, "AAL2")
+	s.State.SimTime, s.lastTrackHistory = start, time.Time{}
+	s.State.TrackHistories["AAL1"] = &TrackHistory{}
+	step(1)
+	if wu := update(); len(wu.TrackHistories) != 1 || len(client.TrackHistories) != 1 {
+		t.Errorf("unexpected update %+v", wu)
+	}
+}
@@ -0,0 +1,462 @@
+// pkg/sim/emergency.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Aircraft may have emergencies or other abnormal situations, either at
+// times given in the scenario file or when an instructor (or the launch
+// controller) triggers them. An emergency changes the aircraft's squawk,
+// what the pilot says, and how the aircraft responds to instructions; it
+// also comes with a set of actions that the controller is expected to
+// take. An EmergencyEvent is posted when the emergency starts, an
+// EmergencyActionEvent for each expected action the controller takes, and
+// an EmergencyResolvedEvent once all have been taken or the time for them
+// has run out; the last lists any that were missed.
+
+type EmergencyType string
+
+const (
+	EmergencyEngineFailure  EmergencyType = "engine_failure"
+	EmergencyPressurization EmergencyType = "pressurization"
+	EmergencyRadioFailure   EmergencyType = "radio_failure"
+	EmergencyNORDOVFR       EmergencyType = "nordo_vfr"
+	EmergencyHijack         EmergencyType = "hijack"
+	EmergencyMinimumFuel    EmergencyType = "minimum_fuel"
+	EmergencyFuel           EmergencyType = "fuel"
+)
+
+var EmergencyTypes = []EmergencyType{EmergencyEngineFailure, EmergencyPressurization,
+	EmergencyRadioFailure, EmergencyNORDOVFR, EmergencyHijack, EmergencyMinimumFuel, EmergencyFuel}
+
+// ParseEmergencyType returns the emergency type corresponding to the
+// given string, which may be either the full name of the type or the
+// abbreviation used in aircraft commands: ENG, PRESS, RDOF, NORDO,
+// HIJACK, MINF, or FUEL.
+func ParseEmergencyType(s string) (EmergencyType, bool) {
+	switch strings.ToUpper(s) {
+	case "ENG":
+		return EmergencyEngineFailure, true
+	case "PRESS":
+		return EmergencyPressurization, true
+	case "RDOF":
+		return EmergencyRadioFailure, true
+	case "NORDO":
+		return EmergencyNORDOVFR, true
+	case "HIJACK":
+		return EmergencyHijack, true
+	case "MINF":
+		return EmergencyMinimumFuel, true
+	case "FUEL":
+		return EmergencyFuel, true
+	}
+	t := EmergencyType(strings.ToLower(s))
+	return t, slices.Contains(EmergencyTypes, t)
+}
+
+// EmergencyAction is something that a controller is expected to do in
+// response to an emergency.
+type EmergencyAction string
+
+const (
+	// Issue any instruction to the aircraft.
+	EmergencyActionAcknowledge EmergencyAction = "acknowledge"
+	// Assign an altitude at or below 10,000'.
+	EmergencyActionDescend EmergencyAction = "descend"
+	// Clear the aircraft for an approach.
+	EmergencyActionApproach EmergencyAction = "approach"
+	// Have the aircraft ident to confirm that it can hear the controller.
+	EmergencyActionIdent EmergencyAction = "ident"
+	// Start tracking the aircraft.
+	EmergencyActionTrack EmergencyAction = "track"
+)
+
+type emergencyInfo struct {
+	squawk av.Squawk // zero if the aircraft keeps its code
+	// deaf aircraft ignore all instructions; mute ones follow them but
+	// don't read them back.
+	deaf, mute bool
+	vfr        bool // only VFR aircraft have it; otherwise only IFR aircraft
+	minAlt     float32
+	actions    []EmergencyAction
+}
+
+var emergencyInfos = map[EmergencyType]emergencyInfo{
+	EmergencyEngineFailure: emergencyInfo{
+		squawk:  0o7700,
+		actions: []EmergencyAction{EmergencyActionAcknowledge, EmergencyActionApproach},
+	},
+	EmergencyPressurization: emergencyInfo{
+		squawk:  0o7700,
+		minAlt:  12000,
+		actions: []EmergencyAction{EmergencyActionAcknowledge, EmergencyActionDescend},
+	},
+	EmergencyRadioFailure: emergencyInfo{
+		squawk:  0o7600,
+		mute:    true,
+		actions: []EmergencyAction{EmergencyActionIdent},
+	},
+	EmergencyNORDOVFR: emergencyInfo{
+		squawk:  0o7600,
+		deaf:    true,
+		mute:    true,
+		vfr:     true,
+		actions: []EmergencyAction{EmergencyActionTrack},
+	},
+	EmergencyHijack: emergencyInfo{
+		squawk:  0o7500,
+		actions: []EmergencyAction{EmergencyActionAcknowledge},
+	},
+	// Minimum fuel isn't an emergency, but the controller should know
+	// that the aircraft can't accept much delay.
+	EmergencyMinimumFuel: emergencyInfo{
+		actions: []EmergencyAction{EmergencyActionAcknowledge},
+	},
+	EmergencyFuel: emergencyInfo{
+		squawk:  0o7700,
+		actions: []EmergencyAction{EmergencyActionAcknowledge, EmergencyActionApproach},
+	},
+}
+
+// ScheduledEmergency is specified in scenario files to start an emergency
+// at a given time after the sim starts.
+type ScheduledEmergency struct {
+	Type         EmergencyType `json:"type"`
+	AfterMinutes float32       `json:"after_minutes"`
+	// Callsign optionally gives the aircraft to have the emergency;
+	// otherwise one is chosen at random from those that it could happen
+	// to.
+	Callsign string `json:"callsign,omitempty"`
+}
+
+func (se ScheduledEmergency) Validate() error {
+	if _, ok := emergencyInfos[se.Type]; !ok {
+		return fmt.Errorf("%q: unknown emergency type", se.Type)
+	}
+	if se.AfterMinutes < 0 {
+		return fmt.Errorf("%.1f: \"after_minutes\" must not be negative", se.AfterMinutes)
+	}
+	return nil
+}
+
+type FutureEmergency struct {
+	Type     EmergencyType
+	Callsign string
+	Time     time.Time
+}
+
+func (s *Sim) scheduleEmergencies(se []ScheduledEmergency) {
+	for _, e := range se {
+		s.FutureEmergencies = append(s.FutureEmergencies, FutureEmergency{
+			Type:     e.Type,
+			Callsign: e.Callsign,
+			Time:     s.State.SimTime.Add(time.Duration(e.AfterMinutes * float32(time.Minute))),
+		})
+	}
+}
+
+// Emergency records an aircraft's emergency and the controller's
+// response to it.
+type Emergency struct {
+	Type       EmergencyType
+	Callsign   string
+	Controller string
+	Required   []EmergencyAction
+	Completed  []EmergencyAction
+	Deadline   time.Time
+	// Resolved is set once the controller's response has been scored;
+	// the aircraft continues to behave accordingly after that.
+	Resolved bool
+}
+
+// emergencyResponseWindow is how long the controller has to take all of
+// the expected actions.
+const emergencyResponseWindow = 10 * time.Minute
+
+// TriggerEmergency starts an emergency of the given type for the
+// aircraft. Only instructors and the launch controller may do so.
+func (s *Sim) TriggerEmergency(tcp, callsign string, t EmergencyType) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if lctrl := s.State.LaunchConfig.Controller; !s.Instructors[tcp] && lctrl != "" && lctrl != tcp {
+		return ErrNotLaunchController
+	}
+	return s.triggerEmergency(callsign, t)
+}
+
+// InstructorTriggerEmergency starts an emergency on behalf of an
+// instructor who isn't signed in to the sim (e.g., via the server's
+// control API).
+func (s *Sim) InstructorTriggerEmergency(callsign string, t EmergencyType) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	return s.triggerEmergency(callsign, t)
+}
+
+func (s *Sim) triggerEmergency(callsign string, t EmergencyType) error {
+	ac, ok := s.State.Aircraft[callsign]
+	if !ok {
+		return av.ErrNoAircraftForCallsign
+	}
+	if _, ok := emergencyInfos[t]; !ok {
+		return ErrUnknownEmergency
+	}
+	if s.emergencyFor(callsign) != nil {
+		return ErrAircraftHasEmergency
+	}
+
+	s.startEmergency(ac, t)
+	return nil
+}
+
+func (s *Sim) emergencyFor(callsign string) *Emergency {
+	for i := range s.Emergencies {
+		if s.Emergencies[i].Callsign == callsign {
+			return &s.Emergencies[i]
+		}
+	}
+	return nil
+}
+
+// emergencyCandidate returns true if the given emergency could plausibly
+// happen to the aircraft now.
+func (s *Sim) emergencyCandidate(ac *av.Aircraft, t EmergencyType) bool {
+	info := emergencyInfos[t]
+	if ac.FlightPlan == nil || (ac.FlightPlan.Rules == av.VFR) != info.vfr {
+		return false
+	}
+	if !ac.IsAirborne() || ac.Altitude() < info.minAlt || s.emergencyFor(ac.Callsign) != nil {
+		return false
+	}
+	if s.PseudoPilotAircraft[ac.Callsign] != "" || s.isExternalAircraft(ac.Callsign) {
+		return false
+	}
+	if info.vfr {
+		return true
+	}
+	// IFR emergencies are only interesting if a human is working the
+	// aircraft.
+	_, ok := s.humanControllers[ac.ControllingController]
+	return ok
+}
+
+func (s *Sim) startEmergency(ac *av.Aircraft, t EmergencyType) {
+	info := emergencyInfos[t]
+	em := Emergency{
+		Type:       t,
+		Callsign:   ac.Callsign,
+		Controller: ac.ControllingController,
+		Required:   info.actions,
+		Deadline:   s.State.SimTime.Add(emergencyResponseWindow),
+	}
+	if em.Controller == "" {
+		em.Controller = ac.TrackingController
+	}
+	if ac.TrackingController != "" && slices.Contains(em.Required, EmergencyActionTrack) {
+		em.Completed = append(em.Completed, EmergencyActionTrack)
+	}
+
+	if info.squawk != 0 {
+		s.enqueueTransponderChange(ac.Callsign, info.squawk, ac.Mode)
+	}
+
+	var description, call string
+	switch t {
+	case EmergencyEngineFailure:
+		description = "engine failure"
+		call = "mayday, mayday, mayday, we've lost an engine, request vectors to the nearest suitable airport"
+		// Level off if climbing; the aircraft can't hold a climb on one
+		// engine.
+		if target, _ := ac.Nav.TargetAltitude(s.lg); target > ac.Altitude() {
+			ac.AssignAltitude(1000*int((ac.Altitude()+999)/1000), false)
+		}
+
+	case EmergencyPressurization:
+		description = "loss of cabin pressure"
+		if ac.Altitude() > 10000 {
+			call = "mayday, mayday, mayday, we've lost cabin pressure, we're starting an emergency descent to 10,000"
+			ac.AssignAltitude(10000, false)
+			ac.ExpediteDescent()
+		} else {
+			call = "pan-pan, pan-pan, pan-pan, we've lost cabin pressure, we need to stay at or below 10,000"
+		}
+
+	case EmergencyRadioFailure:
+		description = "radio failure; can receive but not transmit"
+
+	case EmergencyNORDOVFR:
+		description = "VFR aircraft with no radio"
+
+	case EmergencyHijack:
+		// Crews don't announce a hijacking on the frequency.
+		description = "unlawful interference"
+
+	case EmergencyMinimumFuel:
+		description = "minimum fuel"
+		call = "we're declaring minimum fuel"
+
+	case EmergencyFuel:
+		description = "fuel emergency"
+		call = "mayday, mayday, mayday, we're declaring an emergency for fuel, we need to land as soon as possible"
+	}
+
+	s.declarePriority(ac, util.Select(t == EmergencyMinimumFuel, av.PriorityMinimumFuel, av.PriorityEmergency))
+
+	s.Emergencies = append(s.Emergencies, em)
+
+	s.lg.Infof("%s: emergency %s: %s", ac.Callsign, t, description)
+	s.eventStream.Post(Event{
+		Type:         EmergencyEvent,
+		Callsign:     ac.Callsign,
+		ToController: em.Controller,
+		Message:      string(t) + ": " + description,
+	})
+	if call != "" && ac.ControllingController != "" {
+		s.postRadioEvents(ac.Callsign, []av.RadioTransmission{av.RadioTransmission{
+			Controller: ac.ControllingController,
+			Message:    call,
+			Type:       av.RadioTransmissionUnexpected,
+		}})
+	}
+}
+
+// emergencyAction is called when a controller does something to an
+// aircraft that may be one of the actions expected for its emergency.
+func (s *Sim) emergencyAction(tcp, callsign string, action EmergencyAction) {
+	em := s.emergencyFor(callsign)
+	if em == nil || em.Resolved || s.isPseudoPilotFor(tcp, callsign) {
+		return
+	}
+	if !slices.Contains(em.Required, action) || slices.Contains(em.Completed, action) {
+		return
+	}
+
+	em.Completed = append(em.Completed, action)
+	s.eventStream.Post(Event{
+		Type:           EmergencyActionEvent,
+		Callsign:       callsign,
+		FromController: tcp,
+		ToController:   em.Controller,
+		Message:        string(em.Type) + ": " + string(action),
+	})
+	if len(em.Completed) == len(em.Required) {
+		s.resolveEmergency(em)
+	}
+}
+
+func (s *Sim) resolveEmergency(em *Emergency) {
+	em.Resolved = true
+
+	result := "handled"
+	if missed := slices.DeleteFunc(slices.Clone(em.Required), func(a EmergencyAction) bool {
+		return slices.Contains(em.Completed, a)
+	}); len(missed) > 0 {
+		var m []string
+		for _, a := range missed {
+			m = append(m, string(a))
+		}
+		result = "missed " + strings.Join(m, ", ")
+	}
+
+	s.lg.Infof("%s: emergency %s %s", em.Callsign, em.Type, result)
+	s.eventStream.Post(Event{
+		Type:         EmergencyResolvedEvent,
+		Callsign:     em.Callsign,
+		ToController: em.Controller,
+		Message:      string(em.Type) + ": " + result,
+	})
+}
+
+// updateEmergencies starts scheduled emergencies that are due, resolves
+// ones that the controller has run out of time to respond to, and
+// forgets about aircraft that are gone.
+func (s *Sim) updateEmergencies() {
+	if s.prespawn {
+		return
+	}
+
+	s.FutureEmergencies = slices.DeleteFunc(s.FutureEmergencies, func(fe FutureEmergency) bool {
+		if s.State.SimTime.Before(fe.Time) {
+			return false
+		}
+
+		if fe.Callsign != "" {
+			if ac, ok := s.State.Aircraft[fe.Callsign]; ok && ac.IsAirborne() && s.emergencyFor(fe.Callsign) == nil {
+				s.startEmergency(ac, fe.Type)
+				return true
+			}
+			// Keep waiting for it to show up.
+			return false
+		}
+
+		var candidates []*av.Aircraft
+		for _, ac := range s.State.Aircraft {
+			if s.emergencyCandidate(ac, fe.Type) {
+				candidates = append(candidates, ac)
+			}
+		}
+		if len(candidates) == 0 {
+			// Try again later.
+			return false
+		}
+		// Sort so that deterministic sims pick the same one.
+		slices.SortFunc(candidates, func(a, b *av.Aircraft) int { return strings.Compare(a.Callsign, b.Callsign) })
+		s.startEmergency(candidates[s.Rand.Intn(len(candidates))], fe.Type)
+		return true
+	})
+
+	for i := range s.Emergencies {
+		em := &s.Emergencies[i]
+		_, ok := s.State.Aircraft[em.Callsign]
+		if !em.Resolved && (!ok || s.State.SimTime.After(em.Deadline)) {
+			s.resolveEmergency(em)
+		}
+	}
+	s.Emergencies = slices.DeleteFunc(s.Emergencies, func(em Emergency) bool {
+		_, ok := s.State.Aircraft[em.Callsign]
+		return !ok
+	})
+}
+
+// radioForEmergency applies the effect of an emergency on the aircraft's
+// radio to an instruction issued to it: aircraft that can't hear the
+// controller ignore it and aircraft that can't transmit follow it
+// without reading it back. Pseudo-pilots flying the aircraft aren't
+// affected.
+func (s *Sim) radioForEmergency(tcp string, ac *av.Aircraft,
+	cmd func(tcp string, ac *av.Aircraft) []av.RadioTransmission) []av.RadioTransmission {
+	em := s.emergencyFor(ac.Callsign)
+	if em == nil || s.isPseudoPilotFor(tcp, ac.Callsign) {
+		return cmd(tcp, ac)
+	}
+
+	info := emergencyInfos[em.Type]
+	if info.deaf {
+		return nil
+	}
+	rt := cmd(tcp, ac)
+	s.emergencyAction(tcp, ac.Callsign, EmergencyActionAcknowledge)
+	if info.mute {
+		return nil
+	}
+	return rt
+}
+
+// emergencyCanHear returns false if the aircraft's emergency prevents it
+// from hearing the controller.
+func (s *Sim) emergencyCanHear(callsign string) bool {
+	em := s.emergencyFor(callsign)
+	return em == nil || !emergencyInfos[em.Type].deaf
+}
@@ -0,0 +1,295 @@
+// pkg/sim/emergency_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/rand"
+)
+
+// makeEmergencyTestSim returns a sim where 2K is working AAL1, an IFR at
+// 15,000', and N123AB is a VFR that nobody is working.
+func makeEmergencyTestSim(t *testing.T) *Sim {
+	s := newTestSim(t, &State{
+		Aircraft:      make(map[string]*av.Aircraft),
+		ERAMComputers: &ERAMComputers{},
+		SimTime:       testSimTime,
+	})
+	s.humanControllers = map[string]*EventsSubscription{"2K": nil}
+	s.Instructors = make(map[string]bool)
+	s.Rand = rand.New()
+
+	for _, ac := range []*av.Aircraft{
+		{Callsign: "AAL1", ControllingController: "2K", TrackingController: "2K", Squawk: 0o1234,
+			FlightPlan: &av.FlightPlan{Rules: av.IFR}},
+		{Callsign: "N123AB", Squawk: 0o1200, FlightPlan: &av.FlightPlan{Rules: av.VFR}},
+	} {
+		ac.Nav.FlightState = av.FlightState{Altitude: 15000, IAS: 250}
+		ac.Nav.Perf.Ceiling = 40000
+		if ac.Callsign == "N123AB" {
+			ac.Nav.FlightState.Altitude = 3500
+		}
+		s.State.Aircraft[ac.Callsign] = ac
+	}
+	return s
+}
+
+// emergencyEvents returns the emergency events in the subscription along
+// with the messages of any radio transmissions.
+func emergencyEvents(sub *EventsSubscription) (emergency []Event, radio []string) {
+	for _, e := range sub.Get() {
+		switch e.Type {
+		case EmergencyEvent, EmergencyActionEvent, EmergencyResolvedEvent:
+			emergency = append(emergency, e)
+		case RadioTransmissionEvent:
+			radio = append(radio, e.Message)
+		}
+	}
+	return
+}
+
+func TestParseEmergencyType(t *testing.T) {
+	for _, test := range []struct {
+		s        string
+		expected EmergencyType
+		ok       bool
+	}{
+		{"ENG", EmergencyEngineFailure, true},
+		{"press", EmergencyPressurization, true},
+		{"RDOF", EmergencyRadioFailure, true},
+		{"NORDO", EmergencyNORDOVFR, true},
+		{"hijack", EmergencyHijack, true},
+		{"MINF", EmergencyMinimumFuel, true},
+		{"FUEL", EmergencyFuel, true},
+		{"engine_failure", EmergencyEngineFailure, true},
+		{"NORDO_VFR", EmergencyNORDOVFR, true},
+		{"bird_strike", "", false},
+		{"", "", false},
+	} {
+		et, ok := ParseEmergencyType(test.s)
+		if ok != test.ok || (ok && et != test.expected) {
+			t.Errorf("%q: got %q/%v, expected %q/%v", test.s, et, ok, test.expected, test.ok)
+		}
+	}
+
+	for _, test := range []struct {
+		se    ScheduledEmergency
+		valid bool
+	}{
+		{ScheduledEmergency{Type: EmergencyHijack, AfterMinutes: 10}, true},
+		{ScheduledEmergency{Type: EmergencyFuel, Callsign: "AAL1"}, true},
+		{ScheduledEmergency{Type: "bird_strike", AfterMinutes: 10}, false},
+		{ScheduledEmergency{Type: EmergencyHijack, AfterMinutes: -1}, false},
+	} {
+		if err := test.se.Validate(); (err == nil) != test.valid {
+			t.Errorf("%+v: got error %v, expected valid %v", test.se, err, test.valid)
+		}
+	}
+}
+
+func TestTriggerEmergency(t *testing.T) {
+	s := makeEmergencyTestSim(t)
+	sub := s.eventStream.Subscribe()
+
+	if err := s.triggerEmergency("AAL1", EmergencyPressurization); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// The pilot starts an emergency descent, squawks 7700, and lets the
+	// controller know.
+	ac := s.State.Aircraft["AAL1"]
+	if alt := ac.Nav.Altitude.Assigned; alt == nil || *alt != 10000 {
+		t.Errorf("got assigned altitude %v, expected 10000", alt)
+	}
+	if len(s.FutureSquawkChanges) != 1 || s.FutureSquawkChanges[0].Code != 0o7700 {
+		t.Errorf("got squawk changes %+v, expected 7700", s.FutureSquawkChanges)
+	}
+	if ac.DeclaredPriority&av.PriorityEmergency == 0 {
+		t.Errorf("emergency priority wasn't declared")
+	}
+	em, radio := emergencyEvents(sub)
+	if len(em) != 1 || em[0].Type != EmergencyEvent || em[0].ToController != "2K" ||
+		em[0].Message != "pressurization: loss of cabin pressure" {
+		t.Errorf("got events %+v", em)
+	}
+	if len(radio) != 1 || radio[0] != "mayday, mayday, mayday, we've lost cabin pressure, we're starting an emergency descent to 10,000" {
+		t.Errorf("got transmissions %q", radio)
+	}
+	if e := s.emergencyFor("AAL1"); e == nil || e.Controller != "2K" ||
+		!slices.Equal(e.Required, []EmergencyAction{EmergencyActionAcknowledge, EmergencyActionDescend}) ||
+		!e.Deadline.Equal(s.State.SimTime.Add(emergencyResponseWindow)) {
+		t.Errorf("got emergency %+v", e)
+	}
+
+	if err := s.triggerEmergency("AAL1", EmergencyHijack); err != ErrAircraftHasEmergency {
+		t.Errorf("got %v for a second emergency, expected %v", err, ErrAircraftHasEmergency)
+	}
+	if err := s.triggerEmergency("UAL2", EmergencyHijack); err != av.ErrNoAircraftForCallsign {
+		t.Errorf("got %v for an unknown aircraft, expected %v", err, av.ErrNoAircraftForCallsign)
+	}
+	if err := s.triggerEmergency("N123AB", "bird_strike"); err != ErrUnknownEmergency {
+		t.Errorf("got %v for an unknown emergency, expected %v", err, ErrUnknownEmergency)
+	}
+
+	// Only instructors and the launch controller can trigger them.
+	s.State.LaunchConfig.Controller = "2K"
+	if err := s.TriggerEmergency("2J", "N123AB", EmergencyNORDOVFR); err != ErrNotLaunchController {
+		t.Errorf("got %v from 2J, expected %v", err, ErrNotLaunchController)
+	}
+	s.Instructors["2J"] = true
+	if err := s.TriggerEmergency("2J", "N123AB", EmergencyNORDOVFR); err != nil {
+		t.Errorf("unexpected error %v from an instructor", err)
+	}
+}
+
+func TestEmergencyActions(t *testing.T) {
+	readback := func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+		return []av.RadioTransmission{{Controller: tcp, Message: "roger", Type: av.RadioTransmissionReadback}}
+	}
+
+	t.Run("hijack", func(t *testing.T) {
+		s := makeEmergencyTestSim(t)
+		s.startEmergency(s.State.Aircraft["AAL1"], EmergencyHijack)
+		sub := s.eventStream.Subscribe()
+
+		// Unexpected actions don't count.
+		s.emergencyAction("2K", "AAL1", EmergencyActionIdent)
+		if rt := s.radioForEmergency("2K", s.State.Aircraft["AAL1"], readback); len(rt) != 1 {
+			t.Errorf("got %+v, expected a readback", rt)
+		}
+
+		em, _ := emergencyEvents(sub)
+		if len(em) != 2 || em[0].Type != EmergencyActionEvent || em[0].Message != "hijack: acknowledge" ||
+			em[1].Type != EmergencyResolvedEvent || em[1].Message != "hijack: handled" {
+			t.Errorf("got events %+v", em)
+		}
+		if e := s.emergencyFor("AAL1"); !e.Resolved {
+			t.Errorf("emergency wasn't resolved")
+		}
+	})
+
+	t.Run("radio failure", func(t *testing.T) {
+		s := makeEmergencyTestSim(t)
+		s.startEmergency(s.State.Aircraft["AAL1"], EmergencyRadioFailure)
+
+		called := false
+		rt := s.radioForEmergency("2K", s.State.Aircraft["AAL1"], func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			called = true
+			return readback(tcp, ac)
+		})
+		if !called || rt != nil {
+			t.Errorf("got called %v, transmissions %+v; expected the instruction to be followed silently", called, rt)
+		}
+		if !s.emergencyCanHear("AAL1") {
+			t.Errorf("aircraft with a radio failure can't hear")
+		}
+
+		s.emergencyAction("2K", "AAL1", EmergencyActionIdent)
+		if e := s.emergencyFor("AAL1"); !e.Resolved {
+			t.Errorf("emergency wasn't resolved after the ident")
+		}
+	})
+
+	t.Run("NORDO", func(t *testing.T) {
+		s := makeEmergencyTestSim(t)
+		s.startEmergency(s.State.Aircraft["N123AB"], EmergencyNORDOVFR)
+
+		rt := s.radioForEmergency("2K", s.State.Aircraft["N123AB"], func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			t.Errorf("NORDO aircraft followed an instruction")
+			return nil
+		})
+		if rt != nil || s.emergencyCanHear("N123AB") {
+			t.Errorf("NORDO aircraft responded")
+		}
+	})
+
+	t.Run("pseudo-pilot", func(t *testing.T) {
+		s := makeEmergencyTestSim(t)
+		s.PseudoPilots = map[string]bool{"PP": true}
+		s.PseudoPilotAircraft = map[string]string{"AAL1": "PP"}
+		s.startEmergency(s.State.Aircraft["AAL1"], EmergencyRadioFailure)
+
+		// Pseudo-pilots can talk and their instructions don't count as
+		// the controller's response.
+		if rt := s.radioForEmergency("PP", s.State.Aircraft["AAL1"], readback); len(rt) != 1 {
+			t.Errorf("got %+v, expected a readback", rt)
+		}
+		s.emergencyAction("PP", "AAL1", EmergencyActionIdent)
+		if e := s.emergencyFor("AAL1"); e.Resolved {
+			t.Errorf("pseudo-pilot resolved the emergency")
+		}
+	})
+}
+
+func TestUpdateEmergencies(t *testing.T) {
+	s := makeEmergencyTestSim(t)
+	sub := s.eventStream.Subscribe()
+
+	s.scheduleEmergencies([]ScheduledEmergency{
+		{Type: EmergencyMinimumFuel, AfterMinutes: 1, Callsign: "UAL2"},
+		{Type: EmergencyNORDOVFR, AfterMinutes: 2},
+		{Type: EmergencyHijack, AfterMinutes: 2},
+	})
+	step := func(d time.Duration) {
+		s.State.SimTime = s.State.SimTime.Add(d)
+		s.updateEmergencies()
+	}
+
+	// UAL2 isn't around yet; it starts once it shows up.
+	step(90 * time.Second)
+	if len(s.FutureEmergencies) != 3 {
+		t.Errorf("got future emergencies %+v, expected all 3 to still be pending", s.FutureEmergencies)
+	}
+	ual2 := &av.Aircraft{Callsign: "UAL2", ControllingController: "2K", FlightPlan: &av.FlightPlan{Rules: av.IFR}}
+	ual2.Nav.FlightState = av.FlightState{Altitude: 9000, IAS: 250}
+	s.State.Aircraft["UAL2"] = ual2
+	step(time.Second)
+	if s.emergencyFor("UAL2") == nil {
+		t.Errorf("scheduled emergency didn't start for UAL2")
+	}
+
+	// The NORDO emergency can only happen to the VFR. AAL1 is the only
+	// IFR that a human is working that doesn't already have an
+	// emergency, so it gets the hijacking.
+	step(time.Minute)
+	if e := s.emergencyFor("N123AB"); e == nil || e.Type != EmergencyNORDOVFR {
+		t.Errorf("got emergency %+v for N123AB, expected NORDO", e)
+	}
+	if e := s.emergencyFor("AAL1"); e == nil || e.Type != EmergencyHijack {
+		t.Errorf("got emergency %+v for AAL1, expected hijack", e)
+	}
+	if len(s.FutureEmergencies) != 0 {
+		t.Errorf("got future emergencies %+v, expected none", s.FutureEmergencies)
+	}
+
+	// The controller never acknowledges the minimum fuel.
+	sub.Get()
+	step(emergencyResponseWindow)
+	em, _ := emergencyEvents(sub)
+	if !slices.ContainsFunc(em, func(e Event) bool {
+		return e.Type == EmergencyResolvedEvent && e.Callsign == "UAL2" && e.Message == "minimum_fuel: missed acknowledge"
+	}) {
+		t.Errorf("got events %+v, expected the minimum fuel to be missed", em)
+	}
+
+	// Emergencies are forgotten once the aircraft is gone.
+	delete(s.State.Aircraft, "UAL2")
+	step(time.Second)
+	if s.emergencyFor("UAL2") != nil {
+		t.Errorf("emergency kept after UAL2 was deleted")
+	}
+
+	// Nothing happens during prespawn.
+	s.scheduleEmergencies([]ScheduledEmergency{{Type: EmergencyFuel}})
+	s.prespawn = true
+	step(time.Minute)
+	if len(s.FutureEmergencies) != 1 {
+		t.Errorf("got future emergencies %+v during prespawn", s.FutureEmergencies)
+	}
+}
@@ -6,10 +6,14 @@ package sim
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 )
 
 var (
 	ErrAircraftAlreadyReleased     = errors.New("Aircraft already released")
+	ErrAircraftHasEmergency        = errors.New("Aircraft already has an emergency")
+	ErrAircraftHasPseudoPilot      = errors.New("Aircraft is flown by another pseudo-pilot")
 	ErrBeaconMismatch              = errors.New("Beacon code mismatch")
 	ErrControllerAlreadySignedIn   = errors.New("Controller with that callsign already signed in")
 	ErrIllegalACID                 = errors.New("Illegal ACID")
@@ -18,12 +22,143 @@ var (
 	ErrIllegalScratchpad           = errors.New("Illegal scratchpad")
 	ErrInvalidAbbreviatedFP        = errors.New("Invalid abbreviated flight plan")
 	ErrInvalidDepartureController  = errors.New("Invalid departure controller")
+	ErrInvalidEFC                  = errors.New("Invalid EFC time")
+	ErrInvalidFastForwardRate      = errors.New("Fast-forward rate must be between 2 and 8")
+	ErrInvalidNOTAM                = errors.New("Invalid NOTAM")
+	ErrInvalidPIREP                = errors.New("Invalid PIREP")
 	ErrInvalidRestrictionAreaIndex = errors.New("Invalid restriction area index")
+	ErrInvalidRoute                = errors.New("Route has no known fixes")
+	ErrInvalidTrafficRestriction   = errors.New("Invalid traffic restriction")
+	ErrNoAPREQ                     = errors.New("Departure does not need a release")
+	ErrNoBeaconMismatch            = errors.New("Aircraft is squawking its assigned code")
+	ErrNoCheckpoint                = errors.New("No checkpoints available to rewind to")
+	ErrNoDeviationRequest          = errors.New("Aircraft has not requested a deviation")
+	ErrNoFlightIDMismatch          = errors.New("Aircraft's flight ID matches its callsign")
 	ErrNoMatchingFlight            = errors.New("No matching flight")
+	ErrNoSVFRRequest               = errors.New("No such special VFR request")
+	ErrNoVehicleRequest            = errors.New("No such vehicle request")
 	ErrNotLaunchController         = errors.New("Not signed in as the launch controller")
+	ErrNotConsolidated             = errors.New("Position is not consolidated")
+	ErrNotPseudoPilot              = errors.New("Not signed in as a pseudo-pilot")
+	ErrNotVFR                      = errors.New("Aircraft is not VFR")
+	ErrNotVirtualController        = errors.New("Controller is not a virtual controller")
+	ErrPositionAlreadyConsolidated = errors.New("Position is already consolidated")
+	ErrPreferenceSetsTooLarge      = errors.New("Preference sets are too large")
+	ErrReleaseAlreadyRequested     = errors.New("Release already requested")
+	ErrRunwayClosed                = errors.New("Runway is closed")
+	ErrSVFRBelowMinimums           = errors.New("Visibility is below special VFR minimums")
+	ErrSimNotPaused                = errors.New("Sim is not paused")
 	ErrTooManyRestrictionAreas     = errors.New("Too many restriction areas specified")
 	ErrUnknownController           = errors.New("Unknown controller")
 	ErrUnknownControllerFacility   = errors.New("Unknown controller facility")
+	ErrUnknownEmergency            = errors.New("Unknown emergency type")
+	ErrUnknownFacility             = errors.New("Unknown facility")
+	ErrUnknownNOTAM                = errors.New("Unknown NOTAM")
+	ErrUnknownSectorization        = errors.New("Unknown sectorization")
+	ErrUnknownTrafficRestriction   = errors.New("Unknown traffic restriction")
 	ErrViolatedAirspace            = errors.New("Violated B/C airspace")
 	ErrVFRSimTookTooLong           = errors.New("VFR simulation took too long")
 )
+
+///////////////////////////////////////////////////////////////////////////
+// NASError
+
+// NASError is returned by the ERAM and STARS computers; it wraps one of
+// the sentinel errors above (or from the aviation package) with the
+// context in which it happened so that problems with a particular flight
+// can be tracked down. errors.Is works as expected with NASErrors.
+type NASError struct {
+	Err         error
+	Facility    string
+	Callsign    string
+	MessageType int
+}
+
+func (e *NASError) Error() string {
+	var ctx []string
+	if e.Facility != "" {
+		ctx = append(ctx, "facility="+e.Facility)
+	}
+	if e.Callsign != "" {
+		ctx = append(ctx, "callsign="+e.Callsign)
+	}
+	if e.MessageType != Unset {
+		ctx = append(ctx, "msg="+MessageTypeString(e.MessageType))
+	}
+
+	if len(ctx) == 0 {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + " [" + strings.Join(ctx, " ") + "]"
+}
+
+func (e *NASError) Unwrap() error {
+	return e.Err
+}
+
+// nasError wraps err in a NASError with the given context. nil is
+// returned if err is nil and existing NASErrors are returned unchanged
+// so that the innermost context is preserved.
+func nasError(err error, facility, callsign string, messageType int) error {
+	if err == nil {
+		return nil
+	}
+	var ne *NASError
+	if errors.As(err, &ne) {
+		return err
+	}
+	return &NASError{Err: err, Facility: facility, Callsign: callsign, MessageType: messageType}
+}
+
+// ParseNASError reconstructs a NASError from the string returned by its
+// Error method; this allows the context to survive being passed through
+// RPC calls. The wrapped error is set using the provided decode function,
+// which should map an error message to the corresponding sentinel error
+// (or return nil if there isn't one).
+func ParseNASError(s string, decode func(string) error) (*NASError, bool) {
+	msg, ctx, ok := strings.Cut(s, " [")
+	if !ok || !strings.HasSuffix(ctx, "]") {
+		return nil, false
+	}
+
+	ne := &NASError{Err: decode(msg)}
+	if ne.Err == nil {
+		ne.Err = errors.New(msg)
+	}
+	for _, f := range strings.Fields(strings.TrimSuffix(ctx, "]")) {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			return nil, false
+		}
+		switch k {
+		case "facility":
+			ne.Facility = v
+		case "callsign":
+			ne.Callsign = v
+		case "msg":
+			ne.MessageType = parseMessageType(v)
+		default:
+			return nil, false
+		}
+	}
+	return ne, true
+}
+
+var messageTypeNames = []string{"Unset", "Plan", "Amendment", "Cancellation", "RequestFlightPlan",
+	"DepartureDM", "BeaconTerminate", "InitiateTransfer", "AcceptRecallTransfer"}
+
+func MessageTypeString(mt int) string {
+	if mt >= 0 && mt < len(messageTypeNames) {
+		return messageTypeNames[mt]
+	}
+	return "MessageType(" + strconv.Itoa(mt) + ")"
+}
+
+func parseMessageType(s string) int {
+	for i, n := range messageTypeNames {
+		if n == s {
+			return i
+		}
+	}
+	return Unset
+}
@@ -0,0 +1,49 @@
+// pkg/sim/errors_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"errors"
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+func TestNASError(t *testing.T) {
+	err := nasError(av.ErrNoAircraftForCallsign, "N90", "AAL123", InitiateTransfer)
+	if !errors.Is(err, av.ErrNoAircraftForCallsign) {
+		t.Errorf("errors.Is failed for wrapped error")
+	}
+	if s := err.Error(); s != "No aircraft exists with specified callsign [facility=N90 callsign=AAL123 msg=InitiateTransfer]" {
+		t.Errorf("unexpected error string %q", s)
+	}
+
+	// Rewrapping keeps the original context
+	if err2 := nasError(err, "ZNY", "", Plan); err2 != err {
+		t.Errorf("NASError was rewrapped: %v", err2)
+	}
+	if nasError(nil, "N90", "", Unset) != nil {
+		t.Errorf("expected nil for nil error")
+	}
+
+	decode := func(s string) error {
+		if s == av.ErrNoAircraftForCallsign.Error() {
+			return av.ErrNoAircraftForCallsign
+		}
+		return nil
+	}
+	ne, ok := ParseNASError(err.Error(), decode)
+	if !ok {
+		t.Fatalf("unable to parse %q", err.Error())
+	}
+	if ne.Err != av.ErrNoAircraftForCallsign || ne.Facility != "N90" || ne.Callsign != "AAL123" ||
+		ne.MessageType != InitiateTransfer {
+		t.Errorf("parse mismatch: %+v", ne)
+	}
+
+	if _, ok := ParseNASError("Unknown facility", decode); ok {
+		t.Errorf("unexpectedly parsed error without context")
+	}
+}
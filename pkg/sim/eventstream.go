@@ -207,6 +207,33 @@ const (
 	TransferAcceptedEvent
 	TransferRejectedEvent
 	RecalledPointOutEvent
+	PseudoPilotInstructionEvent
+	PilotErrorEvent
+	PilotErrorResolvedEvent
+	EmergencyEvent
+	EmergencyActionEvent
+	EmergencyResolvedEvent
+	GoAroundEvent
+	RejectedTakeoffEvent
+	TaxiConflictEvent
+	SimRewoundEvent
+	LOAViolationEvent
+	RestrictionWarningEvent
+	RestrictionMissedEvent
+	TCASRAEvent
+	APREQEvent
+	AmbiguousTrackEvent
+	CallsignMismatchEvent
+	TMIViolationEvent
+	WeatherDeviationEvent
+	PIREPEvent
+	PriorityHandlingEvent
+	AircraftSpawnedEvent
+	CoordinationEvent
+	PointOutSuggestionEvent
+	MissedPointOutEvent
+	AirspaceViolationEvent
+	PhraseologyEvent
 	NumEventTypes
 )
 
@@ -216,7 +243,13 @@ func (t EventType) String() string {
 		"RejectedHandoff", "RadioTransmission", "StatusMessage", "ServerBroadcastMessage",
 		"GlobalMessage", "AcknowledgedPointOut", "RejectedPointOut", "Ident", "HandoffControl",
 		"SetGlobalLeaderLine", "TrackClicked", "ForceQL", "TransferAccepted", "TransferRejected",
-		"RecalledPointOut"}[t]
+		"RecalledPointOut", "PseudoPilotInstruction", "PilotError", "PilotErrorResolved",
+		"Emergency", "EmergencyAction", "EmergencyResolved", "GoAround", "RejectedTakeoff",
+		"TaxiConflict", "SimRewound", "LOAViolation",
+		"RestrictionWarning", "RestrictionMissed", "TCASRA", "APREQ", "AmbiguousTrack",
+		"CallsignMismatch", "TMIViolation", "WeatherDeviation", "PIREP", "PriorityHandling",
+		"AircraftSpawned", "Coordination", "PointOutSuggestion", "MissedPointOut",
+		"AirspaceViolation", "Phraseology"}[t]
 }
 
 type Event struct {
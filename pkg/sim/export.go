@@ -0,0 +1,166 @@
+// pkg/sim/export.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/swim"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// The sim's flight plans and tracks can be exported as SWIM-style feeds
+// for external tools; see pkg/swim.
+
+// Tracks are exported at the STARS radar scan rate.
+const exportInterval = 5 * time.Second
+
+type exportState struct {
+	server     *swim.Server
+	lastExport time.Time // sim time
+	nextTrack  int
+	tracks     map[string]*exportedTrack
+	plans      map[string]av.FlightPlan
+}
+
+type exportedTrack struct {
+	num      int
+	altitude float32
+}
+
+// updateExport is called once a second of sim time.
+func (s *Sim) updateExport() {
+	if s.ExportConfig == nil {
+		return
+	}
+
+	ex := &s.export
+	if ex.server == nil {
+		server, err := swim.Listen(*s.ExportConfig, s.lg)
+		if err != nil {
+			s.lg.Errorf("Unable to start export: %v", err)
+			s.eventStream.Post(Event{
+				Type:    StatusMessageEvent,
+				Message: "Unable to export flight data: " + err.Error(),
+			})
+			s.ExportConfig = nil
+			return
+		}
+		*ex = exportState{
+			server: server,
+			tracks: make(map[string]*exportedTrack),
+			plans:  make(map[string]av.FlightPlan),
+		}
+	}
+
+	now := s.State.SimTime
+	dt := now.Sub(ex.lastExport)
+	if dt < exportInterval {
+		return
+	}
+	ex.lastExport = now
+
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+
+		if fp := ac.FlightPlan; fp != nil {
+			prev, ok := ex.plans[callsign]
+			if !ok || prev != *fp {
+				ex.plans[callsign] = *fp
+				s.sendExport(s.makeFlightData(ac, ok))
+			}
+		}
+
+		if ac.Mode == av.Standby || ac.WaitingForLaunch || (ac.HoldForRelease && !ac.Released) {
+			continue
+		}
+		tr, ok := ex.tracks[callsign]
+		if !ok {
+			ex.nextTrack++
+			tr = &exportedTrack{num: ex.nextTrack, altitude: ac.Altitude()}
+			ex.tracks[callsign] = tr
+		}
+		vvert := (ac.Altitude() - tr.altitude) / float32(dt.Minutes())
+		tr.altitude = ac.Altitude()
+
+		pos := ac.Position()
+		s.sendExport(swim.Track{
+			Time:       now,
+			Facility:   s.State.TRACON,
+			TrackNum:   tr.num,
+			ACID:       callsign,
+			BeaconCode: ac.Squawk.String(),
+			Lat:        pos[1],
+			Lon:        pos[0],
+			Altitude:   int(ac.Altitude()),
+			GS:         int(ac.GS()),
+			Heading:    int(math.NormalizeHeading(ac.Heading() - s.State.MagneticVariation)),
+			VVert:      int(vvert),
+			Owner:      ac.TrackingController,
+			Handoff:    ac.HandoffTrackController,
+		})
+	}
+
+	// Forget about aircraft that have left.
+	for callsign := range ex.tracks {
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(ex.tracks, callsign)
+			delete(ex.plans, callsign)
+		}
+	}
+}
+
+func (s *Sim) makeFlightData(ac *av.Aircraft, amendment bool) swim.FlightData {
+	fp := ac.FlightPlan
+	fd := swim.FlightData{
+		Type:         "FlightPlanInformation",
+		Time:         s.State.SimTime,
+		Facility:     s.State.TRACON,
+		ACID:         ac.Callsign,
+		AircraftType: fp.AircraftType,
+		Rules:        fp.Rules.String(),
+		Departure:    fp.DepartureAirport,
+		Arrival:      fp.ArrivalAirport,
+		Route:        fp.Route,
+		RequestedAlt: fp.Altitude,
+		CruiseSpeed:  fp.CruiseSpeed,
+		ComputerID:   fp.ECID,
+	}
+	if amendment {
+		fd.Type = "FlightPlanAmendmentInformation"
+	}
+	if fp.AssignedSquawk != 0 {
+		fd.BeaconCode = fp.AssignedSquawk.String()
+	}
+	if fp.DepartTimeEst != 0 {
+		fd.EstimatedDepTime = fmt.Sprintf("%04d", fp.DepartTimeEst)
+	}
+	if alt := ac.Nav.Altitude.Assigned; alt != nil {
+		fd.AssignedAlt = int(*alt)
+	}
+	if stars := s.State.STARSComputer(); stars != nil {
+		if ti := stars.TrackInformation[ac.Callsign]; ti != nil && ti.FlightPlan != nil {
+			fd.CoordinationFix = ti.FlightPlan.CoordinationFix
+		}
+	}
+	return fd
+}
+
+func (s *Sim) sendExport(msg swim.Message) {
+	if err := s.export.server.Send(msg); err != nil {
+		s.lg.Warnf("export: %v", err)
+	}
+}
+
+// closeExport stops the export server, if it's running.
+func (s *Sim) closeExport() {
+	if s.export.server != nil {
+		s.export.server.Close()
+		s.export = exportState{}
+	}
+}
@@ -0,0 +1,279 @@
+// pkg/sim/federation.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/federation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// A sim may be federated with another one that handles some of the
+// adjacent facilities (see the federation package). Each sim flies its
+// own aircraft and sends their tracks to the other, where they are added
+// as live traffic (see livetraffic.go). The computers for the other
+// sim's facilities act as stand-ins: the NAS messages that are sent to
+// them are forwarded to the other sim rather than being processed here,
+// and messages that it sends to our facilities are delivered to our
+// computers. Handoffs to and from its controllers are exchanged much as
+// they are for an FSD network (see network.go), and PIREPs made in either
+// sim are shared. The two sims' scenarios
+// should use the same TCPs for the controllers at each facility.
+//
+// Instructions to aircraft aren't forwarded; aircraft are flown by the
+// sim that created them, which treats the other sim's controllers as
+// virtual controllers.
+
+const federationRetryInterval = 30 * time.Second
+
+func (s *Sim) updateFederation() {
+	if s.FederationConfig == nil {
+		return
+	}
+	// Hold messages for the other sim's facilities even while we're not
+	// connected so that they're sent once we are.
+	s.State.ERAMComputers.SetRemoteFacilities(s.FederationConfig.RemoteFacilities)
+
+	if s.federation != nil {
+		if err := s.federation.Err(); err != nil {
+			s.eventStream.Post(Event{
+				Type:    StatusMessageEvent,
+				Message: "Federated sim connection lost: " + err.Error(),
+			})
+			s.federation = nil
+		}
+	}
+	if s.federation == nil {
+		if now := time.Now(); now.After(s.federationRetry) {
+			s.federation = federation.Connect(*s.FederationConfig, s.lg)
+			s.federationRetry = now.Add(federationRetryInterval)
+		}
+		return
+	}
+	if !s.federation.Connected() {
+		return
+	}
+
+	for _, m := range s.federation.Received() {
+		switch {
+		case m.NAS != nil:
+			s.receiveFederatedNAS(*m.NAS)
+		case m.Tracks != nil:
+			s.syncFederatedTracks(m.Tracks.Tracks)
+		case m.Handoff != nil:
+			s.receiveFederatedHandoff(*m.Handoff)
+		case m.PIREP != nil:
+			s.receiveFederatedPIREP(m.PIREP)
+		}
+	}
+
+	s.sendFederatedNAS()
+	if s.State.SimTime.Sub(s.federationTracksSent) >= time.Second {
+		s.sendFederatedTracks()
+		s.federationTracksSent = s.State.SimTime
+	}
+}
+
+func (s *Sim) isFederatedAircraft(callsign string) bool {
+	return s.FederatedAircraft[callsign]
+}
+
+// isRemoteController returns true if the controller is at one of the
+// federated sim's facilities.
+func (s *Sim) isRemoteController(tcp string) bool {
+	if s.FederationConfig == nil {
+		return false
+	}
+	ctrl, ok := s.State.Controllers[tcp]
+	return ok && slices.Contains(s.FederationConfig.RemoteFacilities, ctrl.Facility)
+}
+
+func (s *Sim) sendFederated(m federation.Message) {
+	if s.federation == nil {
+		return
+	}
+	if err := s.federation.Send(m); err != nil {
+		s.lg.Warnf("federation: %v", err)
+	}
+}
+
+// sendFederatedNAS forwards the messages that have been sent to the other
+// sim's facilities.
+func (s *Sim) sendFederatedNAS() {
+	for _, fac := range s.FederationConfig.RemoteFacilities {
+		for _, msg := range s.State.ERAMComputers.TakeMessages(fac) {
+			payload, err := json.Marshal(msg)
+			if err != nil {
+				s.lg.Warnf("%s: federation: %v", fac, err)
+				continue
+			}
+			s.sendFederated(federation.Message{
+				NAS: &federation.NASMessage{Facility: fac, Payload: payload},
+			})
+		}
+	}
+}
+
+func (s *Sim) receiveFederatedNAS(m federation.NASMessage) {
+	var msg FlightPlanMessage
+	if err := json.Unmarshal(m.Payload, &msg); err != nil {
+		s.lg.Warnf("%s: federation: %v", m.Facility, err)
+	} else if err := s.State.ERAMComputers.DeliverMessage(m.Facility, msg); err != nil {
+		s.lg.Warnf("%s: federation: %v", m.Facility, err)
+	}
+}
+
+// sendFederatedPIREP shares a PIREP that was made here.
+func (s *Sim) sendFederatedPIREP(p PIREP) {
+	if s.federation == nil || !s.federation.Connected() {
+		return
+	}
+	if payload, err := json.Marshal(p); err != nil {
+		s.lg.Warnf("PIREP: federation: %v", err)
+	} else {
+		s.sendFederated(federation.Message{PIREP: payload})
+	}
+}
+
+func (s *Sim) receiveFederatedPIREP(payload json.RawMessage) {
+	var p PIREP
+	if err := json.Unmarshal(payload, &p); err != nil {
+		s.lg.Warnf("PIREP: federation: %v", err)
+		return
+	}
+	// Not passed to addPIREP, so that it isn't sent back.
+	s.State.PIREPs = append(s.State.PIREPs, p)
+}
+
+// sendFederatedTracks sends the tracks of the aircraft that we are
+// flying.
+func (s *Sim) sendFederatedTracks() {
+	tracks := []federation.Track{}
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		if s.isExternalAircraft(callsign) || ac.WaitingForLaunch {
+			continue
+		}
+
+		tr := federation.Track{
+			Callsign:   callsign,
+			Squawk:     ac.Squawk,
+			Mode:       ac.Mode,
+			Position:   ac.Position(),
+			Altitude:   ac.Altitude(),
+			GS:         ac.GS(),
+			Heading:    math.NormalizeHeading(ac.Heading() - s.State.MagneticVariation),
+			FlightPlan: ac.FlightPlan,
+		}
+		if !s.isRemoteController(ac.TrackingController) {
+			tr.TrackingController = ac.TrackingController
+		}
+		tracks = append(tracks, tr)
+	}
+	s.sendFederated(federation.Message{Tracks: &federation.TrackUpdate{Tracks: tracks}})
+}
+
+// syncFederatedTracks updates the aircraft that the other sim is flying.
+// Their tracking controller is taken from the other sim if it is one of
+// its controllers; otherwise, it's one of ours and we know better.
+func (s *Sim) syncFederatedTracks(tracks []federation.Track) {
+	if s.FederatedAircraft == nil {
+		s.FederatedAircraft = make(map[string]bool)
+	}
+
+	ext := make([]externalTrack, 0, len(tracks))
+	for _, tr := range tracks {
+		ext = append(ext, externalTrack{
+			Callsign:   tr.Callsign,
+			Squawk:     tr.Squawk,
+			Mode:       tr.Mode,
+			Position:   tr.Position,
+			Altitude:   tr.Altitude,
+			GS:         tr.GS,
+			Heading:    tr.Heading,
+			FlightPlan: tr.FlightPlan,
+		})
+	}
+	s.syncExternalTraffic(ext, s.FederatedAircraft)
+
+	for _, tr := range tracks {
+		ac, ok := s.State.Aircraft[tr.Callsign]
+		if !ok || !s.FederatedAircraft[tr.Callsign] {
+			continue
+		}
+		if s.isRemoteController(tr.TrackingController) {
+			ac.TrackingController = tr.TrackingController
+		} else if tr.TrackingController == "" && s.isRemoteController(ac.TrackingController) {
+			// Dropped by the other sim.
+			ac.TrackingController = ""
+			ac.HandoffTrackController = ""
+		}
+	}
+}
+
+func (s *Sim) receiveFederatedHandoff(h federation.Handoff) {
+	ac, ok := s.State.Aircraft[h.Callsign]
+	if !ok {
+		s.lg.Warnf("%s: federated handoff for unknown aircraft", h.Callsign)
+		return
+	}
+
+	if h.Accepted {
+		if ac.HandoffTrackController != h.To {
+			return
+		}
+		s.eventStream.Post(Event{
+			Type:           AcceptedHandoffEvent,
+			FromController: h.From,
+			ToController:   h.To,
+			Callsign:       ac.Callsign,
+		})
+		ac.TrackingController = h.To
+		ac.HandoffTrackController = ""
+		return
+	}
+
+	if _, ok := s.State.Controllers[h.To]; !ok {
+		s.lg.Warnf("%s: federated handoff to unknown controller %q", h.Callsign, h.To)
+		return
+	}
+	ac.TrackingController = h.From
+	ac.HandoffTrackController = h.To
+	s.eventStream.Post(Event{
+		Type:           OfferedHandoffEvent,
+		FromController: h.From,
+		ToController:   h.To,
+		Callsign:       ac.Callsign,
+	})
+
+	if !s.isActiveHumanController(h.To) {
+		// Virtual controllers accept it after a bit, as usual.
+		acceptDelay := 4 + s.Rand.Intn(10)
+		s.Handoffs[ac.Callsign] = Handoff{
+			Time: s.State.SimTime.Add(time.Duration(acceptDelay) * time.Second),
+		}
+	}
+}
+
+// offerFederatedHandoff sends a handoff to a controller in the other sim.
+func (s *Sim) offerFederatedHandoff(fromTCP, toTCP, callsign string) {
+	s.sendFederated(federation.Message{
+		Handoff: &federation.Handoff{Callsign: callsign, From: fromTCP, To: toTCP},
+	})
+}
+
+// acceptFederatedHandoff lets the other sim know that the handoff of the
+// aircraft to the given controller has been accepted. It must be called
+// before the aircraft's tracking controller is updated.
+func (s *Sim) acceptFederatedHandoff(ac *av.Aircraft, tcp string) {
+	s.sendFederated(federation.Message{
+		Handoff: &federation.Handoff{Callsign: ac.Callsign, From: ac.TrackingController, To: tcp, Accepted: true},
+	})
+}
@@ -0,0 +1,137 @@
+// pkg/sim/flightid.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+// Aircraft with Mode S transponders or ADS-B out downlink a flight ID
+// that the pilot enters; it is compared to the callsign and a
+// CallsignMismatchEvent is posted to the tracking controller when they
+// differ. Pilots occasionally leave the flight number from the previous
+// leg or transpose digits, at a rate given by the launch configuration's
+// FlightIDMismatchRate. The controller resolves the mismatch by having
+// the pilot reset the flight ID.
+
+// assignFlightID sets the flight ID that the aircraft downlinks, if it
+// has Mode S.
+func (s *Sim) assignFlightID(ac *av.Aircraft) {
+	if ac.FlightPlan == nil || !ac.FlightPlan.HasModeS() {
+		return
+	}
+
+	ac.FlightID = ac.Callsign
+	if s.Rand.Float32() < s.State.LaunchConfig.FlightIDMismatchRate {
+		if id, ok := s.wrongFlightID(ac.Callsign); ok {
+			ac.FlightID = id
+			s.lg.Info("flight ID mismatch", slog.String("callsign", ac.Callsign),
+				slog.String("flight_id", id))
+		}
+	}
+}
+
+// wrongFlightID returns a plausible incorrectly-entered flight ID for
+// the given callsign: either the digits of the flight number are
+// transposed or a nearby flight number is used.
+func (s *Sim) wrongFlightID(callsign string) (string, bool) {
+	i := strings.IndexAny(callsign, "0123456789")
+	if i <= 0 {
+		// N-numbers and the like.
+		return "", false
+	}
+	prefix, number := callsign[:i], callsign[i:]
+
+	if len(number) >= 2 && s.Rand.Intn(2) == 0 {
+		d := s.Rand.Intn(len(number) - 1)
+		if number[d] != number[d+1] {
+			b := []byte(number)
+			b[d], b[d+1] = b[d+1], b[d]
+			if b[0] != '0' {
+				return prefix + string(b), true
+			}
+		}
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		// Alphanumeric flight numbers.
+		return "", false
+	}
+	if n > 1 && s.Rand.Intn(2) == 0 {
+		n--
+	} else {
+		n++
+	}
+	if id := prefix + strconv.Itoa(n); len(id) <= 7 {
+		return id, true
+	}
+	return "", false
+}
+
+// checkFlightIDMismatches is called once a second.
+func (s *Sim) checkFlightIDMismatches() {
+	if s.flightIDMismatches == nil {
+		s.flightIDMismatches = make(map[string]string)
+	}
+
+	for callsign := range s.flightIDMismatches {
+		if ac, ok := s.State.Aircraft[callsign]; !ok || !ac.FlightIDMismatch() || ac.TrackingController == "" {
+			delete(s.flightIDMismatches, callsign)
+		}
+	}
+
+	for callsign, ac := range s.State.Aircraft {
+		if ac.TrackingController == "" || !ac.FlightIDMismatch() {
+			continue
+		}
+		if s.flightIDMismatches[callsign] == ac.TrackingController {
+			// This controller has already been told.
+			continue
+		}
+
+		s.flightIDMismatches[callsign] = ac.TrackingController
+		s.eventStream.Post(Event{
+			Type:         CallsignMismatchEvent,
+			Callsign:     callsign,
+			ToController: ac.TrackingController,
+			Message:      "downlinked flight ID " + ac.FlightID,
+		})
+	}
+}
+
+// ResetFlightID has the pilot re-enter the aircraft's flight ID so that
+// it matches the callsign.
+func (s *Sim) ResetFlightID(tcp, callsign string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	return s.dispatchCommand(tcp, callsign,
+		func(tcp string, ac *av.Aircraft) error {
+			if ac.ControllingController != tcp && !s.Instructors[tcp] && !s.isPseudoPilotFor(tcp, ac.Callsign) {
+				return av.ErrOtherControllerHasTrack
+			} else if !ac.FlightIDMismatch() {
+				return ErrNoFlightIDMismatch
+			}
+			return nil
+		},
+		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			return s.radioForEmergency(tcp, ac, func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+				s.lg.Info("flight ID reset", slog.String("callsign", ac.Callsign),
+					slog.String("flight_id", ac.FlightID))
+				ac.FlightID = ac.Callsign
+
+				return []av.RadioTransmission{av.RadioTransmission{
+					Controller: tcp,
+					Message:    "resetting our flight ID",
+					Type:       av.RadioTransmissionReadback,
+				}}
+			})
+		})
+}
@@ -0,0 +1,146 @@
+// pkg/sim/goaround.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/rand"
+)
+
+// In addition to the random go-arounds given by LaunchConfig.GoAroundRate,
+// arrivals go around if they are unstable on short final, if they
+// encounter wind shear (more likely with gusty winds), or if the runway is
+// still occupied when they are about to land. Departures occasionally
+// reject their takeoff, which closes the runway for a few minutes. Both
+// post events so that they can be scored, and a go-around delays the
+// following arrivals to the airport, as the arrival flow would be in
+// practice.
+
+const (
+	// Distance from the threshold at which pilots decide whether the
+	// approach is stable.
+	stabilizedApproachDistance = 1.5
+	// Distance from the threshold inside which an occupied runway
+	// causes a go-around.
+	runwayOccupiedDistance = 0.5
+)
+
+func runwayKey(airport, runway string) string {
+	return airport + "/" + av.TidyRunway(runway)
+}
+
+// occupyRunway records that the runway is unavailable for the given
+// amount of time.
+func (s *Sim) occupyRunway(airport, runway string, d time.Duration) {
+	if s.RunwayOccupied == nil {
+		s.RunwayOccupied = make(map[string]time.Time)
+	}
+	key := runwayKey(airport, runway)
+	if t := s.State.SimTime.Add(d); t.After(s.RunwayOccupied[key]) {
+		s.RunwayOccupied[key] = t
+	}
+}
+
+func (s *Sim) runwayOccupied(airport, runway string) bool {
+	t, ok := s.RunwayOccupied[runwayKey(airport, runway)]
+	return ok && s.State.SimTime.Before(t)
+}
+
+// landed is called when an arrival lands; it occupies the runway until
+// it has rolled out and exited.
+func (s *Sim) landed(ac *av.Aircraft) {
+	delete(s.StabilityChecked, ac.Callsign)
+	if s.batch != nil && ac.FlightPlan != nil {
+		s.batch.landed(ac)
+	}
+	if appr := ac.Nav.Approach.Assigned; appr != nil && ac.FlightPlan != nil {
+		s.occupyRunway(ac.FlightPlan.ArrivalAirport, appr.Runway, s.arrivalRunwayOccupancy(ac, appr.Runway))
+	}
+}
+
+// checkFinalApproach decides whether an arrival on final should go around.
+func (s *Sim) checkFinalApproach(ac *av.Aircraft) {
+	appr := ac.Nav.Approach.Assigned
+	if appr == nil || !ac.Nav.Approach.Cleared || ac.FlightPlan.Rules != av.IFR {
+		return
+	}
+	d, err := ac.DistanceToEndOfApproach()
+	if err != nil {
+		return
+	}
+
+	if d < runwayOccupiedDistance && s.runwayOccupied(ac.FlightPlan.ArrivalAirport, appr.Runway) {
+		s.goAround(ac, "traffic on the runway")
+		return
+	}
+
+	if d >= stabilizedApproachDistance || s.StabilityChecked[ac.Callsign] {
+		return
+	}
+	if s.StabilityChecked == nil {
+		s.StabilityChecked = make(map[string]bool)
+	}
+	s.StabilityChecked[ac.Callsign] = true
+
+	// Too fast or too high to make a normal landing: the 3 degree
+	// glidepath descends about 318' per nm.
+	perf := ac.AircraftPerformance()
+	glidepath := ac.ArrivalAirportElevation() + 318*d
+	if ac.IAS() > perf.Speed.Landing+30 || ac.Altitude() > glidepath+500 {
+		s.goAround(ac, "unstable approach")
+		return
+	}
+
+	wind := s.State.Wind
+	if gust := float32(wind.Gust - wind.Speed); gust >= 10 {
+		if p := min(s.State.LaunchConfig.GoAroundRate*gust/10, 0.5); s.Rand.Float32() < p {
+			s.goAround(ac, "wind shear")
+		}
+	}
+}
+
+// delayArrivals pushes back the next arrivals to the airport; it's called
+// after a go-around to account for the aircraft being re-sequenced.
+func (s *Sim) delayArrivals(airport string) {
+	delay := time.Duration(60+s.Rand.Intn(60)) * time.Second
+	for group, rates := range s.State.LaunchConfig.InboundFlowRates {
+		if rates[airport] > 0 {
+			s.NextInboundSpawn[group] = s.NextInboundSpawn[group].Add(delay)
+		}
+	}
+}
+
+// rejectTakeoff decides whether the departure rejects its takeoff. If so,
+// the runway is closed for a few minutes and the aircraft will depart
+// again later.
+func (s *Sim) rejectTakeoff(airport, runway string, dep *DepartureAircraft) bool {
+	ac := s.State.Aircraft[dep.Callsign]
+	if s.prespawn || dep.RejectedTakeoff || ac.FlightPlan.Rules != av.IFR ||
+		s.Rand.Float32() >= s.State.LaunchConfig.RejectedTakeoffRate {
+		return false
+	}
+
+	dep.RejectedTakeoff = true
+	s.occupyRunway(airport, runway, time.Duration(90+s.Rand.Intn(150))*time.Second)
+
+	reason := rand.SampleWith(&s.Rand, "engine indication", "configuration warning", "bird strike", "blown tire")
+	ctrl := s.ResolveController(ac.DepartureContactController)
+	s.lg.Infof("%s: rejected takeoff on %s at %s: %s", ac.Callsign, runway, airport, reason)
+	s.eventStream.Post(Event{
+		Type:         RejectedTakeoffEvent,
+		Callsign:     ac.Callsign,
+		ToController: ctrl,
+		Message:      airport + " runway " + runway + ": " + reason,
+	})
+	// The tower lets departure know that there will be a delay.
+	s.eventStream.Post(Event{
+		Type:         StatusMessageEvent,
+		ToController: ctrl,
+		Message:      ac.Callsign + " rejected takeoff on runway " + runway + " at " + airport + ", " + reason,
+	})
+	return true
+}
@@ -0,0 +1,110 @@
+// pkg/sim/hearback.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"slices"
+	"time"
+)
+
+// A controller must listen to each readback and correct it if it's
+// wrong ("hearback"). Altitude and heading clearances are the ones that
+// pilots can read back incorrectly (see piloterror.go); the hearback log
+// counts the ones that human controllers issue and records each
+// erroneous readback and whether and how quickly it was corrected. The
+// score report summarizes it in HearbackStats. (Missed errors are
+// penalized by the "training_events" rubric.)
+
+// HearbackLog records clearances and readback errors.
+type HearbackLog struct {
+	// Number of clearances issued by human controllers, by instruction
+	// ("altitude" or "heading").
+	Clearances map[string]int
+	Errors     []HearbackError
+}
+
+// HearbackError is a readback error and what came of it.
+type HearbackError struct {
+	Time        time.Time     `json:"time"`
+	Callsign    string        `json:"callsign"`
+	Controller  string        `json:"controller"`
+	Instruction string        `json:"instruction"`
+	Description string        `json:"description"`
+	Resolved    bool          `json:"resolved"`
+	Corrected   bool          `json:"corrected"`
+	Latency     time.Duration `json:"latency,omitempty"` // until it was corrected
+}
+
+// HearbackStats summarizes the hearback log for the score report.
+type HearbackStats struct {
+	Clearances     int             `json:"clearances"`
+	ReadbackErrors int             `json:"readback_errors"`
+	Corrected      int             `json:"corrected"`
+	Missed         int             `json:"missed"`
+	MeanLatency    time.Duration   `json:"mean_latency,omitempty"`
+	Errors         []HearbackError `json:"errors,omitempty"`
+}
+
+// recordClearance is called when a controller issues a clearance that
+// the pilot may read back incorrectly.
+func (s *Sim) recordClearance(tcp, instruction string) {
+	if _, ok := s.humanControllers[tcp]; !ok {
+		return
+	}
+	if s.Hearback.Clearances == nil {
+		s.Hearback.Clearances = make(map[string]int)
+	}
+	s.Hearback.Clearances[instruction]++
+}
+
+func (s *Sim) recordReadbackError(pe PilotError) {
+	s.Hearback.Errors = append(s.Hearback.Errors, HearbackError{
+		Time:        s.State.SimTime,
+		Callsign:    pe.Callsign,
+		Controller:  pe.Controller,
+		Instruction: pe.Instruction,
+		Description: pe.Description,
+	})
+}
+
+func (s *Sim) resolveReadbackError(pe PilotError, corrected bool) {
+	for i := len(s.Hearback.Errors) - 1; i >= 0; i-- {
+		if he := &s.Hearback.Errors[i]; he.Callsign == pe.Callsign && !he.Resolved {
+			he.Resolved, he.Corrected = true, corrected
+			if corrected {
+				he.Latency = s.State.SimTime.Sub(he.Time)
+			}
+			return
+		}
+	}
+}
+
+// hearbackStats summarizes the readback errors since the given time.
+// Clearances aren't timestamped, so all of them are counted.
+func (s *Sim) hearbackStats(start time.Time) HearbackStats {
+	hs := HearbackStats{
+		Errors: slices.DeleteFunc(slices.Clone(s.Hearback.Errors), func(he HearbackError) bool {
+			return he.Time.Before(start)
+		}),
+	}
+	for _, n := range s.Hearback.Clearances {
+		hs.Clearances += n
+	}
+
+	var latency time.Duration
+	for _, he := range hs.Errors {
+		hs.ReadbackErrors++
+		if he.Corrected {
+			hs.Corrected++
+			latency += he.Latency
+		} else if he.Resolved {
+			hs.Missed++
+		}
+	}
+	if hs.Corrected > 0 {
+		hs.MeanLatency = latency / time.Duration(hs.Corrected)
+	}
+	return hs
+}
@@ -0,0 +1,44 @@
+// pkg/sim/hearback_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+func TestHearbackStats(t *testing.T) {
+	start := testSimTime
+	s := newTestSim(t, &State{SimTime: start})
+	s.humanControllers = map[string]*EventsSubscription{"2K": nil}
+
+	s.recordClearance("2K", "altitude")
+	s.recordClearance("2K", "heading")
+	s.recordClearance("2K", "altitude")
+	s.recordClearance("1V", "altitude") // not a human controller
+
+	aal := PilotError{Kind: PilotErrorReadback, Callsign: "AAL1", Controller: "2K", Instruction: "altitude"}
+	ual := PilotError{Kind: PilotErrorReadback, Callsign: "UAL2", Controller: "2K", Instruction: "heading"}
+	s.injectPilotError(aal)
+	s.injectPilotError(ual)
+
+	// AAL1's is corrected 20 seconds later; UAL2's times out.
+	s.State.SimTime = start.Add(20 * time.Second)
+	s.pilotErrorCorrected("AAL1", "altitude")
+	s.State.SimTime = start.Add(2 * pilotErrorWindow)
+	s.State.Aircraft = map[string]*av.Aircraft{"UAL2": {Callsign: "UAL2"}}
+	s.updatePilotErrors()
+
+	hs := s.hearbackStats(start)
+	if hs.Clearances != 3 || hs.ReadbackErrors != 2 || hs.Corrected != 1 || hs.Missed != 1 ||
+		hs.MeanLatency != 20*time.Second {
+		t.Errorf("got %+v", hs)
+	}
+	if hs := s.hearbackStats(start.Add(time.Second)); hs.ReadbackErrors != 0 {
+		t.Errorf("errors before the start time counted: %+v", hs)
+	}
+}
@@ -0,0 +1,37 @@
+// pkg/sim/helpers_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/mmp/vice/pkg/log"
+)
+
+// testSimTime is the sim time that the tests' sims generally start at.
+var testSimTime = time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)
+
+// newTestSim returns a Sim with the given state that discards its log
+// messages, has an event stream, and has a clock that follows the
+// state's SimTime. An empty state is used if state is nil. Other fields
+// of the Sim may be set by the caller.
+func newTestSim(t *testing.T, state *State) *Sim {
+	t.Helper()
+
+	if state == nil {
+		state = &State{}
+	}
+	lg := &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	s := &Sim{
+		State:       state,
+		eventStream: NewEventStream(lg),
+		lg:          lg,
+	}
+	s.clock = NewTimeSource(s.State)
+	return s
+}
@@ -0,0 +1,93 @@
+// pkg/sim/history.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+// The sim keeps a history of each aircraft's positions so that scopes can
+// draw history trails with however many positions and at whatever rate
+// they're configured for, and so that the trails are there as soon as a
+// scope connects. A position is recorded every trackHistoryInterval;
+// TrackHistoryDepth of them are kept for each aircraft.
+
+const (
+	trackHistoryInterval     = 2 * time.Second
+	DefaultTrackHistoryDepth = 30
+	MaxTrackHistoryDepth     = 120
+)
+
+// TrackHistory is a ring buffer of an aircraft's past positions.
+type TrackHistory struct {
+	Tracks []av.RadarTrack
+	// Index in Tracks where the next one will be written once it is full;
+	// it's also the index of the oldest one.
+	Next int
+}
+
+// Add records a track, discarding the oldest one if there are already
+// depth of them.
+func (h *TrackHistory) Add(t av.RadarTrack, depth int) {
+	if len(h.Tracks) < depth {
+		// Still filling it up; Next stays at 0, where the oldest one is.
+		h.Tracks = append(h.Tracks, t)
+		return
+	}
+	h.Tracks[h.Next] = t
+	h.Next = (h.Next + 1) % len(h.Tracks)
+}
+
+// Recent returns up to n of the most recent tracks, newest first.
+func (h *TrackHistory) Recent(n int) []av.RadarTrack {
+	n = min(n, len(h.Tracks))
+	r := make([]av.RadarTrack, n)
+	for i := range r {
+		r[i] = h.Tracks[(h.Next-1-i+2*len(h.Tracks))%len(h.Tracks)]
+	}
+	return r
+}
+
+// updateTrackHistories is called once a second.
+func (s *Sim) updateTrackHistories() {
+	now := s.State.SimTime
+	if now.Sub(s.lastTrackHistory) < trackHistoryInterval {
+		return
+	}
+	s.lastTrackHistory = now
+
+	if s.State.TrackHistories == nil {
+		s.State.TrackHistories = make(map[string]*TrackHistory)
+	}
+	for callsign := range s.State.TrackHistories {
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(s.State.TrackHistories, callsign)
+		}
+	}
+
+	depth := s.TrackHistoryDepth
+	if depth <= 0 {
+		depth = DefaultTrackHistoryDepth
+	}
+	for callsign, ac := range s.State.Aircraft {
+		if ac.WaitingForLaunch || (ac.HoldForRelease && !ac.Released) {
+			continue
+		}
+
+		h, ok := s.State.TrackHistories[callsign]
+		if !ok {
+			h = &TrackHistory{}
+			s.State.TrackHistories[callsign] = h
+		}
+		h.Add(av.RadarTrack{
+			Position:    ac.Position(),
+			Altitude:    int(ac.Altitude()),
+			Groundspeed: int(ac.Nav.FlightState.GS),
+			Time:        now,
+		}, depth)
+	}
+}
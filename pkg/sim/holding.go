@@ -0,0 +1,175 @@
+// pkg/sim/holding.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"cmp"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Controllers may have aircraft hold at a fix--for example, at the
+// approach gate when an airport's arrival rate drops during an event--and
+// give them an expect further clearance (EFC) time. The aircraft holding
+// at each fix are collected into a stack once a second so that the
+// controllers can see who is where and when each aircraft expects to
+// leave the hold. The controlling controller is warned shortly before an
+// aircraft's EFC; if it passes without further clearance, the pilot asks
+// for one.
+
+const efcWarningLead = 2 * time.Minute
+
+// HoldingAircraft is an aircraft in a holding stack.
+type HoldingAircraft struct {
+	Callsign   string
+	Controller string // controlling
+	Altitude   int    // assigned, or current if none
+	EFC        time.Time
+	// Entered is set once the aircraft has reached the fix.
+	Entered bool
+}
+
+// efcWarning records which warnings have been given about an aircraft's
+// EFC.
+type efcWarning struct {
+	EFC     time.Time
+	Warned  bool // about to expire
+	Expired bool
+}
+
+// updateHoldingStacks is called once a second.
+func (s *Sim) updateHoldingStacks() {
+	stacks := make(map[string][]HoldingAircraft)
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		h := ac.Nav.Holding()
+		if h == nil {
+			continue
+		}
+
+		alt := int(ac.Altitude() + 0.5)
+		if ac.Nav.Altitude.Assigned != nil {
+			alt = int(*ac.Nav.Altitude.Assigned)
+		}
+		stacks[h.Fix] = append(stacks[h.Fix], HoldingAircraft{
+			Callsign:   callsign,
+			Controller: ac.ControllingController,
+			Altitude:   alt,
+			EFC:        h.EFC,
+			Entered:    h.Entered(),
+		})
+	}
+	for _, stack := range stacks {
+		// Lowest first; they're usually the first to be cleared out.
+		slices.SortStableFunc(stack, func(a, b HoldingAircraft) int { return cmp.Compare(a.Altitude, b.Altitude) })
+	}
+	s.State.HoldingStacks = stacks
+
+	s.checkEFCs()
+}
+
+// checkEFCs warns the controller about EFCs that are about to expire and
+// has the pilot ask for further clearance once they have.
+func (s *Sim) checkEFCs() {
+	if s.efcWarnings == nil {
+		s.efcWarnings = make(map[string]efcWarning)
+	}
+
+	held := make(map[string]bool)
+	for _, fix := range util.SortedMapKeys(s.State.HoldingStacks) {
+		for _, hac := range s.State.HoldingStacks[fix] {
+			if hac.EFC.IsZero() {
+				continue
+			}
+			held[hac.Callsign] = true
+
+			w := s.efcWarnings[hac.Callsign]
+			if !w.EFC.Equal(hac.EFC) {
+				// New or amended EFC.
+				w = efcWarning{EFC: hac.EFC}
+			}
+
+			now := s.State.SimTime
+			if !w.Warned && now.Add(efcWarningLead).After(hac.EFC) {
+				w.Warned = true
+				s.eventStream.Post(Event{
+					Type:         StatusMessageEvent,
+					ToController: hac.Controller,
+					Message: hac.Callsign + " holding at " + fix + ": EFC " + hac.EFC.UTC().Format("1504") +
+						" expires in " + strconv.Itoa(max(0, int(hac.EFC.Sub(now).Minutes()+0.5))) + " minutes",
+				})
+			}
+			if !w.Expired && now.After(hac.EFC) {
+				w.Expired = true
+				if hac.Controller != "" {
+					s.postRadioEvents(hac.Callsign, []av.RadioTransmission{av.RadioTransmission{
+						Controller: hac.Controller,
+						Message:    "we've reached our EFC time holding at " + av.FixReadback(fix) + ", request further clearance",
+						Type:       av.RadioTransmissionUnexpected,
+					}})
+				}
+				s.lg.Info("EFC expired", slog.String("callsign", hac.Callsign), slog.String("fix", fix),
+					slog.Time("efc", hac.EFC))
+			}
+			s.efcWarnings[hac.Callsign] = w
+		}
+	}
+
+	for callsign := range s.efcWarnings {
+		if !held[callsign] {
+			delete(s.efcWarnings, callsign)
+		}
+	}
+}
+
+// parseEFC returns the next time after the current sim time at the given
+// hour and minute, which are given as "HHMM" in UTC; an empty string
+// means no EFC.
+func (s *Sim) parseEFC(efc string) (time.Time, error) {
+	if efc == "" {
+		return time.Time{}, nil
+	}
+	if len(efc) != 4 {
+		return time.Time{}, ErrInvalidEFC
+	}
+	hhmm, err := strconv.Atoi(efc)
+	if err != nil || hhmm/100 > 23 || hhmm%100 > 59 {
+		return time.Time{}, ErrInvalidEFC
+	}
+
+	now := s.State.SimTime.UTC()
+	t := time.Date(now.Year(), now.Month(), now.Day(), hhmm/100, hhmm%100, 0, 0, time.UTC)
+	if !t.After(now) {
+		t = t.Add(24 * time.Hour)
+	}
+	return t, nil
+}
+
+// Hold instructs the aircraft to hold at the fix with the given EFC
+// ("HHMM"; may be empty). Holding again at the same fix amends the EFC.
+func (s *Sim) Hold(tcp, callsign, fix string, rightTurns bool, efc string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	loc, ok := s.State.Locate(fix)
+	if !ok {
+		return av.ErrNoMatchingFix
+	}
+	t, err := s.parseEFC(efc)
+	if err != nil {
+		return err
+	}
+
+	return s.dispatchControllingCommand(tcp, callsign,
+		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			s.checkPriorityHold(tcp, ac, fix)
+			return ac.Hold(fix, loc, rightTurns, t, s.State.SimTime)
+		})
+}
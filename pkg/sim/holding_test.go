@@ -0,0 +1,147 @@
+// pkg/sim/holding_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+func makeHoldingAircraft(callsign, fix string, alt float32, assigned *float32, efc time.Time) *av.Aircraft {
+	ac := &av.Aircraft{Callsign: callsign, ControllingController: "2K"}
+	ac.Nav.FlightState.Altitude = alt
+	ac.Nav.Altitude.Assigned = assigned
+	ac.Nav.Heading.Hold = &av.FlyHold{Fix: fix, EFC: efc}
+	return ac
+}
+
+func TestHoldingStacks(t *testing.T) {
+	a8000, a6000 := float32(8000), float32(6000)
+	aircraft := map[string]*av.Aircraft{
+		"AAL1": makeHoldingAircraft("AAL1", "CAMRN", 8000, &a8000, time.Time{}),
+		"UAL2": makeHoldingAircraft("UAL2", "CAMRN", 7000, &a6000, time.Time{}),
+		"DAL3": makeHoldingAircraft("DAL3", "ROBER", 7049.6, nil, time.Time{}),
+		"JBU4": {Callsign: "JBU4"},
+	}
+	aircraft["AAL1"].Nav.Heading.Hold.State = av.HoldStateFlyingOutbound
+	s := newTestSim(t, &State{Aircraft: aircraft, SimTime: testSimTime})
+
+	s.updateHoldingStacks()
+
+	expected := map[string][]HoldingAircraft{
+		"CAMRN": {
+			{Callsign: "UAL2", Controller: "2K", Altitude: 6000},
+			{Callsign: "AAL1", Controller: "2K", Altitude: 8000, Entered: true},
+		},
+		"ROBER": {{Callsign: "DAL3", Controller: "2K", Altitude: 7050}},
+	}
+	if !reflect.DeepEqual(s.State.HoldingStacks, expected) {
+		t.Errorf("got stacks %+v, expected %+v", s.State.HoldingStacks, expected)
+	}
+}
+
+func TestEFCWarnings(t *testing.T) {
+	a6000, a7000 := float32(6000), float32(7000)
+	s := newTestSim(t, &State{
+		Aircraft: map[string]*av.Aircraft{
+			"AAL1": makeHoldingAircraft("AAL1", "ROBER", 6000, &a6000, testSimTime.Add(90*time.Second)),
+			"UAL2": makeHoldingAircraft("UAL2", "CAMRN", 7000, &a7000, testSimTime.Add(100*time.Second)),
+		},
+		SimTime: testSimTime,
+	})
+	sub := s.eventStream.Subscribe()
+
+	// events advances to the given time and returns the status messages
+	// and radio transmissions that were posted.
+	events := func(t time.Time) []string {
+		s.State.SimTime = t
+		s.updateHoldingStacks()
+		var msgs []string
+		for _, e := range sub.Get() {
+			if e.Type == StatusMessageEvent || e.Type == RadioTransmissionEvent {
+				msgs = append(msgs, e.Callsign+": "+e.Message)
+			}
+		}
+		return msgs
+	}
+
+	// Both EFCs are within the warning lead, so both are warned about,
+	// ordered by fix.
+	expected := []string{
+		": UAL2 holding at CAMRN: EFC 1501 expires in 2 minutes",
+		": AAL1 holding at ROBER: EFC 1501 expires in 2 minutes",
+	}
+	if msgs := events(testSimTime); !slices.Equal(msgs, expected) {
+		t.Errorf("got %q, expected %q", msgs, expected)
+	}
+	if msgs := events(testSimTime.Add(time.Second)); len(msgs) != 0 {
+		t.Errorf("warnings repeated: %q", msgs)
+	}
+
+	expected = []string{"AAL1: we've reached our EFC time holding at ROBER, request further clearance"}
+	if msgs := events(testSimTime.Add(95 * time.Second)); !slices.Equal(msgs, expected) {
+		t.Errorf("got %q, expected %q", msgs, expected)
+	}
+	if msgs := events(testSimTime.Add(96 * time.Second)); len(msgs) != 0 {
+		t.Errorf("expiration repeated: %q", msgs)
+	}
+
+	expected = []string{"UAL2: we've reached our EFC time holding at CAMRN, request further clearance"}
+	if msgs := events(testSimTime.Add(101 * time.Second)); !slices.Equal(msgs, expected) {
+		t.Errorf("got %q, expected %q", msgs, expected)
+	}
+
+	// An amended EFC is warned about again.
+	s.State.Aircraft["AAL1"].Nav.Heading.Hold.EFC = testSimTime.Add(10 * time.Minute)
+	if msgs := events(testSimTime.Add(102 * time.Second)); len(msgs) != 0 {
+		t.Errorf("amended EFC warned early: %q", msgs)
+	}
+	expected = []string{": AAL1 holding at ROBER: EFC 1510 expires in 2 minutes"}
+	if msgs := events(testSimTime.Add(8*time.Minute + time.Second)); !slices.Equal(msgs, expected) {
+		t.Errorf("got %q, expected %q", msgs, expected)
+	}
+
+	// Aircraft that leave the hold are forgotten.
+	s.State.Aircraft["UAL2"].Nav.Heading.Hold = nil
+	events(testSimTime.Add(8*time.Minute + 2*time.Second))
+	if _, ok := s.efcWarnings["UAL2"]; ok {
+		t.Errorf("UAL2 still has EFC warnings after leaving the hold")
+	}
+}
+
+func TestParseEFC(t *testing.T) {
+	for _, test := range []struct {
+		now      time.Time
+		efc      string
+		expected time.Time
+		err      error
+	}{
+		{now: testSimTime, efc: "", expected: time.Time{}},
+		{now: testSimTime, efc: "1530", expected: time.Date(2024, 6, 1, 15, 30, 0, 0, time.UTC)},
+		// Times that have passed are for tomorrow.
+		{now: testSimTime, efc: "1500", expected: time.Date(2024, 6, 2, 15, 0, 0, 0, time.UTC)},
+		{now: time.Date(2024, 6, 1, 23, 50, 0, 0, time.UTC), efc: "0010",
+			expected: time.Date(2024, 6, 2, 0, 10, 0, 0, time.UTC)},
+		{now: time.Date(2024, 12, 31, 23, 50, 0, 0, time.UTC), efc: "0005",
+			expected: time.Date(2025, 1, 1, 0, 5, 0, 0, time.UTC)},
+		// Sim times in other time zones are converted to UTC.
+		{now: time.Date(2024, 6, 1, 20, 0, 0, 0, time.FixedZone("EDT", -4*3600)), efc: "0030",
+			expected: time.Date(2024, 6, 2, 0, 30, 0, 0, time.UTC)},
+		{now: testSimTime, efc: "930", err: ErrInvalidEFC},
+		{now: testSimTime, efc: "2400", err: ErrInvalidEFC},
+		{now: testSimTime, efc: "1260", err: ErrInvalidEFC},
+		{now: testSimTime, efc: "12a0", err: ErrInvalidEFC},
+	} {
+		s := newTestSim(t, &State{SimTime: test.now})
+		efc, err := s.parseEFC(test.efc)
+		if err != test.err || !efc.Equal(test.expected) {
+			t.Errorf("%q at %s: got %s, %v; expected %s, %v", test.efc, test.now, efc, err, test.expected, test.err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// pkg/sim/intent.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+// Each aircraft's intent--its route, target altitude, and the
+// restrictions it's expected to meet; see av.Intent--is published in
+// State.Intents once a second, before any of the automation runs. The
+// conflict probe, crossing restriction monitoring, point out advisories,
+// and the EDST on the client all work from the published intents rather
+// than digging into the aircraft's Nav state themselves.
+//
+// LOA checks, metering, and the detection of fix crossings don't: they
+// need to know whether a fix is still in an aircraft's route while it's
+// being vectored, when its intent has no route, and LOA checks and
+// metering also run when clearances are issued and aircraft are spawned,
+// between publications. They use the Nav state via
+// Aircraft.RouteIncludesFix and the assigned altitude and speed.
+
+func (s *Sim) publishIntents() {
+	intents := make(map[string]av.Intent, len(s.State.Aircraft))
+	for callsign, ac := range s.State.Aircraft {
+		intents[callsign] = ac.Intent()
+	}
+	s.State.Intents = intents
+}
+
+// Intent returns the aircraft's most recently published intent.
+func (ss *State) Intent(callsign string) (av.Intent, bool) {
+	in, ok := ss.Intents[callsign]
+	return in, ok
+}
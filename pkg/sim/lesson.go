@@ -0,0 +1,175 @@
+// pkg/sim/lesson.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// A scenario may be run as a lesson: a sequence of steps, each with a
+// prompt that's shown to the controller ("Accept the handoff on
+// AAL123") and the event that completes it. The lesson only advances
+// once the controller has done what the step asks, so the steps can
+// build on each other. Lessons are given in the scenario JSON:
+//
+//	"lesson": {
+//	  "title": "Arrivals 1",
+//	  "steps": [
+//	    { "prompt": "Accept the handoff on AAL123", "event": "accepted_handoff",
+//	      "callsign": "AAL123" },
+//	    { "prompt": "Clear AAL123 to descend via the CLARR arrival",
+//	      "event": "radio_transmission", "callsign": "AAL123", "message": "descend via",
+//	      "feedback": "Good; it will meet the STAR's restrictions on its own" }
+//	  ]
+//	}
+//
+// Event names are the same as for scripts (see script.go). A step's
+// callsign and message, if given, must also match the event; the message
+// is matched case-insensitively as a substring, so for
+// "radio_transmission" steps it's checked against the pilot's readback,
+// which is how instructions are validated. The time taken for each step
+// is included in the session's score report.
+
+// Lesson is a scenario's sequence of guided steps.
+type Lesson struct {
+	Title string       `json:"title"`
+	Steps []LessonStep `json:"steps"`
+}
+
+type LessonStep struct {
+	Prompt   string `json:"prompt"`
+	Event    string `json:"event"`
+	Callsign string `json:"callsign,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// Feedback is shown when the step is completed.
+	Feedback string `json:"feedback,omitempty"`
+}
+
+func (l Lesson) Validate() error {
+	if len(l.Steps) == 0 {
+		return fmt.Errorf("no \"steps\" given")
+	}
+	for i, st := range l.Steps {
+		if st.Prompt == "" {
+			return fmt.Errorf("step %d: \"prompt\" must be specified", i+1)
+		}
+		if _, ok := scriptEventNames[st.Event]; !ok {
+			return fmt.Errorf("step %d: %q: unknown event", i+1, st.Event)
+		}
+	}
+	return nil
+}
+
+// matches returns whether the event completes the step.
+func (st LessonStep) matches(e Event) bool {
+	if scriptEventNames[st.Event] != e.Type {
+		return false
+	}
+	if st.Callsign != "" && !strings.EqualFold(st.Callsign, e.Callsign) {
+		return false
+	}
+	return st.Message == "" || strings.Contains(strings.ToLower(e.Message), strings.ToLower(st.Message))
+}
+
+// LessonProgress records how far along the lesson is.
+type LessonProgress struct {
+	Lesson Lesson
+	Step   int // index of the current step; len(Steps) when complete
+	// Sim time when the current step started.
+	StepStart time.Time
+	// How long each completed step took.
+	StepTimes []time.Duration
+}
+
+// LessonStatus is what clients need to show the lesson.
+type LessonStatus struct {
+	Title    string
+	Step     int // 1-based
+	NumSteps int
+	Prompt   string
+	Complete bool
+}
+
+// LessonResult is included in the score report for lessons.
+type LessonResult struct {
+	Title     string          `json:"title"`
+	Completed int             `json:"completed"`
+	Steps     int             `json:"steps"`
+	StepTimes []time.Duration `json:"step_times"`
+}
+
+func (p *LessonProgress) complete() bool {
+	return p.Step >= len(p.Lesson.Steps)
+}
+
+func (p *LessonProgress) status() *LessonStatus {
+	st := &LessonStatus{
+		Title:    p.Lesson.Title,
+		Step:     min(p.Step, len(p.Lesson.Steps)-1) + 1,
+		NumSteps: len(p.Lesson.Steps),
+		Complete: p.complete(),
+	}
+	if !st.Complete {
+		st.Prompt = p.Lesson.Steps[p.Step].Prompt
+	}
+	return st
+}
+
+func (p *LessonProgress) result() *LessonResult {
+	return &LessonResult{
+		Title:     p.Lesson.Title,
+		Completed: min(p.Step, len(p.Lesson.Steps)),
+		Steps:     len(p.Lesson.Steps),
+		StepTimes: append([]time.Duration(nil), p.StepTimes...),
+	}
+}
+
+// updateLesson advances the lesson past each step that an event since the
+// last update has completed.
+func (s *Sim) updateLesson() {
+	p := s.Lesson
+	if p == nil {
+		return
+	}
+
+	if p.StepStart.IsZero() {
+		p.StepStart = s.State.SimTime
+	}
+	if s.lessonEvents == nil {
+		s.lessonEvents = s.eventStream.Subscribe()
+	}
+
+	for _, e := range s.lessonEvents.Get() {
+		if p.complete() {
+			break
+		}
+		st := p.Lesson.Steps[p.Step]
+		if !st.matches(e) {
+			continue
+		}
+
+		p.StepTimes = append(p.StepTimes, s.State.SimTime.Sub(p.StepStart))
+		p.StepStart = s.State.SimTime
+		p.Step++
+		s.lg.Info("lesson step completed", slog.String("lesson", p.Lesson.Title), slog.Int("step", p.Step))
+
+		msg := fmt.Sprintf("Step %d complete", p.Step)
+		if st.Feedback != "" {
+			msg += ": " + st.Feedback
+		}
+		s.eventStream.Post(Event{Type: StatusMessageEvent, Message: msg})
+		if p.complete() {
+			s.eventStream.Post(Event{
+				Type:    StatusMessageEvent,
+				Message: fmt.Sprintf("Lesson %q complete", p.Lesson.Title),
+			})
+		}
+	}
+
+	s.State.Lesson = p.status()
+}
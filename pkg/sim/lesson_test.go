@@ -0,0 +1,75 @@
+// pkg/sim/lesson_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLessonValidate(t *testing.T) {
+	for _, l := range []Lesson{
+		{Title: "empty"},
+		{Steps: []LessonStep{{Event: "accepted_handoff"}}},
+		{Steps: []LessonStep{{Prompt: "Do it", Event: "handoff_accepted"}}},
+	} {
+		if err := l.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", l)
+		}
+	}
+}
+
+func TestLessonProgress(t *testing.T) {
+	start := testSimTime
+	lesson := Lesson{
+		Title: "Arrivals",
+		Steps: []LessonStep{
+			{Prompt: "Accept the handoff on AAL123", Event: "accepted_handoff", Callsign: "AAL123"},
+			{Prompt: "Descend AAL123 via the STAR", Event: "radio_transmission", Callsign: "AAL123",
+				Message: "Descend Via"},
+		},
+	}
+	if err := lesson.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	s := newTestSim(t, &State{SimTime: start})
+	s.Lesson = &LessonProgress{Lesson: lesson}
+	s.updateLesson()
+	if st := s.State.Lesson; st == nil || st.Step != 1 || st.Prompt != lesson.Steps[0].Prompt {
+		t.Fatalf("initial status %+v", st)
+	}
+
+	// Events for other aircraft or of other types don't advance it, and
+	// neither does the second step's event before the first is done.
+	s.eventStream.Post(Event{Type: AcceptedHandoffEvent, Callsign: "UAL1"})
+	s.eventStream.Post(Event{Type: RadioTransmissionEvent, Callsign: "AAL123", Message: "descend via the STAR"})
+	s.eventStream.Post(Event{Type: OfferedHandoffEvent, Callsign: "AAL123"})
+	s.updateLesson()
+	if s.Lesson.Step != 0 {
+		t.Fatalf("advanced to step %d on non-matching events", s.Lesson.Step)
+	}
+
+	s.State.SimTime = start.Add(30 * time.Second)
+	s.eventStream.Post(Event{Type: AcceptedHandoffEvent, Callsign: "AAL123"})
+	s.updateLesson()
+	if st := s.State.Lesson; st.Step != 2 || st.Complete {
+		t.Fatalf("status after handoff %+v", st)
+	}
+
+	s.State.SimTime = start.Add(50 * time.Second)
+	s.eventStream.Post(Event{Type: RadioTransmissionEvent, Callsign: "AAL123", Message: "maintain 250 knots"})
+	s.eventStream.Post(Event{Type: RadioTransmissionEvent, Callsign: "AAL123", Message: "descend via the STAR"})
+	s.updateLesson()
+	if st := s.State.Lesson; !st.Complete || st.Prompt != "" {
+		t.Fatalf("status after descend via %+v", st)
+	}
+
+	r := s.Lesson.result()
+	if r.Completed != 2 || r.Steps != 2 || len(r.StepTimes) != 2 ||
+		r.StepTimes[0] != 30*time.Second || r.StepTimes[1] != 20*time.Second {
+		t.Errorf("result %+v", r)
+	}
+}
@@ -0,0 +1,152 @@
+// pkg/sim/livetraffic.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"time"
+
+	"github.com/mmp/vice/pkg/adsb"
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+// Live traffic comes from outside of the sim: from an FSD network (see
+// network.go), an ADS-B receiver, or a federated sim (see federation.go). Such aircraft are added to
+// the sim like any other, but their state is taken from the source rather
+// than being simulated.
+
+// externalTrack is the latest state of an aircraft from a live traffic
+// source.
+type externalTrack struct {
+	Callsign   string
+	Squawk     av.Squawk
+	Mode       av.TransponderMode
+	Position   math.Point2LL
+	Altitude   float32
+	GS         float32
+	Heading    float32        // true
+	FlightPlan *av.FlightPlan // may be nil
+}
+
+// isExternalAircraft returns true if the aircraft's state comes from a
+// live traffic source.
+func (s *Sim) isExternalAircraft(callsign string) bool {
+	return s.NetworkAircraft[callsign] || s.ADSBAircraft[callsign] || s.isFederatedAircraft(callsign)
+}
+
+// syncExternalTraffic adds and updates aircraft for the given tracks and
+// deletes the ones in owned that are no longer present; owned records the
+// aircraft that came from the source.
+func (s *Sim) syncExternalTraffic(tracks []externalTrack, owned map[string]bool) {
+	seen := make(map[string]bool)
+	for _, tr := range tracks {
+		seen[tr.Callsign] = true
+
+		ac, ok := s.State.Aircraft[tr.Callsign]
+		if ok && !owned[tr.Callsign] {
+			// One of ours (or from another source) has the same callsign;
+			// leave it be.
+			continue
+		}
+		if !ok {
+			ac = &av.Aircraft{
+				Callsign:   tr.Callsign,
+				FlightPlan: &av.FlightPlan{Callsign: tr.Callsign, Rules: av.VFR},
+			}
+			ac.Nav.FlightState.NmPerLongitude = s.State.NmPerLongitude
+			ac.Nav.FlightState.MagneticVariation = s.State.MagneticVariation
+			s.State.Aircraft[tr.Callsign] = ac
+			owned[tr.Callsign] = true
+			s.lg.Infof("%s: added live traffic", tr.Callsign)
+		}
+
+		ac.Squawk, ac.Mode = tr.Squawk, tr.Mode
+		fs := &ac.Nav.FlightState
+		fs.Position = tr.Position
+		fs.Altitude = tr.Altitude
+		fs.GS, fs.IAS = tr.GS, tr.GS
+		fs.Heading = math.NormalizeHeading(tr.Heading + s.State.MagneticVariation)
+
+		if tr.FlightPlan != nil {
+			// Keep what we've assigned locally when comparing to the
+			// filed plan so that it's only passed along when it changes.
+			fp := *tr.FlightPlan
+			fp.AssignedSquawk, fp.ECID = ac.FlightPlan.AssignedSquawk, ac.FlightPlan.ECID
+			if fp != *ac.FlightPlan {
+				ac.FlightPlan = &fp
+				s.State.ERAMComputer().AddFlightPlan(av.MakeSTARSFlightPlan(&fp))
+			}
+		}
+	}
+
+	for callsign := range owned {
+		if !seen[callsign] {
+			if ac, ok := s.State.Aircraft[callsign]; ok {
+				s.lg.Infof("%s: live traffic dropped", callsign)
+				s.State.DeleteAircraft(ac)
+			}
+			delete(owned, callsign)
+		}
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// ADS-B
+
+const adsbRetryInterval = 30 * time.Second
+
+// updateADSB adds the traffic received by an ADS-B receiver within the
+// scenario's range, e.g. to shadow real-world traffic at the facility.
+func (s *Sim) updateADSB() {
+	if s.ADSBConfig == nil {
+		return
+	}
+
+	if s.adsbFeed != nil {
+		if err := s.adsbFeed.Err(); err != nil {
+			s.eventStream.Post(Event{
+				Type:    StatusMessageEvent,
+				Message: "ADS-B feed lost: " + err.Error(),
+			})
+			s.adsbFeed = nil
+		}
+	}
+	if s.adsbFeed == nil {
+		if now := time.Now(); now.After(s.adsbRetry) {
+			s.adsbFeed = adsb.Connect(*s.ADSBConfig, s.lg)
+			s.adsbRetry = now.Add(adsbRetryInterval)
+		}
+		return
+	}
+
+	if s.ADSBAircraft == nil {
+		s.ADSBAircraft = make(map[string]bool)
+	}
+
+	var tracks []externalTrack
+	for _, ac := range s.adsbFeed.Aircraft() {
+		if math.NMDistance2LL(ac.Position, s.State.Center) > s.State.Range {
+			continue
+		}
+
+		tr := externalTrack{
+			Callsign: ac.Callsign,
+			Mode:     av.Altitude,
+			Position: ac.Position,
+			Altitude: ac.Altitude,
+			GS:       ac.GS,
+			Heading:  ac.Track,
+		}
+		if tr.Callsign == "" {
+			// Use the address until the callsign is received.
+			tr.Callsign = ac.ICAO
+		}
+		if sq, err := av.ParseSquawk(ac.Squawk); err == nil {
+			tr.Squawk = sq
+		}
+		tracks = append(tracks, tr)
+	}
+	s.syncExternalTraffic(tracks, s.ADSBAircraft)
+}
@@ -0,0 +1,189 @@
+// pkg/sim/loa.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Letters of agreement and SOPs specify how aircraft are to be handed
+// between facilities: "props to XYZ at 7000", "jets over MERIT at 10000
+// and 250 knots", and so forth. Each LOA is checked once a second against
+// the aircraft whose routes include its fix; a LOAViolationEvent is
+// posted when a human controller's clearance is inconsistent with it and
+// again if an aircraft crosses the fix outside of it. The events are
+// scored by the "loa" rubric and may be shown to instructors.
+
+// LOA is a crossing restriction from a letter of agreement or SOP.
+type LOA struct {
+	Name     string `json:"name"`
+	Fix      string `json:"fix"`
+	Altitude [2]int `json:"altitude,omitempty"` // [low, high]; may be equal
+	MaxSpeed int    `json:"max_speed,omitempty"`
+
+	// Aircraft the LOA applies to; an empty filter matches all.
+	Engines    []string `json:"engines,omitempty"` // "jet", "turboprop", "prop"
+	Departures []string `json:"departure_airports,omitempty"`
+	Arrivals   []string `json:"arrival_airports,omitempty"`
+	// If given, only clearances issued by these controllers are checked.
+	Controllers []string `json:"controllers,omitempty"`
+}
+
+var loaEngineTypes = map[string]string{"jet": "J", "turboprop": "T", "prop": "P"}
+
+func (l LOA) Validate(locate func(string) (math.Point2LL, bool)) error {
+	if l.Name == "" {
+		return fmt.Errorf("\"name\" must be specified")
+	}
+	if l.Fix == "" {
+		return fmt.Errorf("%s: \"fix\" must be specified", l.Name)
+	} else if _, ok := locate(l.Fix); !ok {
+		return fmt.Errorf("%s: %s: unknown fix", l.Name, l.Fix)
+	}
+	if l.Altitude[0] > l.Altitude[1] {
+		return fmt.Errorf("%s: \"altitude\" range %d-%d is invalid", l.Name, l.Altitude[0], l.Altitude[1])
+	}
+	if l.Altitude[1] == 0 && l.MaxSpeed == 0 {
+		return fmt.Errorf("%s: one of \"altitude\" or \"max_speed\" must be specified", l.Name)
+	}
+	for _, e := range l.Engines {
+		if _, ok := loaEngineTypes[e]; !ok {
+			return fmt.Errorf("%s: %q: unknown engine type; must be \"jet\", \"turboprop\", or \"prop\"", l.Name, e)
+		}
+	}
+	return nil
+}
+
+func (l LOA) appliesTo(ac *av.Aircraft) bool {
+	fp := ac.FlightPlan
+	if fp == nil || !ac.RouteIncludesFix(l.Fix) {
+		return false
+	}
+	if len(l.Departures) > 0 && !slices.Contains(l.Departures, fp.DepartureAirport) {
+		return false
+	}
+	if len(l.Arrivals) > 0 && !slices.Contains(l.Arrivals, fp.ArrivalAirport) {
+		return false
+	}
+	if len(l.Engines) > 0 {
+		engine := ac.AircraftPerformance().Engine.AircraftType
+		if !slices.ContainsFunc(l.Engines, func(e string) bool { return loaEngineTypes[e] == engine }) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l LOA) altitudeString() string {
+	if l.Altitude[0] == l.Altitude[1] {
+		return fmt.Sprintf("%d", l.Altitude[0])
+	}
+	return fmt.Sprintf("%d-%d", l.Altitude[0], l.Altitude[1])
+}
+
+// loaCrossingWindow returns the window that the aircraft is to cross the
+// LOA's fix within, including the altitude it was coordinated at, if any.
+func (s *Sim) loaCrossingWindow(l LOA, ac *av.Aircraft) crossingWindow {
+	w := makeCrossingWindow(l.Altitude, l.MaxSpeed)
+	w.Coordinated = float32(s.CoordinatedAltitudes[ac.Callsign])
+	return w
+}
+
+// loaClearanceProblem returns a description of how the aircraft's current
+// clearance is inconsistent with the LOA, if it is.
+func (s *Sim) loaClearanceProblem(l LOA, ac *av.Aircraft) string {
+	return s.loaCrossingWindow(l, ac).clearanceProblem(ac.Altitude(), ac.Nav.Altitude.Assigned, ac.Nav.Speed.Assigned)
+}
+
+// loaCheck records what has been reported for an aircraft and LOA so that
+// each problem is only reported once.
+type loaCheck struct {
+	clearance string // most recently reported clearance problem
+	crossed   bool
+}
+
+// checkLOAs is called once a second.
+func (s *Sim) checkLOAs() {
+	if len(s.LOAs) == 0 {
+		return
+	}
+	if s.loaChecks == nil {
+		s.loaChecks = make(map[string]*loaCheck)
+	}
+
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		if !ac.IsAirborne() {
+			continue
+		}
+
+		ctrl := ac.ControllingController
+		for _, l := range s.LOAs {
+			key := callsign + "/" + l.Name
+			chk, ok := s.loaChecks[key]
+			if !l.appliesTo(ac) {
+				// The fix is no longer ahead; see if it was just crossed
+				// (rather than, say, the aircraft being sent direct to a
+				// later fix).
+				if ok && !chk.crossed {
+					chk.crossed = true
+					loc, _ := s.State.Locate(l.Fix)
+					if math.NMDistance2LL(ac.Position(), loc) > crossingRadius {
+						continue
+					}
+					if p := s.loaCrossingWindow(l, ac).crossingProblem(ac.Altitude(), ac.IAS()); p != "" && s.loaResponsible(l, ctrl) {
+						s.postLOAViolation(l, ac, ctrl, "crossed "+l.Fix+" "+p)
+					}
+				}
+				continue
+			}
+
+			if !ok {
+				chk = &loaCheck{}
+				s.loaChecks[key] = chk
+			}
+			if !s.loaResponsible(l, ctrl) {
+				continue
+			}
+			if p := s.loaClearanceProblem(l, ac); p != chk.clearance {
+				chk.clearance = p
+				if p != "" {
+					s.postLOAViolation(l, ac, ctrl, p+" at "+l.Fix)
+				}
+			}
+		}
+	}
+
+	for key := range s.loaChecks {
+		callsign, _, _ := strings.Cut(key, "/")
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(s.loaChecks, key)
+		}
+	}
+}
+
+// loaResponsible returns whether the LOA should be checked for clearances
+// issued by the given controller.
+func (s *Sim) loaResponsible(l LOA, tcp string) bool {
+	return s.isActiveHumanController(tcp) && (len(l.Controllers) == 0 || slices.Contains(l.Controllers, tcp))
+}
+
+func (s *Sim) postLOAViolation(l LOA, ac *av.Aircraft, tcp, msg string) {
+	s.lg.Info("LOA violation", slog.String("loa", l.Name), slog.String("callsign", ac.Callsign),
+		slog.String("controller", tcp), slog.String("problem", msg))
+	s.eventStream.Post(Event{
+		Type:         LOAViolationEvent,
+		Callsign:     ac.Callsign,
+		ToController: tcp,
+		Message:      l.Name + ": " + msg,
+	})
+}
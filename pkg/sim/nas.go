@@ -7,14 +7,14 @@ package sim
 import (
 	"fmt"
 	"slices"
-	"strconv"
 	"strings"
 	"time"
-	"unicode"
 
 	av "github.com/mmp/vice/pkg/aviation"
 	"github.com/mmp/vice/pkg/log"
 	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/units"
 	"github.com/mmp/vice/pkg/util"
 )
 
@@ -66,6 +66,7 @@ type ERAMComputer struct {
 	// copy in ERAMComputer so that when we deserialize after loading a
 	// saved sim, we are still sharing the same one.
 	STARSCodePool *av.SquawkCodePool
+	SquawkLedger  *SquawkLedger // see squawks.go
 	Identifier    string
 	Adaptation    av.ERAMAdaptation
 
@@ -80,6 +81,7 @@ func MakeERAMComputer(fac string, adapt av.ERAMAdaptation, starsBeaconBank int,
 		TrackInformation: make(map[string]*TrackInformation),
 		SquawkCodePool:   av.MakeCompleteSquawkCodePool(),
 		STARSCodePool:    av.MakeSquawkBankCodePool(starsBeaconBank),
+		SquawkLedger:     makeSquawkLedger(),
 		Identifier:       fac,
 		eramComputers:    eramComputers,
 	}
@@ -87,6 +89,7 @@ func MakeERAMComputer(fac string, adapt av.ERAMAdaptation, starsBeaconBank int,
 	for id, tracon := range av.DB.TRACONs {
 		if tracon.ARTCC == fac {
 			sc := MakeSTARSComputer(id, ec.STARSCodePool)
+			sc.eram = ec
 			ec.STARSComputers[id] = sc
 		}
 	}
@@ -97,21 +100,29 @@ func MakeERAMComputer(fac string, adapt av.ERAMAdaptation, starsBeaconBank int,
 func (comp *ERAMComputer) Activate(ec *ERAMComputers) {
 	comp.eramComputers = ec
 
+	if comp.SquawkLedger == nil {
+		comp.SquawkLedger = makeSquawkLedger()
+		comp.SquawkLedger.sync(comp.SquawkCodePool, comp.STARSCodePool)
+	}
+
 	// When a sim is saved, we lose the fact that the STARSComputers all
 	// share the same SquawkCodePool; so we will reestablish that now from
 	// the copy saved in ERAMComputer.
 	for _, sc := range comp.STARSComputers {
 		sc.Activate(comp.STARSCodePool)
+		sc.eram = comp
 	}
 }
 
 // For NAS codes
-func (comp *ERAMComputer) CreateSquawk() (av.Squawk, error) {
-	return comp.SquawkCodePool.Get()
+func (comp *ERAMComputer) CreateSquawk(callsign string, r *rand.Rand) (av.Squawk, error) {
+	return comp.SquawkLedger.get(comp.SquawkCodePool, comp.SquawkLedger.ERAM, callsign, r)
 }
 
+// ReturnSquawk returns the code to the pool it was allocated from, which
+// may be the STARS computers' pool.
 func (comp *ERAMComputer) ReturnSquawk(code av.Squawk) error {
-	return comp.SquawkCodePool.Return(code)
+	return comp.SquawkLedger.release(comp.SquawkCodePool, comp.STARSCodePool, code)
 }
 
 func (comp *ERAMComputer) SendFlightPlans(tracon string, simTime time.Time, lg *log.Logger) {
@@ -136,7 +147,7 @@ func (comp *ERAMComputer) SendFlightPlans(tracon string, simTime time.Time, lg *
 
 	for _, info := range comp.TrackInformation {
 		if fp := info.FlightPlan; fp != nil {
-			if fp.Callsign == "" && fp.Altitude == "" {
+			if fp.Callsign == "" && !fp.Altitude.IsSet() {
 				// FIXME(mtrokel): figure out why these are sneaking in here!
 				delete(comp.TrackInformation, info.Identifier)
 			} else {
@@ -156,9 +167,9 @@ func (comp *ERAMComputer) SendFlightPlan(fp *av.STARSFlightPlan, tracon string,
 	msg.SourceID = formatSourceID(comp.Identifier, simTime)
 
 	if coordFix, ok := comp.Adaptation.CoordinationFixes[fp.CoordinationFix]; !ok {
-		return av.ErrNoMatchingFix
+		return nasError(av.ErrNoMatchingFix, comp.Identifier, fp.Callsign, Plan)
 	} else if adaptFix, err := coordFix.Fix(fp.Altitude); err != nil {
-		return err
+		return nasError(err, comp.Identifier, fp.Callsign, Plan)
 	} else {
 		// TODO: change tracon to the fix pair assignment (this will be in the adaptation)
 		err := comp.SendMessageToSTARSFacility(tracon, msg)
@@ -179,7 +190,10 @@ func (comp *ERAMComputer) AddTrackInformation(callsign string, trk TrackInformat
 }
 
 func (comp *ERAMComputer) AddDeparture(fp *av.FlightPlan, tracon string, simTime time.Time) {
-	starsFP := av.MakeSTARSFlightPlan(fp)
+	// Make a copy so that amendments to our plan don't change the
+	// aircraft's.
+	fpCopy := *fp
+	starsFP := av.MakeSTARSFlightPlan(&fpCopy)
 
 	if fix := comp.Adaptation.FixForRouteAndAltitude(starsFP.Route, starsFP.Altitude); fix != nil {
 		msg := MakeFlightPlanMessage(starsFP)
@@ -203,7 +217,7 @@ func (comp *ERAMComputer) SendMessageToSTARSFacility(facility string, msg Flight
 	}
 
 	if stars, ok := comp.STARSComputers[facility]; !ok {
-		return av.ErrInvalidFacility
+		return nasError(ErrUnknownFacility, facility, msg.Identifier, msg.MessageType)
 	} else {
 		stars.ReceivedMessages = append(stars.ReceivedMessages, msg)
 		return nil
@@ -211,11 +225,17 @@ func (comp *ERAMComputer) SendMessageToSTARSFacility(facility string, msg Flight
 }
 
 func (comp *ERAMComputer) Update(s *Sim) {
-	comp.SortMessages(s.State.SimTime, s.lg)
-	comp.SendFlightPlans(s.State.TRACON, s.State.SimTime, s.lg)
+	remote := comp.eramComputers.remote
+	if !remote[comp.Identifier] {
+		now := s.clock.Now()
+		comp.SortMessages(now, s.lg)
+		comp.SendFlightPlans(s.State.TRACON, now, s.lg)
+	}
 
-	for _, stars := range comp.STARSComputers {
-		stars.Update(s)
+	for id, stars := range comp.STARSComputers {
+		if !remote[id] {
+			stars.Update(s)
+		}
 	}
 }
 
@@ -225,7 +245,7 @@ func (comp *ERAMComputer) SendMessageToERAM(facility string, msg FlightPlanMessa
 	}
 
 	if facERAM, ok := comp.eramComputers.Computers[facility]; !ok {
-		return av.ErrInvalidFacility
+		return nasError(ErrUnknownFacility, facility, msg.Identifier, msg.MessageType)
 	} else {
 		facERAM.ReceivedMessages = append(facERAM.ReceivedMessages, msg)
 		return nil
@@ -233,25 +253,36 @@ func (comp *ERAMComputer) SendMessageToERAM(facility string, msg FlightPlanMessa
 }
 
 func (comp *ERAMComputer) SortMessages(simTime time.Time, lg *log.Logger) {
-	for _, msg := range comp.ReceivedMessages {
+	lg = lg.Subsystem("eram").With(log.Facility(comp.Identifier))
+
+	// Take the messages first; handling them may send more our way, which
+	// will be handled next time.
+	var msgs []FlightPlanMessage
+	msgs, comp.ReceivedMessages = comp.ReceivedMessages, nil
+
+	for _, msg := range msgs {
+		lg := lg.WithFlight("", msg.callsign()).With(log.Beacon(msg.BCN))
 		switch msg.MessageType {
 		case Plan:
 			fp := msg.FlightPlan()
 
 			if fp.AssignedSquawk == av.Squawk(0) {
 				// TODO: Figure out why it's sending a blank fp
-				//panic("zero squawk")
+				lg.Warnf("%s: plan without a beacon code", msg.FlightID)
 				break
 			}
 
-			// Ensure comp.FlightPlans[msg.BCN] is initialized
+			if prev := comp.FlightPlans[msg.BCN]; prev != nil && prev.Callsign == fp.Callsign {
+				// Remember who else has it so amendments still reach them.
+				fp.ContainedFacilities = prev.ContainedFacilities
+			}
 			comp.FlightPlans[msg.BCN] = fp
 
 			if fp.CoordinationFix == "" {
 				if fix := comp.FixForRouteAndAltitude(fp.Route, fp.Altitude); fix != nil {
 					fp.CoordinationFix = fix.Name
 				} else {
-					lg.Warnf("Coordination fix not found for route %q, altitude \"%s",
+					lg.Warnf("Coordination fix not found for route %q, altitude %q",
 						fp.Route, fp.Altitude)
 					continue
 				}
@@ -261,7 +292,9 @@ func (comp *ERAMComputer) SortMessages(simTime time.Time, lg *log.Logger) {
 			if af := comp.AdaptationFixForAltitude(fp.CoordinationFix, fp.Altitude); af != nil {
 				if af.ToFacility != comp.Identifier {
 					// Send the plan to the STARS facility that needs it.
-					comp.SendMessageToSTARSFacility(af.ToFacility, msg)
+					if comp.SendMessageToSTARSFacility(af.ToFacility, msg) == nil {
+						addContainedFacility(fp, af.ToFacility)
+					}
 				}
 			}
 
@@ -271,11 +304,51 @@ func (comp *ERAMComputer) SortMessages(simTime time.Time, lg *log.Logger) {
 			plan, ok := comp.FlightPlans[msg.BCN]
 			if ok {
 				msg := FlightPlanDepartureMessage(*plan.FlightPlan, comp.Identifier, simTime)
-				comp.SendMessageToSTARSFacility(facility, msg)
+				if comp.SendMessageToSTARSFacility(facility, msg) == nil {
+					addContainedFacility(plan, facility)
+				}
+			}
+
+		case Amendment:
+			// Update our copy of the flight plan and pass the amendment
+			// along to the facilities that have it as well as the one
+			// that sent it, so that its copy is updated.
+			bcn := util.Select(msg.PreviousBCN != 0, msg.PreviousBCN, msg.BCN)
+			fp := comp.FlightPlans[bcn]
+			if fp == nil {
+				lg.Warnf("%s: amendment for unknown flight plan", msg.FlightID)
+				break
+			}
+			if len(msg.SourceID) < 3 {
+				lg.Warnf("%s: amendment with invalid source %q", msg.FlightID, msg.SourceID)
+				break
+			}
+			fp.Route, fp.Altitude = msg.Route, msg.Altitude
+			fp.FlightPlan.Altitude = int(msg.Altitude.Low)
+			fp.Priority = msg.Priority
+			if msg.PreviousBCN != 0 {
+				// The plan's beacon code was changed.
+				delete(comp.FlightPlans, msg.PreviousBCN)
+				fp.AssignedSquawk = msg.BCN
+				comp.FlightPlans[msg.BCN] = fp
 			}
 
-			// FIXME: why is this here?
-			comp.ReceivedMessages = (comp.ReceivedMessages)[1:]
+			source := msg.SourceID[:3]
+			msg.SourceID = formatSourceID(comp.Identifier, simTime)
+			for _, fac := range util.DuplicateSlice(fp.ContainedFacilities) {
+				if fac == comp.Identifier {
+					continue
+				} else if fac[0] == 'Z' {
+					comp.SendMessageToERAM(fac, msg)
+				} else {
+					comp.SendMessageToSTARSFacility(fac, msg)
+				}
+			}
+			if !slices.Contains(fp.ContainedFacilities, source) {
+				if _, ok := comp.STARSComputers[source]; ok {
+					comp.SendMessageToSTARSFacility(source, msg)
+				}
+			}
 
 		case DepartureDM: // Stars ERAM coordination time tracking
 
@@ -283,35 +356,38 @@ func (comp *ERAMComputer) SortMessages(simTime time.Time, lg *log.Logger) {
 
 		case InitiateTransfer:
 			// Forward these to w.TRACON for now. ERAM adaptations will have to fix this eventually...
+			fp := comp.FlightPlans[msg.BCN]
+			if fp == nil {
+				lg.Warnf("%s: transfer for unknown flight plan", msg.Identifier)
+				break
+			}
 			if comp.TrackInformation[msg.Identifier] == nil {
-				comp.TrackInformation[msg.Identifier] = &TrackInformation{
-					FlightPlan: comp.FlightPlans[msg.BCN],
-				}
+				comp.TrackInformation[msg.Identifier] = &TrackInformation{FlightPlan: fp}
 			}
 			comp.TrackInformation[msg.Identifier].TrackOwner = msg.TrackOwner
 			comp.TrackInformation[msg.Identifier].HandoffController = msg.HandoffController
-			comp.SquawkCodePool.Return(msg.BCN)
-
-			for name, fixes := range comp.Adaptation.CoordinationFixes {
-				alt := comp.TrackInformation[msg.Identifier].FlightPlan.Altitude
-				if fix, err := fixes.Fix(alt); err != nil {
-					lg.Warnf("Couldn't find adaptation fix: %v. Altitude %q, Fixes %+v",
-						err, alt, fixes)
-				} else {
-					if name == msg.CoordinationFix && fix.ToFacility != comp.Identifier { // Forward
-						msg.SourceID = formatSourceID(comp.Identifier, simTime)
-						if to := fix.ToFacility; len(to) > 0 && to[0] == 'Z' { // To another ARTCC
-							comp.SendMessageToERAM(to, msg)
-						} else { // To a TRACON
-							comp.SendMessageToSTARSFacility(to, msg)
-						}
-					} else if name == msg.CoordinationFix && fix.ToFacility == comp.Identifier { // Stay here
-						comp.TrackInformation[msg.Identifier] = &TrackInformation{
-							TrackOwner:        msg.TrackOwner,
-							HandoffController: msg.HandoffController,
-							FlightPlan:        comp.FlightPlans[msg.BCN],
-						}
-					}
+			// The beacon code stays assigned; it is returned to the pool
+			// when the aircraft is deleted.
+
+			if fix := comp.AdaptationFixForAltitude(msg.CoordinationFix, fp.Altitude); fix == nil {
+				lg.Warnf("%s: couldn't find adaptation fix for altitude %q", msg.CoordinationFix, fp.Altitude)
+			} else if fix.ToFacility != comp.Identifier { // Forward
+				msg.SourceID = formatSourceID(comp.Identifier, simTime)
+				to := fix.ToFacility
+				var err error
+				if len(to) > 0 && to[0] == 'Z' { // To another ARTCC
+					err = comp.SendMessageToERAM(to, msg)
+				} else { // To a TRACON
+					err = comp.SendMessageToSTARSFacility(to, msg)
+				}
+				if err == nil {
+					addContainedFacility(fp, to)
+				}
+			} else { // Stay here
+				comp.TrackInformation[msg.Identifier] = &TrackInformation{
+					TrackOwner:        msg.TrackOwner,
+					HandoffController: msg.HandoffController,
+					FlightPlan:        fp,
 				}
 			}
 
@@ -322,38 +398,43 @@ func (comp *ERAMComputer) SortMessages(simTime time.Time, lg *log.Logger) {
 					msg.CoordinationFix)
 			} else {
 				if info := comp.TrackInformation[msg.Identifier]; info != nil {
-					// Recall message, we can free up this code now
-					if msg.TrackOwner == info.TrackOwner {
-						comp.SquawkCodePool.Return(msg.BCN)
-					}
+					// Even for a recall, the aircraft still has its code,
+					// so it isn't returned to the pool here.
 					info.TrackOwner = msg.TrackOwner
 
-					altitude := info.FlightPlan.Altitude
-					if adaptationFix, err := adaptationFixes.Fix(altitude); err == nil {
-						if adaptationFix.FromFacility != comp.Identifier {
-							// Comes from a different ERAM facility
-							comp.SendMessageToERAM(adaptationFix.FromFacility, msg)
+					if fp := info.FlightPlan; fp != nil {
+						if adaptationFix, err := adaptationFixes.Fix(fp.Altitude); err == nil {
+							if adaptationFix.FromFacility != comp.Identifier {
+								// Comes from a different ERAM facility
+								comp.SendMessageToERAM(adaptationFix.FromFacility, msg)
+							}
 						}
 					}
 				}
 			}
 		}
 	}
+}
 
-	clear(comp.ReceivedMessages)
+// addContainedFacility records that the given facility has been sent a
+// copy of the flight plan.
+func addContainedFacility(fp *av.STARSFlightPlan, fac string) {
+	if !slices.Contains(fp.ContainedFacilities, fac) {
+		fp.ContainedFacilities = append(fp.ContainedFacilities, fac)
+	}
 }
 
-func (ec *ERAMComputer) FixForRouteAndAltitude(route string, altitude string) *av.AdaptationFix {
+func (ec *ERAMComputer) FixForRouteAndAltitude(route string, altitude units.FlightDataAltitude) *av.AdaptationFix {
 	return ec.Adaptation.FixForRouteAndAltitude(route, altitude)
 }
 
-func (ec *ERAMComputer) AdaptationFixForAltitude(fix string, altitude string) *av.AdaptationFix {
+func (ec *ERAMComputer) AdaptationFixForAltitude(fix string, altitude units.FlightDataAltitude) *av.AdaptationFix {
 	return ec.Adaptation.AdaptationFixForAltitude(fix, altitude)
 }
 
 func (comp *ERAMComputer) InitiateTrack(callsign string, controller string, fp *av.STARSFlightPlan) error {
 	if fp != nil { // FIXME: why is this nil?
-		comp.SquawkCodePool.Claim(fp.AssignedSquawk)
+		comp.claimSquawk(fp.AssignedSquawk, callsign)
 	}
 	return nil
 }
@@ -361,7 +442,7 @@ func (comp *ERAMComputer) InitiateTrack(callsign string, controller string, fp *
 func (comp *ERAMComputer) HandoffTrack(ac *av.Aircraft, from, to *av.Controller, simTime time.Time) error {
 	plan := comp.FlightPlans[ac.Squawk]
 	if plan == nil {
-		return av.ErrNoFlightPlan
+		return nasError(av.ErrNoFlightPlan, comp.Identifier, ac.Callsign, InitiateTransfer)
 	}
 	msg := MakeFlightPlanMessage(plan)
 	msg.SourceID = formatSourceID(from.Facility, simTime)
@@ -389,7 +470,9 @@ func (comp *ERAMComputer) HandoffTrack(ac *av.Aircraft, from, to *av.Controller,
 
 func (comp *ERAMComputer) DropTrack(ac *av.Aircraft) error {
 	if trk := comp.TrackInformation[ac.Callsign]; trk != nil {
-		delete(comp.FlightPlans, trk.FlightPlan.AssignedSquawk)
+		if trk.FlightPlan != nil {
+			delete(comp.FlightPlans, trk.FlightPlan.AssignedSquawk)
+		}
 		delete(comp.TrackInformation, ac.Callsign)
 	}
 	return nil
@@ -405,6 +488,11 @@ func (comp *ERAMComputer) CompletelyDeleteAircraft(ac *av.Aircraft) {
 			}
 		}
 	}
+	for sq, fp := range comp.FlightPlans {
+		if fp.Callsign == ac.Callsign {
+			delete(comp.FlightPlans, sq)
+		}
+	}
 
 	for _, stars := range comp.STARSComputers {
 		stars.CompletelyDeleteAircraft(ac)
@@ -413,6 +501,11 @@ func (comp *ERAMComputer) CompletelyDeleteAircraft(ac *av.Aircraft) {
 
 type ERAMComputers struct {
 	Computers map[string]*ERAMComputer
+
+	// Facilities that are handled by a federated sim; messages sent to
+	// their computers are forwarded to it rather than being processed
+	// here. See federation.go.
+	remote map[string]bool
 }
 
 type ERAMTrackInfo struct {
@@ -433,6 +526,8 @@ type STARSComputer struct {
 	UnsupportedTracks []UnsupportedTrack
 	SquawkCodePool    *av.SquawkCodePool
 	HoldForRelease    []*av.Aircraft
+
+	eram *ERAMComputer // do not include when we serialize
 }
 
 func MakeSTARSComputer(id string, sq *av.SquawkCodePool) *STARSComputer {
@@ -450,12 +545,19 @@ func (comp *STARSComputer) Activate(pool *av.SquawkCodePool) {
 }
 
 // For local codes
-func (comp *STARSComputer) CreateSquawk() (av.Squawk, error) {
-	return comp.SquawkCodePool.Get()
+func (comp *STARSComputer) CreateSquawk(callsign string, r *rand.Rand) (av.Squawk, error) {
+	if comp.eram == nil {
+		return comp.SquawkCodePool.Get(r)
+	}
+	l := comp.eram.SquawkLedger
+	return l.get(comp.SquawkCodePool, l.STARS, callsign, r)
 }
 
 func (comp *STARSComputer) ReturnSquawk(code av.Squawk) error {
-	return comp.SquawkCodePool.Return(code)
+	if comp.eram == nil {
+		return comp.SquawkCodePool.Return(code)
+	}
+	return comp.eram.ReturnSquawk(code)
 }
 
 func (comp *STARSComputer) SendTrackInfo(receivingFacility string, msg FlightPlanMessage, simTime time.Time) {
@@ -500,7 +602,7 @@ func (comp *STARSComputer) GetFlightPlan(identifier string) (*av.STARSFlightPlan
 			}
 		}
 	}
-	return nil, ErrNoMatchingFlight
+	return nil, nasError(ErrNoMatchingFlight, comp.Identifier, identifier, Unset)
 }
 
 func (comp *STARSComputer) AddFlightPlan(plan *av.STARSFlightPlan) {
@@ -551,7 +653,7 @@ func inAcquisitionArea(ac *av.Aircraft) bool {
 	}
 
 	for _, icao := range []string{ac.FlightPlan.DepartureAirport, ac.FlightPlan.ArrivalAirport} {
-		ap := av.DB.Airports[icao]
+		ap := av.DB.Airports()[icao]
 		if math.NMDistance2LL(ap.Location, ac.Position()) <= 2 {
 			return true
 		}
@@ -561,7 +663,7 @@ func inAcquisitionArea(ac *av.Aircraft) bool {
 
 func inDropArea(ac *av.Aircraft) bool {
 	for _, icao := range []string{ac.FlightPlan.DepartureAirport, ac.FlightPlan.ArrivalAirport} {
-		ap := av.DB.Airports[icao]
+		ap := av.DB.Airports()[icao]
 		if math.NMDistance2LL(ap.Location, ac.Position()) <= 1 &&
 			ac.Altitude() <= float32(ap.Elevation+50) {
 			return true
@@ -573,7 +675,7 @@ func inDropArea(ac *av.Aircraft) bool {
 
 func (comp *STARSComputer) InitiateTrack(callsign string, controller string, fp *av.STARSFlightPlan, haveControl bool) error {
 	if _, ok := comp.TrackInformation[callsign]; ok {
-		return av.ErrOtherControllerHasTrack
+		return nasError(av.ErrOtherControllerHasTrack, comp.Identifier, callsign, Unset)
 	}
 
 	trk := &TrackInformation{
@@ -602,7 +704,7 @@ func (comp *STARSComputer) InitiateTrack(callsign string, controller string, fp
 func (comp *STARSComputer) DropTrack(ac *av.Aircraft) error {
 	trk := comp.TrackInformation[ac.Callsign]
 	if trk == nil {
-		return av.ErrNoAircraftForCallsign
+		return nasError(av.ErrNoAircraftForCallsign, comp.Identifier, ac.Callsign, Unset)
 	}
 
 	delete(comp.ContainedPlans, ac.Squawk)
@@ -614,7 +716,7 @@ func (comp *STARSComputer) DropTrack(ac *av.Aircraft) error {
 func (comp *STARSComputer) HandoffTrack(callsign string, from *av.Controller, to *av.Controller, simTime time.Time) error {
 	trk := comp.TrackInformation[callsign]
 	if trk == nil {
-		return av.ErrNoAircraftForCallsign
+		return nasError(av.ErrNoAircraftForCallsign, comp.Identifier, callsign, Unset)
 	}
 
 	if to.Facility != from.Facility { // inter-facility
@@ -642,15 +744,38 @@ func (comp *STARSComputer) HandoffTrack(callsign string, from *av.Controller, to
 	return nil
 }
 
+// TransferTrack updates the track so that anything that was for the from
+// position (its ownership, a pending handoff, or a point out) is for the
+// to position; it's used when positions are consolidated or split.
+func (comp *STARSComputer) TransferTrack(callsign, from, to string) {
+	trk := comp.TrackInformation[callsign]
+	if trk == nil {
+		return
+	}
+
+	if trk.TrackOwner == from {
+		trk.TrackOwner = to
+	}
+	if trk.HandoffController == from {
+		trk.HandoffController = to
+	}
+	if trk.PointOut == from {
+		trk.PointOut = to
+	}
+	if trk.RedirectedHandoff.RedirectedTo == from {
+		trk.RedirectedHandoff.RedirectedTo = to
+	}
+}
+
 func (comp *STARSComputer) HandoffControl(callsign string, nextController string) error {
 	trk := comp.TrackInformation[callsign]
 	if trk == nil {
-		return av.ErrNoAircraftForCallsign
+		return nasError(av.ErrNoAircraftForCallsign, comp.Identifier, callsign, Unset)
 	}
 
 	if trk.HandoffController != nextController {
-		return fmt.Errorf("trk.HandoffController %s != nextController %s", trk.HandoffController,
-			nextController)
+		return nasError(fmt.Errorf("trk.HandoffController %s != nextController %s", trk.HandoffController,
+			nextController), comp.Identifier, callsign, Unset)
 	}
 
 	trk.TrackOwner = nextController
@@ -661,7 +786,7 @@ func (comp *STARSComputer) AcceptHandoff(ac *av.Aircraft, ctrl *av.Controller,
 	controllers map[string]*av.Controller, adaptation av.STARSFacilityAdaptation, simTime time.Time) error {
 	trk := comp.TrackInformation[ac.Callsign]
 	if trk == nil {
-		return av.ErrNoAircraftForCallsign
+		return nasError(av.ErrNoAircraftForCallsign, comp.Identifier, ac.Callsign, Unset)
 	}
 
 	if octrl := controllers[trk.TrackOwner]; octrl != nil && octrl.FacilityIdentifier != "" { // inter-facility
@@ -699,7 +824,7 @@ func (comp *STARSComputer) AutomatedAcceptHandoff(ac *av.Aircraft, controller st
 	// TODO: can this be unified with AcceptHandoff() above?
 	trk := comp.TrackInformation[ac.Callsign]
 	if trk == nil {
-		return av.ErrNoAircraftForCallsign
+		return nasError(av.ErrNoAircraftForCallsign, comp.Identifier, ac.Callsign, Unset)
 	}
 
 	if ctrl := controllers[trk.TrackOwner]; ctrl != nil && ctrl.FacilityIdentifier != "" { // inter-facility
@@ -725,12 +850,12 @@ func (comp *STARSComputer) CancelHandoff(ac *av.Aircraft, ctrl *av.Controller,
 	controllers map[string]*av.Controller, simTime time.Time) error {
 	trk := comp.TrackInformation[ac.Callsign]
 	if trk == nil || trk.HandoffController == "" {
-		return av.ErrNotBeingHandedOffToMe
+		return nasError(av.ErrNotBeingHandedOffToMe, comp.Identifier, ac.Callsign, Unset)
 	}
 
 	octrl := controllers[trk.HandoffController]
 	if octrl == nil {
-		return av.ErrInvalidController
+		return nasError(av.ErrInvalidController, comp.Identifier, ac.Callsign, Unset)
 	}
 
 	if octrl.Facility != ctrl.Facility { // inter-facility
@@ -757,7 +882,7 @@ func (comp *STARSComputer) CancelHandoff(ac *av.Aircraft, ctrl *av.Controller,
 func (comp *STARSComputer) RedirectHandoff(ac *av.Aircraft, ctrl, octrl *av.Controller) error {
 	trk := comp.TrackInformation[ac.Callsign]
 	if trk == nil || trk.HandoffController == "" {
-		return av.ErrNotBeingHandedOffToMe
+		return nasError(av.ErrNotBeingHandedOffToMe, comp.Identifier, ac.Callsign, Unset)
 	}
 
 	// FIXME(mtrokel): ac.TrackingController
@@ -775,7 +900,7 @@ func (comp *STARSComputer) RedirectHandoff(ac *av.Aircraft, ctrl, octrl *av.Cont
 func (comp *STARSComputer) AcceptRedirectedHandoff(ac *av.Aircraft, ctrl *av.Controller) error {
 	trk := comp.TrackInformation[ac.Callsign]
 	if trk == nil || trk.HandoffController == "" {
-		return av.ErrNotBeingHandedOffToMe
+		return nasError(av.ErrNotBeingHandedOffToMe, comp.Identifier, ac.Callsign, Unset)
 	}
 
 	if trk.RedirectedHandoff.RedirectedTo == ctrl.Id() { // Accept
@@ -796,7 +921,7 @@ func (comp *STARSComputer) AcceptRedirectedHandoff(ac *av.Aircraft, ctrl *av.Con
 func (comp *STARSComputer) PointOut(callsign, toController string) error {
 	trk := comp.TrackInformation[callsign]
 	if trk == nil || trk.HandoffController == "" {
-		return av.ErrNoAircraftForCallsign
+		return nasError(av.ErrNoAircraftForCallsign, comp.Identifier, callsign, Unset)
 	}
 
 	trk.PointOut = toController
@@ -806,7 +931,7 @@ func (comp *STARSComputer) PointOut(callsign, toController string) error {
 func (comp *STARSComputer) AcknowledgePointOut(callsign, controller string) error {
 	trk := comp.TrackInformation[callsign]
 	if trk == nil || trk.HandoffController == "" {
-		return av.ErrNoAircraftForCallsign
+		return nasError(av.ErrNoAircraftForCallsign, comp.Identifier, callsign, Unset)
 	}
 
 	trk.PointOut = ""
@@ -823,7 +948,7 @@ func (comp *STARSComputer) AcknowledgePointOut(callsign, controller string) erro
 func (comp *STARSComputer) RecallPointOut(callsign, controller string) error {
 	trk := comp.TrackInformation[callsign]
 	if trk == nil || trk.HandoffController == "" {
-		return av.ErrNoAircraftForCallsign
+		return nasError(av.ErrNoAircraftForCallsign, comp.Identifier, callsign, Unset)
 	}
 
 	trk.PointOut = ""
@@ -833,7 +958,7 @@ func (comp *STARSComputer) RecallPointOut(callsign, controller string) error {
 func (comp *STARSComputer) RejectPointOut(callsign, controller string) error {
 	trk := comp.TrackInformation[callsign]
 	if trk == nil || trk.HandoffController == "" {
-		return av.ErrNoAircraftForCallsign
+		return nasError(av.ErrNoAircraftForCallsign, comp.Identifier, callsign, Unset)
 	}
 
 	// TODO(mtrokel): what needs to be done here, if anything?
@@ -843,10 +968,10 @@ func (comp *STARSComputer) RejectPointOut(callsign, controller string) error {
 func (comp *STARSComputer) ReleaseDeparture(callsign string) error {
 	idx := slices.IndexFunc(comp.HoldForRelease, func(ac *av.Aircraft) bool { return ac.Callsign == callsign })
 	if idx == -1 {
-		return av.ErrNoAircraftForCallsign
+		return nasError(av.ErrNoAircraftForCallsign, comp.Identifier, callsign, Unset)
 	}
 	if comp.HoldForRelease[idx].Released {
-		return ErrAircraftAlreadyReleased
+		return nasError(ErrAircraftAlreadyReleased, comp.Identifier, callsign, Unset)
 	} else {
 		comp.HoldForRelease[idx].Released = true
 		return nil
@@ -862,23 +987,46 @@ func (comp *STARSComputer) AddHeldDeparture(ac *av.Aircraft) {
 }
 
 func (comp *STARSComputer) Update(s *Sim) {
-	comp.SortReceivedMessages(s.eventStream)
+	comp.SortReceivedMessages(s.eventStream, s.lg)
 	comp.AssociateFlightPlans(s)
 }
 
 // Sorting the STARS messages. This will store flight plans with FP
 // messages, change flight plans with AM messages, cancel flight plans with
 // CX messages, etc.
-func (comp *STARSComputer) SortReceivedMessages(e *EventStream) {
-	for _, msg := range comp.ReceivedMessages {
+func (comp *STARSComputer) SortReceivedMessages(e *EventStream, lg *log.Logger) {
+	lg = lg.Subsystem("stars").With(log.Facility(comp.Identifier))
+
+	var msgs []FlightPlanMessage
+	msgs, comp.ReceivedMessages = comp.ReceivedMessages, nil
+
+	for _, msg := range msgs {
+		lg := lg.WithFlight("", msg.callsign()).With(log.Beacon(msg.BCN))
+		lg.Debugf("received message type %d from %q", msg.MessageType, msg.SourceID)
+
 		switch msg.MessageType {
-		case Plan:
-			if msg.BCN != av.Squawk(0) {
-				comp.ContainedPlans[msg.BCN] = msg.FlightPlan()
+		case Plan, Amendment:
+			if msg.BCN == av.Squawk(0) {
+				lg.Warnf("%s: plan without a beacon code", msg.FlightID)
+				break
+			}
+			if msg.PreviousBCN != 0 {
+				delete(comp.ContainedPlans, msg.PreviousBCN)
 			}
 
-		case Amendment:
-			comp.ContainedPlans[msg.BCN] = msg.FlightPlan()
+			// If we're tracking the aircraft, its track holds the plan;
+			// keeping another copy in ContainedPlans would let it be
+			// associated a second time.
+			if trk := comp.trackForMessage(msg); trk != nil {
+				fp := trk.FlightPlan
+				fp.AssignedSquawk = msg.BCN
+				fp.Route, fp.Altitude = msg.Route, msg.Altitude
+				fp.FlightPlan.Altitude = int(msg.Altitude.Low)
+				fp.Priority = msg.Priority
+				delete(comp.ContainedPlans, msg.BCN)
+			} else {
+				comp.ContainedPlans[msg.BCN] = msg.FlightPlan()
+			}
 
 		case Cancellation: // Deletes the flight plan from the computer
 			delete(comp.ContainedPlans, msg.BCN)
@@ -916,13 +1064,13 @@ func (comp *STARSComputer) SortReceivedMessages(e *EventStream) {
 						ToController: msg.TrackOwner,
 					})
 				} else { // send an IF msg
+					lg.Warnf("%s: transfer for unknown flight plan", msg.Identifier)
 					e.Post(Event{
 						Type:         TransferRejectedEvent,
 						Callsign:     msg.Identifier,
 						ToController: msg.TrackOwner,
 					})
 				}
-
 			}
 
 		case AcceptRecallTransfer:
@@ -949,8 +1097,22 @@ func (comp *STARSComputer) SortReceivedMessages(e *EventStream) {
 			}
 		}
 	}
+}
 
-	clear(comp.ReceivedMessages)
+// trackForMessage returns our track for the flight that a plan or
+// amendment message is for, if there is one.
+func (comp *STARSComputer) trackForMessage(msg FlightPlanMessage) *TrackInformation {
+	callsign := msg.FlightPlan().Callsign
+	for _, cs := range util.SortedMapKeys(comp.TrackInformation) {
+		trk := comp.TrackInformation[cs]
+		if fp := trk.FlightPlan; fp != nil && fp.FlightPlan != nil {
+			if (callsign != "" && (cs == callsign || fp.Callsign == callsign)) || fp.AssignedSquawk == msg.BCN ||
+				(msg.PreviousBCN != 0 && fp.AssignedSquawk == msg.PreviousBCN) {
+				return trk
+			}
+		}
+	}
+	return nil
 }
 
 func (comp *STARSComputer) AssociateFlightPlans(s *Sim) {
@@ -1016,6 +1178,12 @@ func (comp *STARSComputer) CompletelyDeleteAircraft(ac *av.Aircraft) {
 	comp.HoldForRelease = util.FilterSliceInPlace(comp.HoldForRelease,
 		func(a *av.Aircraft) bool { return ac.Callsign != a.Callsign })
 
+	for sq, fp := range comp.ContainedPlans {
+		if fp.Callsign == ac.Callsign {
+			delete(comp.ContainedPlans, sq)
+		}
+	}
+
 	for sq, info := range comp.TrackInformation {
 		if fp := info.FlightPlan; fp != nil {
 			if fp.Callsign == ac.Callsign {
@@ -1033,6 +1201,7 @@ type FlightPlanMessage struct {
 	FlightID         string // ddaLa(a)(a)(a)(a)(a)ECID (3 chars start w/ digit), Aircraft ID (2-7 chars start with letter)
 	AircraftData     AircraftDataMessage
 	BCN              av.Squawk
+	PreviousBCN      av.Squawk // For amendments that change the beacon code
 	CoordinationFix  string
 	CoordinationTime av.CoordinationTime
 
@@ -1043,8 +1212,9 @@ type FlightPlanMessage struct {
 	// computer instead of the cruising altitude. If no interim altitude is
 	// set, use the cruise altitude (check this) Examples of altitudes
 	// could be 310, VFR/170, VFR, 170B210 (block altitude), etc.
-	Altitude string
+	Altitude units.FlightDataAltitude
 	Route    string
+	Priority av.PriorityFlags
 
 	TrackInformation // For track messages
 }
@@ -1102,23 +1272,6 @@ const (
 	Errors
 )
 
-type AbbreviatedFPFields struct {
-	ACID                string
-	BCN                 av.Squawk
-	ControllingPosition string
-	TypeOfFlight        string // Figure out this
-	SC1                 string
-	SC2                 string
-	AircraftType        string
-	RequestedALT        string
-	Rules               av.FlightRules
-	DepartureAirport    string // Specified with type of flight (maybe)
-
-	// TODO: why is there an error stored here (vs just returned from the
-	// parsing function)?
-	Error error
-}
-
 type UnsupportedTrack struct {
 	TrackLocation     math.Point2LL
 	Owner             string
@@ -1129,8 +1282,9 @@ type UnsupportedTrack struct {
 func MakeFlightPlanMessage(fp *av.STARSFlightPlan) FlightPlanMessage {
 	return FlightPlanMessage{
 		BCN:      fp.AssignedSquawk,
-		Altitude: fp.Altitude, // Eventually we'll change this to a string
+		Altitude: fp.Altitude,
 		Route:    fp.Route,
+		Priority: fp.Priority,
 		AircraftData: AircraftDataMessage{
 			DepartureLocation: fp.DepartureAirport,
 			ArrivalLocation:   fp.ArrivalAirport,
@@ -1174,7 +1328,7 @@ func (ec *ERAMComputers) FacilityComputers(fac string) (*ERAMComputer, *STARSCom
 
 	tracon, ok := av.DB.TRACONs[fac]
 	if !ok {
-		return nil, nil, av.ErrInvalidFacility
+		return nil, nil, nasError(ErrUnknownFacility, fac, "", Unset)
 	}
 
 	eram, ok := ec.Computers[tracon.ARTCC]
@@ -1192,6 +1346,48 @@ func (ec *ERAMComputers) FacilityComputers(fac string) (*ERAMComputer, *STARSCom
 	return eram, stars, nil
 }
 
+// SetRemoteFacilities records the facilities that are handled by a
+// federated sim.
+func (ec *ERAMComputers) SetRemoteFacilities(facilities []string) {
+	ec.remote = make(map[string]bool)
+	for _, fac := range facilities {
+		ec.remote[fac] = true
+	}
+}
+
+// TakeMessages returns the messages that have been sent to the given
+// facility's computer and clears its inbox.
+func (ec *ERAMComputers) TakeMessages(fac string) []FlightPlanMessage {
+	eram, stars, err := ec.FacilityComputers(fac)
+	if err != nil {
+		return nil
+	}
+
+	var msgs []FlightPlanMessage
+	if stars != nil {
+		msgs, stars.ReceivedMessages = stars.ReceivedMessages, nil
+	} else {
+		msgs, eram.ReceivedMessages = eram.ReceivedMessages, nil
+	}
+	return msgs
+}
+
+// DeliverMessage adds a message for the given facility's computer that
+// was sent by a federated sim.
+func (ec *ERAMComputers) DeliverMessage(fac string, msg FlightPlanMessage) error {
+	eram, stars, err := ec.FacilityComputers(fac)
+	if err != nil {
+		return err
+	}
+
+	if stars != nil {
+		stars.ReceivedMessages = append(stars.ReceivedMessages, msg)
+	} else {
+		eram.ReceivedMessages = append(eram.ReceivedMessages, msg)
+	}
+	return nil
+}
+
 // Give the computers a chance to sort through their received
 // messages and do assorted housekeeping.
 func (ec ERAMComputers) Update(s *Sim) {
@@ -1211,7 +1407,8 @@ func (ec ERAMComputers) GetSTARSFlightPlan(tracon string, identifier string) (*a
 }
 
 func (ec *ERAMComputers) AddArrival(ac *av.Aircraft, facility string, fa av.STARSFacilityAdaptation, simTime time.Time) error {
-	starsFP := av.MakeSTARSFlightPlan(ac.FlightPlan)
+	fp := *ac.FlightPlan
+	starsFP := av.MakeSTARSFlightPlan(&fp)
 	if err := starsFP.SetCoordinationFix(fa, ac, simTime); err != nil {
 		return err
 	}
@@ -1247,7 +1444,7 @@ func (ec *ERAMComputers) CompletelyDeleteAircraft(ac *av.Aircraft) {
 func (ec *ERAMComputers) HandoffTrack(ac *av.Aircraft, from, to string, controllers map[string]*av.Controller, simTime time.Time) error {
 	fromCtrl, toCtrl := controllers[from], controllers[to]
 	if fromCtrl == nil || toCtrl == nil {
-		return av.ErrInvalidController
+		return nasError(av.ErrInvalidController, "", ac.Callsign, Unset)
 	}
 
 	eram, stars, err := ec.FacilityComputers(fromCtrl.Facility)
@@ -1285,6 +1482,61 @@ func (ec *ERAMComputers) SetSecondaryScratchpad(callsign, facility, scratchpad s
 	return nil
 }
 
+// AmendFlightPlan sends an amendment for the aircraft's flight plan to
+// the ERAM computer responsible for the given facility, which updates its
+// copy of the plan and forwards it to the facilities that have it.
+func (ec *ERAMComputers) AmendFlightPlan(ac *av.Aircraft, facility string, simTime time.Time) error {
+	eram, _, err := ec.FacilityComputers(facility)
+	if err != nil {
+		return err
+	}
+
+	msg := makeAmendmentMessage(ac)
+	msg.SourceID = formatSourceID(facility, simTime)
+	eram.ReceivedMessages = append(eram.ReceivedMessages, msg)
+	return nil
+}
+
+// makeAmendmentMessage returns an amendment with the aircraft's current
+// flight plan and priority status.
+func makeAmendmentMessage(ac *av.Aircraft) FlightPlanMessage {
+	fp := av.MakeSTARSFlightPlan(ac.FlightPlan)
+	fp.Priority = ac.Priority()
+	msg := MakeFlightPlanMessage(fp)
+	msg.MessageType = Amendment
+	return msg
+}
+
+// AmendBeaconCode sends an amendment for a flight plan whose beacon code
+// has been changed from previous to the one the aircraft is squawking.
+// The tracking facility's copy of the plan is updated immediately and
+// the code pools are updated to match.
+func (ec *ERAMComputers) AmendBeaconCode(ac *av.Aircraft, facility string, previous av.Squawk, simTime time.Time) error {
+	eram, stars, err := ec.FacilityComputers(facility)
+	if err != nil {
+		return err
+	}
+
+	sq := ac.FlightPlan.AssignedSquawk
+	if stars != nil {
+		if trk := stars.TrackInformation[ac.Callsign]; trk != nil && trk.FlightPlan != nil {
+			trk.FlightPlan.AssignedSquawk = sq
+		}
+	}
+	// Either code may be outside of the pools' ranges, in which case
+	// there's nothing to do.
+	if previous != sq {
+		eram.ReturnSquawk(previous)
+	}
+	eram.claimSquawk(sq, ac.Callsign)
+
+	msg := makeAmendmentMessage(ac)
+	msg.PreviousBCN = previous
+	msg.SourceID = formatSourceID(facility, simTime)
+	eram.ReceivedMessages = append(eram.ReceivedMessages, msg)
+	return nil
+}
+
 // For debugging purposes
 func (e ERAMComputers) DumpMap() {
 	for key, eramComputer := range e.Computers {
@@ -1349,9 +1601,20 @@ func (e ERAMComputers) DumpMap() {
 	}
 }
 
+// callsign returns the callsign of the flight the message is about, if
+// it can be determined.
+func (s FlightPlanMessage) callsign() string {
+	if s.Identifier != "" {
+		return s.Identifier
+	} else if len(s.FlightID) > 3 {
+		return s.FlightID[3:]
+	}
+	return ""
+}
+
 // Converts the message to a STARS flight plan.
 func (s FlightPlanMessage) FlightPlan() *av.STARSFlightPlan {
-	rules := av.FlightRules(util.Select(strings.Contains(s.Altitude, "VFR"), av.VFR, av.IFR))
+	rules := av.FlightRules(util.Select(s.Altitude.VFR, av.VFR, av.IFR))
 	flightPlan := &av.STARSFlightPlan{
 		FlightPlan: &av.FlightPlan{
 			Rules:            rules,
@@ -1364,6 +1627,7 @@ func (s FlightPlanMessage) FlightPlan() *av.STARSFlightPlan {
 		CoordinationFix:  s.CoordinationFix,
 		CoordinationTime: s.CoordinationTime,
 		Altitude:         s.Altitude,
+		Priority:         s.Priority,
 	}
 
 	if len(s.FlightID) > 3 {
@@ -1376,6 +1640,9 @@ func (s FlightPlanMessage) FlightPlan() *av.STARSFlightPlan {
 
 // Prepare the message to sent to a STARS facility after a RF message
 func FlightPlanDepartureMessage(fp av.FlightPlan, sendingFacility string, simTime time.Time) FlightPlanMessage {
+	alt := units.MakeFlightDataAltitude(units.Feet(fp.Altitude))
+	alt.VFR = fp.Rules == av.VFR
+
 	return FlightPlanMessage{
 		SourceID:    formatSourceID(sendingFacility, simTime),
 		MessageType: Plan,
@@ -1390,192 +1657,8 @@ func FlightPlanDepartureMessage(fp av.FlightPlan, sendingFacility string, simTim
 		},
 		BCN:             fp.AssignedSquawk,
 		CoordinationFix: fp.Exit,
-		Altitude:        util.Select(fp.Rules == av.VFR, "VFR/", "") + strconv.Itoa(fp.Altitude),
+		Altitude:        alt,
 		Route:           fp.Route,
+		Priority:        fp.FiledPriority(),
 	}
 }
-
-func MakeSTARSFlightPlanFromAbbreviated(abbr string, stars *STARSComputer, facilityAdaptation av.STARSFacilityAdaptation) (*av.STARSFlightPlan, error) {
-	if strings.Contains(abbr, "*") {
-		// VFR FP; it's a required field
-		// TODO(mtrokel)
-		return nil, nil
-	} else {
-		// Abbreviated FP
-		fields := strings.Fields(abbr)
-		if len(fields) == 0 {
-			return nil, ErrInvalidAbbreviatedFP
-		}
-
-		info := ParseAbbreviatedFPFields(facilityAdaptation, fields)
-		if err := info.Error; err != nil && err != ErrIllegalACType {
-			return nil, err
-		} else {
-			if info.BCN == av.Squawk(0) {
-				var err error
-				if info.BCN, err = stars.CreateSquawk(); err != nil {
-					return nil, err
-				}
-			}
-
-			fp := &av.STARSFlightPlan{ // TODO: Do single char ap parsing
-				FlightPlan: &av.FlightPlan{
-					Callsign:         info.ACID,
-					Rules:            util.Select(info.Rules == av.UNKNOWN, av.VFR, info.Rules),
-					AircraftType:     info.AircraftType,
-					DepartureAirport: info.DepartureAirport,
-					AssignedSquawk:   info.BCN,
-				},
-				Altitude:          util.Select(info.RequestedALT == "", "VFR", info.RequestedALT),
-				SP1:               info.SC1,
-				SP2:               info.SC1,
-				InitialController: info.ControllingPosition,
-			}
-			return fp, err
-		}
-	}
-}
-
-// FIXME: yuck, duplicated here
-const STARSTriangleCharacter = string(rune(0x80))
-
-func ParseAbbreviatedFPFields(facilityAdaptation av.STARSFacilityAdaptation, fields []string) AbbreviatedFPFields {
-	output := AbbreviatedFPFields{}
-	if len(fields[0]) >= 2 && len(fields[0]) <= 7 && unicode.IsLetter(rune(fields[0][0])) {
-		output.ACID = fields[0]
-	} else {
-		output.Error = ErrIllegalACID
-		return output
-	}
-
-	for _, field := range fields[1:] { // fields[0] is always the ACID
-		// See if it's a BCN
-		if sq, err := av.ParseSquawk(field); err == nil {
-			output.BCN = sq
-			continue
-		}
-
-		// See if its specifying the controlling position
-		if len(field) == 2 {
-			output.ControllingPosition = field
-			continue
-		}
-
-		// See if it's specifying the type of flight. No errors for this
-		// because this could turn into a scratchpad.
-		if len(field) <= 2 {
-			if len(field) == 1 {
-				switch field {
-				case "A":
-					output.TypeOfFlight = "arrival"
-				case "P":
-					output.TypeOfFlight = "departure"
-				case "E":
-					output.TypeOfFlight = "overflight"
-				}
-			} else if len(field) == 2 { // Type first, then airport id
-				types := []string{"A", "P", "E"}
-				if slices.Contains(types, field[:1]) {
-					output.TypeOfFlight = field[:1]
-					output.DepartureAirport = field[1:]
-					continue
-				}
-			}
-		}
-
-		badScratchpads := []string{"NAT", "CST", "AMB", "RDR", "ADB", "XXX"}
-		if strings.HasPrefix(field, STARSTriangleCharacter) && len(field) > 3 && len(field) <= 5 || (len(field) <= 6 && facilityAdaptation.AllowLongScratchpad) { // See if it's specifying the SC1
-
-			if slices.Contains(badScratchpads, field) {
-				output.Error = ErrIllegalScratchpad
-				return output
-			}
-			if util.IsAllNumbers(field[len(field)-3:]) {
-				output.Error = ErrIllegalScratchpad
-			}
-			output.SC1 = field
-		}
-		if strings.HasPrefix(field, "+") && len(field) > 2 && (len(field) <= 4 || (len(field) <= 5 && facilityAdaptation.AllowLongScratchpad)) { // See if it's specifying the SC1
-			if slices.Contains(badScratchpads, field) {
-				output.Error = ErrIllegalScratchpad
-				return output
-			}
-			if util.IsAllNumbers(field[len(field)-3:]) {
-				output.Error = ErrIllegalScratchpad
-			}
-			output.SC2 = field
-		}
-		if acFields := strings.Split(field, "/"); len(field) >= 4 { // See if it's specifying the type of flight
-			switch len(acFields) {
-			case 1: // Just the AC Type
-				if _, ok := av.DB.AircraftPerformance[field]; !ok { // AC doesn't exist
-					output.Error = ErrIllegalACType
-					continue
-				} else {
-					output.AircraftType = field
-					continue
-				}
-			case 2: // Either a formation number with the ac type or a ac type with a equipment suffix
-				if all := util.IsAllNumbers(acFields[0]); all { // Formation number
-					if !unicode.IsLetter(rune(acFields[1][0])) {
-						output.Error = ErrInvalidAbbreviatedFP
-						return output
-					}
-					if _, ok := av.DB.AircraftPerformance[acFields[1]]; !ok { // AC doesn't exist
-						output.Error = ErrIllegalACType // This error is informational. Shouldn't end the entire function. Just this switch statement
-						continue
-					}
-					output.AircraftType = field
-				} else { // AC Type with equipment suffix
-					if len(acFields[1]) > 1 || !util.IsAllLetters(acFields[1]) {
-						output.Error = ErrInvalidAbbreviatedFP
-						return output
-					}
-					if _, ok := av.DB.AircraftPerformance[acFields[0]]; !ok { // AC doesn't exist
-						output.Error = ErrIllegalACType
-						continue
-					}
-					output.AircraftType = field
-				}
-			case 3:
-				if len(acFields[2]) > 1 || !util.IsAllLetters(acFields[2]) {
-					output.Error = ErrInvalidAbbreviatedFP
-					return output
-				}
-				if !unicode.IsLetter(rune(acFields[1][0])) {
-					output.Error = ErrInvalidAbbreviatedFP
-					return output
-				}
-				if _, ok := av.DB.AircraftPerformance[acFields[1]]; !ok { // AC doesn't exist
-					output.Error = ErrIllegalACType
-					break
-				}
-				output.AircraftType = field
-			}
-			continue
-		}
-		if len(field) == 3 && util.IsAllNumbers(field) {
-			output.RequestedALT = field
-			continue
-		}
-		if len(field) == 2 {
-			if field[0] != '.' {
-				output.Error = ErrInvalidAbbreviatedFP
-				return output
-			}
-			switch field[1] {
-			case 'V':
-				output.Rules = av.VFR
-			case 'P':
-				output.Rules = av.VFR // vfr on top
-			case 'E':
-				output.Rules = av.IFR // enroute
-			default:
-				output.Error = ErrInvalidAbbreviatedFP
-				return output
-			}
-		}
-
-	}
-	return output
-}
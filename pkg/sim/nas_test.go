@@ -0,0 +1,556 @@
+// pkg/sim/nas_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// The NAS tests use two ARTCCs, each with one TRACON. Flights depart
+// from N90; ones that go via PARKE are handed to ZDC and then to PCT.
+func init() {
+	if av.DB == nil {
+		av.DB = &av.StaticDatabase{}
+	}
+	av.DB.TRACONs = map[string]av.TRACON{
+		"N90": {ARTCC: "ZNY"},
+		"PCT": {ARTCC: "ZDC"},
+	}
+	av.DB.ERAMAdaptations = map[string]av.ERAMAdaptation{
+		"ZNY": {
+			ARTCC: "ZNY",
+			CoordinationFixes: map[string]av.AdaptationFixes{
+				"PARKE": {{Name: "PARKE", Type: av.RouteBasedFix, ToFacility: "ZDC", FromFacility: "ZNY"}},
+				"MERIT": {{Name: "MERIT", Type: av.RouteBasedFix, ToFacility: "N90", FromFacility: "ZNY"}},
+				"BIGGY": {
+					{Name: "BIGGY", Type: av.RouteBasedFix, ToFacility: "N90", FromFacility: "ZNY", Altitude: [2]int{0, 17000}},
+					{Name: "BIGGY", Type: av.RouteBasedFix, ToFacility: "ZDC", FromFacility: "ZNY", Altitude: [2]int{17001, 60000}},
+				},
+			},
+		},
+		"ZDC": {
+			ARTCC: "ZDC",
+			CoordinationFixes: map[string]av.AdaptationFixes{
+				"PARKE": {{Name: "PARKE", Type: av.RouteBasedFix, ToFacility: "PCT", FromFacility: "ZNY"}},
+				"BIGGY": {{Name: "BIGGY", Type: av.RouteBasedFix, ToFacility: "PCT", FromFacility: "ZNY"}},
+			},
+		},
+	}
+}
+
+var (
+	nasTestRoutes    = []string{"PARKE J6", "MERIT J60", "BIGGY J75", "DIXIE V16", "PARKE BIGGY"}
+	nasTestAltitudes = []int{9000, 17000, 23000, 35000}
+	nasTestFixes     = []string{"PARKE", "MERIT", "BIGGY", "DIXIE", ""}
+	nasTestN90       = []*av.Controller{
+		{TCP: "1A", Facility: "N90"},
+		{TCP: "1B", Facility: "N90"},
+	}
+	nasTestPCT = []*av.Controller{
+		{TCP: "2A", FacilityIdentifier: "P", Facility: "PCT"},
+		{TCP: "2B", FacilityIdentifier: "P", Facility: "PCT"},
+	}
+)
+
+// nasHarness drives the ERAM and STARS computers the way the sim does,
+// keeping its own record of the flights that exist so that the
+// computers' state can be checked against it.
+type nasHarness struct {
+	t       *testing.T
+	ec      *ERAMComputers
+	es      *EventStream
+	lg      *log.Logger
+	r       rand.Rand
+	now     time.Time
+	flights map[string]*av.Aircraft
+	n       int
+
+	initialCodes int
+}
+
+func makeNASHarness(t *testing.T) *nasHarness {
+	h := &nasHarness{
+		t:       t,
+		es:      NewEventStream(nil),
+		lg:      &log.Logger{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))},
+		r:       rand.New(),
+		now:     time.Date(2024, 6, 1, 15, 4, 0, 0, time.UTC),
+		flights: make(map[string]*av.Aircraft),
+	}
+	h.r.Seed(1)
+	h.ec = MakeERAMComputers(0o22, h.lg)
+	h.ec.Activate()
+	h.initialCodes = h.eram("ZNY").SquawkCodePool.NumAvailable()
+	return h
+}
+
+func (h *nasHarness) eram(fac string) *ERAMComputer {
+	return h.ec.Computers[fac]
+}
+
+func (h *nasHarness) stars(fac string) *STARSComputer {
+	_, stars, err := h.ec.FacilityComputers(fac)
+	if err != nil || stars == nil {
+		h.t.Fatalf("%s: no STARS computer: %v", fac, err)
+	}
+	return stars
+}
+
+// flight returns the i'th live flight (modulo the number of them), if
+// there are any.
+func (h *nasHarness) flight(i byte) *av.Aircraft {
+	if len(h.flights) == 0 {
+		return nil
+	}
+	callsigns := util.SortedMapKeys(h.flights)
+	return h.flights[callsigns[int(i)%len(callsigns)]]
+}
+
+// All codes come from ZNY's pool, as they do in a sim whose TRACON is N90.
+func (h *nasHarness) addDeparture(arg byte) {
+	h.n++
+	callsign := fmt.Sprintf("AAL%d", h.n)
+	sq, err := h.eram("ZNY").CreateSquawk(callsign, &h.r)
+	if err != nil {
+		return
+	}
+
+	ac := &av.Aircraft{
+		Callsign: callsign,
+		Squawk:   sq,
+		FlightPlan: &av.FlightPlan{
+			Callsign:         callsign,
+			ECID:             "XXX",
+			Rules:            av.IFR,
+			AircraftType:     "B738/L",
+			AssignedSquawk:   sq,
+			DepartureAirport: "KJFK",
+			ArrivalAirport:   "KIAD",
+			Altitude:         nasTestAltitudes[int(arg/8)%len(nasTestAltitudes)],
+			Route:            nasTestRoutes[int(arg)%len(nasTestRoutes)],
+		},
+	}
+	h.flights[callsign] = ac
+	h.eram("ZNY").AddDeparture(ac.FlightPlan, "N90", h.now)
+}
+
+func (h *nasHarness) deleteAircraft(ac *av.Aircraft) {
+	// This matches State.DeleteAircraft.
+	delete(h.flights, ac.Callsign)
+	h.eram("ZNY").ReturnSquawk(ac.FlightPlan.AssignedSquawk)
+	h.ec.CompletelyDeleteAircraft(ac)
+}
+
+// step performs the operation given by op; arg chooses the flight,
+// controller, or whatever else the operation needs.
+func (h *nasHarness) step(op, arg byte) {
+	n90, pct := h.stars("N90"), h.stars("PCT")
+
+	switch op % 10 {
+	case 0:
+		h.addDeparture(arg)
+
+	case 1: // Altitude amendment
+		if ac := h.flight(arg); ac != nil {
+			ac.FlightPlan.Altitude = nasTestAltitudes[int(arg/4)%len(nasTestAltitudes)]
+			if err := h.ec.AmendFlightPlan(ac, "N90", h.now); err != nil {
+				h.t.Fatalf("AmendFlightPlan: %v", err)
+			}
+		}
+
+	case 2: // Beacon code change
+		if ac := h.flight(arg); ac != nil {
+			sq, err := h.eram("ZNY").CreateSquawk(ac.Callsign, &h.r)
+			if err != nil {
+				return
+			}
+			previous := ac.FlightPlan.AssignedSquawk
+			ac.Squawk, ac.FlightPlan.AssignedSquawk = sq, sq
+			if err := h.ec.AmendBeaconCode(ac, "N90", previous, h.now); err != nil {
+				h.t.Fatalf("AmendBeaconCode: %v", err)
+			}
+		}
+
+	case 3: // Initiate track at N90
+		if ac := h.flight(arg); ac != nil && n90.TrackInformation[ac.Callsign] == nil {
+			if fp := n90.ContainedPlans[ac.Squawk]; fp != nil {
+				ctrl := nasTestN90[int(arg/4)%len(nasTestN90)]
+				if err := n90.InitiateTrack(ac.Callsign, ctrl.Id(), fp, false); err != nil {
+					h.t.Fatalf("InitiateTrack: %v", err)
+				}
+			}
+		}
+
+	case 4: // Handoff from N90 to PCT
+		ac := h.flight(arg)
+		if ac == nil {
+			return
+		}
+		trk := n90.TrackInformation[ac.Callsign]
+		if trk == nil || trk.HandoffController != "" || trk.FlightPlan == nil {
+			return
+		}
+		idx := slices.IndexFunc(nasTestN90, func(c *av.Controller) bool { return c.Id() == trk.TrackOwner })
+		if idx == -1 {
+			return
+		}
+		from := nasTestN90[idx]
+		to := nasTestPCT[int(arg/4)%len(nasTestPCT)]
+		if err := n90.HandoffTrack(ac.Callsign, from, to, h.now); err != nil {
+			h.t.Fatalf("HandoffTrack: %v", err)
+		}
+
+		// STARS doesn't yet send to its ERAM computer, so do that here.
+		msg := MakeFlightPlanMessage(trk.FlightPlan)
+		msg.MessageType = InitiateTransfer
+		msg.SourceID = formatSourceID("N90", h.now)
+		msg.Identifier = ac.Callsign
+		msg.TrackOwner, msg.HandoffController = from.Id(), to.Id()
+		if fp := h.eram("ZNY").FlightPlans[ac.Squawk]; fp != nil {
+			msg.CoordinationFix = fp.CoordinationFix
+		}
+		h.deliver("ZNY", msg)
+
+	case 5: // PCT accepts a handoff
+		if ac := h.flight(arg); ac != nil {
+			trk := pct.TrackInformation[ac.Callsign]
+			if trk == nil || trk.HandoffController == "" || trk.HandoffController == trk.TrackOwner {
+				return
+			}
+			trk.TrackOwner, trk.HandoffController = trk.HandoffController, ""
+			h.deliver("N90", FlightPlanMessage{
+				MessageType:      AcceptRecallTransfer,
+				SourceID:         formatSourceID("PCT", h.now),
+				FlightID:         "XXX" + ac.Callsign,
+				BCN:              ac.Squawk,
+				TrackInformation: TrackInformation{Identifier: ac.Callsign, TrackOwner: trk.TrackOwner},
+			})
+		}
+
+	case 6: // N90 recalls a handoff
+		if ac := h.flight(arg); ac != nil {
+			trk := n90.TrackInformation[ac.Callsign]
+			if trk == nil || trk.HandoffController == "" || trk.HandoffController == trk.TrackOwner {
+				return
+			}
+			trk.HandoffController = ""
+			h.deliver("PCT", FlightPlanMessage{
+				MessageType:      AcceptRecallTransfer,
+				SourceID:         formatSourceID("N90", h.now),
+				FlightID:         "XXX" + ac.Callsign,
+				BCN:              ac.Squawk,
+				TrackInformation: TrackInformation{Identifier: ac.Callsign, TrackOwner: trk.TrackOwner},
+			})
+		}
+
+	case 7: // Drop track
+		if ac := h.flight(arg); ac != nil {
+			for _, stars := range []*STARSComputer{n90, pct} {
+				if trk := stars.TrackInformation[ac.Callsign]; trk != nil && trk.HandoffController == "" &&
+					h.ownedBy(trk.TrackOwner, stars.Identifier) {
+					if err := stars.DropTrack(ac); err != nil {
+						h.t.Fatalf("DropTrack: %v", err)
+					}
+				}
+			}
+		}
+
+	case 8: // PCT requests the flight plan
+		if ac := h.flight(arg); ac != nil {
+			h.deliver("ZDC", FlightPlanMessage{
+				MessageType: RequestFlightPlan,
+				SourceID:    formatSourceID("PCT", h.now),
+				BCN:         ac.Squawk,
+			})
+		}
+
+	case 9:
+		if ac := h.flight(arg); ac != nil {
+			h.deliver("ZNY", FlightPlanMessage{
+				MessageType: DepartureDM,
+				SourceID:    formatSourceID("N90", h.now),
+				FlightID:    "XXX" + ac.Callsign,
+				BCN:         ac.Squawk,
+			})
+		} else {
+			h.addDeparture(arg)
+		}
+	}
+
+	h.now = h.now.Add(time.Duration(arg) * time.Second)
+}
+
+func (h *nasHarness) ownedBy(tcp, fac string) bool {
+	ctrls := util.Select(fac == "N90", nasTestN90, nasTestPCT)
+	return slices.ContainsFunc(ctrls, func(c *av.Controller) bool { return c.Id() == tcp })
+}
+
+func (h *nasHarness) deliver(fac string, msg FlightPlanMessage) {
+	if err := h.ec.DeliverMessage(fac, msg); err != nil {
+		h.t.Fatalf("%s: DeliverMessage: %v", fac, err)
+	}
+}
+
+func (h *nasHarness) inboxesEmpty() bool {
+	for _, eram := range h.ec.Computers {
+		if len(eram.ReceivedMessages) > 0 {
+			return false
+		}
+		for _, stars := range eram.STARSComputers {
+			if len(stars.ReceivedMessages) > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// process has all of the computers handle their messages until there
+// are no more.
+func (h *nasHarness) process() {
+	for range 8 {
+		if h.inboxesEmpty() {
+			return
+		}
+		for _, fac := range util.SortedMapKeys(h.ec.Computers) {
+			eram := h.ec.Computers[fac]
+			eram.SortMessages(h.now, h.lg)
+			for _, id := range util.SortedMapKeys(eram.STARSComputers) {
+				eram.STARSComputers[id].SortReceivedMessages(h.es, h.lg)
+			}
+		}
+	}
+	if !h.inboxesEmpty() {
+		h.t.Fatalf("messages are still pending after 8 rounds")
+	}
+}
+
+// checkPlans checks that every stored flight plan is under its own,
+// valid, beacon code.
+func (h *nasHarness) checkPlans() {
+	check := func(fac string, plans map[av.Squawk]*av.STARSFlightPlan) {
+		for sq, fp := range plans {
+			if sq == 0 {
+				h.t.Errorf("%s: %s: plan stored under code 0000", fac, fp.Callsign)
+			} else if fp.AssignedSquawk != sq {
+				h.t.Errorf("%s: %s: plan with code %s stored under %s", fac, fp.Callsign, fp.AssignedSquawk, sq)
+			}
+		}
+	}
+	for _, fac := range util.SortedMapKeys(h.ec.Computers) {
+		eram := h.ec.Computers[fac]
+		check(fac, eram.FlightPlans)
+		for _, id := range util.SortedMapKeys(eram.STARSComputers) {
+			check(id, eram.STARSComputers[id].ContainedPlans)
+		}
+	}
+}
+
+// checkFlights checks that the computers agree with the harness about
+// which flights exist, their codes, and who owns them.
+func (h *nasHarness) checkFlights() {
+	// No code leaks: every live flight's code is assigned and nothing
+	// else is.
+	pool := h.eram("ZNY").SquawkCodePool
+	if n := h.initialCodes - len(h.flights); pool.NumAvailable() != n {
+		h.t.Errorf("%d codes available, expected %d", pool.NumAvailable(), n)
+	}
+	for _, ac := range h.flights {
+		if !pool.IsAssigned(ac.Squawk) {
+			h.t.Errorf("%s: code %s isn't assigned", ac.Callsign, ac.Squawk)
+		}
+	}
+	h.checkSquawks()
+
+	checkPlan := func(fac string, fp *av.STARSFlightPlan) {
+		if ac, ok := h.flights[fp.Callsign]; !ok {
+			h.t.Errorf("%s: plan for deleted flight %s", fac, fp.Callsign)
+		} else if fp.AssignedSquawk != ac.Squawk {
+			h.t.Errorf("%s: %s: stale code %s; flight has %s", fac, fp.Callsign, fp.AssignedSquawk, ac.Squawk)
+		}
+	}
+
+	owners := make(map[string][]string) // callsign -> owner at each STARS facility tracking it
+	for _, fac := range util.SortedMapKeys(h.ec.Computers) {
+		eram := h.ec.Computers[fac]
+		for _, fp := range eram.FlightPlans {
+			checkPlan(fac, fp)
+		}
+		for callsign := range eram.TrackInformation {
+			if _, ok := h.flights[callsign]; !ok {
+				h.t.Errorf("%s: track for deleted flight %s", fac, callsign)
+			}
+		}
+
+		for _, id := range util.SortedMapKeys(eram.STARSComputers) {
+			stars := eram.STARSComputers[id]
+			for _, fp := range stars.ContainedPlans {
+				checkPlan(id, fp)
+				if stars.TrackInformation[fp.Callsign] != nil {
+					h.t.Errorf("%s: %s is both tracked and has an unassociated plan", id, fp.Callsign)
+				}
+			}
+			for _, callsign := range util.SortedMapKeys(stars.TrackInformation) {
+				trk := stars.TrackInformation[callsign]
+				if trk.FlightPlan == nil {
+					h.t.Errorf("%s: %s: track without a flight plan", id, callsign)
+				} else {
+					checkPlan(id, trk.FlightPlan)
+				}
+				owners[callsign] = append(owners[callsign], trk.TrackOwner)
+			}
+		}
+	}
+
+	// No split-brain: once all of the messages have been delivered, every
+	// facility tracking a flight agrees on its owner.
+	for callsign, o := range owners {
+		if slices.ContainsFunc(o, func(s string) bool { return s != o[0] }) {
+			h.t.Errorf("%s: facilities disagree about the owner: %v", callsign, o)
+		}
+	}
+}
+
+// checkSquawks checks that the pools agree with their ledgers and that
+// there are no leaks.
+func (h *nasHarness) checkSquawks() {
+	for _, p := range h.ec.SquawkProblems(h.flights) {
+		h.t.Errorf("%s", p)
+	}
+}
+
+// checkEmpty checks that nothing is left behind once all of the flights
+// have been deleted.
+func (h *nasHarness) checkEmpty() {
+	h.checkSquawks()
+	if n := h.eram("ZNY").SquawkCodePool.NumAvailable(); n != h.initialCodes {
+		h.t.Errorf("%d codes available after deleting all flights, expected %d", n, h.initialCodes)
+	}
+	for _, fac := range util.SortedMapKeys(h.ec.Computers) {
+		eram := h.ec.Computers[fac]
+		if len(eram.FlightPlans) > 0 || len(eram.TrackInformation) > 0 {
+			h.t.Errorf("%s: %d plans and %d tracks left", fac, len(eram.FlightPlans), len(eram.TrackInformation))
+		}
+		for _, id := range util.SortedMapKeys(eram.STARSComputers) {
+			stars := eram.STARSComputers[id]
+			if len(stars.ContainedPlans) > 0 || len(stars.TrackInformation) > 0 {
+				h.t.Errorf("%s: %d plans and %d tracks left", id, len(stars.ContainedPlans), len(stars.TrackInformation))
+			}
+		}
+	}
+}
+
+func (h *nasHarness) deleteAll() {
+	for _, callsign := range util.SortedMapKeys(h.flights) {
+		h.deleteAircraft(h.flights[callsign])
+	}
+	h.process()
+}
+
+// FuzzNASOperations interprets its input as a series of (operation,
+// argument) byte pairs that are performed as the sim would perform them,
+// checking the computers' state after each one.
+func FuzzNASOperations(f *testing.F) {
+	f.Add([]byte{0, 0, 0, 1, 3, 0, 4, 0, 5, 0})
+	f.Add([]byte{0, 0, 3, 0, 4, 4, 6, 0, 2, 0, 1, 9})
+	f.Add([]byte{0, 4, 0, 5, 2, 1, 8, 1, 3, 1, 4, 1, 5, 1, 7, 1, 17, 0})
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		h := makeNASHarness(t)
+		for i := 0; i+1 < len(ops); i += 2 {
+			if op := ops[i]; op >= 10 && op < 20 {
+				if ac := h.flight(ops[i+1]); ac != nil {
+					h.deleteAircraft(ac)
+				}
+			} else {
+				h.step(op, ops[i+1])
+			}
+			h.process()
+			h.checkPlans()
+			h.checkFlights()
+			if t.Failed() {
+				t.Fatalf("after operation %d (%d, %d)", i/2, ops[i], ops[i+1])
+			}
+		}
+
+		h.deleteAll()
+		h.checkEmpty()
+	})
+}
+
+// FuzzNASMessages sends arbitrary well-formed messages for a handful of
+// flights to arbitrary facilities. There's no guarantee that the
+// computers' state is sensible afterward, but they shouldn't crash,
+// should handle all of their messages, and shouldn't leak codes.
+func FuzzNASMessages(f *testing.F) {
+	f.Add([]byte{1, 0, 0, 0, 0, 0, 2, 1, 1, 2, 1, 0})
+	f.Add([]byte{7, 1, 2, 0, 3, 1, 8, 2, 2, 1, 0, 3, 4, 3, 3, 0, 0, 0})
+	f.Add([]byte{1, 3, 1, 4, 0, 0, 4, 2, 3, 2, 2, 0, 5, 3, 0, 0, 1, 0})
+
+	facilities := []string{"ZNY", "ZDC", "N90", "PCT"}
+	owners := []string{"", "1A", "1B", "P2A", "P2B"}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h := makeNASHarness(t)
+		for i := range 4 {
+			h.addDeparture(byte(i))
+		}
+		h.process()
+
+		// Each message takes six bytes: type, flight, destination and
+		// source, coordination fix, owners, and beacon code variations.
+		for ; len(data) >= 6; data = data[6:] {
+			ac := h.flight(data[1])
+			msg := FlightPlanMessage{
+				MessageType:     Plan + int(data[0])%(AcceptRecallTransfer-Plan+1),
+				SourceID:        formatSourceID(facilities[int(data[2]/4)%len(facilities)], h.now),
+				FlightID:        "XXX" + ac.Callsign,
+				BCN:             ac.Squawk,
+				CoordinationFix: nasTestFixes[int(data[3])%len(nasTestFixes)],
+				Altitude:        av.MakeSTARSFlightPlan(ac.FlightPlan).Altitude,
+				Route:           ac.FlightPlan.Route,
+				AircraftData: AircraftDataMessage{
+					DepartureLocation: ac.FlightPlan.DepartureAirport,
+					ArrivalLocation:   ac.FlightPlan.ArrivalAirport,
+					AircraftType:      ac.FlightPlan.TypeWithoutSuffix(),
+				},
+				TrackInformation: TrackInformation{
+					Identifier:        h.flight(data[1] + data[5]/8).Callsign,
+					TrackOwner:        owners[int(data[4])%len(owners)],
+					HandoffController: owners[int(data[4]/8)%len(owners)],
+				},
+			}
+			switch data[5] % 4 {
+			case 1:
+				// This used to lead to a panic.
+				msg.BCN = 0
+			case 2:
+				msg.PreviousBCN = h.flight(data[1] + 1).Squawk
+			}
+
+			h.deliver(facilities[int(data[2])%len(facilities)], msg)
+			h.process()
+			h.checkPlans()
+
+			h.checkSquawks()
+			if t.Failed() {
+				t.FailNow()
+			}
+		}
+
+		h.deleteAll()
+		h.checkEmpty()
+	})
+}
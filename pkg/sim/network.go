@@ -0,0 +1,207 @@
+// pkg/sim/network.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/fsd"
+)
+
+// A sim may be connected to an FSD network (e.g., VATSIM) as a controller
+// client. Aircraft on the network are then added to the sim along with
+// the ones it generates; their positions come from the network rather
+// than being simulated, their filed flight plans go to the ERAM computer,
+// and handoffs of them to and from controllers on the network are sent as
+// network handoff messages. Controllers on the network are matched to
+// the scenario's control positions by their callsigns.
+
+const networkRetryInterval = 30 * time.Second
+
+func (s *Sim) updateNetwork() {
+	if s.NetworkConfig == nil {
+		return
+	}
+
+	if s.network != nil {
+		if err := s.network.Err(); err != nil {
+			s.eventStream.Post(Event{
+				Type:    StatusMessageEvent,
+				Message: "Network connection lost: " + err.Error(),
+			})
+			s.network = nil
+		}
+	}
+	if s.network == nil {
+		if now := time.Now(); now.After(s.networkRetry) {
+			s.network = fsd.Connect(*s.NetworkConfig, nil, s.lg)
+			s.networkRetry = now.Add(networkRetryInterval)
+		}
+		return
+	}
+	if !s.network.Connected() {
+		return
+	}
+
+	s.updateNetworkTraffic()
+	s.updateNetworkHandoffs()
+
+	for _, m := range s.network.Messages() {
+		s.eventStream.Post(Event{
+			Type:    ServerBroadcastMessageEvent,
+			Message: m.From + ": " + m.Text,
+		})
+	}
+}
+
+// initializeNetwork fills in defaults for the network connection from the
+// scenario.
+func (s *Sim) initializeNetwork(config *fsd.Config) {
+	cfg := *config
+	if ctrl, ok := s.SignOnPositions[s.State.PrimaryController]; ok {
+		if cfg.Callsign == "" {
+			cfg.Callsign = ctrl.Position
+		}
+		if cfg.Frequency == 0 {
+			cfg.Frequency = ctrl.Frequency
+		}
+	}
+	if cfg.Location.IsZero() {
+		cfg.Location = s.State.Center
+	}
+	if cfg.VisibilityRange == 0 {
+		cfg.VisibilityRange = int(s.State.Range)
+	}
+	if cfg.Facility == 0 {
+		cfg.Facility = fsd.FacilityApproach
+	}
+	s.NetworkConfig = &cfg
+}
+
+// Disconnect ends the sim's network connection, ADS-B feed, and link to a
+// federated sim and stops exporting flight data.
+func (s *Sim) Disconnect() {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if s.network != nil {
+		s.network.Close()
+		s.network = nil
+	}
+	if s.adsbFeed != nil {
+		s.adsbFeed.Close()
+		s.adsbFeed = nil
+	}
+	if s.federation != nil {
+		s.federation.Close()
+		s.federation = nil
+	}
+	s.closeExport()
+	s.closeStream()
+}
+
+func (s *Sim) isNetworkAircraft(callsign string) bool {
+	return s.NetworkAircraft[callsign]
+}
+
+func (s *Sim) updateNetworkTraffic() {
+	if s.NetworkAircraft == nil {
+		s.NetworkAircraft = make(map[string]bool)
+	}
+
+	var tracks []externalTrack
+	for _, pilot := range s.network.Pilots() {
+		if pilot.Position.IsZero() {
+			// Only the flight plan has arrived so far.
+			continue
+		}
+		tracks = append(tracks, externalTrack{
+			Callsign:   pilot.Callsign,
+			Squawk:     pilot.Squawk,
+			Mode:       pilot.Mode,
+			Position:   pilot.Position,
+			Altitude:   pilot.Altitude,
+			GS:         pilot.GS,
+			Heading:    pilot.Heading,
+			FlightPlan: pilot.FlightPlan,
+		})
+	}
+	s.syncExternalTraffic(tracks, s.NetworkAircraft)
+}
+
+// networkController returns the TCP of the control position with the given
+// network callsign.
+func (s *Sim) networkController(callsign string) (string, bool) {
+	for tcp, ctrl := range s.State.Controllers {
+		if ctrl.Position == callsign {
+			return tcp, true
+		}
+	}
+	return "", false
+}
+
+func (s *Sim) updateNetworkHandoffs() {
+	for _, h := range s.network.Handoffs() {
+		ac, ok := s.State.Aircraft[h.Callsign]
+		if !ok || !s.NetworkAircraft[h.Callsign] {
+			continue
+		}
+		from, ok := s.networkController(h.From)
+		if !ok {
+			s.lg.Warnf("%s: handoff from unknown network controller %q", h.Callsign, h.From)
+			continue
+		}
+
+		if h.Accepted {
+			if ac.HandoffTrackController != from {
+				continue
+			}
+			s.eventStream.Post(Event{
+				Type:           AcceptedHandoffEvent,
+				FromController: ac.TrackingController,
+				ToController:   from,
+				Callsign:       ac.Callsign,
+			})
+			ac.TrackingController = from
+			ac.HandoffTrackController = ""
+		} else {
+			ac.TrackingController = from
+			ac.HandoffTrackController = s.State.PrimaryController
+			s.eventStream.Post(Event{
+				Type:           OfferedHandoffEvent,
+				FromController: from,
+				ToController:   s.State.PrimaryController,
+				Callsign:       ac.Callsign,
+			})
+		}
+	}
+}
+
+// offerNetworkHandoff sends a handoff of a network aircraft to the
+// receiving controller on the network.
+func (s *Sim) offerNetworkHandoff(callsign, toTCP string) {
+	if s.network == nil {
+		return
+	}
+	if to, ok := s.State.Controllers[toTCP]; ok {
+		if err := s.network.OfferHandoff(callsign, to.Position); err != nil {
+			s.lg.Warnf("%s: network handoff: %v", callsign, err)
+		}
+	}
+}
+
+// acceptNetworkHandoff lets the offering controller on the network know
+// that we have accepted the handoff.
+func (s *Sim) acceptNetworkHandoff(ac *av.Aircraft) {
+	if s.network == nil {
+		return
+	}
+	if from, ok := s.State.Controllers[ac.TrackingController]; ok {
+		if err := s.network.AcceptHandoff(ac.Callsign, from.Position); err != nil {
+			s.lg.Warnf("%s: network handoff accept: %v", ac.Callsign, err)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+// pkg/sim/notam.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// NOTAMs close runways and taxiways and take navaids and approaches out
+// of service. They may be given in the scenario file or issued by a
+// controller while the sim is running. While a NOTAM is in effect:
+//
+//   - Nothing departs a closed runway: it's removed from the launch
+//     configuration, and its departure rates are restored when the NOTAM
+//     is cancelled.
+//   - Departures taxi around closed taxiways if there's another way to the
+//     runway.
+//   - Pilots are unable to fly approaches to closed runways, approaches
+//     that are themselves unavailable, and approaches that include a navaid
+//     that's out of service; those that were expecting one say so.
+//   - The NOTAM is included in the airport's ATIS.
+
+type NOTAMType string
+
+const (
+	NOTAMRunwayClosed        NOTAMType = "runway_closed"
+	NOTAMTaxiwayClosed       NOTAMType = "taxiway_closed"
+	NOTAMNavaidOutOfService  NOTAMType = "navaid_out_of_service"
+	NOTAMApproachUnavailable NOTAMType = "approach_unavailable"
+)
+
+var NOTAMTypes = []NOTAMType{NOTAMRunwayClosed, NOTAMTaxiwayClosed, NOTAMNavaidOutOfService,
+	NOTAMApproachUnavailable}
+
+type NOTAM struct {
+	Id      int       `json:"-"`
+	Type    NOTAMType `json:"type"`
+	Airport string    `json:"airport"`
+	// Subject is the runway, taxiway, navaid, or approach (as it's named
+	// in the airport's "approaches") that the NOTAM is for. Closing a
+	// runway closes both of its ends.
+	Subject string `json:"subject"`
+	Remarks string `json:"remarks,omitempty"`
+}
+
+// Validate checks that the NOTAM is well-formed; it doesn't check that
+// its airport and subject exist.
+func (n NOTAM) Validate() error {
+	if !slices.Contains(NOTAMTypes, n.Type) {
+		return fmt.Errorf("%q: unknown NOTAM type", n.Type)
+	}
+	if n.Airport == "" && n.Type != NOTAMNavaidOutOfService {
+		return fmt.Errorf("%s: must specify \"airport\"", n.Type)
+	}
+	if n.Subject == "" {
+		return fmt.Errorf("%s: must specify \"subject\"", n.Type)
+	}
+	return nil
+}
+
+// String returns the NOTAM as it's given in the ATIS.
+func (n NOTAM) String() string {
+	var s string
+	switch n.Type {
+	case NOTAMRunwayClosed:
+		s = "Runway " + n.Subject + " closed"
+	case NOTAMTaxiwayClosed:
+		s = "Taxiway " + n.Subject + " closed"
+	case NOTAMNavaidOutOfService:
+		s = n.Subject + " out of service"
+	case NOTAMApproachUnavailable:
+		s = n.Subject + " approach not available"
+	default:
+		s = n.Subject
+	}
+	if n.Remarks != "" {
+		s += ", " + n.Remarks
+	}
+	return s
+}
+
+// ClosesRunway returns whether the NOTAM closes the runway or its
+// opposite end.
+func (n NOTAM) ClosesRunway(airport, rwy string) bool {
+	if n.Type != NOTAMRunwayClosed || n.Airport != airport {
+		return false
+	}
+	rwy = av.TidyRunway(rwy)
+	if n.Subject == rwy {
+		return true
+	}
+	opp, ok := av.LookupOppositeRunway(airport, n.Subject)
+	return ok && opp.Id == rwy
+}
+
+// RunwayClosed returns whether the runway, or its opposite end, is closed
+// by a NOTAM.
+func (ss *State) RunwayClosed(airport, rwy string) bool {
+	return slices.ContainsFunc(ss.NOTAMs, func(n NOTAM) bool { return n.ClosesRunway(airport, rwy) })
+}
+
+// ClosedTaxiways returns the taxiways at the airport that are closed.
+func (ss *State) ClosedTaxiways(airport string) []string {
+	var tw []string
+	for _, n := range ss.NOTAMs {
+		if n.Type == NOTAMTaxiwayClosed && n.Airport == airport {
+			tw = append(tw, n.Subject)
+		}
+	}
+	return tw
+}
+
+// approachAffected returns whether the NOTAM makes the given approach to
+// the airport unavailable.
+func (ss *State) approachAffected(n NOTAM, airport, id string) bool {
+	if n.Type == NOTAMApproachUnavailable {
+		return n.Airport == airport && n.Subject == id
+	}
+
+	ap, ok := ss.Airports[airport]
+	if !ok || ap.Approaches[id] == nil {
+		return false
+	}
+	appr := ap.Approaches[id]
+
+	switch n.Type {
+	case NOTAMRunwayClosed:
+		return n.ClosesRunway(airport, appr.Runway)
+	case NOTAMNavaidOutOfService:
+		return slices.ContainsFunc(appr.Waypoints, func(wps av.WaypointArray) bool {
+			return slices.ContainsFunc(wps, func(wp av.Waypoint) bool { return wp.Fix == n.Subject })
+		})
+	default:
+		return false
+	}
+}
+
+// ApproachNOTAM returns the NOTAM that makes the approach unavailable, if
+// there is one.
+func (ss *State) ApproachNOTAM(airport, id string) (NOTAM, bool) {
+	for _, n := range ss.NOTAMs {
+		if ss.approachAffected(n, airport, id) {
+			return n, true
+		}
+	}
+	return NOTAM{}, false
+}
+
+// AirportNOTAMs returns the NOTAMs that are in effect for the airport.
+func (ss *State) AirportNOTAMs(airport string) []NOTAM {
+	return util.FilterSlice(ss.NOTAMs, func(n NOTAM) bool { return n.Airport == airport })
+}
+
+// AddNOTAM issues a new NOTAM.
+func (s *Sim) AddNOTAM(tcp string, n NOTAM) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.isActiveHumanController(tcp) {
+		return av.ErrNoController
+	}
+	if err := s.checkNOTAM(n); err != nil {
+		return err
+	}
+
+	s.addNOTAM(n)
+	s.lg.Info("NOTAM issued", slog.String("tcp", tcp), slog.Any("notam", n))
+
+	return nil
+}
+
+// checkNOTAM returns an error if the NOTAM's airport or subject doesn't
+// exist.
+func (s *Sim) checkNOTAM(n NOTAM) error {
+	if err := n.Validate(); err != nil {
+		return ErrInvalidNOTAM
+	}
+
+	ap, ok := s.State.Airports[n.Airport]
+	if !ok && n.Airport != "" {
+		return av.ErrUnknownAirport
+	}
+
+	switch n.Type {
+	case NOTAMRunwayClosed:
+		if _, ok := av.LookupRunway(n.Airport, n.Subject); !ok {
+			return av.ErrUnknownRunway
+		}
+	case NOTAMNavaidOutOfService:
+		if _, ok := av.DB.Navaids()[n.Subject]; !ok {
+			return av.ErrNoMatchingFix
+		}
+	case NOTAMApproachUnavailable:
+		if _, ok := ap.Approaches[n.Subject]; !ok {
+			return av.ErrUnknownApproach
+		}
+	}
+	return nil
+}
+
+func (s *Sim) addNOTAM(n NOTAM) {
+	n.Id = 1
+	for _, prev := range s.State.NOTAMs {
+		n.Id = max(n.Id, prev.Id+1)
+	}
+	s.State.NOTAMs = append(s.State.NOTAMs, n)
+
+	if n.Type == NOTAMRunwayClosed {
+		s.closeDepartureRunway(n)
+	}
+	s.notifyUnavailableApproach(n)
+
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: fmt.Sprintf("NOTAM %d: %s %s", n.Id, util.Select(n.Airport != "", n.Airport, "--"), n),
+	})
+}
+
+// CancelNOTAM cancels the NOTAM with the given id.
+func (s *Sim) CancelNOTAM(tcp string, id int) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.isActiveHumanController(tcp) {
+		return av.ErrNoController
+	}
+	idx := slices.IndexFunc(s.State.NOTAMs, func(n NOTAM) bool { return n.Id == id })
+	if idx == -1 {
+		return ErrUnknownNOTAM
+	}
+
+	n := s.State.NOTAMs[idx]
+	s.State.NOTAMs = slices.Delete(s.State.NOTAMs, idx, idx+1)
+	if n.Type == NOTAMRunwayClosed {
+		s.reopenDepartureRunway(n)
+	}
+
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: fmt.Sprintf("NOTAM %d cancelled: %s", n.Id, n),
+	})
+	s.lg.Info("NOTAM cancelled", slog.String("tcp", tcp), slog.Any("notam", n))
+
+	return nil
+}
+
+// closeDepartureRunway removes the departure rates for the runway closed
+// by the NOTAM from the launch configuration, saving them so that they
+// can be restored when the NOTAM is cancelled; departures that are
+// waiting for the runway are culled.
+func (s *Sim) closeDepartureRunway(n NOTAM) {
+	rates := s.State.LaunchConfig.DepartureRates[n.Airport]
+	for _, rwy := range util.SortedMapKeys(rates) {
+		if !s.State.RunwayClosed(n.Airport, rwy) {
+			continue
+		}
+
+		if s.closedRunwayRates == nil {
+			s.closedRunwayRates = make(map[int]map[string]map[string]float32)
+		}
+		if s.closedRunwayRates[n.Id] == nil {
+			s.closedRunwayRates[n.Id] = make(map[string]map[string]float32)
+		}
+		s.closedRunwayRates[n.Id][rwy] = rates[rwy]
+		delete(rates, rwy)
+
+		if depState, ok := s.DepartureState[n.Airport][rwy]; ok {
+			depState.setIFRRate(s, 0)
+		}
+	}
+}
+
+func (s *Sim) reopenDepartureRunway(n NOTAM) {
+	rates := s.closedRunwayRates[n.Id]
+	delete(s.closedRunwayRates, n.Id)
+	if rates == nil {
+		// The runway was already closed when the sim started, so use the
+		// scenario's default rates.
+		rates = make(map[string]map[string]float32)
+		for _, rwy := range s.State.DepartureRunways {
+			if n.ClosesRunway(rwy.Airport, rwy.Runway) {
+				if rates[rwy.Runway] == nil {
+					rates[rwy.Runway] = make(map[string]float32)
+				}
+				rates[rwy.Runway][rwy.Category] = float32(rwy.DefaultRate)
+			}
+		}
+	}
+
+	for _, rwy := range util.SortedMapKeys(rates) {
+		categoryRates := rates[rwy]
+		if s.State.RunwayClosed(n.Airport, rwy) {
+			// Still closed by another NOTAM; hand the rates over to it.
+			for _, other := range s.State.NOTAMs {
+				if other.ClosesRunway(n.Airport, rwy) {
+					if s.closedRunwayRates == nil {
+						s.closedRunwayRates = make(map[int]map[string]map[string]float32)
+					}
+					if s.closedRunwayRates[other.Id] == nil {
+						s.closedRunwayRates[other.Id] = make(map[string]map[string]float32)
+					}
+					s.closedRunwayRates[other.Id][rwy] = categoryRates
+					break
+				}
+			}
+			continue
+		}
+
+		if s.State.LaunchConfig.DepartureRates[n.Airport] == nil {
+			s.State.LaunchConfig.DepartureRates[n.Airport] = make(map[string]map[string]float32)
+		}
+		s.State.LaunchConfig.DepartureRates[n.Airport][rwy] = categoryRates
+
+		if runways, ok := s.DepartureState[n.Airport]; ok {
+			// The runway may have been closed from the start, in which
+			// case it doesn't have launch state yet.
+			if _, ok := runways[rwy]; !ok {
+				runways[rwy] = &RunwayLaunchState{}
+			}
+			runways[rwy].setIFRRate(s, sumRateMap(categoryRates, s.State.LaunchConfig.DepartureRateScale))
+		}
+	}
+}
+
+// notifyUnavailableApproach has arrivals that are expecting an approach
+// that the NOTAM makes unavailable let their controller know.
+func (s *Sim) notifyUnavailableApproach(n NOTAM) {
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		appr := ac.Nav.Approach.Assigned
+		if appr == nil || ac.Nav.Approach.Cleared || ac.FlightPlan == nil || ac.ControllingController == "" {
+			continue
+		}
+		if !s.State.approachAffected(n, ac.FlightPlan.ArrivalAirport, ac.Nav.Approach.AssignedId) {
+			continue
+		}
+
+		s.postRadioEvents(callsign, []av.RadioTransmission{av.RadioTransmission{
+			Controller: ac.ControllingController,
+			Message:    "we're showing the " + appr.FullName + " isn't available, we'll need a different approach",
+			Type:       av.RadioTransmissionUnexpected,
+		}})
+	}
+}
+
+// unavailableApproach returns the pilot's response if the approach can't
+// be flown due to a NOTAM or, for charted visual approaches, the time of
+// day or the weather; it returns nil otherwise.
+func (s *Sim) unavailableApproach(tcp string, ac *av.Aircraft, id string) []av.RadioTransmission {
+	if ac.FlightPlan == nil {
+		return nil
+	}
+	airport := ac.FlightPlan.ArrivalAirport
+	var appr *av.Approach
+	if ap, ok := s.State.Airports[airport]; ok {
+		appr = ap.Approaches[id]
+	}
+
+	var reason string
+	if n, ok := s.State.ApproachNOTAM(airport, id); ok {
+		reason = strings.ToLower(n.String())
+	} else if appr != nil {
+		loc, _ := s.State.Locate(airport)
+		reason = appr.VisualUnavailable(isDaytime(s.State.SimTime, loc), s.State.METAR[airport])
+	}
+	if reason == "" {
+		return nil
+	}
+
+	name := id
+	if appr != nil {
+		name = appr.FullName
+	}
+	return []av.RadioTransmission{av.RadioTransmission{
+		Controller: tcp,
+		Message:    "unable, the " + name + " isn't available: " + reason,
+		Type:       av.RadioTransmissionUnexpected,
+	}}
+}
@@ -0,0 +1,204 @@
+// pkg/sim/notam_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+// makeNOTAMTestSim returns a sim departing KJFK 31L and 4L and landing
+// 4R, with an ILS to 4R via ROSLY and an RNAV to 22L.
+func makeNOTAMTestSim(t *testing.T) *Sim {
+	s := newTestSim(t, &State{
+		Aircraft: make(map[string]*av.Aircraft),
+		Airports: map[string]*av.Airport{
+			"KJFK": {Approaches: map[string]*av.Approach{
+				"I4R":  {FullName: "ILS Runway 4R", Runway: "4R", Waypoints: []av.WaypointArray{{{Fix: "ROSLY"}, {Fix: "ZALPO"}}}},
+				"R22L": {FullName: "RNAV Runway 22L", Runway: "22L", Waypoints: []av.WaypointArray{{{Fix: "ENEEE"}}}},
+			}},
+		},
+		DepartureRunways: []DepartureRunway{
+			{Airport: "KJFK", Runway: "31L", Category: "North", DefaultRate: 20},
+			{Airport: "KJFK", Runway: "4L", DefaultRate: 30},
+		},
+		ArrivalRunways: []ArrivalRunway{{Airport: "KJFK", Runway: "4R"}},
+		LaunchConfig: LaunchConfig{
+			DepartureRates: map[string]map[string]map[string]float32{
+				"KJFK": {"31L": {"North": 10, "South": 5}, "4L": {"": 25}},
+			},
+			DepartureRateScale: 1,
+		},
+		SimTime: testSimTime,
+	})
+	s.DepartureState = map[string]map[string]*RunwayLaunchState{
+		"KJFK": {"31L": {IFRSpawnRate: 15}, "4L": {IFRSpawnRate: 25}},
+	}
+	s.humanControllers = map[string]*EventsSubscription{"2K": nil}
+	return s
+}
+
+func TestNOTAMValidate(t *testing.T) {
+	for _, test := range []struct {
+		notam    NOTAM
+		valid    bool
+		expected string
+	}{
+		{NOTAM{Type: NOTAMRunwayClosed, Airport: "KJFK", Subject: "4L"}, true, "Runway 4L closed"},
+		{NOTAM{Type: NOTAMTaxiwayClosed, Airport: "KJFK", Subject: "B", Remarks: "construction"}, true,
+			"Taxiway B closed, construction"},
+		{NOTAM{Type: NOTAMNavaidOutOfService, Subject: "CRI"}, true, "CRI out of service"},
+		{NOTAM{Type: NOTAMApproachUnavailable, Airport: "KJFK", Subject: "I4R"}, true, "I4R approach not available"},
+		{NOTAM{Type: "runway_flooded", Airport: "KJFK", Subject: "4L"}, false, ""},
+		{NOTAM{Type: NOTAMRunwayClosed, Subject: "4L"}, false, ""},
+		{NOTAM{Type: NOTAMTaxiwayClosed, Airport: "KJFK"}, false, ""},
+	} {
+		if err := test.notam.Validate(); (err == nil) != test.valid {
+			t.Errorf("%+v: got error %v, expected valid %v", test.notam, err, test.valid)
+		}
+		if test.valid && test.notam.String() != test.expected {
+			t.Errorf("%+v: got %q, expected %q", test.notam, test.notam.String(), test.expected)
+		}
+	}
+}
+
+func TestNOTAMRunwaysAndApproaches(t *testing.T) {
+	ss := makeNOTAMTestSim(t).State
+	ss.NOTAMs = []NOTAM{
+		{Type: NOTAMRunwayClosed, Airport: "KJFK", Subject: "4L"},
+		{Type: NOTAMTaxiwayClosed, Airport: "KJFK", Subject: "B"},
+		{Type: NOTAMTaxiwayClosed, Airport: "KLGA", Subject: "A"},
+	}
+
+	// Closing a runway closes both ends.
+	for rwy, closed := range map[string]bool{"4L": true, "22R": true, "4R": false, "31L": false} {
+		if c := ss.RunwayClosed("KJFK", rwy); c != closed {
+			t.Errorf("%s: got closed %v, expected %v", rwy, c, closed)
+		}
+	}
+	if ss.RunwayClosed("KLGA", "4") {
+		t.Errorf("KLGA 4 closed by a KJFK NOTAM")
+	}
+	if tw := ss.ClosedTaxiways("KJFK"); !slices.Equal(tw, []string{"B"}) {
+		t.Errorf("got closed taxiways %v, expected [B]", tw)
+	}
+	if n := ss.AirportNOTAMs("KJFK"); len(n) != 2 {
+		t.Errorf("got KJFK NOTAMs %+v, expected 2", n)
+	}
+
+	for _, test := range []struct {
+		notam       NOTAM
+		unavailable []string
+	}{
+		{NOTAM{Type: NOTAMRunwayClosed, Airport: "KJFK", Subject: "22L"}, []string{"R22L", "I4R"}},
+		{NOTAM{Type: NOTAMRunwayClosed, Airport: "KJFK", Subject: "4L"}, nil},
+		{NOTAM{Type: NOTAMNavaidOutOfService, Subject: "ROSLY"}, []string{"I4R"}},
+		{NOTAM{Type: NOTAMNavaidOutOfService, Subject: "CRI"}, nil},
+		{NOTAM{Type: NOTAMApproachUnavailable, Airport: "KJFK", Subject: "R22L"}, []string{"R22L"}},
+		{NOTAM{Type: NOTAMApproachUnavailable, Airport: "KLGA", Subject: "R22L"}, nil},
+	} {
+		ss.NOTAMs = []NOTAM{test.notam}
+		for _, id := range []string{"I4R", "R22L"} {
+			n, ok := ss.ApproachNOTAM("KJFK", id)
+			if ok != slices.Contains(test.unavailable, id) {
+				t.Errorf("%+v: %s: got unavailable %v", test.notam, id, ok)
+			} else if ok && n != test.notam {
+				t.Errorf("%+v: %s: got NOTAM %+v", test.notam, id, n)
+			}
+		}
+	}
+}
+
+func TestNOTAMDepartureRates(t *testing.T) {
+	s := makeNOTAMTestSim(t)
+	rates := func() map[string]map[string]float32 { return s.State.LaunchConfig.DepartureRates["KJFK"] }
+	orig := maps.Clone(rates())
+
+	s.addNOTAM(NOTAM{Type: NOTAMRunwayClosed, Airport: "KJFK", Subject: "31L"})
+	s.addNOTAM(NOTAM{Type: NOTAMRunwayClosed, Airport: "KJFK", Subject: "13R"})
+	if ids := []int{s.State.NOTAMs[0].Id, s.State.NOTAMs[1].Id}; ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("got NOTAM ids %v, expected [1 2]", ids)
+	}
+	if _, ok := rates()["31L"]; ok {
+		t.Errorf("31L still has departure rates after it was closed")
+	}
+	if r := s.DepartureState["KJFK"]["31L"].IFRSpawnRate; r != 0 {
+		t.Errorf("31L IFR rate %f, expected 0", r)
+	}
+	if r := s.DepartureState["KJFK"]["4L"].IFRSpawnRate; r != 25 {
+		t.Errorf("4L IFR rate %f, expected 25", r)
+	}
+
+	// 31L is still closed by the NOTAM for 13R after the first one is
+	// cancelled.
+	if err := s.CancelNOTAM("2K", 1); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, ok := rates()["31L"]; ok {
+		t.Errorf("31L has departure rates while still closed")
+	}
+
+	if err := s.CancelNOTAM("2K", 2); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !maps.EqualFunc(rates(), orig, maps.Equal) {
+		t.Errorf("got rates %v after reopening, expected %v", rates(), orig)
+	}
+	if r := s.DepartureState["KJFK"]["31L"].IFRSpawnRate; r != 15 {
+		t.Errorf("31L IFR rate %f after reopening, expected 15", r)
+	}
+
+	if err := s.CancelNOTAM("2K", 2); err != ErrUnknownNOTAM {
+		t.Errorf("got %v cancelling a cancelled NOTAM, expected %v", err, ErrUnknownNOTAM)
+	}
+	if err := s.CancelNOTAM("N56", 1); err != av.ErrNoController {
+		t.Errorf("got %v from a controller that isn't signed in, expected %v", err, av.ErrNoController)
+	}
+}
+
+func TestNOTAMClosedAtStart(t *testing.T) {
+	// When a runway is closed from the start, reopening it uses the
+	// scenario's default rates.
+	s := makeNOTAMTestSim(t)
+	delete(s.State.LaunchConfig.DepartureRates["KJFK"], "4L")
+	delete(s.DepartureState["KJFK"], "4L")
+	s.State.NOTAMs = []NOTAM{{Id: 1, Type: NOTAMRunwayClosed, Airport: "KJFK", Subject: "4L"}}
+
+	if err := s.CancelNOTAM("2K", 1); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if r := s.State.LaunchConfig.DepartureRates["KJFK"]["4L"]; !maps.Equal(r, map[string]float32{"": 30}) {
+		t.Errorf("got 4L rates %v, expected the default 30", r)
+	}
+	if d, ok := s.DepartureState["KJFK"]["4L"]; !ok || d.IFRSpawnRate != 30 {
+		t.Errorf("got 4L launch state %+v, expected a rate of 30", d)
+	}
+}
+
+func TestNOTAMATISAndApproaches(t *testing.T) {
+	s := makeNOTAMTestSim(t)
+	s.addNOTAM(NOTAM{Type: NOTAMRunwayClosed, Airport: "KJFK", Subject: "31L"})
+	s.addNOTAM(NOTAM{Type: NOTAMNavaidOutOfService, Subject: "ROSLY"})
+
+	atis := s.composeATIS("KJFK", nil)
+	if atis.Runways != "Landing runway 4R, departing runway 4L" {
+		t.Errorf("got runways %q", atis.Runways)
+	}
+	if !slices.Equal(atis.Closures, []string{"Runway 31L closed"}) {
+		t.Errorf("got closures %v", atis.Closures)
+	}
+
+	ac := &av.Aircraft{Callsign: "AAL1", FlightPlan: &av.FlightPlan{ArrivalAirport: "KJFK"}}
+	if rt := s.unavailableApproach("2K", ac, "I4R"); len(rt) != 1 ||
+		rt[0].Message != "unable, the ILS Runway 4R isn't available: rosly out of service" {
+		t.Errorf("got %+v for the ILS", rt)
+	}
+	if rt := s.unavailableApproach("2K", ac, "R22L"); rt != nil {
+		t.Errorf("got %+v for the RNAV, expected it to be available", rt)
+	}
+}
@@ -0,0 +1,33 @@
+// pkg/sim/phraseology.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"log/slog"
+)
+
+// Clearances that controllers give in words, by voice or typed out, are
+// converted to commands by the client, which also checks them against
+// standard phraseology (see speech/phraseology.go). Any deviations it
+// finds are sent along with the commands and posted as
+// PhraseologyEvents, which the "phraseology" scoring rubric counts.
+
+// ReportPhraseology records the deviations from standard phraseology in
+// a clearance that the given controller issued to the aircraft.
+func (s *Sim) ReportPhraseology(tcp, callsign string, nonstandard []string) {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	for _, msg := range nonstandard {
+		s.lg.Info("nonstandard phraseology", slog.String("tcp", tcp), slog.String("callsign", callsign),
+			slog.String("message", msg))
+		s.eventStream.Post(Event{
+			Type:           PhraseologyEvent,
+			Callsign:       callsign,
+			FromController: tcp,
+			Message:        msg,
+		})
+	}
+}
@@ -0,0 +1,395 @@
+// pkg/sim/piloterror.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Pilots can be made to occasionally make mistakes: reading back the wrong
+// altitude or heading (and then flying it), busting an assigned altitude,
+// missing a frequency change, turning the wrong way, or dialing in the
+// wrong beacon code. Each injected
+// error is marked by a PilotErrorEvent; a PilotErrorResolvedEvent follows
+// once the controller catches it--by issuing another instruction of the
+// same sort to the aircraft--or once it's too late to do so. An aircraft
+// has at most one outstanding error at a time so that the two events can
+// be paired by callsign.
+
+type PilotErrorKind string
+
+const (
+	PilotErrorReadback              PilotErrorKind = "readback"
+	PilotErrorLevelBust             PilotErrorKind = "level_bust"
+	PilotErrorMissedFrequencyChange PilotErrorKind = "missed_frequency_change"
+	PilotErrorWrongTurn             PilotErrorKind = "wrong_turn"
+	PilotErrorWrongCode             PilotErrorKind = "wrong_code"
+)
+
+var PilotErrorKinds = []PilotErrorKind{PilotErrorReadback, PilotErrorLevelBust,
+	PilotErrorMissedFrequencyChange, PilotErrorWrongTurn, PilotErrorWrongCode}
+
+// PilotErrorConfig specifies how often pilots make mistakes and how bad
+// they are.
+type PilotErrorConfig struct {
+	// Rate is the probability that an instruction that is susceptible to
+	// an error is botched.
+	Rate float32 `json:"rate"`
+	// Severity, in [0,1], sets how far off wrong values are: from 1,000'
+	// to 2,000' for altitudes, 10 to 30 degrees for headings, and
+	// 300' to 1,000' for level busts.
+	Severity float32 `json:"severity"`
+	// Kinds limits the errors that are made; all are possible if it is
+	// empty.
+	Kinds []PilotErrorKind `json:"kinds,omitempty"`
+	// CorrectionSeconds is how long the controller has to catch an
+	// error; pilotErrorWindow is used if it is 0.
+	CorrectionSeconds int `json:"correction_seconds,omitempty"`
+}
+
+func (c PilotErrorConfig) Validate() error {
+	if c.Rate < 0 || c.Rate > 1 {
+		return fmt.Errorf("%.2f: pilot error rate must be between 0 and 1", c.Rate)
+	}
+	if c.Severity < 0 || c.Severity > 1 {
+		return fmt.Errorf("%.2f: pilot error severity must be between 0 and 1", c.Severity)
+	}
+	if c.CorrectionSeconds < 0 {
+		return fmt.Errorf("%d: correction time must not be negative", c.CorrectionSeconds)
+	}
+	for _, k := range c.Kinds {
+		if !slices.Contains(PilotErrorKinds, k) {
+			return fmt.Errorf("%q: unknown pilot error kind", k)
+		}
+	}
+	return nil
+}
+
+// PilotError records an error that is waiting to be caught.
+type PilotError struct {
+	Kind        PilotErrorKind
+	Callsign    string
+	Controller  string
+	Instruction string // "altitude", "heading", "frequency", or "squawk": what corrects it
+	Description string
+	Deadline    time.Time
+
+	// For level busts, the assigned altitude and the altitude that the
+	// aircraft is actually flying to.
+	Altitude, BustAltitude int
+}
+
+// pilotErrorWindow is how long the controller has to catch an error by
+// default.
+const pilotErrorWindow = 60 * time.Second
+
+// pickPilotError randomly decides whether a pilot should botch an
+// instruction from the given controller that is susceptible to the given
+// kinds of error. It returns the kind of error to make, if any.
+func (s *Sim) pickPilotError(tcp string, ac *av.Aircraft, kinds ...PilotErrorKind) (PilotErrorKind, bool) {
+	cfg := s.State.LaunchConfig.PilotErrors
+	if cfg.Rate == 0 || s.PseudoPilots[tcp] || s.PseudoPilotAircraft[ac.Callsign] != "" ||
+		s.isExternalAircraft(ac.Callsign) {
+		return "", false
+	}
+	if _, ok := s.humanControllers[tcp]; !ok {
+		return "", false
+	}
+	if slices.ContainsFunc(s.PilotErrors, func(pe PilotError) bool { return pe.Callsign == ac.Callsign }) {
+		return "", false
+	}
+
+	kinds = slices.DeleteFunc(kinds, func(k PilotErrorKind) bool {
+		return len(cfg.Kinds) > 0 && !slices.Contains(cfg.Kinds, k)
+	})
+	if len(kinds) == 0 || s.Rand.Float32() >= cfg.Rate {
+		return "", false
+	}
+	return kinds[s.Rand.Intn(len(kinds))], true
+}
+
+func (s *Sim) severity() float32 {
+	return math.Clamp(s.State.LaunchConfig.PilotErrors.Severity, 0, 1)
+}
+
+// injectPilotError records the error and posts the corresponding event.
+func (s *Sim) injectPilotError(pe PilotError) {
+	window := pilotErrorWindow
+	if sec := s.State.LaunchConfig.PilotErrors.CorrectionSeconds; sec > 0 {
+		window = time.Duration(sec) * time.Second
+	}
+	pe.Deadline = s.State.SimTime.Add(window)
+	s.PilotErrors = append(s.PilotErrors, pe)
+	if pe.Kind == PilotErrorReadback {
+		s.recordReadbackError(pe)
+	}
+
+	s.lg.Infof("%s: injected pilot error %s: %s", pe.Callsign, pe.Kind, pe.Description)
+	s.eventStream.Post(Event{
+		Type:         PilotErrorEvent,
+		Callsign:     pe.Callsign,
+		ToController: pe.Controller,
+		Message:      string(pe.Kind) + ": " + pe.Description,
+	})
+}
+
+func (s *Sim) resolvePilotError(pe PilotError, caught bool) {
+	result := "missed"
+	if caught {
+		result = "caught"
+	}
+	s.lg.Infof("%s: pilot error %s %s", pe.Callsign, pe.Kind, result)
+	if pe.Kind == PilotErrorReadback {
+		s.resolveReadbackError(pe, caught)
+	}
+	s.eventStream.Post(Event{
+		Type:         PilotErrorResolvedEvent,
+		Callsign:     pe.Callsign,
+		ToController: pe.Controller,
+		Message:      string(pe.Kind) + ": " + result,
+	})
+}
+
+// pilotErrorCorrected is called when a controller issues an instruction
+// of the given sort to an aircraft; any outstanding error that it
+// corrects is resolved as caught.
+func (s *Sim) pilotErrorCorrected(callsign, instruction string) {
+	s.PilotErrors = slices.DeleteFunc(s.PilotErrors, func(pe PilotError) bool {
+		if pe.Callsign == callsign && pe.Instruction == instruction {
+			s.resolvePilotError(pe, true)
+			return true
+		}
+		return false
+	})
+}
+
+// updatePilotErrors resolves errors that weren't caught in time. Pilots
+// that have busted their altitude notice on their own once they reach
+// the wrong altitude, or at the deadline, and return to the assigned
+// one.
+func (s *Sim) updatePilotErrors() {
+	s.PilotErrors = slices.DeleteFunc(s.PilotErrors, func(pe PilotError) bool {
+		ac, ok := s.State.Aircraft[pe.Callsign]
+		if !ok {
+			return true
+		}
+
+		if pe.Kind == PilotErrorLevelBust {
+			if math.Abs(ac.Altitude()-float32(pe.BustAltitude)) < 50 || s.State.SimTime.After(pe.Deadline) {
+				ac.AssignAltitude(pe.Altitude, false)
+				s.resolvePilotError(pe, false)
+				return true
+			}
+			return false
+		}
+
+		if s.State.SimTime.After(pe.Deadline) {
+			s.resolvePilotError(pe, false)
+			return true
+		}
+		return false
+	})
+}
+
+func unexpectedResponse(rt []av.RadioTransmission) bool {
+	return slices.ContainsFunc(rt, func(r av.RadioTransmission) bool {
+		return r.Type == av.RadioTransmissionUnexpected
+	})
+}
+
+// assignAltitudeWithErrors assigns the altitude to the aircraft, possibly
+// making an error in the process. It returns the pilot's readback.
+func (s *Sim) assignAltitudeWithErrors(tcp string, ac *av.Aircraft, altitude int, afterSpeed bool) []av.RadioTransmission {
+	s.pilotErrorCorrected(ac.Callsign, "altitude")
+
+	rt := ac.AssignAltitude(altitude, afterSpeed)
+	if unexpectedResponse(rt) {
+		return rt
+	}
+	s.recordClearance(tcp, "altitude")
+
+	kinds := []PilotErrorKind{PilotErrorReadback}
+	delta := float32(altitude) - ac.Altitude()
+	if math.Abs(delta) > 1000 {
+		kinds = append(kinds, PilotErrorLevelBust)
+	}
+	kind, ok := s.pickPilotError(tcp, ac, kinds...)
+	if !ok {
+		return rt
+	}
+
+	switch kind {
+	case PilotErrorReadback:
+		// Off by 1,000' or 2,000', in either direction.
+		offset := 1000 * (1 + int(s.severity()+0.5))
+		wrong := altitude + util.Select(s.Rand.Intn(2) == 0, offset, -offset)
+		wrt := ac.AssignAltitude(wrong, afterSpeed)
+		if wrong <= 0 || unexpectedResponse(wrt) {
+			ac.AssignAltitude(altitude, afterSpeed)
+			return rt
+		}
+		s.injectPilotError(PilotError{
+			Kind:        kind,
+			Callsign:    ac.Callsign,
+			Controller:  tcp,
+			Instruction: "altitude",
+			Description: fmt.Sprintf("assigned %s, read back and flying %s", av.FormatAltitude(float32(altitude)),
+				av.FormatAltitude(float32(wrong))),
+		})
+		return wrt
+
+	case PilotErrorLevelBust:
+		// Overshoot in the direction the aircraft is going.
+		bust := 100 * int((300+700*s.severity())/100)
+		bustAltitude := altitude + util.Select(delta > 0, bust, -bust)
+		if wrt := ac.AssignAltitude(bustAltitude, afterSpeed); unexpectedResponse(wrt) {
+			ac.AssignAltitude(altitude, afterSpeed)
+			return rt
+		}
+		s.injectPilotError(PilotError{
+			Kind:         kind,
+			Callsign:     ac.Callsign,
+			Controller:   tcp,
+			Instruction:  "altitude",
+			Description:  fmt.Sprintf("assigned %s, will bust it by %d'", av.FormatAltitude(float32(altitude)), bust),
+			Altitude:     altitude,
+			BustAltitude: bustAltitude,
+		})
+	}
+	return rt
+}
+
+// assignHeadingWithErrors assigns the heading to the aircraft, possibly
+// making an error in the process. It returns the pilot's readback.
+func (s *Sim) assignHeadingWithErrors(tcp string, ac *av.Aircraft, heading int, turn av.TurnMethod) []av.RadioTransmission {
+	s.pilotErrorCorrected(ac.Callsign, "heading")
+
+	rt := ac.AssignHeading(heading, turn, s.State.SimTime)
+	if unexpectedResponse(rt) {
+		return rt
+	}
+	s.recordClearance(tcp, "heading")
+
+	kinds := []PilotErrorKind{PilotErrorReadback}
+	// Only bother with wrong-way turns if it will make a difference.
+	turnAngle := math.HeadingSignedTurn(ac.Heading(), float32(heading))
+	if math.Abs(turnAngle) > 30 && math.Abs(turnAngle) < 150 {
+		kinds = append(kinds, PilotErrorWrongTurn)
+	}
+	kind, ok := s.pickPilotError(tcp, ac, kinds...)
+	if !ok {
+		return rt
+	}
+
+	switch kind {
+	case PilotErrorReadback:
+		// Off by 10-30 degrees in either direction.
+		offset := 10 * (1 + int(2*s.severity()+0.5))
+		offset = util.Select(s.Rand.Intn(2) == 0, offset, -offset)
+		wrong := int(math.NormalizeHeading(float32(heading + offset)))
+		if wrong == 0 {
+			wrong = 360
+		}
+		wrt := ac.AssignHeading(wrong, turn, s.State.SimTime)
+		if unexpectedResponse(wrt) {
+			ac.AssignHeading(heading, turn, s.State.SimTime)
+			return rt
+		}
+		s.injectPilotError(PilotError{
+			Kind:        kind,
+			Callsign:    ac.Callsign,
+			Controller:  tcp,
+			Instruction: "heading",
+			Description: fmt.Sprintf("assigned heading %03d, read back and flying %03d", heading, wrong),
+		})
+		return wrt
+
+	case PilotErrorWrongTurn:
+		// Read back correctly but turn the other way.
+		var wrong av.TurnMethod
+		switch {
+		case turn == av.TurnLeft:
+			wrong = av.TurnRight
+		case turn == av.TurnRight:
+			wrong = av.TurnLeft
+		case turnAngle < 0:
+			wrong = av.TurnRight
+		default:
+			wrong = av.TurnLeft
+		}
+		ac.AssignHeading(heading, wrong, s.State.SimTime)
+		s.injectPilotError(PilotError{
+			Kind:        kind,
+			Callsign:    ac.Callsign,
+			Controller:  tcp,
+			Instruction: "heading",
+			Description: fmt.Sprintf("assigned heading %03d, turning the wrong way", heading),
+		})
+	}
+	return rt
+}
+
+// missedFrequencyChange decides whether the pilot misses a frequency
+// change; if so, there is no response and the aircraft stays on the
+// current frequency.
+func (s *Sim) missedFrequencyChange(tcp string, ac *av.Aircraft) bool {
+	s.pilotErrorCorrected(ac.Callsign, "frequency")
+
+	if _, ok := s.pickPilotError(tcp, ac, PilotErrorMissedFrequencyChange); !ok {
+		return false
+	}
+	s.injectPilotError(PilotError{
+		Kind:        PilotErrorMissedFrequencyChange,
+		Callsign:    ac.Callsign,
+		Controller:  tcp,
+		Instruction: "frequency",
+		Description: "no response to frequency change",
+	})
+	return true
+}
+
+// changeSquawkWithErrors has the aircraft change to the given beacon
+// code, possibly with the pilot dialing in a wrong digit. It returns the
+// pilot's readback.
+func (s *Sim) changeSquawkWithErrors(tcp string, ac *av.Aircraft, sq av.Squawk) []av.RadioTransmission {
+	s.pilotErrorCorrected(ac.Callsign, "squawk")
+
+	rt := []av.RadioTransmission{av.RadioTransmission{
+		Controller: tcp,
+		Message:    "squawk " + sq.String(),
+		Type:       av.RadioTransmissionReadback,
+	}}
+
+	if _, ok := s.pickPilotError(tcp, ac, PilotErrorWrongCode); !ok {
+		s.enqueueTransponderChange(ac.Callsign, sq, ac.Mode)
+		return rt
+	}
+
+	// Read back correctly but get one of the digits wrong.
+	shift := 3 * s.Rand.Intn(4)
+	digit := (int(sq) >> shift) & 7
+	wrongDigit := (digit + 1 + s.Rand.Intn(7)) % 8
+	wrong := av.Squawk(int(sq)&^(7<<shift) | wrongDigit<<shift)
+	if spc, _ := wrong.IsSPC(); spc || wrong == 0o1200 {
+		s.enqueueTransponderChange(ac.Callsign, sq, ac.Mode)
+		return rt
+	}
+
+	s.enqueueTransponderChange(ac.Callsign, wrong, ac.Mode)
+	s.injectPilotError(PilotError{
+		Kind:        PilotErrorWrongCode,
+		Callsign:    ac.Callsign,
+		Controller:  tcp,
+		Instruction: "squawk",
+		Description: fmt.Sprintf("assigned code %s, squawking %s", sq, wrong),
+	})
+	return rt
+}
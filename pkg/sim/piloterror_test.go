@@ -0,0 +1,271 @@
+// pkg/sim/piloterror_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/rand"
+)
+
+// makePilotErrorTestSim returns a sim where every susceptible instruction
+// from 2K to AAL1, at 5,000' heading 090, is botched with one of the
+// given kinds of error.
+func makePilotErrorTestSim(t *testing.T, kinds ...PilotErrorKind) *Sim {
+	ac := &av.Aircraft{Callsign: "AAL1", ControllingController: "2K"}
+	ac.Nav.FlightState = av.FlightState{Altitude: 5000, Heading: 90, IAS: 250}
+	ac.Nav.Perf.Ceiling = 41000
+	ac.Nav.Rand = rand.New()
+
+	s := newTestSim(t, &State{
+		Aircraft: map[string]*av.Aircraft{"AAL1": ac},
+		SimTime:  testSimTime,
+	})
+	s.State.LaunchConfig.PilotErrors = PilotErrorConfig{Rate: 1, Kinds: kinds}
+	s.humanControllers = map[string]*EventsSubscription{"2K": nil}
+	s.Rand = rand.New()
+	s.Rand.Seed(1)
+	return s
+}
+
+// pilotErrorEvents returns the messages of the pilot error events that
+// have been posted.
+func pilotErrorEvents(sub *EventsSubscription) (injected, resolved []string) {
+	for _, e := range sub.Get() {
+		switch e.Type {
+		case PilotErrorEvent:
+			injected = append(injected, e.Message)
+		case PilotErrorResolvedEvent:
+			resolved = append(resolved, e.Message)
+		}
+	}
+	return
+}
+
+func TestPickPilotError(t *testing.T) {
+	s := makePilotErrorTestSim(t)
+	ac := s.State.Aircraft["AAL1"]
+
+	if k, ok := s.pickPilotError("2K", ac, PilotErrorReadback); !ok || k != PilotErrorReadback {
+		t.Errorf("got %q/%v, expected a readback error", k, ok)
+	}
+	if _, ok := s.pickPilotError("N4P", ac, PilotErrorReadback); ok {
+		t.Errorf("error made for a virtual controller's instruction")
+	}
+
+	s.PseudoPilotAircraft = map[string]string{"AAL1": "2K"}
+	if _, ok := s.pickPilotError("2K", ac, PilotErrorReadback); ok {
+		t.Errorf("error made by a pseudo-pilot's aircraft")
+	}
+	s.PseudoPilotAircraft = nil
+
+	s.PilotErrors = []PilotError{{Kind: PilotErrorWrongCode, Callsign: "AAL1"}}
+	if _, ok := s.pickPilotError("2K", ac, PilotErrorReadback); ok {
+		t.Errorf("second error made while one is outstanding")
+	}
+	s.PilotErrors = nil
+
+	s.State.LaunchConfig.PilotErrors.Kinds = []PilotErrorKind{PilotErrorLevelBust}
+	if _, ok := s.pickPilotError("2K", ac, PilotErrorReadback); ok {
+		t.Errorf("error made that isn't in the configured kinds")
+	}
+	for range 10 {
+		if k, ok := s.pickPilotError("2K", ac, PilotErrorReadback, PilotErrorLevelBust); !ok || k != PilotErrorLevelBust {
+			t.Errorf("got %q/%v, expected a level bust", k, ok)
+		}
+	}
+
+	s.State.LaunchConfig.PilotErrors.Rate = 0
+	if _, ok := s.pickPilotError("2K", ac, PilotErrorLevelBust); ok {
+		t.Errorf("error made with a zero rate")
+	}
+}
+
+func TestAltitudeReadbackErrorCaught(t *testing.T) {
+	s := makePilotErrorTestSim(t, PilotErrorReadback)
+	ac := s.State.Aircraft["AAL1"]
+	sub := s.eventStream.Subscribe()
+
+	rt := s.assignAltitudeWithErrors("2K", ac, 8000, false)
+	if len(s.PilotErrors) != 1 || s.PilotErrors[0].Instruction != "altitude" {
+		t.Fatalf("got errors %+v, expected an altitude readback error", s.PilotErrors)
+	}
+	// With zero severity, it's off by 1,000'.
+	wrong := *ac.Nav.Altitude.Assigned
+	if wrong != 7000 && wrong != 9000 {
+		t.Errorf("flying %.0f, expected 7,000 or 9,000", wrong)
+	}
+	if len(rt) != 1 || rt[0].Message != "climb and maintain "+av.FormatAltitude(wrong) &&
+		rt[0].Message != "up to "+av.FormatAltitude(wrong) {
+		t.Errorf("got readback %+v, expected the wrong altitude", rt)
+	}
+	if len(s.Hearback.Errors) != 1 {
+		t.Errorf("readback error wasn't recorded for hearback")
+	}
+
+	// Reissuing the altitude catches the error.
+	s.State.LaunchConfig.PilotErrors.Rate = 0
+	s.State.SimTime = s.State.SimTime.Add(20 * time.Second)
+	s.assignAltitudeWithErrors("2K", ac, 8000, false)
+
+	if len(s.PilotErrors) != 0 {
+		t.Errorf("error still outstanding after correction: %+v", s.PilotErrors)
+	}
+	if alt := *ac.Nav.Altitude.Assigned; alt != 8000 {
+		t.Errorf("flying %.0f after correction, expected 8,000", alt)
+	}
+	if he := s.Hearback.Errors[0]; !he.Resolved || !he.Corrected || he.Latency != 20*time.Second {
+		t.Errorf("got hearback error %+v, expected corrected after 20s", he)
+	}
+	injected, resolved := pilotErrorEvents(sub)
+	if len(injected) != 1 || !slices.Equal(resolved, []string{"readback: caught"}) {
+		t.Errorf("got events %q and %q", injected, resolved)
+	}
+}
+
+func TestPilotErrorMissed(t *testing.T) {
+	s := makePilotErrorTestSim(t, PilotErrorReadback)
+	s.State.LaunchConfig.PilotErrors.CorrectionSeconds = 30
+	ac := s.State.Aircraft["AAL1"]
+	sub := s.eventStream.Subscribe()
+
+	s.assignHeadingWithErrors("2K", ac, 120, av.TurnClosest)
+	if len(s.PilotErrors) != 1 || !s.PilotErrors[0].Deadline.Equal(testSimTime.Add(30*time.Second)) {
+		t.Fatalf("got errors %+v, expected one due in 30s", s.PilotErrors)
+	}
+
+	// A different sort of instruction doesn't catch it.
+	s.State.LaunchConfig.PilotErrors.Rate = 0
+	s.pilotErrorCorrected("AAL1", "altitude")
+
+	s.State.SimTime = testSimTime.Add(30 * time.Second)
+	s.updatePilotErrors()
+	if len(s.PilotErrors) != 1 {
+		t.Errorf("error resolved at the deadline")
+	}
+
+	s.State.SimTime = testSimTime.Add(31 * time.Second)
+	s.updatePilotErrors()
+	if len(s.PilotErrors) != 0 {
+		t.Errorf("error outstanding after the deadline")
+	}
+	if he := s.Hearback.Errors[0]; !he.Resolved || he.Corrected {
+		t.Errorf("got hearback error %+v, expected missed", he)
+	}
+	if _, resolved := pilotErrorEvents(sub); !slices.Equal(resolved, []string{"readback: missed"}) {
+		t.Errorf("got resolutions %q", resolved)
+	}
+}
+
+func TestLevelBust(t *testing.T) {
+	s := makePilotErrorTestSim(t, PilotErrorLevelBust)
+	ac := s.State.Aircraft["AAL1"]
+
+	// Not enough of a climb to bust.
+	s.assignAltitudeWithErrors("2K", ac, 6000, false)
+	if len(s.PilotErrors) != 0 {
+		t.Fatalf("got errors %+v for a 1,000' climb", s.PilotErrors)
+	}
+
+	rt := s.assignAltitudeWithErrors("2K", ac, 8000, false)
+	if len(s.PilotErrors) != 1 {
+		t.Fatalf("got errors %+v, expected a level bust", s.PilotErrors)
+	}
+	// With zero severity, it overshoots by 300'.
+	if pe := s.PilotErrors[0]; pe.Altitude != 8000 || pe.BustAltitude != 8300 || *ac.Nav.Altitude.Assigned != 8300 {
+		t.Errorf("got %+v flying %.0f, expected to bust 8,000 by 300'", pe, *ac.Nav.Altitude.Assigned)
+	}
+	if len(rt) != 1 || rt[0].Message != "climb and maintain 8,000" && rt[0].Message != "up to 8,000" {
+		t.Errorf("got readback %+v, expected 8,000", rt)
+	}
+
+	// Climbing through the assigned altitude...
+	ac.Nav.FlightState.Altitude = 8100
+	s.updatePilotErrors()
+	if len(s.PilotErrors) != 1 {
+		t.Errorf("pilot noticed before reaching the bust altitude")
+	}
+
+	// ...until the pilot notices and returns to it.
+	ac.Nav.FlightState.Altitude = 8280
+	s.updatePilotErrors()
+	if len(s.PilotErrors) != 0 || *ac.Nav.Altitude.Assigned != 8000 {
+		t.Errorf("got errors %+v flying %.0f, expected to return to 8,000", s.PilotErrors, *ac.Nav.Altitude.Assigned)
+	}
+}
+
+func TestWrongTurn(t *testing.T) {
+	for _, test := range []struct {
+		heading     int
+		turn, wrong av.TurnMethod
+	}{
+		{180, av.TurnClosest, av.TurnLeft},
+		{360, av.TurnClosest, av.TurnRight},
+		{180, av.TurnLeft, av.TurnRight},
+		{360, av.TurnRight, av.TurnLeft},
+	} {
+		s := makePilotErrorTestSim(t, PilotErrorWrongTurn)
+		ac := s.State.Aircraft["AAL1"]
+
+		s.assignHeadingWithErrors("2K", ac, test.heading, test.turn)
+		if len(s.PilotErrors) != 1 {
+			t.Errorf("%03d %v: got errors %+v, expected a wrong turn", test.heading, test.turn, s.PilotErrors)
+			continue
+		}
+		h := ac.Nav.DeferredHeading.Heading
+		if *h.Assigned != float32(test.heading) || *h.Turn != test.wrong {
+			t.Errorf("%03d %v: flying %03.0f turning %v, expected turning %v", test.heading, test.turn,
+				*h.Assigned, *h.Turn, test.wrong)
+		}
+	}
+
+	// Small turns aren't botched.
+	s := makePilotErrorTestSim(t, PilotErrorWrongTurn)
+	s.assignHeadingWithErrors("2K", s.State.Aircraft["AAL1"], 100, av.TurnClosest)
+	if len(s.PilotErrors) != 0 {
+		t.Errorf("got errors %+v for a 10 degree turn", s.PilotErrors)
+	}
+}
+
+func TestWrongCode(t *testing.T) {
+	s := makePilotErrorTestSim(t, PilotErrorWrongCode)
+	ac := s.State.Aircraft["AAL1"]
+
+	// These are all one digit from 1200 or an SPC.
+	for _, sq := range []av.Squawk{0o1201, 0o1210, 0o1300, 0o7501, 0o7610, 0o7707, 0o7770, 0o4512} {
+		for range 50 {
+			s.PilotErrors = nil
+			s.FutureSquawkChanges = nil
+			s.changeSquawkWithErrors("2K", ac, sq)
+
+			if len(s.FutureSquawkChanges) != 1 {
+				t.Fatalf("got squawk changes %+v", s.FutureSquawkChanges)
+			}
+			code := s.FutureSquawkChanges[0].Code
+			if spc, _ := code.IsSPC(); spc || code == 0o1200 {
+				t.Errorf("%s: squawking %s", sq, code)
+			}
+			if len(s.PilotErrors) == 0 {
+				if code != sq {
+					t.Errorf("%s: squawking %s without an error", sq, code)
+				}
+				continue
+			}
+
+			ndiff := 0
+			for shift := 0; shift < 12; shift += 3 {
+				if (int(code)>>shift)&7 != (int(sq)>>shift)&7 {
+					ndiff++
+				}
+			}
+			if ndiff != 1 {
+				t.Errorf("%s: squawking %s, expected one wrong digit", sq, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,429 @@
+// pkg/sim/pirep.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Scenarios may also script icing and turbulence: regions between a floor
+// and a ceiling where aircraft encounter the given conditions. Pilots
+// report the conditions a little while after they run into them; unless
+// the conditions are light, they also ask for an altitude out of them.
+// Pilots won't accept altitudes in severe conditions.
+//
+// Pilot reports (PIREPs) are also entered by controllers relaying what
+// they've been told. They're kept for an hour and shared with the
+// federated sim, if any, so that controllers can pass them on to other
+// aircraft; RecentPIREPs finds the ones near a fix.
+
+// WeatherHazard is an icing or turbulence layer given in a scenario's
+// weather script.
+type WeatherHazard struct {
+	Type      string `json:"type"`      // "icing" or "turbulence"
+	Intensity string `json:"intensity"` // "light", "moderate", or "severe"
+	Floor     int    `json:"floor"`     // feet MSL
+	Ceiling   int    `json:"ceiling"`
+	// If given, the hazard is only inside this area.
+	Vertices []math.Point2LL `json:"vertices,omitempty"`
+	// As with WeatherCells.
+	AfterMinutes    float32 `json:"after_minutes,omitempty"`
+	DurationMinutes float32 `json:"duration_minutes,omitempty"`
+}
+
+var hazardIntensities = []string{"light", "moderate", "severe"}
+
+const (
+	// How long pilots are in conditions before reporting them.
+	pirepDelay = 30 * time.Second
+	// How long PIREPs are kept.
+	pirepLifetime = time.Hour
+	// Pilots won't ask to descend below this to get out of conditions.
+	hazardMinimumRequest = 3000
+)
+
+func (h WeatherHazard) Validate() error {
+	if h.Type != "icing" && h.Type != "turbulence" {
+		return fmt.Errorf("%q: \"type\" must be \"icing\" or \"turbulence\"", h.Type)
+	}
+	if !slices.Contains(hazardIntensities, h.Intensity) {
+		return fmt.Errorf("%q: \"intensity\" must be \"light\", \"moderate\", or \"severe\"", h.Intensity)
+	}
+	if h.Floor < 0 || h.Ceiling <= h.Floor {
+		return fmt.Errorf("%d-%d: \"ceiling\" must be above \"floor\"", h.Floor, h.Ceiling)
+	}
+	if len(h.Vertices) > 0 && len(h.Vertices) < 3 {
+		return fmt.Errorf("at least three \"vertices\" must be given if any are")
+	}
+	if h.AfterMinutes < 0 || h.DurationMinutes < 0 {
+		return fmt.Errorf("\"after_minutes\" and \"duration_minutes\" must not be negative")
+	}
+	return nil
+}
+
+func (h WeatherHazard) contains(p math.Point2LL, alt float32) bool {
+	return alt >= float32(h.Floor) && alt <= float32(h.Ceiling) &&
+		(len(h.Vertices) == 0 || math.PointInPolygon2LL(p, h.Vertices))
+}
+
+func (h WeatherHazard) severity() int {
+	return slices.Index(hazardIntensities, h.Intensity)
+}
+
+// ScriptedWeatherHazard is a hazard from the weather script along with
+// when it is present.
+type ScriptedWeatherHazard struct {
+	Hazard     WeatherHazard
+	Start, End time.Time // End is zero if it lasts indefinitely
+}
+
+func (s *Sim) scheduleWeatherHazards(hazards []WeatherHazard) {
+	for _, h := range hazards {
+		sh := ScriptedWeatherHazard{
+			Hazard: h,
+			Start:  s.State.SimTime.Add(time.Duration(h.AfterMinutes * float32(time.Minute))),
+		}
+		if h.DurationMinutes > 0 {
+			sh.End = sh.Start.Add(time.Duration(h.DurationMinutes * float32(time.Minute)))
+		}
+		s.HazardScript = append(s.HazardScript, sh)
+	}
+}
+
+// hazardAt returns the index in the script of the most severe hazard
+// present at the given position and altitude, or -1 if there is none.
+func (s *Sim) hazardAt(p math.Point2LL, alt float32) int {
+	idx := -1
+	now := s.State.SimTime
+	for i, sh := range s.HazardScript {
+		if now.Before(sh.Start) || (!sh.End.IsZero() && now.After(sh.End)) || !sh.Hazard.contains(p, alt) {
+			continue
+		}
+		if idx == -1 || sh.Hazard.severity() > s.HazardScript[idx].Hazard.severity() {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// PIREP is a pilot report of icing or turbulence or, if Type is empty,
+// just of what's given in the remarks.
+type PIREP struct {
+	Time         time.Time
+	Callsign     string
+	AircraftType string
+	Location     string // e.g. "CAMRN270012"
+	Position     math.Point2LL
+	Altitude     int
+	Type         string // "icing" or "turbulence"
+	Intensity    string
+	Remarks      string
+	// Controller is set if the PIREP was entered by a controller rather
+	// than generated by the sim.
+	Controller string
+}
+
+// String returns the PIREP in the standard format, e.g. "UA /OV
+// CAMRN270012 /TM 1530 /FL080 /TP B738 /IC MOD".
+func (p PIREP) String() string {
+	s := fmt.Sprintf("UA /OV %s /TM %s /FL%03d", p.Location, p.Time.UTC().Format("1504"), p.Altitude/100)
+	if p.AircraftType != "" {
+		s += " /TP " + p.AircraftType
+	}
+	if p.Type != "" {
+		s += util.Select(p.Type == "icing", " /IC ", " /TB ") + p.Conditions()
+	}
+	if p.Remarks != "" {
+		s += " /RM " + p.Remarks
+	}
+	return s
+}
+
+// Conditions returns the reported conditions abbreviated, e.g. "MOD".
+func (p PIREP) Conditions() string {
+	if len(p.Intensity) < 3 {
+		return strings.ToUpper(p.Intensity)
+	}
+	return strings.ToUpper(p.Intensity[:3])
+}
+
+// Validate checks a PIREP that has been entered by a controller.
+func (p PIREP) Validate() error {
+	if p.Location == "" {
+		return fmt.Errorf("location must be given")
+	}
+	if p.Altitude <= 0 {
+		return fmt.Errorf("altitude must be given")
+	}
+	if p.Type == "" {
+		if p.Remarks == "" {
+			return fmt.Errorf("conditions or remarks must be given")
+		}
+	} else if p.Type != "icing" && p.Type != "turbulence" {
+		return fmt.Errorf("%q: type must be \"icing\" or \"turbulence\"", p.Type)
+	} else if !slices.Contains(hazardIntensities, p.Intensity) {
+		return fmt.Errorf("%q: intensity must be \"light\", \"moderate\", or \"severe\"", p.Intensity)
+	}
+	return nil
+}
+
+// SummarizePIREPs summarizes the conditions in the given PIREPs, giving
+// the altitudes at which each was reported, e.g. "MOD IC 060-080, LGT TB
+// 120".
+func SummarizePIREPs(pireps []PIREP) string {
+	type altRange struct{ lo, hi int }
+	ranges := make(map[string]altRange)
+	for _, p := range pireps {
+		if p.Type == "" {
+			continue
+		}
+		key := p.Conditions() + util.Select(p.Type == "icing", " IC", " TB")
+		if r, ok := ranges[key]; ok {
+			ranges[key] = altRange{lo: min(r.lo, p.Altitude), hi: max(r.hi, p.Altitude)}
+		} else {
+			ranges[key] = altRange{lo: p.Altitude, hi: p.Altitude}
+		}
+	}
+
+	var s []string
+	for _, key := range util.SortedMapKeys(ranges) {
+		r := ranges[key]
+		if r.lo == r.hi {
+			s = append(s, fmt.Sprintf("%s %03d", key, r.lo/100))
+		} else {
+			s = append(s, fmt.Sprintf("%s %03d-%03d", key, r.lo/100, r.hi/100))
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+// RecentPIREPs returns the PIREPs within the given distance of the fix,
+// most recent first.
+func (ss *State) RecentPIREPs(fix string, nm float32) []PIREP {
+	loc, ok := ss.Locate(fix)
+	if !ok {
+		return nil
+	}
+
+	var pireps []PIREP
+	for i := len(ss.PIREPs) - 1; i >= 0; i-- {
+		if p := ss.PIREPs[i]; math.NMDistance2LL(p.Position, loc) <= nm {
+			pireps = append(pireps, p)
+		}
+	}
+	return pireps
+}
+
+// locatePIREP returns the position for a location given as a fix,
+// possibly followed by a three-digit radial and a three-digit distance,
+// e.g. "CAMRN270012".
+func (s *Sim) locatePIREP(location string) (math.Point2LL, bool) {
+	if p, ok := s.State.Locate(location); ok {
+		return p, true
+	}
+	if n := len(location); n > 6 {
+		radial, rerr := strconv.Atoi(location[n-6 : n-3])
+		dist, derr := strconv.Atoi(location[n-3:])
+		if p, ok := s.State.Locate(location[:n-6]); ok && rerr == nil && derr == nil && radial <= 360 {
+			return math.Offset2LL(p, float32(radial), float32(dist), s.State.NmPerLongitude, s.State.MagneticVariation), true
+		}
+	}
+	return math.Point2LL{}, false
+}
+
+// EnterPIREP adds a PIREP that a pilot has given a controller.
+func (s *Sim) EnterPIREP(tcp string, p PIREP) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.isActiveHumanController(tcp) {
+		return av.ErrNoController
+	}
+	if err := p.Validate(); err != nil {
+		return ErrInvalidPIREP
+	}
+	p.Location = strings.ToUpper(p.Location)
+	pos, ok := s.locatePIREP(p.Location)
+	if !ok {
+		return av.ErrNoMatchingFix
+	}
+
+	p.Position = pos
+	p.Time = s.State.SimTime
+	p.Controller = tcp
+	if ac, ok := s.State.Aircraft[p.Callsign]; ok && ac.FlightPlan != nil && p.AircraftType == "" {
+		p.AircraftType = ac.FlightPlan.TypeWithoutSuffix()
+	}
+	s.addPIREP(p)
+
+	return nil
+}
+
+func (s *Sim) addPIREP(p PIREP) {
+	s.State.PIREPs = append(s.State.PIREPs, p)
+
+	s.lg.Info("PIREP", slog.String("callsign", p.Callsign), slog.String("controller", p.Controller),
+		slog.String("pirep", p.String()))
+	s.eventStream.Post(Event{
+		Type:         PIREPEvent,
+		Callsign:     p.Callsign,
+		ToController: util.Select(p.Controller == "", s.pirepController(p.Callsign), ""),
+		Message:      p.String(),
+	})
+
+	s.sendFederatedPIREP(p)
+}
+
+func (s *Sim) pirepController(callsign string) string {
+	if ac, ok := s.State.Aircraft[callsign]; ok {
+		return ac.ControllingController
+	}
+	return ""
+}
+
+// pirepLocation gives the aircraft's position relative to the nearest
+// reporting point as it would be written in a PIREP.
+func (s *Sim) pirepLocation(ac *av.Aircraft) string {
+	var rp *av.ReportingPoint
+	var rpDistance float32
+	for i, pt := range s.ReportingPoints {
+		if d := math.NMDistance2LL(ac.Position(), pt.Location); rp == nil || d < rpDistance {
+			rp = &s.ReportingPoints[i]
+			rpDistance = d
+		}
+	}
+	if rp == nil {
+		return ac.Position().DDString()
+	}
+
+	hdg := math.Heading2LL(rp.Location, ac.Position(), s.State.NmPerLongitude, s.State.MagneticVariation)
+	if hdg < 0.5 {
+		hdg = 360
+	}
+	return fmt.Sprintf("%s%03d%03d", rp.Fix, int(hdg+0.5), int(rpDistance+0.5))
+}
+
+// hazardEncounter records an aircraft that is in icing or turbulence.
+type hazardEncounter struct {
+	Hazard   int // index in the script
+	Entered  time.Time
+	Reported bool
+}
+
+// checkWeatherHazards is called once a second.
+func (s *Sim) checkWeatherHazards() {
+	if s.hazardEncounters == nil {
+		s.hazardEncounters = make(map[string]hazardEncounter)
+	}
+
+	now := s.State.SimTime
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		idx := -1
+		if ac.IsAirborne() && !s.isExternalAircraft(callsign) {
+			idx = s.hazardAt(ac.Position(), ac.Altitude())
+		}
+		if idx == -1 {
+			delete(s.hazardEncounters, callsign)
+			continue
+		}
+
+		enc, ok := s.hazardEncounters[callsign]
+		if !ok || enc.Hazard != idx {
+			enc = hazardEncounter{Hazard: idx, Entered: now}
+		}
+		if !enc.Reported && now.Sub(enc.Entered) >= pirepDelay {
+			enc.Reported = true
+			s.reportHazard(ac, s.HazardScript[idx].Hazard)
+		}
+		s.hazardEncounters[callsign] = enc
+	}
+
+	for callsign := range s.hazardEncounters {
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(s.hazardEncounters, callsign)
+		}
+	}
+
+	s.State.PIREPs = slices.DeleteFunc(s.State.PIREPs, func(p PIREP) bool {
+		return now.Sub(p.Time) > pirepLifetime
+	})
+}
+
+// reportHazard has the pilot report the conditions and, if they're bad
+// enough, ask for an altitude out of them.
+func (s *Sim) reportHazard(ac *av.Aircraft, h WeatherHazard) {
+	alt := int(ac.Altitude()+50) / 100 * 100
+	p := PIREP{
+		Time:      s.State.SimTime,
+		Callsign:  ac.Callsign,
+		Location:  s.pirepLocation(ac),
+		Position:  ac.Position(),
+		Altitude:  alt,
+		Type:      h.Type,
+		Intensity: h.Intensity,
+	}
+	if ac.FlightPlan != nil {
+		p.AircraftType = ac.FlightPlan.TypeWithoutSuffix()
+	}
+	s.addPIREP(p)
+
+	if ac.ControllingController == "" {
+		return
+	}
+	msg := "we're getting " + h.Intensity + " " + util.Select(h.Type == "icing", "icing", "chop") +
+		" at " + av.FormatAltitude(float32(alt))
+	if h.Intensity != "light" {
+		if req, ok := s.hazardExitAltitude(ac, h); ok {
+			msg += ", request " + av.FormatAltitude(float32(req))
+		}
+	}
+	s.postRadioEvents(ac.Callsign, []av.RadioTransmission{av.RadioTransmission{
+		Controller: ac.ControllingController,
+		Message:    msg,
+		Type:       av.RadioTransmissionUnexpected,
+	}})
+}
+
+// hazardExitAltitude returns the nearest altitude below or above the
+// hazard's layer that the aircraft might reasonably be given.
+func (s *Sim) hazardExitAltitude(ac *av.Aircraft, h WeatherHazard) (int, bool) {
+	below := (h.Floor - 1) / 1000 * 1000
+	above := (h.Ceiling/1000 + 1) * 1000
+
+	belowOK := below >= hazardMinimumRequest
+	aboveOK := ac.FlightPlan == nil || above <= ac.FlightPlan.Altitude
+	alt := ac.Altitude()
+	switch {
+	case belowOK && aboveOK:
+		return util.Select(alt-float32(below) < float32(above)-alt, below, above), true
+	case belowOK:
+		return below, true
+	case aboveOK:
+		return above, true
+	default:
+		return 0, false
+	}
+}
+
+// severeHazardAt returns the severe hazard, if any, at the aircraft's
+// position and the given altitude.
+func (s *Sim) severeHazardAt(ac *av.Aircraft, alt int) (WeatherHazard, bool) {
+	if idx := s.hazardAt(ac.Position(), float32(alt)); idx != -1 {
+		if h := s.HazardScript[idx].Hazard; h.Intensity == "severe" {
+			return h, true
+		}
+	}
+	return WeatherHazard{}, false
+}
@@ -0,0 +1,153 @@
+// pkg/sim/pointoutadvisor.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Aircraft that will clip another position's airspace on their way
+// through ours need to be pointed out to it, and forgetting to do so is a
+// common trainee error. The trajectories of the aircraft that human
+// controllers are tracking are predicted a few minutes ahead; when one is
+// predicted to enter another position's airspace and leave it again, a
+// PointOutSuggestionEvent is posted to the tracking controller--or, if
+// the STARS adaptation specifies "auto_point_outs", the point-out is made
+// for them. If the aircraft then enters that airspace without having
+// been pointed out, a MissedPointOutEvent is posted; the "pointout"
+// rubric scores them.
+
+const (
+	pointOutCheckInterval = 10 * time.Second
+	pointOutStep          = 10 * time.Second
+	pointOutHorizon       = 3 * time.Minute
+)
+
+// pointOutAdvisory records a predicted entry into another position's
+// airspace.
+type pointOutAdvisory struct {
+	TrackingController string
+	Entered            bool // the aircraft has entered the airspace
+}
+
+// clippedAirspace returns the controllers other than tcp whose airspace
+// the trajectory enters and then leaves, along with the index of the
+// trajectory point where it enters. current gives the owners of the
+// airspace the aircraft is already in.
+func (ss *State) clippedAirspace(tcp string, current []string, traj []trajectoryPoint) map[string]int {
+	owners := make([][]string, len(traj))
+	for i, pt := range traj {
+		owners[i] = ss.airspaceOwnersAt(pt.P, pt.Altitude)
+	}
+
+	clipped := make(map[string]int)
+	for i := range traj {
+		for _, to := range owners[i] {
+			if _, ok := clipped[to]; ok || to == tcp || slices.Contains(current, to) {
+				continue
+			}
+			if slices.ContainsFunc(owners[i+1:], func(o []string) bool { return !slices.Contains(o, to) }) {
+				clipped[to] = i
+			}
+		}
+	}
+	return clipped
+}
+
+// pointedOut returns whether the controller already knows about the
+// aircraft.
+func (s *Sim) pointedOut(ac *av.Aircraft, tcp string) bool {
+	if po, ok := s.PointOuts[ac.Callsign]; ok && po.ToController == tcp {
+		return true
+	}
+	return ac.TrackingController == tcp || ac.HandoffTrackController == tcp ||
+		slices.Contains(ac.PointOutHistory, tcp)
+}
+
+// updatePointOutAdvisor is called once a second.
+func (s *Sim) updatePointOutAdvisor() {
+	now := s.State.SimTime
+	if len(s.State.Airspace) == 0 || now.Sub(s.lastPointOutCheck) < pointOutCheckInterval {
+		return
+	}
+	s.lastPointOutCheck = now
+	if s.pointOutAdvisories == nil {
+		s.pointOutAdvisories = make(map[string]*pointOutAdvisory)
+	}
+
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		tcp := ac.TrackingController
+		if !ac.IsAirborne() || !s.isActiveHumanController(tcp) || ac.HandoffTrackController != "" {
+			continue
+		}
+
+		current := s.State.airspaceOwnersAt(ac.Position(), ac.Altitude())
+		for _, to := range current {
+			if adv, ok := s.pointOutAdvisories[callsign+"/"+to]; ok && !adv.Entered {
+				adv.Entered = true
+				if !s.pointedOut(ac, to) {
+					s.eventStream.Post(Event{
+						Type:           MissedPointOutEvent,
+						Callsign:       callsign,
+						FromController: to,
+						ToController:   tcp,
+						Message:        "entered " + to + " airspace without a point out",
+					})
+				}
+			}
+		}
+
+		in, ok := s.State.Intent(callsign)
+		if !ok {
+			in = ac.Intent()
+		}
+		traj := s.State.predictTrajectory(ac, in.RoutePoints(), in.TargetAltitude, pointOutStep, pointOutHorizon)
+		clipped := s.State.clippedAirspace(tcp, current, traj)
+		for _, to := range util.SortedMapKeys(clipped) {
+			key := callsign + "/" + to
+			if _, ok := s.pointOutAdvisories[key]; ok {
+				continue
+			}
+			s.pointOutAdvisories[key] = &pointOutAdvisory{TrackingController: tcp}
+			if s.pointedOut(ac, to) {
+				continue
+			}
+
+			from, fok := s.State.Controllers[tcp]
+			toCtrl, tok := s.State.Controllers[to]
+			if s.State.STARSFacilityAdaptation.AutoPointOuts && fok && tok && from.Facility == toCtrl.Facility {
+				s.lg.Info("automatic point out", slog.String("callsign", callsign),
+					slog.String("from", tcp), slog.String("to", to))
+				s.pointOut(callsign, from, toCtrl)
+			} else {
+				entry := time.Duration(clipped[to]+1) * pointOutStep
+				s.eventStream.Post(Event{
+					Type:           PointOutSuggestionEvent,
+					Callsign:       callsign,
+					FromController: to,
+					ToController:   tcp,
+					Message: fmt.Sprintf("point out to %s, entering its airspace in %d:%02d", to,
+						int(entry.Minutes()), int(entry.Seconds())%60),
+				})
+			}
+		}
+	}
+
+	// Forget about aircraft that have left or changed hands.
+	for key, adv := range s.pointOutAdvisories {
+		callsign, _, _ := strings.Cut(key, "/")
+		if ac, ok := s.State.Aircraft[callsign]; !ok || ac.TrackingController != adv.TrackingController {
+			delete(s.pointOutAdvisories, key)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// pkg/sim/pointoutadvisor_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"maps"
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+func TestClippedAirspace(t *testing.T) {
+	box := func(x0, x1 float32, lower, upper int) []av.ControllerAirspaceVolume {
+		return []av.ControllerAirspaceVolume{{
+			LowerLimit: lower,
+			UpperLimit: upper,
+			Boundaries: [][]math.Point2LL{{{x0, 0}, {x1, 0}, {x1, 1}, {x0, 1}}},
+		}}
+	}
+	ss := &State{
+		Airspace: map[string]map[string][]av.ControllerAirspaceVolume{
+			"2K": {"A": box(0, 1, 0, 10000)},
+			"2J": {"A": box(1, 1.2, 0, 10000)},
+			"2H": {"A": box(1.2, 3, 0, 10000)},
+			"2W": {"A": box(0.5, 0.7, 12000, 17000)},
+		},
+		Consolidations: map[string]string{"2H": "2K"},
+	}
+
+	// An aircraft flying east at 5000' clips 2J and then gets back into
+	// 2K's airspace, as 2H is consolidated to 2K.
+	var traj []trajectoryPoint
+	for i := range 30 {
+		traj = append(traj, trajectoryPoint{P: math.Point2LL{0.05 + 0.1*float32(i), 0.5}, Altitude: 5000})
+	}
+	if c := ss.clippedAirspace("2K", []string{"2K"}, traj); !maps.Equal(c, map[string]int{"2J": 10}) {
+		t.Errorf("clipped %v, expected 2J at 10", c)
+	}
+
+	// If it's already in 2J's airspace, it's too late.
+	if c := ss.clippedAirspace("2K", []string{"2K", "2J"}, traj); len(c) != 0 {
+		t.Errorf("clipped %v, expected none", c)
+	}
+
+	// Ending up in 2J's airspace is a handoff, not a point-out.
+	if c := ss.clippedAirspace("2K", []string{"2K"}, traj[:12]); len(c) != 0 {
+		t.Errorf("clipped %v, expected none", c)
+	}
+
+	// Climbing through 2W's shelf.
+	for i := range traj {
+		traj[i].Altitude = 10000 + 1000*float32(i)
+	}
+	if c := ss.clippedAirspace("2K", []string{"2K"}, traj); !maps.Equal(c, map[string]int{"2W": 5}) {
+		t.Errorf("clipped %v, expected 2W at 5", c)
+	}
+}
@@ -0,0 +1,328 @@
+// pkg/sim/practice.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// General aviation aircraft request practice approaches to the runways in
+// use at the sim's airports, at the rate given by
+// LaunchConfig.PracticeApproachRate. They show up squawking 1200 and call
+// the controller who owns the airspace they're in, asking for an approach
+// under IFR or VFR and whether they'll make low approaches or land.
+// Practice approaches at airports within class B or C airspace get
+// separation services; elsewhere VFR aircraft don't.
+//
+// The controller creates a local flight plan for the aircraft with
+// CreateLocalFlightPlan, which assigns a beacon code and starts a track,
+// and then vectors and clears it for the approach like any other arrival.
+// Each practice approach takes a slot in the airport's arrival flow, so
+// clearing one pushes back the next IFR arrivals. At the end of a low
+// approach, the aircraft climbs out on the missed approach, returns to
+// the controller, and asks for another one or, after the last, for a
+// full stop.
+
+// PracticeApproach records an aircraft's request for practice approaches.
+type PracticeApproach struct {
+	Airport  string
+	Approach string // approach id
+	IFR      bool
+	// Whether VFR aircraft get separation services; IFR aircraft always
+	// do.
+	Separation bool
+	// Number of low approaches to make before landing.
+	LowApproaches int
+	Controller    string
+	Planned       bool // a local flight plan has been created
+	Slotted       bool // the current approach has taken an arrival slot
+}
+
+// ServicesString returns a description of the services the aircraft
+// gets.
+func (pa PracticeApproach) ServicesString() string {
+	if pa.IFR {
+		return "IFR"
+	}
+	return util.Select(pa.Separation, "VFR, separation services", "VFR, no separation services")
+}
+
+func (pa PracticeApproach) requestMessage(ap *av.Airport) string {
+	appr := pa.Approach
+	if a, ok := ap.Approaches[pa.Approach]; ok {
+		appr = a.FullName
+	}
+	option := util.Select(pa.LowApproaches > 0, "low approach", "full stop")
+	return "request practice " + appr + ", " + util.Select(pa.IFR, "IFR", "VFR") + ", " + option
+}
+
+// practiceApproachCandidates returns the airports and approaches that
+// practice approaches may be requested for: those to the runways in use.
+func (s *Sim) practiceApproachCandidates() [][2]string {
+	var c [][2]string
+	for _, rwy := range s.State.ArrivalRunways {
+		ap, ok := s.State.Airports[rwy.Airport]
+		if !ok {
+			continue
+		}
+		for _, id := range util.SortedMapKeys(ap.Approaches) {
+			if av.TidyRunway(ap.Approaches[id].Runway) == av.TidyRunway(rwy.Runway) {
+				c = append(c, [2]string{rwy.Airport, id})
+			}
+		}
+	}
+	return c
+}
+
+func (s *Sim) createPracticeApproach() error {
+	candidates := s.practiceApproachCandidates()
+	if len(candidates) == 0 {
+		return fmt.Errorf("no approaches to active runways")
+	}
+	c := candidates[s.Rand.Intn(len(candidates))]
+	icao, ap := c[0], s.State.Airports[c[0]]
+	nmPerLongitude, magneticVariation := s.State.NmPerLongitude, s.State.MagneticVariation
+
+	if s.bravoAirspace == nil || s.charlieAirspace == nil {
+		s.initializeAirspaceGrids()
+	}
+	dbap := av.DB.Airports()[icao]
+	elev := dbap.Elevation
+	pa := &PracticeApproach{
+		Airport:       icao,
+		Approach:      c[1],
+		IFR:           s.Rand.Intn(3) == 0,
+		LowApproaches: s.Rand.Intn(3),
+		Separation: s.bravoAirspace.Inside(ap.Location, elev+500) ||
+			s.charlieAirspace.Inside(ap.Location, elev+500),
+	}
+
+	ac, acType := s.State.sampleAircraft(av.AirlineSpecifier{ICAO: "N"}, &s.Rand, s.lg)
+	if ac == nil {
+		return fmt.Errorf("unable to sample a valid aircraft")
+	}
+	ac.Squawk = 0o1200
+	ac.FlightPlan = ac.NewFlightPlan(av.VFR, acType, icao, icao)
+	perf := av.DB.AircraftPerformance[ac.FlightPlan.BaseType()]
+
+	// Start outside of class B and C airspace, headed for the airport.
+	var p math.Point2LL
+	var alt int
+	for i := range 10 {
+		hdg := float32(1 + s.Rand.Intn(360))
+		p = math.Offset2LL(ap.Location, hdg, float32(15+s.Rand.Intn(11)), nmPerLongitude, magneticVariation)
+		course := math.NormalizeHeading(hdg + 180)
+		alt = util.Select(course < 180, 3500, 4500)
+		if pa.IFR {
+			alt -= 500
+		}
+		alt = min(max(alt, 1000*((elev+999)/1000)+2500), int(perf.Ceiling))
+		if !s.bravoAirspace.Inside(p, alt) && !s.charlieAirspace.Inside(p, alt) {
+			break
+		} else if i == 9 {
+			return ErrViolatedAirspace
+		}
+	}
+
+	of := av.Overflight{
+		Waypoints: []av.Waypoint{
+			{Fix: "_practice0", Location: p},
+			{Fix: icao, Location: ap.Location},
+		},
+		InitialAltitudes: util.SingleOrArray[int]{alt},
+		CruiseAltitude:   float32(alt),
+		InitialSpeed:     perf.Speed.CruiseTAS,
+	}
+	if err := ac.InitializeOverflight(&of, "", nmPerLongitude, magneticVariation, s.State /* wind */, s.lg); err != nil {
+		return err
+	}
+
+	// Call whoever owns the airspace, if anyone does.
+	pa.Controller = s.State.AirspaceOwner(p, float32(alt))
+	if !s.isActiveHumanController(pa.Controller) {
+		pa.Controller = s.ResolveController(ap.DepartureController)
+	}
+	ac.ControllingController = pa.Controller
+
+	s.addAircraftNoLock(*ac)
+	if s.PracticeApproaches == nil {
+		s.PracticeApproaches = make(map[string]*PracticeApproach)
+	}
+	s.PracticeApproaches[ac.Callsign] = pa
+
+	hdg := math.Heading2LL(ap.Location, p, nmPerLongitude, magneticVariation)
+	dist := int(math.NMDistance2LL(ap.Location, p) + 0.5)
+	s.postRadioEvents(ac.Callsign, []av.RadioTransmission{av.RadioTransmission{
+		Controller: pa.Controller,
+		Message: fmt.Sprintf("%d miles %s of %s, %s, %s", dist, math.Compass(hdg), dbap.Name,
+			av.FormatAltitude(float32(alt)), pa.requestMessage(ap)),
+		Type: av.RadioTransmissionContact,
+	}})
+	s.lg.Info("practice approach request", slog.String("callsign", ac.Callsign),
+		slog.String("airport", icao), slog.String("approach", pa.Approach), slog.Bool("ifr", pa.IFR))
+	return nil
+}
+
+// CreateLocalFlightPlan creates a local flight plan for a VFR aircraft
+// that is talking to the controller, assigns it a beacon code, and starts
+// a track. If the aircraft has asked for practice approaches, the plan is
+// for them.
+func (s *Sim) CreateLocalFlightPlan(tcp, callsign string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	return s.dispatchCommand(tcp, callsign,
+		func(tcp string, ac *av.Aircraft) error {
+			if ac.ControllingController != tcp {
+				return av.ErrOtherControllerHasTrack
+			} else if ac.TrackingController != "" {
+				return av.ErrOtherControllerHasTrack
+			} else if ac.FlightPlan == nil || ac.FlightPlan.Rules != av.VFR {
+				return ErrNotVFR
+			}
+			return nil
+		},
+		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			comp := s.State.STARSComputer()
+			sq, err := comp.CreateSquawk(ac.Callsign, &s.Rand)
+			if err != nil {
+				s.lg.Warnf("%s: unable to allocate local beacon code: %v", ac.Callsign, err)
+				return nil
+			}
+			ac.FlightPlan.AssignedSquawk = sq
+
+			pa := s.PracticeApproaches[ac.Callsign]
+			msg := ""
+			if pa != nil {
+				pa.Planned = true
+				pa.Controller = tcp
+				ac.Scratchpad = pa.Approach
+				if pa.IFR {
+					ac.FlightPlan.Rules = av.IFR
+					alt := float32(1000 * int((ac.Altitude()+500)/1000))
+					ac.FlightPlan.Altitude = int(alt)
+					ac.Nav.Altitude = av.NavAltitude{Assigned: &alt}
+					msg = ", maintain " + av.FormatAltitude(alt)
+				} else if !pa.Separation {
+					msg = ", maintain VFR, no separation services"
+				} else {
+					msg = ", maintain VFR"
+				}
+			}
+
+			fp := av.MakeSTARSFlightPlan(ac.FlightPlan)
+			fp.FlightPlanType = av.LocalNonEnroute
+			fp.SP1 = ac.Scratchpad
+			ac.TrackingController = tcp
+			if err := comp.InitiateTrack(ac.Callsign, tcp, fp, true); err != nil {
+				s.lg.Warnf("%s: InitiateTrack: %v", ac.Callsign, err)
+			}
+			s.eventStream.Post(Event{
+				Type:         InitiatedTrackEvent,
+				Callsign:     ac.Callsign,
+				ToController: tcp,
+			})
+
+			rt := s.changeSquawkWithErrors(tcp, ac, sq)
+			for i := range rt {
+				rt[i].Message += msg
+			}
+			return rt
+		})
+}
+
+// practiceArrivalDelay returns how much a practice approach to the
+// airport pushes back the arrival flows to it: the time of one slot at
+// their combined rate.
+func (s *Sim) practiceArrivalDelay(airport string) time.Duration {
+	var rate float32
+	for group := range s.State.LaunchConfig.InboundFlowRates {
+		rate += scaleRate(s.inboundFlowRates(group)[airport], s.State.LaunchConfig.InboundFlowRateScale)
+	}
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Hour) / float64(rate))
+}
+
+// updatePracticeApproaches is called once a second.
+func (s *Sim) updatePracticeApproaches() {
+	now := s.clock.Now()
+	if rate := s.State.LaunchConfig.PracticeApproachRate; rate > 0 && !now.Before(s.NextPracticeApproachSpawn) {
+		if !s.NextPracticeApproachSpawn.IsZero() {
+			if err := s.createPracticeApproach(); err != nil {
+				s.lg.Info("unable to create practice approach", slog.Any("error", err))
+			}
+		}
+		s.NextPracticeApproachSpawn = now.Add(poissonWait(&s.Rand, rate))
+	}
+
+	for _, callsign := range util.SortedMapKeys(s.PracticeApproaches) {
+		pa := s.PracticeApproaches[callsign]
+		ac, ok := s.State.Aircraft[callsign]
+		if !ok {
+			delete(s.PracticeApproaches, callsign)
+			continue
+		}
+		if !ac.Nav.Approach.Cleared {
+			continue
+		}
+
+		if !pa.Slotted {
+			// Make room for it in the arrival flow.
+			pa.Slotted = true
+			if d := s.practiceArrivalDelay(pa.Airport); d > 0 {
+				for group, rates := range s.State.LaunchConfig.InboundFlowRates {
+					if rates[pa.Airport] > 0 {
+						s.NextInboundSpawn[group] = s.NextInboundSpawn[group].Add(d)
+					}
+				}
+			}
+		}
+
+		if d, err := ac.DistanceToEndOfApproach(); pa.LowApproaches > 0 && err == nil && d < .25 {
+			s.lowApproach(ac, pa)
+		}
+	}
+}
+
+// lowApproach has the aircraft climb out from a practice approach and
+// return to the controller that is working it.
+func (s *Sim) lowApproach(ac *av.Aircraft, pa *PracticeApproach) {
+	if appr := ac.Nav.Approach.Assigned; appr != nil {
+		s.occupyRunway(pa.Airport, appr.Runway, 20*time.Second)
+	}
+	ac.Nav.GoAround()
+	ac.GotContactTower = false
+	delete(s.StabilityChecked, ac.Callsign)
+	pa.LowApproaches--
+	pa.Slotted = false
+
+	ac.ControllingController = pa.Controller
+	if ac.TrackingController != "" && ac.TrackingController != pa.Controller {
+		ac.HandoffTrackController = pa.Controller
+		s.eventStream.Post(Event{
+			Type:           OfferedHandoffEvent,
+			Callsign:       ac.Callsign,
+			FromController: ac.TrackingController,
+			ToController:   pa.Controller,
+		})
+	}
+
+	ap := s.State.Airports[pa.Airport]
+	s.postRadioEvents(ac.Callsign, []av.RadioTransmission{av.RadioTransmission{
+		Controller: pa.Controller,
+		Message:    "low approach complete, " + pa.requestMessage(ap),
+		Type:       av.RadioTransmissionContact,
+	}})
+	s.lg.Info("practice low approach", slog.String("callsign", ac.Callsign),
+		slog.Int("remaining", pa.LowApproaches))
+}
@@ -0,0 +1,104 @@
+// pkg/sim/practice_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+func TestPracticeApproaches(t *testing.T) {
+	ils := &av.Approach{Id: "I6", FullName: "ILS Runway 6", Runway: "6"}
+	ap := &av.Airport{
+		Name: "Oakville",
+		Approaches: map[string]*av.Approach{
+			"I6":  ils,
+			"R24": {Id: "R24", FullName: "RNAV Runway 24", Runway: "24"},
+		},
+	}
+
+	start := time.Date(2024, 6, 1, 15, 4, 0, 0, time.UTC)
+	ac := &av.Aircraft{Callsign: "N123AB", TrackingController: "TWR", ControllingController: "TWR",
+		FlightPlan: &av.FlightPlan{Rules: av.VFR, ArrivalAirport: "KOAK"}}
+	ac.Nav.FlightState.Position = math.Point2LL{0.5, 0.5}
+	ac.Nav.FlightState.ArrivalAirportLocation = math.Point2LL{0.5, 0.5}
+	ac.Nav.Approach.Assigned = ils
+	ac.Nav.Approach.Cleared = true
+
+	state := &State{
+		Aircraft:       map[string]*av.Aircraft{"N123AB": ac},
+		Airports:       map[string]*av.Airport{"KOAK": ap},
+		ArrivalRunways: []ArrivalRunway{{Airport: "KOAK", Runway: "6"}},
+		SimTime:        start,
+	}
+	state.LaunchConfig.InboundFlowRates = map[string]map[string]float32{
+		"east": {"KOAK": 20},
+		"west": {"KOAK": 10, "KSFO": 30},
+	}
+	state.LaunchConfig.InboundFlowRateScale = 1
+	s := newTestSim(t, state)
+	s.NextInboundSpawn = map[string]time.Time{"east": start, "west": start}
+	s.PracticeApproaches = map[string]*PracticeApproach{
+		"N123AB": {Airport: "KOAK", Approach: "I6", LowApproaches: 1, Controller: "1A", Planned: true},
+	}
+	sub := s.eventStream.Subscribe()
+
+	if c := s.practiceApproachCandidates(); len(c) != 1 || c[0] != [2]string{"KOAK", "I6"} {
+		t.Errorf("candidates %v: expected KOAK I6", c)
+	}
+	// 30 an hour arriving at KOAK, so a slot is two minutes.
+	if d := s.practiceArrivalDelay("KOAK"); d != 2*time.Minute {
+		t.Errorf("arrival delay %s: expected 2m", d)
+	}
+
+	// Cleared and over the runway: the aircraft takes a slot and makes its
+	// low approach.
+	s.updatePracticeApproaches()
+	pa := s.PracticeApproaches["N123AB"]
+	for _, group := range []string{"east", "west"} {
+		if n := s.NextInboundSpawn[group]; !n.Equal(start.Add(2 * time.Minute)) {
+			t.Errorf("%s: next inbound %s, expected 2 minutes later", group, n)
+		}
+	}
+	if pa.LowApproaches != 0 || ac.Nav.Approach.Cleared || ac.ControllingController != "1A" ||
+		ac.HandoffTrackController != "1A" {
+		t.Errorf("after low approach: %d remaining, cleared %v, controlling %q, handoff %q", pa.LowApproaches,
+			ac.Nav.Approach.Cleared, ac.ControllingController, ac.HandoffTrackController)
+	}
+	if !s.runwayOccupied("KOAK", "6") {
+		t.Errorf("runway 6 not occupied after low approach")
+	}
+	var msgs []string
+	for _, e := range sub.Get() {
+		if e.Type == RadioTransmissionEvent {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	if len(msgs) != 1 || msgs[0] != "low approach complete, request practice ILS Runway 6, VFR, full stop" {
+		t.Errorf("unexpected transmissions %v", msgs)
+	}
+
+	// Cleared again for the last one; it's slotted but lands rather than
+	// making another low approach.
+	ac.Nav.Approach.Assigned = ils
+	ac.Nav.Approach.Cleared = true
+	s.updatePracticeApproaches()
+	if !pa.Slotted || !ac.Nav.Approach.Cleared {
+		t.Errorf("full stop: slotted %v, cleared %v", pa.Slotted, ac.Nav.Approach.Cleared)
+	}
+	if n := s.NextInboundSpawn["east"]; !n.Equal(start.Add(4 * time.Minute)) {
+		t.Errorf("next inbound %s, expected 4 minutes later", n)
+	}
+
+	// It's forgotten once it has landed.
+	delete(s.State.Aircraft, "N123AB")
+	s.updatePracticeApproaches()
+	if len(s.PracticeApproaches) != 0 {
+		t.Errorf("practice approach not removed")
+	}
+}
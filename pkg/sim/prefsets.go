@@ -0,0 +1,40 @@
+// pkg/sim/prefsets.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"log/slog"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+// Each position's saved STARS preference sets are kept in the sim as well
+// as in the user's config, so that whoever signs in to the position--after
+// reconnecting, from another computer, or to relieve another
+// controller--can recall them by number. The sim doesn't interpret them;
+// they're the scope's JSON-encoded saved sets.
+
+// Preference sets larger than this are rejected.
+const maxPreferenceSetsSize = 1 << 20
+
+func (s *Sim) SetPreferenceSets(tcp string, prefs []byte) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.isActiveHumanController(tcp) {
+		return av.ErrNoController
+	}
+	if len(prefs) > maxPreferenceSetsSize {
+		return ErrPreferenceSetsTooLarge
+	}
+	if s.State.PreferenceSets == nil {
+		s.State.PreferenceSets = make(map[string][]byte)
+	}
+	s.State.PreferenceSets[tcp] = prefs
+
+	s.lg.Debug("preference sets", slog.String("tcp", tcp), slog.Int("size", len(prefs)))
+
+	return nil
+}
@@ -0,0 +1,107 @@
+// pkg/sim/priority.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+// Flights from some traffic profiles have special handling indicators in
+// their flight plans (see aviation/profiles.go) and the pilots mention
+// them on check-in. Controllers are expected to honor them: lifeguard
+// (MEDEVAC) flights shouldn't be held or slowed, and flights on an
+// altitude reservation (ALTRV) shouldn't be held or moved off of their
+// reserved altitude once they're at it. A PriorityHandlingEvent is posted
+// when a controller doesn't; the scoring rule for them is in scoring.go.
+//
+// Pilots may also declare minimum fuel or an emergency (see
+// emergency.go). Those are recorded with the aircraft and sent to the
+// facilities with its flight plan as an amendment, along with the filed
+// priority status. Flights with priority status aren't metered for
+// traffic management restrictions.
+
+const (
+	stsMedevac = "MEDEVAC"
+	stsALTRV   = "ALTRV"
+)
+
+// priorityCheckIn returns the part of a priority flight's initial contact
+// that identifies it as one.
+func priorityCheckIn(ac *av.Aircraft) string {
+	switch {
+	case ac.FlightPlan == nil:
+		return ""
+	case ac.FlightPlan.HasSpecialHandling(stsMedevac):
+		return ", lifeguard"
+	case ac.FlightPlan.HasSpecialHandling(stsALTRV):
+		return ", on an ALTRV at " + av.FormatAltitude(float32(ac.FlightPlan.Altitude))
+	default:
+		return ""
+	}
+}
+
+// declarePriority records priority status declared by the pilot and
+// amends the flight plan to include it.
+func (s *Sim) declarePriority(ac *av.Aircraft, p av.PriorityFlags) {
+	ac.DeclaredPriority |= p
+	if ac.FlightPlan == nil {
+		return
+	}
+	facility := s.State.TRACON
+	if ctrl, ok := s.State.Controllers[ac.TrackingController]; ok && ctrl.Facility != "" {
+		facility = ctrl.Facility
+	}
+	if err := s.State.ERAMComputers.AmendFlightPlan(ac, facility, s.State.SimTime); err != nil {
+		s.lg.Warnf("%s: priority amendment: %v", ac.Callsign, err)
+	}
+}
+
+func (s *Sim) priorityHandlingMissed(tcp string, ac *av.Aircraft, sts, what string) {
+	msg := sts + ": " + what
+	s.lg.Info("priority handling", slog.String("callsign", ac.Callsign), slog.String("message", msg))
+	s.eventStream.Post(Event{
+		Type:         PriorityHandlingEvent,
+		Callsign:     ac.Callsign,
+		ToController: tcp,
+		Message:      msg,
+	})
+}
+
+// checkPriorityHold is called when a controller tells an aircraft to hold.
+func (s *Sim) checkPriorityHold(tcp string, ac *av.Aircraft, fix string) {
+	if ac.FlightPlan == nil {
+		return
+	}
+	for _, sts := range []string{stsMedevac, stsALTRV} {
+		if ac.FlightPlan.HasSpecialHandling(sts) {
+			s.priorityHandlingMissed(tcp, ac, sts, "told to hold at "+fix)
+			return
+		}
+	}
+}
+
+// checkPrioritySpeed is called when a controller assigns a speed.
+func (s *Sim) checkPrioritySpeed(tcp string, ac *av.Aircraft, speed int) {
+	if ac.FlightPlan != nil && ac.FlightPlan.HasSpecialHandling(stsMedevac) &&
+		speed > 0 && float32(speed) < ac.Nav.FlightState.IAS-10 && !ac.OnApproach(false) {
+		s.priorityHandlingMissed(tcp, ac, stsMedevac, fmt.Sprintf("slowed to %d knots", speed))
+	}
+}
+
+// checkPriorityAltitude is called when a controller assigns an altitude.
+func (s *Sim) checkPriorityAltitude(tcp string, ac *av.Aircraft, altitude int) {
+	if ac.FlightPlan == nil || !ac.FlightPlan.HasSpecialHandling(stsALTRV) {
+		return
+	}
+	reserved := ac.FlightPlan.Altitude
+	if altitude != reserved && math.Abs(ac.Altitude()-float32(reserved)) < 500 {
+		s.priorityHandlingMissed(tcp, ac, stsALTRV, fmt.Sprintf("moved off reserved altitude %s to %s",
+			av.FormatAltitude(float32(reserved)), av.FormatAltitude(float32(altitude))))
+	}
+}
@@ -0,0 +1,228 @@
+// pkg/sim/probe.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// The ERAM conflict probe predicts each IFR aircraft's trajectory along
+// its route for the next few minutes and reports the pairs that are
+// expected to lose en route separation. The same prediction is used for
+// trial planning: a controller can check a proposed route or altitude
+// amendment for conflicts before issuing it.
+
+// ProbeConflict is a predicted loss of separation between two aircraft.
+type ProbeConflict struct {
+	Callsign, Other string
+	Time            time.Time // first predicted loss of separation
+	LateralNM       float32   // at closest approach
+	VerticalFt      float32
+}
+
+const (
+	probeInterval   = 12 * time.Second // ERAM reprobes at its update cycle
+	probeHorizon    = 20 * time.Minute
+	probeStep       = 30 * time.Second
+	probeLateralNM  = 5
+	probeVerticalFt = 1000
+)
+
+// trajectoryPoint is a predicted position of an aircraft.
+type trajectoryPoint struct {
+	P        math.Point2LL
+	Altitude float32
+}
+
+// parseProbeRoute returns the locations of the fixes in a route string;
+// airways and other things that can't be located are skipped.
+func (ss *State) parseProbeRoute(route string) []math.Point2LL {
+	var pts []math.Point2LL
+	for _, f := range strings.Fields(route) {
+		if p, ok := ss.Locate(f); ok {
+			pts = append(pts, p)
+		}
+	}
+	return pts
+}
+
+// predictTrajectory predicts where the aircraft will be at each step over
+// the given horizon if it flies the given route at its current
+// groundspeed, climbing or descending to the given altitude. Once it
+// reaches the end of the route (or if it's being vectored), it is assumed
+// to continue on its current heading.
+func (ss *State) predictTrajectory(ac *av.Aircraft, route []math.Point2LL, altitude float32,
+	step, horizon time.Duration) []trajectoryPoint {
+	nmPerLongitude, magVar := ss.NmPerLongitude, ss.MagneticVariation
+	gs := math.Max(ac.GS(), 100)
+	perf := ac.AircraftPerformance()
+
+	p, alt := ac.Position(), ac.Altitude()
+	hdg := ac.Heading()
+	traj := make([]trajectoryPoint, 0, int(horizon/step))
+
+	for t := step; t <= horizon; t += step {
+		// Move along the route.
+		dist := gs * float32(step.Hours())
+		for dist > 0 {
+			if len(route) == 0 {
+				p = math.Offset2LL(p, hdg, dist, nmPerLongitude, magVar)
+				break
+			}
+			if d := math.NMDistance2LL(p, route[0]); d > dist {
+				hdg = math.Heading2LL(p, route[0], nmPerLongitude, magVar)
+				p = math.Offset2LL(p, hdg, dist, nmPerLongitude, magVar)
+				break
+			} else {
+				if d > 0.01 {
+					hdg = math.Heading2LL(p, route[0], nmPerLongitude, magVar)
+				}
+				p, route = route[0], route[1:]
+				dist -= d
+			}
+		}
+
+		minutes := float32(step.Minutes())
+		if alt < altitude {
+			alt = math.Min(altitude, alt+perf.Rate.Climb*minutes)
+		} else {
+			alt = math.Max(altitude, alt-perf.Rate.Descent*minutes)
+		}
+
+		traj = append(traj, trajectoryPoint{P: p, Altitude: alt})
+	}
+	return traj
+}
+
+// probeCandidate returns whether the aircraft should be included in the
+// conflict probe. Only IFRs tracked by en route controllers are; TRACON
+// traffic is routinely closer than the en route standard.
+func (ss *State) probeCandidate(ac *av.Aircraft) bool {
+	if !ac.IsAirborne() || ac.FlightPlan == nil || ac.FlightPlan.Rules != av.IFR {
+		return false
+	}
+	ctrl, ok := ss.Controllers[ac.TrackingController]
+	return ok && ctrl.ERAMFacility
+}
+
+// probeTrajectories returns the predicted trajectories of all of the
+// aircraft that are probed.
+func (ss *State) probeTrajectories() map[string][]trajectoryPoint {
+	traj := make(map[string][]trajectoryPoint)
+	for callsign, ac := range ss.Aircraft {
+		if in, ok := ss.Intent(callsign); ok && ss.probeCandidate(ac) {
+			traj[callsign] = ss.predictTrajectory(ac, in.RoutePoints(), in.TargetAltitude, probeStep, probeHorizon)
+		}
+	}
+	return traj
+}
+
+// probeConflict checks a pair of trajectories for a loss of separation,
+// returning the time step at which it first happens and the separation
+// at the closest approach.
+func probeConflict(a, b []trajectoryPoint) (step int, lateral, vertical float32, ok bool) {
+	step = -1
+	lateral = 1e30
+	for i := range min(len(a), len(b)) {
+		v := math.Abs(a[i].Altitude - b[i].Altitude)
+		if v >= probeVerticalFt {
+			continue
+		}
+		l := math.NMDistance2LL(a[i].P, b[i].P)
+		if l >= probeLateralNM {
+			continue
+		}
+		if step == -1 {
+			step = i
+		}
+		if l < lateral {
+			lateral, vertical = l, v
+		}
+	}
+	return step, lateral, vertical, step != -1
+}
+
+// probeConflicts returns the predicted conflicts involving the given
+// aircraft (or all of them, if callsign is ""), with trajectories given
+// by traj.
+func (ss *State) probeConflicts(traj map[string][]trajectoryPoint, callsign string) []ProbeConflict {
+	var conflicts []ProbeConflict
+	callsigns := util.SortedMapKeys(traj)
+	for i, cs0 := range callsigns {
+		for _, cs1 := range callsigns[i+1:] {
+			if callsign != "" && cs0 != callsign && cs1 != callsign {
+				continue
+			}
+			if step, l, v, ok := probeConflict(traj[cs0], traj[cs1]); ok {
+				c := ProbeConflict{
+					Callsign:   cs0,
+					Other:      cs1,
+					Time:       ss.SimTime.Add(time.Duration(step+1) * probeStep),
+					LateralNM:  l,
+					VerticalFt: v,
+				}
+				if cs1 == callsign {
+					c.Callsign, c.Other = c.Other, c.Callsign
+				}
+				conflicts = append(conflicts, c)
+			}
+		}
+	}
+	slices.SortFunc(conflicts, func(a, b ProbeConflict) int { return a.Time.Compare(b.Time) })
+	return conflicts
+}
+
+// updateConflictProbe reprobes all of the aircraft if it's time to; it's
+// called once a second.
+func (s *Sim) updateConflictProbe() {
+	if s.State.SimTime.Sub(s.lastProbe) < probeInterval {
+		return
+	}
+	s.lastProbe = s.State.SimTime
+	s.State.ProbeConflicts = s.State.probeConflicts(s.State.probeTrajectories(), "")
+}
+
+// TrialPlan returns the conflicts that the aircraft would have if its
+// route or altitude were amended as given. An empty route or zero
+// altitude leaves that part of its clearance unchanged.
+func (s *Sim) TrialPlan(tcp, callsign, route string, altitude int) ([]ProbeConflict, error) {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	ac, ok := s.State.Aircraft[callsign]
+	if !ok {
+		return nil, av.ErrNoAircraftForCallsign
+	}
+
+	in, ok := s.State.Intent(callsign)
+	if !ok {
+		in = ac.Intent()
+	}
+	rt := in.RoutePoints()
+	if route != "" {
+		if rt = s.State.parseProbeRoute(route); len(rt) == 0 {
+			return nil, ErrInvalidRoute
+		}
+	}
+	alt := in.TargetAltitude
+	if altitude != 0 {
+		alt = float32(altitude)
+	}
+
+	traj := s.State.probeTrajectories()
+	traj[callsign] = s.State.predictTrajectory(ac, rt, alt, probeStep, probeHorizon)
+
+	s.lg.Info("trial plan", slog.String("tcp", tcp), slog.String("callsign", callsign),
+		slog.String("route", route), slog.Int("altitude", altitude))
+
+	return s.State.probeConflicts(traj, callsign), nil
+}
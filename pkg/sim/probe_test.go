@@ -0,0 +1,214 @@
+// pkg/sim/probe_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+const probeTestNmPerLongitude = 45.4
+
+// probeTestPoint returns the point the given distances north and east of
+// a reference point.
+func probeTestPoint(northNM, eastNM float32) math.Point2LL {
+	return math.Point2LL{-74 + eastNM/probeTestNmPerLongitude, 40 + northNM/60}
+}
+
+func TestPredictTrajectory(t *testing.T) {
+	ss := &State{NmPerLongitude: probeTestNmPerLongitude}
+	makeAircraft := func(gs, alt, hdg float32) *av.Aircraft {
+		ac := &av.Aircraft{Callsign: "AAL1"}
+		ac.Nav.FlightState = av.FlightState{Position: probeTestPoint(0, 0), GS: gs, Altitude: alt, Heading: hdg}
+		ac.Nav.Perf.Rate.Climb = 2000
+		ac.Nav.Perf.Rate.Descent = 1500
+		return ac
+	}
+
+	for _, test := range []struct {
+		name     string
+		ac       *av.Aircraft
+		route    []math.Point2LL
+		altitude float32
+		expected []trajectoryPoint // north and east in nm for P
+	}{
+		{
+			// It flies to the fix 10nm east and then continues on the
+			// same heading, climbing at its climb rate.
+			name:     "route then heading",
+			ac:       makeAircraft(300, 5000, 90),
+			route:    []math.Point2LL{probeTestPoint(0, 10)},
+			altitude: 9000,
+			expected: []trajectoryPoint{{P: math.Point2LL{0, 5}, Altitude: 7000}, {P: math.Point2LL{0, 10}, Altitude: 9000},
+				{P: math.Point2LL{0, 15}, Altitude: 9000}, {P: math.Point2LL{0, 20}, Altitude: 9000}},
+		},
+		{
+			// It turns north at the first fix.
+			name:     "turn at fix",
+			ac:       makeAircraft(300, 5000, 90),
+			route:    []math.Point2LL{probeTestPoint(0, 5), probeTestPoint(20, 5)},
+			altitude: 2000,
+			expected: []trajectoryPoint{{P: math.Point2LL{0, 5}, Altitude: 3500}, {P: math.Point2LL{5, 5}, Altitude: 2000},
+				{P: math.Point2LL{10, 5}, Altitude: 2000}, {P: math.Point2LL{15, 5}, Altitude: 2000}},
+		},
+		{
+			// Vectored at a groundspeed that's taken to be at least 100
+			// knots.
+			name:     "vectored",
+			ac:       makeAircraft(0, 5000, 0),
+			altitude: 5000,
+			expected: []trajectoryPoint{{P: math.Point2LL{100. / 60, 0}, Altitude: 5000}, {P: math.Point2LL{200. / 60, 0}, Altitude: 5000},
+				{P: math.Point2LL{300. / 60, 0}, Altitude: 5000}, {P: math.Point2LL{400. / 60, 0}, Altitude: 5000}},
+		},
+	} {
+		traj := ss.predictTrajectory(test.ac, test.route, test.altitude, time.Minute, 4*time.Minute)
+		if len(traj) != len(test.expected) {
+			t.Errorf("%s: got %d points, expected %d", test.name, len(traj), len(test.expected))
+			continue
+		}
+		for i, pt := range traj {
+			exp := test.expected[i]
+			p := probeTestPoint(exp.P[0], exp.P[1])
+			if d := math.NMDistance2LL(pt.P, p); d > 0.1 || pt.Altitude != exp.Altitude {
+				t.Errorf("%s: step %d: got %v at %.0f, %.2f nm from expected %v at %.0f", test.name, i,
+					pt.P, pt.Altitude, d, p, exp.Altitude)
+			}
+		}
+	}
+}
+
+func TestProbeConflict(t *testing.T) {
+	// a is stationary at 10,000'; b is north of it at the given
+	// distances.
+	makeTrajectories := func(alt float32, north ...float32) ([]trajectoryPoint, []trajectoryPoint) {
+		var a, b []trajectoryPoint
+		for _, n := range north {
+			a = append(a, trajectoryPoint{P: probeTestPoint(0, 0), Altitude: 10000})
+			b = append(b, trajectoryPoint{P: probeTestPoint(n, 0), Altitude: alt})
+		}
+		return a, b
+	}
+
+	for _, test := range []struct {
+		name              string
+		alt               float32
+		north             []float32
+		step              int
+		lateral, vertical float32
+		ok                bool
+	}{
+		{name: "converging", alt: 10500, north: []float32{20, 10, 4, 2, 6}, step: 2, lateral: 2, vertical: 500, ok: true},
+		{name: "vertically separated", alt: 11000, north: []float32{20, 10, 4, 2, 6}},
+		{name: "laterally separated", alt: 10000, north: []float32{20, 10, 5.5, 6, 10}},
+		{name: "same altitude", alt: 10000, north: []float32{4.9, 3, 1, 8}, step: 0, lateral: 1, vertical: 0, ok: true},
+		{name: "empty", alt: 10000},
+	} {
+		a, b := makeTrajectories(test.alt, test.north...)
+		step, l, v, ok := probeConflict(a, b)
+		if ok != test.ok {
+			t.Errorf("%s: got conflict %v, expected %v", test.name, ok, test.ok)
+		} else if ok && (step != test.step || math.Abs(l-test.lateral) > 0.05 || v != test.vertical) {
+			t.Errorf("%s: got step %d, %.2f nm, %.0f ft; expected step %d, %.2f nm, %.0f ft", test.name,
+				step, l, v, test.step, test.lateral, test.vertical)
+		}
+	}
+
+	// Only the time span that both trajectories cover is checked.
+	a, b := makeTrajectories(10000, 20, 10, 1)
+	if _, _, _, ok := probeConflict(a[:2], b); ok {
+		t.Errorf("unexpected conflict past the end of a trajectory")
+	}
+}
+
+func TestProbeConflicts(t *testing.T) {
+	now := time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)
+	ss := &State{SimTime: now}
+
+	stationary := func(northNM, alt float32) []trajectoryPoint {
+		return slices.Repeat([]trajectoryPoint{{P: probeTestPoint(northNM, 0), Altitude: alt}}, 5)
+	}
+	// UAL3 descends through DAL2's altitude at step 1 and through AAL1's
+	// at step 3; AAL1 and DAL2 are 8nm apart, 4nm to either side of it.
+	ual3 := stationary(4, 0)
+	for i, alt := range []float32{20000, 17000, 15000, 12000, 12000} {
+		ual3[i].Altitude = alt
+	}
+	traj := map[string][]trajectoryPoint{
+		"AAL1": stationary(0, 12000),
+		"DAL2": stationary(8, 17000),
+		"UAL3": ual3,
+	}
+
+	for _, test := range []struct {
+		callsign string
+		expected []ProbeConflict
+	}{
+		{"", []ProbeConflict{
+			{Callsign: "DAL2", Other: "UAL3", Time: now.Add(2 * probeStep), LateralNM: 4},
+			{Callsign: "AAL1", Other: "UAL3", Time: now.Add(4 * probeStep), LateralNM: 4},
+		}},
+		// The given aircraft is always first.
+		{"UAL3", []ProbeConflict{
+			{Callsign: "UAL3", Other: "DAL2", Time: now.Add(2 * probeStep), LateralNM: 4},
+			{Callsign: "UAL3", Other: "AAL1", Time: now.Add(4 * probeStep), LateralNM: 4},
+		}},
+		{"AAL1", []ProbeConflict{
+			{Callsign: "AAL1", Other: "UAL3", Time: now.Add(4 * probeStep), LateralNM: 4},
+		}},
+	} {
+		c := ss.probeConflicts(traj, test.callsign)
+		if len(c) != len(test.expected) {
+			t.Errorf("%q: got %+v, expected %+v", test.callsign, c, test.expected)
+			continue
+		}
+		for i := range c {
+			// Round the lateral separation, which isn't exactly 4nm, to
+			// compare.
+			c[i].LateralNM = float32(int(c[i].LateralNM + 0.5))
+			if c[i] != test.expected[i] {
+				t.Errorf("%q: got %+v, expected %+v", test.callsign, c[i], test.expected[i])
+			}
+		}
+	}
+}
+
+func TestProbeCandidate(t *testing.T) {
+	ss := &State{
+		Controllers: map[string]*av.Controller{
+			"N56": {ERAMFacility: true},
+			"2K":  {},
+		},
+	}
+
+	for _, test := range []struct {
+		name     string
+		rules    av.FlightRules
+		ctrl     string
+		ias      float32
+		noPlan   bool
+		expected bool
+	}{
+		{name: "en route IFR", rules: av.IFR, ctrl: "N56", ias: 250, expected: true},
+		{name: "VFR", rules: av.VFR, ctrl: "N56", ias: 250},
+		{name: "TRACON", rules: av.IFR, ctrl: "2K", ias: 250},
+		{name: "untracked", rules: av.IFR, ias: 250},
+		{name: "no flight plan", ctrl: "N56", ias: 250, noPlan: true},
+		{name: "on the ground", rules: av.IFR, ctrl: "N56"},
+	} {
+		ac := &av.Aircraft{Callsign: "AAL1", TrackingController: test.ctrl}
+		ac.Nav.FlightState.IAS = test.ias
+		ac.Nav.Perf.Speed.V2 = 140
+		if !test.noPlan {
+			ac.FlightPlan = &av.FlightPlan{Rules: test.rules}
+		}
+		if c := ss.probeCandidate(ac); c != test.expected {
+			t.Errorf("%s: got %v, expected %v", test.name, c, test.expected)
+		}
+	}
+}
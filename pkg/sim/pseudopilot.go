@@ -0,0 +1,140 @@
+// pkg/sim/pseudopilot.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"regexp"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+// Pseudo-pilots are users who fly aircraft in place of vice's automatic
+// pilots. A pseudo-pilot claims aircraft; from then on, instructions that
+// controllers issue to those aircraft aren't executed but are instead
+// sent to the pseudo-pilot as text (as PseudoPilotInstructionEvents). The
+// pseudo-pilot then flies the aircraft using a limited set of
+// commands--headings, altitudes, speeds, and approaches--which generate
+// readbacks to the controller as usual. Everything else (flying the
+// route, contacting the next controller, etc.) is still done
+// automatically.
+
+// pseudoPilotCommandRE matches the commands that pseudo-pilots may issue:
+// headings and turns, altitudes, speeds, expect, cleared, and intercept
+// approach, expedites, and say speed/altitude/heading.
+var pseudoPilotCommandRE = regexp.MustCompile(`^(H\d*|[LR]\d+D?|[ACD]\d+|S(\d*|MIN|MAX|S|A|H)|E[A-Z0-9]+|C[A-Z0-9]+|I)$`)
+
+// PseudoPilotCommandAllowed returns true if the given aircraft command
+// (in the syntax used in RunAircraftCommands) may be issued by a
+// pseudo-pilot: headings, altitudes, speeds, approaches, and the related
+// expedite and "say" commands. Holds, directs, fix crossings, squawk
+// changes, and the like aren't allowed.
+func PseudoPilotCommandAllowed(command string) bool {
+	if command == "CAC" || command == "CVS" {
+		// These look like approach clearances but aren't.
+		return false
+	}
+	return pseudoPilotCommandRE.MatchString(command)
+}
+
+// PseudoPilotFor returns the pseudo-pilot that is flying the given
+// aircraft or the empty string if the aircraft is flown automatically.
+func (s *Sim) PseudoPilotFor(callsign string) string {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	return s.PseudoPilotAircraft[callsign]
+}
+
+func (s *Sim) isPseudoPilotFor(tcp, callsign string) bool {
+	return s.PseudoPilots[tcp] && s.PseudoPilotAircraft[callsign] == tcp
+}
+
+// ClaimPseudoPilotAircraft makes the given pseudo-pilot responsible for
+// flying the aircraft.
+func (s *Sim) ClaimPseudoPilotAircraft(tcp, callsign string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.PseudoPilots[tcp] {
+		return ErrNotPseudoPilot
+	} else if _, ok := s.State.Aircraft[callsign]; !ok {
+		return av.ErrNoAircraftForCallsign
+	} else if pp, ok := s.PseudoPilotAircraft[callsign]; ok && pp != tcp {
+		return ErrAircraftHasPseudoPilot
+	}
+
+	if s.PseudoPilotAircraft == nil {
+		s.PseudoPilotAircraft = make(map[string]string)
+	}
+	s.PseudoPilotAircraft[callsign] = tcp
+
+	// Clean up after any aircraft that have been deleted.
+	for cs := range s.PseudoPilotAircraft {
+		if _, ok := s.State.Aircraft[cs]; !ok {
+			delete(s.PseudoPilotAircraft, cs)
+		}
+	}
+
+	s.lg.Infof("%s: pseudo-pilot %s now flying", callsign, tcp)
+	return nil
+}
+
+// ReleasePseudoPilotAircraft returns the aircraft to the automatic pilot.
+func (s *Sim) ReleasePseudoPilotAircraft(tcp, callsign string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if pp, ok := s.PseudoPilotAircraft[callsign]; !ok {
+		return av.ErrNoAircraftForCallsign
+	} else if pp != tcp && !s.Instructors[tcp] {
+		return ErrAircraftHasPseudoPilot
+	}
+
+	delete(s.PseudoPilotAircraft, callsign)
+	s.lg.Infof("%s: released by pseudo-pilot %s", callsign, tcp)
+	return nil
+}
+
+// releasePseudoPilot returns all of the given pseudo-pilot's aircraft to
+// the automatic pilot; it's called when they sign off. s.mu must be
+// held.
+func (s *Sim) releasePseudoPilot(tcp string) {
+	for cs, pp := range s.PseudoPilotAircraft {
+		if pp == tcp {
+			delete(s.PseudoPilotAircraft, cs)
+		}
+	}
+	delete(s.PseudoPilots, tcp)
+}
+
+// RelayToPseudoPilot sends the instructions that the given controller
+// issued to an aircraft to the pseudo-pilot flying it.
+func (s *Sim) RelayToPseudoPilot(tcp, callsign, instructions string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	pp, ok := s.PseudoPilotAircraft[callsign]
+	if !ok {
+		return ErrNotPseudoPilot
+	}
+
+	return s.dispatchCommand(tcp, callsign,
+		func(tcp string, ac *av.Aircraft) error {
+			if ac.ControllingController != tcp && !s.Instructors[tcp] {
+				return av.ErrOtherControllerHasTrack
+			}
+			return nil
+		},
+		func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+			s.eventStream.Post(Event{
+				Type:           PseudoPilotInstructionEvent,
+				Callsign:       callsign,
+				FromController: tcp,
+				ToController:   pp,
+				Message:        instructions,
+			})
+			return nil
+		})
+}
@@ -0,0 +1,23 @@
+// pkg/sim/pseudopilot_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import "testing"
+
+func TestPseudoPilotCommandAllowed(t *testing.T) {
+	for _, cmd := range []string{"H", "H270", "L090", "R180", "L20D", "R30D", "A40", "C120", "D60",
+		"S", "S210", "SMIN", "SMAX", "SS", "SA", "SH", "ED", "EC", "EI2L", "CI2L", "CSII2L", "I"} {
+		if !PseudoPilotCommandAllowed(cmd) {
+			t.Errorf("%s: expected command to be allowed", cmd)
+		}
+	}
+	for _, cmd := range []string{"", "ATIS", "APREQ", "ACAMRN/CI2L", "CAC", "CVS", "CCAMRN/A100", "DVS",
+		"DEV", "DCAMRN", "DCAMRN/H090", "HCAMRN", "HCAMRN/L", "ID", "LXD", "SQ", "SQ1200", "SQS", "S2X",
+		"FC", "TO", "X"} {
+		if PseudoPilotCommandAllowed(cmd) {
+			t.Errorf("%s: expected command to be rejected", cmd)
+		}
+	}
+}
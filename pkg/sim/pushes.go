@@ -0,0 +1,265 @@
+// pkg/sim/pushes.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Arrivals at busy airports come in banks rather than at a constant
+// rate. A scenario may define arrival pushes, each of which runs between
+// given times after the sim starts. While one is in progress, its rate
+// curve gives the total arrival rate for the inbound flows it covers;
+// that rate replaces the flows' own arrival rates, divided between the
+// flows by the push's shares and between each flow's airports in
+// proportion to their rates. (Overflights aren't affected.) Between
+// pushes, the flows run at their usual rates, so scenarios with pushes
+// generally give them low ones. The traffic restrictions given for a
+// push are imposed by the TMU when it starts and cancelled when it ends;
+// see tmu.go.
+//
+// The push that's in progress is given by State.ActivePush and arrivals
+// that spawn during each one are counted in batch reports.
+
+// ArrivalPush is a bank of arrivals given in a scenario.
+type ArrivalPush struct {
+	Name         string  `json:"name"`
+	StartMinutes float32 `json:"start_minutes"` // after the sim starts
+	EndMinutes   float32 `json:"end_minutes"`
+	// Inbound flow -> its share of the push's arrivals. If none are
+	// given, all flows with arrivals take part in proportion to their
+	// arrival rates.
+	Flows map[string]float32 `json:"flows,omitempty"`
+	// Arrivals per hour over the course of the push, as [minutes since
+	// it started, rate] pairs; the rate is interpolated between them.
+	Rate [][2]float32 `json:"rate"`
+	// Restrictions the TMU imposes while the push is in progress.
+	TrafficRestrictions []TrafficRestriction `json:"traffic_restrictions,omitempty"`
+}
+
+// ScheduledPush is an ArrivalPush that hasn't yet finished.
+type ScheduledPush struct {
+	ArrivalPush
+	Start, End time.Time
+	Active     bool
+	// Current arrivals per hour, while it's active.
+	CurrentRate float32
+	// Ids of the traffic restrictions imposed for it.
+	Restrictions []int
+}
+
+// ArrivalPushStatus describes the arrival push that is in progress.
+type ArrivalPushStatus struct {
+	Name       string
+	Rate       float32 // arrivals per hour
+	Start, End time.Time
+}
+
+// Validate checks that the push is well-formed; locate gives the
+// locations of fixes.
+func (p ArrivalPush) Validate(locate func(string) (math.Point2LL, bool)) error {
+	if p.Name == "" {
+		return fmt.Errorf("\"name\" must be specified")
+	}
+	if p.StartMinutes < 0 || p.EndMinutes <= p.StartMinutes {
+		return fmt.Errorf("%s: \"end_minutes\" must be after \"start_minutes\", which must be non-negative", p.Name)
+	}
+	if len(p.Rate) == 0 {
+		return fmt.Errorf("%s: \"rate\" must be specified", p.Name)
+	}
+	for i, r := range p.Rate {
+		if r[0] < 0 || r[0] > p.EndMinutes-p.StartMinutes {
+			return fmt.Errorf("%s: rate time %.1f is outside of the push", p.Name, r[0])
+		} else if i > 0 && r[0] <= p.Rate[i-1][0] {
+			return fmt.Errorf("%s: rate times must be increasing", p.Name)
+		} else if r[1] < 0 {
+			return fmt.Errorf("%s: rates must be non-negative", p.Name)
+		}
+	}
+	for flow, share := range p.Flows {
+		if share <= 0 {
+			return fmt.Errorf("%s: %s: share must be positive", p.Name, flow)
+		}
+	}
+	for _, r := range p.TrafficRestrictions {
+		if err := r.Validate(locate); err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// rateAt returns the push's arrival rate the given number of minutes
+// after it started.
+func (p ArrivalPush) rateAt(minutes float32) float32 {
+	r := p.Rate
+	if minutes <= r[0][0] {
+		return r[0][1]
+	}
+	for i := 1; i < len(r); i++ {
+		if minutes <= r[i][0] {
+			t := (minutes - r[i-1][0]) / (r[i][0] - r[i-1][0])
+			return math.Lerp(t, r[i-1][1], r[i][1])
+		}
+	}
+	return r[len(r)-1][1]
+}
+
+func (s *Sim) scheduleArrivalPushes(pushes []ArrivalPush) {
+	for _, p := range pushes {
+		minutes := func(m float32) time.Time {
+			return s.State.SimTime.Add(time.Duration(float64(m) * float64(time.Minute)))
+		}
+		s.ArrivalPushes = append(s.ArrivalPushes, ScheduledPush{
+			ArrivalPush: p,
+			Start:       minutes(p.StartMinutes),
+			End:         minutes(p.EndMinutes),
+		})
+	}
+}
+
+func (s *Sim) activeArrivalPush() *ScheduledPush {
+	for i := range s.ArrivalPushes {
+		if s.ArrivalPushes[i].Active {
+			return &s.ArrivalPushes[i]
+		}
+	}
+	return nil
+}
+
+// inboundFlowRates returns the launch configuration's rates for the
+// inbound flow, adjusted for the arrival push in progress, if any.
+func (s *Sim) inboundFlowRates(group string) map[string]float32 {
+	lc := &s.State.LaunchConfig
+	rates := lc.InboundFlowRates[group]
+	p := s.activeArrivalPush()
+	if p == nil {
+		return rates
+	}
+
+	arrivalSum := func(rates map[string]float32) float32 {
+		var sum float32
+		for ap, r := range rates {
+			if ap != "overflights" {
+				sum += r
+			}
+		}
+		return sum
+	}
+
+	var share, shareSum float32
+	if len(p.Flows) > 0 {
+		share = p.Flows[group]
+		for _, sh := range p.Flows {
+			shareSum += sh
+		}
+	} else {
+		share = arrivalSum(rates)
+		for _, r := range lc.InboundFlowRates {
+			shareSum += arrivalSum(r)
+		}
+	}
+	if share == 0 || shareSum == 0 {
+		return rates
+	}
+
+	flowRate := p.CurrentRate * share / shareSum
+	base := arrivalSum(rates)
+	nairports := len(rates)
+	if _, ok := rates["overflights"]; ok {
+		nairports--
+	}
+	pushRates := make(map[string]float32)
+	for ap, r := range rates {
+		if ap == "overflights" {
+			pushRates[ap] = r
+		} else if base > 0 {
+			pushRates[ap] = flowRate * r / base
+		} else {
+			pushRates[ap] = flowRate / float32(nairports)
+		}
+	}
+	return pushRates
+}
+
+// updateArrivalPushes starts and ends arrival pushes and updates the rate
+// of the one in progress; it's called once a second.
+func (s *Sim) updateArrivalPushes() {
+	if len(s.ArrivalPushes) == 0 {
+		return
+	}
+
+	lc := &s.State.LaunchConfig
+	groups := util.SortedMapKeys(lc.InboundFlowRates)
+	oldSums := make(map[string]float32)
+	for _, group := range groups {
+		oldSums[group] = sumRateMap(s.inboundFlowRates(group), lc.InboundFlowRateScale)
+	}
+
+	now := s.State.SimTime
+	s.ArrivalPushes = slices.DeleteFunc(s.ArrivalPushes, func(p ScheduledPush) bool {
+		if now.Before(p.End) {
+			return false
+		}
+		if p.Active {
+			s.endArrivalPush(p)
+		}
+		return true
+	})
+	for i := range s.ArrivalPushes {
+		p := &s.ArrivalPushes[i]
+		if !p.Active && !now.Before(p.Start) && s.activeArrivalPush() == nil {
+			s.startArrivalPush(p)
+		}
+		if p.Active {
+			p.CurrentRate = p.rateAt(float32(now.Sub(p.Start).Minutes()))
+		}
+	}
+
+	if p := s.activeArrivalPush(); p != nil {
+		s.State.ActivePush = &ArrivalPushStatus{Name: p.Name, Rate: p.CurrentRate, Start: p.Start, End: p.End}
+	} else {
+		s.State.ActivePush = nil
+	}
+
+	for _, group := range groups {
+		if newSum := sumRateMap(s.inboundFlowRates(group), lc.InboundFlowRateScale); newSum != oldSums[group] {
+			s.NextInboundSpawn[group] = s.rescaleSpawnTime(s.NextInboundSpawn[group], oldSums[group], newSum)
+		}
+	}
+}
+
+func (s *Sim) startArrivalPush(p *ScheduledPush) {
+	p.Active = true
+	s.lg.Info("arrival push starting", slog.String("name", p.Name), slog.Time("end_time", p.End))
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: fmt.Sprintf("TMU: arrival push %s starting, until %s", p.Name, p.End.Format("1504Z")),
+	})
+
+	for _, r := range p.TrafficRestrictions {
+		s.addTrafficRestriction(r)
+		p.Restrictions = append(p.Restrictions, s.State.TrafficRestrictions[len(s.State.TrafficRestrictions)-1].Id)
+	}
+}
+
+func (s *Sim) endArrivalPush(p ScheduledPush) {
+	s.lg.Info("arrival push ending", slog.String("name", p.Name))
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: fmt.Sprintf("TMU: arrival push %s complete", p.Name),
+	})
+
+	// Controllers may have already cancelled some of them.
+	for _, id := range p.Restrictions {
+		s.cancelTrafficRestriction(id)
+	}
+}
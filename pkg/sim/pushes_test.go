@@ -0,0 +1,88 @@
+// pkg/sim/pushes_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmp/vice/pkg/math"
+)
+
+func TestArrivalPushRate(t *testing.T) {
+	p := ArrivalPush{Rate: [][2]float32{{10, 20}, {30, 60}, {50, 10}}}
+	for _, c := range []struct{ minutes, rate float32 }{
+		{0, 20}, {10, 20}, {20, 40}, {30, 60}, {40, 35}, {60, 10},
+	} {
+		if r := p.rateAt(c.minutes); r != c.rate {
+			t.Errorf("%.0f minutes: rate %f, expected %f", c.minutes, r, c.rate)
+		}
+	}
+}
+
+func TestArrivalPushes(t *testing.T) {
+	start := testSimTime
+
+	state := &State{SimTime: start}
+	state.LaunchConfig.InboundFlowRates = map[string]map[string]float32{
+		"east": {"KOAK": 4, "KSFO": 12, "overflights": 6},
+		"west": {"KSJC": 10},
+	}
+	state.LaunchConfig.InboundFlowRateScale = 1
+	s := newTestSim(t, state)
+	s.NextInboundSpawn = map[string]time.Time{"east": start.Add(time.Hour), "west": start.Add(time.Hour)}
+	s.scheduleArrivalPushes([]ArrivalPush{{
+		Name:                "morning",
+		StartMinutes:        10,
+		EndMinutes:          40,
+		Flows:               map[string]float32{"east": 1},
+		Rate:                [][2]float32{{0, 32}},
+		TrafficRestrictions: []TrafficRestriction{{Fix: "MERIT", MilesInTrail: 20}},
+	}})
+	if err := s.ArrivalPushes[0].Validate(func(string) (math.Point2LL, bool) { return math.Point2LL{}, true }); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	s.updateArrivalPushes()
+	if s.State.ActivePush != nil || len(s.State.TrafficRestrictions) != 0 {
+		t.Errorf("push active before its start")
+	}
+
+	// Once it starts, the east flow's arrivals go at the push's rate,
+	// divided between the airports, and its restriction is in effect.
+	s.State.SimTime = start.Add(10 * time.Minute)
+	s.updateArrivalPushes()
+	if p := s.State.ActivePush; p == nil || p.Name != "morning" || p.Rate != 32 {
+		t.Fatalf("active push %+v, expected morning at 32/hr", p)
+	}
+	rates := s.inboundFlowRates("east")
+	if rates["KOAK"] != 8 || rates["KSFO"] != 24 || rates["overflights"] != 6 {
+		t.Errorf("east rates during push %v", rates)
+	}
+	if rates := s.inboundFlowRates("west"); rates["KSJC"] != 10 {
+		t.Errorf("west rates during push %v", rates)
+	}
+	if len(s.State.TrafficRestrictions) != 1 || s.State.TrafficRestrictions[0].Fix != "MERIT" {
+		t.Errorf("restrictions %v, expected MERIT 20 MIT", s.State.TrafficRestrictions)
+	}
+	// 22/hr went to 38/hr; the west flow is unchanged.
+	if n := s.NextInboundSpawn["east"]; !n.Equal(s.State.SimTime.Add(time.Duration(float32(50*time.Minute) * 22 / 38))) {
+		t.Errorf("next east spawn %s not rescaled", n)
+	}
+	if n := s.NextInboundSpawn["west"]; !n.Equal(start.Add(time.Hour)) {
+		t.Errorf("next west spawn %s changed", n)
+	}
+
+	// When it ends, everything goes back to how it was.
+	s.State.SimTime = start.Add(40 * time.Minute)
+	s.updateArrivalPushes()
+	if s.State.ActivePush != nil || len(s.ArrivalPushes) != 0 || len(s.State.TrafficRestrictions) != 0 {
+		t.Errorf("after push: active %+v, %d scheduled, restrictions %v", s.State.ActivePush, len(s.ArrivalPushes),
+			s.State.TrafficRestrictions)
+	}
+	if rates := s.inboundFlowRates("east"); rates["KOAK"] != 4 {
+		t.Errorf("east rates after push %v", rates)
+	}
+}
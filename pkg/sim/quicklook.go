@@ -0,0 +1,49 @@
+// pkg/sim/quicklook.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"log/slog"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Each position's quick look selection--which other positions' tracks
+// are shown with full datablocks--is kept in the sim as well as in the
+// STARS preferences so that it survives reconnecting to the sim or
+// another controller relieving the position.
+
+type QuickLookPosition struct {
+	Id   string
+	Plus bool
+}
+
+func (q QuickLookPosition) String() string {
+	return q.Id + util.Select(q.Plus, "+", "")
+}
+
+type QuickLook struct {
+	All       bool
+	AllIsPlus bool
+	Positions []QuickLookPosition
+}
+
+func (s *Sim) SetQuickLook(tcp string, ql QuickLook) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if _, ok := s.State.Controllers[tcp]; !ok {
+		return av.ErrNoController
+	}
+	if s.State.QuickLooks == nil {
+		s.State.QuickLooks = make(map[string]QuickLook)
+	}
+	s.State.QuickLooks[tcp] = ql
+
+	s.lg.Debug("quick look", slog.String("tcp", tcp), slog.Any("quick_look", ql))
+
+	return nil
+}
@@ -0,0 +1,260 @@
+// pkg/sim/reload.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/mmp/vice/pkg/util"
+)
+
+// ReloadReport describes the result of applying an updated scenario
+// definition to a running Sim.
+type ReloadReport struct {
+	// Changes that were applied to the running sim.
+	Applied []string
+	// Changes that were not applied since they require starting a new sim.
+	RequiresRestart []string
+}
+
+func (r ReloadReport) Changed() bool {
+	return len(r.Applied) > 0 || len(r.RequiresRestart) > 0
+}
+
+func (r ReloadReport) String() string {
+	var sb strings.Builder
+	if !r.Changed() {
+		return "no changes"
+	}
+	if len(r.Applied) > 0 {
+		sb.WriteString("applied: " + strings.Join(r.Applied, "; "))
+	}
+	if len(r.RequiresRestart) > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("requires restart: " + strings.Join(r.RequiresRestart, "; "))
+	}
+	return sb.String()
+}
+
+// ReloadScenario applies the differences between the scenario definition
+// that the sim was started with, prev, and an updated one, next, to the
+// running sim. Airport definitions (departures, departure routes,
+// approaches, ATPA volumes), inbound flows, fixes, wind, and default
+// launch rates are updated in place; aircraft that have already been
+// launched keep the routes they were given. Changes to things like the
+// controllers, airspace, or STARS adaptation require a new sim; they are
+// reported but not applied.
+//
+// Default launch rates are applied by comparing prev's and next's
+// defaults, so that rates that the user has adjusted in the running sim
+// are left alone unless the scenario's default for them changed.
+func (s *Sim) ReloadScenario(prev, next NewSimConfiguration) ReloadReport {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	var r ReloadReport
+	restart := func(what string) {
+		r.RequiresRestart = append(r.RequiresRestart, what)
+	}
+	applied := func(f string, args ...interface{}) {
+		r.Applied = append(r.Applied, fmt.Sprintf(f, args...))
+	}
+
+	// Things that we don't try to update in a running sim.
+	if !reflect.DeepEqual(prev.ControlPositions, next.ControlPositions) {
+		restart("control positions")
+	}
+	if !slices.Equal(prev.VirtualControllers, next.VirtualControllers) {
+		restart("virtual controllers")
+	}
+	if !reflect.DeepEqual(prev.ControllerAirspace, next.ControllerAirspace) ||
+		!reflect.DeepEqual(prev.Airspace, next.Airspace) {
+		restart("controller airspace")
+	}
+	if !reflect.DeepEqual(prev.STARSFacilityAdaptation, next.STARSFacilityAdaptation) {
+		restart("STARS adaptation")
+	}
+	if prev.PrimaryAirport != next.PrimaryAirport || prev.MagneticVariation != next.MagneticVariation ||
+		prev.NmPerLongitude != next.NmPerLongitude {
+		restart("primary airport or magnetic variation")
+	}
+	if !slices.Equal(util.SortedMapKeys(prev.Airports), util.SortedMapKeys(next.Airports)) {
+		restart("airports added or removed")
+	}
+	if !slices.Equal(prev.ArrivalRunways, next.ArrivalRunways) {
+		restart("arrival runways")
+	}
+	if !slices.Equal(util.SortedMapKeys(prev.InboundFlows), util.SortedMapKeys(next.InboundFlows)) {
+		restart("inbound flows added or removed")
+	}
+
+	sameDepartureRunways := len(prev.DepartureRunways) == len(next.DepartureRunways)
+	for i := range prev.DepartureRunways {
+		if !sameDepartureRunways {
+			break
+		}
+		p, n := prev.DepartureRunways[i], next.DepartureRunways[i]
+		sameDepartureRunways = p.Airport == n.Airport && p.Runway == n.Runway && p.Category == n.Category
+	}
+	if !sameDepartureRunways {
+		restart("departure runways")
+	}
+
+	// The maps and slices in State may be shared with the scenario group
+	// and other sims; make copies before updating them.
+	s.State.Airports = maps.Clone(s.State.Airports)
+	s.State.InboundFlows = maps.Clone(s.State.InboundFlows)
+	s.State.LaunchConfig.VFRAirports = maps.Clone(s.State.LaunchConfig.VFRAirports)
+	s.State.DepartureAirports = maps.Clone(s.State.DepartureAirports)
+	s.State.ArrivalAirports = maps.Clone(s.State.ArrivalAirports)
+	s.State.DepartureRunways = slices.Clone(s.State.DepartureRunways)
+
+	// Airports
+	for _, name := range util.SortedMapKeys(next.Airports) {
+		pap, ok := prev.Airports[name]
+		ap := next.Airports[name]
+		if !ok || reflect.DeepEqual(pap, ap) {
+			continue
+		}
+
+		var what []string
+		if !reflect.DeepEqual(pap.Departures, ap.Departures) {
+			what = append(what, "departures")
+		}
+		if !reflect.DeepEqual(pap.DepartureRoutes, ap.DepartureRoutes) {
+			what = append(what, "departure routes")
+		}
+		if !reflect.DeepEqual(pap.Approaches, ap.Approaches) {
+			what = append(what, "approaches")
+		}
+		if !reflect.DeepEqual(pap.ATPAVolumes, ap.ATPAVolumes) {
+			what = append(what, "ATPA volumes")
+		}
+		if len(what) == 0 {
+			what = append(what, "definition")
+		}
+
+		s.State.Airports[name] = ap
+		if _, ok := s.State.DepartureAirports[name]; ok {
+			s.State.DepartureAirports[name] = ap
+		}
+		if _, ok := s.State.ArrivalAirports[name]; ok {
+			s.State.ArrivalAirports[name] = ap
+		}
+		if _, ok := s.State.LaunchConfig.VFRAirports[name]; ok {
+			s.State.LaunchConfig.VFRAirports[name] = ap
+		}
+		applied("%s: updated %s", name, strings.Join(what, ", "))
+	}
+
+	// Departure runways: the exit routes can always be updated as long
+	// as the runways themselves haven't changed.
+	if sameDepartureRunways {
+		for i, rwy := range next.DepartureRunways {
+			cur := &s.State.DepartureRunways[i]
+			if cur.Airport != rwy.Airport || cur.Runway != rwy.Runway || cur.Category != rwy.Category {
+				continue
+			}
+			if !reflect.DeepEqual(cur.ExitRoutes, rwy.ExitRoutes) {
+				cur.ExitRoutes = rwy.ExitRoutes
+				applied("%s runway %s: updated exit routes", rwy.Airport, rwy.Runway)
+			}
+			cur.DefaultRate = rwy.DefaultRate
+		}
+	}
+
+	// Inbound flows
+	for _, name := range util.SortedMapKeys(next.InboundFlows) {
+		if pf, ok := prev.InboundFlows[name]; ok && !reflect.DeepEqual(pf, next.InboundFlows[name]) {
+			s.State.InboundFlows[name] = next.InboundFlows[name]
+			applied("inbound flow %s: updated", name)
+		}
+	}
+
+	if !maps.Equal(prev.Fixes, next.Fixes) {
+		s.State.Fixes = next.Fixes
+		applied("updated fixes")
+	}
+	if !reflect.DeepEqual(prev.Wind, next.Wind) {
+		s.State.Wind = next.Wind
+		applied("updated wind")
+	}
+
+	s.reloadLaunchRates(prev.LaunchConfig, next.LaunchConfig, applied)
+
+	s.lg.Infof("scenario reloaded: %s", r)
+
+	return r
+}
+
+// reloadLaunchRates updates the current launch rates for the rates whose
+// defaults differ between prev and next.
+func (s *Sim) reloadLaunchRates(prev, next LaunchConfig, applied func(string, ...interface{})) {
+	lc := &s.State.LaunchConfig
+
+	for _, ap := range util.SortedMapKeys(next.DepartureRates) {
+		for _, rwy := range util.SortedMapKeys(next.DepartureRates[ap]) {
+			rates, ok := lc.DepartureRates[ap][rwy]
+			if !ok {
+				continue
+			}
+			changed := false
+			for _, cat := range util.SortedMapKeys(next.DepartureRates[ap][rwy]) {
+				nr := next.DepartureRates[ap][rwy][cat]
+				if pr, ok := prev.DepartureRates[ap][rwy][cat]; ok && pr != nr {
+					rates[cat] = nr
+					changed = true
+				}
+			}
+			if changed {
+				if ds, ok := s.DepartureState[ap][rwy]; ok {
+					ds.setIFRRate(s, sumRateMap(rates, lc.DepartureRateScale))
+				}
+				applied("%s runway %s: updated departure rate", ap, rwy)
+			}
+		}
+	}
+
+	for _, group := range util.SortedMapKeys(next.InboundFlowRates) {
+		rates, ok := lc.InboundFlowRates[group]
+		if !ok {
+			continue
+		}
+		changed := false
+		for _, ap := range util.SortedMapKeys(next.InboundFlowRates[group]) {
+			nr := next.InboundFlowRates[group][ap]
+			if pr, ok := prev.InboundFlowRates[group][ap]; ok && pr != nr {
+				rates[ap] = nr
+				changed = true
+			}
+		}
+		if changed {
+			var sum float32
+			for _, rate := range rates {
+				sum += scaleRate(rate, lc.InboundFlowRateScale)
+			}
+			pushActive := s.State.SimTime.Before(s.PushEnd)
+			s.NextInboundSpawn[group] = s.State.SimTime.Add(randomWait(&s.Rand, sum, pushActive))
+			applied("inbound flow %s: updated rates", group)
+		}
+	}
+
+	if prev.VFRDepartureRateScale != next.VFRDepartureRateScale {
+		lc.VFRDepartureRateScale = next.VFRDepartureRateScale
+		for name, ap := range lc.VFRAirports {
+			rwy := s.State.VFRRunways[name]
+			if ds, ok := s.DepartureState[name][rwy.Id]; ok {
+				ds.setVFRRate(s, scaleRate(float32(ap.VFRRateSum()), lc.VFRDepartureRateScale))
+			}
+		}
+		applied("updated VFR departure rate scale")
+	}
+}
@@ -0,0 +1,295 @@
+// pkg/sim/runwayadvisor.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// The runway advisor recommends runway configurations. Facilities adapt
+// runway flows: the runways that are used together at nearby airports
+// whose traffic interacts--JFK, LGA, and EWR, for example--so only
+// combinations that work together are recommended. Once a minute, each
+// flow is scored by the headwind on its runways and how well they line up
+// with where the arrivals are coming from, averaged over its runways so
+// that flows with more runways aren't favored; flows with a tailwind or
+// crosswind beyond the usual limits are ruled out. If the runways in use
+// are ruled out or another flow is clearly better, it's recommended.
+// Runways in use at airports that aren't part of any flow are checked
+// individually and the best-aligned runway is recommended if they're
+// ruled out.
+//
+// Only the current wind is used; there are no forecasts to go by.
+
+// RunwayFlow is an adapted runway configuration for one or more airports
+// that are used together.
+type RunwayFlow struct {
+	Name    string              `json:"name"`
+	Runways map[string][]string `json:"runways"` // airport -> runways
+}
+
+// RunwayAdvice is a recommendation to change runways.
+type RunwayAdvice struct {
+	// The flow in use and the recommended one, if the recommendation is
+	// for adapted flows.
+	Current     string
+	Recommended string
+	Runways     map[string][]string // airport -> recommended runways
+	Reasons     []string
+}
+
+const (
+	// Runways aren't used with more wind than this (knots).
+	runwayMaxTailwind  = 5
+	runwayMaxCrosswind = 20
+
+	runwayAdviceInterval = time.Minute
+	// Another flow must score this much better than the one in use to be
+	// recommended when the one in use is still usable.
+	runwayAdviceMargin = 5
+	// How much aligning with the arrivals counts, relative to knots of
+	// headwind.
+	runwayDemandWeight = 4
+)
+
+func (f RunwayFlow) Validate() error {
+	if f.Name == "" {
+		return fmt.Errorf("\"name\" must be given")
+	}
+	if len(f.Runways) == 0 {
+		return fmt.Errorf("%s: \"runways\" must be given", f.Name)
+	}
+	for _, ap := range util.SortedMapKeys(f.Runways) {
+		for _, rwy := range f.Runways[ap] {
+			if _, ok := av.LookupRunway(ap, rwy); !ok {
+				return fmt.Errorf("%s: %s: runway not found at %s", f.Name, rwy, ap)
+			}
+		}
+	}
+	return nil
+}
+
+func (a RunwayAdvice) String() string {
+	var rwys []string
+	for _, ap := range util.SortedMapKeys(a.Runways) {
+		rwys = append(rwys, ap+" "+strings.Join(a.Runways[ap], "/"))
+	}
+	s := strings.Join(rwys, ", ")
+	if a.Recommended != "" {
+		s = a.Recommended + " (" + s + ")"
+	}
+	if len(a.Reasons) > 0 {
+		s += ": " + strings.Join(a.Reasons, "; ")
+	}
+	return s
+}
+
+// runwaysInUse returns the runways that arrivals and departures are using
+// at each airport.
+func (s *Sim) runwaysInUse() map[string][]string {
+	inUse := make(map[string][]string)
+	add := func(ap, rwy string) {
+		if rwy = av.TidyRunway(rwy); !slices.Contains(inUse[ap], rwy) {
+			inUse[ap] = append(inUse[ap], rwy)
+		}
+	}
+	for _, r := range s.State.ArrivalRunways {
+		add(r.Airport, r.Runway)
+	}
+	for _, r := range s.State.DepartureRunways {
+		add(r.Airport, r.Runway)
+	}
+	for _, rwys := range inUse {
+		slices.Sort(rwys)
+	}
+	return inUse
+}
+
+// airportWind returns the wind at the airport: from its METAR if there is
+// one and otherwise the sim's wind.
+func (s *Sim) airportWind(ap string) av.Wind {
+	if m, ok := s.State.METAR[ap]; ok && m != nil {
+		return m.Wind
+	}
+	return s.State.Wind
+}
+
+// arrivalBearings returns the (magnetic) bearings from the airport to the
+// aircraft that are inbound to it.
+func (s *Sim) arrivalBearings(ap string) []float32 {
+	loc, ok := s.State.Locate(ap)
+	if !ok {
+		return nil
+	}
+	var b []float32
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		if ac.FlightPlan != nil && ac.FlightPlan.ArrivalAirport == ap && ac.IsAirborne() &&
+			math.NMDistance2LL(ac.Position(), loc) > 10 {
+			b = append(b, math.Heading2LL(loc, ac.Position(), s.State.NmPerLongitude, s.State.MagneticVariation))
+		}
+	}
+	return b
+}
+
+// scoreRunways returns a score for using the given runways, higher being
+// better, and, if any of them can't be used, why not. The score is the
+// average of the runways' scores so that flows with different numbers of
+// runways can be compared. lookup is used to find the runways.
+func (s *Sim) scoreRunways(runways map[string][]string, lookup func(ap, rwy string) (av.Runway, bool)) (float32, []string) {
+	var score float32
+	var reasons []string
+	n := 0
+	for _, ap := range util.SortedMapKeys(runways) {
+		wind := s.airportWind(ap)
+		speed := float32(max(wind.Speed, wind.Gust))
+		bearings := s.arrivalBearings(ap)
+
+		for _, id := range runways[ap] {
+			rwy, ok := lookup(ap, id)
+			if !ok {
+				continue
+			}
+			n++
+
+			if !wind.Variable && wind.Speed > 0 {
+				// Wind directions are true; runway headings are magnetic.
+				d := math.Radians(float32(wind.Direction) + s.State.MagneticVariation - rwy.Heading)
+				head, cross := speed*math.Cos(d), math.Abs(speed*math.Sin(d))
+				if -head > runwayMaxTailwind {
+					reasons = append(reasons, fmt.Sprintf("%s %s: %.0f knot tailwind", ap, id, -head))
+				}
+				if cross > runwayMaxCrosswind {
+					reasons = append(reasons, fmt.Sprintf("%s %s: %.0f knot crosswind", ap, id, cross))
+				}
+				score += float32(wind.Speed) * math.Cos(d)
+			}
+
+			// Arrivals coming from the approach end of the runway have
+			// the shortest trip to it.
+			for _, b := range bearings {
+				d := math.Radians(math.HeadingDifference(b, math.OppositeHeading(rwy.Heading)))
+				score += runwayDemandWeight * math.Cos(d) / float32(len(bearings))
+			}
+		}
+	}
+	if n > 0 {
+		score /= float32(n)
+	}
+	return score, reasons
+}
+
+// updateRunwayAdvice is called once a second.
+func (s *Sim) updateRunwayAdvice() {
+	now := s.State.SimTime
+	if now.Sub(s.lastRunwayAdvice) < runwayAdviceInterval {
+		return
+	}
+	s.lastRunwayAdvice = now
+
+	advice := s.runwayAdvice(av.LookupRunway)
+
+	prev := util.MapSlice(s.State.RunwayAdvice, func(a RunwayAdvice) string { return a.String() })
+	for _, a := range advice {
+		if !slices.Contains(prev, a.String()) {
+			s.eventStream.Post(Event{
+				Type:    StatusMessageEvent,
+				Message: "Runway advisor: recommend " + a.String(),
+			})
+		}
+	}
+	s.State.RunwayAdvice = advice
+}
+
+// runwayAdvice returns the current runway recommendations, using lookup
+// to find runways.
+func (s *Sim) runwayAdvice(lookup func(ap, rwy string) (av.Runway, bool)) []RunwayAdvice {
+	inUse := s.runwaysInUse()
+	covered := make(map[string]bool)
+	var advice []RunwayAdvice
+
+	if len(s.RunwayFlows) > 0 {
+		current := make(map[string][]string)
+		for _, f := range s.RunwayFlows {
+			for ap := range f.Runways {
+				covered[ap] = true
+				if rwys, ok := inUse[ap]; ok {
+					current[ap] = rwys
+				}
+			}
+		}
+
+		curName := ""
+		for _, f := range s.RunwayFlows {
+			if flowMatches(f, current) {
+				curName = f.Name
+				break
+			}
+		}
+		curScore, curReasons := s.scoreRunways(current, lookup)
+
+		best, bestScore := -1, float32(0)
+		for i, f := range s.RunwayFlows {
+			if score, reasons := s.scoreRunways(f.Runways, lookup); len(reasons) == 0 && (best == -1 || score > bestScore) {
+				best, bestScore = i, score
+			}
+		}
+
+		if best != -1 && s.RunwayFlows[best].Name != curName &&
+			(len(curReasons) > 0 || bestScore > curScore+runwayAdviceMargin) {
+			reasons := curReasons
+			if len(reasons) == 0 {
+				reasons = []string{"better aligned with the wind and arrivals"}
+			}
+			advice = append(advice, RunwayAdvice{
+				Current:     curName,
+				Recommended: s.RunwayFlows[best].Name,
+				Runways:     s.RunwayFlows[best].Runways,
+				Reasons:     reasons,
+			})
+		}
+	}
+
+	for _, ap := range util.SortedMapKeys(inUse) {
+		if covered[ap] {
+			continue
+		}
+		_, reasons := s.scoreRunways(map[string][]string{ap: inUse[ap]}, lookup)
+		if len(reasons) == 0 {
+			continue
+		}
+		if fap, ok := av.DB.Airports()[ap]; ok {
+			if rwy, _ := fap.SelectBestRunway(s.State, s.State.MagneticVariation); rwy != nil &&
+				!slices.Contains(inUse[ap], rwy.Id) {
+				advice = append(advice, RunwayAdvice{
+					Runways: map[string][]string{ap: []string{rwy.Id}},
+					Reasons: reasons,
+				})
+			}
+		}
+	}
+
+	return advice
+}
+
+// flowMatches returns whether the runways in use at each of the flow's
+// airports are the flow's.
+func flowMatches(f RunwayFlow, inUse map[string][]string) bool {
+	for ap, rwys := range f.Runways {
+		r := slices.Clone(rwys)
+		slices.Sort(r)
+		if !slices.Equal(r, inUse[ap]) {
+			return false
+		}
+	}
+	return true
+}
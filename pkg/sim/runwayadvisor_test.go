@@ -0,0 +1,143 @@
+// pkg/sim/runwayadvisor_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+var testRunwayHeadings = map[string]float32{
+	"4L": 44, "4R": 44, "22L": 224, "22R": 224,
+	"13L": 134, "13R": 134, "31L": 314, "31R": 314,
+}
+
+func lookupTestRunway(ap, rwy string) (av.Runway, bool) {
+	h, ok := testRunwayHeadings[rwy]
+	return av.Runway{Id: rwy, Heading: h}, ok && ap == "KJFK"
+}
+
+func makeRunwayAdvisorTestSim(t *testing.T, wind av.Wind, inUse []string, arrivalBearings ...float32) *Sim {
+	jfk := math.Point2LL{-73.78, 40.64}
+	s := newTestSim(t, &State{
+		Airports:       map[string]*av.Airport{"KJFK": {Location: jfk}},
+		Aircraft:       make(map[string]*av.Aircraft),
+		Wind:           wind,
+		NmPerLongitude: 45.5,
+	})
+	for _, rwy := range inUse {
+		s.State.ArrivalRunways = append(s.State.ArrivalRunways, ArrivalRunway{Airport: "KJFK", Runway: rwy})
+	}
+	for i, b := range arrivalBearings {
+		// 20nm out along the bearing.
+		d := math.Radians(b)
+		p := math.Point2LL{jfk[0] + 20*math.Sin(d)/45.5, jfk[1] + 20*math.Cos(d)/60}
+		callsign := fmt.Sprintf("AAL%d", i+1)
+		s.State.Aircraft[callsign] = &av.Aircraft{
+			Callsign:   callsign,
+			FlightPlan: &av.FlightPlan{ArrivalAirport: "KJFK"},
+			Nav:        av.Nav{FlightState: av.FlightState{Position: p, Altitude: 5000, IAS: 250}},
+		}
+	}
+	s.RunwayFlows = []RunwayFlow{
+		{Name: "31s and 22L", Runways: map[string][]string{"KJFK": {"31L", "31R", "22L"}}},
+		{Name: "4s", Runways: map[string][]string{"KJFK": {"4L", "4R"}}},
+		{Name: "22s", Runways: map[string][]string{"KJFK": {"22L", "22R"}}},
+		{Name: "13s", Runways: map[string][]string{"KJFK": {"13L", "13R"}}},
+		{Name: "31s", Runways: map[string][]string{"KJFK": {"31L", "31R"}}},
+	}
+	return s
+}
+
+func TestRunwayAdvice(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		wind        av.Wind
+		inUse       []string
+		arrivals    []float32
+		current     string
+		recommended string
+		reasons     []string
+	}{
+		{name: "aligned with the wind", wind: av.Wind{Direction: 220, Speed: 15}, inUse: []string{"22L", "22R"}},
+		{name: "tailwind", wind: av.Wind{Direction: 220, Speed: 15}, inUse: []string{"4L", "4R"},
+			current: "4s", recommended: "22s",
+			reasons: []string{"KJFK 4L: 15 knot tailwind", "KJFK 4R: 15 knot tailwind"}},
+		{name: "crosswind", wind: av.Wind{Direction: 224, Speed: 15, Gust: 25}, inUse: []string{"13L", "13R"},
+			current: "13s", recommended: "22s",
+			reasons: []string{"KJFK 13L: 25 knot crosswind", "KJFK 13R: 25 knot crosswind"}},
+		{name: "not a flow", wind: av.Wind{Direction: 40, Speed: 15}, inUse: []string{"22L", "31R"},
+			recommended: "4s",
+			reasons:     []string{"KJFK 22L: 15 knot tailwind"}},
+		// Arrivals from the southwest favor the 4s, though not by enough
+		// to switch from the 13s but enough to switch from the 22s.
+		{name: "within the margin", inUse: []string{"13L", "13R"}, arrivals: []float32{224, 224}},
+		{name: "beyond the margin", inUse: []string{"22L", "22R"}, arrivals: []float32{224, 224},
+			current: "22s", recommended: "4s",
+			reasons: []string{"better aligned with the wind and arrivals"}},
+		// The 31s are better aligned with the wind than the 31s with 22L,
+		// even though the latter's total headwind is higher.
+		{name: "more runways", wind: av.Wind{Direction: 300, Speed: 8}, inUse: []string{"4L", "4R"},
+			current: "4s", recommended: "31s",
+			reasons: []string{"better aligned with the wind and arrivals"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := makeRunwayAdvisorTestSim(t, test.wind, test.inUse, test.arrivals...)
+			advice := s.runwayAdvice(lookupTestRunway)
+
+			if test.recommended == "" {
+				if len(advice) != 0 {
+					t.Errorf("unexpected advice %v", advice)
+				}
+				return
+			}
+			if len(advice) != 1 {
+				t.Fatalf("got advice %v, expected one recommendation", advice)
+			}
+			a := advice[0]
+			if a.Current != test.current || a.Recommended != test.recommended {
+				t.Errorf("got %q -> %q, expected %q -> %q", a.Current, a.Recommended, test.current, test.recommended)
+			}
+			if !slices.Equal(a.Reasons, test.reasons) {
+				t.Errorf("got reasons %q, expected %q", a.Reasons, test.reasons)
+			}
+		})
+	}
+}
+
+func TestScoreRunwaysAveraged(t *testing.T) {
+	s := makeRunwayAdvisorTestSim(t, av.Wind{Direction: 224, Speed: 10}, nil)
+
+	two, _ := s.scoreRunways(map[string][]string{"KJFK": {"22L", "22R"}}, lookupTestRunway)
+	one, _ := s.scoreRunways(map[string][]string{"KJFK": {"22L"}}, lookupTestRunway)
+	if math.Abs(two-10) > 0.01 || math.Abs(one-10) > 0.01 {
+		t.Errorf("got scores %f and %f for one and two runways; expected 10 for both", one, two)
+	}
+	if sc, reasons := s.scoreRunways(map[string][]string{"KJFK": {"9L"}}, lookupTestRunway); sc != 0 || reasons != nil {
+		t.Errorf("unknown runway: got %f, %v", sc, reasons)
+	}
+}
+
+func TestFlowMatches(t *testing.T) {
+	f := RunwayFlow{Name: "22s", Runways: map[string][]string{"KJFK": {"22R", "22L"}, "KLGA": {"22"}}}
+	for _, test := range []struct {
+		inUse    map[string][]string
+		expected bool
+	}{
+		{map[string][]string{"KJFK": {"22L", "22R"}, "KLGA": {"22"}}, true},
+		{map[string][]string{"KJFK": {"22L", "22R"}, "KLGA": {"22"}, "KEWR": {"22L"}}, true},
+		{map[string][]string{"KJFK": {"22L"}, "KLGA": {"22"}}, false},
+		{map[string][]string{"KJFK": {"22L", "22R", "31L"}, "KLGA": {"22"}}, false},
+		{map[string][]string{"KJFK": {"22L", "22R"}}, false},
+	} {
+		if m := flowMatches(f, test.inUse); m != test.expected {
+			t.Errorf("%v: got %v, expected %v", test.inUse, m, test.expected)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// pkg/sim/runwaytimers.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Arrivals and departures can't be run independently on runways that
+// intersect or whose flight paths converge just past the ends of the
+// runways; which pairs of runways in use are dependent follows from the
+// runway geometry in the airport database. For each such pair, a
+// protected window is computed for the next arrival cleared for an
+// approach to the arrival runway: it opens shortly before the arrival
+// reaches the threshold and closes once it has landed and can no longer
+// go around or, if the runways intersect, once it has rolled out and
+// exited. Intersecting runways are also protected while the arrival
+// runway is otherwise occupied.
+//
+// The timers are collected in the State once a second so that
+// controllers can see the gaps that are coming up. Departures don't start
+// their takeoff roll if they wouldn't be clear before a window opens; the
+// departure controller is told when one is held for that reason.
+
+// RunwayTimer gives the protected window for departures from a runway
+// due to arrivals to a dependent one.
+type RunwayTimer struct {
+	Airport    string
+	Arrival    string // runway
+	Departure  string // runway
+	Dependency av.RunwayDependency
+	// The arrival that the window is for; empty if the window is because
+	// the arrival runway is occupied or if there are no arrivals.
+	Callsign string
+	// Both are zero if the runways are clear.
+	Opens, Closes time.Time
+}
+
+const (
+	// How long before an arrival reaches the threshold departures on a
+	// dependent runway must be clear.
+	runwayTimerLead = 60 * time.Second
+	// How long a departure needs after starting its takeoff roll to be
+	// clear of a dependent runway's arrivals.
+	runwayTimerTakeoff = 45 * time.Second
+	// How long an arrival is on an intersecting runway after it lands,
+	// for estimating when the window closes before it has landed.
+	runwayTimerRollout = 50 * time.Second
+)
+
+// Protected returns whether departures must hold at the given time.
+func (t RunwayTimer) Protected(now time.Time) bool {
+	return !t.Opens.IsZero() && !now.Before(t.Opens) && now.Before(t.Closes)
+}
+
+// Status describes the timer at the given time, e.g., "AAL123 gap 1:05"
+// or "AAL123 protected 0:40".
+func (t RunwayTimer) Status(now time.Time) string {
+	mmss := func(d time.Duration) string {
+		sec := max(0, int(d.Seconds()+0.5))
+		return fmt.Sprintf("%d:%02d", sec/60, sec%60)
+	}
+
+	who := util.Select(t.Callsign != "", t.Callsign, "runway occupied")
+	switch {
+	case t.Opens.IsZero() || !now.Before(t.Closes):
+		return "clear"
+	case now.Before(t.Opens):
+		return who + " gap " + mmss(t.Opens.Sub(now))
+	default:
+		return who + " protected " + mmss(t.Closes.Sub(now))
+	}
+}
+
+// updateRunwayTimers is called once a second.
+func (s *Sim) updateRunwayTimers() {
+	var timers []RunwayTimer
+	now := s.State.SimTime
+
+	for _, arr := range s.State.ArrivalRunways {
+		for _, dep := range s.State.DepartureRunways {
+			if arr.Airport != dep.Airport {
+				continue
+			}
+			arrRwy, depRwy := av.TidyRunway(arr.Runway), av.TidyRunway(dep.Runway)
+			if slices.ContainsFunc(timers, func(t RunwayTimer) bool {
+				return t.Airport == arr.Airport && t.Arrival == arrRwy && t.Departure == depRwy
+			}) {
+				continue
+			}
+			d := av.ArrivalDepartureDependency(arr.Airport, arrRwy, depRwy, s.State.NmPerLongitude)
+			if d == av.RunwaysIndependent {
+				continue
+			}
+
+			t := RunwayTimer{
+				Airport:    arr.Airport,
+				Arrival:    arrRwy,
+				Departure:  depRwy,
+				Dependency: d,
+			}
+			if d == av.RunwaysIntersect && s.runwayOccupied(arr.Airport, arrRwy) {
+				t.Opens, t.Closes = now, s.RunwayOccupied[runwayKey(arr.Airport, arrRwy)]
+			} else if callsign, eta, ok := s.nextArrival(arr.Airport, arrRwy); ok {
+				t.Callsign = callsign
+				t.Opens = now.Add(eta - runwayTimerLead)
+				t.Closes = now.Add(eta)
+				if d == av.RunwaysIntersect {
+					t.Closes = t.Closes.Add(runwayTimerRollout)
+				}
+			}
+			timers = append(timers, t)
+		}
+	}
+	s.State.RunwayTimers = timers
+
+	for callsign := range s.runwayTimerHolds {
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(s.runwayTimerHolds, callsign)
+		}
+	}
+}
+
+// nextArrival returns the arrival cleared for an approach to the runway
+// that will reach it next and how long it will take to get there.
+func (s *Sim) nextArrival(airport, runway string) (string, time.Duration, bool) {
+	var callsign string
+	var eta time.Duration
+	for _, ac := range s.State.Aircraft {
+		appr := ac.Nav.Approach.Assigned
+		if appr == nil || !ac.Nav.Approach.Cleared || ac.FlightPlan == nil ||
+			ac.FlightPlan.ArrivalAirport != airport || av.TidyRunway(appr.Runway) != runway {
+			continue
+		}
+		d, err := ac.DistanceToEndOfApproach()
+		if err != nil || ac.GS() <= 0 {
+			continue
+		}
+		if t := time.Duration(d / ac.GS() * float32(time.Hour)); callsign == "" || t < eta ||
+			(t == eta && ac.Callsign < callsign) {
+			callsign, eta = ac.Callsign, t
+		}
+	}
+	return callsign, eta, callsign != ""
+}
+
+// dependentRunwaysClear returns whether the departure can start its
+// takeoff roll without running into a protected window for a dependent
+// runway. If it can't, its departure controller is told, once, that it's
+// being held.
+func (s *Sim) dependentRunwaysClear(airport, runway string, dep *DepartureAircraft) bool {
+	runway = av.TidyRunway(runway)
+	now := s.State.SimTime
+	for _, t := range s.State.RunwayTimers {
+		if t.Airport != airport || t.Departure != runway || t.Opens.IsZero() ||
+			!now.Add(runwayTimerTakeoff).After(t.Opens) || !now.Before(t.Closes) {
+			continue
+		}
+
+		if !s.runwayTimerHolds[dep.Callsign] {
+			if s.runwayTimerHolds == nil {
+				s.runwayTimerHolds = make(map[string]bool)
+			}
+			s.runwayTimerHolds[dep.Callsign] = true
+
+			ac := s.State.Aircraft[dep.Callsign]
+			msg := fmt.Sprintf("%s departing %s runway %s held for %s runway %s: %s", dep.Callsign, airport,
+				runway, t.Dependency, t.Arrival, t.Status(now))
+			s.lg.Info("departure held for dependent runway", slog.String("callsign", dep.Callsign),
+				slog.String("message", msg))
+			s.eventStream.Post(Event{
+				Type:         StatusMessageEvent,
+				ToController: s.ResolveController(ac.DepartureContactController),
+				Message:      msg,
+			})
+		}
+		return false
+	}
+
+	delete(s.runwayTimerHolds, dep.Callsign)
+	return true
+}
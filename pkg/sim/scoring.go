@@ -0,0 +1,956 @@
+// pkg/sim/scoring.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// The human controllers' performance over a session is scored against a
+// set of rubrics. Each rubric has a type, which selects the ScoringRule
+// that evaluates it, and type-specific parameters; the rubrics are given
+// in the scenario group JSON so that facilities can encode their SOPs and
+// LOAs. Each violation a rule finds costs the rubric's penalty in points,
+// starting from 100.
+
+// Rubric is one of the criteria that a session is scored against.
+type Rubric struct {
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Penalty    float32         `json:"penalty"`               // points per violation
+	MaxPenalty float32         `json:"max_penalty,omitempty"` // 0 -> no limit
+	Params     json.RawMessage `json:"params,omitempty"`
+}
+
+// ScoringRule is implemented by each type of rubric. Update is called once
+// a second and Event is called with each event that the sim posts; both
+// return any new violations.
+type ScoringRule interface {
+	Update(ctx *ScoringContext) []Violation
+	Event(ctx *ScoringContext, e Event) []Violation
+}
+
+// ScoringContext gives ScoringRules access to the sim.
+type ScoringContext struct {
+	State *State
+	// IsHuman returns whether the given TCP is a signed-in human controller.
+	IsHuman func(tcp string) bool
+	// Index of the aircraft's positions, for rules that look for
+	// aircraft near each other.
+	AircraftIndex *AircraftIndex
+}
+
+// ScoringRuleFactory makes a ScoringRule from a rubric's parameters; it
+// should return an error if they are invalid. locate gives the locations
+// of fixes.
+type ScoringRuleFactory func(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error)
+
+var scoringRuleFactories = make(map[string]ScoringRuleFactory)
+
+// RegisterScoringRule makes a new type of rubric available.
+func RegisterScoringRule(typ string, f ScoringRuleFactory) {
+	if _, ok := scoringRuleFactories[typ]; ok {
+		panic(typ + ": scoring rule type registered twice")
+	}
+	scoringRuleFactories[typ] = f
+}
+
+func (r Rubric) makeRule(locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	f, ok := scoringRuleFactories[r.Type]
+	if !ok {
+		return nil, fmt.Errorf("%q: unknown rubric type", r.Type)
+	}
+	params := r.Params
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
+	return f(params, locate)
+}
+
+func (r Rubric) Validate(locate func(string) (math.Point2LL, bool)) error {
+	if r.Name == "" {
+		return fmt.Errorf("\"name\" must be specified")
+	}
+	if r.Penalty < 0 || r.MaxPenalty < 0 {
+		return fmt.Errorf("%s: penalties must not be negative", r.Name)
+	}
+	if _, err := r.makeRule(locate); err != nil {
+		return fmt.Errorf("%s: %w", r.Name, err)
+	}
+	return nil
+}
+
+// DefaultRubrics are used for scenario groups that don't specify their own.
+var DefaultRubrics = []Rubric{
+	{Name: "Separation", Type: "separation", Penalty: 10},
+	{Name: "Handoffs", Type: "handoff", Penalty: 2, MaxPenalty: 20},
+	{Name: "Check-ins", Type: "missed_call", Penalty: 2, MaxPenalty: 20},
+	{Name: "Pilot errors and emergencies", Type: "training_events", Penalty: 5},
+	{Name: "LOA compliance", Type: "loa", Penalty: 3, MaxPenalty: 30},
+	{Name: "Crossing restrictions", Type: "restrictions", Penalty: 2, MaxPenalty: 20},
+	{Name: "TCAS RAs", Type: "tcas", Penalty: 10},
+	{Name: "Releases", Type: "apreq", Penalty: 2, MaxPenalty: 20},
+	{Name: "Traffic management restrictions", Type: "tmi", Penalty: 2, MaxPenalty: 20},
+	{Name: "Weather deviations", Type: "weather", Penalty: 2, MaxPenalty: 20},
+	{Name: "Priority handling", Type: "priority", Penalty: 3, MaxPenalty: 15},
+	{Name: "Point-outs", Type: "pointout", Penalty: 2, MaxPenalty: 20},
+	{Name: "Phraseology", Type: "phraseology", Penalty: 1, MaxPenalty: 10},
+}
+
+// Violation is an instance of a rubric not being met.
+type Violation struct {
+	Time       time.Time `json:"time"`
+	Callsign   string    `json:"callsign,omitempty"`
+	Controller string    `json:"controller,omitempty"`
+	Message    string    `json:"message"`
+}
+
+type RubricResult struct {
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	Penalty    float32     `json:"penalty"`
+	Violations []Violation `json:"violations"`
+}
+
+// ScoreReport summarizes a session's score.
+type ScoreReport struct {
+	Start   time.Time      `json:"start"`
+	End     time.Time      `json:"end"`
+	Score   float32        `json:"score"`
+	Rubrics []RubricResult `json:"rubrics"`
+	// How each crossing restriction was met; see compliance.go.
+	Compliance []ComplianceRecord `json:"compliance"`
+	// TCAS resolution advisories; see tcas.go.
+	TCAS []TCASRA `json:"tcas"`
+	// Readback errors and how they were handled; see hearback.go.
+	Hearback HearbackStats `json:"hearback"`
+	// Progress through the lesson, if the scenario is one; see lesson.go.
+	Lesson *LessonResult `json:"lesson,omitempty"`
+}
+
+// Scoring holds the state of scoring a session. The rules aren't saved
+// with the sim; they start over from the rubrics when it's loaded.
+type Scoring struct {
+	Rubrics []Rubric
+	Results []RubricResult
+	Start   time.Time
+
+	rules []ScoringRule
+}
+
+func newScoring(rubrics []Rubric) *Scoring {
+	if len(rubrics) == 0 {
+		rubrics = DefaultRubrics
+	}
+	sc := &Scoring{Rubrics: rubrics}
+	for _, r := range rubrics {
+		sc.Results = append(sc.Results, RubricResult{Name: r.Name, Type: r.Type})
+	}
+	return sc
+}
+
+func (s *Sim) updateScoring() {
+	sc := s.Scoring
+	if sc == nil {
+		return
+	}
+
+	if sc.Start.IsZero() {
+		// Scoring starts once prespawn is done.
+		sc.Start = s.State.SimTime
+	}
+	if sc.rules == nil {
+		for _, r := range sc.Rubrics {
+			rule, err := r.makeRule(s.State.Locate)
+			if err != nil {
+				// This should have been caught when the scenario was loaded.
+				s.lg.Errorf("%s: %v", r.Name, err)
+				rule = nopScoringRule{}
+			}
+			sc.rules = append(sc.rules, rule)
+		}
+	}
+	if s.scoringEvents == nil {
+		s.scoringEvents = s.eventStream.Subscribe()
+	}
+
+	ctx := &ScoringContext{State: s.State, IsHuman: s.isActiveHumanController, AircraftIndex: s.aircraftIndex}
+	events := s.scoringEvents.Get()
+	for i, rule := range sc.rules {
+		v := rule.Update(ctx)
+		for _, e := range events {
+			v = append(v, rule.Event(ctx, e)...)
+		}
+
+		res := &sc.Results[i]
+		for _, vi := range v {
+			s.lg.Info("scoring violation", slog.String("rubric", res.Name), slog.Any("violation", vi))
+			res.Violations = append(res.Violations, vi)
+		}
+		res.Penalty = float32(len(res.Violations)) * sc.Rubrics[i].Penalty
+		if limit := sc.Rubrics[i].MaxPenalty; limit > 0 {
+			res.Penalty = math.Min(res.Penalty, limit)
+		}
+	}
+}
+
+func (s *Sim) GetScoreReport() ScoreReport {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if s.Scoring == nil {
+		return ScoreReport{}
+	}
+
+	r := ScoreReport{
+		Start:      s.Scoring.Start,
+		End:        s.State.SimTime,
+		Score:      s.score(),
+		Rubrics:    slices.Clone(s.Scoring.Results),
+		Compliance: slices.Clone(s.ComplianceLog),
+		TCAS:       s.tcasRAsSince(s.Scoring.Start),
+		Hearback:   s.hearbackStats(s.Scoring.Start),
+	}
+	if s.Lesson != nil {
+		r.Lesson = s.Lesson.result()
+	}
+	return r
+}
+
+// score returns the current score, out of 100.
+func (s *Sim) score() float32 {
+	score := float32(100)
+	for _, res := range s.Scoring.Results {
+		score -= res.Penalty
+	}
+	return math.Max(0, score)
+}
+
+func init() {
+	RegisterScoringRule("separation", newSeparationRule)
+	RegisterScoringRule("handoff", newHandoffRule)
+	RegisterScoringRule("crossing", newCrossingRule)
+	RegisterScoringRule("missed_call", newMissedCallRule)
+	RegisterScoringRule("training_events", newTrainingEventsRule)
+	RegisterScoringRule("loa", newLOARule)
+	RegisterScoringRule("restrictions", newRestrictionsRule)
+	RegisterScoringRule("tcas", newTCASRule)
+	RegisterScoringRule("apreq", newAPREQRule)
+	RegisterScoringRule("tmi", newTMIRule)
+	RegisterScoringRule("weather", newWeatherRule)
+	RegisterScoringRule("priority", newPriorityRule)
+	RegisterScoringRule("pointout", newPointOutRule)
+	RegisterScoringRule("phraseology", newPhraseologyRule)
+}
+
+// unmarshalParams unmarshals a rubric's parameters, reporting unknown
+// ones as errors to catch typos.
+func unmarshalParams(params json.RawMessage, v any) error {
+	dec := json.NewDecoder(strings.NewReader(string(params)))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+type nopScoringRule struct{}
+
+func (nopScoringRule) Update(ctx *ScoringContext) []Violation         { return nil }
+func (nopScoringRule) Event(ctx *ScoringContext, e Event) []Violation { return nil }
+
+// humanResponsible returns the human controller responsible for the
+// aircraft, if there is one.
+func (ctx *ScoringContext) humanResponsible(ac *av.Aircraft) string {
+	if ctx.IsHuman(ac.ControllingController) {
+		return ac.ControllingController
+	} else if ctx.IsHuman(ac.TrackingController) {
+		return ac.TrackingController
+	}
+	return ""
+}
+
+///////////////////////////////////////////////////////////////////////////
+// separation
+
+// separationRule flags each time two aircraft that a human controller is
+// working lose both lateral and vertical separation.
+type separationRule struct {
+	LateralNM   float32 `json:"lateral_nm"`
+	VerticalFt  float32 `json:"vertical_ft"`
+	MinAltitude float32 `json:"min_altitude"` // ignore aircraft below
+
+	inConflict map[string]bool // "callsign1/callsign2"
+}
+
+func newSeparationRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &separationRule{LateralNM: 3, VerticalFt: 1000, MinAltitude: 1000, inConflict: make(map[string]bool)}
+	if err := unmarshalParams(params, r); err != nil {
+		return nil, err
+	}
+	if r.LateralNM <= 0 || r.VerticalFt <= 0 {
+		return nil, fmt.Errorf("\"lateral_nm\" and \"vertical_ft\" must be positive")
+	}
+	return r, nil
+}
+
+func (r *separationRule) Update(ctx *ScoringContext) []Violation {
+	eligible := func(ac *av.Aircraft) bool {
+		return ac.IsAirborne() && ac.Altitude() >= r.MinAltitude
+	}
+
+	var v []Violation
+	conflicts := make(map[string]bool)
+	for _, pair := range ctx.AircraftIndex.PairsWithin(r.LateralNM) {
+		ac0, ac1 := pair[0], pair[1]
+		if !eligible(ac0) || !eligible(ac1) {
+			continue
+		}
+		ctrl := ctx.humanResponsible(ac0)
+		if ctrl == "" {
+			ctrl = ctx.humanResponsible(ac1)
+		}
+		if ctrl == "" {
+			continue
+		}
+
+		dv := math.Abs(ac0.Altitude() - ac1.Altitude())
+		if dv >= r.VerticalFt {
+			continue
+		}
+		dl := math.NMDistance2LL(ac0.Position(), ac1.Position())
+		if dl >= r.LateralNM {
+			continue
+		}
+
+		key := ac0.Callsign + "/" + ac1.Callsign
+		conflicts[key] = true
+		if !r.inConflict[key] {
+			v = append(v, Violation{
+				Time:       ctx.State.SimTime,
+				Callsign:   key,
+				Controller: ctrl,
+				Message:    fmt.Sprintf("%.1f nm and %.0f ft apart", dl, dv),
+			})
+		}
+	}
+	r.inConflict = conflicts
+	return v
+}
+
+func (r *separationRule) Event(ctx *ScoringContext, e Event) []Violation { return nil }
+
+///////////////////////////////////////////////////////////////////////////
+// handoff
+
+// handoffRule flags handoffs to human controllers that aren't accepted
+// promptly and aircraft that leave a human controller's airspace without
+// a handoff having been initiated.
+type handoffRule struct {
+	AcceptSeconds int `json:"accept_seconds"`
+	// Aircraft within this distance of their arrival airport may leave
+	// the airspace without a handoff (e.g., by descending below it).
+	ArrivalNM float32 `json:"arrival_nm"`
+
+	offered map[string]time.Time // callsign -> time offered
+	flagged map[string]bool      // late handoffs already reported
+	inside  map[string]bool      // callsign -> inside tracking controller's airspace
+}
+
+func newHandoffRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &handoffRule{
+		AcceptSeconds: 60,
+		ArrivalNM:     10,
+		offered:       make(map[string]time.Time),
+		flagged:       make(map[string]bool),
+		inside:        make(map[string]bool),
+	}
+	if err := unmarshalParams(params, r); err != nil {
+		return nil, err
+	}
+	if r.AcceptSeconds <= 0 {
+		return nil, fmt.Errorf("\"accept_seconds\" must be positive")
+	}
+	return r, nil
+}
+
+func (r *handoffRule) Update(ctx *ScoringContext) []Violation {
+	var v []Violation
+	now := ctx.State.SimTime
+
+	for _, callsign := range util.SortedMapKeys(ctx.State.Aircraft) {
+		ac := ctx.State.Aircraft[callsign]
+
+		if to := ac.HandoffTrackController; ctx.IsHuman(to) {
+			t, ok := r.offered[callsign]
+			if !ok {
+				r.offered[callsign] = now
+			} else if now.Sub(t) > time.Duration(r.AcceptSeconds)*time.Second && !r.flagged[callsign] {
+				r.flagged[callsign] = true
+				v = append(v, Violation{
+					Time:       now,
+					Callsign:   callsign,
+					Controller: to,
+					Message:    fmt.Sprintf("handoff from %s not accepted within %d seconds", ac.TrackingController, r.AcceptSeconds),
+				})
+			}
+		} else {
+			delete(r.offered, callsign)
+			delete(r.flagged, callsign)
+		}
+
+		ctrl := ac.TrackingController
+		vols, ok := ctx.State.Airspace[ctrl]
+		if !ctx.IsHuman(ctrl) || !ok || !ac.IsAirborne() {
+			delete(r.inside, callsign)
+			continue
+		}
+		inside := false
+		for _, vol := range util.SortedMapKeys(vols) {
+			if in, _ := av.InAirspace(ac.Position(), ac.Altitude(), vols[vol]); in {
+				inside = true
+				break
+			}
+		}
+		if r.inside[callsign] && !inside && ac.HandoffTrackController == "" && !r.nearArrival(ac) {
+			v = append(v, Violation{
+				Time:       now,
+				Callsign:   callsign,
+				Controller: ctrl,
+				Message:    "left " + ctrl + "'s airspace without a handoff",
+			})
+		}
+		r.inside[callsign] = inside
+	}
+
+	// Forget about aircraft that are gone.
+	for _, m := range []map[string]bool{r.flagged, r.inside} {
+		for callsign := range m {
+			if _, ok := ctx.State.Aircraft[callsign]; !ok {
+				delete(m, callsign)
+			}
+		}
+	}
+
+	return v
+}
+
+func (r *handoffRule) nearArrival(ac *av.Aircraft) bool {
+	if ac.FlightPlan == nil {
+		return false
+	}
+	ap, ok := av.DB.Airports()[ac.FlightPlan.ArrivalAirport]
+	return ok && math.NMDistance2LL(ac.Position(), ap.Location) < r.ArrivalNM
+}
+
+func (r *handoffRule) Event(ctx *ScoringContext, e Event) []Violation { return nil }
+
+///////////////////////////////////////////////////////////////////////////
+// crossing
+
+// crossingRule checks that aircraft a human controller is working cross
+// a fix within an altitude range and, optionally, below a speed, as is
+// typically specified in an LOA. It can be limited to aircraft departing
+// or arriving at particular airports.
+type crossingRule struct {
+	Fix        string   `json:"fix"`
+	Altitude   [2]int   `json:"altitude"`
+	MaxSpeed   int      `json:"max_speed"`
+	Departures []string `json:"departure_airports"`
+	Arrivals   []string `json:"arrival_airports"`
+
+	location math.Point2LL
+	// Closest approach to the fix so far for aircraft within
+	// crossingRadius of it.
+	closest map[string]crossingSample
+	crossed map[string]bool
+}
+
+type crossingSample struct {
+	Distance float32
+	Altitude float32
+	IAS      float32
+	Ctrl     string
+}
+
+func newCrossingRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &crossingRule{closest: make(map[string]crossingSample), crossed: make(map[string]bool)}
+	if err := unmarshalParams(params, r); err != nil {
+		return nil, err
+	}
+	var ok bool
+	if r.Fix == "" {
+		return nil, fmt.Errorf("\"fix\" must be specified")
+	} else if r.location, ok = locate(r.Fix); !ok {
+		return nil, fmt.Errorf("%s: unknown fix", r.Fix)
+	}
+	if r.Altitude[0] > r.Altitude[1] {
+		return nil, fmt.Errorf("\"altitude\" range %d-%d is invalid", r.Altitude[0], r.Altitude[1])
+	}
+	if r.Altitude[1] == 0 && r.MaxSpeed == 0 {
+		return nil, fmt.Errorf("one of \"altitude\" or \"max_speed\" must be specified")
+	}
+	return r, nil
+}
+
+func (r *crossingRule) applies(ac *av.Aircraft) bool {
+	fp := ac.FlightPlan
+	return fp != nil && (len(r.Departures) == 0 || slices.Contains(r.Departures, fp.DepartureAirport)) &&
+		(len(r.Arrivals) == 0 || slices.Contains(r.Arrivals, fp.ArrivalAirport))
+}
+
+func (r *crossingRule) Update(ctx *ScoringContext) []Violation {
+	var v []Violation
+	for _, callsign := range util.SortedMapKeys(ctx.State.Aircraft) {
+		ac := ctx.State.Aircraft[callsign]
+		if r.crossed[callsign] || !ac.IsAirborne() || !r.applies(ac) {
+			continue
+		}
+
+		d := math.NMDistance2LL(ac.Position(), r.location)
+		prev, ok := r.closest[callsign]
+		if d < crossingRadius && (!ok || d <= prev.Distance) {
+			r.closest[callsign] = crossingSample{Distance: d, Altitude: ac.Altitude(), IAS: ac.IAS(),
+				Ctrl: ctx.humanResponsible(ac)}
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		// It's passed the fix; evaluate it at its closest approach if a
+		// human was working it.
+		r.crossed[callsign] = true
+		delete(r.closest, callsign)
+		if prev.Ctrl == "" {
+			continue
+		}
+		if p := makeCrossingWindow(r.Altitude, r.MaxSpeed).crossingProblem(prev.Altitude, prev.IAS); p != "" {
+			v = append(v, Violation{
+				Time:       ctx.State.SimTime,
+				Callsign:   callsign,
+				Controller: prev.Ctrl,
+				Message:    "crossed " + r.Fix + " " + p,
+			})
+		}
+	}
+
+	for callsign := range r.crossed {
+		if _, ok := ctx.State.Aircraft[callsign]; !ok {
+			delete(r.crossed, callsign)
+		}
+	}
+	for callsign := range r.closest {
+		if _, ok := ctx.State.Aircraft[callsign]; !ok {
+			delete(r.closest, callsign)
+		}
+	}
+
+	return v
+}
+
+func (r *crossingRule) Event(ctx *ScoringContext, e Event) []Violation { return nil }
+
+///////////////////////////////////////////////////////////////////////////
+// missed_call
+
+// missedCallRule flags aircraft that check in with a human controller and
+// aren't given an instruction within a given amount of time.
+type missedCallRule struct {
+	Seconds int `json:"seconds"`
+
+	pending map[string]Event // callsign -> check-in
+	times   map[string]time.Time
+}
+
+func newMissedCallRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &missedCallRule{Seconds: 60, pending: make(map[string]Event), times: make(map[string]time.Time)}
+	if err := unmarshalParams(params, r); err != nil {
+		return nil, err
+	}
+	if r.Seconds <= 0 {
+		return nil, fmt.Errorf("\"seconds\" must be positive")
+	}
+	return r, nil
+}
+
+func (r *missedCallRule) Event(ctx *ScoringContext, e Event) []Violation {
+	if e.Type != RadioTransmissionEvent {
+		return nil
+	}
+	switch e.RadioTransmissionType {
+	case av.RadioTransmissionContact:
+		if ctx.IsHuman(e.ToController) {
+			r.pending[e.Callsign] = e
+			r.times[e.Callsign] = ctx.State.SimTime
+		}
+	case av.RadioTransmissionReadback, av.RadioTransmissionUnexpected:
+		// The controller said something to the aircraft.
+		delete(r.pending, e.Callsign)
+		delete(r.times, e.Callsign)
+	}
+	return nil
+}
+
+func (r *missedCallRule) Update(ctx *ScoringContext) []Violation {
+	var v []Violation
+	now := ctx.State.SimTime
+	for _, callsign := range util.SortedMapKeys(r.pending) {
+		e := r.pending[callsign]
+		_, exists := ctx.State.Aircraft[callsign]
+		if late := now.Sub(r.times[callsign]) > time.Duration(r.Seconds)*time.Second; late || !exists {
+			if late && exists {
+				v = append(v, Violation{
+					Time:       now,
+					Callsign:   callsign,
+					Controller: e.ToController,
+					Message:    fmt.Sprintf("check-in not answered within %d seconds", r.Seconds),
+				})
+			}
+			delete(r.pending, callsign)
+			delete(r.times, callsign)
+		}
+	}
+	return v
+}
+
+///////////////////////////////////////////////////////////////////////////
+// training_events
+
+// trainingEventsRule flags injected pilot errors that weren't caught and
+// emergencies where the expected actions weren't all taken.
+type trainingEventsRule struct{}
+
+func newTrainingEventsRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	var r trainingEventsRule
+	return r, unmarshalParams(params, &r)
+}
+
+func (trainingEventsRule) Update(ctx *ScoringContext) []Violation { return nil }
+
+func (trainingEventsRule) Event(ctx *ScoringContext, e Event) []Violation {
+	missed := (e.Type == PilotErrorResolvedEvent && strings.HasSuffix(e.Message, ": missed")) ||
+		(e.Type == EmergencyResolvedEvent && strings.Contains(e.Message, ": missed"))
+	if !missed || !ctx.IsHuman(e.ToController) {
+		return nil
+	}
+	return []Violation{{
+		Time:       ctx.State.SimTime,
+		Callsign:   e.Callsign,
+		Controller: e.ToController,
+		Message:    e.Message,
+	}}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// loa
+
+// loaRule flags the violations of the scenario group's LOAs that are
+// found by Sim.checkLOAs; it can be limited to particular ones.
+type loaRule struct {
+	LOAs []string `json:"loas"` // LOA names; all if empty
+}
+
+func newLOARule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &loaRule{}
+	return r, unmarshalParams(params, r)
+}
+
+func (r *loaRule) Update(ctx *ScoringContext) []Violation { return nil }
+
+func (r *loaRule) Event(ctx *ScoringContext, e Event) []Violation {
+	if e.Type != LOAViolationEvent || !ctx.IsHuman(e.ToController) {
+		return nil
+	}
+	if name, _, _ := strings.Cut(e.Message, ": "); len(r.LOAs) > 0 && !slices.Contains(r.LOAs, name) {
+		return nil
+	}
+	return []Violation{{
+		Time:       ctx.State.SimTime,
+		Callsign:   e.Callsign,
+		Controller: e.ToController,
+		Message:    e.Message,
+	}}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// restrictions
+
+// restrictionsRule flags crossing restrictions and descend-via
+// clearances that weren't met; see compliance.go.
+type restrictionsRule struct {
+	Kinds []string `json:"kinds"` // "crossing", "descend via"; all if empty
+}
+
+func newRestrictionsRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &restrictionsRule{}
+	if err := unmarshalParams(params, r); err != nil {
+		return nil, err
+	}
+	for _, k := range r.Kinds {
+		if k != "crossing" && k != "descend via" {
+			return nil, fmt.Errorf("%q: unknown kind; must be \"crossing\" or \"descend via\"", k)
+		}
+	}
+	return r, nil
+}
+
+func (r *restrictionsRule) Update(ctx *ScoringContext) []Violation { return nil }
+
+func (r *restrictionsRule) Event(ctx *ScoringContext, e Event) []Violation {
+	if e.Type != RestrictionMissedEvent || !ctx.IsHuman(e.ToController) {
+		return nil
+	}
+	if len(r.Kinds) > 0 && !slices.ContainsFunc(r.Kinds, func(k string) bool { return strings.HasSuffix(e.Message, "("+k+")") }) {
+		return nil
+	}
+	return []Violation{{
+		Time:       ctx.State.SimTime,
+		Callsign:   e.Callsign,
+		Controller: e.ToController,
+		Message:    e.Message,
+	}}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// tcas
+
+// tcasRule flags TCAS RAs for aircraft that human controllers are working
+// and altitude instructions they issue to aircraft responding to an RA;
+// see tcas.go.
+type tcasRule struct {
+	// Only flag instructions during RAs, not the RAs themselves, which
+	// the separation rubric generally covers as well.
+	InstructionsOnly bool `json:"instructions_only"`
+}
+
+func newTCASRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &tcasRule{}
+	return r, unmarshalParams(params, r)
+}
+
+func (r *tcasRule) Update(ctx *ScoringContext) []Violation { return nil }
+
+func (r *tcasRule) Event(ctx *ScoringContext, e Event) []Violation {
+	if e.Type != TCASRAEvent || !ctx.IsHuman(e.ToController) {
+		return nil
+	}
+	if r.InstructionsOnly && !strings.HasPrefix(e.Message, "altitude instruction") {
+		return nil
+	}
+	return []Violation{{
+		Time:       ctx.State.SimTime,
+		Callsign:   e.Callsign,
+		Controller: e.ToController,
+		Message:    e.Message,
+	}}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// apreq
+
+// apreqRule flags releases that were requested late and release windows
+// that departures missed; see apreq.go.
+type apreqRule struct {
+	MissedOnly bool `json:"missed_only"` // don't flag late requests
+}
+
+func newAPREQRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &apreqRule{}
+	return r, unmarshalParams(params, r)
+}
+
+func (r *apreqRule) Update(ctx *ScoringContext) []Violation { return nil }
+
+func (r *apreqRule) Event(ctx *ScoringContext, e Event) []Violation {
+	if e.Type != APREQEvent || !ctx.IsHuman(e.ToController) {
+		return nil
+	}
+	if r.MissedOnly && !strings.Contains(e.Message, "window missed") {
+		return nil
+	}
+	return []Violation{{
+		Time:       ctx.State.SimTime,
+		Callsign:   e.Callsign,
+		Controller: e.ToController,
+		Message:    e.Message,
+	}}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// tmi
+
+// tmiRule flags aircraft that crossed a fix with a miles- or
+// minutes-in-trail restriction without enough spacing; see tmu.go. It can
+// be limited to the restrictions at particular fixes.
+type tmiRule struct {
+	Fixes []string `json:"fixes"` // all if empty
+}
+
+func newTMIRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &tmiRule{}
+	if err := unmarshalParams(params, r); err != nil {
+		return nil, err
+	}
+	for _, fix := range r.Fixes {
+		if _, ok := locate(fix); !ok {
+			return nil, fmt.Errorf("%s: unknown fix", fix)
+		}
+	}
+	return r, nil
+}
+
+func (r *tmiRule) Update(ctx *ScoringContext) []Violation { return nil }
+
+func (r *tmiRule) Event(ctx *ScoringContext, e Event) []Violation {
+	if e.Type != TMIViolationEvent || !ctx.IsHuman(e.ToController) {
+		return nil
+	}
+	if fix, _, _ := strings.Cut(e.Message, ": "); len(r.Fixes) > 0 && !slices.Contains(r.Fixes, fix) {
+		return nil
+	}
+	return []Violation{{
+		Time:       ctx.State.SimTime,
+		Callsign:   e.Callsign,
+		Controller: e.ToController,
+		Message:    e.Message,
+	}}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// weather
+
+// weatherRule flags aircraft that had to deviate around convective
+// weather on their own; see convective.go. It can be limited to
+// deviation requests that the controller didn't answer.
+type weatherRule struct {
+	UnansweredOnly bool `json:"unanswered_only"`
+}
+
+func newWeatherRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &weatherRule{}
+	return r, unmarshalParams(params, r)
+}
+
+func (r *weatherRule) Update(ctx *ScoringContext) []Violation { return nil }
+
+func (r *weatherRule) Event(ctx *ScoringContext, e Event) []Violation {
+	if e.Type != WeatherDeviationEvent || !ctx.IsHuman(e.ToController) {
+		return nil
+	}
+	if r.UnansweredOnly && !strings.Contains(e.Message, "not answered") {
+		return nil
+	}
+	return []Violation{{
+		Time:       ctx.State.SimTime,
+		Callsign:   e.Callsign,
+		Controller: e.ToController,
+		Message:    e.Message,
+	}}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// priority
+
+// priorityRule flags priority flights that weren't given the handling
+// they're due; see priority.go. It can be limited to some kinds of them,
+// given by their special handling indicators (e.g., "MEDEVAC").
+type priorityRule struct {
+	Kinds []string `json:"kinds"`
+}
+
+func newPriorityRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &priorityRule{}
+	if err := unmarshalParams(params, r); err != nil {
+		return nil, err
+	}
+	for _, k := range r.Kinds {
+		if k != stsMedevac && k != stsALTRV {
+			return nil, fmt.Errorf("%s: unknown kind of priority flight", k)
+		}
+	}
+	return r, nil
+}
+
+func (r *priorityRule) Update(ctx *ScoringContext) []Violation { return nil }
+
+func (r *priorityRule) Event(ctx *ScoringContext, e Event) []Violation {
+	if e.Type != PriorityHandlingEvent || !ctx.IsHuman(e.ToController) {
+		return nil
+	}
+	if kind, _, _ := strings.Cut(e.Message, ": "); len(r.Kinds) > 0 && !slices.Contains(r.Kinds, kind) {
+		return nil
+	}
+	return []Violation{{
+		Time:       ctx.State.SimTime,
+		Callsign:   e.Callsign,
+		Controller: e.ToController,
+		Message:    e.Message,
+	}}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// pointout
+
+// pointOutRule flags aircraft that entered another position's airspace
+// without being pointed out to it; see pointoutadvisor.go. It can be
+// limited to entries into the airspace of particular positions.
+type pointOutRule struct {
+	Positions []string `json:"positions"` // all if empty
+}
+
+func newPointOutRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	r := &pointOutRule{}
+	return r, unmarshalParams(params, r)
+}
+
+func (r *pointOutRule) Update(ctx *ScoringContext) []Violation { return nil }
+
+func (r *pointOutRule) Event(ctx *ScoringContext, e Event) []Violation {
+	if e.Type != MissedPointOutEvent || !ctx.IsHuman(e.ToController) {
+		return nil
+	}
+	if len(r.Positions) > 0 && !slices.Contains(r.Positions, e.FromController) {
+		return nil
+	}
+	return []Violation{{
+		Time:       ctx.State.SimTime,
+		Callsign:   e.Callsign,
+		Controller: e.ToController,
+		Message:    e.Message,
+	}}
+}
+
+///////////////////////////////////////////////////////////////////////////
+// phraseology
+
+// phraseologyRule flags nonstandard phraseology in clearances that were
+// given in words; see phraseology.go.
+type phraseologyRule struct{}
+
+func newPhraseologyRule(params json.RawMessage, locate func(string) (math.Point2LL, bool)) (ScoringRule, error) {
+	var r phraseologyRule
+	return r, unmarshalParams(params, &r)
+}
+
+func (phraseologyRule) Update(ctx *ScoringContext) []Violation { return nil }
+
+func (phraseologyRule) Event(ctx *ScoringContext, e Event) []Violation {
+	if e.Type != PhraseologyEvent || !ctx.IsHuman(e.FromController) {
+		return nil
+	}
+	return []Violation{{
+		Time:       ctx.State.SimTime,
+		Callsign:   e.Callsign,
+		Controller: e.FromController,
+		Message:    e.Message,
+	}}
+}
@@ -0,0 +1,293 @@
+// pkg/sim/scoring_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// makeScoringContext returns a ScoringContext for the given aircraft where
+// 2K is the only human controller.
+func makeScoringContext(aircraft ...*av.Aircraft) *ScoringContext {
+	ss := &State{
+		Aircraft:       make(map[string]*av.Aircraft),
+		SimTime:        time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC),
+		NmPerLongitude: 45.4,
+	}
+	for _, ac := range aircraft {
+		ss.Aircraft[ac.Callsign] = ac
+	}
+	return &ScoringContext{
+		State:         ss,
+		IsHuman:       func(tcp string) bool { return tcp == "2K" },
+		AircraftIndex: NewAircraftIndex(aircraft, nil, ss.NmPerLongitude),
+	}
+}
+
+func makeScoringAircraft(callsign, ctrl string, p math.Point2LL, alt float32) *av.Aircraft {
+	return &av.Aircraft{
+		Callsign:              callsign,
+		ControllingController: ctrl,
+		TrackingController:    ctrl,
+		Nav: av.Nav{FlightState: av.FlightState{
+			Position: p, Altitude: alt, IAS: 250,
+		}},
+	}
+}
+
+func TestRubricValidate(t *testing.T) {
+	locate := func(fix string) (math.Point2LL, bool) {
+		return math.Point2LL{-73.8, 40.7}, fix == "MERIT"
+	}
+
+	for _, test := range []struct {
+		rubric   Rubric
+		expected string
+	}{
+		{Rubric{Name: "Separation", Type: "separation", Penalty: 10}, ""},
+		{Rubric{Name: "Separation", Type: "separation", Params: json.RawMessage(`{"lateral_nm": 5}`)}, ""},
+		{Rubric{Type: "separation"}, `"name" must be specified`},
+		{Rubric{Name: "Bad", Type: "teleport"}, `"teleport": unknown rubric type`},
+		{Rubric{Name: "Bad", Type: "handoff", Penalty: -1}, "penalties must not be negative"},
+		{Rubric{Name: "Bad", Type: "handoff", MaxPenalty: -1}, "penalties must not be negative"},
+		{Rubric{Name: "Bad", Type: "separation", Params: json.RawMessage(`{"lateral_nm": 0}`)}, "must be positive"},
+		{Rubric{Name: "Typo", Type: "handoff", Params: json.RawMessage(`{"accept_secs": 30}`)}, "accept_secs"},
+		{Rubric{Name: "Crossing", Type: "crossing", Params: json.RawMessage(`{"fix": "MERIT", "altitude": [8000, 10000]}`)}, ""},
+		{Rubric{Name: "Crossing", Type: "crossing", Params: json.RawMessage(`{"fix": "NOWHR", "altitude": [8000, 10000]}`)},
+			"NOWHR: unknown fix"},
+		{Rubric{Name: "Crossing", Type: "crossing", Params: json.RawMessage(`{"fix": "MERIT", "altitude": [10000, 8000]}`)},
+			"range 10000-8000 is invalid"},
+		{Rubric{Name: "Crossing", Type: "crossing", Params: json.RawMessage(`{"fix": "MERIT"}`)},
+			`one of "altitude" or "max_speed"`},
+		{Rubric{Name: "Restrictions", Type: "restrictions", Params: json.RawMessage(`{"kinds": ["hold"]}`)},
+			`"hold": unknown kind`},
+		{Rubric{Name: "Priority", Type: "priority", Params: json.RawMessage(`{"kinds": ["MEDEVAC", "VIP"]}`)},
+			"VIP: unknown kind"},
+		{Rubric{Name: "TMI", Type: "tmi", Params: json.RawMessage(`{"fixes": ["MERIT", "NOWHR"]}`)}, "NOWHR: unknown fix"},
+	} {
+		err := test.rubric.Validate(locate)
+		if test.expected == "" && err != nil {
+			t.Errorf("%+v: unexpected error %v", test.rubric, err)
+		} else if test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)) {
+			t.Errorf("%+v: got error %v, expected one containing %q", test.rubric, err, test.expected)
+		}
+	}
+
+	for _, r := range DefaultRubrics {
+		if err := r.Validate(locate); err != nil {
+			t.Errorf("%s: default rubric is invalid: %v", r.Name, err)
+		}
+	}
+}
+
+func TestSeparationRule(t *testing.T) {
+	rule, err := newSeparationRule(json.RawMessage("{}"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Two miles apart laterally.
+	p0, p1 := math.Point2LL{-73.8, 40.7}, math.Point2LL{-73.8, 40.7 + 2.0/60}
+	for _, test := range []struct {
+		name       string
+		alt0, alt1 float32
+		ctrl1      string
+		violations int
+	}{
+		{name: "loss", alt0: 5000, alt1: 5500, ctrl1: "2K", violations: 1},
+		{name: "still in conflict", alt0: 5000, alt1: 5500, ctrl1: "2K"},
+		{name: "vertically separated", alt0: 5000, alt1: 6000, ctrl1: "2K"},
+		{name: "loss again", alt0: 5000, alt1: 5300, ctrl1: "2K", violations: 1},
+		{name: "separated again", alt0: 5000, alt1: 7000, ctrl1: "2K"},
+		{name: "no human", alt0: 5000, alt1: 5500},
+		{name: "below minimum altitude", alt0: 800, alt1: 900, ctrl1: "2K"},
+	} {
+		ctx := makeScoringContext(makeScoringAircraft("AAL1", "", p0, test.alt0),
+			makeScoringAircraft("UAL2", test.ctrl1, p1, test.alt1))
+		v := rule.Update(ctx)
+		if len(v) != test.violations {
+			t.Errorf("%s: got violations %+v, expected %d", test.name, v, test.violations)
+		} else if len(v) == 1 && v[0].Controller != "2K" {
+			t.Errorf("%s: got controller %q, expected 2K", test.name, v[0].Controller)
+		}
+	}
+}
+
+func TestHandoffRule(t *testing.T) {
+	rule, err := newHandoffRule(json.RawMessage(`{"accept_seconds": 30}`), nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	ac := makeScoringAircraft("AAL1", "N56", math.Point2LL{-73.8, 40.7}, 9000)
+	ac.HandoffTrackController = "2K"
+	ctx := makeScoringContext(ac)
+
+	for i, expected := range []int{0, 0, 1, 0} {
+		if v := rule.Update(ctx); len(v) != expected {
+			t.Errorf("update %d: got violations %+v, expected %d", i, v, expected)
+		} else if expected == 1 && (v[0].Controller != "2K" || v[0].Callsign != "AAL1") {
+			t.Errorf("update %d: got %+v", i, v[0])
+		}
+		ctx.State.SimTime = ctx.State.SimTime.Add(20 * time.Second)
+	}
+
+	// Once accepted, it starts over.
+	ac.HandoffTrackController = ""
+	ac.TrackingController = "2K"
+	if v := rule.Update(ctx); len(v) != 0 {
+		t.Errorf("got violations %+v after the handoff was accepted", v)
+	}
+}
+
+func TestMissedCallRule(t *testing.T) {
+	rule, err := newMissedCallRule(json.RawMessage(`{"seconds": 30}`), nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	ctx := makeScoringContext(makeScoringAircraft("AAL1", "2K", math.Point2LL{-73.8, 40.7}, 5000),
+		makeScoringAircraft("UAL2", "2K", math.Point2LL{-73.8, 40.7}, 7000),
+		makeScoringAircraft("DAL3", "N56", math.Point2LL{-73.8, 40.7}, 9000))
+
+	contact := func(callsign, ctrl string) Event {
+		return Event{Type: RadioTransmissionEvent, Callsign: callsign, ToController: ctrl,
+			RadioTransmissionType: av.RadioTransmissionContact}
+	}
+	rule.Event(ctx, contact("AAL1", "2K"))
+	rule.Event(ctx, contact("UAL2", "2K"))
+	rule.Event(ctx, contact("DAL3", "N56"))
+
+	// UAL2 gets an answer.
+	ctx.State.SimTime = ctx.State.SimTime.Add(10 * time.Second)
+	rule.Event(ctx, Event{Type: RadioTransmissionEvent, Callsign: "UAL2", ToController: "2K",
+		RadioTransmissionType: av.RadioTransmissionReadback})
+	if v := rule.Update(ctx); len(v) != 0 {
+		t.Errorf("got violations %+v before the limit", v)
+	}
+
+	ctx.State.SimTime = ctx.State.SimTime.Add(30 * time.Second)
+	v := rule.Update(ctx)
+	if len(v) != 1 || v[0].Callsign != "AAL1" || v[0].Controller != "2K" {
+		t.Errorf("got violations %+v, expected one for AAL1", v)
+	}
+	if v := rule.Update(ctx); len(v) != 0 {
+		t.Errorf("got violations %+v, expected AAL1 to only be flagged once", v)
+	}
+}
+
+func TestEventScoringRules(t *testing.T) {
+	ctx := makeScoringContext()
+
+	for _, test := range []struct {
+		typ      string
+		params   string
+		event    Event
+		violates bool
+	}{
+		{"loa", `{}`, Event{Type: LOAViolationEvent, ToController: "2K", Message: "N90-ZNY: too high"}, true},
+		{"loa", `{}`, Event{Type: LOAViolationEvent, ToController: "N56", Message: "N90-ZNY: too high"}, false},
+		{"loa", `{"loas": ["N90-ZDC"]}`, Event{Type: LOAViolationEvent, ToController: "2K", Message: "N90-ZNY: too high"}, false},
+		{"loa", `{}`, Event{Type: TCASRAEvent, ToController: "2K", Message: "N90-ZNY: too high"}, false},
+		{"restrictions", `{"kinds": ["descend via"]}`,
+			Event{Type: RestrictionMissedEvent, ToController: "2K", Message: "CAMRN at 11000 (descend via)"}, true},
+		{"restrictions", `{"kinds": ["descend via"]}`,
+			Event{Type: RestrictionMissedEvent, ToController: "2K", Message: "CAMRN at 11000 (crossing)"}, false},
+		{"tcas", `{}`, Event{Type: TCASRAEvent, ToController: "2K", Message: "climb RA"}, true},
+		{"tcas", `{"instructions_only": true}`, Event{Type: TCASRAEvent, ToController: "2K", Message: "climb RA"}, false},
+		{"tcas", `{"instructions_only": true}`,
+			Event{Type: TCASRAEvent, ToController: "2K", Message: "altitude instruction during RA"}, true},
+		{"apreq", `{"missed_only": true}`, Event{Type: APREQEvent, ToController: "2K", Message: "requested late"}, false},
+		{"apreq", `{"missed_only": true}`, Event{Type: APREQEvent, ToController: "2K", Message: "release window missed"}, true},
+		{"tmi", `{"fixes": ["MERIT"]}`, Event{Type: TMIViolationEvent, ToController: "2K", Message: "MERIT: 12 MIT"}, true},
+		{"tmi", `{"fixes": ["MERIT"]}`, Event{Type: TMIViolationEvent, ToController: "2K", Message: "GAYEL: 12 MIT"}, false},
+		{"weather", `{"unanswered_only": true}`, Event{Type: WeatherDeviationEvent, ToController: "2K", Message: "request not answered"}, true},
+		{"weather", `{"unanswered_only": true}`, Event{Type: WeatherDeviationEvent, ToController: "2K", Message: "deviated"}, false},
+		{"priority", `{"kinds": ["MEDEVAC"]}`, Event{Type: PriorityHandlingEvent, ToController: "2K", Message: "MEDEVAC: delayed"}, true},
+		{"priority", `{"kinds": ["MEDEVAC"]}`, Event{Type: PriorityHandlingEvent, ToController: "2K", Message: "ALTRV: delayed"}, false},
+		{"pointout", `{"positions": ["2J"]}`, Event{Type: MissedPointOutEvent, FromController: "2J", ToController: "2K"}, true},
+		{"pointout", `{"positions": ["2J"]}`, Event{Type: MissedPointOutEvent, FromController: "2H", ToController: "2K"}, false},
+		{"phraseology", `{}`, Event{Type: PhraseologyEvent, FromController: "2K", ToController: "N56"}, true},
+		{"phraseology", `{}`, Event{Type: PhraseologyEvent, FromController: "N56", ToController: "2K"}, false},
+		{"training_events", `{}`, Event{Type: PilotErrorResolvedEvent, ToController: "2K", Message: "wrong altitude: missed"}, true},
+		{"training_events", `{}`, Event{Type: PilotErrorResolvedEvent, ToController: "2K", Message: "wrong altitude: caught"}, false},
+		{"training_events", `{}`, Event{Type: EmergencyResolvedEvent, ToController: "2K", Message: "engine failure: missed squawk"}, true},
+	} {
+		rule, err := Rubric{Name: test.typ, Type: test.typ, Params: json.RawMessage(test.params)}.makeRule(ctx.State.Locate)
+		if err != nil {
+			t.Errorf("%s %s: unexpected error %v", test.typ, test.params, err)
+			continue
+		}
+		if v := rule.Event(ctx, test.event); (len(v) > 0) != test.violates {
+			t.Errorf("%s %s: %s: got violations %+v, expected violation %v", test.typ, test.params,
+				test.event.String(), v, test.violates)
+		}
+	}
+}
+
+func TestUpdateScoring(t *testing.T) {
+	s := newTestSim(t, &State{Aircraft: make(map[string]*av.Aircraft), SimTime: testSimTime})
+	s.humanControllers = map[string]*EventsSubscription{"2K": nil}
+	s.Scoring = newScoring([]Rubric{
+		{Name: "LOAs", Type: "loa", Penalty: 3, MaxPenalty: 5},
+		{Name: "RAs", Type: "tcas", Penalty: 40},
+	})
+
+	// Scoring starts with the first update.
+	s.updateScoring()
+	if start := s.Scoring.Start; !start.Equal(s.State.SimTime) {
+		t.Errorf("got start %s, expected %s", start, s.State.SimTime)
+	}
+
+	post := func(typ EventType, n int) {
+		for range n {
+			s.eventStream.Post(Event{Type: typ, Callsign: "AAL1", ToController: "2K", Message: "N90-ZNY: too high"})
+		}
+	}
+
+	for _, test := range []struct {
+		loa, tcas  int
+		penalties  [2]float32
+		violations int
+		score      float32
+	}{
+		{loa: 1, penalties: [2]float32{3, 0}, violations: 1, score: 97},
+		// The LOA penalty is limited to 5 points.
+		{loa: 2, tcas: 1, penalties: [2]float32{5, 40}, violations: 4, score: 55},
+		// The score doesn't go below 0.
+		{tcas: 2, penalties: [2]float32{5, 120}, violations: 6, score: 0},
+	} {
+		post(LOAViolationEvent, test.loa)
+		post(TCASRAEvent, test.tcas)
+		s.updateScoring()
+
+		var n int
+		for i, res := range s.Scoring.Results {
+			n += len(res.Violations)
+			if res.Penalty != test.penalties[i] {
+				t.Errorf("%s: got penalty %f, expected %f", res.Name, res.Penalty, test.penalties[i])
+			}
+		}
+		if n != test.violations {
+			t.Errorf("got %d violations, expected %d", n, test.violations)
+		}
+		if score := s.score(); score != test.score {
+			t.Errorf("got score %f, expected %f", score, test.score)
+		}
+	}
+
+	if r := newScoring(nil); len(r.Rubrics) != len(DefaultRubrics) || len(r.Results) != len(DefaultRubrics) {
+		t.Errorf("got %d rubrics, expected the %d defaults", len(r.Rubrics), len(DefaultRubrics))
+	}
+	if names := util.MapSlice(s.Scoring.Results, func(r RubricResult) string { return r.Name }); strings.Join(names, ",") != "LOAs,RAs" {
+		t.Errorf("got results %v", names)
+	}
+}
@@ -0,0 +1,433 @@
+// pkg/sim/script.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// Scenarios may include a script, written in Starlark, that reacts to
+// what happens in the sim; this makes it possible to write branching
+// training scenarios without changes to vice itself. The script's
+// top-level code registers hooks:
+//
+//	on("accepted_handoff", fn)  # fn(event) for each event of that type
+//	at(seconds, fn)             # fn() once, that long after the start
+//	every(seconds, fn)          # fn() repeatedly
+//
+// Event names are the snake_case versions of the EventTypes' names
+// (e.g., "aircraft_spawned", "accepted_handoff", "go_around"); hooks
+// are passed a struct with the event's type, callsign, from_controller,
+// to_controller, and message.
+//
+// Scripts can only affect the sim through the functions in the "sim"
+// module (see scriptEngine.module), and each call into the script is limited
+// in how much it may compute, so a buggy script can't hang the sim.
+// Errors in hooks are logged and otherwise ignored.
+//
+// Only the script's source and start time are saved with the sim. When
+// a saved sim is loaded, the top-level code runs again and at() hooks
+// for times that have passed are skipped, but any state that the hooks
+// had accumulated is lost. The script is restarted the same way when the
+// sim is rewound, so at() hooks after the checkpoint run again.
+
+type ScenarioScript struct {
+	Source string
+	// Sim time when the script started running; at() times are relative
+	// to it.
+	Start time.Time
+}
+
+// maxScriptSteps bounds the amount of computation for a single call into
+// the script.
+const maxScriptSteps = 1000000
+
+var scriptFileOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+}
+
+// scriptEventNames maps the script's names for events to their
+// EventTypes.
+var scriptEventNames = func() map[string]EventType {
+	m := make(map[string]EventType)
+	for t := range EventType(NumEventTypes) {
+		m[scriptEventName(t)] = t
+	}
+	return m
+}()
+
+// scriptEventName returns the name that scripts use for the given event
+// type: "AcceptedHandoff" is "accepted_handoff", and so forth.
+func scriptEventName(t EventType) string {
+	name := strings.TrimSuffix(t.String(), "Event")
+	var sb strings.Builder
+	for i := range len(name) {
+		c := name[i]
+		if isUpper(c) {
+			// Start a new word at a capital that follows a lowercase
+			// letter or that starts a word after an acronym, as in
+			// "LOAViolation".
+			if i > 0 && (!isUpper(name[i-1]) || (i+1 < len(name) && !isUpper(name[i+1]))) {
+				sb.WriteByte('_')
+			}
+			c += 'a' - 'A'
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
+
+// CompileScript checks the given script for syntax errors and references
+// to undefined names; it doesn't run it.
+func CompileScript(source string) error {
+	predeclared := (&scriptEngine{}).predeclared()
+	_, _, err := starlark.SourceProgramOptions(scriptFileOptions, "script", source, predeclared.Has)
+	return err
+}
+
+type scriptEngine struct {
+	sim    *Sim
+	hooks  map[EventType][]starlark.Callable
+	events *EventsSubscription
+	// The at() and every() hooks' callbacks and the clock they were
+	// scheduled with.
+	clock     *TimeSource
+	callbacks []CallbackID
+}
+
+// updateScript starts the scenario's script if it hasn't been started
+// already and then runs the hooks for the events since the last update.
+func (s *Sim) updateScript() {
+	if s.Script == nil {
+		return
+	}
+
+	if s.script == nil {
+		if s.Script.Start.IsZero() {
+			s.Script.Start = s.State.SimTime
+		}
+		s.script = s.startScript()
+	}
+
+	for _, e := range s.script.events.Get() {
+		for _, fn := range s.script.hooks[e.Type] {
+			s.script.call(fn, scriptEvent(e))
+		}
+	}
+}
+
+// startScript runs the script's top-level code, which registers its
+// hooks. If it fails, the error is logged and the script is left with
+// whatever hooks were registered before the error.
+func (s *Sim) startScript() *scriptEngine {
+	e := &scriptEngine{
+		sim:    s,
+		hooks:  make(map[EventType][]starlark.Callable),
+		events: s.eventStream.Subscribe(),
+		clock:  s.clock,
+	}
+
+	// The globals aren't frozen so that hooks can keep state in them.
+	_, prog, err := starlark.SourceProgramOptions(scriptFileOptions, "script", s.Script.Source, e.predeclared().Has)
+	if err != nil {
+		s.lg.Errorf("script: %v", err)
+		return e
+	}
+	if _, err := prog.Init(e.thread(), e.predeclared()); err != nil {
+		s.lg.Errorf("script: %s", scriptErrorString(err))
+	}
+	return e
+}
+
+// stopScript stops the script; it is restarted at the next update.
+func (s *Sim) stopScript() {
+	if s.script != nil {
+		s.script.events.Unsubscribe()
+		for _, id := range s.script.callbacks {
+			s.script.clock.Cancel(id)
+		}
+		s.script = nil
+	}
+}
+
+func (e *scriptEngine) thread() *starlark.Thread {
+	t := &starlark.Thread{
+		Name:  "script",
+		Print: func(_ *starlark.Thread, msg string) { e.sim.lg.Infof("script: %s", msg) },
+	}
+	t.SetMaxExecutionSteps(maxScriptSteps)
+	return t
+}
+
+func (e *scriptEngine) call(fn starlark.Callable, args ...starlark.Value) {
+	if _, err := starlark.Call(e.thread(), fn, args, nil); err != nil {
+		e.sim.lg.Warnf("script: %s: %s", fn.Name(), scriptErrorString(err))
+	}
+}
+
+func scriptErrorString(err error) string {
+	if ee, ok := err.(*starlark.EvalError); ok {
+		return ee.Backtrace()
+	}
+	return err.Error()
+}
+
+func scriptEvent(e Event) starlark.Value {
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"type":            starlark.String(scriptEventName(e.Type)),
+		"callsign":        starlark.String(e.Callsign),
+		"from_controller": starlark.String(e.FromController),
+		"to_controller":   starlark.String(e.ToController),
+		"message":         starlark.String(e.Message),
+	})
+}
+
+func (e *scriptEngine) predeclared() starlark.StringDict {
+	return starlark.StringDict{
+		"on":    starlark.NewBuiltin("on", e.on),
+		"at":    starlark.NewBuiltin("at", e.at),
+		"every": starlark.NewBuiltin("every", e.every),
+		"sim":   e.module(),
+	}
+}
+
+func (e *scriptEngine) on(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var fn starlark.Callable
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "event", &name, "fn", &fn); err != nil {
+		return nil, err
+	}
+	t, ok := scriptEventNames[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %q: unknown event", b.Name(), name)
+	}
+	e.hooks[t] = append(e.hooks[t], fn)
+	return starlark.None, nil
+}
+
+func (e *scriptEngine) at(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var secondsValue starlark.Value
+	var fn starlark.Callable
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "seconds", &secondsValue, "fn", &fn); err != nil {
+		return nil, err
+	}
+	seconds, ok := starlark.AsFloat(secondsValue)
+	if !ok {
+		return nil, fmt.Errorf("%s: got %s for seconds, want float or int", b.Name(), secondsValue.Type())
+	}
+	s := e.sim
+	t := s.Script.Start.Add(time.Duration(seconds * float64(time.Second)))
+	// When a saved sim is resumed, don't run hooks whose time has passed.
+	if !t.Before(e.clock.Now()) {
+		e.callbacks = append(e.callbacks, e.clock.Schedule(t, func() { e.call(fn) }))
+	}
+	return starlark.None, nil
+}
+
+func (e *scriptEngine) every(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var secondsValue starlark.Value
+	var fn starlark.Callable
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "seconds", &secondsValue, "fn", &fn); err != nil {
+		return nil, err
+	}
+	seconds, ok := starlark.AsFloat(secondsValue)
+	if !ok {
+		return nil, fmt.Errorf("%s: got %s for seconds, want float or int", b.Name(), secondsValue.Type())
+	}
+	if seconds < 1 {
+		return nil, fmt.Errorf("%s: interval must be at least 1 second", b.Name())
+	}
+	interval := time.Duration(seconds * float64(time.Second))
+	e.callbacks = append(e.callbacks, e.clock.Every(interval, func() { e.call(fn) }))
+	return starlark.None, nil
+}
+
+// module returns the "sim" module, which holds the functions that
+// scripts use to inspect and affect the sim. They are called during the
+// sim's update, with its lock held.
+func (e *scriptEngine) module() *starlarkstruct.Module {
+	builtins := map[string]func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error){
+		"aircraft":         e.aircraft,
+		"aircraft_info":    e.aircraftInfo,
+		"message":          e.message,
+		"pilot_request":    e.pilotRequest,
+		"set_wind":         e.setWind,
+		"spawn_arrival":    e.spawnArrival,
+		"spawn_departure":  e.spawnDeparture,
+		"spawn_overflight": e.spawnOverflight,
+		"time":             e.time,
+	}
+	m := &starlarkstruct.Module{Name: "sim", Members: make(starlark.StringDict)}
+	for name, f := range builtins {
+		m.Members[name] = starlark.NewBuiltin(name, f)
+	}
+	return m
+}
+
+// time returns the number of seconds since the script started.
+func (e *scriptEngine) time(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	return starlark.Float(e.sim.State.SimTime.Sub(e.sim.Script.Start).Seconds()), nil
+}
+
+// aircraft returns the callsigns of all of the aircraft, sorted.
+func (e *scriptEngine) aircraft(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	var callsigns []starlark.Value
+	for _, callsign := range util.SortedMapKeys(e.sim.State.Aircraft) {
+		callsigns = append(callsigns, starlark.String(callsign))
+	}
+	return starlark.NewList(callsigns), nil
+}
+
+// aircraftInfo returns a struct describing the given aircraft or None if
+// there is no such aircraft.
+func (e *scriptEngine) aircraftInfo(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var callsign string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "callsign", &callsign); err != nil {
+		return nil, err
+	}
+	ac, ok := e.sim.State.Aircraft[callsign]
+	if !ok {
+		return starlark.None, nil
+	}
+	info := starlark.StringDict{
+		"callsign":               starlark.String(ac.Callsign),
+		"altitude":               starlark.Float(ac.Altitude()),
+		"heading":                starlark.Float(ac.Heading()),
+		"speed":                  starlark.Float(ac.IAS()),
+		"tracking_controller":    starlark.String(ac.TrackingController),
+		"controlling_controller": starlark.String(ac.ControllingController),
+		"squawk":                 starlark.String(ac.Squawk.String()),
+	}
+	if fp := ac.FlightPlan; fp != nil {
+		info["type"] = starlark.String(fp.AircraftType)
+		info["departure"] = starlark.String(fp.DepartureAirport)
+		info["arrival"] = starlark.String(fp.ArrivalAirport)
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, info), nil
+}
+
+// spawned adds the given aircraft and returns its callsign; if the
+// aircraft couldn't be created, None is returned.
+func spawned(ac *av.Aircraft, err error, add func(*av.Aircraft)) (starlark.Value, error) {
+	if err != nil {
+		return nil, err
+	} else if ac == nil {
+		return starlark.None, nil
+	}
+	add(ac)
+	return starlark.String(ac.Callsign), nil
+}
+
+func (e *scriptEngine) spawnArrival(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var group, airport string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "group", &group, "airport", &airport); err != nil {
+		return nil, err
+	}
+	s := e.sim
+	if _, ok := s.State.InboundFlows[group]; !ok {
+		return nil, fmt.Errorf("%s: %q: unknown inbound flow", b.Name(), group)
+	}
+	ac, err := s.createArrivalNoLock(group, airport)
+	return spawned(ac, err, func(ac *av.Aircraft) { s.addAircraftNoLock(*ac) })
+}
+
+func (e *scriptEngine) spawnDeparture(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var airport, runway, category string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "airport", &airport, "runway", &runway,
+		"category?", &category); err != nil {
+		return nil, err
+	}
+	s := e.sim
+	if _, ok := s.DepartureState[airport][runway]; !ok {
+		return nil, fmt.Errorf("%s: %s/%s: not an active departure runway", b.Name(), airport, runway)
+	}
+	ac, err := s.createIFRDepartureNoLock(airport, runway, category)
+	return spawned(ac, err, func(ac *av.Aircraft) {
+		if !ac.HoldForRelease {
+			ac.ReleaseTime = s.clock.Now()
+		}
+		s.addDepartureToPool(ac, runway)
+	})
+}
+
+func (e *scriptEngine) spawnOverflight(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var group string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "group", &group); err != nil {
+		return nil, err
+	}
+	s := e.sim
+	if _, ok := s.State.InboundFlows[group]; !ok {
+		return nil, fmt.Errorf("%s: %q: unknown inbound flow", b.Name(), group)
+	}
+	ac, err := s.createOverflightNoLock(group)
+	return spawned(ac, err, func(ac *av.Aircraft) { s.addAircraftNoLock(*ac) })
+}
+
+func (e *scriptEngine) setWind(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var wind av.Wind
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "direction", &wind.Direction, "speed", &wind.Speed,
+		"gust?", &wind.Gust); err != nil {
+		return nil, err
+	}
+	if wind.Direction < 0 || wind.Direction > 360 || wind.Speed < 0 || (wind.Gust != 0 && wind.Gust < wind.Speed) {
+		return nil, fmt.Errorf("%s: %03d%02dG%02d: invalid wind", b.Name(), wind.Direction, wind.Speed, wind.Gust)
+	}
+	e.sim.State.Wind = wind
+	return starlark.None, nil
+}
+
+// pilotRequest has the pilot of the given aircraft say something to its
+// controller.
+func (e *scriptEngine) pilotRequest(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var callsign, msg string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "callsign", &callsign, "message", &msg); err != nil {
+		return nil, err
+	}
+	ac, ok := e.sim.State.Aircraft[callsign]
+	if !ok {
+		return nil, fmt.Errorf("%s: %s: no such aircraft", b.Name(), callsign)
+	}
+	if ac.ControllingController != "" {
+		e.sim.postRadioEvents(callsign, []av.RadioTransmission{av.RadioTransmission{
+			Controller: ac.ControllingController,
+			Message:    msg,
+			Type:       av.RadioTransmissionContact,
+		}})
+	}
+	return starlark.None, nil
+}
+
+// message sends a message to all of the controllers.
+func (e *scriptEngine) message(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var msg string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "message", &msg); err != nil {
+		return nil, err
+	}
+	e.sim.eventStream.Post(Event{
+		Type:    GlobalMessageEvent,
+		Message: msg,
+	})
+	return starlark.None, nil
+}
@@ -0,0 +1,146 @@
+// pkg/sim/script_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+func TestScriptEventNames(t *testing.T) {
+	for et, name := range map[EventType]string{
+		AcceptedHandoffEvent:           "accepted_handoff",
+		AcceptedRedirectedHandoffEvent: "accepted_redirected_handoff",
+		AircraftSpawnedEvent:           "aircraft_spawned",
+		LOAViolationEvent:              "loa_violation",
+		TCASRAEvent:                    "tcasra",
+		ForceQLEvent:                   "force_ql",
+	} {
+		if got := scriptEventName(et); got != name {
+			t.Errorf("%s: got %q, expected %q", et, got, name)
+		}
+	}
+}
+
+func TestCompileScript(t *testing.T) {
+	if err := CompileScript(`on("ident", lambda e: sim.message(e.callsign))`); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, src := range []string{`on("ident", lambda e: print(e)`, `launch_missiles()`} {
+		if err := CompileScript(src); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+func TestScriptHooks(t *testing.T) {
+	s := newTestSim(t, &State{
+		Aircraft: map[string]*av.Aircraft{
+			"AAL1": {Callsign: "AAL1", ControllingController: "2K"},
+		},
+		SimTime: time.Date(2024, 6, 1, 15, 4, 0, 0, time.UTC),
+	})
+	s.Script = &ScenarioScript{Source: `
+state = {"handoffs": 0}
+
+def accepted(e):
+    state["handoffs"] += 1
+    sim.pilot_request(e.callsign, "request higher, handoff %d" % state["handoffs"])
+on("accepted_handoff", accepted)
+
+def spin(e):
+    while True:
+        pass
+on("ident", spin)
+
+at(30, lambda: sim.set_wind(270, 15, gust = 25))
+`}
+	sub := s.eventStream.Subscribe()
+
+	s.updateScript()
+	s.eventStream.Post(Event{Type: IdentEvent, Callsign: "AAL1"})
+	s.eventStream.Post(Event{Type: AcceptedHandoffEvent, Callsign: "AAL1"})
+	s.eventStream.Post(Event{Type: AcceptedHandoffEvent, Callsign: "AAL1"})
+	// The runaway hook should be stopped and the others should still run.
+	s.updateScript()
+
+	var msgs []string
+	for _, e := range sub.Get() {
+		if e.Type == RadioTransmissionEvent && e.ToController == "2K" {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	if len(msgs) != 2 || msgs[1] != "request higher, handoff 2" {
+		t.Errorf("unexpected pilot requests %q", msgs)
+	}
+
+	for range 29 {
+		s.clock.Tick(func() {})
+	}
+	if s.State.Wind.Speed != 0 {
+		t.Errorf("wind changed early")
+	}
+	s.clock.Tick(func() {})
+	if s.State.Wind != (av.Wind{Direction: 270, Speed: 15, Gust: 25}) {
+		t.Errorf("unexpected wind %+v", s.State.Wind)
+	}
+}
+
+func TestScriptRestart(t *testing.T) {
+	s := newTestSim(t, &State{SimTime: time.Date(2024, 6, 1, 15, 4, 0, 0, time.UTC)})
+	s.Script = &ScenarioScript{Source: `
+state = {"n": 0}
+def tick():
+    state["n"] += 1
+    sim.message("tick %d" % state["n"])
+every(10, tick)
+at(25, lambda: sim.message("at 25"))
+`}
+	sub := s.eventStream.Subscribe()
+	messages := func() []string {
+		var msgs []string
+		for _, e := range sub.Get() {
+			if e.Type == GlobalMessageEvent {
+				msgs = append(msgs, e.Message)
+			}
+		}
+		return msgs
+	}
+	run := func(n int) {
+		for range n {
+			s.clock.Tick(s.updateScript)
+		}
+	}
+
+	s.updateScript()
+	s.takeCheckpoint()
+	run(30)
+	if msgs := messages(); !slices.Equal(msgs, []string{"tick 1", "tick 2", "at 25", "tick 3"}) {
+		t.Errorf("got messages %q", msgs)
+	}
+
+	// After a rewind, the script starts over: its state is reset and the
+	// at() hook runs again.
+	if err := s.Rewind("2K", time.Minute); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	sub.Get()
+	s.updateScript()
+	run(30)
+	if msgs := messages(); !slices.Equal(msgs, []string{"tick 1", "tick 2", "at 25", "tick 3"}) {
+		t.Errorf("got messages %q after rewind", msgs)
+	}
+
+	// A stopped script's hooks don't run.
+	s.stopScript()
+	s.Script = nil
+	run(30)
+	if msgs := messages(); len(msgs) != 0 {
+		t.Errorf("stopped script sent %q", msgs)
+	}
+}
@@ -0,0 +1,260 @@
+// pkg/sim/sectorization.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Each control position is delegated the airspace volumes that the
+// scenario assigns it; a sectorization is one such assignment. Besides
+// the scenario's default, it may adapt others--a night configuration
+// where a few positions take everything, for example--that take effect
+// at scheduled times or when a controller resectorizes. When the
+// airspace is resectorized, handoffs that are pending to controllers
+// who no longer own any airspace are redirected to whoever has taken
+// over most of their volumes.
+//
+// The owner of the airspace at a point is the controller working the
+// position it's delegated to, accounting for consolidation and the
+// split configuration.
+
+// Sectorization assigns airspace volumes to control positions.
+type Sectorization map[string][]string // position -> volume names
+
+// DefaultSectorization is the name of the scenario's "airspace"
+// assignment.
+const DefaultSectorization = "default"
+
+// ScheduledSectorization specifies a sectorization that takes effect at
+// a given time after the sim starts.
+type ScheduledSectorization struct {
+	Sectorization string  `json:"sectorization"`
+	AfterMinutes  float32 `json:"after_minutes"`
+}
+
+type FutureSectorization struct {
+	Name string
+	Time time.Time
+}
+
+// makeAirspace returns the airspace of each position under the given
+// sectorization. For single-controller sims, all of the airspace goes to
+// primary.
+func makeAirspace(sect Sectorization, volumes map[string][]av.ControllerAirspaceVolume,
+	local bool, primary string) map[string]map[string][]av.ControllerAirspaceVolume {
+	if len(sect) == 0 {
+		return nil
+	}
+
+	airspace := make(map[string]map[string][]av.ControllerAirspaceVolume)
+	for ctrl, vnames := range sect {
+		if local {
+			ctrl = primary
+		}
+		if _, ok := airspace[ctrl]; !ok {
+			airspace[ctrl] = make(map[string][]av.ControllerAirspaceVolume)
+		}
+		for _, vname := range vnames {
+			// Remap from strings provided in the scenario to the actual
+			// volumes defined in the scenario group.
+			airspace[ctrl][vname] = volumes[vname]
+		}
+	}
+	return airspace
+}
+
+// airspaceOwner returns the controller who is currently working the
+// given position's airspace.
+func (ss *State) airspaceOwner(pos string) string {
+	if _, ok := ss.MultiControllers[pos]; ok {
+		active := func(id string) bool {
+			_, ok := ss.Controllers[id]
+			return ok
+		}
+		if id, err := ss.MultiControllers.ResolveController(pos, active); err == nil {
+			pos = id
+		}
+	}
+	return ss.resolveConsolidation(pos)
+}
+
+// airspaceOwnersIn returns the controllers who own the given airspace at
+// the given point.
+func (ss *State) airspaceOwnersIn(airspace map[string]map[string][]av.ControllerAirspaceVolume,
+	p math.Point2LL, alt float32) []string {
+	var owners []string
+	for _, pos := range util.SortedMapKeys(airspace) {
+		var vols []av.ControllerAirspaceVolume
+		for _, name := range util.SortedMapKeys(airspace[pos]) {
+			vols = append(vols, airspace[pos][name]...)
+		}
+		if in, _ := av.InAirspace(p, alt, vols); in {
+			if owner := ss.airspaceOwner(pos); !slices.Contains(owners, owner) {
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
+
+// airspaceOwnersAt returns the controllers who own the airspace at the
+// given point.
+func (ss *State) airspaceOwnersAt(p math.Point2LL, alt float32) []string {
+	return ss.airspaceOwnersIn(ss.Airspace, p, alt)
+}
+
+// AirspaceOwner returns the controller who owns the airspace at the given
+// point, or the empty string if no one does. If volumes overlap there,
+// the first position in alphabetical order is returned.
+func (ss *State) AirspaceOwner(p math.Point2LL, alt float32) string {
+	if owners := ss.airspaceOwnersAt(p, alt); len(owners) > 0 {
+		return owners[0]
+	}
+	return ""
+}
+
+// AirspaceOwnerAt returns the controller who will own the airspace at the
+// given point at time t, accounting for scheduled resectorizations but
+// assuming that the positions are staffed as they are now.
+func (s *Sim) AirspaceOwnerAt(p math.Point2LL, alt float32, t time.Time) string {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	airspace := s.State.Airspace
+	var latest time.Time
+	for _, fs := range s.FutureSectorizations {
+		if !fs.Time.After(t) && !fs.Time.Before(latest) {
+			latest = fs.Time
+			airspace = makeAirspace(s.State.Sectorizations[fs.Name], s.AirspaceVolumes, s.LocalAirspace,
+				s.State.PrimaryController)
+		}
+	}
+
+	if owners := s.State.airspaceOwnersIn(airspace, p, alt); len(owners) > 0 {
+		return owners[0]
+	}
+	return ""
+}
+
+func (s *Sim) scheduleSectorizations(sched []ScheduledSectorization) {
+	for _, ss := range sched {
+		s.FutureSectorizations = append(s.FutureSectorizations, FutureSectorization{
+			Name: ss.Sectorization,
+			Time: s.State.SimTime.Add(time.Duration(ss.AfterMinutes * float32(time.Minute))),
+		})
+	}
+}
+
+// updateSectorizations applies scheduled sectorizations whose time has
+// come; it's called once a second.
+func (s *Sim) updateSectorizations() {
+	now := s.State.SimTime
+	s.FutureSectorizations = slices.DeleteFunc(s.FutureSectorizations, func(fs FutureSectorization) bool {
+		if now.Before(fs.Time) {
+			return false
+		}
+		s.resectorize(fs.Name)
+		return true
+	})
+}
+
+// Resectorize switches to the named sectorization.
+func (s *Sim) Resectorize(tcp, name string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.isActiveHumanController(tcp) {
+		return av.ErrNoController
+	}
+	names := util.SortedMapKeys(s.State.Sectorizations)
+	idx := slices.IndexFunc(names, func(n string) bool { return strings.EqualFold(n, name) })
+	if idx == -1 {
+		return ErrUnknownSectorization
+	}
+	name = names[idx]
+
+	s.lg.Info("resectorize", slog.String("tcp", tcp), slog.String("sectorization", name))
+	s.resectorize(name)
+	return nil
+}
+
+func (s *Sim) resectorize(name string) {
+	prev := s.State.Airspace
+	s.State.Airspace = makeAirspace(s.State.Sectorizations[name], s.AirspaceVolumes, s.LocalAirspace,
+		s.State.PrimaryController)
+	s.State.Sectorization = name
+
+	// Find who owns each volume now.
+	newOwner := make(map[string]string) // volume name -> controller
+	for _, pos := range util.SortedMapKeys(s.State.Airspace) {
+		owner := s.State.airspaceOwner(pos)
+		for vname := range s.State.Airspace[pos] {
+			newOwner[vname] = owner
+		}
+	}
+
+	// For each controller who owned airspace before but doesn't now,
+	// hand their pending handoffs to whoever has the most of their
+	// volumes.
+	oldVolumes := make(map[string][]string) // controller -> volume names
+	for pos, vols := range prev {
+		owner := s.State.airspaceOwner(pos)
+		oldVolumes[owner] = append(oldVolumes[owner], slices.Collect(maps.Keys(vols))...)
+	}
+	for _, from := range util.SortedMapKeys(oldVolumes) {
+		if slices.Contains(slices.Collect(maps.Values(newOwner)), from) {
+			continue
+		}
+
+		counts := make(map[string]int)
+		for _, vname := range oldVolumes[from] {
+			if o, ok := newOwner[vname]; ok {
+				counts[o]++
+			}
+		}
+		to := ""
+		for _, o := range util.SortedMapKeys(counts) {
+			if to == "" || counts[o] > counts[to] {
+				to = o
+			}
+		}
+		if _, ok := s.State.Controllers[to]; !ok {
+			continue
+		}
+
+		var handoffs []string
+		for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+			if s.State.Aircraft[callsign].HandoffTrackController == from {
+				handoffs = append(handoffs, callsign)
+			}
+		}
+		if len(handoffs) == 0 {
+			continue
+		}
+		s.transferPosition(from, to, func(ac *av.Aircraft) bool { return slices.Contains(handoffs, ac.Callsign) })
+		for _, callsign := range handoffs {
+			ac := s.State.Aircraft[callsign]
+			if _, ok := s.Handoffs[callsign]; !ok && !s.isActiveHumanController(to) {
+				s.Handoffs[callsign] = s.makeVirtualHandoff(ac.TrackingController)
+			}
+		}
+		s.lg.Info("resectorization redirected handoffs", slog.String("from", from),
+			slog.String("to", to), slog.Any("callsigns", handoffs))
+	}
+
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: "Airspace has been resectorized: " + name + ".",
+	})
+}
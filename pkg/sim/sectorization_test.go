@@ -0,0 +1,101 @@
+// pkg/sim/sectorization_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/rand"
+)
+
+func TestSectorization(t *testing.T) {
+	box := func(x0, x1 float32) []av.ControllerAirspaceVolume {
+		return []av.ControllerAirspaceVolume{{
+			LowerLimit: 0,
+			UpperLimit: 10000,
+			Boundaries: [][]math.Point2LL{{{x0, 0}, {x1, 0}, {x1, 1}, {x0, 1}}},
+		}}
+	}
+	volumes := map[string][]av.ControllerAirspaceVolume{"WEST": box(0, 1), "EAST": box(1, 2)}
+	day := Sectorization{"2A": {"WEST"}, "2B": {"EAST"}}
+	night := Sectorization{"2A": {"WEST", "EAST"}}
+
+	if a := makeAirspace(day, volumes, true, "2B"); len(a) != 1 || len(a["2B"]) != 2 {
+		t.Errorf("local airspace %v: expected all volumes for 2B", a)
+	}
+
+	start := time.Date(2024, 6, 1, 15, 4, 0, 0, time.UTC)
+	ac := &av.Aircraft{Callsign: "AAL1", TrackingController: "N4P", HandoffTrackController: "2B"}
+	s := newTestSim(t, &State{
+		Aircraft: map[string]*av.Aircraft{"AAL1": ac},
+		Controllers: map[string]*av.Controller{
+			"2A":  {TCP: "2A", FacilityIdentifier: "P", Facility: "PCT"},
+			"2B":  {TCP: "2B", FacilityIdentifier: "P", Facility: "PCT"},
+			"N4P": {TCP: "N4P", Facility: "N90"},
+		},
+		Airspace:       makeAirspace(day, volumes, false, ""),
+		Sectorization:  DefaultSectorization,
+		Sectorizations: map[string]Sectorization{DefaultSectorization: day, "night": night},
+		TRACON:         "PCT",
+		SimTime:        start,
+	})
+	s.State.ERAMComputers = MakeERAMComputers(0o22, s.lg)
+	s.State.ERAMComputers.Activate()
+	s.AirspaceVolumes = volumes
+	s.Handoffs = make(map[string]Handoff)
+	s.humanControllers = map[string]*EventsSubscription{"2A": nil}
+	s.Rand = rand.New()
+	s.scheduleSectorizations([]ScheduledSectorization{{Sectorization: "night", AfterMinutes: 30}})
+
+	east := math.Point2LL{1.5, 0.5}
+	if o := s.State.AirspaceOwner(east, 5000); o != "2B" {
+		t.Errorf("owner %q, expected 2B", o)
+	}
+	if o := s.AirspaceOwnerAt(east, 5000, start.Add(29*time.Minute)); o != "2B" {
+		t.Errorf("owner before resectorization %q, expected 2B", o)
+	}
+	if o := s.AirspaceOwnerAt(east, 5000, start.Add(31*time.Minute)); o != "2A" {
+		t.Errorf("owner after resectorization %q, expected 2A", o)
+	}
+	if o := s.State.AirspaceOwner(east, 12000); o != "" {
+		t.Errorf("owner above the airspace %q, expected none", o)
+	}
+
+	if err := s.Resectorize("2B", "night"); err != av.ErrNoController {
+		t.Errorf("virtual controller resectorized: got error %v", err)
+	}
+	if err := s.Resectorize("2A", "evening"); err != ErrUnknownSectorization {
+		t.Errorf("unknown sectorization: got error %v", err)
+	}
+
+	s.State.SimTime = start.Add(31 * time.Minute)
+	s.updateSectorizations()
+	if s.State.Sectorization != "night" || len(s.FutureSectorizations) != 0 {
+		t.Errorf("sectorization %q (%d pending), expected night", s.State.Sectorization, len(s.FutureSectorizations))
+	}
+	if o := s.State.AirspaceOwner(east, 5000); o != "2A" {
+		t.Errorf("owner %q after resectorization, expected 2A", o)
+	}
+	// 2B no longer owns any airspace, so its pending handoff goes to 2A,
+	// which is human and so doesn't need a virtual handoff.
+	if ac.HandoffTrackController != "2A" || ac.TrackingController != "N4P" {
+		t.Errorf("handoff to %q from %q, expected 2A from N4P", ac.HandoffTrackController, ac.TrackingController)
+	}
+	if _, ok := s.Handoffs["AAL1"]; ok {
+		t.Errorf("unexpected virtual handoff to 2A")
+	}
+
+	// Going back gives 2B its airspace again but it doesn't get its
+	// handoff back.
+	if err := s.Resectorize("2A", "DEFAULT"); err != nil {
+		t.Fatalf("resectorize: %v", err)
+	}
+	if o := s.State.AirspaceOwner(east, 5000); o != "2B" || ac.HandoffTrackController != "2A" {
+		t.Errorf("owner %q, handoff to %q; expected 2B and 2A", o, ac.HandoffTrackController)
+	}
+}
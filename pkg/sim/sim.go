@@ -5,14 +5,23 @@
 package sim
 
 import (
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"maps"
+	"net/url"
 	"slices"
 	"time"
 
+	"github.com/mmp/vice/pkg/adsb"
 	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/federation"
+	"github.com/mmp/vice/pkg/fsd"
 	"github.com/mmp/vice/pkg/log"
 	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/stream"
+	"github.com/mmp/vice/pkg/swim"
 	"github.com/mmp/vice/pkg/util"
 
 	"github.com/brunoga/deep"
@@ -21,10 +30,14 @@ import (
 type Sim struct {
 	State *State
 
-	mu util.LoggingMutex
+	mu stateMutex
 
 	SignOnPositions  map[string]*av.Controller
 	humanControllers map[string]*EventsSubscription
+	// The world version last sent to each controller and when each part
+	// of the world last changed; see delta.go.
+	worldUpdates  map[string]*worldUpdateState
+	worldVersions *worldVersions
 
 	eventStream *EventStream
 	lg          *log.Logger
@@ -35,8 +48,14 @@ type Sim struct {
 	NextInboundSpawn map[string]time.Time
 
 	Handoffs map[string]Handoff
+	// How virtual controllers respond to handoffs; see virtualhandoff.go.
+	VirtualHandoffs VirtualHandoffConfig
 	// a/c callsign -> PointOut
 	PointOuts map[string]PointOut
+	// Calls to virtual controllers that are awaiting replies and the
+	// altitudes they've approved; see coordination.go.
+	Coordination         []Coordination
+	CoordinatedAltitudes map[string]int // callsign -> altitude
 
 	ReportingPoints []av.ReportingPoint
 
@@ -44,18 +63,211 @@ type Sim struct {
 	FutureOnCourse           []FutureOnCourse
 	FutureSquawkChanges      []FutureChangeSquawk
 
-	lastSimUpdate  time.Time
-	updateTimeSlop time.Duration
-	lastUpdateTime time.Time // this is w.r.t. true wallclock time
-	lastLogTime    time.Time
+	// The sim's clock; see timesource.go.
+	clock *TimeSource // do not include when we serialize
+
+	lastSimUpdate time.Time
+	lastLogTime   time.Time
 
 	prespawn                 bool
 	prespawnUncontrolledOnly bool
 
 	NextPushStart time.Time // both w.r.t. sim time
 	PushEnd       time.Time
+	// The scenario's arrival pushes that haven't finished; see pushes.go.
+	ArrivalPushes []ScheduledPush
+
+	// Untracked VFR traffic flying around the area; see ambient.go.
+	NextAmbientVFRSpawn time.Time
+	ambientVFRAirports  []string
+
+	// Airport vehicles' runway requests; see vehicles.go.
+	NextVehicleSpawn time.Time
+
+	// GA aircraft requesting practice approaches; see practice.go.
+	NextPracticeApproachSpawn time.Time
+	PracticeApproaches        map[string]*PracticeApproach
+
+	// Special VFR requests at airports below VFR minimums; see svfr.go.
+	NextSVFRSpawn time.Time
+	svfrIntruders map[string]bool
+
+	// Number of positions kept in each aircraft's track history; see
+	// history.go.
+	TrackHistoryDepth int
+	lastTrackHistory  time.Time
+
+	// Sim time since which no traffic has needed attention; used for
+	// fast-forwarding.
+	quietSince time.Time
+
+	// Recent checkpoints, oldest first; see checkpoint.go.
+	checkpoints []checkpoint
+
+	// Crossing restrictions from the facility's LOAs and what has been
+	// reported about them; see loa.go.
+	LOAs      []LOA
+	loaChecks map[string]*loaCheck // "callsign/LOA name"
+
+	// Departures that need a release from another facility; see apreq.go.
+	APREQs []APREQ
+
+	// The airspace volumes that sectorizations assign to positions and
+	// the resectorizations that are scheduled; see sectorization.go.
+	AirspaceVolumes      map[string][]av.ControllerAirspaceVolume
+	LocalAirspace        bool
+	FutureSectorizations []FutureSectorization
+
+	// For each of the TMU's traffic restrictions, the latest slot that
+	// has been given out at its fix, the aircraft that are approaching
+	// the fix, and the last one to cross it; see tmu.go.
+	meterSlots     map[int]time.Time   // restriction id ->
+	tmiApproaching map[string]bool     // "callsign/restriction id"
+	tmiCrossings   map[int]tmiCrossing // restriction id ->
+
+	// Crossing restrictions being monitored and how aircraft met the
+	// ones they've crossed; see compliance.go.
+	ComplianceLog         []ComplianceRecord
+	monitoredRestrictions map[string]*monitoredRestriction // callsign ->
+
+	// Aircraft downlinking a flight ID other than their callsign and the
+	// controller that has been told; see flightid.go.
+	flightIDMismatches map[string]string // callsign -> TCP
+
+	// Aircraft squawking a code other than their assigned one that have
+	// been reported to the tracking controller; see beacon.go.
+	beaconMismatches map[string]av.Squawk // callsign -> observed code
+
+	// Warnings given about the EFCs of holding aircraft; see holding.go.
+	efcWarnings map[string]efcWarning // callsign ->
+
+	// Scripted convective weather and the aircraft that are deviating
+	// around it or have asked to; see convective.go.
+	WeatherScript []ScriptedWeatherCell
+	wxDeviations  map[string]*wxDeviation // callsign ->
+
+	// Scripted icing and turbulence and the aircraft that are in it; see
+	// pirep.go.
+	HazardScript     []ScriptedWeatherHazard
+	hazardEncounters map[string]hazardEncounter // callsign ->
+
+	// Sim time of the most recent conflict probe; see probe.go.
+	lastProbe time.Time
+
+	// Predicted brief entries into other positions' airspace that need
+	// point-outs; see pointoutadvisor.go.
+	pointOutAdvisories map[string]*pointOutAdvisory // "callsign/TCP"
+	lastPointOutCheck  time.Time
+
+	// Aircraft that are in airspace they shouldn't be and have been
+	// reported; see airspaceviolation.go.
+	airspaceViolations map[string]bool // "callsign/TCP", "callsign/B", or "callsign/C"
+
+	// Adapted runway flows and when runway configurations were last
+	// evaluated; see runwayadvisor.go.
+	RunwayFlows      []RunwayFlow
+	lastRunwayAdvice time.Time
+
+	// Departures held for a dependent runway's protected window whose
+	// controller has been told; see runwaytimers.go.
+	runwayTimerHolds map[string]bool
+
+	// The scenario's script, if it has one; see script.go.
+	Script *ScenarioScript
+	script *scriptEngine
+
+	// The scenario's lesson, if it's run as one; see lesson.go.
+	Lesson       *LessonProgress
+	lessonEvents *EventsSubscription
+
+	// Evaluation of the human controllers' performance; see scoring.go.
+	Scoring       *Scoring
+	scoringEvents *EventsSubscription
+
+	// Statistics collected while running as a batch; see batch.go.
+	batch *batchStats
 
 	Instructors map[string]bool
+	// Pseudo-pilots fly the aircraft that they have claimed in place of
+	// the automatic pilots; see pseudopilot.go.
+	PseudoPilots        map[string]bool
+	PseudoPilotAircraft map[string]string // callsign -> pseudo-pilot TCP
+
+	// Pilot errors that have been injected and are waiting to be caught;
+	// see piloterror.go.
+	PilotErrors []PilotError
+	// Clearances and readback errors; see hearback.go.
+	Hearback HearbackLog
+
+	// Emergencies that are in progress and ones that are scheduled to
+	// happen; see emergency.go.
+	Emergencies       []Emergency
+	FutureEmergencies []FutureEmergency
+
+	// TCAS resolution advisories, both past and in progress, and each
+	// aircraft's altitude a second ago; see tcas.go.
+	TCASRAs       []TCASRA
+	tcasAltitudes map[string]float32
+
+	// Index of aircraft positions for proximity queries, rebuilt each
+	// tick; see spatial.go.
+	aircraftIndex *AircraftIndex
+
+	// Callsign -> the ATIS letter the aircraft reported when it checked
+	// in; see atis.go.
+	atisReported map[string]string
+
+	// NOTAM id -> runway -> category -> the departure rates that were
+	// removed from the launch configuration when it closed the runway;
+	// see notam.go.
+	closedRunwayRates map[int]map[string]map[string]float32
+
+	// Airport/runway -> time until which it is occupied, and arrivals
+	// that have been checked for a stable approach; see goaround.go.
+	RunwayOccupied   map[string]time.Time
+	StabilityChecked map[string]bool
+
+	// Set when the sim is connected to an FSD network; see network.go.
+	// NetworkAircraft records which aircraft come from the network.
+	NetworkConfig   *fsd.Config
+	NetworkAircraft map[string]bool
+	network         *fsd.Client
+	networkRetry    time.Time
+
+	// Set when live traffic comes from an ADS-B receiver; see
+	// livetraffic.go.
+	ADSBConfig   *adsb.Config
+	ADSBAircraft map[string]bool
+	adsbFeed     *adsb.Feed
+	adsbRetry    time.Time
+
+	// Set when the sim is federated with another one; see
+	// federation.go. FederatedAircraft records which aircraft it flies.
+	FederationConfig     *federation.Config
+	FederatedAircraft    map[string]bool
+	federation           *federation.Link
+	federationRetry      time.Time
+	federationTracksSent time.Time
+
+	// Set when flight data is exported; see export.go.
+	ExportConfig *swim.Config
+	export       exportState
+
+	// Set when live data is served to overlays; see streaming.go.
+	StreamConfig *stream.Config
+	streaming    streamingState
+
+	// All of the sim's randomness (other than that of individual
+	// aircraft, which have their own generators seeded by callsign) comes
+	// from Rand, so that a sim created with the same seed behaves the
+	// same. When Deterministic is set, the sim's clock also starts at a
+	// fixed time and doesn't use the wallclock; see Step.
+	Rand          rand.Rand
+	Deterministic bool
+
+	// If non-zero, the number of goroutines used to update the aircraft;
+	// see updateWorkers.
+	workers int
 
 	// No need to serialize these; they're caches anyway.
 	bravoAirspace   *av.AirspaceGrid
@@ -79,6 +291,9 @@ type ArrivalRunway struct {
 type Handoff struct {
 	Time              time.Time
 	ReceivingFacility string // only for auto accept
+	// Missed handoffs aren't accepted unless they are offered again; see
+	// virtualhandoff.go.
+	Missed bool
 }
 
 type PointOut struct {
@@ -103,9 +318,13 @@ type NewSimConfiguration struct {
 	ControlPositions   map[string]*av.Controller
 	PrimaryController  string
 	ControllerAirspace map[string][]string
-	VirtualControllers []string
-	MultiControllers   av.SplitConfiguration
-	SignOnPositions    map[string]*av.Controller
+	// Alternative assignments of airspace to positions and when they
+	// take effect.
+	Sectorizations        map[string]Sectorization
+	SectorizationSchedule []ScheduledSectorization
+	VirtualControllers    []string
+	MultiControllers      av.SplitConfiguration
+	SignOnPositions       map[string]*av.Controller
 
 	TFRs                    []av.TFR
 	LiveWeather             bool
@@ -120,8 +339,76 @@ type NewSimConfiguration struct {
 	Range             float32
 	DefaultMaps       []string
 	Airspace          av.Airspace
+
+	// If Deterministic is set, the sim is seeded with Seed and the same
+	// scenario, seed, and sequence of controller commands give the same
+	// traffic. Live weather is not used in deterministic sims.
+	Deterministic bool
+	Seed          uint64
+
+	// UpdateWorkers, if non-zero, overrides the number of goroutines that
+	// are used to update the aircraft each second.
+	UpdateWorkers int
+
+	Emergencies []ScheduledEmergency
+	NOTAMs      []NOTAM
+	// Miles- and minutes-in-trail restrictions in effect at the start.
+	TrafficRestrictions []TrafficRestriction
+	// Scheduled banks of arrivals; when given, they replace the launch
+	// configuration's random arrival pushes.
+	ArrivalPushes []ArrivalPush
+	// Scripted convective weather cells and icing and turbulence.
+	WeatherCells   []WeatherCell
+	WeatherHazards []WeatherHazard
+
+	// Rubrics that the human controllers are scored against; the
+	// defaults are used if none are given.
+	ScoringRubrics []Rubric
+
+	// Starlark source for the scenario's script, if any.
+	Script string
+	// Guided steps if the scenario is a lesson.
+	Lesson *Lesson
+
+	VirtualHandoffs VirtualHandoffConfig
+
+	// LOA crossing restrictions that clearances are checked against.
+	LOAs []LOA
+
+	// Runway configurations used together at nearby airports.
+	RunwayFlows []RunwayFlow
+
+	// Departures that must be released by another facility.
+	APREQs []APREQ
+
+	// Number of positions kept in each aircraft's track history; the
+	// default is used if zero.
+	TrackHistoryDepth int
+
+	// If non-nil, the sim connects to the given FSD network; unset
+	// fields of the configuration are filled in from the scenario.
+	Network *fsd.Config
+
+	// If non-nil, live traffic from the given ADS-B receiver is added.
+	ADSB *adsb.Config
+
+	// If non-nil, flight plans and tracks are exported as SWIM-style
+	// feeds.
+	Export *swim.Config
+
+	// If non-nil, tracks, statistics, and events are served to browser
+	// overlays.
+	Stream *stream.Config
+
+	// If non-nil, the sim is federated with another one that handles
+	// adjacent facilities.
+	Federation *federation.Config
 }
 
+// DeterministicStartTime is the simulated time at which deterministic sims
+// start.
+var DeterministicStartTime = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
 func NewSim(config NewSimConfiguration, manifest *av.VideoMapManifest, lg *log.Logger) *Sim {
 	s := &Sim{
 		DepartureState:   make(map[string]map[string]*RunwayLaunchState),
@@ -136,17 +423,64 @@ func NewSim(config NewSimConfiguration, manifest *av.VideoMapManifest, lg *log.L
 
 		ReportingPoints: config.ReportingPoints,
 
-		lastUpdateTime: time.Now(),
-
 		Handoffs:  make(map[string]Handoff),
 		PointOuts: make(map[string]PointOut),
 
-		Instructors: make(map[string]bool),
+		Instructors:         make(map[string]bool),
+		PseudoPilots:        make(map[string]bool),
+		PseudoPilotAircraft: make(map[string]string),
+
+		Rand:          rand.New(),
+		Deterministic: config.Deterministic,
+		workers:       config.UpdateWorkers,
 	}
 
-	s.State = newState(config, manifest, lg)
+	if config.Deterministic {
+		s.Rand.Seed(config.Seed)
+		config.LiveWeather = false
+	} else {
+		s.Rand.Seed(uint64(time.Now().UnixNano()))
+	}
 
-	s.setInitialSpawnTimes(time.Now()) // FIXME? will be clobbered in prespawn
+	s.State = newState(config, manifest, &s.Rand, lg)
+	s.clock = NewTimeSource(s.State)
+	if len(config.ArrivalPushes) > 0 {
+		s.State.LaunchConfig.ArrivalPushes = false
+	}
+
+	s.setInitialSpawnTimes(s.State.SimTime) // FIXME? will be clobbered in prespawn
+	s.scheduleEmergencies(config.Emergencies)
+	for _, n := range config.NOTAMs {
+		s.addNOTAM(n)
+	}
+	for _, r := range config.TrafficRestrictions {
+		s.addTrafficRestriction(r)
+	}
+	s.scheduleWeatherCells(config.WeatherCells)
+	s.scheduleWeatherHazards(config.WeatherHazards)
+	s.Scoring = newScoring(config.ScoringRubrics)
+	s.LOAs = config.LOAs
+	s.VirtualHandoffs = config.VirtualHandoffs
+	s.RunwayFlows = config.RunwayFlows
+	s.APREQs = config.APREQs
+	s.AirspaceVolumes = config.Airspace.Volumes
+	s.LocalAirspace = config.IsLocal
+	s.scheduleSectorizations(config.SectorizationSchedule)
+	s.scheduleArrivalPushes(config.ArrivalPushes)
+	s.TrackHistoryDepth = config.TrackHistoryDepth
+	if config.Network != nil {
+		s.initializeNetwork(config.Network)
+	}
+	if config.Script != "" {
+		s.Script = &ScenarioScript{Source: config.Script}
+	}
+	if config.Lesson != nil {
+		s.Lesson = &LessonProgress{Lesson: *config.Lesson}
+	}
+	s.ADSBConfig = config.ADSB
+	s.ExportConfig = config.Export
+	s.StreamConfig = config.Stream
+	s.FederationConfig = config.Federation
 
 	return s
 }
@@ -160,8 +494,10 @@ func (s *Sim) Activate(lg *log.Logger) {
 	s.humanControllers = make(map[string]*EventsSubscription)
 	s.State.HumanControllers = nil
 
-	now := time.Now()
-	s.lastUpdateTime = now
+	s.clock = NewTimeSource(s.State)
+	s.clock.Every(checkpointInterval, s.takeCheckpoint)
+	// Its hooks were scheduled with the old clock.
+	s.stopScript()
 
 	s.State.Activate(s.lg)
 }
@@ -177,6 +513,79 @@ func (s *Sim) GetSerializeSim() Sim {
 	return ss
 }
 
+// CrashDump returns the sim's state, JSON-encoded, for a crash report. It
+// doesn't wait for the sim's lock, since the code that crashed may have
+// been holding it. Users are asked to attach crash reports to public bug
+// reports, so credentials and addresses in the network configurations
+// are redacted.
+func (s *Sim) CrashDump() ([]byte, error) {
+	if !s.mu.TryLock() {
+		return nil, errors.New("sim is locked")
+	}
+	defer s.mu.Mutex.Unlock()
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	redact := func(name string, v any) error {
+		rb, err := json.Marshal(v)
+		fields[name] = rb
+		return err
+	}
+	if c := s.NetworkConfig; c != nil {
+		nc := *c
+		nc.CID, nc.Password, nc.RealName = redacted(nc.CID), redacted(nc.Password), redacted(nc.RealName)
+		if err := redact("NetworkConfig", nc); err != nil {
+			return nil, err
+		}
+	}
+	if c := s.ADSBConfig; c != nil {
+		ac := *c
+		ac.Source = redactedURL(ac.Source)
+		if err := redact("ADSBConfig", ac); err != nil {
+			return nil, err
+		}
+	}
+	if c := s.FederationConfig; c != nil {
+		fc := *c
+		fc.Peer = redacted(fc.Peer)
+		if err := redact("FederationConfig", fc); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+func redacted(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// redactedURL removes the user information and query parameters, which
+// may hold credentials, from a URL; other strings are returned unchanged.
+func redactedURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return s
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "[redacted]"
+	}
+	return u.String()
+}
+
 func (s *Sim) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.Any("state", s.State),
@@ -189,20 +598,24 @@ func (s *Sim) LogValue() slog.Value {
 		slog.Time("push_end", s.PushEnd))
 }
 
-func (s *Sim) SignOn(tcp string, instructor bool) (*State, error) {
-	if err := s.signOn(tcp, instructor); err != nil {
+func (s *Sim) SignOn(tcp string, instructor, pseudoPilot bool) (*State, error) {
+	if err := s.signOn(tcp, instructor, pseudoPilot); err != nil {
 		return nil, err
 	}
 	return s.State.GetStateForController(tcp), nil
 }
 
-func (s *Sim) signOn(tcp string, instructor bool) error {
+func (s *Sim) signOn(tcp string, instructor, pseudoPilot bool) error {
 	s.mu.Lock(s.lg)
 	defer s.mu.Unlock(s.lg)
 
 	if _, ok := s.humanControllers[tcp]; ok {
 		return ErrControllerAlreadySignedIn
 	}
+	consolidatedTo, consolidated := s.State.Consolidations[tcp]
+	if consolidated {
+		s.splitPosition(tcp)
+	}
 	if _, ok := s.State.Controllers[tcp]; ok {
 		// Trying to sign in to a virtual position.
 		return av.ErrInvalidController
@@ -214,16 +627,24 @@ func (s *Sim) signOn(tcp string, instructor bool) error {
 	s.humanControllers[tcp] = s.eventStream.Subscribe()
 	s.State.Controllers[tcp] = s.SignOnPositions[tcp]
 	s.State.HumanControllers = append(s.State.HumanControllers, tcp)
+	if consolidated {
+		s.takeOverSplitPosition(consolidatedTo, tcp)
+	}
 
 	if tcp == s.State.PrimaryController {
-		// The primary controller signed in so the sim will resume.
-		// Reset lastUpdateTime so that the next time Update() is
-		// called for the sim, we don't try to run a ton of steps.
-		s.lastUpdateTime = time.Now()
+		// The primary controller signed in so the sim will resume;
+		// make sure that the time while they were gone is ignored.
+		s.clock.Resync()
 	}
 	if instructor {
 		s.Instructors[tcp] = true
 	}
+	if pseudoPilot {
+		if s.PseudoPilots == nil {
+			s.PseudoPilots = make(map[string]bool)
+		}
+		s.PseudoPilots[tcp] = true
+	}
 
 	s.eventStream.Post(Event{
 		Type:    StatusMessageEvent,
@@ -253,10 +674,13 @@ func (s *Sim) SignOff(tcp string) error {
 	}
 
 	s.humanControllers[tcp].Unsubscribe()
+	s.splitAllPositions(tcp)
 
 	delete(s.humanControllers, tcp)
+	delete(s.worldUpdates, tcp)
 	delete(s.State.Controllers, tcp)
 	delete(s.Instructors, tcp)
+	s.releasePseudoPilot(tcp)
 	s.State.HumanControllers =
 		slices.DeleteFunc(s.State.HumanControllers, func(s string) bool { return s == tcp })
 
@@ -274,7 +698,7 @@ func (s *Sim) ChangeControlPosition(fromTCP, toTCP string, keepTracks bool) erro
 
 	// Make sure we can successfully sign on before signing off from the
 	// current position.
-	if err := s.signOn(toTCP, s.Instructors[fromTCP]); err != nil {
+	if err := s.signOn(toTCP, s.Instructors[fromTCP], s.PseudoPilots[fromTCP]); err != nil {
 		return err
 	}
 
@@ -284,8 +708,10 @@ func (s *Sim) ChangeControlPosition(fromTCP, toTCP string, keepTracks bool) erro
 	s.State.HumanControllers = append(s.State.HumanControllers, toTCP)
 
 	delete(s.humanControllers, fromTCP)
+	delete(s.worldUpdates, fromTCP)
 	delete(s.State.Controllers, fromTCP)
 	delete(s.Instructors, fromTCP)
+	s.releasePseudoPilot(fromTCP)
 	slices.DeleteFunc(s.State.HumanControllers, func(s string) bool { return s == fromTCP })
 
 	s.eventStream.Post(Event{
@@ -300,6 +726,15 @@ func (s *Sim) ChangeControlPosition(fromTCP, toTCP string, keepTracks bool) erro
 			ac.HandleControllerDisconnect(fromTCP, s.State.PrimaryController)
 		}
 	}
+	for pos, tcp := range s.State.Consolidations {
+		if tcp == fromTCP {
+			if keepTracks {
+				s.State.Consolidations[pos] = toTCP
+			} else {
+				s.splitPosition(pos)
+			}
+		}
+	}
 
 	return nil
 }
@@ -308,29 +743,91 @@ func (s *Sim) TogglePause(tcp string) error {
 	s.mu.Lock(s.lg)
 	defer s.mu.Unlock(s.lg)
 
-	s.State.Paused = !s.State.Paused
-	s.lg.Infof("paused: %v", s.State.Paused)
-	s.lastUpdateTime = time.Now() // ignore time passage...
+	s.setPaused(tcp, !s.clock.Paused())
+	return nil
+}
+
+// SetPaused pauses or unpauses the sim; it does nothing if the sim is
+// already in the requested state.
+func (s *Sim) SetPaused(tcp string, paused bool) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if s.clock.Paused() != paused {
+		s.setPaused(tcp, paused)
+	}
+	return nil
+}
+
+func (s *Sim) setPaused(tcp string, paused bool) {
+	s.clock.SetPaused(paused)
+	s.lg.Infof("paused: %v", s.clock.Paused())
 
 	s.eventStream.Post(Event{
 		Type:    GlobalMessageEvent,
 		Message: tcp + " has " + util.Select(s.State.Paused, "paused", "unpaused") + " the sim",
 	})
-	return nil
+
+	// The stream isn't updated while the sim is paused, so let the
+	// overlays know now.
+	if s.streaming.server != nil {
+		s.sendStreamEvents()
+		s.sendStreamStats()
+	}
+}
+
+// SimStatus summarizes a sim's progress for reporting outside of vice
+// (e.g., via the server's control API).
+type SimStatus struct {
+	Paused   bool
+	Rate     float32
+	TotalIFR int
+	TotalVFR int
+}
+
+func (s *Sim) Status() SimStatus {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	return SimStatus{
+		Paused:   s.State.Paused,
+		Rate:     s.State.SimRate,
+		TotalIFR: s.State.TotalIFR,
+		TotalVFR: s.State.TotalVFR,
+	}
 }
 
 func (s *Sim) IdleTime() time.Duration {
 	s.mu.Lock(s.lg)
 	defer s.mu.Unlock(s.lg)
-	return time.Since(s.lastUpdateTime)
+	return s.clock.IdleTime()
+}
+
+func (s *Sim) TRACON() string {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+	return s.State.TRACON
+}
+
+// SingleStep advances the sim by one second while it is paused.
+func (s *Sim) SingleStep(tcp string) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.clock.Paused() {
+		return ErrSimNotPaused
+	}
+	s.clock.Step()
+	s.lg.Infof("%s: single step", tcp)
+	return nil
 }
 
 func (s *Sim) SetSimRate(tcp string, rate float32) error {
 	s.mu.Lock(s.lg)
 	defer s.mu.Unlock(s.lg)
 
-	s.State.SimRate = rate
-	s.lg.Infof("sim rate set to %f", s.State.SimRate)
+	s.clock.SetRate(rate)
+	s.lg.Infof("sim rate set to %f", rate)
 	return nil
 }
 
@@ -440,9 +937,28 @@ type GlobalMessage struct {
 }
 
 type WorldUpdate struct {
+	// Sequence is the world version of the update; it should be passed
+	// back with the next call to GetWorldUpdate.
+	Sequence uint64
+	// If Delta is set, this is a patch against the update the client
+	// acknowledged: Aircraft only includes new aircraft, AircraftPatches
+	// has the changes to the others, and RemovedAircraft gives the
+	// callsigns of the ones that have been deleted. ERAMComputers only
+	// includes the facilities whose computers have changed and it and
+	// Controllers are nil if nothing has; Airspace and Sectorization are
+	// only set if AirspaceChanged is. See delta.go.
+	Delta           bool
+	AircraftPatches map[string]*AircraftPatch
+	RemovedAircraft []string
+
 	Aircraft         map[string]*av.Aircraft
 	Controllers      map[string]*av.Controller
 	HumanControllers []string
+	Airspace         map[string]map[string][]av.ControllerAirspaceVolume
+	Sectorization    string
+	// AirspaceChanged distinguishes an empty Airspace from one that
+	// hasn't changed, since both arrive as nil.
+	AirspaceChanged bool
 
 	Time time.Time
 
@@ -452,15 +968,53 @@ type WorldUpdate struct {
 
 	UserRestrictionAreas []av.RestrictionArea
 
-	SimIsPaused        bool
-	SimRate            float32
-	TotalIFR, TotalVFR int
-	Events             []Event
-	Instructors        map[string]bool
+	SimIsPaused         bool
+	SimRate             float32
+	FastForwardRate     float32
+	FastForwarding      bool
+	Consolidations      map[string]string
+	ATIS                map[string]ATIS
+	NOTAMs              []NOTAM
+	TrafficRestrictions []TrafficRestriction
+	ActivePush          *ArrivalPushStatus
+	Lesson              *LessonStatus
+	SurfaceVehicles     []SurfaceVehicle
+	SVFRRequests        []SVFRRequest
+	Releases            []Release
+	RunwayTimers        []RunwayTimer
+	CoastTracks         map[string]*CoastTrack
+	TotalIFR, TotalVFR  int
+	Events              []Event
+	Instructors         map[string]bool
+
+	PseudoPilots        map[string]bool
+	PseudoPilotAircraft map[string]string
+
+	// The following are only included if they have changed; bit i of
+	// Collections is set if the i'th of worldCollections is. See
+	// delta.go.
+	Collections    uint64
+	ProbeConflicts []ProbeConflict
+	Intents        map[string]av.Intent
+	HoldingStacks  map[string][]HoldingAircraft
+	WeatherCells   []WeatherCell
+	PIREPs         []PIREP
+	RunwayAdvice   []RunwayAdvice
+
+	// TrackHistories holds the complete histories of new aircraft and of
+	// all of them in a full update; for the others, TrackHistoryAppends
+	// has the tracks that have been added since the acknowledged update,
+	// oldest first.
+	TrackHistories      map[string]*TrackHistory
+	TrackHistoryAppends map[string][]av.RadarTrack
+	TrackHistoryDepth   int
 }
 
-func (s *Sim) GetWorldUpdate(tcp string, update *WorldUpdate) error {
-	s.mu.Lock(s.lg)
+// GetWorldUpdate returns the changes to the world since the last update
+// that the controller has received; sequence should be the Sequence of
+// the last WorldUpdate received, or zero to get a full update.
+func (s *Sim) GetWorldUpdate(tcp string, sequence uint64, update *WorldUpdate) error {
+	s.mu.lockUnchanged(s.lg)
 	defer s.mu.Unlock(s.lg)
 
 	var events []Event
@@ -468,23 +1022,37 @@ func (s *Sim) GetWorldUpdate(tcp string, update *WorldUpdate) error {
 		events = sub.Get()
 	}
 
-	var err error
-	*update, err = deep.Copy(WorldUpdate{
-		Aircraft:             s.State.Aircraft,
-		Controllers:          s.State.Controllers,
+	wu := WorldUpdate{
 		HumanControllers:     slices.Collect(maps.Keys(s.humanControllers)),
-		ERAMComputers:        s.State.ERAMComputers,
 		Time:                 s.State.SimTime,
 		LaunchConfig:         s.State.LaunchConfig,
 		SimIsPaused:          s.State.Paused,
 		SimRate:              s.State.SimRate,
+		FastForwardRate:      s.State.FastForwardRate,
+		FastForwarding:       s.State.FastForwarding,
+		Consolidations:       s.State.Consolidations,
+		ATIS:                 s.State.ATIS,
+		NOTAMs:               s.State.NOTAMs,
+		TrafficRestrictions:  s.State.TrafficRestrictions,
+		ActivePush:           s.State.ActivePush,
+		Lesson:               s.State.Lesson,
+		SurfaceVehicles:      s.State.SurfaceVehicles,
+		SVFRRequests:         s.State.SVFRRequests,
+		Releases:             s.State.Releases,
+		RunwayTimers:         s.State.RunwayTimers,
+		CoastTracks:          s.State.CoastTracks,
 		TotalIFR:             s.State.TotalIFR,
 		TotalVFR:             s.State.TotalVFR,
 		Events:               events,
 		UserRestrictionAreas: s.State.UserRestrictionAreas,
 		Instructors:          s.Instructors,
-	})
+		PseudoPilots:         s.PseudoPilots,
+		PseudoPilotAircraft:  s.PseudoPilotAircraft,
+	}
+	s.worldUpdateDelta(tcp, sequence, &wu)
 
+	var err error
+	*update, err = deep.Copy(wu)
 	return err
 }
 
@@ -495,7 +1063,8 @@ func (s *Sim) ResolveController(tcp string) string {
 	} else {
 		c, err := s.State.MultiControllers.ResolveController(tcp,
 			func(callsign string) bool {
-				return s.isActiveHumanController(callsign)
+				_, consolidated := s.State.Consolidations[callsign]
+				return s.isActiveHumanController(callsign) || consolidated
 			})
 		if err != nil {
 			s.lg.Errorf("%s: unable to resolve controller: %v", tcp, err)
@@ -504,7 +1073,7 @@ func (s *Sim) ResolveController(tcp string) string {
 		if c == "" { // This shouldn't happen...
 			return s.State.PrimaryController
 		}
-		return c
+		return s.State.resolveConsolidation(c)
 	}
 }
 
@@ -517,7 +1086,10 @@ func (s *Sim) isActiveHumanController(tcp string) bool {
 // Simulation
 
 func (s *Sim) Update() {
-	s.mu.Lock(s.lg)
+	// Update is called much more often than the sim is stepped; it
+	// only changes the world when it does step or if there's live
+	// traffic.
+	s.mu.lockUnchanged(s.lg)
 	defer s.mu.Unlock(s.lg)
 
 	startUpdate := time.Now()
@@ -532,34 +1104,35 @@ func (s *Sim) Update() {
 		ac.Check(s.lg)
 	}
 
-	if s.State.Paused {
-		return
+	// Live traffic keeps moving even if the sim is paused.
+	if s.NetworkConfig != nil || s.ADSBConfig != nil || s.FederationConfig != nil {
+		s.mu.changed = true
 	}
-
-	if !s.isActiveHumanController(s.State.PrimaryController) {
-		// Pause the sim if the primary controller is gone
-		return
+	s.updateNetwork()
+	s.updateADSB()
+	s.updateFederation()
+
+	// The clock doesn't advance while the sim is paused or if the
+	// primary controller is gone, other than for single steps.
+	ns := s.clock.Ticks(s.isActiveHumanController(s.State.PrimaryController))
+	if ns > 10 && !s.State.FastForwarding {
+		s.lg.Warn("unexpected hitch in update rate", slog.Int("steps", ns))
 	}
-
-	// Figure out how much time has passed since the last update: wallclock
-	// time is scaled by the sim rate, then we add in any time from the
-	// last update that wasn't accounted for.
-	elapsed := time.Since(s.lastUpdateTime)
-	elapsed = time.Duration(s.State.SimRate*float32(elapsed)) + s.updateTimeSlop
-	// Run the sim for this many seconds
-	ns := int(elapsed.Truncate(time.Second).Seconds())
-	if ns > 10 {
-		s.lg.Warn("unexpected hitch in update rate", slog.Duration("elapsed", elapsed),
-			slog.Int("steps", ns), slog.Duration("slop", s.updateTimeSlop))
+	if ns > 0 {
+		s.mu.changed = true
 	}
-	for i := 0; i < ns; i++ {
-		s.State.SimTime = s.State.SimTime.Add(time.Second)
-		s.updateState()
+	for range ns {
+		changed := false
+		s.clock.Tick(func() {
+			s.updateState()
+			changed = s.updateFastForward()
+		})
+		if changed {
+			// Don't run any more steps at the old rate.
+			s.clock.Resync()
+			break
+		}
 	}
-	s.updateTimeSlop = elapsed - elapsed.Truncate(time.Second)
-	s.State.SimTime = s.State.SimTime
-
-	s.lastUpdateTime = time.Now()
 
 	// Log the current state of everything once a minute
 	if time.Since(s.lastLogTime) > time.Minute {
@@ -568,43 +1141,39 @@ func (s *Sim) Update() {
 	}
 }
 
-// separate so time management can be outside this so we can do the prespawn stuff...
-func (s *Sim) updateState() {
-	now := s.State.SimTime
+// Step advances the sim by the given amount of simulated time (rounded
+// down to whole seconds), independent of the wallclock and the sim rate.
+// Along with a deterministic sim, this allows running a scenario
+// reproducibly, e.g. for regression tests.
+func (s *Sim) Step(d time.Duration) {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
 
-	for callsign, ho := range s.Handoffs {
-		if !now.After(ho.Time) {
-			continue
-		}
+	for range int(d.Seconds()) {
+		s.clock.Tick(s.updateState)
+	}
+	s.clock.Resync()
+}
 
-		if ac, ok := s.State.Aircraft[callsign]; ok && ac.HandoffTrackController != "" {
-			human := s.isActiveHumanController(ac.HandoffTrackController)
-			if !human && !s.prespawn {
-				// Automated accept
-				s.eventStream.Post(Event{
-					Type:           AcceptedHandoffEvent,
-					FromController: ac.TrackingController,
-					ToController:   ac.HandoffTrackController,
-					Callsign:       ac.Callsign,
-				})
-				s.lg.Info("automatic handoff accept", slog.String("callsign", ac.Callsign),
-					slog.String("from", ac.TrackingController),
-					slog.String("to", ac.HandoffTrackController))
-
-				_, receivingSTARS, err := s.State.ERAMComputers.FacilityComputers(ho.ReceivingFacility)
-				if err != nil {
-					//s.lg.Errorf("%s: FacilityComputers(): %v", ho.ReceivingFacility, err)
-				} else if err := s.State.STARSComputer().AutomatedAcceptHandoff(ac, ac.HandoffTrackController,
-					receivingSTARS, s.State.Controllers, s.State.SimTime); err != nil {
-					//s.lg.Errorf("AutomatedAcceptHandoff: %v", err)
-				}
+// Below this many aircraft, updating them in parallel isn't worth the
+// overhead.
+const minParallelAircraftUpdates = 32
 
-				ac.TrackingController = ac.HandoffTrackController
-				ac.HandoffTrackController = ""
-			}
-		}
-		delete(s.Handoffs, callsign)
+// updateWorkers returns the number of goroutines to use to update the
+// given number of aircraft; zero means one per CPU.
+func updateWorkers(n int) int {
+	if n < minParallelAircraftUpdates {
+		return 1
 	}
+	return 0
+}
+
+// separate so time management can be outside this so we can do the prespawn stuff...
+func (s *Sim) updateState() {
+	now := s.State.SimTime
+
+	s.updateVirtualHandoffs()
+	s.updateCoordination()
 
 	for callsign, po := range s.PointOuts {
 		if !now.After(po.AcceptTime) {
@@ -631,17 +1200,37 @@ func (s *Sim) updateState() {
 	// Update the simulation state once a second.
 	if now.Sub(s.lastSimUpdate) >= time.Second {
 		s.lastSimUpdate = now
-		for callsign, ac := range s.State.Aircraft {
+
+		// Each aircraft's flight dynamics and navigation only depend on
+		// its own state and the weather, so they are updated in parallel.
+		// Everything that follows from those updates--handoffs, radio
+		// calls, deletions, and so forth--happens afterward, one aircraft
+		// at a time in callsign order, so that the results don't depend on
+		// how the updates were scheduled.
+		var aircraft []*av.Aircraft
+		for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+			ac := s.State.Aircraft[callsign]
 			if ac.HoldForRelease && !ac.Released {
 				// nvm...
 				continue
 			}
-			if ac.WaitingForLaunch {
+			if ac.WaitingForLaunch || s.isExternalAircraft(callsign) {
 				continue
 			}
+			aircraft = append(aircraft, ac)
+		}
+		passedWaypoints := make([]*av.Waypoint, len(aircraft))
+		workers := s.workers
+		if workers == 0 {
+			workers = updateWorkers(len(aircraft))
+		}
+		util.ParallelFor(len(aircraft), workers, func(i int) {
+			passedWaypoints[i] = aircraft[i].Update(s.State, s.State.SimTime, nil /* s.lg*/)
+		})
 
-			passedWaypoint := ac.Update(s.State, nil /* s.lg*/)
-			if passedWaypoint != nil {
+		for i, ac := range aircraft {
+			callsign := ac.Callsign
+			if passedWaypoint := passedWaypoints[i]; passedWaypoint != nil {
 				if passedWaypoint.HumanHandoff {
 					// Handoff from virtual controller to a human controller.
 					s.handoffTrack(ac.TrackingController, s.ResolveController(ac.WaypointHandoffController),
@@ -673,7 +1262,7 @@ func (s *Sim) updateState() {
 						if !s.isActiveHumanController(ac.ControllingController) {
 							fromCtrl := s.State.Controllers[ac.ControllingController]
 							s.pointOut(ac.Callsign, fromCtrl, ctrl)
-							break
+							continue
 						}
 					}
 				}
@@ -691,9 +1280,10 @@ func (s *Sim) updateState() {
 					lowEnough := alt == nil || ac.Altitude() <= alt.TargetAltitude(ac.Altitude())+150
 					if lowEnough {
 						s.lg.Info("deleting landing at waypoint", slog.Any("waypoint", passedWaypoint))
+						s.landed(ac)
 						s.State.DeleteAircraft(ac)
 					} else {
-						s.goAround(ac)
+						s.goAround(ac, "")
 					}
 				}
 			}
@@ -704,9 +1294,10 @@ func (s *Sim) updateState() {
 				if d, err := ac.DistanceToEndOfApproach(); err == nil && d < *ac.GoAroundDistance {
 					s.lg.Info("randomly going around")
 					ac.GoAroundDistance = nil // only go around once
-					s.goAround(ac)
+					s.goAround(ac, "")
 				}
 			}
+			s.checkFinalApproach(ac)
 
 			// Possibly contact the departure controller
 			if ac.DepartureContactAltitude != 0 && ac.Nav.FlightState.Altitude >= ac.DepartureContactAltitude &&
@@ -746,20 +1337,76 @@ func (s *Sim) updateState() {
 
 		// Handle assorted deferred radio calls.
 		s.processEnqueued()
+		s.updatePilotErrors()
+		s.updateEmergencies()
 
+		s.updateRateSchedule()
+		s.updateArrivalPushes()
 		s.spawnAircraft()
 
 		s.State.ERAMComputers.Update(s)
+		s.updateAircraftIndex()
+
+		if !s.prespawn {
+			s.publishIntents()
+			s.updateATIS()
+			s.updateRunwayAdvice()
+			s.updateRunwayTimers()
+			s.updateSurfaceVehicles()
+			s.updatePracticeApproaches()
+			s.updateSVFR()
+			s.updateReleases()
+			s.updateTrackHistories()
+			s.updateCoastTracks()
+			s.updateHoldingStacks()
+			s.updateWeatherCells()
+			s.checkBeaconMismatches()
+			s.checkFlightIDMismatches()
+			s.updateExport()
+			s.updateStream()
+			s.checkLOAs()
+			s.checkTrafficRestrictions()
+			s.checkWeatherDeviations()
+			s.checkWeatherHazards()
+			s.checkRestrictionCompliance()
+			s.updateConflictProbe()
+			s.updateSectorizations()
+			s.updatePointOutAdvisor()
+			s.checkAirspaceViolations()
+			s.updateTCAS()
+			s.updateLesson()
+			s.updateScript()
+			s.updateScoring()
+		}
 	}
 }
 
-func (s *Sim) goAround(ac *av.Aircraft) {
+// goAround sends the aircraft around; reason, if given, is included in
+// the pilot's transmission.
+func (s *Sim) goAround(ac *av.Aircraft, reason string) {
 	// Update controller before calling GoAround so the
 	// transmission goes to the right controller.
 	ac.ControllingController = s.State.DepartureController(ac, s.lg)
 	rt := ac.GoAround()
+	if s.batch != nil {
+		s.batch.report.GoArounds++
+	}
+	if reason != "" {
+		for i := range rt {
+			rt[i].Message += ", " + reason
+		}
+	}
 	s.postRadioEvents(ac.Callsign, rt)
 
+	s.eventStream.Post(Event{
+		Type:         GoAroundEvent,
+		Callsign:     ac.Callsign,
+		ToController: ac.ControllingController,
+		Message:      reason,
+	})
+	delete(s.StabilityChecked, ac.Callsign)
+	s.delayArrivals(ac.FlightPlan.ArrivalAirport)
+
 	// If it was handed off to tower, hand it back to us
 	if ac.TrackingController != "" && ac.TrackingController != ac.ApproachController {
 		ac.HandoffTrackController = s.State.DepartureController(ac, s.lg)
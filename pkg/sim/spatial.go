@@ -0,0 +1,144 @@
+// pkg/sim/spatial.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"slices"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+// AircraftIndex is a uniform grid over nautical-mile coordinates that
+// makes it cheap to find the aircraft near a point or near each other;
+// separation checks, TCAS, and the like use it rather than considering
+// every pair of aircraft. The sim rebuilds its index once per tick (see
+// Sim.updateAircraftIndex); clients can build their own from track
+// positions.
+//
+// The grid is only used to find candidates; the final distance test
+// uses math.NMDistance2LL, so results match what a brute-force scan
+// would find.
+type AircraftIndex struct {
+	nmPerLongitude float32
+	cells          map[[2]int][]indexedAircraft
+	n              int
+}
+
+type indexedAircraft struct {
+	ac *av.Aircraft
+	p  math.Point2LL
+}
+
+// aircraftIndexCellSize is the size of the grid cells in nm; it's a
+// reasonable match for the distances that are queried, which range from
+// a few nm to a few tens of nm.
+const aircraftIndexCellSize = 5
+
+// NewAircraftIndex returns an index of the given aircraft. pos gives the
+// position to use for each aircraft; if it is nil, ac.Position() is used.
+func NewAircraftIndex(aircraft []*av.Aircraft, pos func(*av.Aircraft) math.Point2LL,
+	nmPerLongitude float32) *AircraftIndex {
+	idx := &AircraftIndex{
+		nmPerLongitude: nmPerLongitude,
+		cells:          make(map[[2]int][]indexedAircraft),
+		n:              len(aircraft),
+	}
+	for _, ac := range aircraft {
+		p := ac.Position()
+		if pos != nil {
+			p = pos(ac)
+		}
+		c := idx.cell(p)
+		idx.cells[c] = append(idx.cells[c], indexedAircraft{ac: ac, p: p})
+	}
+	return idx
+}
+
+func (idx *AircraftIndex) cell(p math.Point2LL) [2]int {
+	pnm := math.LL2NM(p, idx.nmPerLongitude)
+	return [2]int{int(math.Floor(pnm[0] / aircraftIndexCellSize)), int(math.Floor(pnm[1] / aircraftIndexCellSize))}
+}
+
+// reach returns how many cells in each direction must be searched to
+// find everything within dist nm. The grid is laid out using a single
+// nm-per-longitude value, which is only exact at one latitude, so there
+// is some padding.
+func (idx *AircraftIndex) reach(dist float32) int {
+	return int(math.Ceil(1.25 * dist / aircraftIndexCellSize))
+}
+
+// Len returns the number of aircraft in the index.
+func (idx *AircraftIndex) Len() int {
+	return idx.n
+}
+
+// NearbyAircraft returns the aircraft within radius nm of p, sorted by
+// callsign.
+func (idx *AircraftIndex) NearbyAircraft(p math.Point2LL, radius float32) []*av.Aircraft {
+	if idx == nil {
+		return nil
+	}
+
+	var result []*av.Aircraft
+	c, r := idx.cell(p), idx.reach(radius)
+	for y := c[1] - r; y <= c[1]+r; y++ {
+		for x := c[0] - r; x <= c[0]+r; x++ {
+			for _, ia := range idx.cells[[2]int{x, y}] {
+				if math.NMDistance2LL(p, ia.p) <= radius {
+					result = append(result, ia.ac)
+				}
+			}
+		}
+	}
+	slices.SortFunc(result, func(a, b *av.Aircraft) int { return strings.Compare(a.Callsign, b.Callsign) })
+	return result
+}
+
+// PairsWithin returns all pairs of aircraft that are within dist nm of
+// each other. The first aircraft in each pair has the alphabetically
+// earlier callsign and the pairs are sorted by callsign, so they are in
+// the same order as a loop over all pairs of aircraft sorted by callsign
+// would give.
+func (idx *AircraftIndex) PairsWithin(dist float32) [][2]*av.Aircraft {
+	if idx == nil {
+		return nil
+	}
+
+	var pairs [][2]*av.Aircraft
+	r := idx.reach(dist)
+	for c, cellAircraft := range idx.cells {
+		for _, ia := range cellAircraft {
+			for y := c[1] - r; y <= c[1]+r; y++ {
+				for x := c[0] - r; x <= c[0]+r; x++ {
+					for _, ib := range idx.cells[[2]int{x, y}] {
+						if ia.ac.Callsign < ib.ac.Callsign && math.NMDistance2LL(ia.p, ib.p) <= dist {
+							pairs = append(pairs, [2]*av.Aircraft{ia.ac, ib.ac})
+						}
+					}
+				}
+			}
+		}
+	}
+	slices.SortFunc(pairs, func(a, b [2]*av.Aircraft) int {
+		if c := strings.Compare(a[0].Callsign, b[0].Callsign); c != 0 {
+			return c
+		}
+		return strings.Compare(a[1].Callsign, b[1].Callsign)
+	})
+	return pairs
+}
+
+// updateAircraftIndex rebuilds the sim's index of aircraft positions; it
+// is called once per tick, after the aircraft have moved and been
+// spawned and deleted but before anything that queries it.
+func (s *Sim) updateAircraftIndex() {
+	aircraft := make([]*av.Aircraft, 0, len(s.State.Aircraft))
+	for _, ac := range s.State.Aircraft {
+		aircraft = append(aircraft, ac)
+	}
+	s.aircraftIndex = NewAircraftIndex(aircraft, nil, s.State.NmPerLongitude)
+}
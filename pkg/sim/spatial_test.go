@@ -0,0 +1,59 @@
+// pkg/sim/spatial_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+func TestAircraftIndex(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	center := math.Point2LL{-73.8, 40.7}
+	var aircraft []*av.Aircraft
+	pos := make(map[string]math.Point2LL)
+	for i := range 300 {
+		ac := &av.Aircraft{Callsign: fmt.Sprintf("AAL%d", i)}
+		aircraft = append(aircraft, ac)
+		// Spread them over a couple hundred nm, clustered toward the
+		// center.
+		pos[ac.Callsign] = math.Add2f(center, math.Point2LL{2 * (r.Float32()*r.Float32() - 0.25) * 4,
+			2 * (r.Float32()*r.Float32() - 0.25) * 3})
+	}
+	slices.SortFunc(aircraft, func(a, b *av.Aircraft) int { return strings.Compare(a.Callsign, b.Callsign) })
+
+	idx := NewAircraftIndex(aircraft, func(ac *av.Aircraft) math.Point2LL { return pos[ac.Callsign] }, 45.4)
+
+	for _, dist := range []float32{0.5, 3, 5, 9.99, 15, 40} {
+		var expected [][2]*av.Aircraft
+		for i, ac0 := range aircraft {
+			for _, ac1 := range aircraft[i+1:] {
+				if math.NMDistance2LL(pos[ac0.Callsign], pos[ac1.Callsign]) <= dist {
+					expected = append(expected, [2]*av.Aircraft{ac0, ac1})
+				}
+			}
+		}
+		if pairs := idx.PairsWithin(dist); !slices.Equal(pairs, expected) {
+			t.Errorf("PairsWithin(%f): got %d pairs, expected %d", dist, len(pairs), len(expected))
+		}
+
+		p := pos[aircraft[0].Callsign]
+		var near []*av.Aircraft
+		for _, ac := range aircraft {
+			if math.NMDistance2LL(p, pos[ac.Callsign]) <= dist {
+				near = append(near, ac)
+			}
+		}
+		if got := idx.NearbyAircraft(p, dist); !slices.Equal(got, near) {
+			t.Errorf("NearbyAircraft(%f): got %d aircraft, expected %d", dist, len(got), len(near))
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package sim
 
 import (
+	"cmp"
 	"fmt"
 	"log/slog"
 	"maps"
@@ -67,6 +68,14 @@ type DepartureAircraft struct {
 	ReleaseDelay       time.Duration // minimum wait after release before the takeoff roll
 	AddToHFRListTime   time.Time
 	RequestReleaseTime time.Time
+
+	RejectedTakeoff bool // it has already rejected a takeoff
+
+	// Runways it must cross taxiing to the departure runway, given as
+	// "4L/22R", if the airport has a surface model.
+	RunwayCrossings []string
+	HoldingShort    bool
+	TaxiReadyTime   time.Time // when it has finished crossing the last runway
 }
 
 const (
@@ -84,7 +93,11 @@ type LaunchConfig struct {
 	// LaunchManual or LaunchAutomatic
 	Mode int
 
-	GoAroundRate float32
+	GoAroundRate        float32
+	RejectedTakeoffRate float32
+	// Probability that a Mode S-equipped aircraft's pilot has entered the
+	// wrong flight ID; see flightid.go.
+	FlightIDMismatchRate float32
 	// airport -> runway -> category -> rate
 	DepartureRates     map[string]map[string]map[string]float32
 	DepartureRateScale float32
@@ -98,12 +111,36 @@ type LaunchConfig struct {
 	ArrivalPushes               bool
 	ArrivalPushFrequencyMinutes int
 	ArrivalPushLengthMinutes    int
+	// Changes to the rate scales to be made over the course of the
+	// session; see traffic.go.
+	RateSchedule []RateChange
+
+	// Aircraft per hour at the busiest time of day; see ambient.go.
+	AmbientVFRRate float32
+
+	// Airport vehicle runway requests per hour; see vehicles.go.
+	VehicleRate float32
+
+	// GA aircraft requesting practice approaches per hour; see
+	// practice.go.
+	PracticeApproachRate float32
+
+	// Special VFR requests per hour at airports below VFR minimums; see
+	// svfr.go.
+	SVFRRate float32
+
+	// Year to age the airlines' fleets to; zero leaves them as they are.
+	FleetYear int
+
+	PilotErrors PilotErrorConfig
 }
 
 func MakeLaunchConfig(dep []DepartureRunway, vfrRateScale float32, vfrAirports map[string]*av.Airport,
 	inbound map[string]map[string]int) LaunchConfig {
 	lc := LaunchConfig{
 		GoAroundRate:                0.05,
+		RejectedTakeoffRate:         0.01,
+		FlightIDMismatchRate:        0.02,
 		DepartureRateScale:          1,
 		VFRDepartureRateScale:       vfrRateScale,
 		VFRAirports:                 vfrAirports,
@@ -163,13 +200,18 @@ func (s *Sim) SetLaunchConfig(tcp string, lc LaunchConfig) error {
 			oldSum *= s.State.LaunchConfig.InboundFlowRateScale
 
 			if newSum != oldSum {
-				pushActive := s.State.SimTime.Before(s.PushEnd)
+				pushActive := s.clock.Now().Before(s.PushEnd)
 				s.lg.Infof("%s: inbound flow rate changed %f -> %f", group, oldSum, newSum)
-				s.NextInboundSpawn[group] = s.State.SimTime.Add(randomWait(newSum, pushActive))
+				s.NextInboundSpawn[group] = s.clock.Now().Add(randomWait(&s.Rand, newSum, pushActive))
 			}
 		}
 	}
 
+	if lc.AmbientVFRRate != s.State.LaunchConfig.AmbientVFRRate {
+		s.lg.Infof("ambient VFR rate changed %f -> %f", s.State.LaunchConfig.AmbientVFRRate, lc.AmbientVFRRate)
+		s.NextAmbientVFRSpawn = s.clock.Now().Add(poissonWait(&s.Rand, lc.AmbientVFRRate))
+	}
+
 	s.State.LaunchConfig = lc
 	return nil
 }
@@ -203,7 +245,7 @@ func (s *Sim) LaunchAircraft(ac av.Aircraft, departureRunway string) {
 	s.mu.Lock(s.lg)
 	defer s.mu.Unlock(s.lg)
 
-	if departureRunway != "" && ac.HoldForRelease {
+	if departureRunway != "" && (ac.HoldForRelease || s.needsAPREQ(&ac)) {
 		s.addDepartureToPool(&ac, departureRunway)
 	} else {
 		s.addAircraftNoLock(ac)
@@ -211,7 +253,8 @@ func (s *Sim) LaunchAircraft(ac av.Aircraft, departureRunway string) {
 }
 
 func (s *Sim) addDepartureToPool(ac *av.Aircraft, runway string) {
-	depac := makeDepartureAircraft(ac, s.State.SimTime, s.State /* wind */)
+	depac := makeDepartureAircraft(ac, s.clock.Now(), s.State /* wind */, &s.Rand)
+	depac.RunwayCrossings = s.planTaxi(ac.FlightPlan.DepartureAirport, runway)
 
 	ac.WaitingForLaunch = true
 	s.addAircraftNoLock(*ac)
@@ -219,6 +262,10 @@ func (s *Sim) addDepartureToPool(ac *av.Aircraft, runway string) {
 	depState := s.DepartureState[ac.FlightPlan.DepartureAirport][runway]
 	if ac.HoldForRelease {
 		depState.Held = append(depState.Held, depac)
+	} else if s.needsAPREQ(ac) {
+		// The tower calls for the release once it's ready to go.
+		depac.RequestReleaseTime = s.clock.Now().Add(time.Duration(60+s.Rand.Intn(90)) * time.Second)
+		depState.Held = append(depState.Held, depac)
 	} else {
 		depState.Released = append(depState.Released, depac)
 	}
@@ -228,13 +275,22 @@ func (s *Sim) addDepartureToPool(ac *av.Aircraft, runway string) {
 func (s *Sim) addAircraftNoLock(ac av.Aircraft) {
 	if _, ok := s.State.Aircraft[ac.Callsign]; ok {
 		s.lg.Warn("already have an aircraft with that callsign!", slog.String("callsign", ac.Callsign))
+		if ac.FlightPlan != nil {
+			s.State.ERAMComputer().ReturnSquawk(ac.FlightPlan.AssignedSquawk)
+		}
 		return
 	}
 
+	s.assignFlightID(&ac)
 	s.State.Aircraft[ac.Callsign] = &ac
 
 	ac.Nav.Check(s.lg)
 
+	if s.batch != nil {
+		s.batch.aircraftAdded(s, &ac)
+	}
+	s.eventStream.Post(Event{Type: AircraftSpawnedEvent, Callsign: ac.Callsign})
+
 	if ac.FlightPlan.Rules == av.IFR {
 		s.State.TotalIFR++
 	} else {
@@ -256,23 +312,21 @@ func (s *Sim) Prespawn() {
 	s.lg.Info("starting aircraft prespawn")
 
 	// Prime the pump before the user gets involved
-	t := time.Now().Add(-(initialSimSeconds + 1) * time.Second)
+	start := util.Select(s.Deterministic, s.clock.Now(), time.Now())
+	t := start.Add(-(initialSimSeconds + 1) * time.Second)
 	s.setInitialSpawnTimes(t)
+	s.clock.SetTime(t.Add(-time.Second))
 	s.prespawn = true
 	for i := 0; i < initialSimSeconds; i++ {
 		// Controlled only at the tail end.
 		s.prespawnUncontrolledOnly = i < initialSimSeconds-initialSimControlledSeconds
 
-		s.State.SimTime = t
-		s.lastUpdateTime = t
-		t = t.Add(1 * time.Second)
-
-		s.updateState()
+		s.clock.Tick(s.updateState)
 	}
 	s.prespawnUncontrolledOnly, s.prespawn = false, false
 
-	s.State.SimTime = time.Now()
-	s.lastUpdateTime = time.Now()
+	s.clock.SetTime(start)
+	s.clock.Resync()
 
 	s.lg.Info("finished aircraft prespawn")
 }
@@ -282,20 +336,21 @@ func (s *Sim) setInitialSpawnTimes(now time.Time) {
 	// or after the current time.
 	randomDelay := func(rate float32) time.Time {
 		if rate == 0 {
-			return time.Now().Add(365 * 24 * time.Hour)
+			return now.Add(365 * 24 * time.Hour)
 		}
 		avgWait := int(3600 / rate)
-		delta := rand.Intn(avgWait) - avgWait/2
+		delta := s.Rand.Intn(avgWait) - avgWait/2
 		return now.Add(time.Duration(delta) * time.Second)
 	}
 
 	if s.State.LaunchConfig.ArrivalPushes {
 		// Figure out when the next arrival push will start
-		m := 1 + rand.Intn(s.State.LaunchConfig.ArrivalPushFrequencyMinutes)
+		m := 1 + s.Rand.Intn(s.State.LaunchConfig.ArrivalPushFrequencyMinutes)
 		s.NextPushStart = now.Add(time.Duration(m) * time.Minute)
 	}
 
-	for group, rates := range s.State.LaunchConfig.InboundFlowRates {
+	for _, group := range util.SortedMapKeys(s.State.LaunchConfig.InboundFlowRates) {
+		rates := s.State.LaunchConfig.InboundFlowRates[group]
 		var rateSum float32
 		for _, rate := range rates {
 			rate = scaleRate(rate, s.State.LaunchConfig.InboundFlowRateScale)
@@ -304,11 +359,13 @@ func (s *Sim) setInitialSpawnTimes(now time.Time) {
 		s.NextInboundSpawn[group] = randomDelay(rateSum)
 	}
 
-	for name, ap := range s.State.DepartureAirports {
+	for _, name := range util.SortedMapKeys(s.State.DepartureAirports) {
+		ap := s.State.DepartureAirports[name]
 		s.DepartureState[name] = make(map[string]*RunwayLaunchState)
 
 		if runwayRates, ok := s.State.LaunchConfig.DepartureRates[name]; ok {
-			for rwy, rate := range runwayRates {
+			for _, rwy := range util.SortedMapKeys(runwayRates) {
+				rate := runwayRates[rwy]
 				r := sumRateMap(rate, s.State.LaunchConfig.DepartureRateScale)
 				s.DepartureState[name][rwy] = &RunwayLaunchState{
 					IFRSpawnRate: r,
@@ -328,6 +385,8 @@ func (s *Sim) setInitialSpawnTimes(now time.Time) {
 			state.NextVFRSpawn = randomDelay(state.VFRSpawnRate)
 		}
 	}
+
+	s.setInitialAmbientVFRSpawnTime(now)
 }
 
 func scaleRate(rate, scale float32) float32 {
@@ -349,22 +408,24 @@ func sumRateMap(rates map[string]float32, scale float32) float32 {
 }
 
 // sampleRateMap randomly samples elements from a map of some type T to a
-// rate with probability proportional to the element's rate.
-func sampleRateMap[T comparable](rates map[T]float32, scale float32) (T, float32) {
+// rate with probability proportional to the element's rate. The map is
+// traversed in sorted order so that the result is deterministic for a
+// given state of r.
+func sampleRateMap[T cmp.Ordered](r *rand.Rand, rates map[T]float32, scale float32) (T, float32) {
 	var rateSum float32
 	var result T
-	for item, rate := range rates {
-		rate = scaleRate(rate, scale)
+	for _, item := range util.SortedMapKeys(rates) {
+		rate := scaleRate(rates[item], scale)
 		rateSum += rate
 		// Weighted reservoir sampling...
-		if rateSum == 0 || rand.Float32() < rate/rateSum {
+		if rateSum == 0 || r.Float32() < rate/rateSum {
 			result = item
 		}
 	}
 	return result, rateSum
 }
 
-func randomWait(rate float32, pushActive bool) time.Duration {
+func randomWait(r *rand.Rand, rate float32, pushActive bool) time.Duration {
 	if rate == 0 {
 		return 365 * 24 * time.Hour
 	}
@@ -373,7 +434,21 @@ func randomWait(rate float32, pushActive bool) time.Duration {
 	}
 
 	avgSeconds := 3600 / rate
-	seconds := math.Lerp(rand.Float32(), .85*avgSeconds, 1.15*avgSeconds)
+	seconds := math.Lerp(r.Float32(), .85*avgSeconds, 1.15*avgSeconds)
+	return time.Duration(seconds * float32(time.Second))
+}
+
+// poissonWait is an alternative to randomWait that models launches as a
+// Poisson process, which gives the bunching seen with real-world
+// departures rather than near-uniform spacing: the waits are
+// exponentially distributed with a mean of 1/rate.
+func poissonWait(r *rand.Rand, rate float32) time.Duration {
+	if rate == 0 {
+		return 365 * 24 * time.Hour
+	}
+
+	avgSeconds := 3600 / rate
+	seconds := r.Exponential(avgSeconds)
 	return time.Duration(seconds * float32(time.Second))
 }
 
@@ -382,6 +457,7 @@ func (s *Sim) spawnAircraft() {
 		// Don't spawn automatically if someone is spawning manually.
 		s.spawnArrivalsAndOverflights()
 		s.spawnDepartures()
+		s.spawnAmbientVFR()
 	}
 	s.updateDepartureSequence()
 }
@@ -400,7 +476,7 @@ func (s *Sim) isControlled(ac *av.Aircraft, departure bool) bool {
 }
 
 func (s *Sim) spawnArrivalsAndOverflights() {
-	now := s.State.SimTime
+	now := s.clock.Now()
 
 	if !s.NextPushStart.IsZero() && now.After(s.NextPushStart) {
 		// party time
@@ -410,17 +486,19 @@ func (s *Sim) spawnArrivalsAndOverflights() {
 	}
 	if !s.PushEnd.IsZero() && now.After(s.PushEnd) {
 		// end push
-		m := -2 + rand.Intn(4) + s.State.LaunchConfig.ArrivalPushFrequencyMinutes
-		s.NextPushStart = now.Add(time.Duration(m) * time.Minute)
+		freq := float32(s.State.LaunchConfig.ArrivalPushFrequencyMinutes)
+		m := s.Rand.TruncatedNormal(freq, 2, max(1, freq-5), freq+5)
+		s.NextPushStart = now.Add(time.Duration(m * float32(time.Minute)))
 		s.lg.Info("arrival push ending", slog.Time("next_start", s.NextPushStart))
 		s.PushEnd = time.Time{}
 	}
 
 	pushActive := now.Before(s.PushEnd)
 
-	for group, rates := range s.State.LaunchConfig.InboundFlowRates {
+	for _, group := range util.SortedMapKeys(s.State.LaunchConfig.InboundFlowRates) {
+		rates := s.inboundFlowRates(group)
 		if now.After(s.NextInboundSpawn[group]) {
-			flow, rateSum := sampleRateMap(rates, s.State.LaunchConfig.InboundFlowRateScale)
+			flow, rateSum := sampleRateMap(&s.Rand, rates, s.State.LaunchConfig.InboundFlowRateScale)
 
 			var ac *av.Aircraft
 			var err error
@@ -436,30 +514,42 @@ func (s *Sim) spawnArrivalsAndOverflights() {
 				if s.prespawnUncontrolledOnly && s.isControlled(ac, false) {
 					s.lg.Infof("%s: discarding arrival/overflight\n", ac.Callsign)
 					s.State.DeleteAircraft(ac)
+				} else if delay := s.meterDelay(ac); delay > 0 {
+					// Hold the flow until there's a slot at the
+					// restricted fix; see tmu.go.
+					s.State.DeleteAircraft(ac)
+					s.NextInboundSpawn[group] = now.Add(delay)
+					continue
 				} else {
+					s.assignMeterSlots(ac)
 					s.addAircraftNoLock(*ac)
 				}
-				s.NextInboundSpawn[group] = now.Add(randomWait(rateSum, pushActive))
+				s.NextInboundSpawn[group] = now.Add(randomWait(&s.Rand, rateSum, pushActive))
 			}
 		}
 	}
 }
 
 func (s *Sim) spawnDepartures() {
-	now := s.State.SimTime
+	now := s.clock.Now()
 
-	for airport, runways := range s.DepartureState {
-		for runway, depState := range runways {
+	for _, airport := range util.SortedMapKeys(s.DepartureState) {
+		runways := s.DepartureState[airport]
+		for _, runway := range util.SortedMapKeys(runways) {
+			if s.State.RunwayClosed(airport, runway) {
+				continue
+			}
+			depState := runways[runway]
 			// Possibly spawn another aircraft, depending on how much time has
 			// passed since the last one.
 			if now.After(depState.NextIFRSpawn) {
 				if ac, err := s.makeNewIFRDeparture(airport, runway); ac != nil && err == nil {
 					dropUncontrolled := s.prespawnUncontrolledOnly && s.isControlled(ac, true)
-					dropHFR := s.prespawn && ac.HoldForRelease
+					dropHFR := s.prespawn && (ac.HoldForRelease || s.needsAPREQ(ac))
 					if !dropUncontrolled && !dropHFR {
 						s.addDepartureToPool(ac, runway)
 						r := scaleRate(depState.IFRSpawnRate, s.State.LaunchConfig.DepartureRateScale)
-						depState.NextIFRSpawn = now.Add(randomWait(r, false))
+						depState.NextIFRSpawn = now.Add(poissonWait(&s.Rand, r))
 					} else {
 						s.State.DeleteAircraft(ac)
 					}
@@ -469,7 +559,7 @@ func (s *Sim) spawnDepartures() {
 				if ac, err := s.makeNewVFRDeparture(airport, runway); ac != nil && err == nil {
 					s.addDepartureToPool(ac, runway)
 					r := scaleRate(depState.VFRSpawnRate, s.State.LaunchConfig.DepartureRateScale)
-					depState.NextVFRSpawn = now.Add(randomWait(r, false))
+					depState.NextVFRSpawn = now.Add(poissonWait(&s.Rand, r))
 				}
 			}
 		}
@@ -477,10 +567,12 @@ func (s *Sim) spawnDepartures() {
 }
 
 func (s *Sim) updateDepartureSequence() {
-	now := s.State.SimTime
+	now := s.clock.Now()
 
-	for airport, runways := range s.DepartureState {
-		for depRunway, depState := range runways {
+	for _, airport := range util.SortedMapKeys(s.DepartureState) {
+		runways := s.DepartureState[airport]
+		for _, depRunway := range util.SortedMapKeys(runways) {
+			depState := runways[depRunway]
 			changed := func() { // Debugging...
 				if false {
 					callsign := func(dep DepartureAircraft) string {
@@ -508,8 +600,9 @@ func (s *Sim) updateDepartureSequence() {
 			for i, held := range depState.Held {
 				if !held.AddedToList {
 					depState.Held[i].AddedToList = true
-					ac := s.State.Aircraft[depState.Held[i].Callsign]
-					s.State.STARSComputer().AddHeldDeparture(ac)
+					if ac := s.State.Aircraft[depState.Held[i].Callsign]; ac.HoldForRelease {
+						s.State.STARSComputer().AddHeldDeparture(ac)
+					}
 				}
 			}
 			for i, held := range depState.Held {
@@ -519,20 +612,16 @@ func (s *Sim) updateDepartureSequence() {
 				}
 				if !held.ReleaseRequested {
 					depState.Held[i].ReleaseRequested = true
-					depState.Held[i].ReleaseDelay = time.Duration(20+rand.Intn(100)) * time.Second
-				}
-			}
-			if len(depState.Held) > 0 {
-				// Held go to Released in FIFO order so only consider the first one added.
-				if dep := depState.Held[0]; dep.ReleaseRequested {
-					ac := s.State.Aircraft[dep.Callsign]
-					if ac.Released && now.After(ac.ReleaseTime.Add(dep.ReleaseDelay)) {
-						depState.Released = append(depState.Released, dep)
-						depState.Held = depState.Held[1:]
-						changed()
+					ac := s.State.Aircraft[held.Callsign]
+					if ac.HoldForRelease {
+						depState.Held[i].ReleaseDelay = time.Duration(20+s.Rand.Intn(100)) * time.Second
 					}
+					s.departureReady(ac)
 				}
 			}
+			if s.releaseHeldDepartures(depState, now) {
+				changed()
+			}
 
 			minReleased := util.Select(depState.BufferReleased, 3, 1)
 			if len(depState.Released) >= minReleased || len(depState.Sequenced) == 0 {
@@ -546,6 +635,12 @@ func (s *Sim) updateDepartureSequence() {
 						maxWaitIdx = i
 					}
 				}
+				// Lifeguard flights and the like go first.
+				if i := slices.IndexFunc(depState.Released, func(rel DepartureAircraft) bool {
+					return s.State.Aircraft[rel.Callsign].Priority().Expedite()
+				}); i != -1 {
+					maxWaitIdx = i
+				}
 				if maxWaitIdx != -1 {
 					depState.Sequenced = append(depState.Sequenced, depState.Released[maxWaitIdx])
 					depState.Released = append(depState.Released[:maxWaitIdx], depState.Released[maxWaitIdx+1:]...)
@@ -585,17 +680,36 @@ func (s *Sim) updateDepartureSequence() {
 
 			// See if we have anything to launch
 			considerExit := len(depState.Sequenced) == 1 // if it's just us waiting, don't rush it unnecessarily
-			if len(depState.Sequenced) > 0 && s.canLaunch(depState.LastDeparture, depState.Sequenced[0], considerExit) {
+			if len(depState.Sequenced) > 0 && !s.State.RunwayClosed(airport, depRunway) &&
+				s.taxiComplete(airport, &depState.Sequenced[0]) && s.releaseWindowOpen(depState.Sequenced[0].Callsign) &&
+				s.departureMetered(depState.Sequenced[0].Callsign) &&
+				!s.runwayOccupied(airport, depRunway) && !s.arrivalOnFinal(airport, depRunway, departureArrivalClearance) &&
+				!s.svfrHoldsDeparture(airport, depState.Sequenced[0].Callsign) &&
+				s.canLaunch(depState.LastDeparture, depState.Sequenced[0], considerExit) &&
+				s.dependentRunwaysClear(airport, depRunway, &depState.Sequenced[0]) {
 				dep := &depState.Sequenced[0]
 				ac := s.State.Aircraft[dep.Callsign]
 
+				if s.rejectTakeoff(airport, depRunway, dep) {
+					// It goes to the back of the line once it has
+					// taxied back.
+					depState.Sequenced = append(depState.Sequenced[1:], *dep)
+					changed()
+					continue
+				}
+
 				// Launch!
 				ac.WaitingForLaunch = false
+				s.assignMeterSlots(ac)
+				s.occupyRunway(airport, depRunway, av.DepartureRunwayOccupancy(ac.CWT()))
 
 				// Record the launch so we have it when we consider
 				// launching the next one.
 				dep.LaunchTime = now
 				depState.LastDeparture = dep
+				if s.batch != nil {
+					s.batch.departureLaunched(airport, depRunway, dep, now)
+				}
 
 				// Remove it from the pool of waiting departures.
 				depState.Sequenced = depState.Sequenced[1:]
@@ -633,6 +747,26 @@ func (s *Sim) updateDepartureSequence() {
 	}
 }
 
+// releaseHeldDepartures moves the runway's held departures that have been
+// released on to Released and returns true if there were any. Each is
+// considered independently so that one that's still waiting (e.g., for
+// its APREQ release window) doesn't hold up the others.
+func (s *Sim) releaseHeldDepartures(depState *RunwayLaunchState, now time.Time) bool {
+	released := false
+	held := depState.Held[:0]
+	for _, dep := range depState.Held {
+		ac := s.State.Aircraft[dep.Callsign]
+		if dep.ReleaseRequested && s.departureReleased(ac) && now.After(ac.ReleaseTime.Add(dep.ReleaseDelay)) {
+			depState.Released = append(depState.Released, dep)
+			released = true
+		} else {
+			held = append(held, dep)
+		}
+	}
+	depState.Held = held
+	return released
+}
+
 // canLaunch checks whether we can go ahead and launch dep.
 func (s *Sim) canLaunch(prevDep *DepartureAircraft, dep DepartureAircraft, considerExit bool) bool {
 	if prevDep == nil {
@@ -641,7 +775,7 @@ func (s *Sim) canLaunch(prevDep *DepartureAircraft, dep DepartureAircraft, consi
 		return true
 	} else {
 		// Make sure enough time has passed since the last departure.
-		elapsed := s.State.SimTime.Sub(prevDep.LaunchTime)
+		elapsed := s.clock.Now().Sub(prevDep.LaunchTime)
 		return elapsed > s.launchInterval(*prevDep, dep, considerExit)
 	}
 }
@@ -689,12 +823,12 @@ func (s *Sim) makeNewIFRDeparture(airport, runway string) (ac *av.Aircraft, err
 
 	rates, ok := s.State.LaunchConfig.DepartureRates[airport][runway]
 	if ok {
-		category, rateSum := sampleRateMap(rates, s.State.LaunchConfig.DepartureRateScale)
+		category, rateSum := sampleRateMap(&s.Rand, rates, s.State.LaunchConfig.DepartureRateScale)
 		if rateSum > 0 {
 			ac, err = s.createIFRDepartureNoLock(airport, runway, category)
 
 			if ac != nil && !ac.HoldForRelease {
-				ac.ReleaseTime = s.State.SimTime
+				ac.ReleaseTime = s.clock.Now()
 			}
 		}
 	}
@@ -720,22 +854,16 @@ func (s *Sim) makeNewVFRDeparture(depart, runway string) (ac *av.Aircraft, err e
 		ap := s.State.DepartureAirports[depart]
 
 		// Sample among the randoms and the routes
-		rateSum := 0
 		var sampledRandoms *av.VFRRandomsSpec
 		var sampledRoute *av.VFRRouteSpec
-		if ap.VFR.Randoms.Rate > 0 {
-			rateSum = ap.VFR.Randoms.Rate
-			sampledRandoms = &ap.VFR.Randoms
-		}
+		weights := []float32{float32(ap.VFR.Randoms.Rate)}
 		for _, route := range ap.VFR.Routes {
-			if route.Rate > 0 {
-				rateSum += route.Rate
-				p := float32(route.Rate) / float32(rateSum)
-				if rand.Float32() < p {
-					sampledRandoms = nil
-					sampledRoute = &route
-				}
-			}
+			weights = append(weights, float32(route.Rate))
+		}
+		if idx := s.Rand.SampleWeightedFloat(weights); idx == 0 {
+			sampledRandoms = &ap.VFR.Randoms
+		} else if idx > 0 {
+			sampledRoute = &ap.VFR.Routes[idx-1]
 		}
 
 		for range 5 {
@@ -743,7 +871,7 @@ func (s *Sim) makeNewVFRDeparture(depart, runway string) (ac *av.Aircraft, err e
 
 			if sampledRandoms != nil {
 				// Sample destination airport: may be where we started from.
-				arrive, ok := rand.SampleWeightedSeq(maps.Keys(s.State.DepartureAirports),
+				arrive, ok := rand.SampleWeightedWith(&s.Rand, util.SortedMapKeys(s.State.DepartureAirports),
 					func(ap string) int { return s.State.DepartureAirports[ap].VFRRateSum() })
 				if !ok {
 					s.lg.Errorf("%s: unable to sample VFR destination airport???", depart)
@@ -756,7 +884,7 @@ func (s *Sim) makeNewVFRDeparture(depart, runway string) (ac *av.Aircraft, err e
 			}
 
 			if err == nil && ac != nil {
-				ac.ReleaseTime = s.State.SimTime
+				ac.ReleaseTime = s.clock.Now()
 				depState.VFRSuccesses++
 				return
 			}
@@ -792,7 +920,7 @@ func (d *RunwayLaunchState) setIFRRate(s *Sim, r float32) {
 	}
 	d.IFRSpawnRate = r
 	d.BufferReleased = d.VFRSpawnRate+d.IFRSpawnRate > 30
-	d.NextIFRSpawn = s.State.SimTime.Add(randomWait(r*2, false))
+	d.NextIFRSpawn = s.clock.Now().Add(randomWait(&s.Rand, r*2, false))
 	keep := util.Select(r > 30, 2, util.Select(r > 15, 1, 0))
 	d.Held = s.cullDepartures(keep, d.Held)
 	d.Released = s.cullDepartures(keep, d.Released)
@@ -805,7 +933,7 @@ func (d *RunwayLaunchState) setVFRRate(s *Sim, r float32) {
 	}
 	d.VFRSpawnRate = r
 	d.BufferReleased = d.VFRSpawnRate+d.IFRSpawnRate > 30
-	d.NextVFRSpawn = s.State.SimTime.Add(randomWait(r*2, false))
+	d.NextVFRSpawn = s.clock.Now().Add(randomWait(&s.Rand, r*2, false))
 	keep := util.Select(r > 30, 2, util.Select(r > 15, 1, 0))
 	d.Held = s.cullDepartures(keep, d.Held)
 	d.Released = s.cullDepartures(keep, d.Released)
@@ -852,39 +980,41 @@ var badCallsigns map[string]interface{} = map[string]interface{}{
 	"PSA5342": nil,
 }
 
-func (ss *State) sampleAircraft(al av.AirlineSpecifier, lg *log.Logger) (*av.Aircraft, string) {
-	dbAirline, ok := av.DB.Airlines[al.ICAO]
-	if !ok {
+func (ss *State) sampleAircraft(al av.AirlineSpecifier, r *rand.Rand, lg *log.Logger) (*av.Aircraft, string) {
+	var prefix string
+	var formats []string
+	if p, ok := av.TrafficProfiles[al.Profile]; ok && len(p.Callsigns) > 0 {
+		var format string
+		prefix, format = p.SampleCallsign(r)
+		formats = []string{format}
+	} else if dbAirline, ok := av.DB.Airlines[al.ICAO]; ok {
+		prefix, formats = strings.ToUpper(dbAirline.ICAO), dbAirline.Callsign.CallsignFormats
+	} else {
 		// TODO: this should be caught at load validation time...
 		lg.Errorf("Airline %s, not found in database", al.ICAO)
 		return nil, ""
 	}
 
-	// Sample according to fleet count
-	var aircraft string
-	acCount := 0
-	for _, ac := range al.Aircraft() {
-		// Reservoir sampling...
-		acCount += ac.Count
-		if rand.Float32() < float32(ac.Count)/float32(acCount) {
-			aircraft = ac.ICAO
-		}
-	}
+	// Sample according to fleet count, aged to the configured year.
+	fleet := al.Aircraft()
+	aircraft, _ := av.SampleFleet(fleet, ss.LaunchConfig.FleetYear, r)
 
-	perf, ok := av.DB.AircraftPerformance[aircraft]
-	if !ok {
-		// TODO: validation stage...
-		lg.Errorf("Aircraft %s not found in performance database from airline %+v",
-			aircraft, al)
-		return nil, ""
+	// Use an actual aircraft of that type from the registration database
+	// if there is one.
+	callsign := prefix
+	reg, ra, registered := av.DB.Registrations.SampleRegistration(prefix, aircraft, r, func(reg string) bool {
+		_, ok := ss.Aircraft[reg]
+		return ok
+	})
+	if registered {
+		callsign = reg
 	}
 
 	// random callsign
-	callsign := strings.ToUpper(dbAirline.ICAO)
-	for {
+	for !registered {
 		format := "####"
-		if len(dbAirline.Callsign.CallsignFormats) > 0 {
-			f, ok := rand.SampleWeighted(dbAirline.Callsign.CallsignFormats,
+		if len(formats) > 0 {
+			f, ok := rand.SampleWeightedWith(r, formats,
 				func(f string) int {
 					if _, wt, ok := strings.Cut(f, "x"); ok { // we have a weight
 						if v, err := strconv.Atoi(wt); err == nil {
@@ -905,12 +1035,12 @@ func (ss *State) sampleAircraft(al av.AirlineSpecifier, lg *log.Logger) (*av.Air
 			case '#':
 				if i == 0 {
 					// Don't start with a 0.
-					id += strconv.Itoa(1 + rand.Intn(9))
+					id += strconv.Itoa(1 + r.Intn(9))
 				} else {
-					id += strconv.Itoa(rand.Intn(10))
+					id += strconv.Itoa(r.Intn(10))
 				}
 			case '@':
-				id += string(rune('A' + rand.Intn(26)))
+				id += string(rune('A' + r.Intn(26)))
 			case 'x':
 				break loop
 			}
@@ -925,6 +1055,21 @@ func (ss *State) sampleAircraft(al av.AirlineSpecifier, lg *log.Logger) (*av.Air
 		}
 	}
 
+	// Airline flights that the registration database knows are flown by
+	// their usual equipment, as long as the fleet has it.
+	if t, ok := av.DB.Registrations.FlightType(callsign); ok &&
+		slices.ContainsFunc(fleet, func(f av.FleetAircraft) bool { return f.ICAO == t }) {
+		aircraft = t
+	}
+
+	perf, ok := av.DB.AircraftPerformance[aircraft]
+	if !ok {
+		// TODO: validation stage...
+		lg.Errorf("Aircraft %s not found in performance database from airline %+v",
+			aircraft, al)
+		return nil, ""
+	}
+
 	acType := aircraft
 	if perf.WeightClass == "H" {
 		acType = "H/" + acType
@@ -932,6 +1077,9 @@ func (ss *State) sampleAircraft(al av.AirlineSpecifier, lg *log.Logger) (*av.Air
 	if perf.WeightClass == "J" {
 		acType = "J/" + acType
 	}
+	if ra.Equipment != "" {
+		acType += "/" + ra.Equipment
+	}
 
 	return &av.Aircraft{
 		Callsign: callsign,
@@ -946,11 +1094,11 @@ func (s *Sim) CreateArrival(arrivalGroup string, arrivalAirport string) (*av.Air
 }
 
 func (s *Sim) createArrivalNoLock(group string, arrivalAirport string) (*av.Aircraft, error) {
-	goAround := rand.Float32() < s.State.LaunchConfig.GoAroundRate
+	goAround := s.Rand.Float32() < s.State.LaunchConfig.GoAroundRate
 
 	arrivals := s.State.InboundFlows[group].Arrivals
 	// Randomly sample from the arrivals that have a route to this airport.
-	idx := rand.SampleFiltered(arrivals, func(ar av.Arrival) bool {
+	idx := rand.SampleFilteredWith(&s.Rand, arrivals, func(ar av.Arrival) bool {
 		_, ok := ar.Airlines[arrivalAirport]
 		return ok
 	})
@@ -961,18 +1109,19 @@ func (s *Sim) createArrivalNoLock(group string, arrivalAirport string) (*av.Airc
 	}
 	arr := arrivals[idx]
 
-	airline := rand.SampleSlice(arr.Airlines[arrivalAirport])
-	ac, acType := s.State.sampleAircraft(airline.AirlineSpecifier, s.lg)
+	airline := rand.SampleSliceWith(&s.Rand, arr.Airlines[arrivalAirport])
+	ac, acType := s.State.sampleAircraft(airline.AirlineSpecifier, &s.Rand, s.lg)
 	if ac == nil {
 		return nil, fmt.Errorf("unable to sample a valid aircraft")
 	}
 
-	sq, err := s.State.ERAMComputer().CreateSquawk()
+	sq, err := s.State.ERAMComputer().CreateSquawk(ac.Callsign, &s.Rand)
 	if err != nil {
 		return nil, err
 	}
 	ac.Squawk = sq
 	ac.FlightPlan = ac.NewFlightPlan(av.IFR, acType, airline.Airport, arrivalAirport)
+	airline.ApplyProfile(ac.FlightPlan, &s.Rand)
 
 	// Figure out which controller will (for starters) get the arrival
 	// handoff. For single-user, it's easy.  Otherwise, figure out which
@@ -995,15 +1144,17 @@ func (s *Sim) createArrivalNoLock(group string, arrivalAirport string) (*av.Airc
 	}
 
 	if err := ac.InitializeArrival(s.State.Airports[arrivalAirport], &arr, arrivalController,
-		goAround, s.State.NmPerLongitude, s.State.MagneticVariation, s.State /* wind */, s.lg); err != nil {
+		goAround, s.State.NmPerLongitude, s.State.MagneticVariation, s.State /* wind */, &s.Rand, s.lg); err != nil {
+		s.State.ERAMComputer().ReturnSquawk(sq)
 		return nil, err
 	}
 
 	facility, ok := s.State.FacilityFromController(ac.TrackingController)
 	if !ok {
+		s.State.ERAMComputer().ReturnSquawk(sq)
 		return nil, ErrUnknownControllerFacility
 	}
-	s.State.ERAMComputers.AddArrival(ac, facility, s.State.STARSFacilityAdaptation, s.State.SimTime)
+	s.State.ERAMComputers.AddArrival(ac, facility, s.State.STARSFacilityAdaptation, s.clock.Now())
 
 	return ac, nil
 }
@@ -1021,7 +1172,7 @@ func (s *Sim) CreateVFRDeparture(departureAirport string) (*av.Aircraft, error)
 
 	for range 50 {
 		// Sample destination airport: may be where we started from.
-		arrive, ok := rand.SampleWeightedSeq(maps.Keys(s.State.DepartureAirports),
+		arrive, ok := rand.SampleWeightedWith(&s.Rand, util.SortedMapKeys(s.State.DepartureAirports),
 			func(ap string) int { return s.State.DepartureAirports[ap].VFRRateSum() })
 		if !ok {
 			return nil, nil
@@ -1050,10 +1201,13 @@ func (s *Sim) createIFRDepartureNoLock(departureAirport, runway, category string
 	if idx == -1 {
 		return nil, av.ErrUnknownRunway
 	}
+	if s.State.RunwayClosed(departureAirport, runway) {
+		return nil, ErrRunwayClosed
+	}
 	rwy := &s.State.DepartureRunways[idx]
 
 	// Sample uniformly, minding the category, if specified
-	idx = rand.SampleFiltered(ap.Departures,
+	idx = rand.SampleFilteredWith(&s.Rand, ap.Departures,
 		func(d av.Departure) bool {
 			_, ok := rwy.ExitRoutes[d.Exit] // make sure the runway handles the exit
 			return ok && (rwy.Category == "" || rwy.Category == ap.ExitCategories[d.Exit])
@@ -1065,28 +1219,30 @@ func (s *Sim) createIFRDepartureNoLock(departureAirport, runway, category string
 	}
 	dep := &ap.Departures[idx]
 
-	airline := rand.SampleSlice(dep.Airlines)
-	ac, acType := s.State.sampleAircraft(airline.AirlineSpecifier, s.lg)
+	airline := rand.SampleSliceWith(&s.Rand, dep.Airlines)
+	ac, acType := s.State.sampleAircraft(airline.AirlineSpecifier, &s.Rand, s.lg)
 	if ac == nil {
 		return nil, fmt.Errorf("unable to sample a valid aircraft")
 	}
 
-	sq, err := s.State.ERAMComputer().CreateSquawk()
+	sq, err := s.State.ERAMComputer().CreateSquawk(ac.Callsign, &s.Rand)
 	if err != nil {
 		return nil, err
 	}
 	ac.Squawk = sq
 	ac.FlightPlan = ac.NewFlightPlan(av.IFR, acType, departureAirport, dep.Destination)
+	airline.ApplyProfile(ac.FlightPlan, &s.Rand)
 
 	exitRoute := rwy.ExitRoutes[dep.Exit]
 	if err := ac.InitializeDeparture(ap, departureAirport, dep, runway, *exitRoute,
 		s.State.NmPerLongitude, s.State.MagneticVariation, s.State.STARSFacilityAdaptation.Scratchpads,
-		s.State.PrimaryController, s.State.MultiControllers, s.State /* wind */, s.lg); err != nil {
+		s.State.PrimaryController, s.State.MultiControllers, s.State /* wind */, &s.Rand, s.lg); err != nil {
+		s.State.ERAMComputer().ReturnSquawk(sq)
 		return nil, err
 	}
 
 	eram := s.State.ERAMComputer()
-	eram.AddDeparture(ac.FlightPlan, s.State.TRACON, s.State.SimTime)
+	eram.AddDeparture(ac.FlightPlan, s.State.TRACON, s.clock.Now())
 
 	return ac, nil
 }
@@ -1100,15 +1256,15 @@ func (s *Sim) CreateOverflight(group string) (*av.Aircraft, error) {
 func (s *Sim) createOverflightNoLock(group string) (*av.Aircraft, error) {
 	overflights := s.State.InboundFlows[group].Overflights
 	// Randomly sample an overflight
-	of := rand.SampleSlice(overflights)
+	of := rand.SampleSliceWith(&s.Rand, overflights)
 
-	airline := rand.SampleSlice(of.Airlines)
-	ac, acType := s.State.sampleAircraft(airline.AirlineSpecifier, s.lg)
+	airline := rand.SampleSliceWith(&s.Rand, of.Airlines)
+	ac, acType := s.State.sampleAircraft(airline.AirlineSpecifier, &s.Rand, s.lg)
 	if ac == nil {
 		return nil, fmt.Errorf("unable to sample a valid aircraft")
 	}
 
-	sq, err := s.State.ERAMComputer().CreateSquawk()
+	sq, err := s.State.ERAMComputer().CreateSquawk(ac.Callsign, &s.Rand)
 	if err != nil {
 		return nil, err
 	}
@@ -1116,6 +1272,7 @@ func (s *Sim) createOverflightNoLock(group string) (*av.Aircraft, error) {
 
 	ac.FlightPlan = ac.NewFlightPlan(av.IFR, acType, airline.DepartureAirport,
 		airline.ArrivalAirport)
+	airline.ApplyProfile(ac.FlightPlan, &s.Rand)
 
 	// Figure out which controller will (for starters) get the handoff. For
 	// single-user, it's easy.  Otherwise, figure out which control
@@ -1138,21 +1295,22 @@ func (s *Sim) createOverflightNoLock(group string) (*av.Aircraft, error) {
 
 	if err := ac.InitializeOverflight(&of, controller, s.State.NmPerLongitude, s.State.MagneticVariation,
 		s.State /* wind */, s.lg); err != nil {
+		s.State.ERAMComputer().ReturnSquawk(sq)
 		return nil, err
 	}
 
 	return ac, nil
 }
 
-func makeDepartureAircraft(ac *av.Aircraft, now time.Time, wind av.WindModel) DepartureAircraft {
+func makeDepartureAircraft(ac *av.Aircraft, now time.Time, wind av.WindModel, r *rand.Rand) DepartureAircraft {
 	d := DepartureAircraft{
 		Callsign:  ac.Callsign,
 		SpawnTime: now,
 	}
 
 	if ac.HoldForRelease {
-		d.AddToHFRListTime = now.Add(time.Duration(30+rand.Intn(30)) * time.Second)
-		d.RequestReleaseTime = d.AddToHFRListTime.Add(time.Duration(60+rand.Intn(60)) * time.Second)
+		d.AddToHFRListTime = now.Add(time.Duration(30+r.Intn(30)) * time.Second)
+		d.RequestReleaseTime = d.AddToHFRListTime.Add(time.Duration(60+r.Intn(60)) * time.Second)
 	}
 
 	// Simulate out the takeoff roll and initial climb to figure out when
@@ -1161,7 +1319,7 @@ func makeDepartureAircraft(ac *av.Aircraft, now time.Time, wind av.WindModel) De
 	start := ac.Position()
 	d.MinSeparation = 120 * time.Second // just in case
 	for i := range 120 {
-		simAc.Update(wind, nil /* lg */)
+		simAc.Update(wind, now.Add(time.Duration(i)*time.Second), nil /* lg */)
 		// We need 6,000' and airborne, but we'll add a bit of slop
 		if simAc.IsAirborne() && math.NMDistance2LL(start, simAc.Position()) > 7500*math.FeetToNauticalMiles {
 			d.MinSeparation = time.Duration(i) * time.Second
@@ -1173,17 +1331,17 @@ func makeDepartureAircraft(ac *av.Aircraft, now time.Time, wind av.WindModel) De
 }
 
 func (s *Sim) createUncontrolledVFRDeparture(depart, arrive, fleet string, routeWps []av.Waypoint) (*av.Aircraft, string, error) {
-	depap, arrap := av.DB.Airports[depart], av.DB.Airports[arrive]
+	depap, arrap := av.DB.Airports()[depart], av.DB.Airports()[arrive]
 	rwy := s.State.VFRRunways[depart]
 
-	ac, acType := s.State.sampleAircraft(av.AirlineSpecifier{ICAO: "N", Fleet: fleet}, s.lg)
+	ac, acType := s.State.sampleAircraft(av.AirlineSpecifier{ICAO: "N", Fleet: fleet}, &s.Rand, s.lg)
 	if ac == nil {
 		return nil, "", fmt.Errorf("unable to sample a valid aircraft")
 	}
 
 	rules := av.VFR
 	ac.Squawk = 0o1200
-	if r := rand.Float32(); r < .02 {
+	if r := s.Rand.Float32(); r < .02 {
 		ac.Mode = av.On // mode-A
 	} else if r < .03 {
 		ac.Mode = av.Standby // flat out off
@@ -1195,7 +1353,7 @@ func (s *Sim) createUncontrolledVFRDeparture(depart, arrive, fleet string, route
 	base := math.Max(depap.Elevation, arrap.Elevation)
 	base = 1000 + 1000*(base/1000) // round to 1000s.
 	var alt int
-	randalt := func(n int) int { return base + (1+rand.Intn(n))*1000 }
+	randalt := func(n int) int { return base + (1+s.Rand.Intn(n))*1000 }
 	if dist == 0 {
 		// returning to same airport
 		alt = randalt(4)
@@ -1208,13 +1366,13 @@ func (s *Sim) createUncontrolledVFRDeparture(depart, arrive, fleet string, route
 		alt = randalt(16)
 	}
 	alt = math.Min(alt, 17000)
-	alt = math.Min(alt, int(av.DB.AircraftPerformance[acType].Ceiling))
+	alt = math.Min(alt, int(av.DB.AircraftPerformance[ac.FlightPlan.BaseType()].Ceiling))
 	alt += 500
 
 	mid := math.Mid2f(depap.Location, arrap.Location)
 	if arrive == depart {
-		dist := float32(10 + rand.Intn(20))
-		hdg := float32(1 + rand.Intn(360))
+		dist := float32(10 + s.Rand.Intn(20))
+		hdg := float32(1 + s.Rand.Intn(360))
 		v := [2]float32{dist * math.Sin(math.Radians(hdg)), dist * math.Cos(math.Radians(hdg))}
 		dnm := math.LL2NM(depap.Location, s.State.NmPerLongitude)
 		midnm := math.Add2f(dnm, v)
@@ -1263,9 +1421,9 @@ func (s *Sim) createUncontrolledVFRDeparture(depart, arrive, fleet string, route
 		radius := .15 * dist
 		airwork := func() bool {
 			if depart == arrive {
-				return rand.Intn(3) == 0
+				return s.Rand.Intn(3) == 0
 			}
-			return rand.Intn(10) == 0
+			return s.Rand.Intn(10) == 0
 		}()
 
 		const nsteps = 10
@@ -1296,8 +1454,8 @@ func (s *Sim) createUncontrolledVFRDeparture(depart, arrive, fleet string, route
 			})
 
 			if airwork && i == nsteps/2 {
-				wps[len(wps)-1].AirworkRadius = 4 + rand.Intn(4)
-				wps[len(wps)-1].AirworkMinutes = 5 + rand.Intn(15)
+				wps[len(wps)-1].AirworkRadius = 4 + s.Rand.Intn(4)
+				wps[len(wps)-1].AirworkMinutes = 5 + s.Rand.Intn(15)
 				wps[len(wps)-1].AltitudeRestriction.Range[0] -= 500
 				wps[len(wps)-1].AltitudeRestriction.Range[1] += 2000
 			}
@@ -1317,8 +1475,9 @@ func (s *Sim) createUncontrolledVFRDeparture(depart, arrive, fleet string, route
 
 	// Check airspace violations
 	simac := deep.MustCopy(*ac)
-	for range 3 * 60 * 60 { // limit to 3 hours of sim time, just in case
-		if wp := simac.Update(s.State /* wind */, nil); wp != nil && wp.Delete {
+	for i := range 3 * 60 * 60 { // limit to 3 hours of sim time, just in case
+		t := s.State.SimTime.Add(time.Duration(i) * time.Second)
+		if wp := simac.Update(s.State /* wind */, t, nil); wp != nil && wp.Delete {
 			return ac, rwy.Id, nil
 		}
 		if s.bravoAirspace.Inside(simac.Position(), int(simac.Altitude())) ||
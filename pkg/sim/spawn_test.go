@@ -0,0 +1,39 @@
+// pkg/sim/spawn_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmp/vice/pkg/rand"
+)
+
+func TestPoissonWaitRate(t *testing.T) {
+	r := rand.New()
+	r.Seed(1)
+
+	const rate = 30 // per hour
+	const n = 100000
+	var total time.Duration
+	short := 0
+	for range n {
+		w := poissonWait(&r, rate)
+		total += w
+		if w < 30*time.Second {
+			short++
+		}
+	}
+
+	// The long-run launch rate should match the requested one.
+	if got := float64(n) / total.Hours(); got < 0.98*rate || got > 1.02*rate {
+		t.Errorf("got %.2f launches per hour, expected %d", got, rate)
+	}
+	// And back-to-back launches should happen: about 1-e^(-1/4) of the
+	// waits are less than a quarter of the average.
+	if frac := float64(short) / n; frac < 0.2 || frac > 0.24 {
+		t.Errorf("%.3f of waits were under 30s, expected ~0.221", frac)
+	}
+}
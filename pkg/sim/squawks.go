@@ -0,0 +1,218 @@
+// pkg/sim/squawks.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Each ERAM computer has a SquawkLedger that records which aircraft each
+// beacon code from its code pool, or from the pool that its STARS
+// computers share, has been given to. All allocations and releases go
+// through it, so that the pools can be checked against the ledger and
+// the aircraft that actually exist; see ERAMComputers.SquawkProblems.
+
+// maxSquawkLedgerProblems bounds the number of problems that a ledger
+// remembers.
+const maxSquawkLedgerProblems = 50
+
+type SquawkLedger struct {
+	// code -> callsign; the callsign is empty for codes that were
+	// assigned before there was a ledger.
+	ERAM  map[av.Squawk]string
+	STARS map[av.Squawk]string
+
+	// Problems records errors from allocating and releasing codes, most
+	// recent last.
+	Problems []string
+}
+
+func makeSquawkLedger() *SquawkLedger {
+	return &SquawkLedger{
+		ERAM:  make(map[av.Squawk]string),
+		STARS: make(map[av.Squawk]string),
+	}
+}
+
+// sync adds entries for codes that the pools have assigned but that the
+// ledger doesn't know about; this is necessary for sims that were saved
+// before there were ledgers.
+func (l *SquawkLedger) sync(eram, stars *av.SquawkCodePool) {
+	for _, a := range []struct {
+		pool  *av.SquawkCodePool
+		codes map[av.Squawk]string
+	}{{eram, l.ERAM}, {stars, l.STARS}} {
+		if a.pool == nil {
+			continue
+		}
+		for code := a.pool.First; code <= a.pool.Last; code++ {
+			if _, ok := a.codes[code]; !ok && a.pool.IsAssigned(code) && !av.IsReservedSquawk(code) {
+				a.codes[code] = ""
+			}
+		}
+	}
+}
+
+func (l *SquawkLedger) problem(f string, args ...any) {
+	l.Problems = append(l.Problems, fmt.Sprintf(f, args...))
+	if n := len(l.Problems); n > maxSquawkLedgerProblems {
+		l.Problems = l.Problems[n-maxSquawkLedgerProblems:]
+	}
+}
+
+// get allocates a code from the pool for the given aircraft.
+func (l *SquawkLedger) get(pool *av.SquawkCodePool, codes map[av.Squawk]string, callsign string,
+	r *rand.Rand) (av.Squawk, error) {
+	code, err := pool.Get(r)
+	if err != nil {
+		l.problem("%s: %v", callsign, err)
+		return code, err
+	}
+
+	if prev, ok := codes[code]; ok {
+		l.problem("%s: allocated %s, which the ledger has assigned to %q", callsign, code, prev)
+	}
+	codes[code] = callsign
+	return code, nil
+}
+
+// claim records that the aircraft has the given code, which isn't
+// necessarily one that was allocated from the pool.
+func (l *SquawkLedger) claim(pool *av.SquawkCodePool, codes map[av.Squawk]string, code av.Squawk, callsign string) {
+	if prev, ok := codes[code]; ok {
+		if prev != callsign {
+			l.problem("%s: claimed %s, which is assigned to %q", callsign, code, prev)
+			codes[code] = callsign
+		}
+		return
+	}
+
+	if err := pool.Claim(code); err == av.ErrSquawkCodeNotManagedByPool {
+		return
+	} else if err != nil {
+		l.problem("%s: claimed %s: %v", callsign, code, err)
+	}
+	codes[code] = callsign
+}
+
+// release returns the code to whichever of the two pools it was
+// allocated from.
+func (l *SquawkLedger) release(eram, stars *av.SquawkCodePool, code av.Squawk) error {
+	pool, codes := eram, l.ERAM
+	if _, ok := l.STARS[code]; ok {
+		pool, codes = stars, l.STARS
+	} else if _, ok := l.ERAM[code]; !ok {
+		l.problem("released %s, which isn't assigned", code)
+	}
+
+	delete(codes, code)
+	if pool == nil {
+		return av.ErrSquawkCodeNotManagedByPool
+	}
+	err := pool.Return(code)
+	if err != nil && err != av.ErrSquawkCodeNotManagedByPool {
+		l.problem("released %s: %v", code, err)
+	}
+	return err
+}
+
+// claimSquawk records that the aircraft has the given code; it's taken
+// from the STARS pool if the code is in its bank and from the ERAM pool
+// otherwise.
+func (comp *ERAMComputer) claimSquawk(code av.Squawk, callsign string) {
+	l := comp.SquawkLedger
+	if cs, ok := l.ERAM[code]; ok && cs == callsign {
+		return
+	} else if cs, ok := l.STARS[code]; ok && cs == callsign {
+		return
+	}
+
+	if p := comp.STARSCodePool; p != nil && code >= p.First && code <= p.Last {
+		l.claim(p, l.STARS, code, callsign)
+	} else {
+		l.claim(comp.SquawkCodePool, l.ERAM, code, callsign)
+	}
+}
+
+// SquawkProblems checks the code pools against their ledgers and the
+// given aircraft and returns a description of each inconsistency found:
+// codes that are free in a pool but recorded as assigned or vice versa,
+// codes assigned from both a facility's ERAM and STARS pools, codes held
+// for aircraft that no longer exist, and codes assigned to more than one
+// aircraft. Problems the ledgers encountered along the way are included
+// as well.
+func (ec *ERAMComputers) SquawkProblems(aircraft map[string]*av.Aircraft) []string {
+	var problems []string
+	report := func(f string, args ...any) { problems = append(problems, fmt.Sprintf(f, args...)) }
+
+	// Codes that aircraft are assigned: code -> callsigns
+	assigned := make(map[av.Squawk][]string)
+	for _, callsign := range util.SortedMapKeys(aircraft) {
+		if fp := aircraft[callsign].FlightPlan; fp != nil && fp.AssignedSquawk != 0 {
+			assigned[fp.AssignedSquawk] = append(assigned[fp.AssignedSquawk], callsign)
+		}
+	}
+	for _, code := range util.SortedMapKeys(assigned) {
+		if cs := assigned[code]; len(cs) > 1 {
+			report("%s is assigned to %v", code, cs)
+		}
+	}
+
+	for _, fac := range util.SortedMapKeys(ec.Computers) {
+		comp := ec.Computers[fac]
+		l := comp.SquawkLedger
+		if l == nil {
+			continue
+		}
+
+		for _, a := range []struct {
+			name  string
+			pool  *av.SquawkCodePool
+			codes map[av.Squawk]string
+		}{{fac + " ERAM", comp.SquawkCodePool, l.ERAM}, {fac + " STARS", comp.STARSCodePool, l.STARS}} {
+			if a.pool == nil {
+				continue
+			}
+
+			for _, code := range util.SortedMapKeys(a.codes) {
+				callsign := a.codes[code]
+				if !a.pool.IsAssigned(code) {
+					report("%s: %s is free but assigned to %q", a.name, code, callsign)
+				}
+				if callsign == "" {
+					if len(assigned[code]) == 0 {
+						report("%s: %s is assigned to an unknown aircraft that no longer has it", a.name, code)
+					}
+				} else if ac, ok := aircraft[callsign]; !ok {
+					report("%s: %s leaked: %s no longer exists", a.name, code, callsign)
+				} else if ac.FlightPlan != nil && ac.FlightPlan.AssignedSquawk != code {
+					report("%s: %s leaked: %s now has %s", a.name, code, callsign, ac.FlightPlan.AssignedSquawk)
+				}
+			}
+
+			for code := a.pool.First; code <= a.pool.Last; code++ {
+				if _, ok := a.codes[code]; !ok && a.pool.IsAssigned(code) && !av.IsReservedSquawk(code) {
+					report("%s: %s is assigned in the pool but not in the ledger", a.name, code)
+				}
+			}
+		}
+
+		for _, code := range util.SortedMapKeys(l.ERAM) {
+			if cs, ok := l.STARS[code]; ok {
+				report("%s: %s is assigned from both the ERAM and STARS pools (%q, %q)", fac, code, l.ERAM[code], cs)
+			}
+		}
+
+		for _, p := range l.Problems {
+			report("%s: %s", fac, p)
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,57 @@
+// pkg/sim/squawks_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"strings"
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+)
+
+func TestSquawkProblems(t *testing.T) {
+	h := makeNASHarness(t)
+	h.addDeparture(0)
+	h.addDeparture(1)
+	h.process()
+	if p := h.ec.SquawkProblems(h.flights); len(p) > 0 {
+		t.Fatalf("unexpected problems: %v", p)
+	}
+
+	expect := func(substr string) {
+		t.Helper()
+		p := h.ec.SquawkProblems(h.flights)
+		for _, s := range p {
+			if strings.Contains(s, substr) {
+				return
+			}
+		}
+		t.Errorf("expected a problem with %q; got %v", substr, p)
+	}
+
+	// Deleting an aircraft without returning its code leaks it.
+	ac := h.flights["AAL1"]
+	delete(h.flights, "AAL1")
+	h.ec.CompletelyDeleteAircraft(ac)
+	expect("leaked: AAL1 no longer exists")
+
+	// Returning it twice is noticed as well.
+	eram := h.eram("ZNY")
+	eram.ReturnSquawk(ac.Squawk)
+	eram.ReturnSquawk(ac.Squawk)
+	expect("isn't assigned")
+
+	// As is a code being freed behind the ledger's back.
+	ac = h.flights["AAL2"]
+	eram.SquawkCodePool.Return(ac.Squawk)
+	expect("is free but assigned to \"AAL2\"")
+
+	// And a code given to two aircraft.
+	eram.SquawkLedger.Problems = nil
+	eram.SquawkCodePool.Claim(ac.Squawk)
+	h.flights["AAL3"] = &av.Aircraft{Callsign: "AAL3", Squawk: ac.Squawk,
+		FlightPlan: &av.FlightPlan{Callsign: "AAL3", AssignedSquawk: ac.Squawk}}
+	expect("is assigned to [AAL2 AAL3]")
+}
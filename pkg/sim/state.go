@@ -47,6 +47,8 @@ type State struct {
 	MultiControllers  av.SplitConfiguration
 	PrimaryTCP        string
 	Airspace          map[string]map[string][]av.ControllerAirspaceVolume // ctrl id -> vol name -> definition
+	Sectorization     string                                              // see sectorization.go
+	Sectorizations    map[string]Sectorization
 
 	DepartureRunways []DepartureRunway
 	ArrivalRunways   []ArrivalRunway
@@ -71,13 +73,67 @@ type State struct {
 
 	TotalIFR, TotalVFR int
 
-	Paused         bool
-	SimRate        float32
-	SimDescription string
-	SimTime        time.Time // this is our fake time--accounting for pauses & simRate..
+	Paused  bool
+	SimRate float32
+	// When FastForwardRate is non-zero, the sim runs at that rate
+	// whenever the human controllers don't have anything to do; see
+	// traffic.go. FastForwarding records whether it currently is.
+	FastForwardRate float32
+	FastForwarding  bool
+	SimDescription  string
+	SimTime         time.Time // this is our fake time--accounting for pauses & simRate..
+
+	// Conflicts predicted by the ERAM conflict probe; see probe.go.
+	ProbeConflicts []ProbeConflict
+	// What each aircraft is going to do; see intent.go.
+	Intents map[string]av.Intent
+	// Each position's quick look selection; see quicklook.go.
+	QuickLooks map[string]QuickLook
+	// Each position's saved STARS preference sets; see prefsets.go.
+	PreferenceSets map[string][]byte
+	// Consolidated position -> the human controller working it; see
+	// consolidate.go.
+	Consolidations map[string]string
+	// Airport -> current ATIS; see atis.go.
+	ATIS map[string]ATIS
+	// NOTAMs that are in effect; see notam.go.
+	NOTAMs []NOTAM
+	// Miles- and minutes-in-trail restrictions that are in effect; see
+	// tmu.go.
+	TrafficRestrictions []TrafficRestriction
+	// The arrival push that's in progress, if any; see pushes.go.
+	ActivePush *ArrivalPushStatus
+	// Progress through the lesson, if the scenario is one; see lesson.go.
+	Lesson *LessonStatus
+	// Airport vehicles that want to be or are on a runway; see
+	// vehicles.go.
+	SurfaceVehicles []SurfaceVehicle
+	// Special VFR requests from the towers; see svfr.go.
+	SVFRRequests []SVFRRequest
+	// Releases for departures that need an APREQ; see apreq.go.
+	Releases []Release
+	// Fix -> the aircraft holding there, lowest first; see holding.go.
+	HoldingStacks map[string][]HoldingAircraft
+	// Convective weather cells that are currently present; see
+	// convective.go.
+	WeatherCells []WeatherCell
+	// Recent pilot reports of icing and turbulence; see pirep.go.
+	PIREPs []PIREP
+	// Recommended runway changes; see runwayadvisor.go.
+	RunwayAdvice []RunwayAdvice
+	// Protected windows for departures from runways that depend on
+	// arrival runways; see runwaytimers.go.
+	RunwayTimers []RunwayTimer
+	// Callsign -> its recent positions; see history.go.
+	TrackHistories map[string]*TrackHistory
+	// Callsign -> associated tracks that radar has lost; see coast.go.
+	CoastTracks map[string]*CoastTrack
 
 	Instructors map[string]bool
 
+	PseudoPilots        map[string]bool
+	PseudoPilotAircraft map[string]string // callsign -> pseudo-pilot TCP
+
 	VideoMapLibraryHash []byte
 
 	// Set in State returned by GetStateForController
@@ -86,7 +142,7 @@ type State struct {
 	ControllerMonitoredBeaconCodeBlocks []av.Squawk
 }
 
-func newState(config NewSimConfiguration, manifest *av.VideoMapManifest, lg *log.Logger) *State {
+func newState(config NewSimConfiguration, manifest *av.VideoMapManifest, r *rand.Rand, lg *log.Logger) *State {
 	ss := &State{
 		Aircraft:   make(map[string]*av.Aircraft),
 		Airports:   config.Airports,
@@ -120,7 +176,7 @@ func newState(config NewSimConfiguration, manifest *av.VideoMapManifest, lg *log
 
 		SimRate:        1,
 		SimDescription: config.Description,
-		SimTime:        time.Now(),
+		SimTime:        util.Select(config.Deterministic, DeterministicStartTime, time.Now()),
 
 		Instructors: make(map[string]bool),
 	}
@@ -129,31 +185,12 @@ func newState(config NewSimConfiguration, manifest *av.VideoMapManifest, lg *log
 		ss.VideoMapLibraryHash, _ = manifest.Hash()
 	}
 
-	if len(config.ControllerAirspace) > 0 {
-		ss.Airspace = make(map[string]map[string][]av.ControllerAirspaceVolume)
-		if config.IsLocal {
-			ss.Airspace[ss.PrimaryController] = make(map[string][]av.ControllerAirspaceVolume)
-			// Take all the airspace
-			for _, vnames := range config.ControllerAirspace {
-				for _, vname := range vnames {
-					// Remap from strings provided in the scenario to the
-					// actual volumes defined in the scenario group.
-					ss.Airspace[ss.PrimaryController][vname] = config.Airspace.Volumes[vname]
-				}
-			}
-		} else {
-			for ctrl, vnames := range config.ControllerAirspace {
-				if _, ok := ss.Airspace[ctrl]; !ok {
-					ss.Airspace[ctrl] = make(map[string][]av.ControllerAirspaceVolume)
-				}
-				for _, vname := range vnames {
-					// Remap from strings provided in the scenario to the
-					// actual volumes defined in the scenario group.
-					ss.Airspace[ctrl][vname] = config.Airspace.Volumes[vname]
-				}
-			}
-		}
+	ss.Sectorizations = map[string]Sectorization{DefaultSectorization: config.ControllerAirspace}
+	for name, sect := range config.Sectorizations {
+		ss.Sectorizations[name] = sect
 	}
+	ss.Sectorization = DefaultSectorization
+	ss.Airspace = makeAirspace(config.ControllerAirspace, config.Airspace.Volumes, config.IsLocal, ss.PrimaryController)
 
 	// Add the TFR restriction areas
 	for _, tfr := range config.TFRs {
@@ -180,15 +217,15 @@ func newState(config NewSimConfiguration, manifest *av.VideoMapManifest, lg *log
 	}
 
 	// Make some fake METARs; slightly different for all airports.
-	alt := 2980 + rand.Intn(40)
+	alt := 2980 + r.Intn(40)
 
 	fakeMETAR := func(icao []string) {
 		for _, ap := range icao {
 			ss.METAR[ap] = &av.METAR{
 				// Just provide the stuff that the STARS display shows
 				AirportICAO: ap,
-				Wind:        ss.Wind.Randomize(),
-				Altimeter:   fmt.Sprintf("A%d", alt-2+rand.Intn(4)),
+				Wind:        ss.Wind.Randomize(r),
+				Altimeter:   fmt.Sprintf("A%d", alt-2+r.Intn(4)),
 			}
 		}
 	}
@@ -213,7 +250,7 @@ func newState(config NewSimConfiguration, manifest *av.VideoMapManifest, lg *log
 		if ap.VFRRateSum() > 0 {
 			ss.DepartureAirports[name] = ap
 
-			if rwy, _ := av.DB.Airports[name].SelectBestRunway(ss /* wind */, ss.MagneticVariation); rwy != nil {
+			if rwy, _ := av.DB.Airports()[name].SelectBestRunway(ss /* wind */, ss.MagneticVariation); rwy != nil {
 				ss.VFRRunways[name] = *rwy
 			} else {
 				lg.Errorf("%s: unable to find runway for VFRs", name)
@@ -281,16 +318,16 @@ func (ss *State) Locate(s string) (math.Point2LL, bool) {
 		return ap.Location, true
 	} else if p, ok := ss.Fixes[s]; ok {
 		return p, true
-	} else if n, ok := av.DB.Navaids[s]; ok {
+	} else if n, ok := av.DB.Navaids()[s]; ok {
 		return n.Location, ok
-	} else if ap, ok := av.DB.Airports[s]; ok {
+	} else if ap, ok := av.DB.Airports()[s]; ok {
 		return ap.Location, ok
-	} else if f, ok := av.DB.Fixes[s]; ok {
+	} else if f, ok := av.DB.Fixes()[s]; ok {
 		return f.Location, ok
 	} else if p, err := math.ParseLatLong([]byte(s)); err == nil {
 		return p, true
 	} else if ap, rwy, ok := strings.Cut(s, "/"); ok {
-		if ap, ok := av.DB.Airports[ap]; ok {
+		if ap, ok := av.DB.Airports()[ap]; ok {
 			if idx := slices.IndexFunc(ap.Runways, func(r av.Runway) bool { return r.Id == rwy }); idx != -1 {
 				return ap.Runways[idx].Threshold, true
 			}
@@ -307,7 +344,7 @@ func (ss *State) GetConsolidatedPositions(id string) []string {
 			_, ok := ss.Controllers[id]
 			return ok // active
 		})
-		if rid == id { // The position resolves to us.
+		if ss.resolveConsolidation(rid) == id { // The position resolves to us.
 			cons = append(cons, pos)
 		}
 	}
@@ -341,12 +378,14 @@ func (ss *State) DepartureController(ac *av.Aircraft, lg *log.Logger) string {
 	if len(ss.MultiControllers) > 0 {
 		callsign, err := ss.MultiControllers.ResolveController(ac.DepartureContactController,
 			func(tcp string) bool {
-				return slices.Contains(ss.HumanControllers, tcp)
+				_, consolidated := ss.Consolidations[tcp]
+				return slices.Contains(ss.HumanControllers, tcp) || consolidated
 			})
 		if err != nil {
 			lg.Warn("Unable to resolve departure controller", slog.Any("error", err),
 				slog.Any("aircraft", ac))
 		}
+		callsign = ss.resolveConsolidation(callsign)
 		return util.Select(callsign != "", callsign, ss.PrimaryController)
 	} else {
 		return ss.PrimaryController
@@ -478,7 +517,13 @@ func (ss *State) FacilityFromController(callsign string) (string, bool) {
 
 func (ss *State) DeleteAircraft(ac *av.Aircraft) {
 	delete(ss.Aircraft, ac.Callsign)
-	ss.ERAMComputer().ReturnSquawk(ac.Squawk)
+	// The code the aircraft is squawking may not be the one it was
+	// assigned; see beacon.go.
+	if ac.FlightPlan != nil {
+		ss.ERAMComputer().ReturnSquawk(ac.FlightPlan.AssignedSquawk)
+	} else {
+		ss.ERAMComputer().ReturnSquawk(ac.Squawk)
+	}
 	ss.ERAMComputers.CompletelyDeleteAircraft(ac)
 }
 
@@ -496,3 +541,20 @@ func (ss *State) AmInstructor() bool {
 	_, ok := ss.Instructors[ss.PrimaryTCP]
 	return ok
 }
+
+func (ss *State) AmPseudoPilot() bool {
+	return ss.PseudoPilots[ss.PrimaryTCP]
+}
+
+// PseudoPilotCallsigns returns the callsigns of the aircraft that the
+// given pseudo-pilot is flying.
+func (ss *State) PseudoPilotCallsigns(tcp string) []string {
+	var cs []string
+	for callsign, pp := range ss.PseudoPilotAircraft {
+		if pp == tcp {
+			cs = append(cs, callsign)
+		}
+	}
+	slices.Sort(cs)
+	return cs
+}
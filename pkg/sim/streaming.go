@@ -0,0 +1,134 @@
+// pkg/sim/streaming.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"slices"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/stream"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// A local sim's tracks, statistics, and events can be served to browser
+// overlays and dashboards (e.g., for streaming a session); see
+// pkg/stream. Unlike the flight data export, which follows the format of
+// the FAA's feeds, these are updated every second and include the
+// sim's events.
+
+type streamingState struct {
+	server   *stream.Server
+	events   *EventsSubscription
+	aircraft int // number of tracks last sent
+}
+
+// updateStream is called once a second of sim time.
+func (s *Sim) updateStream() {
+	if s.StreamConfig == nil {
+		return
+	}
+
+	st := &s.streaming
+	if st.server == nil {
+		server, err := stream.Listen(*s.StreamConfig, s.lg)
+		if err != nil {
+			s.lg.Errorf("Unable to start streaming: %v", err)
+			s.eventStream.Post(Event{
+				Type:    StatusMessageEvent,
+				Message: "Unable to serve live data: " + err.Error(),
+			})
+			s.StreamConfig = nil
+			return
+		}
+		*st = streamingState{
+			server: server,
+			events: s.eventStream.Subscribe(),
+		}
+	}
+
+	s.sendStreamEvents()
+
+	now := s.State.SimTime
+	tracks := stream.Tracks{Time: now, Tracks: []stream.Track{}}
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		if ac.WaitingForLaunch || (ac.HoldForRelease && !ac.Released) {
+			continue
+		}
+
+		pos := ac.Position()
+		tr := stream.Track{
+			Callsign:    callsign,
+			Squawk:      ac.Squawk.String(),
+			Lat:         pos[1],
+			Lon:         pos[0],
+			Altitude:    int(ac.Altitude()),
+			GroundSpeed: int(ac.GS()),
+			Heading:     int(math.NormalizeHeading(ac.Heading() - s.State.MagneticVariation)),
+			Owner:       ac.TrackingController,
+			Controller:  ac.ControllingController,
+		}
+		if ac.Mode == av.Standby {
+			tr.Squawk = ""
+		}
+		if fp := ac.FlightPlan; fp != nil {
+			tr.AircraftType = fp.AircraftType
+			tr.Rules = fp.Rules.String()
+			tr.Departure = fp.DepartureAirport
+			tr.Arrival = fp.ArrivalAirport
+		}
+		tracks.Tracks = append(tracks.Tracks, tr)
+	}
+	st.server.SendTracks(tracks)
+	st.aircraft = len(tracks.Tracks)
+
+	s.sendStreamStats()
+}
+
+// sendStreamEvents sends the events posted since the last call to the
+// streaming server, which must be running.
+func (s *Sim) sendStreamEvents() {
+	st := &s.streaming
+	for _, e := range st.events.Get() {
+		st.server.SendEvent(stream.Event{
+			Time:           s.State.SimTime,
+			Type:           scriptEventName(e.Type),
+			Callsign:       e.Callsign,
+			FromController: e.FromController,
+			ToController:   e.ToController,
+			Message:        e.Message,
+		})
+	}
+}
+
+// sendStreamStats sends the current statistics to the streaming server,
+// which must be running.
+func (s *Sim) sendStreamStats() {
+	stats := stream.Stats{
+		Time:        s.State.SimTime,
+		Facility:    s.State.TRACON,
+		Paused:      s.State.Paused,
+		Rate:        s.State.SimRate,
+		Aircraft:    s.streaming.aircraft,
+		TotalIFR:    s.State.TotalIFR,
+		TotalVFR:    s.State.TotalVFR,
+		Controllers: slices.Clone(s.State.HumanControllers),
+	}
+	if s.Scoring != nil {
+		score := s.score()
+		stats.Score = &score
+	}
+	s.streaming.server.SendStats(stats)
+}
+
+// closeStream stops the streaming server, if it's running.
+func (s *Sim) closeStream() {
+	if s.streaming.server != nil {
+		s.streaming.server.Close()
+		s.streaming.events.Unsubscribe()
+		s.streaming = streamingState{}
+	}
+}
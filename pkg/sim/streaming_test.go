@@ -0,0 +1,48 @@
+// pkg/sim/streaming_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/stream"
+)
+
+func TestStreamPause(t *testing.T) {
+	s := newTestSim(t, &State{Aircraft: make(map[string]*av.Aircraft), SimTime: testSimTime})
+	server, err := stream.Listen(stream.Config{Address: "localhost:0"}, s.lg)
+	if err != nil {
+		t.Skipf("unable to listen: %v", err)
+	}
+	s.streaming = streamingState{server: server, events: s.eventStream.Subscribe()}
+	defer s.closeStream()
+
+	paused := func() bool {
+		resp, err := http.Get("http://" + server.Addr().String() + "/stats")
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		defer resp.Body.Close()
+		var stats stream.Stats
+		if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return stats.Paused
+	}
+
+	// The sim doesn't tick while paused, so the stats have to be sent
+	// when it's paused.
+	s.setPaused("2K", true)
+	if !paused() {
+		t.Errorf("stream not paused after pausing the sim")
+	}
+	s.setPaused("2K", false)
+	if paused() {
+		t.Errorf("stream paused after unpausing the sim")
+	}
+}
@@ -0,0 +1,141 @@
+// pkg/sim/surface.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/rand"
+)
+
+// Runway occupancy follows from what's happening on the airport surface:
+// arrivals roll out to an exit that suits their category (using the
+// airport's surface model, if it has one), departures hold the runway
+// while they line up and roll, and departures don't go with an arrival
+// on short final. Departures that must cross other runways on the way
+// from the gate hold short until those runways are clear, which is
+// reported as a taxi conflict.
+
+const (
+	// Departures are held if there is an arrival within this distance of
+	// the runway.
+	departureArrivalClearance = 2.5 // nm
+	// Runways aren't crossed if there is an arrival within this distance.
+	runwayCrossingClearance = 2 // nm
+	runwayCrossingTime      = 20 * time.Second
+)
+
+func (s *Sim) surface(airport string) *av.Surface {
+	if ap, ok := s.State.Airports[airport]; ok && ap != nil {
+		return ap.Surface()
+	}
+	return nil
+}
+
+// arrivalRunwayOccupancy returns how long the arrival will be on the
+// runway after it lands.
+func (s *Sim) arrivalRunwayOccupancy(ac *av.Aircraft, runway string) time.Duration {
+	var exits []av.RunwayExit
+	var length float32
+	if sf := s.surface(ac.FlightPlan.ArrivalAirport); sf != nil {
+		exits = sf.RunwayExits(runway)
+		length, _ = sf.RunwayLength(runway)
+	}
+
+	exit, d := av.ArrivalRunwayOccupancy(ac.CWT(), ac.AircraftPerformance().Speed.Landing, exits, length)
+	if exit.Taxiway != "" {
+		s.lg.Infof("%s: landed %s, exiting at %s", ac.Callsign, runway, exit.Taxiway)
+	}
+	// Not every pilot is as quick about it.
+	return d + time.Duration(s.Rand.Intn(10))*time.Second
+}
+
+// arrivalOnFinal returns true if there is an arrival cleared for an
+// approach to the runway within the given distance of it.
+func (s *Sim) arrivalOnFinal(airport, runway string, dist float32) bool {
+	runway = av.TidyRunway(runway)
+	for _, ac := range s.State.Aircraft {
+		appr := ac.Nav.Approach.Assigned
+		if appr == nil || !ac.Nav.Approach.Cleared || ac.FlightPlan == nil ||
+			ac.FlightPlan.ArrivalAirport != airport || av.TidyRunway(appr.Runway) != runway {
+			continue
+		}
+		if d, err := ac.DistanceToEndOfApproach(); err == nil && d < dist {
+			return true
+		}
+	}
+	return false
+}
+
+// planTaxi picks a gate for a departure and returns the runways it must
+// cross taxiing from there to the departure runway.
+func (s *Sim) planTaxi(airport, runway string) []string {
+	sf := s.surface(airport)
+	if sf == nil || len(sf.Gates) == 0 {
+		return nil
+	}
+	rwy, idx, ok := sf.LookupRunway(runway)
+	if !ok {
+		return nil
+	}
+
+	gate := sf.Nodes[rand.SampleSliceWith(&s.Rand, sf.Gates)]
+	route, _, ok := sf.TaxiRouteAvoiding(gate, rwy.Ends[idx], s.State.ClosedTaxiways(airport))
+	if !ok {
+		return nil
+	}
+
+	var crossings []string
+	for _, r := range sf.RunwayCrossings(route) {
+		if r != rwy {
+			crossings = append(crossings, r.String())
+		}
+	}
+	return crossings
+}
+
+// taxiComplete returns true if the departure has made it to the departure
+// runway. Otherwise it crosses the next runway along its route if it is
+// clear or holds short if not.
+func (s *Sim) taxiComplete(airport string, dep *DepartureAircraft) bool {
+	now := s.State.SimTime
+	if len(dep.RunwayCrossings) == 0 {
+		return !now.Before(dep.TaxiReadyTime)
+	}
+	if now.Before(dep.TaxiReadyTime) {
+		return false
+	}
+
+	crossing := dep.RunwayCrossings[0]
+	rwys := strings.Split(crossing, "/")
+	if slices.ContainsFunc(rwys, func(rwy string) bool {
+		return s.runwayOccupied(airport, rwy) || s.arrivalOnFinal(airport, rwy, runwayCrossingClearance)
+	}) {
+		if !dep.HoldingShort {
+			dep.HoldingShort = true
+			if !s.prespawn {
+				ac := s.State.Aircraft[dep.Callsign]
+				s.eventStream.Post(Event{
+					Type:         TaxiConflictEvent,
+					Callsign:     dep.Callsign,
+					ToController: s.ResolveController(ac.DepartureContactController),
+					Message:      dep.Callsign + " holding short of runway " + crossing + " at " + airport,
+				})
+			}
+		}
+		return false
+	}
+
+	for _, rwy := range rwys {
+		s.occupyRunway(airport, rwy, runwayCrossingTime)
+	}
+	dep.HoldingShort = false
+	dep.RunwayCrossings = dep.RunwayCrossings[1:]
+	dep.TaxiReadyTime = now.Add(runwayCrossingTime)
+	return false
+}
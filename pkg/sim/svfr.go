@@ -0,0 +1,278 @@
+// pkg/sim/svfr.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// When the weather at one of the sim's airports is below basic VFR
+// minimums, VFR pilots there ask the tower for special VFR to depart or
+// to come into the surface area to land, at the rate given by
+// LaunchConfig.SVFRRate. Since SVFR aircraft are separated from IFR
+// traffic, the tower coordinates each one with the TRACON, which approves
+// or denies it; approval isn't possible once the visibility is below a
+// mile. Approved operations are run one-in-one-out: only one SVFR
+// aircraft is in the surface area at a time, one isn't let in while an
+// IFR arrival is close in on an approach or an IFR aircraft is in the
+// surface area, and IFR departures hold until it's clear. If an IFR
+// aircraft enters the surface area while an SVFR aircraft is in it
+// anyway, the tower says so.
+
+type SVFRRequestType string
+
+const (
+	SVFRDeparture SVFRRequestType = "departure"
+	SVFRArrival   SVFRRequestType = "arrival"
+)
+
+type SVFRRequest struct {
+	Id       int
+	Callsign string
+	Type     SVFRRequestType
+	Airport  string
+	// Compass direction the aircraft is leaving toward or coming from.
+	Direction string
+	// How long it will be in the surface area.
+	Duration time.Duration
+
+	Requested time.Time
+	Approved  bool
+	// Zero until the aircraft is in the surface area, then the time it
+	// will have left it or landed.
+	ClearTime time.Time
+}
+
+const (
+	// Requests that the TRACON hasn't answered by then are withdrawn, as
+	// are approved ones that haven't been able to go.
+	svfrRequestTimeout = 10 * time.Minute
+	// An SVFR aircraft isn't let into the surface area if there's an IFR
+	// arrival within this distance of the end of its approach.
+	svfrArrivalClearance = 8 // nm
+	// Approximate lateral and vertical extent of a surface area.
+	svfrSurfaceAreaRadius  = 4.4  // nm
+	svfrSurfaceAreaCeiling = 2500 // feet AGL
+)
+
+// Pending returns whether the request is waiting for the TRACON.
+func (r SVFRRequest) Pending() bool {
+	return !r.Approved
+}
+
+// Active returns whether the aircraft is in the surface area.
+func (r SVFRRequest) Active() bool {
+	return !r.ClearTime.IsZero()
+}
+
+func (r SVFRRequest) String() string {
+	switch r.Type {
+	case SVFRDeparture:
+		return fmt.Sprintf("%s requests special VFR departure to the %s", r.Callsign, r.Direction)
+	default:
+		return fmt.Sprintf("%s %s of the field requests special VFR to land", r.Callsign, r.Direction)
+	}
+}
+
+// svfrWeather returns whether the METAR is below basic VFR minimums, so
+// that VFR aircraft need special VFR, and whether the visibility is good
+// enough for it to be allowed.
+func svfrWeather(metar *av.METAR) (needed, allowed bool) {
+	if metar == nil {
+		return false, false
+	}
+	needed = (metar.Ceiling > 0 && metar.Ceiling < 1000) || (metar.Visibility > 0 && metar.Visibility < 3)
+	allowed = metar.Visibility == 0 || metar.Visibility >= 1
+	return
+}
+
+// svfrAirports returns the sim's airports where SVFR may be requested.
+func (s *Sim) svfrAirports() []string {
+	var aps []string
+	for _, icao := range util.SortedMapKeys(s.State.Airports) {
+		if needed, allowed := svfrWeather(s.State.METAR[icao]); needed && allowed {
+			aps = append(aps, icao)
+		}
+	}
+	return aps
+}
+
+// ifrInSurfaceArea returns the callsigns of the IFR aircraft that are in
+// the airport's surface area.
+func (s *Sim) ifrInSurfaceArea(airport string) []string {
+	ap, ok := s.State.Airports[airport]
+	if !ok {
+		return nil
+	}
+	ceiling := float32(av.DB.Airports()[airport].Elevation + svfrSurfaceAreaCeiling)
+
+	var cs []string
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		if ac.FlightPlan == nil || ac.FlightPlan.Rules != av.IFR || !ac.IsAirborne() {
+			continue
+		}
+		if ac.Altitude() <= ceiling && math.NMDistance2LL(ac.Position(), ap.Location) < svfrSurfaceAreaRadius {
+			cs = append(cs, callsign)
+		}
+	}
+	return cs
+}
+
+// ifrArrivalClose returns whether there's an IFR arrival to the airport
+// close in on an approach.
+func (s *Sim) ifrArrivalClose(airport string) bool {
+	for _, ac := range s.State.Aircraft {
+		if ac.FlightPlan == nil || ac.FlightPlan.ArrivalAirport != airport || !ac.Nav.Approach.Cleared {
+			continue
+		}
+		if d, err := ac.DistanceToEndOfApproach(); err == nil && d < svfrArrivalClearance {
+			return true
+		}
+	}
+	return false
+}
+
+// svfrActive returns whether there's an SVFR aircraft in the airport's
+// surface area.
+func (s *Sim) svfrActive(airport string) bool {
+	return slices.ContainsFunc(s.State.SVFRRequests, func(r SVFRRequest) bool {
+		return r.Airport == airport && r.Active()
+	})
+}
+
+// svfrHoldsDeparture returns whether the departure has to wait for an SVFR
+// aircraft to leave the surface area.
+func (s *Sim) svfrHoldsDeparture(airport, callsign string) bool {
+	ac, ok := s.State.Aircraft[callsign]
+	return ok && ac.FlightPlan != nil && ac.FlightPlan.Rules == av.IFR && s.svfrActive(airport)
+}
+
+func (s *Sim) updateSVFR() {
+	now := s.clock.Now()
+	if rate := s.State.LaunchConfig.SVFRRate; rate > 0 && !now.Before(s.NextSVFRSpawn) {
+		if !s.NextSVFRSpawn.IsZero() {
+			s.spawnSVFRRequest()
+		}
+		s.NextSVFRSpawn = now.Add(poissonWait(&s.Rand, rate))
+	}
+
+	s.State.SVFRRequests = slices.DeleteFunc(s.State.SVFRRequests, func(r SVFRRequest) bool {
+		if r.Active() {
+			if now.Before(r.ClearTime) {
+				return false
+			}
+			s.postTowerMessage(r.Airport, r.Callsign+util.Select(r.Type == SVFRDeparture,
+				" is clear of the surface area", " is down"))
+			return true
+		}
+		if now.Sub(r.Requested) < svfrRequestTimeout {
+			return false
+		}
+		s.postTowerMessage(r.Airport, r.Callsign+" cancels the special VFR request")
+		return true
+	})
+
+	// Let approved aircraft go, one at a time at each airport.
+	for i := range s.State.SVFRRequests {
+		r := &s.State.SVFRRequests[i]
+		if r.Active() || r.Pending() || s.svfrActive(r.Airport) || s.ifrArrivalClose(r.Airport) ||
+			len(s.ifrInSurfaceArea(r.Airport)) > 0 {
+			continue
+		}
+
+		r.ClearTime = now.Add(r.Duration)
+		s.lg.Info("SVFR in surface area", slog.String("callsign", r.Callsign), slog.String("airport", r.Airport),
+			slog.String("type", string(r.Type)))
+		s.postTowerMessage(r.Airport, r.Callsign+util.Select(r.Type == SVFRDeparture,
+			" departing special VFR", " entering the surface area special VFR"))
+	}
+
+	// Report IFR aircraft that come into the surface area while an SVFR
+	// aircraft is in it.
+	intruders := make(map[string]bool)
+	for _, r := range s.State.SVFRRequests {
+		if !r.Active() {
+			continue
+		}
+		for _, callsign := range s.ifrInSurfaceArea(r.Airport) {
+			intruders[callsign] = true
+			if !s.svfrIntruders[callsign] {
+				s.postTowerMessage(r.Airport, callsign+" is in the surface area with special VFR "+r.Callsign)
+			}
+		}
+	}
+	s.svfrIntruders = intruders
+}
+
+func (s *Sim) spawnSVFRRequest() {
+	aps := s.svfrAirports()
+	if len(aps) == 0 {
+		return
+	}
+	ap := aps[s.Rand.Intn(len(aps))]
+
+	ac, _ := s.State.sampleAircraft(av.AirlineSpecifier{ICAO: "N"}, &s.Rand, s.lg)
+	if ac == nil {
+		return
+	}
+
+	r := SVFRRequest{
+		Callsign:  ac.Callsign,
+		Airport:   ap,
+		Direction: math.Compass(float32(1 + s.Rand.Intn(360))),
+		Requested: s.clock.Now(),
+	}
+	for _, prev := range s.State.SVFRRequests {
+		r.Id = max(r.Id, prev.Id)
+	}
+	r.Id++
+	if s.Rand.Intn(2) == 0 {
+		r.Type, r.Duration = SVFRDeparture, time.Duration(120+s.Rand.Intn(120))*time.Second
+	} else {
+		// Arrivals fly in from the edge of the surface area and land.
+		r.Type, r.Duration = SVFRArrival, time.Duration(180+s.Rand.Intn(180))*time.Second
+	}
+
+	s.State.SVFRRequests = append(s.State.SVFRRequests, r)
+	s.lg.Info("SVFR request", slog.String("callsign", r.Callsign), slog.String("airport", r.Airport),
+		slog.String("type", string(r.Type)))
+	s.postTowerMessage(r.Airport, r.String())
+}
+
+// RespondToSVFRRequest approves or denies a tower's request for an SVFR
+// aircraft.
+func (s *Sim) RespondToSVFRRequest(tcp string, id int, approve bool) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.isActiveHumanController(tcp) {
+		return av.ErrNoController
+	}
+	idx := slices.IndexFunc(s.State.SVFRRequests, func(r SVFRRequest) bool { return r.Id == id && r.Pending() })
+	if idx == -1 {
+		return ErrNoSVFRRequest
+	}
+
+	r := &s.State.SVFRRequests[idx]
+	if approve {
+		if _, allowed := svfrWeather(s.State.METAR[r.Airport]); !allowed {
+			return ErrSVFRBelowMinimums
+		}
+		r.Approved = true
+		s.postTowerMessage(r.Airport, fmt.Sprintf("%s special VFR %s approved by %s", r.Callsign, r.Type, tcp))
+	} else {
+		s.postTowerMessage(r.Airport, fmt.Sprintf("%s special VFR %s denied by %s", r.Callsign, r.Type, tcp))
+		s.State.SVFRRequests = slices.Delete(s.State.SVFRRequests, idx, idx+1)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// pkg/sim/svfr_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+func TestSVFRWeather(t *testing.T) {
+	for _, c := range []struct {
+		ceiling         int
+		visibility      float32
+		needed, allowed bool
+	}{
+		{0, 10, false, true},
+		{3000, 5, false, true},
+		{800, 5, true, true},
+		{0, 2, true, true},
+		{500, 0.5, true, false},
+		{0, 0, false, true}, // not reported
+	} {
+		needed, allowed := svfrWeather(&av.METAR{Ceiling: c.ceiling, Visibility: c.visibility})
+		if needed != c.needed || allowed != c.allowed {
+			t.Errorf("ceiling %d visibility %.1f: got needed %v allowed %v, expected %v %v", c.ceiling,
+				c.visibility, needed, allowed, c.needed, c.allowed)
+		}
+	}
+}
+
+func TestSVFROneInOneOut(t *testing.T) {
+	start := time.Date(2024, 6, 1, 15, 4, 0, 0, time.UTC)
+
+	// An IFR arrival cleared for the approach 5 miles out.
+	arr := &av.Aircraft{Callsign: "AAL1", FlightPlan: &av.FlightPlan{Rules: av.IFR, ArrivalAirport: "KOAK"}}
+	arr.Nav.FlightState.Position = math.Point2LL{0, 0}
+	arr.Nav.FlightState.ArrivalAirportLocation = math.Point2LL{0, 5.0 / 60}
+	arr.Nav.FlightState.Altitude = 1500
+	arr.Nav.FlightState.IAS = 140
+	arr.Nav.Approach.Assigned = &av.Approach{Id: "I6", Runway: "6"}
+	arr.Nav.Approach.Cleared = true
+
+	s := newTestSim(t, &State{
+		Aircraft: map[string]*av.Aircraft{"AAL1": arr},
+		Airports: map[string]*av.Airport{"KOAK": {Location: math.Point2LL{0, 5.0 / 60}}},
+		METAR:    map[string]*av.METAR{"KOAK": {Ceiling: 700, Visibility: 0.5}},
+		SVFRRequests: []SVFRRequest{
+			{Id: 1, Callsign: "N1", Type: SVFRDeparture, Airport: "KOAK", Duration: 2 * time.Minute, Requested: start},
+			{Id: 2, Callsign: "N2", Type: SVFRArrival, Airport: "KOAK", Duration: 3 * time.Minute, Requested: start},
+		},
+		SimTime: start,
+	})
+	s.humanControllers = map[string]*EventsSubscription{"1A": nil}
+
+	if err := s.RespondToSVFRRequest("1A", 1, true); err != ErrSVFRBelowMinimums {
+		t.Errorf("approval below minimums: got error %v", err)
+	}
+	s.State.METAR["KOAK"].Visibility = 2
+	if err := s.RespondToSVFRRequest("1A", 3, true); err != ErrNoSVFRRequest {
+		t.Errorf("unknown request: got error %v", err)
+	}
+	for _, id := range []int{1, 2} {
+		if err := s.RespondToSVFRRequest("1A", id, true); err != nil {
+			t.Fatalf("approve %d: %v", id, err)
+		}
+	}
+	if err := s.RespondToSVFRRequest("1A", 1, true); err != ErrNoSVFRRequest {
+		t.Errorf("approving twice: got error %v", err)
+	}
+
+	active := func() []string {
+		var a []string
+		for _, r := range s.State.SVFRRequests {
+			if r.Active() {
+				a = append(a, r.Callsign)
+			}
+		}
+		return a
+	}
+
+	// Nothing goes with the arrival close in.
+	s.updateSVFR()
+	if a := active(); len(a) != 0 {
+		t.Errorf("SVFR %v active with IFR arrival on final", a)
+	}
+
+	// Once it has landed, only the first one goes, and IFR departures
+	// hold until it's clear.
+	delete(s.State.Aircraft, "AAL1")
+	dep := &av.Aircraft{Callsign: "JBU2", FlightPlan: &av.FlightPlan{Rules: av.IFR, DepartureAirport: "KOAK"}}
+	s.State.Aircraft["JBU2"] = dep
+	s.updateSVFR()
+	if a := active(); len(a) != 1 || a[0] != "N1" {
+		t.Errorf("active SVFR %v, expected N1", a)
+	}
+	if !s.svfrHoldsDeparture("KOAK", "JBU2") {
+		t.Errorf("IFR departure not held for SVFR")
+	}
+
+	s.State.SimTime = start.Add(3 * time.Minute)
+	s.updateSVFR()
+	if a := active(); len(a) != 1 || a[0] != "N2" || len(s.State.SVFRRequests) != 1 {
+		t.Errorf("active SVFR %v (%d requests), expected N2", a, len(s.State.SVFRRequests))
+	}
+
+	// An IFR aircraft in the surface area is reported once.
+	dep.Nav.FlightState.Position = math.Point2LL{0, 5.0 / 60}
+	dep.Nav.FlightState.Altitude = 1000
+	dep.Nav.FlightState.IAS = 160
+	sub := s.eventStream.Subscribe()
+	s.updateSVFR()
+	s.updateSVFR()
+	var msgs []string
+	for _, e := range sub.Get() {
+		msgs = append(msgs, e.Message)
+	}
+	if len(msgs) != 1 || msgs[0] != "KOAK tower: JBU2 is in the surface area with special VFR N2" {
+		t.Errorf("unexpected messages %v", msgs)
+	}
+}
@@ -0,0 +1,325 @@
+// pkg/sim/tcas.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// IFR aircraft are equipped with TCAS II, which issues resolution
+// advisories (RAs) when another aircraft with an altitude-reporting
+// transponder is projected to come too close. An RA takes precedence over
+// ATC instructions: the pilot climbs or descends as directed, reports
+// "TCAS RA" to the controller, and returns to the clearance once clear of
+// conflict. When both aircraft have TCAS, their RAs are coordinated so
+// that one climbs and the other descends. A TCASRAEvent is posted for
+// each RA and for each altitude instruction a controller issues to an
+// aircraft that is responding to one, and all RAs are recorded in
+// Sim.TCASRAs so that they can be reviewed after the session. The RAs
+// there that haven't ended are the ones in progress; since they're saved
+// along with the rest of the sim, RAs that are in progress when a sim is
+// saved are still resolved after it's loaded.
+
+// TCASRA records a resolution advisory.
+type TCASRA struct {
+	Callsign    string    `json:"callsign"`
+	Intruder    string    `json:"intruder"`
+	Sense       string    `json:"sense"`       // "climb" or "descend"
+	Coordinated bool      `json:"coordinated"` // the intruder had an RA as well
+	Controller  string    `json:"controller,omitempty"`
+	Altitude    float32   `json:"altitude"` // when the RA was issued
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end,omitzero"` // zero while the RA is in progress
+
+	// What the aircraft was doing before the RA, so it can return to its
+	// clearance afterward. It's cleared when the RA ends.
+	PriorAltitude av.NavAltitude `json:"prior_altitude,omitzero"`
+}
+
+// tcasSensitivity gives the RA thresholds for an altitude band, following
+// TCAS II version 7.1's sensitivity levels.
+type tcasSensitivity struct {
+	below float32 // altitude (AGL for the first, MSL otherwise)
+	tau   float32 // seconds
+	dmod  float32 // nm
+	zthr  float32 // feet
+	alim  float32 // feet
+}
+
+var tcasSensitivities = []tcasSensitivity{
+	{below: 2350, tau: 15, dmod: 0.2, zthr: 600, alim: 300},
+	{below: 5000, tau: 20, dmod: 0.35, zthr: 600, alim: 300},
+	{below: 10000, tau: 25, dmod: 0.55, zthr: 600, alim: 350},
+	{below: 20000, tau: 30, dmod: 0.8, zthr: 600, alim: 400},
+	{below: 42000, tau: 35, dmod: 1.1, zthr: 700, alim: 600},
+	{below: 1e9, tau: 35, dmod: 1.1, zthr: 800, alim: 700},
+}
+
+// RAs are inhibited close to the ground.
+const tcasMinimumAGL = 1000
+
+// tcasMaximumRange bounds the range at which an RA may be issued: the
+// longest tau is 35 seconds, which at a closure rate of 1,400 knots
+// covers a bit under 14nm, plus the largest DMOD.
+const tcasMaximumRange = 15
+
+// tcasAGL approximates the aircraft's height above the ground using the
+// elevation of the closer of its departure and arrival airports.
+func tcasAGL(ac *av.Aircraft) float32 {
+	elev := ac.DepartureAirportElevation()
+	if math.NMDistance2LL(ac.Position(), ac.ArrivalAirportLocation()) <
+		math.NMDistance2LL(ac.Position(), ac.DepartureAirportLocation()) {
+		elev = ac.ArrivalAirportElevation()
+	}
+	return ac.Altitude() - elev
+}
+
+func tcasSensitivityFor(ac *av.Aircraft) tcasSensitivity {
+	if tcasAGL(ac) < tcasSensitivities[0].below {
+		return tcasSensitivities[0]
+	}
+	for _, sl := range tcasSensitivities[1:] {
+		if ac.Altitude() < sl.below {
+			return sl
+		}
+	}
+	return tcasSensitivities[len(tcasSensitivities)-1]
+}
+
+func tcasEquipped(ac *av.Aircraft) bool {
+	return ac.FlightPlan != nil && ac.FlightPlan.Rules == av.IFR && ac.Mode == av.Altitude
+}
+
+// activeRA returns the RA that the aircraft is currently responding to,
+// if any.
+func (s *Sim) activeRA(callsign string) *TCASRA {
+	for i := range s.TCASRAs {
+		if ra := &s.TCASRAs[i]; ra.Callsign == callsign && ra.End.IsZero() {
+			return ra
+		}
+	}
+	return nil
+}
+
+// tcasGeometry returns the range in nm between the two aircraft, the rate
+// at which it is changing in nm/second (negative if they are closing),
+// and the vertical rate of each in feet/second.
+func (s *Sim) tcasGeometry(ac0, ac1 *av.Aircraft) (r, rdot, vz0, vz1 float32) {
+	nmPerLongitude, magneticVariation := s.State.NmPerLongitude, s.State.MagneticVariation
+	velocity := func(ac *av.Aircraft) [2]float32 {
+		p := ac.Position()
+		next := math.Offset2LL(p, ac.Heading(), ac.GS()/3600, nmPerLongitude, magneticVariation)
+		return math.Sub2f(math.LL2NM(next, nmPerLongitude), math.LL2NM(p, nmPerLongitude))
+	}
+
+	d := math.Sub2f(math.LL2NM(ac1.Position(), nmPerLongitude), math.LL2NM(ac0.Position(), nmPerLongitude))
+	v := math.Sub2f(velocity(ac1), velocity(ac0))
+	r = math.Length2f(d)
+	if r > 0 {
+		rdot = math.Dot(d, v) / r
+	}
+
+	vrate := func(ac *av.Aircraft) float32 {
+		if prev, ok := s.tcasAltitudes[ac.Callsign]; ok {
+			return ac.Altitude() - prev
+		}
+		return 0
+	}
+	return r, rdot, vrate(ac0), vrate(ac1)
+}
+
+// tcasThreat returns whether own's TCAS would issue an RA against the
+// intruder.
+func (s *Sim) tcasThreat(own, intruder *av.Aircraft) bool {
+	sl := tcasSensitivityFor(own)
+	r, rdot, vzOwn, vzIntruder := s.tcasGeometry(own, intruder)
+
+	// Range test, with the modified tau that handles slow closure rates.
+	if r >= sl.dmod {
+		if rdot >= 0 {
+			return false
+		}
+		if tau := -(r*r - sl.dmod*sl.dmod) / (r * rdot); tau > sl.tau {
+			return false
+		}
+	}
+
+	// Altitude test: either they're already close vertically or they will
+	// be by the time they're closest.
+	dz := intruder.Altitude() - own.Altitude()
+	if math.Abs(dz) < sl.zthr {
+		return true
+	}
+	t := sl.tau
+	if rdot < 0 {
+		t = math.Min(t, -r/rdot)
+	}
+	return math.Abs(dz+(vzIntruder-vzOwn)*t) < sl.alim
+}
+
+// updateTCAS is called once a second of sim time.
+func (s *Sim) updateTCAS() {
+	eligible := func(ac *av.Aircraft) bool {
+		return ac.IsAirborne() && ac.Mode == av.Altitude && tcasAGL(ac) >= tcasMinimumAGL
+	}
+
+	s.updateActiveRAs()
+
+	for _, pair := range s.aircraftIndex.PairsWithin(tcasMaximumRange) {
+		ac0, ac1 := pair[0], pair[1]
+		if !eligible(ac0) || !eligible(ac1) {
+			continue
+		}
+		eq0, eq1 := tcasEquipped(ac0), tcasEquipped(ac1)
+		if !eq0 && !eq1 {
+			continue
+		}
+		if s.activeRA(ac0.Callsign) != nil || s.activeRA(ac1.Callsign) != nil {
+			continue
+		}
+		if (!eq0 || !s.tcasThreat(ac0, ac1)) && (!eq1 || !s.tcasThreat(ac1, ac0)) {
+			continue
+		}
+
+		// The higher one climbs and the lower descends; ties are
+		// broken as the Mode S addresses would be.
+		upper, lower := ac0, ac1
+		if ac1.Altitude() > ac0.Altitude() || (ac1.Altitude() == ac0.Altitude() && ac1.Callsign < ac0.Callsign) {
+			upper, lower = ac1, ac0
+		}
+		coordinated := eq0 && eq1
+		if tcasEquipped(upper) {
+			s.issueRA(upper, lower, "climb", coordinated)
+		}
+		if tcasEquipped(lower) {
+			s.issueRA(lower, upper, "descend", coordinated)
+		}
+	}
+
+	s.tcasAltitudes = make(map[string]float32)
+	for _, ac := range s.State.Aircraft {
+		if eligible(ac) {
+			s.tcasAltitudes[ac.Callsign] = ac.Altitude()
+		}
+	}
+}
+
+func (s *Sim) issueRA(ac, intruder *av.Aircraft, sense string, coordinated bool) {
+	ra := TCASRA{
+		Callsign:      ac.Callsign,
+		Intruder:      intruder.Callsign,
+		Sense:         sense,
+		Coordinated:   coordinated,
+		Controller:    ac.ControllingController,
+		Altitude:      ac.Altitude(),
+		Start:         s.State.SimTime,
+		PriorAltitude: ac.Nav.Altitude,
+	}
+	s.TCASRAs = append(s.TCASRAs, ra)
+
+	// Climb or descend at least 1,000' from where we are, as quickly as
+	// possible, until clear of conflict.
+	alt := 100 * float32(int(ac.Altitude()+50)/100)
+	alt += util.Select(sense == "climb", float32(1000), float32(-1000))
+	alt = math.Min(alt, ac.AircraftPerformance().Ceiling)
+	ac.Nav.Altitude = av.NavAltitude{Assigned: &alt, Expedite: true}
+
+	s.lg.Info("TCAS RA", slog.String("callsign", ac.Callsign), slog.String("intruder", intruder.Callsign),
+		slog.String("sense", sense), slog.Bool("coordinated", coordinated))
+	s.eventStream.Post(Event{
+		Type:         TCASRAEvent,
+		Callsign:     ac.Callsign,
+		ToController: ra.Controller,
+		Message:      fmt.Sprintf("%s RA, traffic %s at %s", sense, intruder.Callsign, av.FormatAltitude(intruder.Altitude())),
+	})
+	if ra.Controller != "" {
+		s.postRadioEvents(ac.Callsign, []av.RadioTransmission{av.RadioTransmission{
+			Controller: ra.Controller,
+			Message:    "TCAS RA",
+			Type:       av.RadioTransmissionUnexpected,
+		}})
+	}
+}
+
+// updateActiveRAs ends the RAs of aircraft that are clear of conflict:
+// they're diverging from the intruder and separated from it, or it's gone.
+func (s *Sim) updateActiveRAs() {
+	var active []*TCASRA
+	for i := range s.TCASRAs {
+		if s.TCASRAs[i].End.IsZero() {
+			active = append(active, &s.TCASRAs[i])
+		}
+	}
+	slices.SortFunc(active, func(a, b *TCASRA) int { return strings.Compare(a.Callsign, b.Callsign) })
+
+	for _, ra := range active {
+		ac, ok := s.State.Aircraft[ra.Callsign]
+		if !ok {
+			ra.End = s.State.SimTime
+			ra.PriorAltitude = av.NavAltitude{}
+			continue
+		}
+		if intruder, ok := s.State.Aircraft[ra.Intruder]; ok {
+			sl := tcasSensitivityFor(ac)
+			r, rdot, _, _ := s.tcasGeometry(ac, intruder)
+			separated := r > sl.dmod || math.Abs(intruder.Altitude()-ac.Altitude()) > sl.zthr
+			if !separated || rdot < 0 || s.State.SimTime.Sub(ra.Start) < 10*time.Second {
+				continue
+			}
+		}
+
+		ra.End = s.State.SimTime
+		ac.Nav.Altitude = ra.PriorAltitude
+		ra.PriorAltitude = av.NavAltitude{}
+		s.lg.Info("TCAS clear of conflict", slog.String("callsign", ra.Callsign))
+
+		if ctrl := ac.ControllingController; ctrl != "" {
+			msg := "clear of conflict, returning to assigned altitude"
+			if alt := ac.Nav.Altitude.Assigned; alt != nil {
+				msg = "clear of conflict, returning to " + av.FormatAltitude(*alt)
+			}
+			s.postRadioEvents(ac.Callsign, []av.RadioTransmission{av.RadioTransmission{
+				Controller: ctrl,
+				Message:    msg,
+				Type:       av.RadioTransmissionUnexpected,
+			}})
+		}
+	}
+}
+
+// radioForRA is called for altitude instructions; pilots responding to an
+// RA don't follow them until they are clear of conflict.
+func (s *Sim) radioForRA(tcp string, ac *av.Aircraft,
+	cmd func(tcp string, ac *av.Aircraft) []av.RadioTransmission) []av.RadioTransmission {
+	ra := s.activeRA(ac.Callsign)
+	if ra == nil || s.isPseudoPilotFor(tcp, ac.Callsign) {
+		return cmd(tcp, ac)
+	}
+
+	s.eventStream.Post(Event{
+		Type:         TCASRAEvent,
+		Callsign:     ac.Callsign,
+		ToController: tcp,
+		Message:      "altitude instruction during " + ra.Sense + " RA",
+	})
+	return []av.RadioTransmission{av.RadioTransmission{
+		Controller: tcp,
+		Message:    "unable, TCAS RA",
+		Type:       av.RadioTransmissionUnexpected,
+	}}
+}
+
+// tcasRAsSince returns the RAs that started at or after the given time.
+func (s *Sim) tcasRAsSince(t time.Time) []TCASRA {
+	return slices.DeleteFunc(slices.Clone(s.TCASRAs), func(ra TCASRA) bool { return ra.Start.Before(t) })
+}
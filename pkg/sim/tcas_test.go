@@ -0,0 +1,219 @@
+// pkg/sim/tcas_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+const tcasTestNmPerLongitude = 45.5
+
+// makeTCASTestAircraft returns an IFR aircraft at 8,000' cleared to
+// maintain that altitude; at that altitude, TCAS uses a tau of 25
+// seconds, DMOD 0.55nm, ZTHR 600', and ALIM 350'.
+func makeTCASTestAircraft(callsign string, p math.Point2LL, alt, hdg, gs float32) *av.Aircraft {
+	cleared := float32(8000)
+	return &av.Aircraft{
+		Callsign:              callsign,
+		ControllingController: "2K",
+		Mode:                  av.Altitude,
+		FlightPlan:            &av.FlightPlan{Rules: av.IFR},
+		Nav: av.Nav{
+			FlightState: av.FlightState{Position: p, Altitude: alt, Heading: hdg, GS: gs, IAS: 250},
+			Perf:        av.AircraftPerformance{Ceiling: 41000},
+			Altitude:    av.NavAltitude{Assigned: &cleared},
+		},
+	}
+}
+
+func makeTCASTestSim(t *testing.T, aircraft ...*av.Aircraft) *Sim {
+	s := newTestSim(t, &State{
+		Aircraft:       make(map[string]*av.Aircraft),
+		NmPerLongitude: tcasTestNmPerLongitude,
+		SimTime:        testSimTime,
+	})
+	for _, ac := range aircraft {
+		s.State.Aircraft[ac.Callsign] = ac
+	}
+	s.aircraftIndex = NewAircraftIndex(aircraft, nil, tcasTestNmPerLongitude)
+	return s
+}
+
+// eastOf returns the point the given number of nm east of p.
+func eastOf(p math.Point2LL, nm float32) math.Point2LL {
+	return math.Point2LL{p[0] + nm/tcasTestNmPerLongitude, p[1]}
+}
+
+func TestTCASThreat(t *testing.T) {
+	p := math.Point2LL{-73, 40}
+	for _, test := range []struct {
+		name string
+		// The intruder's range to the east, altitude, heading, ground
+		// speed, and altitude a second ago; own is at 8,000' heading east
+		// at the given ground speed.
+		r, alt, hdg, gs, prevAlt float32
+		ownGS                    float32
+		threat                   bool
+	}{
+		{name: "head-on within tau", r: 3, alt: 8000, hdg: 270, gs: 300, prevAlt: 8000, ownGS: 300, threat: true},
+		{name: "head-on beyond tau", r: 6, alt: 8000, hdg: 270, gs: 300, prevAlt: 8000, ownGS: 300},
+		{name: "diverging", r: 1, alt: 8000, hdg: 90, gs: 400, prevAlt: 8000, ownGS: 300},
+		{name: "within DMOD", r: 0.4, alt: 8300, prevAlt: 8300, threat: true},
+		{name: "within DMOD, above ZTHR", r: 0.4, alt: 9000, prevAlt: 9000},
+		{name: "within ZTHR", r: 3, alt: 8500, hdg: 270, gs: 300, prevAlt: 8500, ownGS: 300, threat: true},
+		{name: "above ZTHR, level", r: 3, alt: 9000, hdg: 270, gs: 300, prevAlt: 9000, ownGS: 300},
+		// Descending at 3,000fpm, it will be 100' above at closest approach.
+		{name: "within ALIM at CPA", r: 3, alt: 9000, hdg: 270, gs: 300, prevAlt: 9050, ownGS: 300, threat: true},
+		// Climbing away at 3,000fpm.
+		{name: "beyond ALIM at CPA", r: 3, alt: 9000, hdg: 270, gs: 300, prevAlt: 8950, ownGS: 300},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			own := makeTCASTestAircraft("AAL1", p, 8000, 90, test.ownGS)
+			intruder := makeTCASTestAircraft("UAL2", eastOf(p, test.r), test.alt, test.hdg, test.gs)
+			s := makeTCASTestSim(t, own, intruder)
+			s.tcasAltitudes = map[string]float32{"AAL1": 8000, "UAL2": test.prevAlt}
+
+			if threat := s.tcasThreat(own, intruder); threat != test.threat {
+				t.Errorf("got threat %v, expected %v", threat, test.threat)
+			}
+		})
+	}
+}
+
+func TestTCASCoordinatedRA(t *testing.T) {
+	p := math.Point2LL{-73, 40}
+	lower := makeTCASTestAircraft("AAL1", p, 8000, 90, 300)
+	upper := makeTCASTestAircraft("UAL2", eastOf(p, 3), 8200, 270, 300)
+	s := makeTCASTestSim(t, lower, upper)
+
+	s.updateTCAS()
+
+	if len(s.TCASRAs) != 2 {
+		t.Fatalf("got RAs %+v, expected two", s.TCASRAs)
+	}
+	for _, test := range []struct {
+		callsign, intruder, sense string
+		alt                       float32
+	}{
+		{"AAL1", "UAL2", "descend", 7000},
+		{"UAL2", "AAL1", "climb", 9200},
+	} {
+		ra := s.activeRA(test.callsign)
+		if ra == nil {
+			t.Errorf("%s: no active RA", test.callsign)
+			continue
+		}
+		if ra.Intruder != test.intruder || ra.Sense != test.sense || !ra.Coordinated {
+			t.Errorf("%s: got %+v, expected coordinated %s RA against %s", test.callsign, *ra, test.sense, test.intruder)
+		}
+		nav := s.State.Aircraft[test.callsign].Nav.Altitude
+		if nav.Assigned == nil || *nav.Assigned != test.alt || !nav.Expedite {
+			t.Errorf("%s: got altitude %+v, expected expedite to %.0f", test.callsign, nav, test.alt)
+		}
+	}
+
+	// Only the equipped aircraft responds to a VFR intruder.
+	p = math.Point2LL{-72, 40}
+	ifr := makeTCASTestAircraft("DAL3", p, 8200, 90, 300)
+	vfr := makeTCASTestAircraft("N123", eastOf(p, 3), 8000, 270, 150)
+	vfr.FlightPlan.Rules = av.VFR
+	s = makeTCASTestSim(t, ifr, vfr)
+
+	s.updateTCAS()
+
+	if len(s.TCASRAs) != 1 || s.TCASRAs[0].Callsign != "DAL3" || s.TCASRAs[0].Sense != "climb" ||
+		s.TCASRAs[0].Coordinated {
+		t.Errorf("got RAs %+v, expected an uncoordinated climb RA for DAL3", s.TCASRAs)
+	}
+}
+
+func TestTCASUnableDuringRA(t *testing.T) {
+	p := math.Point2LL{-73, 40}
+	ac := makeTCASTestAircraft("AAL1", p, 8000, 90, 300)
+	intruder := makeTCASTestAircraft("UAL2", eastOf(p, 3), 8200, 270, 300)
+	s := makeTCASTestSim(t, ac, intruder)
+
+	called := false
+	cmd := func(tcp string, ac *av.Aircraft) []av.RadioTransmission {
+		called = true
+		return []av.RadioTransmission{{Controller: tcp, Message: "descend and maintain 6,000"}}
+	}
+
+	if rt := s.radioForRA("2K", ac, cmd); !called || len(rt) != 1 || rt[0].Message != "descend and maintain 6,000" {
+		t.Errorf("without an RA got %+v", rt)
+	}
+
+	s.updateTCAS()
+	called = false
+	if rt := s.radioForRA("2K", ac, cmd); called || len(rt) != 1 || rt[0].Message != "unable, TCAS RA" {
+		t.Errorf("during an RA got %+v, instruction followed %v", rt, called)
+	}
+}
+
+func TestTCASClearOfConflict(t *testing.T) {
+	p := math.Point2LL{-73, 40}
+	ac := makeTCASTestAircraft("AAL1", p, 8000, 90, 300)
+	intruder := makeTCASTestAircraft("UAL2", eastOf(p, 3), 8200, 270, 300)
+	s := makeTCASTestSim(t, ac, intruder)
+
+	s.updateTCAS()
+	if s.activeRA("AAL1") == nil {
+		t.Fatalf("no RA issued")
+	}
+
+	// Save and reload the RAs partway through.
+	b, err := json.Marshal(s.TCASRAs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.TCASRAs = nil
+	if err := json.Unmarshal(b, &s.TCASRAs); err != nil {
+		t.Fatal(err)
+	}
+	if s.activeRA("AAL1") == nil {
+		t.Fatalf("RA isn't active after reloading")
+	}
+
+	// Still converging.
+	s.State.SimTime = s.State.SimTime.Add(5 * time.Second)
+	s.updateActiveRAs()
+	if s.activeRA("AAL1") == nil {
+		t.Fatalf("RA ended while converging")
+	}
+
+	// Now they've passed each other and are diverging.
+	s.State.SimTime = s.State.SimTime.Add(10 * time.Second)
+	ac.Nav.FlightState.Altitude = 7000
+	ac.Nav.FlightState.Position = eastOf(p, 3)
+	intruder.Nav.FlightState.Position = p
+	sub := s.eventStream.Subscribe()
+	s.updateActiveRAs()
+
+	if s.activeRA("AAL1") != nil {
+		t.Errorf("RA still active after clear of conflict")
+	}
+	if alt := ac.Nav.Altitude.Assigned; alt == nil || *alt != 8000 || ac.Nav.Altitude.Expedite {
+		t.Errorf("got altitude %+v, expected the prior assignment to 8,000", ac.Nav.Altitude)
+	}
+	for _, ra := range s.TCASRAs {
+		if ra.Callsign == "AAL1" && (!ra.End.Equal(s.State.SimTime) || ra.PriorAltitude.Assigned != nil) {
+			t.Errorf("got ended RA %+v", ra)
+		}
+	}
+	found := false
+	for _, e := range sub.Get() {
+		if e.Type == RadioTransmissionEvent && e.Callsign == "AAL1" {
+			found = e.Message == "clear of conflict, returning to "+av.FormatAltitude(8000)
+		}
+	}
+	if !found {
+		t.Errorf("no clear of conflict report")
+	}
+}
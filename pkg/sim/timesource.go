@@ -0,0 +1,241 @@
+// pkg/sim/timesource.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"slices"
+	"time"
+
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// TimeSource is the sim's clock. All of the passage of sim time goes
+// through it: it turns elapsed wallclock time into one-second ticks,
+// accounting for the sim rate and fast-forwarding, doesn't advance while
+// the sim is paused (other than for explicitly-requested single steps),
+// and runs callbacks that have been scheduled for particular sim times.
+//
+// The clock's state--the current time, whether it's paused, and the
+// rates--is stored in the State so that it's sent to the clients and
+// saved with the sim; the TimeSource itself isn't serialized and is
+// recreated when the sim is activated. Clients use a TimeSource for
+// their State to extrapolate the current time between updates.
+type TimeSource struct {
+	state *State
+
+	// Wallclock time through which ticks have been handed out; stopped
+	// records that the clock wasn't running as of the last call to Ticks.
+	lastWallclock time.Time
+	stopped       bool
+	// Sim time from the last call to Ticks that wasn't enough for a
+	// whole tick.
+	slop time.Duration
+	// Ticks requested via Step that haven't been run yet.
+	pendingSteps int
+
+	callbacks []scheduledCallback // sorted by time
+	nextID    CallbackID
+}
+
+// CallbackID identifies a scheduled callback so that it can be canceled.
+type CallbackID int
+
+type scheduledCallback struct {
+	id        CallbackID
+	at        time.Time
+	scheduled time.Time // sim time when the callback was scheduled
+	interval  time.Duration
+	f         func()
+}
+
+// NewTimeSource returns a TimeSource that manages the time in the given
+// State.
+func NewTimeSource(state *State) *TimeSource {
+	return &TimeSource{
+		state:         state,
+		lastWallclock: time.Now(),
+	}
+}
+
+// Now returns the current sim time.
+func (ts *TimeSource) Now() time.Time {
+	return ts.state.SimTime
+}
+
+// Paused returns whether the sim is paused.
+func (ts *TimeSource) Paused() bool {
+	return ts.state.Paused
+}
+
+// SetPaused pauses or resumes the sim; wallclock time that passes while
+// the sim is paused is ignored.
+func (ts *TimeSource) SetPaused(paused bool) {
+	ts.state.Paused = paused
+	ts.Resync()
+}
+
+// Rate returns the rate at which sim time is currently advancing
+// relative to wallclock time, accounting for fast-forwarding.
+func (ts *TimeSource) Rate() float32 {
+	if ts.state.FastForwarding {
+		return math.Max(ts.state.SimRate, ts.state.FastForwardRate)
+	}
+	return ts.state.SimRate
+}
+
+// SetRate sets the sim rate; time that has already passed is accounted
+// for at the old rate.
+func (ts *TimeSource) SetRate(rate float32) {
+	ts.state.SimRate = rate
+}
+
+// SetFastForwardRate sets the rate at which the sim runs when it's
+// fast-forwarding; zero disables fast-forwarding.
+func (ts *TimeSource) SetFastForwardRate(rate float32) {
+	ts.state.FastForwardRate = rate
+	if rate == 0 {
+		ts.state.FastForwarding = false
+	}
+}
+
+// SetFastForwarding starts or stops fast-forwarding.
+func (ts *TimeSource) SetFastForwarding(ff bool) {
+	ts.state.FastForwarding = ff && ts.state.FastForwardRate != 0
+}
+
+// Resync discards any wallclock time that has passed since the last
+// ticks were handed out; it should be called after anything that takes
+// long enough that the sim shouldn't try to catch up afterward.
+func (ts *TimeSource) Resync() {
+	ts.lastWallclock = time.Now()
+	ts.slop = 0
+}
+
+// SetTime sets the current sim time without running any callbacks; it's
+// used before the sim starts running.
+func (ts *TimeSource) SetTime(t time.Time) {
+	ts.state.SimTime = t
+}
+
+// Step requests that the clock advance by a single tick the next time
+// Ticks is called, even if it's paused.
+func (ts *TimeSource) Step() {
+	ts.pendingSteps++
+}
+
+// Ticks returns the number of one-second ticks that should be run given
+// the wallclock time that has passed since the last call. If running is
+// false (or the sim is paused), only ticks requested via Step are
+// returned and the time that passes is ignored.
+func (ts *TimeSource) Ticks(running bool) int {
+	n := ts.pendingSteps
+	ts.pendingSteps = 0
+
+	if !running || ts.state.Paused {
+		ts.stopped = true
+		return n
+	}
+	if ts.stopped {
+		// Just started running again; don't try to make up for the time
+		// that passed while we were stopped.
+		ts.stopped = false
+		ts.Resync()
+		return n
+	}
+
+	now := time.Now()
+	elapsed := time.Duration(ts.Rate()*float32(now.Sub(ts.lastWallclock))) + ts.slop
+	ts.lastWallclock = now
+	ts.slop = elapsed - elapsed.Truncate(time.Second)
+	return n + int(elapsed.Truncate(time.Second).Seconds())
+}
+
+// IdleTime returns how long it has been (in wallclock time) since the
+// clock last advanced.
+func (ts *TimeSource) IdleTime() time.Duration {
+	return time.Since(ts.lastWallclock)
+}
+
+// Tick advances sim time by one second, calls update, and then runs any
+// callbacks that are due.
+func (ts *TimeSource) Tick(update func()) {
+	ts.state.SimTime = ts.state.SimTime.Add(time.Second)
+	update()
+
+	now := ts.state.SimTime
+	for len(ts.callbacks) > 0 && !ts.callbacks[0].at.After(now) {
+		cb := ts.callbacks[0]
+		ts.callbacks = ts.callbacks[1:]
+		if cb.interval > 0 {
+			cb.at = cb.at.Add(cb.interval)
+			ts.insert(cb)
+		}
+		cb.f()
+	}
+}
+
+// Schedule arranges for f to be called at the end of the first tick at or
+// after the given sim time. Callbacks aren't saved with the sim, so they
+// should only be used for things that can be recreated when it's
+// activated.
+func (ts *TimeSource) Schedule(at time.Time, f func()) CallbackID {
+	return ts.add(scheduledCallback{at: at, scheduled: ts.Now(), f: f})
+}
+
+// Every arranges for f to be called every interval of sim time, starting
+// an interval from now.
+func (ts *TimeSource) Every(interval time.Duration, f func()) CallbackID {
+	return ts.add(scheduledCallback{at: ts.Now().Add(interval), scheduled: ts.Now(), interval: interval, f: f})
+}
+
+// Cancel removes a callback so that it isn't called (again); it may be
+// called from the callback itself.
+func (ts *TimeSource) Cancel(id CallbackID) {
+	ts.callbacks = slices.DeleteFunc(ts.callbacks, func(cb scheduledCallback) bool { return cb.id == id })
+}
+
+func (ts *TimeSource) add(cb scheduledCallback) CallbackID {
+	ts.nextID++
+	cb.id = ts.nextID
+	ts.insert(cb)
+	return cb.id
+}
+
+func (ts *TimeSource) insert(cb scheduledCallback) {
+	// Callbacks for the same time run in the order they were scheduled.
+	idx, _ := slices.BinarySearchFunc(ts.callbacks, cb.at, func(c scheduledCallback, t time.Time) int {
+		return util.Select(c.at.After(t), 1, -1)
+	})
+	ts.callbacks = slices.Insert(ts.callbacks, idx, cb)
+}
+
+// Rewound should be called after the sim time has been set back to an
+// earlier time. Callbacks that were scheduled after that time are
+// discarded, since the things that scheduled them haven't happened any
+// more, and periodic callbacks restart from the current time.
+func (ts *TimeSource) Rewound() {
+	now := ts.Now()
+	ts.callbacks = slices.DeleteFunc(ts.callbacks, func(cb scheduledCallback) bool {
+		return cb.interval == 0 && cb.scheduled.After(now)
+	})
+	for i := range ts.callbacks {
+		if cb := &ts.callbacks[i]; cb.interval > 0 {
+			cb.at, cb.scheduled = now.Add(cb.interval), now
+		}
+	}
+	slices.SortStableFunc(ts.callbacks, func(a, b scheduledCallback) int { return a.at.Compare(b.at) })
+	ts.Resync()
+}
+
+// Extrapolate returns an estimate of the current sim time, given that
+// the specified amount of wallclock time has passed since the State's
+// time was current.
+func (ts *TimeSource) Extrapolate(d time.Duration) time.Time {
+	if ts.state.Paused || d <= 0 {
+		return ts.Now()
+	}
+	return ts.Now().Add(time.Duration(float64(d) * float64(ts.Rate())))
+}
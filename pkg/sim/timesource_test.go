@@ -0,0 +1,106 @@
+// pkg/sim/timesource_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTimeSource(t *testing.T) {
+	state := &State{SimTime: DeterministicStartTime, SimRate: 1}
+	ts := NewTimeSource(state)
+	start := ts.Now()
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	var calls []string
+	ts.Schedule(at(3), func() { calls = append(calls, "a") })
+	ts.Schedule(at(2), func() { calls = append(calls, "b") })
+	ts.Schedule(at(2), func() { calls = append(calls, "c") })
+	ts.Every(2*time.Second, func() { calls = append(calls, "p") })
+
+	updates := 0
+	for range 4 {
+		ts.Tick(func() { updates++ })
+	}
+	if updates != 4 || !ts.Now().Equal(at(4)) {
+		t.Errorf("after 4 ticks: %d updates, time %s", updates, ts.Now())
+	}
+	if want := []string{"b", "c", "p", "a", "p"}; !slices.Equal(calls, want) {
+		t.Errorf("callbacks ran %v; expected %v", calls, want)
+	}
+
+	// Paused: no time passes other than single steps.
+	ts.SetPaused(true)
+	time.Sleep(1100 * time.Millisecond)
+	if n := ts.Ticks(true); n != 0 {
+		t.Errorf("paused clock gave %d ticks", n)
+	}
+	ts.Step()
+	ts.Step()
+	if n := ts.Ticks(true); n != 2 {
+		t.Errorf("expected 2 single-step ticks; got %d", n)
+	}
+	if !ts.Extrapolate(time.Minute).Equal(ts.Now()) {
+		t.Errorf("paused clock extrapolated to %s", ts.Extrapolate(time.Minute))
+	}
+
+	// Resuming doesn't make up for the time spent paused.
+	ts.SetPaused(false)
+	if n := ts.Ticks(true); n != 0 {
+		t.Errorf("resumed clock gave %d ticks", n)
+	}
+
+	state.SimRate = 2
+	state.FastForwardRate, state.FastForwarding = 4, true
+	if r := ts.Rate(); r != 4 {
+		t.Errorf("expected fast-forward rate 4; got %f", r)
+	}
+	ts.SetFastForwardRate(0)
+	if r := ts.Rate(); r != 2 || state.FastForwarding {
+		t.Errorf("expected rate 2 after disabling fast-forward; got %f", r)
+	}
+	if e := ts.Extrapolate(time.Second); !e.Equal(ts.Now().Add(2 * time.Second)) {
+		t.Errorf("extrapolated to %s; expected %s", e, ts.Now().Add(2*time.Second))
+	}
+
+	// Rewinding drops callbacks scheduled after the new time and restarts
+	// periodic ones.
+	calls = nil
+	ts.Schedule(at(10), func() { calls = append(calls, "late") })
+	ts.SetTime(at(1))
+	ts.Rewound()
+	for range 4 {
+		ts.Tick(func() {})
+	}
+	if want := []string{"p", "p"}; !slices.Equal(calls, want) {
+		t.Errorf("callbacks after rewind ran %v; expected %v", calls, want)
+	}
+}
+
+func TestTimeSourceCancel(t *testing.T) {
+	ts := NewTimeSource(&State{SimTime: DeterministicStartTime, SimRate: 1})
+
+	var calls []string
+	a := ts.Schedule(ts.Now().Add(2*time.Second), func() { calls = append(calls, "a") })
+	ts.Schedule(ts.Now().Add(2*time.Second), func() { calls = append(calls, "b") })
+	var p CallbackID
+	n := 0
+	p = ts.Every(time.Second, func() {
+		calls = append(calls, "p")
+		if n++; n == 2 {
+			ts.Cancel(p)
+		}
+	})
+	ts.Cancel(a)
+
+	for range 4 {
+		ts.Tick(func() {})
+	}
+	if want := []string{"p", "b", "p"}; !slices.Equal(calls, want) {
+		t.Errorf("callbacks ran %v; expected %v", calls, want)
+	}
+}
@@ -0,0 +1,352 @@
+// pkg/sim/tmu.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// The traffic management unit (TMU) imposes miles-in-trail (MIT) and
+// minutes-in-trail (MINIT) restrictions on the aircraft crossing a fix,
+// possibly only those bound for particular airports. Restrictions may be
+// given in the scenario file or imposed by a controller while the sim is
+// running. While one is in effect:
+//
+//   - Aircraft that will cross the fix are metered: each one is given a
+//     slot at the fix, and arrivals and overflights aren't spawned and
+//     departures aren't launched until they can make a slot that is far
+//     enough behind the previous one. Lifeguard flights and ones with an
+//     emergency aren't held for a slot.
+//   - As each aircraft crosses the fix, its spacing behind the previous
+//     one is checked; a TMIViolationEvent is posted to the controller
+//     working it if the spacing is short. The events are scored by the
+//     "tmi" rubric.
+
+// TrafficRestriction is a miles- or minutes-in-trail restriction at a
+// fix; exactly one of MilesInTrail and MinutesInTrail is given.
+type TrafficRestriction struct {
+	Id             int      `json:"-"`
+	Fix            string   `json:"fix"`
+	Airports       []string `json:"arrival_airports,omitempty"` // all if empty
+	MilesInTrail   int      `json:"miles_in_trail,omitempty"`
+	MinutesInTrail int      `json:"minutes_in_trail,omitempty"`
+	// If given, only these controllers are responsible for the spacing
+	// at the fix.
+	Controllers []string `json:"controllers,omitempty"`
+}
+
+const (
+	// Spacing at the fix can be this much short before it's a violation.
+	tmiMilesTolerance   = 1
+	tmiMinutesTolerance = 30 * time.Second
+
+	// Speed used to estimate when departures still on the ground will
+	// reach the fix.
+	meterDepartureSpeed = 250
+)
+
+// Validate checks that the restriction is well-formed; locate gives the
+// locations of fixes.
+func (r TrafficRestriction) Validate(locate func(string) (math.Point2LL, bool)) error {
+	if r.Fix == "" {
+		return fmt.Errorf("\"fix\" must be specified")
+	} else if _, ok := locate(r.Fix); !ok {
+		return fmt.Errorf("%s: unknown fix", r.Fix)
+	}
+	if (r.MilesInTrail == 0) == (r.MinutesInTrail == 0) {
+		return fmt.Errorf("%s: exactly one of \"miles_in_trail\" and \"minutes_in_trail\" must be specified", r.Fix)
+	}
+	if r.MilesInTrail < 0 || r.MinutesInTrail < 0 {
+		return fmt.Errorf("%s: spacing must not be negative", r.Fix)
+	}
+	return nil
+}
+
+// String returns the restriction as it would be written by the TMU, e.g.
+// "KJFK via MERIT 20 MIT".
+func (r TrafficRestriction) String() string {
+	var s string
+	if len(r.Airports) > 0 {
+		s = strings.Join(r.Airports, "/") + " via "
+	}
+	s += r.Fix + " " + r.spacingString()
+	if len(r.Controllers) > 0 {
+		s += " (" + strings.Join(r.Controllers, ", ") + ")"
+	}
+	return s
+}
+
+func (r TrafficRestriction) spacingString() string {
+	if r.MilesInTrail != 0 {
+		return strconv.Itoa(r.MilesInTrail) + " MIT"
+	}
+	return strconv.Itoa(r.MinutesInTrail) + " MINIT"
+}
+
+func (r TrafficRestriction) appliesTo(ac *av.Aircraft) bool {
+	fp := ac.FlightPlan
+	return fp != nil && ac.RouteIncludesFix(r.Fix) &&
+		(len(r.Airports) == 0 || slices.Contains(r.Airports, fp.ArrivalAirport))
+}
+
+// interval returns how long after the previous aircraft one flying at
+// the given groundspeed must cross the fix.
+func (r TrafficRestriction) interval(gs float32) time.Duration {
+	if r.MinutesInTrail != 0 {
+		return time.Duration(r.MinutesInTrail) * time.Minute
+	}
+	return time.Duration(float32(r.MilesInTrail) / max(gs, 60) * float32(time.Hour))
+}
+
+// tmiCrossing records the most recent aircraft to cross a restriction's
+// fix.
+type tmiCrossing struct {
+	Callsign string
+	Time     time.Time
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Metering
+
+// meterETA returns when the aircraft is expected to reach the fix and the
+// groundspeed it's expected to have when it does.
+func (s *Sim) meterETA(ac *av.Aircraft, fix string) (time.Time, float32, bool) {
+	d, err := ac.DistanceAlongRoute(fix)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	gs := ac.GS()
+	if !ac.IsAirborne() {
+		gs = meterDepartureSpeed
+	}
+	return s.State.SimTime.Add(time.Duration(d / gs * float32(time.Hour))), gs, true
+}
+
+// meterDelay returns how long the aircraft must wait before it can make
+// a slot at all of the restricted fixes it will cross; zero means that it
+// can go now.
+func (s *Sim) meterDelay(ac *av.Aircraft) time.Duration {
+	if ac.Priority().Expedite() {
+		return 0
+	}
+
+	var delay time.Duration
+	for _, r := range s.State.TrafficRestrictions {
+		if !r.appliesTo(ac) {
+			continue
+		}
+		last, ok := s.meterSlots[r.Id]
+		if !ok {
+			continue
+		}
+		if eta, gs, ok := s.meterETA(ac, r.Fix); ok {
+			if next := last.Add(r.interval(gs)); eta.Before(next) {
+				delay = max(delay, next.Sub(eta))
+			}
+		}
+	}
+	return delay
+}
+
+// assignMeterSlots gives the aircraft slots at the restricted fixes it
+// will cross; it's called when the aircraft is spawned or launched.
+func (s *Sim) assignMeterSlots(ac *av.Aircraft) {
+	if s.meterSlots == nil {
+		s.meterSlots = make(map[int]time.Time)
+	}
+	for _, r := range s.State.TrafficRestrictions {
+		if !r.appliesTo(ac) {
+			continue
+		}
+		if eta, _, ok := s.meterETA(ac, r.Fix); ok && eta.After(s.meterSlots[r.Id]) {
+			s.meterSlots[r.Id] = eta
+		}
+	}
+}
+
+// departureMetered returns whether the departure can be launched without
+// taking a slot that is too close to the one before it.
+func (s *Sim) departureMetered(callsign string) bool {
+	ac, ok := s.State.Aircraft[callsign]
+	return !ok || s.meterDelay(ac) == 0
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Compliance
+
+// checkTrafficRestrictions is called once a second.
+func (s *Sim) checkTrafficRestrictions() {
+	if len(s.State.TrafficRestrictions) == 0 {
+		return
+	}
+	if s.tmiApproaching == nil {
+		s.tmiApproaching = make(map[string]bool)
+	}
+	if s.tmiCrossings == nil {
+		s.tmiCrossings = make(map[int]tmiCrossing)
+	}
+
+	for _, callsign := range util.SortedMapKeys(s.State.Aircraft) {
+		ac := s.State.Aircraft[callsign]
+		if !ac.IsAirborne() {
+			continue
+		}
+
+		for _, r := range s.State.TrafficRestrictions {
+			key := callsign + "/" + strconv.Itoa(r.Id)
+			if r.appliesTo(ac) {
+				s.tmiApproaching[key] = true
+				continue
+			}
+			if !s.tmiApproaching[key] {
+				continue
+			}
+
+			// As with LOAs, make sure that the fix was crossed rather
+			// than the aircraft being sent somewhere else.
+			delete(s.tmiApproaching, key)
+			if loc, _ := s.State.Locate(r.Fix); math.NMDistance2LL(ac.Position(), loc) > crossingRadius {
+				continue
+			}
+			prev, ok := s.tmiCrossings[r.Id]
+			s.tmiCrossings[r.Id] = tmiCrossing{Callsign: callsign, Time: s.State.SimTime}
+			if ok {
+				s.checkTrailSpacing(r, ac, prev)
+			}
+		}
+	}
+
+	for key := range s.tmiApproaching {
+		callsign, _, _ := strings.Cut(key, "/")
+		if _, ok := s.State.Aircraft[callsign]; !ok {
+			delete(s.tmiApproaching, key)
+		}
+	}
+}
+
+// checkTrailSpacing checks the spacing of the aircraft, which has just
+// crossed the restriction's fix, behind the previous one to do so.
+func (s *Sim) checkTrailSpacing(r TrafficRestriction, ac *av.Aircraft, prev tmiCrossing) {
+	elapsed := s.State.SimTime.Sub(prev.Time)
+
+	var msg string
+	if r.MinutesInTrail != 0 {
+		if elapsed < time.Duration(r.MinutesInTrail)*time.Minute-tmiMinutesTolerance {
+			msg = fmt.Sprintf("%.1f minutes in trail behind %s", elapsed.Minutes(), prev.Callsign)
+		}
+	} else {
+		// Measure to where the previous aircraft is now if it's still
+		// around; otherwise estimate it from the time between them.
+		var miles float32
+		if pac, ok := s.State.Aircraft[prev.Callsign]; ok {
+			miles = math.NMDistance2LL(pac.Position(), ac.Position())
+		} else {
+			miles = ac.GS() * float32(elapsed.Hours())
+		}
+		if miles < float32(r.MilesInTrail-tmiMilesTolerance) {
+			msg = fmt.Sprintf("%.1f miles in trail behind %s", miles, prev.Callsign)
+		}
+	}
+	if msg == "" {
+		return
+	}
+
+	tcp := ac.ControllingController
+	if !s.isActiveHumanController(tcp) || (len(r.Controllers) > 0 && !slices.Contains(r.Controllers, tcp)) {
+		return
+	}
+
+	s.lg.Info("TMI violation", slog.String("restriction", r.String()), slog.String("callsign", ac.Callsign),
+		slog.String("controller", tcp), slog.String("problem", msg))
+	s.eventStream.Post(Event{
+		Type:         TMIViolationEvent,
+		Callsign:     ac.Callsign,
+		ToController: tcp,
+		Message:      r.Fix + ": " + msg + ", not " + r.spacingString(),
+	})
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Imposing and cancelling restrictions
+
+// ImposeTrafficRestriction puts a new restriction into effect.
+func (s *Sim) ImposeTrafficRestriction(tcp string, r TrafficRestriction) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.isActiveHumanController(tcp) {
+		return av.ErrNoController
+	}
+	if err := r.Validate(s.State.Locate); err != nil {
+		return ErrInvalidTrafficRestriction
+	}
+	for _, ap := range r.Airports {
+		if _, ok := av.DB.Airports()[ap]; !ok {
+			return av.ErrUnknownAirport
+		}
+	}
+
+	s.addTrafficRestriction(r)
+	s.lg.Info("traffic restriction imposed", slog.String("tcp", tcp), slog.String("restriction", r.String()))
+
+	return nil
+}
+
+func (s *Sim) addTrafficRestriction(r TrafficRestriction) {
+	r.Id = 1
+	for _, prev := range s.State.TrafficRestrictions {
+		r.Id = max(r.Id, prev.Id+1)
+	}
+	s.State.TrafficRestrictions = append(s.State.TrafficRestrictions, r)
+
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: fmt.Sprintf("TMU: %s in effect", r),
+	})
+}
+
+// CancelTrafficRestriction cancels the restriction with the given id.
+func (s *Sim) CancelTrafficRestriction(tcp string, id int) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.isActiveHumanController(tcp) {
+		return av.ErrNoController
+	}
+	r, ok := s.cancelTrafficRestriction(id)
+	if !ok {
+		return ErrUnknownTrafficRestriction
+	}
+	s.lg.Info("traffic restriction cancelled", slog.String("tcp", tcp), slog.String("restriction", r.String()))
+
+	return nil
+}
+
+func (s *Sim) cancelTrafficRestriction(id int) (TrafficRestriction, bool) {
+	idx := slices.IndexFunc(s.State.TrafficRestrictions, func(r TrafficRestriction) bool { return r.Id == id })
+	if idx == -1 {
+		return TrafficRestriction{}, false
+	}
+
+	r := s.State.TrafficRestrictions[idx]
+	s.State.TrafficRestrictions = slices.Delete(s.State.TrafficRestrictions, idx, idx+1)
+	delete(s.meterSlots, id)
+	delete(s.tmiCrossings, id)
+
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: fmt.Sprintf("TMU: %s cancelled", r),
+	})
+	return r, true
+}
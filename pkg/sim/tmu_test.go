@@ -0,0 +1,201 @@
+// pkg/sim/tmu_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/math"
+)
+
+const tmuTestNmPerLongitude = 45.4
+
+// tmuTestPoint returns the point the given distance north of CAMRN.
+func tmuTestPoint(northNM float32) math.Point2LL {
+	return math.Point2LL{-73.6, 40.1 + northNM/60}
+}
+
+func makeTMUTestSim(t *testing.T) *Sim {
+	s := newTestSim(t, &State{
+		Aircraft:       make(map[string]*av.Aircraft),
+		Fixes:          map[string]math.Point2LL{"CAMRN": tmuTestPoint(0)},
+		NmPerLongitude: tmuTestNmPerLongitude,
+		SimTime:        testSimTime,
+	})
+	s.humanControllers = map[string]*EventsSubscription{"2K": nil}
+	return s
+}
+
+// makeTMUTestAircraft returns an airborne aircraft the given distance
+// north of CAMRN, flying south to it and then to its arrival airport.
+func makeTMUTestAircraft(s *Sim, callsign string, northNM, gs float32, arrival string) *av.Aircraft {
+	ac := &av.Aircraft{
+		Callsign:              callsign,
+		ControllingController: "2K",
+		FlightPlan:            &av.FlightPlan{ArrivalAirport: arrival},
+	}
+	ac.Nav.FlightState = av.FlightState{Position: tmuTestPoint(northNM), GS: gs, IAS: gs, Heading: 180}
+	ac.Nav.Waypoints = []av.Waypoint{{Fix: "CAMRN", Location: tmuTestPoint(0)}, {Fix: arrival, Location: tmuTestPoint(-40)}}
+	s.State.Aircraft[callsign] = ac
+	return ac
+}
+
+func TestTrafficRestrictionValidate(t *testing.T) {
+	locate := func(fix string) (math.Point2LL, bool) { return tmuTestPoint(0), fix == "CAMRN" }
+
+	for _, test := range []struct {
+		r        TrafficRestriction
+		expected string // error or String()
+		valid    bool
+	}{
+		{TrafficRestriction{Fix: "CAMRN", MilesInTrail: 20}, "CAMRN 20 MIT", true},
+		{TrafficRestriction{Fix: "CAMRN", Airports: []string{"KJFK", "KLGA"}, MinutesInTrail: 5, Controllers: []string{"2K", "2J"}},
+			"KJFK/KLGA via CAMRN 5 MINIT (2K, 2J)", true},
+		{TrafficRestriction{MilesInTrail: 20}, `"fix" must be specified`, false},
+		{TrafficRestriction{Fix: "LENDY", MilesInTrail: 20}, "LENDY: unknown fix", false},
+		{TrafficRestriction{Fix: "CAMRN"}, "exactly one of", false},
+		{TrafficRestriction{Fix: "CAMRN", MilesInTrail: 20, MinutesInTrail: 5}, "exactly one of", false},
+		{TrafficRestriction{Fix: "CAMRN", MilesInTrail: -20}, "must not be negative", false},
+	} {
+		err := test.r.Validate(locate)
+		if test.valid {
+			if err != nil {
+				t.Errorf("%+v: unexpected error %v", test.r, err)
+			} else if test.r.String() != test.expected {
+				t.Errorf("%+v: got %q, expected %q", test.r, test.r.String(), test.expected)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%+v: got error %v, expected one containing %q", test.r, err, test.expected)
+		}
+	}
+
+	for _, test := range []struct {
+		r        TrafficRestriction
+		gs       float32
+		expected time.Duration
+	}{
+		{TrafficRestriction{MilesInTrail: 10}, 300, 2 * time.Minute},
+		{TrafficRestriction{MilesInTrail: 10}, 600, time.Minute},
+		// Slow aircraft are taken to be doing at least 60 knots.
+		{TrafficRestriction{MilesInTrail: 10}, 20, 10 * time.Minute},
+		{TrafficRestriction{MinutesInTrail: 5}, 300, 5 * time.Minute},
+	} {
+		if d := test.r.interval(test.gs); math.Abs(float32((d - test.expected).Seconds())) > 0.01 {
+			t.Errorf("%+v at %.0f knots: got interval %s, expected %s", test.r, test.gs, d, test.expected)
+		}
+	}
+}
+
+func TestMeterDelay(t *testing.T) {
+	s := makeTMUTestSim(t)
+	s.addTrafficRestriction(TrafficRestriction{Fix: "CAMRN", Airports: []string{"KJFK"}, MilesInTrail: 10})
+
+	// The first aircraft doesn't have to wait; it's 6 minutes from CAMRN.
+	lead := makeTMUTestAircraft(s, "AAL1", 30, 300, "KJFK")
+	if d := s.meterDelay(lead); d != 0 {
+		t.Errorf("got delay %s for the first aircraft", d)
+	}
+	s.assignMeterSlots(lead)
+
+	for _, test := range []struct {
+		name     string
+		northNM  float32
+		arrival  string
+		remarks  string
+		expected time.Duration
+	}{
+		// 6.2 minutes out; it has to be at least 8 minutes behind.
+		{name: "too close", northNM: 31, arrival: "KJFK", expected: 108 * time.Second},
+		{name: "far enough", northNM: 45, arrival: "KJFK"},
+		{name: "other airport", northNM: 31, arrival: "KLGA"},
+		{name: "lifeguard", northNM: 31, arrival: "KJFK", remarks: "LIFEGUARD"},
+	} {
+		ac := makeTMUTestAircraft(s, "UAL2", test.northNM, 300, test.arrival)
+		ac.FlightPlan.Remarks = test.remarks
+		if d := s.meterDelay(ac); math.Abs(float32((d - test.expected).Seconds())) > 1 {
+			t.Errorf("%s: got delay %s, expected %s", test.name, d, test.expected)
+		}
+		if m := s.departureMetered("UAL2"); m != (test.expected == 0) {
+			t.Errorf("%s: got departureMetered %v", test.name, m)
+		}
+	}
+
+	// Once it's cancelled, there's no need to wait.
+	ac := makeTMUTestAircraft(s, "UAL2", 31, 300, "KJFK")
+	if _, ok := s.cancelTrafficRestriction(1); !ok {
+		t.Fatalf("unable to cancel the restriction")
+	}
+	if d := s.meterDelay(ac); d != 0 {
+		t.Errorf("got delay %s after the restriction was cancelled", d)
+	}
+}
+
+func TestTrailSpacing(t *testing.T) {
+	// cross has the aircraft fly past CAMRN.
+	cross := func(s *Sim, ac *av.Aircraft, at float32) {
+		s.checkTrafficRestrictions()
+		ac.Nav.Waypoints = ac.Nav.Waypoints[1:]
+		ac.Nav.FlightState.Position = tmuTestPoint(at)
+		s.checkTrafficRestrictions()
+	}
+
+	for _, test := range []struct {
+		name        string
+		restriction TrafficRestriction
+		spacing     float32 // nm between the aircraft when the second crosses
+		elapsed     time.Duration
+		controller  string
+		crossAt     float32 // where the second aircraft is once past CAMRN
+		expected    string
+	}{
+		{name: "miles short", restriction: TrafficRestriction{Fix: "CAMRN", MilesInTrail: 10}, spacing: 5,
+			elapsed: time.Minute, expected: "CAMRN: 5.0 miles in trail behind AAL1, not 10 MIT"},
+		{name: "miles within tolerance", restriction: TrafficRestriction{Fix: "CAMRN", MilesInTrail: 10}, spacing: 9.5,
+			elapsed: 2 * time.Minute},
+		{name: "not human", restriction: TrafficRestriction{Fix: "CAMRN", MilesInTrail: 10}, spacing: 5,
+			elapsed: time.Minute, controller: "N56"},
+		{name: "other controller", restriction: TrafficRestriction{Fix: "CAMRN", MilesInTrail: 10, Controllers: []string{"2J"}},
+			spacing: 5, elapsed: time.Minute},
+		{name: "minutes short", restriction: TrafficRestriction{Fix: "CAMRN", MinutesInTrail: 2}, spacing: 5,
+			elapsed: time.Minute, expected: "CAMRN: 1.0 minutes in trail behind AAL1, not 2 MINIT"},
+		{name: "minutes within tolerance", restriction: TrafficRestriction{Fix: "CAMRN", MinutesInTrail: 2}, spacing: 5,
+			elapsed: 105 * time.Second},
+		{name: "didn't cross", restriction: TrafficRestriction{Fix: "CAMRN", MilesInTrail: 10}, spacing: 5,
+			elapsed: time.Minute, crossAt: 20},
+	} {
+		s := makeTMUTestSim(t)
+		s.addTrafficRestriction(test.restriction)
+		sub := s.eventStream.Subscribe()
+
+		lead := makeTMUTestAircraft(s, "AAL1", 1, 300, "KJFK")
+		cross(s, lead, 0)
+
+		s.State.SimTime = s.State.SimTime.Add(test.elapsed)
+		lead.Nav.FlightState.Position = tmuTestPoint(-test.spacing)
+		trail := makeTMUTestAircraft(s, "UAL2", 1, 300, "KJFK")
+		if test.controller != "" {
+			trail.ControllingController = test.controller
+		}
+		cross(s, trail, test.crossAt)
+
+		var msgs []string
+		for _, e := range sub.Get() {
+			if e.Type == TMIViolationEvent {
+				if e.Callsign != "UAL2" || e.ToController != "2K" {
+					t.Errorf("%s: unexpected event %s", test.name, e.String())
+				}
+				msgs = append(msgs, e.Message)
+			}
+		}
+		if test.expected == "" && len(msgs) > 0 {
+			t.Errorf("%s: got unexpected violations %v", test.name, msgs)
+		} else if test.expected != "" && (len(msgs) != 1 || msgs[0] != test.expected) {
+			t.Errorf("%s: got violations %q, expected %q", test.name, msgs, test.expected)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// pkg/sim/traffic.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/mmp/vice/pkg/math"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Traffic density can be changed over the course of a session by
+// scheduling changes to the departure and arrival rate scales, and quiet
+// periods can be skipped through by fast-forwarding the sim until one of
+// the human controllers has something to do.
+
+// RateChange is a scheduled change to the launch rate scales; the scales
+// are changed linearly from their values at Time to the given ones over
+// RampMinutes, which allows modeling a push building up or subsiding.
+type RateChange struct {
+	Time                 time.Time // sim time
+	RampMinutes          int
+	DepartureRateScale   float32
+	InboundFlowRateScale float32
+}
+
+// A fast-forward rate is only used after there has been nothing for the
+// human controllers to do for this long (in sim time), so that the sim
+// doesn't go back and forth between rates.
+const fastForwardQuietTime = 15 * time.Second
+
+func (s *Sim) SetFastForwardRate(tcp string, rate float32) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if rate != 0 && (rate < 2 || rate > 8) {
+		return ErrInvalidFastForwardRate
+	}
+	s.clock.SetFastForwardRate(rate)
+	s.lg.Infof("%s: fast-forward rate set to %f", tcp, rate)
+	return nil
+}
+
+// updateFastForward starts or stops fast-forwarding depending on whether
+// any aircraft need attention from a human controller. It returns true if
+// the rate at which the sim is running changed.
+func (s *Sim) updateFastForward() bool {
+	if s.State.FastForwardRate == 0 {
+		return false
+	}
+
+	callsign, reason := s.trafficNeedingAction()
+	if callsign != "" {
+		s.quietSince = time.Time{}
+		if s.State.FastForwarding {
+			s.clock.SetFastForwarding(false)
+			s.lg.Info("fast-forward ended", slog.String("callsign", callsign), slog.String("reason", reason))
+			s.eventStream.Post(Event{
+				Type:    StatusMessageEvent,
+				Message: "Returning to normal speed: " + callsign + " " + reason,
+			})
+			return true
+		}
+		return false
+	}
+
+	now := s.clock.Now()
+	if s.quietSince.IsZero() {
+		s.quietSince = now
+	}
+	if !s.State.FastForwarding && now.Sub(s.quietSince) >= fastForwardQuietTime {
+		s.clock.SetFastForwarding(true)
+		s.lg.Info("fast-forward started", slog.Float64("rate", float64(s.State.FastForwardRate)))
+		s.eventStream.Post(Event{
+			Type:    StatusMessageEvent,
+			Message: fmt.Sprintf("No traffic needs attention; fast-forwarding at %.0fx", s.State.FastForwardRate),
+		})
+		return true
+	}
+	return false
+}
+
+// trafficNeedingAction returns the callsign of an aircraft that one of
+// the human controllers needs to do something about, along with a short
+// description of why, or an empty string if there are none.
+func (s *Sim) trafficNeedingAction() (string, string) {
+	for _, em := range s.Emergencies {
+		if !em.Resolved {
+			return em.Callsign, "has an emergency"
+		}
+	}
+	for callsign, po := range s.PointOuts {
+		if s.isActiveHumanController(po.ToController) {
+			return callsign, "is being pointed out"
+		}
+	}
+
+	var callsign, reason string
+	for cs, ac := range s.State.Aircraft {
+		if ac.WaitingForLaunch || s.isExternalAircraft(cs) {
+			continue
+		}
+
+		r := ""
+		if ac.HoldForRelease && !ac.Released {
+			r = "is waiting for release"
+		} else if s.isActiveHumanController(ac.HandoffTrackController) {
+			r = "is being handed off"
+		} else if s.isActiveHumanController(ac.ControllingController) {
+			r = "is on frequency"
+		}
+		// Take the first alphabetically so that the message doesn't
+		// depend on map iteration order.
+		if r != "" && (callsign == "" || cs < callsign) {
+			callsign, reason = cs, r
+		}
+	}
+	return callsign, reason
+}
+
+// updateRateSchedule applies any scheduled rate changes; it's called once
+// a second.
+func (s *Sim) updateRateSchedule() {
+	lc := &s.State.LaunchConfig
+	now := s.clock.Now()
+
+	// Scheduled changes are applied in order; a change that is scheduled
+	// while an earlier one is still ramping waits for it to finish.
+	slices.SortStableFunc(lc.RateSchedule, func(a, b RateChange) int { return a.Time.Compare(b.Time) })
+	if len(lc.RateSchedule) == 0 || now.Before(lc.RateSchedule[0].Time) {
+		return
+	}
+
+	rc := lc.RateSchedule[0]
+	end := rc.Time.Add(time.Duration(rc.RampMinutes) * time.Minute)
+	dep, inbound := rc.DepartureRateScale, rc.InboundFlowRateScale
+	if remaining := end.Sub(now); remaining > time.Second {
+		// Move the remaining distance to the targets in proportion to the
+		// time remaining, which gives a linear ramp without needing to
+		// remember where it started.
+		t := float32(time.Second) / float32(remaining)
+		dep = math.Lerp(t, lc.DepartureRateScale, dep)
+		inbound = math.Lerp(t, lc.InboundFlowRateScale, inbound)
+	} else {
+		lc.RateSchedule = lc.RateSchedule[1:]
+		s.lg.Info("scheduled rate change done", slog.Float64("departure_scale", float64(dep)),
+			slog.Float64("inbound_scale", float64(inbound)))
+	}
+
+	s.setRateScales(dep, inbound)
+}
+
+// setRateScales updates the departure and inbound rate scales. Rather
+// than choosing new random launch times, as SetLaunchConfig does, the
+// time remaining until each next launch is scaled by the change in its
+// rate so that gradual changes don't keep postponing launches.
+func (s *Sim) setRateScales(dep, inbound float32) {
+	lc := &s.State.LaunchConfig
+
+	for _, ap := range util.SortedMapKeys(lc.DepartureRates) {
+		for _, rwy := range util.SortedMapKeys(lc.DepartureRates[ap]) {
+			ds, ok := s.DepartureState[ap][rwy]
+			if !ok {
+				continue
+			}
+			r := sumRateMap(lc.DepartureRates[ap][rwy], dep)
+			if r != ds.IFRSpawnRate {
+				ds.NextIFRSpawn = s.rescaleSpawnTime(ds.NextIFRSpawn, ds.IFRSpawnRate, r)
+				ds.IFRSpawnRate = r
+			}
+		}
+	}
+
+	for _, group := range util.SortedMapKeys(lc.InboundFlowRates) {
+		rates := s.inboundFlowRates(group)
+		oldSum := sumRateMap(rates, lc.InboundFlowRateScale)
+		newSum := sumRateMap(rates, inbound)
+		if newSum != oldSum {
+			s.NextInboundSpawn[group] = s.rescaleSpawnTime(s.NextInboundSpawn[group], oldSum, newSum)
+		}
+	}
+
+	lc.DepartureRateScale, lc.InboundFlowRateScale = dep, inbound
+}
+
+// rescaleSpawnTime returns the updated time of the next launch at t after
+// its rate changes from oldRate to newRate.
+func (s *Sim) rescaleSpawnTime(t time.Time, oldRate, newRate float32) time.Time {
+	now := s.clock.Now()
+	if !t.After(now) {
+		return t
+	} else if oldRate == 0 || newRate == 0 {
+		return now.Add(randomWait(&s.Rand, newRate, false))
+	}
+	return now.Add(time.Duration(float32(t.Sub(now)) * oldRate / newRate))
+}
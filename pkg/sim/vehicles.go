@@ -0,0 +1,235 @@
+// pkg/sim/vehicles.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Airport vehicles--operations trucks, follow-mes, and, in the winter,
+// snow plows--call ground asking to cross or to get onto the active
+// runways, at the rate given by LaunchConfig.VehicleRate. The tower lets
+// crossings go when there's no one close in on final. Inspections and
+// plowing take long enough that the tower first asks the TRACON for a gap
+// in the arrivals; the controller approves or denies the request, and
+// once it's approved, the vehicle goes onto the runway at the next gap.
+// Either way, the runway is occupied while the vehicle is on it, so
+// departures hold and arrivals that get too close go around.
+
+type SurfaceVehicleKind string
+
+const (
+	VehicleOps      SurfaceVehicleKind = "ops"
+	VehicleFollowMe SurfaceVehicleKind = "follow me"
+	VehiclePlow     SurfaceVehicleKind = "snow plow"
+)
+
+type SurfaceVehicleRequest string
+
+const (
+	VehicleCrossing   SurfaceVehicleRequest = "crossing"
+	VehicleInspection SurfaceVehicleRequest = "inspection"
+	VehiclePlowing    SurfaceVehicleRequest = "plowing"
+)
+
+type SurfaceVehicle struct {
+	Id       int
+	Callsign string // e.g., "OPS 2"
+	Kind     SurfaceVehicleKind
+	Request  SurfaceVehicleRequest
+	Airport  string
+	Runway   string
+	// How long it will be on the runway.
+	Duration time.Duration
+
+	Requested time.Time
+	// Approved is set once a controller has agreed to a gap in the
+	// arrivals for an inspection or plowing; crossings don't need it.
+	Approved bool
+	// Zero until the vehicle is on the runway, then the time it will be
+	// off of it.
+	ClearTime time.Time
+}
+
+const (
+	// Requests that the TRACON hasn't answered by then are withdrawn.
+	vehicleRequestTimeout = 5 * time.Minute
+	// Vehicles aren't let onto the runway for an inspection or plowing
+	// if there's an arrival within this distance.
+	vehicleArrivalClearance = 6 // nm
+)
+
+// NeedsApproval returns whether the TRACON must approve the request.
+func (v SurfaceVehicle) NeedsApproval() bool {
+	return v.Request != VehicleCrossing
+}
+
+// Pending returns whether the vehicle is waiting for the controller to
+// approve its request.
+func (v SurfaceVehicle) Pending() bool {
+	return v.NeedsApproval() && !v.Approved
+}
+
+func (v SurfaceVehicle) String() string {
+	switch v.Request {
+	case VehicleCrossing:
+		return fmt.Sprintf("%s crossing runway %s at %s", v.Callsign, v.Runway, v.Airport)
+	default:
+		return fmt.Sprintf("%s requests runway %s at %s for %s, about %d minutes", v.Callsign, v.Runway,
+			v.Airport, v.Request, int(v.Duration.Minutes()+0.5))
+	}
+}
+
+func (s *Sim) updateSurfaceVehicles() {
+	now := s.clock.Now()
+	if rate := s.State.LaunchConfig.VehicleRate; rate > 0 && !now.Before(s.NextVehicleSpawn) {
+		if !s.NextVehicleSpawn.IsZero() {
+			s.spawnSurfaceVehicle()
+		}
+		s.NextVehicleSpawn = now.Add(poissonWait(&s.Rand, rate))
+	}
+
+	s.State.SurfaceVehicles = slices.DeleteFunc(s.State.SurfaceVehicles, func(v SurfaceVehicle) bool {
+		if !v.ClearTime.IsZero() {
+			if now.Before(v.ClearTime) {
+				return false
+			}
+			if v.NeedsApproval() {
+				s.postTowerMessage(v.Airport, fmt.Sprintf("%s is off runway %s; runway %s is open", v.Callsign,
+					v.Runway, v.Runway))
+			}
+			return true
+		}
+
+		if v.Pending() {
+			if now.Sub(v.Requested) < vehicleRequestTimeout {
+				return false
+			}
+			s.postTowerMessage(v.Airport, v.Callsign+" will try runway "+v.Runway+" again later")
+			return true
+		}
+		return false
+	})
+
+	for i := range s.State.SurfaceVehicles {
+		v := &s.State.SurfaceVehicles[i]
+		if !v.ClearTime.IsZero() || v.Pending() || s.runwayOccupied(v.Airport, v.Runway) {
+			continue
+		}
+		clearance := util.Select(v.NeedsApproval(), float32(vehicleArrivalClearance), float32(runwayCrossingClearance))
+		if s.arrivalOnFinal(v.Airport, v.Runway, clearance) {
+			continue
+		}
+
+		v.ClearTime = now.Add(v.Duration)
+		s.occupyRunway(v.Airport, v.Runway, v.Duration)
+		s.lg.Info("vehicle on runway", slog.String("callsign", v.Callsign), slog.String("airport", v.Airport),
+			slog.String("runway", v.Runway), slog.String("request", string(v.Request)))
+		if v.NeedsApproval() {
+			s.postTowerMessage(v.Airport, fmt.Sprintf("%s is on runway %s for %s", v.Callsign, v.Runway, v.Request))
+		}
+	}
+}
+
+func (s *Sim) spawnSurfaceVehicle() {
+	type rwy struct{ airport, runway string }
+	var rwys []rwy
+	add := func(ap, r string) {
+		r = av.TidyRunway(r)
+		if !slices.Contains(rwys, rwy{ap, r}) && !s.State.RunwayClosed(ap, r) {
+			rwys = append(rwys, rwy{ap, r})
+		}
+	}
+	for _, r := range s.State.ArrivalRunways {
+		add(r.Airport, r.Runway)
+	}
+	for _, r := range s.State.DepartureRunways {
+		add(r.Airport, r.Runway)
+	}
+	if len(rwys) == 0 {
+		return
+	}
+	r := rand.SampleSliceWith(&s.Rand, rwys)
+
+	v := SurfaceVehicle{
+		Airport:   r.airport,
+		Runway:    r.runway,
+		Requested: s.clock.Now(),
+	}
+	for _, prev := range s.State.SurfaceVehicles {
+		v.Id = max(v.Id, prev.Id)
+	}
+	v.Id++
+
+	seconds := func(lo, hi int) time.Duration {
+		return time.Duration(lo+s.Rand.Intn(hi-lo)) * time.Second
+	}
+	winter := slices.Contains([]time.Month{time.December, time.January, time.February, time.March},
+		s.clock.Now().Month())
+	switch p := s.Rand.Float32(); {
+	case winter && p < .3:
+		v.Kind, v.Request, v.Duration = VehiclePlow, VehiclePlowing, seconds(8*60, 15*60)
+	case p < .55:
+		v.Kind, v.Request, v.Duration = VehicleOps, VehicleInspection, seconds(3*60, 6*60)
+	case p < .8:
+		v.Kind, v.Request, v.Duration = VehicleOps, VehicleCrossing, seconds(15, 40)
+	default:
+		v.Kind, v.Request, v.Duration = VehicleFollowMe, VehicleCrossing, seconds(15, 40)
+	}
+
+	prefix := map[SurfaceVehicleKind]string{VehicleOps: "OPS", VehicleFollowMe: "FOLLOW ME", VehiclePlow: "PLOW"}
+	v.Callsign = prefix[v.Kind] + " " + strconv.Itoa(1+s.Rand.Intn(9))
+
+	s.State.SurfaceVehicles = append(s.State.SurfaceVehicles, v)
+	s.lg.Info("vehicle request", slog.String("callsign", v.Callsign), slog.String("airport", v.Airport),
+		slog.String("runway", v.Runway), slog.String("request", string(v.Request)))
+	if v.NeedsApproval() {
+		s.postTowerMessage(v.Airport, v.String())
+	}
+}
+
+// postTowerMessage posts a message from the tower at the airport to the
+// human controllers.
+func (s *Sim) postTowerMessage(airport, msg string) {
+	s.eventStream.Post(Event{
+		Type:    StatusMessageEvent,
+		Message: airport + " tower: " + msg,
+	})
+}
+
+// RespondToVehicleRequest approves or denies a vehicle's request for a
+// gap in the arrivals.
+func (s *Sim) RespondToVehicleRequest(tcp string, id int, approve bool) error {
+	s.mu.Lock(s.lg)
+	defer s.mu.Unlock(s.lg)
+
+	if !s.isActiveHumanController(tcp) {
+		return av.ErrNoController
+	}
+	idx := slices.IndexFunc(s.State.SurfaceVehicles, func(v SurfaceVehicle) bool { return v.Id == id && v.Pending() })
+	if idx == -1 {
+		return ErrNoVehicleRequest
+	}
+
+	v := &s.State.SurfaceVehicles[idx]
+	if approve {
+		v.Approved = true
+		s.postTowerMessage(v.Airport, fmt.Sprintf("%s approved for %s on runway %s by %s", v.Callsign, v.Request,
+			v.Runway, tcp))
+	} else {
+		s.postTowerMessage(v.Airport, fmt.Sprintf("%s %s on runway %s denied by %s", v.Callsign, v.Request,
+			v.Runway, tcp))
+		s.State.SurfaceVehicles = slices.Delete(s.State.SurfaceVehicles, idx, idx+1)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// pkg/sim/virtualhandoff.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// Virtual controllers accept handoffs after a human-like delay. Scenarios
+// may make them less cooperative: depending on the difficulty, handoffs
+// from human controllers are sometimes accepted late or missed entirely
+// (in which case the handoff must be offered again), and handoffs of
+// aircraft whose clearances are inconsistent with an LOA may be refused,
+// which posts a RejectedHandoffEvent explaining why.
+
+// VirtualHandoffConfig specifies how virtual controllers respond to
+// handoffs.
+type VirtualHandoffConfig struct {
+	// Range of delays before a handoff is accepted, in seconds.
+	AcceptDelay [2]int `json:"accept_delay,omitempty"`
+	// Between 0 and 1; higher values make late and missed handoffs more
+	// likely.
+	Difficulty float32 `json:"difficulty,omitempty"`
+	// If set, handoffs of aircraft with clearances that don't meet an
+	// LOA are refused.
+	RefuseLOAViolations bool `json:"refuse_loa_violations,omitempty"`
+}
+
+var defaultHandoffAcceptDelay = [2]int{4, 13}
+
+const (
+	// At the maximum difficulty, the fraction of handoffs from human
+	// controllers that are missed and the fraction that are accepted
+	// late.
+	maxMissedHandoffFraction  = 0.2
+	maxDelayedHandoffFraction = 0.4
+)
+
+func (c VirtualHandoffConfig) Validate() error {
+	if c.AcceptDelay != [2]int{} && (c.AcceptDelay[0] < 0 || c.AcceptDelay[0] > c.AcceptDelay[1]) {
+		return fmt.Errorf("\"accept_delay\" range %d-%d is invalid", c.AcceptDelay[0], c.AcceptDelay[1])
+	}
+	if c.Difficulty < 0 || c.Difficulty > 1 {
+		return fmt.Errorf("\"difficulty\" %f must be between 0 and 1", c.Difficulty)
+	}
+	return nil
+}
+
+// makeVirtualHandoff returns the Handoff for a handoff from the given
+// controller to a virtual controller.
+func (s *Sim) makeVirtualHandoff(fromTCP string) Handoff {
+	cfg := s.VirtualHandoffs
+	delay := util.Select(cfg.AcceptDelay == [2]int{}, defaultHandoffAcceptDelay, cfg.AcceptDelay)
+	acceptDelay := delay[0] + s.Rand.Intn(delay[1]-delay[0]+1)
+
+	if cfg.Difficulty > 0 && s.isActiveHumanController(fromTCP) {
+		r := s.Rand.Float32()
+		if r < cfg.Difficulty*maxMissedHandoffFraction {
+			return Handoff{Missed: true}
+		} else if r < cfg.Difficulty*(maxMissedHandoffFraction+maxDelayedHandoffFraction) {
+			acceptDelay += 30 + s.Rand.Intn(60)
+		}
+	}
+
+	return Handoff{Time: s.State.SimTime.Add(time.Duration(acceptDelay) * time.Second)}
+}
+
+// updateVirtualHandoffs accepts or refuses the handoffs to virtual
+// controllers whose time has come.
+func (s *Sim) updateVirtualHandoffs() {
+	now := s.State.SimTime
+
+	for _, callsign := range util.SortedMapKeys(s.Handoffs) {
+		ho := s.Handoffs[callsign]
+		ac, ok := s.State.Aircraft[callsign]
+		if !ok || ac.HandoffTrackController == "" {
+			delete(s.Handoffs, callsign)
+			continue
+		}
+		if ho.Missed || !now.After(ho.Time) {
+			continue
+		}
+
+		if !s.isActiveHumanController(ac.HandoffTrackController) && !s.prespawn {
+			if reason := s.handoffRefusal(ac); reason != "" {
+				s.refuseHandoff(ac, reason)
+			} else {
+				s.acceptVirtualHandoff(ac, ho)
+			}
+		}
+		delete(s.Handoffs, callsign)
+	}
+}
+
+// handoffRefusal returns the reason that the receiving virtual controller
+// won't accept the aircraft's handoff, if there is one.
+func (s *Sim) handoffRefusal(ac *av.Aircraft) string {
+	if !s.VirtualHandoffs.RefuseLOAViolations || !s.isActiveHumanController(ac.TrackingController) {
+		return ""
+	}
+
+	var problems []string
+	for _, l := range s.LOAs {
+		if l.appliesTo(ac) && (len(l.Controllers) == 0 || slices.Contains(l.Controllers, ac.TrackingController)) {
+			if p := s.loaClearanceProblem(l, ac); p != "" {
+				problems = append(problems, p+" at "+l.Fix)
+			}
+		}
+	}
+	return strings.Join(problems, "; ")
+}
+
+func (s *Sim) acceptVirtualHandoff(ac *av.Aircraft, ho Handoff) {
+	s.eventStream.Post(Event{
+		Type:           AcceptedHandoffEvent,
+		FromController: ac.TrackingController,
+		ToController:   ac.HandoffTrackController,
+		Callsign:       ac.Callsign,
+	})
+	s.lg.Info("automatic handoff accept", slog.String("callsign", ac.Callsign),
+		slog.String("from", ac.TrackingController),
+		slog.String("to", ac.HandoffTrackController))
+
+	if s.isRemoteController(ac.TrackingController) {
+		s.acceptFederatedHandoff(ac, ac.HandoffTrackController)
+	}
+
+	_, receivingSTARS, err := s.State.ERAMComputers.FacilityComputers(ho.ReceivingFacility)
+	if err != nil {
+		//s.lg.Errorf("%s: FacilityComputers(): %v", ho.ReceivingFacility, err)
+	} else if err := s.State.STARSComputer().AutomatedAcceptHandoff(ac, ac.HandoffTrackController,
+		receivingSTARS, s.State.Controllers, s.State.SimTime); err != nil {
+		//s.lg.Errorf("AutomatedAcceptHandoff: %v", err)
+	}
+
+	ac.TrackingController = ac.HandoffTrackController
+	ac.HandoffTrackController = ""
+}
+
+// refuseHandoff has the receiving virtual controller refuse the
+// aircraft's handoff; the track stays with the offering controller.
+func (s *Sim) refuseHandoff(ac *av.Aircraft, reason string) {
+	s.eventStream.Post(Event{
+		Type:           RejectedHandoffEvent,
+		FromController: ac.HandoffTrackController,
+		ToController:   ac.TrackingController,
+		Callsign:       ac.Callsign,
+		Message:        reason,
+	})
+	s.lg.Info("automatic handoff refusal", slog.String("callsign", ac.Callsign),
+		slog.String("from", ac.TrackingController),
+		slog.String("to", ac.HandoffTrackController), slog.String("reason", reason))
+
+	if ctrl, ok := s.State.Controllers[ac.TrackingController]; ok {
+		if err := s.State.STARSComputer().CancelHandoff(ac, ctrl, s.State.Controllers, s.State.SimTime); err != nil {
+			//s.lg.Errorf("CancelHandoff: %v", err)
+		}
+	}
+	ac.HandoffTrackController = ""
+	ac.RedirectedHandoff = av.RedirectedHandoff{}
+}
@@ -0,0 +1,63 @@
+// pkg/sim/virtualhandoff_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmp/vice/pkg/rand"
+)
+
+func TestVirtualHandoffConfigValidate(t *testing.T) {
+	for _, c := range []VirtualHandoffConfig{{}, {AcceptDelay: [2]int{0, 0}, Difficulty: 1}, {AcceptDelay: [2]int{2, 5}}} {
+		if err := c.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", c, err)
+		}
+	}
+	for _, c := range []VirtualHandoffConfig{{AcceptDelay: [2]int{10, 5}}, {AcceptDelay: [2]int{-1, 5}}, {Difficulty: 1.5}} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", c)
+		}
+	}
+}
+
+func TestMakeVirtualHandoff(t *testing.T) {
+	start := time.Date(2024, 6, 1, 15, 4, 0, 0, time.UTC)
+	s := &Sim{
+		State:            &State{SimTime: start},
+		humanControllers: map[string]*EventsSubscription{"2K": nil},
+		Rand:             rand.New(),
+	}
+	s.Rand.Seed(1)
+
+	// count returns the number of missed and late handoffs out of n.
+	count := func(from string, n int) (missed, late int) {
+		for range n {
+			ho := s.makeVirtualHandoff(from)
+			if ho.Missed {
+				missed++
+			} else if d := ho.Time.Sub(start); d > 13*time.Second {
+				late++
+			} else if d < 4*time.Second {
+				t.Errorf("%s: accept delay %s less than the minimum", from, d)
+			}
+		}
+		return
+	}
+
+	if missed, late := count("2K", 1000); missed != 0 || late != 0 {
+		t.Errorf("default config: %d missed, %d late; expected none", missed, late)
+	}
+
+	s.VirtualHandoffs = VirtualHandoffConfig{Difficulty: 1}
+	if missed, late := count("2K", 1000); missed < 150 || missed > 250 || late < 340 || late > 460 {
+		t.Errorf("difficulty 1: %d missed, %d late out of 1000", missed, late)
+	}
+	// Handoffs between virtual controllers are unaffected.
+	if missed, late := count("N4P", 1000); missed != 0 || late != 0 {
+		t.Errorf("virtual controller: %d missed, %d late; expected none", missed, late)
+	}
+}
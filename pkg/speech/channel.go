@@ -0,0 +1,176 @@
+// pkg/speech/channel.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package speech
+
+import (
+	gomath "math"
+	"sync"
+	"time"
+
+	"github.com/mmp/vice/pkg/log"
+	"github.com/mmp/vice/pkg/rand"
+)
+
+// RadioChannel models a single radio frequency: only one transmission
+// can be heard clearly at a time. Transmissions that are made while the
+// frequency is in use normally wait until it is clear, but with some
+// probability one steps on the other; in that case the overlapping part
+// is garbled by the heterodyne that results when two transmitters are
+// keyed at once.
+type RadioChannel struct {
+	// Gap is the pause between successive transmissions.
+	Gap time.Duration
+
+	mu        sync.Mutex
+	stepOn    float32
+	r         rand.Rand
+	busyUntil time.Time
+}
+
+// Transmission is the result of making a transmission on a RadioChannel.
+type Transmission struct {
+	// Delay is how long to wait before playing the audio.
+	Delay time.Duration
+	// PCM is the audio to play; if the transmission was blocked, it
+	// includes the heterodyne.
+	PCM []byte
+	// Blocked indicates that the transmission stepped on another one.
+	Blocked bool
+}
+
+// NewRadioChannel returns a RadioChannel where transmissions that are
+// made while the frequency is busy step on the one in progress with the
+// given probability.
+func NewRadioChannel(stepOnProbability float32, seed uint64) *RadioChannel {
+	rc := &RadioChannel{
+		Gap:    500 * time.Millisecond,
+		stepOn: stepOnProbability,
+		r:      rand.New(),
+	}
+	rc.r.Seed(seed)
+	return rc
+}
+
+func (rc *RadioChannel) SetStepOnProbability(p float32) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.stepOn = p
+}
+
+func pcmDuration(pcm []byte) time.Duration {
+	return time.Duration(len(pcm)/2) * time.Second / SampleRate
+}
+
+// Transmit schedules the given audio for transmission at time now and
+// returns when and what should be played.
+func (rc *RadioChannel) Transmit(now time.Time, pcm []byte) Transmission {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	dur := pcmDuration(pcm)
+	if !now.Before(rc.busyUntil) {
+		// The frequency is clear.
+		rc.busyUntil = now.Add(dur + rc.Gap)
+		return Transmission{PCM: pcm}
+	}
+
+	if rc.r.Float32() >= rc.stepOn {
+		// Wait for it to be clear.
+		delay := rc.busyUntil.Sub(now)
+		rc.busyUntil = rc.busyUntil.Add(dur + rc.Gap)
+		return Transmission{Delay: delay, PCM: pcm}
+	}
+
+	// Stepped on: both are heard garbled for as long as they overlap.
+	overlap := rc.busyUntil.Add(-rc.Gap).Sub(now)
+	if end := now.Add(dur + rc.Gap); end.After(rc.busyUntil) {
+		rc.busyUntil = end
+	}
+	return Transmission{PCM: heterodyne(pcm, overlap), Blocked: true}
+}
+
+// heterodyne returns a copy of the audio where the given initial
+// duration is attenuated and mixed with the squeal heard when two
+// transmitters are keyed simultaneously.
+func heterodyne(pcm []byte, overlap time.Duration) []byte {
+	samples := decodePCM(pcm)
+	n := min(len(samples), int(overlap*SampleRate/time.Second))
+	for i := 0; i < n; i++ {
+		t := float64(i) / SampleRate
+		// The beat frequency of two slightly-offset carriers wanders a
+		// bit; add a slow wobble to the squeal.
+		f := 1800 + 150*gomath.Sin(2*gomath.Pi*3*t)
+		squeal := 9000 * gomath.Sin(2*gomath.Pi*f*t)
+		v := 0.4*float64(samples[i]) + squeal
+		samples[i] = int16(max(-32768, min(32767, v)))
+	}
+	return encodePCM(samples)
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Speaker
+
+// Speaker speaks pilot transmissions: each is synthesized with the
+// pilot's voice and then transmitted on a RadioChannel. Synthesis happens
+// asynchronously; the given play function is called with the audio when
+// it should be played.
+type Speaker struct {
+	backend  Backend
+	channel  *RadioChannel
+	baseRate int
+	play     func(pcm []byte)
+	lg       *log.Logger
+	requests chan speakRequest
+}
+
+type speakRequest struct {
+	callsign, text string
+}
+
+func NewSpeaker(b Backend, channel *RadioChannel, baseRate int, play func(pcm []byte), lg *log.Logger) *Speaker {
+	s := &Speaker{
+		backend:  b,
+		channel:  channel,
+		baseRate: baseRate,
+		play:     play,
+		lg:       lg,
+		requests: make(chan speakRequest, 32),
+	}
+	go s.run()
+	return s
+}
+
+// Say speaks the given text, which should be in the form it is
+// displayed, in the voice of the given aircraft's pilot. If too many
+// transmissions are already pending, it is dropped.
+func (s *Speaker) Say(callsign, text string) {
+	select {
+	case s.requests <- speakRequest{callsign: callsign, text: text}:
+	default:
+		s.lg.Warnf("%s: speech queue full; dropping transmission", callsign)
+	}
+}
+
+func (s *Speaker) run() {
+	for req := range s.requests {
+		voice := VoiceFor(req.callsign, s.backend.Voices(), s.baseRate)
+		pcm, err := s.backend.Synthesize(SpokenText(req.text), voice)
+		if err != nil {
+			s.lg.Warnf("%s: %v", req.callsign, err)
+			continue
+		}
+
+		tr := s.channel.Transmit(time.Now(), pcm)
+		if tr.Blocked {
+			s.lg.Infof("%s: transmission blocked", req.callsign)
+		}
+		if tr.Delay > 0 {
+			time.AfterFunc(tr.Delay, func() { s.play(tr.PCM) })
+		} else {
+			s.play(tr.PCM)
+		}
+	}
+}
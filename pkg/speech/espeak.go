@@ -0,0 +1,66 @@
+// pkg/speech/espeak.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package speech
+
+import (
+	"bytes"
+	"os/exec"
+	"strconv"
+)
+
+// espeakVoices are the English variants that are used for pilots; they
+// give a mix of accents.
+var espeakVoices = []string{"en-us", "en-gb", "en-gb-scotland", "en-gb-x-rp", "en-029", "en-us+m3", "en-us+f2"}
+
+// espeakBackend synthesizes speech by running espeak-ng (or espeak) and
+// reading the WAV file it writes to stdout.
+type espeakBackend struct {
+	path string
+}
+
+func init() {
+	RegisterBackend("espeak", newEspeakBackend)
+}
+
+func newEspeakBackend() (Backend, error) {
+	for _, cmd := range []string{"espeak-ng", "espeak"} {
+		if path, err := exec.LookPath(cmd); err == nil {
+			return &espeakBackend{path: path}, nil
+		}
+	}
+	return nil, ErrNoBackend
+}
+
+func (e *espeakBackend) Voices() []string {
+	return espeakVoices
+}
+
+func (e *espeakBackend) Synthesize(text string, v Voice) ([]byte, error) {
+	if text == "" {
+		return nil, ErrNothingToSpeak
+	}
+
+	args := []string{"--stdout"}
+	if v.Name != "" {
+		args = append(args, "-v", v.Name)
+	}
+	if v.Rate > 0 {
+		args = append(args, "-s", strconv.Itoa(v.Rate))
+	}
+	args = append(args, "-p", strconv.Itoa(v.Pitch), text)
+
+	cmd := exec.Command(e.path, args...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, ErrSynthesisFailed
+	}
+
+	samples, rate, err := decodeWAV(stdout.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return encodePCM(resample(samples, rate)), nil
+}
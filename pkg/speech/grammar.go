@@ -0,0 +1,556 @@
+// pkg/speech/grammar.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package speech
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Spoken clearances are converted to the aircraft command syntax used by
+// RunAircraftCommands (e.g., "L270 D50") by matching the transcript
+// against a small grammar of standard phraseology. The grammar is
+// constrained by what's plausible for each aircraft--only its arrival
+// airport's approaches, the fixes on its route, and climbs and descents
+// relative to its current altitude are accepted--so that recognition
+// errors are more likely to be rejected than to turn into the wrong
+// instruction.
+
+// AircraftGrammar describes an aircraft that may be addressed and the
+// instructions that are plausible for it.
+type AircraftGrammar struct {
+	// Callsign is the ICAO callsign, e.g. "AAL123" or "N123AB".
+	Callsign string
+	// Telephony is the airline's radio telephony, e.g. "American"; it is
+	// empty for general aviation aircraft and if unknown.
+	Telephony string
+	// Altitude is the aircraft's current altitude, in feet.
+	Altitude float32
+	// Approaches maps from approach ids (as used in commands) to their
+	// full names (e.g., "ILS Runway 22L").
+	Approaches map[string]string
+	// Fixes are the fixes that the aircraft may be sent direct to.
+	Fixes []string
+}
+
+// Clearance is the result of parsing a spoken clearance.
+type Clearance struct {
+	Callsign string
+	// Commands are in the syntax used by RunAircraftCommands.
+	Commands []string
+	// Transcript is the text that was parsed.
+	Transcript string
+	// Nonstandard describes deviations from standard phraseology; see
+	// phraseology.go.
+	Nonstandard []string
+}
+
+func (c Clearance) String() string {
+	return c.Callsign + " " + strings.Join(c.Commands, " ")
+}
+
+var phoneticLetters = map[string]string{
+	"alpha": "a", "alfa": "a", "bravo": "b", "charlie": "c", "delta": "d", "echo": "e", "foxtrot": "f",
+	"golf": "g", "hotel": "h", "india": "i", "juliet": "j", "juliett": "j", "kilo": "k", "lima": "l",
+	"mike": "m", "oscar": "o", "papa": "p", "quebec": "q", "romeo": "r", "sierra": "s",
+	"tango": "t", "uniform": "u", "victor": "v", "whiskey": "w", "xray": "x", "yankee": "y", "zulu": "z",
+}
+
+var numberWords = map[string]string{
+	"zero": "0", "oh": "0", "one": "1", "won": "1", "two": "2", "three": "3", "tree": "3",
+	"four": "4", "five": "5", "fife": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+	"niner": "9",
+}
+
+// tokenize converts text to a canonical sequence of lowercase tokens:
+// number words become digits and successive digits are merged into a
+// single number, "5,000" becomes "5000", successive single letters are
+// merged into a word ("i l s" is "ils"), and a runway suffix following a
+// number is spelled out ("22l" is "22 left").
+func tokenize(text string) []string {
+	text = strings.ToLower(text)
+	// Remove thousands separators before splitting on punctuation.
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == ',' && i > 0 && i+1 < len(text) && isDigit(text[i-1]) && isDigit(text[i+1]) {
+			continue
+		}
+		sb.WriteByte(text[i])
+	}
+
+	fields := strings.FieldsFunc(sb.String(), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9')
+	})
+
+	var toks []string
+	for _, f := range fields {
+		if d, ok := numberWords[f]; ok {
+			f = d
+		} else if l, ok := phoneticLetters[f]; ok {
+			f = l
+		}
+
+		// Split things like "22l", "fl230", and "n123ab" into runs of
+		// letters and digits.
+		for len(f) > 0 {
+			n := 1
+			for n < len(f) && isDigit(f[n]) == isDigit(f[0]) {
+				n++
+			}
+			toks = append(toks, f[:n])
+			f = f[n:]
+		}
+	}
+
+	var merged []string
+	for i, t := range toks {
+		n := len(merged)
+		if n > 0 && allDigits(t) && allDigits(merged[n-1]) {
+			merged[n-1] += t
+		} else if n > 0 && len(t) == 1 && !allDigits(t) && (len(toks[i-1]) == 1 && !allDigits(toks[i-1])) {
+			merged[n-1] += t
+		} else {
+			merged = append(merged, t)
+		}
+	}
+
+	for i := 1; i < len(merged); i++ {
+		if allDigits(merged[i-1]) {
+			switch merged[i] {
+			case "l":
+				merged[i] = "left"
+			case "r":
+				merged[i] = "right"
+			case "c":
+				merged[i] = "center"
+			}
+		}
+	}
+	return merged
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+// callsignTokens returns the tokens that the aircraft's callsign is
+// spoken as.
+func (ag AircraftGrammar) callsignTokens() [][]string {
+	cs := strings.ToLower(ag.Callsign)
+	i := strings.IndexAny(cs, "0123456789")
+	if i == -1 {
+		return [][]string{tokenize(spaced(cs))}
+	}
+
+	var variants [][]string
+	if strings.HasPrefix(cs, "n") && i == 1 {
+		// General aviation: "November 1 2 3 alpha bravo"
+		variants = append(variants, tokenize("november "+spaced(cs[1:])))
+	}
+	if ag.Telephony != "" {
+		variants = append(variants, tokenize(ag.Telephony+" "+spaced(cs[i:])))
+	}
+	// The ICAO code spelled out.
+	variants = append(variants, tokenize(spaced(cs)))
+	return variants
+}
+
+func spaced(s string) string {
+	return strings.Join(strings.Split(s, ""), " ")
+}
+
+func hasPrefix(toks, prefix []string) bool {
+	return len(prefix) > 0 && len(toks) >= len(prefix) && slices.Equal(toks[:len(prefix)], prefix)
+}
+
+func hasSuffix(toks, suffix []string) bool {
+	return len(suffix) > 0 && len(toks) >= len(suffix) && slices.Equal(toks[len(toks)-len(suffix):], suffix)
+}
+
+// ParseClearance parses the transcript of a spoken clearance. The
+// transcript must start with the callsign of one of the given aircraft;
+// the remainder is parsed into commands subject to the constraints for
+// that aircraft.
+func ParseClearance(transcript string, aircraft []AircraftGrammar) (Clearance, error) {
+	toks := tokenize(transcript)
+	c := Clearance{Transcript: transcript}
+
+	// Find the aircraft, preferring the longest match.
+	var ag *AircraftGrammar
+	n := 0
+	for i := range aircraft {
+		for _, cs := range aircraft[i].callsignTokens() {
+			if hasPrefix(toks, cs) && len(cs) > n {
+				ag, n = &aircraft[i], len(cs)
+			}
+		}
+	}
+	var p clearanceParser
+	if ag != nil {
+		toks = toks[n:]
+	} else {
+		// Accept the callsign at the end, though it's not standard.
+		for i := range aircraft {
+			for _, cs := range aircraft[i].callsignTokens() {
+				if hasSuffix(toks, cs) && len(cs) > n {
+					ag, n = &aircraft[i], len(cs)
+				}
+			}
+		}
+		if ag == nil {
+			return c, ErrUnknownCallsign
+		}
+		toks = toks[:len(toks)-n]
+		p.flag("the callsign should come first")
+	}
+	c.Callsign = ag.Callsign
+
+	p.ag, p.toks = ag, toks
+	for !p.done() {
+		cmd, err := p.parsePhrase()
+		if err != nil {
+			return c, err
+		}
+		if cmd != "" {
+			c.Commands = append(c.Commands, cmd)
+		}
+	}
+	if len(c.Commands) == 0 {
+		return c, ErrNoInstructions
+	}
+	p.checkAltimeter()
+	c.Nonstandard = p.nonstandard
+	return c, nil
+}
+
+type clearanceParser struct {
+	ag   *AircraftGrammar
+	toks []string
+
+	// Phraseology checks; see phraseology.go.
+	nonstandard     []string
+	belowFL180      bool // descended below FL180 from above
+	issuedAltimeter bool
+}
+
+func (p *clearanceParser) done() bool {
+	return len(p.toks) == 0
+}
+
+func (p *clearanceParser) peek() string {
+	if len(p.toks) == 0 {
+		return ""
+	}
+	return p.toks[0]
+}
+
+func (p *clearanceParser) next() string {
+	t := p.peek()
+	if len(p.toks) > 0 {
+		p.toks = p.toks[1:]
+	}
+	return t
+}
+
+// accept consumes the given sequence of tokens if they are next.
+func (p *clearanceParser) accept(words ...string) bool {
+	if hasPrefix(p.toks, words) {
+		p.toks = p.toks[len(words):]
+		return true
+	}
+	return false
+}
+
+// skip consumes any of the given words.
+func (p *clearanceParser) skip(words ...string) {
+	for slices.Contains(words, p.peek()) {
+		p.next()
+	}
+}
+
+func (p *clearanceParser) number() (int, bool) {
+	if !allDigits(p.peek()) {
+		return 0, false
+	}
+	v, err := strconv.Atoi(p.next())
+	return v, err == nil
+}
+
+func (p *clearanceParser) heading() (int, error) {
+	if hdg, ok := p.number(); !ok || hdg < 1 || hdg > 360 {
+		return 0, ErrInvalidHeading
+	} else {
+		return hdg, nil
+	}
+}
+
+// altitude parses an altitude and returns it in hundreds of feet.
+func (p *clearanceParser) altitude() (int, error) {
+	var alt int
+	fl := p.accept("flight", "level") || p.accept("fl")
+	if fl {
+		v, ok := p.number()
+		if !ok {
+			return 0, ErrInvalidAltitude
+		}
+		alt = v * 100
+	} else if v, ok := p.number(); !ok {
+		return 0, ErrInvalidAltitude
+	} else if p.accept("thousand") {
+		alt = v * 1000
+		if h, ok := p.number(); ok {
+			if !p.accept("hundred") {
+				return 0, ErrInvalidAltitude
+			}
+			alt += h * 100
+		}
+	} else if p.accept("hundred") {
+		alt = v * 100
+	} else {
+		alt = v
+	}
+	p.skip("feet")
+
+	if alt < 1000 || alt > 60000 || alt%100 != 0 {
+		return 0, ErrInvalidAltitude
+	}
+	if alt >= 18000 && !fl {
+		p.flag("altitudes at or above 18,000 are given as flight levels")
+	} else if alt < 18000 && fl {
+		p.flag("altitudes below 18,000 are given in feet, not as flight levels")
+	}
+	return alt / 100, nil
+}
+
+func (p *clearanceParser) speed() (int, error) {
+	if kts, ok := p.number(); !ok || kts < 100 || kts > 400 {
+		return 0, ErrInvalidSpeed
+	} else {
+		p.skip("knots", "or", "greater", "less")
+		return kts, nil
+	}
+}
+
+// approach parses an approach name up to "approach" and returns its id.
+// The spoken name may omit words of the full name (e.g., "runway") as
+// long as it identifies a single approach.
+func (p *clearanceParser) approach() (string, error) {
+	end := slices.Index(p.toks, "approach")
+	if end == -1 {
+		end = len(p.toks)
+	}
+	spoken := p.toks[:end]
+	p.toks = p.toks[min(end+1, len(p.toks)):]
+
+	isSubsequence := func(s, full []string) bool {
+		i := 0
+		for _, t := range full {
+			if i < len(s) && s[i] == t {
+				i++
+			}
+		}
+		return i == len(s)
+	}
+
+	var matches []string
+	for id, name := range p.ag.Approaches {
+		full := tokenize(name)
+		if slices.Equal(spoken, full) {
+			return id, nil
+		} else if len(spoken) > 0 && isSubsequence(spoken, full) {
+			matches = append(matches, id)
+		}
+	}
+	if len(matches) != 1 {
+		return "", ErrUnknownApproach
+	}
+	return matches[0], nil
+}
+
+func (p *clearanceParser) fix() (string, error) {
+	spoken := p.next()
+	for _, fix := range p.ag.Fixes {
+		if strings.EqualFold(fix, spoken) {
+			return fix, nil
+		}
+	}
+	return "", ErrUnknownFix
+}
+
+// parsePhrase parses a single instruction and returns the corresponding
+// command. An empty command is returned for filler words.
+func (p *clearanceParser) parsePhrase() (string, error) {
+	switch {
+	case p.accept("and") || p.accept("then") || p.accept("now") || p.accept("heavy") || p.accept("super"):
+		return "", nil
+	case p.accept("altimeter"):
+		if a := p.next(); len(a) != 4 || !allDigits(a) {
+			return "", ErrInvalidAltimeter
+		}
+		p.issuedAltimeter = true
+		return "", nil
+
+	case p.accept("turn", "left"):
+		return p.turn("L")
+	case p.accept("left"):
+		p.flag(`"turn left", not "left"`)
+		return p.turn("L")
+	case p.accept("turn", "right"):
+		return p.turn("R")
+	case p.accept("right"):
+		p.flag(`"turn right", not "right"`)
+		return p.turn("R")
+	case p.accept("fly", "present", "heading"):
+		return "H", nil
+	case p.accept("present", "heading"):
+		p.flag(`"fly present heading", not "present heading"`)
+		return "H", nil
+	case p.accept("fly", "heading"):
+		hdg, err := p.heading()
+		return fmt.Sprintf("H%03d", hdg), err
+	case p.accept("heading"):
+		p.flag(`"fly heading", not "heading"`)
+		hdg, err := p.heading()
+		return fmt.Sprintf("H%03d", hdg), err
+
+	case p.accept("climb", "via", "sid") || p.accept("climb", "via", "the", "sid"):
+		return "CVS", nil
+	case p.accept("descend", "via"):
+		// The STAR's name follows.
+		for !p.done() && p.peek() != "and" {
+			p.next()
+		}
+		return "DVS", nil
+	case p.accept("climb"):
+		if !p.accept("and", "maintain") {
+			p.flag(`"climb and maintain"`)
+			p.skip("and", "maintain", "to")
+		}
+		alt, err := p.altitude()
+		if err == nil && float32(alt*100) <= p.ag.Altitude {
+			err = ErrImplausibleInstruction
+		}
+		return "C" + strconv.Itoa(alt), err
+	case p.accept("descend"):
+		if !p.accept("and", "maintain") {
+			p.flag(`"descend and maintain"`)
+			p.skip("and", "maintain", "to")
+		}
+		alt, err := p.altitude()
+		if err == nil && float32(alt*100) >= p.ag.Altitude {
+			err = ErrImplausibleInstruction
+		}
+		if err == nil && alt < 180 && p.ag.Altitude >= 18000 {
+			p.belowFL180 = true
+		}
+		return "D" + strconv.Itoa(alt), err
+
+	case p.accept("expedite"):
+		p.skip("your", "the")
+		if p.accept("climb") {
+			return "EC", nil
+		} else if p.accept("descent") {
+			return "ED", nil
+		}
+		return "", ErrUnrecognizedPhrase
+
+	case p.accept("maintain", "slowest", "practical", "speed"):
+		return "SMIN", nil
+	case p.accept("maintain", "maximum", "forward", "speed"):
+		return "SMAX", nil
+	case p.accept("resume", "normal", "speed") || p.accept("cancel", "speed", "restrictions"):
+		return "S", nil
+	case p.accept("maintain"):
+		// Either a speed or an altitude.
+		if len(p.toks) > 1 && allDigits(p.toks[0]) && p.toks[1] == "knots" {
+			kts, err := p.speed()
+			return "S" + strconv.Itoa(kts), err
+		}
+		alt, err := p.altitude()
+		return "A" + strconv.Itoa(alt), err
+	case p.accept("reduce") || p.accept("increase"):
+		if !p.accept("speed", "to") {
+			p.flag(`"reduce speed to" or "increase speed to"`)
+			p.skip("speed", "to")
+		}
+		kts, err := p.speed()
+		return "S" + strconv.Itoa(kts), err
+	case p.accept("slow") || p.accept("speed"):
+		p.flag(`"reduce speed to" or "increase speed to"`)
+		p.skip("speed", "to", "up")
+		kts, err := p.speed()
+		return "S" + strconv.Itoa(kts), err
+
+	case p.accept("cancel", "approach", "clearance"):
+		return "CAC", nil
+	case p.accept("cleared", "straight", "in"):
+		p.checkApproachName()
+		ap, err := p.approach()
+		return "CSI" + ap, err
+	case p.accept("cleared", "direct") || p.accept("proceed", "direct"):
+		fix, err := p.fix()
+		return "D" + fix, err
+	case p.accept("direct"):
+		p.flag(`"proceed direct" or "cleared direct", not "direct"`)
+		fix, err := p.fix()
+		return "D" + fix, err
+	case p.accept("cleared"):
+		p.skip("for", "the")
+		p.checkApproachName()
+		ap, err := p.approach()
+		return "C" + ap, err
+	case p.accept("expect"):
+		p.skip("the")
+		ap, err := p.approach()
+		return "E" + ap, err
+	case p.accept("intercept"):
+		p.skip("the")
+		if p.accept("localizer") {
+			return "I", nil
+		}
+		return "", ErrUnrecognizedPhrase
+
+	case p.accept("contact"):
+		// Whatever follows (the facility name and frequency) isn't needed.
+		tower := slices.Contains(p.toks, "tower")
+		p.toks = nil
+		if tower {
+			return "TO", nil
+		}
+		return "FC", nil
+	case p.accept("frequency", "change", "approved") || p.accept("handoff"):
+		return "FC", nil
+
+	case p.accept("squawk", "ident") || p.accept("ident"):
+		return "ID", nil
+	case p.accept("squawk"):
+		code := p.next()
+		if len(code) != 4 || !allDigits(code) || strings.ContainsAny(code, "89") {
+			return "", ErrInvalidSquawk
+		}
+		return "SQ" + code, nil
+
+	default:
+		return "", fmt.Errorf("%q: %w", p.peek(), ErrUnrecognizedPhrase)
+	}
+}
+
+func (p *clearanceParser) turn(dir string) (string, error) {
+	if len(p.toks) > 1 && allDigits(p.toks[0]) && p.toks[1] == "degrees" {
+		deg, _ := p.number()
+		p.next()
+		if deg < 1 || deg > 180 {
+			return "", ErrInvalidHeading
+		}
+		return dir + strconv.Itoa(deg) + "D", nil
+	}
+	if !p.accept("heading") {
+		p.flag(`"turn left heading" or "turn right heading"`)
+	}
+	hdg, err := p.heading()
+	return fmt.Sprintf("%s%03d", dir, hdg), err
+}
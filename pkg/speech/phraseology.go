@@ -0,0 +1,59 @@
+// pkg/speech/phraseology.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package speech
+
+import (
+	"slices"
+	"strings"
+)
+
+// Clearances given in words--spoken or typed--are parsed leniently, but
+// a controller in training should learn the standard phraseology of FAA
+// JO 7110.65, so the parser also notes deviations from it: a callsign
+// that comes after the instructions rather than first, "descend to" for
+// "descend and maintain" (4-5-7), "left 270" for "turn left heading 270"
+// (5-6-2), "slow to 210" for "reduce speed to 210" (5-7-2), altitudes
+// at and above 18,000 that aren't given as flight levels (2-4-17), an
+// approach clearance that doesn't name the approach, and a descent below
+// FL180 from above without the altimeter setting (2-7-2). They're
+// returned in Clearance.Nonstandard; the instructions are still issued.
+
+// phraseologyKeywords are words that start standard instructions; text
+// that starts with one of them is phraseology rather than commands.
+var phraseologyKeywords = []string{
+	"climb", "descend", "turn", "fly", "maintain", "reduce", "increase", "cleared", "expect",
+	"proceed", "contact", "squawk", "intercept", "expedite", "resume", "cancel", "heading",
+	"left", "right", "altimeter", "frequency",
+}
+
+// IsPhraseology returns whether the text looks like instructions written
+// out in words (e.g., "descend and maintain 5000") rather than in the
+// command syntax used by RunAircraftCommands (e.g., "D50").
+func IsPhraseology(text string) bool {
+	first, _, _ := strings.Cut(strings.TrimSpace(strings.ToLower(text)), " ")
+	return slices.Contains(phraseologyKeywords, first)
+}
+
+// flag records a deviation from standard phraseology.
+func (p *clearanceParser) flag(msg string) {
+	if !slices.Contains(p.nonstandard, msg) {
+		p.nonstandard = append(p.nonstandard, msg)
+	}
+}
+
+// checkApproachName is called before an approach clearance is parsed;
+// the approach should be named through to the word "approach".
+func (p *clearanceParser) checkApproachName() {
+	if !slices.Contains(p.toks, "approach") {
+		p.flag(`approach clearances should give the approach's name, ending with "approach"`)
+	}
+}
+
+// checkAltimeter is called after the clearance has been parsed.
+func (p *clearanceParser) checkAltimeter() {
+	if p.belowFL180 && !p.issuedAltimeter {
+		p.flag("the altimeter setting is required when descending below FL180")
+	}
+}
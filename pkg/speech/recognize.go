@@ -0,0 +1,121 @@
+// pkg/speech/recognize.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package speech
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Recognizer is implemented by speech-to-text engines.
+type Recognizer interface {
+	// Transcribe returns the text spoken in the given audio, which is one
+	// channel, 16-bit little-endian PCM sampled at SampleRate. hints
+	// gives words and phrases that are likely to be spoken (e.g.,
+	// callsigns and fix names); recognizers may use them to improve
+	// accuracy.
+	Transcribe(pcm []byte, hints []string) (string, error)
+}
+
+var (
+	recognizersMu sync.Mutex
+	recognizers   = make(map[string]func() (Recognizer, error))
+)
+
+// RegisterRecognizer makes a speech recognizer available under the given
+// name. As with RegisterBackend, the constructor should return an error
+// if it can't be used on the current system.
+func RegisterRecognizer(name string, create func() (Recognizer, error)) {
+	recognizersMu.Lock()
+	defer recognizersMu.Unlock()
+
+	recognizers[name] = create
+}
+
+// NewRecognizer returns the named recognizer or, if name is empty, the
+// first registered recognizer that is available.
+func NewRecognizer(name string) (Recognizer, error) {
+	recognizersMu.Lock()
+	defer recognizersMu.Unlock()
+
+	if name != "" {
+		if create, ok := recognizers[name]; ok {
+			return create()
+		}
+		return nil, ErrUnknownRecognizer
+	}
+
+	for _, n := range slices.Sorted(maps.Keys(recognizers)) {
+		if r, err := recognizers[n](); err == nil {
+			return r, nil
+		}
+	}
+	return nil, ErrNoRecognizer
+}
+
+///////////////////////////////////////////////////////////////////////////
+// whisper.cpp
+
+// whisperRecognizer runs the whisper.cpp command-line tool on a WAV file
+// holding the audio. The path to the model to use is given by the
+// VICE_WHISPER_MODEL environment variable.
+type whisperRecognizer struct {
+	path, model string
+}
+
+func init() {
+	RegisterRecognizer("whisper", newWhisperRecognizer)
+}
+
+func newWhisperRecognizer() (Recognizer, error) {
+	model := os.Getenv("VICE_WHISPER_MODEL")
+	if model == "" {
+		return nil, ErrNoRecognizer
+	}
+	if _, err := os.Stat(model); err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range []string{"whisper-cli", "whisper-cpp", "whisper"} {
+		if path, err := exec.LookPath(cmd); err == nil {
+			return &whisperRecognizer{path: path, model: model}, nil
+		}
+	}
+	return nil, ErrNoRecognizer
+}
+
+func (w *whisperRecognizer) Transcribe(pcm []byte, hints []string) (string, error) {
+	f, err := os.CreateTemp("", "vice-*.wav")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(encodeWAV(pcm, 16000)) // whisper requires 16kHz audio
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"-m", w.model, "-f", f.Name(), "-l", "en", "-nt", "-np"}
+	if len(hints) > 0 {
+		args = append(args, "--prompt", strings.Join(hints, ", "))
+	}
+	cmd := exec.Command(w.path, args...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", ErrRecognitionFailed
+	}
+
+	return strings.Join(strings.Fields(stdout.String()), " "), nil
+}
@@ -0,0 +1,138 @@
+// pkg/speech/speech.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+// Package speech implements text-to-speech for pilot transmissions. Text
+// is synthesized by a pluggable Backend using a Voice that is chosen
+// per-aircraft, so that a given pilot always sounds the same, and the
+// resulting audio is routed through a RadioChannel that models the
+// single shared frequency, including transmissions that step on each
+// other.
+package speech
+
+import (
+	"errors"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// SampleRate is the sample rate of the audio returned by backends; it
+// matches the platform audio engine's.
+const SampleRate = 44100
+
+var (
+	ErrNoBackend       = errors.New("No text-to-speech backend available")
+	ErrUnknownBackend  = errors.New("Unknown text-to-speech backend")
+	ErrInvalidWAV      = errors.New("Invalid WAV file")
+	ErrUnsupportedWAV  = errors.New("Unsupported WAV format")
+	ErrNothingToSpeak  = errors.New("No text to speak")
+	ErrSynthesisFailed = errors.New("Speech synthesis failed")
+
+	ErrNoRecognizer           = errors.New("No speech recognizer available")
+	ErrUnknownRecognizer      = errors.New("Unknown speech recognizer")
+	ErrRecognitionFailed      = errors.New("Speech recognition failed")
+	ErrUnknownCallsign        = errors.New("No aircraft with that callsign")
+	ErrNoInstructions         = errors.New("No instructions recognized")
+	ErrUnrecognizedPhrase     = errors.New("Unrecognized phrase")
+	ErrInvalidHeading         = errors.New("Invalid heading")
+	ErrInvalidAltitude        = errors.New("Invalid altitude")
+	ErrInvalidSpeed           = errors.New("Invalid speed")
+	ErrInvalidSquawk          = errors.New("Invalid squawk code")
+	ErrInvalidAltimeter       = errors.New("Invalid altimeter setting")
+	ErrUnknownApproach        = errors.New("Unknown approach")
+	ErrUnknownFix             = errors.New("Fix is not on the aircraft's route")
+	ErrImplausibleInstruction = errors.New("Instruction is implausible for the aircraft")
+)
+
+// Voice describes how a transmission is spoken.
+type Voice struct {
+	// Name identifies the backend's voice (e.g., "en-us").
+	Name string
+	// Rate is the speaking rate in words per minute.
+	Rate int
+	// Pitch is in [0,99], with 50 being the backend's default.
+	Pitch int
+}
+
+// Backend is implemented by text-to-speech engines.
+type Backend interface {
+	// Synthesize returns the given text spoken with the given voice as
+	// one channel, 16-bit little-endian PCM sampled at SampleRate.
+	Synthesize(text string, v Voice) ([]byte, error)
+	// Voices returns the names of the voices that are available; these
+	// may be used for Voice.Name. Each is a different accent.
+	Voices() []string
+}
+
+var (
+	backendsMu sync.Mutex
+	backends   = make(map[string]func() (Backend, error))
+)
+
+// RegisterBackend makes a text-to-speech backend available under the given
+// name. The constructor should return an error if the backend can't be
+// used on the current system.
+func RegisterBackend(name string, create func() (Backend, error)) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	backends[name] = create
+}
+
+// Backends returns the names of the registered backends.
+func Backends() []string {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	return slices.Sorted(maps.Keys(backends))
+}
+
+// NewBackend returns the named backend or, if name is empty, the first
+// registered backend that is available.
+func NewBackend(name string) (Backend, error) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if name != "" {
+		if create, ok := backends[name]; ok {
+			return create()
+		}
+		return nil, ErrUnknownBackend
+	}
+
+	for _, n := range slices.Sorted(maps.Keys(backends)) {
+		if b, err := backends[n](); err == nil {
+			return b, nil
+		}
+	}
+	return nil, ErrNoBackend
+}
+
+// VoiceFor returns the voice used for the given callsign's pilot. The
+// voice, rate, and pitch are derived from a hash of the callsign so that
+// the same aircraft always sounds the same while different aircraft are
+// (usually) distinguishable. baseRate is the nominal speaking rate.
+func VoiceFor(callsign string, voices []string, baseRate int) Voice {
+	h := fnv.New32a()
+	h.Write([]byte(callsign))
+	v := h.Sum32()
+
+	var voice Voice
+	if len(voices) > 0 {
+		// Sort so that the choice doesn't depend on the order the backend
+		// returns them in.
+		voices = slices.Clone(voices)
+		slices.Sort(voices)
+		voice.Name = voices[v%uint32(len(voices))]
+	}
+	v /= 97
+
+	// Rates vary by +/-20%, pitch over [25,75].
+	voice.Rate = baseRate + (int(v%41)-20)*baseRate/100
+	v /= 41
+	voice.Pitch = 25 + int(v%51)
+
+	return voice
+}
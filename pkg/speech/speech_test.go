@@ -0,0 +1,243 @@
+// pkg/speech/speech_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package speech
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSpokenText(t *testing.T) {
+	for _, c := range []struct{ text, spoken string }{
+		{"turn left heading 090", "turn left heading zero niner zero"},
+		{"descend and maintain 11,000", "descend and maintain one one thousand"},
+		{"climb and maintain 4,500, expedite", "climb and maintain four thousand five hundred, expedite"},
+		{"maintain FL230", "maintain flight level two three zero"},
+		{"cleared ILS runway 22L approach", "cleared ILS runway two two left approach"},
+		{"at 210 kts", "at two one zero knots"},
+		{"contact departure on 128.35.", "contact departure on one two eight point three five."},
+		{"at 3,250", "at three thousand two hundred five zero"},
+		{"runway 4R", "runway four right"},
+	} {
+		if s := SpokenText(c.text); s != c.spoken {
+			t.Errorf("%q: got %q, expected %q", c.text, s, c.spoken)
+		}
+	}
+}
+
+func TestVoiceFor(t *testing.T) {
+	voices := []string{"a", "b", "c", "d"}
+	names := make(map[string]bool)
+	for _, cs := range []string{"AAL123", "UAL9", "N123AB", "DAL2201", "JBU88", "SWA1492"} {
+		v := VoiceFor(cs, voices, 175)
+		if v != VoiceFor(cs, []string{"d", "c", "b", "a"}, 175) {
+			t.Errorf("%s: voice depends on voice order", cs)
+		}
+		if v.Rate < 140 || v.Rate > 210 {
+			t.Errorf("%s: rate %d out of range", cs, v.Rate)
+		}
+		if v.Pitch < 25 || v.Pitch > 75 {
+			t.Errorf("%s: pitch %d out of range", cs, v.Pitch)
+		}
+		names[v.Name] = true
+	}
+	if len(names) < 2 {
+		t.Errorf("expected variation in voices, got %v", names)
+	}
+}
+
+func makeWAV(channels, rate int, samples []int16, dataSize uint32) []byte {
+	var b []byte
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, 0xffffffff)
+	b = append(b, "WAVEfmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = binary.LittleEndian.AppendUint16(b, uint16(channels))
+	b = binary.LittleEndian.AppendUint32(b, uint32(rate))
+	b = binary.LittleEndian.AppendUint32(b, uint32(rate*channels*2))
+	b = binary.LittleEndian.AppendUint16(b, uint16(channels*2))
+	b = binary.LittleEndian.AppendUint16(b, 16)
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, dataSize)
+	for _, s := range samples {
+		b = binary.LittleEndian.AppendUint16(b, uint16(s))
+	}
+	return b
+}
+
+func TestDecodeWAV(t *testing.T) {
+	samples, rate, err := decodeWAV(makeWAV(1, 22050, []int16{1, -2, 300}, 6))
+	if err != nil || rate != 22050 || len(samples) != 3 || samples[1] != -2 || samples[2] != 300 {
+		t.Errorf("mono: got %v %d %v", samples, rate, err)
+	}
+
+	// Stereo is mixed down; bogus (streamed) sizes are clamped.
+	samples, _, err = decodeWAV(makeWAV(2, 44100, []int16{100, 200, -50, -150}, 0xffffffff))
+	if err != nil || len(samples) != 2 || samples[0] != 150 || samples[1] != -100 {
+		t.Errorf("stereo: got %v %v", samples, err)
+	}
+
+	if _, _, err := decodeWAV([]byte("RIFF0000AVI ")); err != ErrInvalidWAV {
+		t.Errorf("expected ErrInvalidWAV, got %v", err)
+	}
+}
+
+func TestResample(t *testing.T) {
+	in := []int16{0, 100, 200, 300}
+	out := resample(in, SampleRate/2)
+	if len(out) != 8 {
+		t.Fatalf("expected 8 samples, got %d", len(out))
+	}
+	for i, expected := range []int16{0, 50, 100, 150, 200, 250, 300, 300} {
+		if out[i] != expected {
+			t.Errorf("sample %d: got %d, expected %d", i, out[i], expected)
+		}
+	}
+}
+
+func TestRadioChannel(t *testing.T) {
+	oneSecond := make([]byte, 2*SampleRate)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Never step on: the second transmission waits for the first plus the gap.
+	rc := NewRadioChannel(0, 1)
+	if tr := rc.Transmit(now, oneSecond); tr.Delay != 0 || tr.Blocked {
+		t.Errorf("first transmission: %v %v", tr.Delay, tr.Blocked)
+	}
+	if tr := rc.Transmit(now.Add(200*time.Millisecond), oneSecond); tr.Delay != 1300*time.Millisecond || tr.Blocked {
+		t.Errorf("second transmission: %v %v", tr.Delay, tr.Blocked)
+	}
+	if tr := rc.Transmit(now.Add(10*time.Second), oneSecond); tr.Delay != 0 || tr.Blocked {
+		t.Errorf("clear frequency: %v %v", tr.Delay, tr.Blocked)
+	}
+
+	// Always step on: the overlapping part is garbled and the rest is untouched.
+	rc = NewRadioChannel(1, 1)
+	rc.Transmit(now, oneSecond)
+	tr := rc.Transmit(now.Add(500*time.Millisecond), oneSecond)
+	if !tr.Blocked || tr.Delay != 0 {
+		t.Errorf("expected blocked transmission: %v %v", tr.Delay, tr.Blocked)
+	}
+	samples := decodePCM(tr.PCM)
+	squeal := false
+	for _, s := range samples[:SampleRate/2] {
+		squeal = squeal || s != 0
+	}
+	if !squeal {
+		t.Errorf("expected heterodyne in overlap")
+	}
+	for i, s := range samples[SampleRate/2+1:] {
+		if s != 0 {
+			t.Errorf("sample %d after overlap modified", i)
+			break
+		}
+	}
+}
+
+func TestEncodeWAV(t *testing.T) {
+	pcm := encodePCM([]int16{0, 300, 600, 900, 1200, 1500})
+	samples, rate, err := decodeWAV(encodeWAV(pcm, SampleRate))
+	if err != nil || rate != SampleRate || len(samples) != 6 || samples[5] != 1500 {
+		t.Errorf("got %v %d %v", samples, rate, err)
+	}
+}
+
+func TestParseClearance(t *testing.T) {
+	aircraft := []AircraftGrammar{
+		{
+			Callsign:   "AAL123",
+			Telephony:  "American",
+			Altitude:   8000,
+			Approaches: map[string]string{"I2L": "ILS Runway 22L", "I2R": "ILS Runway 22R", "R4": "RNAV Runway 4"},
+			Fixes:      []string{"MERIT", "HAARP"},
+		},
+		{Callsign: "N123AB", Altitude: 3000},
+		{Callsign: "AAL1234", Telephony: "American", Altitude: 11000},
+	}
+
+	for _, c := range []struct {
+		transcript string
+		callsign   string
+		commands   []string
+		err        error
+	}{
+		{"American 123, turn left heading 270, descend and maintain 5,000.", "AAL123", []string{"L270", "D50"}, nil},
+		{"american one two three fly heading zero niner zero climb and maintain one one thousand", "AAL123",
+			[]string{"H090", "C110"}, nil},
+		{"American 1234 descend and maintain four thousand five hundred", "AAL1234", []string{"D45"}, nil},
+		{"American 123 cleared ILS runway 22 left approach", "AAL123", []string{"CI2L"}, nil},
+		{"American 123 expect the ILS 22R approach", "AAL123", []string{"EI2R"}, nil},
+		{"American 123 proceed direct MERIT, reduce speed to 210 knots", "AAL123", []string{"DMERIT", "S210"}, nil},
+		{"American 123 maintain 250 knots, contact New York Center 132.45", "AAL123", []string{"S250", "FC"}, nil},
+		{"American 123 intercept the localizer", "AAL123", []string{"I"}, nil},
+		{"November one two three alpha bravo squawk 4521", "N123AB", []string{"SQ4521"}, nil},
+		{"N123AB turn right 20 degrees, contact tower", "N123AB", []string{"R20D", "TO"}, nil},
+		{"November 123AB climb and maintain flight level 230", "N123AB", []string{"C230"}, nil},
+
+		// Errors
+		{"Delta 456 turn left heading 270", "", nil, ErrUnknownCallsign},
+		{"American 123 climb and maintain 5,000", "AAL123", nil, ErrImplausibleInstruction},
+		{"American 123 turn left heading 400", "AAL123", nil, ErrInvalidHeading},
+		{"American 123 cleared ILS approach", "AAL123", nil, ErrUnknownApproach},
+		{"American 123 proceed direct ROBER", "AAL123", nil, ErrUnknownFix},
+		{"American 123 do a barrel roll", "AAL123", nil, ErrUnrecognizedPhrase},
+		{"American 123", "AAL123", nil, ErrNoInstructions},
+	} {
+		cl, err := ParseClearance(c.transcript, aircraft)
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("%q: expected error %v, got %v", c.transcript, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", c.transcript, err)
+		} else if cl.Callsign != c.callsign || !slices.Equal(cl.Commands, c.commands) {
+			t.Errorf("%q: got %s %v, expected %s %v", c.transcript, cl.Callsign, cl.Commands, c.callsign, c.commands)
+		}
+	}
+}
+
+func TestPhraseology(t *testing.T) {
+	aircraft := []AircraftGrammar{
+		{
+			Callsign:   "AAL123",
+			Telephony:  "American",
+			Altitude:   24000,
+			Approaches: map[string]string{"I2L": "ILS Runway 22L"},
+			Fixes:      []string{"MERIT"},
+		},
+	}
+
+	for _, c := range []struct {
+		transcript  string
+		nonstandard int
+	}{
+		{"American 123 turn left heading 270, descend and maintain flight level 200", 0},
+		{"American 123 descend and maintain 12,000, altimeter 2992", 0},
+		{"American 123 cleared ILS runway 22 left approach, reduce speed to 180", 0},
+		{"descend and maintain flight level 200, American 123", 1},
+		{"American 123 left 270", 2},
+		{"American 123 descend to 12,000", 2},
+		{"American 123 descend and maintain 20,000", 1},
+		{"American 123 slow to 180, direct MERIT", 2},
+		{"American 123 cleared ILS 22 left", 1},
+	} {
+		cl, err := ParseClearance(c.transcript, aircraft)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", c.transcript, err)
+		} else if len(cl.Nonstandard) != c.nonstandard {
+			t.Errorf("%q: got nonstandard %q, expected %d", c.transcript, cl.Nonstandard, c.nonstandard)
+		}
+	}
+
+	if !IsPhraseology("DESCEND AND MAINTAIN 5000") || IsPhraseology("D50 L270") {
+		t.Errorf("IsPhraseology mismatch")
+	}
+}
@@ -0,0 +1,115 @@
+// pkg/speech/text.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package speech
+
+import (
+	"strings"
+)
+
+var digitWords = [10]string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "niner"}
+
+// SpokenText converts the text of a radio transmission as it is displayed
+// (e.g., "descend and maintain 11,000, turn left heading 090, expect ILS
+// runway 22L") into the words a pilot would say, following standard
+// phraseology: numbers are spoken digit-by-digit except for altitudes
+// given in thousands and hundreds, flight levels are spelled out, and
+// abbreviations are expanded.
+func SpokenText(s string) string {
+	var words []string
+	for _, w := range strings.Fields(s) {
+		// Keep trailing punctuation so the synthesizer pauses there.
+		punct := ""
+		if n := len(w); n > 1 && strings.ContainsRune(",.;:", rune(w[n-1])) {
+			w, punct = w[:n-1], w[n-1:]
+		}
+
+		words = append(words, spokenWord(w)+punct)
+	}
+	return strings.Join(words, " ")
+}
+
+func spokenWord(w string) string {
+	switch {
+	case strings.EqualFold(w, "kts") || strings.EqualFold(w, "kt"):
+		return "knots"
+
+	case len(w) > 2 && strings.EqualFold(w[:2], "FL") && allDigits(w[2:]):
+		return "flight level " + spokenDigits(w[2:])
+
+	case isAltitude(w):
+		return spokenAltitude(w)
+
+	case isRunway(w):
+		rwy := spokenDigits(w[:len(w)-1])
+		switch w[len(w)-1] {
+		case 'L':
+			return rwy + " left"
+		case 'R':
+			return rwy + " right"
+		default:
+			return rwy + " center"
+		}
+
+	case allDigits(strings.Replace(w, ".", "", 1)) && strings.Trim(w, ".") == w:
+		// Headings, speeds, frequencies, squawk codes, and flight numbers
+		// are all read as individual digits.
+		if before, after, ok := strings.Cut(w, "."); ok {
+			return spokenDigits(before) + " point " + spokenDigits(after)
+		}
+		return spokenDigits(w)
+
+	default:
+		return w
+	}
+}
+
+func allDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func spokenDigits(s string) string {
+	var d []string
+	for _, ch := range s {
+		d = append(d, digitWords[ch-'0'])
+	}
+	return strings.Join(d, " ")
+}
+
+// isAltitude returns true for altitudes formatted with a thousands
+// separator, as by FormatAltitude (e.g. "4,000" or "12,500").
+func isAltitude(w string) bool {
+	th, h, ok := strings.Cut(w, ",")
+	return ok && len(th) <= 2 && allDigits(th) && len(h) == 3 && allDigits(h)
+}
+
+// spokenAltitude returns the spoken form of an altitude accepted by
+// isAltitude: "12,500" is "one two thousand five hundred".
+func spokenAltitude(w string) string {
+	th, h, _ := strings.Cut(w, ",")
+	s := spokenDigits(th) + " thousand"
+	if hundreds := h[0] - '0'; hundreds != 0 {
+		s += " " + digitWords[hundreds] + " hundred"
+	}
+	if h[1:] != "00" {
+		// Not a standard altitude; read the rest digit-by-digit.
+		s += " " + spokenDigits(h[1:])
+	}
+	return s
+}
+
+// isRunway returns true for runway identifiers with a left/right/center
+// suffix, e.g. "22L".
+func isRunway(w string) bool {
+	n := len(w)
+	return n >= 2 && n <= 3 && allDigits(w[:n-1]) && strings.ContainsRune("LRC", rune(w[n-1]))
+}
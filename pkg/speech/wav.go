@@ -0,0 +1,139 @@
+// pkg/speech/wav.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package speech
+
+import (
+	"encoding/binary"
+)
+
+// decodeWAV parses a RIFF WAV file holding 16-bit PCM samples and returns
+// its samples, mixed down to a single channel, and its sample rate.
+// Synthesizers that write to a pipe often don't know the length of the
+// data when they write the header and so give bogus chunk sizes; these
+// are clamped to the data actually present.
+func decodeWAV(b []byte) ([]int16, int, error) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return nil, 0, ErrInvalidWAV
+	}
+
+	var channels, bits, rate int
+	haveFormat := false
+	b = b[12:]
+	for len(b) >= 8 {
+		id := string(b[0:4])
+		size := int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+		if size < 0 || size > len(b) {
+			size = len(b)
+		}
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, ErrInvalidWAV
+			}
+			if format := binary.LittleEndian.Uint16(b[0:2]); format != 1 /* PCM */ {
+				return nil, 0, ErrUnsupportedWAV
+			}
+			channels = int(binary.LittleEndian.Uint16(b[2:4]))
+			rate = int(binary.LittleEndian.Uint32(b[4:8]))
+			bits = int(binary.LittleEndian.Uint16(b[14:16]))
+			if bits != 16 || channels == 0 || rate == 0 {
+				return nil, 0, ErrUnsupportedWAV
+			}
+			haveFormat = true
+
+		case "data":
+			if !haveFormat {
+				return nil, 0, ErrInvalidWAV
+			}
+			n := size / (2 * channels)
+			samples := make([]int16, n)
+			for i := range samples {
+				sum := 0
+				for c := 0; c < channels; c++ {
+					off := 2 * (i*channels + c)
+					sum += int(int16(binary.LittleEndian.Uint16(b[off : off+2])))
+				}
+				samples[i] = int16(sum / channels)
+			}
+			return samples, rate, nil
+		}
+
+		// Chunks are padded to an even number of bytes.
+		size += size & 1
+		if size > len(b) {
+			break
+		}
+		b = b[size:]
+	}
+	return nil, 0, ErrInvalidWAV
+}
+
+// resample converts the samples from the given rate to SampleRate using
+// linear interpolation, which is plenty for speech over a radio.
+func resample(samples []int16, rate int) []int16 {
+	return resampleTo(samples, rate, SampleRate)
+}
+
+func resampleTo(samples []int16, from, to int) []int16 {
+	if from == to || len(samples) == 0 {
+		return samples
+	}
+
+	n := int(int64(len(samples)) * int64(to) / int64(from))
+	out := make([]int16, n)
+	for i := range out {
+		// Position in the source, in units of 1/to of a source sample.
+		pos := int64(i) * int64(from)
+		j, frac := int(pos/int64(to)), pos%int64(to)
+		if j+1 >= len(samples) {
+			out[i] = samples[len(samples)-1]
+			continue
+		}
+		a, b := int64(samples[j]), int64(samples[j+1])
+		out[i] = int16(a + (b-a)*frac/int64(to))
+	}
+	return out
+}
+
+// encodeWAV returns a WAV file holding the given audio, which is sampled
+// at SampleRate, resampled to the given rate.
+func encodeWAV(pcm []byte, rate int) []byte {
+	data := encodePCM(resampleTo(decodePCM(pcm), SampleRate, rate))
+
+	var b []byte
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(36+len(data)))
+	b = append(b, "WAVEfmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, 1) // PCM
+	b = binary.LittleEndian.AppendUint16(b, 1) // channels
+	b = binary.LittleEndian.AppendUint32(b, uint32(rate))
+	b = binary.LittleEndian.AppendUint32(b, uint32(2*rate))
+	b = binary.LittleEndian.AppendUint16(b, 2) // block align
+	b = binary.LittleEndian.AppendUint16(b, 16)
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// encodePCM returns the samples as 16-bit little-endian PCM.
+func encodePCM(samples []int16) []byte {
+	pcm := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(s))
+	}
+	return pcm
+}
+
+// decodePCM returns the samples in 16-bit little-endian PCM.
+func decodePCM(pcm []byte) []int16 {
+	samples := make([]int16, len(pcm)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+	}
+	return samples
+}
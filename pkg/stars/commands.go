@@ -0,0 +1,320 @@
+// pkg/stars/commands.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package stars
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Commands are entered at the STARS TCW keyboard as a line of text that
+// may be followed by clicking on a track ("slewing" it). The input is
+// first broken into tokens and then each command's handler gets a chance
+// to match it. Parsing doesn't depend on the state of the scope or the
+// sim: the result describes what was entered and it's up to the caller
+// to carry it out and to report errors like ILL TRK that depend on the
+// track.
+
+// TriangleCharacter is the STARS keyboard's triangle key, which is used
+// to enter scratchpads among other things.
+const TriangleCharacter = string(rune(0x80))
+
+///////////////////////////////////////////////////////////////////////////
+// Tokenizer
+
+type TokenType int
+
+const (
+	TokenLetters TokenType = iota // "JBU", "ROUTE"
+	TokenNumber                   // "220", "2.5"
+	TokenSymbol                   // a single non-alphanumeric character: "*", "+", ...
+)
+
+func (t TokenType) String() string {
+	return [...]string{"Letters", "Number", "Symbol"}[t]
+}
+
+type Token struct {
+	Type TokenType
+	Text string
+	Pos  int // byte offset of the token in the input
+}
+
+// End returns the offset in the input just past the token.
+func (t Token) End() int { return t.Pos + len(t.Text) }
+
+// Tokenize breaks a line of keyboard input into tokens: runs of letters,
+// numbers (which may include a decimal point), and individual symbols.
+// Whitespace separates tokens but doesn't generate any; adjacent tokens
+// can be found by comparing their positions. Thus, "JBU123" is the two
+// tokens "JBU" and "123" and "*J2.5" is "*", "J", and "2.5".
+func Tokenize(s string) []Token {
+	var tokens []Token
+	runes := []rune(s)
+	offset := func(i int) int { return len(string(runes[:i])) }
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+
+		case unicode.IsLetter(r):
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Type: TokenLetters, Text: string(runes[start:i]), Pos: offset(start)})
+
+		case unicode.IsDigit(r):
+			sawPoint := false
+			for i < len(runes) {
+				if unicode.IsDigit(runes[i]) {
+					i++
+				} else if runes[i] == '.' && !sawPoint && i+1 < len(runes) && unicode.IsDigit(runes[i+1]) {
+					sawPoint = true
+					i++
+				} else {
+					break
+				}
+			}
+			tokens = append(tokens, Token{Type: TokenNumber, Text: string(runes[start:i]), Pos: offset(start)})
+
+		default:
+			i++
+			tokens = append(tokens, Token{Type: TokenSymbol, Text: string(r), Pos: offset(start)})
+		}
+	}
+	return tokens
+}
+
+// Fields groups tokens that aren't separated by whitespace.
+func Fields(tokens []Token) [][]Token {
+	var fields [][]Token
+	for i, t := range tokens {
+		if i == 0 || t.Pos != tokens[i-1].End() {
+			fields = append(fields, nil)
+		}
+		fields[len(fields)-1] = append(fields[len(fields)-1], t)
+	}
+	return fields
+}
+
+// contiguous returns whether there is no whitespace between any of the
+// tokens.
+func contiguous(tokens []Token) bool {
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i].Pos != tokens[i-1].End() {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTokens returns whether the tokens are exactly the given strings
+// with no whitespace between them.
+func matchTokens(tokens []Token, text ...string) bool {
+	if len(tokens) != len(text) || !contiguous(tokens) {
+		return false
+	}
+	for i, t := range tokens {
+		if t.Text != text[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// prefixTokens returns whether the tokens start with the given strings
+// with no whitespace between them and, if so, the remaining tokens.
+func prefixTokens(tokens []Token, text ...string) ([]Token, bool) {
+	if len(tokens) < len(text) || !matchTokens(tokens[:len(text)], text...) {
+		return nil, false
+	}
+	return tokens[len(text):], true
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Slew commands
+
+// SlewCommand identifies a command that is entered and followed by
+// clicking on a track.
+type SlewCommand int
+
+const (
+	SlewSelect                   SlewCommand = iota // nothing entered: accept a handoff, acknowledge an alert, ...
+	SlewText                                        // initiate track, hand off, or set the scratchpad, depending on the text
+	SlewClearScratchpad                             // .
+	SlewClearSecondaryScratchpad                    // +
+	SlewSecondaryScratchpad                         // +TEXT
+	SlewTemporaryAltitude                           // +NNN
+	SlewAssignedAltitude                            // ++NNN
+	SlewPilotReportedAltitude                       // NNN
+	SlewRangeBearing                                // * then click a second location
+	SlewRangeBearingToFix                           // *F
+	SlewRangeBearingLine                            // *T
+	SlewJRing                                       // *JN
+	SlewRemoveJRing                                 // *J
+	SlewCone                                        // *PN
+	SlewRemoveCone                                  // *P
+	SlewToggleTPASize                               // *D+
+	SlewEnableTPASize                               // *D+E
+	SlewInhibitTPASize                              // *D+I
+	SlewEnableATPAWarnAlert                         // *AE
+	SlewInhibitATPAWarnAlert                        // *AI
+	SlewEnableATPAMonitor                           // *BE
+	SlewInhibitATPAMonitor                          // *BI
+	SlewForceQL                                     // ** [TCP...]
+	SlewPointOut                                    // TCP*
+	SlewRejectPointOut                              // UN
+	SlewDisplayRoute                                // .ROUTE
+	SlewDump                                        // ?
+)
+
+// Slew is a parsed slew command.
+type Slew struct {
+	Command   SlewCommand
+	Text      string   // SlewText, SlewSecondaryScratchpad, SlewPointOut
+	Positions []string // SlewForceQL
+	Altitude  int      // feet
+	Range     float32  // nm; SlewJRing and SlewCone
+}
+
+// slewHandler tries to parse a slew command from the input; it returns
+// false if the input isn't one that it handles.
+type slewHandler func(input string, tokens []Token) (Slew, bool, error)
+
+// The handlers are tried in order and the first that matches is used, so
+// longer commands must precede ones that are a prefix of them.
+var slewHandlers = []slewHandler{
+	slewLiteral(SlewClearScratchpad, "."),
+	slewLiteral(SlewClearSecondaryScratchpad, "+"),
+	slewLiteral(SlewRangeBearing, "*"),
+	slewLiteral(SlewDump, "?"),
+	slewLiteral(SlewRangeBearingToFix, "*", "F"),
+	slewLiteral(SlewRangeBearingLine, "*", "T"),
+	slewLiteral(SlewRemoveJRing, "*", "J"),
+	slewLiteral(SlewRemoveCone, "*", "P"),
+	slewLiteral(SlewToggleTPASize, "*", "D", "+"),
+	slewLiteral(SlewEnableTPASize, "*", "D", "+", "E"),
+	slewLiteral(SlewInhibitTPASize, "*", "D", "+", "I"),
+	slewLiteral(SlewEnableATPAWarnAlert, "*", "AE"),
+	slewLiteral(SlewInhibitATPAWarnAlert, "*", "AI"),
+	slewLiteral(SlewEnableATPAMonitor, "*", "BE"),
+	slewLiteral(SlewInhibitATPAMonitor, "*", "BI"),
+	slewLiteral(SlewRejectPointOut, "UN"),
+	slewLiteral(SlewDisplayRoute, ".", "ROUTE"),
+	parseSlewForceQL,
+	parseSlewAssignedAltitude,
+	parseSlewSecondaryScratchpad,
+	parseSlewPilotReportedAltitude,
+	slewRange(SlewJRing, "J"),
+	slewRange(SlewCone, "P"),
+	parseSlewPointOut,
+}
+
+// ParseSlew parses the input that was entered before a track was
+// clicked. Input that isn't otherwise recognized is returned as a
+// SlewText command.
+func ParseSlew(input string) (Slew, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return Slew{Command: SlewSelect}, nil
+	}
+
+	tokens := Tokenize(input)
+	for _, h := range slewHandlers {
+		if s, ok, err := h(input, tokens); ok || err != nil {
+			return s, err
+		}
+	}
+	return Slew{Command: SlewText, Text: input}, nil
+}
+
+func slewLiteral(cmd SlewCommand, text ...string) slewHandler {
+	return func(input string, tokens []Token) (Slew, bool, error) {
+		return Slew{Command: cmd}, matchTokens(tokens, text...), nil
+	}
+}
+
+// parseSlewForceQL handles "**", optionally followed by the positions to
+// force the track to quicklook at (Manual 6-70).
+func parseSlewForceQL(input string, tokens []Token) (Slew, bool, error) {
+	if _, ok := prefixTokens(tokens, "*", "*"); !ok {
+		return Slew{}, false, nil
+	}
+	return Slew{Command: SlewForceQL, Positions: strings.Fields(input[2:])}, true, nil
+}
+
+// parseSlewAssignedAltitude handles "++" followed by an altitude in
+// hundreds of feet.
+func parseSlewAssignedAltitude(input string, tokens []Token) (Slew, bool, error) {
+	rest, ok := prefixTokens(tokens, "+", "+")
+	if !ok {
+		return Slew{}, false, nil
+	}
+	if len(rest) != 1 || !contiguous(tokens) || !isAltitude(rest[0]) {
+		return Slew{}, true, ErrCommandFormat
+	}
+	alt, _ := strconv.Atoi(rest[0].Text)
+	return Slew{Command: SlewAssignedAltitude, Altitude: alt * 100}, true, nil
+}
+
+// parseSlewSecondaryScratchpad handles "+" followed by either a
+// temporary altitude in hundreds of feet or the secondary scratchpad's
+// contents.
+func parseSlewSecondaryScratchpad(input string, tokens []Token) (Slew, bool, error) {
+	rest, ok := prefixTokens(tokens, "+")
+	if !ok {
+		return Slew{}, false, nil
+	}
+	if len(rest) == 1 && contiguous(tokens) && rest[0].Type == TokenNumber && !strings.Contains(rest[0].Text, ".") {
+		alt, _ := strconv.Atoi(rest[0].Text)
+		return Slew{Command: SlewTemporaryAltitude, Altitude: alt * 100}, true, nil
+	}
+	return Slew{Command: SlewSecondaryScratchpad, Text: input[1:]}, true, nil
+}
+
+// parseSlewPilotReportedAltitude handles a three-digit altitude in
+// hundreds of feet.
+func parseSlewPilotReportedAltitude(input string, tokens []Token) (Slew, bool, error) {
+	if len(tokens) != 1 || !isAltitude(tokens[0]) {
+		return Slew{}, false, nil
+	}
+	alt, _ := strconv.Atoi(tokens[0].Text)
+	return Slew{Command: SlewPilotReportedAltitude, Altitude: alt * 100}, true, nil
+}
+
+func isAltitude(t Token) bool {
+	return t.Type == TokenNumber && len(t.Text) == 3 && !strings.Contains(t.Text, ".")
+}
+
+// slewRange returns a handler for "*J" and "*P", which are followed by a
+// radius or length in nm between 1 and 30.
+func slewRange(cmd SlewCommand, letter string) slewHandler {
+	return func(input string, tokens []Token) (Slew, bool, error) {
+		if len(tokens) < 2 || tokens[0].Text != "*" || tokens[1].Type != TokenLetters ||
+			!strings.HasPrefix(tokens[1].Text, letter) || !contiguous(tokens[:2]) {
+			return Slew{}, false, nil
+		}
+		r, err := strconv.ParseFloat(input[2:], 32)
+		if err != nil {
+			return Slew{}, true, ErrIllegalParam
+		} else if r < 1 || r > 30 {
+			return Slew{}, true, ErrIllegalValue
+		}
+		return Slew{Command: cmd, Range: float32(r)}, true, nil
+	}
+}
+
+// parseSlewPointOut handles a position followed by "*" (Manual 6-64).
+func parseSlewPointOut(input string, tokens []Token) (Slew, bool, error) {
+	if n := len(tokens); n < 2 || tokens[n-1].Text != "*" {
+		return Slew{}, false, nil
+	}
+	return Slew{Command: SlewPointOut, Text: strings.TrimSuffix(input, "*")}, true, nil
+}
@@ -0,0 +1,142 @@
+// pkg/stars/commands_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package stars
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	type testcase struct {
+		input  string
+		tokens []Token
+	}
+	for _, test := range []testcase{
+		{input: "", tokens: nil},
+		{input: "   ", tokens: nil},
+		{input: "JBU123", tokens: []Token{{TokenLetters, "JBU", 0}, {TokenNumber, "123", 3}}},
+		{input: "*J2.5", tokens: []Token{{TokenSymbol, "*", 0}, {TokenLetters, "J", 1}, {TokenNumber, "2.5", 2}}},
+		{input: "1.", tokens: []Token{{TokenNumber, "1", 0}, {TokenSymbol, ".", 1}}},
+		{input: "1.2.3", tokens: []Token{{TokenNumber, "1.2", 0}, {TokenSymbol, ".", 3}, {TokenNumber, "3", 4}}},
+		{input: "** 1A  2B", tokens: []Token{{TokenSymbol, "*", 0}, {TokenSymbol, "*", 1}, {TokenNumber, "1", 3},
+			{TokenLetters, "A", 4}, {TokenNumber, "2", 7}, {TokenLetters, "B", 8}}},
+		{input: "B738/L", tokens: []Token{{TokenLetters, "B", 0}, {TokenNumber, "738", 1}, {TokenSymbol, "/", 4},
+			{TokenLetters, "L", 5}}},
+		{input: TriangleCharacter + "AB", tokens: []Token{{TokenSymbol, TriangleCharacter, 0},
+			{TokenLetters, "AB", len(TriangleCharacter)}}},
+	} {
+		tokens := Tokenize(test.input)
+		if !slices.Equal(tokens, test.tokens) {
+			t.Errorf("%q: got tokens %+v, expected %+v", test.input, tokens, test.tokens)
+		}
+		for _, tok := range tokens {
+			if test.input[tok.Pos:tok.End()] != tok.Text {
+				t.Errorf("%q: token %+v doesn't match input %q", test.input, tok, test.input[tok.Pos:tok.End()])
+			}
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	fields := Fields(Tokenize("JBU123 B738/L  +AB 220"))
+	var text []string
+	for _, f := range fields {
+		s := ""
+		for _, tok := range f {
+			s += tok.Text
+		}
+		text = append(text, s)
+	}
+	if expected := []string{"JBU123", "B738/L", "+AB", "220"}; !slices.Equal(text, expected) {
+		t.Errorf("got fields %v, expected %v", text, expected)
+	}
+}
+
+func TestParseSlew(t *testing.T) {
+	type testcase struct {
+		input string
+		slew  Slew
+		err   error
+	}
+	for _, test := range []testcase{
+		{input: "", slew: Slew{Command: SlewSelect}},
+		{input: " ", slew: Slew{Command: SlewSelect}},
+		{input: ".", slew: Slew{Command: SlewClearScratchpad}},
+		{input: "+", slew: Slew{Command: SlewClearSecondaryScratchpad}},
+		{input: "*", slew: Slew{Command: SlewRangeBearing}},
+		{input: "?", slew: Slew{Command: SlewDump}},
+		{input: "*F", slew: Slew{Command: SlewRangeBearingToFix}},
+		{input: "*T", slew: Slew{Command: SlewRangeBearingLine}},
+		{input: "*J", slew: Slew{Command: SlewRemoveJRing}},
+		{input: "*P", slew: Slew{Command: SlewRemoveCone}},
+		{input: "*D+", slew: Slew{Command: SlewToggleTPASize}},
+		{input: "*D+E", slew: Slew{Command: SlewEnableTPASize}},
+		{input: "*D+I", slew: Slew{Command: SlewInhibitTPASize}},
+		{input: "*AE", slew: Slew{Command: SlewEnableATPAWarnAlert}},
+		{input: "*AI", slew: Slew{Command: SlewInhibitATPAWarnAlert}},
+		{input: "*BE", slew: Slew{Command: SlewEnableATPAMonitor}},
+		{input: "*BI", slew: Slew{Command: SlewInhibitATPAMonitor}},
+		{input: "UN", slew: Slew{Command: SlewRejectPointOut}},
+		{input: ".ROUTE", slew: Slew{Command: SlewDisplayRoute}},
+
+		// Force quicklook
+		{input: "**", slew: Slew{Command: SlewForceQL}},
+		{input: "**1A", slew: Slew{Command: SlewForceQL, Positions: []string{"1A"}}},
+		{input: "**1A 2B", slew: Slew{Command: SlewForceQL, Positions: []string{"1A", "2B"}}},
+		{input: "**ALL", slew: Slew{Command: SlewForceQL, Positions: []string{"ALL"}}},
+
+		// Altitudes
+		{input: "++120", slew: Slew{Command: SlewAssignedAltitude, Altitude: 12000}},
+		{input: "++12", err: ErrCommandFormat},
+		{input: "++ABC", err: ErrCommandFormat},
+		{input: "++1.5", err: ErrCommandFormat},
+		{input: "+80", slew: Slew{Command: SlewTemporaryAltitude, Altitude: 8000}},
+		{input: "+240", slew: Slew{Command: SlewTemporaryAltitude, Altitude: 24000}},
+		{input: "220", slew: Slew{Command: SlewPilotReportedAltitude, Altitude: 22000}},
+		{input: "005", slew: Slew{Command: SlewPilotReportedAltitude, Altitude: 500}},
+
+		// Secondary scratchpad
+		{input: "+AB", slew: Slew{Command: SlewSecondaryScratchpad, Text: "AB"}},
+		{input: "+A1", slew: Slew{Command: SlewSecondaryScratchpad, Text: "A1"}},
+
+		// J-rings and cones
+		{input: "*J3", slew: Slew{Command: SlewJRing, Range: 3}},
+		{input: "*J2.5", slew: Slew{Command: SlewJRing, Range: 2.5}},
+		{input: "*J30", slew: Slew{Command: SlewJRing, Range: 30}},
+		{input: "*J31", err: ErrIllegalValue},
+		{input: "*J0.5", err: ErrIllegalValue},
+		{input: "*JFK", err: ErrIllegalParam},
+		{input: "*P10", slew: Slew{Command: SlewCone, Range: 10}},
+		{input: "*P0", err: ErrIllegalValue},
+		{input: "*PX", err: ErrIllegalParam},
+
+		// Point outs
+		{input: "1A*", slew: Slew{Command: SlewPointOut, Text: "1A"}},
+		{input: "N4P*", slew: Slew{Command: SlewPointOut, Text: "N4P"}},
+
+		// Everything else
+		{input: "1A", slew: Slew{Command: SlewText, Text: "1A"}},
+		{input: "JBU123", slew: Slew{Command: SlewText, Text: "JBU123"}},
+		{input: "ABC", slew: Slew{Command: SlewText, Text: "ABC"}},
+		{input: "22", slew: Slew{Command: SlewText, Text: "22"}},
+		{input: "2200", slew: Slew{Command: SlewText, Text: "2200"}},
+		{input: "*X", slew: Slew{Command: SlewText, Text: "*X"}},
+		{input: ". ROUTE", slew: Slew{Command: SlewText, Text: ". ROUTE"}},
+	} {
+		slew, err := ParseSlew(test.input)
+		if err != test.err {
+			t.Errorf("%q: got error %v, expected %v", test.input, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if slew.Command != test.slew.Command || slew.Text != test.slew.Text || slew.Altitude != test.slew.Altitude ||
+			slew.Range != test.slew.Range || !slices.Equal(slew.Positions, test.slew.Positions) {
+			t.Errorf("%q: got %+v, expected %+v", test.input, slew, test.slew)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+// pkg/stars/errors.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package stars
+
+import "errors"
+
+var (
+	ErrCommandFormat = errors.New("Invalid command format")
+	ErrIllegalParam  = errors.New("Illegal command parameter")
+	ErrIllegalValue  = errors.New("Illegal command value")
+)
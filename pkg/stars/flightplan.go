@@ -0,0 +1,207 @@
+// pkg/stars/flightplan.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package stars
+
+import (
+	"slices"
+	"strings"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/rand"
+	"github.com/mmp/vice/pkg/sim"
+	"github.com/mmp/vice/pkg/units"
+	"github.com/mmp/vice/pkg/util"
+)
+
+// AbbreviatedFlightPlan holds the fields of an abbreviated flight plan
+// entered at the keyboard: the ACID followed by any of the beacon code,
+// controlling position, type of flight, scratchpads, aircraft type,
+// requested altitude, and flight rules, in any order.
+type AbbreviatedFlightPlan struct {
+	ACID                string
+	BCN                 av.Squawk
+	ControllingPosition string
+	TypeOfFlight        string // "arrival", "departure", or "overflight"
+	DepartureAirport    string // specified with the type of flight
+	SC1                 string
+	SC2                 string
+	AircraftType        string
+	RequestedALT        units.Feet
+	Rules               av.FlightRules
+}
+
+var typesOfFlight = map[string]string{"A": "arrival", "P": "departure", "E": "overflight"}
+
+// Scratchpad contents that are reserved for the system.
+var badScratchpads = []string{"NAT", "CST", "AMB", "RDR", "ADB", "XXX"}
+
+// ParseAbbreviatedFlightPlan parses an abbreviated flight plan entry. An
+// aircraft type that isn't in the database gives sim.ErrIllegalACType
+// along with the rest of the flight plan, since it doesn't prevent the
+// flight plan from being entered; other errors mean that it can't be.
+func ParseAbbreviatedFlightPlan(input string, adapt av.STARSFacilityAdaptation) (AbbreviatedFlightPlan, error) {
+	var fp AbbreviatedFlightPlan
+	var typeErr error
+
+	fields := Fields(Tokenize(input))
+	if len(fields) == 0 {
+		return fp, sim.ErrInvalidAbbreviatedFP
+	}
+
+	acid := fieldText(input, fields[0])
+	if len(acid) < 2 || len(acid) > 7 || fields[0][0].Type != TokenLetters {
+		return fp, sim.ErrIllegalACID
+	}
+	fp.ACID = acid
+
+	maxScratchpad := util.Select(adapt.AllowLongScratchpad, 4, 3)
+	scratchpad := func(s string) (string, error) {
+		if len(s) == 0 || len(s) > maxScratchpad || slices.Contains(badScratchpads, s) ||
+			(len(s) >= 3 && util.IsAllNumbers(s[len(s)-3:])) {
+			return "", sim.ErrIllegalScratchpad
+		}
+		return s, nil
+	}
+
+	for _, f := range fields[1:] {
+		text := fieldText(input, f)
+		switch {
+		case len(f) == 1 && f[0].Type == TokenNumber && len(text) == 4:
+			// Beacon code
+			sq, err := av.ParseSquawk(text)
+			if err != nil {
+				return fp, sim.ErrInvalidAbbreviatedFP
+			}
+			fp.BCN = sq
+
+		case len(f) == 1 && f[0].Type == TokenNumber && len(text) == 3:
+			// Requested altitude, in hundreds of feet
+			alt, err := units.ParseFeet(text)
+			if err != nil {
+				return fp, sim.ErrInvalidAbbreviatedFP
+			}
+			fp.RequestedALT = alt
+
+		case len(f) == 2 && f[0].Type == TokenNumber && f[1].Type == TokenLetters && len(text) == 2:
+			// Controlling position (TCP)
+			fp.ControllingPosition = text
+
+		case len(f) == 1 && f[0].Type == TokenLetters && len(text) <= 2 && typesOfFlight[text[:1]] != "":
+			// Type of flight, optionally followed by a single-character
+			// airport id.
+			fp.TypeOfFlight = typesOfFlight[text[:1]]
+			fp.DepartureAirport = text[1:]
+
+		case len(f) == 2 && f[0].Text == ".":
+			// Flight rules
+			switch f[1].Text {
+			case "V", "P": // VFR, VFR on top
+				fp.Rules = av.VFR
+			case "E": // en route
+				fp.Rules = av.IFR
+			default:
+				return fp, sim.ErrInvalidAbbreviatedFP
+			}
+
+		case f[0].Text == TriangleCharacter:
+			sc, err := scratchpad(strings.TrimPrefix(text, TriangleCharacter))
+			if err != nil {
+				return fp, err
+			}
+			fp.SC1 = sc
+
+		case f[0].Text == "+":
+			sc, err := scratchpad(text[1:])
+			if err != nil {
+				return fp, err
+			}
+			fp.SC2 = sc
+
+		case f[0].Type == TokenLetters || (len(f) > 1 && f[1].Text == "/"):
+			// Aircraft type: TYPE, TYPE/E, N/TYPE, or N/TYPE/E, where E is
+			// the equipment suffix and N is the number in a formation.
+			actype, err := parseAbbreviatedACType(text)
+			if err != nil {
+				return fp, err
+			}
+			if _, ok := av.DB.AircraftPerformance[actype]; !ok {
+				typeErr = sim.ErrIllegalACType
+			}
+			fp.AircraftType = text
+
+		default:
+			return fp, sim.ErrInvalidAbbreviatedFP
+		}
+	}
+
+	return fp, typeErr
+}
+
+// parseAbbreviatedACType returns the aircraft type from an aircraft type
+// field, without the formation count or equipment suffix.
+func parseAbbreviatedACType(s string) (string, error) {
+	isSuffix := func(s string) bool { return len(s) == 1 && util.IsAllLetters(s) }
+	isType := func(s string) bool { return len(s) >= 2 && len(s) <= 4 && util.IsAllLetters(s[:1]) }
+
+	f := strings.Split(s, "/")
+	switch {
+	case len(f) == 1 && isType(f[0]):
+		return f[0], nil
+	case len(f) == 2 && util.IsAllNumbers(f[0]) && isType(f[1]):
+		return f[1], nil
+	case len(f) == 2 && isType(f[0]) && isSuffix(f[1]):
+		return f[0], nil
+	case len(f) == 3 && util.IsAllNumbers(f[0]) && isType(f[1]) && isSuffix(f[2]):
+		return f[1], nil
+	default:
+		return "", sim.ErrInvalidAbbreviatedFP
+	}
+}
+
+// fieldText returns the text of the input corresponding to the tokens of
+// a field.
+func fieldText(input string, f []Token) string {
+	return input[f[0].Pos:f[len(f)-1].End()]
+}
+
+// MakeFlightPlanFromAbbreviated returns a STARS flight plan for an
+// abbreviated flight plan entry; a beacon code is assigned if one wasn't
+// given.
+func MakeFlightPlanFromAbbreviated(input string, comp *sim.STARSComputer, adapt av.STARSFacilityAdaptation,
+	r *rand.Rand) (*av.STARSFlightPlan, error) {
+	if strings.Contains(input, "*") {
+		// VFR FP; it's a required field
+		// TODO(mtrokel)
+		return nil, nil
+	}
+
+	afp, err := ParseAbbreviatedFlightPlan(input, adapt)
+	if err != nil && err != sim.ErrIllegalACType {
+		return nil, err
+	}
+
+	if afp.BCN == av.Squawk(0) {
+		var err error
+		if afp.BCN, err = comp.CreateSquawk(afp.ACID, r); err != nil {
+			return nil, err
+		}
+	}
+
+	fp := &av.STARSFlightPlan{ // TODO: Do single char ap parsing
+		FlightPlan: &av.FlightPlan{
+			Callsign:         afp.ACID,
+			Rules:            util.Select(afp.Rules == av.UNKNOWN, av.VFR, afp.Rules),
+			AircraftType:     afp.AircraftType,
+			DepartureAirport: afp.DepartureAirport,
+			AssignedSquawk:   afp.BCN,
+		},
+		Altitude: util.Select(afp.RequestedALT == 0, units.FlightDataAltitude{VFR: true},
+			units.MakeFlightDataAltitude(afp.RequestedALT)),
+		SP1:               afp.SC1,
+		SP2:               afp.SC2,
+		InitialController: afp.ControllingPosition,
+	}
+	return fp, err
+}
@@ -0,0 +1,117 @@
+// pkg/stars/flightplan_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package stars
+
+import (
+	"testing"
+
+	av "github.com/mmp/vice/pkg/aviation"
+	"github.com/mmp/vice/pkg/sim"
+)
+
+func init() {
+	av.DB = &av.StaticDatabase{
+		AircraftPerformance: map[string]av.AircraftPerformance{"B738": {}, "C172": {}},
+	}
+}
+
+func TestParseAbbreviatedFlightPlan(t *testing.T) {
+	type testcase struct {
+		input     string
+		longSP    bool
+		fp        AbbreviatedFlightPlan
+		err       error
+		checkFull bool // compare the flight plan even though there's an error
+	}
+	for _, test := range []testcase{
+		{input: "", err: sim.ErrInvalidAbbreviatedFP},
+		{input: "1ABC", err: sim.ErrIllegalACID},
+		{input: "A", err: sim.ErrIllegalACID},
+		{input: "ABCDEFGH", err: sim.ErrIllegalACID},
+		{input: "JBU123", fp: AbbreviatedFlightPlan{ACID: "JBU123"}},
+
+		// Beacon codes and altitudes
+		{input: "JBU123 1234", fp: AbbreviatedFlightPlan{ACID: "JBU123", BCN: 0o1234}},
+		{input: "JBU123 1238", err: sim.ErrInvalidAbbreviatedFP},
+		{input: "N123AB 045", fp: AbbreviatedFlightPlan{ACID: "N123AB", RequestedALT: 4500}},
+		{input: "N123AB 120", fp: AbbreviatedFlightPlan{ACID: "N123AB", RequestedALT: 12000}},
+
+		// Controlling position and type of flight
+		{input: "N123AB 1A", fp: AbbreviatedFlightPlan{ACID: "N123AB", ControllingPosition: "1A"}},
+		{input: "N123AB A", fp: AbbreviatedFlightPlan{ACID: "N123AB", TypeOfFlight: "arrival"}},
+		{input: "N123AB E", fp: AbbreviatedFlightPlan{ACID: "N123AB", TypeOfFlight: "overflight"}},
+		{input: "N123AB PK", fp: AbbreviatedFlightPlan{ACID: "N123AB", TypeOfFlight: "departure", DepartureAirport: "K"}},
+
+		// Flight rules
+		{input: "N123AB .V", fp: AbbreviatedFlightPlan{ACID: "N123AB", Rules: av.VFR}},
+		{input: "N123AB .P", fp: AbbreviatedFlightPlan{ACID: "N123AB", Rules: av.VFR}},
+		{input: "N123AB .E", fp: AbbreviatedFlightPlan{ACID: "N123AB", Rules: av.IFR}},
+		{input: "N123AB .X", err: sim.ErrInvalidAbbreviatedFP},
+
+		// Scratchpads
+		{input: "N123AB " + TriangleCharacter + "AB", fp: AbbreviatedFlightPlan{ACID: "N123AB", SC1: "AB"}},
+		{input: "N123AB +AB", fp: AbbreviatedFlightPlan{ACID: "N123AB", SC2: "AB"}},
+		{input: "N123AB +ABCD", err: sim.ErrIllegalScratchpad},
+		{input: "N123AB +ABCD", longSP: true, fp: AbbreviatedFlightPlan{ACID: "N123AB", SC2: "ABCD"}},
+		{input: "N123AB +123", err: sim.ErrIllegalScratchpad},
+		{input: "N123AB +NAT", err: sim.ErrIllegalScratchpad},
+		{input: "N123AB " + TriangleCharacter + "XXX", err: sim.ErrIllegalScratchpad},
+		{input: "N123AB +", err: sim.ErrIllegalScratchpad},
+
+		// Aircraft types
+		{input: "N123AB C172", fp: AbbreviatedFlightPlan{ACID: "N123AB", AircraftType: "C172"}},
+		{input: "JBU123 B738/L", fp: AbbreviatedFlightPlan{ACID: "JBU123", AircraftType: "B738/L"}},
+		{input: "JBU123 2/B738", fp: AbbreviatedFlightPlan{ACID: "JBU123", AircraftType: "2/B738"}},
+		{input: "JBU123 2/B738/L", fp: AbbreviatedFlightPlan{ACID: "JBU123", AircraftType: "2/B738/L"}},
+		{input: "JBU123 B738/LL", err: sim.ErrInvalidAbbreviatedFP},
+		{input: "JBU123 B738/L/X", err: sim.ErrInvalidAbbreviatedFP},
+		{input: "JBU123 2/F16 1234", err: sim.ErrIllegalACType, checkFull: true,
+			fp: AbbreviatedFlightPlan{ACID: "JBU123", AircraftType: "2/F16", BCN: 0o1234}},
+
+		// Everything, in no particular order
+		{input: "JBU123 .E 220 B738/L 1A +AB 1234 PK", fp: AbbreviatedFlightPlan{
+			ACID:                "JBU123",
+			BCN:                 0o1234,
+			ControllingPosition: "1A",
+			TypeOfFlight:        "departure",
+			DepartureAirport:    "K",
+			SC2:                 "AB",
+			AircraftType:        "B738/L",
+			RequestedALT:        22000,
+			Rules:               av.IFR,
+		}},
+	} {
+		fp, err := ParseAbbreviatedFlightPlan(test.input, av.STARSFacilityAdaptation{AllowLongScratchpad: test.longSP})
+		if err != test.err {
+			t.Errorf("%q: got error %v, expected %v", test.input, err, test.err)
+			continue
+		}
+		if (err == nil || test.checkFull) && fp != test.fp {
+			t.Errorf("%q: got %+v, expected %+v", test.input, fp, test.fp)
+		}
+	}
+}
+
+func TestMakeFlightPlanFromAbbreviated(t *testing.T) {
+	// With a beacon code given, no STARS computer is needed to assign one.
+	fp, err := MakeFlightPlanFromAbbreviated("JBU123 1234 B738 +AB "+TriangleCharacter+"CD 1A", nil,
+		av.STARSFacilityAdaptation{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fp.Callsign != "JBU123" || fp.AssignedSquawk != 0o1234 || fp.AircraftType != "B738" {
+		t.Errorf("got %+v", fp.FlightPlan)
+	}
+	if fp.SP1 != "CD" || fp.SP2 != "AB" || fp.InitialController != "1A" {
+		t.Errorf("got scratchpads %q/%q and controller %q", fp.SP1, fp.SP2, fp.InitialController)
+	}
+	if fp.Rules != av.VFR || !fp.Altitude.VFR {
+		t.Errorf("expected VFR flight plan with no requested altitude; got %v %+v", fp.Rules, fp.Altitude)
+	}
+
+	if _, err := MakeFlightPlanFromAbbreviated("1ABC", nil, av.STARSFacilityAdaptation{}, nil); err != sim.ErrIllegalACID {
+		t.Errorf("expected ErrIllegalACID; got %v", err)
+	}
+}
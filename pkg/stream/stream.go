@@ -0,0 +1,240 @@
+// pkg/stream/stream.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+// Package stream serves a running sim's live data over HTTP as JSON so
+// that browser overlays and dashboards can be built on top of it. It is
+// read-only. The endpoints are:
+//
+//	/tracks  the current tracks
+//	/stats   session statistics
+//	/stream  a stream of "tracks", "stats", and "event" messages
+//
+// The stream uses server-sent events (the text/event-stream content
+// type), which browsers support via EventSource without any libraries:
+//
+//	new EventSource("http://localhost:9001/stream")
+//	    .addEventListener("tracks", e => draw(JSON.parse(e.data)))
+//
+// Cross-origin requests are allowed so that overlays can be loaded from
+// anywhere, including local files.
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mmp/vice/pkg/log"
+)
+
+// Messages are dropped for clients that fall this far behind.
+const clientQueueLength = 256
+
+type Config struct {
+	Address string // e.g., "localhost:9001"
+}
+
+// Track is the JSON representation of an aircraft.
+type Track struct {
+	Callsign     string  `json:"callsign"`
+	AircraftType string  `json:"aircraft_type,omitempty"`
+	Rules        string  `json:"rules,omitempty"`
+	Departure    string  `json:"departure,omitempty"`
+	Arrival      string  `json:"arrival,omitempty"`
+	Squawk       string  `json:"squawk"`
+	Lat          float32 `json:"lat"`
+	Lon          float32 `json:"lon"`
+	Altitude     int     `json:"altitude"`     // feet
+	GroundSpeed  int     `json:"ground_speed"` // knots
+	Heading      int     `json:"heading"`      // magnetic
+	Owner        string  `json:"owner,omitempty"`
+	Controller   string  `json:"controller,omitempty"` // on frequency with
+}
+
+// Tracks is sent once a second.
+type Tracks struct {
+	Time   time.Time `json:"time"`
+	Tracks []Track   `json:"tracks"`
+}
+
+// Stats is sent once a second.
+type Stats struct {
+	Time        time.Time `json:"time"`
+	Facility    string    `json:"facility"`
+	Paused      bool      `json:"paused"`
+	Rate        float32   `json:"rate"`
+	Aircraft    int       `json:"aircraft"`
+	TotalIFR    int       `json:"total_ifr"` // launched so far
+	TotalVFR    int       `json:"total_vfr"`
+	Controllers []string  `json:"controllers"` // signed-in humans
+	Score       *float32  `json:"score,omitempty"`
+}
+
+// Event is sent for each of the sim's events; its type is named as for
+// scenario scripts (e.g., "accepted_handoff").
+type Event struct {
+	Time           time.Time `json:"time"`
+	Type           string    `json:"type"`
+	Callsign       string    `json:"callsign,omitempty"`
+	FromController string    `json:"from_controller,omitempty"`
+	ToController   string    `json:"to_controller,omitempty"`
+	Message        string    `json:"message,omitempty"`
+}
+
+// Server serves the data that it's given to HTTP clients.
+type Server struct {
+	lg       *log.Logger
+	listener net.Listener
+	http     *http.Server
+
+	mu      sync.Mutex
+	tracks  []byte
+	stats   []byte
+	clients map[chan []byte]struct{}
+}
+
+// Listen starts serving at the configured address.
+func Listen(config Config, lg *log.Logger) (*Server, error) {
+	l, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		lg:       lg,
+		listener: l,
+		tracks:   []byte("null"),
+		stats:    []byte("null"),
+		clients:  make(map[chan []byte]struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tracks", func(w http.ResponseWriter, r *http.Request) { s.serveLatest(w, &s.tracks) })
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) { s.serveLatest(w, &s.stats) })
+	mux.HandleFunc("/stream", s.serveStream)
+	s.http = &http.Server{Handler: mux}
+
+	go func() {
+		defer lg.CatchAndReportCrash()
+		if err := s.http.Serve(l); err != nil && err != http.ErrServerClosed {
+			lg.Errorf("stream: %v", err)
+		}
+	}()
+
+	lg.Infof("stream: serving at http://%s", l.Addr())
+	return s, nil
+}
+
+// Addr returns the address that the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *Server) serveLatest(w http.ResponseWriter, b *[]byte) {
+	s.mu.Lock()
+	data := *b
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(data)
+}
+
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	queue := make(chan []byte, clientQueueLength)
+	s.mu.Lock()
+	s.clients[queue] = struct{}{}
+	// Start the client off with the latest data.
+	queue <- encodeMessage("tracks", s.tracks)
+	queue <- encodeMessage("stats", s.stats)
+	s.mu.Unlock()
+	s.lg.Infof("stream: %s connected", r.RemoteAddr)
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, queue)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case msg := <-queue:
+			if _, err := w.Write(msg); err != nil {
+				s.lg.Infof("stream: %s: %v", r.RemoteAddr, err)
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// encodeMessage returns a server-sent event with the given name and JSON
+// data, which doesn't have any newlines.
+func encodeMessage(name string, data []byte) []byte {
+	return fmt.Appendf(nil, "event: %s\ndata: %s\n\n", name, data)
+}
+
+// SendTracks updates the tracks and sends them to streaming clients.
+func (s *Server) SendTracks(t Tracks) {
+	s.send("tracks", t, &s.tracks)
+}
+
+// SendStats updates the statistics and sends them to streaming clients.
+func (s *Server) SendStats(st Stats) {
+	s.send("stats", st, &s.stats)
+}
+
+// SendEvent sends the event to streaming clients.
+func (s *Server) SendEvent(e Event) {
+	s.send("event", e, nil)
+}
+
+func (s *Server) send(name string, v any, latest *[]byte) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		s.lg.Errorf("stream: %v", err)
+		return
+	}
+	msg := encodeMessage(name, b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if latest != nil {
+		*latest = b
+	}
+	for c := range s.clients {
+		select {
+		case c <- msg:
+		default:
+			// Don't let a slow client hold up the sim.
+		}
+	}
+}
+
+// NumClients returns the number of streaming clients that are connected.
+func (s *Server) NumClients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// Close stops the server and disconnects all of the clients.
+func (s *Server) Close() {
+	s.http.Close()
+}
@@ -0,0 +1,93 @@
+// pkg/stream/stream_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	s, err := Listen(Config{Address: "localhost:0"}, nil)
+	if err != nil {
+		t.Skipf("unable to listen: %v", err)
+	}
+	defer s.Close()
+
+	url := "http://" + s.Addr().String()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.SendTracks(Tracks{Time: now, Tracks: []Track{{Callsign: "AAL123", AircraftType: "B738", Altitude: 5000, GroundSpeed: 250}}})
+
+	resp, err := http.Get(url + "/tracks")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if h := resp.Header.Get("Access-Control-Allow-Origin"); h != "*" {
+		t.Errorf("expected CORS header, got %q", h)
+	}
+	var tr Tracks
+	if err := json.Unmarshal(b, &tr); err != nil {
+		t.Fatalf("%s: unexpected error %v", string(b), err)
+	}
+	if len(tr.Tracks) != 1 || tr.Tracks[0].Callsign != "AAL123" || !tr.Time.Equal(now) {
+		t.Errorf("got %s", string(b))
+	}
+	// Overlays read the JSON directly, so check the field names.
+	for _, f := range []string{`"aircraft_type":"B738"`, `"ground_speed":250`} {
+		if !strings.Contains(string(b), f) {
+			t.Errorf("%s: expected %s", string(b), f)
+		}
+	}
+
+	resp, err = http.Get(url + "/stream")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer resp.Body.Close()
+
+	for start := time.Now(); s.NumClients() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("client never connected")
+		}
+	}
+	s.SendEvent(Event{Time: now, Type: "accepted_handoff", Callsign: "AAL123", FromController: "2K", ToController: "4P"})
+
+	// The stream starts with the latest tracks and stats, then the event.
+	r := bufio.NewReader(resp.Body)
+	var names []string
+	var data string
+	for len(names) < 3 || data == "" {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			names = append(names, strings.TrimSpace(name))
+		} else if d, ok := strings.CutPrefix(line, "data: "); ok && len(names) == 3 {
+			data = d
+		}
+	}
+
+	if strings.Join(names, ",") != "tracks,stats,event" {
+		t.Errorf("got messages %v", names)
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		t.Fatalf("%s: unexpected error %v", data, err)
+	}
+	if e.Type != "accepted_handoff" || e.Callsign != "AAL123" || e.FromController != "2K" || e.ToController != "4P" {
+		t.Errorf("got %s", data)
+	}
+	if !strings.Contains(data, `"from_controller":"2K","to_controller":"4P"`) {
+		t.Errorf("%s: expected snake_case controller fields", data)
+	}
+}
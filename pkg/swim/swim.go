@@ -0,0 +1,232 @@
+// pkg/swim/swim.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+// Package swim exports flight data in the style of the FAA's SWIM feeds:
+// TFMS flight data messages and TAIS track messages. Messages are sent
+// over a local TCP socket, one per line, as either JSON or XML, to all of
+// the clients that are connected.
+package swim
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mmp/vice/pkg/log"
+)
+
+const (
+	FormatJSON = "json"
+	FormatXML  = "xml"
+
+	// Messages are dropped for clients that fall this far behind.
+	clientQueueLength = 1024
+)
+
+var ErrUnknownFormat = errors.New("Unknown export format")
+
+type Config struct {
+	Address string // e.g., "localhost:9000"
+	Format  string // FormatJSON or FormatXML
+}
+
+// FlightData corresponds to a TFMS flight plan message. It's sent when a
+// flight plan is filed or amended.
+type FlightData struct {
+	XMLName          xml.Name  `xml:"fltdMessage" json:"-"`
+	Type             string    `xml:"msgType,attr" json:"msgType"` // "FlightPlanInformation" or "FlightPlanAmendmentInformation"
+	Time             time.Time `xml:"sourceTimeStamp,attr" json:"sourceTimeStamp"`
+	Facility         string    `xml:"facility,attr" json:"facility"`
+	ACID             string    `xml:"acid,attr" json:"acid"`
+	AircraftType     string    `xml:"aircraftType" json:"aircraftType"`
+	Rules            string    `xml:"flightRules" json:"flightRules"`
+	Departure        string    `xml:"departurePoint" json:"departurePoint"`
+	Arrival          string    `xml:"arrivalPoint" json:"arrivalPoint"`
+	Route            string    `xml:"route" json:"route"`
+	RequestedAlt     int       `xml:"requestedAltitude" json:"requestedAltitude"`
+	AssignedAlt      int       `xml:"assignedAltitude,omitempty" json:"assignedAltitude,omitempty"`
+	CruiseSpeed      int       `xml:"speed" json:"speed"`
+	BeaconCode       string    `xml:"beaconCode,omitempty" json:"beaconCode,omitempty"`
+	ComputerID       string    `xml:"computerId,omitempty" json:"computerId,omitempty"`
+	CoordinationFix  string    `xml:"coordinationFix,omitempty" json:"coordinationFix,omitempty"`
+	EstimatedDepTime string    `xml:"etd,omitempty" json:"etd,omitempty"` // HHMM
+}
+
+// Track corresponds to a TAIS track message for a single aircraft. Tracks
+// are sent once per radar scan.
+type Track struct {
+	XMLName    xml.Name  `xml:"track" json:"-"`
+	Time       time.Time `xml:"time,attr" json:"time"`
+	Facility   string    `xml:"facility,attr" json:"facility"`
+	TrackNum   int       `xml:"trackNum" json:"trackNum"`
+	ACID       string    `xml:"acid,omitempty" json:"acid,omitempty"`
+	BeaconCode string    `xml:"reportedBeaconCode,omitempty" json:"reportedBeaconCode,omitempty"`
+	Lat        float32   `xml:"lat" json:"lat"`
+	Lon        float32   `xml:"lon" json:"lon"`
+	Altitude   int       `xml:"reportedAltitude" json:"reportedAltitude"` // feet
+	GS         int       `xml:"groundSpeed" json:"groundSpeed"`           // knots
+	Heading    int       `xml:"heading" json:"heading"`                   // true
+	VVert      int       `xml:"vVert" json:"vVert"`                       // feet per minute
+	Owner      string    `xml:"owner,omitempty" json:"owner,omitempty"`   // tracking controller
+	Handoff    string    `xml:"handoff,omitempty" json:"handoff,omitempty"`
+	Frozen     bool      `xml:"frozen,omitempty" json:"frozen,omitempty"`
+}
+
+// Server sends messages to the clients that connect to it.
+type Server struct {
+	format   string
+	lg       *log.Logger
+	listener net.Listener
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+}
+
+type client struct {
+	conn  net.Conn
+	queue chan []byte
+}
+
+// Listen starts accepting connections at the configured address.
+func Listen(config Config, lg *log.Logger) (*Server, error) {
+	if config.Format == "" {
+		config.Format = FormatJSON
+	}
+	if config.Format != FormatJSON && config.Format != FormatXML {
+		return nil, ErrUnknownFormat
+	}
+
+	l, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		format:   config.Format,
+		lg:       lg,
+		listener: l,
+		clients:  make(map[*client]struct{}),
+	}
+	go s.accept()
+
+	lg.Infof("swim: exporting %s at %s", config.Format, l.Addr())
+	return s, nil
+}
+
+// Addr returns the address that the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *Server) accept() {
+	defer s.lg.CatchAndReportCrash()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			// The listener was closed.
+			return
+		}
+
+		c := &client{conn: conn, queue: make(chan []byte, clientQueueLength)}
+		s.mu.Lock()
+		s.clients[c] = struct{}{}
+		s.mu.Unlock()
+		s.lg.Infof("swim: %s connected", conn.RemoteAddr())
+
+		go s.write(c)
+	}
+}
+
+func (s *Server) write(c *client) {
+	defer s.lg.CatchAndReportCrash()
+
+	for msg := range c.queue {
+		if _, err := c.conn.Write(msg); err != nil {
+			s.lg.Infof("swim: %s: %v", c.conn.RemoteAddr(), err)
+			s.remove(c)
+			return
+		}
+	}
+}
+
+func (s *Server) remove(c *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[c]; ok {
+		delete(s.clients, c)
+		c.conn.Close()
+		close(c.queue)
+	}
+}
+
+// Message is implemented by FlightData and Track.
+type Message interface {
+	// name is the XML element name, which is also used as the key of the
+	// object that holds the message in JSON.
+	name() string
+}
+
+func (FlightData) name() string { return "fltdMessage" }
+func (Track) name() string      { return "track" }
+
+// Send encodes the message and sends it to all of the connected clients.
+func (s *Server) Send(msg Message) error {
+	b, err := Encode(msg, s.format)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.clients {
+		select {
+		case c.queue <- b:
+		default:
+			// Don't let a slow client hold up the sim.
+		}
+	}
+	return nil
+}
+
+// Encode returns the message in the given format, not including a trailing
+// newline.
+func Encode(msg Message, format string) ([]byte, error) {
+	switch format {
+	case FormatXML:
+		return xml.Marshal(msg)
+	case FormatJSON:
+		return json.Marshal(map[string]Message{msg.name(): msg})
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// NumClients returns the number of clients that are connected.
+func (s *Server) NumClients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// Close stops accepting connections and disconnects all of the clients.
+func (s *Server) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range clients {
+		s.remove(c)
+	}
+}
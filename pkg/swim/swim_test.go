@@ -0,0 +1,114 @@
+// pkg/swim/swim_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package swim
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	tr := Track{Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), Facility: "N90", TrackNum: 12,
+		ACID: "AAL123", BeaconCode: "4521", Lat: 40.6, Lon: -73.7, Altitude: 5000, GS: 250, Heading: 270}
+
+	b, err := Encode(tr, FormatXML)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if s := string(b); !strings.HasPrefix(s, `<track time="2024-01-01T12:00:00Z" facility="N90">`) ||
+		!strings.Contains(s, "<acid>AAL123</acid>") || strings.Contains(s, "owner") {
+		t.Errorf("unexpected XML %s", s)
+	}
+
+	b, err = Encode(tr, FormatJSON)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var m map[string]Track
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("%s: unexpected error %v", string(b), err)
+	}
+	if got, ok := m["track"]; !ok || got.ACID != tr.ACID || got.Altitude != tr.Altitude || !got.Time.Equal(tr.Time) {
+		t.Errorf("got %s", string(b))
+	}
+
+	if _, err := Encode(tr, "csv"); err != ErrUnknownFormat {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	s, err := Listen(Config{Address: "localhost:0"}, nil)
+	if err != nil {
+		t.Skipf("unable to listen: %v", err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer conn.Close()
+
+	for start := time.Now(); s.NumClients() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("client never connected")
+		}
+	}
+
+	if err := s.Send(FlightData{ACID: "DAL456", Departure: "KJFK", Arrival: "KATL"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var m map[string]FlightData
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		t.Fatalf("%s: unexpected error %v", line, err)
+	}
+	if fd := m["fltdMessage"]; fd.ACID != "DAL456" || fd.Arrival != "KATL" {
+		t.Errorf("got %s", line)
+	}
+}
+
+// failingConn is a net.Conn whose writes all fail.
+type failingConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	c.writes++
+	return 0, errors.New("broken pipe")
+}
+
+func (c *failingConn) RemoteAddr() net.Addr { return &net.TCPAddr{} }
+func (c *failingConn) Close() error         { return nil }
+
+func TestWriteError(t *testing.T) {
+	conn := &failingConn{}
+	c := &client{conn: conn, queue: make(chan []byte, clientQueueLength)}
+	s := &Server{clients: map[*client]struct{}{c: {}}}
+	for range 3 {
+		c.queue <- []byte("{}\n")
+	}
+
+	s.write(c)
+
+	if conn.writes != 1 {
+		t.Errorf("%d writes after a write error, expected 1", conn.writes)
+	}
+	if n := s.NumClients(); n != 0 {
+		t.Errorf("%d clients after a write error, expected 0", n)
+	}
+}
@@ -0,0 +1,312 @@
+// pkg/units/units.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+// Package units provides typed quantities for the assorted altitudes,
+// distances, and speeds that otherwise get passed around as bare ints,
+// floats, and strings.
+package units
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidAltitude    = errors.New("Invalid altitude")
+	ErrInvalidFlightLevel = errors.New("Invalid flight level")
+	ErrInvalidSpeed       = errors.New("Invalid speed")
+	ErrInvalidDistance    = errors.New("Invalid distance")
+)
+
+const FeetPerNauticalMile = 6076.12
+
+// TransitionAltitude is the altitude at and above which altitudes are
+// expressed as flight levels in the US.
+const TransitionAltitude Feet = 18000
+
+///////////////////////////////////////////////////////////////////////////
+// Feet
+
+// Feet represents an altitude or height in feet (MSL, unless noted otherwise).
+type Feet float32
+
+// Hundreds returns the altitude in hundreds of feet, rounded to the
+// nearest hundred; this is the representation used in datablocks and NAS
+// messages.
+func (f Feet) Hundreds() int {
+	if f < 0 {
+		return -int((-f + 50) / 100)
+	}
+	return int((f + 50) / 100)
+}
+
+// FlightLevel returns the flight level corresponding to the altitude.
+func (f Feet) FlightLevel() FlightLevel {
+	return FlightLevel(f.Hundreds())
+}
+
+// String returns the altitude as it would be spoken or written by a
+// controller: flight levels at or above the transition altitude and
+// thousands/hundreds below it.
+func (f Feet) String() string {
+	alt := int(f)
+	if f >= TransitionAltitude {
+		return f.FlightLevel().String()
+	} else if alt < 1000 {
+		return strconv.Itoa(alt)
+	} else {
+		th := alt / 1000
+		hu := (alt % 1000) / 100 * 100
+		if hu == 0 {
+			return strconv.Itoa(th) + ",000"
+		} else {
+			return fmt.Sprintf("%d,%03d", th, hu)
+		}
+	}
+}
+
+// ParseFeet parses an altitude given either in feet ("12000"), as a flight
+// level ("FL310"), or as a three-digit number of hundreds of feet ("070",
+// "310").
+func ParseFeet(s string) (Feet, error) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	if strings.HasPrefix(s, "FL") {
+		fl, err := ParseFlightLevel(s)
+		if err != nil {
+			return 0, err
+		}
+		return fl.Feet(), nil
+	}
+
+	alt, err := strconv.Atoi(s)
+	if err != nil || alt < 0 {
+		return 0, ErrInvalidAltitude
+	}
+	if len(s) <= 3 {
+		alt *= 100
+	}
+	return Feet(alt), nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+// FlightLevel
+
+// FlightLevel represents a pressure altitude in hundreds of feet.
+type FlightLevel int
+
+func (fl FlightLevel) Feet() Feet {
+	return Feet(100 * fl)
+}
+
+func (fl FlightLevel) String() string {
+	return fmt.Sprintf("FL%03d", int(fl))
+}
+
+// ParseFlightLevel parses flight levels given either as "FL310" or "310".
+func ParseFlightLevel(s string) (FlightLevel, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(strings.ToUpper(s)), "FL")
+	if len(s) == 0 || len(s) > 3 {
+		return 0, ErrInvalidFlightLevel
+	}
+	fl, err := strconv.Atoi(s)
+	if err != nil || fl < 0 {
+		return 0, ErrInvalidFlightLevel
+	}
+	return FlightLevel(fl), nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+// NauticalMiles
+
+type NauticalMiles float32
+
+func (nm NauticalMiles) Feet() Feet {
+	return Feet(nm * FeetPerNauticalMile)
+}
+
+func (nm NauticalMiles) String() string {
+	return strconv.FormatFloat(float64(nm), 'f', -1, 32) + "nm"
+}
+
+// ParseNauticalMiles parses a distance like "5", "2.5", or "2.5NM".
+func ParseNauticalMiles(s string) (NauticalMiles, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(strings.ToUpper(s)), "NM")
+	d, err := strconv.ParseFloat(s, 32)
+	if err != nil || d < 0 {
+		return 0, ErrInvalidDistance
+	}
+	return NauticalMiles(d), nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+// Knots
+
+type Knots float32
+
+// Distance returns the distance covered at the speed over the given
+// duration.
+func (k Knots) Distance(d time.Duration) NauticalMiles {
+	return NauticalMiles(float64(k) * d.Hours())
+}
+
+// TimeToFly returns the time it takes to cover the given distance at the
+// speed; zero is returned for zero or negative speeds.
+func (k Knots) TimeToFly(nm NauticalMiles) time.Duration {
+	if k <= 0 {
+		return 0
+	}
+	return time.Duration(float64(nm) / float64(k) * float64(time.Hour))
+}
+
+func (k Knots) String() string {
+	return strconv.Itoa(int(k+0.5)) + "kts"
+}
+
+// ParseKnots parses a speed like "250" or "250KTS".
+func ParseKnots(s string) (Knots, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(strings.ToUpper(s)), "KTS")
+	k, err := strconv.Atoi(s)
+	if err != nil || k < 0 {
+		return 0, ErrInvalidSpeed
+	}
+	return Knots(k), nil
+}
+
+///////////////////////////////////////////////////////////////////////////
+// FlightDataAltitude
+
+// FlightDataAltitude is the altitude field of a NAS flight plan: either a
+// single altitude ("310"), a block altitude ("170B210"), or VFR, possibly
+// with a requested altitude ("VFR", "VFR/065"). Altitudes are formatted
+// in hundreds of feet, as they are in NAS messages.
+type FlightDataAltitude struct {
+	Low  Feet
+	High Feet // Same as Low unless it's a block altitude
+	VFR  bool
+}
+
+// MakeFlightDataAltitude returns a FlightDataAltitude for a single IFR
+// altitude.
+func MakeFlightDataAltitude(alt Feet) FlightDataAltitude {
+	return FlightDataAltitude{Low: alt, High: alt}
+}
+
+// ParseFlightDataAltitude parses a flight plan altitude field. For
+// compatibility with older saved sims, altitudes of four or more digits
+// are interpreted as feet rather than hundreds of feet.
+func ParseFlightDataAltitude(s string) (FlightDataAltitude, error) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	if s == "" {
+		return FlightDataAltitude{}, nil
+	}
+
+	var fa FlightDataAltitude
+	if rest, ok := strings.CutPrefix(s, "VFR"); ok {
+		fa.VFR = true
+		if rest == "" {
+			return fa, nil
+		} else if rest[0] != '/' {
+			return FlightDataAltitude{}, ErrInvalidAltitude
+		}
+		s = rest[1:]
+	}
+
+	if low, high, ok := strings.Cut(s, "B"); ok {
+		var err error
+		if fa.Low, err = ParseFeet(low); err != nil {
+			return FlightDataAltitude{}, err
+		}
+		if fa.High, err = ParseFeet(high); err != nil {
+			return FlightDataAltitude{}, err
+		}
+		if fa.High < fa.Low {
+			return FlightDataAltitude{}, ErrInvalidAltitude
+		}
+		return fa, nil
+	}
+
+	alt, err := ParseFeet(s)
+	if err != nil {
+		return FlightDataAltitude{}, err
+	}
+	fa.Low, fa.High = alt, alt
+	return fa, nil
+}
+
+// IsSet returns true if either an altitude or VFR has been specified.
+func (fa FlightDataAltitude) IsSet() bool {
+	return fa.VFR || fa.Low != 0 || fa.High != 0
+}
+
+// HasAltitude returns true if an actual altitude is specified (vs. e.g.
+// just "VFR").
+func (fa FlightDataAltitude) HasAltitude() bool {
+	return fa.Low != 0 || fa.High != 0
+}
+
+func (fa FlightDataAltitude) IsBlock() bool {
+	return fa.High != fa.Low
+}
+
+// Feet returns the altitude to use for things like coordination fix
+// selection; for block altitudes, it is the lower altitude of the block.
+func (fa FlightDataAltitude) Feet() (Feet, error) {
+	if !fa.HasAltitude() {
+		return 0, ErrInvalidAltitude
+	}
+	return fa.Low, nil
+}
+
+// Contains returns true if the given altitude is within the assigned
+// altitude (or block) to the nearest hundred feet.
+func (fa FlightDataAltitude) Contains(alt Feet) bool {
+	h := alt.Hundreds()
+	return h >= fa.Low.Hundreds() && h <= fa.High.Hundreds()
+}
+
+// String returns the altitude formatted as it is in NAS messages.
+func (fa FlightDataAltitude) String() string {
+	var alt string
+	if fa.HasAltitude() {
+		alt = fmt.Sprintf("%03d", fa.Low.Hundreds())
+		if fa.IsBlock() {
+			alt += fmt.Sprintf("B%03d", fa.High.Hundreds())
+		}
+	}
+
+	if fa.VFR {
+		if alt == "" {
+			return "VFR"
+		}
+		return "VFR/" + alt
+	}
+	return alt
+}
+
+func (fa FlightDataAltitude) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fa.String())
+}
+
+func (fa *FlightDataAltitude) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	var err error
+	*fa, err = ParseFlightDataAltitude(s)
+	return err
+}
+
+func (fa *FlightDataAltitude) CheckJSON(json interface{}) bool {
+	s, ok := json.(string)
+	if !ok {
+		return false
+	}
+	_, err := ParseFlightDataAltitude(s)
+	return err == nil
+}
@@ -0,0 +1,147 @@
+// pkg/units/units_test.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package units
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFeet(t *testing.T) {
+	for _, c := range []struct {
+		f        Feet
+		s        string
+		hundreds int
+	}{{500, "500", 5}, {4000, "4,000", 40}, {12300, "12,300", 123}, {17999, "17,900", 180},
+		{18000, "FL180", 180}, {18050, "FL181", 181}, {31000, "FL310", 310}, {-40, "-40", 0}} {
+		if c.f.String() != c.s {
+			t.Errorf("%f: got string %q, expected %q", c.f, c.f.String(), c.s)
+		}
+		if c.f.Hundreds() != c.hundreds {
+			t.Errorf("%f: got hundreds %d, expected %d", c.f, c.f.Hundreds(), c.hundreds)
+		}
+	}
+
+	for _, c := range []struct {
+		s  string
+		f  Feet
+		ok bool
+	}{{"12000", 12000, true}, {"070", 7000, true}, {"310", 31000, true}, {"FL240", 24000, true},
+		{"fl80", 8000, true}, {"", 0, false}, {"FL", 0, false}, {"abc", 0, false}, {"-100", 0, false}} {
+		f, err := ParseFeet(c.s)
+		if c.ok && err != nil {
+			t.Errorf("%q: unexpected error %v", c.s, err)
+		} else if !c.ok && err == nil {
+			t.Errorf("%q: expected error; got %f", c.s, f)
+		} else if f != c.f {
+			t.Errorf("%q: got %f, expected %f", c.s, f, c.f)
+		}
+	}
+}
+
+func TestFlightLevel(t *testing.T) {
+	if fl := Feet(23470).FlightLevel(); fl != 235 {
+		t.Errorf("got flight level %d, expected 235", fl)
+	}
+	if FlightLevel(90).String() != "FL090" {
+		t.Errorf("got %q, expected FL090", FlightLevel(90).String())
+	}
+	if fl, err := ParseFlightLevel("FL350"); err != nil || fl != 350 {
+		t.Errorf("FL350: got %d, %v", fl, err)
+	}
+	if _, err := ParseFlightLevel("FL3500"); err == nil {
+		t.Errorf("FL3500: expected error")
+	}
+}
+
+func TestSpeedDistance(t *testing.T) {
+	if d := Knots(240).Distance(30 * time.Second); d != 2 {
+		t.Errorf("240kts for 30s: got %f, expected 2nm", d)
+	}
+	if tt := Knots(180).TimeToFly(6); tt != 2*time.Minute {
+		t.Errorf("6nm at 180kts: got %s, expected 2m", tt)
+	}
+	if tt := Knots(0).TimeToFly(6); tt != 0 {
+		t.Errorf("0kts: got %s, expected 0", tt)
+	}
+	if k, err := ParseKnots("250KTS"); err != nil || k != 250 {
+		t.Errorf("250KTS: got %f, %v", k, err)
+	}
+	if nm, err := ParseNauticalMiles("2.5nm"); err != nil || nm != 2.5 {
+		t.Errorf("2.5nm: got %f, %v", nm, err)
+	}
+	if f := NauticalMiles(1).Feet(); f != FeetPerNauticalMile {
+		t.Errorf("1nm: got %f feet", f)
+	}
+}
+
+func TestFlightDataAltitude(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		fa   FlightDataAltitude
+		str  string
+		fail bool
+	}{
+		{s: "", fa: FlightDataAltitude{}, str: ""},
+		{s: "310", fa: FlightDataAltitude{Low: 31000, High: 31000}, str: "310"},
+		{s: "070", fa: FlightDataAltitude{Low: 7000, High: 7000}, str: "070"},
+		{s: "31000", fa: FlightDataAltitude{Low: 31000, High: 31000}, str: "310"},
+		{s: "VFR", fa: FlightDataAltitude{VFR: true}, str: "VFR"},
+		{s: "VFR/065", fa: FlightDataAltitude{Low: 6500, High: 6500, VFR: true}, str: "VFR/065"},
+		{s: "170B210", fa: FlightDataAltitude{Low: 17000, High: 21000}, str: "170B210"},
+		{s: "VFRX", fail: true},
+		{s: "210B170", fail: true},
+		{s: "OTP", fail: true},
+	} {
+		fa, err := ParseFlightDataAltitude(c.s)
+		if c.fail {
+			if err == nil {
+				t.Errorf("%q: expected error, got %+v", c.s, fa)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", c.s, err)
+		} else if fa != c.fa {
+			t.Errorf("%q: got %+v, expected %+v", c.s, fa, c.fa)
+		} else if fa.String() != c.str {
+			t.Errorf("%q: got string %q, expected %q", c.s, fa.String(), c.str)
+		}
+	}
+
+	block := FlightDataAltitude{Low: 17000, High: 21000}
+	if !block.Contains(19000) || !block.Contains(17040) || block.Contains(21100) {
+		t.Errorf("block altitude containment incorrect")
+	}
+	if alt, err := block.Feet(); err != nil || alt != 17000 {
+		t.Errorf("block altitude: got %f, %v; expected 17000", alt, err)
+	}
+	if _, err := (FlightDataAltitude{VFR: true}).Feet(); err == nil {
+		t.Errorf("VFR without altitude: expected error from Feet()")
+	}
+}
+
+func TestFlightDataAltitudeJSON(t *testing.T) {
+	type fp struct {
+		Altitude FlightDataAltitude
+	}
+
+	b, err := json.Marshal(fp{Altitude: FlightDataAltitude{Low: 6500, High: 6500, VFR: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"Altitude":"VFR/065"}` {
+		t.Errorf("got JSON %s", string(b))
+	}
+
+	// Legacy saved sims store the altitude in feet.
+	var f fp
+	if err := json.Unmarshal([]byte(`{"Altitude":"12000"}`), &f); err != nil {
+		t.Error(err)
+	} else if f.Altitude != MakeFlightDataAltitude(12000) {
+		t.Errorf("got %+v", f.Altitude)
+	}
+}
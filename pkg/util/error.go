@@ -7,6 +7,7 @@ package util
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/mmp/vice/pkg/log"
@@ -56,6 +57,11 @@ func (e *ErrorLogger) PrintErrors(lg *log.Logger) {
 	}
 }
 
+// Errors returns a copy of all of the errors that have been logged.
+func (e *ErrorLogger) Errors() []string {
+	return slices.Clone(e.errors)
+}
+
 func (e *ErrorLogger) String() string {
 	return strings.Join(e.errors, "\n")
 }
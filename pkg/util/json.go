@@ -5,10 +5,12 @@
 package util
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"reflect"
+	"slices"
 	"strings"
 )
 
@@ -174,3 +176,274 @@ func typeCheckJSON(json interface{}, ty reflect.Type, structTypeCache map[reflec
 		}
 	}
 }
+
+///////////////////////////////////////////////////////////////////////////
+// PatchJSON
+
+// PatchJSON returns a copy of the JSON document doc where the value at the
+// given path has been replaced with the JSON encoding of value. Path
+// elements are either object keys (strings) or array indices (ints). If
+// trailing keys of the path aren't present, they are added at the end of
+// their enclosing object. The rest of the document is left as is, so that
+// hand-edited files keep their key ordering and formatting.
+func PatchJSON(doc []byte, path []interface{}, value interface{}) ([]byte, error) {
+	p := jsonPatcher{doc: doc}
+	start := p.skipSpace(0)
+
+	for i, elem := range path {
+		switch e := elem.(type) {
+		case string:
+			if start >= len(doc) || doc[start] != '{' {
+				return nil, fmt.Errorf("%s: not a JSON object", p.pathString(path[:i]))
+			}
+			vstart, insert, err := p.findKey(start, e)
+			if err != nil {
+				return nil, err
+			}
+			if vstart == -1 {
+				// Missing; nest the value in objects for any remaining
+				// keys and add it to this one.
+				for j := len(path) - 1; j > i; j-- {
+					k, ok := path[j].(string)
+					if !ok {
+						return nil, fmt.Errorf("%s: not found", p.pathString(path[:j]))
+					}
+					value = map[string]interface{}{k: value}
+				}
+				return p.insert(start, insert, e, value)
+			}
+			start = vstart
+
+		case int:
+			if start >= len(doc) || doc[start] != '[' {
+				return nil, fmt.Errorf("%s: not a JSON array", p.pathString(path[:i]))
+			}
+			vstart, err := p.findIndex(start, e)
+			if err != nil {
+				return nil, err
+			}
+			if vstart == -1 {
+				return nil, fmt.Errorf("%s: index out of range", p.pathString(path[:i+1]))
+			}
+			start = vstart
+
+		default:
+			return nil, fmt.Errorf("%v: invalid path element", elem)
+		}
+	}
+
+	end, err := p.valueEnd(start)
+	if err != nil {
+		return nil, err
+	}
+	// Keep values that were on a single line that way.
+	b, err := p.encode(value, p.lineIndent(start), slices.Contains(doc[start:end], '\n'))
+	if err != nil {
+		return nil, err
+	}
+	return slices.Concat(doc[:start], b, doc[end:]), nil
+}
+
+type jsonPatcher struct {
+	doc []byte
+}
+
+func (p *jsonPatcher) pathString(path []interface{}) string {
+	var s []string
+	for _, e := range path {
+		s = append(s, fmt.Sprintf("%v", e))
+	}
+	return "/" + strings.Join(s, "/")
+}
+
+func (p *jsonPatcher) skipSpace(i int) int {
+	for i < len(p.doc) && strings.IndexByte(" \t\r\n", p.doc[i]) != -1 {
+		i++
+	}
+	return i
+}
+
+// valueEnd returns the offset just past the end of the value that starts
+// at offset i.
+func (p *jsonPatcher) valueEnd(i int) (int, error) {
+	if i >= len(p.doc) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	switch p.doc[i] {
+	case '"':
+		for j := i + 1; j < len(p.doc); j++ {
+			if p.doc[j] == '\\' {
+				j++
+			} else if p.doc[j] == '"' {
+				return j + 1, nil
+			}
+		}
+		return 0, io.ErrUnexpectedEOF
+
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(p.doc); j++ {
+			switch p.doc[j] {
+			case '"':
+				end, err := p.valueEnd(j)
+				if err != nil {
+					return 0, err
+				}
+				j = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, io.ErrUnexpectedEOF
+
+	default: // number, true, false, null
+		j := i
+		for j < len(p.doc) && strings.IndexByte(",}] \t\r\n", p.doc[j]) == -1 {
+			j++
+		}
+		return j, nil
+	}
+}
+
+// findKey returns the offset of the value for the given key in the object
+// starting at offset i. If the key isn't present, it returns -1 and the
+// offset where a new member should be inserted: just past the end of the
+// last member or just past the opening brace if the object is empty.
+func (p *jsonPatcher) findKey(i int, key string) (int, int, error) {
+	insert := i + 1
+	i = p.skipSpace(i + 1)
+	for i < len(p.doc) && p.doc[i] != '}' {
+		kend, err := p.valueEnd(i)
+		if err != nil {
+			return 0, 0, err
+		}
+		var k string
+		if err := json.Unmarshal(p.doc[i:kend], &k); err != nil {
+			return 0, 0, err
+		}
+
+		i = p.skipSpace(kend)
+		if i >= len(p.doc) || p.doc[i] != ':' {
+			return 0, 0, fmt.Errorf("%q: expected ':' after key", k)
+		}
+		vstart := p.skipSpace(i + 1)
+		if k == key {
+			return vstart, 0, nil
+		}
+
+		vend, err := p.valueEnd(vstart)
+		if err != nil {
+			return 0, 0, err
+		}
+		insert = vend
+		if i = p.skipSpace(vend); i < len(p.doc) && p.doc[i] == ',' {
+			i = p.skipSpace(i + 1)
+		}
+	}
+	if i >= len(p.doc) {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	return -1, insert, nil
+}
+
+// findIndex returns the offset of the given element of the array starting
+// at offset i, or -1 if it has fewer elements.
+func (p *jsonPatcher) findIndex(i int, index int) (int, error) {
+	i = p.skipSpace(i + 1)
+	for n := 0; i < len(p.doc) && p.doc[i] != ']'; n++ {
+		if n == index {
+			return i, nil
+		}
+		end, err := p.valueEnd(i)
+		if err != nil {
+			return 0, err
+		}
+		if i = p.skipSpace(end); i < len(p.doc) && p.doc[i] == ',' {
+			i = p.skipSpace(i + 1)
+		}
+	}
+	if i >= len(p.doc) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return -1, nil
+}
+
+// insert adds a new member to the object starting at offset obj at the
+// given offset, following the layout of the object's existing members.
+func (p *jsonPatcher) insert(obj, at int, key string, value interface{}) ([]byte, error) {
+	empty := at == obj+1
+	end := p.skipSpace(at)
+	multiline := slices.Contains(p.doc[obj:end], '\n')
+
+	indent := ""
+	if multiline {
+		indent = Select(empty, p.lineIndent(obj)+p.indentUnit(), p.lineIndent(at-1))
+	}
+	b, err := p.encode(value, indent, multiline)
+	if err != nil {
+		return nil, err
+	}
+	kb, _ := json.Marshal(key)
+
+	var member []byte
+	if multiline {
+		member = slices.Concat([]byte(Select(empty, "\n", ",\n")), []byte(indent), kb, []byte(": "), b)
+		if empty {
+			member = append(member, '\n')
+			member = append(member, p.lineIndent(obj)...)
+		}
+	} else {
+		member = slices.Concat([]byte(Select(empty, " ", ", ")), kb, []byte(": "), b)
+		if empty {
+			member = append(member, ' ')
+		}
+	}
+	return slices.Concat(p.doc[:at], member, p.doc[at:]), nil
+}
+
+// lineIndent returns the leading whitespace of the line that includes
+// offset i.
+func (p *jsonPatcher) lineIndent(i int) string {
+	start := i
+	for start > 0 && p.doc[start-1] != '\n' {
+		start--
+	}
+	end := start
+	for end < len(p.doc) && (p.doc[end] == ' ' || p.doc[end] == '\t') {
+		end++
+	}
+	return string(p.doc[start:end])
+}
+
+// indentUnit returns the indentation of the first indented line of the
+// document.
+func (p *jsonPatcher) indentUnit() string {
+	for i := range p.doc {
+		if i > 0 && p.doc[i-1] == '\n' {
+			if s := p.lineIndent(i); s != "" {
+				return s
+			}
+		}
+	}
+	return "    "
+}
+
+// encode returns the JSON encoding of value; if multiline is set, it is
+// indented to start at the given indentation.
+func (p *jsonPatcher) encode(value interface{}, indent string, multiline bool) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if multiline {
+		enc.SetIndent(indent, p.indentUnit())
+	}
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
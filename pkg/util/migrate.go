@@ -0,0 +1,59 @@
+// pkg/util/migrate.go
+// Copyright(c) 2022-2024 vice contributors, licensed under the GNU Public License, Version 3.
+// SPDX: GPL-3.0-only
+
+package util
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Migration is a single step in upgrading a saved value (the config, a
+// pane, its preferences, ...) to the current representation: Apply is
+// run for values that were saved before Version.
+type Migration[T any] struct {
+	Version     int // the config version that introduced the change
+	Description string
+	Apply       func(T)
+}
+
+// Migrations holds the migration steps for a type, in version order.
+type Migrations[T any] []Migration[T]
+
+// NewMigrations returns Migrations with the given steps, which must be
+// sorted by version; it panics if they are not. Steps with the same
+// version are run in the order given.
+func NewMigrations[T any](steps ...Migration[T]) Migrations[T] {
+	if !slices.IsSortedFunc(steps, func(a, b Migration[T]) int { return a.Version - b.Version }) {
+		panic("migration steps are not sorted by version")
+	}
+	for _, m := range steps {
+		if m.Apply == nil {
+			panic(fmt.Sprintf("version %d migration %q has no Apply function", m.Version, m.Description))
+		}
+	}
+	return Migrations[T](steps)
+}
+
+// Apply runs the migration steps needed to upgrade v from version from to
+// version to: those with from < Version <= to. It returns the
+// descriptions of the steps that were run.
+func (m Migrations[T]) Apply(v T, from, to int) []string {
+	var applied []string
+	for _, step := range m {
+		if step.Version > from && step.Version <= to {
+			step.Apply(v)
+			applied = append(applied, step.Description)
+		}
+	}
+	return applied
+}
+
+// Latest returns the most recent version that has a migration step.
+func (m Migrations[T]) Latest() int {
+	if len(m) == 0 {
+		return 0
+	}
+	return m[len(m)-1].Version
+}
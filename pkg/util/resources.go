@@ -40,6 +40,7 @@ func initResourcesFS() *fs.StatFS {
 	}
 
 	if check(fsys) {
+		resourcesDir = dir
 		return &fsys
 	}
 
@@ -58,6 +59,7 @@ func initResourcesFS() *fs.StatFS {
 		}
 
 		if check(fsys) {
+			resourcesDir = dir
 			return &fsys
 		}
 	}
@@ -65,6 +67,7 @@ func initResourcesFS() *fs.StatFS {
 }
 
 var resourcesFS *fs.StatFS
+var resourcesDir string
 
 func init() {
 	resourcesFS = initResourcesFS()
@@ -74,6 +77,12 @@ func GetResourcesFS() fs.StatFS {
 	return *resourcesFS
 }
 
+// GetResourcesDirectory returns the path to the resources directory, for
+// the rare cases where files there need to be written.
+func GetResourcesDirectory() string {
+	return resourcesDir
+}
+
 // Unfortunately, unlike io.ReadCloser, the zstd Decoder's Close() method
 // doesn't return an error, so we need to make our own custom ReadCloser
 // interface.
@@ -7,6 +7,7 @@ package util
 import (
 	"encoding/json"
 	"log/slog"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -116,3 +117,40 @@ func (l *LoggingMutex) LogValue() slog.Value {
 		slog.Duration("held", time.Since(l.acq)),
 		slog.Any("acq_stack", l.acqStack))
 }
+
+///////////////////////////////////////////////////////////////////////////
+// ParallelFor
+
+// ParallelFor calls f for each i in [0,n) using a pool of up to workers
+// goroutines (or runtime.GOMAXPROCS if workers is zero), returning once
+// all of the calls have completed. The calls may happen in any order, so
+// f should only modify state that is specific to i.
+func ParallelFor(n, workers int, f func(i int)) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, n)
+	if workers <= 1 {
+		for i := range n {
+			f(i)
+		}
+		return
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				f(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
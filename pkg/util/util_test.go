@@ -5,6 +5,7 @@
 package util
 
 import (
+	"encoding/json"
 	"slices"
 	"strings"
 	"testing"
@@ -41,3 +42,119 @@ func TestHash(t *testing.T) {
 		t.Errorf("hash mismatch")
 	}
 }
+
+func TestPatchJSON(t *testing.T) {
+	doc := `{
+  "tracon": "N90",
+  "airports": {
+    "KJFK": { "tower_cab_height": 300 },
+    "KLGA": {
+      "atpa_volumes": {
+        "22": { "heading": 220, "length": 15 }
+      },
+      "name": "La Guardia"
+    }
+  },
+  "fixes": ["A", "B\"]", "C"]
+}`
+
+	for _, test := range []struct {
+		path   []interface{}
+		value  interface{}
+		expect string
+	}{
+		{path: []interface{}{"tracon"}, value: "A90",
+			expect: `"tracon": "A90",`},
+		{path: []interface{}{"airports", "KLGA", "atpa_volumes", "22", "length"}, value: 12.5,
+			expect: `"22": { "heading": 220, "length": 12.5 }`},
+		{path: []interface{}{"fixes", 2}, value: "D",
+			expect: `"fixes": ["A", "B\"]", "D"]`},
+		// New keys follow the layout of their object.
+		{path: []interface{}{"airports", "KJFK", "tower_cab"}, value: "KJFK",
+			expect: `"KJFK": { "tower_cab_height": 300, "tower_cab": "KJFK" },`},
+		{path: []interface{}{"airports", "KLGA", "departure_controller"}, value: "2W",
+			expect: "\"name\": \"La Guardia\",\n      \"departure_controller\": \"2W\"\n    }"},
+		{path: []interface{}{"airports", "KLGA", "atpa_volumes", "31", "heading"}, value: 310,
+			expect: "},\n        \"31\": {\n          \"heading\": 310\n        }\n      },"},
+	} {
+		b, err := PatchJSON([]byte(doc), test.path, test.value)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.path, err)
+			continue
+		}
+		if !strings.Contains(string(b), test.expect) {
+			t.Errorf("%v: expected %q in result:\n%s", test.path, test.expect, string(b))
+		}
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			t.Errorf("%v: invalid JSON %v:\n%s", test.path, err, string(b))
+		}
+	}
+
+	for _, path := range [][]interface{}{{"fixes", 3}, {"tracon", "x"}, {"fixes", 0, "x"}} {
+		if _, err := PatchJSON([]byte(doc), path, 1); err == nil {
+			t.Errorf("%v: expected error", path)
+		}
+	}
+}
+
+func TestParallelFor(t *testing.T) {
+	for _, n := range []int{0, 1, 7, 1000} {
+		for _, workers := range []int{0, 1, 3, 64} {
+			counts := make([]int, n)
+			ParallelFor(n, workers, func(i int) { counts[i]++ })
+			if i := slices.IndexFunc(counts, func(c int) bool { return c != 1 }); i != -1 {
+				t.Errorf("n=%d workers=%d: index %d called %d times", n, workers, i, counts[i])
+			}
+		}
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	type config struct {
+		Size   int
+		Colors []string
+	}
+	step := func(v int, desc string, f func(*config)) Migration[*config] {
+		return Migration[*config]{Version: v, Description: desc, Apply: f}
+	}
+	m := NewMigrations(
+		step(3, "double size", func(c *config) { c.Size *= 2 }),
+		step(5, "add red", func(c *config) { c.Colors = append(c.Colors, "red") }),
+		step(5, "add blue", func(c *config) { c.Colors = append(c.Colors, "blue") }),
+		step(8, "clamp size", func(c *config) { c.Size = min(c.Size, 10) }))
+
+	if m.Latest() != 8 {
+		t.Errorf("Latest: got %d, expected 8", m.Latest())
+	}
+
+	for _, test := range []struct {
+		from, to int
+		expected config
+		steps    []string
+	}{
+		{from: 0, to: 8, expected: config{Size: 10, Colors: []string{"red", "blue"}},
+			steps: []string{"double size", "add red", "add blue", "clamp size"}},
+		{from: 3, to: 8, expected: config{Size: 7, Colors: []string{"red", "blue"}},
+			steps: []string{"add red", "add blue", "clamp size"}},
+		{from: 2, to: 4, expected: config{Size: 14}, steps: []string{"double size"}},
+		{from: 5, to: 7, expected: config{Size: 7}},
+		{from: 8, to: 8, expected: config{Size: 7}},
+	} {
+		c := config{Size: 7}
+		steps := m.Apply(&c, test.from, test.to)
+		if c.Size != test.expected.Size || !slices.Equal(c.Colors, test.expected.Colors) {
+			t.Errorf("%d->%d: got %+v, expected %+v", test.from, test.to, c, test.expected)
+		}
+		if !slices.Equal(steps, test.steps) {
+			t.Errorf("%d->%d: applied %q, expected %q", test.from, test.to, steps, test.steps)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic for unsorted migrations")
+		}
+	}()
+	NewMigrations(step(5, "b", func(*config) {}), step(3, "a", func(*config) {}))
+}
@@ -20,6 +20,9 @@ type Stats struct {
 	drawUI    renderer.RendererStats
 	startTime time.Time
 	redraws   int
+	// Redraws at the reduced rate for when there's no user input; see
+	// pacing.go.
+	idleRedraws int
 }
 
 var startupMallocs uint64
@@ -37,6 +40,7 @@ func (stats Stats) LogValue(lg *log.Logger) slog.Value {
 
 	return slog.GroupValue(
 		slog.Float64("redraws_per_second", float64(stats.redraws)/time.Since(stats.startTime).Seconds()),
+		slog.Int("idle_redraws", stats.idleRedraws),
 		slog.Float64("mallocs_per_second", mallocsPerSecond),
 		slog.Int64("active_mallocs", int64(mem.Mallocs-mem.Frees)),
 		slog.Int64("memory_in_use", int64(mem.HeapAlloc)),
@@ -57,6 +57,11 @@ var (
 		showSettings      bool
 		showScenarioInfo  bool
 		showLaunchControl bool
+		showScore         bool
+
+		scoreWindow *ScoreWindow
+
+		capture panes.Capture
 	}
 
 	//go:embed icons/tower-256x256.png
@@ -198,6 +203,12 @@ func uiDraw(mgr *server.ConnectionManager, config *Config, p platform.Platform,
 				if imgui.IsItemHovered() {
 					imgui.SetTooltip("Resume simulation")
 				}
+				if imgui.Button(renderer.FontAwesomeIconStepForward) {
+					controlClient.SingleStepSim()
+				}
+				if imgui.IsItemHovered() {
+					imgui.SetTooltip("Advance simulation by one second")
+				}
 			} else {
 				if imgui.Button(renderer.FontAwesomeIconPauseCircle) {
 					controlClient.ToggleSimPause()
@@ -229,6 +240,13 @@ func uiDraw(mgr *server.ConnectionManager, config *Config, p platform.Platform,
 			if imgui.IsItemHovered() {
 				imgui.SetTooltip("Show departures, arrivals, approaches, overflights, and airspace awareness")
 			}
+
+			if imgui.Button(renderer.FontAwesomeIconCheckSquare) {
+				ui.showScore = !ui.showScore
+			}
+			if imgui.IsItemHovered() {
+				imgui.SetTooltip("Show controller performance score")
+			}
 		}
 
 		if imgui.Button(renderer.FontAwesomeIconKeyboard) {
@@ -292,6 +310,17 @@ func uiDraw(mgr *server.ConnectionManager, config *Config, p platform.Platform,
 			ui.showScenarioInfo = drawScenarioInfoWindow(config, controlClient, p, lg)
 		}
 
+		if ui.showScore {
+			if ui.scoreWindow == nil {
+				ui.scoreWindow = &ScoreWindow{}
+			}
+			ui.showScore = ui.scoreWindow.Draw(controlClient, p)
+		}
+
+		if controlClient.State.Lesson != nil {
+			drawLessonWindow(controlClient.State.Lesson)
+		}
+
 		uiDrawMissingPrimaryDialog(mgr, controlClient, p)
 
 		if ui.showLaunchControl {
@@ -324,6 +353,7 @@ func uiDraw(mgr *server.ConnectionManager, config *Config, p platform.Platform,
 
 func uiResetControlClient(c *server.ControlClient) {
 	ui.launchControlWindow = nil
+	ui.scoreWindow = nil
 }
 
 func drawActiveDialogBoxes() {
@@ -999,6 +1029,7 @@ altitude. (*TS* = 'then speed')`, "*TS210*"},
 	[3]string{"*C_appr", `"Cleared _appr_ approach."`, "*CI2L*"},
 	[3]string{"*TO*", `"Contact tower"`, "*TO*"},
 	[3]string{"*FC*", `"Contact _ctrl_ on _freq_, where _ctrl_ is the controller who has the track and _freq_ is their frequency."`, "*FC*"},
+	[3]string{"*FID*", `"Reset your flight ID," for aircraft downlinking the wrong one.`, "*FID*"},
 	[3]string{"*X*", "(Deletes the aircraft.)", "*X*"},
 }
 
@@ -1008,6 +1039,8 @@ var secondaryAcCommands = [][3]string{
 	[3]string{"*R_hdg", `"Turn right heading _hdg_".`, "*R210*"},
 	[3]string{"*T_deg*R", `"Turn _deg_ degrees right".`, "*T20R*"},
 	[3]string{"*D_fix*/H_hdg", `"Depart _fix_ heading _hdg_".`, "*DLENDY/H180*"},
+	[3]string{"*H_fix*/L*/EFC_time", `"Hold at _fix_, expect further clearance _time_."
+Right turns unless *L* is given; either or both of *L* and *EFC* may be omitted.`, "*HCAMRN/EFC1530*"},
 	[3]string{"*C_fix*/A_alt*/S_kts",
 		`"Cross _fix_ at _alt_ / _kts_ knots."
 Either one or both of *A* and *S* may be specified.`, "*CCAMRN/A110+*"},
@@ -1019,6 +1052,7 @@ Either one or both of *A* and *S* may be specified.`, "*CCAMRN/A110+*"},
 	[3]string{"*SA*", `"Say altitude".`, "*SA*"},
 	[3]string{"*SH*", `"Say heading".`, "*SH*"},
 	[3]string{"*SQ_code", `"Squawk _code_."`, "*SQ1200*"},
+	[3]string{"*SQ", `"Squawk _code_," re-issuing the assigned code.`, "*SQ*"},
 	[3]string{"*SQS", `"Squawk standby."`, "*SQS*"},
 	[3]string{"*SQA", `"Squawk altitude."`, "*SQA*"},
 	[3]string{"*SQON", `"Squawk on."`, "*SSON*"},
@@ -1027,8 +1061,11 @@ Either one or both of *A* and *S* may be specified.`, "*CCAMRN/A110+*"},
 	[3]string{"*CSI_appr", `"Cleared straight-in _appr_ approach.`, "*CSII6*"},
 	[3]string{"*I*", `"Intercept the localizer."`, "*I*"},
 	[3]string{"*ID*", `"Ident."`, "*ID*"},
+	[3]string{"*ATIS*", `"Verify you have information _X_."`, "*ATIS*"},
+	[3]string{"*APREQ*", `Requests a release for a held departure`, "*APREQ*"},
 	[3]string{"*CVS*", `"Climb via the SID"`, "*CVS*"},
 	[3]string{"*DVS*", `"Descend via the STAR"`, "*CVS*"},
+	[3]string{"*DEV*", `"Deviation approved" for a pilot's weather deviation request`, "*DEV*"},
 	[3]string{"*P*", `Pauses/unpauses the sim`, "*P*"},
 }
 
@@ -1350,6 +1387,27 @@ func uiDrawSettingsWindow(c *server.ControlClient, config *Config, p platform.Pl
 	if imgui.SliderFloatV("Simulation speed", &c.SimRate, 1, 20, "%.1f", 0) {
 		c.SetSimRate(c.SimRate)
 	}
+	ff := c.FastForwardRate != 0
+	if imgui.Checkbox("Fast-forward when no traffic needs attention", &ff) {
+		c.SetFastForwardRate(util.Select(ff, float32(4), 0))
+	}
+	if ff {
+		rate := c.FastForwardRate
+		if imgui.SliderFloatV("Fast-forward speed", &rate, 2, 8, "%.0fx", 0) {
+			c.SetFastForwardRate(rate)
+		}
+	}
+
+	imgui.Text("Rewind:")
+	for _, rw := range []struct {
+		label string
+		d     time.Duration
+	}{{"30 seconds", 30 * time.Second}, {"2 minutes", 2 * time.Minute}, {"5 minutes", 5 * time.Minute}} {
+		imgui.SameLine()
+		if imgui.Button(rw.label) {
+			c.Rewind(rw.d)
+		}
+	}
 
 	update := !config.InhibitDiscordActivity.Load()
 	imgui.Checkbox("Update Discord activity status", &update)
@@ -1378,6 +1436,8 @@ func uiDrawSettingsWindow(c *server.ControlClient, config *Config, p platform.Pl
 
 		imgui.Checkbox("Start in full-screen", &config.StartInFullScreen)
 
+		imgui.Checkbox("Reduce frame rate when idle", &config.ReduceIdleRendering)
+
 		monitorNames := p.GetAllMonitorNames()
 		if imgui.BeginComboV("Monitor", monitorNames[config.FullScreenMonitor], imgui.ComboFlagsHeightLarge) {
 			for index, monitor := range monitorNames {
@@ -1392,6 +1452,30 @@ func uiDrawSettingsWindow(c *server.ControlClient, config *Config, p platform.Pl
 		}
 	}
 
+	if imgui.CollapsingHeader("Screenshots") {
+		imgui.Checkbox("Capture the entire window rather than the active pane", &config.Capture.WholeWindow)
+		imgui.Checkbox("Anonymize callsigns", &config.Capture.AnonymizeCallsigns)
+		imgui.Checkbox("Add time and facility", &config.Capture.Watermark)
+		if imgui.Button("Save screenshot") {
+			ui.capture.CaptureNextFrame(config.Capture)
+		}
+
+		interval := int32(max(config.Capture.IntervalSeconds, 1))
+		if imgui.SliderIntV("Timed capture interval", &interval, 1, 120, "%d seconds", 0) {
+			config.Capture.IntervalSeconds = int(interval)
+		}
+		if ui.capture.TimedActive() {
+			if imgui.Button("Stop timed capture") {
+				ui.capture.StopTimed()
+			}
+		} else if imgui.Button("Start timed capture") {
+			ui.capture.StartTimed(config.Capture)
+		}
+		imgui.Text("Screenshots are saved in your home directory.")
+	}
+
+	panes.DrawPluginUI(config.DisplayRoot)
+
 	config.DisplayRoot.VisitPanes(func(pane panes.Pane) {
 		if draw, ok := pane.(panes.UIDrawer); ok {
 			if imgui.CollapsingHeader(draw.DisplayName()) {